@@ -0,0 +1,351 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/buildsafedev/bsf/cmd/styles"
+	"github.com/buildsafedev/bsf/pkg/attestation"
+	"github.com/buildsafedev/bsf/pkg/drift"
+	"github.com/buildsafedev/bsf/pkg/layout"
+	nixcmd "github.com/buildsafedev/bsf/pkg/nix/cmd"
+	"github.com/buildsafedev/bsf/pkg/oci"
+	"github.com/buildsafedev/bsf/pkg/receipt"
+	bsbom "github.com/buildsafedev/bsf/pkg/sbom"
+	"github.com/buildsafedev/bsf/pkg/signing"
+)
+
+var (
+	output           string
+	keyPath          string
+	insecureRegistry bool
+	root, pathsFile  string
+	image, sbomFile  string
+	format           string
+
+	certIdentity, certIssuer string
+)
+
+// AuditCmd represents the audit command
+var AuditCmd = &cobra.Command{
+	Use:   "audit",
+	Short: "audits published artifacts against their builds",
+	Long:  `used to check that what was published is what bsf built`,
+	Run: func(cmd *cobra.Command, args []string) {
+		fmt.Println(styles.HintStyle.Render("hint: use bsf audit with a subcomand"))
+		os.Exit(1)
+	},
+}
+
+var releaseCmd = &cobra.Command{
+	Use:   "release",
+	Short: "verifies a published image against its recorded build",
+	Long: `
+	Pulls the image of a release tag from the registry, recomputes the digests of its config and layers and compares
+	them with the image in the output directory, the image digest of its receipt and the subjects of its SBOM.
+	A different config means the tag was reused or the image tampered with in the registry.
+
+	bsf audit release <image:tag>
+	bsf audit release ghcr.io/acme/app:v1.2.0 --output bsf-result --key receipt.pub
+	`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		ref, err := oci.ParseReference(args[0])
+		if err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+			os.Exit(1)
+		}
+
+		recorded, err := recordedImage(filepath.Join(output, "result"))
+		if err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error: no image recorded in", output+":", err.Error()))
+			os.Exit(1)
+		}
+
+		fmt.Println(styles.HighlightStyle.Render(fmt.Sprintf("Pulling %s...", ref)))
+		published, discrepancies, err := auditRelease(ref, recorded)
+		if err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+			os.Exit(1)
+		}
+		if len(discrepancies) > 0 {
+			for _, d := range discrepancies {
+				fmt.Println(styles.ErrorStyle.Render("✘", d.What+":", d.Detail))
+			}
+			fmt.Println(styles.ErrorStyle.Render(fmt.Sprintf("error: %s does not match the build in %s", ref, output)))
+			os.Exit(1)
+		}
+		fmt.Println(styles.SucessStyle.Render(fmt.Sprintf("✔ %s matches the build in %s: config %s, %d layers", ref, output, published.Config, len(published.Layers))))
+	},
+}
+
+// auditRelease pulls the image and compares it with the recorded one, the receipt and the SBOM
+func auditRelease(ref *oci.Reference, recorded oci.ImageDigests) (oci.ImageDigests, []oci.Discrepancy, error) {
+	dir, err := os.MkdirTemp("", "bsf-audit-*")
+	if err != nil {
+		return oci.ImageDigests{}, nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+	defer cancel()
+	client := oci.NewClient()
+	client.Insecure = insecureRegistry
+	if _, err := client.PullDir(ctx, ref, dir); err != nil {
+		return oci.ImageDigests{}, nil, err
+	}
+	published, err := oci.DirDigests(dir)
+	if err != nil {
+		return oci.ImageDigests{}, nil, err
+	}
+
+	discrepancies := oci.CompareImages(published, recorded)
+	discrepancies = append(discrepancies, checkReceipt(published.Config)...)
+	discrepancies = append(discrepancies, checkSBOM(published.Config)...)
+	return published, discrepancies, nil
+}
+
+// recordedImage returns the digests of the image of the output directory. Images nix assembles on copy
+// have no manifest until they are pushed, only their config and layers are compared.
+func recordedImage(path string) (oci.ImageDigests, error) {
+	if d, err := oci.DirDigests(path); err == nil {
+		return d, nil
+	}
+	img, err := nixcmd.GetImage(path)
+	if err != nil {
+		return oci.ImageDigests{}, err
+	}
+	d := oci.ImageDigests{Config: "sha256:" + img.ConfigDigest}
+	for _, l := range img.Layers {
+		d.Layers = append(d.Layers, "sha256:"+l.Digest)
+	}
+	return d, nil
+}
+
+// checkReceipt compares the config digest with the image digest of the receipt of the output directory, when it has one
+func checkReceipt(config string) []oci.Discrepancy {
+	data, err := os.ReadFile(filepath.Join(output, receipt.Name))
+	if err != nil {
+		return nil
+	}
+
+	opts := receipt.OpenOptions{Identity: signing.Identity{Subject: certIdentity, Issuer: certIssuer}}
+	switch {
+	case keyPath != "":
+		pem, err := os.ReadFile(keyPath)
+		if err != nil {
+			return []oci.Discrepancy{{What: "receipt", Detail: err.Error()}}
+		}
+		if opts.Key, err = signing.ParsePublicKeyPEM(pem); err != nil {
+			return []oci.Discrepancy{{What: "receipt", Detail: err.Error()}}
+		}
+	case certIdentity != "" && certIssuer != "":
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		root, err := signing.FetchTrustRoot(ctx, signing.DefaultFulcioURL, signing.DefaultRekorURL, time.Hour)
+		if err != nil {
+			return []oci.Discrepancy{{What: "receipt", Detail: fmt.Sprintf("failed to fetch the trust root: %v", err)}}
+		}
+		opts.TrustRoot = root
+	}
+	r, _, err := receipt.Open(data, opts)
+	if err != nil && opts.Key == nil && opts.TrustRoot == nil {
+		fmt.Println(styles.WarnStyle.Render("warning: receipt not checked:", err.Error()))
+		return nil
+	}
+	if err != nil {
+		return []oci.Discrepancy{{What: "receipt", Detail: fmt.Sprintf("invalid receipt: %v", err)}}
+	}
+	if r.Image != nil && r.Image.Digest != config {
+		return []oci.Discrepancy{{What: "receipt", Detail: fmt.Sprintf("published config is %s, the receipt has %s", config, r.Image.Digest)}}
+	}
+	return nil
+}
+
+// checkSBOM checks that the published config is a subject of the SBOMs of the output directory
+func checkSBOM(config string) []oci.Discrepancy {
+	data, err := layout.ReadAttestations(output)
+	if err != nil {
+		return nil
+	}
+	psMap, err := attestation.ValidateInTotoStatement(data)
+	if err != nil {
+		return []oci.Discrepancy{{What: "sbom", Detail: err.Error()}}
+	}
+
+	statements := append(psMap["spdx"], psMap["cdx"]...)
+	if len(statements) == 0 {
+		return nil
+	}
+	digest := strings.TrimPrefix(config, "sha256:")
+	for _, st := range statements {
+		for _, s := range st.Subject {
+			if s.Digest["sha256"] == digest {
+				return nil
+			}
+		}
+	}
+	return []oci.Discrepancy{{What: "sbom", Detail: fmt.Sprintf("published config %s is not a subject of the SBOM", config)}}
+}
+
+var runtimeCmd = &cobra.Command{
+	Use:   "runtime",
+	Short: "detects the store paths of a running container its SBOM doesn't declare",
+	Long: `
+	Compares the store paths of a running container with the components of the SBOM of its build and reports the
+	drift: store paths present in the container but undeclared, e.g. installed or copied in after the build. The store
+	paths are listed from the root filesystem of the container, from a file listing them or its mounts, such as
+	/proc/<pid>/mountinfo, or from the layers of its image. Exits with status 1 on drift so runtime security agents
+	can run it as a hook, --format json prints the report for them.
+
+	bsf audit runtime --root /proc/4242/root
+	bsf audit runtime --paths /proc/4242/mountinfo --sbom sbom.spdx.json --format json
+	bsf audit runtime --image ghcr.io/acme/app@sha256:1a2b... --output bsf-result
+	`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		declared, err := declaredStorePaths()
+		if err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+			os.Exit(1)
+		}
+		observed, err := observedStorePaths()
+		if err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+			os.Exit(1)
+		}
+
+		report := drift.Compare(declared, observed)
+		switch format {
+		case "json":
+			data, err := json.MarshalIndent(report, "", "  ")
+			if err != nil {
+				fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+				os.Exit(1)
+			}
+			fmt.Println(string(data))
+		case "", "text":
+			for _, p := range report.Undeclared {
+				fmt.Println(styles.ErrorStyle.Render("✘ undeclared", p))
+			}
+			if len(report.Missing) > 0 {
+				fmt.Println(styles.TextStyle.Render(fmt.Sprintf("%d store paths of the SBOM are not in the container", len(report.Missing))))
+			}
+			if report.Drifted() {
+				fmt.Println(styles.ErrorStyle.Render(fmt.Sprintf("error: %d of %d store paths of the container are not declared by its SBOM", len(report.Undeclared), report.Observed)))
+			} else {
+				fmt.Println(styles.SucessStyle.Render(fmt.Sprintf("✔ the %d store paths of the container are declared by its SBOM", report.Observed)))
+			}
+		default:
+			fmt.Println(styles.ErrorStyle.Render("error:", fmt.Sprintf("unknown format %q, use text or json", format)))
+			os.Exit(1)
+		}
+		if report.Drifted() {
+			os.Exit(1)
+		}
+	},
+}
+
+// declaredStorePaths returns the store paths of the SBOM file, or of the SBOM of the output directory
+func declaredStorePaths() ([]string, error) {
+	var data []byte
+	var err error
+	if sbomFile != "" {
+		data, err = os.ReadFile(sbomFile)
+	} else {
+		data, err = layout.ReadAttestations(output)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !bsbom.IsDocument(data) {
+		if data, err = bsbom.PredicateFromAttestations(data); err != nil {
+			return nil, err
+		}
+	}
+	doc, err := bsbom.Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse SBOM: %v", err)
+	}
+	declared := drift.Declared(doc)
+	if len(declared) == 0 {
+		return nil, fmt.Errorf("the SBOM has no store paths, it wasn't generated by bsf")
+	}
+	return declared, nil
+}
+
+// observedStorePaths returns the store paths of the container given by --root, --paths or --image
+func observedStorePaths() ([]string, error) {
+	set := 0
+	for _, s := range []string{root, pathsFile, image} {
+		if s != "" {
+			set++
+		}
+	}
+	if set != 1 {
+		return nil, fmt.Errorf("pass one of --root, --paths or --image")
+	}
+
+	switch {
+	case root != "":
+		return drift.RootStorePaths(root)
+	case pathsFile == "-":
+		return drift.ReadStorePaths(os.Stdin)
+	case pathsFile != "":
+		f, err := os.Open(pathsFile)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		return drift.ReadStorePaths(f)
+	}
+
+	// the manifest of an image digest is pulled as a tag is
+	name, digest, byDigest := strings.Cut(image, "@")
+	ref, err := oci.ParseReference(name)
+	if err != nil {
+		return nil, err
+	}
+	if byDigest {
+		ref.Tag = digest
+	}
+	dir, err := os.MkdirTemp("", "bsf-audit-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+	defer cancel()
+	client := oci.NewClient()
+	client.Insecure = insecureRegistry
+	if _, err := client.PullDir(ctx, ref, dir); err != nil {
+		return nil, err
+	}
+	return drift.ImageStorePaths(dir)
+}
+
+func init() {
+	releaseCmd.Flags().StringVarP(&output, "output", "o", "bsf-result", "output directory of the build the image was pushed from")
+	releaseCmd.Flags().StringVarP(&keyPath, "key", "", "", "PEM encoded public key the receipt was signed with, receipts of trusted builders are checked against --certificate-identity")
+	releaseCmd.Flags().StringVarP(&certIdentity, "certificate-identity", "", "", "identity the certificate of a keyless receipt must be issued for")
+	releaseCmd.Flags().StringVarP(&certIssuer, "certificate-oidc-issuer", "", "", "OIDC issuer of the identity of a keyless receipt")
+	releaseCmd.Flags().BoolVarP(&insecureRegistry, "insecure-registry", "", false, "pull from the registry over plain HTTP")
+	AuditCmd.AddCommand(releaseCmd)
+
+	runtimeCmd.Flags().StringVarP(&output, "output", "o", "bsf-result", "output directory of the build whose SBOM declares the store paths")
+	runtimeCmd.Flags().StringVarP(&sbomFile, "sbom", "", "", "SBOM or attestations file declaring the store paths, instead of the SBOM of the output directory")
+	runtimeCmd.Flags().StringVarP(&root, "root", "", "", "root filesystem of the container, e.g. /proc/<pid>/root")
+	runtimeCmd.Flags().StringVarP(&pathsFile, "paths", "", "", "file listing the store paths of the container or its mounts, e.g. /proc/<pid>/mountinfo, - for stdin")
+	runtimeCmd.Flags().StringVarP(&image, "image", "", "", "image of the container, pulled from the registry, e.g. ghcr.io/acme/app:v1.2.0")
+	runtimeCmd.Flags().BoolVarP(&insecureRegistry, "insecure-registry", "", false, "pull from the registry over plain HTTP")
+	runtimeCmd.Flags().StringVarP(&format, "format", "", "text", "format of the report: text or json")
+	AuditCmd.AddCommand(runtimeCmd)
+}
@@ -0,0 +1,175 @@
+package bench
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/pprof"
+	"runtime/trace"
+
+	"github.com/bom-squad/protobom/pkg/formats"
+	"github.com/bom-squad/protobom/pkg/sbom"
+	"github.com/spf13/cobra"
+
+	"github.com/buildsafedev/bsf/cmd/styles"
+	"github.com/buildsafedev/bsf/pkg/depgraph"
+	"github.com/buildsafedev/bsf/pkg/hcl2nix"
+	nixcmd "github.com/buildsafedev/bsf/pkg/nix/cmd"
+	bsbom "github.com/buildsafedev/bsf/pkg/sbom"
+	"github.com/buildsafedev/bsf/pkg/timing"
+)
+
+var (
+	cpuProfile, memProfile, traceFile string
+	count, depth                      int
+	noHashCache                       bool
+)
+
+func init() {
+	BenchCmd.Flags().StringVarP(&cpuProfile, "cpuprofile", "", "", "write a CPU profile to the file")
+	BenchCmd.Flags().StringVarP(&memProfile, "memprofile", "", "", "write a heap profile to the file")
+	BenchCmd.Flags().StringVarP(&traceFile, "trace", "", "", "write an execution trace to the file, phases show up as regions")
+	BenchCmd.Flags().IntVarP(&count, "count", "n", 1, "number of times to run the pipeline")
+	BenchCmd.Flags().IntVarP(&depth, "quick-depth", "", 0, "benchmark --quick mode with this annotation depth")
+	BenchCmd.Flags().BoolVarP(&noHashCache, "no-hash-cache", "", false, "benchmark cold runs, hashing the closure paths again instead of reusing the cached hashes")
+}
+
+// BenchCmd represents the bench command
+var BenchCmd = &cobra.Command{
+	Use:   "bench",
+	Short: "bench measures the SBOM pipeline on a store path",
+	Long: `bench runs the closure annotation and SBOM generation of bsf build against an existing store path
+	and prints how long each phase took. CPU and heap profiles can be written for go tool pprof.
+
+	bsf bench /nix/store/...-myapp-1.0.0
+	bsf bench ./bsf-result/result --cpuprofile cpu.out --memprofile mem.out -n 3
+	`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) != 1 {
+			fmt.Println(styles.HintStyle.Render("hint:", "run `bsf bench <store path>`"))
+			os.Exit(1)
+		}
+
+		storePath, err := filepath.EvalSymlinks(args[0])
+		if err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+			os.Exit(1)
+		}
+
+		// the pipeline reads the build result through a symlink, like bsf build does
+		dir, err := os.MkdirTemp("", "bsf-bench-")
+		if err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+			os.Exit(1)
+		}
+		defer os.RemoveAll(dir)
+		if err := os.Symlink(storePath, filepath.Join(dir, "result")); err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+			os.Exit(1)
+		}
+
+		stopProfiles, err := startProfiles()
+		if err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+			os.Exit(1)
+		}
+
+		rec := timing.NewRecorder()
+		for i := 0; i < count; i++ {
+			err = run(rec, dir+"/", "result")
+			if err != nil {
+				stopProfiles()
+				fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+				os.Exit(1)
+			}
+		}
+
+		err = stopProfiles()
+		if err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+			os.Exit(1)
+		}
+
+		fmt.Println(styles.SucessStyle.Render(fmt.Sprintf("ran the pipeline %d time(s) on %s", count, storePath)))
+		rec.Report(os.Stdout)
+	},
+}
+
+// run executes the pipeline bsf build runs after nix build
+func run(rec *timing.Recorder, output, symlink string) error {
+	app, graph, err := nixcmd.GetRuntimeClosureGraph("bench", output, symlink, nixcmd.ClosureOptions{
+		Depth:       depth,
+		Timer:       rec,
+		NoHashCache: noHashCache,
+	})
+	if err != nil {
+		return err
+	}
+
+	stop := rec.Start("build sbom")
+	appNode := &sbom.Node{
+		Id:             bsbom.GenerateID(app.Name, app.Version, "", ""),
+		PrimaryPurpose: []sbom.Purpose{sbom.Purpose_APPLICATION},
+		Name:           app.Name,
+	}
+	bom := bsbom.PackageGraphToSBOM(appNode, &hcl2nix.LockFile{}, depgraph.FromDOT(graph))
+	stop()
+
+	for _, format := range []formats.Format{formats.SPDX23JSON, formats.CDX15JSON} {
+		stop = rec.Start("serialize " + string(format))
+		_, err = bsbom.NewStatement(app).ToJSON(bom, format)
+		stop()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// startProfiles starts the requested CPU profile and trace, the returned function stops them and writes the heap profile
+func startProfiles() (func() error, error) {
+	var cpuFile, tFile *os.File
+	var err error
+	if cpuProfile != "" {
+		cpuFile, err = os.Create(cpuProfile)
+		if err != nil {
+			return nil, err
+		}
+		if err := pprof.StartCPUProfile(cpuFile); err != nil {
+			return nil, err
+		}
+	}
+	if traceFile != "" {
+		tFile, err = os.Create(traceFile)
+		if err != nil {
+			return nil, err
+		}
+		if err := trace.Start(tFile); err != nil {
+			return nil, err
+		}
+	}
+
+	return func() error {
+		if cpuFile != nil {
+			pprof.StopCPUProfile()
+			cpuFile.Close()
+		}
+		if tFile != nil {
+			trace.Stop()
+			tFile.Close()
+		}
+		if memProfile == "" {
+			return nil
+		}
+
+		f, err := os.Create(memProfile)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		// get up-to-date statistics
+		runtime.GC()
+		return pprof.WriteHeapProfile(f)
+	}, nil
+}
@@ -0,0 +1,144 @@
+package build
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/buildsafedev/bsf/cmd/styles"
+	"github.com/buildsafedev/bsf/pkg/builddb"
+	"github.com/buildsafedev/bsf/pkg/deadline"
+	"github.com/buildsafedev/bsf/pkg/events"
+	"github.com/buildsafedev/bsf/pkg/layout"
+	"github.com/buildsafedev/bsf/pkg/shutdown"
+)
+
+// IncompleteName is the report of a build stopped by --max-duration
+const IncompleteName = "incomplete.json"
+
+// Incomplete records how far a build stopped by its time budget got, the outputs of the completed phases are kept
+type Incomplete struct {
+	Budget    string   `json:"budget"`
+	Elapsed   string   `json:"elapsed"`
+	Completed []string `json:"completed"`
+	StoppedIn string   `json:"stoppedIn"`
+}
+
+// budget tracks the phases of the build, so a build out of time stops at the next phase boundary
+// and records what it completed. The phases are streamed as events. A build that fails or is interrupted before it is
+// recorded is recorded as failed in the phase it stopped in, the partial outputs of the phase are removed.
+type budget struct {
+	output           string
+	project, variant string
+	completed        []string
+	current          string
+	// recorded is set once the build is recorded in the build database
+	recorded bool
+	// finished emits the end of the current phase
+	finished func(error)
+}
+
+func newBudget(output, project, variant string) *budget {
+	b := &budget{output: output, project: project, variant: variant}
+	// the watchdog stops builds stuck in a phase that doesn't run external commands
+	deadline.OnExpire(b.persist)
+	shutdown.Register(b.abort)
+	return b
+}
+
+// start starts the phase, unless the budget ran out
+func (b *budget) start(phase string) {
+	if b.current != "" {
+		b.completed = append(b.completed, b.current)
+		b.end(nil)
+	}
+	b.current = phase
+	b.finished = events.Phase(phase)
+	if deadline.Exceeded() {
+		b.stop()
+	}
+}
+
+// check stops the build if err was caused by the budget running out. The build stops on other errors as well, the
+// current phase ends with err.
+func (b *budget) check(err error) {
+	if errors.Is(err, deadline.ErrExceeded) || deadline.Exceeded() {
+		b.stop()
+	}
+	b.end(err)
+}
+
+func (b *budget) stop() {
+	b.persist()
+	b.end(deadline.ErrExceeded)
+	fmt.Println(styles.ErrorStyle.Render(fmt.Sprintf("error: %s after %s in the %s phase", deadline.ErrExceeded, deadline.Elapsed().Round(time.Second), b.current)))
+	if len(b.completed) > 0 {
+		fmt.Println(styles.HintStyle.Render(fmt.Sprintf("hint: the outputs of the completed phases are in %s, see %s", b.output, IncompleteName)))
+	}
+	shutdown.Exit(deadline.ExitCode, deadline.ErrExceeded)
+}
+
+// fail stops the build on the error, its message was printed
+func (b *budget) fail(err error) {
+	shutdown.Exit(1, err)
+}
+
+// abort cleans up after the build stopped by cause: the current phase ends with it, the files it left in the output
+// directory are removed and the build is recorded as failed, unless it was recorded already
+func (b *budget) abort(cause error) {
+	b.end(cause)
+	if l, err := layout.Open(b.output); err == nil {
+		if swept, err := l.Sweep(); err != nil {
+			fmt.Println(styles.WarnStyle.Render("warning: failed to clean up the output directory:", err.Error()))
+		} else if swept > 0 {
+			fmt.Println(styles.TextStyle.Render(fmt.Sprintf("Removed %d partial outputs of the build from %s", swept, b.output)))
+		}
+	}
+	if b.recorded {
+		return
+	}
+	r := builddb.Failure(b.project, b.variant, b.current, cause)
+	r.Builder = builderFingerprint()
+	if err := builddb.Append(r); err != nil {
+		fmt.Println(styles.WarnStyle.Render("warning: failed to record the failed build:", err.Error()))
+	}
+}
+
+// finish ends the last phase of the build
+func (b *budget) finish() {
+	if b.current != "" {
+		b.completed = append(b.completed, b.current)
+		b.end(nil)
+		b.current = ""
+	}
+}
+
+// end emits the end of the current phase, once
+func (b *budget) end(err error) {
+	if b.finished != nil {
+		b.finished(err)
+		b.finished = nil
+	}
+}
+
+// persist records the completed phases in the output directory
+func (b *budget) persist() {
+	l, err := layout.Open(b.output)
+	if err != nil {
+		return
+	}
+	data, err := json.MarshalIndent(Incomplete{
+		Budget:    deadline.Budget().String(),
+		Elapsed:   deadline.Elapsed().Round(time.Second).String(),
+		Completed: b.completed,
+		StoppedIn: b.current,
+	}, "", "  ")
+	if err != nil {
+		return
+	}
+	if _, err := l.Add(layout.KindReport, IncompleteName, "application/json", data); err != nil {
+		return
+	}
+	l.Write()
+}
@@ -1,36 +1,127 @@
 package build
 
 import (
+	"bytes"
+	"context"
+	"crypto"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
 	"runtime"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/awalterschulze/gographviz"
 	"github.com/bom-squad/protobom/pkg/formats"
 	"github.com/bom-squad/protobom/pkg/sbom"
 	"github.com/spf13/cobra"
 
+	"github.com/buildsafedev/bsf/cmd/configure"
 	binit "github.com/buildsafedev/bsf/cmd/init"
 	"github.com/buildsafedev/bsf/cmd/styles"
+	"github.com/buildsafedev/bsf/pkg/anomaly"
+	"github.com/buildsafedev/bsf/pkg/catalog"
+	"github.com/buildsafedev/bsf/pkg/cbom"
+	"github.com/buildsafedev/bsf/pkg/clients/pkgregistry"
+	"github.com/buildsafedev/bsf/pkg/config"
+	"github.com/buildsafedev/bsf/pkg/deadline"
+	"github.com/buildsafedev/bsf/pkg/depgraph"
+	"github.com/buildsafedev/bsf/pkg/egress"
+	"github.com/buildsafedev/bsf/pkg/embedded"
+	"github.com/buildsafedev/bsf/pkg/events"
+	"github.com/buildsafedev/bsf/pkg/flakelock"
 	"github.com/buildsafedev/bsf/pkg/generate"
 	bgit "github.com/buildsafedev/bsf/pkg/git"
+	"github.com/buildsafedev/bsf/pkg/hardening"
 	"github.com/buildsafedev/bsf/pkg/hcl2nix"
+	"github.com/buildsafedev/bsf/pkg/imagesize"
 	"github.com/buildsafedev/bsf/pkg/langdetect"
+	"github.com/buildsafedev/bsf/pkg/layout"
+	"github.com/buildsafedev/bsf/pkg/loader"
 	nixcmd "github.com/buildsafedev/bsf/pkg/nix/cmd"
+	"github.com/buildsafedev/bsf/pkg/nixmeta"
+	"github.com/buildsafedev/bsf/pkg/osv"
+	"github.com/buildsafedev/bsf/pkg/policy"
 	"github.com/buildsafedev/bsf/pkg/provenance"
+	"github.com/buildsafedev/bsf/pkg/provides"
+	"github.com/buildsafedev/bsf/pkg/receipt"
 	bsbom "github.com/buildsafedev/bsf/pkg/sbom"
+	"github.com/buildsafedev/bsf/pkg/schedule"
+	"github.com/buildsafedev/bsf/pkg/shutdown"
+	"github.com/buildsafedev/bsf/pkg/signing"
+	"github.com/buildsafedev/bsf/pkg/telemetry"
+	"github.com/buildsafedev/bsf/pkg/vex"
+	"github.com/buildsafedev/bsf/pkg/workload"
+	"github.com/buildsafedev/bsf/pkg/workspace"
 )
 
 var (
-	output string
+	output                         string
+	verifyInputs, verifySignatures bool
+	quick, noRealise, noHashCache  bool
+	checkStore, repairStore        bool
+	buildClosure, sliceSBOMs       bool
+	criticalPath                   bool
+	trustedBuilder, sign           bool
+	receiptKey                     string
+	quickDepth                     int
+	outputs                        []string
+	sbomFormats                    []string
+	scan, deep                     bool
+	osvDBs                         []string
+	vexFormat, failOn              string
+	catalogLocation                string
+	enforceCatalog                 bool
+	policyReport                   string
+	appVersion                     string
+	enrichTimeout                  time.Duration
+	projects                       []string
+	allProjects, matrix            bool
+	jobs                           int
+	variant                        string
+	egressProxy                    bool
 )
 
 func init() {
 	BuildCmd.Flags().StringVarP(&output, "output", "o", "", "location of the build artifacts generated")
+	BuildCmd.Flags().BoolVarP(&verifyInputs, "verify-inputs", "", false, "verify flake inputs match their locked narHash before building")
+	BuildCmd.Flags().BoolVarP(&verifySignatures, "verify-signatures", "", false, "also check that commits of flake inputs are signed (implies --verify-inputs)")
+	BuildCmd.Flags().BoolVarP(&quick, "quick", "", false, "only fully annotate the top levels of the dependency graph, deeper dependencies are recorded with their hash only")
+	BuildCmd.Flags().IntVarP(&quickDepth, "quick-depth", "", 2, "number of dependency levels fully annotated in --quick mode")
+	BuildCmd.Flags().BoolVarP(&trustedBuilder, "trusted-builder", "", false, "sign attestations with an ephemeral key bound to the CI workload identity and record the runner in provenance")
+	BuildCmd.Flags().BoolVarP(&sign, "sign", "", false, "sign the SBOM and provenance attestations keyless with sigstore, as the CI workload identity or the OIDC token of $"+workload.TokenEnv)
+	BuildCmd.Flags().StringVarP(&receiptKey, "receipt-key", "", "", "PEM encoded ECDSA private key to sign a build receipt with, receipts are signed with the signing identity with --sign or --trusted-builder")
+	BuildCmd.Flags().BoolVarP(&noRealise, "no-realise", "", false, "fail instead of re-substituting closure paths that were garbage collected")
+	BuildCmd.Flags().BoolVarP(&checkStore, "check-store", "", false, "hash the closure paths again and report the ones that don't hash to the NAR hash the store recorded, e.g. corrupted on disk")
+	BuildCmd.Flags().BoolVarP(&repairStore, "repair", "", false, "check the closure paths as --check-store does and repair the corrupted ones with nix store repair, which substitutes or rebuilds them")
+	BuildCmd.Flags().BoolVarP(&noHashCache, "no-hash-cache", "", false, "hash every closure path the store has no NAR hash of, instead of reusing the hashes of previous builds")
+	BuildCmd.Flags().StringSliceVarP(&outputs, "outputs", "", nil, "other outputs of the package to include in the SBOM as root components, e.g. man,lib. They share the closure annotation of the application")
+	BuildCmd.Flags().BoolVarP(&egressProxy, "egress-proxy", "", false, "route the downloads of fixed-output derivations through a local proxy and record them in the provenance")
+	BuildCmd.Flags().BoolVarP(&buildClosure, "build-closure", "", false, "also record the build-time closure, the derivations and sources the result was built from, in a build SBOM and as the resolved dependencies of the provenance")
+	BuildCmd.Flags().BoolVarP(&criticalPath, "critical-path", "", false, "time the derivations nix builds and write the critical path, parallelism profile and scheduling hints of the build to schedule.json")
+	BuildCmd.Flags().BoolVarP(&sliceSBOMs, "slice-sboms", "", false, "experimental: also write a SBOM for each architecture of a universal macOS binary")
+	BuildCmd.Flags().StringSliceVarP(&sbomFormats, "format", "", []string{"spdx-json", "cyclonedx-json"}, "formats of the SBOMs written to the output directory: spdx-json, cyclonedx-json or protobom")
+	BuildCmd.Flags().BoolVarP(&scan, "scan", "", false, "scan the closure for OSV vulnerabilities and write a VEX document of the findings")
+	BuildCmd.Flags().StringSliceVarP(&osvDBs, "osv-db", "", nil, "scan offline with OSV databases fetched with bsf db fetch, e.g. osv/PyPI, instead of querying osv.dev (implies --scan)")
+	BuildCmd.Flags().StringVarP(&vexFormat, "vex-format", "", vex.FormatOpenVEX, "format of the VEX document: openvex or cyclonedx")
+	BuildCmd.Flags().StringVarP(&failOn, "fail-on", "", "", "fail the build when a vulnerability of this severity or higher affects the application: low, medium, high or critical (implies --scan)")
+	BuildCmd.Flags().StringVarP(&catalogLocation, "catalog", "", "", "approved package catalog to check the closure against, a path or an https:// URL, defaults to catalog in ~/.bsf.json")
+	BuildCmd.Flags().BoolVarP(&enforceCatalog, "enforce-catalog", "", false, "fail the build when components of the closure are neither approved by the catalog nor exempted in bsf.hcl")
+	BuildCmd.Flags().StringVarP(&policyReport, "policy-report", "", "", "also write the check of the closure against the policy block of bsf.hcl to this file, e.g. for CI to annotate the violations")
+	BuildCmd.Flags().StringVarP(&appVersion, "app-version", "", "", "version of the application in the SBOM and provenance, resolved from its derivation, store path or the nearest git tag otherwise")
+	BuildCmd.Flags().DurationVarP(&enrichTimeout, "enrich-timeout", "", 0, "write the SBOM once the package registry and nixpkgs metadata of the closure are resolved or this long, e.g. 2m, components resolved later are flagged as pending enrichment")
+	BuildCmd.Flags().BoolVarP(&deep, "deep", "", false, "also record the files of the closure in the SBOM, as files of the components providing them, and index them for bsf provides")
+	BuildCmd.Flags().StringSliceVarP(&projects, "projects", "", nil, "build these projects of the workspace concurrently, e.g. services/api,services/worker")
+	BuildCmd.Flags().BoolVarP(&allProjects, "workspace", "", false, "build every project in the subdirectories concurrently")
+	BuildCmd.Flags().IntVarP(&jobs, "jobs", "j", 2, "number of projects of the workspace built at once")
+	BuildCmd.Flags().StringVarP(&variant, "variant", "", "", "build this variant of bsf.hcl instead of the package as declared, its output directory defaults to bsf-result-<variant>")
+	BuildCmd.Flags().BoolVarP(&matrix, "matrix", "", false, "build the package and each variant of bsf.hcl, each in a directory of the output named after it, and compare their closures")
+	workspace.MarkPaths(BuildCmd.Flags(), "output", "receipt-key", "projects", "policy-report")
 }
 
 // BuildCmd represents the build command
@@ -40,8 +131,200 @@ var BuildCmd = &cobra.Command{
 	Long: `builds the project based on instructions defined in bsf.hcl.
 	Build occurs in a sandboxed environment where only current directory is available. 
 	It is recommended to check in the files in version control system(ex: Git) before building.
+
+	Artifacts, SBOMs, attestations and logs are stored by digest in the output directory and listed in its index.json.
+	The attestations hold the SPDX and CycloneDX SBOMs, --format picks the standalone SBOMs written next to them:
+
+	bsf build --format spdx-json,protobom
+
+	The application is versioned with the version of its derivation, or of its store path, or else with the nearest
+	git tag of the project, e.g. 1.2.0-3-g1a2b3c4. --app-version sets it explicitly:
+
+	bsf build --app-version 1.2.0
+
+	The runtime dependencies outside of the closure, such as databases and external APIs, are declared in requires
+	blocks of bsf.hcl. They are components of the SBOM the application has as a prerequisite:
+
+	requires "postgres" {
+	  version = ">= 14"
+	}
+
+	requires "stripe" {
+	  kind = "service"
+	  url  = "https://api.stripe.com"
+	}
+
+	The provenance is a SLSA v1 statement whose subjects are the digests of the binary and of the result. With --sign,
+	the attestations are signed keyless with sigstore and recorded in its transparency log, as the CI workload identity
+	or the identity of the OIDC token in $SIGSTORE_ID_TOKEN, e.g. obtained with cosign login flows. Every signed
+	attestation and the receipt are written as sigstore v0.3 bundles holding the signature, the certificate and the
+	Rekor inclusion proof, as cosign v2 verifies them:
+
+	SIGSTORE_ID_TOKEN=$(gcloud auth print-identity-token --audiences=sigstore) bsf build --sign
+
+	With --build-closure, the derivations, sources and toolchain the result was built from are recorded too, in
+	build-sbom.spdx.json and as the resolved dependencies of the provenance.
+
+	With --egress-proxy, the fixed-output derivations nix builds, the only ones reaching the network, are routed
+	through a local proxy recording every request. The requests are byproducts of the provenance, with the digest of
+	plain HTTP downloads and the host of HTTPS ones, which the output hash of the derivation verifies. Paths already in
+	the store or substituted aren't fetched, so aren't recorded. A nix daemon applies the proxy to its builds when the
+	user is trusted and supports the configurable-impure-env experimental feature.
+
+	With --critical-path, the derivations nix builds are timed and schedule.json records the critical path of the
+	derivation graph, the chain of builds that bounds the build however many builders there are, how many derivations
+	could build at once and the order a build farm should start them in. Substituted derivations take no time. See it
+	as a Gantt chart with bsf report schedule.
+
+	The slices of universal macOS binaries are recorded as components of the application, with their digests.
+	With --slice-sboms, a SBOM of each architecture is written too, e.g. slice-arm64-sbom.spdx.json.
+
+	The SBOM of a multi-platform image records the image of each platform as a component. A SBOM of each platform is
+	written too, e.g. platform-linux-arm64-sbom.spdx.json, and index-sbom.cdx.json references them with the platform
+	they select. bsf oci --push attaches them to the manifest of their platform and to the image index.
+
+	With --scan, the components of the closure with an upstream package url are matched against OSV and their
+	vulnerabilities written in vex.openvex.json. Components the entrypoints don't load are not affected.
+	--fail-on fails the build, after the artifacts are written, when an affecting vulnerability is severe enough.
+	Vulnerabilities of unknown severity, e.g. only rated with CVSS v4, fail --fail-on low:
+
+	bsf build --fail-on high --osv-db osv/PyPI
+
+	The closure is checked against the approved package catalog of the organization given with --catalog or set as
+	catalog in ~/.bsf.json, a JSON list of package names and version ranges. Packages it doesn't approve are
+	reported in catalog.json with the exemption blocks to request, exemption blocks of bsf.hcl exempt them:
+
+	exemption "openssl" {
+	  version = "1.1.1w"
+	  reason  = "SEC-1234, legacy client until 2026-12"
+	  expires = "2026-12-31"
+	}
+
+	--enforce-catalog fails the build, after the artifacts are written, when components are neither approved nor
+	exempted.
+
+	The closure is checked against the policy block of bsf.hcl, if any: the licenses its components may or may not
+	have, the packages banned from it and its maximum size and number of store paths. The build fails, after the
+	artifacts are written, when the policy is violated. The violations are reported in policy.json and in the file
+	given with --policy-report:
+
+	policy {
+	  denied_licenses  = ["AGPL-3.0-only", "SSPL-1.0"]
+	  max_closure_size = "512MiB"
+	  max_paths        = 400
+
+	  ban "openssl" {
+	    versions = "<3"
+	    reason   = "OpenSSL 1.1 is end of life"
+	  }
+
+	  hardening {
+	    require_pie   = true
+	    require_relro = "full"
+	    deny_setuid   = true
+	  }
+
+	  ignore "mongodb" {
+	    rule    = "denied-license"
+	    owner   = "legal@example.com"
+	    expires = "2026-12-31"
+	    reason  = "LEGAL-42, replaced by postgres in Q4"
+	  }
+	}
+
+	The executables of the result are analyzed in hardening.json: whether they are PIE, their RELRO, NX stack, stack
+	protector and FORTIFY_SOURCE, their setuid bits and file capabilities and the TLS library they load or link in.
+	The hardening block of the policy fails the executables lacking the mitigations it requires, or privileged.
+
+	The cryptography of the closure is inventoried in cbom.cdx.json, a CycloneDX 1.6 cryptography bill of materials:
+	the cryptographic libraries of the closure, whether they ship a FIPS module such as the fips provider of OpenSSL,
+	and the algorithms and protocols the executables use, from the symbols they import from these libraries or the Go
+	packages they are built with. Algorithms are flagged when FIPS 140-3 doesn't approve them, and rated with their
+	NIST post-quantum security level, 0 for those quantum computers break, for FIPS and post-quantum assessments.
+
+	Ignore blocks except a component, or every component with "*", from a rule of the policy until their expiry
+	date. They name the owner of the exception, are reported in policy.json, warned about two weeks before they
+	lapse and fail the build once lapsed, until they are renewed or removed.
+
+	The closure is annotated with the metadata of the package registry and of nixpkgs before the SBOM is written.
+	With --enrich-timeout, the SBOM is written once the timeout passed, the components whose metadata wasn't resolved
+	yet are flagged as pending enrichment and bsf enrich completes them later:
+
+	bsf build --enrich-timeout 2m && bsf enrich bsf-result
+
+	With --deep, the files of the closure are recorded in the SBOM as files of the components providing them, and
+	indexed in provides.json, where bsf provides finds which store path provides a file. The python packages of
+	site-packages (wheel METADATA) and the libraries of JARs (pom.properties, or the manifest) embedded in a store
+	path are recorded as components it contains, and scanned with --scan:
+
+	bsf build --deep && bsf provides libssl.so.3
+
+	Builds are recorded in a local build database, with the size of their closure, its components, licenses and, with
+	--scan, open vulnerabilities. bsf report trends shows how they evolve across builds.
+
+	A build that fails or is interrupted (SIGINT, SIGTERM or --max-duration) removes the partial outputs it left in
+	the output directory, such as temporary files, SBOMs it didn't index and dangling links, and is recorded as failed
+	in the build database with the phase it stopped in and why.
+
+	With --projects or --workspace, the projects of a workspace are built concurrently, --jobs at a time, each in its
+	own output directory. They share the nixpkgs metadata and nix evaluation caches, and split the --max-jobs and
+	--hash-workers budgets, one worker per CPU by default. The logs of the builds and workspace-summary.json are
+	written to the output directory of the workspace:
+
+	bsf build --workspace --jobs 4
+
+	Variant blocks of bsf.hcl declare other builds of the package, such as a debug build or a FIPS build, from
+	another flake attribute or with overridden arguments of the package or attributes of its derivation. --variant
+	builds one, to bsf-result-<variant> by default, its SBOM labeled with the variant and its builds recorded apart:
+
+	variant "fips" {
+	  override = { openssl = "pkgs.openssl_3_fips" }
+	}
+
+	variant "debug" {
+	  override_attrs = { dontStrip = "true" }
+	}
+
+	--matrix builds the package and each variant, one after the other, each with its artifacts and SBOMs in a directory
+	of the output named after it. The components whose versions differ between the variants are printed and written
+	to matrix-summary.json with the logs of the builds:
+
+	bsf build --matrix
 	`,
 	Run: func(cmd *cobra.Command, args []string) {
+		shutdown.Notify()
+		if len(projects) > 0 || allProjects {
+			runWorkspace(cmd)
+			return
+		}
+		if matrix {
+			if variant != "" {
+				fmt.Println(styles.ErrorStyle.Render("error:", "--matrix builds every variant, it can't be combined with --variant"))
+				os.Exit(1)
+			}
+			runMatrix(cmd)
+			return
+		}
+
+		sbomFmts, err := parseFormats(sbomFormats)
+		if err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+			os.Exit(1)
+		}
+		if _, err = vex.FileName(vexFormat); err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+			os.Exit(1)
+		}
+		threshold := osv.SeverityUnknown
+		if failOn != "" {
+			threshold, err = osv.ParseSeverity(failOn)
+			if err != nil {
+				fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+				os.Exit(1)
+			}
+		}
+		scan = scan || failOn != "" || len(osvDBs) > 0
+
 		sc, fh, err := binit.GetBSFInitializers()
 		if err != nil {
 			fmt.Println(styles.ErrorStyle.Render("error: ", err.Error()))
@@ -54,8 +337,24 @@ var BuildCmd = &cobra.Command{
 			os.Exit(1)
 		}
 
+		lockFile, err := hcl2nix.ReadLockFile()
+		if err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+			os.Exit(1)
+		}
+		var buildVar *hcl2nix.Variant
+		if variant != "" {
+			if buildVar, err = lockedVariant(lockFile, variant); err != nil {
+				fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+				os.Exit(1)
+			}
+		}
+
 		if output == "" {
 			output = "bsf-result"
+			if buildVar != nil {
+				output += "-" + buildVar.Name
+			}
 		}
 
 		err = bgit.Add("bsf/")
@@ -74,136 +373,1540 @@ var BuildCmd = &cobra.Command{
 			fmt.Println(styles.ErrorStyle.Render("error fetching symlink: ", err.Error()))
 			os.Exit(1)
 		}
-		err = nixcmd.Build(output+"/result", "bsf/.")
+
+		// the identity of a trusted builder is recorded in the provenance, others only sign. It is detected before the
+		// build to fail early, the token is requested again right before signing.
+		var identity, signingIdentity *workload.Identity
+		if trustedBuilder {
+			identity, err = workload.Detect(context.Background(), "sigstore")
+			signingIdentity = identity
+		} else if sign {
+			signingIdentity, err = workload.Signing(context.Background(), "sigstore")
+		}
+		if err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+			os.Exit(1)
+		}
+
+		var inputs []flakelock.Verification
+		if verifyInputs || verifySignatures {
+			fmt.Println(styles.HighlightStyle.Render("Verifying flake inputs..."))
+			inputs, err = VerifyFlakeInputs("bsf", verifySignatures)
+			if err != nil {
+				fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+				os.Exit(1)
+			}
+		}
+
+		var proxy *egress.Proxy
+		if egressProxy {
+			proxy, err = egress.Start()
+			if err != nil {
+				fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+				os.Exit(1)
+			}
+			nixcmd.SetFetchProxy(proxy.URL())
+		}
+
+		budget := newBudget(output, lockFile.App.Name, variant)
+		budget.start("nix build")
+		stop := telemetry.Phase("nix build")
+		nixcmd.SetBuildTiming(criticalPath)
+		err = buildVariant(filepath.Join(output, "result"), buildVar)
+		stop()
+		timings := nixcmd.BuildTimings()
+		nixcmd.SetBuildTiming(false)
+		var egressRecords []egress.Record
+		if proxy != nil {
+			nixcmd.SetFetchProxy("")
+			proxy.Close()
+			egressRecords = proxy.Records()
+			fmt.Println(styles.TextStyle.Render(fmt.Sprintf("Recorded %d requests of the build through the egress proxy", len(egressRecords))))
+		}
 		if err != nil {
+			budget.check(err)
 			if isNoFileError(err.Error()) {
 				fmt.Println(styles.ErrorStyle.Render(err.Error() + "\n Please ensure all necessary files are added/committed in your version control system"))
 				fmt.Println(styles.HintStyle.Render("hint: run git add .  "))
-				os.Exit(1)
+				budget.fail(err)
 			}
 			fmt.Println(styles.ErrorStyle.Render("error: ", err.Error()))
-			os.Exit(1)
+			budget.fail(err)
 		}
 
 		fmt.Println(styles.HighlightStyle.Render("Generating artifacts..."))
 
-		lockData, err := os.ReadFile("bsf.lock")
+		closureOpts := nixcmd.ClosureOptions{Realise: !noRealise, NoHashCache: noHashCache, Version: appVersion}
+		if quick {
+			closureOpts.Depth = quickDepth
+		}
+		switch {
+		case repairStore:
+			closureOpts.StoreCheck = nixcmd.CheckRepair
+		case checkStore:
+			closureOpts.StoreCheck = nixcmd.CheckHashes
+		}
+		budget.start("closure")
+		stop = telemetry.Phase("closure")
+		symlinks, err := outputSymlinks(output, symlink, outputs)
 		if err != nil {
 			fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
-			os.Exit(1)
+			budget.fail(err)
 		}
-
-		lockFile := &hcl2nix.LockFile{}
-		err = json.Unmarshal(lockData, lockFile)
+		apps, graph, err := nixcmd.GetRuntimeClosureGraphs(lockFile.App.Name, output, symlinks, closureOpts)
+		stop()
 		if err != nil {
+			budget.check(err)
 			fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
-			os.Exit(1)
+			budget.fail(err)
+		}
+		telemetry.SetClosureSize(len(graph.Nodes.Nodes))
+		appDetails := apps[0]
+		if appDetails.VersionSource == nixcmd.VersionFromDefault {
+			fmt.Println(styles.HintStyle.Render("hint: the version of the application couldn't be resolved, set it with --app-version"))
 		}
 
-		appDetails, graph, err := nixcmd.GetRuntimeClosureGraph(lockFile.App.Name, output, symlink)
-		if err != nil {
+		warnHashProblems(graph)
+		EnrichClosure(graph, enrichTimeout)
+		reachability := AnalyzeReachability(graph, appDetails.StorePath)
+		binaries := AnalyzeHardening(apps)
+		inventory := AnalyzeCryptography(graph, apps)
+		layers := AnalyzeLayers(appDetails, graph)
+
+		artifactOpts := ArtifactOptions{Variant: variant, Inputs: inputs, Identity: identity, Reachability: reachability, Hardening: binaries, Crypto: inventory, Layers: layers, Outputs: apps[1:], SBOMFormats: sbomFmts, SliceSBOMs: sliceSBOMs, Egress: egressRecords}
+		if conf, err := configure.PreCheckConf(); err == nil {
+			artifactOpts.ComponentStore = conf.ComponentStore
+			artifactOpts.Namespace, err = organizationNamespace(conf)
+			if err != nil {
+				fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+				budget.fail(err)
+			}
+		}
+		if buildClosure {
+			budget.start("build closure")
+			stop = telemetry.Phase("build closure")
+			artifactOpts.BuildDerivation, artifactOpts.BuildGraph, err = nixcmd.GetBuildClosureGraph(output, symlink)
+			stop()
+			if err != nil {
+				budget.check(err)
+				fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+				budget.fail(err)
+			}
+		}
+
+		if criticalPath {
+			artifactOpts.Schedule, err = AnalyzeSchedule(output, symlink, artifactOpts.BuildGraph, timings)
+			if err != nil {
+				fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+				budget.fail(err)
+			}
+		}
+
+		if catalogLocation != "" && !strings.Contains(catalogLocation, "://") {
+			// not marked as a path flag, as catalogs can be URLs
+			catalogLocation = workspace.Resolve(catalogLocation)
+		}
+		if catalogLocation == "" {
+			if conf, err := configure.PreCheckConf(); err == nil {
+				catalogLocation = conf.Catalog
+			}
+		}
+		if catalogLocation != "" {
+			results := make([]string, 0, len(apps))
+			for _, app := range apps {
+				results = append(results, app.StorePath)
+			}
+			artifactOpts.Catalog, err = CheckCatalog(graph, lockFile, catalogLocation, results...)
+			if err != nil {
+				fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+				budget.fail(err)
+			}
+			c := artifactOpts.Catalog
+			if c.Unapproved > 0 {
+				fmt.Println(styles.WarnStyle.Render(fmt.Sprintf("%d components are not approved by the package catalog, %d approved and %d exempted", c.Unapproved, c.Approved, c.Exempted)))
+			} else {
+				fmt.Println(styles.TextStyle.Render(fmt.Sprintf("All components are approved by the package catalog, %d of them exempted", c.Exempted)))
+			}
+		} else if enforceCatalog {
+			err = errors.New("--enforce-catalog needs a package catalog, pass --catalog or set catalog in ~/.bsf.json")
 			fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
-			os.Exit(1)
+			budget.fail(err)
 		}
 
-		err = GenerateArtifcats(output, symlink, lockFile, appDetails, graph, runtime.GOOS, runtime.GOARCH)
+		if lockFile.App.Policy != nil {
+			results := make([]string, 0, len(apps))
+			for _, app := range apps {
+				results = append(results, app.StorePath)
+			}
+			artifactOpts.Policy, err = CheckPolicy(graph, lockFile, binaries, results...)
+			if err != nil {
+				fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+				budget.fail(err)
+			}
+			if n := len(artifactOpts.Policy.Violations); n > 0 {
+				fmt.Println(styles.WarnStyle.Render(fmt.Sprintf("%d violations of the policy of bsf.hcl", n)))
+			} else {
+				fmt.Println(styles.TextStyle.Render("The closure complies with the policy of bsf.hcl"))
+			}
+			if n := len(artifactOpts.Policy.Ignored); n > 0 {
+				fmt.Println(styles.TextStyle.Render(fmt.Sprintf("%d violations excepted by ignore blocks", n)))
+			}
+			warnExpiringIgnores(artifactOpts.Policy)
+		}
+
+		if deep {
+			budget.start("provides")
+			stop = telemetry.Phase("provides")
+			artifactOpts.Provides, err = IndexFiles(graph)
+			if err == nil {
+				artifactOpts.Embedded, err = ExtractEmbedded(graph)
+			}
+			stop()
+			if err != nil {
+				budget.check(err)
+				fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+				budget.fail(err)
+			}
+		}
+
+		if scan {
+			budget.start("scan")
+			stop = telemetry.Phase("scan")
+			findings, scanned, err := ScanClosure(graph, lockFile, ScanOptions{Databases: osvDBs, Embedded: artifactOpts.Embedded})
+			stop()
+			if err != nil {
+				budget.check(err)
+				fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+				budget.fail(err)
+			}
+			artifactOpts.Findings, artifactOpts.VEXFormat = findings, vexFormat
+			if len(findings) > 0 {
+				fmt.Println(styles.WarnStyle.Render(fmt.Sprintf("%d vulnerabilities in %d scanned components: %s", len(findings), scanned, summarize(findings))))
+			} else {
+				fmt.Println(styles.TextStyle.Render(fmt.Sprintf("No vulnerabilities in %d scanned components", scanned)))
+			}
+		}
+
+		// the previous attestations are overwritten, keep them to compare the closures
+		previous, _ := layout.ReadAttestations(output)
+
+		budget.start("artifacts")
+		stop = telemetry.Phase("artifacts")
+		err = GenerateArtifcats(output, symlink, lockFile, appDetails, graph, runtime.GOOS, runtime.GOARCH, artifactOpts)
+		stop()
 		if err != nil {
+			budget.check(err)
 			fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+			budget.fail(err)
+		}
+		RecordBuild(lockFile.App.Name, variant, output, appDetails, graph, scan, artifactOpts.Findings)
+		budget.recorded = true
+
+		var signer crypto.Signer
+		var certs []string
+		if signingIdentity != nil {
+			budget.start("signing")
+			fmt.Println(styles.HighlightStyle.Render(fmt.Sprintf("Signing attestations as %s...", signingIdentity.Subject)))
+			signer, certs, err = certifiedSigner(signingIdentity)
+			if err == nil {
+				err = SignAttestations(output, signer, certs)
+			}
+			if err != nil {
+				fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+				budget.fail(err)
+			}
+		} else if receiptKey != "" {
+			signer, err = signing.ReadPrivateKey(receiptKey)
+			if err != nil {
+				fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+				budget.fail(err)
+			}
+		}
+
+		if signer != nil {
+			budget.start("receipt")
+			err = GenerateReceipt(output, symlink, appDetails, signer, certs, identity)
+			if err != nil {
+				fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+				budget.fail(err)
+			}
+		}
+
+		budget.finish()
+		emitResult(lockFile.App.Name, variant, output, appDetails, graph)
+
+		warnAnomalies(previous, output)
+
+		if failOn != "" {
+			if failing := failingFindings(artifactOpts.Findings, threshold); len(failing) > 0 {
+				for _, f := range failing {
+					fmt.Println(styles.ErrorStyle.Render(fmt.Sprintf("%s (%s) affects %s %s", f.Vulnerability.ID, f.Severity, f.Component.Name, f.Component.Version)))
+				}
+				fmt.Println(styles.ErrorStyle.Render("error:", fmt.Sprintf("%d vulnerabilities of severity %s or higher affect the application", len(failing), threshold)))
+				os.Exit(1)
+			}
+		}
+
+		if r := artifactOpts.Policy; r != nil && !r.Passed {
+			reportPolicy(r)
+			fmt.Println(styles.ErrorStyle.Render("error:", fmt.Sprintf("the closure violates the policy of bsf.hcl %d times, see %s", len(r.Violations), policy.ReportName)))
 			os.Exit(1)
 		}
 
+		if c := artifactOpts.Catalog; c != nil && c.Unapproved > 0 {
+			reportCatalog(c)
+			if enforceCatalog {
+				fmt.Println(styles.ErrorStyle.Render("error:", fmt.Sprintf("%d components of the closure are not approved by the package catalog", c.Unapproved)))
+				os.Exit(1)
+			}
+		}
+
 		fmt.Println(styles.SucessStyle.Render(fmt.Sprintf("Build completed successfully, please check the %s directory", output)))
 
 	},
 }
 
-// GenerateSBOM generates the Software Bill of Materials (SBOM)
-func GenerateSBOM(w io.Writer, lockFile *hcl2nix.LockFile, appDetails *nixcmd.App, graph *gographviz.Graph, os, arch string) error {
-	appNode := &sbom.Node{
-		Id:             bsbom.GeneratePurl(appDetails.Name, "0.0.0", os, arch),
-		PrimaryPurpose: []sbom.Purpose{sbom.Purpose_APPLICATION},
-		Name:           appDetails.Name,
-		Hashes: map[int32]string{
-			int32(sbom.HashAlgorithm_SHA256): appDetails.BinaryHash,
-		},
+// EnrichClosure annotates the closure with the metadata of the package registry and of nixpkgs. With a timeout, the
+// lookups that didn't complete in time are abandoned, their components are flagged as pending enrichment in the SBOM
+// and bsf enrich completes them later. It returns why lookups failed, the warnings were printed.
+func EnrichClosure(graph *gographviz.Graph, timeout time.Duration) error {
+	ctx := deadline.Context()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
 	}
 
-	bom := bsbom.PackageGraphToSBOM(appNode, lockFile, graph)
-	bomSt := bsbom.NewStatement(appDetails)
+	registryPending, registryErr := AnnotatePrivatePackages(ctx, graph)
+	nixpkgsPending, nixpkgsErr := AnnotateNixpkgsMetadata(ctx, graph)
+	if pending := registryPending + nixpkgsPending; pending > 0 {
+		fmt.Println(styles.WarnStyle.Render(fmt.Sprintf("warning: the metadata of %d components wasn't resolved before the enrichment deadline", pending)))
+		fmt.Println(styles.HintStyle.Render("hint: bsf enrich <output directory> completes the components pending enrichment"))
+	}
+	return errors.Join(registryErr, nixpkgsErr)
+}
 
-	spdxBom, err := bomSt.ToJSON(bom, formats.SPDX23JSON)
-	if err != nil {
-		return err
+// markPending flags the node as pending the metadata of the source
+func markPending(node *gographviz.Node, source string) {
+	sources := strings.Fields(node.Attrs[bsbom.AttrPendingEnrichment])
+	if !slices.Contains(sources, source) {
+		node.Attrs[bsbom.AttrPendingEnrichment] = strings.Join(append(sources, source), " ")
 	}
-	_, err = w.Write(append(spdxBom, []byte("\n")...))
-	if err != nil {
-		return err
+}
+
+// AnnotatePrivatePackages looks up the closure in the package registry configured in ~/.bsf.json, so components of
+// private overlays get their internal name, owner and license instead of the ones guessed from the store path.
+// It returns the number of components pending enrichment when ctx was done before the registry answered.
+func AnnotatePrivatePackages(ctx context.Context, graph *gographviz.Graph) (int, error) {
+	conf, err := configure.PreCheckConf()
+	if err != nil || conf.PackageRegistry == "" {
+		return 0, nil
 	}
 
-	cdxBom, err := bomSt.ToJSON(bom, formats.CDX15JSON)
-	if err != nil {
-		return err
+	lookupCtx, cancel := context.WithTimeout(ctx, 2*time.Minute)
+	defer cancel()
+
+	pkgs, err := pkgregistry.NewClient(conf.PackageRegistry).Lookup(lookupCtx, pkgregistry.Queries(graph))
+	if err != nil && ctx.Err() != nil {
+		pending := 0
+		for _, node := range graph.Nodes.Nodes {
+			if node.Attrs["name"] != "" {
+				markPending(node, bsbom.SourceRegistry)
+				pending++
+			}
+		}
+		return pending, nil
 	}
-	_, err = w.Write(append(cdxBom, []byte("\n")...))
 	if err != nil {
-		return err
+		fmt.Println(styles.WarnStyle.Render("warning: package registry lookup failed, private components are named after their store path:", err.Error()))
+		return 0, err
 	}
-	return nil
+	if n := pkgregistry.Annotate(graph, pkgs); n > 0 {
+		fmt.Println(styles.TextStyle.Render(fmt.Sprintf("Annotated %d components from the package registry", n)))
+	}
+	return 0, nil
 }
 
-// GenerateProvenance generates the provenance
-func GenerateProvenance(w io.Writer, output string, symlink string, appDetails *nixcmd.App, graph *gographviz.Graph) error {
-	drvPath, err := nixcmd.GetDrvPathFromResult(output, symlink)
-	if err != nil {
-		return err
+// AnnotateNixpkgsMetadata resolves the licenses, homepages, descriptions and maintainers of the closure from the
+// nixpkgs revision locked in bsf/flake.lock, for the license compliance of the SBOM. Wrappers and environments
+// inherit the licenses of the packages they wrap. It returns the number of components whose metadata wasn't
+// evaluated when ctx was done.
+func AnnotateNixpkgsMetadata(ctx context.Context, graph *gographviz.Graph) (int, error) {
+	defer nixmeta.InheritWrapperLicenses(graph)
+
+	rev, ok := nixpkgsRev()
+	if !ok {
+		return 0, nil
 	}
 
-	drv, err := provenance.GetDerivation(drvPath)
+	resolver := nixmeta.NewResolver(rev)
+	// each evaluation loads nixpkgs, a few at once keep the memory of the host in check
+	resolver.Workers = min(runtime.NumCPU(), 4)
+	entries, pending, err := resolver.ResolveContext(ctx, nixmeta.Packages(graph))
 	if err != nil {
-		return err
+		fmt.Println(styles.WarnStyle.Render("warning: some components have no license metadata:", err.Error()))
+		fmt.Println(styles.HintStyle.Render("hint: bsf cache pull or bsf cache generate provide the metadata without evaluating nixpkgs"))
 	}
+	nixmeta.Annotate(graph, entries)
 
-	provSt := provenance.NewStatement(appDetails)
-	err = provSt.FromDerivationClosure(drvPath, drv, graph)
+	isPending := make(map[nixmeta.Package]bool, len(pending))
+	for _, p := range pending {
+		isPending[p] = true
+	}
+	n := 0
+	for _, node := range graph.Nodes.Nodes {
+		if isPending[nixmeta.Package{Pname: node.Attrs["name"], Version: node.Attrs["version"]}] {
+			markPending(node, bsbom.SourceNixpkgs)
+			n++
+		}
+	}
+	return n, err
+}
+
+// nixpkgsRev returns the nixpkgs revision locked in bsf/flake.lock
+func nixpkgsRev() (string, bool) {
+	lock, err := flakelock.Read("bsf/flake.lock")
 	if err != nil {
-		return err
+		return "", false
 	}
-	provJ, err := provSt.ToJSON()
+	return lock.InputRev("nixpkgs")
+}
+
+// IndexFiles indexes the files of the store paths of the closure, one store path per CPU at once
+func IndexFiles(graph *gographviz.Graph) (*provides.Index, error) {
+	storePaths := make([]string, 0, len(graph.Nodes.Nodes))
+	for _, node := range graph.Nodes.Nodes {
+		storePaths = append(storePaths, nixcmd.StoreDir+"/"+nixcmd.CleanNameFromGraph(node.Name))
+	}
+	return provides.Build(storePaths, runtime.NumCPU())
+}
+
+// ExtractEmbedded returns the python packages and JARs embedded in the store paths of the closure, which the closure
+// graph models as a single component
+func ExtractEmbedded(graph *gographviz.Graph) (map[string][]embedded.Package, error) {
+	storePaths := make([]string, 0, len(graph.Nodes.Nodes))
+	for _, node := range graph.Nodes.Nodes {
+		storePaths = append(storePaths, nixcmd.StoreDir+"/"+nixcmd.CleanNameFromGraph(node.Name))
+	}
+	packages, err := embedded.Extract(storePaths, runtime.NumCPU())
 	if err != nil {
-		return err
+		return nil, err
+	}
+	if n := embedded.Count(packages); n > 0 {
+		fmt.Println(styles.TextStyle.Render(fmt.Sprintf("%d python packages and java libraries embedded in %d store paths", n, len(packages))))
 	}
+	return packages, nil
+}
 
-	_, err = w.Write(provJ)
+// AnalyzeReachability simulates the dynamic loader from the executables of the build result and tags the closure
+// components it loads, results without a bin directory are not analyzed
+func AnalyzeReachability(graph *gographviz.Graph, result string) *loader.Report {
+	entries, err := os.ReadDir(nixcmd.HostPath(filepath.Join(result, "bin")))
 	if err != nil {
-		return err
+		return nil
+	}
+	entrypoints := make([]string, 0, len(entries))
+	for _, e := range entries {
+		entrypoints = append(entrypoints, filepath.Join(result, "bin", e.Name()))
+	}
+	if len(entrypoints) == 0 {
+		return nil
 	}
 
-	return nil
+	report := loader.Annotate(graph, entrypoints, loader.Simulate(entrypoints))
+	reachable, unreachable := report.Count()
+	if unreachable > 0 {
+		fmt.Println(styles.TextStyle.Render(fmt.Sprintf("%d of %d components with shared libraries are loaded by the entrypoints", reachable, reachable+unreachable)))
+	}
+	return report
 }
 
-// GenerateArtifcats generates remaining artifacts after build
-func GenerateArtifcats(output string, symlink string, lockFile *hcl2nix.LockFile, appDetails *nixcmd.App, graph *gographviz.Graph, tos, tarch string) error {
-	attestationsPath := filepath.Join(output, "attestations.intoto.jsonl")
-	attFile, err := os.Create(attestationsPath)
-	if err != nil {
-		fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
-		os.Exit(1)
+// AnalyzeHardening analyzes the executables of the outputs of the package for their mitigations and privileges,
+// outputs without executables are not analyzed
+func AnalyzeHardening(apps []*nixcmd.App) *hardening.Report {
+	results := make([]string, 0, len(apps))
+	for _, app := range apps {
+		results = append(results, app.StorePath)
+	}
+	report := hardening.Analyze(results...)
+	if len(report.Binaries) == 0 {
+		return nil
+	}
+
+	weak := 0
+	for _, b := range report.Binaries {
+		if !b.PIE || b.RELRO != hardening.RELROFull || !b.NX || b.Setuid || b.Setgid || len(b.Capabilities) > 0 {
+			weak++
+		}
+	}
+	if weak > 0 {
+		fmt.Println(styles.TextStyle.Render(fmt.Sprintf("%d of %d executables lack PIE, full RELRO or NX, or are privileged, see %s", weak, len(report.Binaries), hardening.ReportName)))
+	}
+	return report
+}
+
+// warnHashProblems reports the paths of the closure that couldn't be hashed, and the special files skipped while
+// hashing others, path by path: their components are in the SBOM without a hash, or with the hash of the files nix
+// can serialise. With --check-store, it also reports the paths that didn't hash to the NAR hash the store recorded,
+// and whether they were repaired.
+func warnHashProblems(graph *gographviz.Graph) {
+	corrupted := false
+	for _, node := range depgraph.FromDOT(graph).Nodes {
+		if recorded, actual, ok := nixcmd.HashMismatch(node.Attrs); ok {
+			switch {
+			case node.Attrs[nixcmd.AttrRepaired] == "true":
+				fmt.Println(styles.WarnStyle.Render(fmt.Sprintf("warning: %s hashed to %s rather than the NAR hash the store recorded, %s: it was repaired", node.StorePath(), actual, recorded)))
+			case node.Attrs[nixcmd.AttrRepairError] != "":
+				fmt.Println(styles.WarnStyle.Render(fmt.Sprintf("warning: %s hashed to %s rather than the NAR hash the store recorded, %s, and couldn't be repaired: %s", node.StorePath(), actual, recorded, node.Attrs[nixcmd.AttrRepairError])))
+			default:
+				fmt.Println(styles.WarnStyle.Render(fmt.Sprintf("warning: %s hashed to %s rather than the NAR hash the store recorded, %s", node.StorePath(), actual, recorded)))
+				corrupted = true
+			}
+		}
+		if err := node.Attrs[nixcmd.AttrHashError]; err != "" {
+			fmt.Println(styles.WarnStyle.Render(fmt.Sprintf("warning: %s has no hash, it couldn't be serialised: %s", node.StorePath(), err)))
+		}
+		if skipped := node.Attrs[nixcmd.AttrHashSkipped]; skipped != "" {
+			fmt.Println(styles.WarnStyle.Render(fmt.Sprintf("warning: %s was hashed without its special files, which NARs can't have: %s", node.StorePath(), skipped)))
+		}
 	}
-	defer attFile.Close()
+	if corrupted {
+		fmt.Println(styles.HintStyle.Render("hint: bsf build --repair repairs the corrupted paths with nix store repair"))
+	}
+}
 
-	err = GenerateSBOM(attFile, lockFile, appDetails, graph, tos, tarch)
+// organizationNamespace returns the package url namespace of ~/.bsf.json, nil when none is configured. Without
+// patterns of internal packages, components are internal when nixpkgs has no package of them, which can't be told
+// without the nixpkgs revision of bsf/flake.lock: the namespace isn't applied then.
+func organizationNamespace(conf *config.Config) (*bsbom.Namespace, error) {
+	if conf.PurlNamespace == "" {
+		return nil, nil
+	}
+	ns, err := bsbom.ParseNamespace(conf.PurlNamespace)
 	if err != nil {
-		fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
-		os.Exit(1)
+		return nil, err
+	}
+	ns.Packages, ns.RepositoryURL = conf.InternalPackages, conf.PackageRegistry
+	if _, ok := nixpkgsRev(); !ok && len(ns.Packages) == 0 {
+		fmt.Println(styles.WarnStyle.Render("warning: internal components can't be told apart without the nixpkgs revision of bsf/flake.lock, they keep their nix package url"))
+		fmt.Println(styles.HintStyle.Render("hint: list the internal packages with internal_packages in ~/.bsf.json"))
+		return nil, nil
 	}
+	return &ns, nil
+}
 
-	err = GenerateProvenance(attFile, output, symlink, appDetails, graph)
+// AnalyzeLayers attributes the size of the layers of the image to the components of the closure, nil when the
+// result is not an image. The components of nix2container layers are sized by their NAR size in the closure graph.
+func AnalyzeLayers(appDetails *nixcmd.App, graph *gographviz.Graph) *imagesize.Report {
+	if appDetails.Image == nil {
+		return nil
+	}
+	narSizes := make(map[string]int64)
+	for _, node := range depgraph.FromDOT(graph).Nodes {
+		if size, err := strconv.ParseInt(node.Attrs[policy.AttrNarSize], 10, 64); err == nil {
+			narSizes[node.StorePath()] = size
+		}
+	}
+	layers, err := nixcmd.LayerSizes(nixcmd.HostPath(appDetails.StorePath), appDetails.Image, func(storePath string) int64 {
+		return narSizes[storePath]
+	})
 	if err != nil {
-		fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
-		os.Exit(1)
+		fmt.Println(styles.WarnStyle.Render("warning: failed to attribute the size of the layers:", err.Error()))
+		return nil
+	}
+	if len(layers) == 0 {
+		return nil
 	}
 
-	return nil
+	report := imagesize.NewReport(layers)
+	var pulled int64
+	for _, l := range layers {
+		pulled += l.Size
+	}
+	if len(report.Components) > 0 && pulled > 0 {
+		top := report.Components[0]
+		fmt.Println(styles.TextStyle.Render(fmt.Sprintf("%s takes %.1fMiB of the %.1fMiB of the layers pulled, see bsf report layers",
+			top.Name, float64(top.CompressedSize)/(1<<20), float64(pulled)/(1<<20))))
+	}
+	return report
+}
+
+// AnalyzeSchedule computes the critical path and parallelism of the derivation graph of the result with the timings
+// of the derivations built, reusing the build-time closure when it was recorded
+func AnalyzeSchedule(output, symlink string, drvGraph *gographviz.Graph, timings []nixcmd.BuildTiming) (*schedule.Report, error) {
+	if drvGraph == nil {
+		var err error
+		if _, drvGraph, err = nixcmd.GetDerivationGraph(output, symlink); err != nil {
+			return nil, err
+		}
+	}
+	built := make([]schedule.Timing, 0, len(timings))
+	for _, t := range timings {
+		built = append(built, schedule.Timing{DrvPath: t.DrvPath, Start: t.Start, End: t.End})
+	}
+	report := schedule.Analyze(depgraph.FromDOT(drvGraph), built)
+
+	s := report.Summary
+	if s.Built == 0 {
+		fmt.Println(styles.TextStyle.Render("No derivation was built, the result was substituted or already in the store"))
+		return report, nil
+	}
+	fmt.Println(styles.TextStyle.Render(fmt.Sprintf("Built %d derivations in %s, %s of work: the critical path of %d derivations takes %s, more than %d builders wouldn't build faster, see bsf report schedule",
+		s.Built, s.Wall.Round(time.Second), s.Work.Round(time.Second), len(report.CriticalPath), s.CriticalPath.Round(time.Second), s.Builders)))
+	return report, nil
+}
+
+// AnalyzeCryptography inventories the cryptographic libraries of the closure and the algorithms and protocols the
+// executables of the outputs of the package use, nil when there is no cryptography
+func AnalyzeCryptography(graph *gographviz.Graph, apps []*nixcmd.App) *cbom.Inventory {
+	results := make([]string, 0, len(apps))
+	for _, app := range apps {
+		results = append(results, app.StorePath)
+	}
+	inv := cbom.Analyze(depgraph.FromDOT(graph), results...)
+	if len(inv.Libraries) == 0 && len(inv.Assets) == 0 {
+		return nil
+	}
+
+	algorithms := 0
+	for _, a := range inv.Assets {
+		if a.Type == cbom.TypeAlgorithm {
+			algorithms++
+		}
+	}
+	fmt.Println(styles.TextStyle.Render(fmt.Sprintf("%d cryptographic algorithms used and %d cryptographic libraries, %d algorithms not FIPS approved and %d quantum vulnerable, see %s",
+		algorithms, len(inv.Libraries), inv.NotApproved(), inv.QuantumVulnerable(), cbom.FileName)))
+	return inv
+}
+
+// GenerateSBOM generates the Software Bill of Materials (SBOM).
+// The other outputs of the package are root components of the same SBOM.
+func GenerateSBOM(w io.Writer, lockFile *hcl2nix.LockFile, appDetails *nixcmd.App, graph *gographviz.Graph, os, arch string, outputs ...*nixcmd.App) error {
+	bom := sbomDocument(lockFile, appDetails, graph, os, arch, outputs...)
+	return writeSBOMStatements(w, bom, appDetails, outputs...)
+}
+
+// sbomDocument returns the SBOM of the application and the other outputs of the package
+func sbomDocument(lockFile *hcl2nix.LockFile, appDetails *nixcmd.App, graph *gographviz.Graph, os, arch string, outputs ...*nixcmd.App) *sbom.Document {
+	roots := []bsbom.Root{{Node: rootNode(appDetails, sbom.Purpose_APPLICATION, os, arch)}}
+	bsbom.AddProductMetadata(roots[0].Node, lockFile.App.Product)
+	if len(outputs) > 0 {
+		roots[0].StorePath = appDetails.StorePath
+	}
+	for _, out := range outputs {
+		node := rootNode(out, out.AppType, os, arch)
+		if out.BinaryHash == "" {
+			// outputs without a binary, e.g. man pages, are identified by the hash of their result
+			node.Hashes[int32(sbom.HashAlgorithm_SHA256)] = bsbom.NarHashHex(out.ResultHash)
+		}
+		roots = append(roots, bsbom.Root{Node: node, StorePath: out.StorePath})
+	}
+
+	bom := bsbom.OutputsGraphToSBOM(roots, lockFile, depgraph.FromDOT(graph))
+	for _, slice := range appDetails.Slices {
+		node := sliceNode(appDetails, slice)
+		bom.NodeList.AddNode(node)
+		bom.NodeList.RelateNodeAtID(node, roots[0].Node.Id, sbom.Edge_contains)
+	}
+	if appDetails.FHS != nil {
+		comment := "buildFHSEnv output running " + appDetails.FHS.Program + " in " + appDetails.FHS.RootFS
+		if appDetails.FHS.Program == "" {
+			comment = "buildFHSEnv output running in " + appDetails.FHS.RootFS
+		}
+		if roots[0].Node.Comment != "" {
+			comment = roots[0].Node.Comment + "; " + comment
+		}
+		roots[0].Node.Comment = comment
+	}
+	// a single artifact is the binary of the root, unless it is the launcher of an FHS env
+	if len(appDetails.Artifacts) > 1 || appDetails.FHS != nil {
+		for _, art := range appDetails.Artifacts {
+			node := artifactNode(appDetails, art, os, arch)
+			bom.NodeList.AddNode(node)
+			bom.NodeList.RelateNodeAtID(node, roots[0].Node.Id, sbom.Edge_contains)
+		}
+	}
+	if appDetails.Image != nil {
+		for _, p := range appDetails.Image.Platforms {
+			node := platformNode(appDetails, p)
+			bom.NodeList.AddNode(node)
+			bom.NodeList.RelateNodeAtID(node, roots[0].Node.Id, sbom.Edge_contains)
+		}
+	}
+	return bom
+}
+
+// applyNamespace gives the internal components of the SBOM a package url in the namespace of the organization
+func applyNamespace(bom *sbom.Document, ns *bsbom.Namespace) int {
+	if ns == nil {
+		return 0
+	}
+	return bsbom.ApplyNamespace(bom, *ns)
+}
+
+// emitComponents streams the packages of the SBOM as events
+func emitComponents(bom *sbom.Document) {
+	if !events.Enabled() {
+		return
+	}
+	for _, node := range bom.NodeList.Nodes {
+		if node.Type != sbom.Node_PACKAGE {
+			continue
+		}
+		events.Emit(events.Event{
+			Type:    events.ComponentEmitted,
+			Name:    node.Name,
+			Version: node.Version,
+			Purl:    node.Identifiers[int32(sbom.SoftwareIdentifierType_PURL)],
+			Hash:    node.Hashes[int32(sbom.HashAlgorithm_SHA256)],
+		})
+	}
+}
+
+// emitResult emits the outcome of the build with the artifacts of the output directory
+func emitResult(project, variant, output string, appDetails *nixcmd.App, graph *gographviz.Graph) {
+	if !events.Enabled() {
+		return
+	}
+	result := &events.Result{
+		Project:    project,
+		Variant:    variant,
+		Output:     output,
+		StorePath:  appDetails.StorePath,
+		Components: len(graph.Nodes.Nodes),
+		Artifacts:  make([]events.Artifact, 0),
+	}
+	if l, err := layout.Open(output); err == nil {
+		for _, e := range l.Index.Entries {
+			result.Artifacts = append(result.Artifacts, events.Artifact{
+				Kind:      e.Kind,
+				Name:      e.Name,
+				Path:      filepath.Join(output, e.Path),
+				Digest:    e.Digest,
+				MediaType: e.MediaType,
+			})
+		}
+	}
+	events.Emit(events.Event{Type: events.BuildFinished, Result: result})
+}
+
+// writeSBOMStatements writes the SPDX and CycloneDX statements of the SBOM, one per line
+func writeSBOMStatements(w io.Writer, bom *sbom.Document, appDetails *nixcmd.App, outputs ...*nixcmd.App) error {
+	bomSt := bsbom.NewStatement(appDetails, outputs...)
+
+	spdxBom, err := bomSt.ToJSON(bom, formats.SPDX23JSON)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(spdxBom, []byte("\n")...))
+	if err != nil {
+		return err
+	}
+
+	cdxBom, err := bomSt.ToJSON(bom, formats.CDX15JSON)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(cdxBom, []byte("\n")...))
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// VerifyFlakeInputs checks the inputs of the flake in dir against its flake.lock and fails if any of them was tampered with
+func VerifyFlakeInputs(dir string, signatures bool) ([]flakelock.Verification, error) {
+	lock, err := flakelock.Read(filepath.Join(dir, "flake.lock"))
+	if err != nil {
+		return nil, err
+	}
+
+	archive, err := nixcmd.GetFlakeArchive(dir + "/.")
+	if err != nil {
+		return nil, err
+	}
+
+	var checker flakelock.SignatureChecker
+	if signatures {
+		checker = flakelock.NewGitHubChecker()
+	}
+
+	inputs, err := flakelock.Verify(context.Background(), lock, archive, checker)
+	if err != nil {
+		return nil, err
+	}
+
+	failed := flakelock.Failed(inputs)
+	if len(failed) > 0 {
+		names := make([]string, 0, len(failed))
+		for _, f := range failed {
+			names = append(names, f.Input)
+		}
+		return nil, fmt.Errorf("narHash mismatch for flake inputs: %s", strings.Join(names, ", "))
+	}
+
+	if signatures {
+		for _, in := range inputs {
+			if in.Signature == flakelock.SignatureUnverified {
+				return nil, fmt.Errorf("commit %s of flake input %s is not signed: %s", in.Rev, in.Input, in.SignatureReason)
+			}
+			if in.Signature == flakelock.SignatureUnsupported {
+				fmt.Println(styles.HintStyle.Render(fmt.Sprintf("hint: signature of flake input %s cannot be checked", in.Input)))
+			}
+		}
+	}
+
+	return inputs, nil
+}
+
+// GenerateProvenance generates the provenance
+func GenerateProvenance(w io.Writer, output string, symlink string, appDetails *nixcmd.App, graph *gographviz.Graph, opts ArtifactOptions) error {
+	drvPath, err := nixcmd.GetDrvPathFromResult(output, symlink)
+	if err != nil {
+		return err
+	}
+
+	// the derivation is read below the root of chroot stores
+	drv, err := nixcmd.ReadDerivation(drvPath)
+	if err != nil {
+		return err
+	}
+
+	provSt := provenance.NewStatement(appDetails)
+	// the build-time closure holds the toolchain, the runtime closure only what the result references
+	if opts.BuildGraph != nil {
+		graph = opts.BuildGraph
+	}
+	err = provSt.FromDerivationClosure(drvPath, drv, graph)
+	if err != nil {
+		return err
+	}
+	err = provSt.AddEnvironment(nixcmd.EffectiveEnvironment())
+	if err != nil {
+		return err
+	}
+	err = provSt.AddBuilder(builderFingerprint())
+	if err != nil {
+		return err
+	}
+	if len(opts.Egress) > 0 {
+		err = provSt.AddEgress(opts.Egress)
+		if err != nil {
+			return err
+		}
+	}
+	if len(opts.Inputs) > 0 {
+		err = provSt.AddFlakeInputs(opts.Inputs)
+		if err != nil {
+			return err
+		}
+	}
+	if opts.Identity != nil {
+		err = provSt.AddWorkloadIdentity(opts.Identity)
+		if err != nil {
+			return err
+		}
+	}
+	provJ, err := provSt.ToJSON()
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(provJ)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ArtifactOptions holds the optional information recorded in the artifacts
+type ArtifactOptions struct {
+	// Variant is the variant of bsf.hcl the application was built as, the root component of the SBOM is labeled with it
+	Variant string
+	// Inputs are the verified flake inputs
+	Inputs []flakelock.Verification
+	// Identity is the CI workload identity of a trusted builder
+	Identity *workload.Identity
+	// Reachability is the split of the closure between components the entrypoints load and the others
+	Reachability *loader.Report
+	// Hardening is the analysis of the executables of the results, written in hardening.json
+	Hardening *hardening.Report
+	// Crypto is the inventory of the cryptography of the closure, written in the CBOM
+	Crypto *cbom.Inventory
+	// Schedule is the critical path and parallelism of the derivations built, written in schedule.json
+	Schedule *schedule.Report
+	// Layers is the attribution of the size of the layers of the image to the components, written in layers.json
+	Layers *imagesize.Report
+	// Outputs are the other outputs of the package, root components of the SBOM next to the application
+	Outputs []*nixcmd.App
+	// SBOMFormats are the formats of the standalone SBOMs, SPDX and CycloneDX when empty
+	SBOMFormats []formats.Format
+	// Egress are the requests of the build through the egress proxy, byproducts of the provenance
+	Egress []egress.Record
+	// BuildGraph is the build-time closure of BuildDerivation, recorded in a build SBOM when set
+	BuildGraph      *gographviz.Graph
+	BuildDerivation string
+	// SliceSBOMs writes a SBOM for each architecture of a universal macOS binary, rooted at the thin binary of the slice
+	SliceSBOMs bool
+	// Findings are the vulnerabilities of the closure, written in a VEX document of VEXFormat when scanned
+	Findings  []osv.Finding
+	VEXFormat string
+	// Catalog is the check of the closure against the approved package catalog, written in catalog.json
+	Catalog *catalog.Report
+	// Policy is the check of the closure against the policy of bsf.hcl, written in policy.json
+	Policy *policy.Report
+	// Provides is the index of the files of the closure, recorded in the SBOM and in provides.json with --deep
+	Provides *provides.Index
+	// Embedded are the packages embedded in the store paths of the closure, recorded in the SBOM with --deep
+	Embedded map[string][]embedded.Package
+	// Endpoints are the APIs the container of the application serves, services of the SBOM
+	Endpoints []hcl2nix.Endpoint
+	// ComponentStore is the directory of the component store shared by the projects, the SBOM is stored there when set
+	ComponentStore string
+	// Namespace is the package url namespace of the organization, given to the internal components of the SBOMs
+	Namespace *bsbom.Namespace
+}
+
+// GenerateArtifcats generates remaining artifacts after build.
+// They are stored by digest in the output directory and listed in its index.json, see package layout.
+func GenerateArtifcats(output string, symlink string, lockFile *hcl2nix.LockFile, appDetails *nixcmd.App, graph *gographviz.Graph, tos, tarch string, opts ArtifactOptions) error {
+	l, err := layout.Open(output)
+	if err != nil {
+		return err
+	}
+
+	bom := sbomDocument(lockFile, appDetails, graph, tos, tarch, opts.Outputs...)
+	labelVariant(bom, opts.Variant)
+	if n := applyNamespace(bom, opts.Namespace); n > 0 {
+		fmt.Println(styles.TextStyle.Render(fmt.Sprintf("Named %d internal components in %s", n, opts.Namespace.Prefix)))
+	}
+	if opts.Provides != nil {
+		bsbom.AddFiles(bom, opts.Provides.ByStorePath())
+	}
+	bsbom.AddEmbedded(bom, opts.Embedded)
+	bsbom.AddServices(bom, bom.NodeList.GetNodeByID(bom.NodeList.RootElements[0]), opts.Endpoints)
+	emitComponents(bom)
+	var sbomBuf bytes.Buffer
+	err = writeSBOMStatements(&sbomBuf, bom, appDetails, opts.Outputs...)
+	if err != nil {
+		fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+		os.Exit(1)
+	}
+	err = addSBOMs(l, "", bom, opts.SBOMFormats)
+	if err != nil {
+		return err
+	}
+	if opts.ComponentStore != "" {
+		storeComponents(opts.ComponentStore, lockFile.App.Name, appDetails, bom)
+	}
+	var buildBom *sbom.Document
+	if opts.BuildGraph != nil {
+		buildBom = bsbom.BuildGraphToSBOM(rootNode(appDetails, sbom.Purpose_APPLICATION, tos, tarch), opts.BuildDerivation, depgraph.FromDOT(opts.BuildGraph))
+	}
+	err = addSBOMs(l, BuildSBOMPrefix, buildBom, opts.SBOMFormats)
+	if err != nil {
+		return err
+	}
+	err = addSliceSBOMs(l, lockFile, appDetails, graph, opts)
+	if err != nil {
+		return err
+	}
+	err = addPlatformSBOMs(l, lockFile, appDetails, graph, opts)
+	if err != nil {
+		return err
+	}
+
+	attestations := bytes.NewBuffer(sbomBuf.Bytes())
+	err = GenerateProvenance(attestations, output, symlink, appDetails, graph, opts)
+	if err != nil {
+		fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+		os.Exit(1)
+	}
+
+	_, err = l.Add(layout.KindAttestation, layout.AttestationsName, "application/vnd.in-toto+jsonl", attestations.Bytes())
+	if err != nil {
+		return err
+	}
+	l.Remove(layout.KindReport, IncompleteName)
+	// the signed attestations and receipt of a previous build don't match these anymore
+	for _, name := range []string{layout.SignedAttestationsName, receipt.Name} {
+		l.Remove(layout.KindAttestation, name)
+		os.Remove(filepath.Join(output, name))
+	}
+
+	resultPath, err := nixcmd.ResultPath(output, symlink)
+	if err != nil {
+		return err
+	}
+	err = addBinaries(l, resultPath)
+	if err != nil {
+		return err
+	}
+
+	if opts.Reachability != nil {
+		data, err := json.MarshalIndent(opts.Reachability, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = l.Add(layout.KindReport, loader.ReportName, "application/json", data)
+		if err != nil {
+			return err
+		}
+	} else {
+		l.Remove(layout.KindReport, loader.ReportName)
+	}
+
+	if opts.Hardening != nil {
+		data, err := json.MarshalIndent(opts.Hardening, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = l.Add(layout.KindReport, hardening.ReportName, "application/json", data)
+		if err != nil {
+			return err
+		}
+	} else {
+		l.Remove(layout.KindReport, hardening.ReportName)
+	}
+
+	if opts.Schedule != nil {
+		data, err := json.MarshalIndent(opts.Schedule, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = l.Add(layout.KindReport, schedule.ReportName, "application/json", data)
+		if err != nil {
+			return err
+		}
+	} else {
+		l.Remove(layout.KindReport, schedule.ReportName)
+	}
+
+	if opts.Layers != nil {
+		data, err := json.MarshalIndent(opts.Layers, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = l.Add(layout.KindReport, imagesize.ReportName, "application/json", data)
+		if err != nil {
+			return err
+		}
+	} else {
+		l.Remove(layout.KindReport, imagesize.ReportName)
+	}
+
+	if opts.Crypto != nil {
+		root := rootNode(appDetails, sbom.Purpose_APPLICATION, tos, tarch)
+		product := cbom.Product{
+			Name:    root.Name,
+			Version: root.Version,
+			Purl:    root.Identifiers[int32(sbom.SoftwareIdentifierType_PURL)],
+			BOMRef:  root.Id,
+			ComponentID: func(name, version string) string {
+				return bsbom.GenerateID(name, version, "", "")
+			},
+		}
+		data, err := json.MarshalIndent(cbom.CycloneDX(product, opts.Crypto, time.Now()), "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = l.Add(layout.KindReport, cbom.FileName, "application/json", data)
+		if err != nil {
+			return err
+		}
+	} else {
+		l.Remove(layout.KindReport, cbom.FileName)
+	}
+
+	if opts.Catalog != nil {
+		data, err := json.MarshalIndent(opts.Catalog, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = l.Add(layout.KindReport, catalog.ReportName, "application/json", data)
+		if err != nil {
+			return err
+		}
+	} else {
+		l.Remove(layout.KindReport, catalog.ReportName)
+	}
+
+	if opts.Policy != nil {
+		data, err := json.MarshalIndent(opts.Policy, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = l.Add(layout.KindReport, policy.ReportName, "application/json", data)
+		if err != nil {
+			return err
+		}
+		if policyReport != "" {
+			if err := os.WriteFile(policyReport, data, 0644); err != nil {
+				return err
+			}
+		}
+	} else {
+		l.Remove(layout.KindReport, policy.ReportName)
+	}
+
+	if opts.Provides != nil {
+		data, err := json.Marshal(opts.Provides)
+		if err != nil {
+			return err
+		}
+		_, err = l.Add(layout.KindReport, provides.ReportName, "application/json", data)
+		if err != nil {
+			return err
+		}
+	} else {
+		l.Remove(layout.KindReport, provides.ReportName)
+	}
+
+	err = addVEX(l, appDetails, tos, tarch, opts)
+	if err != nil {
+		return err
+	}
+
+	if drvPath, err := nixcmd.GetDrvPathFromResult(output, symlink); err == nil {
+		if log, err := nixcmd.BuildLog(drvPath); err == nil {
+			_, err = l.Add(layout.KindLog, layout.BuildLogName, "text/plain", log)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	l.Index.App = appDetails.Name
+	l.Index.Version = appDetails.Version
+	l.Index.Result = resultPath
+	l.Index.Created = time.Now().UTC()
+	return writeLayout(l)
+}
+
+// writeLayout writes the index, deletes files of previous builds and links the attestations at the root of the output directory,
+// where earlier versions of bsf wrote them
+func writeLayout(l *layout.Layout) error {
+	err := l.Write()
+	if err != nil {
+		return err
+	}
+	_, err = l.Prune()
+	if err != nil {
+		return err
+	}
+	for _, e := range l.Index.Entries {
+		if e.Kind != layout.KindAttestation {
+			continue
+		}
+		err = l.Link(layout.KindAttestation, e.Name, e.Name)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// BuildSBOMPrefix prefixes the names of the SBOMs of the build-time closure
+const BuildSBOMPrefix = "build-"
+
+// addSBOMs stores the SBOM as standalone documents in the formats, SPDX and CycloneDX when none is given, with names
+// starting with prefix. SBOMs of formats no longer asked for are removed, all of them when bom is nil.
+func addSBOMs(l *layout.Layout, prefix string, bom *sbom.Document, sbomFormats []formats.Format) error {
+	if len(sbomFormats) == 0 {
+		sbomFormats = []formats.Format{formats.SPDX23JSON, formats.CDX15JSON}
+	}
+	for _, format := range []formats.Format{formats.SPDX23JSON, formats.CDX15JSON, bsbom.Protobom} {
+		if bom == nil || !slices.Contains(sbomFormats, format) {
+			name, _ := bsbom.FileName(format)
+			l.Remove(layout.KindSBOM, prefix+name)
+		}
+	}
+	if bom == nil {
+		return nil
+	}
+
+	for _, format := range sbomFormats {
+		data, err := bsbom.Write(bom, format)
+		if err != nil {
+			return err
+		}
+		name, mediaType := bsbom.FileName(format)
+		_, err = l.Add(layout.KindSBOM, prefix+name, mediaType, data)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SliceSBOMPrefix prefixes the names of the SBOMs of the slices of a universal binary, followed by the architecture
+const SliceSBOMPrefix = "slice-"
+
+// addSliceSBOMs stores a SBOM for each slice of a universal macOS binary, its root is the thin binary of the slice.
+// The closure is shared by the slices, nix builds it for the host.
+func addSliceSBOMs(l *layout.Layout, lockFile *hcl2nix.LockFile, appDetails *nixcmd.App, graph *gographviz.Graph, opts ArtifactOptions) error {
+	stale := make([]string, 0)
+	for _, e := range l.Index.Entries {
+		if e.Kind == layout.KindSBOM && strings.HasPrefix(e.Name, SliceSBOMPrefix) {
+			stale = append(stale, e.Name)
+		}
+	}
+	for _, name := range stale {
+		l.Remove(layout.KindSBOM, name)
+	}
+	if !opts.SliceSBOMs {
+		return nil
+	}
+
+	for _, slice := range appDetails.Slices {
+		thin := *appDetails
+		thin.BinaryHash = slice.Digest
+		thin.Slices = nil
+		bom := sbomDocument(lockFile, &thin, graph, "darwin", slice.Arch, opts.Outputs...)
+		applyNamespace(bom, opts.Namespace)
+		if err := addSBOMs(l, SliceSBOMPrefix+slice.Arch+"-", bom, opts.SBOMFormats); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PlatformSBOMPrefix prefixes the names of the SBOMs of the platforms of a multi-platform image, followed by the
+// platform, e.g. platform-linux-arm64-sbom.spdx.json
+const PlatformSBOMPrefix = "platform-"
+
+// addPlatformSBOMs stores a SBOM for each platform of a multi-platform image, its root is the image of the platform,
+// and the index SBOM referencing them with the platform they select. The closure is shared by the platforms.
+func addPlatformSBOMs(l *layout.Layout, lockFile *hcl2nix.LockFile, appDetails *nixcmd.App, graph *gographviz.Graph, opts ArtifactOptions) error {
+	stale := make([]string, 0)
+	for _, e := range l.Index.Entries {
+		if e.Kind == layout.KindSBOM && (strings.HasPrefix(e.Name, PlatformSBOMPrefix) || e.Name == bsbom.IndexSBOMName) {
+			stale = append(stale, e.Name)
+		}
+	}
+	for _, name := range stale {
+		l.Remove(layout.KindSBOM, name)
+	}
+	if appDetails.Image == nil || len(appDetails.Image.Platforms) == 0 {
+		return nil
+	}
+
+	sboms := make([]bsbom.PlatformSBOM, 0)
+	for _, p := range appDetails.Image.Platforms {
+		os, arch, _ := strings.Cut(p.Platform, "/")
+		arch, _, _ = strings.Cut(arch, "/")
+		img := *appDetails.Image
+		img.IndexDigest, img.Platforms, img.ConfigDigest, img.Layers = "", nil, p.ConfigDigest, p.Layers
+		single := *appDetails
+		single.BinaryHash, single.Image = p.ConfigDigest, &img
+
+		bom := sbomDocument(lockFile, &single, graph, os, arch, opts.Outputs...)
+		applyNamespace(bom, opts.Namespace)
+		prefix := PlatformSBOMPrefix + strings.ReplaceAll(p.Platform, "/", "-") + "-"
+		if err := addSBOMs(l, prefix, bom, opts.SBOMFormats); err != nil {
+			return err
+		}
+		for _, e := range l.Index.Entries {
+			if e.Kind != layout.KindSBOM || !strings.HasPrefix(e.Name, prefix) {
+				continue
+			}
+			sboms = append(sboms, bsbom.PlatformSBOM{
+				Platform:       p.Platform,
+				ManifestDigest: p.ManifestDigest,
+				Name:           e.Name,
+				Digest:         strings.TrimPrefix(e.Digest, "sha256:"),
+				MediaType:      e.MediaType,
+				Components:     len(bom.NodeList.Nodes),
+			})
+		}
+	}
+	data, err := bsbom.IndexSBOM(bsbom.IndexImage{Name: appDetails.Name, Version: version(appDetails), IndexDigest: appDetails.Image.IndexDigest}, sboms, time.Now())
+	if err != nil {
+		return err
+	}
+	_, err = l.Add(layout.KindSBOM, bsbom.IndexSBOMName, "application/vnd.cyclonedx+json", data)
+	return err
+}
+
+// parseFormats returns the SBOM formats of their command line names
+func parseFormats(names []string) ([]formats.Format, error) {
+	parsed := make([]formats.Format, 0, len(names))
+	for _, name := range names {
+		format, err := bsbom.ParseFormat(strings.TrimSpace(name))
+		if err != nil {
+			return nil, err
+		}
+		if !slices.Contains(parsed, format) {
+			parsed = append(parsed, format)
+		}
+	}
+	return parsed, nil
+}
+
+// addBinaries copies the executables of the build result, images and other results without a bin directory are only referenced by store path
+func addBinaries(l *layout.Layout, resultPath string) error {
+	binDir := filepath.Join(resultPath, "bin")
+	entries, err := os.ReadDir(nixcmd.HostPath(binDir))
+	if err != nil {
+		return nil
+	}
+
+	for _, e := range entries {
+		target, err := nixcmd.EvalSymlinks(filepath.Join(binDir, e.Name()))
+		if err != nil {
+			continue
+		}
+		info, err := os.Stat(nixcmd.HostPath(target))
+		if err != nil || info.IsDir() {
+			continue
+		}
+		name := "bin/" + e.Name()
+		_, err = l.AddFile(layout.KindArtifact, name, "application/octet-stream", nixcmd.HostPath(target))
+		if err != nil {
+			return err
+		}
+		l.SetStorePath(layout.KindArtifact, name, target)
+	}
+	return nil
+}
+
+// certifiedSigner returns an ephemeral key certified for the workload identity, it only lives in memory. The identity
+// is detected before the build, its token is refreshed here as CI tokens expire before long builds end.
+func certifiedSigner(identity *workload.Identity) (crypto.Signer, []string, error) {
+	signer, err := signing.NewEphemeralSigner()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := identity.Refresh(context.Background(), "sigstore"); err != nil {
+		return nil, nil, err
+	}
+	certs, err := signing.RequestCertificate(context.Background(), signing.DefaultFulcioURL, signer, identity.Token, identity.Subject)
+	if err != nil {
+		return nil, nil, err
+	}
+	return signer, certs, nil
+}
+
+// SignOutput signs the attestations of the output directory of a build that ran without --sign, keyless with
+// sigstore as the CI workload identity or the OIDC token of $SIGSTORE_ID_TOKEN, and returns the subject of the identity
+func SignOutput(output string) (string, error) {
+	identity, err := workload.Signing(context.Background(), "sigstore")
+	if err != nil {
+		return "", err
+	}
+	signer, certs, err := certifiedSigner(identity)
+	if err != nil {
+		return "", err
+	}
+	return identity.Subject, SignAttestations(output, signer, certs)
+}
+
+// SignAttestations signs the attestations, the signed attestations are stored next to the unsigned ones
+func SignAttestations(output string, signer crypto.Signer, certs []string) error {
+	l, err := layout.Open(output)
+	if err != nil {
+		return err
+	}
+	attestations, err := l.Read(layout.KindAttestation, layout.AttestationsName)
+	if err != nil {
+		return err
+	}
+
+	var signed bytes.Buffer
+	err = signing.SignAttestations(&signed, attestations, signer, certs)
+	if err != nil {
+		return err
+	}
+	data := signed.Bytes()
+	// certificates of certified keys expire in minutes, the transparency log proves they were valid at signing time
+	if len(certs) > 0 {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+		defer cancel()
+		data, err = signing.RecordAttestations(ctx, signing.DefaultRekorURL, data)
+		if err != nil {
+			return fmt.Errorf("failed to record the attestations in the transparency log: %v", err)
+		}
+	}
+
+	_, err = l.Add(layout.KindAttestation, layout.SignedAttestationsName, "application/vnd.in-toto+jsonl", data)
+	if err != nil {
+		return err
+	}
+	return writeLayout(l)
+}
+
+// GenerateReceipt signs a receipt linking the source commit to the derivation, the output and the digests
+// of the files of the output directory
+func GenerateReceipt(output, symlink string, appDetails *nixcmd.App, signer crypto.Signer, certs []string, identity *workload.Identity) error {
+	l, err := layout.Open(output)
+	if err != nil {
+		return err
+	}
+
+	src, err := receipt.DetectSource()
+	if err != nil {
+		return err
+	}
+	drvPath, err := nixcmd.GetDrvPathFromResult(output, symlink)
+	if err != nil {
+		return err
+	}
+	narHash, err := nixcmd.GetNarHashFromPath(l.Index.Result)
+	if err != nil {
+		return err
+	}
+
+	r := receipt.New(l, src, drvPath, receipt.Output{StorePath: l.Index.Result, NarHash: narHash})
+	if appDetails.Image != nil {
+		r.Image = &receipt.Digest{Name: appDetails.Name, Digest: "sha256:" + appDetails.Image.ConfigDigest}
+	}
+	if identity != nil {
+		r.Builder = identity.BuilderID
+	}
+
+	signed, err := receipt.Sign(r, signer, certs)
+	if err != nil {
+		return err
+	}
+	if len(certs) > 0 {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		signed.TlogEntry, err = signing.UploadEntry(ctx, signing.DefaultRekorURL, signed.Envelope, certs[0])
+		if err != nil {
+			return fmt.Errorf("failed to record the receipt in the transparency log: %v", err)
+		}
+	}
+	data, err := json.MarshalIndent(signed, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = l.Add(layout.KindAttestation, receipt.Name, receipt.PayloadType, data)
+	if err != nil {
+		return err
+	}
+	return writeLayout(l)
+}
+
+// warnAnomalies warns about duplicate versions in the closure and direct dependencies that were not in the previous build
+func warnAnomalies(previous []byte, output string) {
+	current, err := layout.ReadAttestations(output)
+	if err != nil {
+		return
+	}
+	doc, err := bsbom.FromAttestations(current)
+	if err != nil {
+		return
+	}
+
+	var prevDoc *sbom.Document
+	if len(previous) > 0 {
+		prevDoc, _ = bsbom.FromAttestations(previous)
+	}
+
+	for _, a := range anomaly.Detect(doc, prevDoc) {
+		fmt.Println(styles.WarnStyle.Render("warning:", a.String()))
+	}
+	if unmapped := bsbom.Unmapped(doc); len(unmapped) > 0 {
+		fmt.Println(styles.HintStyle.Render(fmt.Sprintf("hint: %d components have no upstream name or CPE, list them with bsf sbom unmapped and map them with alias blocks in bsf.hcl", len(unmapped))))
+	}
+}
+
+// version returns the version of the application, DefaultAppVersion when it wasn't resolved
+func version(app *nixcmd.App) string {
+	if app.Version == "" {
+		return nixcmd.DefaultAppVersion
+	}
+	return app.Version
+}
+
+func rootNode(app *nixcmd.App, purpose sbom.Purpose, os, arch string) *sbom.Node {
+	comment := ""
+	// the metadata the purpose detector extracted, e.g. the tags of a wheel
+	if app.Detection != nil && len(app.Detection.Metadata) > 0 {
+		comment = "detected by " + app.Detection.String()
+	}
+	return &sbom.Node{
+		Id:             bsbom.GenerateID(app.Name, version(app), os, arch),
+		PrimaryPurpose: []sbom.Purpose{purpose},
+		Comment:        comment,
+		Name:           app.Name,
+		Version:        version(app),
+		Identifiers: map[int32]string{
+			int32(sbom.SoftwareIdentifierType_PURL): bsbom.GeneratePurl(app.Name, version(app), os, arch),
+		},
+		Hashes: map[int32]string{
+			int32(sbom.HashAlgorithm_SHA256): app.BinaryHash,
+		},
+	}
+}
+
+// sliceNode returns the component of a slice of the universal binary of the application. Its package url names the
+// architecture, its identifier differs from the one of the root, whose package url may name the same.
+func sliceNode(app *nixcmd.App, slice nixcmd.Slice) *sbom.Node {
+	return &sbom.Node{
+		Id:             bsbom.GenerateID(app.Name, version(app), "darwin", slice.Arch) + "-slice",
+		PrimaryPurpose: []sbom.Purpose{sbom.Purpose_EXECUTABLE},
+		Name:           app.Name,
+		Comment:        fmt.Sprintf("%s slice of the universal binary, %d bytes at offset %d", slice.Arch, slice.Size, slice.Offset),
+		Identifiers: map[int32]string{
+			int32(sbom.SoftwareIdentifierType_PURL): bsbom.GeneratePurl(app.Name, version(app), "darwin", slice.Arch),
+		},
+		Hashes: map[int32]string{
+			int32(sbom.HashAlgorithm_SHA256): slice.Digest,
+		},
+	}
+}
+
+// artifactNode returns the component of an executable or library of the result of the application, named after its
+// path in the result
+func artifactNode(app *nixcmd.App, art nixcmd.Artifact, os, arch string) *sbom.Node {
+	return &sbom.Node{
+		Id:             bsbom.GenerateID(app.Name, version(app), os, arch) + "-" + strings.NewReplacer("/", "-", ".", "-").Replace(art.Path),
+		PrimaryPurpose: []sbom.Purpose{art.Purpose},
+		Name:           filepath.Base(art.Path),
+		Comment:        art.Path + " of the result",
+		Hashes: map[int32]string{
+			int32(sbom.HashAlgorithm_SHA256): art.Digest,
+		},
+	}
+}
+
+// platformNode returns the component of the image of a platform of a multi-platform image. Its package url names
+// the platform, its hash is the digest of the image config as the one of single platform images.
+func platformNode(app *nixcmd.App, p nixcmd.PlatformImage) *sbom.Node {
+	os, arch, _ := strings.Cut(p.Platform, "/")
+	// the variant, e.g. v7 of linux/arm/v7, tells the images of an architecture apart
+	arch, variant, _ := strings.Cut(arch, "/")
+	return &sbom.Node{
+		Id:             strings.TrimSuffix(bsbom.GenerateID(app.Name, version(app), os, arch)+"-"+variant, "-") + "-platform",
+		PrimaryPurpose: []sbom.Purpose{sbom.Purpose_CONTAINER},
+		Name:           app.Name,
+		Comment:        fmt.Sprintf("%s image, manifest sha256:%s", p.Platform, p.ManifestDigest),
+		Identifiers: map[int32]string{
+			int32(sbom.SoftwareIdentifierType_PURL): bsbom.GeneratePurl(app.Name, version(app), os, arch),
+		},
+		Hashes: map[int32]string{
+			int32(sbom.HashAlgorithm_SHA256): p.ConfigDigest,
+		},
+	}
+}
+
+// outputSymlinks returns the result symlinks of the application and of the other outputs nix build created
+func outputSymlinks(output, symlink string, outputs []string) ([]string, error) {
+	symlinks := []string{symlink}
+	for _, o := range outputs {
+		if o == nixcmd.OutputName(symlink) {
+			continue
+		}
+		link := "/result-" + o
+		if _, err := os.Lstat(filepath.Join(output, link)); err != nil {
+			return nil, fmt.Errorf("output %s of the package was not built, %s is missing", o, filepath.Join(output, link))
+		}
+		symlinks = append(symlinks, link)
+	}
+	return symlinks, nil
 }
 
 func isNoFileError(err string) bool {
@@ -0,0 +1,75 @@
+//go:build integration
+
+package build
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bom-squad/protobom/pkg/formats"
+
+	"github.com/buildsafedev/bsf/pkg/bsftest"
+	"github.com/buildsafedev/bsf/pkg/hcl2nix"
+	"github.com/buildsafedev/bsf/pkg/layout"
+	nixcmd "github.com/buildsafedev/bsf/pkg/nix/cmd"
+	bsbom "github.com/buildsafedev/bsf/pkg/sbom"
+)
+
+func TestBuildPipelineIntegration(t *testing.T) {
+	s := bsftest.NewStore(t)
+	lib := s.Add(bsftest.Package{Name: "libfoo", Version: "1.2.3", Files: map[string]string{"lib/libfoo.so": "foo"}})
+	app := s.Add(bsftest.Package{
+		Name:    "app",
+		Version: "2.0.0",
+		Deps:    []string{lib},
+		Files:   map[string]string{"bin/app": "#!/bin/sh\necho app\n"},
+	})
+	s.Use()
+	output := s.Result(app)
+
+	details, graph, err := nixcmd.GetRuntimeClosureGraph("", output, bsftest.ResultSymlink, nixcmd.ClosureOptions{NoHashCache: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lockFile := &hcl2nix.LockFile{App: hcl2nix.LockApp{Name: "app"}}
+	if err := GenerateArtifcats(output, bsftest.ResultSymlink, lockFile, details, graph, "linux", "amd64", ArtifactOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := layout.Open(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l.Index.App != "app" || l.Index.Version != "2.0.0" || l.Index.Result != app {
+		t.Errorf("index = %s %s %s, want app 2.0.0 %s", l.Index.App, l.Index.Version, l.Index.Result, app)
+	}
+	attestations, err := l.Read(layout.KindAttestation, layout.AttestationsName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(strings.TrimSpace(string(attestations)), "\n") + 1; n < 3 {
+		t.Errorf("got %d attestations, want the SPDX and CycloneDX SBOMs and the provenance", n)
+	}
+
+	sbomName, _ := bsbom.FileName(formats.CDX15JSON)
+	data, err := l.Read(layout.KindSBOM, sbomName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bom, err := bsbom.Parse(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, node := range bom.NodeList.Nodes {
+		if node.Name == "libfoo" && node.Version == "1.2.3" {
+			found = true
+			if bsbom.StorePath(node) != lib {
+				t.Errorf("store path of libfoo = %s, want %s", bsbom.StorePath(node), lib)
+			}
+		}
+	}
+	if !found {
+		t.Errorf("the SBOM has no libfoo 1.2.3 component")
+	}
+}
@@ -1,6 +1,15 @@
 package build
 
-import "testing"
+import (
+	"testing"
+
+	"github.com/awalterschulze/gographviz"
+	"github.com/bom-squad/protobom/pkg/sbom"
+
+	"github.com/buildsafedev/bsf/pkg/hcl2nix"
+	nixcmd "github.com/buildsafedev/bsf/pkg/nix/cmd"
+	bsbom "github.com/buildsafedev/bsf/pkg/sbom"
+)
 
 func TestIsNoFileError(t *testing.T) {
 	tests := []struct {
@@ -33,3 +42,73 @@ func TestIsNoFileError(t *testing.T) {
 		})
 	}
 }
+
+func TestSBOMDocumentSlices(t *testing.T) {
+	app := &nixcmd.App{
+		Name:       "app",
+		BinaryHash: "fat",
+		Slices:     []nixcmd.Slice{{Arch: "amd64", Digest: "aaaa"}, {Arch: "arm64", Digest: "bbbb"}},
+	}
+	graph := gographviz.NewGraph()
+	graph.SetName("G")
+
+	bom := sbomDocument(&hcl2nix.LockFile{}, app, graph, "darwin", "arm64")
+	root := bom.NodeList.GetNodeByID(bsbom.GenerateID("app", "0.0.0", "darwin", "arm64"))
+	if root == nil || root.Hashes[int32(sbom.HashAlgorithm_SHA256)] != "fat" {
+		t.Fatalf("unexpected root %v", root)
+	}
+	for _, s := range app.Slices {
+		node := bom.NodeList.GetNodeByID(bsbom.GenerateID("app", "0.0.0", "darwin", s.Arch) + "-slice")
+		if node == nil {
+			t.Fatalf("no component for the %s slice", s.Arch)
+		}
+		if node.Hashes[int32(sbom.HashAlgorithm_SHA256)] != s.Digest {
+			t.Errorf("%s slice has digest %s, want %s", s.Arch, node.Hashes[int32(sbom.HashAlgorithm_SHA256)], s.Digest)
+		}
+		if purl := node.Identifiers[int32(sbom.SoftwareIdentifierType_PURL)]; purl != "pkg:nix/app@v0.0.0?os=darwin&arch="+s.Arch {
+			t.Errorf("unexpected purl %s", purl)
+		}
+	}
+}
+
+func TestSBOMDocumentArtifacts(t *testing.T) {
+	app := &nixcmd.App{
+		Name:       "app",
+		BinaryHash: "aaaa",
+		Artifacts: []nixcmd.Artifact{
+			{Path: "bin/app", Digest: "aaaa", Purpose: sbom.Purpose_EXECUTABLE},
+			{Path: "lib/libapp.so.1", Digest: "bbbb", Purpose: sbom.Purpose_LIBRARY},
+		},
+		Image: &nixcmd.Image{Platforms: []nixcmd.PlatformImage{
+			{Platform: "linux/amd64", ManifestDigest: "m0", ConfigDigest: "c0"},
+			{Platform: "linux/arm/v7", ManifestDigest: "m1", ConfigDigest: "c1"},
+		}},
+	}
+	graph := gographviz.NewGraph()
+	graph.SetName("G")
+
+	bom := sbomDocument(&hcl2nix.LockFile{}, app, graph, "linux", "amd64")
+	id := bsbom.GenerateID("app", "0.0.0", "linux", "amd64")
+	for suffix, want := range map[string]string{"-bin-app": "aaaa", "-lib-libapp-so-1": "bbbb"} {
+		node := bom.NodeList.GetNodeByID(id + suffix)
+		if node == nil {
+			t.Fatalf("no component %s", id+suffix)
+		}
+		if node.Hashes[int32(sbom.HashAlgorithm_SHA256)] != want {
+			t.Errorf("%s has digest %s, want %s", node.Id, node.Hashes[int32(sbom.HashAlgorithm_SHA256)], want)
+		}
+	}
+
+	for id, want := range map[string]string{
+		bsbom.GenerateID("app", "0.0.0", "linux", "amd64") + "-platform":  "c0",
+		bsbom.GenerateID("app", "0.0.0", "linux", "arm") + "-v7-platform": "c1",
+	} {
+		node := bom.NodeList.GetNodeByID(id)
+		if node == nil {
+			t.Fatalf("no component %s", id)
+		}
+		if node.Hashes[int32(sbom.HashAlgorithm_SHA256)] != want {
+			t.Errorf("%s has digest %s, want %s", id, node.Hashes[int32(sbom.HashAlgorithm_SHA256)], want)
+		}
+	}
+}
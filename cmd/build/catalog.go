@@ -0,0 +1,52 @@
+package build
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/awalterschulze/gographviz"
+
+	"github.com/buildsafedev/bsf/cmd/styles"
+	"github.com/buildsafedev/bsf/pkg/catalog"
+	"github.com/buildsafedev/bsf/pkg/hcl2nix"
+	nixcmd "github.com/buildsafedev/bsf/pkg/nix/cmd"
+)
+
+// CheckCatalog checks the components of the closure against the approved package catalog at location, with the
+// exemptions of bsf.hcl. The results of the build, the roots of the closure, are not checked.
+func CheckCatalog(graph *gographviz.Graph, lockFile *hcl2nix.LockFile, location string, results ...string) (*catalog.Report, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+	c, err := catalog.Load(ctx, location)
+	if err != nil {
+		return nil, err
+	}
+
+	isResult := make(map[string]bool, len(results))
+	for _, r := range results {
+		isResult[r] = true
+	}
+	components := make([]catalog.Component, 0, len(graph.Nodes.Nodes))
+	for _, node := range graph.Nodes.Nodes {
+		storePath := nixcmd.StoreDir + "/" + nixcmd.CleanNameFromGraph(node.Name)
+		name := node.Attrs["name"]
+		if name == "" || isResult[storePath] {
+			continue
+		}
+		components = append(components, catalog.Component{Name: name, Version: node.Attrs["version"], StorePath: storePath})
+	}
+	return c.Check(location, components, lockFile.App.Exemptions, time.Now()), nil
+}
+
+// reportCatalog prints the unapproved components of the closure and the exemptions to request for them
+func reportCatalog(report *catalog.Report) {
+	for _, r := range report.Components {
+		if r.Status == catalog.StatusUnapproved {
+			fmt.Println(styles.WarnStyle.Render(fmt.Sprintf("%s %s is not approved: %s", r.Name, r.Version, r.Reason)))
+		}
+	}
+	fmt.Println(styles.HintStyle.Render("hint: request exemptions for them and add the blocks to bsf.hcl once approved:"))
+	report.WriteRequests(os.Stdout)
+}
@@ -0,0 +1,221 @@
+package build
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"text/tabwriter"
+	"time"
+
+	"github.com/bom-squad/protobom/pkg/sbom"
+	"github.com/spf13/cobra"
+
+	diffCmd "github.com/buildsafedev/bsf/cmd/diff"
+	binit "github.com/buildsafedev/bsf/cmd/init"
+	"github.com/buildsafedev/bsf/cmd/styles"
+	"github.com/buildsafedev/bsf/pkg/diff"
+	"github.com/buildsafedev/bsf/pkg/generate"
+	"github.com/buildsafedev/bsf/pkg/hcl2nix"
+	"github.com/buildsafedev/bsf/pkg/layout"
+	nixcmd "github.com/buildsafedev/bsf/pkg/nix/cmd"
+)
+
+// MatrixSummaryName is the report of the builds of the variants of a build matrix
+const MatrixSummaryName = "matrix-summary.json"
+
+// MatrixSummary is the combined report of the builds of the variants of bsf.hcl
+type MatrixSummary struct {
+	Duration  string `json:"duration"`
+	Succeeded int    `json:"succeeded"`
+	Failed    int    `json:"failed"`
+	// Variants are the results of the builds of the variants, the project of a result is the name of its variant
+	Variants []ProjectResult `json:"variants"`
+	// Comparison is the comparison of the closures of the variants built
+	Comparison *diff.Matrix `json:"comparison"`
+}
+
+// lockedVariant returns the variant of the lock file with the name
+func lockedVariant(lockFile *hcl2nix.LockFile, name string) (*hcl2nix.Variant, error) {
+	for i := range lockFile.App.Variants {
+		if v := &lockFile.App.Variants[i]; v.Name == name {
+			return v, nil
+		}
+	}
+	return nil, fmt.Errorf("bsf.hcl declares no variant %s", name)
+}
+
+// buildVariant builds the variant of the package, the package as declared when nil, linking the result to dir
+func buildVariant(dir string, v *hcl2nix.Variant) error {
+	switch {
+	case v == nil:
+		return nixcmd.Build(dir, "bsf/.")
+	case v.Attribute != "":
+		return nixcmd.Build(dir, v.Attribute)
+	}
+	expr, err := nixcmd.VariantExpr("bsf", nixcmd.NixSystem(runtime.GOOS, runtime.GOARCH), v.Override, v.OverrideAttrs)
+	if err != nil {
+		return err
+	}
+	return nixcmd.BuildExpr(dir, expr)
+}
+
+// labelVariant labels the root component of the SBOM with the variant it was built as
+func labelVariant(bom *sbom.Document, variant string) {
+	if variant == "" {
+		return
+	}
+	root := bom.NodeList.GetNodeByID(bom.NodeList.RootElements[0])
+	comment := "variant " + variant
+	if root.Comment != "" {
+		comment = root.Comment + "; " + comment
+	}
+	root.Comment = comment
+}
+
+// buildMatrix builds the package as declared and each of its variants, each in its own process and in the directory
+// of the output named after the variant. The variants are built one after the other, as they share the bsf
+// directory of the project, nix builds the derivations of each in parallel. The closures of the variants built are
+// compared in the summary written to output with their logs.
+func buildMatrix(cmd *cobra.Command, variants []string, output string) (*MatrixSummary, error) {
+	bsf, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	args, err := projectArgs(cmd.Flags(), 1, "matrix", "variant")
+	if err != nil {
+		return nil, err
+	}
+	l, err := layout.Open(output)
+	if err != nil {
+		return nil, err
+	}
+
+	run := func(variant string, log io.Writer) error {
+		// the builds run in the directory of the project too
+		vargs := append(slices.Clone(args), "--output", filepath.Join(output, variant))
+		if variant != hcl2nix.DefaultVariant {
+			vargs = append(vargs, "--variant", variant)
+		}
+		c := exec.Command(bsf, vargs...)
+		c.Stdout, c.Stderr = log, log
+		return runBuild(c)
+	}
+	start := time.Now()
+	var logErr error
+	results := runPipelines(variants, 1, run, func(r ProjectResult, log []byte) {
+		e, err := l.Add(layout.KindLog, r.Log, "text/plain", log)
+		if err != nil && logErr == nil {
+			logErr = err
+		}
+		if r.Status == ProjectSucceeded {
+			fmt.Println(styles.SucessStyle.Render(fmt.Sprintf("%s built in %s", r.Project, r.Duration)))
+		} else {
+			fmt.Println(styles.ErrorStyle.Render(fmt.Sprintf("%s failed after %s: %s, see %s", r.Project, r.Duration, r.Error, filepath.Join(output, e.Path))))
+		}
+	})
+	if logErr != nil {
+		return nil, logErr
+	}
+
+	summary := &MatrixSummary{Duration: time.Since(start).Round(time.Millisecond).String(), Variants: results}
+	built := make([]string, 0, len(results))
+	pkgs := make(map[string][]diff.Package, len(results))
+	for _, r := range results {
+		if r.Status != ProjectSucceeded {
+			summary.Failed++
+			continue
+		}
+		summary.Succeeded++
+		if pkgs[r.Project], err = diffCmd.ReadPackages(filepath.Join(output, r.Project)); err != nil {
+			return nil, fmt.Errorf("failed to read the SBOM of variant %s: %v", r.Project, err)
+		}
+		built = append(built, r.Project)
+	}
+	summary.Comparison = diff.CompareMatrix(built, pkgs)
+
+	data, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if _, err = l.Add(layout.KindReport, MatrixSummaryName, "application/json", data); err != nil {
+		return nil, err
+	}
+	return summary, l.Write()
+}
+
+// writeMatrix writes the table of the components whose versions differ between the variants
+func writeMatrix(w io.Writer, m *diff.Matrix) {
+	if len(m.Rows) == 0 {
+		fmt.Fprintln(w, styles.TextStyle.Render(fmt.Sprintf("The %d variants have the same %d components", len(m.Variants), m.Common)))
+		return
+	}
+	fmt.Fprintln(w, styles.HighlightStyle.Render(fmt.Sprintf("%d components differ between the variants, %d are the same", len(m.Rows), m.Common)))
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprint(tw, "COMPONENT")
+	for _, v := range m.Variants {
+		fmt.Fprint(tw, "\t", v)
+	}
+	fmt.Fprintln(tw)
+	for _, row := range m.Rows {
+		fmt.Fprint(tw, row.Name)
+		for _, v := range m.Variants {
+			version := row.Versions[v]
+			if version == "" {
+				version = "-"
+			}
+			fmt.Fprint(tw, "\t", version)
+		}
+		fmt.Fprintln(tw)
+	}
+	tw.Flush()
+}
+
+// runMatrix builds the variants of bsf.hcl and exits with an error when one of the builds failed
+func runMatrix(cmd *cobra.Command) {
+	sc, fh, err := binit.GetBSFInitializers()
+	if err != nil {
+		fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+		os.Exit(1)
+	}
+	// the lock file lists the variants, each build generates it again
+	if err = generate.Generate(fh, sc); err != nil {
+		fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+		os.Exit(1)
+	}
+	lockFile, err := hcl2nix.ReadLockFile()
+	if err != nil {
+		fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+		os.Exit(1)
+	}
+	if len(lockFile.App.Variants) == 0 {
+		fmt.Println(styles.ErrorStyle.Render("error:", "bsf.hcl declares no variant blocks to build"))
+		os.Exit(1)
+	}
+	variants := []string{hcl2nix.DefaultVariant}
+	for _, v := range lockFile.App.Variants {
+		variants = append(variants, v.Name)
+	}
+	if output == "" {
+		output = "bsf-result"
+	}
+
+	fmt.Println(styles.HighlightStyle.Render(fmt.Sprintf("Building %d variants...", len(variants))))
+	summary, err := buildMatrix(cmd, variants, output)
+	if err != nil {
+		fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+		os.Exit(1)
+	}
+	if len(summary.Comparison.Variants) > 1 {
+		writeMatrix(os.Stdout, summary.Comparison)
+	}
+	if summary.Failed > 0 {
+		fmt.Println(styles.ErrorStyle.Render("error:", fmt.Sprintf("%d of %d variants failed to build, see %s", summary.Failed, len(summary.Variants), filepath.Join(output, layout.IndexFile))))
+		os.Exit(1)
+	}
+	fmt.Println(styles.SucessStyle.Render(fmt.Sprintf("Built %d variants in %s, please check the %s directory", summary.Succeeded, summary.Duration, output)))
+}
@@ -0,0 +1,31 @@
+package build
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/buildsafedev/bsf/pkg/diff"
+)
+
+func TestWriteMatrix(t *testing.T) {
+	m := &diff.Matrix{
+		Variants: []string{"default", "fips"},
+		Common:   12,
+		Rows: []diff.MatrixRow{
+			{Name: "openssl", Versions: map[string]string{"default": "3.0.13", "fips": "3.0.9"}},
+			{Name: "openssl-fips-provider", Versions: map[string]string{"fips": "3.0.9"}},
+		},
+	}
+	var buf bytes.Buffer
+	writeMatrix(&buf, m)
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("writeMatrix() = %q, want a header and a row per component", buf.String())
+	}
+	for i, want := range [][]string{{"COMPONENT", "default", "fips"}, {"openssl", "3.0.13", "3.0.9"}, {"openssl-fips-provider", "-", "3.0.9"}} {
+		if got := strings.Fields(lines[i+1]); strings.Join(got, " ") != strings.Join(want, " ") {
+			t.Errorf("line %d = %q, want %v", i+1, lines[i+1], want)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package build
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/awalterschulze/gographviz"
+
+	"github.com/buildsafedev/bsf/cmd/styles"
+	"github.com/buildsafedev/bsf/pkg/depgraph"
+	"github.com/buildsafedev/bsf/pkg/hardening"
+	"github.com/buildsafedev/bsf/pkg/hcl2nix"
+	nixcmd "github.com/buildsafedev/bsf/pkg/nix/cmd"
+	"github.com/buildsafedev/bsf/pkg/policy"
+)
+
+// CheckPolicy checks the closure against the policy block of bsf.hcl. When the policy limits the size of the closure,
+// the paths the store recorded no NAR size of, e.g. queried without the nix daemon, are dumped to size them. The
+// executables of the results are checked against its hardening block.
+func CheckPolicy(graph *gographviz.Graph, lockFile *hcl2nix.LockFile, binaries *hardening.Report, results ...string) (*policy.Report, error) {
+	p := lockFile.App.Policy
+	g := depgraph.FromDOT(graph)
+	if p.MaxClosureSize != "" {
+		for _, node := range g.Nodes {
+			if node.Attrs[policy.AttrNarSize] != "" {
+				continue
+			}
+			size, err := nixcmd.GetNarSize(node.StorePath())
+			if err != nil {
+				return nil, fmt.Errorf("failed to size %s: %v", node.StorePath(), err)
+			}
+			node.Attrs[policy.AttrNarSize] = fmt.Sprint(size)
+		}
+	}
+	now := time.Now()
+	report, err := policy.Check(p, g, now, results...)
+	if err != nil {
+		return nil, err
+	}
+	report.CheckHardening(p, binaries, now)
+	return report, nil
+}
+
+// reportPolicy prints the violations of the policy
+func reportPolicy(report *policy.Report) {
+	for _, v := range report.Violations {
+		fmt.Println(styles.ErrorStyle.Render(fmt.Sprintf("%s: %s", v.Rule, v.Message)))
+	}
+}
+
+// warnExpiringIgnores prints the ignore blocks of the policy lapsing soon, the build fails once they lapsed
+func warnExpiringIgnores(report *policy.Report) {
+	for _, i := range report.Expiring {
+		fmt.Println(styles.WarnStyle.Render(fmt.Sprintf("warning: the exception to %s for %s, owned by %s, lapses after %s", i.Rule, i.Component, i.Owner, i.Expires)))
+	}
+	if len(report.Expiring) > 0 {
+		fmt.Println(styles.HintStyle.Render("hint: renew the ignore blocks of bsf.hcl or fix the violations they except before they lapse"))
+	}
+}
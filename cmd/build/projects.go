@@ -0,0 +1,267 @@
+package build
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+
+	"github.com/buildsafedev/bsf/cmd/styles"
+	"github.com/buildsafedev/bsf/pkg/layout"
+	"github.com/buildsafedev/bsf/pkg/shutdown"
+	"github.com/buildsafedev/bsf/pkg/workspace"
+)
+
+// WorkspaceSummaryName is the report of the builds of the projects of a workspace
+const WorkspaceSummaryName = "workspace-summary.json"
+
+// Statuses of the builds of the projects of a workspace
+const (
+	ProjectSucceeded = "succeeded"
+	ProjectFailed    = "failed"
+)
+
+// ProjectResult is the outcome of the build of a project of the workspace
+type ProjectResult struct {
+	Project  string `json:"project"`
+	Status   string `json:"status"`
+	Duration string `json:"duration"`
+	Error    string `json:"error,omitempty"`
+	// Log is the name of the log of the build in the output directory of the workspace
+	Log string `json:"log"`
+}
+
+// WorkspaceSummary is the combined report of the builds of the projects of a workspace
+type WorkspaceSummary struct {
+	Jobs      int             `json:"jobs"`
+	Duration  string          `json:"duration"`
+	Succeeded int             `json:"succeeded"`
+	Failed    int             `json:"failed"`
+	Projects  []ProjectResult `json:"projects"`
+}
+
+// pipelineFunc runs the pipeline of a project, writing its output to log
+type pipelineFunc func(project string, log io.Writer) error
+
+// runPipelines runs the pipelines of the projects, at most jobs at once. The results are in the order of the
+// projects, done is called as each pipeline finishes.
+func runPipelines(projects []string, jobs int, run pipelineFunc, done func(ProjectResult, []byte)) []ProjectResult {
+	if jobs < 1 {
+		jobs = 1
+	}
+	results := make([]ProjectResult, len(projects))
+	sem := make(chan struct{}, jobs)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	for i, p := range projects {
+		wg.Add(1)
+		go func(i int, p string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			var log bytes.Buffer
+			start := time.Now()
+			err := run(p, &log)
+			r := ProjectResult{
+				Project:  p,
+				Status:   ProjectSucceeded,
+				Duration: time.Since(start).Round(time.Millisecond).String(),
+				Log:      projectLogName(p),
+			}
+			if err != nil {
+				r.Status, r.Error = ProjectFailed, err.Error()
+			}
+			results[i] = r
+
+			mu.Lock()
+			defer mu.Unlock()
+			if done != nil {
+				done(r, log.Bytes())
+			}
+		}(i, p)
+	}
+	wg.Wait()
+	return results
+}
+
+// runBuild runs the build of a pipeline in its own bsf process. When the run shuts down, the build gets SIGTERM to
+// clean up its partial outputs and record its failure itself.
+func runBuild(c *exec.Cmd) error {
+	if err := c.Start(); err != nil {
+		return err
+	}
+	defer shutdown.Register(func(error) { c.Process.Signal(syscall.SIGTERM) })()
+	return c.Wait()
+}
+
+// projectCommand returns the command building the project. The builds run concurrently, each gets its own copy of
+// the arguments.
+func projectCommand(bsf string, args []string, project string) *exec.Cmd {
+	return exec.Command(bsf, append(slices.Clone(args), "--chdir", project)...)
+}
+
+// projectLogName returns the name of the log of the build of a project, e.g. services-api.log
+func projectLogName(project string) string {
+	return strings.ReplaceAll(filepath.ToSlash(filepath.Clean(project)), "/", "-") + ".log"
+}
+
+// shareBudget splits a budget of workers between the concurrent pipelines, each gets at least one
+func shareBudget(total, jobs int) int {
+	if jobs < 1 {
+		jobs = 1
+	}
+	if share := total / jobs; share > 1 {
+		return share
+	}
+	return 1
+}
+
+// workspaceFlags are the flags of the workspace run itself, not passed on to the builds of the projects
+var workspaceFlags = map[string]bool{
+	"projects": true, "workspace": true, "jobs": true, "output": true, "chdir": true,
+	"max-jobs": true, "hash-workers": true,
+}
+
+// projectArgs returns the arguments of the builds of the projects: the flags set on the workspace run, with paths
+// made absolute as the builds run in the directories of the projects, and their share of the nix build and hashing
+// workers. The excluded flags aren't passed on either.
+func projectArgs(fs *pflag.FlagSet, jobs int, exclude ...string) ([]string, error) {
+	args := []string{"build"}
+	var err error
+	fs.Visit(func(f *pflag.Flag) {
+		if workspaceFlags[f.Name] || slices.Contains(exclude, f.Name) || err != nil {
+			return
+		}
+		values := []string{f.Value.String()}
+		if sv, ok := f.Value.(pflag.SliceValue); ok {
+			values = sv.GetSlice()
+		}
+		if _, ok := f.Annotations[workspace.PathAnnotation]; ok {
+			for i := range values {
+				if values[i], err = filepath.Abs(values[i]); err != nil {
+					return
+				}
+			}
+		}
+		args = append(args, "--"+f.Name+"="+strings.Join(values, ","))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// the budgets given on the workspace run are the ones of all the builds, by default one worker per CPU
+	for _, name := range []string{"max-jobs", "hash-workers"} {
+		total := runtime.NumCPU()
+		if f := fs.Lookup(name); f != nil && f.Changed {
+			total, _ = strconv.Atoi(f.Value.String())
+		}
+		args = append(args, "--"+name+"="+strconv.Itoa(shareBudget(total, jobs)))
+	}
+	return args, nil
+}
+
+// buildProjects builds the projects of the workspace concurrently, each in its own process and output directory.
+// The projects share the caches bsf and nix keep in the user's cache directory, such as the nixpkgs metadata and
+// the evaluation cache. The logs of the builds and the combined summary are written to output.
+func buildProjects(cmd *cobra.Command, projects []string, jobs int, output string) (*WorkspaceSummary, error) {
+	bsf, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	args, err := projectArgs(cmd.Flags(), jobs)
+	if err != nil {
+		return nil, err
+	}
+	l, err := layout.Open(output)
+	if err != nil {
+		return nil, err
+	}
+
+	run := func(project string, log io.Writer) error {
+		c := projectCommand(bsf, args, project)
+		c.Stdout, c.Stderr = log, log
+		return runBuild(c)
+	}
+	start := time.Now()
+	var logErr error
+	results := runPipelines(projects, jobs, run, func(r ProjectResult, log []byte) {
+		e, err := l.Add(layout.KindLog, r.Log, "text/plain", log)
+		if err != nil && logErr == nil {
+			logErr = err
+		}
+		if r.Status == ProjectSucceeded {
+			fmt.Println(styles.SucessStyle.Render(fmt.Sprintf("%s built in %s", r.Project, r.Duration)))
+		} else {
+			fmt.Println(styles.ErrorStyle.Render(fmt.Sprintf("%s failed after %s: %s, see %s", r.Project, r.Duration, r.Error, filepath.Join(output, e.Path))))
+		}
+	})
+	if logErr != nil {
+		return nil, logErr
+	}
+
+	summary := &WorkspaceSummary{
+		Jobs:     jobs,
+		Duration: time.Since(start).Round(time.Millisecond).String(),
+		Projects: results,
+	}
+	for _, r := range results {
+		if r.Status == ProjectSucceeded {
+			summary.Succeeded++
+		} else {
+			summary.Failed++
+		}
+	}
+	data, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if _, err = l.Add(layout.KindReport, WorkspaceSummaryName, "application/json", data); err != nil {
+		return nil, err
+	}
+	return summary, l.Write()
+}
+
+// runWorkspace builds the projects of the workspace and exits with an error when one of the builds failed
+func runWorkspace(cmd *cobra.Command) {
+	if allProjects {
+		found, err := workspace.FindProjects(".")
+		if err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+			os.Exit(1)
+		}
+		projects = append(projects, found...)
+	}
+	if len(projects) == 0 {
+		fmt.Println(styles.ErrorStyle.Render("error:", "no bsf project in the subdirectories of the workspace"))
+		os.Exit(1)
+	}
+	if output == "" {
+		output = "bsf-result"
+	}
+
+	fmt.Println(styles.HighlightStyle.Render(fmt.Sprintf("Building %d projects, %d at a time...", len(projects), jobs)))
+	summary, err := buildProjects(cmd, projects, jobs, output)
+	if err != nil {
+		fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+		os.Exit(1)
+	}
+	if summary.Failed > 0 {
+		fmt.Println(styles.ErrorStyle.Render("error:", fmt.Sprintf("%d of %d projects failed to build, see %s", summary.Failed, len(summary.Projects), filepath.Join(output, layout.IndexFile))))
+		os.Exit(1)
+	}
+	fmt.Println(styles.SucessStyle.Render(fmt.Sprintf("Built %d projects in %s", summary.Succeeded, summary.Duration)))
+}
@@ -0,0 +1,145 @@
+package build
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/spf13/pflag"
+
+	"github.com/buildsafedev/bsf/pkg/workspace"
+)
+
+func TestRunPipelines(t *testing.T) {
+	var running, peak int32
+	run := func(project string, log io.Writer) error {
+		n := atomic.AddInt32(&running, 1)
+		for {
+			p := atomic.LoadInt32(&peak)
+			if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		atomic.AddInt32(&running, -1)
+		fmt.Fprintf(log, "building %s\n", project)
+		if project == "services/worker" {
+			return errors.New("exit status 1")
+		}
+		return nil
+	}
+
+	logs := map[string]string{}
+	projects := []string{"cli", "services/api", "services/worker", "web", "docs"}
+	results := runPipelines(projects, 2, run, func(r ProjectResult, log []byte) {
+		logs[r.Project] = string(log)
+	})
+
+	if peak > 2 {
+		t.Errorf("%d pipelines ran at once, want at most 2", peak)
+	}
+	for i, r := range results {
+		if r.Project != projects[i] {
+			t.Errorf("result %d is %s, want %s", i, r.Project, projects[i])
+		}
+		wantStatus := ProjectSucceeded
+		if r.Project == "services/worker" {
+			wantStatus = ProjectFailed
+		}
+		if r.Status != wantStatus {
+			t.Errorf("%s: status %s, want %s", r.Project, r.Status, wantStatus)
+		}
+		if logs[r.Project] != "building "+r.Project+"\n" {
+			t.Errorf("%s: log %q", r.Project, logs[r.Project])
+		}
+	}
+	if results[1].Log != "services-api.log" {
+		t.Errorf("log name %s, want services-api.log", results[1].Log)
+	}
+}
+
+func TestProjectCommand(t *testing.T) {
+	// spare capacity, as projectArgs leaves it, would be shared by the builds
+	args := make([]string, 0, 16)
+	args = append(args, "build", "--sign=true")
+	projects := []string{"cli", "services/api", "services/worker", "web", "docs"}
+
+	commands := make([][]string, len(projects))
+	var ready sync.WaitGroup
+	ready.Add(len(projects))
+	runPipelines(projects, len(projects), func(project string, log io.Writer) error {
+		// all the builds start at once
+		ready.Done()
+		ready.Wait()
+		commands[slices.Index(projects, project)] = projectCommand("bsf", args, project).Args
+		return nil
+	}, func(ProjectResult, []byte) {})
+
+	for i, project := range projects {
+		want := []string{"bsf", "build", "--sign=true", "--chdir", project}
+		if !reflect.DeepEqual(commands[i], want) {
+			t.Errorf("command of %s = %v, want %v", project, commands[i], want)
+		}
+	}
+}
+
+func TestShareBudget(t *testing.T) {
+	tests := []struct {
+		total, jobs, want int
+	}{
+		{total: 16, jobs: 4, want: 4},
+		{total: 10, jobs: 4, want: 2},
+		{total: 2, jobs: 4, want: 1},
+		{total: 8, jobs: 0, want: 8},
+	}
+	for _, tt := range tests {
+		if got := shareBudget(tt.total, tt.jobs); got != tt.want {
+			t.Errorf("shareBudget(%d, %d) = %d, want %d", tt.total, tt.jobs, got, tt.want)
+		}
+	}
+}
+
+func TestProjectArgs(t *testing.T) {
+	var (
+		out, key      string
+		formats, list []string
+		maxJobs       int
+		scan          bool
+	)
+	fs := pflag.NewFlagSet("build", pflag.ContinueOnError)
+	fs.StringVar(&out, "output", "", "")
+	fs.StringVar(&key, "receipt-key", "", "")
+	fs.StringSliceVar(&formats, "format", nil, "")
+	fs.StringSliceVar(&list, "projects", nil, "")
+	fs.IntVar(&maxJobs, "max-jobs", 0, "")
+	fs.BoolVar(&scan, "scan", false, "")
+	workspace.MarkPaths(fs, "output", "receipt-key")
+	if err := fs.Parse([]string{"--output", "out", "--receipt-key", "keys/receipt.pem", "--format", "spdx-json,protobom", "--projects", "a,b", "--max-jobs", "8", "--scan"}); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := projectArgs(fs, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	abs, _ := filepath.Abs("keys/receipt.pem")
+	want := []string{"build", "--format=spdx-json,protobom", "--receipt-key=" + abs, "--scan=true", "--max-jobs=2"}
+	if !reflect.DeepEqual(got[:len(want)], want) || len(got) != len(want)+1 {
+		t.Errorf("projectArgs() = %v, want %v and the hash workers", got, want)
+	}
+
+	got, err = projectArgs(fs, 4, "scan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if slices.Contains(got, "--scan=true") {
+		t.Errorf("projectArgs() = %v, want --scan excluded", got)
+	}
+}
@@ -0,0 +1,85 @@
+package build
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/awalterschulze/gographviz"
+	"github.com/bom-squad/protobom/pkg/sbom"
+
+	"github.com/buildsafedev/bsf/cmd/styles"
+	"github.com/buildsafedev/bsf/pkg/builddb"
+	"github.com/buildsafedev/bsf/pkg/buildhost"
+	"github.com/buildsafedev/bsf/pkg/componentstore"
+	"github.com/buildsafedev/bsf/pkg/depgraph"
+	"github.com/buildsafedev/bsf/pkg/git"
+	"github.com/buildsafedev/bsf/pkg/loader"
+	nixcmd "github.com/buildsafedev/bsf/pkg/nix/cmd"
+	"github.com/buildsafedev/bsf/pkg/osv"
+)
+
+// RecordBuild records the build of the app in the build database bsf report trends reports from. The vulnerabilities
+// are counted when the closure was scanned, the builds of a variant are recorded apart from the others. Failing to
+// record the build doesn't fail it.
+func RecordBuild(project, variant, output string, appDetails *nixcmd.App, graph *gographviz.Graph, scanned bool, findings []osv.Finding) {
+	r := builddb.Measure(project, appDetails.Version, appDetails.StorePath, depgraph.FromDOT(graph))
+	// bsf prune keeps the last builds of each branch and removes the artifacts of the others from their output
+	r.Branch, _ = git.CurrentBranch()
+	r.Variant = variant
+	r.Builder = builderFingerprint()
+	if abs, err := filepath.Abs(output); err == nil {
+		r.Output = abs
+	}
+	if scanned {
+		open := openCVEs(findings)
+		r.OpenCVEs = &open
+	}
+	if err := builddb.Append(r); err != nil {
+		fmt.Println(styles.WarnStyle.Render("warning: failed to record the build:", err.Error()))
+	}
+}
+
+var (
+	builder     *buildhost.Fingerprint
+	builderOnce sync.Once
+)
+
+// builderFingerprint returns the fingerprint of the host and nix installation of the builds, probed once per run. The
+// builds of a workspace share it.
+func builderFingerprint() *buildhost.Fingerprint {
+	builderOnce.Do(func() {
+		version, _ := nixcmd.NixVersion()
+		config, _ := nixcmd.NixShowConfig()
+		builder = buildhost.Probe(version, config)
+	})
+	return builder
+}
+
+// openCVEs returns the number of distinct vulnerabilities of the findings that may affect the application
+func openCVEs(findings []osv.Finding) int {
+	ids := make(map[string]bool)
+	for _, f := range findings {
+		if f.Component.Reachability != loader.Unreachable {
+			ids[f.Vulnerability.ID] = true
+		}
+	}
+	return len(ids)
+}
+
+// storeComponents stores the SBOM in the component store shared by the projects, as a reference document to the
+// components other builds already stored. Failing to store it doesn't fail the build.
+func storeComponents(dir, project string, appDetails *nixcmd.App, bom *sbom.Document) {
+	s, err := componentstore.Open(dir)
+	if err != nil {
+		fmt.Println(styles.WarnStyle.Render("warning: failed to open the component store:", err.Error()))
+		return
+	}
+	res, err := s.Put(project, filepath.Base(appDetails.StorePath), bom, time.Now())
+	if err != nil {
+		fmt.Println(styles.WarnStyle.Render("warning: failed to store the SBOM in the component store:", err.Error()))
+		return
+	}
+	fmt.Println(styles.TextStyle.Render(fmt.Sprintf("Stored the SBOM in the component store, %d of its %d components were new", res.Added, res.Components)))
+}
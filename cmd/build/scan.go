@@ -0,0 +1,177 @@
+package build
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/awalterschulze/gographviz"
+	"github.com/bom-squad/protobom/pkg/sbom"
+
+	"github.com/buildsafedev/bsf/pkg/embedded"
+	"github.com/buildsafedev/bsf/pkg/enrichdb"
+	"github.com/buildsafedev/bsf/pkg/hcl2nix"
+	"github.com/buildsafedev/bsf/pkg/layout"
+	"github.com/buildsafedev/bsf/pkg/loader"
+	nixcmd "github.com/buildsafedev/bsf/pkg/nix/cmd"
+	"github.com/buildsafedev/bsf/pkg/osv"
+	bsbom "github.com/buildsafedev/bsf/pkg/sbom"
+	"github.com/buildsafedev/bsf/pkg/vex"
+)
+
+// ScanOptions configures the vulnerability scan of the closure
+type ScanOptions struct {
+	// Databases are the offline OSV databases fetched with bsf db fetch, e.g. osv/PyPI. osv.dev is queried when empty.
+	Databases []string
+	// Embedded are the packages embedded in the store paths of the closure, scanned as components of their store path
+	Embedded map[string][]embedded.Package
+}
+
+// ScanClosure matches the components of the closure that have an upstream package url against OSV and annotates
+// the graph with their vulnerabilities. It returns the findings and the number of components that were scanned.
+func ScanClosure(graph *gographviz.Graph, lockFile *hcl2nix.LockFile, opts ScanOptions) ([]osv.Finding, int, error) {
+	src, err := OSVSource(opts.Databases)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	components := append(closureComponents(graph, lockFile), embeddedComponents(graph, opts.Embedded)...)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+	findings, err := osv.Scan(ctx, src, components)
+	if err != nil {
+		return nil, 0, err
+	}
+	osv.Annotate(graph, findings)
+	return findings, len(components), nil
+}
+
+// OSVSource returns the offline OSV databases fetched with bsf db fetch, e.g. osv/PyPI, osv.dev when there are none
+func OSVSource(databases []string) (osv.Source, error) {
+	if len(databases) == 0 {
+		return osv.NewClient(), nil
+	}
+	lock, err := enrichdb.ReadLock(enrichdb.LockFile)
+	if err != nil {
+		return nil, err
+	}
+	paths := make([]string, 0, len(databases))
+	for _, name := range databases {
+		path, err := enrichdb.Cached(lock, name)
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, path)
+	}
+	return osv.OpenDB(paths...)
+}
+
+// closureComponents returns the components of the closure that have the package url of an OSV ecosystem,
+// through the alias blocks of bsf.hcl and the aliases bsf ships
+func closureComponents(graph *gographviz.Graph, lockFile *hcl2nix.LockFile) []osv.Component {
+	aliases := bsbom.NewAliases(lockFile.App.Aliases)
+	components := make([]osv.Component, 0)
+	for _, node := range graph.Nodes.Nodes {
+		name, version := node.Attrs["name"], node.Attrs["version"]
+		if name == "" {
+			continue
+		}
+		purl := aliases.Identifiers(name, version)[int32(sbom.SoftwareIdentifierType_PURL)]
+		if _, _, _, ok := osv.Package(purl); !ok {
+			continue
+		}
+		components = append(components, osv.Component{
+			Node:         node.Name,
+			Name:         name,
+			Version:      version,
+			Purl:         purl,
+			Reachability: node.Attrs[loader.Attr],
+		})
+	}
+	return components
+}
+
+// embeddedComponents returns the packages embedded in the store paths of the closure that are of an OSV ecosystem,
+// their vulnerabilities are annotated on the node of their store path
+func embeddedComponents(graph *gographviz.Graph, packages map[string][]embedded.Package) []osv.Component {
+	components := make([]osv.Component, 0)
+	for _, node := range graph.Nodes.Nodes {
+		for _, p := range packages[nixcmd.StoreDir+"/"+nixcmd.CleanNameFromGraph(node.Name)] {
+			purl := p.Purl()
+			if _, _, _, ok := osv.Package(purl); !ok {
+				continue
+			}
+			components = append(components, osv.Component{
+				Node:         node.Name,
+				Name:         p.Name,
+				Version:      p.Version,
+				Purl:         purl,
+				Reachability: node.Attrs[loader.Attr],
+			})
+		}
+	}
+	return components
+}
+
+// addVEX stores the VEX document of the findings when the closure was scanned, and removes the documents of a
+// previous scan otherwise
+func addVEX(l *layout.Layout, appDetails *nixcmd.App, tos, tarch string, opts ArtifactOptions) error {
+	for _, format := range []string{vex.FormatOpenVEX, vex.FormatCycloneDX} {
+		if format == opts.VEXFormat {
+			continue
+		}
+		name, _ := vex.FileName(format)
+		l.Remove(layout.KindReport, name)
+	}
+	if opts.VEXFormat == "" {
+		return nil
+	}
+
+	name, err := vex.FileName(opts.VEXFormat)
+	if err != nil {
+		return err
+	}
+	product := vex.Product{
+		Purl: rootNode(appDetails, sbom.Purpose_APPLICATION, tos, tarch).Identifiers[int32(sbom.SoftwareIdentifierType_PURL)],
+		ComponentID: func(name, version string) string {
+			return bsbom.GenerateID(name, version, "", "")
+		},
+	}
+	data, err := vex.Write(opts.VEXFormat, product, opts.Findings, time.Now())
+	if err != nil {
+		return err
+	}
+	_, err = l.Add(layout.KindReport, name, "application/json", data)
+	return err
+}
+
+// failingFindings returns the findings at or above the severity that affect the application. Components the
+// entrypoints don't load are not affected.
+func failingFindings(findings []osv.Finding, threshold osv.Severity) []osv.Finding {
+	failing := make([]osv.Finding, 0)
+	for _, f := range osv.AtLeast(findings, threshold) {
+		if f.Component.Reachability != loader.Unreachable {
+			failing = append(failing, f)
+		}
+	}
+	return failing
+}
+
+// summarize returns the number of findings by severity, e.g. "2 critical, 1 medium"
+func summarize(findings []osv.Finding) string {
+	counts := make(map[osv.Severity]int)
+	for _, f := range findings {
+		counts[f.Severity]++
+	}
+	summary := ""
+	for s := osv.SeverityCritical; s >= osv.SeverityUnknown; s-- {
+		if counts[s] == 0 {
+			continue
+		}
+		if summary != "" {
+			summary += ", "
+		}
+		summary += fmt.Sprintf("%d %s", counts[s], s)
+	}
+	return summary
+}
@@ -0,0 +1,252 @@
+package bundle
+
+import (
+	"context"
+	"crypto"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/buildsafedev/bsf/cmd/styles"
+	"github.com/buildsafedev/bsf/pkg/airgap"
+	"github.com/buildsafedev/bsf/pkg/oci"
+	"github.com/buildsafedev/bsf/pkg/receipt"
+	"github.com/buildsafedev/bsf/pkg/signing"
+)
+
+var (
+	output        string
+	image         string
+	trustRootPath string
+	ttlDays       int
+	keyPath       string
+	insecure      bool
+
+	certIdentity string
+	certIssuer   string
+)
+
+func init() {
+	createCmd.Flags().StringVarP(&output, "output", "o", "bsf-bundle", "directory to write the bundle to")
+	createCmd.Flags().StringVarP(&image, "image", "", "", "image reference to pull from the registry into the bundle, e.g. ghcr.io/org/app:v1")
+	createCmd.Flags().StringVarP(&trustRootPath, "trust-root", "", "", "trust root to bundle, fetched from Sigstore when not set")
+	createCmd.Flags().IntVarP(&ttlDays, "trust-root-ttl", "", 30, "days before a fetched trust root expires")
+	createCmd.Flags().BoolVarP(&insecure, "insecure-registry", "", false, "pull the image over plain HTTP")
+
+	trustRootCmd.Flags().StringVarP(&output, "output", "o", "trust-root.json", "file to write the trust root to")
+	trustRootCmd.Flags().IntVarP(&ttlDays, "ttl", "", 30, "days before the trust root expires")
+
+	verifyCmd.Flags().StringVarP(&trustRootPath, "trust-root", "", "", "trust root obtained out of band, the trust root of the bundle is used when not set")
+	verifyCmd.Flags().StringVarP(&certIdentity, "certificate-identity", "", "", "identity the certificates of keyless signatures must be issued for, e.g. the workflow URI of the trusted builder")
+	verifyCmd.Flags().StringVarP(&certIssuer, "certificate-oidc-issuer", "", "", "OIDC issuer of the identity of keyless signatures, e.g. https://token.actions.githubusercontent.com")
+	verifyCmd.Flags().StringVarP(&keyPath, "key", "", "", "PEM encoded public key of signatures made with a key of their own")
+
+	mirrorCmd.Flags().BoolVarP(&insecure, "insecure-registry", "", false, "push the image over plain HTTP")
+
+	BundleCmd.AddCommand(createCmd)
+	BundleCmd.AddCommand(trustRootCmd)
+	BundleCmd.AddCommand(verifyCmd)
+	BundleCmd.AddCommand(mirrorCmd)
+}
+
+// BundleCmd represents the bundle command
+var BundleCmd = &cobra.Command{
+	Use:   "bundle",
+	Short: "creates and verifies bundles for disconnected environments",
+	Long: `bundles the output directory of a build with the transparency log entries of its signatures, the image pulled
+	from the registry and the trust root needed to check them, so builds can be verified without network access.
+
+	bsf bundle create bsf-result --image ghcr.io/org/app:v1 -o app-bundle
+	bsf bundle verify app-bundle --trust-root trust-root.json --certificate-identity <workflow URI> --certificate-oidc-issuer <issuer>
+	bsf bundle mirror app-bundle registry.internal/org/app:v1
+	`,
+	Run: func(cmd *cobra.Command, args []string) {
+		fmt.Println(styles.HintStyle.Render("hint: use bsf bundle with a subcommand"))
+		os.Exit(1)
+	},
+}
+
+var createCmd = &cobra.Command{
+	Use:   "create [output directory]",
+	Short: "bundles the output directory of a build",
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		dir := "bsf-result"
+		if len(args) == 1 {
+			dir = args[0]
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+		defer cancel()
+
+		opts := airgap.Options{RekorURL: signing.DefaultRekorURL}
+		if trustRootPath != "" {
+			opts.TrustRoot = readTrustRoot()
+		} else {
+			root, err := signing.FetchTrustRoot(ctx, signing.DefaultFulcioURL, signing.DefaultRekorURL, time.Duration(ttlDays)*24*time.Hour)
+			if err != nil {
+				fmt.Println(styles.WarnStyle.Render("warning: bundling without trust root, keyless signatures can't be verified:", err.Error()))
+			}
+			opts.TrustRoot = root
+		}
+		if image != "" {
+			ref, err := oci.ParseReference(image)
+			if err != nil {
+				fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+				os.Exit(1)
+			}
+			opts.Image = ref
+			opts.Registry = oci.NewClient()
+			opts.Registry.Insecure = insecure
+		}
+
+		m, err := airgap.Create(ctx, dir, output, opts)
+		if err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+			os.Exit(1)
+		}
+		if m.TrustRoot != nil {
+			fmt.Println(styles.TextStyle.Render(fmt.Sprintf("Trust root valid until %s", m.TrustRoot.Expires.Format(time.DateOnly))))
+		}
+		fmt.Println(styles.SucessStyle.Render(fmt.Sprintf("Bundle of %s written to %s", dir, output)))
+	},
+}
+
+var trustRootCmd = &cobra.Command{
+	Use:   "trust-root",
+	Short: "fetches the Sigstore trust root to verify bundles with",
+	Long: `fetches the certificate chain of Fulcio and the key of Rekor. Distribute it to disconnected verifiers over a
+	trusted channel, and fetch a new one before it expires.
+	`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+
+		root, err := signing.FetchTrustRoot(ctx, signing.DefaultFulcioURL, signing.DefaultRekorURL, time.Duration(ttlDays)*24*time.Hour)
+		if err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+			os.Exit(1)
+		}
+		data, err := json.MarshalIndent(root, "", "  ")
+		if err == nil {
+			err = os.WriteFile(output, data, 0644)
+		}
+		if err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+			os.Exit(1)
+		}
+		fmt.Println(styles.SucessStyle.Render(fmt.Sprintf("Trust root valid until %s written to %s", root.Expires.Format(time.DateOnly), output)))
+	},
+}
+
+var verifyCmd = &cobra.Command{
+	Use:   "verify <bundle>",
+	Short: "verifies a bundle without network access",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		opts := airgap.VerifyOptions{
+			Now:      time.Now(),
+			Identity: signing.Identity{Subject: certIdentity, Issuer: certIssuer},
+		}
+		if trustRootPath != "" {
+			opts.TrustRoot = readTrustRoot()
+		} else {
+			fmt.Println(styles.WarnStyle.Render("warning: using the trust root of the bundle, pass --trust-root with one obtained out of band"))
+		}
+		if keyPath != "" {
+			opts.Key = readKey()
+		} else if certIdentity == "" || certIssuer == "" {
+			fmt.Println(styles.ErrorStyle.Render("error: pass the --key of the signatures, or the --certificate-identity and --certificate-oidc-issuer they were signed by"))
+			os.Exit(1)
+		}
+
+		if opts.TrustRoot != nil && opts.TrustRoot.ExpiresWithin(opts.Now, 7*24*time.Hour) {
+			fmt.Println(styles.WarnStyle.Render(fmt.Sprintf("warning: the trust root expires on %s", opts.TrustRoot.Expires.Format(time.DateOnly))))
+		}
+
+		checks, err := airgap.Verify(args[0], opts)
+		if err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+			os.Exit(1)
+		}
+		for _, c := range checks {
+			switch c.Status {
+			case receipt.StatusOK:
+				fmt.Println(styles.SucessStyle.Render("✔", c.Link+":", c.Detail))
+			case receipt.StatusSkipped:
+				fmt.Println(styles.WarnStyle.Render("-", c.Link+":", c.Detail))
+			default:
+				fmt.Println(styles.ErrorStyle.Render("✘", c.Link+":", c.Detail))
+			}
+		}
+
+		if failed := receipt.Failed(checks); len(failed) > 0 {
+			fmt.Println(styles.ErrorStyle.Render(fmt.Sprintf("error: %d checks failed", len(failed))))
+			os.Exit(1)
+		}
+		fmt.Println(styles.SucessStyle.Render(fmt.Sprintf("Bundle %s verified", args[0])))
+	},
+}
+
+var mirrorCmd = &cobra.Command{
+	Use:   "mirror <bundle> <image>",
+	Short: "pushes the image of a bundle to a registry of the disconnected environment",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		m, err := airgap.ReadManifest(args[0])
+		if err == nil && m.Image == nil {
+			err = fmt.Errorf("%s has no image, create it with --image", args[0])
+		}
+		if err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+			os.Exit(1)
+		}
+		ref, err := oci.ParseReference(args[1])
+		if err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+			os.Exit(1)
+		}
+
+		client := oci.NewClient()
+		client.Insecure = insecure
+		err = client.PushDir(context.Background(), filepath.Join(args[0], airgap.ImageDir), ref)
+		if err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+			os.Exit(1)
+		}
+		fmt.Println(styles.SucessStyle.Render(fmt.Sprintf("Mirrored %s (%s) to %s", m.Image.Reference, m.Image.Digest, ref)))
+	},
+}
+
+func readTrustRoot() *signing.TrustRoot {
+	data, err := os.ReadFile(trustRootPath)
+	if err != nil {
+		fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+		os.Exit(1)
+	}
+	root := &signing.TrustRoot{}
+	if err := json.Unmarshal(data, root); err != nil {
+		fmt.Println(styles.ErrorStyle.Render("error: failed to parse trust root:", err.Error()))
+		os.Exit(1)
+	}
+	return root
+}
+
+func readKey() crypto.PublicKey {
+	data, err := os.ReadFile(keyPath)
+	if err != nil {
+		fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+		os.Exit(1)
+	}
+	key, err := signing.ParsePublicKeyPEM(data)
+	if err != nil {
+		fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+		os.Exit(1)
+	}
+	return key
+}
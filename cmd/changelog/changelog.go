@@ -0,0 +1,123 @@
+package changelog
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	buildsafev1 "github.com/buildsafedev/bsf-apis/go/buildsafe/v1"
+	"github.com/spf13/cobra"
+
+	"github.com/buildsafedev/bsf/cmd/configure"
+	"github.com/buildsafedev/bsf/cmd/styles"
+	"github.com/buildsafedev/bsf/pkg/changelog"
+	"github.com/buildsafedev/bsf/pkg/clients/search"
+	"github.com/buildsafedev/bsf/pkg/diff"
+	bsbom "github.com/buildsafedev/bsf/pkg/sbom"
+)
+
+var (
+	output, from, to string
+	skipCVEs         bool
+)
+
+func init() {
+	ChangelogCmd.Flags().StringVarP(&output, "output", "o", "", "location of the markdown changelog generated")
+	ChangelogCmd.Flags().StringVarP(&from, "from", "", "", "label of the old build, ex: v1.0.0")
+	ChangelogCmd.Flags().StringVarP(&to, "to", "", "", "label of the new build, ex: v1.1.0")
+	ChangelogCmd.Flags().BoolVarP(&skipCVEs, "skip-cves", "", false, "do not look up vulnerabilities fixed by upgrades")
+}
+
+// ChangelogCmd represents the changelog command
+var ChangelogCmd = &cobra.Command{
+	Use:   "changelog",
+	Short: "generates a dependency changelog between two builds",
+	Long: `generates a markdown changelog of dependency upgrades, additions, removals and fixed CVEs
+	between two builds, using the attestations generated by bsf build or bsf oci.
+
+	bsf changelog <old attestations> <new attestations>
+	bsf changelog v1/attestations.intoto.jsonl bsf-result/attestations.intoto.jsonl --from v1.0.0 --to v1.1.0 -o CHANGES.md
+	`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) != 2 {
+			fmt.Println(styles.HintStyle.Render("hint:", "run `bsf changelog <old attestations> <new attestations>`"))
+			os.Exit(1)
+		}
+
+		oldPkgs, err := readPackages(args[0])
+		if err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+			os.Exit(1)
+		}
+		newPkgs, err := readPackages(args[1])
+		if err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+			os.Exit(1)
+		}
+
+		if from == "" {
+			from = args[0]
+		}
+		if to == "" {
+			to = args[1]
+		}
+
+		var sc buildsafev1.SearchServiceClient
+		if !skipCVEs {
+			conf, err := configure.PreCheckConf()
+			if err != nil {
+				fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+				os.Exit(1)
+			}
+			sc, err = search.NewClientWithAddr(conf.BuildSafeAPI, conf.BuildSafeAPITLS)
+			if err != nil {
+				fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+				os.Exit(1)
+			}
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 120*time.Second)
+		defer cancel()
+
+		cl, err := changelog.New(ctx, sc, from, to, diff.Compare(oldPkgs, newPkgs))
+		if err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+			os.Exit(1)
+		}
+
+		var w io.Writer
+		if output == "" {
+			w = os.Stdout
+		} else {
+			f, err := os.Create(output)
+			if err != nil {
+				fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+				os.Exit(1)
+			}
+			defer f.Close()
+			w = f
+		}
+
+		err = cl.WriteMarkdown(w)
+		if err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+			os.Exit(1)
+		}
+	},
+}
+
+func readPackages(attestationsPath string) ([]diff.Package, error) {
+	data, err := os.ReadFile(attestationsPath)
+	if err != nil {
+		return nil, err
+	}
+
+	doc, err := bsbom.FromAttestations(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read SBOM from %s: %v", attestationsPath, err)
+	}
+
+	return diff.PackagesFromSBOM(doc), nil
+}
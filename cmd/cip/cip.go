@@ -0,0 +1,101 @@
+package cip
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/buildsafedev/bsf/cmd/styles"
+	"github.com/buildsafedev/bsf/pkg/hcl2nix"
+	"github.com/buildsafedev/bsf/pkg/policycontroller"
+	"github.com/buildsafedev/bsf/pkg/workspace"
+)
+
+var (
+	output string
+)
+
+func init() {
+	CIPCmd.Flags().StringVarP(&output, "output", "o", "", "location of the policy generated")
+	workspace.MarkPaths(CIPCmd.Flags(), "output")
+}
+
+// CIPCmd represents the clusterimagepolicy command
+var CIPCmd = &cobra.Command{
+	Use:     "cip",
+	Short:   "cip generates a sigstore policy-controller ClusterImagePolicy for the image",
+	Aliases: []string{"clusterimagepolicy"},
+	Long: `
+	cip generates a ClusterImagePolicy describing how images built for the environment should be verified,
+	based on the signing block defined in bsf.hcl.
+
+	bsf cip <environment name>
+	bsf cip <environment name> --output <output filename>
+	`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) < 1 {
+			fmt.Println(styles.HintStyle.Render("hint:", "run `bsf cip <environment name>` to generate the policy"))
+			os.Exit(1)
+		}
+
+		data, err := os.ReadFile("bsf.hcl")
+		if err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error: ", err.Error()))
+			os.Exit(1)
+		}
+
+		var dstErr bytes.Buffer
+		conf, err := hcl2nix.ReadConfig(data, &dstErr)
+		if err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error: ", dstErr.String()))
+			os.Exit(1)
+		}
+
+		env, err := findEnvironment(conf, args[0])
+		if err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error: ", err.Error()))
+			os.Exit(1)
+		}
+
+		policy, err := policycontroller.NewClusterImagePolicy(env, conf.Signing)
+		if err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error: ", err.Error()))
+			os.Exit(1)
+		}
+
+		var w io.Writer
+		if output == "" {
+			w = os.Stdout
+		} else {
+			f, err := os.Create(output)
+			if err != nil {
+				fmt.Println(styles.ErrorStyle.Render("error: ", err.Error()))
+				os.Exit(1)
+			}
+			defer f.Close()
+			w = f
+		}
+
+		err = policy.Write(w)
+		if err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error: ", err.Error()))
+			os.Exit(1)
+		}
+	},
+}
+
+func findEnvironment(conf *hcl2nix.Config, envName string) (hcl2nix.OCIArtifact, error) {
+	envNames := make([]string, 0, len(conf.OCIArtifact))
+	for _, ec := range conf.OCIArtifact {
+		if ec.Environment == envName {
+			return ec, nil
+		}
+		envNames = append(envNames, ec.Environment)
+	}
+
+	return hcl2nix.OCIArtifact{}, fmt.Errorf("No such environment found. Valid oci environments are: %s", strings.Join(envNames, ", "))
+}
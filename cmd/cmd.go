@@ -9,36 +9,141 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/elewis787/boa"
 	"github.com/spf13/cobra"
 
 	"github.com/buildsafedev/bsf/cmd/attestation"
+	"github.com/buildsafedev/bsf/cmd/audit"
+	"github.com/buildsafedev/bsf/cmd/bench"
 	"github.com/buildsafedev/bsf/cmd/build"
+	"github.com/buildsafedev/bsf/cmd/bundle"
+	"github.com/buildsafedev/bsf/cmd/changelog"
+	"github.com/buildsafedev/bsf/cmd/cip"
+	"github.com/buildsafedev/bsf/cmd/components"
 	"github.com/buildsafedev/bsf/cmd/configure"
+	"github.com/buildsafedev/bsf/cmd/db"
 	"github.com/buildsafedev/bsf/cmd/develop"
+	diffCmd "github.com/buildsafedev/bsf/cmd/diff"
 	"github.com/buildsafedev/bsf/cmd/direnv"
 	"github.com/buildsafedev/bsf/cmd/dockerfile"
+	"github.com/buildsafedev/bsf/cmd/enrich"
+	"github.com/buildsafedev/bsf/cmd/evidence"
+	"github.com/buildsafedev/bsf/cmd/export"
+	"github.com/buildsafedev/bsf/cmd/generate"
 	initCmd "github.com/buildsafedev/bsf/cmd/init"
+	"github.com/buildsafedev/bsf/cmd/metacache"
 	"github.com/buildsafedev/bsf/cmd/nixgenerate"
 	"github.com/buildsafedev/bsf/cmd/oci"
+	"github.com/buildsafedev/bsf/cmd/pin"
 	"github.com/buildsafedev/bsf/cmd/precheck"
+	"github.com/buildsafedev/bsf/cmd/promote"
+	"github.com/buildsafedev/bsf/cmd/provides"
+	"github.com/buildsafedev/bsf/cmd/prune"
+	"github.com/buildsafedev/bsf/cmd/receipt"
+	"github.com/buildsafedev/bsf/cmd/release"
+	"github.com/buildsafedev/bsf/cmd/report"
+	"github.com/buildsafedev/bsf/cmd/sbom"
 	"github.com/buildsafedev/bsf/cmd/scan"
+	"github.com/buildsafedev/bsf/cmd/scorecard"
 	"github.com/buildsafedev/bsf/cmd/search"
+	"github.com/buildsafedev/bsf/cmd/simulate"
 	"github.com/buildsafedev/bsf/cmd/styles"
+	syncCmd "github.com/buildsafedev/bsf/cmd/sync"
+	"github.com/buildsafedev/bsf/cmd/telemetry"
 	"github.com/buildsafedev/bsf/cmd/update"
+	"github.com/buildsafedev/bsf/pkg/config"
+	"github.com/buildsafedev/bsf/pkg/deadline"
+	"github.com/buildsafedev/bsf/pkg/events"
+	nixcmd "github.com/buildsafedev/bsf/pkg/nix/cmd"
+	"github.com/buildsafedev/bsf/pkg/priority"
+	"github.com/buildsafedev/bsf/pkg/profile"
+	"github.com/buildsafedev/bsf/pkg/purpose"
+	"github.com/buildsafedev/bsf/pkg/toolchain"
+	"github.com/buildsafedev/bsf/pkg/workspace"
 )
 
 var (
 	// DebugDir is the directory where bsf project needs to be debugged
 	DebugDir string
+
+	maxDuration    time.Duration
+	commandTimeout time.Duration
+	chdir          string
+	parallelism    nixcmd.Parallelism
+	nice           int
+	ioClass        string
+	store          string
+	eventStream    string
+	inheritEnv     bool
+	keepEnv        []string
+	verbose        bool
+	profileName    string
 )
 
+// projectCmds work on the bsf project, they run from its root when bsf is invoked from one of its subdirectories
+var projectCmds = []*cobra.Command{
+	build.BuildCmd, oci.OCICmd, develop.DevCmd, update.UpdateCmd, direnv.Direnv, dockerfile.DFCmd, cip.CIPCmd,
+	export.ExportCmd, syncCmd.SyncCmd, nixgenerate.NixGenCmd, precheck.PreCheckCmd, generate.GenerateCmd,
+	prune.PruneCmd, simulate.SimulateCmd, pin.PinCmd, release.ReleaseCmd,
+}
+
+func init() {
+	rootCmd.PersistentFlags().DurationVarP(&maxDuration, "max-duration", "", 0, "wall-clock budget of the whole run, e.g. 30m. Commands stop at the next phase boundary and keep the outputs of the completed phases")
+	rootCmd.PersistentFlags().StringVarP(&chdir, "chdir", "C", "", "run as if bsf was started in this directory, the project root is looked up from it")
+	rootCmd.PersistentFlags().DurationVarP(&commandTimeout, "command-timeout", "", 0, "timeout of each nix command bsf runs, e.g. 10m")
+	rootCmd.PersistentFlags().StringVarP(&eventStream, "events", "", "", "stream the phases, hashed paths and progress of the closure, SBOM components, push progress and build result of the run as NDJSON to a file descriptor (fd:3) or unix socket (unix:/run/bsf.sock)")
+	rootCmd.PersistentFlags().StringVarP(&store, "store", "", "", "nix store to build in and read from, e.g. local?root=/tmp/nix-root for the chroot stores of unprivileged CI containers. Closures and hashes of remote stores (ssh-ng://host) and binary caches (https://cache.example.com, s3://bucket) are queried without realising the paths here")
+	rootCmd.PersistentFlags().IntVarP(&parallelism.HashWorkers, "hash-workers", "", 0, "number of closure paths hashed and annotated at once, one per CPU by default")
+	rootCmd.PersistentFlags().IntVarP(&parallelism.MaxJobs, "max-jobs", "", 0, "number of derivations nix builds at once, defaults to the nix configuration")
+	rootCmd.PersistentFlags().IntVarP(&parallelism.Cores, "cores", "", 0, "number of cores each nix build job can use, defaults to the nix configuration")
+	rootCmd.PersistentFlags().IntVarP(&nice, "nice", "", 0, "niceness of bsf and the nix commands it runs, from -20 to 19")
+	rootCmd.PersistentFlags().BoolVarP(&inheritEnv, "inherit-env", "", false, "run nix commands with the whole environment of bsf, rather than without NIX_PATH, NIX_CONFIG and the other variables that change what nix evaluates")
+	rootCmd.PersistentFlags().StringSliceVarP(&keepEnv, "keep-env", "", nil, "variables nix commands keep in addition to the defaults, e.g. NIX_CONFIG")
+	rootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "", false, "report how the run queries the nix store: the nix daemon, nix-store or the store directory when neither is available")
+	rootCmd.PersistentFlags().StringVarP(&profileName, "profile", "", "", "profile of flag defaults to run with: dev, ci, release, airgapped or a profile of ~/.bsf.json, defaults to profile in ~/.bsf.json. Flags given override the profile")
+	rootCmd.PersistentFlags().StringVarP(&ioClass, "io-class", "", "", "IO scheduling class of bsf and the nix commands it runs: idle, best-effort or realtime, e.g. best-effort:7 (Linux only)")
+}
+
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
 	Use:   "bsf",
 	Short: "bsf CLI lets you manage OS dependencies of your application seamlessly",
 	Long:  `Opinionated app dependency management tool.`,
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		if err := applyProfile(cmd); err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+			os.Exit(1)
+		}
+		if chdir != "" || isProjectCmd(cmd) {
+			if _, err := workspace.Enter(chdir); err != nil {
+				fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+				os.Exit(1)
+			}
+			if err := workspace.ResolveFlags(cmd.Flags()); err != nil {
+				fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+				os.Exit(1)
+			}
+		}
+		if eventStream != "" {
+			if err := events.Open(eventStream); err != nil {
+				fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+				os.Exit(1)
+			}
+		}
+		deadline.Set(maxDuration, commandTimeout)
+		if err := applyResourceLimits(cmd); err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+			os.Exit(1)
+		}
+		telemetry.Start(cmd)
+	},
+	PersistentPostRun: func(cmd *cobra.Command, args []string) {
+		telemetry.Finish()
+		events.Close()
+	},
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
@@ -64,6 +169,7 @@ func Execute() {
 	rootCmd.AddCommand(scan.ScanCmd)
 	rootCmd.AddCommand(update.UpdateCmd)
 	rootCmd.AddCommand(attestation.AttCmd)
+	rootCmd.AddCommand(sbom.SBOMCmd)
 	rootCmd.AddCommand(direnv.Direnv)
 
 	if os.Getenv("BSF_DEBUG_MODE") == "true" {
@@ -73,6 +179,30 @@ func Execute() {
 	}
 	rootCmd.AddCommand(oci.OCICmd)
 	rootCmd.AddCommand(dockerfile.DFCmd)
+	rootCmd.AddCommand(generate.GenerateCmd)
+	rootCmd.AddCommand(cip.CIPCmd)
+	rootCmd.AddCommand(changelog.ChangelogCmd)
+	rootCmd.AddCommand(diffCmd.DiffCmd)
+	rootCmd.AddCommand(provides.ProvidesCmd)
+	rootCmd.AddCommand(scorecard.ScorecardCmd)
+	rootCmd.AddCommand(enrich.EnrichCmd)
+	rootCmd.AddCommand(export.ExportCmd)
+	rootCmd.AddCommand(metacache.MetaCacheCmd)
+	rootCmd.AddCommand(bench.BenchCmd)
+	rootCmd.AddCommand(db.DBCmd)
+	rootCmd.AddCommand(syncCmd.SyncCmd)
+	rootCmd.AddCommand(receipt.ReceiptCmd)
+	rootCmd.AddCommand(report.ReportCmd)
+	rootCmd.AddCommand(promote.PromoteCmd)
+	rootCmd.AddCommand(prune.PruneCmd)
+	rootCmd.AddCommand(simulate.SimulateCmd)
+	rootCmd.AddCommand(components.ComponentsCmd)
+	rootCmd.AddCommand(evidence.EvidenceCmd)
+	rootCmd.AddCommand(bundle.BundleCmd)
+	rootCmd.AddCommand(audit.AuditCmd)
+	rootCmd.AddCommand(telemetry.TelemetryCmd)
+	rootCmd.AddCommand(pin.PinCmd)
+	rootCmd.AddCommand(release.ReleaseCmd)
 
 	err := rootCmd.ExecuteContext(context.Background())
 	if err != nil {
@@ -81,6 +211,100 @@ func Execute() {
 
 }
 
+// applyProfile sets the flags of the command that weren't given to the defaults of the profile of --profile, or of
+// ~/.bsf.json. The flags of the profile apply before the ones of ~/.bsf.json, as if they were given.
+func applyProfile(cmd *cobra.Command) error {
+	conf, err := configure.LoadConf()
+	if err != nil {
+		conf = &config.Config{}
+	}
+	name := profileName
+	if name == "" {
+		name = conf.Profile
+	}
+	if name == "" {
+		return nil
+	}
+
+	p, err := profile.Resolve(name, conf.Profiles)
+	if err != nil {
+		return err
+	}
+	command := strings.TrimPrefix(cmd.CommandPath(), cmd.Root().Name()+" ")
+	applied, err := p.Apply(cmd.Flags(), command)
+	if err != nil {
+		return fmt.Errorf("profile %s: %v", name, err)
+	}
+	if len(applied) > 0 {
+		fmt.Fprintln(os.Stderr, styles.TextStyle.Render(fmt.Sprintf("Profile %s: --%s", name, strings.Join(applied, " --"))))
+	}
+	return nil
+}
+
+// applyResourceLimits applies the store, parallelism and priority of ~/.bsf.json, the flags override them, and its
+// toolchain and purpose detectors
+func applyResourceLimits(cmd *cobra.Command) error {
+	conf, err := configure.LoadConf()
+	if err != nil {
+		// the other commands report a broken configuration, limits given as flags still apply
+		conf = &config.Config{}
+	}
+	flags := cmd.Flags()
+	if !flags.Changed("store") {
+		store = conf.Store
+	}
+	if !flags.Changed("hash-workers") {
+		parallelism.HashWorkers = conf.HashWorkers
+	}
+	if !flags.Changed("max-jobs") {
+		parallelism.MaxJobs = conf.MaxJobs
+	}
+	if !flags.Changed("cores") {
+		parallelism.Cores = conf.Cores
+	}
+	if !flags.Changed("nice") {
+		nice = conf.Nice
+	}
+	if !flags.Changed("io-class") {
+		ioClass = conf.IOClass
+	}
+	if !flags.Changed("keep-env") {
+		keepEnv = conf.KeepEnv
+	}
+	if parallelism.HashWorkers < 0 || parallelism.MaxJobs < 0 || parallelism.Cores < 0 {
+		return fmt.Errorf("--hash-workers, --max-jobs and --cores can't be negative")
+	}
+	nixcmd.SetParallelism(parallelism)
+	nixcmd.SetVerbose(verbose)
+	nixcmd.SetEnvironment(nixcmd.Environment{Inherit: inheritEnv, Keep: keepEnv})
+	if err := toolchain.Set(conf.Toolchain); err != nil {
+		return err
+	}
+	if err := purpose.SetRules(conf.PurposeDetectors); err != nil {
+		return err
+	}
+	if err := nixcmd.SetStore(store); err != nil {
+		return err
+	}
+
+	class, level, err := priority.ParseIOClass(ioClass)
+	if err != nil {
+		return err
+	}
+	return priority.Apply(priority.Options{Nice: nice, IOClass: class, IOLevel: level})
+}
+
+func isProjectCmd(cmd *cobra.Command) bool {
+	for c := cmd; c != nil; c = c.Parent() {
+		for _, p := range projectCmds {
+			if c == p {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 func getDebugPath() string {
 	if os.Getenv("BSF_DEBUG_DIR") != "" {
 		DebugDir = os.Getenv("BSF_DEBUG_DIR")
@@ -0,0 +1,45 @@
+// Package completion completes the arguments of bsf commands dynamically, from what bsf analyzed or evaluated before
+package completion
+
+import (
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	nixcmd "github.com/buildsafedev/bsf/pkg/nix/cmd"
+)
+
+// StorePaths completes store paths of the closures bsf analyzed before. Other arguments, such as result
+// symlinks or files, are completed by the shell.
+func StorePaths(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	storePrefix := strings.HasPrefix(toComplete, nixcmd.StoreDir) || strings.HasPrefix(nixcmd.StoreDir+"/", toComplete)
+	if toComplete == "" || !storePrefix {
+		return nil, cobra.ShellCompDirectiveDefault
+	}
+	path, err := nixcmd.NarHashCachePath()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveDefault
+	}
+	return Filter(nixcmd.OpenNarHashCache(path).Paths(), toComplete), cobra.ShellCompDirectiveNoFileComp
+}
+
+// MaxArgs limits a completion function to the first n arguments, the following ones are not completed
+func MaxArgs(n int, f func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective)) func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
+	return func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		if len(args) >= n {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		return f(cmd, args, toComplete)
+	}
+}
+
+// Filter returns the candidates starting with prefix
+func Filter(candidates []string, prefix string) []string {
+	matches := make([]string, 0, len(candidates))
+	for _, c := range candidates {
+		if strings.HasPrefix(c, prefix) {
+			matches = append(matches, c)
+		}
+	}
+	return matches
+}
@@ -0,0 +1,37 @@
+package completion
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+func TestFilter(t *testing.T) {
+	candidates := []string{"/nix/store/aaaa-hello-2.12", "/nix/store/abcd-zlib-1.3", "/nix/store/bbbb-curl-8.5.0"}
+	tests := []struct {
+		prefix string
+		want   []string
+	}{
+		{"/nix/store/a", []string{"/nix/store/aaaa-hello-2.12", "/nix/store/abcd-zlib-1.3"}},
+		{"/nix/store/", candidates},
+		{"/nix/store/c", []string{}},
+	}
+	for _, tt := range tests {
+		if got := Filter(candidates, tt.prefix); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Filter(%q) = %v, want %v", tt.prefix, got, tt.want)
+		}
+	}
+}
+
+func TestStorePathsLeavesOtherArgumentsToTheShell(t *testing.T) {
+	for _, toComplete := range []string{"", "bsf-result/", "./res"} {
+		if _, directive := StorePaths(nil, nil, toComplete); directive != cobra.ShellCompDirectiveDefault {
+			t.Errorf("StorePaths(%q) directive = %v, want files completed by the shell", toComplete, directive)
+		}
+	}
+	complete := MaxArgs(1, StorePaths)
+	if _, directive := complete(nil, []string{"/nix/store/aaaa-hello"}, "/nix"); directive != cobra.ShellCompDirectiveNoFileComp {
+		t.Errorf("second argument directive = %v, want no completion", directive)
+	}
+}
@@ -0,0 +1,188 @@
+package components
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/buildsafedev/bsf/cmd/configure"
+	"github.com/buildsafedev/bsf/cmd/styles"
+	"github.com/buildsafedev/bsf/pkg/componentstore"
+	bsbom "github.com/buildsafedev/bsf/pkg/sbom"
+	"github.com/buildsafedev/bsf/pkg/workspace"
+)
+
+var (
+	storeDir, format string
+	jsonOutput       bool
+)
+
+func init() {
+	ComponentsCmd.PersistentFlags().StringVarP(&storeDir, "store", "", "", "directory of the component store, component_store of ~/.bsf.json by default")
+	workspace.MarkPaths(ComponentsCmd.PersistentFlags(), "store")
+	usedByCmd.Flags().BoolVarP(&jsonOutput, "json", "", false, "print the projects as JSON")
+	buildsCmd.Flags().BoolVarP(&jsonOutput, "json", "", false, "print the builds as JSON")
+	getCmd.Flags().StringVarP(&format, "format", "f", "spdx-json", "format of the SBOM: spdx-json, cyclonedx-json or protobom")
+
+	ComponentsCmd.AddCommand(usedByCmd)
+	ComponentsCmd.AddCommand(buildsCmd)
+	ComponentsCmd.AddCommand(getCmd)
+}
+
+// ComponentsCmd represents the components command
+var ComponentsCmd = &cobra.Command{
+	Use:   "components",
+	Short: "queries the component store the projects of the organization share",
+	Long: `queries the component store set by component_store in ~/.bsf.json, the directory bsf build stores its SBOMs in
+	when builds of several projects share a server. Each component is stored once, the SBOM of a build references the
+	components of its closure, so the projects using a component are listed without reading their SBOMs.
+
+	bsf components usedby openssl
+	bsf components usedby /nix/store/...-openssl-3.0.13
+	bsf components builds my-api
+	bsf components get my-api <build> --format cyclonedx-json > sbom.cdx.json
+	`,
+	Run: func(cmd *cobra.Command, args []string) {
+		fmt.Println(styles.HintStyle.Render("hint: use bsf components with a subcommand"))
+		os.Exit(1)
+	},
+}
+
+var usedByCmd = &cobra.Command{
+	Use:   "usedby <name|store path>",
+	Short: "lists the projects using the components of a name or a store path",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		usages, err := openStore().UsedBy(args[0])
+		if err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+			os.Exit(1)
+		}
+		if jsonOutput {
+			printJSON(usages)
+			return
+		}
+		if len(usages) == 0 {
+			fmt.Println(styles.TextStyle.Render(fmt.Sprintf("No project uses %s", args[0])))
+			return
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "PROJECT\tCOMPONENT\tVERSION\tSTORE PATH")
+		for _, u := range usages {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", u.Project, u.Name, u.Version, u.StorePath)
+		}
+		tw.Flush()
+	},
+}
+
+var buildsCmd = &cobra.Command{
+	Use:   "builds <project>",
+	Short: "lists the builds of a project with a SBOM in the store, the most recent first",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		refs, err := openStore().Builds(args[0])
+		if err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+			os.Exit(1)
+		}
+		if jsonOutput {
+			type build struct {
+				Build      string    `json:"build"`
+				Time       time.Time `json:"time"`
+				Components int       `json:"components"`
+			}
+			builds := make([]build, 0, len(refs))
+			for _, r := range refs {
+				builds = append(builds, build{Build: r.Build, Time: r.Time, Components: len(r.Components)})
+			}
+			printJSON(builds)
+			return
+		}
+		if len(refs) == 0 {
+			fmt.Println(styles.TextStyle.Render(fmt.Sprintf("No build of %s in the component store", args[0])))
+			return
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "BUILD\tTIME\tCOMPONENTS")
+		for _, r := range refs {
+			fmt.Fprintf(tw, "%s\t%s\t%d\n", r.Build, r.Time.Format(time.RFC3339), len(r.Components))
+		}
+		tw.Flush()
+	},
+}
+
+var getCmd = &cobra.Command{
+	Use:   "get <project> [build]",
+	Short: "prints the SBOM of a build of a project, the most recent one by default",
+	Args:  cobra.RangeArgs(1, 2),
+	Run: func(cmd *cobra.Command, args []string) {
+		f, err := bsbom.ParseFormat(format)
+		if err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+			os.Exit(1)
+		}
+		s := openStore()
+		build := ""
+		if len(args) == 2 {
+			build = args[1]
+		} else {
+			refs, err := s.Builds(args[0])
+			if err != nil {
+				fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+				os.Exit(1)
+			}
+			if len(refs) == 0 {
+				fmt.Println(styles.ErrorStyle.Render(fmt.Sprintf("error: no build of %s in the component store", args[0])))
+				os.Exit(1)
+			}
+			build = refs[0].Build
+		}
+
+		doc, err := s.Get(args[0], build)
+		if err == nil {
+			var data []byte
+			data, err = bsbom.Write(doc, f)
+			if err == nil {
+				_, err = os.Stdout.Write(data)
+			}
+		}
+		if err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+			os.Exit(1)
+		}
+	},
+}
+
+// openStore opens the store of --store, or the one of the configuration
+func openStore() *componentstore.Store {
+	dir := storeDir
+	if dir == "" {
+		if conf, err := configure.PreCheckConf(); err == nil {
+			dir = conf.ComponentStore
+		}
+	}
+	if dir == "" {
+		fmt.Println(styles.ErrorStyle.Render("error: no component store"))
+		fmt.Println(styles.HintStyle.Render("hint: pass --store or set component_store in ~/.bsf.json"))
+		os.Exit(1)
+	}
+	s, err := componentstore.Open(dir)
+	if err != nil {
+		fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+		os.Exit(1)
+	}
+	return s
+}
+
+func printJSON(v interface{}) {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+		os.Exit(1)
+	}
+}
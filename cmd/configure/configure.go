@@ -79,3 +79,41 @@ func PreCheckConf() (*config.Config, error) {
 	}
 	return conf, nil
 }
+
+// LoadConf reads ~/.bsf.json without creating it, a missing file is an empty configuration
+func LoadConf() (*config.Config, error) {
+	path, err := confPath()
+	if err != nil {
+		return nil, err
+	}
+	conf := &config.Config{}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return conf, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return conf, json.Unmarshal(data, conf)
+}
+
+// SaveConf writes the configuration to ~/.bsf.json
+func SaveConf(conf *config.Config) error {
+	path, err := confPath()
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(conf, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+func confPath() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(homeDir, ".bsf.json"), nil
+}
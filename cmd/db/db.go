@@ -0,0 +1,135 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/buildsafedev/bsf/cmd/styles"
+	"github.com/buildsafedev/bsf/pkg/enrichdb"
+)
+
+var (
+	pin bool
+)
+
+func init() {
+	fetchCmd.Flags().BoolVarP(&pin, "pin", "", false, "pin the fetched snapshot so later runs use exactly this content")
+
+	DBCmd.AddCommand(fetchCmd)
+	DBCmd.AddCommand(pinCmd)
+	DBCmd.AddCommand(unpinCmd)
+	DBCmd.AddCommand(listCmd)
+}
+
+// DBCmd represents the db command
+var DBCmd = &cobra.Command{
+	Use:   "db",
+	Short: "manages the enrichment databases used to annotate SBOMs",
+	Long: `fetches enrichment databases and records their digest and timestamps in ` + enrichdb.LockFile + `.
+	Pinned databases are reused from the local cache so results are reproducible, and reports name the exact snapshot used.
+
+	bsf db fetch osv/Go eol/go --pin
+	bsf db list
+	bsf db unpin osv/Go
+	`,
+	Run: func(cmd *cobra.Command, args []string) {
+		fmt.Println(styles.HintStyle.Render("hint: use bsf db with a subcommand"))
+		os.Exit(1)
+	},
+}
+
+var fetchCmd = &cobra.Command{
+	Use:   "fetch",
+	Short: "downloads databases, osv/<ecosystem> or eol/<product>",
+	Args:  cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		lock := readLock()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+		defer cancel()
+
+		for _, name := range args {
+			url, err := enrichdb.SourceURL(name)
+			if err != nil {
+				fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+				os.Exit(1)
+			}
+
+			_, snapshot, err := enrichdb.Fetch(ctx, name, url, lock)
+			if err != nil {
+				fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+				os.Exit(1)
+			}
+			if pin {
+				lock.Pin(name)
+			}
+			fmt.Println(styles.SucessStyle.Render(fmt.Sprintf("%s: %s", name, snapshot.Digest)))
+		}
+
+		writeLock(lock)
+	},
+}
+
+var pinCmd = &cobra.Command{
+	Use:   "pin",
+	Short: "pins the recorded snapshot of databases",
+	Args:  cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		lock := readLock()
+		for _, name := range args {
+			if err := lock.Pin(name); err != nil {
+				fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+				os.Exit(1)
+			}
+		}
+		writeLock(lock)
+	},
+}
+
+var unpinCmd = &cobra.Command{
+	Use:   "unpin",
+	Short: "lets databases be updated on the next fetch",
+	Args:  cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		lock := readLock()
+		for _, name := range args {
+			lock.Unpin(name)
+		}
+		writeLock(lock)
+	},
+}
+
+var listCmd = &cobra.Command{
+	Use:   "list",
+	Short: "lists the recorded database snapshots",
+	Run: func(cmd *cobra.Command, args []string) {
+		lock := readLock()
+		for _, s := range lock.Snapshots() {
+			pinned := ""
+			if s.Pinned {
+				pinned = " (pinned)"
+			}
+			fmt.Println(styles.TextStyle.Render(fmt.Sprintf("%-24s %s fetched %s%s", s.Name, s.Digest, s.FetchedAt.Format(time.RFC3339), pinned)))
+		}
+	},
+}
+
+func readLock() *enrichdb.Lock {
+	lock, err := enrichdb.ReadLock(enrichdb.LockFile)
+	if err != nil {
+		fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+		os.Exit(1)
+	}
+	return lock
+}
+
+func writeLock(lock *enrichdb.Lock) {
+	if err := lock.Write(enrichdb.LockFile); err != nil {
+		fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+		os.Exit(1)
+	}
+}
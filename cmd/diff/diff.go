@@ -0,0 +1,191 @@
+package diff
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/spf13/cobra"
+
+	"github.com/buildsafedev/bsf/cmd/completion"
+	"github.com/buildsafedev/bsf/cmd/styles"
+	"github.com/buildsafedev/bsf/pkg/diff"
+	"github.com/buildsafedev/bsf/pkg/layout"
+	nixcmd "github.com/buildsafedev/bsf/pkg/nix/cmd"
+	bsbom "github.com/buildsafedev/bsf/pkg/sbom"
+	"github.com/buildsafedev/bsf/pkg/workspace"
+)
+
+// Formats of the diff
+const (
+	FormatTable    = "table"
+	FormatJSON     = "json"
+	FormatMarkdown = "markdown"
+)
+
+var (
+	format, output string
+	exitCode       bool
+)
+
+func init() {
+	DiffCmd.Flags().StringVarP(&format, "format", "f", FormatTable, "format of the diff: table, json or markdown")
+	DiffCmd.Flags().StringVarP(&output, "output", "o", "", "file the diff is written to, stdout by default")
+	DiffCmd.Flags().BoolVarP(&exitCode, "exit-code", "", false, "exit with status 1 when the closures differ, like git diff --exit-code")
+	workspace.MarkPaths(DiffCmd.Flags(), "output")
+}
+
+// DiffCmd represents the diff command
+var DiffCmd = &cobra.Command{
+	Use:   "diff <old> <new>",
+	Short: "compares the dependencies of two builds",
+	Long: `compares the runtime closures of two builds and reports the packages added, removed, upgraded, downgraded
+	and rebuilt with another NAR hash. Each build is given as one of:
+
+	- a result symlink or a store path, whose closure is queried from the nix store
+	- an output directory of bsf build or bsf oci, e.g. bsf-result
+	- an attestations file or a SPDX or CycloneDX SBOM
+
+	bsf diff main-result bsf-result
+	bsf diff v1/attestations.intoto.jsonl ./result --format markdown -o closure-diff.md
+	`,
+	Args:              cobra.ExactArgs(2),
+	ValidArgsFunction: completion.MaxArgs(2, completion.StorePaths),
+	Run: func(cmd *cobra.Command, args []string) {
+		if format != FormatTable && format != FormatJSON && format != FormatMarkdown {
+			fmt.Println(styles.ErrorStyle.Render("error:", fmt.Sprintf("unknown format %q, use table, json or markdown", format)))
+			os.Exit(1)
+		}
+
+		oldPkgs, err := ReadPackages(workspace.Resolve(args[0]))
+		if err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+			os.Exit(1)
+		}
+		newPkgs, err := ReadPackages(workspace.Resolve(args[1]))
+		if err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+			os.Exit(1)
+		}
+		d := diff.Compare(oldPkgs, newPkgs)
+
+		w := io.Writer(os.Stdout)
+		if output != "" {
+			f, err := os.Create(output)
+			if err != nil {
+				fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+				os.Exit(1)
+			}
+			defer f.Close()
+			w = f
+		}
+
+		if err := Write(w, d, format, args[0], args[1], output == ""); err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+			os.Exit(1)
+		}
+
+		if exitCode && !d.IsEmpty() {
+			os.Exit(1)
+		}
+	},
+}
+
+// ReadPackages returns the packages of a build: the closure of a result symlink or store path, or the SBOM of an
+// output directory, an attestations file or a SBOM file
+func ReadPackages(path string) ([]diff.Package, error) {
+	if _, err := nixcmd.ResolveStorePath(path); err == nil {
+		graph, err := nixcmd.StoreClosureGraph(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to query the closure of %s: %v", path, err)
+		}
+		return diff.PackagesFromGraph(graph), nil
+	}
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	var data []byte
+	if fi.IsDir() {
+		if _, err := os.Stat(filepath.Join(path, layout.IndexFile)); err != nil {
+			return nil, fmt.Errorf("%s is not an output directory of bsf, it has no %s", path, layout.IndexFile)
+		}
+		data, err = layout.ReadAttestations(path)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	doc, err := bsbom.FromAttestations(data)
+	if err != nil {
+		// not attestations, a standalone SBOM
+		doc, err = bsbom.Parse(data)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the SBOM of %s: %v", path, err)
+	}
+	return diff.PackagesFromSBOM(doc), nil
+}
+
+// Write writes the diff from one build to another in the format, the table is colored when color is set
+func Write(w io.Writer, d *diff.Diff, format, from, to string, color bool) error {
+	switch format {
+	case FormatJSON:
+		return json.NewEncoder(w).Encode(d)
+	case FormatMarkdown:
+		return d.WriteMarkdown(w, from, to)
+	}
+	return writeTable(w, d, color)
+}
+
+// rowStyles color the rows of the table by kind of change
+var rowStyles = map[string]lipgloss.Style{
+	diff.KindAdded:      styles.SucessStyle,
+	diff.KindRemoved:    styles.ErrorStyle,
+	diff.KindUpgraded:   styles.HintStyle,
+	diff.KindDowngraded: styles.WarnStyle,
+	diff.KindRebuilt:    styles.TextStyle,
+}
+
+// writeTable writes the diff as an aligned table, colored by kind of change when color is set
+func writeTable(w io.Writer, d *diff.Diff, color bool) error {
+	if d.IsEmpty() {
+		_, err := fmt.Fprintln(w, "No dependency changes")
+		return err
+	}
+
+	var buf bytes.Buffer
+	tw := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "CHANGE\tPACKAGE\tOLD\tNEW\tNAR HASH")
+	rows := d.Rows()
+	for _, r := range rows {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", r.Kind, r.Name, r.OldVersion, r.NewVersion, r.HashChange())
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	// lines are colored once aligned, escape codes would count in the width of the columns
+	sc := bufio.NewScanner(&buf)
+	for i := -1; sc.Scan(); i++ {
+		line := strings.TrimRight(sc.Text(), " ")
+		if color && i >= 0 {
+			line = rowStyles[rows[i].Kind].Render(line)
+		}
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintln(w, "\n"+d.Summary())
+	return err
+}
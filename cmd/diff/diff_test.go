@@ -0,0 +1,35 @@
+package diff
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/buildsafedev/bsf/pkg/diff"
+)
+
+func TestWriteTable(t *testing.T) {
+	d := &diff.Diff{
+		Added:    []diff.Package{{Name: "cacert", Version: "3.95"}},
+		Upgraded: []diff.Change{{Name: "openssl", OldVersion: "3.0.12", NewVersion: "3.0.13"}},
+	}
+	var buf bytes.Buffer
+	if err := writeTable(&buf, d, false); err != nil {
+		t.Fatal(err)
+	}
+	want := "CHANGE    PACKAGE  OLD     NEW     NAR HASH\n" +
+		"upgraded  openssl  3.0.12  3.0.13\n" +
+		"added     cacert           3.95\n" +
+		"\n1 upgraded, 1 added\n"
+	if buf.String() != want {
+		t.Errorf("writeTable() =\n%s\nwant\n%s", buf.String(), want)
+	}
+
+	buf.Reset()
+	if err := writeTable(&buf, &diff.Diff{}, false); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(buf.String(), "No dependency changes") {
+		t.Errorf("writeTable() of an empty diff = %q", buf.String())
+	}
+}
@@ -13,6 +13,7 @@ import (
 	"github.com/buildsafedev/bsf/pkg/builddocker"
 	"github.com/buildsafedev/bsf/pkg/generate"
 	bgit "github.com/buildsafedev/bsf/pkg/git"
+	"github.com/buildsafedev/bsf/pkg/workspace"
 )
 
 var (
@@ -22,6 +23,7 @@ var (
 func init() {
 	DFCmd.Flags().StringVarP(&output, "output", "o", "", "location of the dockerfile generated")
 	DFCmd.Flags().StringVarP(&platform, "platform", "p", "", "The platform to build the image for")
+	workspace.MarkPaths(DFCmd.Flags(), "output")
 
 }
 
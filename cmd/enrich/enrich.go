@@ -0,0 +1,212 @@
+package enrich
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/awalterschulze/gographviz"
+	"github.com/bom-squad/protobom/pkg/sbom"
+	"github.com/spf13/cobra"
+
+	"github.com/buildsafedev/bsf/cmd/build"
+	"github.com/buildsafedev/bsf/cmd/styles"
+	"github.com/buildsafedev/bsf/pkg/layout"
+	nixcmd "github.com/buildsafedev/bsf/pkg/nix/cmd"
+	bsbom "github.com/buildsafedev/bsf/pkg/sbom"
+)
+
+var timeout time.Duration
+
+func init() {
+	EnrichCmd.Flags().DurationVarP(&timeout, "timeout", "", 0, "give up on the metadata not resolved after this long, e.g. 10m, the components stay pending")
+}
+
+// EnrichCmd represents the enrich command
+var EnrichCmd = &cobra.Command{
+	Use:   "enrich",
+	Short: "enrich completes the components of SBOMs pending enrichment",
+	Long: `enrich resolves the package registry and nixpkgs metadata of the components bsf build --enrich-timeout
+	flagged as pending enrichment, because their lookups didn't complete in time, and rewrites the SBOMs of the output
+	directory, or the SBOM file, with it. It runs in the directory of the project, whose bsf/flake.lock locks the
+	nixpkgs revision of the closure. The attestations are signed, they keep the SBOMs they were signed with.
+
+	bsf enrich bsf-result
+	bsf enrich sbom.cdx.json --timeout 10m
+	`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		info, err := os.Stat(args[0])
+		if err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+			os.Exit(1)
+		}
+
+		var left int
+		if info.IsDir() {
+			left, err = enrichLayout(args[0])
+		} else {
+			left, err = enrichFile(args[0])
+		}
+		if err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+			os.Exit(1)
+		}
+		if left > 0 {
+			fmt.Println(styles.WarnStyle.Render(fmt.Sprintf("warning: %d components are still pending enrichment", left)))
+			return
+		}
+		fmt.Println(styles.SucessStyle.Render("Enriched the components pending enrichment"))
+	},
+}
+
+// document is a SBOM being enriched
+type document struct {
+	name, mediaType string
+	data            []byte
+	bom             *sbom.Document
+}
+
+// enrichLayout enriches the SBOMs of the output directory, they are stored under their new digest
+func enrichLayout(dir string) (int, error) {
+	l, err := layout.Open(dir)
+	if err != nil {
+		return 0, err
+	}
+	docs := make([]*document, 0)
+	for _, e := range l.Index.Entries {
+		if e.Kind != layout.KindSBOM {
+			continue
+		}
+		data, err := l.Read(e.Kind, e.Name)
+		if err != nil {
+			return 0, err
+		}
+		bom, err := bsbom.Parse(data)
+		if err != nil {
+			return 0, fmt.Errorf("failed to parse %s: %v", e.Name, err)
+		}
+		docs = append(docs, &document{name: e.Name, mediaType: e.MediaType, data: data, bom: bom})
+	}
+
+	left, enriched, err := enrich(docs)
+	if err != nil || len(enriched) == 0 {
+		return left, err
+	}
+	for _, doc := range enriched {
+		data, err := bsbom.Write(doc.bom, bsbom.DetectFormat(doc.data))
+		if err != nil {
+			return 0, err
+		}
+		if _, err := l.Add(layout.KindSBOM, doc.name, doc.mediaType, data); err != nil {
+			return 0, err
+		}
+	}
+	if err := l.Write(); err != nil {
+		return 0, err
+	}
+	_, err = l.Prune()
+	return left, err
+}
+
+// enrichFile enriches the SBOM file in place
+func enrichFile(name string) (int, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return 0, err
+	}
+	if !bsbom.IsDocument(data) {
+		return 0, fmt.Errorf("%s is not a SBOM, attestations are signed and can't be enriched", name)
+	}
+	bom, err := bsbom.Parse(data)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse %s: %v", name, err)
+	}
+
+	left, enriched, err := enrich([]*document{{name: name, data: data, bom: bom}})
+	if err != nil || len(enriched) == 0 {
+		return left, err
+	}
+	data, err = bsbom.Write(bom, bsbom.DetectFormat(data))
+	if err != nil {
+		return 0, err
+	}
+	return left, os.WriteFile(name, data, 0644)
+}
+
+// enrich resolves the metadata of the components pending enrichment of the documents, once for the components the
+// documents share. It returns how many components are still pending and the documents that were enriched.
+func enrich(docs []*document) (int, []*document, error) {
+	graph, pending := pendingGraph(docs)
+	if len(pending) == 0 {
+		fmt.Println(styles.TextStyle.Render("No components are pending enrichment"))
+		return 0, nil, nil
+	}
+	fmt.Println(styles.HighlightStyle.Render(fmt.Sprintf("Enriching %d components...", len(pending))))
+
+	// components whose lookups failed rather than timed out stay pending, a later run may complete them
+	failed := build.EnrichClosure(graph, timeout) != nil
+	left := 0
+	for name, nodes := range pending {
+		attrs := make(map[string]string)
+		for k, v := range graph.Nodes.Lookup[name].Attrs {
+			attrs[string(k)] = v
+		}
+		sources := strings.Fields(attrs[bsbom.AttrPendingEnrichment])
+		for _, node := range nodes {
+			bsbom.Enrich(node, attrs)
+			if failed {
+				sources = bsbom.PendingEnrichment(node)
+			}
+			bsbom.SetPendingEnrichment(node, sources)
+		}
+		if len(sources) > 0 {
+			left++
+		}
+	}
+
+	enriched := make([]*document, 0, len(docs))
+	for _, doc := range docs {
+		for _, node := range doc.bom.NodeList.Nodes {
+			if _, ok := pending[nodeName(node)]; ok {
+				enriched = append(enriched, doc)
+				break
+			}
+		}
+	}
+	return left, enriched, nil
+}
+
+// pendingGraph returns the closure graph of the components of the documents pending enrichment, named and versioned
+// as in the SBOMs, and the components of each node
+func pendingGraph(docs []*document) (*gographviz.Graph, map[string][]*sbom.Node) {
+	graph := gographviz.NewGraph()
+	graph.SetName("G")
+	graph.SetDir(true)
+
+	pending := make(map[string][]*sbom.Node)
+	for _, doc := range docs {
+		for _, node := range doc.bom.NodeList.Nodes {
+			name := nodeName(node)
+			if name == "" || len(bsbom.PendingEnrichment(node)) == 0 {
+				continue
+			}
+			if _, ok := pending[name]; !ok {
+				nixcmd.AddGraphNode(graph, name, map[string]string{"name": node.Name, "version": node.Version})
+			}
+			pending[name] = append(pending[name], node)
+		}
+	}
+	return graph, pending
+}
+
+// nodeName returns the name of the closure graph node of the component, empty for components without a store path
+func nodeName(node *sbom.Node) string {
+	storePath := bsbom.StorePath(node)
+	if storePath == "" {
+		return ""
+	}
+	return `"` + path.Base(storePath) + `"`
+}
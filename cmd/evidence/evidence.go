@@ -0,0 +1,170 @@
+package evidence
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/buildsafedev/bsf/cmd/styles"
+	"github.com/buildsafedev/bsf/pkg/builddb"
+	"github.com/buildsafedev/bsf/pkg/evidence"
+	"github.com/buildsafedev/bsf/pkg/signing"
+	"github.com/buildsafedev/bsf/pkg/workspace"
+)
+
+var (
+	from, to, project, keyPath, output string
+)
+
+func init() {
+	exportCmd.Flags().StringVarP(&from, "from", "", "", "start of the period, a date (2024-01-01) or a time (2024-01-01T00:00:00Z)")
+	exportCmd.Flags().StringVarP(&to, "to", "", "", "end of the period, excluded, now by default")
+	exportCmd.Flags().StringVarP(&project, "project", "", "", "export the builds of this project only")
+	exportCmd.Flags().StringVarP(&keyPath, "key", "", "", "PEM encoded ECDSA private key the manifest of the archive is signed with")
+	exportCmd.Flags().StringVarP(&output, "output", "o", "", "path of the archive, evidence-<from>-<to>.tar.gz by default")
+	exportCmd.MarkFlagRequired("from")
+	exportCmd.MarkFlagRequired("key")
+	workspace.MarkPaths(exportCmd.Flags(), "key", "output")
+
+	verifyCmd.Flags().StringVarP(&keyPath, "key", "", "", "PEM encoded public key the manifest of the archive was signed with")
+	verifyCmd.MarkFlagRequired("key")
+	workspace.MarkPaths(verifyCmd.Flags(), "key")
+
+	EvidenceCmd.AddCommand(exportCmd)
+	EvidenceCmd.AddCommand(verifyCmd)
+}
+
+// EvidenceCmd represents the evidence command
+var EvidenceCmd = &cobra.Command{
+	Use:   "evidence",
+	Short: "exports the evidence of the builds of a period for audits",
+	Long: `exports the builds recorded in the build database over a period as a signed archive to hand to auditors, e.g.
+	for SOC 2 or ISO 27001 audits. The archive holds the records of the builds and promotions, and the SBOMs,
+	attestations, receipts, scan reports and policy decisions of the builds their output directories still hold.
+	Its manifest lists the builds, the files and their digests, and is signed as a DSSE envelope.
+
+	bsf evidence export --from 2024-01-01 --to 2024-04-01 --key evidence.key
+	bsf evidence verify evidence-2024-01-01-2024-04-01.tar.gz --key evidence.pub
+	`,
+	Run: func(cmd *cobra.Command, args []string) {
+		fmt.Println(styles.HintStyle.Render("hint: use bsf evidence export or bsf evidence verify"))
+		os.Exit(1)
+	},
+}
+
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "writes the signed evidence archive of the builds of a period",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		now := time.Now().UTC()
+		start, err := parseTime(from)
+		if err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error: invalid --from:", err.Error()))
+			os.Exit(1)
+		}
+		end := now
+		if to != "" {
+			if end, err = parseTime(to); err != nil {
+				fmt.Println(styles.ErrorStyle.Render("error: invalid --to:", err.Error()))
+				os.Exit(1)
+			}
+		}
+		if !start.Before(end) {
+			fmt.Println(styles.ErrorStyle.Render("error: --from must be before --to"))
+			os.Exit(1)
+		}
+		signer, err := signing.ReadPrivateKey(keyPath)
+		if err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+			os.Exit(1)
+		}
+
+		records, err := builddb.Records()
+		if err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+			os.Exit(1)
+		}
+		promotions, err := builddb.Promotions()
+		if err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+			os.Exit(1)
+		}
+		m := evidence.Collect(records, promotions, evidence.Options{From: start, To: end, Project: project}, now)
+		if len(m.Builds) == 0 {
+			fmt.Println(styles.ErrorStyle.Render("error: no build recorded in the period"))
+			os.Exit(1)
+		}
+
+		if output == "" {
+			output = fmt.Sprintf("evidence-%s-%s.tar.gz", start.Format(time.DateOnly), end.Format(time.DateOnly))
+		}
+		f, err := os.Create(output)
+		if err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+			os.Exit(1)
+		}
+		if err := evidence.Write(f, m, signer); err != nil {
+			f.Close()
+			os.Remove(output)
+			fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+			os.Exit(1)
+		}
+		if err := f.Close(); err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+			os.Exit(1)
+		}
+
+		missing := 0
+		for _, b := range m.Builds {
+			if b.Missing != "" {
+				missing++
+			}
+		}
+		if missing > 0 {
+			fmt.Println(styles.WarnStyle.Render(fmt.Sprintf("warning: the files of %d builds are missing, the manifest records why", missing)))
+		}
+		fmt.Println(styles.SucessStyle.Render(fmt.Sprintf("Exported %d builds, %d promotions and %d files to %s", len(m.Builds), len(m.Promotions), len(m.Files), output)))
+	},
+}
+
+var verifyCmd = &cobra.Command{
+	Use:   "verify <archive>",
+	Short: "verifies the signature of an evidence archive and the digests of its files",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		keyData, err := os.ReadFile(keyPath)
+		if err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+			os.Exit(1)
+		}
+		pub, err := signing.ParsePublicKeyPEM(keyData)
+		if err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+			os.Exit(1)
+		}
+		f, err := os.Open(args[0])
+		if err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+			os.Exit(1)
+		}
+		defer f.Close()
+
+		m, err := evidence.Verify(f, pub)
+		if err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error: verification failed:", err.Error()))
+			os.Exit(1)
+		}
+		fmt.Println(styles.SucessStyle.Render(fmt.Sprintf("Verified %d builds and %d files from %s to %s", len(m.Builds), len(m.Files), m.From.Format(time.DateOnly), m.To.Format(time.DateOnly))))
+	},
+}
+
+// parseTime parses a date or a RFC 3339 time
+func parseTime(s string) (time.Time, error) {
+	if t, err := time.Parse(time.DateOnly, s); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
@@ -0,0 +1,137 @@
+package export
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/spf13/cobra"
+
+	"github.com/buildsafedev/bsf/cmd/styles"
+	"github.com/buildsafedev/bsf/pkg/anomaly"
+	"github.com/buildsafedev/bsf/pkg/distribution"
+	bgit "github.com/buildsafedev/bsf/pkg/git"
+	"github.com/buildsafedev/bsf/pkg/layout"
+	bsbom "github.com/buildsafedev/bsf/pkg/sbom"
+	"github.com/buildsafedev/bsf/pkg/workspace"
+)
+
+var (
+	owner, lifecycle, system, sbomURL, catalogOutput string
+)
+
+func init() {
+	backstageCmd.Flags().StringVarP(&output, "output", "o", "bsf-result", "location of the build artifacts")
+	backstageCmd.Flags().StringVarP(&catalogOutput, "file", "f", "", "file to write the catalog entities to, defaults to stdout")
+	backstageCmd.Flags().StringVarP(&owner, "owner", "", "", "owner of the component in the catalog, e.g. group:team-platform")
+	backstageCmd.Flags().StringVarP(&lifecycle, "lifecycle", "", "production", "lifecycle of the component")
+	backstageCmd.Flags().StringVarP(&system, "system", "", "", "system the component belongs to")
+	backstageCmd.Flags().StringVarP(&description, "desc", "", "", "description of the component")
+	backstageCmd.Flags().StringVarP(&sbomURL, "sbom-url", "", "", "URL of the SBOM, defaults to the asset uploaded by bsf export github-release")
+	backstageCmd.Flags().StringVarP(&tag, "tag", "t", "", "tag of the release, defaults to the tag pointing at HEAD")
+	backstageCmd.Flags().StringVarP(&repo, "repo", "r", "", "GitHub repository (owner/repo), defaults to the origin remote")
+	workspace.MarkPaths(backstageCmd.Flags(), "output", "file")
+	backstageCmd.MarkFlagRequired("owner")
+}
+
+var backstageCmd = &cobra.Command{
+	Use:   "backstage",
+	Short: "generates Backstage catalog entities for the build",
+	Long: `generates a catalog-info.yaml describing the build as a Backstage component, with its direct dependencies as resources it depends on and a link to its SBOM.
+
+	bsf export backstage --owner group:team-platform
+	bsf export backstage --owner group:team-platform --system payments -f catalog-info.yaml
+	`,
+	Run: func(cmd *cobra.Command, args []string) {
+		attData, err := layout.ReadAttestations(output)
+		if err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error:", "failed to read attestations, run bsf build first:", err.Error()))
+			os.Exit(1)
+		}
+		doc, err := bsbom.FromAttestations(attData)
+		if err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+			os.Exit(1)
+		}
+		roots := doc.NodeList.GetRootNodes()
+		if len(roots) == 0 {
+			fmt.Println(styles.ErrorStyle.Render("error:", "SBOM does not describe a component"))
+			os.Exit(1)
+		}
+
+		digests, err := subjectDigests(output)
+		if err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+			os.Exit(1)
+		}
+
+		if repo == "" {
+			// the repository is optional, it only adds the project slug and the default SBOM link
+			repo, _ = originRepo()
+		}
+		if sbomURL == "" && repo != "" {
+			if tag == "" {
+				tag, _ = bgit.CurrentTag()
+			}
+			if tag != "" {
+				sbomURL = fmt.Sprintf("https://github.com/%s/releases/download/%s/%s.spdx.json", repo, tag, roots[0].Name)
+			}
+		}
+		if sbomURL == "" {
+			fmt.Fprintln(os.Stderr, styles.HintStyle.Render("hint: pass --sbom-url to link the component to its SBOM"))
+		}
+
+		digest := digests.binary
+		if digest == "" {
+			digest = digests.result
+		}
+
+		catalog := &distribution.Catalog{
+			Name:         roots[0].Name,
+			Description:  description,
+			Owner:        owner,
+			Lifecycle:    lifecycle,
+			System:       system,
+			Repo:         repo,
+			SBOMURL:      sbomURL,
+			Digest:       digest,
+			Dependencies: directDependencies(anomaly.TopLevel(doc)),
+		}
+
+		w := os.Stdout
+		if catalogOutput != "" {
+			w, err = os.Create(catalogOutput)
+			if err != nil {
+				fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+				os.Exit(1)
+			}
+			defer w.Close()
+		}
+
+		err = catalog.WriteBackstage(w)
+		if err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+			os.Exit(1)
+		}
+	},
+}
+
+func directDependencies(topLevel map[string]map[string]bool) []distribution.Dependency {
+	deps := make([]distribution.Dependency, 0, len(topLevel))
+	for name, versions := range topLevel {
+		for version := range versions {
+			deps = append(deps, distribution.Dependency{
+				Name:    name,
+				Version: version,
+				Purl:    bsbom.GeneratePurl(name, version, "", ""),
+			})
+		}
+	}
+	sort.Slice(deps, func(i, j int) bool {
+		if deps[i].Name != deps[j].Name {
+			return deps[i].Name < deps[j].Name
+		}
+		return deps[i].Version < deps[j].Version
+	})
+	return deps
+}
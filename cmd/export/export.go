@@ -0,0 +1,29 @@
+package export
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/buildsafedev/bsf/cmd/styles"
+)
+
+// ExportCmd represents the export command
+var ExportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "publishes build artifacts",
+	Long:  `used to publish the artifacts and attestations generated by bsf build to other systems`,
+	Run: func(cmd *cobra.Command, args []string) {
+		fmt.Println(styles.HintStyle.Render("hint: use bsf export with a subcommand"))
+		os.Exit(1)
+	},
+}
+
+func init() {
+	ExportCmd.AddCommand(githubReleaseCmd)
+	ExportCmd.AddCommand(homebrewCmd)
+	ExportCmd.AddCommand(nixProfileCmd)
+	ExportCmd.AddCommand(backstageCmd)
+	ExportCmd.AddCommand(graphCmd)
+}
@@ -0,0 +1,180 @@
+package export
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+
+	"github.com/spf13/cobra"
+
+	"github.com/buildsafedev/bsf/cmd/styles"
+	"github.com/buildsafedev/bsf/pkg/attestation"
+	bgit "github.com/buildsafedev/bsf/pkg/git"
+	"github.com/buildsafedev/bsf/pkg/githubrelease"
+	"github.com/buildsafedev/bsf/pkg/hcl2nix"
+	"github.com/buildsafedev/bsf/pkg/workspace"
+)
+
+var (
+	output, tag, repo string
+	draft             bool
+)
+
+func init() {
+	githubReleaseCmd.Flags().StringVarP(&output, "output", "o", "bsf-result", "location of the build artifacts")
+	githubReleaseCmd.Flags().StringVarP(&tag, "tag", "t", "", "tag of the release, defaults to the tag pointing at HEAD")
+	githubReleaseCmd.Flags().StringVarP(&repo, "repo", "r", "", "GitHub repository (owner/repo), defaults to the origin remote")
+	githubReleaseCmd.Flags().BoolVarP(&draft, "draft", "", false, "create the release as a draft if it does not exist")
+	workspace.MarkPaths(githubReleaseCmd.Flags(), "output")
+}
+
+var githubReleaseCmd = &cobra.Command{
+	Use:   "github-release",
+	Short: "uploads artifacts, SBOMs, provenance and checksums to a GitHub release",
+	Long: `uploads the binaries, SBOMs, provenance and SHA256SUMS generated by bsf build to the GitHub release of the current tag.
+	The release is created if it does not exist. GITHUB_TOKEN must be set.
+
+	bsf export github-release
+	bsf export github-release --tag v1.0.0 --repo buildsafedev/bsf
+	`,
+	Run: func(cmd *cobra.Command, args []string) {
+		client, err := githubrelease.NewClient()
+		if err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+			os.Exit(1)
+		}
+
+		if tag == "" {
+			tag, err = bgit.CurrentTag()
+			if err != nil {
+				fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+				fmt.Println(styles.HintStyle.Render("hint: tag the commit or pass --tag"))
+				os.Exit(1)
+			}
+		}
+
+		if repo == "" {
+			repo, err = originRepo()
+			if err != nil {
+				fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+				fmt.Println(styles.HintStyle.Render("hint: pass --repo owner/repo"))
+				os.Exit(1)
+			}
+		}
+
+		assets, err := collectAssets(output)
+		if err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+			os.Exit(1)
+		}
+		defer os.RemoveAll(assets.tmpDir)
+
+		ctx := context.Background()
+		release, created, err := client.GetOrCreate(ctx, repo, tag, draft)
+		if err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+			os.Exit(1)
+		}
+		if created {
+			fmt.Println(styles.HighlightStyle.Render(fmt.Sprintf("Created release %s", tag)))
+		}
+
+		names := make([]string, 0, len(assets.files))
+		for name := range assets.files {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			fmt.Println(styles.HighlightStyle.Render(fmt.Sprintf("Uploading %s...", name)))
+			err = client.Upload(ctx, repo, release, name, assets.files[name])
+			if err != nil {
+				fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+				os.Exit(1)
+			}
+		}
+
+		fmt.Println(styles.SucessStyle.Render(fmt.Sprintf("Uploaded %d assets to %s", len(names), release.HTMLURL)))
+	},
+}
+
+type releaseAssets struct {
+	// files maps asset names to local paths
+	files  map[string]string
+	tmpDir string
+}
+
+// collectAssets gathers the binaries and attestations from the build output and writes SHA256SUMS for them
+func collectAssets(output string) (*releaseAssets, error) {
+	tmpDir, err := os.MkdirTemp("", "bsf-release-")
+	if err != nil {
+		return nil, err
+	}
+	assets := &releaseAssets{
+		files:  make(map[string]string),
+		tmpDir: tmpDir,
+	}
+
+	appName := hcl2nix.LockedAppName()
+	if appName == "" {
+		appName = "app"
+	}
+
+	for _, symlink := range []string{"result", "result-bin"} {
+		binDir := filepath.Join(output, symlink, "bin")
+		entries, err := os.ReadDir(binDir)
+		if err != nil {
+			continue
+		}
+		for _, e := range entries {
+			if e.IsDir() {
+				continue
+			}
+			assets.files[fmt.Sprintf("%s-%s-%s", e.Name(), runtime.GOOS, runtime.GOARCH)] = filepath.Join(binDir, e.Name())
+		}
+	}
+
+	attPath := filepath.Join(output, "attestations.intoto.jsonl")
+	attData, err := os.ReadFile(attPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read attestations, run bsf build first: %v", err)
+	}
+	assets.files[appName+".intoto.jsonl"] = attPath
+
+	psMap, err := attestation.ValidateInTotoStatement(attData)
+	if err != nil {
+		return nil, err
+	}
+	for predType, ext := range map[string]string{"spdx": "spdx.json", "cdx": "cdx.json", "provenance": "provenance.json"} {
+		statements, ok := psMap[predType]
+		if !ok || len(statements) == 0 {
+			continue
+		}
+		data, err := json.Marshal(statements[0].Predicate)
+		if err != nil {
+			return nil, err
+		}
+		name := appName + "." + ext
+		path := filepath.Join(tmpDir, name)
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			return nil, err
+		}
+		assets.files[name] = path
+	}
+
+	sums, err := githubrelease.Checksums(assets.files)
+	if err != nil {
+		return nil, err
+	}
+	sumsPath := filepath.Join(tmpDir, "SHA256SUMS")
+	if err := os.WriteFile(sumsPath, []byte(sums), 0644); err != nil {
+		return nil, err
+	}
+	assets.files["SHA256SUMS"] = sumsPath
+
+	return assets, nil
+}
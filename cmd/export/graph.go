@@ -0,0 +1,96 @@
+package export
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/buildsafedev/bsf/cmd/build"
+	"github.com/buildsafedev/bsf/cmd/completion"
+	"github.com/buildsafedev/bsf/cmd/styles"
+	"github.com/buildsafedev/bsf/pkg/depgraph"
+	"github.com/buildsafedev/bsf/pkg/hcl2nix"
+	nixcmd "github.com/buildsafedev/bsf/pkg/nix/cmd"
+	"github.com/buildsafedev/bsf/pkg/workspace"
+)
+
+var (
+	graphFormat, graphOutput, graphProject string
+	graphEnrich                            bool
+)
+
+func init() {
+	graphCmd.Flags().StringVarP(&output, "output", "o", "bsf-result", "location of the build artifacts")
+	graphCmd.Flags().StringVarP(&graphFormat, "format", "", depgraph.FormatJSON, "format of the graph: "+strings.Join(depgraph.Formats, ", "))
+	graphCmd.Flags().StringVarP(&graphOutput, "file", "f", "", "file to write the graph to, defaults to stdout")
+	graphCmd.Flags().StringVarP(&graphProject, "project", "", "", "project the closure is linked to in graph database exports, defaults to the app of bsf.lock")
+	graphCmd.Flags().BoolVarP(&graphEnrich, "enrich", "", false, "annotate the closure with the metadata of the package registry and of nixpkgs, as in the SBOM")
+	workspace.MarkPaths(graphCmd.Flags(), "output", "file")
+}
+
+var graphCmd = &cobra.Command{
+	Use:   "graph [result]",
+	Short: "exports the dependency graph of the closure",
+	Long: `exports the runtime closure of the build result, or of the result symlink or store path given, as a dependency
+	graph for other tools: a JSON adjacency list, GraphML, a Mermaid flowchart or DOT. Nodes are the names of the store
+	paths, sorted, so exports of the same closure are identical. Edges point from the dependency to the dependent, as
+	in the graphs of nix-store --query --graph.
+
+	bsf export graph --format mermaid -f closure.mmd
+	bsf export graph ./result --format graphml
+
+	The cypher, ntriples and sparql formats load the closure into graph databases, Neo4j or triple stores, to query
+	the closures of every project at once. Components are keyed by store path, so projects share their common
+	components, and the project is linked to the roots of its closure:
+
+	bsf export graph --format cypher --enrich | cypher-shell -u neo4j
+	bsf export graph --format sparql --project api | curl --data-binary @- -H 'Content-Type: application/sparql-update' $ENDPOINT
+	`,
+	Args:              cobra.MaximumNArgs(1),
+	ValidArgsFunction: completion.MaxArgs(1, completion.StorePaths),
+	Run: func(cmd *cobra.Command, args []string) {
+		if !slices.Contains(depgraph.Formats, graphFormat) {
+			fmt.Println(styles.ErrorStyle.Render("error:", fmt.Sprintf("unsupported graph format %q, use %s", graphFormat, strings.Join(depgraph.Formats, ", "))))
+			os.Exit(1)
+		}
+
+		result := filepath.Join(output, "result")
+		if len(args) > 0 {
+			result = workspace.Resolve(args[0])
+		}
+		graph, err := nixcmd.StoreClosureGraph(result)
+		if err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+			os.Exit(1)
+		}
+
+		w := io.Writer(os.Stdout)
+		if graphOutput != "" {
+			f, err := os.Create(graphOutput)
+			if err != nil {
+				fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+				os.Exit(1)
+			}
+			defer f.Close()
+			w = f
+		}
+		if graphEnrich {
+			build.EnrichClosure(graph, 0)
+		}
+
+		g := depgraph.FromDOT(graph)
+		g.Project = graphProject
+		if g.Project == "" {
+			g.Project = hcl2nix.LockedAppName()
+		}
+		if err = depgraph.Write(w, g, graphFormat); err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+			os.Exit(1)
+		}
+	},
+}
@@ -0,0 +1,167 @@
+package export
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/buildsafedev/bsf/cmd/styles"
+	"github.com/buildsafedev/bsf/pkg/attestation"
+	"github.com/buildsafedev/bsf/pkg/distribution"
+	bgit "github.com/buildsafedev/bsf/pkg/git"
+	"github.com/buildsafedev/bsf/pkg/githubrelease"
+	"github.com/buildsafedev/bsf/pkg/layout"
+	"github.com/buildsafedev/bsf/pkg/workspace"
+)
+
+var (
+	description, homepage, url, version, formulaOutput string
+)
+
+func init() {
+	homebrewCmd.Flags().StringVarP(&output, "output", "o", "bsf-result", "location of the build artifacts")
+	homebrewCmd.Flags().StringVarP(&formulaOutput, "file", "f", "", "file to write the formula to, defaults to stdout")
+	homebrewCmd.Flags().StringVarP(&tag, "tag", "t", "", "tag of the release, defaults to the tag pointing at HEAD")
+	homebrewCmd.Flags().StringVarP(&repo, "repo", "r", "", "GitHub repository (owner/repo), defaults to the origin remote")
+	homebrewCmd.Flags().StringVarP(&url, "url", "", "", "download URL of the binary, defaults to the asset uploaded by bsf export github-release")
+	homebrewCmd.Flags().StringVarP(&version, "version", "", "", "version of the formula, defaults to the tag")
+	homebrewCmd.Flags().StringVarP(&description, "desc", "", "", "description of the formula")
+	homebrewCmd.Flags().StringVarP(&homepage, "homepage", "", "", "homepage of the formula, defaults to the GitHub repository")
+	workspace.MarkPaths(homebrewCmd.Flags(), "output", "file")
+}
+
+var homebrewCmd = &cobra.Command{
+	Use:   "homebrew",
+	Short: "generates a Homebrew formula for the built binary",
+	Long: `generates a Homebrew formula that installs the binary built by bsf build, pinned to the digest recorded in its provenance.
+
+	bsf export homebrew
+	bsf export homebrew --tag v1.0.0 --desc "my tool" -f Formula/mytool.rb
+	`,
+	Run: func(cmd *cobra.Command, args []string) {
+		binPath, err := findBinary(output)
+		if err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+			os.Exit(1)
+		}
+		binName := filepath.Base(binPath)
+
+		digests, err := subjectDigests(output)
+		if err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+			os.Exit(1)
+		}
+
+		if tag == "" && (url == "" || version == "") {
+			tag, err = bgit.CurrentTag()
+			if err != nil {
+				fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+				fmt.Println(styles.HintStyle.Render("hint: tag the commit or pass --tag"))
+				os.Exit(1)
+			}
+		}
+		if repo == "" && (url == "" || homepage == "") {
+			repo, err = originRepo()
+			if err != nil {
+				fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+				fmt.Println(styles.HintStyle.Render("hint: pass --repo owner/repo"))
+				os.Exit(1)
+			}
+		}
+		if url == "" {
+			url = fmt.Sprintf("https://github.com/%s/releases/download/%s/%s-%s-%s", repo, tag, binName, runtime.GOOS, runtime.GOARCH)
+		}
+		if version == "" {
+			version = strings.TrimPrefix(tag, "v")
+		}
+		if homepage == "" {
+			homepage = "https://github.com/" + repo
+		}
+
+		formula := &distribution.Formula{
+			Name:        binName,
+			Description: description,
+			Homepage:    homepage,
+			Version:     version,
+			URL:         url,
+			SHA256:      digests.binary,
+			Binary:      binName,
+		}
+
+		w := os.Stdout
+		if formulaOutput != "" {
+			w, err = os.Create(formulaOutput)
+			if err != nil {
+				fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+				os.Exit(1)
+			}
+			defer w.Close()
+		}
+
+		err = formula.WriteHomebrew(w)
+		if err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+			os.Exit(1)
+		}
+	},
+}
+
+// buildDigests are the digests bsf build recorded as provenance subjects
+type buildDigests struct {
+	binary string
+	result string
+}
+
+func subjectDigests(output string) (*buildDigests, error) {
+	attData, err := layout.ReadAttestations(output)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read attestations, run bsf build first: %v", err)
+	}
+
+	psMap, err := attestation.ValidateInTotoStatement(attData)
+	if err != nil {
+		return nil, err
+	}
+	statements := psMap["provenance"]
+	if len(statements) == 0 {
+		return nil, fmt.Errorf("no provenance found in attestations")
+	}
+
+	digests := &buildDigests{}
+	for _, s := range statements[0].Subject {
+		if strings.HasPrefix(s.Name, "result-") {
+			digests.result = s.Digest["sha256"]
+			continue
+		}
+		digests.binary = s.Digest["sha256"]
+	}
+	return digests, nil
+}
+
+func findBinary(output string) (string, error) {
+	for _, symlink := range []string{"result", "result-bin"} {
+		binDir := filepath.Join(output, symlink, "bin")
+		entries, err := os.ReadDir(binDir)
+		if err != nil {
+			continue
+		}
+		for _, e := range entries {
+			if !e.IsDir() {
+				return filepath.Join(binDir, e.Name()), nil
+			}
+		}
+	}
+	return "", fmt.Errorf("no binary found in %s", output)
+}
+
+func originRepo() (string, error) {
+	remote, err := bgit.RemoteURL("origin")
+	if err != nil {
+		return "", err
+	}
+	return githubrelease.RepoFromRemote(remote)
+}
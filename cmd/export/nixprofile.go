@@ -0,0 +1,70 @@
+package export
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"github.com/buildsafedev/bsf/cmd/styles"
+	"github.com/buildsafedev/bsf/pkg/distribution"
+	bgit "github.com/buildsafedev/bsf/pkg/git"
+	"github.com/buildsafedev/bsf/pkg/workspace"
+)
+
+func init() {
+	nixProfileCmd.Flags().StringVarP(&output, "output", "o", "bsf-result", "location of the build artifacts")
+	nixProfileCmd.Flags().StringVarP(&repo, "repo", "r", "", "GitHub repository (owner/repo), defaults to the origin remote")
+	workspace.MarkPaths(nixProfileCmd.Flags(), "output")
+}
+
+var nixProfileCmd = &cobra.Command{
+	Use:   "nix-profile",
+	Short: "prints nix profile install instructions pinned to the build",
+	Long: `prints instructions to install the project with nix profile, pinned to the current commit and the NAR hash bsf recorded for the build result.
+
+	bsf export nix-profile
+	`,
+	Run: func(cmd *cobra.Command, args []string) {
+		digests, err := subjectDigests(output)
+		if err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+			os.Exit(1)
+		}
+
+		if repo == "" {
+			repo, err = originRepo()
+			if err != nil {
+				fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+				fmt.Println(styles.HintStyle.Render("hint: pass --repo owner/repo"))
+				os.Exit(1)
+			}
+		}
+
+		rev, err := bgit.HeadCommit()
+		if err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+			os.Exit(1)
+		}
+
+		storePath, err := os.Readlink(filepath.Join(output, "result"))
+		if err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+			os.Exit(1)
+		}
+
+		np := &distribution.NixProfile{
+			Name:      filepath.Base(storePath),
+			Repo:      repo,
+			Rev:       rev,
+			StorePath: storePath,
+			NarHash:   digests.result,
+		}
+		err = np.WriteInstructions(os.Stdout)
+		if err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+			os.Exit(1)
+		}
+	},
+}
@@ -0,0 +1,82 @@
+package generate
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"github.com/buildsafedev/bsf/cmd/styles"
+	"github.com/buildsafedev/bsf/pkg/builddocker"
+	"github.com/buildsafedev/bsf/pkg/workspace"
+)
+
+var (
+	contextDir string
+)
+
+func init() {
+	dockerfileCmd.Flags().StringVarP(&contextDir, "output", "o", "", "directory the Dockerfile and the layers it adds are written to, the Dockerfile is printed when unset")
+	workspace.MarkPaths(dockerfileCmd.Flags(), "output")
+
+	GenerateCmd.AddCommand(dockerfileCmd)
+}
+
+// GenerateCmd represents the generate command
+var GenerateCmd = &cobra.Command{
+	Use:   "generate",
+	Short: "generates files describing the artifacts built by bsf",
+	Long: `generates files describing the artifacts bsf built, for the tools and reviews that expect them.
+
+	bsf generate dockerfile
+	bsf generate dockerfile bsf-result --output review/
+	`,
+	Run: func(cmd *cobra.Command, args []string) {
+		fmt.Println(styles.HintStyle.Render("hint: use bsf generate with a subcommand"))
+		os.Exit(1)
+	},
+}
+
+var dockerfileCmd = &cobra.Command{
+	Use:   "dockerfile [output directory of bsf oci]",
+	Short: "generates a Dockerfile equivalent to an image built by bsf oci",
+	Long: `generates a deterministic Dockerfile equivalent to the image bsf oci built, for review boards that require one:
+	it starts FROM scratch and ADDs the layers of the image, the closure of the app, with its environment, entrypoint
+	and command. The Dockerfile is annotated as generated and records the digests of the manifest, config and layers
+	of the image. With --output, the layers are written next to it, named by their digest, so the build context
+	holds the exact layer blobs of the image.
+	The image built by bsf remains the artifact to ship: an image built from the Dockerfile has the same files, but
+	docker recompresses its layers and its digests differ.
+
+	bsf generate dockerfile
+	bsf generate dockerfile bsf-result --output review/
+	`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		output := "bsf-result"
+		if len(args) > 0 {
+			output = workspace.Resolve(args[0])
+		}
+		dir := filepath.Join(output, "result")
+		img, err := builddocker.ReadScratchImage(dir)
+		if err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+			fmt.Println(styles.HintStyle.Render("hint:", "run `bsf oci <environment name>` to build the image first"))
+			os.Exit(1)
+		}
+
+		if contextDir == "" {
+			if err := img.WriteDockerfile(os.Stdout); err != nil {
+				fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+				os.Exit(1)
+			}
+			return
+		}
+		if err := img.WriteContext(dir, contextDir); err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+			os.Exit(1)
+		}
+		fmt.Println(styles.SucessStyle.Render(fmt.Sprintf("Dockerfile and %d layers written to %s", len(img.Layers), contextDir)))
+	},
+}
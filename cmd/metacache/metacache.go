@@ -0,0 +1,172 @@
+package metacache
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/buildsafedev/bsf/cmd/configure"
+	"github.com/buildsafedev/bsf/cmd/styles"
+	"github.com/buildsafedev/bsf/pkg/enrichdb"
+	"github.com/buildsafedev/bsf/pkg/flakelock"
+	"github.com/buildsafedev/bsf/pkg/nixmeta"
+)
+
+var (
+	rev, location string
+)
+
+func init() {
+	for _, c := range []*cobra.Command{generateCmd, pushCmd, pullCmd} {
+		c.Flags().StringVarP(&rev, "rev", "", "", "nixpkgs revision, defaults to the one locked in bsf/flake.lock")
+	}
+	for _, c := range []*cobra.Command{pushCmd, pullCmd} {
+		c.Flags().StringVarP(&location, "location", "l", "", "shared cache location (a directory, https:// or s3://), defaults to metadata_cache in ~/.bsf.json")
+	}
+
+	MetaCacheCmd.AddCommand(generateCmd)
+	MetaCacheCmd.AddCommand(pushCmd)
+	MetaCacheCmd.AddCommand(pullCmd)
+}
+
+// MetaCacheCmd represents the cache command
+var MetaCacheCmd = &cobra.Command{
+	Use:   "cache",
+	Short: "manages the nixpkgs metadata cache",
+	Long: `the nixpkgs metadata cache maps store paths to attribute paths, licenses, homepages, descriptions and maintainers.
+	bsf build uses it to set the metadata of the SBOM components, and evaluates nixpkgs for the packages it misses.
+	Generating it evaluates all of nixpkgs, so it can be shared across machines keyed by the nixpkgs revision.
+
+	bsf cache generate
+	bsf cache push --location s3://my-bucket/bsf
+	bsf cache pull --location https://cache.example.com/bsf
+	`,
+	Run: func(cmd *cobra.Command, args []string) {
+		fmt.Println(styles.HintStyle.Render("hint: use bsf cache with a subcommand"))
+		os.Exit(1)
+	},
+}
+
+var generateCmd = &cobra.Command{
+	Use:   "generate",
+	Short: "evaluates nixpkgs and stores its metadata in the local cache",
+	Run: func(cmd *cobra.Command, args []string) {
+		r := nixpkgsRev()
+
+		fmt.Println(styles.HighlightStyle.Render(fmt.Sprintf("Evaluating nixpkgs %s, this can take several minutes...", r)))
+		c, err := nixmeta.Generate(r)
+		if err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+			os.Exit(1)
+		}
+
+		path, err := c.Save()
+		if err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+			os.Exit(1)
+		}
+		fmt.Println(styles.SucessStyle.Render(fmt.Sprintf("Cached metadata of %d packages in %s", len(c.Entries), path)))
+	},
+}
+
+var pushCmd = &cobra.Command{
+	Use:   "push",
+	Short: "uploads the local metadata cache to the shared location",
+	Run: func(cmd *cobra.Command, args []string) {
+		r := nixpkgsRev()
+		loc := cacheLocation()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+		defer cancel()
+
+		err := nixmeta.Push(ctx, loc, r)
+		if err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+			os.Exit(1)
+		}
+		fmt.Println(styles.SucessStyle.Render(fmt.Sprintf("Pushed metadata cache for %s to %s", r, loc)))
+	},
+}
+
+var pullCmd = &cobra.Command{
+	Use:   "pull",
+	Short: "downloads the metadata cache from the shared location",
+	Run: func(cmd *cobra.Command, args []string) {
+		r := nixpkgsRev()
+		loc := cacheLocation()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+		defer cancel()
+
+		c, err := nixmeta.Pull(ctx, loc, r)
+		if err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+			fmt.Println(styles.HintStyle.Render("hint: run bsf cache generate and bsf cache push on one machine first"))
+			os.Exit(1)
+		}
+
+		// the metadata cache is an enrichment database, record which snapshot was pulled
+		lock, err := enrichdb.ReadLock(enrichdb.LockFile)
+		if err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+			os.Exit(1)
+		}
+		path, err := nixmeta.Path(r)
+		if err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+			os.Exit(1)
+		}
+		snapshot, err := enrichdb.Record(lock, "nixmeta/"+r, loc, path)
+		if err != nil {
+			// don't leave content that doesn't match the pin in the cache
+			os.Remove(path)
+			fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+			os.Exit(1)
+		}
+		if err := lock.Write(enrichdb.LockFile); err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+			os.Exit(1)
+		}
+		fmt.Println(styles.SucessStyle.Render(fmt.Sprintf("Pulled metadata of %d packages for %s (%s)", len(c.Entries), r, snapshot.Digest)))
+	},
+}
+
+func nixpkgsRev() string {
+	if rev != "" {
+		return rev
+	}
+
+	lock, err := flakelock.Read("bsf/flake.lock")
+	if err != nil {
+		fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+		fmt.Println(styles.HintStyle.Render("hint: run bsf init or pass --rev"))
+		os.Exit(1)
+	}
+	r, ok := lock.InputRev("nixpkgs")
+	if !ok {
+		fmt.Println(styles.ErrorStyle.Render("error: nixpkgs is not locked in bsf/flake.lock"))
+		os.Exit(1)
+	}
+	return r
+}
+
+func cacheLocation() string {
+	if location != "" {
+		return location
+	}
+
+	conf, err := configure.PreCheckConf()
+	if err != nil {
+		fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+		os.Exit(1)
+	}
+	if conf.MetadataCache == "" {
+		fmt.Println(styles.ErrorStyle.Render("error: no metadata cache location configured"))
+		fmt.Println(styles.HintStyle.Render("hint: pass --location or set metadata_cache in ~/.bsf.json"))
+		os.Exit(1)
+	}
+	return conf.MetadataCache
+}
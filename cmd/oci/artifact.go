@@ -0,0 +1,81 @@
+package oci
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/buildsafedev/bsf/cmd/completion"
+	"github.com/buildsafedev/bsf/cmd/styles"
+	nixcmd "github.com/buildsafedev/bsf/pkg/nix/cmd"
+	"github.com/buildsafedev/bsf/pkg/oci"
+	"github.com/buildsafedev/bsf/pkg/shutdown"
+	"github.com/buildsafedev/bsf/pkg/workspace"
+)
+
+var pushPathCmd = &cobra.Command{
+	Use:   "push-path",
+	Short: "Pushes a store path to a registry as an artifact",
+	Long: `
+	Pushes the NAR of any store path as an OCI artifact, annotated with its narinfo (store path, NAR hash and size,
+	references and deriver). The NAR blob is named by the NAR hash, so registries can store Nix outputs by content.
+	Without a tag, the artifact is tagged with the hash part of the store path.
+
+	bsf oci push-path <store path or result symlink> <repository>
+	bsf oci push-path ./bsf-result/result ghcr.io/acme/nix-outputs:app-1.0
+	`,
+	Args:              cobra.ExactArgs(2),
+	ValidArgsFunction: completion.MaxArgs(1, completion.StorePaths),
+	Run: func(cmd *cobra.Command, args []string) {
+		storePath, err := nixcmd.ResolveStorePath(workspace.Resolve(args[0]))
+		if err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+			os.Exit(1)
+		}
+
+		ref, err := oci.ParseReference(args[1])
+		if err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+			os.Exit(1)
+		}
+		if !hasTag(args[1]) {
+			ref.Tag = oci.StorePathTag(storePath)
+		}
+
+		shutdown.Notify()
+		fmt.Println(styles.HighlightStyle.Render(fmt.Sprintf("Serialising %s...", storePath)))
+		narPath, info, err := nixcmd.DumpNARFile(storePath)
+		if err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+			os.Exit(1)
+		}
+		// the NAR is removed when the push fails or is interrupted too
+		defer shutdown.RemoveOnExit(narPath)()
+		defer os.Remove(narPath)
+
+		desc, err := newClient(insecureRegistry).PushNAR(shutdown.Context(), ref, narPath, oci.NARInfo{
+			StorePath:  info.StorePath,
+			NarHash:    info.NarHash,
+			NarSize:    info.NarSize,
+			References: info.References,
+			Deriver:    info.Deriver,
+		})
+		if err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+			shutdown.Exit(1, err)
+		}
+		fmt.Println(styles.SucessStyle.Render(fmt.Sprintf("%s pushed to %s@%s", storePath, ref, desc.Digest)))
+	},
+}
+
+// hasTag reports if the image name has an explicit tag
+func hasTag(name string) bool {
+	last := name[strings.LastIndex(name, "/")+1:]
+	return strings.Contains(last, ":")
+}
+
+func init() {
+	OCICmd.AddCommand(pushPathCmd)
+}
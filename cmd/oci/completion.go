@@ -0,0 +1,43 @@
+package oci
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/buildsafedev/bsf/cmd/completion"
+	nixcmd "github.com/buildsafedev/bsf/pkg/nix/cmd"
+	"github.com/buildsafedev/bsf/pkg/workspace"
+)
+
+// completeEnvironments completes the environments of the images of the flake of the project for the platform of
+// --platform. The attributes of the flake are evaluated once per revision of the flake, the environments of the
+// oci blocks of bsf.hcl are completed until then and when the flake doesn't evaluate.
+func completeEnvironments(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	root, err := workspace.FindRoot(".")
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	plat, _ := cmd.Flags().GetString("platform")
+	if plat == "" {
+		tos, tarch := findPlatform(plat)
+		plat = tos + "/" + tarch
+	}
+
+	envs := make([]string, 0)
+	names, err := nixcmd.FlakeAttrNames(filepath.Join(root, "bsf"), "ociImages."+nixSystem(plat))
+	if err == nil {
+		for _, name := range names {
+			env := strings.TrimSuffix(strings.TrimPrefix(name, "ociImage_"), "-as-dir")
+			if ociImageAttr(env) == name {
+				envs = append(envs, env)
+			}
+		}
+	} else if conf, err := readConfigAt(filepath.Join(root, "bsf.hcl")); err == nil {
+		for _, a := range conf.OCIArtifact {
+			envs = append(envs, a.Environment)
+		}
+	}
+	return completion.Filter(envs, toComplete), cobra.ShellCompDirectiveNoFileComp
+}
@@ -2,15 +2,19 @@ package oci
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"os"
+	"path/filepath"
 	"runtime"
 	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 
 	"github.com/buildsafedev/bsf/cmd/build"
+	"github.com/buildsafedev/bsf/cmd/completion"
 	binit "github.com/buildsafedev/bsf/cmd/init"
 	"github.com/buildsafedev/bsf/cmd/styles"
 	"github.com/buildsafedev/bsf/pkg/builddocker"
@@ -19,11 +23,17 @@ import (
 	"github.com/buildsafedev/bsf/pkg/hcl2nix"
 	nixcmd "github.com/buildsafedev/bsf/pkg/nix/cmd"
 	"github.com/buildsafedev/bsf/pkg/oci"
+	"github.com/buildsafedev/bsf/pkg/workspace"
 )
 
 var (
 	platform, output             string
 	push, loadDocker, loadPodman bool
+	insecureRegistry             bool
+	chunkSize, parallelUploads   int
+	mountFrom, registryNames     []string
+	channel                      string
+	force                        bool
 )
 var (
 	supportedPlatforms = []string{"linux/amd64", "linux/arm64"}
@@ -37,6 +47,18 @@ var OCICmd = &cobra.Command{
 	bsf oci <environment name> 
 	bsf oci <environment name> --platform <platform>
 	bsf oci <environment name> --platform <platform> --output <output directory>
+	bsf oci <environment name> --push --registry <registry name>
+
+	The APIs the container serves on its exposed ports are CycloneDX services of its SBOM, for threat modeling tools.
+	Endpoint blocks of the oci block describe them, the other exposed ports are services of their transport:
+
+	endpoint "public-api" {
+	  port          = "8443/tcp"
+	  protocol      = "https"
+	  path          = "/v1"
+	  authenticated = true
+	  public        = true
+	}
 	`,
 	Run: func(cmd *cobra.Command, args []string) {
 		// todo: we could provide a TUI list dropdown to select
@@ -82,7 +104,7 @@ var OCICmd = &cobra.Command{
 
 		symlink := "/result"
 
-		err = nixcmd.Build(output+symlink, genOCIAttrName(env.Environment, platform))
+		err = nixcmd.Build(filepath.Join(output, symlink), genOCIAttrName(env.Environment, platform))
 		if err != nil {
 			fmt.Println(styles.ErrorStyle.Render("error: ", err.Error()))
 			os.Exit(1)
@@ -102,15 +124,16 @@ var OCICmd = &cobra.Command{
 			os.Exit(1)
 		}
 
-		appDetails, graph, err := nixcmd.GetRuntimeClosureGraph(lockFile.App.Name, output, symlink)
+		appDetails, graph, err := nixcmd.GetRuntimeClosureGraph(lockFile.App.Name, output, symlink, nixcmd.ClosureOptions{Realise: true})
 		if err != nil {
 			fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
 			os.Exit(1)
 		}
 		appDetails.Name = env.Name
+		build.EnrichClosure(graph, 0)
 
 		tos, tarch := findPlatform(platform)
-		err = build.GenerateArtifcats(output, symlink, lockFile, appDetails, graph, tos, tarch)
+		err = build.GenerateArtifcats(output, symlink, lockFile, appDetails, graph, tos, tarch, build.ArtifactOptions{Endpoints: env.Services()})
 		if err != nil {
 			fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
 			os.Exit(1)
@@ -141,7 +164,7 @@ var OCICmd = &cobra.Command{
 				contextEP[currentContext] = "unix:///var/run/docker.sock"
 			}
 
-			err = oci.LoadDocker(contextEP[currentContext], output+"/result", env.Name)
+			err = oci.LoadDocker(contextEP[currentContext], filepath.Join(output, "result"), env.Name)
 			if err != nil {
 				fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
 				if !expectedInstall {
@@ -156,7 +179,7 @@ var OCICmd = &cobra.Command{
 
 		if loadPodman {
 			fmt.Println(styles.HighlightStyle.Render("Loading image to podman..."))
-			err = oci.LoadPodman(output+"/result", env.Name)
+			err = oci.LoadPodman(filepath.Join(output, "result"), env.Name)
 			if err != nil {
 				fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
 				os.Exit(1)
@@ -166,17 +189,69 @@ var OCICmd = &cobra.Command{
 
 		if push {
 			fmt.Println(styles.HighlightStyle.Render("Pushing image to registry..."))
-			err = oci.Push(output+"/result", env.Name)
+			err = pushImage(filepath.Join(output, "result"), env.Name)
 			if err != nil {
 				fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
 				os.Exit(1)
 			}
 			fmt.Println(styles.SucessStyle.Render(fmt.Sprintf("Image %s pushed to registry", env.Name)))
+
+			registries, err := selectRegistries(env, registryNames)
+			if err != nil {
+				fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+				os.Exit(1)
+			}
+			if len(registries) > 0 {
+				conf, err := readConfig()
+				if err != nil {
+					fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+					os.Exit(1)
+				}
+				err = pushRegistries(context.Background(), lockFile.App.Name, output, filepath.Join(output, "result"), registries, conf, tagData(env.Name, appDetails))
+				if err != nil {
+					fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+					os.Exit(1)
+				}
+			}
 		}
 
 	},
 }
 
+// pushImage pushes the image in chunks, an interrupted push resumes where it stopped when run again
+func pushImage(dir, imageName string) error {
+	ref, err := oci.ParseReference(imageName)
+	if err != nil {
+		return err
+	}
+	subject, err := oci.DirManifest(dir)
+	if err != nil {
+		return err
+	}
+
+	client := newClient(insecureRegistry)
+	if err := checkImmutable(context.Background(), client, ref, subject.Digest); err != nil {
+		return err
+	}
+	return client.PushDir(context.Background(), dir, ref)
+}
+
+// tagData returns the build metadata the tag templates of the registries are evaluated from
+func tagData(imageName string, app *nixcmd.App) oci.TagData {
+	data := oci.TagData{
+		Version: app.Version,
+		Date:    time.Now().UTC().Format("20060102"),
+		Channel: channel,
+	}
+	if ref, err := oci.ParseReference(imageName); err == nil {
+		data.Tag = ref.Tag
+	}
+	if commit, err := bgit.HeadCommit(); err == nil && len(commit) >= 7 {
+		data.GitSHA = commit[:7]
+	}
+	return data
+}
+
 func findPlatform(platform string) (string, string) {
 	if platform == "" {
 		return runtime.GOOS, runtime.GOARCH
@@ -207,15 +282,9 @@ func ProcessPlatformAndConfig(plat string, envName string) (hcl2nix.OCIArtifact,
 	if !pfound {
 		return hcl2nix.OCIArtifact{}, "", fmt.Errorf("Platform %s is not supported. Supported platforms are %s", platform, strings.Join(supportedPlatforms, ", "))
 	}
-	data, err := os.ReadFile("bsf.hcl")
-	if err != nil {
-		return hcl2nix.OCIArtifact{}, "", fmt.Errorf("error: %s", err.Error())
-	}
-
-	var dstErr bytes.Buffer
-	conf, err := hcl2nix.ReadConfig(data, &dstErr)
+	conf, err := readConfig()
 	if err != nil {
-		return hcl2nix.OCIArtifact{}, "", fmt.Errorf(dstErr.String())
+		return hcl2nix.OCIArtifact{}, "", err
 	}
 
 	envNames := make([]string, 0, len(conf.OCIArtifact))
@@ -242,16 +311,45 @@ func ProcessPlatformAndConfig(plat string, envName string) (hcl2nix.OCIArtifact,
 	return env, plat, nil
 }
 
+// readConfig reads bsf.hcl
+func readConfig() (*hcl2nix.Config, error) {
+	return readConfigAt("bsf.hcl")
+}
+
+// readConfigAt reads the bsf.hcl at path
+func readConfigAt(path string) (*hcl2nix.Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error: %s", err.Error())
+	}
+
+	var dstErr bytes.Buffer
+	conf, err := hcl2nix.ReadConfig(data, &dstErr)
+	if err != nil {
+		return nil, fmt.Errorf(dstErr.String())
+	}
+	return conf, nil
+}
+
 func genOCIAttrName(env, platform string) string {
 	// .#ociImages.x86_64-linux.ociImage_caddy-as-dir
-	tostarch := ""
+	return fmt.Sprintf("bsf/.#ociImages.%s.%s", nixSystem(platform), ociImageAttr(env))
+}
+
+// ociImageAttr returns the name of the attribute of the image of the environment in ociImages
+func ociImageAttr(env string) string {
+	return "ociImage_" + env + "-as-dir"
+}
+
+// nixSystem returns the nix system of the platform, e.g. x86_64-linux for linux/amd64
+func nixSystem(platform string) string {
 	switch platform {
 	case "linux/amd64":
-		tostarch = "x86_64-linux"
+		return "x86_64-linux"
 	case "linux/arm64":
-		tostarch = "aarch64-linux"
+		return "aarch64-linux"
 	}
-	return fmt.Sprintf("bsf/.#ociImages.%s.ociImage_%s-as-dir", tostarch, env)
+	return ""
 }
 
 func init() {
@@ -260,5 +358,14 @@ func init() {
 	OCICmd.Flags().BoolVarP(&loadDocker, "load-docker", "", false, "Load the image into docker daemon")
 	OCICmd.Flags().BoolVarP(&loadPodman, "load-podman", "", false, "Load the image into podman")
 	OCICmd.Flags().BoolVarP(&push, "push", "", false, "Push the image to the registry")
-
+	OCICmd.PersistentFlags().IntVarP(&chunkSize, "chunk-size", "", oci.DefaultChunkSize>>20, "size in MiB of the chunks layers are pushed in")
+	OCICmd.PersistentFlags().IntVarP(&parallelUploads, "parallel", "", oci.DefaultParallel, "number of layers pushed at the same time")
+	OCICmd.PersistentFlags().StringSliceVarP(&mountFrom, "mount-from", "", nil, "repositories of the same registry to mount existing layers from instead of uploading them")
+	OCICmd.PersistentFlags().BoolVarP(&insecureRegistry, "insecure-registry", "", false, "push to the registry over plain HTTP")
+	OCICmd.Flags().StringSliceVarP(&registryNames, "registry", "", nil, "names of the registry blocks of the oci block to push to with --push, all of them by default")
+	OCICmd.Flags().StringVarP(&channel, "channel", "", "", "release channel the {channel} placeholder of the registry tags is replaced with, e.g. stable")
+	OCICmd.Flags().BoolVarP(&force, "force", "", false, "move immutable tags that already point to a different image")
+	workspace.MarkPaths(OCICmd.Flags(), "output")
+	OCICmd.ValidArgsFunction = completion.MaxArgs(1, completeEnvironments)
+	OCICmd.RegisterFlagCompletionFunc("platform", cobra.FixedCompletions(supportedPlatforms, cobra.ShellCompDirectiveNoFileComp))
 }
@@ -0,0 +1,332 @@
+package oci
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/buildsafedev/bsf/cmd/build"
+	"github.com/buildsafedev/bsf/cmd/styles"
+	"github.com/buildsafedev/bsf/pkg/attestation"
+	"github.com/buildsafedev/bsf/pkg/builddb"
+	"github.com/buildsafedev/bsf/pkg/events"
+	bgit "github.com/buildsafedev/bsf/pkg/git"
+	"github.com/buildsafedev/bsf/pkg/hcl2nix"
+	"github.com/buildsafedev/bsf/pkg/layout"
+	"github.com/buildsafedev/bsf/pkg/oci"
+	bsbom "github.com/buildsafedev/bsf/pkg/sbom"
+	"github.com/buildsafedev/bsf/pkg/signing"
+)
+
+// redactionAnnotation records on the attestations artifact the redaction profile applied to it
+const redactionAnnotation = "buildsafe.dev/redaction"
+
+// platformAnnotation records on a SBOM artifact the platform of the image manifest it refers to, as os/arch[/variant]
+const platformAnnotation = "buildsafe.dev/platform"
+
+// newClient returns the registry client configured by the push flags
+func newClient(insecure bool) *oci.Client {
+	client := oci.NewClient()
+	client.ChunkSize = int64(chunkSize) << 20
+	client.Parallel = parallelUploads
+	client.Insecure = insecure
+	client.MountFrom = mountFrom
+	client.Progress = func(digest string, uploaded, size int64) {
+		events.Emit(events.Event{Type: events.PushProgress, Digest: digest, Uploaded: uploaded, Size: size})
+		if uploaded == size {
+			fmt.Println(styles.TextStyle.Render(fmt.Sprintf("pushed %s (%d bytes)", digest, size)))
+		}
+	}
+	return client
+}
+
+// selectRegistries returns the registries of the oci block with the given names, all of them when names is empty
+func selectRegistries(env hcl2nix.OCIArtifact, names []string) ([]hcl2nix.Registry, error) {
+	if len(names) == 0 {
+		return env.Registries, nil
+	}
+	selected := make([]hcl2nix.Registry, 0, len(names))
+	for _, name := range names {
+		found := false
+		for _, r := range env.Registries {
+			if r.Name == name {
+				selected = append(selected, r)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("no registry %s in the oci block %s", name, env.Environment)
+		}
+	}
+	return selected, nil
+}
+
+// pushTarget is a tag of a registry the image is pushed under
+type pushTarget struct {
+	registry hcl2nix.Registry
+	ref      *oci.Reference
+	mutable  bool
+}
+
+// planPush evaluates the tag templates of the registries. Registries pushing to the same tag of a repository collide.
+func planPush(registries []hcl2nix.Registry, data oci.TagData) ([]pushTarget, error) {
+	var targets []pushTarget
+	owner := make(map[string]string)
+	for _, r := range registries {
+		templates := r.Tags
+		if len(templates) == 0 && len(r.MutableTags) == 0 {
+			templates = []string{"{tag}"}
+		}
+		tags, err := oci.ExpandTags(append(append([]string{}, templates...), r.MutableTags...), data)
+		if err != nil {
+			return nil, fmt.Errorf("registry %s: %v", r.Name, err)
+		}
+		mutable, err := oci.ExpandTags(r.MutableTags, data)
+		if err != nil {
+			return nil, fmt.Errorf("registry %s: %v", r.Name, err)
+		}
+
+		for _, tag := range tags {
+			ref, err := oci.ParseReference(r.Repository + ":" + tag)
+			if err != nil {
+				return nil, fmt.Errorf("registry %s: %v", r.Name, err)
+			}
+			if other, ok := owner[ref.String()]; ok {
+				return nil, fmt.Errorf("registries %s and %s both push to %s", other, r.Name, ref)
+			}
+			owner[ref.String()] = r.Name
+			targets = append(targets, pushTarget{registry: r, ref: ref, mutable: tag == "latest" || contains(mutable, tag)})
+		}
+	}
+	return targets, nil
+}
+
+func contains(values []string, v string) bool {
+	for _, s := range values {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
+
+// checkImmutable fails when an immutable tag already points to an image other than digest, unless forced
+func checkImmutable(ctx context.Context, client *oci.Client, ref *oci.Reference, digest string) error {
+	if force || ref.Tag == "latest" {
+		return nil
+	}
+	existing, err := client.ManifestDigest(ctx, ref)
+	if err != nil {
+		return fmt.Errorf("failed to check %s: %v", ref, err)
+	}
+	if existing != "" && existing != digest {
+		return fmt.Errorf("%s already points to %s, a different image than %s. Tags are immutable, use --force to move it", ref, existing, digest)
+	}
+	return nil
+}
+
+// redaction returns the redaction profile of the registry
+func redaction(r hcl2nix.Registry, conf *hcl2nix.Config) attestation.Redaction {
+	switch r.Redact {
+	case "", hcl2nix.RedactNone:
+		return attestation.Redaction{}
+	case hcl2nix.RedactPublic:
+		return attestation.PublicRedaction
+	}
+	red := conf.FindRedaction(r.Redact)
+	if red == nil {
+		return attestation.PublicRedaction
+	}
+	return attestation.Redaction{Fields: red.Fields, Hosts: red.Hosts, Comments: red.Comments}
+}
+
+// registryAttestations returns the attestations published to the registry, redacted with its profile and signed
+// with its key. Without a key, the signed attestations of the build are published when nothing was redacted.
+func registryAttestations(output string, r hcl2nix.Registry, conf *hcl2nix.Config) ([]byte, error) {
+	l, err := layout.Open(output)
+	if err != nil {
+		return nil, err
+	}
+	red := redaction(r, conf)
+	if r.Key == "" && red.IsZero() {
+		if _, ok := l.Find(layout.KindAttestation, layout.SignedAttestationsName); ok {
+			return l.Read(layout.KindAttestation, layout.SignedAttestationsName)
+		}
+	}
+
+	attestations, err := layout.ReadAttestations(output)
+	if err != nil {
+		return nil, err
+	}
+	attestations, err = attestation.Redact(attestations, red)
+	if err != nil {
+		return nil, err
+	}
+	if r.Key == "" {
+		return attestations, nil
+	}
+
+	signer, err := signing.ReadPrivateKey(r.Key)
+	if err != nil {
+		return nil, err
+	}
+	var signed bytes.Buffer
+	if err := signing.SignAttestations(&signed, attestations, signer, nil); err != nil {
+		return nil, err
+	}
+	return signed.Bytes(), nil
+}
+
+// sigstoreBundles returns the sigstore bundles of the JSON lines attestations, none when they aren't signed
+func sigstoreBundles(attestations []byte) [][]byte {
+	bundles := make([][]byte, 0)
+	for _, line := range bytes.Split(attestations, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if len(line) > 0 && signing.IsBundle(line) {
+			bundles = append(bundles, line)
+		}
+	}
+	return bundles
+}
+
+// pushRegistries pushes the image in dir and its attestations to each registry, with the tags, redaction profile
+// and signing key of the registry. The attestations refer to the image manifest, which is the same in every registry.
+// Every tag is checked before anything is pushed, so a collision or an immutable tag doesn't leave a partial release.
+func pushRegistries(ctx context.Context, project, output, dir string, registries []hcl2nix.Registry, conf *hcl2nix.Config, data oci.TagData) error {
+	subject, err := oci.DirManifest(dir)
+	if err != nil {
+		return err
+	}
+	targets, err := planPush(registries, data)
+	if err != nil {
+		return err
+	}
+
+	clients := make(map[string]*oci.Client, len(registries))
+	for _, r := range registries {
+		clients[r.Name] = newClient(r.Insecure || insecureRegistry)
+	}
+	for _, t := range targets {
+		if t.mutable {
+			continue
+		}
+		if err := checkImmutable(ctx, clients[t.registry.Name], t.ref, subject.Digest); err != nil {
+			return fmt.Errorf("registry %s: %v", t.registry.Name, err)
+		}
+	}
+
+	for _, r := range registries {
+		fmt.Println(styles.HighlightStyle.Render(fmt.Sprintf("Pushing image to registry %s (%s)...", r.Name, r.Repository)))
+		client := clients[r.Name]
+
+		var ref *oci.Reference
+		for _, t := range targets {
+			if t.registry.Name != r.Name {
+				continue
+			}
+			ref = t.ref
+			if err := client.PushDir(ctx, dir, ref); err != nil {
+				return fmt.Errorf("failed to push to registry %s: %v", r.Name, err)
+			}
+			fmt.Println(styles.TextStyle.Render("pushed " + ref.String()))
+			if !t.mutable {
+				recordTag(project, r.Name, ref, subject.Digest)
+			}
+		}
+
+		attestations, err := registryAttestations(output, r, conf)
+		if err != nil {
+			return fmt.Errorf("failed to prepare the attestations for registry %s: %v", r.Name, err)
+		}
+		profile := r.Redact
+		if profile == "" {
+			profile = hcl2nix.RedactNone
+		}
+		_, err = client.PushReferrer(ctx, ref, subject, oci.AttestationsArtifactType, "application/vnd.in-toto+jsonl", "att", attestations,
+			map[string]string{redactionAnnotation: profile})
+		if err != nil {
+			return fmt.Errorf("failed to push the attestations to registry %s: %v", r.Name, err)
+		}
+		// cosign v2 and policy engines discover signed attestations as a referrer per sigstore bundle
+		for i, bundle := range sigstoreBundles(attestations) {
+			_, err = client.PushReferrer(ctx, ref, subject, signing.BundleMediaType, signing.BundleMediaType, fmt.Sprintf("sigstore-%d", i), bundle,
+				map[string]string{redactionAnnotation: profile})
+			if err != nil {
+				return fmt.Errorf("failed to push the sigstore bundles to registry %s: %v", r.Name, err)
+			}
+		}
+		// the SBOMs aren't redacted, registries with a redaction profile get them through the attestations only
+		if redaction(r, conf).IsZero() {
+			if err := pushPlatformSBOMs(ctx, client, ref, output, dir, subject); err != nil {
+				return fmt.Errorf("failed to push the platform SBOMs to registry %s: %v", r.Name, err)
+			}
+		}
+		fmt.Println(styles.SucessStyle.Render(fmt.Sprintf("Image and attestations pushed to registry %s", r.Name)))
+	}
+	return nil
+}
+
+// pushPlatformSBOMs attaches the SBOMs of each platform of a multi-platform image to the manifest of the platform, and
+// the index SBOM to the image index, so consumers resolving the image for a platform find its SBOM. Single platform
+// images have none.
+func pushPlatformSBOMs(ctx context.Context, client *oci.Client, ref *oci.Reference, output, dir string, index oci.Descriptor) error {
+	platforms, err := oci.DirPlatforms(dir)
+	if err != nil || len(platforms) == 0 {
+		return err
+	}
+	l, err := layout.Open(output)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range l.Index.Entries {
+		if e.Kind != layout.KindSBOM {
+			continue
+		}
+		subject, suffix, annotations := index, "", map[string]string{}
+		if e.Name == bsbom.IndexSBOMName {
+			suffix = "sbom-index"
+		}
+		for platform, d := range platforms {
+			prefix := build.PlatformSBOMPrefix + strings.ReplaceAll(platform, "/", "-") + "-"
+			if strings.HasPrefix(e.Name, prefix) {
+				subject, suffix = d, strings.ReplaceAll(strings.TrimPrefix(e.Name, prefix), ".", "-")
+				annotations[platformAnnotation] = platform
+			}
+		}
+		if suffix == "" {
+			continue
+		}
+
+		data, err := l.Read(layout.KindSBOM, e.Name)
+		if err != nil {
+			return err
+		}
+		if _, err := client.PushReferrer(ctx, ref, subject, e.MediaType, e.MediaType, suffix, data, annotations); err != nil {
+			return fmt.Errorf("failed to push %s: %v", e.Name, err)
+		}
+	}
+	return nil
+}
+
+// recordTag records the immutable tag pushed, bsf prune deletes it once the retention of bsf.hcl expires it. Failing
+// to record the tag doesn't fail the push.
+func recordTag(project, registry string, ref *oci.Reference, digest string) {
+	branch, _ := bgit.CurrentBranch()
+	err := builddb.AppendTag(&builddb.Tag{
+		SchemaVersion: builddb.SchemaVersion,
+		Project:       project,
+		Branch:        branch,
+		Time:          time.Now().UTC(),
+		Registry:      registry,
+		Repository:    ref.Registry + "/" + ref.Repository,
+		Tag:           ref.Tag,
+		Digest:        digest,
+	})
+	if err != nil {
+		fmt.Println(styles.WarnStyle.Render("warning: failed to record the tag:", err.Error()))
+	}
+}
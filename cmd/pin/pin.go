@@ -0,0 +1,279 @@
+package pin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/bom-squad/protobom/pkg/sbom"
+	"github.com/spf13/cobra"
+
+	"github.com/buildsafedev/bsf/cmd/build"
+	"github.com/buildsafedev/bsf/cmd/styles"
+	"github.com/buildsafedev/bsf/pkg/flakelock"
+	"github.com/buildsafedev/bsf/pkg/layout"
+	nixcmd "github.com/buildsafedev/bsf/pkg/nix/cmd"
+	"github.com/buildsafedev/bsf/pkg/osv"
+	"github.com/buildsafedev/bsf/pkg/pinning"
+	bsbom "github.com/buildsafedev/bsf/pkg/sbom"
+	"github.com/buildsafedev/bsf/pkg/toolchain"
+	"github.com/buildsafedev/bsf/pkg/workspace"
+)
+
+var (
+	buildDir      string
+	branches      []string
+	osvDBs        []string
+	jsonOutput    bool
+	apply, openPR bool
+)
+
+func init() {
+	PinCmd.Flags().StringVarP(&buildDir, "build-dir", "", "bsf-result", "output directory of the bsf build whose closure is scanned")
+	PinCmd.Flags().StringSliceVarP(&branches, "branch", "", nil, "nixpkgs branches to consider, the branch locked now, nixos-unstable and the two latest release branches by default")
+	PinCmd.Flags().StringSliceVarP(&osvDBs, "osv-db", "", nil, "scan offline with OSV databases fetched with bsf db fetch, e.g. osv/PyPI, instead of querying osv.dev")
+	PinCmd.Flags().BoolVarP(&jsonOutput, "json", "", false, "print the recommendations as JSON")
+	PinCmd.Flags().BoolVarP(&apply, "apply", "", false, "lock nixpkgs to the recommended revision and commit bsf/flake.lock on a new git branch")
+	PinCmd.Flags().BoolVarP(&openPR, "open-pr", "", false, "also push the branch and open a pull request with the gh CLI (implies --apply)")
+	workspace.MarkPaths(PinCmd.Flags(), "build-dir")
+}
+
+// PinCmd represents the pin command
+var PinCmd = &cobra.Command{
+	Use:   "pin",
+	Short: "recommends the nixpkgs revision to lock that resolves the most vulnerabilities of the closure",
+	Long: `scans the components of the closure of the last build against OSV, then looks up the vulnerable packages at
+	the head of the nixpkgs branch locked in bsf/flake.lock, of nixos-unstable and of the two latest release branches,
+	and scans them again at the versions these revisions have. The revisions are ranked by the vulnerabilities they
+	resolve, less the ones they introduce, then by the fewest version jumps of the vulnerable packages, to another major
+	version in particular. Packages that aren't attributes of nixpkgs keep their version.
+
+	bsf pin
+	bsf pin --branch nixos-24.05,nixos-24.11 --osv-db osv/PyPI
+
+	--apply locks nixpkgs to the recommended revision and commits bsf/flake.lock on the branch bsf/pin-nixpkgs-<rev>,
+	--open-pr also pushes it and opens a pull request listing the vulnerabilities it resolves with the gh CLI. Nothing is
+	applied when no revision resolves more vulnerabilities than it introduces.
+	`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		lock, err := flakelock.Read("bsf/flake.lock")
+		if err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+			fmt.Println(styles.HintStyle.Render("hint: run bsf init or bsf build first"))
+			os.Exit(1)
+		}
+		locked, _ := lock.InputRev("nixpkgs")
+		if len(branches) == 0 {
+			ref := ""
+			if original, ok := lock.InputOriginal("nixpkgs"); ok {
+				ref = original.Ref
+			}
+			branches = pinning.Branches(ref, time.Now())
+		}
+
+		components, err := closureComponents(buildDir)
+		if err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+			fmt.Println(styles.HintStyle.Render("hint: run bsf build first, or pass the output directory of the build with --build-dir"))
+			os.Exit(1)
+		}
+		src, err := build.OSVSource(osvDBs)
+		if err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+			os.Exit(1)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+		defer cancel()
+		current, err := osv.Scan(ctx, src, components)
+		if err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error: failed to scan the closure:", err.Error()))
+			os.Exit(1)
+		}
+		if len(current) == 0 {
+			fmt.Println(styles.SucessStyle.Render(fmt.Sprintf("No vulnerabilities in the %d scanned components, nixpkgs can stay at %s", len(components), short(locked))))
+			return
+		}
+		vulnerable := vulnerablePackages(current)
+
+		recs := make([]pinning.Recommendation, 0, len(branches))
+		gh := pinning.NewGitHub()
+		for _, branch := range branches {
+			c, err := gh.Head(ctx, branch)
+			if err != nil {
+				fmt.Println(styles.WarnStyle.Render("warning:", err.Error()))
+				continue
+			}
+			fmt.Fprintln(os.Stderr, styles.TextStyle.Render(fmt.Sprintf("Evaluating the vulnerable packages at %s (%s)...", branch, short(c.Rev))))
+			out, err := nixcmd.EvalJSONContext(ctx, pinning.VersionsExpr(c.Rev, vulnerable))
+			if err != nil {
+				fmt.Println(styles.WarnStyle.Render(fmt.Sprintf("warning: failed to evaluate nixpkgs at %s: %v", branch, err)))
+				continue
+			}
+			versions, err := pinning.ParseVersions(out)
+			if err == nil {
+				var rec pinning.Recommendation
+				rec, err = pinning.Evaluate(ctx, src, components, current, c, versions)
+				recs = append(recs, rec)
+			}
+			if err != nil {
+				fmt.Println(styles.WarnStyle.Render(fmt.Sprintf("warning: failed to scan nixpkgs at %s: %v", branch, err)))
+			}
+		}
+		pinning.Rank(recs)
+
+		if jsonOutput {
+			data, err := json.MarshalIndent(recs, "", "  ")
+			if err != nil {
+				fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+				os.Exit(1)
+			}
+			fmt.Println(string(data))
+		} else {
+			printRecommendations(len(current), locked, recs)
+		}
+
+		if !apply && !openPR {
+			return
+		}
+		if len(recs) == 0 || recs[0].Net() <= 0 || recs[0].Rev == locked {
+			fmt.Println(styles.TextStyle.Render("No revision resolves more vulnerabilities than it introduces, bsf/flake.lock is left as it is"))
+			return
+		}
+		if err := applyRecommendation(recs[0]); err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+			os.Exit(1)
+		}
+	},
+}
+
+// closureComponents returns the components of the SBOM of the build that have the package url of an OSV ecosystem
+func closureComponents(dir string) ([]osv.Component, error) {
+	data, err := layout.ReadAttestations(dir)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := bsbom.FromAttestations(data)
+	if err != nil {
+		return nil, err
+	}
+
+	components := make([]osv.Component, 0)
+	for _, node := range doc.NodeList.Nodes {
+		purl := node.Identifiers[int32(sbom.SoftwareIdentifierType_PURL)]
+		if _, _, _, ok := osv.Package(purl); !ok || node.Type != sbom.Node_PACKAGE {
+			continue
+		}
+		components = append(components, osv.Component{Node: node.Id, Name: node.Name, Version: node.Version, Purl: purl})
+	}
+	return components, nil
+}
+
+// vulnerablePackages returns the names of the packages of the findings, once
+func vulnerablePackages(findings []osv.Finding) []string {
+	seen := make(map[string]bool)
+	names := make([]string, 0)
+	for _, f := range findings {
+		if !seen[f.Component.Name] {
+			seen[f.Component.Name] = true
+			names = append(names, f.Component.Name)
+		}
+	}
+	return names
+}
+
+func printRecommendations(vulnerabilities int, locked string, recs []pinning.Recommendation) {
+	fmt.Println(styles.HighlightStyle.Render(fmt.Sprintf("%d vulnerabilities affect the closure locked at nixpkgs %s", vulnerabilities, short(locked))))
+	for i, r := range recs {
+		line := fmt.Sprintf("%-18s %s  resolves %d, introduces %d, %d left, %d version jumps", r.Branch, short(r.Rev), len(r.Resolved), len(r.Introduced), r.Remaining, len(r.Jumps))
+		if i == 0 && r.Net() > 0 {
+			fmt.Println(styles.SucessStyle.Render(line + " (recommended)"))
+		} else {
+			fmt.Println(styles.TextStyle.Render(line))
+		}
+		for _, j := range r.Jumps {
+			fmt.Println(styles.TextStyle.Render(fmt.Sprintf("    %s %s -> %s", j.Package, j.From, j.To)))
+		}
+	}
+}
+
+// applyRecommendation locks nixpkgs to the revision and commits bsf/flake.lock on a new branch, pushed with a pull
+// request opened with --open-pr
+func applyRecommendation(r pinning.Recommendation) error {
+	fmt.Println(styles.HighlightStyle.Render(fmt.Sprintf("Locking nixpkgs to %s (%s)...", short(r.Rev), r.Branch)))
+	if err := nixcmd.LockInput("nixpkgs", "github:NixOS/nixpkgs/"+r.Rev); err != nil {
+		return err
+	}
+
+	branch := "bsf/pin-nixpkgs-" + short(r.Rev)
+	title := fmt.Sprintf("Lock nixpkgs to %s of %s", short(r.Rev), r.Branch)
+	body := pullRequestBody(r)
+	lock := filepath.Join("bsf", "flake.lock")
+	// the paths after -- are committed alone, whatever else the user staged stays staged
+	for _, args := range [][]string{
+		{"checkout", "-b", branch},
+		{"add", lock},
+		{"commit", "-m", title, "-m", body, "--", lock},
+	} {
+		if err := git(args...); err != nil {
+			return err
+		}
+	}
+	fmt.Println(styles.SucessStyle.Render(fmt.Sprintf("Committed bsf/flake.lock on the branch %s", branch)))
+	if !openPR {
+		fmt.Println(styles.HintStyle.Render(fmt.Sprintf("hint: push it with git push -u origin %s, or pass --open-pr", branch)))
+		return nil
+	}
+
+	if err := git("push", "-u", "origin", branch); err != nil {
+		return err
+	}
+	out, err := toolchain.Check(exec.Command("gh", "pr", "create", "--head", branch, "--title", title, "--body", body)).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to open the pull request: %s", strings.TrimSpace(string(out)))
+	}
+	fmt.Println(styles.SucessStyle.Render("Opened " + strings.TrimSpace(string(out))))
+	return nil
+}
+
+// pullRequestBody lists the vulnerabilities the revision resolves and the version jumps
+func pullRequestBody(r pinning.Recommendation) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Locks nixpkgs to %s, the head of %s on %s.\n\nResolves:\n", r.Rev, r.Branch, r.Date.Format("2006-01-02"))
+	for _, id := range r.Resolved {
+		fmt.Fprintf(&b, "- %s\n", id)
+	}
+	if len(r.Introduced) > 0 {
+		b.WriteString("\nIntroduces:\n")
+		for _, id := range r.Introduced {
+			fmt.Fprintf(&b, "- %s\n", id)
+		}
+	}
+	b.WriteString("\nVersion jumps:\n")
+	for _, j := range r.Jumps {
+		fmt.Fprintf(&b, "- %s %s -> %s\n", j.Package, j.From, j.To)
+	}
+	return b.String()
+}
+
+func git(args ...string) error {
+	out, err := toolchain.Check(exec.Command("git", args...)).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("git %s failed: %s", args[0], strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// short returns the abbreviated revision
+func short(rev string) string {
+	if len(rev) > 7 {
+		return rev[:7]
+	}
+	return rev
+}
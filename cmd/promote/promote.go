@@ -0,0 +1,115 @@
+package promote
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/buildsafedev/bsf/cmd/completion"
+	"github.com/buildsafedev/bsf/cmd/styles"
+	"github.com/buildsafedev/bsf/pkg/builddb"
+	"github.com/buildsafedev/bsf/pkg/deadline"
+	"github.com/buildsafedev/bsf/pkg/hcl2nix"
+	nixcmd "github.com/buildsafedev/bsf/pkg/nix/cmd"
+	"github.com/buildsafedev/bsf/pkg/nix/store"
+	"github.com/buildsafedev/bsf/pkg/workspace"
+)
+
+var (
+	to, from, keyFile, compression string
+	jobs                           int
+)
+
+func init() {
+	PromoteCmd.Flags().StringVarP(&to, "to", "", "", "store or binary cache the closure is promoted to, e.g. s3://prod-cache")
+	PromoteCmd.Flags().StringVarP(&from, "from", "", "", "store or binary cache the closure is promoted from, e.g. https://staging-cache.example.com, the default store when unset")
+	PromoteCmd.Flags().StringVarP(&keyFile, "key", "k", "", "secret key file the paths are signed with in the destination, as nix-store --generate-binary-cache-key writes it")
+	PromoteCmd.Flags().StringVarP(&compression, "compression", "", "", "compression of the NARs in the destination binary cache: none, zstd or xz, nix copy's default when unset")
+	PromoteCmd.Flags().IntVarP(&jobs, "jobs", "j", 4, "number of store paths compressed and pushed at once when bsf pushes the NARs")
+	PromoteCmd.MarkFlagRequired("to")
+	workspace.MarkPaths(PromoteCmd.Flags(), "key")
+}
+
+// PromoteCmd represents the promote command
+var PromoteCmd = &cobra.Command{
+	Use:   "promote <build> --to <store>",
+	Short: "promotes the closure of a build from a store to another",
+	Long: `copies the exact closure of a build, with the NAR hashes the source store records, from a store or binary cache
+	to another with nix copy, e.g. from the staging cache to the production cache, signs its paths in the destination
+	with the production key and verifies the destination has the same NAR hashes and the signature.
+	With --compression, bsf pushes the NARs itself to http(s):// and file:// binary caches, compressed with zstd or xz as
+	modern caches serve them, several paths at once, and verifies each NAR against its hash before uploading it. The
+	NARs of a http(s):// or file:// source cache are decompressed and verified the same way.
+	The build is an output directory of bsf build, a result symlink or a store path. Promotions are recorded in the
+	build database.
+
+	bsf promote bsf-result --from https://staging-cache.example.com --to s3://prod-cache --key prod-cache.sec
+	bsf promote /nix/store/1a2b...-app-1.2.0 --from s3://staging-cache --to file:///srv/cache
+	bsf promote bsf-result --to file:///srv/cache --compression zstd --jobs 8
+	`,
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: completion.MaxArgs(1, completion.StorePaths),
+	Run: func(cmd *cobra.Command, args []string) {
+		storePath, err := resolveBuild(workspace.Resolve(args[0]))
+		if err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+			os.Exit(1)
+		}
+
+		c, err := store.ParseCompression(compression)
+		if err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+			os.Exit(1)
+		}
+		push := store.PushOptions{Jobs: jobs}
+		if compression != "" {
+			push.Compression = c
+		}
+
+		fmt.Println(styles.HighlightStyle.Render(fmt.Sprintf("Promoting %s to %s...", storePath, to)))
+		p, err := nixcmd.Promote(deadline.Context(), storePath, from, to, keyFile, push)
+		if err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+			os.Exit(1)
+		}
+
+		record := &builddb.Promotion{
+			SchemaVersion: builddb.SchemaVersion,
+			Time:          time.Now().UTC(),
+			StorePath:     p.StorePath,
+			From:          p.From,
+			To:            p.To,
+			Paths:         len(p.Paths),
+			KeyName:       p.KeyName,
+		}
+		records, _ := builddb.Records()
+		if b := builddb.Build(records, storePath); b != nil {
+			record.Project, record.Version = b.Project, b.Version
+		} else {
+			record.Project = hcl2nix.LockedAppName()
+		}
+		if err := builddb.AppendPromotion(record); err != nil {
+			fmt.Println(styles.WarnStyle.Render("warning: failed to record the promotion:", err.Error()))
+		}
+
+		msg := fmt.Sprintf("Promoted %d store paths to %s", len(p.Paths), to)
+		if p.KeyName != "" {
+			msg += ", signed with " + p.KeyName
+		}
+		fmt.Println(styles.SucessStyle.Render(msg))
+	},
+}
+
+// resolveBuild returns the store path of the build: the result of an output directory, or the store path of a result
+// symlink or store path
+func resolveBuild(build string) (string, error) {
+	if fi, err := os.Stat(build); err == nil && fi.IsDir() {
+		if _, err := os.Lstat(filepath.Join(build, "result")); err == nil {
+			return nixcmd.ResultPath(build, "result")
+		}
+	}
+	return nixcmd.ResolveStorePath(build)
+}
@@ -0,0 +1,107 @@
+package provides
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/buildsafedev/bsf/cmd/completion"
+	"github.com/buildsafedev/bsf/cmd/styles"
+	"github.com/buildsafedev/bsf/pkg/layout"
+	nixcmd "github.com/buildsafedev/bsf/pkg/nix/cmd"
+	"github.com/buildsafedev/bsf/pkg/provides"
+	"github.com/buildsafedev/bsf/pkg/workspace"
+)
+
+var (
+	output  string
+	jsonOut bool
+)
+
+func init() {
+	ProvidesCmd.Flags().StringVarP(&output, "output", "o", "bsf-result", "output directory of the build, whose provides.json index is used when it was built with --deep")
+	ProvidesCmd.Flags().BoolVarP(&jsonOut, "json", "", false, "print the matching files as JSON")
+	workspace.MarkPaths(ProvidesCmd.Flags(), "output")
+}
+
+// ProvidesCmd represents the provides command
+var ProvidesCmd = &cobra.Command{
+	Use:   "provides <file> [result]",
+	Short: "finds the store paths of the closure providing a file",
+	Long: `finds the store paths of the runtime closure providing a file, e.g. the library a binary fails to load or the
+	file a vulnerability affects. The file is a path relative to store paths, its end, or a file of a store path:
+
+	bsf provides libssl.so.3
+	bsf provides bin/python3
+	bsf provides /nix/store/...-openssl-3.0.13/lib/libssl.so.3
+
+	The index of bsf build --deep in the output directory is used when there is one, otherwise the files of the closure
+	of the result, bsf-result/result by default or the result symlink or store path given, are indexed.
+	`,
+	Args:              cobra.RangeArgs(1, 2),
+	ValidArgsFunction: completion.MaxArgs(2, completion.StorePaths),
+	Run: func(cmd *cobra.Command, args []string) {
+		var result string
+		if len(args) > 1 {
+			result = workspace.Resolve(args[1])
+		}
+		ix, err := ReadIndex(output, result)
+		if err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+			os.Exit(1)
+		}
+
+		matches := ix.Lookup(args[0])
+		if jsonOut {
+			err = json.NewEncoder(os.Stdout).Encode(matches)
+		} else if len(matches) > 0 {
+			tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			for _, m := range matches {
+				fmt.Fprintf(tw, "%s\t%s\n", m.File, m.StorePath)
+			}
+			err = tw.Flush()
+		}
+		if err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+			os.Exit(1)
+		}
+		if len(matches) == 0 {
+			if !jsonOut {
+				fmt.Println(styles.ErrorStyle.Render("error:", fmt.Sprintf("no store path of the closure provides %s", args[0])))
+			}
+			os.Exit(1)
+		}
+	},
+}
+
+// ReadIndex returns the index of the files of the closure of result. Without a result, the provides.json index of the
+// output directory is read when it has one, otherwise the closure of its result symlink is indexed.
+func ReadIndex(output, result string) (*provides.Index, error) {
+	if result == "" {
+		if l, err := layout.Open(output); err == nil {
+			if data, err := l.Read(layout.KindReport, provides.ReportName); err == nil {
+				ix := &provides.Index{}
+				if err := json.Unmarshal(data, ix); err != nil {
+					return nil, fmt.Errorf("failed to read %s of %s: %v", provides.ReportName, output, err)
+				}
+				return ix, nil
+			}
+		}
+		result = filepath.Join(output, "result")
+	}
+
+	storePath, err := nixcmd.ResolveStorePath(result)
+	if err != nil {
+		return nil, err
+	}
+	closure, err := nixcmd.GetClosure(storePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query the closure of %s: %v", result, err)
+	}
+	return provides.Build(closure, runtime.NumCPU())
+}
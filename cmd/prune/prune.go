@@ -0,0 +1,325 @@
+package prune
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/buildsafedev/bsf/cmd/styles"
+	"github.com/buildsafedev/bsf/pkg/builddb"
+	"github.com/buildsafedev/bsf/pkg/flakelock"
+	"github.com/buildsafedev/bsf/pkg/hcl2nix"
+	"github.com/buildsafedev/bsf/pkg/layout"
+	"github.com/buildsafedev/bsf/pkg/nixmeta"
+	boci "github.com/buildsafedev/bsf/pkg/oci"
+)
+
+var (
+	dryRun, registry bool
+)
+
+func init() {
+	PruneCmd.Flags().BoolVarP(&dryRun, "dry-run", "", false, "list what would be pruned without deleting anything")
+	PruneCmd.Flags().BoolVarP(&registry, "registry", "", false, "also delete the expired image tags from the registries, as registry = true in the retention block does")
+}
+
+// PruneCmd represents the prune command
+var PruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "applies the retention block of bsf.hcl to the builds, caches and image tags of the project",
+	Long: `expires the builds of the project as the retention block of bsf.hcl sets: the builds beyond the keep_builds most
+	recent of each git branch and those older than max_age. Their records are removed from the build database and their
+	SBOMs and attestations from the output directories still holding them. Interrupted upload sessions and the nixpkgs
+	metadata of other revisions older than max_age are removed from the cache.
+	With registry = true or --registry, the immutable tags bsf oci --push pushed for the expired images are deleted from
+	the registries, mutable tags such as latest are never deleted.
+
+	retention {
+	  keep_builds = 10
+	  max_age     = "90d"
+	  registry    = true
+	}
+
+	bsf prune --dry-run
+	bsf prune --registry
+	`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		data, err := os.ReadFile("bsf.hcl")
+		if err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+			os.Exit(1)
+		}
+
+		var dstErr bytes.Buffer
+		conf, err := hcl2nix.ReadConfig(data, &dstErr)
+		if err != nil {
+			fmt.Println(styles.ErrorStyle.Render(dstErr.String()))
+			os.Exit(1)
+		}
+		if conf.Retention == nil {
+			fmt.Println(styles.ErrorStyle.Render("error: bsf.hcl has no retention block"))
+			fmt.Println(styles.HintStyle.Render("hint: add a retention block with keep_builds, max_age or both"))
+			os.Exit(1)
+		}
+		if errStr := conf.Retention.Validate(); errStr != nil {
+			fmt.Println(styles.ErrorStyle.Render("error: retention block is invalid:", *errStr))
+			os.Exit(1)
+		}
+		maxAge, _ := conf.Retention.MaxAgeDuration()
+		retention := builddb.Retention{KeepBuilds: conf.Retention.KeepBuilds, MaxAge: maxAge}
+
+		project := hcl2nix.LockedAppName()
+		if project == "" {
+			fmt.Println(styles.ErrorStyle.Render("error: failed to read the app name from bsf.lock"))
+			fmt.Println(styles.HintStyle.Render("hint: run bsf build first"))
+			os.Exit(1)
+		}
+
+		now := time.Now().UTC()
+		if err := pruneBuilds(project, retention, now); err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+			os.Exit(1)
+		}
+		if err := pruneCache(maxAge, now); err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+			os.Exit(1)
+		}
+		if registry || conf.Retention.Registry {
+			if err := pruneTags(context.Background(), project, conf, retention, now); err != nil {
+				fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+				os.Exit(1)
+			}
+		}
+	},
+}
+
+// pruneBuilds removes the expired builds of the project from the build database and their SBOMs and attestations
+// from their output directories
+func pruneBuilds(project string, retention builddb.Retention, now time.Time) error {
+	records, err := builddb.Records()
+	if err != nil {
+		return err
+	}
+	expired := builddb.ExpiredBuilds(records, project, retention, now)
+
+	// a store path built again is kept with its last build
+	kept := make(map[string]bool)
+	isExpired := make(map[*builddb.Record]bool, len(expired))
+	for _, r := range expired {
+		isExpired[r] = true
+	}
+	for _, r := range records {
+		if r.Project == project && !isExpired[r] {
+			kept[r.StorePath] = true
+		}
+	}
+
+	for _, r := range expired {
+		fmt.Println(styles.TextStyle.Render(fmt.Sprintf("build %s %s of %s (%s)", r.Version, r.StorePath, r.Time.Format(time.DateOnly), branchName(r.Branch))))
+		if r.Output == "" || kept[r.StorePath] {
+			continue
+		}
+		pruned, err := pruneOutput(r.Output, r.StorePath)
+		if err != nil {
+			fmt.Println(styles.WarnStyle.Render(fmt.Sprintf("warning: failed to prune %s: %v", r.Output, err)))
+		} else if pruned > 0 {
+			fmt.Println(styles.TextStyle.Render(fmt.Sprintf("  %d SBOMs and attestations in %s", pruned, r.Output)))
+		}
+	}
+
+	if len(expired) == 0 {
+		fmt.Println(styles.TextStyle.Render("No expired builds"))
+		return nil
+	}
+	if dryRun {
+		fmt.Println(styles.HintStyle.Render(fmt.Sprintf("%d builds would be pruned", len(expired))))
+		return nil
+	}
+	if err := builddb.RemoveBuilds(expired); err != nil {
+		return fmt.Errorf("failed to remove the expired builds from the build database: %v", err)
+	}
+	fmt.Println(styles.SucessStyle.Render(fmt.Sprintf("Pruned %d builds", len(expired))))
+	return nil
+}
+
+// pruneOutput removes the SBOMs and attestations of the output directory when it still holds the build of the store
+// path, and returns how many were removed
+func pruneOutput(dir, storePath string) (int, error) {
+	if _, err := os.Stat(filepath.Join(dir, layout.IndexFile)); os.IsNotExist(err) {
+		return 0, nil
+	}
+	l, err := layout.Open(dir)
+	if err != nil {
+		return 0, err
+	}
+	// the directory was written by a later build
+	if l.Index.Result != storePath {
+		return 0, nil
+	}
+
+	pruned := 0
+	for _, e := range append([]layout.Entry(nil), l.Index.Entries...) {
+		if e.Kind == layout.KindSBOM || e.Kind == layout.KindAttestation {
+			l.Remove(e.Kind, e.Name)
+			pruned++
+		}
+	}
+	if pruned == 0 || dryRun {
+		return pruned, nil
+	}
+	if err := l.Write(); err != nil {
+		return 0, err
+	}
+	if _, err := l.Prune(); err != nil {
+		return 0, err
+	}
+	// the legacy names point to the removed entries
+	for _, legacy := range []string{layout.AttestationsName, layout.SignedAttestationsName} {
+		path := filepath.Join(dir, legacy)
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			os.Remove(path)
+		}
+	}
+	return pruned, nil
+}
+
+// pruneCache removes the interrupted upload sessions and the nixpkgs metadata of other revisions than the locked one
+// older than maxAge
+func pruneCache(maxAge time.Duration, now time.Time) error {
+	if maxAge == 0 {
+		return nil
+	}
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return err
+	}
+	metaDir, err := nixmeta.Dir()
+	if err != nil {
+		return err
+	}
+	locked := ""
+	if lock, err := flakelock.Read("bsf/flake.lock"); err == nil {
+		locked, _ = lock.InputRev("nixpkgs")
+	}
+
+	files := make([]string, 0)
+	for _, pattern := range []string{filepath.Join(cacheDir, "bsf", "uploads", "*.json"), filepath.Join(metaDir, "*.json.gz")} {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return err
+		}
+		files = append(files, matches...)
+	}
+
+	pruned := 0
+	var size int64
+	for _, f := range files {
+		if locked != "" && filepath.Base(f) == locked+".json.gz" {
+			continue
+		}
+		info, err := os.Stat(f)
+		if err != nil || now.Sub(info.ModTime()) <= maxAge {
+			continue
+		}
+		if !dryRun {
+			if err := os.Remove(f); err != nil {
+				return err
+			}
+		}
+		pruned++
+		size += info.Size()
+	}
+	if pruned > 0 {
+		verb := "Pruned"
+		if dryRun {
+			verb = "Would prune"
+		}
+		fmt.Println(styles.SucessStyle.Render(fmt.Sprintf("%s %d cache files (%d bytes)", verb, pruned, size)))
+	}
+	return nil
+}
+
+// pruneTags deletes the expired tags of the project from the registries of bsf.hcl. Tags of registries no longer in
+// bsf.hcl are kept, a tag that failed to be deleted is kept in the database to be retried. Registries that can only
+// delete manifests delete every tag of the image, so tags of images also pushed by kept builds are not deleted.
+func pruneTags(ctx context.Context, project string, conf *hcl2nix.Config, retention builddb.Retention, now time.Time) error {
+	tags, err := builddb.Tags()
+	if err != nil {
+		return err
+	}
+	expired := builddb.ExpiredTags(tags, project, retention, now)
+
+	registries := make(map[string]hcl2nix.Registry)
+	for _, artifact := range conf.OCIArtifact {
+		for _, r := range artifact.Registries {
+			registries[r.Name] = r
+		}
+	}
+	isExpired := make(map[*builddb.Tag]bool, len(expired))
+	for _, t := range expired {
+		isExpired[t] = true
+	}
+	keptDigests := make(map[string]bool)
+	for _, t := range tags {
+		if !isExpired[t] {
+			keptDigests[t.Repository+"@"+t.Digest] = true
+		}
+	}
+
+	deleted := make([]*builddb.Tag, 0, len(expired))
+	for _, t := range expired {
+		r, ok := registries[t.Registry]
+		if !ok {
+			fmt.Println(styles.WarnStyle.Render(fmt.Sprintf("warning: registry %s is not in bsf.hcl anymore, %s:%s is kept", t.Registry, t.Repository, t.Tag)))
+			continue
+		}
+		ref, err := boci.ParseReference(t.Repository + ":" + t.Tag)
+		if err != nil {
+			fmt.Println(styles.WarnStyle.Render("warning:", err.Error()))
+			continue
+		}
+		if keptDigests[t.Repository+"@"+t.Digest] {
+			fmt.Println(styles.WarnStyle.Render(fmt.Sprintf("warning: the image of %s is also pushed by a kept build, the tag is kept", ref)))
+			continue
+		}
+		fmt.Println(styles.TextStyle.Render(fmt.Sprintf("tag %s pushed %s (%s)", ref, t.Time.Format(time.DateOnly), branchName(t.Branch))))
+		if dryRun {
+			continue
+		}
+		client := boci.NewClient()
+		client.Insecure = r.Insecure
+		if err := client.DeleteTag(ctx, ref, t.Digest); err != nil {
+			fmt.Println(styles.WarnStyle.Render("warning:", err.Error()))
+			continue
+		}
+		deleted = append(deleted, t)
+	}
+
+	if len(expired) == 0 {
+		fmt.Println(styles.TextStyle.Render("No expired image tags"))
+		return nil
+	}
+	if dryRun {
+		fmt.Println(styles.HintStyle.Render(fmt.Sprintf("%d image tags would be deleted", len(expired))))
+		return nil
+	}
+	if err := builddb.RemoveTags(deleted); err != nil {
+		return fmt.Errorf("failed to remove the deleted tags from the build database: %v", err)
+	}
+	fmt.Println(styles.SucessStyle.Render(fmt.Sprintf("Deleted %d of %d expired image tags", len(deleted), len(expired))))
+	return nil
+}
+
+func branchName(branch string) string {
+	if strings.TrimSpace(branch) == "" {
+		return "no branch"
+	}
+	return "branch " + branch
+}
@@ -0,0 +1,219 @@
+package receipt
+
+import (
+	"context"
+	"crypto"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/buildsafedev/bsf/cmd/styles"
+	"github.com/buildsafedev/bsf/pkg/receipt"
+	"github.com/buildsafedev/bsf/pkg/signing"
+	"github.com/buildsafedev/bsf/pkg/version"
+)
+
+var (
+	keyPath     string
+	receiptPath string
+	offline     bool
+	vsaPath     string
+	vsaKey      string
+	verifierID  string
+	resourceURI string
+	policyURI   string
+
+	certIdentity  string
+	certIssuer    string
+	trustRootPath string
+)
+
+func init() {
+	verifyCmd.Flags().StringVarP(&keyPath, "key", "", "", "PEM encoded public key the receipt was signed with, receipts of trusted builders are checked against --certificate-identity")
+	verifyCmd.Flags().StringVarP(&certIdentity, "certificate-identity", "", "", "identity the certificate of a keyless receipt must be issued for, e.g. the workflow URI of the trusted builder")
+	verifyCmd.Flags().StringVarP(&certIssuer, "certificate-oidc-issuer", "", "", "OIDC issuer of the identity of a keyless receipt, e.g. https://token.actions.githubusercontent.com")
+	verifyCmd.Flags().StringVarP(&trustRootPath, "trust-root", "", "", "trust root to check keyless receipts against, fetched from Sigstore when not set")
+	verifyCmd.Flags().StringVarP(&receiptPath, "receipt", "", "", "path of the receipt, defaults to receipt.json in the output directory")
+	verifyCmd.Flags().BoolVarP(&offline, "offline", "", false, "do not check that the commit belongs to the pull request")
+	verifyCmd.Flags().StringVarP(&vsaPath, "vsa", "", "", "write a SLSA verification summary attestation of the result to this path, signed with --vsa-key")
+	verifyCmd.Flags().StringVarP(&vsaKey, "vsa-key", "", "", "PEM encoded private key of the verifier the VSA is signed with")
+	verifyCmd.Flags().StringVarP(&verifierID, "verifier-id", "", receipt.DefaultVerifierID, "URI identifying the verifier in the VSA")
+	verifyCmd.Flags().StringVarP(&resourceURI, "resource-uri", "", "", "URI of the verified resource in the VSA, e.g. the image repository. Defaults to the source repository")
+	verifyCmd.Flags().StringVarP(&policyURI, "policy", "", receipt.DefaultPolicy, "URI of the policy the VSA was verified against")
+
+	ReceiptCmd.AddCommand(verifyCmd)
+}
+
+// ReceiptCmd represents the receipt command
+var ReceiptCmd = &cobra.Command{
+	Use:   "receipt",
+	Short: "verifies build receipts",
+	Long: `build receipts link the source commit and pull request to the derivation, the output and image digests and the
+	digests of the SBOMs and attestations of a build, signed as one document.
+	They are written by bsf build --trusted-builder or bsf build --receipt-key.
+	`,
+	Run: func(cmd *cobra.Command, args []string) {
+		fmt.Println(styles.HintStyle.Render("hint: use bsf receipt verify"))
+		os.Exit(1)
+	},
+}
+
+var verifyCmd = &cobra.Command{
+	Use:   "verify [output directory]",
+	Short: "verifies the signature of the receipt and walks its chain",
+	Long: `verifies the signature of the receipt and checks each link of its chain: the commit belongs to the pull request,
+	the output was built by the derivation and has the recorded NAR hash, and the files of the output directory have the recorded digests.
+	With --vsa, the result is written as a SLSA verification summary attestation signed by the verifier, so consumers
+	can rely on it instead of verifying the chain again.
+
+	Receipts of trusted builders are checked against the Fulcio and Rekor trust root, and must have been signed by
+	--certificate-identity as issued by --certificate-oidc-issuer.
+
+	bsf receipt verify bsf-result --certificate-identity https://github.com/acme/app/.github/workflows/build.yml@refs/heads/main \
+		--certificate-oidc-issuer https://token.actions.githubusercontent.com
+	bsf receipt verify bsf-result --key receipt.pub
+	bsf receipt verify bsf-result --vsa bsf-result/vsa.intoto.json --vsa-key verifier.key
+	`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		dir := "bsf-result"
+		if len(args) == 1 {
+			dir = args[0]
+		}
+		if receiptPath == "" {
+			receiptPath = filepath.Join(dir, receipt.Name)
+		}
+
+		data, err := os.ReadFile(receiptPath)
+		if err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+			os.Exit(1)
+		}
+
+		var vsaSigner crypto.Signer
+		if vsaPath != "" {
+			if vsaKey == "" {
+				fmt.Println(styles.ErrorStyle.Render("error: --vsa requires the --vsa-key of the verifier"))
+				os.Exit(1)
+			}
+			vsaSigner, err = signing.ReadPrivateKey(vsaKey)
+			if err != nil {
+				fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+				os.Exit(1)
+			}
+		}
+
+		opts, err := openOptions()
+		if err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+			os.Exit(1)
+		}
+
+		r, identity, err := receipt.Open(data, opts)
+		if err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error: invalid receipt:", err.Error()))
+			os.Exit(1)
+		}
+		if identity != "" {
+			fmt.Println(styles.SucessStyle.Render("✔ signed by", identity))
+		} else {
+			fmt.Println(styles.SucessStyle.Render("✔ signed by", keyPath))
+		}
+
+		v := receipt.NewVerifier(dir)
+		if !offline {
+			v.PullRequestCommits = receipt.GitHubPullRequestCommits
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+
+		checks := v.Verify(ctx, r)
+		for _, c := range checks {
+			switch c.Status {
+			case receipt.StatusOK:
+				fmt.Println(styles.SucessStyle.Render("✔", c.Link+":", c.Detail))
+			case receipt.StatusSkipped:
+				fmt.Println(styles.WarnStyle.Render("-", c.Link+":", c.Detail))
+			default:
+				fmt.Println(styles.ErrorStyle.Render("✘", c.Link+":", c.Detail))
+			}
+		}
+
+		if vsaSigner != nil {
+			err = writeVSA(r, checks, data, identity, vsaSigner)
+			if err != nil {
+				fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+				os.Exit(1)
+			}
+			fmt.Println(styles.SucessStyle.Render("Verification summary written to", vsaPath))
+		}
+
+		if failed := receipt.Failed(checks); len(failed) > 0 {
+			fmt.Println(styles.ErrorStyle.Render(fmt.Sprintf("error: %d links of the chain do not hold", len(failed))))
+			os.Exit(1)
+		}
+		fmt.Println(styles.SucessStyle.Render(fmt.Sprintf("Receipt of %s at %s verified", r.Source.Repository, r.Source.Commit)))
+	},
+}
+
+// openOptions returns the key of --key, or the trust root and the identity keyless receipts must be signed by
+func openOptions() (receipt.OpenOptions, error) {
+	if keyPath != "" {
+		pem, err := os.ReadFile(keyPath)
+		if err != nil {
+			return receipt.OpenOptions{}, err
+		}
+		key, err := signing.ParsePublicKeyPEM(pem)
+		return receipt.OpenOptions{Key: key}, err
+	}
+
+	if certIdentity == "" || certIssuer == "" {
+		return receipt.OpenOptions{}, fmt.Errorf("pass the --key of the receipt, or the --certificate-identity and --certificate-oidc-issuer it was signed by")
+	}
+	opts := receipt.OpenOptions{Identity: signing.Identity{Subject: certIdentity, Issuer: certIssuer}}
+	if trustRootPath != "" {
+		data, err := os.ReadFile(trustRootPath)
+		if err != nil {
+			return opts, err
+		}
+		opts.TrustRoot = &signing.TrustRoot{}
+		if err := json.Unmarshal(data, opts.TrustRoot); err != nil {
+			return opts, fmt.Errorf("failed to parse trust root: %v", err)
+		}
+		return opts, opts.TrustRoot.Check(time.Now())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	root, err := signing.FetchTrustRoot(ctx, signing.DefaultFulcioURL, signing.DefaultRekorURL, time.Hour)
+	if err != nil {
+		return opts, fmt.Errorf("failed to fetch the trust root, pass one with --trust-root: %v", err)
+	}
+	opts.TrustRoot = root
+	return opts, nil
+}
+
+// writeVSA signs the summary of the verification of the receipt and writes it to vsaPath
+func writeVSA(r *receipt.Receipt, checks []receipt.Check, data []byte, identity string, signer crypto.Signer) error {
+	st := receipt.NewVSA(r, checks, receipt.VSAOptions{
+		VerifierID:  verifierID,
+		Version:     version.GetVersion(),
+		ResourceURI: resourceURI,
+		Policy:      policyURI,
+		Receipt:     data,
+		Identity:    identity,
+	})
+	signed, err := receipt.SignVSA(st, signer, nil)
+	if err != nil {
+		return err
+	}
+	out, err := json.Marshal(signed)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(vsaPath, append(out, '\n'), 0644)
+}
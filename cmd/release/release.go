@@ -0,0 +1,227 @@
+package release
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+
+	"github.com/buildsafedev/bsf/cmd/build"
+	"github.com/buildsafedev/bsf/cmd/styles"
+	bgit "github.com/buildsafedev/bsf/pkg/git"
+	"github.com/buildsafedev/bsf/pkg/release"
+	"github.com/buildsafedev/bsf/pkg/shutdown"
+	"github.com/buildsafedev/bsf/pkg/workspace"
+)
+
+var (
+	output, failOn, image string
+	registries            []string
+	channel, tag          string
+	enforceCatalog, sign  bool
+	githubRelease, resume bool
+	statePath             string
+)
+
+func init() {
+	ReleaseCmd.Flags().StringVarP(&output, "output", "o", "bsf-result", "location of the build artifacts generated")
+	ReleaseCmd.Flags().StringVarP(&failOn, "fail-on", "", "high", "fail the release when a vulnerability of this severity or higher affects the application: low, medium, high or critical")
+	ReleaseCmd.Flags().BoolVarP(&enforceCatalog, "enforce-catalog", "", false, "fail the release when components of the closure are neither approved by the catalog nor exempted in bsf.hcl")
+	ReleaseCmd.Flags().BoolVarP(&sign, "sign", "", false, "sign the attestations keyless with sigstore, as the CI workload identity, once the gates passed")
+	ReleaseCmd.Flags().StringVarP(&image, "image", "", "", "environment of the oci block of bsf.hcl to build an image of and push")
+	ReleaseCmd.Flags().StringSliceVarP(&registries, "registry", "", nil, "names of the registry blocks of the oci block to push the image to, all of them by default")
+	ReleaseCmd.Flags().StringVarP(&channel, "channel", "", "", "release channel the {channel} placeholder of the registry tags is replaced with, e.g. stable")
+	ReleaseCmd.Flags().BoolVarP(&githubRelease, "github-release", "", false, "upload the artifacts, SBOMs, provenance and checksums to the GitHub release of the tag")
+	ReleaseCmd.Flags().StringVarP(&tag, "tag", "t", "", "tag of the GitHub release, defaults to the tag pointing at HEAD")
+	ReleaseCmd.Flags().BoolVarP(&resume, "resume", "", false, "skip the steps the previous release of the same commit and arguments completed")
+	ReleaseCmd.Flags().StringVarP(&statePath, "state", "", "bsf-release.json", "file the progress of the release is recorded in")
+	workspace.MarkPaths(ReleaseCmd.Flags(), "output", "state")
+}
+
+// ReleaseCmd represents the release command
+var ReleaseCmd = &cobra.Command{
+	Use:   "release",
+	Short: "builds, scans, signs, pushes and publishes a release of the project",
+	Long: `runs the release pipeline of the project, each step once the previous one succeeded:
+
+	build    bsf build with the SBOMs and the vulnerability scan, failing on --fail-on and the policy of bsf.hcl
+	image    bsf oci of the --image environment
+	sign     signs the attestations with --sign
+	push     pushes the image to its registries
+	publish  uploads the artifacts to the GitHub release with --github-release
+
+	The gates run before anything is signed, pushed or published: a release that fails one publishes nothing. The
+	progress is recorded in the state file, a release that stopped resumes at the step that failed with --resume,
+	as long as the commit and the arguments didn't change.
+
+	bsf release --fail-on critical --sign --image prod --github-release
+	bsf release --sign --image prod --resume
+	`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		commit, err := bgit.HeadCommit()
+		if err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+			fmt.Println(styles.HintStyle.Render("hint: releases are of a git commit, commit the project first"))
+			os.Exit(1)
+		}
+		if err := bgit.Ignore(statePath); err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+			os.Exit(1)
+		}
+
+		key := releaseArgs(cmd.Flags())
+		var previous *release.State
+		if resume {
+			previous, err = release.ReadState(statePath)
+			if err != nil {
+				fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+				os.Exit(1)
+			}
+			if !previous.Resumes(commit, key) {
+				fmt.Println(styles.WarnStyle.Render("warning: no release of this commit with these arguments to resume, releasing from the start"))
+				previous = nil
+			}
+		}
+
+		bsf, err := os.Executable()
+		if err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+			os.Exit(1)
+		}
+		state := &release.State{Commit: commit, Args: key, Started: time.Now().UTC()}
+		err = release.Run(steps(append([]string{bsf}, globalArgs(cmd.InheritedFlags())...)), state, previous, func(s *release.State) error { return s.Write(statePath) }, func(name string) io.Writer {
+			if previous.Completed(name) {
+				fmt.Println(styles.TextStyle.Render(fmt.Sprintf("%s: completed by the previous release", name)))
+			} else {
+				fmt.Println(styles.HighlightStyle.Render(fmt.Sprintf("Release step %s...", name)))
+			}
+			return os.Stdout
+		})
+		if state.Steps != nil {
+			writeSummary(os.Stdout, state)
+		}
+		if err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+			if published := state.Published(); len(published) > 0 {
+				fmt.Println(styles.WarnStyle.Render(fmt.Sprintf("warning: the %s steps published before the release failed", strings.Join(published, ", "))))
+			} else {
+				fmt.Println(styles.TextStyle.Render("Nothing was published"))
+			}
+			fmt.Println(styles.HintStyle.Render("hint: bsf release --resume with the same arguments resumes at the step that failed"))
+			os.Exit(1)
+		}
+		fmt.Println(styles.SucessStyle.Render(fmt.Sprintf("Released %s, please check the %s directory", shortCommit(commit), output)))
+	},
+}
+
+// steps returns the steps of the release the flags ask for, bsf is the command line the bsf steps start with
+func steps(bsf []string) []release.Step {
+	buildArgs := []string{"build", "--output", output, "--scan", "--fail-on", failOn}
+	if enforceCatalog {
+		buildArgs = append(buildArgs, "--enforce-catalog")
+	}
+	imageOutput := output + "-" + image
+	imageArgs := []string{"oci", image, "--output", imageOutput}
+
+	s := []release.Step{{Name: "build", Run: runBSF(bsf, buildArgs...)}}
+	if image != "" {
+		s = append(s, release.Step{Name: "image", Run: runBSF(bsf, imageArgs...)})
+	}
+	if sign {
+		s = append(s, release.Step{Name: "sign", Publishes: true, Run: func(log io.Writer) error {
+			subject, err := build.SignOutput(output)
+			if err == nil {
+				fmt.Fprintln(log, styles.TextStyle.Render(fmt.Sprintf("Signed the attestations as %s", subject)))
+			}
+			return err
+		}})
+	}
+	if image != "" {
+		pushArgs := append(slices.Clone(imageArgs), "--push")
+		if len(registries) > 0 {
+			pushArgs = append(pushArgs, "--registry", strings.Join(registries, ","))
+		}
+		if channel != "" {
+			pushArgs = append(pushArgs, "--channel", channel)
+		}
+		s = append(s, release.Step{Name: "push", Publishes: true, Run: runBSF(bsf, pushArgs...)})
+	}
+	if githubRelease {
+		publishArgs := []string{"export", "github-release", "--output", output}
+		if tag != "" {
+			publishArgs = append(publishArgs, "--tag", tag)
+		}
+		s = append(s, release.Step{Name: "publish", Publishes: true, Run: runBSF(bsf, publishArgs...)})
+	}
+	return s
+}
+
+// runBSF returns a step running bsf with the arguments in its own process. When the release shuts down, the process
+// gets SIGTERM to clean up its partial outputs itself.
+func runBSF(bsf []string, args ...string) func(io.Writer) error {
+	return func(log io.Writer) error {
+		c := exec.Command(bsf[0], append(slices.Clone(bsf[1:]), args...)...)
+		c.Stdout, c.Stderr = log, log
+		if err := c.Start(); err != nil {
+			return err
+		}
+		defer shutdown.Register(func(error) { c.Process.Signal(syscall.SIGTERM) })()
+		if err := c.Wait(); err != nil {
+			return fmt.Errorf("bsf %s: %v", strings.Join(args, " "), err)
+		}
+		return nil
+	}
+}
+
+// globalArgs returns the global flags set on the release, passed on to the bsf steps. The steps already run from the
+// project root and the events of their processes aren't the ones of the release.
+func globalArgs(fs *pflag.FlagSet) []string {
+	args := make([]string, 0)
+	fs.Visit(func(f *pflag.Flag) {
+		if f.Name != "chdir" && f.Name != "events" {
+			args = append(args, "--"+f.Name+"="+f.Value.String())
+		}
+	})
+	return args
+}
+
+// releaseArgs returns the flags set on the release, but the ones that don't change what is released
+func releaseArgs(fs *pflag.FlagSet) []string {
+	args := make([]string, 0)
+	fs.Visit(func(f *pflag.Flag) {
+		if f.Name != "resume" && f.Name != "state" {
+			args = append(args, "--"+f.Name+"="+f.Value.String())
+		}
+	})
+	return args
+}
+
+// writeSummary writes the table of the steps of the release
+func writeSummary(w io.Writer, state *release.State) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "STEP\tSTATUS\tDURATION\tERROR")
+	for _, r := range state.Steps {
+		status := r.Status
+		if r.Resumed {
+			status += " (resumed)"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", r.Name, status, r.Duration, r.Error)
+	}
+	tw.Flush()
+}
+
+func shortCommit(commit string) string {
+	if len(commit) > 12 {
+		return commit[:12]
+	}
+	return commit
+}
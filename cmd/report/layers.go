@@ -0,0 +1,143 @@
+package report
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/buildsafedev/bsf/cmd/styles"
+	"github.com/buildsafedev/bsf/pkg/imagesize"
+	"github.com/buildsafedev/bsf/pkg/layout"
+	"github.com/buildsafedev/bsf/pkg/workspace"
+)
+
+var (
+	buildDir string
+	top      int
+)
+
+func init() {
+	layersCmd.Flags().StringVarP(&format, "format", "f", FormatTable, "format of the report: table, json or csv")
+	layersCmd.Flags().StringVarP(&buildDir, "build-dir", "", "bsf-result", "output directory of the bsf build of the image")
+	layersCmd.Flags().IntVarP(&top, "top", "n", 10, "number of largest components listed per layer in the table, 0 for all of them")
+	workspace.MarkPaths(layersCmd.Flags(), "build-dir")
+
+	ReportCmd.AddCommand(layersCmd)
+}
+
+var layersCmd = &cobra.Command{
+	Use:   "layers",
+	Short: "reports which components of the closure take the size of the layers of the image",
+	Long: `reports, for each layer of the image the last build produced, the bytes its components take in the
+	compressed layer pulled and in its tar archive, then the components across the layers. The NAR size of a component
+	doesn't tell how much it adds to pull times: a compressible component may take a fraction of a smaller one.
+
+	The compressed bytes of gzip layers are measured, the ones of zstd layers estimated from their share of the
+	archive. nix2container layers aren't built until the image is copied, their components are estimated from their
+	NAR size.
+
+	bsf report layers
+	bsf report layers --top 0 --format csv > layers.csv
+	`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if format != FormatTable && format != FormatJSON && format != FormatCSV {
+			fmt.Println(styles.ErrorStyle.Render("error:", fmt.Sprintf("unknown format %q, use table, json or csv", format)))
+			os.Exit(1)
+		}
+
+		r, err := readLayers(buildDir)
+		if err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+			fmt.Println(styles.HintStyle.Render("hint: layers are reported for builds of container images, pass the output directory of the build with --build-dir"))
+			os.Exit(1)
+		}
+
+		switch format {
+		case FormatJSON:
+			err = json.NewEncoder(os.Stdout).Encode(r)
+		case FormatCSV:
+			err = writeLayersCSV(os.Stdout, r)
+		default:
+			err = writeLayersTable(os.Stdout, r, top)
+		}
+		if err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+			os.Exit(1)
+		}
+	},
+}
+
+func readLayers(dir string) (*imagesize.Report, error) {
+	l, err := layout.Open(dir)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := l.Find(layout.KindReport, imagesize.ReportName); !ok {
+		return nil, fmt.Errorf("%s has no %s", dir, imagesize.ReportName)
+	}
+	data, err := l.Read(layout.KindReport, imagesize.ReportName)
+	if err != nil {
+		return nil, err
+	}
+	r := &imagesize.Report{}
+	if err := json.Unmarshal(data, r); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", imagesize.ReportName, err)
+	}
+	return r, nil
+}
+
+// writeLayersTable writes the largest components of each layer, then of the image, the others summed on one line
+func writeLayersTable(w io.Writer, r *imagesize.Report, top int) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for i, l := range r.Layers {
+		estimated := ""
+		if l.Estimated {
+			estimated = " (estimated)"
+		}
+		fmt.Fprintf(tw, "layer %d  %.12s\t%s\t%s%s\n", i+1, l.Digest, formatSize(l.Size), formatSize(l.UncompressedSize), estimated)
+		var otherSize, otherCompressed int64
+		others := 0
+		for j, c := range l.Components {
+			if top > 0 && j >= top {
+				otherSize += c.Size
+				otherCompressed += c.CompressedSize
+				others++
+				continue
+			}
+			fmt.Fprintf(tw, "  %s\t%s\t%s\n", c.Name, formatSize(c.CompressedSize), formatSize(c.Size))
+		}
+		if others > 0 {
+			fmt.Fprintf(tw, "  %d others\t%s\t%s\n", others, formatSize(otherCompressed), formatSize(otherSize))
+		}
+	}
+
+	fmt.Fprintf(tw, "\nimage\tcompressed\tuncompressed\n")
+	for j, c := range r.Components {
+		if top > 0 && j >= top {
+			break
+		}
+		fmt.Fprintf(tw, "  %s\t%s\t%s\n", c.Name, formatSize(c.CompressedSize), formatSize(c.Size))
+	}
+	return tw.Flush()
+}
+
+// writeLayersCSV writes a row per component of each layer
+func writeLayersCSV(w io.Writer, r *imagesize.Report) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"layer", "digest", "store_path", "name", "files", "compressed_size", "size", "estimated"})
+	for i, l := range r.Layers {
+		for _, c := range l.Components {
+			cw.Write([]string{strconv.Itoa(i + 1), l.Digest, c.StorePath, c.Name, strconv.Itoa(c.Files),
+				strconv.FormatInt(c.CompressedSize, 10), strconv.FormatInt(c.Size, 10), strconv.FormatBool(l.Estimated)})
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
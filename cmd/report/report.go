@@ -0,0 +1,283 @@
+package report
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/buildsafedev/bsf/cmd/styles"
+	"github.com/buildsafedev/bsf/pkg/builddb"
+)
+
+// Formats of the trends
+const (
+	FormatTable = "table"
+	FormatJSON  = "json"
+	FormatCSV   = "csv"
+)
+
+var (
+	format, project string
+	builder         string
+	limit           int
+)
+
+func init() {
+	trendsCmd.Flags().StringVarP(&format, "format", "f", FormatTable, "format of the trends: table, json or csv")
+	trendsCmd.Flags().StringVarP(&project, "project", "p", "", "only report the builds of this project, as named in bsf.hcl")
+	trendsCmd.Flags().StringVarP(&builder, "builder", "", "", "only report the builds of the builder with this fingerprint, or a prefix of it, as the csv format lists them")
+	trendsCmd.Flags().IntVarP(&limit, "limit", "n", 30, "number of most recent builds reported per project, 0 for all of them")
+
+	ReportCmd.AddCommand(trendsCmd)
+}
+
+// ReportCmd represents the report command
+var ReportCmd = &cobra.Command{
+	Use:   "report",
+	Short: "reports on the builds recorded in the build database",
+	Long: `reports on the builds bsf build recorded in the local build database, and on the layers of the image and
+	the schedule of the derivations of the last build. The records of the builds can be exported, imported and
+	synced with a shared location to report on the builds of a whole team.
+
+	bsf report trends
+	bsf report trends --project my-app --format csv > trends.csv
+	bsf report sync --location s3://acme-builds/bsf
+	bsf report layers
+	bsf report schedule
+	`,
+	Run: func(cmd *cobra.Command, args []string) {
+		fmt.Println(styles.HintStyle.Render("hint: use bsf report with a subcommand"))
+		os.Exit(1)
+	},
+}
+
+var trendsCmd = &cobra.Command{
+	Use:   "trends",
+	Short: "reports how the closures of the projects evolve across builds",
+	Long: `reports, for each project, the closure size, number of components, open vulnerabilities, licenses and
+	unfree packages of its last builds. The table shows them as sparklines, oldest build first, JSON and CSV list
+	every build with the fingerprint of its builder, the host and nix installation that built. Open vulnerabilities
+	are only known for builds with --scan.
+
+	bsf report trends --limit 10
+	bsf report trends --format json
+	bsf report trends --builder 3f2a9c --format csv
+	`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if format != FormatTable && format != FormatJSON && format != FormatCSV {
+			fmt.Println(styles.ErrorStyle.Render("error:", fmt.Sprintf("unknown format %q, use table, json or csv", format)))
+			os.Exit(1)
+		}
+
+		records, err := builddb.Records()
+		if err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+			os.Exit(1)
+		}
+		if builder != "" {
+			records = filterBuilder(records, builder)
+		}
+		series := builddb.Trends(records, limit)
+		if project != "" {
+			series = filterProject(series, project)
+		}
+		if len(series) == 0 {
+			fmt.Println(styles.HintStyle.Render("hint: no builds recorded yet, bsf build records them"))
+			os.Exit(1)
+		}
+
+		switch format {
+		case FormatJSON:
+			err = json.NewEncoder(os.Stdout).Encode(series)
+		case FormatCSV:
+			err = writeCSV(os.Stdout, series)
+		default:
+			err = writeTable(os.Stdout, series)
+		}
+		if err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+			os.Exit(1)
+		}
+	},
+}
+
+func filterProject(series []builddb.Series, project string) []builddb.Series {
+	filtered := make([]builddb.Series, 0)
+	for _, s := range series {
+		if s.Project == project {
+			filtered = append(filtered, s)
+		}
+	}
+	return filtered
+}
+
+// filterBuilder returns the records of the builds of the builder whose fingerprint starts with prefix
+func filterBuilder(records []*builddb.Record, prefix string) []*builddb.Record {
+	filtered := make([]*builddb.Record, 0)
+	for _, r := range records {
+		if r.Builder != nil && strings.HasPrefix(r.Builder.ID, prefix) {
+			filtered = append(filtered, r)
+		}
+	}
+	return filtered
+}
+
+// metric is a measure of the builds reported as a trend
+type metric struct {
+	name string
+	// value returns the measure of the build, false when the build didn't measure it
+	value  func(r *builddb.Record) (int64, bool)
+	format func(v int64) string
+}
+
+var metrics = []metric{
+	{"closure size", func(r *builddb.Record) (int64, bool) { return r.ClosureSize, true }, formatSize},
+	{"components", func(r *builddb.Record) (int64, bool) { return int64(r.Components), true }, formatInt},
+	{"open CVEs", func(r *builddb.Record) (int64, bool) {
+		if r.OpenCVEs == nil {
+			return 0, false
+		}
+		return int64(*r.OpenCVEs), true
+	}, formatInt},
+	{"licenses", func(r *builddb.Record) (int64, bool) { return int64(r.Licenses), true }, formatInt},
+	{"unfree packages", func(r *builddb.Record) (int64, bool) { return int64(r.Unfree), true }, formatInt},
+}
+
+// writeTable writes the trend of each metric of each project, from its first to its last reported build
+func writeTable(w io.Writer, series []builddb.Series) error {
+	for i, s := range series {
+		first, last := s.Records[0], s.Records[len(s.Records)-1]
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		name := s.Project
+		if s.Variant != "" {
+			name += " (" + s.Variant + ")"
+		}
+		fmt.Fprintln(w, styles.HighlightStyle.Render(fmt.Sprintf("%s: %d builds, %s (%s) to %s (%s)", name, len(s.Records),
+			first.Version, first.Time.Format(time.DateOnly), last.Version, last.Time.Format(time.DateOnly))))
+
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "METRIC\tFIRST\tLAST\tCHANGE\tTREND")
+		for _, m := range metrics {
+			values, known := make([]int64, len(s.Records)), make([]bool, len(s.Records))
+			for j, r := range s.Records {
+				values[j], known[j] = m.value(r)
+			}
+			firstV, lastV, ok := firstLast(values, known)
+			if !ok {
+				fmt.Fprintf(tw, "%s\t-\t-\t-\t\n", m.name)
+				continue
+			}
+			change := m.format(lastV - firstV)
+			if lastV >= firstV {
+				change = "+" + change
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", m.name, m.format(firstV), m.format(lastV), change, sparkline(values, known))
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// firstLast returns the first and last known values
+func firstLast(values []int64, known []bool) (int64, int64, bool) {
+	first, last := -1, -1
+	for i := range values {
+		if !known[i] {
+			continue
+		}
+		if first < 0 {
+			first = i
+		}
+		last = i
+	}
+	if first < 0 {
+		return 0, 0, false
+	}
+	return values[first], values[last], true
+}
+
+var sparks = []rune("▁▂▃▄▅▆▇█")
+
+// sparkline draws the values scaled between their minimum and maximum, unknown values are blank
+func sparkline(values []int64, known []bool) string {
+	var lo, hi int64
+	seen := false
+	for i, v := range values {
+		if !known[i] {
+			continue
+		}
+		if !seen || v < lo {
+			lo = v
+		}
+		if !seen || v > hi {
+			hi = v
+		}
+		seen = true
+	}
+
+	var sb strings.Builder
+	for i, v := range values {
+		switch {
+		case !known[i]:
+			sb.WriteRune(' ')
+		case hi == lo:
+			sb.WriteRune(sparks[len(sparks)/2-1])
+		default:
+			sb.WriteRune(sparks[int((v-lo)*int64(len(sparks)-1)/(hi-lo))])
+		}
+	}
+	return strings.TrimRight(sb.String(), " ")
+}
+
+// writeCSV writes a row per build, the open CVEs of builds without --scan are empty
+func writeCSV(w io.Writer, series []builddb.Series) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"project", "version", "time", "store_path", "closure_size", "components", "open_cves", "licenses", "unfree", "builder"})
+	for _, s := range series {
+		for _, r := range s.Records {
+			cves := ""
+			if r.OpenCVEs != nil {
+				cves = strconv.Itoa(*r.OpenCVEs)
+			}
+			cw.Write([]string{r.Project, r.Version, r.Time.Format(time.RFC3339), r.StorePath, strconv.FormatInt(r.ClosureSize, 10),
+				strconv.Itoa(r.Components), cves, strconv.Itoa(r.Licenses), strconv.Itoa(r.Unfree), r.Builder.Short()})
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func formatInt(v int64) string {
+	return strconv.FormatInt(v, 10)
+}
+
+// formatSize formats a number of bytes with a binary unit, e.g. 12.3MiB
+func formatSize(v int64) string {
+	sign := ""
+	if v < 0 {
+		sign, v = "-", -v
+	}
+	units := []string{"B", "KiB", "MiB", "GiB", "TiB"}
+	f, u := float64(v), 0
+	for f >= 1024 && u < len(units)-1 {
+		f /= 1024
+		u++
+	}
+	if u == 0 {
+		return fmt.Sprintf("%s%d%s", sign, v, units[u])
+	}
+	return fmt.Sprintf("%s%.1f%s", sign, f, units[u])
+}
@@ -0,0 +1,120 @@
+package report
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/buildsafedev/bsf/pkg/builddb"
+	"github.com/buildsafedev/bsf/pkg/buildhost"
+	"github.com/buildsafedev/bsf/pkg/imagesize"
+	"github.com/buildsafedev/bsf/pkg/schedule"
+)
+
+func TestSparkline(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []int64
+		known  []bool
+		want   string
+	}{
+		{name: "rising", values: []int64{0, 7, 14}, known: []bool{true, true, true}, want: "▁▄█"},
+		{name: "flat", values: []int64{3, 3}, known: []bool{true, true}, want: "▄▄"},
+		{name: "unknown values", values: []int64{0, 0, 10, 0}, known: []bool{true, false, true, false}, want: "▁ █"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sparkline(tt.values, tt.known); got != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestFormatSize(t *testing.T) {
+	tests := map[int64]string{
+		512:            "512B",
+		1536:           "1.5KiB",
+		-3 * (1 << 20): "-3.0MiB",
+	}
+	for v, want := range tests {
+		if got := formatSize(v); got != want {
+			t.Errorf("formatSize(%d): expected %q, got %q", v, want, got)
+		}
+	}
+}
+
+func TestWriteCSV(t *testing.T) {
+	cves := 2
+	series := []builddb.Series{{Project: "app", Records: []*builddb.Record{
+		{Project: "app", Version: "1.0", Time: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), Components: 10, ClosureSize: 100},
+		{Project: "app", Version: "1.1", Time: time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC), Components: 11, ClosureSize: 120, OpenCVEs: &cves,
+			Builder: &buildhost.Fingerprint{ID: "3f2a9c0d41e7b85a6c"}},
+	}}}
+
+	var buf bytes.Buffer
+	if err := writeCSV(&buf, series); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	want := []string{
+		"project,version,time,store_path,closure_size,components,open_cves,licenses,unfree,builder",
+		"app,1.0,2024-01-01T00:00:00Z,,100,10,,0,0,",
+		"app,1.1,2024-01-02T00:00:00Z,,120,11,2,0,0,3f2a9c0d41e7",
+	}
+	if len(lines) != len(want) {
+		t.Fatalf("expected %d lines, got %q", len(want), lines)
+	}
+	for i := range want {
+		if lines[i] != want[i] {
+			t.Errorf("line %d: expected %q, got %q", i, want[i], lines[i])
+		}
+	}
+}
+
+func TestWriteLayersTable(t *testing.T) {
+	r := imagesize.NewReport([]imagesize.Layer{{
+		Digest: "0123456789abcdef", Size: 3 << 20, UncompressedSize: 8 << 20,
+		Components: []imagesize.Component{
+			{StorePath: "/nix/store/a-openssl-3.0.13", Name: "openssl-3.0.13", Size: 5 << 20, CompressedSize: 2 << 20},
+			{StorePath: "/nix/store/b-tzdata-2024a", Name: "tzdata-2024a", Size: 2 << 20, CompressedSize: 512 << 10},
+			{StorePath: imagesize.ImageFiles, Name: "(image files)", Size: 1 << 20, CompressedSize: 512 << 10},
+		},
+	}})
+
+	var buf bytes.Buffer
+	if err := writeLayersTable(&buf, r, 1); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, want := range []string{"layer 1  0123456789ab", "openssl-3.0.13  2.0MiB", "2 others", "1.0MiB"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q in the table:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "tzdata") {
+		t.Errorf("expected tzdata summed with the others:\n%s", out)
+	}
+}
+
+func TestWriteGantt(t *testing.T) {
+	r := &schedule.Report{
+		Summary:      schedule.Summary{Built: 2, Work: 90 * time.Second, CriticalPath: 60 * time.Second, Wall: 60 * time.Second, Parallelism: 1.5, Builders: 2},
+		CriticalPath: []string{"b-openssl.drv"},
+		Hints: []schedule.Task{
+			{Drv: "b-openssl.drv", Name: "openssl", Duration: 60 * time.Second, End: 60 * time.Second, Critical: true},
+			{Drv: "a-zlib.drv", Name: "zlib", Duration: 30 * time.Second, End: 30 * time.Second},
+		},
+	}
+	var buf bytes.Buffer
+	if err := writeGantt(&buf, r, 0); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, want := range []string{"openssl  1m0s  |" + strings.Repeat("█", ganttWidth) + "|", "zlib     30s   |" + strings.Repeat("▒", ganttWidth/2), "more than 2 builders"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q in the chart:\n%s", want, out)
+		}
+	}
+}
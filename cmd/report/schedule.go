@@ -0,0 +1,162 @@
+package report
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/buildsafedev/bsf/cmd/styles"
+	"github.com/buildsafedev/bsf/pkg/layout"
+	"github.com/buildsafedev/bsf/pkg/schedule"
+	"github.com/buildsafedev/bsf/pkg/workspace"
+)
+
+// ganttWidth is the number of columns the timeline of the Gantt chart spans
+const ganttWidth = 60
+
+func init() {
+	scheduleCmd.Flags().StringVarP(&format, "format", "f", FormatTable, "format of the report: table, json or csv. json and csv export the scheduling hints")
+	scheduleCmd.Flags().StringVarP(&buildDir, "build-dir", "", "bsf-result", "output directory of the bsf build with --critical-path")
+	scheduleCmd.Flags().IntVarP(&top, "top", "n", 30, "number of derivations charted, the longest first, 0 for all of them")
+	workspace.MarkPaths(scheduleCmd.Flags(), "build-dir")
+
+	ReportCmd.AddCommand(scheduleCmd)
+}
+
+var scheduleCmd = &cobra.Command{
+	Use:   "schedule",
+	Short: "reports the critical path and parallelism of the last build, as a Gantt chart",
+	Long: `reports how the derivations of the last bsf build --critical-path built: a Gantt chart of the builds, the
+	ones of the critical path marked, and how many derivations built at once against how many could with unlimited
+	builders. The chart lists the derivations that took the longest, in the order they started.
+
+	json and csv export the scheduling hints, the derivations built by priority, the length of the longest chain of
+	builds they start. Build farms that start the derivations with the highest priority first finish soonest.
+
+	bsf report schedule
+	bsf report schedule --format csv > hints.csv
+	`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if format != FormatTable && format != FormatJSON && format != FormatCSV {
+			fmt.Println(styles.ErrorStyle.Render("error:", fmt.Sprintf("unknown format %q, use table, json or csv", format)))
+			os.Exit(1)
+		}
+
+		r, err := readSchedule(buildDir)
+		if err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+			fmt.Println(styles.HintStyle.Render("hint: build with bsf build --critical-path, or pass the output directory of the build with --build-dir"))
+			os.Exit(1)
+		}
+
+		switch format {
+		case FormatJSON:
+			err = json.NewEncoder(os.Stdout).Encode(r.Hints)
+		case FormatCSV:
+			err = writeHintsCSV(os.Stdout, r)
+		default:
+			err = writeGantt(os.Stdout, r, top)
+		}
+		if err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+			os.Exit(1)
+		}
+	},
+}
+
+func readSchedule(dir string) (*schedule.Report, error) {
+	l, err := layout.Open(dir)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := l.Find(layout.KindReport, schedule.ReportName); !ok {
+		return nil, fmt.Errorf("%s has no %s", dir, schedule.ReportName)
+	}
+	data, err := l.Read(layout.KindReport, schedule.ReportName)
+	if err != nil {
+		return nil, err
+	}
+	r := &schedule.Report{}
+	if err := json.Unmarshal(data, r); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", schedule.ReportName, err)
+	}
+	return r, nil
+}
+
+// writeGantt charts the longest builds in the order they started, the critical ones drawn with █, then sums up the
+// schedule
+func writeGantt(w io.Writer, r *schedule.Report, top int) error {
+	s := r.Summary
+	tasks := append([]schedule.Task(nil), r.Hints...)
+	sort.SliceStable(tasks, func(i, j int) bool { return tasks[i].Duration > tasks[j].Duration })
+	if top > 0 && len(tasks) > top {
+		tasks = tasks[:top]
+	}
+	sort.SliceStable(tasks, func(i, j int) bool { return tasks[i].Start < tasks[j].Start })
+
+	var span time.Duration
+	for _, t := range r.Hints {
+		if t.End > span {
+			span = t.End
+		}
+	}
+	column := func(d time.Duration) int {
+		if span == 0 {
+			return 0
+		}
+		return int(int64(d) * ganttWidth / int64(span))
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, t := range tasks {
+		start, end := column(t.Start), column(t.End)
+		if end == start {
+			end++
+		}
+		bar := "▒"
+		if t.Critical {
+			bar = "█"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t|%s%s%s|\n", t.Name, formatDuration(t.Duration), strings.Repeat(" ", start),
+			strings.Repeat(bar, end-start), strings.Repeat(" ", max(ganttWidth-end, 0)))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "\nbuilt %d derivations in %s, %d substituted or in the store\n", s.Built, formatDuration(s.Wall), s.Cached)
+	fmt.Fprintf(w, "work %s, critical path %s over %d derivations\n", formatDuration(s.Work), formatDuration(s.CriticalPath), len(r.CriticalPath))
+	fmt.Fprintf(w, "parallelism %.1f on average, %d at most, %d during the build: more than %d builders wouldn't build faster\n",
+		s.Parallelism, s.PeakParallelism, s.PeakRunning, s.Builders)
+	return nil
+}
+
+// writeHintsCSV writes a row per derivation built, by priority
+func writeHintsCSV(w io.Writer, r *schedule.Report) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"drv", "name", "duration_seconds", "priority_seconds", "earliest_start_seconds", "slack_seconds", "critical"})
+	seconds := func(d time.Duration) string { return strconv.FormatFloat(d.Seconds(), 'f', 3, 64) }
+	for _, t := range r.Hints {
+		cw.Write([]string{t.Drv, t.Name, seconds(t.Duration), seconds(t.Priority), seconds(t.EarliestStart), seconds(t.Slack), strconv.FormatBool(t.Critical)})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// formatDuration formats a duration to the second, or to the millisecond under a second
+func formatDuration(d time.Duration) string {
+	if d < time.Second {
+		return d.Round(time.Millisecond).String()
+	}
+	return d.Round(time.Second).String()
+}
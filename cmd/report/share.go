@@ -0,0 +1,166 @@
+package report
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/buildsafedev/bsf/cmd/configure"
+	"github.com/buildsafedev/bsf/cmd/styles"
+	"github.com/buildsafedev/bsf/pkg/builddb"
+)
+
+var (
+	output, location string
+	since            time.Duration
+)
+
+func init() {
+	exportCmd.Flags().StringVarP(&output, "output", "o", "", "file the records are written to, standard output by default")
+	exportCmd.Flags().StringVarP(&project, "project", "p", "", "only export the builds of this project, as named in bsf.hcl")
+	exportCmd.Flags().DurationVarP(&since, "since", "", 0, "only export the builds of this last duration, e.g. 720h")
+	syncCmd.Flags().StringVarP(&location, "location", "l", "", "shared location of the records (a directory, https:// or s3://), defaults to build_records in ~/.bsf.json")
+
+	ReportCmd.AddCommand(exportCmd)
+	ReportCmd.AddCommand(importCmd)
+	ReportCmd.AddCommand(syncCmd)
+}
+
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "exports the records of the build database so another machine can import them",
+	Long: `exports the records of the build database as JSON lines, each with its origin, the user and host it was
+	exported from. The build database is itself the JSON lines file bsf/builds.jsonl of the user cache directory, there is no other
+	store to export. The output directories of the builds are left out, they only exist on this machine.
+
+	bsf report export --since 168h -o builds-$(hostname).jsonl
+	`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		records, err := builddb.Records()
+		if err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+			os.Exit(1)
+		}
+		if project != "" {
+			records = filterRecords(records, project)
+		}
+		if since > 0 {
+			records = builddb.Since(records, time.Now().Add(-since))
+		}
+
+		var w io.Writer = os.Stdout
+		if output != "" {
+			f, err := os.Create(output)
+			if err != nil {
+				fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+				os.Exit(1)
+			}
+			defer f.Close()
+			w = f
+		}
+		if err := builddb.Export(w, records, builddb.LocalOrigin()); err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+			os.Exit(1)
+		}
+		if output != "" {
+			fmt.Fprintln(os.Stderr, styles.SucessStyle.Render(fmt.Sprintf("exported %d builds to %s", len(records), output)))
+		}
+	},
+}
+
+var importCmd = &cobra.Command{
+	Use:   "import",
+	Short: "imports the records other machines exported in the build database",
+	Long: `imports the records bsf report export wrote on other machines, - reads them from standard input. The builds
+	already recorded are skipped, so exports can be imported again as they grow. bsf report trends then reports the
+	builds of every machine, their origin tells them apart.
+
+	bsf report import builds-*.jsonl
+	`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		total := 0
+		for _, name := range args {
+			records, err := readExport(name)
+			if err != nil {
+				fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+				os.Exit(1)
+			}
+			n, err := builddb.Import(records)
+			total += n
+			if err != nil {
+				fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+				os.Exit(1)
+			}
+		}
+		fmt.Println(styles.SucessStyle.Render(fmt.Sprintf("imported %d builds", total)))
+	},
+}
+
+var syncCmd = &cobra.Command{
+	Use:   "sync",
+	Short: "merges the build database with the records of the team at a shared location",
+	Long: `imports the records of the team at the shared location, then writes the records of the build database
+	back to it, so every machine syncing, developers' and CI's, builds one dataset of the builds of the team.
+	Locations are directories, e.g. a network share, https:// URLs, read with GET and written with PUT, or s3:// URLs.
+
+	bsf report sync --location s3://acme-builds/bsf
+	`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+		defer cancel()
+
+		imported, err := builddb.Sync(ctx, recordsLocation(), builddb.LocalOrigin())
+		if err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+			os.Exit(1)
+		}
+		fmt.Println(styles.SucessStyle.Render(fmt.Sprintf("imported %d builds", imported)))
+	},
+}
+
+func readExport(name string) ([]*builddb.Record, error) {
+	if name == "-" {
+		return builddb.ReadExport(os.Stdin)
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return builddb.ReadExport(f)
+}
+
+func filterRecords(records []*builddb.Record, project string) []*builddb.Record {
+	kept := make([]*builddb.Record, 0, len(records))
+	for _, r := range records {
+		if r.Project == project {
+			kept = append(kept, r)
+		}
+	}
+	return kept
+}
+
+func recordsLocation() string {
+	if location != "" {
+		return location
+	}
+
+	conf, err := configure.PreCheckConf()
+	if err != nil {
+		fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+		os.Exit(1)
+	}
+	if conf.BuildRecords == "" {
+		fmt.Println(styles.ErrorStyle.Render("error: no shared location of the build records configured"))
+		fmt.Println(styles.HintStyle.Render("hint: pass --location or set build_records in ~/.bsf.json"))
+		os.Exit(1)
+	}
+	return conf.BuildRecords
+}
@@ -0,0 +1,127 @@
+package sbom
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/buildsafedev/bsf/cmd/styles"
+	bsbom "github.com/buildsafedev/bsf/pkg/sbom"
+)
+
+var (
+	to, output string
+)
+
+// SBOMCmd represents the sbom command
+var SBOMCmd = &cobra.Command{
+	Use:   "sbom",
+	Short: "perform SBOM ops",
+	Long:  `used to perform various operations on the SBOMs generated by bsf`,
+	Run: func(cmd *cobra.Command, args []string) {
+		fmt.Println(styles.HintStyle.Render("hint: use bsf sbom with a subcomand"))
+		os.Exit(1)
+	},
+}
+
+var convertCmd = &cobra.Command{
+	Use:   "convert",
+	Short: "converts a SBOM between SPDX, CycloneDX and protobom",
+	Long: `
+	Converts a SBOM, or the SBOM of an attestations file, to SPDX, CycloneDX or the protobom protocol buffers
+	serialization. The store paths, NAR hashes, comments and relationships of the components are kept, CycloneDX
+	stores them in properties.
+
+	bsf sbom convert <path-to-file> --to cyclonedx-json
+	bsf sbom convert <path-to-file> --to spdx-json --output <output file>
+	bsf sbom convert <path-to-file> --to protobom --output sbom.pb
+	`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		format, err := bsbom.ParseFormat(to)
+		if err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+			os.Exit(1)
+		}
+
+		data, err := os.ReadFile(args[0])
+		if err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+			os.Exit(1)
+		}
+		if !bsbom.IsDocument(data) {
+			data, err = bsbom.PredicateFromAttestations(data)
+			if err != nil {
+				fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+				os.Exit(1)
+			}
+		}
+
+		converted, err := bsbom.Convert(data, format)
+		if err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error converting SBOM:", err.Error()))
+			os.Exit(1)
+		}
+
+		if output == "" {
+			fmt.Println(string(converted))
+			return
+		}
+		if err := os.WriteFile(output, converted, 0644); err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+			os.Exit(1)
+		}
+		fmt.Println(styles.SucessStyle.Render(fmt.Sprintf("SBOM written to %s", output)))
+	},
+}
+
+var unmappedCmd = &cobra.Command{
+	Use:   "unmapped",
+	Short: "lists the components of a SBOM without an upstream name",
+	Long: `
+	Lists the components of a SBOM, or of the SBOM of an attestations file, that only have a nix package url and no CPE.
+	Scanners can't match them against the advisories of their ecosystem, alias blocks in bsf.hcl map them:
+
+	alias "python3.11-mylib" {
+		name = "mylib"
+		type = "pypi"
+	}
+
+	bsf sbom unmapped bsf-result/attestations.intoto.jsonl
+	`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		data, err := os.ReadFile(args[0])
+		if err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+			os.Exit(1)
+		}
+		if !bsbom.IsDocument(data) {
+			data, err = bsbom.PredicateFromAttestations(data)
+			if err != nil {
+				fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+				os.Exit(1)
+			}
+		}
+		doc, err := bsbom.Parse(data)
+		if err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error parsing SBOM:", err.Error()))
+			os.Exit(1)
+		}
+
+		unmapped := bsbom.Unmapped(doc)
+		for _, c := range unmapped {
+			fmt.Println(c)
+		}
+		fmt.Println(styles.TextStyle.Render(fmt.Sprintf("%d of %d components are not mapped to an upstream name", len(unmapped), len(doc.NodeList.Nodes))))
+	},
+}
+
+func init() {
+	convertCmd.Flags().StringVarP(&to, "to", "t", "", "format to convert to: spdx-json, cyclonedx-json or protobom")
+	convertCmd.Flags().StringVarP(&output, "output", "o", "", "name of the output file, the SBOM is printed when not set")
+	convertCmd.MarkFlagRequired("to")
+	SBOMCmd.AddCommand(convertCmd)
+	SBOMCmd.AddCommand(unmappedCmd)
+}
@@ -0,0 +1,80 @@
+package scan
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/spf13/cobra"
+
+	"github.com/buildsafedev/bsf/cmd/completion"
+	"github.com/buildsafedev/bsf/cmd/styles"
+	"github.com/buildsafedev/bsf/pkg/filescan"
+	nixcmd "github.com/buildsafedev/bsf/pkg/nix/cmd"
+	"github.com/buildsafedev/bsf/pkg/workspace"
+)
+
+var (
+	reportPath  string
+	resume      bool
+	scanWorkers int
+)
+
+func init() {
+	filesCmd.Flags().StringVarP(&reportPath, "report", "r", "file-scan.jsonl", "JSONL report the findings are streamed to")
+	filesCmd.Flags().BoolVarP(&resume, "resume", "", false, "resume a scan that was stopped, the store paths the report completed are not scanned again")
+	filesCmd.Flags().IntVarP(&scanWorkers, "workers", "", 4, "number of store paths scanned at once")
+	workspace.MarkPaths(filesCmd.Flags(), "report")
+	ScanCmd.AddCommand(filesCmd)
+}
+
+var filesCmd = &cobra.Command{
+	Use:   "files",
+	Short: "scans the files of a closure for licenses",
+	Long: `
+	Scans every file of the closure of a store path for license files and SPDX-License-Identifier tags.
+	Findings are written to the report as they are found, a scan that was stopped resumes with --resume.
+
+	bsf scan files <store path or result symlink>
+	bsf scan files bsf-result/result --report licenses.jsonl --resume
+	`,
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: completion.MaxArgs(1, completion.StorePaths),
+	Run: func(cmd *cobra.Command, args []string) {
+		storePath, err := nixcmd.ResolveStorePath(workspace.Resolve(args[0]))
+		if err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+			os.Exit(1)
+		}
+		closure, err := nixcmd.GetClosure(storePath)
+		if err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+			os.Exit(1)
+		}
+
+		report, err := filescan.OpenReport(reportPath, resume)
+		if err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+			os.Exit(1)
+		}
+
+		// the report stays consistent when interrupted, the scan resumes from it
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		s := &filescan.Scanner{Workers: scanWorkers, HostPath: nixcmd.HostPath}
+		fmt.Println(styles.BaseStyle.Render("info: ", fmt.Sprintf("Scanning the files of %d store paths...", len(closure))))
+		err = s.Scan(ctx, closure, report)
+		stop()
+		if cerr := report.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+			fmt.Println(styles.HintStyle.Render("hint: run again with --resume to continue the scan"))
+			os.Exit(1)
+		}
+
+		fmt.Println(styles.SucessStyle.Render(fmt.Sprintf("Found %d licenses, report written to %s", report.Findings(), reportPath)))
+	},
+}
@@ -2,18 +2,35 @@ package scan
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"os"
 	"strings"
+	"time"
 
 	bsfv1 "github.com/buildsafedev/bsf-apis/go/buildsafe/v1"
 	"github.com/buildsafedev/bsf/cmd/configure"
 	"github.com/buildsafedev/bsf/cmd/styles"
 	"github.com/buildsafedev/bsf/pkg/clients/search"
+	"github.com/buildsafedev/bsf/pkg/enrichdb"
+	"github.com/buildsafedev/bsf/pkg/loader"
+	"github.com/buildsafedev/bsf/pkg/vulnerability"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/spf13/cobra"
 )
 
+var (
+	output   string
+	buildDir string
+	fixes    bool
+)
+
+func init() {
+	ScanCmd.Flags().StringVarP(&output, "output", "o", "", "write a JSON report, including the snapshots of the data scanned against, instead of showing the results")
+	ScanCmd.Flags().BoolVar(&fixes, "fixes", false, "search nixpkgs for pull requests fixing the vulnerabilities and suggest version pins or patches, GITHUB_TOKEN raises the rate limit")
+	ScanCmd.Flags().StringVar(&buildDir, "build-dir", "", "output directory of a bsf build, tells if the entrypoints of the build load the package to prioritize its vulnerabilities")
+}
+
 // ScanCmd represents the scan command
 var ScanCmd = &cobra.Command{
 	Use:   "scan",
@@ -24,6 +41,9 @@ var ScanCmd = &cobra.Command{
 	 bsf scan name:version
 	 bsf scan curl:8.5.0
 	 bsf scan curl 8.5.0
+	 bsf scan curl 8.5.0 -o report.json
+	 bsf scan curl 8.5.0 --build-dir bsf-result
+	 bsf scan curl 8.5.0 --fixes
 	`,
 	Args: func(cmd *cobra.Command, args []string) error {
 		if err := cobra.RangeArgs(1, 2)(cmd, args); err != nil {
@@ -73,10 +93,81 @@ var ScanCmd = &cobra.Command{
 			os.Exit(1)
 		}
 
+		reachability := ""
+		if buildDir != "" {
+			reachability, err = lookupReachability(name, version)
+			if err != nil {
+				fmt.Println(styles.WarnStyle.Render("warning:", err.Error()))
+			}
+		}
+
+		var found []vulnerability.Fix
+		if fixes && len(vulnerabilities.Vulnerabilities) > 0 {
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+			found, err = vulnerability.NewFixFinder().FindAll(ctx, name, vulnerabilities.Vulnerabilities)
+			cancel()
+			if err != nil {
+				fmt.Println(styles.WarnStyle.Render("warning:", err.Error()))
+			}
+		}
+
+		if output != "" {
+			err = writeReport(name, version, conf.BuildSafeAPI, vulnerabilities, reachability, found)
+			if err != nil {
+				fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+				os.Exit(1)
+			}
+			fmt.Println(styles.SucessStyle.Render(fmt.Sprintf("Found %d vulnerabilities, report written to %s", len(vulnerabilities.Vulnerabilities), output)))
+			return
+		}
+
+		if reachability == loader.Unreachable && len(vulnerabilities.Vulnerabilities) > 0 {
+			fmt.Println(styles.HintStyle.Render(fmt.Sprintf("%s is not loaded by any entrypoint of the build in %s, its vulnerabilities can be prioritized lower", name, buildDir)))
+		}
+
 		m := initVulnTable(vulnerabilities)
 		if _, err := tea.NewProgram(m, tea.WithAltScreen()).Run(); err != nil {
 			fmt.Println(styles.ErrorStyle.Render(fmt.Errorf("error: %v", err).Error()))
 			os.Exit(1)
 		}
+		printFixes(found)
 	},
 }
+
+// lookupReachability returns the reachability of the package in the build, empty when it could not be classified
+func lookupReachability(name, version string) (string, error) {
+	report, err := loader.ReadReport(buildDir)
+	if err != nil {
+		return "", err
+	}
+	reachability, _ := report.Lookup(name, version)
+	return reachability, nil
+}
+
+// printFixes prints the fixes found in nixpkgs and the next step each of them suggests
+func printFixes(found []vulnerability.Fix) {
+	for _, fix := range found {
+		fmt.Println(styles.TextStyle.Render(fmt.Sprintf("%s: %s (%s, %s)", fix.ID, fix.Title, fix.State, fix.URL)))
+		fmt.Println(styles.HintStyle.Render("  hint: " + fix.Suggestion))
+	}
+}
+
+func writeReport(name, version, addr string, vulnerabilities *bsfv1.FetchVulnerabilitiesResponse, reachability string, found []vulnerability.Fix) error {
+	lock, err := enrichdb.ReadLock(enrichdb.LockFile)
+	if err != nil {
+		return err
+	}
+
+	report, err := vulnerability.NewReport(name, version, addr, vulnerabilities, lock)
+	if err != nil {
+		return err
+	}
+	report.Reachability = reachability
+	report.Fixes = found
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(output, data, 0644)
+}
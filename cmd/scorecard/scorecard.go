@@ -0,0 +1,163 @@
+package scorecard
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/bom-squad/protobom/pkg/sbom"
+	buildsafev1 "github.com/buildsafedev/bsf-apis/go/buildsafe/v1"
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/spf13/cobra"
+
+	"github.com/buildsafedev/bsf/cmd/configure"
+	"github.com/buildsafedev/bsf/cmd/styles"
+	"github.com/buildsafedev/bsf/pkg/clients/search"
+	bsbom "github.com/buildsafedev/bsf/pkg/sbom"
+	"github.com/buildsafedev/bsf/pkg/scorecard"
+)
+
+var (
+	output               string
+	minScore, minAverage float64
+	concurrency          int
+)
+
+func init() {
+	ScorecardCmd.Flags().StringVarP(&output, "output", "o", "", "location of the JSON report generated")
+	ScorecardCmd.Flags().Float64VarP(&minScore, "min-score", "", 0, "fail if any component scores below this value")
+	ScorecardCmd.Flags().Float64VarP(&minAverage, "min-average", "", 0, "fail if the average score of all components is below this value")
+	ScorecardCmd.Flags().IntVarP(&concurrency, "concurrency", "", 8, "number of concurrent scorecard requests")
+}
+
+// ScorecardCmd represents the scorecard command
+var ScorecardCmd = &cobra.Command{
+	Use:   "scorecard",
+	Short: "scorecard enriches components with OpenSSF Scorecard results",
+	Long: `scorecard resolves the upstream repository of every component in the SBOM and fetches its
+	OpenSSF Scorecard result, aggregating a risk score for the artifact.
+
+	bsf scorecard <path to attestations>
+	bsf scorecard bsf-result/attestations.intoto.jsonl --min-score 4 --output scorecard.json
+	`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) != 1 {
+			fmt.Println(styles.HintStyle.Render("hint:", "run `bsf scorecard <path to attestations>`"))
+			os.Exit(1)
+		}
+
+		data, err := os.ReadFile(args[0])
+		if err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+			os.Exit(1)
+		}
+
+		doc, err := bsbom.FromAttestations(data)
+		if err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+			os.Exit(1)
+		}
+
+		conf, err := configure.PreCheckConf()
+		if err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+			os.Exit(1)
+		}
+		sc, err := search.NewClientWithAddr(conf.BuildSafeAPI, conf.BuildSafeAPITLS)
+		if err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+			os.Exit(1)
+		}
+
+		fmt.Println(styles.HighlightStyle.Render("Fetching scorecards..."))
+
+		ctx, cancel := context.WithTimeout(context.Background(), 300*time.Second)
+		defer cancel()
+
+		report, err := scorecard.Enrich(ctx, scorecard.NewClient(), componentNodes(doc), homepageResolver(sc), concurrency)
+		if err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+			os.Exit(1)
+		}
+
+		printReport(report)
+
+		if output != "" {
+			rj, err := json.MarshalIndent(report, "", "  ")
+			if err != nil {
+				fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+				os.Exit(1)
+			}
+			if err := os.WriteFile(output, rj, 0644); err != nil {
+				fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+				os.Exit(1)
+			}
+		}
+
+		failed := false
+		if minScore > 0 {
+			for _, v := range report.Violations(minScore) {
+				fmt.Println(styles.ErrorStyle.Render(fmt.Sprintf("%s (%s) scores %.1f, below the minimum of %.1f", v.Name, v.Repo, v.Score, minScore)))
+				failed = true
+			}
+		}
+		if minAverage > 0 && report.Average < minAverage {
+			fmt.Println(styles.ErrorStyle.Render(fmt.Sprintf("average score %.1f is below the minimum of %.1f", report.Average, minAverage)))
+			failed = true
+		}
+		if failed {
+			os.Exit(1)
+		}
+	},
+}
+
+func componentNodes(doc *sbom.Document) []*sbom.Node {
+	roots := make(map[string]bool)
+	for _, id := range doc.NodeList.RootElements {
+		roots[id] = true
+	}
+
+	nodes := make([]*sbom.Node, 0, len(doc.NodeList.Nodes))
+	for _, n := range doc.NodeList.Nodes {
+		if roots[n.Id] || n.Name == "" {
+			continue
+		}
+		nodes = append(nodes, n)
+	}
+	return nodes
+}
+
+func homepageResolver(sc buildsafev1.SearchServiceClient) scorecard.HomepageResolver {
+	return func(ctx context.Context, name, version string) (string, error) {
+		resp, err := sc.FetchPackageVersion(ctx, &buildsafev1.FetchPackageVersionRequest{
+			Name:    name,
+			Version: version,
+		})
+		if err != nil {
+			return "", err
+		}
+		if resp.Package == nil {
+			return "", nil
+		}
+		return resp.Package.Homepage, nil
+	}
+}
+
+func printReport(report *scorecard.Report) {
+	t := table.NewWriter()
+	t.SetOutputMirror(os.Stdout)
+	t.AppendHeader(table.Row{"Component", "Version", "Repository", "Score"})
+	for _, c := range report.Components {
+		score := "-"
+		if c.Scored {
+			score = fmt.Sprintf("%.1f", c.Score)
+		}
+		t.AppendRow(table.Row{c.Name, c.Version, c.Repo, score})
+	}
+	t.AppendFooter(table.Row{"", "", "Average", fmt.Sprintf("%.1f", report.Average)})
+	t.Render()
+
+	fmt.Println(styles.TextStyle.Render(fmt.Sprintf("Risk score: %.1f/10 (%d components without scorecard)", report.RiskScore, report.Unscored)))
+}
@@ -0,0 +1,167 @@
+package simulate
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+
+	"github.com/spf13/cobra"
+
+	diffCmd "github.com/buildsafedev/bsf/cmd/diff"
+	"github.com/buildsafedev/bsf/cmd/styles"
+	"github.com/buildsafedev/bsf/pkg/diff"
+	nixcmd "github.com/buildsafedev/bsf/pkg/nix/cmd"
+	"github.com/buildsafedev/bsf/pkg/workspace"
+)
+
+var (
+	substitutes             []string
+	overlay, format, output string
+	noDryRun                bool
+)
+
+func init() {
+	SimulateCmd.Flags().StringArrayVarP(&substitutes, "substitute", "s", nil, "package of nixpkgs replaced by another, e.g. openssl=libressl, can be repeated")
+	SimulateCmd.Flags().StringVarP(&overlay, "overlay", "", "", "file of a nixpkgs overlay (final: prev: { ... }) to simulate")
+	SimulateCmd.Flags().StringVarP(&format, "format", "f", diffCmd.FormatTable, "format of the diff: table, json or markdown")
+	SimulateCmd.Flags().StringVarP(&output, "output", "o", "", "file the diff is written to, stdout by default")
+	SimulateCmd.Flags().BoolVarP(&noDryRun, "no-dry-run", "", false, "don't ask nix which derivations would be built and which paths fetched")
+	workspace.MarkPaths(SimulateCmd.Flags(), "overlay", "output")
+}
+
+// report is the JSON output of the simulation
+type report struct {
+	Derivations *nixcmd.Simulation `json:"derivations"`
+	Diff        *diff.Diff         `json:"diff"`
+	DryRun      *nixcmd.DryRun     `json:"dryRun,omitempty"`
+}
+
+// SimulateCmd represents the simulate command
+var SimulateCmd = &cobra.Command{
+	Use:   "simulate",
+	Short: "previews how replacing dependencies would change the build closure, without building",
+	Long: `evaluates the package of the project with packages of nixpkgs substituted, or with a nixpkgs overlay, and
+	compares the derivations it would be built from with the ones it is built from now. Nothing is built: the diff lists
+	the packages that would be added, removed, upgraded or downgraded, and the ones rebuilt because one of their
+	dependencies changed. nix is then asked which derivations would have to be built and which paths would be fetched
+	from the binary caches.
+	The arguments of the package taken from nixpkgs are taken from the overlaid nixpkgs, builders of other flake inputs
+	such as gomod2nix keep theirs.
+
+	bsf simulate --substitute openssl=libressl
+	bsf simulate -s zlib=zlib-ng -s openssl=libressl --format markdown -o impact.md
+	bsf simulate --overlay overlays/hardened.nix
+	`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if format != diffCmd.FormatTable && format != diffCmd.FormatJSON && format != diffCmd.FormatMarkdown {
+			fmt.Println(styles.ErrorStyle.Render("error:", fmt.Sprintf("unknown format %q, use table, json or markdown", format)))
+			os.Exit(1)
+		}
+		expr, err := overlayExpr()
+		if err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+			os.Exit(1)
+		}
+		if _, err := os.Stat("bsf/flake.nix"); err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error: bsf/flake.nix not found"))
+			fmt.Println(styles.HintStyle.Render("hint: run bsf init or bsf build first"))
+			os.Exit(1)
+		}
+
+		fmt.Fprintln(os.Stderr, styles.TextStyle.Render("Evaluating the package with and without the substitutions..."))
+		sim, err := nixcmd.SimulateOverlay("bsf", nixcmd.NixSystem(runtime.GOOS, runtime.GOARCH), expr)
+		if err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error: failed to evaluate the simulated package:", err.Error()))
+			os.Exit(1)
+		}
+		d, err := compareDerivations(sim)
+		if err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+			os.Exit(1)
+		}
+
+		var dryRun *nixcmd.DryRun
+		if !noDryRun && sim.Current != sim.Simulated {
+			dryRun, err = nixcmd.DryRunBuild(sim.Simulated)
+			if err != nil {
+				fmt.Println(styles.WarnStyle.Render("warning: failed to dry run the build:", err.Error()))
+			}
+		}
+
+		w := io.Writer(os.Stdout)
+		if output != "" {
+			f, err := os.Create(output)
+			if err != nil {
+				fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+				os.Exit(1)
+			}
+			defer f.Close()
+			w = f
+		}
+
+		if format == diffCmd.FormatJSON {
+			err = json.NewEncoder(w).Encode(report{Derivations: sim, Diff: d, DryRun: dryRun})
+		} else {
+			err = diffCmd.Write(w, d, format, sim.Current, sim.Simulated, output == "")
+		}
+		if err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+			os.Exit(1)
+		}
+
+		switch {
+		case sim.Current == sim.Simulated:
+			fmt.Fprintln(os.Stderr, styles.HintStyle.Render("The substitutions don't change the package, none of its dependencies use them"))
+		case dryRun != nil:
+			fmt.Fprintln(os.Stderr, styles.TextStyle.Render(fmt.Sprintf("Building it would build %d derivations and fetch %d paths", len(dryRun.Build), len(dryRun.Fetch))))
+		}
+	},
+}
+
+// overlayExpr returns the overlay of the substitutions or of the overlay file
+func overlayExpr() (string, error) {
+	if len(substitutes) > 0 && overlay != "" {
+		return "", fmt.Errorf("--substitute and --overlay can't be used together, substitute the packages in the overlay")
+	}
+	if overlay != "" {
+		abs, err := filepath.Abs(overlay)
+		if err != nil {
+			return "", err
+		}
+		if _, err := os.Stat(abs); err != nil {
+			return "", err
+		}
+		return "import " + strconv.Quote(abs), nil
+	}
+	if len(substitutes) == 0 {
+		return "", fmt.Errorf("nothing to simulate, use --substitute or --overlay")
+	}
+
+	subs := make([]nixcmd.Substitution, 0, len(substitutes))
+	for _, s := range substitutes {
+		sub, err := nixcmd.ParseSubstitution(s)
+		if err != nil {
+			return "", err
+		}
+		subs = append(subs, sub)
+	}
+	return nixcmd.SubstitutionOverlay(subs), nil
+}
+
+// compareDerivations compares the derivations the package is built from now with the simulated ones
+func compareDerivations(sim *nixcmd.Simulation) (*diff.Diff, error) {
+	current, err := nixcmd.DerivationGraph(sim.Current)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the derivations of %s: %v", sim.Current, err)
+	}
+	simulated, err := nixcmd.DerivationGraph(sim.Simulated)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the derivations of %s: %v", sim.Simulated, err)
+	}
+	return diff.Compare(diff.PackagesFromGraph(current), diff.PackagesFromGraph(simulated)), nil
+}
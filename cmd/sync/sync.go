@@ -0,0 +1,98 @@
+package sync
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"runtime"
+
+	"github.com/spf13/cobra"
+
+	"github.com/buildsafedev/bsf/cmd/styles"
+	"github.com/buildsafedev/bsf/pkg/hcl2nix"
+	nixcmd "github.com/buildsafedev/bsf/pkg/nix/cmd"
+)
+
+var (
+	check bool
+	prune bool
+)
+
+func init() {
+	SyncCmd.Flags().BoolVarP(&check, "check", "", false, "only report drift, exits with 1 if there is any")
+	SyncCmd.Flags().BoolVarP(&prune, "prune", "", false, "remove blocks from bsf.hcl that the flake does not provide")
+}
+
+// SyncCmd represents the sync command
+var SyncCmd = &cobra.Command{
+	Use:   "sync",
+	Short: "detects and fixes drift between bsf.hcl and the flake outputs",
+	Long: `sync evaluates bsf/flake.nix and compares its outputs with bsf.hcl: oci environments and configs that are missing
+	or were renamed in the flake, outputs bsf.hcl does not declare, and app names that differ from the package the flake builds.
+
+	Renamed blocks and app names are updated in bsf.hcl and stubs are added for undeclared outputs.
+
+	bsf sync --check
+	bsf sync
+	bsf sync --prune
+	`,
+	Run: func(cmd *cobra.Command, args []string) {
+		data, err := os.ReadFile("bsf.hcl")
+		if err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+			os.Exit(1)
+		}
+
+		var dstErr bytes.Buffer
+		conf, err := hcl2nix.ReadConfig(data, &dstErr)
+		if err != nil {
+			fmt.Println(styles.ErrorStyle.Render(dstErr.String()))
+			os.Exit(1)
+		}
+
+		fmt.Println(styles.TextStyle.Render("Evaluating flake outputs..."))
+		outputs, err := nixcmd.GetFlakeOutputs("bsf", nixcmd.NixSystem(runtime.GOOS, runtime.GOARCH))
+		if err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+			os.Exit(1)
+		}
+
+		drifts := hcl2nix.DetectDrift(conf, outputs.Outputs, outputs.AppName)
+		if len(drifts) == 0 {
+			fmt.Println(styles.SucessStyle.Render("bsf.hcl is in sync with the flake"))
+			return
+		}
+
+		for _, d := range drifts {
+			fmt.Println(styles.HighlightStyle.Render(" -", d.String()))
+		}
+		if check {
+			fmt.Println(styles.HintStyle.Render("hint: run bsf sync to update bsf.hcl"))
+			os.Exit(1)
+		}
+
+		changes := hcl2nix.Sync(conf, drifts, prune)
+		if len(changes) == 0 {
+			fmt.Println(styles.HintStyle.Render("hint: nothing to update, run bsf sync --prune to remove blocks the flake does not provide"))
+			return
+		}
+
+		f, err := os.Create("bsf.hcl")
+		if err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+			os.Exit(1)
+		}
+		defer f.Close()
+
+		err = hcl2nix.WriteConfig(*conf, f)
+		if err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+			os.Exit(1)
+		}
+
+		for _, c := range changes {
+			fmt.Println(styles.TextStyle.Render(" -", c))
+		}
+		fmt.Println(styles.SucessStyle.Render("Updated bsf.hcl"))
+	},
+}
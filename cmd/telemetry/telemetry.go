@@ -0,0 +1,200 @@
+package telemetry
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+
+	"github.com/buildsafedev/bsf/cmd/configure"
+	"github.com/buildsafedev/bsf/cmd/styles"
+	"github.com/buildsafedev/bsf/pkg/telemetry"
+	"github.com/buildsafedev/bsf/pkg/version"
+)
+
+func init() {
+	TelemetryCmd.AddCommand(enableCmd)
+	TelemetryCmd.AddCommand(disableCmd)
+	TelemetryCmd.AddCommand(statusCmd)
+	TelemetryCmd.AddCommand(previewCmd)
+	TelemetryCmd.AddCommand(sendCmd)
+}
+
+// TelemetryCmd represents the telemetry command
+var TelemetryCmd = &cobra.Command{
+	Use:   "telemetry",
+	Short: "manages the opt-in anonymous usage statistics",
+	Long: `bsf can send anonymous statistics about its runs: the command, the names of the flags used, phase durations,
+	closure sizes, the bsf version, OS and architecture. Names, paths, hashes and flag values are never recorded.
+	Telemetry is off until enabled, and DO_NOT_TRACK=1 or BSF_TELEMETRY=off turn it off regardless of the configuration.
+	Events are queued locally and sent in batches of ` + fmt.Sprint(telemetry.BatchSize) + `, bsf telemetry preview shows them exactly as they will be sent.
+
+	bsf telemetry enable
+	bsf telemetry preview
+	bsf telemetry disable
+	`,
+	Run: func(cmd *cobra.Command, args []string) {
+		fmt.Println(styles.HintStyle.Render("hint: use bsf telemetry with a subcommand"))
+		os.Exit(1)
+	},
+}
+
+var enableCmd = &cobra.Command{
+	Use:   "enable",
+	Short: "opts in to sending anonymous usage statistics",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		setEnabled(true)
+		fmt.Println(styles.SucessStyle.Render("Telemetry enabled, thank you. Run bsf telemetry preview to see what is sent"))
+	},
+}
+
+var disableCmd = &cobra.Command{
+	Use:   "disable",
+	Short: "opts out and deletes the events that were not sent yet",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		setEnabled(false)
+		if err := telemetry.Clear(); err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+			os.Exit(1)
+		}
+		fmt.Println(styles.SucessStyle.Render("Telemetry disabled"))
+	},
+}
+
+var statusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "shows if telemetry is enabled and how many events are queued",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		conf, err := configure.LoadConf()
+		if err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+			os.Exit(1)
+		}
+		switch {
+		case telemetry.Disabled():
+			fmt.Println(styles.TextStyle.Render("Telemetry is disabled by DO_NOT_TRACK or BSF_TELEMETRY"))
+		case conf.Telemetry:
+			fmt.Println(styles.TextStyle.Render("Telemetry is enabled, events are sent to", endpoint(conf.TelemetryEndpoint)))
+		default:
+			fmt.Println(styles.TextStyle.Render("Telemetry is disabled"))
+		}
+
+		events, err := telemetry.Pending()
+		if err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+			os.Exit(1)
+		}
+		fmt.Println(styles.TextStyle.Render(fmt.Sprintf("%d events queued", len(events))))
+	},
+}
+
+var previewCmd = &cobra.Command{
+	Use:   "preview",
+	Short: "shows the request body that will be sent, as is",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		events, err := telemetry.Pending()
+		if err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+			os.Exit(1)
+		}
+		if len(events) == 0 {
+			// show what a build of this machine would report, nothing is recorded until telemetry is enabled
+			fmt.Println(styles.HintStyle.Render("No events queued, this is an example of the event of a build:"))
+			example := telemetry.NewEvent("bsf build", version.GetVersion(), []string{"quick"})
+			example.DurationsMs = map[string]int64{"nix build": 0, "closure": 0, "artifacts": 0, "total": 0}
+			events = append(events, example)
+		}
+
+		body, err := telemetry.Payload(events)
+		if err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+			os.Exit(1)
+		}
+		fmt.Println(string(body))
+	},
+}
+
+var sendCmd = &cobra.Command{
+	Use:   "send",
+	Short: "sends the queued events now",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		conf, err := configure.LoadConf()
+		if err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+			os.Exit(1)
+		}
+		if !conf.Telemetry || telemetry.Disabled() {
+			fmt.Println(styles.ErrorStyle.Render("error: telemetry is disabled"))
+			os.Exit(1)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		n, err := telemetry.Flush(ctx, conf.TelemetryEndpoint, true)
+		if err != nil {
+			fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+			os.Exit(1)
+		}
+		fmt.Println(styles.SucessStyle.Render(fmt.Sprintf("Sent %d events", n)))
+	},
+}
+
+// Start starts recording the run of cmd if the user opted in. Only the names of the flags that were set are recorded.
+func Start(cmd *cobra.Command) {
+	if cmd.HasParent() && cmd.Parent() == TelemetryCmd {
+		return
+	}
+	conf, err := configure.LoadConf()
+	if err != nil || !conf.Telemetry {
+		return
+	}
+
+	features := make([]string, 0)
+	cmd.Flags().Visit(func(f *pflag.Flag) {
+		features = append(features, f.Name)
+	})
+	telemetry.Start(true, cmd.CommandPath(), version.GetVersion(), features)
+}
+
+// Finish queues the event of the run and sends the queue once it is full. Failures never affect the command.
+func Finish() {
+	e, err := telemetry.Finish()
+	if err != nil || e == nil {
+		return
+	}
+	conf, err := configure.LoadConf()
+	if err != nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	telemetry.Flush(ctx, conf.TelemetryEndpoint, false)
+}
+
+func setEnabled(enabled bool) {
+	conf, err := configure.PreCheckConf()
+	if err == nil {
+		conf.Telemetry = enabled
+		err = configure.SaveConf(conf)
+	}
+	if err != nil {
+		fmt.Println(styles.ErrorStyle.Render("error:", err.Error()))
+		os.Exit(1)
+	}
+}
+
+func endpoint(configured string) string {
+	if configured != "" {
+		return configured
+	}
+	return telemetry.DefaultEndpoint
+}
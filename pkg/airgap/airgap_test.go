@@ -0,0 +1,86 @@
+package airgap
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/buildsafedev/bsf/pkg/layout"
+	"github.com/buildsafedev/bsf/pkg/receipt"
+	"github.com/buildsafedev/bsf/pkg/signing"
+)
+
+func TestBundle(t *testing.T) {
+	output := t.TempDir()
+	l, err := layout.Open(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	attestations := []byte("{\"_type\":\"https://in-toto.io/Statement/v1\"}\n")
+	for _, e := range []struct {
+		kind, name string
+		data       []byte
+	}{
+		{layout.KindArtifact, "bin/app", []byte("binary")},
+		{layout.KindSBOM, "sbom.spdx.json", []byte(`{"spdxVersion":"SPDX-2.3"}`)},
+		{layout.KindAttestation, layout.AttestationsName, attestations},
+	} {
+		if _, err := l.Add(e.kind, e.name, "application/octet-stream", e.data); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	signer, _ := signing.NewEphemeralSigner()
+	var signed bytes.Buffer
+	if err := signing.SignAttestations(&signed, attestations, signer, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.Add(layout.KindAttestation, layout.SignedAttestationsName, "application/vnd.in-toto+jsonl", signed.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	r := receipt.New(l, receipt.Source{Commit: "abc123"}, "/nix/store/aaaa-app.drv", receipt.Output{StorePath: "/nix/store/bbbb-app"})
+	sr, err := receipt.Sign(r, signer, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := json.Marshal(sr)
+	if _, err := l.Add(layout.KindAttestation, receipt.Name, receipt.PayloadType, data); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Write(); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := filepath.Join(t.TempDir(), "bundle")
+	if _, err := Create(context.Background(), output, dir, Options{}); err != nil {
+		t.Fatal(err)
+	}
+
+	checks, err := Verify(dir, VerifyOptions{Key: signer.Public()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if failed := receipt.Failed(checks); len(failed) != 0 {
+		t.Errorf("expected the bundle to verify, failed: %v", failed)
+	}
+
+	// without the key the signatures can't be checked
+	checks, _ = Verify(dir, VerifyOptions{})
+	if len(receipt.Failed(checks)) != 2 {
+		t.Errorf("expected the attestation and receipt checks to fail, got %v", checks)
+	}
+
+	// a file modified after bundling breaks the chain of the receipt
+	bundled, _ := layout.Open(filepath.Join(dir, OutputDir))
+	e, _ := bundled.Find(layout.KindSBOM, "sbom.spdx.json")
+	if err := os.WriteFile(filepath.Join(bundled.Dir, e.Path), []byte("{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	checks, _ = Verify(dir, VerifyOptions{Key: signer.Public()})
+	if len(receipt.Failed(checks)) != 1 {
+		t.Errorf("expected the SBOM check to fail, got %v", checks)
+	}
+}
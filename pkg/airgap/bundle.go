@@ -0,0 +1,246 @@
+// Package airgap creates bundles to verify builds on disconnected machines. A bundle holds a copy of the output
+// directory, the transparency log entries of its signatures with their inclusion proofs, the image pulled from the
+// registry and the trust root needed to check them, so no network access is needed to verify it.
+package airgap
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/buildsafedev/bsf/pkg/layout"
+	"github.com/buildsafedev/bsf/pkg/oci"
+	"github.com/buildsafedev/bsf/pkg/receipt"
+	"github.com/buildsafedev/bsf/pkg/signing"
+)
+
+const (
+	// ManifestName is the name of the bundle manifest
+	ManifestName = "bundle.json"
+	// OutputDir is the copy of the output directory in the bundle
+	OutputDir = "output"
+	// ImageDir is the image of the build in the dir: layout
+	ImageDir = "image"
+)
+
+// Manifest describes the content of a bundle
+type Manifest struct {
+	Version    int                `json:"version"`
+	Created    time.Time          `json:"created"`
+	App        string             `json:"app,omitempty"`
+	AppVersion string             `json:"appVersion,omitempty"`
+	TrustRoot  *signing.TrustRoot `json:"trustRoot,omitempty"`
+	Image      *Image             `json:"image,omitempty"`
+}
+
+// Image is the image mirrored from the registry
+type Image struct {
+	Reference string `json:"reference"`
+	Digest    string `json:"digest"`
+}
+
+// Options configure the content of a bundle
+type Options struct {
+	// TrustRoot is bundled for keyless signatures
+	TrustRoot *signing.TrustRoot
+	// Image is pulled from the registry into the bundle
+	Image *oci.Reference
+	// Registry is the client pulling the image
+	Registry *oci.Client
+	// RekorURL is the transparency log inclusion proofs missing from the log entries are fetched from
+	RekorURL string
+}
+
+// Create bundles the output directory in dir
+func Create(ctx context.Context, output, dir string, opts Options) (*Manifest, error) {
+	src, err := layout.Open(output)
+	if err != nil {
+		return nil, err
+	}
+	if len(src.Index.Entries) == 0 {
+		return nil, fmt.Errorf("%s has no %s, build with bsf build first", output, layout.IndexFile)
+	}
+
+	dst, err := copyLayout(src, filepath.Join(dir, OutputDir))
+	if err != nil {
+		return nil, err
+	}
+	if err := completeLogEntries(ctx, dst, opts.RekorURL); err != nil {
+		return nil, err
+	}
+	if err := dst.Write(); err != nil {
+		return nil, err
+	}
+	if _, err := dst.Prune(); err != nil {
+		return nil, err
+	}
+	for _, e := range dst.Index.Entries {
+		if e.Kind == layout.KindAttestation {
+			if err := dst.Link(layout.KindAttestation, e.Name, e.Name); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	m := &Manifest{
+		Version:    1,
+		Created:    time.Now().UTC(),
+		App:        src.Index.App,
+		AppVersion: src.Index.Version,
+		TrustRoot:  opts.TrustRoot,
+	}
+	if opts.Image != nil {
+		client := opts.Registry
+		if client == nil {
+			client = oci.NewClient()
+		}
+		digest, err := client.PullDir(ctx, opts.Image, filepath.Join(dir, ImageDir))
+		if err != nil {
+			return nil, err
+		}
+		m.Image = &Image{Reference: opts.Image.String(), Digest: digest}
+	}
+
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return m, os.WriteFile(filepath.Join(dir, ManifestName), data, 0644)
+}
+
+// ReadManifest reads the manifest of the bundle in dir
+func ReadManifest(dir string) (*Manifest, error) {
+	data, err := os.ReadFile(filepath.Join(dir, ManifestName))
+	if err != nil {
+		return nil, fmt.Errorf("%s is not a bundle: %v", dir, err)
+	}
+	m := &Manifest{}
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", ManifestName, err)
+	}
+	return m, nil
+}
+
+// copyLayout copies the files of the index to dir
+func copyLayout(src *layout.Layout, dir string) (*layout.Layout, error) {
+	dst, err := layout.Open(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range src.Index.Entries {
+		if err := copyFile(filepath.Join(src.Dir, filepath.FromSlash(e.Path)), filepath.Join(dir, filepath.FromSlash(e.Path))); err != nil {
+			return nil, err
+		}
+	}
+	index := *src.Index
+	index.Entries = append([]layout.Entry{}, src.Index.Entries...)
+	dst.Index = &index
+	return dst, nil
+}
+
+func copyFile(from, to string) error {
+	in, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(to), 0755); err != nil {
+		return err
+	}
+	out, err := os.OpenFile(to, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, info.Mode().Perm()|0200)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// completeLogEntries fetches the inclusion proofs the log did not return when the signatures were recorded
+func completeLogEntries(ctx context.Context, l *layout.Layout, rekorURL string) error {
+	complete := func(e *signing.LogEntry) (bool, error) {
+		if e == nil || e.Verification.InclusionProof != nil {
+			return false, nil
+		}
+		if rekorURL == "" {
+			return false, fmt.Errorf("log entry %d has no inclusion proof", e.LogIndex)
+		}
+		fetched, err := signing.FetchEntry(ctx, rekorURL, e.UUID)
+		if err != nil {
+			return false, fmt.Errorf("failed to fetch the inclusion proof of log entry %d: %v", e.LogIndex, err)
+		}
+		*e = *fetched
+		return true, nil
+	}
+
+	if data, err := l.Read(layout.KindAttestation, layout.SignedAttestationsName); err == nil {
+		attestations, err := readSignedAttestations(data)
+		if err != nil {
+			return err
+		}
+		changed := false
+		var buf bytes.Buffer
+		enc := json.NewEncoder(&buf)
+		for _, sa := range attestations {
+			ok, err := complete(sa.TlogEntry)
+			if err != nil {
+				return err
+			}
+			changed = changed || ok
+			if err := enc.Encode(sa); err != nil {
+				return err
+			}
+		}
+		if changed {
+			if _, err := l.Add(layout.KindAttestation, layout.SignedAttestationsName, "application/vnd.in-toto+jsonl", buf.Bytes()); err != nil {
+				return err
+			}
+		}
+	}
+
+	if data, err := l.Read(layout.KindAttestation, receipt.Name); err == nil {
+		signed := &receipt.Signed{}
+		if err := json.Unmarshal(data, signed); err != nil {
+			return err
+		}
+		ok, err := complete(signed.TlogEntry)
+		if err != nil || !ok {
+			return err
+		}
+		data, err = json.MarshalIndent(signed, "", "  ")
+		if err != nil {
+			return err
+		}
+		if _, err := l.Add(layout.KindAttestation, receipt.Name, receipt.PayloadType, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readSignedAttestations(data []byte) ([]*signing.SignedAttestation, error) {
+	attestations := make([]*signing.SignedAttestation, 0)
+	for _, line := range bytes.Split(bytes.TrimSpace(data), []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
+		sa := &signing.SignedAttestation{}
+		if err := json.Unmarshal(line, sa); err != nil {
+			return nil, fmt.Errorf("failed to parse signed attestation: %v", err)
+		}
+		attestations = append(attestations, sa)
+	}
+	return attestations, nil
+}
@@ -0,0 +1,207 @@
+package airgap
+
+import (
+	"context"
+	"crypto"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	bio "github.com/buildsafedev/bsf/pkg/io"
+	"github.com/buildsafedev/bsf/pkg/layout"
+	"github.com/buildsafedev/bsf/pkg/receipt"
+	"github.com/buildsafedev/bsf/pkg/signing"
+)
+
+// VerifyOptions configure the verification of a bundle
+type VerifyOptions struct {
+	// TrustRoot checks keyless signatures. The trust root of the bundle is used when it is nil,
+	// it should only be trusted if the bundle was transferred over a trusted channel.
+	TrustRoot *signing.TrustRoot
+	// Identity is the identity the certificates of keyless signatures must have been issued for
+	Identity signing.Identity
+	// Key checks signatures made with a key managed by the user
+	Key crypto.PublicKey
+	// Now is the time the trust root expiry is checked against
+	Now time.Time
+}
+
+// Verify checks the signatures, log entries and digests of the bundle in dir without network access.
+// The bundle holds if no check failed.
+func Verify(dir string, opts VerifyOptions) ([]receipt.Check, error) {
+	m, err := ReadManifest(dir)
+	if err != nil {
+		return nil, err
+	}
+	root := opts.TrustRoot
+	if root == nil {
+		root = m.TrustRoot
+	}
+	if opts.Now.IsZero() {
+		opts.Now = time.Now()
+	}
+
+	checks := make([]receipt.Check, 0)
+	add := func(link string, status receipt.Status, format string, args ...interface{}) {
+		checks = append(checks, receipt.Check{Link: link, Status: status, Detail: fmt.Sprintf(format, args...)})
+	}
+
+	if root != nil {
+		if err := root.Check(opts.Now); err != nil {
+			add("trust root", receipt.StatusFailed, "%v", err)
+			// signatures checked against an expired trust root are not conclusive
+			root = nil
+		} else {
+			add("trust root", receipt.StatusOK, "valid until %s", root.Expires.Format(time.DateOnly))
+		}
+	}
+	verify := func(env *signing.Envelope, certs []string, entry *signing.LogEntry) ([]byte, string, error) {
+		switch {
+		case len(certs) > 0 && root != nil:
+			if err := signing.CheckIdentity(certs[0], opts.Identity); err != nil {
+				return nil, "", err
+			}
+			return root.Verify(env, certs, entry)
+		case len(certs) > 0 && opts.Key == nil:
+			return nil, "", fmt.Errorf("no valid trust root to check the certificate")
+		case opts.Key == nil:
+			return nil, "", fmt.Errorf("signed with a key of its own, pass its public key")
+		}
+		payload, err := signing.VerifyEnvelope(opts.Key, env)
+		return payload, "", err
+	}
+
+	l, err := layout.Open(filepath.Join(dir, OutputDir))
+	if err != nil {
+		return nil, err
+	}
+
+	if data, err := l.Read(layout.KindAttestation, layout.SignedAttestationsName); err == nil {
+		attestations, err := readSignedAttestations(data)
+		if err != nil {
+			return nil, err
+		}
+		for i, sa := range attestations {
+			link := fmt.Sprintf("signed attestation %d", i+1)
+			if _, identity, err := verify(sa.Envelope, sa.Certificates, sa.TlogEntry); err != nil {
+				add(link, receipt.StatusFailed, "%v", err)
+			} else {
+				add(link, receipt.StatusOK, "signed by %s", signerName(identity, sa.TlogEntry))
+			}
+		}
+	}
+
+	var image *imageDir
+	if m.Image != nil {
+		image, err = readImageDir(filepath.Join(dir, ImageDir))
+		if err != nil {
+			add("image "+m.Image.Reference, receipt.StatusFailed, "%v", err)
+		} else {
+			checks = append(checks, image.check(m.Image)...)
+		}
+	}
+
+	data, err := l.Read(layout.KindAttestation, receipt.Name)
+	if err != nil {
+		add("receipt", receipt.StatusSkipped, "the build has no receipt")
+		return checks, nil
+	}
+	signed := &receipt.Signed{}
+	if err := json.Unmarshal(data, signed); err != nil {
+		return nil, fmt.Errorf("failed to parse receipt: %v", err)
+	}
+	if signed.Envelope == nil || signed.Envelope.PayloadType != receipt.PayloadType {
+		add("receipt", receipt.StatusFailed, "not a build receipt")
+		return checks, nil
+	}
+	payload, identity, err := verify(signed.Envelope, signed.Certificates, signed.TlogEntry)
+	if err != nil {
+		add("receipt", receipt.StatusFailed, "%v", err)
+		return checks, nil
+	}
+	add("receipt", receipt.StatusOK, "signed by %s", signerName(identity, signed.TlogEntry))
+
+	r := &receipt.Receipt{}
+	if err := json.Unmarshal(payload, r); err != nil {
+		return nil, fmt.Errorf("failed to parse receipt payload: %v", err)
+	}
+
+	// the store is not bundled, the output is checked through the digests of the files copied from it
+	offline := func(string) (string, error) { return "", fmt.Errorf("the nix store is not part of the bundle") }
+	v := &receipt.Verifier{
+		OutputDir: l.Dir,
+		Deriver:   offline,
+		NarHash:   offline,
+		ImageDigest: func(string) (string, error) {
+			if image == nil {
+				return "", fmt.Errorf("the image is not part of the bundle")
+			}
+			return image.manifest.Config.Digest, nil
+		},
+	}
+	return append(checks, v.Verify(context.Background(), r)...), nil
+}
+
+func signerName(identity string, entry *signing.LogEntry) string {
+	if identity == "" {
+		return "the given key"
+	}
+	if entry != nil {
+		return fmt.Sprintf("%s (log index %d)", identity, entry.LogIndex)
+	}
+	return identity
+}
+
+// imageDir is an image in the dir: layout, as written by oci.Client.PullDir
+type imageDir struct {
+	dir      string
+	digest   string
+	manifest struct {
+		Config struct {
+			Digest string `json:"digest"`
+		} `json:"config"`
+		Layers []struct {
+			Digest string `json:"digest"`
+		} `json:"layers"`
+	}
+}
+
+func readImageDir(dir string) (*imageDir, error) {
+	data, err := os.ReadFile(filepath.Join(dir, "manifest.json"))
+	if err != nil {
+		return nil, err
+	}
+	img := &imageDir{dir: dir}
+	if err := json.Unmarshal(data, &img.manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse image manifest: %v", err)
+	}
+	sum := sha256.Sum256(data)
+	img.digest = "sha256:" + hex.EncodeToString(sum[:])
+	return img, nil
+}
+
+// check checks the manifest digest recorded when the image was pulled and the digests of its blobs
+func (img *imageDir) check(recorded *Image) []receipt.Check {
+	link := "image " + recorded.Reference
+	if img.digest != recorded.Digest {
+		return []receipt.Check{{Link: link, Status: receipt.StatusFailed, Detail: fmt.Sprintf("manifest has digest %s, the bundle recorded %s", img.digest, recorded.Digest)}}
+	}
+
+	digests := []string{img.manifest.Config.Digest}
+	for _, l := range img.manifest.Layers {
+		digests = append(digests, l.Digest)
+	}
+	for _, d := range digests {
+		hexDigest := strings.TrimPrefix(d, "sha256:")
+		got, err := bio.FileSHA256(filepath.Join(img.dir, hexDigest))
+		if err != nil || got != hexDigest {
+			return []receipt.Check{{Link: link, Status: receipt.StatusFailed, Detail: fmt.Sprintf("blob %s is missing or was modified", d)}}
+		}
+	}
+	return []receipt.Check{{Link: link, Status: receipt.StatusOK, Detail: fmt.Sprintf("%s with %d blobs", recorded.Digest, len(digests))}}
+}
@@ -0,0 +1,150 @@
+package anomaly
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/bom-squad/protobom/pkg/sbom"
+
+	"github.com/buildsafedev/bsf/pkg/diff"
+)
+
+const (
+	// KindDuplicateVersions is reported when the closure contains several versions of the same package
+	KindDuplicateVersions = "duplicate-versions"
+	// KindNewTopLevel is reported when a direct dependency appears that was not in the previous build
+	KindNewTopLevel = "new-top-level"
+)
+
+// Anomaly is a suspicious pattern in the dependency graph, often caused by an overlay or pin mistake
+type Anomaly struct {
+	Kind     string   `json:"kind"`
+	Name     string   `json:"name"`
+	Versions []string `json:"versions"`
+}
+
+// String describes the anomaly
+func (a Anomaly) String() string {
+	switch a.Kind {
+	case KindDuplicateVersions:
+		return fmt.Sprintf("closure contains %d versions of %s: %s", len(a.Versions), a.Name, strings.Join(a.Versions, ", "))
+	case KindNewTopLevel:
+		return fmt.Sprintf("new direct dependency %s %s was not in the previous build", a.Name, strings.Join(a.Versions, ", "))
+	}
+	return a.Name
+}
+
+// Detect returns the anomalies of the closure described by doc. If previous is not nil, direct dependencies are compared with it.
+func Detect(doc, previous *sbom.Document) []Anomaly {
+	anomalies := DuplicateVersions(doc)
+	if previous != nil {
+		anomalies = append(anomalies, NewTopLevel(previous, doc)...)
+	}
+	return anomalies
+}
+
+// DuplicateVersions returns the packages present in more than one version
+func DuplicateVersions(doc *sbom.Document) []Anomaly {
+	versions := make(map[string]map[string]bool)
+	for _, p := range diff.PackagesFromSBOM(doc) {
+		if p.Version == "" {
+			continue
+		}
+		if versions[p.Name] == nil {
+			versions[p.Name] = make(map[string]bool)
+		}
+		versions[p.Name][p.Version] = true
+	}
+
+	anomalies := make([]Anomaly, 0)
+	for name, vs := range versions {
+		if len(vs) < 2 {
+			continue
+		}
+		anomalies = append(anomalies, Anomaly{
+			Kind:     KindDuplicateVersions,
+			Name:     name,
+			Versions: sortedKeys(vs),
+		})
+	}
+	sort.Slice(anomalies, func(i, j int) bool {
+		return anomalies[i].Name < anomalies[j].Name
+	})
+
+	return anomalies
+}
+
+// NewTopLevel returns the direct dependencies of doc that were not direct dependencies in previous
+func NewTopLevel(previous, doc *sbom.Document) []Anomaly {
+	before := TopLevel(previous)
+
+	anomalies := make([]Anomaly, 0)
+	for name, vs := range TopLevel(doc) {
+		if _, ok := before[name]; ok {
+			continue
+		}
+		anomalies = append(anomalies, Anomaly{
+			Kind:     KindNewTopLevel,
+			Name:     name,
+			Versions: sortedKeys(vs),
+		})
+	}
+	sort.Slice(anomalies, func(i, j int) bool {
+		return anomalies[i].Name < anomalies[j].Name
+	})
+
+	return anomalies
+}
+
+// TopLevel returns the names and versions of the direct dependencies of the build result.
+// The build result is the component other components are runtime dependencies of, while not being a dependency itself.
+func TopLevel(doc *sbom.Document) map[string]map[string]bool {
+	nodes := make(map[string]*sbom.Node, len(doc.NodeList.Nodes))
+	for _, n := range doc.NodeList.Nodes {
+		nodes[n.Id] = n
+	}
+	// the lock file relates packages to the root element, those edges don't describe the closure
+	roots := make(map[string]bool)
+	for _, id := range doc.NodeList.RootElements {
+		roots[id] = true
+	}
+
+	isDependency := make(map[string]bool)
+	for _, e := range doc.NodeList.Edges {
+		if e.Type == sbom.Edge_runtimeDependency && !roots[e.From] {
+			isDependency[e.From] = true
+		}
+	}
+
+	topLevel := make(map[string]map[string]bool)
+	for _, e := range doc.NodeList.Edges {
+		if e.Type != sbom.Edge_runtimeDependency || roots[e.From] {
+			continue
+		}
+		for _, to := range e.To {
+			if isDependency[to] {
+				continue
+			}
+			n, ok := nodes[e.From]
+			if !ok || n.Name == "" {
+				continue
+			}
+			if topLevel[n.Name] == nil {
+				topLevel[n.Name] = make(map[string]bool)
+			}
+			topLevel[n.Name][n.Version] = true
+		}
+	}
+
+	return topLevel
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
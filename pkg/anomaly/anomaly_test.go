@@ -0,0 +1,47 @@
+package anomaly
+
+import (
+	"testing"
+
+	"github.com/bom-squad/protobom/pkg/sbom"
+)
+
+func testDoc(deps map[string]string, direct []string) *sbom.Document {
+	doc := sbom.NewDocument()
+	app := &sbom.Node{Id: "app", Name: "app"}
+	doc.NodeList.AddRootNode(app)
+	result := &sbom.Node{Id: "result", Name: "app-result", Version: "1.0"}
+	doc.NodeList.AddNode(result)
+
+	for id, version := range deps {
+		doc.NodeList.AddNode(&sbom.Node{Id: id, Name: id[:len(id)-len(version)-1], Version: version})
+	}
+	for _, id := range direct {
+		doc.NodeList.AddEdge(&sbom.Edge{Type: sbom.Edge_runtimeDependency, From: id, To: []string{"result"}})
+	}
+	return doc
+}
+
+func TestDuplicateVersions(t *testing.T) {
+	doc := testDoc(map[string]string{
+		"glibc@2.38":     "2.38",
+		"glibc@2.39":     "2.39",
+		"openssl@3.0.13": "3.0.13",
+	}, nil)
+
+	got := DuplicateVersions(doc)
+	if len(got) != 1 || got[0].Name != "glibc" || len(got[0].Versions) != 2 {
+		t.Errorf("DuplicateVersions() = %+v, want glibc with 2 versions", got)
+	}
+}
+
+func TestNewTopLevel(t *testing.T) {
+	previous := testDoc(map[string]string{"openssl@3.0.13": "3.0.13"}, []string{"openssl@3.0.13"})
+	current := testDoc(map[string]string{"openssl@3.0.13": "3.0.13", "libressl@3.8.2": "3.8.2"}, []string{"openssl@3.0.13", "libressl@3.8.2"})
+	current.NodeList.AddEdge(&sbom.Edge{Type: sbom.Edge_runtimeDependency, From: "app", To: []string{"openssl@3.0.13"}})
+
+	got := NewTopLevel(previous, current)
+	if len(got) != 1 || got[0].Name != "libressl" {
+		t.Errorf("NewTopLevel() = %+v, want libressl", got)
+	}
+}
@@ -0,0 +1,144 @@
+package attestation
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Redaction removes internal details from in-toto statements before they are published to a registry
+type Redaction struct {
+	// Fields are the JSON keys removed wherever they appear in a statement
+	Fields []string
+	// Hosts are the hosts of internal URLs. References to them are removed from the lists they are in,
+	// other fields with an internal URL are set to NOASSERTION.
+	Hosts []string
+	// Comments are the prefixes of the comments of internal references, such as the internal ids of the package registry
+	Comments []string
+}
+
+// PublicRedaction is the redaction profile for customer-facing registries: the internal ids of private components,
+// email addresses and the internal parameters of the build are removed
+var PublicRedaction = Redaction{
+	Fields:   []string{"internalParameters", "email"},
+	Comments: []string{"internal-id:"},
+}
+
+// IsZero reports if the redaction removes nothing
+func (r Redaction) IsZero() bool {
+	return len(r.Fields) == 0 && len(r.Hosts) == 0 && len(r.Comments) == 0
+}
+
+// Redact applies the redaction to every statement of the JSON lines attestations.
+// The subjects of the statements are kept, so the redacted statements still refer to the same artifacts.
+func Redact(attestations []byte, r Redaction) ([]byte, error) {
+	if r.IsZero() {
+		return attestations, nil
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(attestations))
+	scanner.Buffer(make([]byte, 0, 1024*1024), 64*1024*1024)
+
+	var out bytes.Buffer
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		var statement map[string]interface{}
+		if err := json.Unmarshal(line, &statement); err != nil {
+			return nil, fmt.Errorf("failed to parse statement: %v", err)
+		}
+		subject := statement["subject"]
+		redacted := r.redact(statement).(map[string]interface{})
+		redacted["subject"] = subject
+
+		data, err := json.Marshal(redacted)
+		if err != nil {
+			return nil, err
+		}
+		out.Write(data)
+		out.WriteByte('\n')
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+func (r Redaction) redact(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for _, f := range r.Fields {
+			delete(v, f)
+		}
+		for k, child := range v {
+			if s, ok := child.(string); ok && r.internalURL(s) {
+				v[k] = "NOASSERTION"
+				continue
+			}
+			v[k] = r.redact(child)
+		}
+		return v
+	case []interface{}:
+		kept := v[:0]
+		for _, child := range v {
+			if r.internal(child) {
+				continue
+			}
+			kept = append(kept, r.redact(child))
+		}
+		return kept
+	}
+	return v
+}
+
+// internal reports if an element of a list is a reference to an internal resource
+func (r Redaction) internal(v interface{}) bool {
+	obj, ok := v.(map[string]interface{})
+	if !ok {
+		s, ok := v.(string)
+		return ok && r.internalURL(s)
+	}
+	for k, child := range obj {
+		s, ok := child.(string)
+		if !ok {
+			continue
+		}
+		if k == "comment" {
+			for _, prefix := range r.Comments {
+				if strings.HasPrefix(s, prefix) {
+					return true
+				}
+			}
+		}
+		if referenceKeys[k] && r.internalURL(s) {
+			return true
+		}
+	}
+	return false
+}
+
+// referenceKeys are the keys holding the target of a reference in SPDX, CycloneDX and SLSA
+var referenceKeys = map[string]bool{"url": true, "uri": true, "referenceLocator": true, "locator": true}
+
+func (r Redaction) internalURL(s string) bool {
+	if len(r.Hosts) == 0 || !strings.Contains(s, "://") {
+		return false
+	}
+	u, err := url.Parse(strings.TrimPrefix(s, "git+"))
+	if err != nil {
+		return false
+	}
+	host := u.Hostname()
+	for _, h := range r.Hosts {
+		if host == h || strings.HasSuffix(host, "."+h) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,67 @@
+package attestation
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestRedact(t *testing.T) {
+	statement := `{"_type":"https://in-toto.io/Statement/v1","subject":[{"name":"app","digest":{"sha256":"abc"}}],` +
+		`"predicateType":"https://spdx.dev/Document","predicate":{"packages":[{"name":"billing-core",` +
+		`"externalRefs":[{"referenceType":"purl","referenceLocator":"pkg:nix/billing-core@v1"},` +
+		`{"referenceType":"other","referenceLocator":"https://packages.acme.internal/billing-core","comment":"internal-id:42"}],` +
+		`"downloadLocation":"https://git.acme.internal/billing.git","supplier":{"name":"Acme","email":"team@acme.internal"}}],` +
+		`"internalParameters":{"runner":"build-7"}}}`
+
+	tests := []struct {
+		name      string
+		redaction Redaction
+		removed   []string
+		kept      []string
+	}{
+		{
+			name:      "none",
+			redaction: Redaction{},
+			kept:      []string{"internal-id:42", "team@acme.internal", "build-7"},
+		},
+		{
+			name:      "public",
+			redaction: PublicRedaction,
+			removed:   []string{"internal-id:42", "team@acme.internal", "build-7"},
+			kept:      []string{"pkg:nix/billing-core@v1", "https://git.acme.internal/billing.git"},
+		},
+		{
+			name:      "hosts",
+			redaction: Redaction{Hosts: []string{"acme.internal"}},
+			removed:   []string{"packages.acme.internal", "git.acme.internal"},
+			kept:      []string{"pkg:nix/billing-core@v1", `"downloadLocation":"NOASSERTION"`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Redact([]byte(statement+"\n"), tt.redaction)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var parsed map[string]interface{}
+			if err := json.Unmarshal(got, &parsed); err != nil {
+				t.Fatalf("redacted statement is not valid JSON: %v", err)
+			}
+			if !strings.Contains(string(got), `"sha256":"abc"`) {
+				t.Errorf("the subject was not kept: %s", got)
+			}
+			for _, s := range tt.removed {
+				if strings.Contains(string(got), s) {
+					t.Errorf("%s was not removed: %s", s, got)
+				}
+			}
+			for _, s := range tt.kept {
+				if !strings.Contains(string(got), s) {
+					t.Errorf("%s was removed: %s", s, got)
+				}
+			}
+		})
+	}
+}
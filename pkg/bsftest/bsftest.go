@@ -0,0 +1,171 @@
+// Package bsftest provides disposable nix stores with tiny packages, to test bsf and the tools built on it end to end
+// without the store of the host. Tests using it are skipped when nix is not installed.
+//
+//	func TestSBOM(t *testing.T) {
+//		s := bsftest.NewStore(t)
+//		lib := s.Add(bsftest.Package{Name: "libfoo", Version: "1.0", Files: map[string]string{"lib/libfoo.so": "foo"}})
+//		app := s.Add(bsftest.Package{Name: "app", Version: "2.0", Deps: []string{lib}, Files: map[string]string{"bin/app": "#!/bin/sh"}})
+//		s.Use()
+//		output := s.Result(app)
+//		...
+//	}
+//
+// The integration tests of bsf run against these stores with the integration build tag:
+//
+//	go test -tags integration ./...
+package bsftest
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	nixcmd "github.com/buildsafedev/bsf/pkg/nix/cmd"
+	nixtemplate "github.com/buildsafedev/bsf/pkg/nix/template"
+)
+
+// ResultSymlink is the name of the result symlinks of Result, as nix build names them
+const ResultSymlink = "result"
+
+// Store is a chroot store in a temporary directory, removed when the test ends
+type Store struct {
+	// Root is the directory the store paths are below, URI the store nix is given
+	Root string
+	URI  string
+
+	tb testing.TB
+}
+
+// Package is a tiny package built in the store, from the files written to its output
+type Package struct {
+	Name    string
+	Version string
+	// Deps are the store paths the package references, written to share/<name>/deps
+	Deps []string
+	// Files are the contents of the files of the output by their path in it, files in bin/ are executable
+	Files map[string]string
+	// Env is added to the environment of the derivation, e.g. meta attributes
+	Env map[string]string
+}
+
+// NewStore returns an empty chroot store. The test is skipped when nix is not installed.
+func NewStore(tb testing.TB) *Store {
+	tb.Helper()
+	if _, err := exec.LookPath("nix-build"); err != nil {
+		tb.Skip("nix is not installed")
+	}
+
+	root := tb.TempDir()
+	// the store paths are read-only, the temporary directory can't be removed before they are writable
+	tb.Cleanup(func() {
+		filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+			if err == nil && d.IsDir() {
+				os.Chmod(p, 0755)
+			}
+			return nil
+		})
+	})
+	if err := os.MkdirAll(filepath.Join(root, nixcmd.StoreDir), 0755); err != nil {
+		tb.Fatal(err)
+	}
+	return &Store{Root: root, URI: "local?root=" + root, tb: tb}
+}
+
+// Use makes bsf query the store until the test ends
+func (s *Store) Use() {
+	s.tb.Helper()
+	if err := nixcmd.SetStore(s.URI); err != nil {
+		s.tb.Fatal(err)
+	}
+	s.tb.Cleanup(func() { nixcmd.SetStore("") })
+}
+
+// Add builds the package in the store and returns its store path
+func (s *Store) Add(p Package) string {
+	s.tb.Helper()
+	cmd, cancel := nixcmd.NixCommand(context.Background(), "nix-build", "--store", s.URI, "--option", "sandbox", "false", "--no-out-link", "--expr", p.expr())
+	defer cancel()
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		s.tb.Fatalf("failed to build %s: %v\n%s", p.Name, err, stderr.String())
+	}
+	return strings.TrimSpace(stdout.String())
+}
+
+// Result links the store path from a result symlink of a new output directory, as nix build does, and returns the
+// directory
+func (s *Store) Result(storePath string) string {
+	s.tb.Helper()
+	output := s.tb.TempDir()
+	if err := os.Symlink(storePath, filepath.Join(output, ResultSymlink)); err != nil {
+		s.tb.Fatal(err)
+	}
+	return output
+}
+
+// HostPath returns where the store path is on the host
+func (s *Store) HostPath(storePath string) string {
+	return filepath.Join(s.Root, storePath)
+}
+
+// expr returns the nix expression of the derivation of the package. It is built without sandbox, with the tools on
+// the PATH of the test.
+func (p Package) expr() string {
+	var script strings.Builder
+	script.WriteString("set -e\nmkdir -p \"$out\"\n")
+	files := make([]string, 0, len(p.Files))
+	for name := range p.Files {
+		files = append(files, name)
+	}
+	sort.Strings(files)
+
+	env := map[string]string{"PATH": os.Getenv("PATH")}
+	for i, name := range files {
+		// the contents are passed in the environment, they aren't quoted for the shell
+		env[fmt.Sprintf("file%d", i)] = p.Files[name]
+		fmt.Fprintf(&script, "mkdir -p \"$out/%s\"\nprintf '%%s' \"$file%d\" > \"$out/%s\"\n", path.Dir(name), i, name)
+		if strings.HasPrefix(name, "bin/") {
+			fmt.Fprintf(&script, "chmod +x \"$out/%s\"\n", name)
+		}
+	}
+	if len(p.Deps) > 0 {
+		fmt.Fprintf(&script, "mkdir -p \"$out/share/%s\"\necho \"$deps\" > \"$out/share/%s/deps\"\n", p.Name, p.Name)
+	}
+	for k, v := range p.Env {
+		env[k] = v
+	}
+
+	var b strings.Builder
+	b.WriteString("derivation {\n")
+	fmt.Fprintf(&b, "  name = \"%s\";\n", nixtemplate.NixString(p.Name+"-"+p.Version))
+	fmt.Fprintf(&b, "  pname = \"%s\";\n", nixtemplate.NixString(p.Name))
+	fmt.Fprintf(&b, "  version = \"%s\";\n", nixtemplate.NixString(p.Version))
+	b.WriteString("  system = builtins.currentSystem;\n")
+	b.WriteString("  builder = \"/bin/sh\";\n")
+	fmt.Fprintf(&b, "  args = [ \"-c\" \"%s\" ];\n", nixtemplate.NixString(script.String()))
+	b.WriteString("  deps = [")
+	for _, dep := range p.Deps {
+		fmt.Fprintf(&b, " (builtins.storePath \"%s\")", nixtemplate.NixString(dep))
+	}
+	b.WriteString(" ];\n")
+	keys := make([]string, 0, len(env))
+	for k := range env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(&b, "  \"%s\" = \"%s\";\n", nixtemplate.NixString(k), nixtemplate.NixString(env[k]))
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
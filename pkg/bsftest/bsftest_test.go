@@ -0,0 +1,30 @@
+package bsftest
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPackageExpr(t *testing.T) {
+	p := Package{
+		Name:    "app",
+		Version: "1.0",
+		Deps:    []string{"/nix/store/00000000000000000000000000000000-libfoo-1.0"},
+		Files:   map[string]string{"bin/app": "#!/bin/sh\n", "share/doc/README": "${docs}"},
+		Env:     map[string]string{"meta": "x"},
+	}
+	expr := p.expr()
+	for _, want := range []string{
+		`name = "app-1.0";`,
+		`pname = "app";`,
+		`version = "1.0";`,
+		`(builtins.storePath "/nix/store/00000000000000000000000000000000-libfoo-1.0")`,
+		`"file1" = "\${docs}";`,
+		`chmod +x \"$out/bin/app\"`,
+		`"meta" = "x";`,
+	} {
+		if !strings.Contains(expr, want) {
+			t.Errorf("expr() has no %s:\n%s", want, expr)
+		}
+	}
+}
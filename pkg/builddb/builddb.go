@@ -0,0 +1,264 @@
+// Package builddb records the builds of bsf projects in a local database, one JSON line per build, so the trends of
+// their closures can be reported across builds, and the promotions of builds between stores. Unlike telemetry,
+// records name the project and stay on the machine.
+package builddb
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/buildsafedev/bsf/pkg/buildhost"
+	"github.com/buildsafedev/bsf/pkg/depgraph"
+	nixcmd "github.com/buildsafedev/bsf/pkg/nix/cmd"
+	"github.com/buildsafedev/bsf/pkg/nixmeta"
+	"github.com/buildsafedev/bsf/pkg/policy"
+)
+
+// SchemaVersion is the version of the record format
+const SchemaVersion = 1
+
+// StatusFailed is the status of a build that failed or was interrupted
+const StatusFailed = "failed"
+
+// Record is a build of a project
+type Record struct {
+	SchemaVersion int    `json:"schemaVersion"`
+	Project       string `json:"project"`
+	Version       string `json:"version"`
+	// Branch is the git branch the project was built from, empty outside a branch
+	Branch string `json:"branch,omitempty"`
+	// Variant is the build variant of bsf.hcl the build is of, empty for the package as declared
+	Variant   string    `json:"variant,omitempty"`
+	Time      time.Time `json:"time"`
+	StorePath string    `json:"storePath"`
+	// Output is the absolute path of the directory the artifacts of the build were written to
+	Output string `json:"output,omitempty"`
+	// Components is the number of store paths of the runtime closure
+	Components int `json:"components"`
+	// ClosureSize is the sum of the NAR sizes of the store paths the store recorded the size of, in bytes
+	ClosureSize int64 `json:"closureSize"`
+	// OpenCVEs is the number of vulnerabilities affecting the closure, nil when the build didn't scan it
+	OpenCVEs *int `json:"openCVEs,omitempty"`
+	// Licenses is the number of distinct licenses of the components
+	Licenses int `json:"licenses"`
+	// Unfree is the number of components under an unfree license
+	Unfree int `json:"unfree"`
+	// Status is StatusFailed for a build that didn't complete, empty for a build that succeeded. A failed build has
+	// no store path, output nor measures.
+	Status string `json:"status,omitempty"`
+	// Phase is the phase of the build that failed, e.g. nix build or sbom
+	Phase string `json:"phase,omitempty"`
+	// Error is why the build failed
+	Error string `json:"error,omitempty"`
+	// Builder is the fingerprint of the host and nix installation that built, empty for builds recorded before
+	// builders were
+	Builder *buildhost.Fingerprint `json:"builder,omitempty"`
+	// HashMismatches are the closure paths that didn't hash to the NAR hash the store recorded, found by bsf build
+	// --check-store or --repair
+	HashMismatches []HashMismatch `json:"hashMismatches,omitempty"`
+	// Origin is the user and host the record was exported from, user@host, empty for the builds of this machine
+	// that weren't imported back, see Export
+	Origin string `json:"origin,omitempty"`
+}
+
+// HashMismatch is a closure path whose content didn't hash to the NAR hash the store recorded, e.g. corrupted on disk
+type HashMismatch struct {
+	StorePath string `json:"storePath"`
+	Recorded  string `json:"recorded"`
+	Actual    string `json:"actual"`
+	// Repaired is true when nix store repair restored the content the store recorded, RepairError is why it couldn't
+	Repaired    bool   `json:"repaired,omitempty"`
+	RepairError string `json:"repairError,omitempty"`
+}
+
+// Failed reports if the build didn't complete
+func (r *Record) Failed() bool {
+	return r.Status == StatusFailed
+}
+
+// Series is the builds of a project, oldest first
+type Series struct {
+	Project string `json:"project"`
+	// Variant is the build variant of the records, whose trends are apart from the ones of the package as declared
+	Variant string    `json:"variant,omitempty"`
+	Records []*Record `json:"records"`
+}
+
+// Path is the file builds are recorded in
+func Path() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "bsf", "builds.jsonl"), nil
+}
+
+// Measure returns the record of the build of the project version, measured on its runtime closure
+func Measure(project, version, storePath string, g *depgraph.Graph) *Record {
+	r := &Record{SchemaVersion: SchemaVersion, Project: project, Version: version, Time: time.Now().UTC(), StorePath: storePath}
+	licenses := make(map[string]bool)
+	for _, node := range g.Nodes {
+		r.Components++
+		if size, err := strconv.ParseInt(node.Attrs[policy.AttrNarSize], 10, 64); err == nil {
+			r.ClosureSize += size
+		}
+		unfree := false
+		for _, l := range nodeLicenses(node.Attrs) {
+			licenses[l] = true
+			unfree = unfree || IsUnfree(l)
+		}
+		if unfree {
+			r.Unfree++
+		}
+		if recorded, actual, ok := nixcmd.HashMismatch(node.Attrs); ok {
+			r.HashMismatches = append(r.HashMismatches, HashMismatch{
+				StorePath:   node.StorePath(),
+				Recorded:    recorded,
+				Actual:      actual,
+				Repaired:    node.Attrs[nixcmd.AttrRepaired] == "true",
+				RepairError: node.Attrs[nixcmd.AttrRepairError],
+			})
+		}
+	}
+	sort.Slice(r.HashMismatches, func(i, j int) bool { return r.HashMismatches[i].StorePath < r.HashMismatches[j].StorePath })
+	r.Licenses = len(licenses)
+	return r
+}
+
+// Failure returns the record of the build of the project that failed in the phase
+func Failure(project, variant, phase string, cause error) *Record {
+	r := &Record{SchemaVersion: SchemaVersion, Project: project, Variant: variant, Time: time.Now().UTC(), Status: StatusFailed, Phase: phase}
+	if cause != nil {
+		r.Error = cause.Error()
+	}
+	return r
+}
+
+// IsUnfree reports if the license is one of the unfree licenses of nixpkgs, which have no SPDX identifier and are
+// recorded by their short name, e.g. unfree or unfreeRedistributable
+func IsUnfree(license string) bool {
+	return strings.HasPrefix(strings.ToLower(license), "unfree")
+}
+
+// nodeLicenses returns the licenses of a node: its own, or those of the packages it wraps
+func nodeLicenses(attrs map[string]string) []string {
+	if l := strings.Fields(attrs["licenses"]); len(l) > 0 {
+		return l
+	}
+	return strings.Fields(attrs[nixmeta.AttrInheritedLicenses])
+}
+
+// Append records the build
+func Append(r *Record) error {
+	path, err := Path()
+	if err != nil {
+		return err
+	}
+	return appendLine(path, r)
+}
+
+// Records returns the recorded builds
+func Records() ([]*Record, error) {
+	path, err := Path()
+	if err != nil {
+		return nil, err
+	}
+	return readLines(path, func(r *Record) bool { return r.SchemaVersion == SchemaVersion })
+}
+
+// Build returns the last recorded build of the store path, nil when it wasn't recorded
+func Build(records []*Record, storePath string) *Record {
+	var last *Record
+	for _, r := range records {
+		if !r.Failed() && r.StorePath == storePath && (last == nil || !r.Time.Before(last.Time)) {
+			last = r
+		}
+	}
+	return last
+}
+
+// appendLine appends the value to the JSON lines file
+func appendLine(path string, v any) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// readLines reads the values of the JSON lines file the valid function accepts
+func readLines[T any](path string, valid func(*T) bool) ([]*T, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return make([]*T, 0), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return decodeLines(f, valid)
+}
+
+// decodeLines decodes the values of the JSON lines the valid function accepts
+func decodeLines[T any](r io.Reader, valid func(*T) bool) ([]*T, error) {
+	values := make([]*T, 0)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		v := new(T)
+		// lines of another schema, or truncated by an interrupted run, are skipped
+		if err := json.Unmarshal(scanner.Bytes(), v); err != nil || !valid(v) {
+			continue
+		}
+		values = append(values, v)
+	}
+	return values, scanner.Err()
+}
+
+// Trends groups the records of the builds that succeeded by project and variant, sorted by name, and keeps the last
+// limit builds of each when limit is set
+func Trends(records []*Record, limit int) []Series {
+	type key struct{ project, variant string }
+	byProject := make(map[key][]*Record)
+	for _, r := range records {
+		if r.Failed() {
+			continue
+		}
+		k := key{r.Project, r.Variant}
+		byProject[k] = append(byProject[k], r)
+	}
+
+	series := make([]Series, 0, len(byProject))
+	for k, rs := range byProject {
+		sort.SliceStable(rs, func(i, j int) bool { return rs[i].Time.Before(rs[j].Time) })
+		if limit > 0 && len(rs) > limit {
+			rs = rs[len(rs)-limit:]
+		}
+		series = append(series, Series{Project: k.project, Variant: k.variant, Records: rs})
+	}
+	sort.Slice(series, func(i, j int) bool {
+		if series[i].Project != series[j].Project {
+			return series[i].Project < series[j].Project
+		}
+		return series[i].Variant < series[j].Variant
+	})
+	return series
+}
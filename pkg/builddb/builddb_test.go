@@ -0,0 +1,333 @@
+package builddb
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/buildsafedev/bsf/pkg/depgraph"
+)
+
+func TestMeasure(t *testing.T) {
+	g := depgraph.New()
+	g.AddNode("aaa-app-1.0", map[string]string{"narSize": "100", "licenses": "MIT"})
+	g.AddNode("bbb-openssl-3.0", map[string]string{"narSize": "200", "licenses": "Apache-2.0 MIT"})
+	g.AddNode("ccc-driver-1.2", map[string]string{"licenses": "unfreeRedistributable"})
+	g.AddNode("ddd-wrapper", map[string]string{"narSize": "5", "inherited_licenses": "unfree", "hash_mismatch": "recorded actual", "repaired": "true"})
+
+	r := Measure("app", "1.0", "/nix/store/aaa-app-1.0", g)
+	if r.Components != 4 || r.ClosureSize != 305 {
+		t.Errorf("expected 4 components of 305 bytes, got %d of %d", r.Components, r.ClosureSize)
+	}
+	if r.Licenses != 4 || r.Unfree != 2 {
+		t.Errorf("expected 4 licenses and 2 unfree components, got %d and %d", r.Licenses, r.Unfree)
+	}
+	if r.OpenCVEs != nil {
+		t.Errorf("expected no CVE count of an unscanned build, got %d", *r.OpenCVEs)
+	}
+	if len(r.HashMismatches) != 1 || r.HashMismatches[0] != (HashMismatch{StorePath: "/nix/store/ddd-wrapper", Recorded: "recorded", Actual: "actual", Repaired: true}) {
+		t.Errorf("unexpected hash mismatches %+v", r.HashMismatches)
+	}
+}
+
+func TestAppendAndTrends(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	records, err := Records()
+	if err != nil || len(records) != 0 {
+		t.Fatalf("expected no records, got %v %v", records, err)
+	}
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	builds := []struct {
+		project    string
+		day        int
+		components int
+	}{
+		{"web", 2, 12},
+		{"api", 0, 40},
+		{"web", 0, 10},
+		{"web", 1, 11},
+	}
+	for _, b := range builds {
+		r := &Record{SchemaVersion: SchemaVersion, Project: b.project, Time: start.AddDate(0, 0, b.day), Components: b.components}
+		if err := Append(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	records, err = Records()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != len(builds) {
+		t.Fatalf("expected %d records, got %d", len(builds), len(records))
+	}
+
+	tests := []struct {
+		name  string
+		limit int
+		want  map[string][]int
+	}{
+		{name: "all builds", want: map[string][]int{"api": {40}, "web": {10, 11, 12}}},
+		{name: "last builds", limit: 2, want: map[string][]int{"api": {40}, "web": {11, 12}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			series := Trends(records, tt.limit)
+			if len(series) != 2 || series[0].Project != "api" {
+				t.Fatalf("expected the series of api and web, got %+v", series)
+			}
+			for _, s := range series {
+				got := make([]int, 0)
+				for _, r := range s.Records {
+					got = append(got, r.Components)
+				}
+				if len(got) != len(tt.want[s.Project]) {
+					t.Fatalf("%s: expected %v, got %v", s.Project, tt.want[s.Project], got)
+				}
+				for i := range got {
+					if got[i] != tt.want[s.Project][i] {
+						t.Errorf("%s: expected %v, got %v", s.Project, tt.want[s.Project], got)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestTrendsVariants(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	records := []*Record{
+		{Project: "web", Time: start.AddDate(0, 0, 1), Components: 11},
+		{Project: "web", Variant: "fips", Time: start, Components: 14},
+		{Project: "web", Time: start, Components: 10},
+	}
+	series := Trends(records, 0)
+	if len(series) != 2 || series[0].Variant != "" || series[1].Variant != "fips" {
+		t.Fatalf("expected the series of web and its fips variant, got %+v", series)
+	}
+	if len(series[0].Records) != 2 || len(series[1].Records) != 1 || series[1].Records[0].Components != 14 {
+		t.Errorf("the builds of the fips variant are mixed with the others: %+v", series)
+	}
+}
+
+func TestFailure(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	failed := Failure("web", "", "sbom", errors.New("interrupted"))
+	failed.Time = start.AddDate(0, 0, 1)
+	records := []*Record{
+		{Project: "web", Time: start, StorePath: "/nix/store/abc-web-1.0", Components: 10},
+		failed,
+	}
+	if !failed.Failed() || failed.Phase != "sbom" || failed.Error != "interrupted" || records[0].Failed() {
+		t.Fatalf("unexpected failure record %+v", failed)
+	}
+
+	series := Trends(records, 0)
+	if len(series) != 1 || len(series[0].Records) != 1 || series[0].Records[0].Failed() {
+		t.Errorf("expected the trends of the build that succeeded only, got %+v", series)
+	}
+	if b := Build(records, ""); b != nil {
+		t.Errorf("expected no build without a store path, got %+v", b)
+	}
+	// the failure doesn't count in the builds the retention keeps
+	if expired := ExpiredBuilds(records, "web", Retention{KeepBuilds: 1}, start.AddDate(0, 0, 2)); len(expired) != 0 {
+		t.Errorf("expected no build to expire, got %+v", expired)
+	}
+}
+
+func TestPromotions(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	records := []*Record{
+		{Project: "web", Version: "1.0", StorePath: "/nix/store/aaaa-web-1.0", Time: start},
+		{Project: "web", Version: "1.0-rebuilt", StorePath: "/nix/store/aaaa-web-1.0", Time: start.AddDate(0, 0, 1)},
+		{Project: "api", Version: "2.0", StorePath: "/nix/store/bbbb-api-2.0", Time: start},
+	}
+	if b := Build(records, "/nix/store/aaaa-web-1.0"); b == nil || b.Version != "1.0-rebuilt" {
+		t.Errorf("Build() = %+v, want the last build of web", b)
+	}
+	if b := Build(records, "/nix/store/cccc-other"); b != nil {
+		t.Errorf("Build() of an unrecorded store path = %+v", b)
+	}
+
+	p := &Promotion{SchemaVersion: SchemaVersion, Project: "web", StorePath: "/nix/store/aaaa-web-1.0", To: "s3://prod", Paths: 12}
+	if err := AppendPromotion(p); err != nil {
+		t.Fatal(err)
+	}
+	promotions, err := Promotions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(promotions) != 1 || promotions[0].To != "s3://prod" || promotions[0].Paths != 12 {
+		t.Errorf("Promotions() = %+v", promotions)
+	}
+}
+
+func TestRetention(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	day := func(d int) time.Time { return now.AddDate(0, 0, -d) }
+	records := []*Record{
+		{Project: "web", Branch: "main", StorePath: "/nix/store/a-web", Time: day(1)},
+		{Project: "web", Branch: "main", StorePath: "/nix/store/b-web", Time: day(2)},
+		{Project: "web", Branch: "main", StorePath: "/nix/store/c-web", Time: day(3)},
+		{Project: "web", Branch: "feature", StorePath: "/nix/store/d-web", Time: day(100)},
+		{Project: "api", Branch: "main", StorePath: "/nix/store/e-api", Time: day(200)},
+	}
+
+	tests := []struct {
+		name string
+		r    Retention
+		want []string
+	}{
+		{name: "keep builds per branch", r: Retention{KeepBuilds: 2}, want: []string{"/nix/store/c-web"}},
+		{name: "max age", r: Retention{MaxAge: 90 * 24 * time.Hour}, want: []string{"/nix/store/d-web"}},
+		{name: "both", r: Retention{KeepBuilds: 1, MaxAge: 90 * 24 * time.Hour}, want: []string{"/nix/store/d-web", "/nix/store/c-web", "/nix/store/b-web"}},
+		{name: "none", r: Retention{}, want: []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := make([]string, 0)
+			for _, r := range ExpiredBuilds(records, "web", tt.r, now) {
+				got = append(got, r.StorePath)
+			}
+			if strings.Join(got, " ") != strings.Join(tt.want, " ") {
+				t.Errorf("ExpiredBuilds() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	for _, r := range records {
+		r.SchemaVersion = SchemaVersion
+		if err := Append(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := RemoveBuilds(ExpiredBuilds(records, "web", Retention{KeepBuilds: 1}, now)); err != nil {
+		t.Fatal(err)
+	}
+	left, err := Records()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(left) != 3 || left[0].StorePath != "/nix/store/a-web" {
+		t.Errorf("Records() after RemoveBuilds = %+v", left)
+	}
+
+	// the version, commit and date tags of an image are pushed together
+	tags := []*Tag{
+		{Project: "web", Branch: "main", Repository: "ghcr.io/acme/web", Tag: "1.1", Digest: "sha256:new", Time: day(1)},
+		{Project: "web", Branch: "main", Repository: "ghcr.io/acme/web", Tag: "1a2b3c4", Digest: "sha256:new", Time: day(1)},
+		{Project: "web", Branch: "main", Repository: "ghcr.io/acme/web", Tag: "1.0", Digest: "sha256:old", Time: day(5)},
+		{Project: "web", Branch: "main", Repository: "ghcr.io/acme/web", Tag: "0d9e8f7", Digest: "sha256:old", Time: day(5)},
+		{Project: "web", Branch: "main", Repository: "quay.io/acme/web", Tag: "1.0", Digest: "sha256:old", Time: day(5)},
+	}
+	expired := ExpiredTags(tags, "web", Retention{KeepBuilds: 1}, now)
+	if len(expired) != 2 || expired[0].Tag != "1.0" || expired[1].Tag != "0d9e8f7" {
+		t.Errorf("ExpiredTags() = %+v, want the tags of the old image in ghcr.io", expired)
+	}
+	for _, tag := range tags {
+		tag.SchemaVersion = SchemaVersion
+		if err := AppendTag(tag); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := RemoveTags(expired); err != nil {
+		t.Fatal(err)
+	}
+	if left, err := Tags(); err != nil || len(left) != 3 {
+		t.Errorf("Tags() after RemoveTags = %+v, %v", left, err)
+	}
+}
+
+func TestExportImport(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	local := &Record{SchemaVersion: SchemaVersion, Project: "web", StorePath: "/nix/store/a-web", Output: "/home/dev/web/bsf-result", Time: start}
+	if err := Append(local); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := Export(&buf, []*Record{local}, "dev@laptop"); err != nil {
+		t.Fatal(err)
+	}
+	exported, err := ReadExport(&buf)
+	if err != nil || len(exported) != 1 {
+		t.Fatalf("ReadExport() = %v, %v", exported, err)
+	}
+	if exported[0].Origin != "dev@laptop" || exported[0].Output != "" || local.Output == "" {
+		t.Errorf("unexpected exported record %+v", exported[0])
+	}
+
+	// the records exported from this machine aren't imported back, nor the duplicates of an export
+	ci := &Record{SchemaVersion: SchemaVersion, Project: "web", StorePath: "/nix/store/b-web", Output: "/runner/bsf-result", Time: start.Add(time.Hour), Origin: "ci@runner"}
+	n, err := Import([]*Record{exported[0], ci, ci})
+	if err != nil || n != 1 {
+		t.Fatalf("Import() = %d, %v, want 1 build imported", n, err)
+	}
+	records, err := Records()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || records[1].Origin != "ci@runner" || records[1].Output != "" {
+		t.Errorf("Records() after Import = %+v", records)
+	}
+	if since := Since(records, start.Add(time.Minute)); len(since) != 1 || since[0].StorePath != "/nix/store/b-web" {
+		t.Errorf("Since() = %+v", since)
+	}
+}
+
+func TestSync(t *testing.T) {
+	var shared []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPut:
+			shared, _ = io.ReadAll(r.Body)
+		case shared == nil:
+			http.NotFound(w, r)
+		default:
+			w.Write(shared)
+		}
+	}))
+	defer server.Close()
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, location := range []string{t.TempDir(), server.URL + "/bsf"} {
+		// two machines sync in turn, the first one sees the builds of the second one on its next sync
+		machines := []string{t.TempDir(), t.TempDir()}
+		for i, dir := range machines {
+			t.Setenv("XDG_CACHE_HOME", dir)
+			if err := Append(&Record{SchemaVersion: SchemaVersion, Project: "web", StorePath: fmt.Sprintf("/nix/store/%d-web", i), Time: start.Add(time.Duration(i) * time.Hour)}); err != nil {
+				t.Fatal(err)
+			}
+			if n, err := Sync(context.Background(), location, fmt.Sprintf("dev%d@host", i)); err != nil || n != i {
+				t.Fatalf("Sync(%s) = %d, %v, want %d builds imported", location, n, err, i)
+			}
+		}
+		t.Setenv("XDG_CACHE_HOME", machines[0])
+		if n, err := Sync(context.Background(), location, "dev0@host"); err != nil || n != 1 {
+			t.Fatalf("Sync(%s) = %d, %v, want the build of the other machine imported", location, n, err)
+		}
+		records, err := Records()
+		if err != nil || len(records) != 2 || records[1].Origin != "dev1@host" {
+			t.Errorf("Records() after Sync(%s) = %+v, %v", location, records, err)
+		}
+	}
+
+	if _, err := Sync(context.Background(), "ftp://builds", "dev@host"); err == nil {
+		t.Error("Sync() accepted an unsupported location")
+	}
+}
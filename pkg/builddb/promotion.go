@@ -0,0 +1,49 @@
+package builddb
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Promotion is the copy of the closure of a build from a store to another, see bsf promote
+type Promotion struct {
+	SchemaVersion int       `json:"schemaVersion"`
+	Project       string    `json:"project,omitempty"`
+	Version       string    `json:"version,omitempty"`
+	Time          time.Time `json:"time"`
+	StorePath     string    `json:"storePath"`
+	From          string    `json:"from,omitempty"`
+	To            string    `json:"to"`
+	// Paths is the number of store paths of the closure promoted
+	Paths int `json:"paths"`
+	// KeyName is the name of the key the paths were signed with in the destination
+	KeyName string `json:"keyName,omitempty"`
+}
+
+// PromotionsPath is the file promotions are recorded in
+func PromotionsPath() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "bsf", "promotions.jsonl"), nil
+}
+
+// AppendPromotion records the promotion
+func AppendPromotion(p *Promotion) error {
+	path, err := PromotionsPath()
+	if err != nil {
+		return err
+	}
+	return appendLine(path, p)
+}
+
+// Promotions returns the recorded promotions
+func Promotions() ([]*Promotion, error) {
+	path, err := PromotionsPath()
+	if err != nil {
+		return nil, err
+	}
+	return readLines(path, func(p *Promotion) bool { return p.SchemaVersion == SchemaVersion })
+}
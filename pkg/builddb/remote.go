@@ -0,0 +1,47 @@
+package builddb
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/buildsafedev/bsf/pkg/location"
+)
+
+// sharedFile is the file of the records of the team at the shared location
+const sharedFile = "builds.jsonl"
+
+// Sync merges the records at the shared location with the local ones: the records of the other machines are imported,
+// then the records of both are written back, the local ones with origin as their origin. Locations are the ones of
+// package location. It returns the number of records imported.
+// Machines syncing at the same time can overwrite each other's records, they are written back on their next sync.
+func Sync(ctx context.Context, loc, origin string) (int, error) {
+	var shared []*Record
+	data, err := location.Get(ctx, loc, sharedFile)
+	switch {
+	case errors.Is(err, location.ErrNotFound):
+	case err != nil:
+		return 0, err
+	default:
+		shared, err = ReadExport(bytes.NewReader(data))
+		if err != nil {
+			return 0, fmt.Errorf("invalid records at %s: %v", loc, err)
+		}
+	}
+
+	imported, err := Import(shared)
+	if err != nil {
+		return imported, err
+	}
+
+	records, err := Records()
+	if err != nil {
+		return imported, err
+	}
+	var buf bytes.Buffer
+	if err := Export(&buf, records, origin); err != nil {
+		return imported, err
+	}
+	return imported, location.Put(ctx, loc, sharedFile, "application/jsonl", buf.Bytes())
+}
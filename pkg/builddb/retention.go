@@ -0,0 +1,226 @@
+package builddb
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// Retention is how long builds and the image tags pushed for them are kept, see bsf prune
+type Retention struct {
+	// KeepBuilds is the number of most recent builds kept per project and branch, all of them when 0
+	KeepBuilds int
+	// MaxAge is the age after which builds expire even when they are among the most recent, never when 0
+	MaxAge time.Duration
+}
+
+// Tag is an immutable tag pushed to a registry by bsf oci --push
+type Tag struct {
+	SchemaVersion int       `json:"schemaVersion"`
+	Project       string    `json:"project"`
+	Branch        string    `json:"branch,omitempty"`
+	Time          time.Time `json:"time"`
+	// Registry is the name of the registry block the tag was pushed to
+	Registry   string `json:"registry"`
+	Repository string `json:"repository"`
+	Tag        string `json:"tag"`
+	Digest     string `json:"digest"`
+}
+
+// TagsPath is the file pushed tags are recorded in
+func TagsPath() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "bsf", "tags.jsonl"), nil
+}
+
+// AppendTag records the pushed tag
+func AppendTag(t *Tag) error {
+	path, err := TagsPath()
+	if err != nil {
+		return err
+	}
+	return appendLine(path, t)
+}
+
+// Tags returns the recorded tags
+func Tags() ([]*Tag, error) {
+	path, err := TagsPath()
+	if err != nil {
+		return nil, err
+	}
+	return readLines(path, func(t *Tag) bool { return t.SchemaVersion == SchemaVersion })
+}
+
+// ExpiredBuilds returns the records of the project the retention expires at now: those older than MaxAge and those
+// beyond the KeepBuilds most recent of their branch. Failed builds are ranked apart, so they don't expire the builds
+// that succeeded.
+func ExpiredBuilds(records []*Record, project string, r Retention, now time.Time) []*Record {
+	type group struct {
+		branch string
+		failed bool
+	}
+	byBranch := make(map[group][]*Record)
+	for _, rec := range records {
+		if rec.Project == project {
+			g := group{rec.Branch, rec.Failed()}
+			byBranch[g] = append(byBranch[g], rec)
+		}
+	}
+
+	expired := make([]*Record, 0)
+	for _, rs := range byBranch {
+		// newest first
+		sort.SliceStable(rs, func(i, j int) bool { return rs[i].Time.After(rs[j].Time) })
+		for i, rec := range rs {
+			if r.expires(i, rec.Time, now) {
+				expired = append(expired, rec)
+			}
+		}
+	}
+	sort.SliceStable(expired, func(i, j int) bool { return expired[i].Time.Before(expired[j].Time) })
+	return expired
+}
+
+// ExpiredTags returns the tags of the project the retention expires at now. The tags of an image are pushed together,
+// so KeepBuilds counts the images, by digest, pushed to each repository from a branch.
+func ExpiredTags(tags []*Tag, project string, r Retention, now time.Time) []*Tag {
+	type group struct {
+		branch, repository string
+	}
+	// the last time each image was pushed, per group
+	pushed := make(map[group]map[string]time.Time)
+	for _, t := range tags {
+		if t.Project != project {
+			continue
+		}
+		g := group{t.Branch, t.Repository}
+		if pushed[g] == nil {
+			pushed[g] = make(map[string]time.Time)
+		}
+		if t.Time.After(pushed[g][t.Digest]) {
+			pushed[g][t.Digest] = t.Time
+		}
+	}
+	rank := make(map[group]map[string]int)
+	for g, digests := range pushed {
+		order := make([]string, 0, len(digests))
+		for d := range digests {
+			order = append(order, d)
+		}
+		sort.Slice(order, func(i, j int) bool { return digests[order[i]].After(digests[order[j]]) })
+		rank[g] = make(map[string]int, len(order))
+		for i, d := range order {
+			rank[g][d] = i
+		}
+	}
+
+	expired := make([]*Tag, 0)
+	for _, t := range tags {
+		if t.Project != project {
+			continue
+		}
+		g := group{t.Branch, t.Repository}
+		if r.expires(rank[g][t.Digest], pushed[g][t.Digest], now) {
+			expired = append(expired, t)
+		}
+	}
+	return expired
+}
+
+// expires reports if the entry of the rank, 0 being the most recent, created at the time expires at now
+func (r Retention) expires(rank int, created, now time.Time) bool {
+	if r.KeepBuilds > 0 && rank >= r.KeepBuilds {
+		return true
+	}
+	return r.MaxAge > 0 && now.Sub(created) > r.MaxAge
+}
+
+// RemoveBuilds removes the records from the database
+func RemoveBuilds(records []*Record) error {
+	path, err := Path()
+	if err != nil {
+		return err
+	}
+	removed := make(map[recordKey]bool, len(records))
+	for _, r := range records {
+		removed[keyOf(r)] = true
+	}
+	return removeLines(path, func(r *Record) bool { return r.SchemaVersion == SchemaVersion && removed[keyOf(r)] })
+}
+
+// recordKey identifies a record, its time is as precise as the JSON line
+type recordKey struct {
+	project, storePath string
+	time               int64
+}
+
+func keyOf(r *Record) recordKey {
+	return recordKey{r.Project, r.StorePath, r.Time.UnixNano()}
+}
+
+// RemoveTags removes the tags from the database
+func RemoveTags(tags []*Tag) error {
+	path, err := TagsPath()
+	if err != nil {
+		return err
+	}
+	removed := make(map[string]bool, len(tags))
+	for _, t := range tags {
+		removed[tagKey(t)] = true
+	}
+	return removeLines(path, func(t *Tag) bool { return t.SchemaVersion == SchemaVersion && removed[tagKey(t)] })
+}
+
+func tagKey(t *Tag) string {
+	return t.Repository + ":" + t.Tag + "@" + t.Digest + " " + t.Time.Format(time.RFC3339Nano)
+}
+
+// removeLines rewrites the JSON lines file without the values the remove function accepts. Lines it can't read are
+// kept, the file is replaced at once so an interrupted run leaves it whole.
+func removeLines[T any](path string, remove func(*T) bool) error {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var kept bytes.Buffer
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		v := new(T)
+		if err := json.Unmarshal(scanner.Bytes(), v); err == nil && remove(v) {
+			continue
+		}
+		kept.Write(scanner.Bytes())
+		kept.WriteByte('\n')
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(kept.Bytes()); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,95 @@
+package builddb
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"os/user"
+	"time"
+)
+
+// LocalOrigin returns the origin of the records of this machine, user@host
+func LocalOrigin() string {
+	name := os.Getenv("USER")
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		name = u.Username
+	}
+	host, _ := os.Hostname()
+	if name == "" {
+		return host
+	}
+	return name + "@" + host
+}
+
+// Export writes the records as JSON lines, the format of the database, so they can be imported in the database of
+// another machine. Records without an origin are given origin. Their output directory is left out, it only exists on
+// this machine.
+func Export(w io.Writer, records []*Record, origin string) error {
+	enc := json.NewEncoder(w)
+	for _, r := range records {
+		e := *r
+		e.Output = ""
+		if e.Origin == "" {
+			e.Origin = origin
+		}
+		if err := enc.Encode(&e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadExport reads the records of an export, the lines of another schema are skipped
+func ReadExport(r io.Reader) ([]*Record, error) {
+	return decodeLines(r, func(r *Record) bool { return r.SchemaVersion == SchemaVersion })
+}
+
+// Since returns the records of the builds at or after t
+func Since(records []*Record, t time.Time) []*Record {
+	kept := make([]*Record, 0, len(records))
+	for _, r := range records {
+		if !r.Time.Before(t) {
+			kept = append(kept, r)
+		}
+	}
+	return kept
+}
+
+// Missing returns the imported records that aren't in records, once each. A record is the same build as another when
+// they are of the same project and store path at the same time, whatever their origin: the records exported from this
+// machine and imported back aren't duplicated.
+func Missing(records, imported []*Record) []*Record {
+	known := make(map[recordKey]bool, len(records))
+	for _, r := range records {
+		known[keyOf(r)] = true
+	}
+
+	missing := make([]*Record, 0)
+	for _, r := range imported {
+		key := keyOf(r)
+		if known[key] {
+			continue
+		}
+		known[key] = true
+		missing = append(missing, r)
+	}
+	return missing
+}
+
+// Import appends the imported records the database doesn't have, without their output directory, and returns how
+// many it appended
+func Import(imported []*Record) (int, error) {
+	records, err := Records()
+	if err != nil {
+		return 0, err
+	}
+
+	missing := Missing(records, imported)
+	for i, r := range missing {
+		r.Output = ""
+		if err := Append(r); err != nil {
+			return i, err
+		}
+	}
+	return len(missing), nil
+}
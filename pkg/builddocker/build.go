@@ -12,6 +12,7 @@ import (
 	"time"
 
 	"github.com/buildsafedev/bsf/pkg/hcl2nix"
+	"github.com/buildsafedev/bsf/pkg/toolchain"
 )
 
 type dockerfileCfg struct {
@@ -107,7 +108,7 @@ func convertEnvsToMap(envs []string) map[string]string {
 
 // GetSnapshotter gets the containerd snapshotter value
 func GetSnapshotter() (string, error) {
-	script := exec.Command("docker", "info", "-f", " '{{ .DriverStatus }}' ")
+	script := toolchain.Check(exec.Command("docker", "info", "-f", " '{{ .DriverStatus }}' "))
 	out, err := script.CombinedOutput()
 	if err != nil {
 		return "", fmt.Errorf("error fetching  DriverStatus: %s", err)
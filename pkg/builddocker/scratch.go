@@ -0,0 +1,257 @@
+package builddocker
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/buildsafedev/bsf/pkg/oci"
+)
+
+// ScratchImage is an image built by bsf, as the Dockerfile adding its layers to an empty image describes it
+type ScratchImage struct {
+	// Manifest and Config are the digests of the manifest and config of the image
+	Manifest string
+	Config   string
+	Platform string
+	Layers   []ScratchLayer
+	Env      []string
+	// Entrypoint and Cmd are nil when the image doesn't set them
+	Entrypoint   []string
+	Cmd          []string
+	WorkingDir   string
+	User         string
+	ExposedPorts []string
+	Labels       map[string]string
+	StopSignal   string
+}
+
+// ScratchLayer is a layer of an image, as the image manifest records it
+type ScratchLayer struct {
+	Digest string
+	// DiffID is the digest of the uncompressed layer
+	DiffID    string
+	MediaType string
+	Size      int64
+}
+
+type scratchManifest struct {
+	Config struct {
+		Digest string `json:"digest"`
+	} `json:"config"`
+	Layers []struct {
+		MediaType string `json:"mediaType"`
+		Digest    string `json:"digest"`
+		Size      int64  `json:"size"`
+	} `json:"layers"`
+}
+
+type scratchConfig struct {
+	Architecture string `json:"architecture"`
+	OS           string `json:"os"`
+	Config       struct {
+		Env          []string            `json:"Env"`
+		Entrypoint   []string            `json:"Entrypoint"`
+		Cmd          []string            `json:"Cmd"`
+		WorkingDir   string              `json:"WorkingDir"`
+		User         string              `json:"User"`
+		ExposedPorts map[string]struct{} `json:"ExposedPorts"`
+		Labels       map[string]string   `json:"Labels"`
+		StopSignal   string              `json:"StopSignal"`
+	} `json:"config"`
+	RootFS struct {
+		DiffIDs []string `json:"diff_ids"`
+	} `json:"rootfs"`
+}
+
+// ReadScratchImage reads the image in dir, in the dir: layout bsf oci builds it in
+func ReadScratchImage(dir string) (*ScratchImage, error) {
+	data, err := os.ReadFile(filepath.Join(dir, "manifest.json"))
+	if err != nil {
+		return nil, err
+	}
+	manifest := &scratchManifest{}
+	if err := json.Unmarshal(data, manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest: %v", err)
+	}
+	configData, err := os.ReadFile(blobFile(dir, manifest.Config.Digest))
+	if err != nil {
+		return nil, err
+	}
+	config := &scratchConfig{}
+	if err := json.Unmarshal(configData, config); err != nil {
+		return nil, fmt.Errorf("failed to parse image config: %v", err)
+	}
+	if len(config.RootFS.DiffIDs) != len(manifest.Layers) {
+		return nil, fmt.Errorf("the image config has %d layers, its manifest %d", len(config.RootFS.DiffIDs), len(manifest.Layers))
+	}
+
+	img := &ScratchImage{
+		Manifest:   oci.DigestOf(data),
+		Config:     manifest.Config.Digest,
+		Platform:   config.OS + "/" + config.Architecture,
+		Env:        config.Config.Env,
+		Entrypoint: config.Config.Entrypoint,
+		Cmd:        config.Config.Cmd,
+		WorkingDir: config.Config.WorkingDir,
+		User:       config.Config.User,
+		Labels:     config.Config.Labels,
+		StopSignal: config.Config.StopSignal,
+	}
+	for i, l := range manifest.Layers {
+		// ADD extracts tar archives compressed with gzip, bzip2 or xz
+		if strings.HasSuffix(l.MediaType, "zstd") {
+			return nil, fmt.Errorf("layer %s is compressed with zstd, which Dockerfiles can't add", l.Digest)
+		}
+		img.Layers = append(img.Layers, ScratchLayer{Digest: l.Digest, DiffID: config.RootFS.DiffIDs[i], MediaType: l.MediaType, Size: l.Size})
+	}
+	for port := range config.Config.ExposedPorts {
+		img.ExposedPorts = append(img.ExposedPorts, port)
+	}
+	sort.Strings(img.ExposedPorts)
+	return img, nil
+}
+
+// LayerFile is the file of the layer in the build context of the Dockerfile, named by its digest
+func (l ScratchLayer) LayerFile() string {
+	ext := ".tar"
+	if strings.HasSuffix(l.MediaType, "gzip") {
+		ext = ".tar.gz"
+	}
+	return "layers/" + digestHex(l.Digest) + ext
+}
+
+// WriteDockerfile writes the Dockerfile adding the layers of the image to an empty image, with its config. The same
+// image always gives the same Dockerfile.
+func (img *ScratchImage) WriteDockerfile(w io.Writer) error {
+	var b strings.Builder
+	b.WriteString("# Generated by bsf generate dockerfile from an image built by bsf, do not edit.\n")
+	b.WriteString("# The image built by bsf is the artifact that ships, this Dockerfile describes it for review. Its layers\n")
+	b.WriteString("# are the layer blobs of the image, named by their digest in the build context.\n")
+	fmt.Fprintf(&b, "#\n# image manifest: %s\n# image config:   %s\n# platform:       %s\n\n", img.Manifest, img.Config, img.Platform)
+
+	b.WriteString("FROM scratch\n")
+	for _, l := range img.Layers {
+		fmt.Fprintf(&b, "\n# layer %s, diff ID %s, %d bytes\n", l.Digest, l.DiffID, l.Size)
+		fmt.Fprintf(&b, "ADD %s /\n", l.LayerFile())
+	}
+
+	if len(img.Env) > 0 || len(img.Labels) > 0 || img.WorkingDir != "" || img.User != "" || len(img.ExposedPorts) > 0 ||
+		img.StopSignal != "" || img.Entrypoint != nil || img.Cmd != nil {
+		b.WriteString("\n")
+	}
+	for _, e := range img.Env {
+		key, value, _ := strings.Cut(e, "=")
+		fmt.Fprintf(&b, "ENV %s=%s\n", key, toJSON(value))
+	}
+	labels := make([]string, 0, len(img.Labels))
+	for k := range img.Labels {
+		labels = append(labels, k)
+	}
+	sort.Strings(labels)
+	for _, k := range labels {
+		fmt.Fprintf(&b, "LABEL %s=%s\n", toJSON(k), toJSON(img.Labels[k]))
+	}
+	if len(img.ExposedPorts) > 0 {
+		fmt.Fprintf(&b, "EXPOSE %s\n", strings.Join(img.ExposedPorts, " "))
+	}
+	if img.WorkingDir != "" {
+		fmt.Fprintf(&b, "WORKDIR %s\n", img.WorkingDir)
+	}
+	if img.User != "" {
+		fmt.Fprintf(&b, "USER %s\n", img.User)
+	}
+	if img.StopSignal != "" {
+		fmt.Fprintf(&b, "STOPSIGNAL %s\n", img.StopSignal)
+	}
+	if img.Entrypoint != nil {
+		fmt.Fprintf(&b, "ENTRYPOINT %s\n", toJSON(img.Entrypoint))
+	}
+	if img.Cmd != nil {
+		fmt.Fprintf(&b, "CMD %s\n", toJSON(img.Cmd))
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// WriteContext writes the build context of the Dockerfile to dir: the Dockerfile and the layers of the image in src,
+// linked when both are on the same filesystem
+func (img *ScratchImage) WriteContext(src, dir string) error {
+	if err := os.MkdirAll(filepath.Join(dir, "layers"), 0755); err != nil {
+		return err
+	}
+	for _, l := range img.Layers {
+		dst := filepath.Join(dir, l.LayerFile())
+		if _, err := os.Stat(dst); err == nil {
+			continue
+		}
+		if err := linkOrCopy(blobFile(src, l.Digest), dst); err != nil {
+			return fmt.Errorf("failed to add layer %s to the build context: %v", l.Digest, err)
+		}
+	}
+
+	f, err := os.Create(filepath.Join(dir, "Dockerfile"))
+	if err != nil {
+		return err
+	}
+	if err := img.WriteDockerfile(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func linkOrCopy(src, dst string) error {
+	if err := os.Link(src, dst); err == nil {
+		return nil
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// blobFile is the file of the blob in the dir: layout, where blobs are named by their hex digest, or in the OCI layout,
+// where they are under blobs/<algorithm>/
+func blobFile(dir, digest string) string {
+	algo, h, _ := strings.Cut(digest, ":")
+	if path := filepath.Join(dir, "blobs", algo, h); fileExists(path) {
+		return path
+	}
+	return filepath.Join(dir, h)
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func digestHex(digest string) string {
+	_, h, _ := strings.Cut(digest, ":")
+	return h
+}
+
+// toJSON encodes v without escaping HTML characters, Dockerfiles take them as is
+func toJSON(v any) string {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.Encode(v)
+	return strings.TrimSuffix(buf.String(), "\n")
+}
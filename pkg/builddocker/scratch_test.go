@@ -0,0 +1,105 @@
+package builddocker
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/buildsafedev/bsf/pkg/oci"
+)
+
+// writeImage writes an image with the layers and config to dir, in the dir: layout, and returns its layer digests
+func writeImage(t *testing.T, dir, config string, layers ...string) []string {
+	t.Helper()
+	write := func(data string) string {
+		digest := oci.DigestOf([]byte(data))
+		if err := os.WriteFile(filepath.Join(dir, digestHex(digest)), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return digest
+	}
+
+	digests := make([]string, 0, len(layers))
+	manifestLayers := make([]string, 0, len(layers))
+	for _, l := range layers {
+		d := write(l)
+		digests = append(digests, d)
+		manifestLayers = append(manifestLayers, `{"mediaType":"application/vnd.oci.image.layer.v1.tar","digest":"`+d+`","size":1}`)
+	}
+	configDigest := write(config)
+	manifest := `{"config":{"digest":"` + configDigest + `"},"layers":[` + strings.Join(manifestLayers, ",") + `]}`
+	if err := os.WriteFile(filepath.Join(dir, "manifest.json"), []byte(manifest), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return digests
+}
+
+func TestScratchDockerfile(t *testing.T) {
+	dir := t.TempDir()
+	config := `{"architecture":"amd64","os":"linux","config":{
+		"Env":["PATH=/bin","GREETING=a \"quoted\" <value>"],
+		"Entrypoint":["/nix/store/aaaa-app/bin/app"],
+		"Cmd":["--port","8080"],
+		"ExposedPorts":{"9090/tcp":{},"8080/tcp":{}},
+		"Labels":{"org.opencontainers.image.version":"1.0"}
+	},"rootfs":{"diff_ids":["sha256:1111","sha256:2222"]}}`
+	layers := writeImage(t, dir, config, "layer one", "layer two")
+
+	img, err := ReadScratchImage(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var first, second bytes.Buffer
+	if err := img.WriteDockerfile(&first); err != nil {
+		t.Fatal(err)
+	}
+	img, _ = ReadScratchImage(dir)
+	img.WriteDockerfile(&second)
+	if first.String() != second.String() {
+		t.Errorf("expected the same Dockerfile for the same image")
+	}
+
+	df := first.String()
+	for _, want := range []string{
+		"# Generated by bsf generate dockerfile",
+		"# image manifest: " + img.Manifest,
+		"# platform:       linux/amd64",
+		"FROM scratch\n",
+		"# layer " + layers[0] + ", diff ID sha256:1111",
+		"ADD layers/" + digestHex(layers[1]) + ".tar /\n",
+		`ENV GREETING="a \"quoted\" <value>"` + "\n",
+		`LABEL "org.opencontainers.image.version"="1.0"` + "\n",
+		"EXPOSE 8080/tcp 9090/tcp\n",
+		`ENTRYPOINT ["/nix/store/aaaa-app/bin/app"]` + "\n",
+		`CMD ["--port","8080"]` + "\n",
+	} {
+		if !strings.Contains(df, want) {
+			t.Errorf("expected the Dockerfile to contain %q, got:\n%s", want, df)
+		}
+	}
+	if strings.Index(df, digestHex(layers[0])+".tar") > strings.Index(df, digestHex(layers[1])+".tar") {
+		t.Errorf("expected the layers in the order of the image")
+	}
+
+	out := t.TempDir()
+	if err := img.WriteContext(dir, out); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(out, img.Layers[0].LayerFile()))
+	if err != nil || string(data) != "layer one" {
+		t.Errorf("expected the layer blob in the build context, got %q %v", data, err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(out, "Dockerfile")); string(data) != df {
+		t.Errorf("expected the Dockerfile in the build context")
+	}
+}
+
+func TestScratchImageMismatchedLayers(t *testing.T) {
+	dir := t.TempDir()
+	writeImage(t, dir, `{"rootfs":{"diff_ids":["sha256:1111"]}}`, "one", "two")
+	if _, err := ReadScratchImage(dir); err == nil {
+		t.Errorf("expected an image whose config and manifest disagree to be rejected")
+	}
+}
@@ -0,0 +1,121 @@
+// Package buildhost fingerprints the machine and the nix installation a build ran on, so the builds a builder produced
+// can be told apart from the others, e.g. when investigating an artifact only one builder produces.
+package buildhost
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"os/exec"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/buildsafedev/bsf/pkg/toolchain"
+)
+
+// machineIDFiles hold the machine id of Linux hosts, the second one on hosts without systemd
+var machineIDFiles = []string{"/etc/machine-id", "/var/lib/dbus/machine-id"}
+
+// Fingerprint identifies the builder: the host and the nix installation that built
+type Fingerprint struct {
+	// ID is the digest of the other fields but the hostname, which ephemeral CI runners change from one build to the
+	// next. It changes when the host, its kernel or its nix installation does.
+	ID string `json:"id"`
+	// HostID is the digest of the machine id of the host, the machine id itself isn't recorded. It is empty on hosts
+	// without one, e.g. most containers.
+	HostID   string `json:"hostId,omitempty"`
+	Hostname string `json:"hostname,omitempty"`
+	OS       string `json:"os"`
+	Arch     string `json:"arch"`
+	// Kernel is the release of the kernel, e.g. 6.8.0-45-generic
+	Kernel     string `json:"kernel,omitempty"`
+	NixVersion string `json:"nixVersion,omitempty"`
+	// System is the nix system of the builds, e.g. x86_64-linux
+	System string `json:"system,omitempty"`
+	// SystemFeatures are the features of the nix builder derivations can require, e.g. kvm, sorted
+	SystemFeatures []string `json:"systemFeatures,omitempty"`
+}
+
+// Probe returns the fingerprint of this host with the version and configuration of its nix installation, as nix
+// --version and nix show-config print them. The parts that can't be read are left empty.
+func Probe(nixVersion string, nixConfig map[string]string) *Fingerprint {
+	f := &Fingerprint{
+		HostID:     hostID(),
+		OS:         runtime.GOOS,
+		Arch:       runtime.GOARCH,
+		Kernel:     kernelRelease(),
+		NixVersion: nixVersion,
+		System:     nixConfig["system"],
+	}
+	f.Hostname, _ = os.Hostname()
+	f.SystemFeatures = strings.Fields(nixConfig["system-features"])
+	sort.Strings(f.SystemFeatures)
+	f.ID = f.digest()
+	return f
+}
+
+// Short returns the first 12 characters of the ID, as builds are listed with it
+func (f *Fingerprint) Short() string {
+	if f == nil {
+		return ""
+	}
+	if len(f.ID) > 12 {
+		return f.ID[:12]
+	}
+	return f.ID
+}
+
+// digest hashes the fields of the fingerprint, one per line
+func (f *Fingerprint) digest() string {
+	h := sha256.New()
+	for _, field := range []string{f.HostID, f.OS, f.Arch, f.Kernel, f.NixVersion, f.System, strings.Join(f.SystemFeatures, " ")} {
+		h.Write([]byte(field + "\n"))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// hostID returns the digest of the machine id, which systemd asks applications not to expose as is
+func hostID() string {
+	id := ""
+	for _, f := range machineIDFiles {
+		if data, err := os.ReadFile(f); err == nil {
+			id = strings.TrimSpace(string(data))
+			break
+		}
+	}
+	if id == "" && runtime.GOOS == "darwin" {
+		out, err := toolchain.Check(exec.Command("ioreg", "-rd1", "-c", "IOPlatformExpertDevice")).Output()
+		if err == nil {
+			id = platformUUID(string(out))
+		}
+	}
+	if id == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte("bsf-builder:" + id))
+	return hex.EncodeToString(sum[:])
+}
+
+// platformUUID returns the IOPlatformUUID of the ioreg output of macOS hosts
+func platformUUID(ioreg string) string {
+	for _, line := range strings.Split(ioreg, "\n") {
+		key, value, ok := strings.Cut(line, "=")
+		if ok && strings.Trim(strings.TrimSpace(key), `"`) == "IOPlatformUUID" {
+			return strings.Trim(strings.TrimSpace(value), `"`)
+		}
+	}
+	return ""
+}
+
+// kernelRelease returns the release of the kernel, read from /proc on Linux and from uname elsewhere
+func kernelRelease() string {
+	if data, err := os.ReadFile("/proc/sys/kernel/osrelease"); err == nil {
+		return strings.TrimSpace(string(data))
+	}
+	out, err := toolchain.Check(exec.Command("uname", "-r")).Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
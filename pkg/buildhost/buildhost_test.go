@@ -0,0 +1,51 @@
+package buildhost
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestProbe(t *testing.T) {
+	dir := t.TempDir()
+	machineID := filepath.Join(dir, "machine-id")
+	if err := os.WriteFile(machineID, []byte("4c4c4544004a3510804cb4c04f4e3332\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer func(files []string) { machineIDFiles = files }(machineIDFiles)
+	machineIDFiles = []string{filepath.Join(dir, "missing"), machineID}
+
+	config := map[string]string{"system": "x86_64-linux", "system-features": "nixos-test benchmark big-parallel kvm"}
+	f := Probe("v2.18.1", config)
+	if f.HostID == "" || f.HostID == "4c4c4544004a3510804cb4c04f4e3332" {
+		t.Errorf("HostID = %q, want the digest of the machine id", f.HostID)
+	}
+	if want := []string{"benchmark", "big-parallel", "kvm", "nixos-test"}; !reflect.DeepEqual(f.SystemFeatures, want) {
+		t.Errorf("SystemFeatures = %v, want %v", f.SystemFeatures, want)
+	}
+	if f.System != "x86_64-linux" || f.NixVersion != "v2.18.1" || len(f.ID) != 64 || len(f.Short()) != 12 {
+		t.Errorf("unexpected fingerprint %+v", f)
+	}
+
+	// the fingerprint is stable, whatever the hostname, and changes with the nix installation
+	again := Probe("v2.18.1", map[string]string{"system": "x86_64-linux", "system-features": "kvm big-parallel benchmark nixos-test"})
+	again.Hostname = "runner-8f2k1"
+	if again.digest() != f.ID {
+		t.Errorf("the fingerprint changed from %s to %s", f.ID, again.ID)
+	}
+	if upgraded := Probe("v2.24.9", config); upgraded.ID == f.ID {
+		t.Error("the fingerprint didn't change with the version of nix")
+	}
+}
+
+func TestPlatformUUID(t *testing.T) {
+	ioreg := `+-o J314sAP  <class IOPlatformExpertDevice, id 0x100000242, registered, matched, active, busy 0 (0 ms), retain 36>
+    {
+      "IOPlatformSerialNumber" = "C02XL0GDJGH5"
+      "IOPlatformUUID" = "2B3F3E6A-1C4D-5E6F-8A9B-0C1D2E3F4A5B"
+    }`
+	if got := platformUUID(ioreg); got != "2B3F3E6A-1C4D-5E6F-8A9B-0C1D2E3F4A5B" {
+		t.Errorf("platformUUID() = %q", got)
+	}
+}
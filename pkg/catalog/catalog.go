@@ -0,0 +1,269 @@
+// Package catalog checks the components of a closure against the approved package catalog of an organization. The
+// catalog lists the approved packages and version ranges, bsf.hcl exempts the others explicitly.
+package catalog
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/buildsafedev/bsf/pkg/hcl2nix"
+	"github.com/buildsafedev/bsf/pkg/osv"
+)
+
+// ReportName is the report of bsf build --catalog
+const ReportName = "catalog.json"
+
+// Statuses of the components of the closure
+const (
+	StatusApproved   = "approved"
+	StatusExempted   = "exempted"
+	StatusUnapproved = "unapproved"
+)
+
+// Catalog is the approved package catalog of an organization
+type Catalog struct {
+	Packages []Package `json:"packages"`
+}
+
+// Package is an approved package of the catalog
+type Package struct {
+	// Name is the name of the package, as in its store path. Ex: openssl
+	Name string `json:"name"`
+	// Versions is the range of approved versions, all versions when empty. Constraints separated by commas must all
+	// hold, ranges separated by || are alternatives. Ex: >=3.0.13, <4 || 1.1.1w
+	Versions string `json:"versions,omitempty"`
+}
+
+// Load reads the catalog from a file or an http(s):// URL
+func Load(ctx context.Context, location string) (*Catalog, error) {
+	var data []byte
+	var err error
+	if strings.HasPrefix(location, "https://") || strings.HasPrefix(location, "http://") {
+		data, err = fetch(ctx, location)
+	} else {
+		data, err = os.ReadFile(location)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the package catalog %s: %v", location, err)
+	}
+	c := &Catalog{}
+	if err := json.Unmarshal(data, c); err != nil {
+		return nil, fmt.Errorf("failed to parse the package catalog %s: %v", location, err)
+	}
+	for _, p := range c.Packages {
+		if _, err := ParseRange(p.Versions); err != nil {
+			return nil, fmt.Errorf("package %s of the catalog: %v", p.Name, err)
+		}
+	}
+	return c, nil
+}
+
+func fetch(ctx context.Context, u string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", u, resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// Range is a range of versions: one of its alternatives must hold, all the constraints of an alternative
+type Range [][]constraint
+
+type constraint struct {
+	op      string
+	version string
+}
+
+var operators = []string{">=", "<=", "!=", ">", "<", "="}
+
+// ParseRange parses a range of versions, see Package.Versions. Empty ranges and * are all versions.
+func ParseRange(s string) (Range, error) {
+	r := make(Range, 0)
+	if s = strings.TrimSpace(s); s == "" || s == "*" {
+		return r, nil
+	}
+	for _, alt := range strings.Split(s, "||") {
+		cs := make([]constraint, 0)
+		for _, part := range strings.Split(alt, ",") {
+			part = strings.TrimSpace(part)
+			c := constraint{op: "=", version: part}
+			for _, op := range operators {
+				if strings.HasPrefix(part, op) {
+					c = constraint{op: op, version: strings.TrimSpace(strings.TrimPrefix(part, op))}
+					break
+				}
+			}
+			if c.version == "" {
+				return nil, fmt.Errorf("invalid version range %q", s)
+			}
+			cs = append(cs, c)
+		}
+		r = append(r, cs)
+	}
+	return r, nil
+}
+
+// Contains returns whether the version is in the range
+func (r Range) Contains(version string) bool {
+	if len(r) == 0 {
+		return true
+	}
+	for _, alt := range r {
+		ok := true
+		for _, c := range alt {
+			if !c.holds(version) {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (c constraint) holds(version string) bool {
+	cmp := osv.CompareVersions(version, c.version)
+	switch c.op {
+	case ">=":
+		return cmp >= 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	case "<":
+		return cmp < 0
+	case "!=":
+		return cmp != 0
+	}
+	return cmp == 0
+}
+
+// Component is a component of the closure
+type Component struct {
+	Name      string `json:"name"`
+	Version   string `json:"version"`
+	StorePath string `json:"storePath"`
+}
+
+// Result is the status of a component of the closure
+type Result struct {
+	Component
+	Status string `json:"status"`
+	// Reason is the reason of the exemption of exempted components, why the others aren't approved
+	Reason string `json:"reason,omitempty"`
+}
+
+// Request is the exemption request of an unapproved package, for the versions of the closure
+type Request struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	Reason  string `json:"reason"`
+}
+
+// Report is the check of the closure against the catalog
+type Report struct {
+	Catalog    string   `json:"catalog"`
+	Approved   int      `json:"approved"`
+	Exempted   int      `json:"exempted"`
+	Unapproved int      `json:"unapproved"`
+	Components []Result `json:"components"`
+	// Requests are the exemptions to request for the unapproved packages
+	Requests []Request `json:"exemptionRequests"`
+}
+
+// Check checks the components against the catalog and the exemptions of bsf.hcl that apply on the day of now
+func (c *Catalog) Check(location string, components []Component, exemptions []hcl2nix.Exemption, now time.Time) *Report {
+	approved := make(map[string][]Range)
+	for _, p := range c.Packages {
+		r, _ := ParseRange(p.Versions)
+		approved[p.Name] = append(approved[p.Name], r)
+	}
+
+	report := &Report{Catalog: location, Components: make([]Result, 0, len(components)), Requests: make([]Request, 0)}
+	requested := make(map[string]bool)
+	for _, comp := range components {
+		res := Result{Component: comp, Status: StatusUnapproved, Reason: comp.Name + " is not in the catalog"}
+		if ranges, ok := approved[comp.Name]; ok {
+			res.Reason = fmt.Sprintf("version %s of %s is not approved", comp.Version, comp.Name)
+			for _, r := range ranges {
+				if r.Contains(comp.Version) {
+					res.Status, res.Reason = StatusApproved, ""
+					break
+				}
+			}
+		}
+		if res.Status == StatusUnapproved {
+			for _, e := range exemptions {
+				if e.Applies(comp.Name, comp.Version, now) {
+					res.Status, res.Reason = StatusExempted, e.Reason
+					break
+				}
+			}
+		}
+
+		switch res.Status {
+		case StatusApproved:
+			report.Approved++
+		case StatusExempted:
+			report.Exempted++
+		default:
+			report.Unapproved++
+			if key := comp.Name + "@" + comp.Version; !requested[key] {
+				requested[key] = true
+				report.Requests = append(report.Requests, Request{Name: comp.Name, Version: comp.Version, Reason: res.Reason})
+			}
+		}
+		report.Components = append(report.Components, res)
+	}
+
+	sort.Slice(report.Components, func(i, j int) bool {
+		a, b := report.Components[i], report.Components[j]
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		if a.Version != b.Version {
+			return a.Version < b.Version
+		}
+		return a.StorePath < b.StorePath
+	})
+	sort.Slice(report.Requests, func(i, j int) bool {
+		if report.Requests[i].Name != report.Requests[j].Name {
+			return report.Requests[i].Name < report.Requests[j].Name
+		}
+		return report.Requests[i].Version < report.Requests[j].Version
+	})
+	return report
+}
+
+// WriteRequests writes the exemption requests as exemption blocks of bsf.hcl, to fill in and submit for approval
+func (r *Report) WriteRequests(w io.Writer) error {
+	for i, req := range r.Requests {
+		if i > 0 {
+			if _, err := fmt.Fprintln(w); err != nil {
+				return err
+			}
+		}
+		_, err := fmt.Fprintf(w, "# %s\nexemption %q {\n  version = %q\n  reason  = \"\"\n}\n", req.Reason, req.Name, req.Version)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+package catalog
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/buildsafedev/bsf/pkg/hcl2nix"
+)
+
+func TestRange(t *testing.T) {
+	tests := []struct {
+		versions string
+		version  string
+		want     bool
+	}{
+		{"", "1.0", true},
+		{"*", "1.0", true},
+		{"3.0.13", "3.0.13", true},
+		{"3.0.13", "3.0.14", false},
+		{">=3.0.13, <4", "3.0.13", true},
+		{">=3.0.13, <4", "3.3.0", true},
+		{">=3.0.13, <4", "4.0.0", false},
+		{">=3.0.13, <4", "3.0.12", false},
+		{">=3.0.13, <4 || 1.1.1w", "1.1.1w", true},
+		{">=3.0.13, <4 || 1.1.1w", "1.1.1v", false},
+		{"!=2.0", "2.0", false},
+		{"<=2.0", "2.0", true},
+		{">2.0", "2.0.1", true},
+	}
+	for _, tt := range tests {
+		r, err := ParseRange(tt.versions)
+		if err != nil {
+			t.Fatalf("ParseRange(%q): %v", tt.versions, err)
+		}
+		if got := r.Contains(tt.version); got != tt.want {
+			t.Errorf("ParseRange(%q).Contains(%s) = %v, want %v", tt.versions, tt.version, got, tt.want)
+		}
+	}
+
+	for _, invalid := range []string{">=", "1.0, ", "1.0 ||"} {
+		if _, err := ParseRange(invalid); err == nil {
+			t.Errorf("ParseRange(%q) succeeded", invalid)
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	c := &Catalog{Packages: []Package{
+		{Name: "openssl", Versions: ">=3.0.13, <4"},
+		{Name: "zlib"},
+	}}
+	components := []Component{
+		{Name: "zlib", Version: "1.3", StorePath: "/nix/store/aaaa-zlib-1.3"},
+		{Name: "openssl", Version: "3.0.13", StorePath: "/nix/store/bbbb-openssl-3.0.13"},
+		{Name: "openssl", Version: "1.1.1w", StorePath: "/nix/store/cccc-openssl-1.1.1w"},
+		{Name: "libfoo", Version: "0.1", StorePath: "/nix/store/dddd-libfoo-0.1"},
+		{Name: "libfoo", Version: "0.1", StorePath: "/nix/store/eeee-libfoo-0.1"},
+		{Name: "libbar", Version: "2.0", StorePath: "/nix/store/ffff-libbar-2.0"},
+	}
+	exemptions := []hcl2nix.Exemption{
+		{Name: "libbar", Reason: "SEC-1300"},
+		{Name: "openssl", Version: "1.1.1w", Reason: "SEC-1234", Expires: "2026-01-31"},
+	}
+
+	report := c.Check("catalog.json", components, exemptions, time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC))
+	if report.Approved != 2 || report.Exempted != 1 || report.Unapproved != 3 {
+		t.Errorf("%d approved, %d exempted and %d unapproved, want 2, 1 and 3", report.Approved, report.Exempted, report.Unapproved)
+	}
+	if r := report.Components[0]; r.Name != "libbar" || r.Status != StatusExempted || r.Reason != "SEC-1300" {
+		t.Errorf("libbar = %+v", r)
+	}
+	// the exemption of openssl expired
+	wantRequests := []Request{
+		{Name: "libfoo", Version: "0.1", Reason: "libfoo is not in the catalog"},
+		{Name: "openssl", Version: "1.1.1w", Reason: "version 1.1.1w of openssl is not approved"},
+	}
+	if !reflect.DeepEqual(report.Requests, wantRequests) {
+		t.Errorf("Requests = %+v, want %+v", report.Requests, wantRequests)
+	}
+
+	var buf bytes.Buffer
+	if err := report.WriteRequests(&buf); err != nil {
+		t.Fatal(err)
+	}
+	config, err := hcl2nix.ReadConfig(append([]byte("packages {\n  development = []\n  runtime = []\n}\n"), buf.Bytes()...), os.Stderr)
+	if err != nil {
+		t.Fatalf("the exemption requests are not valid bsf.hcl blocks:\n%s", buf.String())
+	}
+	if len(config.Exemptions) != 2 || config.Exemptions[1].Name != "openssl" || config.Exemptions[1].Version != "1.1.1w" {
+		t.Errorf("exemption requests = %+v", config.Exemptions)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	data := `{"packages": [{"name": "openssl", "versions": ">=3.0.13"}]}`
+	path := filepath.Join(t.TempDir(), "catalog.json")
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/catalog.json" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(data))
+	}))
+	defer srv.Close()
+
+	for _, location := range []string{path, srv.URL + "/catalog.json"} {
+		c, err := Load(context.Background(), location)
+		if err != nil {
+			t.Fatalf("Load(%s): %v", location, err)
+		}
+		if len(c.Packages) != 1 || c.Packages[0].Name != "openssl" {
+			t.Errorf("Load(%s) = %+v", location, c)
+		}
+	}
+
+	if _, err := Load(context.Background(), srv.URL+"/missing.json"); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("Load of a missing catalog: %v", err)
+	}
+	if err := os.WriteFile(path, []byte(`{"packages": [{"name": "zlib", "versions": ">="}]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(context.Background(), path); err == nil {
+		t.Error("Load of a catalog with an invalid range succeeded")
+	}
+}
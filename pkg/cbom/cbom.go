@@ -0,0 +1,365 @@
+// Package cbom inventories the cryptography of a closure: the cryptographic libraries of its components, such as
+// OpenSSL and its providers, libsodium or GnuTLS, and the algorithms and protocols the executables of the result use,
+// from the symbols they import from these libraries or, for Go executables, the packages they are built with. The
+// inventory is written as a CycloneDX 1.6 cryptography bill of materials (CBOM), for FIPS and post-quantum readiness
+// assessments.
+package cbom
+
+import (
+	"debug/buildinfo"
+	"debug/elf"
+	"debug/gosym"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/buildsafedev/bsf/pkg/depgraph"
+	"github.com/buildsafedev/bsf/pkg/loader"
+	nixcmd "github.com/buildsafedev/bsf/pkg/nix/cmd"
+)
+
+// FileName is the name of the CBOM in the output directory
+const FileName = "cbom.cdx.json"
+
+// Types of cryptographic assets
+const (
+	TypeAlgorithm = "algorithm"
+	TypeProtocol  = "protocol"
+)
+
+// Library is a cryptographic library of the closure
+type Library struct {
+	Name      string `json:"name"`
+	Version   string `json:"version"`
+	StorePath string `json:"storePath"`
+	// Providers are the OpenSSL providers the library ships, e.g. fips and legacy
+	Providers []string `json:"providers,omitempty"`
+	// FIPS is true when the library ships a FIPS module, such as the fips provider of OpenSSL 3
+	FIPS bool `json:"fips"`
+
+	family string
+}
+
+// Asset is a cryptographic algorithm or protocol the executables of the result use
+type Asset struct {
+	Name string `json:"name"`
+	// Type is algorithm or protocol
+	Type string `json:"type"`
+	// Primitive is the CycloneDX primitive of an algorithm, e.g. block-cipher, hash or signature
+	Primitive string `json:"primitive,omitempty"`
+	// QuantumLevel is the NIST post-quantum security level of an algorithm, 0 for the algorithms a quantum computer
+	// breaks, such as RSA and elliptic curves
+	QuantumLevel int `json:"quantumLevel"`
+	// FIPSApproved is true for the algorithms FIPS 140-3 approves
+	FIPSApproved bool `json:"fipsApproved"`
+	// UsedBy are the executables using the asset
+	UsedBy []string `json:"usedBy"`
+	// Providers are the store paths of the libraries providing the asset, or the Go packages implementing it
+	Providers []string `json:"providers"`
+}
+
+// Executable is an executable of the result using cryptography
+type Executable struct {
+	Path string `json:"path"`
+	Go   bool   `json:"go,omitempty"`
+	// FIPSMode is the FIPS mode a Go executable was built with: boringcrypto, or fips140 and the version of the Go
+	// Cryptographic Module
+	FIPSMode string `json:"fipsMode,omitempty"`
+	// Libraries are the store paths of the cryptographic libraries the executable loads
+	Libraries []string `json:"libraries,omitempty"`
+}
+
+// Inventory is the cryptography of the closure and of the executables of its results
+type Inventory struct {
+	Libraries   []Library    `json:"libraries"`
+	Assets      []Asset      `json:"assets"`
+	Executables []Executable `json:"executables"`
+}
+
+// QuantumVulnerable returns the number of asymmetric algorithms a quantum computer breaks
+func (inv *Inventory) QuantumVulnerable() int {
+	n := 0
+	for _, a := range inv.Assets {
+		if a.Type == TypeAlgorithm && a.QuantumLevel == 0 {
+			n++
+		}
+	}
+	return n
+}
+
+// NotApproved returns the number of algorithms FIPS 140-3 doesn't approve
+func (inv *Inventory) NotApproved() int {
+	n := 0
+	for _, a := range inv.Assets {
+		if a.Type == TypeAlgorithm && !a.FIPSApproved {
+			n++
+		}
+	}
+	return n
+}
+
+// libraryFamilies are the families of the cryptographic libraries, by nixpkgs package name. Libraries of a family
+// export the same symbols, e.g. the forks of OpenSSL.
+var libraryFamilies = map[string]string{
+	"openssl": "openssl", "libressl": "openssl", "boringssl": "openssl", "aws-lc": "openssl", "quictls": "openssl",
+	"libsodium": "sodium", "gnutls": "gnutls", "nettle": "nettle", "libgcrypt": "gcrypt", "mbedtls": "mbedtls",
+	"wolfssl": "wolfssl", "nss": "nss", "botan": "botan", "botan3": "botan", "cryptopp": "cryptopp",
+	"libxcrypt": "xcrypt", "s2n-tls": "s2n",
+}
+
+// algorithm is a known algorithm or protocol
+type algorithm struct {
+	name, typ, primitive string
+	level                int
+	approved             bool
+}
+
+var (
+	aes              = algorithm{"AES", TypeAlgorithm, "block-cipher", 1, true}
+	tripleDES        = algorithm{"3DES", TypeAlgorithm, "block-cipher", 0, false}
+	rc4              = algorithm{"RC4", TypeAlgorithm, "stream-cipher", 0, false}
+	chacha20Poly1305 = algorithm{"ChaCha20-Poly1305", TypeAlgorithm, "ae", 1, false}
+	xsalsa20Poly1305 = algorithm{"XSalsa20-Poly1305", TypeAlgorithm, "ae", 1, false}
+	md5              = algorithm{"MD5", TypeAlgorithm, "hash", 0, false}
+	sha1             = algorithm{"SHA-1", TypeAlgorithm, "hash", 0, false}
+	sha256           = algorithm{"SHA-256", TypeAlgorithm, "hash", 2, true}
+	sha512           = algorithm{"SHA-512", TypeAlgorithm, "hash", 4, true}
+	sha3             = algorithm{"SHA-3", TypeAlgorithm, "hash", 2, true}
+	blake2b          = algorithm{"BLAKE2b", TypeAlgorithm, "hash", 2, false}
+	hmac             = algorithm{"HMAC", TypeAlgorithm, "mac", 1, true}
+	hkdf             = algorithm{"HKDF", TypeAlgorithm, "kdf", 1, true}
+	pbkdf2           = algorithm{"PBKDF2", TypeAlgorithm, "kdf", 1, true}
+	bcrypt           = algorithm{"bcrypt", TypeAlgorithm, "kdf", 1, false}
+	argon2           = algorithm{"Argon2", TypeAlgorithm, "kdf", 1, false}
+	rsa              = algorithm{"RSA", TypeAlgorithm, "pke", 0, true}
+	ecdsa            = algorithm{"ECDSA", TypeAlgorithm, "signature", 0, true}
+	ed25519          = algorithm{"Ed25519", TypeAlgorithm, "signature", 0, true}
+	ecdh             = algorithm{"ECDH", TypeAlgorithm, "key-agree", 0, true}
+	x25519           = algorithm{"X25519", TypeAlgorithm, "key-agree", 0, false}
+	mlkem            = algorithm{"ML-KEM", TypeAlgorithm, "kem", 3, true}
+	kyber            = algorithm{"Kyber", TypeAlgorithm, "kem", 3, false}
+	tls              = algorithm{"TLS", TypeProtocol, "", 0, false}
+	ssh              = algorithm{"SSH", TypeProtocol, "", 0, false}
+)
+
+// goPackages are the algorithms of the Go packages implementing them. The packages of the Go Cryptographic Module,
+// crypto/internal/fips140/..., are mapped to the crypto/... packages they implement.
+var goPackages = map[string]algorithm{
+	"crypto/aes": aes, "crypto/des": tripleDES, "crypto/rc4": rc4, "crypto/md5": md5, "crypto/sha1": sha1,
+	"crypto/sha256": sha256, "crypto/sha512": sha512, "crypto/sha3": sha3, "crypto/hmac": hmac, "crypto/hkdf": hkdf,
+	"crypto/pbkdf2": pbkdf2, "crypto/rsa": rsa, "crypto/ecdsa": ecdsa, "crypto/ed25519": ed25519,
+	"crypto/ecdh": ecdh, "crypto/mlkem": mlkem, "crypto/tls": tls,
+	"golang.org/x/crypto/chacha20poly1305": chacha20Poly1305, "golang.org/x/crypto/curve25519": x25519,
+	"golang.org/x/crypto/blake2b": blake2b, "golang.org/x/crypto/bcrypt": bcrypt, "golang.org/x/crypto/argon2": argon2,
+	"golang.org/x/crypto/hkdf": hkdf, "golang.org/x/crypto/pbkdf2": pbkdf2, "golang.org/x/crypto/sha3": sha3,
+	"golang.org/x/crypto/ssh": ssh, "github.com/cloudflare/circl/kem/kyber": kyber,
+}
+
+// symbols are the algorithms of the symbols of cryptographic libraries executables import, by prefix
+var symbols = []struct {
+	prefix, family string
+	alg            algorithm
+}{
+	{"EVP_aes_", "openssl", aes}, {"AES_", "openssl", aes}, {"EVP_des_ede3", "openssl", tripleDES},
+	{"EVP_rc4", "openssl", rc4}, {"EVP_chacha20_poly1305", "openssl", chacha20Poly1305},
+	{"EVP_md5", "openssl", md5}, {"MD5_", "openssl", md5}, {"EVP_sha1", "openssl", sha1}, {"SHA1_", "openssl", sha1},
+	{"EVP_sha224", "openssl", sha256}, {"EVP_sha256", "openssl", sha256}, {"SHA256_", "openssl", sha256},
+	{"EVP_sha384", "openssl", sha512}, {"EVP_sha512", "openssl", sha512}, {"SHA512_", "openssl", sha512},
+	{"EVP_sha3_", "openssl", sha3}, {"HMAC", "openssl", hmac}, {"PKCS5_PBKDF2_HMAC", "openssl", pbkdf2},
+	{"RSA_", "openssl", rsa}, {"EVP_PKEY_CTX_set_rsa_", "openssl", rsa}, {"ECDSA_", "openssl", ecdsa},
+	{"ECDH_", "openssl", ecdh}, {"SSL_CTX_new", "openssl", tls},
+	{"crypto_secretbox", "sodium", xsalsa20Poly1305}, {"crypto_box", "sodium", x25519},
+	{"crypto_scalarmult", "sodium", x25519}, {"crypto_kx_", "sodium", x25519}, {"crypto_sign", "sodium", ed25519},
+	{"crypto_aead_chacha20poly1305", "sodium", chacha20Poly1305}, {"crypto_aead_xchacha20poly1305", "sodium", chacha20Poly1305},
+	{"crypto_aead_aes256gcm", "sodium", aes}, {"crypto_generichash", "sodium", blake2b},
+	{"crypto_pwhash", "sodium", argon2}, {"crypto_auth_hmacsha", "sodium", hmac},
+	{"gnutls_init", "gnutls", tls}, {"mbedtls_ssl_setup", "mbedtls", tls}, {"wolfSSL_CTX_new", "wolfssl", tls},
+}
+
+// Analyze inventories the cryptographic libraries of the closure and the cryptography the executables of the bin and
+// sbin directories of the results use
+func Analyze(graph *depgraph.Graph, results ...string) *Inventory {
+	inv := &Inventory{Libraries: make([]Library, 0), Assets: make([]Asset, 0), Executables: make([]Executable, 0)}
+	libraries := make(map[string]*Library)
+	for _, n := range graph.Nodes {
+		family, ok := libraryFamilies[strings.ToLower(n.Attrs["name"])]
+		if !ok {
+			continue
+		}
+		lib := Library{Name: n.Attrs["name"], Version: n.Attrs["version"], StorePath: n.StorePath(), family: family}
+		lib.Providers = opensslProviders(lib.StorePath)
+		for _, p := range lib.Providers {
+			lib.FIPS = lib.FIPS || p == "fips"
+		}
+		inv.Libraries = append(inv.Libraries, lib)
+	}
+	for i := range inv.Libraries {
+		libraries[inv.Libraries[i].StorePath] = &inv.Libraries[i]
+	}
+
+	assets := make(map[string]*Asset)
+	use := func(alg algorithm, exe, provider string) {
+		a, ok := assets[alg.name]
+		if !ok {
+			a = &Asset{Name: alg.name, Type: alg.typ, Primitive: alg.primitive, QuantumLevel: alg.level, FIPSApproved: alg.approved}
+			assets[alg.name] = a
+		}
+		a.UsedBy = appendUnique(a.UsedBy, exe)
+		a.Providers = appendUnique(a.Providers, provider)
+	}
+
+	seen := make(map[string]bool)
+	for _, result := range results {
+		for _, dir := range []string{"bin", "sbin"} {
+			entries, err := os.ReadDir(nixcmd.HostPath(filepath.Join(result, dir)))
+			if err != nil {
+				continue
+			}
+			for _, e := range entries {
+				path := filepath.Join(result, dir, e.Name())
+				file, err := nixcmd.EvalSymlinks(path)
+				if err != nil || seen[file] {
+					continue
+				}
+				seen[file] = true
+				if exe, ok := analyzeExecutable(path, file, libraries, use); ok {
+					inv.Executables = append(inv.Executables, *exe)
+				}
+			}
+		}
+	}
+
+	for _, a := range assets {
+		sort.Strings(a.UsedBy)
+		sort.Strings(a.Providers)
+		inv.Assets = append(inv.Assets, *a)
+	}
+	sort.Slice(inv.Assets, func(i, j int) bool { return inv.Assets[i].Name < inv.Assets[j].Name })
+	sort.Slice(inv.Executables, func(i, j int) bool { return inv.Executables[i].Path < inv.Executables[j].Path })
+	return inv
+}
+
+// analyzeExecutable records the cryptography the executable uses, it returns false when it uses none or isn't an
+// ELF executable
+func analyzeExecutable(path, file string, libraries map[string]*Library, use func(algorithm, string, string)) (*Executable, bool) {
+	f, err := elf.Open(nixcmd.HostPath(file))
+	if err != nil {
+		return nil, false
+	}
+	defer f.Close()
+
+	exe := &Executable{Path: path}
+	used := false
+	if f.Section(".go.buildinfo") != nil {
+		exe.Go = true
+		exe.FIPSMode = goFIPSMode(nixcmd.HostPath(file))
+		for pkg := range goCryptoPackages(f) {
+			use(goPackages[pkg], path, pkg)
+			used = true
+		}
+	}
+
+	loaded := make(map[string][]string)
+	for p := range loader.Simulate([]string{file}).Loaded {
+		if lib, ok := libraries[loader.StorePath(p)]; ok {
+			loaded[lib.family] = appendUnique(loaded[lib.family], lib.StorePath)
+			exe.Libraries = appendUnique(exe.Libraries, lib.StorePath)
+		}
+	}
+	imported, _ := f.ImportedSymbols()
+	for _, s := range imported {
+		for _, sym := range symbols {
+			if !strings.HasPrefix(s.Name, sym.prefix) {
+				continue
+			}
+			for _, provider := range loaded[sym.family] {
+				use(sym.alg, path, provider)
+				used = true
+			}
+		}
+	}
+	sort.Strings(exe.Libraries)
+	return exe, used || len(exe.Libraries) > 0 || exe.FIPSMode != ""
+}
+
+// goCryptoPackages returns the cryptographic packages of the functions of a Go executable, read from its pclntab,
+// which stripped executables keep
+func goCryptoPackages(f *elf.File) map[string]bool {
+	pkgs := make(map[string]bool)
+	pclntab, text := f.Section(".gopclntab"), f.Section(".text")
+	if pclntab == nil || text == nil {
+		return pkgs
+	}
+	data, err := pclntab.Data()
+	if err != nil {
+		return pkgs
+	}
+	table, err := gosym.NewTable(nil, gosym.NewLineTable(data, text.Addr))
+	if err != nil {
+		return pkgs
+	}
+	for _, fn := range table.Funcs {
+		pkg := goPackage(fn.Name)
+		if _, ok := goPackages[pkg]; ok {
+			pkgs[pkg] = true
+		}
+	}
+	return pkgs
+}
+
+// goPackage returns the package of the Go function, crypto/internal/fips140/aes.(*Block).Encrypt is in crypto/aes
+func goPackage(fn string) string {
+	slash := strings.LastIndex(fn, "/")
+	dot := strings.Index(fn[slash+1:], ".")
+	if dot < 0 {
+		return ""
+	}
+	pkg := fn[:slash+1+dot]
+	if rest, ok := strings.CutPrefix(pkg, "crypto/internal/fips140/"); ok {
+		pkg = "crypto/" + rest
+	}
+	return strings.TrimPrefix(pkg, "vendor/")
+}
+
+// goFIPSMode returns the FIPS mode recorded in the build information of a Go executable
+func goFIPSMode(file string) string {
+	info, err := buildinfo.ReadFile(file)
+	if err != nil {
+		return ""
+	}
+	for _, s := range info.Settings {
+		switch {
+		case s.Key == "GOFIPS140" && s.Value != "" && s.Value != "off":
+			return "fips140-" + s.Value
+		case s.Key == "GOEXPERIMENT" && strings.Contains(s.Value, "boringcrypto"):
+			return "boringcrypto"
+		}
+	}
+	return ""
+}
+
+// opensslProviders returns the OpenSSL providers of the library, the modules of its lib/ossl-modules directory
+func opensslProviders(storePath string) []string {
+	entries, err := os.ReadDir(nixcmd.HostPath(filepath.Join(storePath, "lib", "ossl-modules")))
+	if err != nil {
+		return nil
+	}
+	providers := make([]string, 0, len(entries))
+	for _, e := range entries {
+		if name, ok := strings.CutSuffix(e.Name(), ".so"); ok {
+			providers = append(providers, name)
+		}
+	}
+	sort.Strings(providers)
+	return providers
+}
+
+func appendUnique(values []string, v string) []string {
+	for _, existing := range values {
+		if existing == v {
+			return values
+		}
+	}
+	return append(values, v)
+}
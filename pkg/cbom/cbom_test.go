@@ -0,0 +1,104 @@
+package cbom
+
+import (
+	gosha256 "crypto/sha256"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/buildsafedev/bsf/pkg/depgraph"
+)
+
+func TestGoPackage(t *testing.T) {
+	tests := []struct {
+		fn, want string
+	}{
+		{"crypto/sha256.(*digest).Write", "crypto/sha256"},
+		{"crypto/internal/fips140/aes.(*Block).Encrypt", "crypto/aes"},
+		{"vendor/golang.org/x/crypto/chacha20poly1305.New", "golang.org/x/crypto/chacha20poly1305"},
+		{"golang.org/x/crypto/ssh.NewClientConn", "golang.org/x/crypto/ssh"},
+		{"main.main", "main"},
+		{"type:.eq.crypto/tls.Config", "type:.eq.crypto/tls"},
+	}
+	for _, tt := range tests {
+		if got := goPackage(tt.fn); got != tt.want {
+			t.Errorf("goPackage(%q) = %q, want %q", tt.fn, got, tt.want)
+		}
+	}
+}
+
+// TestAnalyze inventories the Go test executable in a result, which uses crypto/sha256
+func TestAnalyze(t *testing.T) {
+	gosha256.Sum256([]byte("bsf"))
+	test, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(result, "bin"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(test, filepath.Join(result, "bin", "app")); err != nil {
+		t.Fatal(err)
+	}
+
+	g := depgraph.New()
+	g.AddNode("aaaa-openssl-3.0.13", map[string]string{"name": "openssl", "version": "3.0.13"})
+	g.AddNode("bbbb-zlib-1.3", map[string]string{"name": "zlib", "version": "1.3"})
+
+	inv := Analyze(g, result)
+	if len(inv.Libraries) != 1 || inv.Libraries[0].Name != "openssl" || inv.Libraries[0].StorePath != "/nix/store/aaaa-openssl-3.0.13" {
+		t.Errorf("Libraries = %+v, want openssl", inv.Libraries)
+	}
+	if len(inv.Executables) != 1 || !inv.Executables[0].Go || inv.Executables[0].Path != filepath.Join(result, "bin", "app") {
+		t.Fatalf("Executables = %+v, want the test executable", inv.Executables)
+	}
+	var found *Asset
+	for i := range inv.Assets {
+		if inv.Assets[i].Name == "SHA-256" {
+			found = &inv.Assets[i]
+		}
+	}
+	if found == nil || !found.FIPSApproved || len(found.Providers) != 1 || found.Providers[0] != "crypto/sha256" {
+		t.Errorf("Assets = %+v, want SHA-256 provided by crypto/sha256", inv.Assets)
+	}
+}
+
+func TestCycloneDX(t *testing.T) {
+	inv := &Inventory{
+		Libraries: []Library{{Name: "openssl", Version: "3.0.13", StorePath: "/nix/store/aaaa-openssl-3.0.13", Providers: []string{"fips", "legacy"}, FIPS: true}},
+		Assets: []Asset{
+			{Name: "RSA", Type: TypeAlgorithm, Primitive: "pke", FIPSApproved: true, UsedBy: []string{"bin/app"}, Providers: []string{"/nix/store/aaaa-openssl-3.0.13"}},
+			{Name: "ML-KEM", Type: TypeAlgorithm, Primitive: "kem", QuantumLevel: 3, FIPSApproved: true, UsedBy: []string{"bin/app"}, Providers: []string{"crypto/mlkem"}},
+			{Name: "TLS", Type: TypeProtocol, UsedBy: []string{"bin/app"}, Providers: []string{"/nix/store/aaaa-openssl-3.0.13", "crypto/tls"}},
+		},
+	}
+	if inv.QuantumVulnerable() != 1 || inv.NotApproved() != 0 {
+		t.Errorf("QuantumVulnerable() = %d, NotApproved() = %d, want 1 and 0", inv.QuantumVulnerable(), inv.NotApproved())
+	}
+
+	product := Product{Name: "app", Version: "1.0", BOMRef: "app@1.0", ComponentID: func(name, version string) string { return name + "@" + version }}
+	doc := CycloneDX(product, inv, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	if doc.SpecVersion != "1.6" || len(doc.Components) != 4 {
+		t.Fatalf("CycloneDX() = %+v", doc)
+	}
+	if c := doc.Components[2]; c.Type != "cryptographic-asset" || c.CryptoProperties.AlgorithmProperties.NISTQuantumSecurityLevel != 3 {
+		t.Errorf("ML-KEM component = %+v", c)
+	}
+	if c := doc.Components[3]; c.CryptoProperties.ProtocolProperties == nil || c.CryptoProperties.ProtocolProperties.Type != "tls" {
+		t.Errorf("TLS component = %+v", c)
+	}
+	want := map[string][]string{
+		"openssl@3.0.13": {"crypto/algorithm/rsa", "crypto/protocol/tls"},
+		"app@1.0":        {"crypto/algorithm/ml-kem", "crypto/protocol/tls"},
+	}
+	if len(doc.Dependencies) != len(want) {
+		t.Fatalf("Dependencies = %+v", doc.Dependencies)
+	}
+	for _, d := range doc.Dependencies {
+		if len(d.Provides) != len(want[d.Ref]) || d.Provides[0] != want[d.Ref][0] || d.Provides[1] != want[d.Ref][1] {
+			t.Errorf("%s provides %v, want %v", d.Ref, d.Provides, want[d.Ref])
+		}
+	}
+}
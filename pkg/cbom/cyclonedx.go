@@ -0,0 +1,125 @@
+package cbom
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Product is the application the CBOM is about
+type Product struct {
+	Name, Version, Purl string
+	// BOMRef is the identifier of the application in the SBOM
+	BOMRef string
+	// ComponentID returns the identifier of a component in the SBOM, the bom-ref of CycloneDX documents
+	ComponentID func(name, version string) string
+}
+
+// Document is a CycloneDX 1.6 document holding the cryptographic assets of the application, the libraries providing
+// them and the dependencies between both. The other components are in the SBOM.
+type Document struct {
+	BOMFormat    string                 `json:"bomFormat"`
+	SpecVersion  string                 `json:"specVersion"`
+	Version      int                    `json:"version"`
+	Metadata     map[string]interface{} `json:"metadata"`
+	Components   []Component            `json:"components"`
+	Dependencies []Dependency           `json:"dependencies"`
+}
+
+// Component is a library or a cryptographic asset
+type Component struct {
+	Type             string            `json:"type"`
+	BOMRef           string            `json:"bom-ref"`
+	Name             string            `json:"name"`
+	Version          string            `json:"version,omitempty"`
+	CryptoProperties *CryptoProperties `json:"cryptoProperties,omitempty"`
+	Properties       []Property        `json:"properties,omitempty"`
+}
+
+// CryptoProperties are the properties of a cryptographic asset
+type CryptoProperties struct {
+	AssetType           string               `json:"assetType"`
+	AlgorithmProperties *AlgorithmProperties `json:"algorithmProperties,omitempty"`
+	ProtocolProperties  *ProtocolProperties  `json:"protocolProperties,omitempty"`
+}
+
+// AlgorithmProperties are the properties of an algorithm
+type AlgorithmProperties struct {
+	Primitive                string `json:"primitive"`
+	NISTQuantumSecurityLevel int    `json:"nistQuantumSecurityLevel"`
+}
+
+// ProtocolProperties are the properties of a protocol
+type ProtocolProperties struct {
+	Type string `json:"type"`
+}
+
+// Property is a name-value property of a component
+type Property struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// Dependency lists the assets a component provides
+type Dependency struct {
+	Ref      string   `json:"ref"`
+	Provides []string `json:"provides"`
+}
+
+// CycloneDX returns the CBOM of the inventory. The libraries are identified as in the SBOM, the application provides
+// the assets implemented by its Go packages.
+func CycloneDX(product Product, inv *Inventory, now time.Time) *Document {
+	appRef := product.BOMRef
+	doc := &Document{
+		BOMFormat:   "CycloneDX",
+		SpecVersion: "1.6",
+		Version:     1,
+		Metadata: map[string]interface{}{
+			"timestamp": now.UTC().Truncate(time.Second),
+			"component": map[string]string{"type": "application", "bom-ref": appRef, "name": product.Name, "version": product.Version, "purl": product.Purl},
+		},
+		Components:   make([]Component, 0, len(inv.Libraries)+len(inv.Assets)),
+		Dependencies: make([]Dependency, 0),
+	}
+
+	libraryRefs := make(map[string]string, len(inv.Libraries))
+	for _, lib := range inv.Libraries {
+		ref := product.ComponentID(lib.Name, lib.Version)
+		libraryRefs[lib.StorePath] = ref
+		c := Component{Type: "library", BOMRef: ref, Name: lib.Name, Version: lib.Version}
+		if len(lib.Providers) > 0 {
+			c.Properties = append(c.Properties, Property{Name: "bsf:openssl-providers", Value: strings.Join(lib.Providers, ",")})
+		}
+		c.Properties = append(c.Properties, Property{Name: "bsf:fips-module", Value: strconv.FormatBool(lib.FIPS)})
+		doc.Components = append(doc.Components, c)
+	}
+
+	provides := make(map[string][]string)
+	refs := make([]string, 0)
+	for _, a := range inv.Assets {
+		ref := "crypto/" + a.Type + "/" + strings.ToLower(a.Name)
+		c := Component{Type: "cryptographic-asset", BOMRef: ref, Name: a.Name, CryptoProperties: &CryptoProperties{AssetType: a.Type}}
+		if a.Type == TypeProtocol {
+			c.CryptoProperties.ProtocolProperties = &ProtocolProperties{Type: strings.ToLower(a.Name)}
+		} else {
+			c.CryptoProperties.AlgorithmProperties = &AlgorithmProperties{Primitive: a.Primitive, NISTQuantumSecurityLevel: a.QuantumLevel}
+			c.Properties = append(c.Properties, Property{Name: "bsf:fips-approved", Value: strconv.FormatBool(a.FIPSApproved)})
+		}
+		doc.Components = append(doc.Components, c)
+
+		for _, p := range a.Providers {
+			provider, ok := libraryRefs[p]
+			if !ok {
+				provider = appRef
+			}
+			if _, ok := provides[provider]; !ok {
+				refs = append(refs, provider)
+			}
+			provides[provider] = appendUnique(provides[provider], ref)
+		}
+	}
+	for _, ref := range refs {
+		doc.Dependencies = append(doc.Dependencies, Dependency{Ref: ref, Provides: provides[ref]})
+	}
+	return doc
+}
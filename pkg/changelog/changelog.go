@@ -0,0 +1,192 @@
+package changelog
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"slices"
+	"strings"
+
+	buildsafev1 "github.com/buildsafedev/bsf-apis/go/buildsafe/v1"
+
+	"github.com/buildsafedev/bsf/pkg/diff"
+)
+
+// Entry is a package upgrade in the changelog
+type Entry struct {
+	diff.Change
+	// UpstreamURL points to the upstream changelog or releases page, if it could be resolved
+	UpstreamURL string
+	// FixedCVEs are the vulnerabilities affecting the old version that no longer affect the new one
+	FixedCVEs []string
+}
+
+// Changelog is a human readable view of the dependency changes between two builds
+type Changelog struct {
+	From       string
+	To         string
+	Upgraded   []Entry
+	Downgraded []Entry
+	Added      []diff.Package
+	Removed    []diff.Package
+	Rebuilt    []diff.Change
+}
+
+// New creates a changelog from the diff. If sc is not nil, vulnerabilities fixed by the upgrades are looked up.
+func New(ctx context.Context, sc buildsafev1.SearchServiceClient, from, to string, d *diff.Diff) (*Changelog, error) {
+	cl := &Changelog{
+		From:    from,
+		To:      to,
+		Added:   d.Added,
+		Removed: d.Removed,
+		Rebuilt: d.Rebuilt,
+	}
+
+	for _, c := range d.Upgraded {
+		e := Entry{Change: c, UpstreamURL: UpstreamChangelogURL(c.Homepage)}
+		if sc != nil {
+			fixed, err := fixedCVEs(ctx, sc, c)
+			if err != nil {
+				return nil, fmt.Errorf("failed to fetch vulnerabilities for %s: %v", c.Name, err)
+			}
+			e.FixedCVEs = fixed
+		}
+		cl.Upgraded = append(cl.Upgraded, e)
+	}
+
+	for _, c := range d.Downgraded {
+		cl.Downgraded = append(cl.Downgraded, Entry{Change: c, UpstreamURL: UpstreamChangelogURL(c.Homepage)})
+	}
+
+	return cl, nil
+}
+
+func fixedCVEs(ctx context.Context, sc buildsafev1.SearchServiceClient, c diff.Change) ([]string, error) {
+	oldVulns, err := sc.FetchVulnerabilities(ctx, &buildsafev1.FetchVulnerabilitiesRequest{
+		Name:    c.Name,
+		Version: c.OldVersion,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	newVulns, err := sc.FetchVulnerabilities(ctx, &buildsafev1.FetchVulnerabilitiesRequest{
+		Name:    c.Name,
+		Version: c.NewVersion,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	stillAffected := make(map[string]bool, len(newVulns.Vulnerabilities))
+	for _, v := range newVulns.Vulnerabilities {
+		stillAffected[v.Id] = true
+	}
+
+	fixed := make([]string, 0, len(oldVulns.Vulnerabilities))
+	for _, v := range oldVulns.Vulnerabilities {
+		if !stillAffected[v.Id] {
+			fixed = append(fixed, v.Id)
+		}
+	}
+	slices.Sort(fixed)
+
+	return slices.Compact(fixed), nil
+}
+
+// UpstreamChangelogURL returns the page where upstream publishes release notes, based on the homepage
+func UpstreamChangelogURL(homepage string) string {
+	if homepage == "" {
+		return ""
+	}
+
+	u, err := url.Parse(homepage)
+	if err != nil || u.Host == "" {
+		return ""
+	}
+
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	switch u.Host {
+	case "github.com", "www.github.com":
+		if len(parts) >= 2 {
+			return fmt.Sprintf("https://github.com/%s/%s/releases", parts[0], parts[1])
+		}
+	case "gitlab.com":
+		if len(parts) >= 2 {
+			return fmt.Sprintf("https://gitlab.com/%s/-/releases", strings.Join(parts, "/"))
+		}
+	case "pypi.org":
+		if len(parts) >= 2 && parts[0] == "project" {
+			return fmt.Sprintf("https://pypi.org/project/%s/#history", parts[1])
+		}
+	case "crates.io":
+		if len(parts) >= 2 && parts[0] == "crates" {
+			return fmt.Sprintf("https://crates.io/crates/%s/versions", parts[1])
+		}
+	}
+
+	return homepage
+}
+
+// WriteMarkdown writes the changelog as markdown, suitable for release notes
+func (cl *Changelog) WriteMarkdown(w io.Writer) error {
+	var sb strings.Builder
+
+	sb.WriteString("## Dependency changes")
+	if cl.From != "" && cl.To != "" {
+		sb.WriteString(fmt.Sprintf(" from %s to %s", cl.From, cl.To))
+	}
+	sb.WriteString("\n\n")
+
+	if len(cl.Upgraded)+len(cl.Downgraded)+len(cl.Added)+len(cl.Removed)+len(cl.Rebuilt) == 0 {
+		sb.WriteString("No dependency changes.\n")
+		_, err := io.WriteString(w, sb.String())
+		return err
+	}
+
+	writeEntries := func(title string, entries []Entry) {
+		if len(entries) == 0 {
+			return
+		}
+		sb.WriteString("### " + title + "\n\n")
+		sb.WriteString("| Package | Old | New | Fixed CVEs | Changelog |\n")
+		sb.WriteString("|---|---|---|---|---|\n")
+		for _, e := range entries {
+			link := ""
+			if e.UpstreamURL != "" {
+				link = fmt.Sprintf("[link](%s)", e.UpstreamURL)
+			}
+			sb.WriteString(fmt.Sprintf("| %s | %s | %s | %s | %s |\n", e.Name, e.OldVersion, e.NewVersion, strings.Join(e.FixedCVEs, ", "), link))
+		}
+		sb.WriteString("\n")
+	}
+
+	writePackages := func(title string, pkgs []diff.Package) {
+		if len(pkgs) == 0 {
+			return
+		}
+		sb.WriteString("### " + title + "\n\n")
+		for _, p := range pkgs {
+			sb.WriteString(fmt.Sprintf("- %s %s\n", p.Name, p.Version))
+		}
+		sb.WriteString("\n")
+	}
+
+	writeEntries("Upgraded", cl.Upgraded)
+	writeEntries("Downgraded", cl.Downgraded)
+	writePackages("Added", cl.Added)
+	writePackages("Removed", cl.Removed)
+
+	if len(cl.Rebuilt) > 0 {
+		sb.WriteString("### Rebuilt\n\n")
+		sb.WriteString("Same version, different contents (patches or build inputs changed):\n\n")
+		for _, c := range cl.Rebuilt {
+			sb.WriteString(fmt.Sprintf("- %s %s\n", c.Name, c.NewVersion))
+		}
+		sb.WriteString("\n")
+	}
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
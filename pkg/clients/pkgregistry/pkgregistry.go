@@ -0,0 +1,168 @@
+// Package pkgregistry looks up components of private nixpkgs overlays in an internal package metadata endpoint
+package pkgregistry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/awalterschulze/gographviz"
+
+	nixcmd "github.com/buildsafedev/bsf/pkg/nix/cmd"
+)
+
+const (
+	// TokenEnv is the environment variable holding the bearer token of the endpoint
+	TokenEnv = "BSF_PACKAGE_REGISTRY_TOKEN"
+	// batchSize is the number of store paths looked up per request
+	batchSize = 500
+)
+
+// Query identifies a component of the closure
+type Query struct {
+	StorePath string `json:"storePath"`
+	Deriver   string `json:"deriver,omitempty"`
+	Name      string `json:"name,omitempty"`
+	Version   string `json:"version,omitempty"`
+}
+
+// Package is the metadata the registry has for a store path
+type Package struct {
+	StorePath   string `json:"storePath"`
+	Name        string `json:"name,omitempty"`
+	Version     string `json:"version,omitempty"`
+	Owner       string `json:"owner,omitempty"`
+	OwnerEmail  string `json:"ownerEmail,omitempty"`
+	License     string `json:"license,omitempty"`
+	InternalID  string `json:"internalId,omitempty"`
+	Purl        string `json:"purl,omitempty"`
+	URL         string `json:"url,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+// Client queries the endpoint with POST <endpoint>/v1/lookup. The registry answers with the packages it knows,
+// store paths of nixpkgs are usually not in it.
+type Client struct {
+	Endpoint   string
+	Token      string
+	HTTPClient *http.Client
+}
+
+// NewClient returns a client for the endpoint, authenticated with the token in BSF_PACKAGE_REGISTRY_TOKEN if set
+func NewClient(endpoint string) *Client {
+	return &Client{
+		Endpoint: strings.TrimSuffix(endpoint, "/"),
+		Token:    os.Getenv(TokenEnv),
+	}
+}
+
+func (c *Client) httpClient() *http.Client {
+	if c.HTTPClient != nil {
+		return c.HTTPClient
+	}
+	return http.DefaultClient
+}
+
+// Lookup returns the metadata of the queried store paths known to the registry
+func (c *Client) Lookup(ctx context.Context, queries []Query) ([]Package, error) {
+	pkgs := make([]Package, 0)
+	for start := 0; start < len(queries); start += batchSize {
+		end := min(start+batchSize, len(queries))
+		batch, err := c.lookup(ctx, queries[start:end])
+		if err != nil {
+			return nil, err
+		}
+		pkgs = append(pkgs, batch...)
+	}
+	return pkgs, nil
+}
+
+func (c *Client) lookup(ctx context.Context, queries []Query) ([]Package, error) {
+	body, err := json.Marshal(struct {
+		Packages []Query `json:"packages"`
+	}{queries})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.Endpoint+"/v1/lookup", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("package registry lookup returned %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+
+	result := struct {
+		Packages []Package `json:"packages"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to parse package registry response: %v", err)
+	}
+	return result.Packages, nil
+}
+
+// Queries returns a query for every node of the closure graph
+func Queries(graph *gographviz.Graph) []Query {
+	queries := make([]Query, 0, len(graph.Nodes.Nodes))
+	for _, node := range graph.Nodes.Nodes {
+		queries = append(queries, Query{
+			StorePath: "/nix/store/" + nixcmd.CleanNameFromGraph(node.Name),
+			Deriver:   node.Attrs["deriver"],
+			Name:      node.Attrs["name"],
+			Version:   node.Attrs["version"],
+		})
+	}
+	return queries
+}
+
+// Annotate records the metadata of the registry on the nodes of the closure graph, replacing the name and version
+// guessed from the store path. It returns the number of annotated nodes.
+func Annotate(graph *gographviz.Graph, pkgs []Package) int {
+	byPath := make(map[string]Package, len(pkgs))
+	for _, p := range pkgs {
+		byPath[p.StorePath] = p
+	}
+
+	annotated := 0
+	for _, node := range graph.Nodes.Nodes {
+		p, ok := byPath["/nix/store/"+nixcmd.CleanNameFromGraph(node.Name)]
+		if !ok {
+			continue
+		}
+		annotated++
+
+		set := func(key, value string) {
+			if value != "" {
+				node.Attrs[gographviz.Attr(key)] = value
+			}
+		}
+		set("name", p.Name)
+		set("version", p.Version)
+		set("owner", p.Owner)
+		set("owner_email", p.OwnerEmail)
+		set("license", p.License)
+		set("internal_id", p.InternalID)
+		set("purl", p.Purl)
+		set("registry_url", p.URL)
+		set("description", p.Description)
+	}
+	return annotated
+}
@@ -0,0 +1,65 @@
+package pkgregistry
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/awalterschulze/gographviz"
+)
+
+func TestLookupAndAnnotate(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/lookup" || r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		req := struct {
+			Packages []Query `json:"packages"`
+		}{}
+		json.NewDecoder(r.Body).Decode(&req)
+
+		pkgs := make([]Package, 0)
+		for _, q := range req.Packages {
+			if q.StorePath == "/nix/store/bbbb-libbilling-2.1.0" {
+				pkgs = append(pkgs, Package{StorePath: q.StorePath, Name: "billing-core", Owner: "payments", License: "LicenseRef-Internal", InternalID: "PKG-42", Purl: "pkg:generic/acme/billing-core@2.1.0"})
+			}
+		}
+		json.NewEncoder(w).Encode(map[string][]Package{"packages": pkgs})
+	}))
+	defer srv.Close()
+
+	graph := gographviz.NewGraph()
+	graph.SetName("G")
+	for _, name := range []string{`"aaaa-openssl-3.0.13"`, `"bbbb-libbilling-2.1.0"`} {
+		if err := graph.AddNode("G", name, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	graph.Nodes.Lookup[`"bbbb-libbilling-2.1.0"`].Attrs["name"] = "libbilling"
+	graph.Nodes.Lookup[`"bbbb-libbilling-2.1.0"`].Attrs["version"] = "2.1.0"
+
+	c := &Client{Endpoint: srv.URL, Token: "secret"}
+	pkgs, err := c.Lookup(context.Background(), Queries(graph))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := Annotate(graph, pkgs); n != 1 {
+		t.Fatalf("expected 1 annotated node, got %d", n)
+	}
+
+	attrs := graph.Nodes.Lookup[`"bbbb-libbilling-2.1.0"`].Attrs
+	if attrs["name"] != "billing-core" || attrs["version"] != "2.1.0" || attrs["owner"] != "payments" || attrs["internal_id"] != "PKG-42" {
+		t.Errorf("unexpected attributes %v", attrs)
+	}
+	if _, ok := graph.Nodes.Lookup[`"aaaa-openssl-3.0.13"`].Attrs["owner"]; ok {
+		t.Errorf("nixpkgs component should not be annotated")
+	}
+
+	c.Token = ""
+	if _, err := c.Lookup(context.Background(), Queries(graph)); err == nil {
+		t.Errorf("expected an error without the token")
+	}
+}
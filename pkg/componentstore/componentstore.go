@@ -0,0 +1,324 @@
+// Package componentstore stores the SBOMs of the projects of an organization in a directory shared by their builds,
+// e.g. on a build server. The components of the closures are stored once, content-addressed, whatever the number of
+// projects and builds depending on them, and the SBOM of a build is kept as a reference document listing them.
+// Components are indexed by name and store path, so the projects using one are found without reading any SBOM.
+//
+//	components/<xx>/<digest>.pb     a component, a protobom node
+//	documents/<project>/<build>.json the reference document of a build
+//	index/names/<name>/<digest>      the components of a name
+//	index/paths/<store path>/<digest> the components of a store path
+//	index/users/<digest>/<project>   the projects using a component
+package componentstore
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bom-squad/protobom/pkg/sbom"
+	"google.golang.org/protobuf/proto"
+
+	bio "github.com/buildsafedev/bsf/pkg/io"
+	bsbom "github.com/buildsafedev/bsf/pkg/sbom"
+)
+
+// SchemaVersion is the version of the reference documents
+const SchemaVersion = 1
+
+// Reference is the SBOM of a build of a project, without the components shared through the store
+type Reference struct {
+	SchemaVersion int       `json:"schemaVersion"`
+	Project       string    `json:"project"`
+	Build         string    `json:"build"`
+	Time          time.Time `json:"time"`
+	// Document is the SBOM without its shared components, in the protobom format
+	Document []byte `json:"document"`
+	// Components are the digests of the shared components of the SBOM
+	Components []string `json:"components"`
+}
+
+// Usage is a component of the store used by a project
+type Usage struct {
+	Project   string `json:"project"`
+	Digest    string `json:"digest"`
+	Name      string `json:"name"`
+	Version   string `json:"version"`
+	StorePath string `json:"storePath,omitempty"`
+}
+
+// PutResult counts the components of a stored SBOM
+type PutResult struct {
+	// Components is the number of shared components of the SBOM
+	Components int
+	// Added is the number of them the store didn't have yet
+	Added int
+}
+
+// Store is a component store in a directory
+type Store struct {
+	Dir string
+}
+
+// Open returns the store in dir, creating it when it doesn't exist
+func Open(dir string) (*Store, error) {
+	for _, sub := range []string{"components", "documents", "index"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0755); err != nil {
+			return nil, err
+		}
+	}
+	return &Store{Dir: dir}, nil
+}
+
+// Put stores the SBOM of the build of the project, replacing the one stored for the same build. The closure
+// components, those with a store path, are stored once and referenced by the document, the root components stay in it.
+func (s *Store) Put(project, build string, doc *sbom.Document, now time.Time) (*PutResult, error) {
+	if project == "" || build == "" {
+		return nil, fmt.Errorf("the project and the build of the SBOM are required")
+	}
+	roots := make(map[string]bool, len(doc.NodeList.RootElements))
+	for _, id := range doc.NodeList.RootElements {
+		roots[id] = true
+	}
+
+	skeleton := proto.Clone(doc).(*sbom.Document)
+	kept := make([]*sbom.Node, 0, len(roots))
+	ref := &Reference{SchemaVersion: SchemaVersion, Project: project, Build: build, Time: now.UTC(), Components: make([]string, 0)}
+	result := &PutResult{}
+	for _, node := range skeleton.NodeList.Nodes {
+		if roots[node.Id] || bsbom.StorePath(node) == "" {
+			kept = append(kept, node)
+			continue
+		}
+		digest, added, err := s.putComponent(node)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.index(project, digest, node); err != nil {
+			return nil, err
+		}
+		ref.Components = append(ref.Components, digest)
+		result.Components++
+		if added {
+			result.Added++
+		}
+	}
+	skeleton.NodeList.Nodes = kept
+
+	var err error
+	ref.Document, err = proto.MarshalOptions{Deterministic: true}.Marshal(skeleton)
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(ref)
+	if err != nil {
+		return nil, err
+	}
+	file := s.documentPath(project, build)
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return nil, err
+	}
+	if err := bio.WriteAtomic(file, data); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// putComponent stores the component unless the store has it, and returns its digest
+func (s *Store) putComponent(node *sbom.Node) (string, bool, error) {
+	data, err := proto.MarshalOptions{Deterministic: true}.Marshal(node)
+	if err != nil {
+		return "", false, err
+	}
+	sum := sha256.Sum256(data)
+	digest := hex.EncodeToString(sum[:])
+	file := s.componentPath(digest)
+	if _, err := os.Stat(file); err == nil {
+		return digest, false, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return "", false, err
+	}
+	return digest, true, bio.WriteAtomic(file, data)
+}
+
+// index records the component under its name and store path, and its use by the project
+func (s *Store) index(project, digest string, node *sbom.Node) error {
+	markers := []string{
+		filepath.Join(s.Dir, "index", "names", escapeName(node.Name), digest),
+		filepath.Join(s.Dir, "index", "users", digest, escapeName(project)),
+	}
+	if p := bsbom.StorePath(node); p != "" {
+		markers = append(markers, filepath.Join(s.Dir, "index", "paths", escapeName(path.Base(p)), digest))
+	}
+	for _, m := range markers {
+		if _, err := os.Stat(m); err == nil {
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(m), 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(m, nil, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Get returns the SBOM of the build of the project, with its components read from the store
+func (s *Store) Get(project, build string) (*sbom.Document, error) {
+	ref, err := s.Reference(project, build)
+	if err != nil {
+		return nil, err
+	}
+	doc := &sbom.Document{}
+	if err := proto.Unmarshal(ref.Document, doc); err != nil {
+		return nil, fmt.Errorf("invalid document of %s/%s: %v", project, build, err)
+	}
+	for _, digest := range ref.Components {
+		node, err := s.Component(digest)
+		if err != nil {
+			return nil, err
+		}
+		doc.NodeList.Nodes = append(doc.NodeList.Nodes, node)
+	}
+	return doc, nil
+}
+
+// Reference returns the reference document of the build of the project
+func (s *Store) Reference(project, build string) (*Reference, error) {
+	data, err := os.ReadFile(s.documentPath(project, build))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("no SBOM of build %s of %s in the component store", build, project)
+	}
+	if err != nil {
+		return nil, err
+	}
+	ref := &Reference{}
+	if err := json.Unmarshal(data, ref); err != nil {
+		return nil, fmt.Errorf("invalid reference document of %s/%s: %v", project, build, err)
+	}
+	return ref, nil
+}
+
+// Builds returns the builds of the project with a SBOM in the store, the most recent first
+func (s *Store) Builds(project string) ([]*Reference, error) {
+	entries, err := os.ReadDir(filepath.Join(s.Dir, "documents", escapeName(project)))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	refs := make([]*Reference, 0, len(entries))
+	for _, e := range entries {
+		build, err := url.PathUnescape(strings.TrimSuffix(e.Name(), ".json"))
+		if err != nil || !strings.HasSuffix(e.Name(), ".json") {
+			continue
+		}
+		ref, err := s.Reference(project, build)
+		if err != nil {
+			return nil, err
+		}
+		refs = append(refs, ref)
+	}
+	sort.SliceStable(refs, func(i, j int) bool { return refs[i].Time.After(refs[j].Time) })
+	return refs, nil
+}
+
+// Component returns the component of the digest
+func (s *Store) Component(digest string) (*sbom.Node, error) {
+	if b, err := hex.DecodeString(digest); err != nil || len(b) != sha256.Size {
+		return nil, fmt.Errorf("invalid component digest %q", digest)
+	}
+	data, err := os.ReadFile(s.componentPath(digest))
+	if err != nil {
+		return nil, fmt.Errorf("component %s is missing from the store: %v", digest, err)
+	}
+	node := &sbom.Node{}
+	if err := proto.Unmarshal(data, node); err != nil {
+		return nil, fmt.Errorf("invalid component %s: %v", digest, err)
+	}
+	return node, nil
+}
+
+// UsedBy returns the projects whose stored builds use the components of a name, e.g. openssl, or of a store path
+func (s *Store) UsedBy(query string) ([]Usage, error) {
+	dir := filepath.Join(s.Dir, "index", "names", escapeName(query))
+	if strings.HasPrefix(query, "/nix/store/") {
+		dir = filepath.Join(s.Dir, "index", "paths", escapeName(path.Base(query)))
+	}
+	digests, err := readNames(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	usages := make([]Usage, 0)
+	for _, digest := range digests {
+		node, err := s.Component(digest)
+		if err != nil {
+			return nil, err
+		}
+		projects, err := readNames(filepath.Join(s.Dir, "index", "users", digest))
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range projects {
+			project, err := url.PathUnescape(p)
+			if err != nil {
+				continue
+			}
+			usages = append(usages, Usage{Project: project, Digest: digest, Name: node.Name, Version: node.Version, StorePath: bsbom.StorePath(node)})
+		}
+	}
+	sort.SliceStable(usages, func(i, j int) bool {
+		if usages[i].Project != usages[j].Project {
+			return usages[i].Project < usages[j].Project
+		}
+		return usages[i].Version < usages[j].Version
+	})
+	return usages, nil
+}
+
+func (s *Store) componentPath(digest string) string {
+	return filepath.Join(s.Dir, "components", digest[:2], digest+".pb")
+}
+
+func (s *Store) documentPath(project, build string) string {
+	return filepath.Join(s.Dir, "documents", escapeName(project), escapeName(build)+".json")
+}
+
+// escapeName escapes a name, e.g. of a project or a component, as a single element of a path of the store. . and ..
+// are escaped too, so names can't point to the parent directory.
+func escapeName(name string) string {
+	switch escaped := url.PathEscape(name); escaped {
+	case ".", "..":
+		return strings.Repeat("%2E", len(escaped))
+	default:
+		return escaped
+	}
+}
+
+// readNames returns the names of the entries of dir, none when it doesn't exist
+func readNames(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	return names, nil
+}
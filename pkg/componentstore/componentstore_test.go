@@ -0,0 +1,88 @@
+package componentstore
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bom-squad/protobom/pkg/sbom"
+
+	bsbom "github.com/buildsafedev/bsf/pkg/sbom"
+)
+
+const (
+	openssl = "/nix/store/1ac3r0gk2fqsy3hkq8m4xhhlq4gfgnc4-openssl-3.0.13"
+	curl    = "/nix/store/2kdc6mhcdkxq4jyzhm6xn2n0v8rz9vzr-curl-8.7.1"
+)
+
+func document(app string, components map[string]string) *sbom.Document {
+	doc := sbom.NewDocument()
+	root := &sbom.Node{Id: app, Name: app, ExternalReferences: []*sbom.ExternalReference{{Url: "/nix/store/0c9rf6rgcfd5j9b9wgzcm4cfdpi8wq5f-" + app, Comment: bsbom.StorePathComment}}}
+	doc.NodeList.AddRootNode(root)
+	for name, storePath := range components {
+		node := &sbom.Node{Id: name, Name: name, Version: storePath[len(storePath)-6:], ExternalReferences: []*sbom.ExternalReference{{Url: storePath, Comment: bsbom.StorePathComment}}}
+		doc.NodeList.AddNode(node)
+		doc.NodeList.RelateNodeAtID(node, root.Id, sbom.Edge_contains)
+	}
+	return doc
+}
+
+func TestStore(t *testing.T) {
+	s, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+
+	res, err := s.Put("api", "v1", document("api", map[string]string{"openssl": openssl, "curl": curl}), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Components != 2 || res.Added != 2 {
+		t.Errorf("Put() = %+v, want 2 components added", res)
+	}
+	res, err = s.Put("org/worker", "v2", document("worker", map[string]string{"openssl": openssl}), now.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Components != 1 || res.Added != 0 {
+		t.Errorf("Put() = %+v, want the component shared with api", res)
+	}
+
+	components, _ := filepath.Glob(filepath.Join(s.Dir, "components", "*", "*.pb"))
+	if len(components) != 2 {
+		t.Errorf("%d components stored, want 2", len(components))
+	}
+
+	doc, err := s.Get("org/worker", "v2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(doc.NodeList.Nodes) != 2 || len(doc.NodeList.RootElements) != 1 || len(doc.NodeList.Edges) != 1 {
+		t.Errorf("Get() = %d nodes, %d roots, %d edges", len(doc.NodeList.Nodes), len(doc.NodeList.RootElements), len(doc.NodeList.Edges))
+	}
+	if n := doc.NodeList.GetNodeByID("openssl"); n == nil || bsbom.StorePath(n) != openssl {
+		t.Errorf("component not restored: %v", n)
+	}
+
+	for _, query := range []string{"openssl", openssl} {
+		usages, err := s.UsedBy(query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(usages) != 2 || usages[0].Project != "api" || usages[1].Project != "org/worker" || usages[0].StorePath != openssl {
+			t.Errorf("UsedBy(%q) = %+v", query, usages)
+		}
+	}
+	if usages, err := s.UsedBy("zlib"); err != nil || len(usages) != 0 {
+		t.Errorf("UsedBy(zlib) = %+v, %v", usages, err)
+	}
+
+	if _, err := s.Get("api", "v9"); err == nil {
+		t.Error("expected an error for a build not in the store")
+	}
+	if _, err := os.Stat(s.documentPath("org/worker", "v2")); err != nil {
+		t.Errorf("project names with slashes should be escaped: %v", err)
+	}
+}
@@ -1,7 +1,62 @@
 package config
 
+import (
+	"github.com/buildsafedev/bsf/pkg/profile"
+	"github.com/buildsafedev/bsf/pkg/purpose"
+	"github.com/buildsafedev/bsf/pkg/toolchain"
+)
+
 // Config is the configuration for the bsf cli
 type Config struct {
 	BuildSafeAPI    string `json:"buildsafe_api"`
 	BuildSafeAPITLS bool   `json:"buildsafe_api_tls"`
+	// MetadataCache is the shared location (https:// or s3://) of the nixpkgs metadata cache
+	MetadataCache string `json:"metadata_cache,omitempty"`
+	// BuildRecords is the shared location (a directory, https:// or s3://) bsf report sync merges the build records
+	// of the team at
+	BuildRecords string `json:"build_records,omitempty"`
+	// PackageRegistry is the internal package metadata endpoint queried for components of private nixpkgs overlays
+	PackageRegistry string `json:"package_registry,omitempty"`
+	// PurlNamespace is the package url type and namespace of the organization, e.g. pkg:generic/acme. bsf build gives
+	// it to the internal components of the SBOMs, the ones without a public identifier.
+	PurlNamespace string `json:"purl_namespace,omitempty"`
+	// InternalPackages are the name patterns of the internal components, e.g. acme-*. When empty, the components
+	// nixpkgs has no package of and no alias maps to an upstream ecosystem are internal.
+	InternalPackages []string `json:"internal_packages,omitempty"`
+	// Catalog is the approved package catalog of the organization (a path or an https:// URL), bsf build reports the
+	// closure components it doesn't approve
+	Catalog string `json:"catalog,omitempty"`
+	// ComponentStore is the directory of the component store the projects of the organization share in server mode,
+	// e.g. on a build server. bsf build stores its SBOMs there, see package componentstore.
+	ComponentStore string `json:"component_store,omitempty"`
+	// Telemetry opts in to sending anonymous usage statistics, see bsf telemetry
+	Telemetry bool `json:"telemetry,omitempty"`
+	// TelemetryEndpoint overrides the endpoint telemetry is sent to
+	TelemetryEndpoint string `json:"telemetry_endpoint,omitempty"`
+	// Store is the nix store to build in and read from, e.g. local?root=/tmp/nix-root, or the remote store or binary
+	// cache to query closures from, e.g. ssh-ng://builder or https://cache.example.com
+	Store string `json:"store,omitempty"`
+	// HashWorkers limits the number of closure paths annotated at once
+	HashWorkers int `json:"hash_workers,omitempty"`
+	// MaxJobs is the number of derivations nix builds at once
+	MaxJobs int `json:"max_jobs,omitempty"`
+	// Cores is the number of cores each nix build job can use
+	Cores int `json:"cores,omitempty"`
+	// Nice is the niceness bsf and the nix commands it runs have, e.g. 10 on shared build servers
+	Nice int `json:"nice,omitempty"`
+	// IOClass is the IO scheduling class of bsf and the nix commands it runs: idle, best-effort or realtime,
+	// the level can follow a colon, e.g. best-effort:7
+	IOClass string `json:"io_class,omitempty"`
+	// KeepEnv are the variables nix commands keep in addition to the defaults, e.g. NIX_CONFIG
+	KeepEnv []string `json:"keep_env,omitempty"`
+	// Profile is the profile of flag defaults bsf runs with when --profile isn't given, e.g. ci on build servers
+	Profile string `json:"profile,omitempty"`
+	// Profiles are the custom profiles, by name. They override the flags of the builtin profile of the same name.
+	Profiles map[string]profile.Profile `json:"profiles,omitempty"`
+	// PurposeDetectors recognise the results of the organization bsf doesn't, e.g. helm charts as DATA, from their
+	// files. They are tried before the builtin detectors, see package purpose.
+	PurposeDetectors []purpose.Rule `json:"purpose_detectors,omitempty"`
+	// Toolchain are the paths and digests the external tools bsf runs must match, by tool name, e.g. nix.
+	// Tools that are not listed are not verified.
+	Toolchain map[string]toolchain.Trust `json:"toolchain,omitempty"`
 }
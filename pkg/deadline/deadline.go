@@ -0,0 +1,162 @@
+// Package deadline enforces the wall-clock budget of a bsf run. External commands are started with the budget's
+// context and get SIGTERM when it runs out, commands then stop at the next phase boundary and persist what they
+// completed. A watchdog exits the process if it is still running after a grace period.
+package deadline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/buildsafedev/bsf/pkg/shutdown"
+)
+
+const (
+	// Grace is how long after the budget ran out the watchdog waits for the run to stop by itself
+	Grace = 30 * time.Second
+	// KillDelay is how long an external command has to exit after SIGTERM before it is killed
+	KillDelay = 10 * time.Second
+	// ExitCode is the exit code of runs that exceeded their budget, the code of timeout(1)
+	ExitCode = 124
+)
+
+// ErrExceeded is returned when the budget of the run was exceeded
+var ErrExceeded = errors.New("time budget exceeded")
+
+var (
+	mu             sync.Mutex
+	ctx            = context.Background()
+	cancel         = func() {}
+	budget         time.Duration
+	start          = time.Now()
+	commandTimeout time.Duration
+	onExpire       []func()
+	watchdog       *time.Timer
+)
+
+// Set starts the budget of the run, 0 means no budget. Each external command is limited to perCommand when it is set.
+func Set(d, perCommand time.Duration) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	cancel()
+	if watchdog != nil {
+		watchdog.Stop()
+	}
+	start = time.Now()
+	budget = d
+	commandTimeout = perCommand
+	onExpire = nil
+	if d <= 0 {
+		ctx, cancel = context.Background(), func() {}
+		return
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), d)
+	watchdog = time.AfterFunc(d+Grace, func() {
+		fmt.Fprintf(os.Stderr, "error: %s after %s, stopping\n", ErrExceeded, d)
+		expire()
+		shutdown.Exit(ExitCode, ErrExceeded)
+	})
+}
+
+// Context returns the context of the run, it is done when the budget runs out
+func Context() context.Context {
+	mu.Lock()
+	defer mu.Unlock()
+	return ctx
+}
+
+// Exceeded reports if the budget ran out
+func Exceeded() bool {
+	return errors.Is(Context().Err(), context.DeadlineExceeded)
+}
+
+// Elapsed returns the time since the run started
+func Elapsed() time.Duration {
+	mu.Lock()
+	defer mu.Unlock()
+	return time.Since(start)
+}
+
+// Budget returns the budget of the run, 0 when there is none
+func Budget() time.Duration {
+	mu.Lock()
+	defer mu.Unlock()
+	return budget
+}
+
+// OnExpire registers a function persisting partial results, it runs if the watchdog has to stop the run
+func OnExpire(f func()) {
+	mu.Lock()
+	defer mu.Unlock()
+	onExpire = append(onExpire, f)
+}
+
+func expire() {
+	mu.Lock()
+	hooks := onExpire
+	onExpire = nil
+	mu.Unlock()
+	for _, f := range hooks {
+		f()
+	}
+}
+
+// Command returns the external command limited by the budget of the run and the per-command timeout, and stopped
+// when the run shuts down. The command gets SIGTERM to stop gracefully, and is killed if it is still running KillDelay
+// later. The returned cancel function must be called once the command is done.
+func Command(name string, args ...string) (*exec.Cmd, context.CancelFunc) {
+	return CommandContext(shutdown.Context(), name, args...)
+}
+
+// CommandContext returns the external command as Command does, also stopped when c is done, e.g. when a phase of
+// the run has its own deadline
+func CommandContext(c context.Context, name string, args ...string) (*exec.Cmd, context.CancelFunc) {
+	mu.Lock()
+	cmdCtx, cmdCancel := ctx, context.CancelFunc(func() {})
+	if commandTimeout > 0 {
+		cmdCtx, cmdCancel = context.WithTimeout(ctx, commandTimeout)
+	}
+	mu.Unlock()
+	// contexts that are never done, such as context.Background(), don't stop the command
+	if c.Done() != nil {
+		timeoutCancel := cmdCancel
+		var cancel context.CancelFunc
+		cmdCtx, cancel = context.WithCancel(cmdCtx)
+		stop := context.AfterFunc(c, cancel)
+		cmdCancel = func() {
+			stop()
+			cancel()
+			timeoutCancel()
+		}
+	}
+
+	cmd := exec.CommandContext(cmdCtx, name, args...)
+	cmd.Cancel = func() error {
+		return cmd.Process.Signal(syscall.SIGTERM)
+	}
+	cmd.WaitDelay = KillDelay
+	return cmd, cmdCancel
+}
+
+// Wrap explains the error of a command stopped because it ran out of time
+func Wrap(cmd *exec.Cmd, err error) error {
+	if err == nil {
+		return nil
+	}
+	if Exceeded() {
+		return fmt.Errorf("%s was stopped: %w", cmd.Path, ErrExceeded)
+	}
+	if commandTimeout > 0 && cmd.ProcessState != nil && !cmd.ProcessState.Success() && cmd.Err == nil {
+		if status, ok := cmd.ProcessState.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+			return fmt.Errorf("%s was stopped after the per-command timeout of %s: %v", cmd.Path, commandTimeout, err)
+		}
+	}
+	return err
+}
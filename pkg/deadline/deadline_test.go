@@ -0,0 +1,82 @@
+package deadline
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"testing"
+	"time"
+)
+
+func TestCommand(t *testing.T) {
+	if _, err := exec.LookPath("sleep"); err != nil {
+		t.Skip("sleep is not available")
+	}
+
+	tests := []struct {
+		name       string
+		budget     time.Duration
+		perCommand time.Duration
+		exceeded   bool
+	}{
+		{name: "no budget", exceeded: false},
+		{name: "budget", budget: 100 * time.Millisecond, exceeded: true},
+		{name: "per-command timeout", perCommand: 100 * time.Millisecond, exceeded: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			Set(tt.budget, tt.perCommand)
+			defer Set(0, 0)
+
+			args := "5"
+			if tt.budget == 0 && tt.perCommand == 0 {
+				args = "0"
+			}
+			cmd, cancel := Command("sleep", args)
+			defer cancel()
+
+			start := time.Now()
+			err := Wrap(cmd, cmd.Run())
+			if time.Since(start) > 3*time.Second {
+				t.Errorf("expected the command to be stopped, it ran for %s", time.Since(start))
+			}
+			if tt.budget == 0 && tt.perCommand == 0 {
+				if err != nil {
+					t.Errorf("unexpected error %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("expected the command to be stopped")
+			}
+			if errors.Is(err, ErrExceeded) != tt.exceeded || Exceeded() != tt.exceeded {
+				t.Errorf("expected exceeded=%v, got %v", tt.exceeded, err)
+			}
+		})
+	}
+}
+
+func TestCommandContext(t *testing.T) {
+	if _, err := exec.LookPath("sleep"); err != nil {
+		t.Skip("sleep is not available")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	cmd, cmdCancel := CommandContext(ctx, "sleep", "5")
+	defer cmdCancel()
+
+	start := time.Now()
+	err := Wrap(cmd, cmd.Run())
+	if time.Since(start) > 3*time.Second {
+		t.Errorf("expected the command to be stopped, it ran for %s", time.Since(start))
+	}
+	if err == nil {
+		t.Fatalf("expected the command to be stopped")
+	}
+	// the run has no budget, only the command was stopped
+	if errors.Is(err, ErrExceeded) || Exceeded() {
+		t.Errorf("unexpected exceeded budget: %v", err)
+	}
+}
@@ -0,0 +1,169 @@
+// Package depgraph is the dependency graph of a closure, independent of the DOT graphs nix prints, with exporters
+// to JSON, GraphML, Mermaid and DOT. Nodes are identified by the name of their store path and kept sorted, so the
+// exports of a closure are the same on every run and can be diffed.
+package depgraph
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/awalterschulze/gographviz"
+)
+
+// StoreDir is the directory of the store paths of the nodes
+const StoreDir = "/nix/store"
+
+// Node is a store path of the closure and its annotations, e.g. name, version and hash
+type Node struct {
+	// ID is the name of the store path, e.g. 0c5nd8lq...-openssl-3.0.13
+	ID    string            `json:"id"`
+	Attrs map[string]string `json:"attrs,omitempty"`
+}
+
+// StorePath returns the store path of the node
+func (n *Node) StorePath() string {
+	return StoreDir + "/" + n.ID
+}
+
+// Edge is a reference between two store paths. As in the graphs of nix-store --query --graph, it points from the
+// dependency to the dependent, its reftype attribute says whether it is a runtime, build or build tool reference.
+type Edge struct {
+	From  string            `json:"from"`
+	To    string            `json:"to"`
+	Attrs map[string]string `json:"attrs,omitempty"`
+}
+
+// Graph is the dependency graph of a closure. Nodes are sorted by ID, edges by their ends.
+type Graph struct {
+	Nodes []*Node
+	Edges []*Edge
+	// Project is the bsf project the closure was built for, exports to graph databases link it to the roots
+	Project string
+
+	nodes map[string]*Node
+	edges map[string]bool
+}
+
+// New returns an empty graph
+func New() *Graph {
+	return &Graph{nodes: make(map[string]*Node), edges: make(map[string]bool)}
+}
+
+// AddNode adds the node with the attributes, the attributes of a node already in the graph are merged
+func (g *Graph) AddNode(id string, attrs map[string]string) *Node {
+	n, ok := g.nodes[id]
+	if !ok {
+		n = &Node{ID: id, Attrs: make(map[string]string, len(attrs))}
+		g.nodes[id] = n
+		i := sort.Search(len(g.Nodes), func(i int) bool { return g.Nodes[i].ID >= id })
+		g.Nodes = append(g.Nodes, nil)
+		copy(g.Nodes[i+1:], g.Nodes[i:])
+		g.Nodes[i] = n
+	}
+	for k, v := range attrs {
+		n.Attrs[k] = v
+	}
+	return n
+}
+
+// AddEdge adds the edge from the dependency to the dependent, both are added to the graph if needed. Edges with the
+// same ends and attributes are added once.
+func (g *Graph) AddEdge(from, to string, attrs map[string]string) {
+	g.AddNode(from, nil)
+	g.AddNode(to, nil)
+	e := &Edge{From: from, To: to, Attrs: make(map[string]string, len(attrs))}
+	for k, v := range attrs {
+		e.Attrs[k] = v
+	}
+	if g.edges[e.key()] {
+		return
+	}
+	g.edges[e.key()] = true
+	i := sort.Search(len(g.Edges), func(i int) bool { return g.Edges[i].key() >= e.key() })
+	g.Edges = append(g.Edges, nil)
+	copy(g.Edges[i+1:], g.Edges[i:])
+	g.Edges[i] = e
+}
+
+// key orders the edges by dependency, dependent and attributes
+func (e *Edge) key() string {
+	return e.From + "\x00" + e.To + "\x00" + joinAttrs(e.Attrs)
+}
+
+// Node returns the node with the ID, nil when the graph has none
+func (g *Graph) Node(id string) *Node {
+	return g.nodes[id]
+}
+
+// ClosureOf returns the IDs of the nodes in the closure of the store path, including its own
+func (g *Graph) ClosureOf(storePath string) map[string]bool {
+	deps := make(map[string][]string)
+	for _, e := range g.Edges {
+		deps[e.To] = append(deps[e.To], e.From)
+	}
+	closure := make(map[string]bool)
+	queue := make([]string, 0)
+	if id := strings.TrimPrefix(storePath, StoreDir+"/"); g.nodes[id] != nil {
+		closure[id] = true
+		queue = append(queue, id)
+	}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		for _, dep := range deps[current] {
+			if !closure[dep] {
+				closure[dep] = true
+				queue = append(queue, dep)
+			}
+		}
+	}
+	return closure
+}
+
+// FromDOT converts the closure graph nix prints, and bsf annotates, to a graph. The quotes of node names and
+// attribute values are removed.
+func FromDOT(dot *gographviz.Graph) *Graph {
+	g := New()
+	for _, n := range dot.Nodes.Nodes {
+		g.AddNode(unquote(n.Name), dotAttrs(n.Attrs))
+	}
+	for _, e := range dot.Edges.Edges {
+		g.AddEdge(unquote(e.Src), unquote(e.Dst), dotAttrs(e.Attrs))
+	}
+	return g
+}
+
+func dotAttrs(attrs gographviz.Attrs) map[string]string {
+	m := make(map[string]string, len(attrs))
+	for k, v := range attrs {
+		m[string(k)] = unquote(v)
+	}
+	return m
+}
+
+// unquote removes the quotes of a DOT identifier
+func unquote(s string) string {
+	if len(s) >= 2 && strings.HasPrefix(s, `"`) && strings.HasSuffix(s, `"`) {
+		s = s[1 : len(s)-1]
+		s = strings.ReplaceAll(s, `\"`, `"`)
+	}
+	return s
+}
+
+// attrNames returns the sorted names of the attributes
+func attrNames(attrs map[string]string) []string {
+	names := make([]string, 0, len(attrs))
+	for k := range attrs {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func joinAttrs(attrs map[string]string) string {
+	var b strings.Builder
+	for _, k := range attrNames(attrs) {
+		b.WriteString(k + "=" + attrs[k] + "\x00")
+	}
+	return b.String()
+}
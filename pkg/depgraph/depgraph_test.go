@@ -0,0 +1,232 @@
+package depgraph
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/awalterschulze/gographviz"
+)
+
+// closureDOT returns the closure graph of curl as nix prints it and bsf annotates it
+func closureDOT(t *testing.T) *gographviz.Graph {
+	t.Helper()
+	dot := gographviz.NewGraph()
+	dot.SetName("G")
+	dot.SetDir(true)
+	for name, attrs := range map[string]gographviz.Attrs{
+		`"bbbb-openssl-3.0.13"`: {"name": "openssl", "version": "3.0.13"},
+		`"aaaa-curl-8.6.0"`:     {"name": "curl", "version": "8.6.0"},
+		`"cccc-cmake-3.28.3"`:   {"name": "cmake", "version": "3.28.3"},
+		`"dddd-unrelated-1.0"`:  {"name": "unrelated", "version": "1.0"},
+	} {
+		if err := dot.AddNode("G", name, nil); err != nil {
+			t.Fatal(err)
+		}
+		for k, v := range attrs {
+			dot.Nodes.Lookup[name].Attrs[k] = v
+		}
+	}
+	dot.Edges.Add(&gographviz.Edge{Src: `"bbbb-openssl-3.0.13"`, Dst: `"aaaa-curl-8.6.0"`, Dir: true, Attrs: gographviz.Attrs{"reftype": "runtime"}})
+	dot.Edges.Add(&gographviz.Edge{Src: `"cccc-cmake-3.28.3"`, Dst: `"aaaa-curl-8.6.0"`, Dir: true, Attrs: gographviz.Attrs{"reftype": "build"}})
+	// nix prints an edge for each reference, bsf may add it again
+	dot.Edges.Add(&gographviz.Edge{Src: `"bbbb-openssl-3.0.13"`, Dst: `"aaaa-curl-8.6.0"`, Dir: true, Attrs: gographviz.Attrs{"reftype": "runtime"}})
+	return dot
+}
+
+func TestFromDOT(t *testing.T) {
+	g := FromDOT(closureDOT(t))
+
+	ids := make([]string, 0, len(g.Nodes))
+	for _, n := range g.Nodes {
+		ids = append(ids, n.ID)
+	}
+	want := []string{"aaaa-curl-8.6.0", "bbbb-openssl-3.0.13", "cccc-cmake-3.28.3", "dddd-unrelated-1.0"}
+	if !reflect.DeepEqual(ids, want) {
+		t.Errorf("nodes = %v, want %v", ids, want)
+	}
+	if len(g.Edges) != 2 {
+		t.Fatalf("%d edges, want the runtime and build references of curl", len(g.Edges))
+	}
+	if e := g.Edges[0]; e.From != "bbbb-openssl-3.0.13" || e.To != "aaaa-curl-8.6.0" || e.Attrs["reftype"] != "runtime" {
+		t.Errorf("first edge = %+v", e)
+	}
+	if n := g.Node("bbbb-openssl-3.0.13"); n == nil || n.StorePath() != "/nix/store/bbbb-openssl-3.0.13" || n.Attrs["version"] != "3.0.13" {
+		t.Errorf("openssl = %+v", n)
+	}
+
+	closure := g.ClosureOf("/nix/store/aaaa-curl-8.6.0")
+	wantClosure := map[string]bool{"aaaa-curl-8.6.0": true, "bbbb-openssl-3.0.13": true, "cccc-cmake-3.28.3": true}
+	if !reflect.DeepEqual(closure, wantClosure) {
+		t.Errorf("ClosureOf(curl) = %v, want %v", closure, wantClosure)
+	}
+}
+
+func TestWrite(t *testing.T) {
+	for _, format := range Formats {
+		var first, second bytes.Buffer
+		if err := Write(&first, FromDOT(closureDOT(t)), format); err != nil {
+			t.Fatalf("Write(%s): %v", format, err)
+		}
+		if err := Write(&second, FromDOT(closureDOT(t)), format); err != nil {
+			t.Fatalf("Write(%s): %v", format, err)
+		}
+		if first.String() != second.String() {
+			t.Errorf("the %s exports of the same closure differ:\n%s\n%s", format, first.String(), second.String())
+		}
+	}
+
+	if err := Write(&bytes.Buffer{}, New(), "svg"); err == nil {
+		t.Error("Write(svg) succeeded")
+	}
+}
+
+func TestWriteJSON(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteJSON(&buf, FromDOT(closureDOT(t))); err != nil {
+		t.Fatal(err)
+	}
+	var doc struct {
+		Nodes []jsonNode `json:"nodes"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	curl := doc.Nodes[0]
+	if curl.ID != "aaaa-curl-8.6.0" || curl.StorePath != "/nix/store/aaaa-curl-8.6.0" || curl.Attrs["name"] != "curl" {
+		t.Errorf("curl = %+v", curl)
+	}
+	wantDeps := []jsonDependency{
+		{ID: "bbbb-openssl-3.0.13", Attrs: map[string]string{"reftype": "runtime"}},
+		{ID: "cccc-cmake-3.28.3", Attrs: map[string]string{"reftype": "build"}},
+	}
+	if !reflect.DeepEqual(curl.Dependencies, wantDeps) {
+		t.Errorf("dependencies of curl = %v, want %v", curl.Dependencies, wantDeps)
+	}
+	if deps := doc.Nodes[1].Dependencies; len(deps) != 0 {
+		t.Errorf("openssl has dependencies %v", deps)
+	}
+}
+
+func TestWriteGraphML(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteGraphML(&buf, FromDOT(closureDOT(t))); err != nil {
+		t.Fatal(err)
+	}
+	var doc graphML
+	if err := xml.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	if len(doc.Graph.Nodes) != 4 || len(doc.Graph.Edges) != 2 {
+		t.Fatalf("%d nodes and %d edges, want 4 and 2", len(doc.Graph.Nodes), len(doc.Graph.Edges))
+	}
+	keys := make(map[string]string)
+	for _, k := range doc.Keys {
+		keys[k.ID] = k.For + ":" + k.AttrName
+	}
+	want := map[string]string{"n_name": "node:name", "n_version": "node:version", "e_reftype": "edge:reftype"}
+	if !reflect.DeepEqual(keys, want) {
+		t.Errorf("keys = %v, want %v", keys, want)
+	}
+	if e := doc.Graph.Edges[1]; e.Source != "cccc-cmake-3.28.3" || e.Target != "aaaa-curl-8.6.0" || e.Data[0].Value != "build" {
+		t.Errorf("second edge = %+v", e)
+	}
+}
+
+func TestWriteMermaid(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteMermaid(&buf, FromDOT(closureDOT(t))); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		"flowchart LR",
+		`  n_aaaa_curl_8_6_0["curl 8.6.0"]`,
+		"  n_bbbb_openssl_3_0_13 --> n_aaaa_curl_8_6_0",
+		"  n_cccc_cmake_3_28_3 -->|build| n_aaaa_curl_8_6_0",
+	} {
+		if !strings.Contains(buf.String(), line+"\n") {
+			t.Errorf("missing %q in:\n%s", line, buf.String())
+		}
+	}
+}
+
+func TestWriteDOT(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteDOT(&buf, FromDOT(closureDOT(t))); err != nil {
+		t.Fatal(err)
+	}
+	// graphviz keeps attributes it doesn't know, gographviz only parses them
+	if _, err := gographviz.ParseString(buf.String()); err != nil {
+		t.Fatalf("%v:\n%s", err, buf.String())
+	}
+	for _, line := range []string{
+		`  "aaaa-curl-8.6.0" ["name"="curl", "version"="8.6.0"];`,
+		`  "cccc-cmake-3.28.3" -> "aaaa-curl-8.6.0" ["reftype"="build"];`,
+	} {
+		if !strings.Contains(buf.String(), line+"\n") {
+			t.Errorf("missing %q in:\n%s", line, buf.String())
+		}
+	}
+}
+
+func TestWriteCypher(t *testing.T) {
+	g := FromDOT(closureDOT(t))
+	g.Project = "curl"
+	var buf bytes.Buffer
+	if err := WriteCypher(&buf, g); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		"MERGE (c:Component {storePath: \"/nix/store/bbbb-openssl-3.0.13\"}) SET c.id = \"bbbb-openssl-3.0.13\", c += {`name`: \"openssl\", `version`: \"3.0.13\"};\n",
+		"MATCH (dependency:Component {storePath: \"/nix/store/cccc-cmake-3.28.3\"}), (dependent:Component {storePath: \"/nix/store/aaaa-curl-8.6.0\"}) MERGE (dependent)-[r:DEPENDS_ON]->(dependency) SET r += {`reftype`: \"build\"};\n",
+		"MERGE (:Project {name: \"curl\"});\n",
+		// the roots of the closure are curl and the unrelated path
+		"MERGE (p)-[:BUILDS]->(c);\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("the Cypher export doesn't contain %q:\n%s", want, out)
+		}
+	}
+	if n := strings.Count(out, "[:BUILDS]"); n != 2 {
+		t.Errorf("%d BUILDS relationships, want curl and unrelated", n)
+	}
+	if got := cypherQuote(`say "hi"\`); got != `"say \"hi\"\\"` {
+		t.Errorf("cypherQuote() = %s", got)
+	}
+}
+
+func TestWriteNTriples(t *testing.T) {
+	g := FromDOT(closureDOT(t))
+	g.Project = "curl"
+	var buf bytes.Buffer
+	if err := WriteNTriples(&buf, g); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	for _, want := range []string{
+		`<urn:nix:store:aaaa-curl-8.6.0> <https://buildsafe.dev/ns/closure#dependsOn> <urn:nix:store:bbbb-openssl-3.0.13> .`,
+		`<urn:nix:store:aaaa-curl-8.6.0> <https://buildsafe.dev/ns/closure#buildDependsOn> <urn:nix:store:cccc-cmake-3.28.3> .`,
+		`<urn:nix:store:bbbb-openssl-3.0.13> <https://buildsafe.dev/ns/closure#version> "3.0.13" .`,
+		`<urn:bsf:project:curl> <https://buildsafe.dev/ns/closure#builds> <urn:nix:store:aaaa-curl-8.6.0> .`,
+	} {
+		found := false
+		for _, l := range lines {
+			found = found || l == want
+		}
+		if !found {
+			t.Errorf("the N-Triples export doesn't contain %s", want)
+		}
+	}
+
+	buf.Reset()
+	if err := WriteSPARQL(&buf, g); err != nil {
+		t.Fatal(err)
+	}
+	if out := buf.String(); !strings.HasPrefix(out, "INSERT DATA {\n") || !strings.HasSuffix(out, "\n}\n") || strings.Count(out, " .\n") != len(lines) {
+		t.Errorf("unexpected SPARQL update:\n%s", out)
+	}
+}
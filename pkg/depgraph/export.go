@@ -0,0 +1,226 @@
+package depgraph
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// Formats of the exports
+const (
+	FormatJSON     = "json"
+	FormatGraphML  = "graphml"
+	FormatMermaid  = "mermaid"
+	FormatDOT      = "dot"
+	FormatCypher   = "cypher"
+	FormatNTriples = "ntriples"
+	FormatSPARQL   = "sparql"
+)
+
+// Formats are the formats graphs are exported to
+var Formats = []string{FormatJSON, FormatGraphML, FormatMermaid, FormatDOT, FormatCypher, FormatNTriples, FormatSPARQL}
+
+// Write exports the graph in the format
+func Write(w io.Writer, g *Graph, format string) error {
+	switch format {
+	case FormatJSON:
+		return WriteJSON(w, g)
+	case FormatGraphML:
+		return WriteGraphML(w, g)
+	case FormatMermaid:
+		return WriteMermaid(w, g)
+	case FormatDOT:
+		return WriteDOT(w, g)
+	case FormatCypher:
+		return WriteCypher(w, g)
+	case FormatNTriples:
+		return WriteNTriples(w, g)
+	case FormatSPARQL:
+		return WriteSPARQL(w, g)
+	}
+	return fmt.Errorf("unsupported graph format %q, use %s", format, strings.Join(Formats, ", "))
+}
+
+// jsonNode is a node of the JSON export with the store paths it references
+type jsonNode struct {
+	ID           string            `json:"id"`
+	StorePath    string            `json:"storePath"`
+	Attrs        map[string]string `json:"attrs,omitempty"`
+	Dependencies []jsonDependency  `json:"dependencies"`
+}
+
+type jsonDependency struct {
+	ID    string            `json:"id"`
+	Attrs map[string]string `json:"attrs,omitempty"`
+}
+
+// WriteJSON exports the graph as an adjacency list: the nodes with their attributes and dependencies
+func WriteJSON(w io.Writer, g *Graph) error {
+	nodes := make([]jsonNode, 0, len(g.Nodes))
+	index := make(map[string]int, len(g.Nodes))
+	for i, n := range g.Nodes {
+		index[n.ID] = i
+		nodes = append(nodes, jsonNode{ID: n.ID, StorePath: n.StorePath(), Attrs: n.Attrs, Dependencies: make([]jsonDependency, 0)})
+	}
+	for _, e := range g.Edges {
+		n := &nodes[index[e.To]]
+		n.Dependencies = append(n.Dependencies, jsonDependency{ID: e.From, Attrs: e.Attrs})
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(struct {
+		Nodes []jsonNode `json:"nodes"`
+	}{nodes})
+}
+
+type graphML struct {
+	XMLName xml.Name     `xml:"graphml"`
+	Xmlns   string       `xml:"xmlns,attr"`
+	Keys    []graphMLKey `xml:"key"`
+	Graph   struct {
+		ID          string        `xml:"id,attr"`
+		EdgeDefault string        `xml:"edgedefault,attr"`
+		Nodes       []graphMLNode `xml:"node"`
+		Edges       []graphMLEdge `xml:"edge"`
+	} `xml:"graph"`
+}
+
+type graphMLKey struct {
+	ID       string `xml:"id,attr"`
+	For      string `xml:"for,attr"`
+	AttrName string `xml:"attr.name,attr"`
+	AttrType string `xml:"attr.type,attr"`
+}
+
+type graphMLNode struct {
+	ID   string        `xml:"id,attr"`
+	Data []graphMLData `xml:"data"`
+}
+
+type graphMLEdge struct {
+	Source string        `xml:"source,attr"`
+	Target string        `xml:"target,attr"`
+	Data   []graphMLData `xml:"data"`
+}
+
+type graphMLData struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:",chardata"`
+}
+
+// WriteGraphML exports the graph as GraphML, with a key for each attribute of the nodes and edges
+func WriteGraphML(w io.Writer, g *Graph) error {
+	doc := graphML{Xmlns: "http://graphml.graphdrawing.org/xmlns"}
+	doc.Graph.ID = "closure"
+	doc.Graph.EdgeDefault = "directed"
+
+	nodeKeys := make(map[string]string)
+	for _, n := range g.Nodes {
+		for k := range n.Attrs {
+			nodeKeys[k] = "n_" + k
+		}
+	}
+	edgeKeys := make(map[string]string)
+	for _, e := range g.Edges {
+		for k := range e.Attrs {
+			edgeKeys[k] = "e_" + k
+		}
+	}
+	for _, k := range attrNames(nodeKeys) {
+		doc.Keys = append(doc.Keys, graphMLKey{ID: nodeKeys[k], For: "node", AttrName: k, AttrType: "string"})
+	}
+	for _, k := range attrNames(edgeKeys) {
+		doc.Keys = append(doc.Keys, graphMLKey{ID: edgeKeys[k], For: "edge", AttrName: k, AttrType: "string"})
+	}
+
+	for _, n := range g.Nodes {
+		node := graphMLNode{ID: n.ID}
+		for _, k := range attrNames(n.Attrs) {
+			node.Data = append(node.Data, graphMLData{Key: nodeKeys[k], Value: n.Attrs[k]})
+		}
+		doc.Graph.Nodes = append(doc.Graph.Nodes, node)
+	}
+	for _, e := range g.Edges {
+		edge := graphMLEdge{Source: e.From, Target: e.To}
+		for _, k := range attrNames(e.Attrs) {
+			edge.Data = append(edge.Data, graphMLData{Key: edgeKeys[k], Value: e.Attrs[k]})
+		}
+		doc.Graph.Edges = append(doc.Graph.Edges, edge)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+var invalidMermaidChars = regexp.MustCompile(`[^a-zA-Z0-9_]+`)
+
+// mermaidID returns the Mermaid identifier of a node, Mermaid identifiers can't have dashes or dots
+func mermaidID(id string) string {
+	return "n_" + invalidMermaidChars.ReplaceAllString(id, "_")
+}
+
+// WriteMermaid exports the graph as a Mermaid flowchart. Nodes are labelled with their name and version, edges
+// other than runtime references with their reference type.
+func WriteMermaid(w io.Writer, g *Graph) error {
+	var b strings.Builder
+	b.WriteString("flowchart LR\n")
+	for _, n := range g.Nodes {
+		label := n.ID
+		if name := n.Attrs["name"]; name != "" {
+			label = strings.TrimSpace(name + " " + n.Attrs["version"])
+		}
+		fmt.Fprintf(&b, "  %s[\"%s\"]\n", mermaidID(n.ID), strings.ReplaceAll(label, `"`, "#quot;"))
+	}
+	for _, e := range g.Edges {
+		if reftype := e.Attrs["reftype"]; reftype != "" && reftype != "runtime" {
+			fmt.Fprintf(&b, "  %s -->|%s| %s\n", mermaidID(e.From), reftype, mermaidID(e.To))
+		} else {
+			fmt.Fprintf(&b, "  %s --> %s\n", mermaidID(e.From), mermaidID(e.To))
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// dotQuote quotes a DOT identifier
+func dotQuote(s string) string {
+	return `"` + strings.ReplaceAll(strings.ReplaceAll(s, `\`, `\\`), `"`, `\"`) + `"`
+}
+
+func dotAttrList(attrs map[string]string) string {
+	if len(attrs) == 0 {
+		return ""
+	}
+	list := make([]string, 0, len(attrs))
+	for _, k := range attrNames(attrs) {
+		list = append(list, dotQuote(k)+"="+dotQuote(attrs[k]))
+	}
+	return " [" + strings.Join(list, ", ") + "]"
+}
+
+// WriteDOT exports the graph as DOT, with the attributes of the nodes and edges
+func WriteDOT(w io.Writer, g *Graph) error {
+	var b strings.Builder
+	b.WriteString("digraph G {\n")
+	for _, n := range g.Nodes {
+		fmt.Fprintf(&b, "  %s%s;\n", dotQuote(n.ID), dotAttrList(n.Attrs))
+	}
+	for _, e := range g.Edges {
+		fmt.Fprintf(&b, "  %s -> %s%s;\n", dotQuote(e.From), dotQuote(e.To), dotAttrList(e.Attrs))
+	}
+	b.WriteString("}\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
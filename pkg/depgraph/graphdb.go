@@ -0,0 +1,142 @@
+package depgraph
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+)
+
+// Namespace is the namespace of the RDF classes and properties of the N-Triples and SPARQL exports
+const Namespace = "https://buildsafe.dev/ns/closure#"
+
+// roots returns the nodes no other node of the graph depends on, the results of the build
+func (g *Graph) roots() []*Node {
+	dependencies := make(map[string]bool, len(g.Edges))
+	for _, e := range g.Edges {
+		dependencies[e.From] = true
+	}
+	roots := make([]*Node, 0)
+	for _, n := range g.Nodes {
+		if !dependencies[n.ID] {
+			roots = append(roots, n)
+		}
+	}
+	return roots
+}
+
+// cypherQuote quotes a Cypher string literal
+func cypherQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s) + `"`
+}
+
+// cypherMap returns the attributes as a Cypher map literal, keys are escaped with backticks
+func cypherMap(attrs map[string]string) string {
+	entries := make([]string, 0, len(attrs))
+	for _, k := range attrNames(attrs) {
+		entries = append(entries, "`"+strings.ReplaceAll(k, "`", "``")+"`: "+cypherQuote(attrs[k]))
+	}
+	return "{" + strings.Join(entries, ", ") + "}"
+}
+
+// WriteCypher exports the graph as Cypher statements for Neo4j and other openCypher databases. Store paths are
+// merged as Component nodes keyed by their path, so the closures of several projects loaded in the same database
+// share their common components. Dependents have a DEPENDS_ON relationship to their dependencies, with the reference
+// type, and the project, when set, a BUILDS relationship to the roots of the closure.
+func WriteCypher(w io.Writer, g *Graph) error {
+	var b strings.Builder
+	b.WriteString("CREATE CONSTRAINT component_store_path IF NOT EXISTS FOR (c:Component) REQUIRE c.storePath IS UNIQUE;\n")
+	for _, n := range g.Nodes {
+		fmt.Fprintf(&b, "MERGE (c:Component {storePath: %s}) SET c.id = %s", cypherQuote(n.StorePath()), cypherQuote(n.ID))
+		if len(n.Attrs) > 0 {
+			fmt.Fprintf(&b, ", c += %s", cypherMap(n.Attrs))
+		}
+		b.WriteString(";\n")
+	}
+	for _, e := range g.Edges {
+		fmt.Fprintf(&b, "MATCH (dependency:Component {storePath: %s}), (dependent:Component {storePath: %s}) MERGE (dependent)-[r:DEPENDS_ON]->(dependency)",
+			cypherQuote(StoreDir+"/"+e.From), cypherQuote(StoreDir+"/"+e.To))
+		if len(e.Attrs) > 0 {
+			fmt.Fprintf(&b, " SET r += %s", cypherMap(e.Attrs))
+		}
+		b.WriteString(";\n")
+	}
+	if g.Project != "" {
+		fmt.Fprintf(&b, "MERGE (:Project {name: %s});\n", cypherQuote(g.Project))
+		for _, n := range g.roots() {
+			fmt.Fprintf(&b, "MATCH (p:Project {name: %s}), (c:Component {storePath: %s}) MERGE (p)-[:BUILDS]->(c);\n", cypherQuote(g.Project), cypherQuote(n.StorePath()))
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// rdfLiteral quotes an RDF string literal
+func rdfLiteral(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`).Replace(s) + `"`
+}
+
+// rdfIRI returns the IRI of a term of the namespace
+func rdfIRI(term string) string {
+	return "<" + Namespace + url.PathEscape(term) + ">"
+}
+
+// componentIRI returns the IRI of a store path, store paths are identified by their name in every store
+func componentIRI(id string) string {
+	return "<urn:nix:store:" + url.PathEscape(id) + ">"
+}
+
+// projectIRI returns the IRI of a project
+func projectIRI(name string) string {
+	return "<urn:bsf:project:" + url.PathEscape(name) + ">"
+}
+
+// triples returns the graph as N-Triples. Runtime references are dependsOn properties, the others are named after
+// their reference type, e.g. buildDependsOn.
+func triples(g *Graph) []string {
+	lines := make([]string, 0, len(g.Nodes)*3+len(g.Edges))
+	rdfType := "<http://www.w3.org/1999/02/22-rdf-syntax-ns#type>"
+	for _, n := range g.Nodes {
+		s := componentIRI(n.ID)
+		lines = append(lines, s+" "+rdfType+" "+rdfIRI("Component")+" .")
+		lines = append(lines, s+" "+rdfIRI("storePath")+" "+rdfLiteral(n.StorePath())+" .")
+		for _, k := range attrNames(n.Attrs) {
+			lines = append(lines, s+" "+rdfIRI(k)+" "+rdfLiteral(n.Attrs[k])+" .")
+		}
+	}
+	for _, e := range g.Edges {
+		predicate := "dependsOn"
+		if reftype := e.Attrs["reftype"]; reftype != "" && reftype != "runtime" {
+			predicate = reftype + "DependsOn"
+		}
+		lines = append(lines, componentIRI(e.To)+" "+rdfIRI(predicate)+" "+componentIRI(e.From)+" .")
+	}
+	if g.Project != "" {
+		p := projectIRI(g.Project)
+		lines = append(lines, p+" "+rdfType+" "+rdfIRI("Project")+" .")
+		lines = append(lines, p+" "+rdfIRI("name")+" "+rdfLiteral(g.Project)+" .")
+		for _, n := range g.roots() {
+			lines = append(lines, p+" "+rdfIRI("builds")+" "+componentIRI(n.ID)+" .")
+		}
+	}
+	return lines
+}
+
+// WriteNTriples exports the graph as RDF N-Triples, for bulk loading into triple stores
+func WriteNTriples(w io.Writer, g *Graph) error {
+	_, err := io.WriteString(w, strings.Join(triples(g), "\n")+"\n")
+	return err
+}
+
+// WriteSPARQL exports the graph as a SPARQL 1.1 update inserting its triples, for triple stores loaded over their
+// SPARQL endpoint
+func WriteSPARQL(w io.Writer, g *Graph) error {
+	var b strings.Builder
+	b.WriteString("INSERT DATA {\n")
+	for _, t := range triples(g) {
+		b.WriteString("  " + t + "\n")
+	}
+	b.WriteString("}\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
@@ -0,0 +1,244 @@
+package diff
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/bom-squad/protobom/pkg/sbom"
+)
+
+// Package is a component of a closure being compared
+type Package struct {
+	Name     string `json:"name"`
+	Version  string `json:"version"`
+	Hash     string `json:"hash,omitempty"`
+	Homepage string `json:"homepage,omitempty"`
+}
+
+// Change is a package that exists in both closures but differs in version or hash
+type Change struct {
+	Name       string `json:"name"`
+	OldVersion string `json:"oldVersion"`
+	NewVersion string `json:"newVersion"`
+	OldHash    string `json:"oldHash,omitempty"`
+	NewHash    string `json:"newHash,omitempty"`
+	Homepage   string `json:"homepage,omitempty"`
+}
+
+// Diff holds the differences between two closures
+type Diff struct {
+	Added      []Package `json:"added"`
+	Removed    []Package `json:"removed"`
+	Upgraded   []Change  `json:"upgraded"`
+	Downgraded []Change  `json:"downgraded"`
+	// Rebuilt holds packages whose version stayed the same but NAR hash changed
+	Rebuilt []Change `json:"rebuilt"`
+}
+
+// IsEmpty returns true if there are no differences
+func (d *Diff) IsEmpty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Upgraded) == 0 && len(d.Downgraded) == 0 && len(d.Rebuilt) == 0
+}
+
+// Compare compares the packages of two closures
+func Compare(oldPkgs, newPkgs []Package) *Diff {
+	d := &Diff{}
+	oldByName := groupByName(oldPkgs)
+	newByName := groupByName(newPkgs)
+
+	names := make([]string, 0, len(oldByName)+len(newByName))
+	for name := range oldByName {
+		names = append(names, name)
+	}
+	for name := range newByName {
+		if _, ok := oldByName[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		o, n := oldByName[name], newByName[name]
+
+		// pair up packages with the same version first
+		remainingOld := make([]Package, 0, len(o))
+		for _, op := range o {
+			matched := false
+			for i, np := range n {
+				if np.Version != op.Version {
+					continue
+				}
+				if op.Hash != "" && np.Hash != "" && op.Hash != np.Hash {
+					d.Rebuilt = append(d.Rebuilt, newChange(op, np))
+				}
+				n = append(n[:i:i], n[i+1:]...)
+				matched = true
+				break
+			}
+			if !matched {
+				remainingOld = append(remainingOld, op)
+			}
+		}
+
+		if len(remainingOld) == 1 && len(n) == 1 {
+			c := newChange(remainingOld[0], n[0])
+			if CompareVersions(c.OldVersion, c.NewVersion) > 0 {
+				d.Downgraded = append(d.Downgraded, c)
+			} else {
+				d.Upgraded = append(d.Upgraded, c)
+			}
+			continue
+		}
+
+		d.Removed = append(d.Removed, remainingOld...)
+		d.Added = append(d.Added, n...)
+	}
+
+	return d
+}
+
+func newChange(o, n Package) Change {
+	homepage := n.Homepage
+	if homepage == "" {
+		homepage = o.Homepage
+	}
+	return Change{
+		Name:       n.Name,
+		OldVersion: o.Version,
+		NewVersion: n.Version,
+		OldHash:    o.Hash,
+		NewHash:    n.Hash,
+		Homepage:   homepage,
+	}
+}
+
+func groupByName(pkgs []Package) map[string][]Package {
+	m := make(map[string][]Package, len(pkgs))
+	for _, p := range pkgs {
+		m[p.Name] = append(m[p.Name], p)
+	}
+	for name := range m {
+		sort.Slice(m[name], func(i, j int) bool {
+			return CompareVersions(m[name][i].Version, m[name][j].Version) < 0
+		})
+	}
+	return m
+}
+
+// PackagesFromSBOM returns the packages described by the SBOM, leaving out the root components
+func PackagesFromSBOM(doc *sbom.Document) []Package {
+	roots := make(map[string]bool)
+	for _, id := range doc.NodeList.RootElements {
+		roots[id] = true
+	}
+
+	seen := make(map[string]int)
+	pkgs := make([]Package, 0, len(doc.NodeList.Nodes))
+	for _, node := range doc.NodeList.Nodes {
+		if roots[node.Id] || node.Name == "" {
+			continue
+		}
+
+		p := Package{
+			Name:     node.Name,
+			Version:  node.Version,
+			Hash:     node.Hashes[int32(sbom.HashAlgorithm_SHA256)],
+			Homepage: node.UrlHome,
+		}
+
+		// the same package can be described both by the closure and the lock file
+		key := p.Name + "@" + p.Version
+		if i, ok := seen[key]; ok {
+			if pkgs[i].Hash == "" {
+				pkgs[i].Hash = p.Hash
+			}
+			if pkgs[i].Homepage == "" {
+				pkgs[i].Homepage = p.Homepage
+			}
+			continue
+		}
+		seen[key] = len(pkgs)
+		pkgs = append(pkgs, p)
+	}
+
+	return pkgs
+}
+
+// CompareVersions compares two Nix style version strings segment by segment.
+// Numeric segments are compared numerically, others lexically.
+func CompareVersions(a, b string) int {
+	as, bs := versionSegments(a), versionSegments(b)
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		an, aErr := strconv.Atoi(as[i])
+		bn, bErr := strconv.Atoi(bs[i])
+		switch {
+		case aErr == nil && bErr == nil:
+			if an != bn {
+				if an < bn {
+					return -1
+				}
+				return 1
+			}
+		case aErr == nil:
+			// numbers are considered newer than pre-release words like "rc" or "beta"
+			return 1
+		case bErr == nil:
+			return -1
+		default:
+			if c := strings.Compare(as[i], bs[i]); c != 0 {
+				return c
+			}
+		}
+	}
+
+	// a trailing word like "rc1" marks a pre-release of the shorter version
+	switch {
+	case len(as) < len(bs):
+		if _, err := strconv.Atoi(bs[len(as)]); err != nil {
+			return 1
+		}
+		return -1
+	case len(as) > len(bs):
+		if _, err := strconv.Atoi(as[len(bs)]); err != nil {
+			return -1
+		}
+		return 1
+	}
+	return 0
+}
+
+func versionSegments(v string) []string {
+	var segs []string
+	var cur strings.Builder
+	isDigit := false
+	flush := func() {
+		if cur.Len() > 0 {
+			segs = append(segs, cur.String())
+			cur.Reset()
+		}
+	}
+
+	for _, r := range v {
+		switch {
+		case unicode.IsDigit(r):
+			if !isDigit {
+				flush()
+			}
+			isDigit = true
+			cur.WriteRune(r)
+		case unicode.IsLetter(r):
+			if isDigit {
+				flush()
+			}
+			isDigit = false
+			cur.WriteRune(r)
+		default:
+			flush()
+		}
+	}
+	flush()
+
+	return segs
+}
@@ -0,0 +1,67 @@
+package diff
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"1.2.3", "1.2.3", 0},
+		{"1.2.3", "1.10.0", -1},
+		{"3.0.13", "3.0.9", 1},
+		{"2.38-44", "2.38-27", 1},
+		{"1.0rc1", "1.0", -1},
+		{"1.0", "1.0.1", -1},
+		{"1.0rc1", "1.0.1", -1},
+		{"unstable-2023-01-01", "unstable-2023-12-01", -1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.a+" vs "+tt.b, func(t *testing.T) {
+			if got := CompareVersions(tt.a, tt.b); got != tt.want {
+				t.Errorf("CompareVersions() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompare(t *testing.T) {
+	oldPkgs := []Package{
+		{Name: "openssl", Version: "3.0.12", Hash: "a"},
+		{Name: "glibc", Version: "2.38-27", Hash: "b"},
+		{Name: "zlib", Version: "1.3", Hash: "c"},
+		{Name: "curl", Version: "8.5.0", Hash: "d"},
+		{Name: "bash", Version: "5.2", Hash: "e"},
+	}
+	newPkgs := []Package{
+		{Name: "openssl", Version: "3.0.13", Hash: "a2"},
+		{Name: "glibc", Version: "2.38-27", Hash: "b2"},
+		{Name: "zlib", Version: "1.3", Hash: "c"},
+		{Name: "curl", Version: "8.4.0", Hash: "d2"},
+		{Name: "cacert", Version: "3.95", Hash: "f"},
+	}
+
+	want := &Diff{
+		Added:   []Package{{Name: "cacert", Version: "3.95", Hash: "f"}},
+		Removed: []Package{{Name: "bash", Version: "5.2", Hash: "e"}},
+		Upgraded: []Change{
+			{Name: "openssl", OldVersion: "3.0.12", NewVersion: "3.0.13", OldHash: "a", NewHash: "a2"},
+		},
+		Downgraded: []Change{
+			{Name: "curl", OldVersion: "8.5.0", NewVersion: "8.4.0", OldHash: "d", NewHash: "d2"},
+		},
+		Rebuilt: []Change{
+			{Name: "glibc", OldVersion: "2.38-27", NewVersion: "2.38-27", OldHash: "b", NewHash: "b2"},
+		},
+	}
+
+	got := Compare(oldPkgs, newPkgs)
+	if d := cmp.Diff(want, got); d != "" {
+		t.Errorf("Compare() mismatch (-want +got):\n%s", d)
+	}
+}
@@ -0,0 +1,29 @@
+package diff
+
+import (
+	"github.com/awalterschulze/gographviz"
+
+	bsbom "github.com/buildsafedev/bsf/pkg/sbom"
+)
+
+// PackagesFromGraph returns the packages of the closure graph, leaving out its roots. Hashes are hex encoded like
+// the ones of SBOMs, so closures can be compared with SBOMs of earlier builds.
+func PackagesFromGraph(graph *gographviz.Graph) []Package {
+	pkgs := make([]Package, 0, len(graph.Nodes.Nodes))
+	for _, node := range graph.Nodes.Nodes {
+		// edges go from the dependency to the dependent, roots have no dependents
+		if len(graph.Edges.SrcToDsts[node.Name]) == 0 || node.Attrs["name"] == "" {
+			continue
+		}
+		p := Package{
+			Name:     node.Attrs["name"],
+			Version:  node.Attrs["version"],
+			Homepage: node.Attrs["homepage"],
+		}
+		if hash := node.Attrs["hash"]; hash != "" {
+			p.Hash = bsbom.NarHashHex(hash)
+		}
+		pkgs = append(pkgs, p)
+	}
+	return pkgs
+}
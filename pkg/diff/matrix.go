@@ -0,0 +1,61 @@
+package diff
+
+import (
+	"sort"
+	"strings"
+)
+
+// MatrixRow is a component whose versions differ between the variants of a build matrix
+type MatrixRow struct {
+	Name string `json:"name"`
+	// Versions are the versions of the component by variant, comma separated when a variant has several. A variant
+	// without the component has none.
+	Versions map[string]string `json:"versions"`
+}
+
+// Matrix compares the closures of the variants of a build
+type Matrix struct {
+	// Variants are the variants compared, in the order of the columns
+	Variants []string `json:"variants"`
+	// Components are the number of components of each variant
+	Components map[string]int `json:"components"`
+	// Common is the number of components all variants have with the same versions
+	Common int `json:"common"`
+	// Rows are the components the variants don't have with the same versions, sorted by name
+	Rows []MatrixRow `json:"rows"`
+}
+
+// CompareMatrix compares the packages of the variants, by variant
+func CompareMatrix(variants []string, pkgs map[string][]Package) *Matrix {
+	m := &Matrix{Variants: variants, Components: make(map[string]int, len(variants)), Rows: make([]MatrixRow, 0)}
+	versions := make(map[string]map[string]string)
+	for _, v := range variants {
+		m.Components[v] = len(pkgs[v])
+		for name, group := range groupByName(pkgs[v]) {
+			vs := make([]string, 0, len(group))
+			for _, p := range group {
+				vs = append(vs, p.Version)
+			}
+			if versions[name] == nil {
+				versions[name] = make(map[string]string, len(variants))
+			}
+			versions[name][v] = strings.Join(vs, ", ")
+		}
+	}
+
+	for name, byVariant := range versions {
+		same := len(byVariant) == len(variants)
+		for _, v := range variants {
+			if byVariant[v] != byVariant[variants[0]] {
+				same = false
+			}
+		}
+		if same {
+			m.Common++
+			continue
+		}
+		m.Rows = append(m.Rows, MatrixRow{Name: name, Versions: byVariant})
+	}
+	sort.Slice(m.Rows, func(i, j int) bool { return m.Rows[i].Name < m.Rows[j].Name })
+	return m
+}
@@ -0,0 +1,39 @@
+package diff
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestCompareMatrix(t *testing.T) {
+	pkgs := map[string][]Package{
+		"default": {
+			{Name: "glibc", Version: "2.39"},
+			{Name: "openssl", Version: "3.0.13"},
+		},
+		"fips": {
+			{Name: "glibc", Version: "2.39"},
+			{Name: "openssl", Version: "3.0.9"},
+			{Name: "openssl", Version: "3.0.13"},
+		},
+		"static": {
+			{Name: "glibc", Version: "2.39"},
+			{Name: "musl", Version: "1.2.4"},
+		},
+	}
+
+	got := CompareMatrix([]string{"default", "fips", "static"}, pkgs)
+	want := &Matrix{
+		Variants:   []string{"default", "fips", "static"},
+		Components: map[string]int{"default": 2, "fips": 3, "static": 2},
+		Common:     1,
+		Rows: []MatrixRow{
+			{Name: "musl", Versions: map[string]string{"static": "1.2.4"}},
+			{Name: "openssl", Versions: map[string]string{"default": "3.0.13", "fips": "3.0.9, 3.0.13"}},
+		},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("CompareMatrix() mismatch (-want +got):\n%s", diff)
+	}
+}
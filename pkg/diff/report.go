@@ -0,0 +1,115 @@
+package diff
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Kinds of the rows of a diff
+const (
+	KindAdded      = "added"
+	KindRemoved    = "removed"
+	KindUpgraded   = "upgraded"
+	KindDowngraded = "downgraded"
+	KindRebuilt    = "rebuilt"
+)
+
+// Row is a package of the diff, as listed in tables
+type Row struct {
+	Kind       string
+	Name       string
+	OldVersion string
+	NewVersion string
+	OldHash    string
+	NewHash    string
+}
+
+// Rows returns the changes of the diff, upgrades and downgrades first, then additions, removals and rebuilds
+func (d *Diff) Rows() []Row {
+	rows := make([]Row, 0, len(d.Added)+len(d.Removed)+len(d.Upgraded)+len(d.Downgraded)+len(d.Rebuilt))
+	for _, kc := range []struct {
+		kind    string
+		changes []Change
+	}{{KindUpgraded, d.Upgraded}, {KindDowngraded, d.Downgraded}} {
+		for _, c := range kc.changes {
+			rows = append(rows, Row{Kind: kc.kind, Name: c.Name, OldVersion: c.OldVersion, NewVersion: c.NewVersion, OldHash: c.OldHash, NewHash: c.NewHash})
+		}
+	}
+	for _, p := range d.Added {
+		rows = append(rows, Row{Kind: KindAdded, Name: p.Name, NewVersion: p.Version, NewHash: p.Hash})
+	}
+	for _, p := range d.Removed {
+		rows = append(rows, Row{Kind: KindRemoved, Name: p.Name, OldVersion: p.Version, OldHash: p.Hash})
+	}
+	for _, c := range d.Rebuilt {
+		rows = append(rows, Row{Kind: KindRebuilt, Name: c.Name, OldVersion: c.OldVersion, NewVersion: c.NewVersion, OldHash: c.OldHash, NewHash: c.NewHash})
+	}
+	return rows
+}
+
+// Summary returns the number of changes of each kind, e.g. 2 upgraded, 1 added
+func (d *Diff) Summary() string {
+	if d.IsEmpty() {
+		return "no changes"
+	}
+	parts := make([]string, 0, 5)
+	for _, c := range []struct {
+		kind string
+		n    int
+	}{
+		{KindUpgraded, len(d.Upgraded)},
+		{KindDowngraded, len(d.Downgraded)},
+		{KindAdded, len(d.Added)},
+		{KindRemoved, len(d.Removed)},
+		{KindRebuilt, len(d.Rebuilt)},
+	} {
+		if c.n > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", c.n, c.kind))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// WriteMarkdown writes the diff as a markdown table, e.g. for the comment of a pull request
+func (d *Diff) WriteMarkdown(w io.Writer, from, to string) error {
+	var sb strings.Builder
+	sb.WriteString("## Closure diff")
+	if from != "" && to != "" {
+		sb.WriteString(fmt.Sprintf(" from %s to %s", from, to))
+	}
+	sb.WriteString("\n\n")
+	if d.IsEmpty() {
+		sb.WriteString("No dependency changes.\n")
+		_, err := io.WriteString(w, sb.String())
+		return err
+	}
+
+	sb.WriteString(d.Summary() + "\n\n")
+	sb.WriteString("| Change | Package | Old | New | NAR hash |\n")
+	sb.WriteString("|---|---|---|---|---|\n")
+	for _, r := range d.Rows() {
+		sb.WriteString(fmt.Sprintf("| %s | %s | %s | %s | %s |\n", r.Kind, r.Name, r.OldVersion, r.NewVersion, r.HashChange()))
+	}
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// HashChange returns the abbreviated NAR hashes of the row, old → new when they changed
+func (r Row) HashChange() string {
+	o, n := shortHash(r.OldHash), shortHash(r.NewHash)
+	switch {
+	case o == "" || n == "":
+		return o + n
+	case o == n:
+		return o
+	}
+	return o + " → " + n
+}
+
+func shortHash(hash string) string {
+	if len(hash) > 12 {
+		return hash[:12]
+	}
+	return hash
+}
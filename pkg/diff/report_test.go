@@ -0,0 +1,95 @@
+package diff
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/awalterschulze/gographviz"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRows(t *testing.T) {
+	d := &Diff{
+		Added:    []Package{{Name: "cacert", Version: "3.95", Hash: "f"}},
+		Removed:  []Package{{Name: "bash", Version: "5.2", Hash: "e"}},
+		Upgraded: []Change{{Name: "openssl", OldVersion: "3.0.12", NewVersion: "3.0.13", OldHash: "a", NewHash: "a2"}},
+		Rebuilt:  []Change{{Name: "glibc", OldVersion: "2.38-27", NewVersion: "2.38-27", OldHash: "b", NewHash: "b2"}},
+	}
+	want := []Row{
+		{Kind: KindUpgraded, Name: "openssl", OldVersion: "3.0.12", NewVersion: "3.0.13", OldHash: "a", NewHash: "a2"},
+		{Kind: KindAdded, Name: "cacert", NewVersion: "3.95", NewHash: "f"},
+		{Kind: KindRemoved, Name: "bash", OldVersion: "5.2", OldHash: "e"},
+		{Kind: KindRebuilt, Name: "glibc", OldVersion: "2.38-27", NewVersion: "2.38-27", OldHash: "b", NewHash: "b2"},
+	}
+	if diff := cmp.Diff(want, d.Rows()); diff != "" {
+		t.Errorf("Rows() mismatch (-want +got):\n%s", diff)
+	}
+	if got := d.Summary(); got != "1 upgraded, 1 added, 1 removed, 1 rebuilt" {
+		t.Errorf("Summary() = %q", got)
+	}
+
+	var buf bytes.Buffer
+	if err := d.WriteMarkdown(&buf, "main", "pr"); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		"## Closure diff from main to pr",
+		"| upgraded | openssl | 3.0.12 | 3.0.13 | a → a2 |",
+		"| added | cacert |  | 3.95 | f |",
+	} {
+		if !strings.Contains(buf.String(), line) {
+			t.Errorf("markdown has no line %q:\n%s", line, buf.String())
+		}
+	}
+}
+
+func TestHashChange(t *testing.T) {
+	tests := []struct {
+		row  Row
+		want string
+	}{
+		{Row{OldHash: "0123456789abcdef", NewHash: "fedcba9876543210"}, "0123456789ab → fedcba987654"},
+		{Row{OldHash: "abc", NewHash: "abc"}, "abc"},
+		{Row{NewHash: "abc"}, "abc"},
+		{Row{}, ""},
+	}
+	for _, tt := range tests {
+		if got := tt.row.HashChange(); got != tt.want {
+			t.Errorf("HashChange(%+v) = %q, want %q", tt.row, got, tt.want)
+		}
+	}
+}
+
+func TestPackagesFromGraph(t *testing.T) {
+	graph := gographviz.NewGraph()
+	graph.SetName("G")
+	graph.SetDir(true)
+	nodes := map[string]map[string]string{
+		`"aaaa-app-0.1"`:     {"name": "app", "version": "0.1"},
+		`"bbbb-openssl-3.0"`: {"name": "openssl", "version": "3.0", "hash": "1b8m03r63zqhnjf7l5wnldhh7c134ap5vpj0850ymkq1iyzicy5s"},
+		`"cccc-glibc-2.38"`:  {"name": "glibc", "version": "2.38"},
+	}
+	for name, attrs := range nodes {
+		if err := graph.AddNode("G", name, nil); err != nil {
+			t.Fatal(err)
+		}
+		for k, v := range attrs {
+			graph.Nodes.Lookup[name].Attrs[gographviz.Attr(k)] = v
+		}
+	}
+	// edges go from the dependency to the dependent
+	for _, e := range [][2]string{{`"bbbb-openssl-3.0"`, `"aaaa-app-0.1"`}, {`"cccc-glibc-2.38"`, `"bbbb-openssl-3.0"`}} {
+		if err := graph.AddEdge(e[0], e[1], true, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got := groupByName(PackagesFromGraph(graph))
+	if _, ok := got["app"]; ok || len(got) != 2 {
+		t.Fatalf("PackagesFromGraph() = %v, want the dependencies of the root", got)
+	}
+	if hash := got["openssl"][0].Hash; len(hash) != 64 {
+		t.Errorf("openssl hash %s is not hex", hash)
+	}
+}
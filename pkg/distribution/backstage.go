@@ -0,0 +1,171 @@
+package distribution
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// AnnotationSBOM links the component to its SBOM
+	AnnotationSBOM = "buildsafe.dev/sbom"
+	// AnnotationDigest is the sha256 digest of the built artifact
+	AnnotationDigest = "buildsafe.dev/digest"
+	// AnnotationPurl is the package url of a dependency
+	AnnotationPurl = "buildsafe.dev/purl"
+)
+
+// BackstageEntity is an entity of the Backstage software catalog
+type BackstageEntity struct {
+	APIVersion string                 `yaml:"apiVersion"`
+	Kind       string                 `yaml:"kind"`
+	Metadata   BackstageMetadata      `yaml:"metadata"`
+	Spec       map[string]interface{} `yaml:"spec"`
+}
+
+// BackstageMetadata is the metadata of a Backstage entity
+type BackstageMetadata struct {
+	Name        string            `yaml:"name"`
+	Title       string            `yaml:"title,omitempty"`
+	Description string            `yaml:"description,omitempty"`
+	Annotations map[string]string `yaml:"annotations,omitempty"`
+	Tags        []string          `yaml:"tags,omitempty"`
+	Links       []BackstageLink   `yaml:"links,omitempty"`
+}
+
+// BackstageLink is an external link of a Backstage entity
+type BackstageLink struct {
+	URL   string `yaml:"url"`
+	Title string `yaml:"title,omitempty"`
+}
+
+// Dependency is a direct dependency of the built component
+type Dependency struct {
+	Name    string
+	Version string
+	Purl    string
+}
+
+// Catalog holds the values needed to describe a bsf build in a Backstage catalog-info.yaml
+type Catalog struct {
+	Name        string
+	Description string
+	Owner       string
+	Lifecycle   string
+	System      string
+	// Repo is the GitHub repository (owner/repo) of the component
+	Repo string
+	// SBOMURL is where the SBOM of the build is published
+	SBOMURL string
+	// Digest is the sha256 digest of the built artifact
+	Digest       string
+	Dependencies []Dependency
+}
+
+// Validate checks that the catalog has everything Backstage needs
+func (c *Catalog) Validate() error {
+	if c.Name == "" || c.Owner == "" {
+		return fmt.Errorf("catalog needs a name and an owner")
+	}
+	return nil
+}
+
+// Entities returns the component entity of the build followed by a resource entity per dependency
+func (c *Catalog) Entities() []BackstageEntity {
+	lifecycle := c.Lifecycle
+	if lifecycle == "" {
+		lifecycle = "production"
+	}
+
+	component := BackstageEntity{
+		APIVersion: "backstage.io/v1alpha1",
+		Kind:       "Component",
+		Metadata: BackstageMetadata{
+			Name:        EntityName(c.Name),
+			Title:       c.Name,
+			Description: c.Description,
+			Annotations: make(map[string]string),
+			Tags:        []string{"bsf", "nix"},
+		},
+		Spec: map[string]interface{}{
+			"type":      "service",
+			"lifecycle": lifecycle,
+			"owner":     c.Owner,
+		},
+	}
+	if c.System != "" {
+		component.Spec["system"] = c.System
+	}
+	if c.Repo != "" {
+		component.Metadata.Annotations["github.com/project-slug"] = c.Repo
+	}
+	if c.Digest != "" {
+		component.Metadata.Annotations[AnnotationDigest] = "sha256:" + c.Digest
+	}
+	if c.SBOMURL != "" {
+		component.Metadata.Annotations[AnnotationSBOM] = c.SBOMURL
+		component.Metadata.Links = append(component.Metadata.Links, BackstageLink{URL: c.SBOMURL, Title: "SBOM"})
+	}
+
+	entities := make([]BackstageEntity, 0, len(c.Dependencies)+1)
+	dependsOn := make([]string, 0, len(c.Dependencies))
+	for _, d := range c.Dependencies {
+		name := EntityName(d.Name + "-" + d.Version)
+		dependsOn = append(dependsOn, "resource:"+name)
+
+		resource := BackstageEntity{
+			APIVersion: "backstage.io/v1alpha1",
+			Kind:       "Resource",
+			Metadata: BackstageMetadata{
+				Name:        name,
+				Title:       d.Name + " " + d.Version,
+				Description: fmt.Sprintf("Nix package %s, version %s", d.Name, d.Version),
+				Tags:        []string{"nix"},
+			},
+			Spec: map[string]interface{}{
+				"type":  "library",
+				"owner": c.Owner,
+			},
+		}
+		if d.Purl != "" {
+			resource.Metadata.Annotations = map[string]string{AnnotationPurl: d.Purl}
+		}
+		entities = append(entities, resource)
+	}
+	if len(dependsOn) > 0 {
+		component.Spec["dependsOn"] = dependsOn
+	}
+
+	return append([]BackstageEntity{component}, entities...)
+}
+
+// WriteBackstage renders the catalog as a multi-document catalog-info.yaml
+func (c *Catalog) WriteBackstage(w io.Writer) error {
+	if err := c.Validate(); err != nil {
+		return err
+	}
+
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	for _, e := range c.Entities() {
+		if err := enc.Encode(e); err != nil {
+			return err
+		}
+	}
+	return enc.Close()
+}
+
+var invalidEntityChars = regexp.MustCompile(`[^A-Za-z0-9_.-]+`)
+
+// EntityName turns s into a valid Backstage entity name: at most 63 characters of letters, digits, '-', '_' and '.',
+// starting and ending with a letter or digit
+func EntityName(s string) string {
+	s = invalidEntityChars.ReplaceAllString(s, "-")
+	if len(s) > 63 {
+		s = s[:63]
+	}
+	return strings.Trim(s, "-_.")
+}
@@ -0,0 +1,59 @@
+package distribution
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWriteBackstage(t *testing.T) {
+	c := &Catalog{
+		Name:    "my-service",
+		Owner:   "team-platform",
+		Repo:    "acme/my-service",
+		SBOMURL: "https://github.com/acme/my-service/releases/download/v1.0.0/my-service.spdx.json",
+		Digest:  strings.Repeat("a", 64),
+		Dependencies: []Dependency{
+			{Name: "openssl", Version: "3.0.13", Purl: "pkg:nix/openssl@v3.0.13"},
+		},
+	}
+
+	var sb strings.Builder
+	if err := c.WriteBackstage(&sb); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{
+		"kind: Component",
+		"github.com/project-slug: acme/my-service",
+		"buildsafe.dev/digest: sha256:" + strings.Repeat("a", 64),
+		"- resource:openssl-3.0.13",
+		"---\napiVersion: backstage.io/v1alpha1\nkind: Resource",
+		"buildsafe.dev/purl: pkg:nix/openssl@v3.0.13",
+	} {
+		if !strings.Contains(sb.String(), want) {
+			t.Errorf("catalog does not contain %q:\n%s", want, sb.String())
+		}
+	}
+
+	c.Owner = ""
+	if err := c.WriteBackstage(&sb); err == nil {
+		t.Errorf("expected missing owner to fail")
+	}
+}
+
+func TestEntityName(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"openssl-3.0.13", "openssl-3.0.13"},
+		{"python3.11-requests 2.31.0", "python3.11-requests-2.31.0"},
+		{"_gcc+libs-", "gcc-libs"},
+		{strings.Repeat("a", 70), strings.Repeat("a", 63)},
+	}
+
+	for _, tt := range tests {
+		if got := EntityName(tt.in); got != tt.want {
+			t.Errorf("EntityName(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package distribution
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/template"
+	"unicode"
+)
+
+const homebrewTmpl = `class {{ .ClassName }} < Formula
+  desc "{{ rubyString .Description }}"
+  homepage "{{ rubyString .Homepage }}"
+  url "{{ rubyString .URL }}"
+  sha256 "{{ rubyString .SHA256 }}"
+  version "{{ rubyString .Version }}"
+
+  def install
+    bin.install "{{ rubyString .Asset }}" => "{{ rubyString .Binary }}"
+  end
+
+  test do
+    assert_predicate bin/"{{ rubyString .Binary }}", :executable?
+  end
+end
+`
+
+// rubyString escapes s for a double-quoted Ruby string literal, so the values of the project can't end the string or
+// interpolate code with #{
+func rubyString(s string) string {
+	var sb strings.Builder
+	for i, r := range s {
+		switch {
+		case r == '\\' || r == '"':
+			sb.WriteRune('\\')
+			sb.WriteRune(r)
+		case r == '#' && i+1 < len(s) && (s[i+1] == '{' || s[i+1] == '$' || s[i+1] == '@'):
+			sb.WriteString(`\#`)
+		case r == '\n':
+			sb.WriteString(`\n`)
+		case r == '\r':
+			sb.WriteString(`\r`)
+		case r == '\t':
+			sb.WriteString(`\t`)
+		case unicode.IsControl(r):
+			fmt.Fprintf(&sb, `\u{%x}`, r)
+		default:
+			sb.WriteRune(r)
+		}
+	}
+	return sb.String()
+}
+
+// Formula holds the values needed to render a Homebrew formula for a prebuilt binary
+type Formula struct {
+	Name        string
+	Description string
+	Homepage    string
+	Version     string
+	// URL is the download location of the binary
+	URL string
+	// SHA256 is the digest of the binary, as recorded in the provenance subject
+	SHA256 string
+	// Binary is the name the binary is installed as
+	Binary string
+}
+
+// ClassName returns the Ruby class name Homebrew expects for the formula
+func (f *Formula) ClassName() string {
+	var sb strings.Builder
+	upper := true
+	for _, r := range f.Name {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			upper = true
+			continue
+		}
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
+
+// Asset returns the file name of the downloaded binary
+func (f *Formula) Asset() string {
+	return f.URL[strings.LastIndex(f.URL, "/")+1:]
+}
+
+// Validate checks that the formula has everything Homebrew needs
+func (f *Formula) Validate() error {
+	if f.Name == "" || f.URL == "" || f.SHA256 == "" || f.Version == "" {
+		return fmt.Errorf("formula needs a name, url, sha256 and version")
+	}
+	if len(f.SHA256) != 64 {
+		return fmt.Errorf("invalid sha256 %s", f.SHA256)
+	}
+	return nil
+}
+
+// WriteHomebrew renders the Homebrew formula
+func (f *Formula) WriteHomebrew(w io.Writer) error {
+	if err := f.Validate(); err != nil {
+		return err
+	}
+	if f.Binary == "" {
+		f.Binary = f.Name
+	}
+
+	tmpl, err := template.New("homebrew").Funcs(template.FuncMap{
+		"rubyString": rubyString,
+	}).Parse(homebrewTmpl)
+	if err != nil {
+		return err
+	}
+	return tmpl.Execute(w, f)
+}
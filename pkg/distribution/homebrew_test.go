@@ -0,0 +1,65 @@
+package distribution
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWriteHomebrew(t *testing.T) {
+	f := &Formula{
+		Name:    "my-tool",
+		Version: "1.0.0",
+		URL:     "https://github.com/o/r/releases/download/v1.0.0/my-tool-darwin-arm64",
+		SHA256:  strings.Repeat("a", 64),
+	}
+
+	var sb strings.Builder
+	if err := f.WriteHomebrew(&sb); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{
+		"class MyTool < Formula",
+		`sha256 "` + strings.Repeat("a", 64) + `"`,
+		`bin.install "my-tool-darwin-arm64" => "my-tool"`,
+	} {
+		if !strings.Contains(sb.String(), want) {
+			t.Errorf("formula does not contain %q:\n%s", want, sb.String())
+		}
+	}
+
+	f.SHA256 = "abc"
+	if err := f.WriteHomebrew(&sb); err == nil {
+		t.Errorf("expected invalid sha256 to fail")
+	}
+}
+
+func TestRubyString(t *testing.T) {
+	tests := map[string]string{
+		`a "quoted" tool`:         `a \"quoted\" tool`,
+		`#{system("id")}`:         `\#{system(\"id\")}`,
+		`C:\tools`:                `C:\\tools`,
+		"two\nlines":              `two\nlines`,
+		"issue #12, not #{ or #@": `issue #12, not \#{ or \#@`,
+	}
+	for in, want := range tests {
+		if got := rubyString(in); got != want {
+			t.Errorf("rubyString(%q) = %q, want %q", in, got, want)
+		}
+	}
+
+	f := &Formula{
+		Name:        "my-tool",
+		Description: `prints "#{ENV['HOME']}"`,
+		Version:     "1.0.0",
+		URL:         "https://github.com/o/r/releases/download/v1.0.0/my-tool-darwin-arm64",
+		SHA256:      strings.Repeat("a", 64),
+	}
+	var sb strings.Builder
+	if err := f.WriteHomebrew(&sb); err != nil {
+		t.Fatal(err)
+	}
+	if want := `desc "prints \"\#{ENV['HOME']}\""`; !strings.Contains(sb.String(), want) {
+		t.Errorf("formula does not contain %q:\n%s", want, sb.String())
+	}
+}
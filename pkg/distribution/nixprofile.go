@@ -0,0 +1,46 @@
+package distribution
+
+import (
+	"fmt"
+	"io"
+	"text/template"
+)
+
+const nixProfileTmpl = `# Install {{ .Name }} pinned to {{ .Rev }}
+nix profile install '{{ .Installable }}'
+
+# The installed store path must match the build bsf attested:
+#   {{ .StorePath }}
+#   narHash sha256:{{ .NarHash }}
+nix path-info --json '{{ .StorePath }}'
+`
+
+// NixProfile holds the values needed to render nix profile install instructions
+type NixProfile struct {
+	Name string
+	// Repo is the GitHub repository (owner/repo) of the project
+	Repo string
+	Rev  string
+	// StorePath is the store path of the build result
+	StorePath string
+	// NarHash is the nixbase32 NAR hash of the build result
+	NarHash string
+}
+
+// Installable returns the flake reference pinned to the revision
+func (n *NixProfile) Installable() string {
+	return fmt.Sprintf("github:%s/%s?dir=bsf", n.Repo, n.Rev)
+}
+
+// WriteInstructions renders the nix profile install instructions
+func (n *NixProfile) WriteInstructions(w io.Writer) error {
+	if n.Repo == "" || n.Rev == "" || n.NarHash == "" {
+		return fmt.Errorf("nix profile instructions need a repository, revision and NAR hash")
+	}
+
+	tmpl, err := template.New("nixprofile").Parse(nixProfileTmpl)
+	if err != nil {
+		return err
+	}
+	return tmpl.Execute(w, n)
+}
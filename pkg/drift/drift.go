@@ -0,0 +1,194 @@
+// Package drift detects the drift of a running container from the SBOM of its image: store paths present in the
+// container that the SBOM doesn't declare, e.g. installed with nix profile install or copied in after the build.
+// Runtime security agents list the store paths of the container from its root filesystem, its mounts or its image and
+// call Compare with the store paths of the SBOM.
+package drift
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/bom-squad/protobom/pkg/sbom"
+
+	nixcmd "github.com/buildsafedev/bsf/pkg/nix/cmd"
+	"github.com/buildsafedev/bsf/pkg/oci"
+	bsbom "github.com/buildsafedev/bsf/pkg/sbom"
+)
+
+// StoreDir is the nix store of containers
+const StoreDir = "/nix/store"
+
+// storePathRe matches the store paths in text, such as the mount points of /proc/<pid>/mountinfo
+var storePathRe = regexp.MustCompile(`/nix/store/[0-9a-df-np-sv-z]{32}-[A-Za-z0-9+\-._?=]+`)
+
+// Report is the drift of a container from the SBOM of its image
+type Report struct {
+	// Declared is the number of store paths of the SBOM
+	Declared int `json:"declared"`
+	// Observed is the number of store paths of the container
+	Observed int `json:"observed"`
+	// Undeclared are the store paths of the container the SBOM doesn't declare
+	Undeclared []string `json:"undeclared"`
+	// Missing are the store paths of the SBOM the container doesn't have, e.g. removed from a slimmed image
+	Missing []string `json:"missing"`
+}
+
+// Drifted reports if the container has store paths the SBOM doesn't declare
+func (r Report) Drifted() bool {
+	return len(r.Undeclared) > 0
+}
+
+// Compare compares the store paths observed in a container with the store paths the SBOM declares
+func Compare(declared, observed []string) Report {
+	d, o := set(declared), set(observed)
+	r := Report{Declared: len(d), Observed: len(o), Undeclared: make([]string, 0), Missing: make([]string, 0)}
+	for p := range o {
+		if !d[p] {
+			r.Undeclared = append(r.Undeclared, p)
+		}
+	}
+	for p := range d {
+		if !o[p] {
+			r.Missing = append(r.Missing, p)
+		}
+	}
+	sort.Strings(r.Undeclared)
+	sort.Strings(r.Missing)
+	return r
+}
+
+// Declared returns the store paths of the components of the SBOM
+func Declared(doc *sbom.Document) []string {
+	paths := make([]string, 0, len(doc.NodeList.Nodes))
+	for _, node := range doc.NodeList.Nodes {
+		if p := bsbom.StorePath(node); p != "" {
+			paths = append(paths, p)
+		}
+	}
+	return paths
+}
+
+// RootStorePaths returns the store paths of the root filesystem of a container, e.g. /proc/<pid>/root
+func RootStorePaths(root string) ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(root, StoreDir))
+	if err != nil {
+		return nil, err
+	}
+	paths := make([]string, 0, len(entries))
+	for _, e := range entries {
+		if p := path.Join(StoreDir, e.Name()); isStoreEntry(p) {
+			paths = append(paths, p)
+		}
+	}
+	return paths, nil
+}
+
+// ReadStorePaths returns the store paths found in the text, such as a list of store paths or files below them, or
+// the /proc/<pid>/mountinfo of a container that bind mounts them
+func ReadStorePaths(r io.Reader) ([]string, error) {
+	seen := make(map[string]bool)
+	paths := make([]string, 0)
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		for _, p := range storePathRe.FindAllString(scanner.Text(), -1) {
+			if !seen[p] {
+				seen[p] = true
+				paths = append(paths, p)
+			}
+		}
+	}
+	return paths, scanner.Err()
+}
+
+// ImageStorePaths returns the store paths of the layers of the image in dir, in the dir: layout bsf oci writes and
+// PullDir pulls
+func ImageStorePaths(dir string) ([]string, error) {
+	layers, err := oci.DirLayers(dir)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	paths := make([]string, 0)
+	for _, l := range layers {
+		layerPaths, err := layerStorePaths(l)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read layer %s: %v", filepath.Base(l), err)
+		}
+		for _, p := range layerPaths {
+			if !seen[p] {
+				seen[p] = true
+				paths = append(paths, p)
+			}
+		}
+	}
+	return paths, nil
+}
+
+// layerStorePaths returns the store paths with files in the layer, a tar archive compressed with gzip or not
+func layerStorePaths(file string) ([]string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	br := bufio.NewReader(f)
+	var r io.Reader = br
+	if magic, err := br.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	seen := make(map[string]bool)
+	paths := make([]string, 0)
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		name := "/" + strings.TrimPrefix(path.Clean("/"+hdr.Name), "/")
+		rel, ok := strings.CutPrefix(name, StoreDir+"/")
+		if !ok {
+			continue
+		}
+		base, _, _ := strings.Cut(rel, "/")
+		if p := path.Join(StoreDir, base); isStoreEntry(p) && !seen[p] {
+			seen[p] = true
+			paths = append(paths, p)
+		}
+	}
+	return paths, nil
+}
+
+// isStoreEntry reports if the entry p of the store directory is a store path, rather than .links or a lock file
+func isStoreEntry(p string) bool {
+	name := path.Base(p)
+	return nixcmd.IsStorePath(p) && !strings.HasPrefix(name, ".") && !strings.HasSuffix(name, ".lock")
+}
+
+func set(paths []string) map[string]bool {
+	s := make(map[string]bool, len(paths))
+	for _, p := range paths {
+		s[path.Clean(p)] = true
+	}
+	return s
+}
@@ -0,0 +1,117 @@
+package drift
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bom-squad/protobom/pkg/sbom"
+
+	bsbom "github.com/buildsafedev/bsf/pkg/sbom"
+)
+
+const (
+	app   = "/nix/store/0c9rf6rgcfd5j9b9wgzcm4cfdpi8wq5f-app-1.0"
+	glibc = "/nix/store/1ac3r0gk2fqsy3hkq8m4xhhlq4gfgnc4-glibc-2.39-52"
+	curl  = "/nix/store/2kdc6mhcdkxq4jyzhm6xn2n0v8rz9vzr-curl-8.7.1"
+)
+
+func TestCompare(t *testing.T) {
+	r := Compare([]string{app, glibc}, []string{glibc, curl, app + "/"})
+	if !r.Drifted() || strings.Join(r.Undeclared, " ") != curl {
+		t.Errorf("Undeclared = %v, want %s", r.Undeclared, curl)
+	}
+	if len(r.Missing) != 0 || r.Declared != 2 || r.Observed != 3 {
+		t.Errorf("report = %+v", r)
+	}
+
+	r = Compare([]string{app, glibc}, []string{app})
+	if r.Drifted() || strings.Join(r.Missing, " ") != glibc {
+		t.Errorf("a slimmed container drifted: %+v", r)
+	}
+}
+
+func TestDeclared(t *testing.T) {
+	doc := sbom.NewDocument()
+	doc.NodeList.AddNode(&sbom.Node{Id: "app", Name: "app", ExternalReferences: []*sbom.ExternalReference{{Url: app, Comment: bsbom.StorePathComment}}})
+	doc.NodeList.AddNode(&sbom.Node{Id: "readme", Name: "README", Type: sbom.Node_FILE})
+	if got := Declared(doc); len(got) != 1 || got[0] != app {
+		t.Errorf("Declared() = %v, want %s", got, app)
+	}
+}
+
+func TestRootStorePaths(t *testing.T) {
+	root := t.TempDir()
+	for _, p := range []string{app, curl, "/nix/store/.links", "/nix/store/" + strings.Repeat("a", 32) + "-x.lock"} {
+		if err := os.MkdirAll(filepath.Join(root, p), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got, err := RootStorePaths(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(got, " ") != app+" "+curl {
+		t.Errorf("RootStorePaths() = %v", got)
+	}
+}
+
+func TestReadStorePaths(t *testing.T) {
+	mountinfo := fmt.Sprintf(`1071 1070 0:52 / / rw,relatime - overlay overlay rw
+1072 1071 259:2 %[1]s %[1]s ro,relatime - ext4 /dev/nvme0n1p2 rw
+1073 1071 259:2 %[2]s/lib %[2]s/lib ro,relatime - ext4 /dev/nvme0n1p2 rw
+1074 1071 259:2 %[1]s/bin %[1]s/bin ro,relatime - ext4 /dev/nvme0n1p2 rw
+`, app, glibc)
+	got, err := ReadStorePaths(strings.NewReader(mountinfo))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(got, " ") != app+" "+glibc {
+		t.Errorf("ReadStorePaths() = %v", got)
+	}
+}
+
+func TestImageStorePaths(t *testing.T) {
+	dir := t.TempDir()
+	layer := func(gzipped bool, names ...string) string {
+		var buf bytes.Buffer
+		tw := tar.NewWriter(&buf)
+		for _, name := range names {
+			tw.WriteHeader(&tar.Header{Name: name, Typeflag: tar.TypeDir, Mode: 0755})
+		}
+		tw.Close()
+		data := buf.Bytes()
+		if gzipped {
+			var gz bytes.Buffer
+			w := gzip.NewWriter(&gz)
+			w.Write(data)
+			w.Close()
+			data = gz.Bytes()
+		}
+		sum := fmt.Sprintf("%x", sha256.Sum256(data))
+		if err := os.WriteFile(filepath.Join(dir, sum), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return "sha256:" + sum
+	}
+	l1 := layer(true, "nix/", "nix/store/", strings.TrimPrefix(glibc, "/")+"/", strings.TrimPrefix(glibc, "/")+"/lib/")
+	l2 := layer(false, "./nix/store/"+filepath.Base(app)+"/bin/", "etc/")
+	manifest := fmt.Sprintf(`{"config":{"digest":"sha256:c"},"layers":[{"digest":%q},{"digest":%q}]}`, l1, l2)
+	if err := os.WriteFile(filepath.Join(dir, "manifest.json"), []byte(manifest), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := ImageStorePaths(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(got, " ") != glibc+" "+app {
+		t.Errorf("ImageStorePaths() = %v", got)
+	}
+}
@@ -0,0 +1,206 @@
+// Package egress records the network egress of builds. Fixed-output derivations, the only derivations nix lets reach
+// the network, are routed through a local forward proxy that records every request: the URL and the digest of the
+// response of plain HTTP downloads, the host and the bytes received of HTTPS tunnels, whose content the output hash of
+// the derivation verifies.
+package egress
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Record is a request of the build through the proxy
+type Record struct {
+	Time   time.Time `json:"time"`
+	Method string    `json:"method"`
+	// URL is the URL fetched, https://host:port for tunnels
+	URL    string `json:"url"`
+	Status int    `json:"status,omitempty"`
+	// Digest is the hex sha256 digest of the response body of plain HTTP requests, Size the bytes received
+	Digest string `json:"digest,omitempty"`
+	Size   int64  `json:"size"`
+	// Tunnel is set for CONNECT requests, whose content the proxy can't see
+	Tunnel bool   `json:"tunnel,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Proxy is a forward proxy recording the requests it forwards
+type Proxy struct {
+	ln        net.Listener
+	srv       *http.Server
+	transport *http.Transport
+
+	mu      sync.Mutex
+	records []Record
+	// tunnels are the upstream connections of the open tunnels, by their client connection
+	tunnels   map[net.Conn]net.Conn
+	tunnelsWG sync.WaitGroup
+}
+
+// Start starts a proxy listening on a free port of the loopback interface
+func Start() (*Proxy, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("failed to start the egress proxy: %v", err)
+	}
+	// the proxy forwards requests itself, it is never proxied
+	p := &Proxy{ln: ln, transport: &http.Transport{Proxy: nil}, tunnels: make(map[net.Conn]net.Conn)}
+	p.srv = &http.Server{Handler: p, ReadHeaderTimeout: 30 * time.Second}
+	go p.srv.Serve(ln)
+	return p, nil
+}
+
+// URL returns the URL of the proxy, for the http_proxy and https_proxy variables
+func (p *Proxy) URL() string {
+	return "http://" + p.ln.Addr().String()
+}
+
+// Close stops the proxy once the requests it forwards completed, the tunnels still open after a second are closed
+func (p *Proxy) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	err := p.srv.Shutdown(ctx)
+	if errors.Is(err, context.DeadlineExceeded) {
+		err = p.srv.Close()
+	}
+	p.transport.CloseIdleConnections()
+
+	done := make(chan struct{})
+	go func() {
+		p.tunnelsWG.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		p.mu.Lock()
+		for client, upstream := range p.tunnels {
+			client.Close()
+			upstream.Close()
+		}
+		p.mu.Unlock()
+		<-done
+	}
+	return err
+}
+
+// Records returns the requests recorded, in the order they started
+func (p *Proxy) Records() []Record {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	records := append([]Record(nil), p.records...)
+	sort.SliceStable(records, func(i, j int) bool { return records[i].Time.Before(records[j].Time) })
+	return records
+}
+
+func (p *Proxy) record(r Record) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.records = append(p.records, r)
+}
+
+// ServeHTTP forwards the request, tunnels CONNECT requests
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodConnect {
+		p.tunnel(w, r)
+		return
+	}
+
+	rec := Record{Time: time.Now().UTC(), Method: r.Method, URL: r.URL.String()}
+	if !r.URL.IsAbs() {
+		rec.Error = "not a proxy request"
+		p.record(rec)
+		http.Error(w, rec.Error, http.StatusBadRequest)
+		return
+	}
+
+	out := r.Clone(r.Context())
+	out.RequestURI = ""
+	out.Header.Del("Proxy-Connection")
+	out.Header.Del("Proxy-Authorization")
+	resp, err := p.transport.RoundTrip(out)
+	if err != nil {
+		rec.Error = err.Error()
+		p.record(rec)
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+
+	for k, v := range resp.Header {
+		w.Header()[k] = v
+	}
+	w.WriteHeader(resp.StatusCode)
+	h := sha256.New()
+	rec.Status = resp.StatusCode
+	rec.Size, err = io.Copy(w, io.TeeReader(resp.Body, h))
+	if err != nil {
+		rec.Error = err.Error()
+	} else {
+		rec.Digest = hex.EncodeToString(h.Sum(nil))
+	}
+	p.record(rec)
+}
+
+// tunnel connects the client to the host of the CONNECT request, recording the bytes the host sent
+func (p *Proxy) tunnel(w http.ResponseWriter, r *http.Request) {
+	rec := Record{Time: time.Now().UTC(), Method: r.Method, URL: "https://" + r.Host, Tunnel: true}
+	upstream, err := net.DialTimeout("tcp", r.Host, 30*time.Second)
+	if err != nil {
+		rec.Error = err.Error()
+		p.record(rec)
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer upstream.Close()
+
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		rec.Error = "the connection can't be tunneled"
+		p.record(rec)
+		http.Error(w, rec.Error, http.StatusInternalServerError)
+		return
+	}
+	client, buf, err := hj.Hijack()
+	if err != nil {
+		rec.Error = err.Error()
+		p.record(rec)
+		return
+	}
+	defer client.Close()
+	p.mu.Lock()
+	p.tunnels[client] = upstream
+	p.tunnelsWG.Add(1)
+	p.mu.Unlock()
+	defer func() {
+		p.mu.Lock()
+		delete(p.tunnels, client)
+		p.mu.Unlock()
+		p.tunnelsWG.Done()
+	}()
+	rec.Status = http.StatusOK
+	fmt.Fprint(client, "HTTP/1.1 200 Connection established\r\n\r\n")
+
+	done := make(chan struct{})
+	go func() {
+		// the client may have sent the start of the TLS handshake with the CONNECT request
+		io.Copy(upstream, buf)
+		if tcp, ok := upstream.(*net.TCPConn); ok {
+			tcp.CloseWrite()
+		}
+		close(done)
+	}()
+	rec.Size, _ = io.Copy(client, upstream)
+	client.Close()
+	<-done
+	p.record(rec)
+}
@@ -0,0 +1,74 @@
+package egress
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestProxy(t *testing.T) {
+	body := "source tarball"
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, body)
+	})
+	plain := httptest.NewServer(handler)
+	defer plain.Close()
+	tls := httptest.NewTLSServer(handler)
+	defer tls.Close()
+
+	p, err := Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	proxyURL, _ := url.Parse(p.URL())
+	transport := tls.Client().Transport.(*http.Transport).Clone()
+	transport.Proxy = http.ProxyURL(proxyURL)
+	client := &http.Client{Transport: transport}
+
+	for _, u := range []string{plain.URL + "/src.tar.gz", plain.URL + "/missing", tls.URL + "/src.tar.gz"} {
+		resp, err := client.Get(u)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusOK && string(got) != body {
+			t.Errorf("GET %s through the proxy = %q, want %q", u, got, body)
+		}
+	}
+	// the tunnel is recorded once the client closes it
+	transport.CloseIdleConnections()
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	records := p.Records()
+	if len(records) != 3 {
+		t.Fatalf("%d records, want 3: %+v", len(records), records)
+	}
+	byURL := make(map[string]Record)
+	for _, r := range records {
+		byURL[r.URL] = r
+	}
+
+	r := byURL[plain.URL+"/src.tar.gz"]
+	if r.Status != http.StatusOK || r.Digest != fmt.Sprintf("%x", sha256.Sum256([]byte(body))) || r.Size != int64(len(body)) || r.Tunnel {
+		t.Errorf("unexpected record of the download %+v", r)
+	}
+	if r := byURL[plain.URL+"/missing"]; r.Status != http.StatusNotFound {
+		t.Errorf("unexpected record of the missing file %+v", r)
+	}
+	r = byURL["https://"+strings.TrimPrefix(tls.URL, "https://")]
+	if !r.Tunnel || r.Status != http.StatusOK || r.Digest != "" || r.Size == 0 {
+		t.Errorf("unexpected record of the tunnel %+v", r)
+	}
+}
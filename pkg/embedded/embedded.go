@@ -0,0 +1,312 @@
+// Package embedded extracts the packages embedded in the store paths of a closure, such as the wheels installed in
+// the site-packages of a python environment or the libraries bundled in a JAR, which the closure graph models as a
+// single store path.
+package embedded
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	nixcmd "github.com/buildsafedev/bsf/pkg/nix/cmd"
+	"github.com/buildsafedev/bsf/pkg/osv"
+)
+
+// Ecosystems of the embedded packages
+const (
+	EcosystemPyPI  = "pypi"
+	EcosystemMaven = "maven"
+	// EcosystemGeneric are JARs only known by their manifest
+	EcosystemGeneric = "generic"
+)
+
+const (
+	// maxNestedJarSize is the size above which JARs nested in JARs are not read
+	maxNestedJarSize = 64 << 20
+	// maxJarDepth is how deep JARs nested in JARs are read, e.g. the libraries of a Spring Boot JAR
+	maxJarDepth = 2
+)
+
+// Package is a package embedded in a store path
+type Package struct {
+	Ecosystem string `json:"ecosystem"`
+	// Namespace is the group of maven packages
+	Namespace string   `json:"namespace,omitempty"`
+	Name      string   `json:"name"`
+	Version   string   `json:"version"`
+	Licenses  []string `json:"licenses,omitempty"`
+	// File is where the package was found relative to the store path, JARs nested in a JAR are separated by !/
+	File string `json:"file"`
+}
+
+// Purl returns the package url of the package
+func (p Package) Purl() string {
+	name := p.Name
+	if p.Namespace != "" {
+		name = p.Namespace + "/" + name
+	}
+	if p.Ecosystem == EcosystemPyPI {
+		name = osv.NormalizePyPI(name)
+	}
+	purl := "pkg:" + p.Ecosystem + "/" + name
+	if p.Version != "" {
+		purl += "@" + p.Version
+	}
+	return purl
+}
+
+// Extract returns the packages embedded in each store path, walking at most workers of them at once. Packages are
+// sorted by package url, a store path doesn't list the package it is built from.
+func Extract(storePaths []string, workers int) (map[string][]Package, error) {
+	if workers < 1 {
+		workers = 1
+	}
+	packages := make(map[string][]Package)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	var firstErr error
+	sem := make(chan struct{}, workers)
+	for _, sp := range storePaths {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(sp string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			pkgs, err := storePathPackages(sp)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				if firstErr == nil {
+					firstErr = err
+				}
+				return
+			}
+			if len(pkgs) > 0 {
+				packages[sp] = pkgs
+			}
+		}(sp)
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return packages, nil
+}
+
+// Count returns the number of packages embedded in the store paths
+func Count(packages map[string][]Package) int {
+	n := 0
+	for _, pkgs := range packages {
+		n += len(pkgs)
+	}
+	return n
+}
+
+// storePathPackages returns the packages embedded in the store path
+func storePathPackages(storePath string) ([]Package, error) {
+	root := nixcmd.HostPath(storePath)
+	found := make([]Package, 0)
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		switch {
+		case d.IsDir() && (strings.HasSuffix(d.Name(), ".dist-info") || strings.HasSuffix(d.Name(), ".egg-info")):
+			metadata := "METADATA"
+			if strings.HasSuffix(d.Name(), ".egg-info") {
+				metadata = "PKG-INFO"
+			}
+			data, err := os.ReadFile(filepath.Join(p, metadata))
+			if err != nil {
+				return filepath.SkipDir
+			}
+			if pkg, ok := parseWheelMetadata(data); ok {
+				pkg.File = rel
+				found = append(found, pkg)
+			}
+			return filepath.SkipDir
+		case d.Type().IsRegular() && isJar(d.Name()):
+			r, err := zip.OpenReader(p)
+			if err != nil {
+				// not every file named .jar is a valid archive
+				return nil
+			}
+			defer r.Close()
+			found = append(found, jarPackages(&r.Reader, rel, 1)...)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	packages := make([]Package, 0, len(found))
+	sort.SliceStable(found, func(i, j int) bool { return found[i].File < found[j].File })
+	for _, pkg := range found {
+		if seen[pkg.Purl()] || ownPackage(storePath, pkg) {
+			continue
+		}
+		seen[pkg.Purl()] = true
+		packages = append(packages, pkg)
+	}
+	sort.Slice(packages, func(i, j int) bool { return packages[i].Purl() < packages[j].Purl() })
+	return packages, nil
+}
+
+// ownPackage reports if the store path is built from the package, e.g. python3.11-requests-2.31.0 holding the
+// metadata of requests 2.31.0
+func ownPackage(storePath string, pkg Package) bool {
+	name := osv.NormalizePyPI(path.Base(storePath))
+	return strings.HasSuffix(name, "-"+osv.NormalizePyPI(pkg.Name+"-"+pkg.Version))
+}
+
+// parseWheelMetadata parses the core metadata of a python distribution, as in the METADATA of wheels
+func parseWheelMetadata(data []byte) (Package, bool) {
+	pkg := Package{Ecosystem: EcosystemPyPI}
+	license := ""
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		// the headers end at the first empty line, the description follows
+		if line == "" {
+			break
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		switch key {
+		case "Name":
+			pkg.Name = value
+		case "Version":
+			pkg.Version = value
+		case "License-Expression":
+			pkg.Licenses = []string{value}
+		case "License":
+			license = value
+		}
+	}
+	// License is free text, only single identifiers are kept
+	if len(pkg.Licenses) == 0 && license != "" && !strings.ContainsAny(license, " \t") && strings.ToUpper(license) != "UNKNOWN" {
+		pkg.Licenses = []string{license}
+	}
+	return pkg, pkg.Name != "" && pkg.Version != ""
+}
+
+// jarPackages returns the maven packages of the pom.properties of the JAR and of the JARs it bundles, or the package
+// of its manifest when it has no pom.properties
+func jarPackages(r *zip.Reader, file string, depth int) []Package {
+	packages := make([]Package, 0)
+	var manifest *zip.File
+	for _, f := range r.File {
+		switch {
+		case strings.HasPrefix(f.Name, "META-INF/maven/") && path.Base(f.Name) == "pom.properties":
+			data, err := readZipFile(f, maxNestedJarSize)
+			if err != nil {
+				continue
+			}
+			if pkg, ok := parsePomProperties(data); ok {
+				pkg.File = file
+				packages = append(packages, pkg)
+			}
+		case f.Name == "META-INF/MANIFEST.MF":
+			manifest = f
+		case isJar(f.Name) && depth < maxJarDepth && f.UncompressedSize64 <= maxNestedJarSize:
+			data, err := readZipFile(f, maxNestedJarSize)
+			if err != nil {
+				continue
+			}
+			nested, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+			if err != nil {
+				continue
+			}
+			packages = append(packages, jarPackages(nested, file+"!/"+f.Name, depth+1)...)
+		}
+	}
+
+	own := false
+	for _, pkg := range packages {
+		own = own || pkg.File == file
+	}
+	if !own && manifest != nil {
+		if data, err := readZipFile(manifest, maxNestedJarSize); err == nil {
+			if pkg, ok := parseJarManifest(data); ok {
+				pkg.File = file
+				packages = append(packages, pkg)
+			}
+		}
+	}
+	return packages
+}
+
+// parsePomProperties parses the pom.properties maven writes in the JARs it builds
+func parsePomProperties(data []byte) (Package, bool) {
+	pkg := Package{Ecosystem: EcosystemMaven}
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		switch strings.TrimSpace(key) {
+		case "groupId":
+			pkg.Namespace = strings.TrimSpace(value)
+		case "artifactId":
+			pkg.Name = strings.TrimSpace(value)
+		case "version":
+			pkg.Version = strings.TrimSpace(value)
+		}
+	}
+	return pkg, pkg.Namespace != "" && pkg.Name != "" && pkg.Version != ""
+}
+
+// parseJarManifest parses the implementation title and version of a JAR manifest
+func parseJarManifest(data []byte) (Package, bool) {
+	pkg := Package{Ecosystem: EcosystemGeneric}
+	for _, line := range strings.Split(string(data), "\n") {
+		key, value, ok := strings.Cut(strings.TrimRight(line, "\r"), ":")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "Implementation-Title":
+			pkg.Name = strings.TrimSpace(value)
+		case "Implementation-Version":
+			pkg.Version = strings.TrimSpace(value)
+		}
+	}
+	return pkg, pkg.Name != "" && pkg.Version != "" && !strings.ContainsAny(pkg.Name, " /")
+}
+
+func readZipFile(f *zip.File, limit int64) ([]byte, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(io.LimitReader(rc, limit))
+}
+
+func isJar(name string) bool {
+	ext := strings.ToLower(path.Ext(name))
+	return ext == ".jar" || ext == ".war" || ext == ".ear"
+}
@@ -0,0 +1,132 @@
+package embedded
+
+import (
+	"archive/zip"
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// jar returns a JAR holding the files
+func jar(t *testing.T, files map[string][]byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for name, data := range files {
+		f, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Write(data)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func writeFile(t *testing.T, path string, data []byte) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestExtract(t *testing.T) {
+	store := t.TempDir()
+
+	env := filepath.Join(store, "aaaa-python3-3.11.9-env")
+	site := filepath.Join(env, "lib", "python3.11", "site-packages")
+	writeFile(t, filepath.Join(site, "requests-2.31.0.dist-info", "METADATA"),
+		[]byte("Metadata-Version: 2.1\nName: requests\nVersion: 2.31.0\nLicense: Apache 2.0\n\nLicense: MIT\n"))
+	writeFile(t, filepath.Join(site, "PyYAML-6.0.1.dist-info", "METADATA"),
+		[]byte("Metadata-Version: 2.4\nName: PyYAML\nVersion: 6.0.1\nLicense-Expression: MIT\n"))
+	writeFile(t, filepath.Join(site, "six-1.16.0.egg-info", "PKG-INFO"),
+		[]byte("Metadata-Version: 1.1\nName: six\nVersion: 1.16.0\nLicense: MIT\n"))
+
+	// a python package lists its own metadata, it isn't embedded
+	own := filepath.Join(store, "bbbb-python3.11-urllib3-2.2.1")
+	writeFile(t, filepath.Join(own, "lib", "python3.11", "site-packages", "urllib3-2.2.1.dist-info", "METADATA"),
+		[]byte("Name: urllib3\nVersion: 2.2.1\n"))
+
+	app := filepath.Join(store, "cccc-app-1.0")
+	nested := jar(t, map[string][]byte{
+		"META-INF/maven/com.fasterxml.jackson.core/jackson-databind/pom.properties": []byte("#Generated by Maven\ngroupId=com.fasterxml.jackson.core\nartifactId=jackson-databind\nversion=2.15.2\n"),
+	})
+	writeFile(t, filepath.Join(app, "share", "java", "app.jar"), jar(t, map[string][]byte{
+		"META-INF/MANIFEST.MF":                             []byte("Manifest-Version: 1.0\r\nImplementation-Title: app\r\nImplementation-Version: 1.0\r\n"),
+		"BOOT-INF/lib/jackson-databind-2.15.2.jar":         nested,
+		"META-INF/maven/org.yaml/snakeyaml/pom.properties": []byte("groupId=org.yaml\nartifactId=snakeyaml\nversion=1.33\n"),
+	}))
+	writeFile(t, filepath.Join(app, "share", "java", "broken.jar"), []byte("not a zip"))
+
+	packages, err := Extract([]string{env, own, app}, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		storePath string
+		want      []string
+	}{
+		{env, []string{"pkg:pypi/pyyaml@6.0.1", "pkg:pypi/requests@2.31.0", "pkg:pypi/six@1.16.0"}},
+		{own, nil},
+		{app, []string{"pkg:maven/com.fasterxml.jackson.core/jackson-databind@2.15.2", "pkg:maven/org.yaml/snakeyaml@1.33"}},
+	}
+	for _, tt := range tests {
+		got := make([]string, 0)
+		for _, p := range packages[tt.storePath] {
+			got = append(got, p.Purl())
+		}
+		if len(got) != len(tt.want) {
+			t.Fatalf("%s: got %v, want %v", filepath.Base(tt.storePath), got, tt.want)
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("%s: got %v, want %v", filepath.Base(tt.storePath), got, tt.want)
+			}
+		}
+	}
+
+	pkgs := packages[env]
+	if l := pkgs[0].Licenses; len(l) != 1 || l[0] != "MIT" {
+		t.Errorf("PyYAML licenses = %v, want the License-Expression", l)
+	}
+	if l := pkgs[1].Licenses; len(l) != 0 {
+		t.Errorf("requests licenses = %v, want none for a free text License", l)
+	}
+	if f := packages[app][0].File; f != "share/java/app.jar!/BOOT-INF/lib/jackson-databind-2.15.2.jar" {
+		t.Errorf("jackson-databind found in %s", f)
+	}
+	if n := Count(packages); n != 5 {
+		t.Errorf("Count() = %d, want 5", n)
+	}
+}
+
+func TestParseJarManifest(t *testing.T) {
+	tests := []struct {
+		name     string
+		manifest string
+		want     string
+	}{
+		{"title and version", "Implementation-Title: guava\r\nImplementation-Version: 33.0.0\r\n", "pkg:generic/guava@33.0.0"},
+		{"no version", "Implementation-Title: guava\r\n", ""},
+		{"title is a sentence", "Implementation-Title: Google Core Libraries\r\nImplementation-Version: 1\r\n", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pkg, ok := parseJarManifest([]byte(tt.manifest))
+			got := ""
+			if ok {
+				got = pkg.Purl()
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,254 @@
+package enrichdb
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	bio "github.com/buildsafedev/bsf/pkg/io"
+)
+
+// LockFile records the snapshots of the enrichment databases a project used, and the ones it pins
+const LockFile = "bsf-db.lock"
+
+// Snapshot identifies the exact content of an enrichment database
+type Snapshot struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+	// Digest is the sha256 digest of the downloaded file, as sha256:<hex>
+	Digest       string    `json:"digest"`
+	FetchedAt    time.Time `json:"fetchedAt"`
+	LastModified time.Time `json:"lastModified,omitempty"`
+	// Pinned snapshots are the only ones accepted, they are reused from the local cache instead of downloaded again
+	Pinned bool `json:"pinned"`
+}
+
+// Lock holds the database snapshots by name
+type Lock struct {
+	Databases map[string]Snapshot `json:"databases"`
+}
+
+// ReadLock reads the lock file at path. A missing file is an empty lock.
+func ReadLock(path string) (*Lock, error) {
+	l := &Lock{Databases: make(map[string]Snapshot)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return l, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, l); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", path, err)
+	}
+	if l.Databases == nil {
+		l.Databases = make(map[string]Snapshot)
+	}
+	return l, nil
+}
+
+// Write writes the lock file to path
+func (l *Lock) Write(path string) error {
+	data, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// Pin pins the recorded snapshot of the database
+func (l *Lock) Pin(name string) error {
+	s, ok := l.Databases[name]
+	if !ok {
+		return fmt.Errorf("no snapshot of %s recorded, fetch it first", name)
+	}
+	s.Pinned = true
+	l.Databases[name] = s
+	return nil
+}
+
+// Unpin lets the database be updated again
+func (l *Lock) Unpin(name string) {
+	if s, ok := l.Databases[name]; ok {
+		s.Pinned = false
+		l.Databases[name] = s
+	}
+}
+
+// Snapshots returns the recorded snapshots sorted by name
+func (l *Lock) Snapshots() []Snapshot {
+	snapshots := make([]Snapshot, 0, len(l.Databases))
+	for _, s := range l.Databases {
+		snapshots = append(snapshots, s)
+	}
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].Name < snapshots[j].Name
+	})
+	return snapshots
+}
+
+// SourceURL returns the download URL of a known database: osv/<ecosystem> for the OSV vulnerabilities of an ecosystem,
+// or eol/<product> for the endoflife.date release cycles of a product
+func SourceURL(name string) (string, error) {
+	kind, arg, ok := strings.Cut(name, "/")
+	if !ok || arg == "" {
+		return "", fmt.Errorf("unknown database %s, expected osv/<ecosystem> or eol/<product>", name)
+	}
+
+	switch kind {
+	case "osv":
+		return "https://osv-vulnerabilities.storage.googleapis.com/" + url.PathEscape(arg) + "/all.zip", nil
+	case "eol":
+		return "https://endoflife.date/api/" + url.PathEscape(arg) + ".json", nil
+	}
+	return "", fmt.Errorf("unknown database %s, expected osv/<ecosystem> or eol/<product>", name)
+}
+
+// CacheDir returns the directory downloaded snapshots are kept in, by digest
+func CacheDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "bsf", "db"), nil
+}
+
+func cachePath(digest string) (string, error) {
+	dir, err := CacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, strings.TrimPrefix(digest, "sha256:")), nil
+}
+
+// Cached returns the local path of the snapshot of the database recorded in the lock, for offline use
+func Cached(lock *Lock, name string) (string, error) {
+	s, ok := lock.Databases[name]
+	if !ok {
+		return "", fmt.Errorf("no snapshot of %s recorded, run bsf db fetch %s", name, name)
+	}
+	path, err := cachePath(s.Digest)
+	if err != nil {
+		return "", err
+	}
+	if sum, err := bio.FileSHA256(path); err != nil || "sha256:"+sum != s.Digest {
+		return "", fmt.Errorf("the snapshot %s of %s is not in the cache, run bsf db fetch %s", s.Digest, name, name)
+	}
+	return path, nil
+}
+
+// Fetch returns the local path of the database. A pinned snapshot is used from the cache when available,
+// otherwise the database is downloaded and, if pinned, must match the pinned digest.
+// The snapshot is recorded in the lock.
+func Fetch(ctx context.Context, name, url string, lock *Lock) (string, *Snapshot, error) {
+	pinned, isPinned := lock.Databases[name]
+	isPinned = isPinned && pinned.Pinned
+	if isPinned {
+		path, err := cachePath(pinned.Digest)
+		if err != nil {
+			return "", nil, err
+		}
+		if sum, err := bio.FileSHA256(path); err == nil && "sha256:"+sum == pinned.Digest {
+			return path, &pinned, nil
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", nil, fmt.Errorf("failed to download %s: %s", url, resp.Status)
+	}
+
+	dir, err := CacheDir()
+	if err != nil {
+		return "", nil, err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", nil, err
+	}
+	tmp, err := os.CreateTemp(dir, "download-")
+	if err != nil {
+		return "", nil, err
+	}
+	defer os.Remove(tmp.Name())
+
+	h := sha256.New()
+	_, err = io.Copy(io.MultiWriter(tmp, h), resp.Body)
+	tmp.Close()
+	if err != nil {
+		return "", nil, err
+	}
+
+	snapshot := Snapshot{
+		Name:      name,
+		URL:       url,
+		Digest:    "sha256:" + hex.EncodeToString(h.Sum(nil)),
+		FetchedAt: time.Now().UTC(),
+		Pinned:    isPinned,
+	}
+	if lm, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		snapshot.LastModified = lm.UTC()
+	}
+	if isPinned && snapshot.Digest != pinned.Digest {
+		return "", nil, fmt.Errorf("%s is pinned to %s but %s now serves %s and the pinned snapshot is not in the cache", name, pinned.Digest, url, snapshot.Digest)
+	}
+
+	path, err := cachePath(snapshot.Digest)
+	if err != nil {
+		return "", nil, err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return "", nil, err
+	}
+	if isPinned {
+		// keep when the pinned snapshot was first fetched
+		snapshot = pinned
+	}
+	lock.Databases[name] = snapshot
+	return path, &snapshot, nil
+}
+
+// Record checks a database obtained by other means, e.g. the nixpkgs metadata cache, against its pin and records its snapshot
+func Record(lock *Lock, name, url, path string) (*Snapshot, error) {
+	sum, err := bio.FileSHA256(path)
+	if err != nil {
+		return nil, err
+	}
+	digest := "sha256:" + sum
+
+	pinned, ok := lock.Databases[name]
+	if ok && pinned.Pinned {
+		if pinned.Digest != digest {
+			return nil, fmt.Errorf("%s is pinned to %s but got %s", name, pinned.Digest, digest)
+		}
+		return &pinned, nil
+	}
+
+	snapshot := Snapshot{
+		Name:      name,
+		URL:       url,
+		Digest:    digest,
+		FetchedAt: time.Now().UTC(),
+	}
+	lock.Databases[name] = snapshot
+	return &snapshot, nil
+}
@@ -0,0 +1,95 @@
+package enrichdb
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFetchPinned(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	content := "snapshot 1"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Last-Modified", "Mon, 01 Jan 2024 00:00:00 GMT")
+		fmt.Fprint(w, content)
+	}))
+	defer srv.Close()
+
+	lock := &Lock{Databases: make(map[string]Snapshot)}
+	_, first, err := Fetch(context.Background(), "osv/Go", srv.URL, lock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.LastModified.Year() != 2024 {
+		t.Errorf("last modified not recorded: %v", first.LastModified)
+	}
+	if cached, err := Cached(lock, "osv/Go"); err != nil || filepath.Base(cached) != first.Digest[len("sha256:"):] {
+		t.Errorf("Cached() = %s, %v", cached, err)
+	}
+	if _, err := Cached(lock, "osv/PyPI"); err == nil {
+		t.Errorf("Cached() of a database that was not fetched succeeded")
+	}
+	if err := lock.Pin("osv/Go"); err != nil {
+		t.Fatal(err)
+	}
+
+	// the database was updated upstream, the pinned snapshot is used from the cache
+	content = "snapshot 2"
+	path, got, err := Fetch(context.Background(), "osv/Go", srv.URL, lock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(path)
+	if string(data) != "snapshot 1" || got.Digest != first.Digest {
+		t.Errorf("expected the pinned snapshot, got %q %s", data, got.Digest)
+	}
+
+	// without the cached snapshot the pin can't be satisfied
+	os.Remove(path)
+	if _, _, err := Fetch(context.Background(), "osv/Go", srv.URL, lock); err == nil {
+		t.Errorf("expected a digest mismatch")
+	}
+
+	lock.Unpin("osv/Go")
+	_, updated, err := Fetch(context.Background(), "osv/Go", srv.URL, lock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.Digest == first.Digest {
+		t.Errorf("expected the new snapshot once unpinned")
+	}
+}
+
+func TestLockRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), LockFile)
+	lock, err := ReadLock(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lock.Databases["eol/go"] = Snapshot{Name: "eol/go", Digest: "sha256:abc", Pinned: true}
+	if err := lock.Write(path); err != nil {
+		t.Fatal(err)
+	}
+
+	read, err := ReadLock(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := read.Snapshots(); len(s) != 1 || !s[0].Pinned || s[0].Digest != "sha256:abc" {
+		t.Errorf("unexpected snapshots %+v", s)
+	}
+}
+
+func TestSourceURL(t *testing.T) {
+	if u, err := SourceURL("osv/crates.io"); err != nil || u != "https://osv-vulnerabilities.storage.googleapis.com/crates.io/all.zip" {
+		t.Errorf("unexpected osv url %s %v", u, err)
+	}
+	if _, err := SourceURL("nvd"); err == nil {
+		t.Errorf("expected unknown database to fail")
+	}
+}
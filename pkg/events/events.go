@@ -0,0 +1,252 @@
+// Package events streams the progress of a bsf run as newline delimited JSON, one event per line, to a file
+// descriptor or unix socket, so orchestrators and UIs can follow builds while they run. Go programs embedding bsf
+// subscribe to the events instead, with a callback or a channel, to render their own progress. Nothing is emitted
+// unless a stream was opened or a subscriber listens.
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Types of the events
+const (
+	PhaseStarted     = "phase_started"
+	PhaseFinished    = "phase_finished"
+	PathHashed       = "path_hashed"
+	HashMismatch     = "hash_mismatch"
+	ComponentEmitted = "component_emitted"
+	PushProgress     = "push_progress"
+	Progress         = "progress"
+	BuildFinished    = "build_finished"
+)
+
+// Event is a line of the stream. Only the fields of its type are set.
+type Event struct {
+	Type string    `json:"type"`
+	Time time.Time `json:"time"`
+	// Phase is the phase of the run that started or finished, e.g. closure
+	Phase string `json:"phase,omitempty"`
+	// DurationMs is how long the finished phase took
+	DurationMs int64 `json:"durationMs,omitempty"`
+	// Error is why the phase stopped, empty when it completed
+	Error string `json:"error,omitempty"`
+	// StorePath and Hash are the store path hashed and its NAR hash
+	StorePath string `json:"storePath,omitempty"`
+	Hash      string `json:"hash,omitempty"`
+	// Expected is the NAR hash the store recorded of a path that hashed to another one, Repaired whether nix store
+	// repair restored its content. Error is why it couldn't.
+	Expected string `json:"expected,omitempty"`
+	Repaired bool   `json:"repaired,omitempty"`
+	// Name, Version and Purl describe the SBOM component emitted
+	Name    string `json:"name,omitempty"`
+	Version string `json:"version,omitempty"`
+	Purl    string `json:"purl,omitempty"`
+	// Digest, Uploaded and Size are the blob being pushed and how many of its bytes were uploaded
+	Digest   string `json:"digest,omitempty"`
+	Uploaded int64  `json:"uploaded,omitempty"`
+	Size     int64  `json:"size,omitempty"`
+	// Done and Total are how many of the items of the phase were processed, e.g. the store paths of the closure hashed
+	Done  int64 `json:"done,omitempty"`
+	Total int64 `json:"total,omitempty"`
+	// Result is the outcome of the finished build
+	Result *Result `json:"result,omitempty"`
+}
+
+// Percent returns how far the phase of a progress event or the push of a blob got, from 0 to 100
+func (e Event) Percent() float64 {
+	done, total := e.Done, e.Total
+	if e.Type == PushProgress {
+		done, total = e.Uploaded, e.Size
+	}
+	if total <= 0 {
+		return 0
+	}
+	return 100 * float64(done) / float64(total)
+}
+
+// Result is the outcome of a build, emitted once it completed
+type Result struct {
+	Project string `json:"project"`
+	Variant string `json:"variant,omitempty"`
+	// Output is the directory the artifacts were written to, StorePath the store path built
+	Output    string `json:"output"`
+	StorePath string `json:"storePath"`
+	// Components is the number of components of the closure
+	Components int        `json:"components"`
+	Artifacts  []Artifact `json:"artifacts"`
+}
+
+// Artifact is a file written to the output directory
+type Artifact struct {
+	Kind      string `json:"kind"`
+	Name      string `json:"name"`
+	Path      string `json:"path"`
+	Digest    string `json:"digest"`
+	MediaType string `json:"mediaType"`
+}
+
+var (
+	mu          sync.Mutex
+	stream      io.WriteCloser
+	subscribers = make(map[int]func(Event))
+	nextID      int
+	// deliverMu delivers the events to the subscribers one at a time, in the order they were emitted
+	deliverMu sync.Mutex
+)
+
+// Open streams the events of the run to the target: fd:N writes to the file descriptor N the orchestrator passed
+// to bsf, unix:PATH connects to the unix socket it listens on
+func Open(target string) error {
+	w, err := open(target)
+	if err != nil {
+		return fmt.Errorf("failed to open the event stream %s: %v", target, err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if stream != nil {
+		stream.Close()
+	}
+	stream = w
+	return nil
+}
+
+func open(target string) (io.WriteCloser, error) {
+	kind, value, ok := strings.Cut(target, ":")
+	if !ok {
+		return nil, fmt.Errorf("the stream must be fd:N or unix:PATH")
+	}
+	switch kind {
+	case "fd":
+		fd, err := strconv.Atoi(value)
+		if err != nil || fd < 1 {
+			return nil, fmt.Errorf("invalid file descriptor %q", value)
+		}
+		f := os.NewFile(uintptr(fd), "events")
+		if _, err := f.Stat(); err != nil {
+			return nil, err
+		}
+		return f, nil
+	case "unix":
+		return net.Dial("unix", value)
+	}
+	return nil, fmt.Errorf("unsupported stream %q, the stream must be fd:N or unix:PATH", kind)
+}
+
+// Enabled returns whether events are streamed or subscribed to
+func Enabled() bool {
+	mu.Lock()
+	defer mu.Unlock()
+	return stream != nil || len(subscribers) > 0
+}
+
+// Subscribe calls fn with each event emitted until the returned function is called. The events are delivered one at a
+// time in the order they were emitted, from the goroutine emitting them, so fn must return quickly and must not emit
+// events itself.
+func Subscribe(fn func(Event)) (unsubscribe func()) {
+	mu.Lock()
+	defer mu.Unlock()
+	id := nextID
+	nextID++
+	subscribers[id] = fn
+	return func() {
+		mu.Lock()
+		defer mu.Unlock()
+		delete(subscribers, id)
+	}
+}
+
+// Channel returns a channel receiving the events emitted until the returned function is called, which closes it. The
+// run waits for the receiver once size events are buffered.
+func Channel(size int) (<-chan Event, func()) {
+	ch := make(chan Event, size)
+	done := make(chan struct{})
+	unsubscribe := Subscribe(func(e Event) {
+		select {
+		case ch <- e:
+		case <-done:
+		}
+	})
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			// emitters waiting for the receiver give up before the subscriber is removed
+			close(done)
+			unsubscribe()
+			// no event is being delivered once the delivery lock is released
+			deliverMu.Lock()
+			close(ch)
+			deliverMu.Unlock()
+		})
+	}
+}
+
+// Emit writes the event to the stream and delivers it to the subscribers, at the current time unless it has one. The
+// stream is dropped when the reader went away, the run goes on without it.
+func Emit(e Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+
+	mu.Lock()
+	if stream != nil {
+		// a single write per line, so readers never see partial events of concurrent emitters
+		if data, err := json.Marshal(e); err == nil {
+			if _, err := stream.Write(append(data, '\n')); err != nil {
+				stream.Close()
+				stream = nil
+			}
+		}
+	}
+	fns := make([]func(Event), 0, len(subscribers))
+	for _, fn := range subscribers {
+		fns = append(fns, fn)
+	}
+	// the delivery lock is taken before the stream is released, so the subscribers see the order of the stream
+	if len(fns) > 0 {
+		deliverMu.Lock()
+		defer deliverMu.Unlock()
+	}
+	mu.Unlock()
+
+	for _, fn := range fns {
+		fn(e)
+	}
+}
+
+// Phase emits the start of the phase and returns the function that emits its end, with the error that stopped it
+func Phase(name string) func(err error) {
+	if !Enabled() {
+		return func(error) {}
+	}
+
+	start := time.Now()
+	Emit(Event{Type: PhaseStarted, Phase: name})
+	return func(err error) {
+		e := Event{Type: PhaseFinished, Phase: name, DurationMs: time.Since(start).Milliseconds()}
+		if err != nil {
+			e.Error = err.Error()
+		}
+		Emit(e)
+	}
+}
+
+// Close closes the stream, the subscribers keep receiving the events
+func Close() error {
+	mu.Lock()
+	defer mu.Unlock()
+	if stream == nil {
+		return nil
+	}
+	err := stream.Close()
+	stream = nil
+	return err
+}
@@ -0,0 +1,155 @@
+package events
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestOpen(t *testing.T) {
+	for _, target := range []string{"", "3", "fd:x", "fd:0", "fd:4242", "tcp:localhost:80", "unix:" + filepath.Join(t.TempDir(), "missing.sock")} {
+		if err := Open(target); err == nil {
+			Close()
+			t.Errorf("Open(%q) succeeded", target)
+		}
+	}
+}
+
+func TestUnixSocket(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "bsf.sock")
+	ln, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	lines := make(chan []string)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			close(lines)
+			return
+		}
+		defer conn.Close()
+		var got []string
+		scanner := bufio.NewScanner(conn)
+		for scanner.Scan() {
+			got = append(got, scanner.Text())
+		}
+		lines <- got
+	}()
+
+	if err := Open("unix:" + socket); err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			Emit(Event{Type: PushProgress, Digest: fmt.Sprintf("sha256:%d", i), Uploaded: int64(i), Size: 50})
+		}(i)
+	}
+	wg.Wait()
+	Close()
+
+	got := <-lines
+	if len(got) != 50 {
+		t.Fatalf("%d events, want 50", len(got))
+	}
+	// concurrent events are never interleaved
+	for _, line := range got {
+		var e Event
+		if err := json.Unmarshal([]byte(line), &e); err != nil || e.Type != PushProgress {
+			t.Errorf("invalid event %s: %v", line, err)
+		}
+	}
+}
+
+func TestDisabled(t *testing.T) {
+	Close()
+	if Enabled() {
+		t.Fatal("events are enabled without a stream")
+	}
+	// nothing to emit to, nothing fails
+	Emit(Event{Type: ComponentEmitted, Name: "curl"})
+	Phase("scan")(nil)
+}
+
+func TestSubscribe(t *testing.T) {
+	Close()
+	var got []Event
+	unsubscribe := Subscribe(func(e Event) { got = append(got, e) })
+	if !Enabled() {
+		t.Fatal("events are disabled with a subscriber")
+	}
+	Phase("closure")(errors.New("no store"))
+	Emit(Event{Type: Progress, Phase: "closure", Done: 1, Total: 4})
+	unsubscribe()
+	Emit(Event{Type: ComponentEmitted, Name: "curl"})
+
+	if len(got) != 3 {
+		t.Fatalf("%d events, want 3", len(got))
+	}
+	if got[0].Type != PhaseStarted || got[1].Type != PhaseFinished || got[1].Error != "no store" || got[0].Time.IsZero() {
+		t.Errorf("unexpected phase events %+v", got[:2])
+	}
+	if p := got[2].Percent(); p != 25 {
+		t.Errorf("Percent() = %v, want 25", p)
+	}
+	if Enabled() {
+		t.Error("events are enabled once the subscriber is gone")
+	}
+}
+
+func TestChannel(t *testing.T) {
+	Close()
+	ch, cancel := Channel(1)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			Emit(Event{Type: PushProgress, Digest: fmt.Sprintf("sha256:%d", i), Uploaded: int64(i), Size: 10})
+		}(i)
+	}
+
+	// the emitters wait for the receiver, the ones left waiting give up once the channel is cancelled
+	for i := 0; i < 5; i++ {
+		if e := <-ch; e.Type != PushProgress {
+			t.Errorf("unexpected event %+v", e)
+		}
+	}
+	cancel()
+	wg.Wait()
+	cancel()
+	for range ch {
+	}
+	if Enabled() {
+		t.Error("events are enabled once the channel is cancelled")
+	}
+}
+
+func TestPercent(t *testing.T) {
+	tests := []struct {
+		name  string
+		event Event
+		want  float64
+	}{
+		{name: "progress", event: Event{Type: Progress, Done: 3, Total: 4}, want: 75},
+		{name: "push", event: Event{Type: PushProgress, Uploaded: 512, Size: 1024}, want: 50},
+		{name: "no total", event: Event{Type: Progress, Done: 3}, want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.event.Percent(); got != tt.want {
+				t.Errorf("Percent() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
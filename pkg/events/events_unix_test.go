@@ -0,0 +1,59 @@
+//go:build unix
+
+package events
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+	"testing"
+)
+
+func TestFileDescriptor(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	// the stream closes its descriptor, a duplicate of the one of w
+	fd, err := syscall.Dup(int(w.Fd()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+	if err := Open(fmt.Sprintf("fd:%d", fd)); err != nil {
+		t.Fatal(err)
+	}
+
+	stop := Phase("closure")
+	Emit(Event{Type: PathHashed, StorePath: "/nix/store/aaaa-curl-8.6.0", Hash: "0a2n"})
+	stop(errors.New("closure paths are missing from the store"))
+	if err := Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []Event
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		var e Event
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			t.Fatalf("invalid event %s: %v", scanner.Text(), err)
+		}
+		got = append(got, e)
+	}
+	if len(got) != 3 {
+		t.Fatalf("%d events, want 3: %+v", len(got), got)
+	}
+	if got[0].Type != PhaseStarted || got[0].Phase != "closure" || got[0].Time.IsZero() {
+		t.Errorf("first event = %+v", got[0])
+	}
+	if got[1].Type != PathHashed || got[1].StorePath != "/nix/store/aaaa-curl-8.6.0" {
+		t.Errorf("second event = %+v", got[1])
+	}
+	if got[2].Type != PhaseFinished || got[2].Error != "closure paths are missing from the store" {
+		t.Errorf("third event = %+v", got[2])
+	}
+}
@@ -0,0 +1,302 @@
+// Package evidence exports the records of the builds of a period as an archive for auditors: the build database
+// entries, and the SBOMs, attestations, receipts, scan reports and policy decisions of the builds their output
+// directories still hold. The manifest of the archive lists every file with its digest and is signed, so the archive
+// can be checked to be complete and unaltered with the public key alone.
+package evidence
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/buildsafedev/bsf/pkg/builddb"
+	"github.com/buildsafedev/bsf/pkg/layout"
+	"github.com/buildsafedev/bsf/pkg/signing"
+)
+
+const (
+	// SchemaVersion is the version of the manifest
+	SchemaVersion = 1
+	// ManifestName is the name of the manifest in the archive
+	ManifestName = "manifest.json"
+	// SignatureName is the DSSE envelope of the manifest in the archive
+	SignatureName = "manifest.sig.json"
+	// PayloadType is the payload type of the envelope of the manifest
+	PayloadType = "application/vnd.buildsafe.evidence.manifest+json"
+)
+
+// Manifest is the index of an evidence archive
+type Manifest struct {
+	SchemaVersion int       `json:"schemaVersion"`
+	Created       time.Time `json:"created"`
+	From          time.Time `json:"from"`
+	To            time.Time `json:"to"`
+	// Project limits the archive to the builds of a project, all projects when empty
+	Project    string               `json:"project,omitempty"`
+	Builds     []Build              `json:"builds"`
+	Promotions []*builddb.Promotion `json:"promotions"`
+	Files      []File               `json:"files"`
+}
+
+// Build is a build of the period
+type Build struct {
+	Record *builddb.Record `json:"record"`
+	// Missing tells why the files of the build are not in the archive, e.g. its output directory was rebuilt
+	Missing string `json:"missing,omitempty"`
+}
+
+// File is a file of the archive
+type File struct {
+	// Path is the path of the file in the archive
+	Path      string `json:"path"`
+	Kind      string `json:"kind"`
+	Name      string `json:"name"`
+	MediaType string `json:"mediaType"`
+	Digest    string `json:"digest"`
+	Size      int64  `json:"size"`
+	// StorePath is the result of the build the file belongs to
+	StorePath string `json:"storePath"`
+
+	source string
+}
+
+// Options select the builds of the archive
+type Options struct {
+	// From and To bound the period, To is excluded
+	From, To time.Time
+	// Project limits the archive to the builds of a project
+	Project string
+}
+
+// Collect returns the manifest of the builds and promotions of the period, with the files of the output directories
+// that still hold the builds. Artifacts such as binaries are left out, they are not evidence.
+func Collect(records []*builddb.Record, promotions []*builddb.Promotion, opts Options, now time.Time) *Manifest {
+	m := &Manifest{
+		SchemaVersion: SchemaVersion,
+		Created:       now.UTC(),
+		From:          opts.From.UTC(),
+		To:            opts.To.UTC(),
+		Project:       opts.Project,
+		Builds:        make([]Build, 0),
+		Promotions:    make([]*builddb.Promotion, 0),
+		Files:         make([]File, 0),
+	}
+	inPeriod := func(project string, t time.Time) bool {
+		return (opts.Project == "" || project == opts.Project) && !t.Before(opts.From) && t.Before(opts.To)
+	}
+
+	for _, r := range records {
+		if !inPeriod(r.Project, r.Time) {
+			continue
+		}
+		b := Build{Record: r}
+		if r.Failed() {
+			// a failed build left no files, its record is the evidence
+			m.Builds = append(m.Builds, b)
+			continue
+		}
+		files, err := buildFiles(r)
+		switch {
+		case err != nil:
+			b.Missing = err.Error()
+		case len(files) == 0:
+			b.Missing = "the output directory holds another build"
+		}
+		m.Builds = append(m.Builds, b)
+		m.Files = append(m.Files, files...)
+	}
+	for _, p := range promotions {
+		if inPeriod(p.Project, p.Time) {
+			m.Promotions = append(m.Promotions, p)
+		}
+	}
+	sort.SliceStable(m.Builds, func(i, j int) bool { return m.Builds[i].Record.Time.Before(m.Builds[j].Record.Time) })
+	sort.SliceStable(m.Promotions, func(i, j int) bool { return m.Promotions[i].Time.Before(m.Promotions[j].Time) })
+	return m
+}
+
+// buildFiles returns the files of the output directory of the build, none when it holds another build
+func buildFiles(r *builddb.Record) ([]File, error) {
+	if r.Output == "" {
+		return nil, fmt.Errorf("the output directory of the build was not recorded")
+	}
+	if _, err := os.Stat(filepath.Join(r.Output, layout.IndexFile)); err != nil {
+		return nil, fmt.Errorf("the output directory %s was removed", r.Output)
+	}
+	l, err := layout.Open(r.Output)
+	if err != nil {
+		return nil, err
+	}
+	if l.Index.Result != r.StorePath {
+		return nil, nil
+	}
+
+	dir := path.Join("builds", safeName(r.Project), path.Base(r.StorePath))
+	files := make([]File, 0, len(l.Index.Entries))
+	for _, e := range l.Index.Entries {
+		if e.Kind == layout.KindArtifact {
+			continue
+		}
+		files = append(files, File{
+			Path:      path.Join(dir, e.Kind, safeName(e.Name)),
+			Kind:      e.Kind,
+			Name:      e.Name,
+			MediaType: e.MediaType,
+			Digest:    e.Digest,
+			Size:      e.Size,
+			StorePath: r.StorePath,
+			source:    filepath.Join(r.Output, filepath.FromSlash(e.Path)),
+		})
+	}
+	return files, nil
+}
+
+// Write writes the archive of the manifest, a gzipped tar of the manifest, its signature and the files it lists.
+// The archive is unsigned when signer is nil.
+func Write(w io.Writer, m *Manifest, signer crypto.Signer) error {
+	manifest, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	if err := writeEntry(tw, ManifestName, m.Created, manifest); err != nil {
+		return err
+	}
+	if signer != nil {
+		env, err := signing.SignEnvelope(signer, PayloadType, manifest)
+		if err != nil {
+			return fmt.Errorf("failed to sign the manifest: %v", err)
+		}
+		sig, err := json.MarshalIndent(env, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := writeEntry(tw, SignatureName, m.Created, sig); err != nil {
+			return err
+		}
+	}
+	for _, f := range m.Files {
+		data, err := os.ReadFile(f.source)
+		if err != nil {
+			return err
+		}
+		// the manifest lists the digests of the index, a file altered since would not verify
+		if digest := sha256Digest(data); digest != f.Digest {
+			return fmt.Errorf("%s has digest %s, its output directory records %s", f.source, digest, f.Digest)
+		}
+		if err := writeEntry(tw, f.Path, m.Created, data); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// Verify checks the archive: the signature of its manifest by the public key, when given, and the digest of each
+// file the manifest lists. It returns the manifest.
+func Verify(r io.Reader, pub crypto.PublicKey) (*Manifest, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("not an evidence archive: %v", err)
+	}
+	defer gz.Close()
+
+	var manifest, sig []byte
+	digests := make(map[string]string)
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, err
+		}
+		switch hdr.Name {
+		case ManifestName:
+			manifest = data
+		case SignatureName:
+			sig = data
+		default:
+			digests[hdr.Name] = sha256Digest(data)
+		}
+	}
+	if manifest == nil {
+		return nil, fmt.Errorf("the archive has no %s", ManifestName)
+	}
+
+	if pub != nil {
+		if sig == nil {
+			return nil, fmt.Errorf("the archive is not signed")
+		}
+		env := &signing.Envelope{}
+		if err := json.Unmarshal(sig, env); err != nil {
+			return nil, fmt.Errorf("invalid %s: %v", SignatureName, err)
+		}
+		payload, err := signing.VerifyEnvelope(pub, env)
+		if err != nil {
+			return nil, err
+		}
+		if env.PayloadType != PayloadType || string(payload) != string(manifest) {
+			return nil, fmt.Errorf("the signature is not the one of %s", ManifestName)
+		}
+	}
+
+	m := &Manifest{}
+	if err := json.Unmarshal(manifest, m); err != nil {
+		return nil, fmt.Errorf("invalid %s: %v", ManifestName, err)
+	}
+	for _, f := range m.Files {
+		digest, ok := digests[f.Path]
+		if !ok {
+			return nil, fmt.Errorf("%s is missing from the archive", f.Path)
+		}
+		if digest != f.Digest {
+			return nil, fmt.Errorf("%s has digest %s, the manifest records %s", f.Path, digest, f.Digest)
+		}
+	}
+	return m, nil
+}
+
+func writeEntry(tw *tar.Writer, name string, modTime time.Time, data []byte) error {
+	hdr := &tar.Header{Name: name, Mode: 0644, Size: int64(len(data)), ModTime: modTime, Typeflag: tar.TypeReg}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err := tw.Write(data)
+	return err
+}
+
+func sha256Digest(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// safeName returns the name as a single path element of the archive
+func safeName(name string) string {
+	name = strings.NewReplacer("/", "_", "\\", "_").Replace(name)
+	if name == "" || name == "." || name == ".." {
+		return "_"
+	}
+	return name
+}
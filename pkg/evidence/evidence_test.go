@@ -0,0 +1,94 @@
+package evidence
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/buildsafedev/bsf/pkg/builddb"
+	"github.com/buildsafedev/bsf/pkg/layout"
+	"github.com/buildsafedev/bsf/pkg/signing"
+)
+
+const (
+	v1 = "/nix/store/0c9rf6rgcfd5j9b9wgzcm4cfdpi8wq5f-app-1.0"
+	v2 = "/nix/store/1ac3r0gk2fqsy3hkq8m4xhhlq4gfgnc4-app-1.1"
+)
+
+func TestExport(t *testing.T) {
+	output := t.TempDir()
+	l, err := layout.Open(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Index.Result = v2
+	for _, e := range []struct{ kind, name string }{
+		{layout.KindSBOM, "sbom.spdx.json"},
+		{layout.KindAttestation, layout.AttestationsName},
+		{layout.KindReport, "policy.json"},
+		{layout.KindArtifact, "bin/app"},
+	} {
+		if _, err := l.Add(e.kind, e.name, "application/json", []byte(e.kind+"/"+e.name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := l.Write(); err != nil {
+		t.Fatal(err)
+	}
+
+	day := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	records := []*builddb.Record{
+		{Project: "app", Version: "1.0", StorePath: v1, Time: day, Output: output},
+		{Project: "app", Version: "1.1", StorePath: v2, Time: day.Add(24 * time.Hour), Output: output},
+		{Project: "app", Version: "0.9", StorePath: v1, Time: day.AddDate(0, -1, 0), Output: output},
+		{Project: "other", Version: "1.0", StorePath: v1, Time: day},
+	}
+	promotions := []*builddb.Promotion{{Project: "app", StorePath: v2, Time: day.Add(48 * time.Hour), To: "s3://prod"}}
+
+	m := Collect(records, promotions, Options{From: day, To: day.AddDate(0, 1, 0), Project: "app"}, day.AddDate(0, 2, 0))
+	if len(m.Builds) != 2 || m.Builds[0].Record.StorePath != v1 || m.Builds[1].Record.StorePath != v2 {
+		t.Fatalf("Builds = %+v", m.Builds)
+	}
+	if m.Builds[0].Missing == "" || m.Builds[1].Missing != "" {
+		t.Errorf("the overwritten build should be reported missing: %+v", m.Builds)
+	}
+	if len(m.Files) != 3 {
+		t.Errorf("%d files, want the SBOM, attestations and report but not the artifact", len(m.Files))
+	}
+	if len(m.Promotions) != 1 {
+		t.Errorf("Promotions = %+v", m.Promotions)
+	}
+
+	signer, err := signing.NewEphemeralSigner()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var archive bytes.Buffer
+	if err := Write(&archive, m, signer); err != nil {
+		t.Fatal(err)
+	}
+
+	verified, err := Verify(bytes.NewReader(archive.Bytes()), signer.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(verified.Files) != 3 || verified.Files[0].Path == "" {
+		t.Errorf("verified manifest = %+v", verified.Files)
+	}
+
+	other, _ := signing.NewEphemeralSigner()
+	if _, err := Verify(bytes.NewReader(archive.Bytes()), other.Public()); err == nil {
+		t.Error("expected the archive signed by another key to fail verification")
+	}
+
+	var unsigned bytes.Buffer
+	if err := Write(&unsigned, m, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Verify(bytes.NewReader(unsigned.Bytes()), signer.Public()); err == nil {
+		t.Error("expected an unsigned archive to fail verification with a key")
+	}
+	if _, err := Verify(bytes.NewReader(unsigned.Bytes()), nil); err != nil {
+		t.Errorf("the digests of an unsigned archive should verify: %v", err)
+	}
+}
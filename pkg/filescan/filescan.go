@@ -0,0 +1,202 @@
+// Package filescan scans the files of store paths for licenses. Findings are streamed to a JSONL report as they
+// are produced, and a scan stopped halfway resumes from the store paths the report did not complete.
+package filescan
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Kinds of findings
+const (
+	// KindLicenseFile is a LICENSE, COPYING or NOTICE file
+	KindLicenseFile = "license-file"
+	// KindSPDXIdentifier is a SPDX-License-Identifier tag in a source file
+	KindSPDXIdentifier = "spdx-identifier"
+)
+
+const (
+	// maxFileSize is the size above which files are not searched for SPDX identifiers, they are binaries or data
+	maxFileSize = 1 << 20
+	// headerSize is how much of a file is searched for a SPDX identifier, the tag is in the header of sources
+	headerSize = 8 << 10
+)
+
+// Finding is a license found in a file of a store path
+type Finding struct {
+	StorePath string `json:"storePath"`
+	// File is the path of the file relative to the store path
+	File    string `json:"file"`
+	Kind    string `json:"kind"`
+	License string `json:"license,omitempty"`
+}
+
+var (
+	licenseFileName = regexp.MustCompile(`(?i)^(licen[cs]e|copying|notice|unlicense)([-._].*)?$`)
+	spdxIdentifier  = regexp.MustCompile(`SPDX-License-Identifier:\s*([A-Za-z0-9.+\-() ]+?)\s*(\*/|-->|$)`)
+)
+
+// licenseTexts identify the license of a license file by a phrase of its text, whitespace collapsed
+var licenseTexts = []struct {
+	id     string
+	phrase string
+}{
+	{"Apache-2.0", "Apache License, Version 2.0"},
+	{"Apache-2.0", "Apache License Version 2.0"},
+	{"GPL-3.0", "GNU GENERAL PUBLIC LICENSE Version 3"},
+	{"GPL-2.0", "GNU GENERAL PUBLIC LICENSE Version 2"},
+	{"LGPL-3.0", "GNU LESSER GENERAL PUBLIC LICENSE Version 3"},
+	{"LGPL-2.1", "GNU LESSER GENERAL PUBLIC LICENSE Version 2.1"},
+	{"MPL-2.0", "Mozilla Public License Version 2.0"},
+	{"MIT", "Permission is hereby granted, free of charge, to any person obtaining a copy"},
+	{"BSD-3-Clause", "Neither the name of"},
+	{"BSD-2-Clause", "Redistributions in binary form must reproduce the above copyright"},
+	{"ISC", "Permission to use, copy, modify, and/or distribute this software for any"},
+	{"Unlicense", "This is free and unencumbered software released into the public domain"},
+}
+
+// Scanner scans store paths, Workers at once
+type Scanner struct {
+	// Workers is the number of store paths scanned at once, 0 scans them one by one
+	Workers int
+	// HostPath returns where a store path is on this host, e.g. below the root of a chroot store
+	HostPath func(storePath string) string
+}
+
+// Scan scans the store paths and streams the findings to the report. Store paths the report already completed
+// are skipped, each store path is marked complete once all its findings were written.
+func (s *Scanner) Scan(ctx context.Context, storePaths []string, report *Report) error {
+	workers := s.Workers
+	if workers <= 0 {
+		workers = 1
+	}
+
+	paths := make(chan string)
+	errs := make(chan error, workers)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for p := range paths {
+				err := s.scanPath(ctx, p, report)
+				if err == nil {
+					err = report.Complete(p)
+				}
+				if err != nil {
+					errs <- err
+					return
+				}
+			}
+		}()
+	}
+
+	var err error
+send:
+	for _, p := range storePaths {
+		if report.Done(p) {
+			continue
+		}
+		select {
+		case paths <- p:
+		case err = <-errs:
+			break send
+		case <-ctx.Done():
+			err = ctx.Err()
+			break send
+		}
+	}
+	close(paths)
+	wg.Wait()
+	close(errs)
+	if err != nil {
+		return err
+	}
+	return <-errs
+}
+
+// scanPath streams the findings of the files of a store path to the report
+func (s *Scanner) scanPath(ctx context.Context, storePath string, report *Report) error {
+	root := storePath
+	if s.HostPath != nil {
+		root = s.HostPath(storePath)
+	}
+
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+
+		finding, err := scanFile(path, d)
+		if err != nil || finding == nil {
+			return err
+		}
+		finding.StorePath = storePath
+		finding.File = filepath.ToSlash(rel)
+		return report.Add(*finding)
+	})
+}
+
+// scanFile returns the license finding of a file, nil when it has none
+func scanFile(path string, d fs.DirEntry) (*Finding, error) {
+	isLicenseFile := licenseFileName.MatchString(d.Name())
+	if !isLicenseFile {
+		info, err := d.Info()
+		if err != nil || info.Size() > maxFileSize {
+			return nil, err
+		}
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	limit := int64(headerSize)
+	if isLicenseFile {
+		limit = maxFileSize
+	}
+	data, err := io.ReadAll(io.LimitReader(f, limit))
+	if err != nil {
+		return nil, err
+	}
+
+	if isLicenseFile {
+		return &Finding{Kind: KindLicenseFile, License: identifyLicense(string(data))}, nil
+	}
+	sc := bufio.NewScanner(strings.NewReader(string(data)))
+	for sc.Scan() {
+		if m := spdxIdentifier.FindStringSubmatch(sc.Text()); m != nil {
+			return &Finding{Kind: KindSPDXIdentifier, License: strings.TrimSpace(m[1])}, nil
+		}
+	}
+	return nil, nil
+}
+
+// identifyLicense returns the SPDX identifier of a license text, empty when it is not known
+func identifyLicense(text string) string {
+	text = strings.Join(strings.Fields(text), " ")
+	for _, l := range licenseTexts {
+		if strings.Contains(text, l.phrase) {
+			return l.id
+		}
+	}
+	return ""
+}
@@ -0,0 +1,132 @@
+package filescan
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func writeFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestScan(t *testing.T) {
+	curl := writeFiles(t, map[string]string{
+		"share/doc/COPYING": "COPYRIGHT AND PERMISSION NOTICE\n\nPermission is hereby granted, free of charge, to any person obtaining a copy\n",
+		"bin/curl":          "\x7fELF binary",
+	})
+	zlib := writeFiles(t, map[string]string{
+		"include/zlib.h":      "/* SPDX-License-Identifier: Zlib */\n#ifndef ZLIB_H\n",
+		"share/LICENSE.txt":   "Apache License\n                           Version 2.0, January 2004\n",
+		"share/doc/README.md": "no license here",
+	})
+
+	reportPath := filepath.Join(t.TempDir(), "report.jsonl")
+	report, err := OpenReport(reportPath, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Scanner{Workers: 2}
+	if err := s.Scan(context.Background(), []string{curl, zlib}, report); err != nil {
+		t.Fatal(err)
+	}
+	if report.Findings() != 3 {
+		t.Errorf("expected 3 findings, got %d", report.Findings())
+	}
+	report.Close()
+
+	findings, completed, err := ReadReport(reportPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make([]string, 0, len(findings))
+	for _, f := range findings {
+		got = append(got, f.File+" "+f.Kind+" "+f.License)
+	}
+	sort.Strings(got)
+	want := []string{
+		"include/zlib.h spdx-identifier Zlib",
+		"share/LICENSE.txt license-file Apache-2.0",
+		"share/doc/COPYING license-file MIT",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got findings\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if len(completed) != 2 {
+		t.Errorf("expected both store paths to be completed, got %v", completed)
+	}
+}
+
+func TestResume(t *testing.T) {
+	done := writeFiles(t, map[string]string{"LICENSE": "Mozilla Public License Version 2.0"})
+	partial := writeFiles(t, map[string]string{"COPYING": "GNU GENERAL PUBLIC LICENSE\n   Version 3, 29 June 2007"})
+
+	// a scan killed while scanning the second store path, in the middle of a line
+	reportPath := filepath.Join(t.TempDir(), "report.jsonl")
+	previous := `{"finding":{"storePath":"` + done + `","file":"LICENSE","kind":"license-file","license":"MPL-2.0"}}
+{"complete":"` + done + `"}
+{"finding":{"storePath":"` + partial + `","file":"COPYING","kind":"license-file","license":"GPL-3.0"}}
+{"finding":{"storePath":"` + partial + `","fi`
+	if err := os.WriteFile(reportPath, []byte(previous), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := OpenReport(reportPath, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.Done(done) || report.Done(partial) {
+		t.Fatalf("only %s should be done", done)
+	}
+	// the completed store path is not scanned again, its files could have changed without showing in the report
+	if err := os.Remove(filepath.Join(done, "LICENSE")); err != nil {
+		t.Fatal(err)
+	}
+	if err := (&Scanner{}).Scan(context.Background(), []string{done, partial}, report); err != nil {
+		t.Fatal(err)
+	}
+	report.Close()
+
+	findings, completed, err := ReadReport(reportPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(findings) != 2 || findings[0].License != "MPL-2.0" || findings[1].License != "GPL-3.0" {
+		t.Errorf("unexpected findings %+v", findings)
+	}
+	if len(completed) != 2 {
+		t.Errorf("expected both store paths to be completed, got %v", completed)
+	}
+}
+
+func TestScanCancelled(t *testing.T) {
+	dir := writeFiles(t, map[string]string{"LICENSE": "MIT"})
+	report, err := OpenReport(filepath.Join(t.TempDir(), "report.jsonl"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer report.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := (&Scanner{}).Scan(ctx, []string{dir}, report); err == nil {
+		t.Errorf("expected a cancelled scan to fail")
+	}
+	if report.Done(dir) {
+		t.Errorf("a cancelled store path should not be completed")
+	}
+}
@@ -0,0 +1,185 @@
+package filescan
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// record is a line of the report: a finding, or the marker of a store path whose findings were all written
+type record struct {
+	Finding  *Finding `json:"finding,omitempty"`
+	Complete string   `json:"complete,omitempty"`
+}
+
+// Report is a JSONL report findings are written to as they are produced, nothing is held in memory
+type Report struct {
+	mu       sync.Mutex
+	f        *os.File
+	done     map[string]bool
+	findings int
+}
+
+// OpenReport creates the report at path. When resuming, the findings of the store paths the report completed
+// are kept and the ones of store paths it did not complete are dropped, they are scanned again.
+func OpenReport(path string, resume bool) (*Report, error) {
+	if !resume {
+		f, err := os.Create(path)
+		if err != nil {
+			return nil, err
+		}
+		return &Report{f: f, done: make(map[string]bool)}, nil
+	}
+
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	kept, done, findings, err := completedRecords(f)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to resume %s: %v", path, err)
+	}
+	if err := rewrite(f, kept); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &Report{f: f, done: done, findings: findings}, nil
+}
+
+// completedRecords returns the lines of the report about completed store paths and the number of findings
+// among them. A truncated last line, from a scan killed while writing it, is dropped.
+func completedRecords(r io.Reader) ([][]byte, map[string]bool, int, error) {
+	var records []record
+	var lines [][]byte
+	done := make(map[string]bool)
+
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64*1024), 16<<20)
+	for sc.Scan() {
+		rec := record{}
+		if err := json.Unmarshal(sc.Bytes(), &rec); err != nil {
+			continue
+		}
+		if rec.Complete != "" {
+			done[rec.Complete] = true
+		}
+		records = append(records, rec)
+		lines = append(lines, append([]byte(nil), sc.Bytes()...))
+	}
+	if err := sc.Err(); err != nil {
+		return nil, nil, 0, err
+	}
+
+	kept := make([][]byte, 0, len(lines))
+	findings := 0
+	for i, rec := range records {
+		if rec.Finding != nil {
+			if !done[rec.Finding.StorePath] {
+				continue
+			}
+			findings++
+		}
+		kept = append(kept, lines[i])
+	}
+	return kept, done, findings, nil
+}
+
+// rewrite replaces the content of the file with the lines, leaving the offset at its end for the next records
+func rewrite(f *os.File, lines [][]byte) error {
+	if err := f.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	for _, l := range lines {
+		if _, err := f.Write(append(l, '\n')); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Done reports if the report completed the store path
+func (r *Report) Done(storePath string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.done[storePath]
+}
+
+// Add writes the finding to the report
+func (r *Report) Add(f Finding) error {
+	if err := r.write(record{Finding: &f}); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.findings++
+	return nil
+}
+
+// Findings returns the number of findings in the report
+func (r *Report) Findings() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.findings
+}
+
+// Complete marks the store path complete, after all its findings were added
+func (r *Report) Complete(storePath string) error {
+	if err := r.write(record{Complete: storePath}); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.done[storePath] = true
+	return nil
+}
+
+// write writes the record as one line, so concurrent scans don't interleave their findings within a line
+func (r *Report) write(rec record) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, err = r.f.Write(append(data, '\n'))
+	return err
+}
+
+// Close closes the report
+func (r *Report) Close() error {
+	return r.f.Close()
+}
+
+// ReadReport returns the findings of a report and the store paths it completed
+func ReadReport(path string) ([]Finding, []string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	findings := make([]Finding, 0)
+	completed := make([]string, 0)
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	sc.Buffer(make([]byte, 0, 64*1024), 16<<20)
+	for sc.Scan() {
+		rec := record{}
+		if err := json.Unmarshal(sc.Bytes(), &rec); err != nil {
+			return nil, nil, fmt.Errorf("invalid report line %q: %v", sc.Text(), err)
+		}
+		if rec.Finding != nil {
+			findings = append(findings, *rec.Finding)
+		}
+		if rec.Complete != "" {
+			completed = append(completed, rec.Complete)
+		}
+	}
+	return findings, completed, sc.Err()
+}
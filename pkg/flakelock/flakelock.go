@@ -0,0 +1,155 @@
+package flakelock
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+)
+
+// Lock represents a flake.lock file
+type Lock struct {
+	Nodes   map[string]Node `json:"nodes"`
+	Root    string          `json:"root"`
+	Version int             `json:"version"`
+}
+
+// Node is an input of the flake
+type Node struct {
+	// Inputs maps input names to a node name, or to a follows path
+	Inputs   map[string]json.RawMessage `json:"inputs"`
+	Locked   *Ref                       `json:"locked"`
+	Original *Ref                       `json:"original"`
+}
+
+// Ref is a locked or original flake reference
+type Ref struct {
+	Type         string `json:"type"`
+	Owner        string `json:"owner,omitempty"`
+	Repo         string `json:"repo,omitempty"`
+	Rev          string `json:"rev,omitempty"`
+	Ref          string `json:"ref,omitempty"`
+	URL          string `json:"url,omitempty"`
+	Path         string `json:"path,omitempty"`
+	NarHash      string `json:"narHash,omitempty"`
+	LastModified int64  `json:"lastModified,omitempty"`
+}
+
+// Read reads the flake.lock file
+func Read(path string) (*Lock, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	lock := &Lock{}
+	err = json.Unmarshal(data, lock)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", path, err)
+	}
+	if lock.Root == "" {
+		lock.Root = "root"
+	}
+
+	return lock, nil
+}
+
+// resolve returns the node name an input points to, following "follows" paths from the root
+func (l *Lock) resolve(input json.RawMessage) (string, bool) {
+	var name string
+	if err := json.Unmarshal(input, &name); err == nil {
+		return name, true
+	}
+
+	var follows []string
+	if err := json.Unmarshal(input, &follows); err != nil {
+		return "", false
+	}
+
+	current := l.Root
+	for _, f := range follows {
+		node, ok := l.Nodes[current]
+		if !ok {
+			return "", false
+		}
+		next, ok := node.Inputs[f]
+		if !ok {
+			return "", false
+		}
+		current, ok = l.resolve(next)
+		if !ok {
+			return "", false
+		}
+	}
+
+	return current, true
+}
+
+// String returns the flake reference URL of the ref
+func (r *Ref) String() string {
+	switch r.Type {
+	case "github", "gitlab", "sourcehut":
+		s := fmt.Sprintf("%s:%s/%s", r.Type, r.Owner, r.Repo)
+		if r.Rev != "" {
+			s += "/" + r.Rev
+		} else if r.Ref != "" {
+			s += "/" + r.Ref
+		}
+		return s
+	case "git", "hg":
+		s := r.Type + "+" + r.URL
+		q := url.Values{}
+		if r.Ref != "" {
+			q.Set("ref", r.Ref)
+		}
+		if r.Rev != "" {
+			q.Set("rev", r.Rev)
+		}
+		if len(q) > 0 {
+			s += "?" + q.Encode()
+		}
+		return s
+	case "path":
+		return "path:" + r.Path
+	case "tarball", "file":
+		return r.Type + "+" + r.URL
+	}
+
+	return r.Type + ":" + r.URL
+}
+
+// InputRev returns the locked revision of a direct input of the root flake
+func (l *Lock) InputRev(name string) (string, bool) {
+	node, ok := l.input(name)
+	if !ok || node.Locked == nil || node.Locked.Rev == "" {
+		return "", false
+	}
+	return node.Locked.Rev, true
+}
+
+// InputOriginal returns the reference a direct input of the root flake was locked from, e.g. the branch it follows
+func (l *Lock) InputOriginal(name string) (*Ref, bool) {
+	node, ok := l.input(name)
+	if !ok || node.Original == nil {
+		return nil, false
+	}
+	return node.Original, true
+}
+
+// input returns the node of a direct input of the root flake
+func (l *Lock) input(name string) (Node, bool) {
+	root, ok := l.Nodes[l.Root]
+	if !ok {
+		return Node{}, false
+	}
+	raw, ok := root.Inputs[name]
+	if !ok {
+		return Node{}, false
+	}
+	nodeName, ok := l.resolve(raw)
+	if !ok {
+		return Node{}, false
+	}
+	node, ok := l.Nodes[nodeName]
+	return node, ok
+}
@@ -0,0 +1,135 @@
+package flakelock
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"zombiezen.com/go/nix/nixbase32"
+
+	nixcmd "github.com/buildsafedev/bsf/pkg/nix/cmd"
+)
+
+func TestRefString(t *testing.T) {
+	tests := []struct {
+		name string
+		ref  Ref
+		want string
+	}{
+		{
+			name: "github with rev",
+			ref:  Ref{Type: "github", Owner: "NixOS", Repo: "nixpkgs", Rev: "abc123"},
+			want: "github:NixOS/nixpkgs/abc123",
+		},
+		{
+			name: "git with ref and rev",
+			ref:  Ref{Type: "git", URL: "https://example.com/repo.git", Ref: "main", Rev: "abc123"},
+			want: "git+https://example.com/repo.git?ref=main&rev=abc123",
+		},
+		{
+			name: "path",
+			ref:  Ref{Type: "path", Path: "/tmp/flake"},
+			want: "path:/tmp/flake",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.ref.String(); got != tt.want {
+				t.Errorf("String() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolve(t *testing.T) {
+	lock := &Lock{}
+	err := json.Unmarshal([]byte(`{
+		"nodes": {
+			"root": {"inputs": {"nixpkgs": "nixpkgs", "utils": "utils"}},
+			"nixpkgs": {"locked": {"type": "github", "rev": "abc"}, "original": {"type": "github", "owner": "NixOS", "repo": "nixpkgs", "ref": "nixos-24.05"}},
+			"utils": {"inputs": {"nixpkgs": ["nixpkgs"]}, "locked": {"type": "github"}}
+		},
+		"root": "root",
+		"version": 7
+	}`), lock)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, ok := lock.resolve(lock.Nodes["utils"].Inputs["nixpkgs"])
+	if !ok || got != "nixpkgs" {
+		t.Errorf("resolve() = %v, %v, want nixpkgs, true", got, ok)
+	}
+
+	_, ok = lock.resolve(json.RawMessage(`["missing"]`))
+	if ok {
+		t.Errorf("resolve() of a missing follows path should fail")
+	}
+
+	if rev, ok := lock.InputRev("nixpkgs"); !ok || rev != "abc" {
+		t.Errorf("InputRev() = %v, %v, want abc, true", rev, ok)
+	}
+	if original, ok := lock.InputOriginal("nixpkgs"); !ok || original.Ref != "nixos-24.05" {
+		t.Errorf("InputOriginal() = %+v, %v, want the nixos-24.05 branch", original, ok)
+	}
+	if _, ok := lock.InputOriginal("utils"); ok {
+		t.Errorf("InputOriginal() of an input without an original reference should fail")
+	}
+}
+
+func TestVerify(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	if err := os.Mkdir(src, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(src, "flake.nix"), []byte("{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	hash, err := nixcmd.GetNarHashFromPath(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest, err := nixbase32.DecodeString(hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sri := "sha256-" + base64.StdEncoding.EncodeToString(digest)
+
+	tests := []struct {
+		name    string
+		narHash string
+		want    bool
+	}{
+		{name: "matching narHash", narHash: sri, want: true},
+		{name: "tampered input", narHash: "sha256-" + base64.StdEncoding.EncodeToString(make([]byte, 32)), want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lock := &Lock{
+				Root: "root",
+				Nodes: map[string]Node{
+					"root": {Inputs: map[string]json.RawMessage{"src": json.RawMessage(`"src"`)}},
+					"src":  {Locked: &Ref{Type: "path", Path: src, NarHash: tt.narHash}},
+				},
+			}
+			archive := &nixcmd.FlakeArchive{
+				Inputs: map[string]nixcmd.FlakeArchive{"src": {Path: src}},
+			}
+
+			got, err := Verify(context.Background(), lock, archive, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != 1 || got[0].NarHashVerified != tt.want {
+				t.Errorf("Verify() = %+v, want NarHashVerified %v", got, tt.want)
+			}
+		})
+	}
+}
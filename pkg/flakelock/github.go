@@ -0,0 +1,74 @@
+package flakelock
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+)
+
+// GitHubChecker checks commit signatures of github inputs using the GitHub API
+type GitHubChecker struct {
+	BaseURL    string
+	Token      string
+	HTTPClient *http.Client
+}
+
+// NewGitHubChecker creates a GitHubChecker, authenticating with GITHUB_TOKEN if it is set
+func NewGitHubChecker() *GitHubChecker {
+	return &GitHubChecker{
+		BaseURL: "https://api.github.com",
+		Token:   os.Getenv("GITHUB_TOKEN"),
+		HTTPClient: &http.Client{
+			Timeout: 30 * time.Second,
+		},
+	}
+}
+
+type githubCommit struct {
+	Commit struct {
+		Verification struct {
+			Verified bool   `json:"verified"`
+			Reason   string `json:"reason"`
+		} `json:"verification"`
+	} `json:"commit"`
+}
+
+// Check checks if the commit the ref is locked to has a verified signature
+func (g *GitHubChecker) Check(ctx context.Context, ref *Ref) (string, string, error) {
+	if ref.Type != "github" || ref.Rev == "" {
+		return SignatureUnsupported, "signatures can only be checked for github inputs", nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("%s/repos/%s/%s/commits/%s", g.BaseURL, ref.Owner, ref.Repo, ref.Rev), nil)
+	if err != nil {
+		return "", "", err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	if g.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+g.Token)
+	}
+
+	resp, err := g.HTTPClient.Do(req)
+	if err != nil {
+		return "", "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", "", fmt.Errorf("GitHub API returned %s", resp.Status)
+	}
+
+	commit := &githubCommit{}
+	err = json.NewDecoder(resp.Body).Decode(commit)
+	if err != nil {
+		return "", "", err
+	}
+
+	if commit.Commit.Verification.Verified {
+		return SignatureVerified, commit.Commit.Verification.Reason, nil
+	}
+	return SignatureUnverified, commit.Commit.Verification.Reason, nil
+}
@@ -0,0 +1,167 @@
+package flakelock
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+
+	"zombiezen.com/go/nix/nixbase32"
+
+	nixcmd "github.com/buildsafedev/bsf/pkg/nix/cmd"
+)
+
+const (
+	// SignatureVerified means the commit of the input is signed by a key known to the forge
+	SignatureVerified = "verified"
+	// SignatureUnverified means the commit of the input is not signed, or the signature could not be verified
+	SignatureUnverified = "unverified"
+	// SignatureUnsupported means signatures cannot be checked for the type of input
+	SignatureUnsupported = "unsupported"
+)
+
+// Verification is the result of verifying a locked flake input
+type Verification struct {
+	Input           string `json:"input"`
+	Ref             string `json:"ref"`
+	Rev             string `json:"rev,omitempty"`
+	NarHash         string `json:"narHash"`
+	StorePath       string `json:"storePath,omitempty"`
+	NarHashVerified bool   `json:"narHashVerified"`
+	// Signature is empty if signatures were not checked
+	Signature       string `json:"signature,omitempty"`
+	SignatureReason string `json:"signatureReason,omitempty"`
+}
+
+// SignatureChecker checks whether the commit an input is locked to is signed
+type SignatureChecker interface {
+	Check(ctx context.Context, ref *Ref) (status string, reason string, err error)
+}
+
+// Verify recomputes the NAR hash of every input in the archive and compares it with the narHash recorded in the lock.
+// If checker is not nil, commit signatures of the inputs are checked too.
+func Verify(ctx context.Context, lock *Lock, archive *nixcmd.FlakeArchive, checker SignatureChecker) ([]Verification, error) {
+	results := make(map[string]Verification)
+
+	var walk func(nodeName string, archive *nixcmd.FlakeArchive) error
+	walk = func(nodeName string, archive *nixcmd.FlakeArchive) error {
+		node, ok := lock.Nodes[nodeName]
+		if !ok {
+			return fmt.Errorf("input %s not found in flake.lock", nodeName)
+		}
+
+		for inputName, inputArchive := range archive.Inputs {
+			raw, ok := node.Inputs[inputName]
+			if !ok {
+				return fmt.Errorf("input %s of %s not found in flake.lock", inputName, nodeName)
+			}
+			childName, ok := lock.resolve(raw)
+			if !ok {
+				return fmt.Errorf("could not resolve input %s of %s", inputName, nodeName)
+			}
+			if _, done := results[childName]; done {
+				continue
+			}
+
+			child := lock.Nodes[childName]
+			if child.Locked == nil {
+				continue
+			}
+
+			v, err := verifyInput(ctx, childName, child.Locked, inputArchive.Path, checker)
+			if err != nil {
+				return err
+			}
+			results[childName] = v
+
+			inputArchive := inputArchive
+			if err := walk(childName, &inputArchive); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if err := walk(lock.Root, archive); err != nil {
+		return nil, err
+	}
+
+	verifications := make([]Verification, 0, len(results))
+	for _, v := range results {
+		verifications = append(verifications, v)
+	}
+	sort.Slice(verifications, func(i, j int) bool {
+		return verifications[i].Input < verifications[j].Input
+	})
+
+	return verifications, nil
+}
+
+func verifyInput(ctx context.Context, name string, locked *Ref, storePath string, checker SignatureChecker) (Verification, error) {
+	v := Verification{
+		Input:     name,
+		Ref:       locked.String(),
+		Rev:       locked.Rev,
+		NarHash:   locked.NarHash,
+		StorePath: storePath,
+	}
+
+	expected, err := SRIToNixbase32(locked.NarHash)
+	if err != nil {
+		return v, fmt.Errorf("invalid narHash for input %s: %v", name, err)
+	}
+
+	actual, err := nixcmd.GetNarHashFromPath(storePath)
+	if err != nil {
+		return v, fmt.Errorf("failed to hash input %s: %v", name, err)
+	}
+	v.NarHashVerified = expected == actual
+
+	if checker != nil {
+		v.Signature, v.SignatureReason, err = checker.Check(ctx, locked)
+		if err != nil {
+			return v, fmt.Errorf("failed to check signature of input %s: %v", name, err)
+		}
+	}
+
+	return v, nil
+}
+
+// SRIToNixbase32 converts a sha256 SRI hash (sha256-<base64>) to the nixbase32 encoding used by bsf
+func SRIToNixbase32(sri string) (string, error) {
+	digest, err := decodeSRI(sri)
+	if err != nil {
+		return "", err
+	}
+	return nixbase32.EncodeToString(digest), nil
+}
+
+// SRIToHex converts a sha256 SRI hash (sha256-<base64>) to hex
+func SRIToHex(sri string) (string, error) {
+	digest, err := decodeSRI(sri)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(digest), nil
+}
+
+func decodeSRI(sri string) ([]byte, error) {
+	b64, ok := strings.CutPrefix(sri, "sha256-")
+	if !ok {
+		return nil, fmt.Errorf("unsupported hash %s, only sha256 is supported", sri)
+	}
+	return base64.StdEncoding.DecodeString(b64)
+}
+
+// Failed returns the inputs whose NAR hash did not match the lock
+func Failed(verifications []Verification) []Verification {
+	failed := make([]Verification, 0)
+	for _, v := range verifications {
+		if !v.NarHashVerified {
+			failed = append(failed, v)
+		}
+	}
+	return failed
+}
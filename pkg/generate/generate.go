@@ -28,6 +28,46 @@ func Generate(fh *hcl2nix.FileHandlers, sc buildsafev1.SearchServiceClient) erro
 	if err != nil {
 		return fmt.Errorf("%v", &dstErr)
 	}
+	if conf.Product != nil {
+		if errStr := conf.Product.Validate(); errStr != nil {
+			return fmt.Errorf("product block is invalid: %s", *errStr)
+		}
+	}
+	for _, a := range conf.Aliases {
+		if errStr := a.Validate(); errStr != nil {
+			return fmt.Errorf("alias block is invalid: %s", *errStr)
+		}
+	}
+	for _, e := range conf.Exemptions {
+		if errStr := e.Validate(); errStr != nil {
+			return fmt.Errorf("exemption block is invalid: %s", *errStr)
+		}
+	}
+	if conf.Policy != nil {
+		if errStr := conf.Policy.Validate(); errStr != nil {
+			return fmt.Errorf("policy block is invalid: %s", *errStr)
+		}
+	}
+	for _, r := range conf.Requires {
+		if errStr := r.Validate(); errStr != nil {
+			return fmt.Errorf("requires block is invalid: %s", *errStr)
+		}
+	}
+	if conf.Retention != nil {
+		if errStr := conf.Retention.Validate(); errStr != nil {
+			return fmt.Errorf("retention block is invalid: %s", *errStr)
+		}
+	}
+	variants := make(map[string]bool)
+	for _, v := range conf.Variants {
+		if errStr := v.Validate(); errStr != nil {
+			return fmt.Errorf("variant block is invalid: %s", *errStr)
+		}
+		if variants[v.Name] {
+			return fmt.Errorf("variant block is invalid: variant %s is declared twice", v.Name)
+		}
+		variants[v.Name] = true
+	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Second)
 	defer cancel()
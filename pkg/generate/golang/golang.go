@@ -17,6 +17,8 @@ import (
 
 	"github.com/nix-community/go-nix/pkg/nar"
 	"golang.org/x/mod/modfile"
+
+	"github.com/buildsafedev/bsf/pkg/toolchain"
 )
 
 type goModDownload struct {
@@ -58,10 +60,10 @@ func resolveDeps(directory string) ([]*goModDownload, map[string]string, error)
 	var modDownloads []*goModDownload
 	{
 
-		cmd := exec.Command(
+		cmd := toolchain.Check(exec.Command(
 			// nix run nixpkgs#go_1_22 -- mod download --json
 			"nix", "run", "nixpkgs#go_1_22", "--", "mod", "download", "--json",
-		)
+		))
 		cmd.Dir = directory
 		stdout, err := cmd.Output()
 		if err != nil {
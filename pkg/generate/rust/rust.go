@@ -2,14 +2,16 @@ package generate
 
 import (
 	"os/exec"
+
+	"github.com/buildsafedev/bsf/pkg/toolchain"
 )
 
 // GenCargoNix - Generates the Cargo.nix file
 func GenCargoNix() error {
 	// Run the command
-	cmd := exec.Command(
+	cmd := toolchain.Check(exec.Command(
 		"nix", "run", "github:cargo2nix/cargo2nix",
-	)
+	))
 	cmd.Dir = "bsf/"
 	// Execute the command
 	err := cmd.Run()
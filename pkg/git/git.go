@@ -1,11 +1,15 @@
 package git
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
 
 	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
 )
 
 // Add adds the path to the git work tree
@@ -96,3 +100,170 @@ func Ignore(path string) error {
 
 	return nil
 }
+
+// CurrentTag returns the tag pointing at HEAD
+func CurrentTag() (string, error) {
+	r, err := git.PlainOpenWithOptions(".", &git.PlainOpenOptions{DetectDotGit: true})
+	if err != nil {
+		return "", err
+	}
+
+	head, err := r.Head()
+	if err != nil {
+		return "", err
+	}
+
+	tags, err := r.Tags()
+	if err != nil {
+		return "", err
+	}
+	defer tags.Close()
+
+	for {
+		ref, err := tags.Next()
+		if err != nil {
+			break
+		}
+
+		hash := ref.Hash()
+		// annotated tags point to a tag object rather than the commit
+		if tag, err := r.TagObject(hash); err == nil {
+			commit, err := tag.Commit()
+			if err != nil {
+				continue
+			}
+			hash = commit.Hash
+		}
+
+		if hash == head.Hash() {
+			return ref.Name().Short(), nil
+		}
+	}
+
+	return "", fmt.Errorf("no tag points at HEAD")
+}
+
+// Describe describes HEAD as git describe --tags does: the nearest tag reachable from HEAD, followed by the number of
+// commits since the tag and the abbreviated hash of HEAD when the tag doesn't point at it. Ex: v1.2.0-3-g1a2b3c4
+func Describe() (string, error) {
+	r, err := git.PlainOpenWithOptions(".", &git.PlainOpenOptions{DetectDotGit: true})
+	if err != nil {
+		return "", err
+	}
+
+	head, err := r.Head()
+	if err != nil {
+		return "", err
+	}
+
+	tags, err := r.Tags()
+	if err != nil {
+		return "", err
+	}
+	defer tags.Close()
+
+	tagged := make(map[plumbing.Hash]string)
+	err = tags.ForEach(func(ref *plumbing.Reference) error {
+		hash := ref.Hash()
+		// annotated tags point to a tag object rather than the commit
+		if tag, err := r.TagObject(hash); err == nil {
+			commit, err := tag.Commit()
+			if err != nil {
+				return nil
+			}
+			hash = commit.Hash
+		}
+		// commits with several tags are described by the greatest, e.g. v1.1.0 rather than v1.1.0-rc2
+		if name := ref.Name().Short(); name > tagged[hash] {
+			tagged[hash] = name
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	if len(tagged) == 0 {
+		return "", fmt.Errorf("the repository has no tags")
+	}
+
+	commits, err := r.Log(&git.LogOptions{From: head.Hash(), Order: git.LogOrderBSF})
+	if err != nil {
+		return "", err
+	}
+	defer commits.Close()
+
+	var tag string
+	distance := 0
+	err = commits.ForEach(func(c *object.Commit) error {
+		if name, ok := tagged[c.Hash]; ok {
+			tag = name
+			return storer.ErrStop
+		}
+		distance++
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	if tag == "" {
+		return "", fmt.Errorf("no tag is reachable from HEAD")
+	}
+	if distance == 0 {
+		return tag, nil
+	}
+
+	return fmt.Sprintf("%s-%d-g%s", tag, distance, head.Hash().String()[:7]), nil
+}
+
+// RemoteURL returns the first URL of the remote
+func RemoteURL(name string) (string, error) {
+	r, err := git.PlainOpenWithOptions(".", &git.PlainOpenOptions{DetectDotGit: true})
+	if err != nil {
+		return "", err
+	}
+
+	remote, err := r.Remote(name)
+	if err != nil {
+		return "", err
+	}
+
+	urls := remote.Config().URLs
+	if len(urls) == 0 {
+		return "", fmt.Errorf("remote %s has no URL", name)
+	}
+
+	return urls[0], nil
+}
+
+// HeadCommit returns the hash of the commit HEAD points at
+func HeadCommit() (string, error) {
+	r, err := git.PlainOpenWithOptions(".", &git.PlainOpenOptions{DetectDotGit: true})
+	if err != nil {
+		return "", err
+	}
+
+	head, err := r.Head()
+	if err != nil {
+		return "", err
+	}
+
+	return head.Hash().String(), nil
+}
+
+// CurrentBranch returns the short name of the branch HEAD is on
+func CurrentBranch() (string, error) {
+	r, err := git.PlainOpenWithOptions(".", &git.PlainOpenOptions{DetectDotGit: true})
+	if err != nil {
+		return "", err
+	}
+
+	head, err := r.Head()
+	if err != nil {
+		return "", err
+	}
+	if !head.Name().IsBranch() {
+		return "", fmt.Errorf("HEAD is detached")
+	}
+
+	return head.Name().Short(), nil
+}
@@ -0,0 +1,30 @@
+package githubrelease
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	bio "github.com/buildsafedev/bsf/pkg/io"
+)
+
+// Checksums returns the contents of a SHA256SUMS file for the files, keyed by their asset name
+func Checksums(files map[string]string) (string, error) {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var sb strings.Builder
+	for _, name := range names {
+		sum, err := bio.FileSHA256(files[name])
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&sb, "%s  %s\n", sum, filepath.Base(name))
+	}
+
+	return sb.String(), nil
+}
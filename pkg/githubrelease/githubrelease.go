@@ -0,0 +1,217 @@
+package githubrelease
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// ErrNotFound is returned when the release does not exist
+var ErrNotFound = errors.New("release not found")
+
+// Client is a client for the GitHub Releases API
+type Client struct {
+	BaseURL    string
+	UploadURL  string
+	Token      string
+	HTTPClient *http.Client
+}
+
+// Release is a GitHub release
+type Release struct {
+	ID      int64   `json:"id"`
+	TagName string  `json:"tag_name"`
+	Name    string  `json:"name"`
+	Draft   bool    `json:"draft"`
+	HTMLURL string  `json:"html_url"`
+	Assets  []Asset `json:"assets"`
+}
+
+// Asset is a file attached to a release
+type Asset struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+}
+
+// NewClient creates a new client authenticated with GITHUB_TOKEN
+func NewClient() (*Client, error) {
+	token := os.Getenv("GITHUB_TOKEN")
+	if token == "" {
+		return nil, fmt.Errorf("GITHUB_TOKEN is not set")
+	}
+
+	return &Client{
+		BaseURL:   "https://api.github.com",
+		UploadURL: "https://uploads.github.com",
+		Token:     token,
+		HTTPClient: &http.Client{
+			Timeout: 10 * time.Minute,
+		},
+	}, nil
+}
+
+// GetByTag returns the release for the tag
+func (c *Client) GetByTag(ctx context.Context, repo, tag string) (*Release, error) {
+	release := &Release{}
+	err := c.do(ctx, http.MethodGet, fmt.Sprintf("%s/repos/%s/releases/tags/%s", c.BaseURL, repo, url.PathEscape(tag)), nil, "", release)
+	if err != nil {
+		return nil, err
+	}
+	return release, nil
+}
+
+// DraftByTag returns the draft release for the tag. Drafts have no tag yet, GetByTag doesn't find them, the
+// releases of the repository are listed instead.
+func (c *Client) DraftByTag(ctx context.Context, repo, tag string) (*Release, error) {
+	const perPage = 100
+	for page := 1; ; page++ {
+		var releases []*Release
+		err := c.do(ctx, http.MethodGet, fmt.Sprintf("%s/repos/%s/releases?per_page=%d&page=%d", c.BaseURL, repo, perPage, page), nil, "", &releases)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range releases {
+			if r.Draft && r.TagName == tag {
+				return r, nil
+			}
+		}
+		if len(releases) < perPage {
+			return nil, ErrNotFound
+		}
+	}
+}
+
+// Create creates a release for the tag
+func (c *Client) Create(ctx context.Context, repo, tag string, draft bool) (*Release, error) {
+	body, err := json.Marshal(map[string]interface{}{
+		"tag_name": tag,
+		"name":     tag,
+		"draft":    draft,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	release := &Release{}
+	err = c.do(ctx, http.MethodPost, fmt.Sprintf("%s/repos/%s/releases", c.BaseURL, repo), bytes.NewReader(body), "application/json", release)
+	if err != nil {
+		return nil, err
+	}
+	return release, nil
+}
+
+// GetOrCreate returns the release or the draft release for the tag, creating it if it does not exist
+func (c *Client) GetOrCreate(ctx context.Context, repo, tag string, draft bool) (*Release, bool, error) {
+	release, err := c.GetByTag(ctx, repo, tag)
+	if errors.Is(err, ErrNotFound) {
+		release, err = c.DraftByTag(ctx, repo, tag)
+	}
+	if err == nil {
+		return release, false, nil
+	}
+	if !errors.Is(err, ErrNotFound) {
+		return nil, false, err
+	}
+
+	release, err = c.Create(ctx, repo, tag, draft)
+	if err != nil {
+		return nil, false, err
+	}
+	return release, true, nil
+}
+
+// Upload uploads the file as an asset of the release, replacing any existing asset with the same name
+func (c *Client) Upload(ctx context.Context, repo string, release *Release, name, path string) error {
+	for _, a := range release.Assets {
+		if a.Name != name {
+			continue
+		}
+		err := c.do(ctx, http.MethodDelete, fmt.Sprintf("%s/repos/%s/releases/assets/%d", c.BaseURL, repo, a.ID), nil, "", nil)
+		if err != nil {
+			return fmt.Errorf("failed to delete existing asset %s: %v", name, err)
+		}
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf("%s/repos/%s/releases/%d/assets?name=%s", c.UploadURL, repo, release.ID, url.QueryEscape(name)), f)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = info.Size()
+	req.Header.Set("Content-Type", "application/octet-stream")
+
+	return c.send(req, nil)
+}
+
+func (c *Client) do(ctx context.Context, method, u string, body io.Reader, contentType string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	return c.send(req, v)
+}
+
+func (c *Client) send(req *http.Request, v interface{}) error {
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("Authorization", "Bearer "+c.Token)
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return ErrNotFound
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("GitHub API returned %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+
+	if v == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// RepoFromRemote returns owner/repo from a GitHub remote URL
+func RepoFromRemote(remote string) (string, error) {
+	remote = strings.TrimSuffix(remote, ".git")
+
+	switch {
+	case strings.HasPrefix(remote, "git@github.com:"):
+		remote = strings.TrimPrefix(remote, "git@github.com:")
+	case strings.Contains(remote, "github.com/"):
+		remote = remote[strings.Index(remote, "github.com/")+len("github.com/"):]
+	default:
+		return "", fmt.Errorf("%s is not a GitHub remote", remote)
+	}
+
+	parts := strings.Split(strings.Trim(remote, "/"), "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", fmt.Errorf("invalid GitHub repository %s", remote)
+	}
+	return parts[0] + "/" + parts[1], nil
+}
@@ -0,0 +1,109 @@
+package githubrelease
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRepoFromRemote(t *testing.T) {
+	tests := []struct {
+		remote  string
+		want    string
+		wantErr bool
+	}{
+		{remote: "https://github.com/buildsafedev/bsf.git", want: "buildsafedev/bsf"},
+		{remote: "git@github.com:buildsafedev/bsf.git", want: "buildsafedev/bsf"},
+		{remote: "ssh://git@github.com/buildsafedev/bsf", want: "buildsafedev/bsf"},
+		{remote: "https://gitlab.com/buildsafedev/bsf.git", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.remote, func(t *testing.T) {
+			got, err := RepoFromRemote(tt.remote)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("RepoFromRemote() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("RepoFromRemote() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetOrCreate(t *testing.T) {
+	created := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/repos/o/r/releases/tags/v1.0.0":
+			w.WriteHeader(http.StatusNotFound)
+		case r.Method == http.MethodGet && r.URL.Path == "/repos/o/r/releases":
+			_ = json.NewEncoder(w).Encode([]Release{{ID: 2, TagName: "v0.9.0", Draft: true}})
+		case r.Method == http.MethodPost && r.URL.Path == "/repos/o/r/releases":
+			created = true
+			_ = json.NewEncoder(w).Encode(Release{ID: 1, TagName: "v1.0.0"})
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer srv.Close()
+
+	c := &Client{BaseURL: srv.URL, UploadURL: srv.URL, Token: "t", HTTPClient: srv.Client()}
+	release, isNew, err := c.GetOrCreate(context.Background(), "o/r", "v1.0.0", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !created || !isNew || release.ID != 1 {
+		t.Errorf("GetOrCreate() = %+v, %v, want a newly created release", release, isNew)
+	}
+}
+
+func TestGetOrCreateDraft(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/repos/o/r/releases/tags/v1.0.0":
+			w.WriteHeader(http.StatusNotFound)
+		case r.Method == http.MethodGet && r.URL.Path == "/repos/o/r/releases" && r.URL.Query().Get("page") == "1":
+			releases := make([]Release, 100)
+			for i := range releases {
+				releases[i] = Release{ID: int64(10 + i), TagName: "v0.1.0"}
+			}
+			_ = json.NewEncoder(w).Encode(releases)
+		case r.Method == http.MethodGet && r.URL.Path == "/repos/o/r/releases" && r.URL.Query().Get("page") == "2":
+			_ = json.NewEncoder(w).Encode([]Release{{ID: 3, TagName: "v1.0.0", Draft: true}})
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer srv.Close()
+
+	c := &Client{BaseURL: srv.URL, UploadURL: srv.URL, Token: "t", HTTPClient: srv.Client()}
+	release, isNew, err := c.GetOrCreate(context.Background(), "o/r", "v1.0.0", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if isNew || release.ID != 3 {
+		t.Errorf("GetOrCreate() = %+v, %v, want the existing draft", release, isNew)
+	}
+}
+
+func TestChecksums(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "hello")
+	if err := os.WriteFile(path, []byte("hello\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := Checksums(map[string]string{"hello-linux-amd64": path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "5891b5b522d5df086d0ff0b110fbd9d21bb4fc7163af34d08286a2e846f6be03  hello-linux-amd64\n"
+	if got != want {
+		t.Errorf("Checksums() = %q, want %q", got, want)
+	}
+}
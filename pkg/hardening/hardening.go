@@ -0,0 +1,247 @@
+// Package hardening analyzes the executables of a build result for their security relevant attributes: setuid and
+// setgid bits, the capabilities they request, the exploit mitigations they were linked with (PIE, RELRO, NX, stack
+// protector, FORTIFY_SOURCE) and the TLS library they use, loaded or linked in. The policy of bsf.hcl can require
+// mitigations, see package policy.
+package hardening
+
+import (
+	"debug/elf"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/buildsafedev/bsf/pkg/loader"
+	nixcmd "github.com/buildsafedev/bsf/pkg/nix/cmd"
+)
+
+// ReportName is the name of the hardening report in the output directory
+const ReportName = "hardening.json"
+
+// RELRO levels
+const (
+	RELRONone    = "none"
+	RELROPartial = "partial"
+	RELROFull    = "full"
+)
+
+// Binary is the analysis of an executable of the result
+type Binary struct {
+	// Path is the path of the executable in the result, File the file it resolves to
+	Path string `json:"path"`
+	File string `json:"file"`
+	// Static is true for executables without a dynamic loader
+	Static bool `json:"static"`
+	PIE    bool `json:"pie"`
+	// RELRO is none, partial (read-only relocations) or full (with immediate binding)
+	RELRO          string `json:"relro"`
+	NX             bool   `json:"nx"`
+	StackProtector bool   `json:"stackProtector"`
+	Fortify        bool   `json:"fortify"`
+	// Go is true for Go executables, their runtime checks bounds rather than using C mitigations
+	Go           bool         `json:"go,omitempty"`
+	Setuid       bool         `json:"setuid,omitempty"`
+	Setgid       bool         `json:"setgid,omitempty"`
+	Capabilities []string     `json:"capabilities,omitempty"`
+	TLS          []TLSLibrary `json:"tls,omitempty"`
+}
+
+// TLSLibrary is a TLS library an executable loads or is linked with
+type TLSLibrary struct {
+	// Library is the soname of a shared library, or the name of a library linked in, e.g. crypto/tls
+	Library string `json:"library"`
+	// StorePath is the store path of a shared library
+	StorePath string `json:"storePath,omitempty"`
+}
+
+// Report is the analysis of the executables of the results of a build
+type Report struct {
+	Binaries []Binary `json:"binaries"`
+}
+
+// tlsSonames are the prefixes of the sonames of TLS libraries
+var tlsSonames = []string{"libssl.so", "libgnutls.so", "libmbedtls.so", "libwolfssl.so", "libnss3.so", "libs2n.so", "libtls.so", "libbearssl.so"}
+
+// tlsSymbols are symbols of TLS libraries linked into executables, by the library they belong to
+var tlsSymbols = []struct {
+	prefix, library string
+}{
+	{"crypto/tls.", "crypto/tls"},
+	{"_ZN6rustls", "rustls"},
+	{"SSL_CTX_new", "openssl"},
+	{"mbedtls_ssl_setup", "mbedtls"},
+}
+
+// Analyze analyzes the executables of the bin and sbin directories of the results. Scripts, such as nix wrappers,
+// aren't analyzed: the executables they run are in the same directories.
+func Analyze(results ...string) *Report {
+	report := &Report{Binaries: make([]Binary, 0)}
+	seen := make(map[string]bool)
+	for _, result := range results {
+		for _, dir := range []string{"bin", "sbin"} {
+			entries, err := os.ReadDir(nixcmd.HostPath(filepath.Join(result, dir)))
+			if err != nil {
+				continue
+			}
+			for _, e := range entries {
+				path := filepath.Join(result, dir, e.Name())
+				file, err := nixcmd.EvalSymlinks(path)
+				if err != nil || seen[file] {
+					continue
+				}
+				seen[file] = true
+				if b, ok := AnalyzeBinary(path, file); ok {
+					report.Binaries = append(report.Binaries, *b)
+				}
+			}
+		}
+	}
+	sort.Slice(report.Binaries, func(i, j int) bool { return report.Binaries[i].Path < report.Binaries[j].Path })
+	return report
+}
+
+// AnalyzeBinary analyzes the executable file of the path, it returns false for files that aren't ELF executables
+func AnalyzeBinary(path, file string) (*Binary, bool) {
+	f, err := elf.Open(nixcmd.HostPath(file))
+	if err != nil {
+		return nil, false
+	}
+	defer f.Close()
+	if f.Type != elf.ET_EXEC && f.Type != elf.ET_DYN {
+		return nil, false
+	}
+
+	b := &Binary{Path: path, File: file, RELRO: RELRONone}
+	hasInterp, relro := false, false
+	for _, p := range f.Progs {
+		switch p.Type {
+		case elf.PT_INTERP:
+			hasInterp = true
+		case elf.PT_GNU_RELRO:
+			relro = true
+		case elf.PT_GNU_STACK:
+			b.NX = p.Flags&elf.PF_X == 0
+		}
+	}
+	flags, flags1 := dynValue(f, elf.DT_FLAGS), dynValue(f, elf.DT_FLAGS_1)
+	b.Static = !hasInterp
+	// shared libraries are ET_DYN too, executables have an interpreter or are static-pie
+	b.PIE = f.Type == elf.ET_DYN && (hasInterp || flags1&uint64(elf.DF_1_PIE) != 0)
+	if relro {
+		b.RELRO = RELROPartial
+		bindNow := len(dynValues(f, elf.DT_BIND_NOW)) > 0 || flags&uint64(elf.DF_BIND_NOW) != 0 || flags1&uint64(elf.DF_1_NOW) != 0
+		if bindNow {
+			b.RELRO = RELROFull
+		}
+	}
+	b.Go = f.Section(".go.buildinfo") != nil
+
+	symbols, _ := f.Symbols()
+	dynamic, _ := f.DynamicSymbols()
+	linked := make(map[string]bool)
+	for _, s := range append(symbols, dynamic...) {
+		switch {
+		case strings.HasPrefix(s.Name, "__stack_chk_"):
+			b.StackProtector = true
+		case strings.HasPrefix(s.Name, "__") && strings.HasSuffix(s.Name, "_chk"):
+			b.Fortify = true
+		}
+		if s.Section == elf.SHN_UNDEF {
+			continue
+		}
+		for _, t := range tlsSymbols {
+			if strings.HasPrefix(s.Name, t.prefix) && !linked[t.library] {
+				linked[t.library] = true
+				b.TLS = append(b.TLS, TLSLibrary{Library: t.library})
+			}
+		}
+	}
+	if !b.Static {
+		b.TLS = append(b.TLS, loadedTLS(file)...)
+	}
+
+	if fi, err := os.Stat(nixcmd.HostPath(file)); err == nil {
+		b.Setuid = fi.Mode()&os.ModeSetuid != 0
+		b.Setgid = fi.Mode()&os.ModeSetgid != 0
+	}
+	b.Capabilities = fileCapabilities(nixcmd.HostPath(file))
+	return b, true
+}
+
+// loadedTLS returns the TLS libraries the dynamic loader loads for the executable
+func loadedTLS(file string) []TLSLibrary {
+	libs := make([]TLSLibrary, 0)
+	for path := range loader.Simulate([]string{file}).Loaded {
+		base := filepath.Base(path)
+		for _, soname := range tlsSonames {
+			if strings.HasPrefix(base, soname) {
+				libs = append(libs, TLSLibrary{Library: base, StorePath: loader.StorePath(path)})
+				break
+			}
+		}
+	}
+	sort.Slice(libs, func(i, j int) bool { return libs[i].Library < libs[j].Library })
+	return libs
+}
+
+func dynValues(f *elf.File, tag elf.DynTag) []uint64 {
+	values, err := f.DynValue(tag)
+	if err != nil {
+		return nil
+	}
+	return values
+}
+
+func dynValue(f *elf.File, tag elf.DynTag) uint64 {
+	var v uint64
+	for _, value := range dynValues(f, tag) {
+		v |= value
+	}
+	return v
+}
+
+// capabilityNames are the names of the capabilities, by bit
+var capabilityNames = []string{
+	"cap_chown", "cap_dac_override", "cap_dac_read_search", "cap_fowner", "cap_fsetid", "cap_kill", "cap_setgid",
+	"cap_setuid", "cap_setpcap", "cap_linux_immutable", "cap_net_bind_service", "cap_net_broadcast", "cap_net_admin",
+	"cap_net_raw", "cap_ipc_lock", "cap_ipc_owner", "cap_sys_module", "cap_sys_rawio", "cap_sys_chroot",
+	"cap_sys_ptrace", "cap_sys_pacct", "cap_sys_admin", "cap_sys_boot", "cap_sys_nice", "cap_sys_resource",
+	"cap_sys_time", "cap_sys_tty_config", "cap_mknod", "cap_lease", "cap_audit_write", "cap_audit_control",
+	"cap_setfcap", "cap_mac_override", "cap_mac_admin", "cap_syslog", "cap_wake_alarm", "cap_block_suspend",
+	"cap_audit_read", "cap_perfmon", "cap_bpf", "cap_checkpoint_restore",
+}
+
+// parseCapabilities returns the permitted capabilities of a security.capability extended attribute, a
+// vfs_cap_data structure
+func parseCapabilities(data []byte) []string {
+	if len(data) < 12 {
+		return nil
+	}
+	words := 1
+	if version := binary.LittleEndian.Uint32(data) & 0xff000000; version != 0x01000000 {
+		words = 2
+	}
+	if len(data) < 4+8*words {
+		return nil
+	}
+	caps := make([]string, 0)
+	for w := 0; w < words; w++ {
+		permitted := binary.LittleEndian.Uint32(data[4+8*w:])
+		for bit := 0; bit < 32; bit++ {
+			if permitted&(1<<bit) == 0 {
+				continue
+			}
+			if n := 32*w + bit; n < len(capabilityNames) {
+				caps = append(caps, capabilityNames[n])
+			} else {
+				caps = append(caps, fmt.Sprintf("cap_%d", n))
+			}
+		}
+	}
+	if len(caps) == 0 {
+		return nil
+	}
+	return caps
+}
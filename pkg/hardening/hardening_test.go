@@ -0,0 +1,91 @@
+package hardening
+
+import (
+	"debug/elf"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseCapabilities(t *testing.T) {
+	v2 := make([]byte, 20)
+	binary.LittleEndian.PutUint32(v2[0:], 0x02000001)
+	binary.LittleEndian.PutUint32(v2[4:], 1<<10|1<<13)
+	binary.LittleEndian.PutUint32(v2[12:], 1<<(39-32))
+	v1 := make([]byte, 12)
+	binary.LittleEndian.PutUint32(v1[0:], 0x01000000)
+	binary.LittleEndian.PutUint32(v1[4:], 1<<21)
+
+	tests := []struct {
+		name string
+		data []byte
+		want []string
+	}{
+		{"v2", v2, []string{"cap_net_bind_service", "cap_net_raw", "cap_bpf"}},
+		{"v1", v1, []string{"cap_sys_admin"}},
+		{"none", make([]byte, 20), nil},
+		{"truncated", v2[:8], nil},
+	}
+	for _, tt := range tests {
+		if got := parseCapabilities(tt.data); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: parseCapabilities() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// TestAnalyze analyzes a dynamically linked executable of the host in a result, and the Go test executable
+func TestAnalyze(t *testing.T) {
+	exe := ""
+	for _, p := range []string{"/bin/sh", "/usr/bin/env", "/bin/ls"} {
+		f, err := elf.Open(p)
+		if err != nil {
+			continue
+		}
+		libs, _ := f.ImportedLibraries()
+		f.Close()
+		if len(libs) > 0 {
+			exe = p
+			break
+		}
+	}
+	if exe == "" {
+		t.Skip("no dynamically linked binary on the host")
+	}
+
+	result := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(result, "bin"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(exe, filepath.Join(result, "bin", "tool")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(result, "bin", "wrapper"), []byte("#!/bin/sh\nexec tool\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	r := Analyze(result)
+	if len(r.Binaries) != 1 {
+		t.Fatalf("Analyze() = %+v, want the executable and not the script", r.Binaries)
+	}
+	b := r.Binaries[0]
+	if b.Path != filepath.Join(result, "bin", "tool") || b.Static || b.Go || b.Setuid {
+		t.Errorf("Analyze() = %+v", b)
+	}
+	if b.RELRO != RELRONone && b.RELRO != RELROPartial && b.RELRO != RELROFull {
+		t.Errorf("RELRO = %q", b.RELRO)
+	}
+
+	test, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, ok := AnalyzeBinary(test, test)
+	if !ok || !g.Go {
+		t.Errorf("AnalyzeBinary(%s) = %+v, want a Go executable", test, g)
+	}
+	if _, ok := AnalyzeBinary(filepath.Join(result, "bin", "wrapper"), filepath.Join(result, "bin", "wrapper")); ok {
+		t.Errorf("AnalyzeBinary() analyzed a script")
+	}
+}
@@ -0,0 +1,15 @@
+//go:build linux
+
+package hardening
+
+import "syscall"
+
+// fileCapabilities returns the capabilities the file requests in its security.capability extended attribute
+func fileCapabilities(path string) []string {
+	buf := make([]byte, 64)
+	n, err := syscall.Getxattr(path, "security.capability", buf)
+	if err != nil {
+		return nil
+	}
+	return parseCapabilities(buf[:n])
+}
@@ -0,0 +1,8 @@
+//go:build !linux
+
+package hardening
+
+// fileCapabilities returns no capabilities, file capabilities are a feature of Linux
+func fileCapabilities(path string) []string {
+	return nil
+}
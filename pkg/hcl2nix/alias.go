@@ -0,0 +1,42 @@
+package hcl2nix
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// purlTypes are the package url types an alias can map a nixpkgs package to
+var purlTypes = []string{"nix", "pypi", "npm", "cargo", "golang", "gem", "cpan", "maven", "hackage", "generic"}
+
+var cpeRegex = regexp.MustCompile(`^[a-z0-9_.\-~%]+:[a-z0-9_.\-~%]+$`)
+
+// Alias maps a nixpkgs package name to its upstream name, used in the package urls and CPEs of the SBOM.
+// It extends the aliases bsf embeds, e.g. for packages of private overlays.
+type Alias struct {
+	// Pname is the name of the package in nixpkgs, as in its store path. Ex: python3.11-mylib
+	Pname string `hcl:"pname,label" json:"pname"`
+	// Name is the upstream name of the package. Ex: mylib
+	Name string `hcl:"name,optional" json:"name,omitempty"`
+	// Type is the package url type of the ecosystem of the package. Ex: pypi
+	Type string `hcl:"type,optional" json:"type,omitempty"`
+	// Namespace is the package url namespace, e.g. the group of maven packages
+	Namespace string `hcl:"namespace,optional" json:"namespace,omitempty"`
+	// CPE is the vendor and product of the CPE of the package. Ex: acme:mylib
+	CPE string `hcl:"cpe,optional" json:"cpe,omitempty"`
+}
+
+// Validate validates Alias
+func (a *Alias) Validate() *string {
+	if a.Name == "" && a.CPE == "" {
+		return pointerTo(fmt.Sprintf("alias %s must set the name or the cpe of the package", a.Pname))
+	}
+	if a.Type != "" && !slices.Contains(purlTypes, a.Type) {
+		return pointerTo(fmt.Sprintf("alias %s has an unsupported type %s, use one of %s", a.Pname, a.Type, strings.Join(purlTypes, ", ")))
+	}
+	if a.CPE != "" && !cpeRegex.MatchString(a.CPE) {
+		return pointerTo(fmt.Sprintf("the cpe of alias %s must be vendor:product, in lower case", a.Pname))
+	}
+	return nil
+}
@@ -21,6 +21,15 @@ type Config struct {
 	JsNpmApp    *JsNpmApp     `hcl:"jsnpmapp,block"`
 	OCIArtifact []OCIArtifact `hcl:"oci,block"`
 	ConfigFiles []ConfigFiles `hcl:"config,block"`
+	Signing     *Signing      `hcl:"signing,block"`
+	Product     *Product      `hcl:"product,block"`
+	Redactions  []Redaction   `hcl:"redaction,block"`
+	Aliases     []Alias       `hcl:"alias,block"`
+	Exemptions  []Exemption   `hcl:"exemption,block"`
+	Policy      *Policy       `hcl:"policy,block"`
+	Requires    []Requirement `hcl:"requires,block"`
+	Retention   *Retention    `hcl:"retention,block"`
+	Variants    []Variant     `hcl:"variant,block"`
 }
 
 // Packages holds package parameters
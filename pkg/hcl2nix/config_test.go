@@ -5,6 +5,7 @@ import (
 	"io"
 	"slices"
 	"testing"
+	"time"
 
 	bstrings "github.com/buildsafedev/bsf/pkg/strings"
 	"github.com/buildsafedev/bsf/pkg/update"
@@ -164,3 +165,476 @@ func TestPreferNewElemenets(t *testing.T) {
 		})
 	}
 }
+
+func TestReadConfigProduct(t *testing.T) {
+	src := []byte(`
+packages {
+  development = []
+  runtime     = []
+}
+
+product {
+  name          = "Acme Billing"
+  vendor        = "Acme Inc."
+  icon          = "https://acme.example/icon.png"
+  documentation = "https://docs.acme.example/billing"
+}
+`)
+	config, err := ReadConfig(src, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Product == nil || config.Product.Vendor != "Acme Inc." {
+		t.Fatalf("product block not read: %+v", config.Product)
+	}
+	if errStr := config.Product.Validate(); errStr != nil {
+		t.Errorf("unexpected validation error %s", *errStr)
+	}
+
+	annotations := config.Product.Annotations()
+	want := map[string]string{
+		"org.opencontainers.image.title":         "Acme Billing",
+		"org.opencontainers.image.vendor":        "Acme Inc.",
+		"org.opencontainers.image.documentation": "https://docs.acme.example/billing",
+		IconAnnotation:                           "https://acme.example/icon.png",
+	}
+	if len(annotations) != len(want) {
+		t.Errorf("Annotations() = %v, want %v", annotations, want)
+	}
+	for k, v := range want {
+		if annotations[k] != v {
+			t.Errorf("annotation %s = %q, want %q", k, annotations[k], v)
+		}
+	}
+
+	config.Product.Icon = "icon.png"
+	if config.Product.Validate() == nil {
+		t.Errorf("expected a relative icon to be rejected")
+	}
+}
+
+func TestReadConfigRegistries(t *testing.T) {
+	src := []byte(`
+packages {
+  development = []
+  runtime     = []
+}
+
+oci "pkgs" {
+  name = "registry.acme.internal/billing:v1"
+
+  registry "customers" {
+    repository = "ghcr.io/acme/billing"
+    tags       = ["{tag}", "latest"]
+    redact     = "customer"
+    key        = "keys/customers.pem"
+  }
+}
+
+redaction "customer" {
+  hosts    = ["acme.internal"]
+  comments = ["internal-id:"]
+}
+`)
+	config, err := ReadConfig(src, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(config.OCIArtifact) != 1 || len(config.OCIArtifact[0].Registries) != 1 {
+		t.Fatalf("registry block not read: %+v", config.OCIArtifact)
+	}
+	oci := config.OCIArtifact[0]
+	if errStr := oci.Validate(config); errStr != nil {
+		t.Errorf("unexpected validation error %s", *errStr)
+	}
+
+	tests := []struct {
+		name   string
+		modify func(r *Registry)
+	}{
+		{name: "unknown redaction", modify: func(r *Registry) { r.Redact = "partners" }},
+		{name: "repository with a tag", modify: func(r *Registry) { r.Repository = "ghcr.io/acme/billing:v1" }},
+		{name: "invalid tag", modify: func(r *Registry) { r.Tags = []string{"v1:latest"} }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := oci.Registries[0]
+			tt.modify(&r)
+			if r.Validate(config) == nil {
+				t.Errorf("expected the registry to be rejected")
+			}
+		})
+	}
+}
+
+func TestReadConfigAliases(t *testing.T) {
+	src := []byte(`
+packages {
+  development = []
+  runtime     = []
+}
+
+alias "python3.11-acme-client" {
+  name = "acme-client"
+  type = "pypi"
+}
+
+alias "libacme" {
+  cpe = "acme:libacme"
+}
+`)
+	config, err := ReadConfig(src, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(config.Aliases) != 2 || config.Aliases[0].Pname != "python3.11-acme-client" || config.Aliases[1].CPE != "acme:libacme" {
+		t.Fatalf("alias blocks not read: %+v", config.Aliases)
+	}
+	for _, a := range config.Aliases {
+		if errStr := a.Validate(); errStr != nil {
+			t.Errorf("unexpected validation error %s", *errStr)
+		}
+	}
+
+	tests := []struct {
+		name  string
+		alias Alias
+	}{
+		{name: "nothing mapped", alias: Alias{Pname: "libacme"}},
+		{name: "unknown type", alias: Alias{Pname: "libacme", Name: "acme", Type: "apt"}},
+		{name: "cpe without vendor", alias: Alias{Pname: "libacme", CPE: "libacme"}},
+		{name: "cpe in upper case", alias: Alias{Pname: "libacme", CPE: "Acme:LibAcme"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if errStr := tt.alias.Validate(); errStr == nil {
+				t.Errorf("expected %+v to be invalid", tt.alias)
+			}
+		})
+	}
+}
+
+func TestExemptionBlocks(t *testing.T) {
+	src := []byte(`
+packages {
+  development = []
+  runtime     = []
+}
+
+exemption "openssl" {
+  version = "1.1.1w"
+  reason  = "SEC-1234, legacy client"
+  expires = "2026-12-31"
+}
+
+exemption "zlib" {
+  reason = "SEC-1300"
+}
+`)
+	config, err := ReadConfig(src, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(config.Exemptions) != 2 || config.Exemptions[0].Name != "openssl" || config.Exemptions[1].Version != "" {
+		t.Fatalf("exemption blocks not read: %+v", config.Exemptions)
+	}
+	for _, e := range config.Exemptions {
+		if errStr := e.Validate(); errStr != nil {
+			t.Errorf("unexpected validation error %s", *errStr)
+		}
+	}
+	for _, e := range []Exemption{{Name: "zlib"}, {Name: "zlib", Reason: "SEC-1300", Expires: "31/12/2026"}} {
+		if errStr := e.Validate(); errStr == nil {
+			t.Errorf("expected %+v to be invalid", e)
+		}
+	}
+
+	openssl := config.Exemptions[0]
+	lastDay := time.Date(2026, 12, 31, 23, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name, version string
+		now           time.Time
+		want          bool
+	}{
+		{"openssl", "1.1.1w", lastDay, true},
+		{"openssl", "1.1.1w", lastDay.Add(2 * time.Hour), false},
+		{"openssl", "3.0.13", lastDay, false},
+		{"zlib", "1.1.1w", lastDay, false},
+	}
+	for _, tt := range tests {
+		if got := openssl.Applies(tt.name, tt.version, tt.now); got != tt.want {
+			t.Errorf("Applies(%s, %s, %s) = %v, want %v", tt.name, tt.version, tt.now, got, tt.want)
+		}
+	}
+	if !config.Exemptions[1].Applies("zlib", "1.3", lastDay.AddDate(10, 0, 0)) {
+		t.Error("the exemption of all versions of zlib doesn't apply")
+	}
+}
+
+func TestPolicyBlock(t *testing.T) {
+	src := []byte(`
+packages {
+  development = []
+  runtime     = []
+}
+
+policy {
+  denied_licenses  = ["AGPL-3.0-only"]
+  max_closure_size = "1.5GiB"
+  max_paths        = 400
+
+  ban "openssl" {
+    versions = "<3"
+    reason   = "end of life"
+  }
+
+  hardening {
+    require_pie          = true
+    require_relro        = "full"
+    deny_capabilities    = true
+    allowed_capabilities = ["cap_net_bind_service"]
+  }
+
+  ignore "openssl" {
+    rule    = "banned-package"
+    version = "1.1.1w"
+    owner   = "security@example.com"
+    expires = "2025-12-31"
+  }
+}
+`)
+	config, err := ReadConfig(src, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := config.Policy
+	if p == nil || len(p.Bans) != 1 || p.Bans[0].Name != "openssl" || p.MaxPaths != 400 {
+		t.Fatalf("policy block not read: %+v", p)
+	}
+	if errStr := p.Validate(); errStr != nil {
+		t.Errorf("unexpected validation error %s", *errStr)
+	}
+	if len(p.Ignores) != 1 || p.Ignores[0].Owner != "security@example.com" || !p.Ignores[0].Matches("banned-package", "openssl", "1.1.1w") {
+		t.Errorf("ignore block not read: %+v", p.Ignores)
+	}
+	if h := p.Hardening; h == nil || !h.RequirePIE || h.RequireRELRO != "full" || !h.DenyCapabilities || len(h.AllowedCapabilities) != 1 {
+		t.Errorf("hardening block not read: %+v", h)
+	}
+	if n, err := p.MaxClosureBytes(); err != nil || n != 3<<29 {
+		t.Errorf("MaxClosureBytes() = %d, %v, want %d", n, err, 3<<29)
+	}
+
+	for _, invalid := range []Policy{
+		{MaxClosureSize: "512"},
+		{MaxClosureSize: "-1MB"},
+		{MaxPaths: -1},
+		{AllowedLicenses: []string{"MIT"}, DeniedLicenses: []string{"MIT"}},
+		{Ignores: []Ignore{{Component: "openssl", Rule: "banned", Owner: "me", Expires: "2025-12-31"}}},
+		{Ignores: []Ignore{{Component: "openssl", Rule: "banned-package", Expires: "2025-12-31"}}},
+		{Ignores: []Ignore{{Component: "openssl", Rule: "banned-package", Owner: "me", Expires: "31/12/2025"}}},
+		{Hardening: &Hardening{RequireRELRO: "yes"}},
+		{Hardening: &Hardening{AllowedCapabilities: []string{"NET_BIND_SERVICE"}}},
+	} {
+		if errStr := invalid.Validate(); errStr == nil {
+			t.Errorf("expected %+v to be invalid", invalid)
+		}
+	}
+}
+
+func TestReadConfigRequires(t *testing.T) {
+	src := []byte(`
+packages {
+  development = []
+  runtime     = []
+}
+
+requires "postgres" {
+  version     = ">= 14, < 17"
+  description = "primary database"
+}
+
+requires "stripe" {
+  kind = "service"
+  url  = "https://api.stripe.com"
+}
+`)
+	config, err := ReadConfig(src, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(config.Requires) != 2 {
+		t.Fatalf("requires blocks not read: %+v", config.Requires)
+	}
+	for _, r := range config.Requires {
+		if errStr := r.Validate(); errStr != nil {
+			t.Errorf("unexpected validation error %s", *errStr)
+		}
+	}
+	if kind := config.Requires[0].KindOrDefault(); kind != RequirementPackage {
+		t.Errorf("KindOrDefault() = %s, want %s", kind, RequirementPackage)
+	}
+
+	tests := []struct {
+		name string
+		r    Requirement
+	}{
+		{name: "unknown kind", r: Requirement{Name: "redis", Kind: "database"}},
+		{name: "invalid constraint", r: Requirement{Name: "redis", Version: ">= "}},
+		{name: "relative url", r: Requirement{Name: "stripe", URL: "api.stripe.com"}},
+	}
+	for _, tt := range tests {
+		if tt.r.Validate() == nil {
+			t.Errorf("%s: expected the requirement to be rejected", tt.name)
+		}
+	}
+}
+
+func TestReadConfigEndpoints(t *testing.T) {
+	src := []byte(`
+packages {
+  development = []
+  runtime     = []
+}
+
+oci "pkgs" {
+  name         = "ttl.sh/acme/billing:v1"
+  exposedPorts = ["8443/tcp", "9090/tcp"]
+
+  endpoint "public-api" {
+    port          = "8443/tcp"
+    protocol      = "https"
+    path          = "/v1"
+    authenticated = true
+    public        = true
+  }
+}
+`)
+	config, err := ReadConfig(src, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oci := config.OCIArtifact[0]
+	if errStr := oci.Validate(config); errStr != nil {
+		t.Fatalf("unexpected validation error %s", *errStr)
+	}
+
+	services := oci.Services()
+	if len(services) != 2 {
+		t.Fatalf("Services() = %+v, want the endpoint and the other exposed port", services)
+	}
+	if u := services[0].URL(); u != "https://0.0.0.0:8443/v1" {
+		t.Errorf("URL() = %s, want https://0.0.0.0:8443/v1", u)
+	}
+	if services[1].Name != "port-9090-tcp" || services[1].URL() != "tcp://0.0.0.0:9090" {
+		t.Errorf("service of the exposed port = %s %s, want port-9090-tcp tcp://0.0.0.0:9090", services[1].Name, services[1].URL())
+	}
+
+	tests := []struct {
+		name   string
+		modify func(e *Endpoint)
+	}{
+		{name: "port not exposed", modify: func(e *Endpoint) { e.Port = "80/tcp" }},
+		{name: "invalid protocol", modify: func(e *Endpoint) { e.Protocol = "HTTP/2" }},
+		{name: "relative path", modify: func(e *Endpoint) { e.Path = "v1" }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := oci
+			c.Endpoints = []Endpoint{oci.Endpoints[0]}
+			tt.modify(&c.Endpoints[0])
+			if c.Validate(config) == nil {
+				t.Errorf("expected the endpoint to be rejected")
+			}
+		})
+	}
+}
+
+func TestReadConfigRetention(t *testing.T) {
+	src := []byte(`
+packages {
+  development = []
+  runtime     = []
+}
+
+retention {
+  keep_builds = 10
+  max_age     = "90d"
+  registry    = true
+}
+`)
+	config, err := ReadConfig(src, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Retention == nil {
+		t.Fatal("retention block not read")
+	}
+	if errStr := config.Retention.Validate(); errStr != nil {
+		t.Fatalf("unexpected validation error %s", *errStr)
+	}
+	if age, _ := config.Retention.MaxAgeDuration(); age != 90*24*time.Hour {
+		t.Errorf("MaxAgeDuration() = %s, want 2160h", age)
+	}
+
+	tests := []struct {
+		name string
+		r    Retention
+	}{
+		{name: "empty", r: Retention{Registry: true}},
+		{name: "negative keep_builds", r: Retention{KeepBuilds: -1}},
+		{name: "no unit", r: Retention{MaxAge: "90"}},
+		{name: "unknown unit", r: Retention{MaxAge: "3m"}},
+		{name: "zero", r: Retention{MaxAge: "0d"}},
+	}
+	for _, tt := range tests {
+		if tt.r.Validate() == nil {
+			t.Errorf("%s: expected the retention block to be rejected", tt.name)
+		}
+	}
+}
+
+func TestReadConfigVariants(t *testing.T) {
+	src := []byte(`
+packages {
+  development = []
+  runtime     = []
+}
+
+variant "debug" {
+  attribute = ".#app-debug"
+}
+
+variant "fips" {
+  override       = { openssl = "pkgs.openssl_3_fips" }
+  override_attrs = { tags = "old.tags ++ [ \"fips\" ]" }
+}
+`)
+	config, err := ReadConfig(src, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(config.Variants) != 2 {
+		t.Fatalf("variant blocks not read: %+v", config.Variants)
+	}
+	for _, v := range config.Variants {
+		if errStr := v.Validate(); errStr != nil {
+			t.Errorf("unexpected validation error %s", *errStr)
+		}
+	}
+	if fips := config.Variants[1]; fips.Override["openssl"] != "pkgs.openssl_3_fips" || fips.OverrideAttrs["tags"] != `old.tags ++ [ "fips" ]` {
+		t.Errorf("variant overrides not read: %+v", fips)
+	}
+
+	for _, invalid := range []Variant{
+		{Name: "Debug", Attribute: ".#debug"},
+		{Name: DefaultVariant, Attribute: ".#app"},
+		{Name: "debug"},
+		{Name: "debug", Attribute: ".#debug", Override: map[string]string{"debug": "true"}},
+		{Name: "debug", Override: map[string]string{"with debug": "true"}},
+		{Name: "debug", OverrideAttrs: map[string]string{"dontStrip": ""}},
+	} {
+		if errStr := invalid.Validate(); errStr == nil {
+			t.Errorf("expected %+v to be invalid", invalid)
+		}
+	}
+}
@@ -0,0 +1,239 @@
+package hcl2nix
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// DriftKind is the kind of difference between bsf.hcl and the flake
+type DriftKind string
+
+const (
+	// DriftMissing is an output declared in bsf.hcl that the flake does not provide
+	DriftMissing DriftKind = "missing"
+	// DriftUndeclared is an output the flake provides that bsf.hcl does not declare
+	DriftUndeclared DriftKind = "undeclared"
+	// DriftRenamed is an output declared in bsf.hcl that the flake provides under another name
+	DriftRenamed DriftKind = "renamed"
+	// DriftAppName is an app name in bsf.hcl that differs from the name of the package the flake builds
+	DriftAppName DriftKind = "app name"
+)
+
+// Drift is a difference between bsf.hcl and the outputs of the flake
+type Drift struct {
+	Kind DriftKind
+	// Block is the bsf.hcl block the drift is about, such as oci or config
+	Block string
+	// Declared is the name in bsf.hcl, empty for undeclared outputs
+	Declared string
+	// Actual is the name in the flake, empty for missing outputs
+	Actual string
+}
+
+func (d Drift) String() string {
+	switch d.Kind {
+	case DriftMissing:
+		return fmt.Sprintf("%s %q is declared in bsf.hcl but the flake does not provide it", d.Block, d.Declared)
+	case DriftUndeclared:
+		return fmt.Sprintf("the flake provides %s %q but bsf.hcl does not declare it", d.Block, d.Actual)
+	case DriftRenamed:
+		return fmt.Sprintf("%s %q is declared in bsf.hcl but the flake provides it as %q", d.Block, d.Declared, d.Actual)
+	case DriftAppName:
+		return fmt.Sprintf("app is named %q in bsf.hcl but the flake builds %q", d.Declared, d.Actual)
+	}
+	return string(d.Kind)
+}
+
+// outputBlock maps a flake output to the bsf.hcl block that generates it, with the prefix of its attributes
+type outputBlock struct {
+	output string
+	block  string
+	prefix string
+}
+
+var outputBlocks = []outputBlock{
+	{output: "ociImages", block: "oci", prefix: "ociImage_"},
+	{output: "configs", block: "config", prefix: "config_"},
+}
+
+// declaredNames returns the names of the blocks of bsf.hcl that generate the flake output
+func declaredNames(conf *Config, block string) []string {
+	names := make([]string, 0)
+	switch block {
+	case "oci":
+		for _, a := range conf.OCIArtifact {
+			names = append(names, a.Environment)
+		}
+	case "config":
+		for _, c := range conf.ConfigFiles {
+			names = append(names, c.Name)
+		}
+	}
+	return names
+}
+
+// actualNames returns the names of the blocks the flake output was generated from
+func actualNames(attrs []string, ob outputBlock) []string {
+	names := make([]string, 0)
+	for _, attr := range attrs {
+		// images are also provided as directories, these are not declared separately
+		if ob.block == "oci" && strings.HasSuffix(attr, "-as-dir") {
+			continue
+		}
+		if name, ok := strings.CutPrefix(attr, ob.prefix); ok {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// AppName returns the name of the app declared in bsf.hcl
+func (c *Config) AppName() string {
+	switch {
+	case c.GoModule != nil:
+		return c.GoModule.Name
+	case c.RustApp != nil:
+		return c.RustApp.CrateName
+	case c.JsNpmApp != nil:
+		return c.JsNpmApp.PackageName
+	}
+	// poetry apps are named after pyproject.toml
+	return ""
+}
+
+// DetectDrift compares bsf.hcl with the outputs of the flake, as attribute names by output, and the name of its default package.
+// When a block is missing from the flake and exactly one undeclared output of the same block exists, it is reported as renamed.
+func DetectDrift(conf *Config, outputs map[string][]string, appName string) []Drift {
+	drifts := make([]Drift, 0)
+
+	if declared := conf.AppName(); declared != "" && appName != "" && declared != appName {
+		drifts = append(drifts, Drift{Kind: DriftAppName, Block: "app", Declared: declared, Actual: appName})
+	}
+
+	for _, ob := range outputBlocks {
+		declared := declaredNames(conf, ob.block)
+		actual := actualNames(outputs[ob.output], ob)
+
+		missing := difference(declared, actual)
+		undeclared := difference(actual, declared)
+
+		if len(missing) == 1 && len(undeclared) == 1 {
+			drifts = append(drifts, Drift{Kind: DriftRenamed, Block: ob.block, Declared: missing[0], Actual: undeclared[0]})
+			continue
+		}
+		for _, name := range missing {
+			drifts = append(drifts, Drift{Kind: DriftMissing, Block: ob.block, Declared: name})
+		}
+		for _, name := range undeclared {
+			drifts = append(drifts, Drift{Kind: DriftUndeclared, Block: ob.block, Actual: name})
+		}
+	}
+
+	return drifts
+}
+
+// difference returns the elements of a that are not in b, sorted
+func difference(a, b []string) []string {
+	in := make(map[string]bool, len(b))
+	for _, s := range b {
+		in[s] = true
+	}
+	diff := make([]string, 0)
+	for _, s := range a {
+		if !in[s] {
+			diff = append(diff, s)
+		}
+	}
+	sort.Strings(diff)
+	return diff
+}
+
+// Sync updates conf to match the flake: renamed blocks and the app name are updated, and stubs are added for undeclared outputs.
+// Blocks missing from the flake are removed only when prune is set. It returns a description of each change,
+// stubs need to be completed before the config is valid.
+func Sync(conf *Config, drifts []Drift, prune bool) []string {
+	changes := make([]string, 0)
+	for _, d := range drifts {
+		switch d.Kind {
+		case DriftAppName:
+			switch {
+			case conf.GoModule != nil:
+				conf.GoModule.Name = d.Actual
+			case conf.RustApp != nil:
+				conf.RustApp.CrateName = d.Actual
+			case conf.JsNpmApp != nil:
+				conf.JsNpmApp.PackageName = d.Actual
+			}
+			changes = append(changes, fmt.Sprintf("renamed app %q to %q", d.Declared, d.Actual))
+		case DriftRenamed:
+			renameBlock(conf, d.Block, d.Declared, d.Actual)
+			changes = append(changes, fmt.Sprintf("renamed %s %q to %q", d.Block, d.Declared, d.Actual))
+		case DriftUndeclared:
+			addStub(conf, d.Block, d.Actual)
+			changes = append(changes, fmt.Sprintf("added a stub for %s %q, complete it in bsf.hcl", d.Block, d.Actual))
+		case DriftMissing:
+			if !prune {
+				continue
+			}
+			removeBlock(conf, d.Block, d.Declared)
+			changes = append(changes, fmt.Sprintf("removed %s %q", d.Block, d.Declared))
+		}
+	}
+	return changes
+}
+
+func renameBlock(conf *Config, block, from, to string) {
+	switch block {
+	case "oci":
+		for i := range conf.OCIArtifact {
+			if conf.OCIArtifact[i].Environment == from {
+				conf.OCIArtifact[i].Environment = to
+			}
+		}
+	case "config":
+		for i := range conf.ConfigFiles {
+			if conf.ConfigFiles[i].Name == from {
+				conf.ConfigFiles[i].Name = to
+			}
+		}
+		// images importing the config keep importing it
+		for i := range conf.OCIArtifact {
+			for j, name := range conf.OCIArtifact[i].ImportConfigs {
+				if name == from {
+					conf.OCIArtifact[i].ImportConfigs[j] = to
+				}
+			}
+		}
+	}
+}
+
+func addStub(conf *Config, block, name string) {
+	switch block {
+	case "oci":
+		conf.OCIArtifact = append(conf.OCIArtifact, OCIArtifact{Environment: name, Name: name + ":latest"})
+	case "config":
+		conf.ConfigFiles = append(conf.ConfigFiles, ConfigFiles{Name: name, Files: []string{}})
+	}
+}
+
+func removeBlock(conf *Config, block, name string) {
+	switch block {
+	case "oci":
+		kept := make([]OCIArtifact, 0, len(conf.OCIArtifact))
+		for _, a := range conf.OCIArtifact {
+			if a.Environment != name {
+				kept = append(kept, a)
+			}
+		}
+		conf.OCIArtifact = kept
+	case "config":
+		kept := make([]ConfigFiles, 0, len(conf.ConfigFiles))
+		for _, c := range conf.ConfigFiles {
+			if c.Name != name {
+				kept = append(kept, c)
+			}
+		}
+		conf.ConfigFiles = kept
+	}
+}
@@ -0,0 +1,108 @@
+package hcl2nix
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDetectDrift(t *testing.T) {
+	conf := func() *Config {
+		return &Config{
+			GoModule: &GoModule{Name: "app"},
+			OCIArtifact: []OCIArtifact{
+				{Environment: "prod", Name: "ttl.sh/app:1h", ImportConfigs: []string{"nginx"}},
+				{Environment: "dev", Name: "ttl.sh/app:dev"},
+			},
+			ConfigFiles: []ConfigFiles{{Name: "nginx", Files: []string{"nginx.conf"}}},
+		}
+	}
+
+	tests := []struct {
+		name    string
+		outputs map[string][]string
+		appName string
+		want    []Drift
+	}{
+		{
+			name: "in sync",
+			outputs: map[string][]string{
+				"ociImages": {"ociImage_dev", "ociImage_dev-as-dir", "ociImage_prod", "ociImage_prod-as-dir"},
+				"configs":   {"config_nginx"},
+			},
+			appName: "app",
+			want:    []Drift{},
+		},
+		{
+			name: "renamed and missing",
+			outputs: map[string][]string{
+				"ociImages": {"ociImage_dev", "ociImage_production", "ociImage_production-as-dir"},
+				"configs":   {},
+			},
+			appName: "server",
+			want: []Drift{
+				{Kind: DriftAppName, Block: "app", Declared: "app", Actual: "server"},
+				{Kind: DriftRenamed, Block: "oci", Declared: "prod", Actual: "production"},
+				{Kind: DriftMissing, Block: "config", Declared: "nginx"},
+			},
+		},
+		{
+			name: "undeclared",
+			outputs: map[string][]string{
+				"ociImages": {"ociImage_dev", "ociImage_prod", "ociImage_debug", "ociImage_test"},
+				"configs":   {"config_nginx"},
+			},
+			appName: "app",
+			want: []Drift{
+				{Kind: DriftUndeclared, Block: "oci", Actual: "debug"},
+				{Kind: DriftUndeclared, Block: "oci", Actual: "test"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := DetectDrift(conf(), tt.outputs, tt.appName)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("DetectDrift() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSync(t *testing.T) {
+	conf := &Config{
+		GoModule: &GoModule{Name: "app"},
+		OCIArtifact: []OCIArtifact{
+			{Environment: "prod", Name: "ttl.sh/app:1h", ImportConfigs: []string{"nginx"}},
+			{Environment: "old", Name: "ttl.sh/app:old"},
+		},
+		ConfigFiles: []ConfigFiles{{Name: "nginx", Files: []string{"nginx.conf"}}},
+	}
+	drifts := []Drift{
+		{Kind: DriftAppName, Block: "app", Declared: "app", Actual: "server"},
+		{Kind: DriftRenamed, Block: "config", Declared: "nginx", Actual: "proxy"},
+		{Kind: DriftMissing, Block: "oci", Declared: "old"},
+		{Kind: DriftUndeclared, Block: "oci", Actual: "debug"},
+	}
+
+	changes := Sync(conf, drifts, false)
+	if len(changes) != 3 {
+		t.Errorf("expected 3 changes without prune, got %v", changes)
+	}
+	if conf.GoModule.Name != "server" {
+		t.Errorf("app was not renamed, got %q", conf.GoModule.Name)
+	}
+	if conf.ConfigFiles[0].Name != "proxy" || conf.OCIArtifact[0].ImportConfigs[0] != "proxy" {
+		t.Errorf("config was not renamed everywhere: %+v %+v", conf.ConfigFiles, conf.OCIArtifact[0])
+	}
+	if len(conf.OCIArtifact) != 3 || conf.OCIArtifact[2].Environment != "debug" {
+		t.Errorf("expected a stub for debug to be added and old to be kept, got %+v", conf.OCIArtifact)
+	}
+
+	Sync(conf, drifts[2:3], true)
+	for _, a := range conf.OCIArtifact {
+		if a.Environment == "old" {
+			t.Errorf("expected old to be pruned")
+		}
+	}
+}
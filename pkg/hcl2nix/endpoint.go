@@ -0,0 +1,66 @@
+package hcl2nix
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+var protocolRegex = regexp.MustCompile(`^[a-z][a-z0-9+.\-]*$`)
+
+// Endpoint is an API the container serves on one of its exposed ports, a CycloneDX service of its SBOM for threat
+// modeling tools
+type Endpoint struct {
+	// Name is the name of the API. Ex: public-api
+	Name string `hcl:"name,label" json:"name"`
+	// Port is the exposed port the API is served on. Ex: 8443/tcp
+	Port string `hcl:"port" json:"port"`
+	// Protocol is the application protocol of the API, the transport of the port when unset. Ex: https, grpc
+	Protocol string `hcl:"protocol,optional" json:"protocol,omitempty"`
+	// Path is the path the API is served at. Ex: /v1
+	Path string `hcl:"path,optional" json:"path,omitempty"`
+	// Authenticated is whether the API requires authentication, unknown when unset
+	Authenticated *bool `hcl:"authenticated,optional" json:"authenticated,omitempty"`
+	// Public is whether the API is reachable from outside of the trust boundary of the container, e.g. from the internet
+	Public bool `hcl:"public,optional" json:"public,omitempty"`
+	// Description is what the API serves
+	Description string `hcl:"description,optional" json:"description,omitempty"`
+}
+
+// validate validates the endpoint of a container exposing the ports
+func (e *Endpoint) validate(exposedPorts []string) *string {
+	if !slices.Contains(exposedPorts, e.Port) {
+		return pointerTo(fmt.Sprintf("endpoint %s is served on port %s, which exposedPorts doesn't list", e.Name, e.Port))
+	}
+	if e.Protocol != "" && !protocolRegex.MatchString(e.Protocol) {
+		return pointerTo(fmt.Sprintf("the protocol of endpoint %s must be a URL scheme, e.g. https", e.Name))
+	}
+	if e.Path != "" && !strings.HasPrefix(e.Path, "/") {
+		return pointerTo(fmt.Sprintf("the path of endpoint %s must start with /", e.Name))
+	}
+	return nil
+}
+
+// URL returns the URL the endpoint is served at in the container, which listens on all its interfaces
+func (e *Endpoint) URL() string {
+	port, transport, _ := strings.Cut(e.Port, "/")
+	scheme := e.Protocol
+	if scheme == "" {
+		scheme = transport
+	}
+	return scheme + "://0.0.0.0:" + port + e.Path
+}
+
+// Services returns the endpoints of the container: the endpoint blocks and an endpoint for each exposed port none of
+// them is served on
+func (c *OCIArtifact) Services() []Endpoint {
+	endpoints := slices.Clone(c.Endpoints)
+	for _, port := range c.ExposedPorts {
+		if slices.ContainsFunc(c.Endpoints, func(e Endpoint) bool { return e.Port == port }) {
+			continue
+		}
+		endpoints = append(endpoints, Endpoint{Name: "port-" + strings.ReplaceAll(port, "/", "-"), Port: port})
+	}
+	return endpoints
+}
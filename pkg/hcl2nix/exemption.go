@@ -0,0 +1,51 @@
+package hcl2nix
+
+import (
+	"fmt"
+	"time"
+)
+
+// ExemptionDateLayout is the layout of the expiry dates of exemptions
+const ExemptionDateLayout = "2006-01-02"
+
+// Exemption exempts a package of the closure that isn't in the approved package catalog of the organization,
+// see the catalog of ~/.bsf.json and bsf build --catalog
+type Exemption struct {
+	// Name is the name of the package, as in its store path. Ex: openssl
+	Name string `hcl:"name,label" json:"name"`
+	// Version is the exempted version of the package, all of its versions when unset. Ex: 1.1.1w
+	Version string `hcl:"version,optional" json:"version,omitempty"`
+	// Reason is why the package is used although it isn't approved, e.g. the ticket of the exemption request
+	Reason string `hcl:"reason" json:"reason"`
+	// Expires is the last day the exemption applies, in YYYY-MM-DD form. It doesn't expire when unset.
+	Expires string `hcl:"expires,optional" json:"expires,omitempty"`
+}
+
+// Validate validates Exemption
+func (e *Exemption) Validate() *string {
+	if e.Reason == "" {
+		return pointerTo(fmt.Sprintf("exemption %s must give the reason the package is used", e.Name))
+	}
+	if e.Expires != "" {
+		if _, err := time.Parse(ExemptionDateLayout, e.Expires); err != nil {
+			return pointerTo(fmt.Sprintf("the expiry date of exemption %s must be in YYYY-MM-DD form", e.Name))
+		}
+	}
+	return nil
+}
+
+// Applies returns whether the exemption applies to the version of the package on the day of now
+func (e *Exemption) Applies(name, version string, now time.Time) bool {
+	if e.Name != name || (e.Version != "" && e.Version != version) {
+		return false
+	}
+	if e.Expires == "" {
+		return true
+	}
+	expires, err := time.Parse(ExemptionDateLayout, e.Expires)
+	if err != nil {
+		return false
+	}
+	// the exemption applies until the end of its last day
+	return now.Before(expires.AddDate(0, 0, 1))
+}
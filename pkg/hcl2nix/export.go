@@ -22,6 +22,10 @@ type OCIArtifact struct {
 	ImportConfigs []string `hcl:"importConfigs,optional"`
 	// DevDeps defines if development dependencies should be present in the image. By default, it is false.
 	DevDeps bool `hcl:"devDeps,optional"`
+	// Registries are the registries the image and its attestations are pushed to, in addition to Name
+	Registries []Registry `hcl:"registry,block"`
+	// Endpoints are the APIs the container serves on its exposed ports, recorded as CycloneDX services
+	Endpoints []Endpoint `hcl:"endpoint,block"`
 }
 
 // Validate validates ExportConfig
@@ -44,6 +48,28 @@ func (c *OCIArtifact) Validate(conf *Config) *string {
 		}
 	}
 
+	endpoints := make(map[string]bool, len(c.Endpoints))
+	for _, e := range c.Endpoints {
+		if endpoints[e.Name] {
+			return pointerTo("Endpoint " + e.Name + " is defined more than once")
+		}
+		endpoints[e.Name] = true
+		if errStr := e.validate(c.ExposedPorts); errStr != nil {
+			return errStr
+		}
+	}
+
+	names := make(map[string]bool, len(c.Registries))
+	for _, r := range c.Registries {
+		if names[r.Name] {
+			return pointerTo("Registry " + r.Name + " is defined more than once")
+		}
+		names[r.Name] = true
+		if errStr := r.Validate(conf); errStr != nil {
+			return errStr
+		}
+	}
+
 	return nil
 }
 
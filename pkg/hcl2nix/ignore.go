@@ -0,0 +1,72 @@
+package hcl2nix
+
+import (
+	"fmt"
+	"slices"
+	"time"
+)
+
+// IgnoreAnyComponent is the component of ignore rules applying to every component and to the closure as a whole,
+// e.g. to ignore max-closure-size
+const IgnoreAnyComponent = "*"
+
+// PolicyRules are the rules of the policy ignore blocks can ignore
+var PolicyRules = []string{"denied-license", "unallowed-license", "missing-license", "banned-package", "max-closure-size", "max-paths",
+	"hardening-pie", "hardening-relro", "hardening-nx", "hardening-stack-protector", "hardening-fortify", "hardening-setuid", "hardening-capabilities"}
+
+// Ignore is a temporary exception to a rule of the policy for a component. It has an owner who reviews it and it
+// lapses after its expiry date, when bsf build fails until it is renewed or removed.
+type Ignore struct {
+	// Component is the name of the component, as in its store path, or * for every component. Ex: openssl
+	Component string `hcl:"component,label" json:"component"`
+	// Rule is the rule of the policy ignored. Ex: banned-package
+	Rule string `hcl:"rule" json:"rule"`
+	// Version is the version of the component the rule is ignored for, all of its versions when unset
+	Version string `hcl:"version,optional" json:"version,omitempty"`
+	// Owner is who answers for the exception. Ex: security@example.com
+	Owner string `hcl:"owner" json:"owner"`
+	// Expires is the last day the rule is ignored, in YYYY-MM-DD form
+	Expires string `hcl:"expires" json:"expires"`
+	// Reason is why the rule is ignored, e.g. the ticket of the exception
+	Reason string `hcl:"reason,optional" json:"reason,omitempty"`
+}
+
+// Validate validates Ignore
+func (i *Ignore) Validate() *string {
+	if !slices.Contains(PolicyRules, i.Rule) {
+		return pointerTo(fmt.Sprintf("ignore %s: unknown rule %q, the rules are %v", i.Component, i.Rule, PolicyRules))
+	}
+	if i.Owner == "" {
+		return pointerTo(fmt.Sprintf("ignore %s must name the owner of the exception", i.Component))
+	}
+	if _, err := time.Parse(ExemptionDateLayout, i.Expires); err != nil {
+		return pointerTo(fmt.Sprintf("the expiry date of ignore %s must be in YYYY-MM-DD form", i.Component))
+	}
+	return nil
+}
+
+// Matches returns whether the rule is ignored for the version of the component, regardless of expiry. Violations
+// of the closure as a whole have no component.
+func (i *Ignore) Matches(rule, component, version string) bool {
+	if i.Rule != rule {
+		return false
+	}
+	if i.Component == IgnoreAnyComponent {
+		return true
+	}
+	return i.Component == component && (i.Version == "" || i.Version == version)
+}
+
+// Lapses returns the time the ignore rule lapses, the end of its last day
+func (i *Ignore) Lapses() time.Time {
+	expires, err := time.Parse(ExemptionDateLayout, i.Expires)
+	if err != nil {
+		return time.Time{}
+	}
+	return expires.AddDate(0, 0, 1)
+}
+
+// Lapsed returns whether the ignore rule lapsed on the day of now
+func (i *Ignore) Lapsed(now time.Time) bool {
+	return !now.Before(i.Lapses())
+}
@@ -41,6 +41,18 @@ type LockFile struct {
 // LockApp represents a app
 type LockApp struct {
 	Name string `json:"name"`
+	// Product is the product metadata declared in bsf.hcl, set on the root component of the SBOM
+	Product *Product `json:"product,omitempty"`
+	// Aliases are the nixpkgs package names mapped to upstream names in bsf.hcl, used in the SBOM
+	Aliases []Alias `json:"aliases,omitempty"`
+	// Exemptions are the packages bsf.hcl exempts from the approved package catalog
+	Exemptions []Exemption `json:"exemptions,omitempty"`
+	// Policy is the license and dependency policy of bsf.hcl the closure is checked against
+	Policy *Policy `json:"policy,omitempty"`
+	// Requirements are the runtime dependencies bsf.hcl declares outside of the closure, components of the SBOM
+	Requirements []Requirement `json:"requirements,omitempty"`
+	// Variants are the build variants of bsf.hcl, built by bsf build --matrix
+	Variants []Variant `json:"variants,omitempty"`
 }
 
 // LockPackage represents a package
@@ -49,9 +61,31 @@ type LockPackage struct {
 	Runtime bool                 `json:"runtime"`
 }
 
+// ReadLockFile reads bsf.lock of the project
+func ReadLockFile() (*LockFile, error) {
+	lockData, err := os.ReadFile("bsf.lock")
+	if err != nil {
+		return nil, err
+	}
+	lockFile := &LockFile{}
+	if err := json.Unmarshal(lockData, lockFile); err != nil {
+		return nil, err
+	}
+	return lockFile, nil
+}
+
+// LockedAppName returns the name of the app of bsf.lock, if any
+func LockedAppName() string {
+	lockFile, err := ReadLockFile()
+	if err != nil {
+		return ""
+	}
+	return lockFile.App.Name
+}
+
 // GenerateLockFile generates lock file
 func GenerateLockFile(conf *Config, packages []LockPackage, wr io.Writer) error {
-	la := LockApp{}
+	la := LockApp{Product: conf.Product, Aliases: conf.Aliases, Exemptions: conf.Exemptions, Policy: conf.Policy, Requirements: conf.Requires, Variants: conf.Variants}
 
 	// In future, when we have more languages, we can check all of them and pick the one that is used.
 	if conf.GoModule != nil {
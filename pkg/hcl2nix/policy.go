@@ -0,0 +1,133 @@
+package hcl2nix
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Policy is the license and dependency policy of the closure, bsf build fails when it is violated
+type Policy struct {
+	// AllowedLicenses are the SPDX identifiers of the licenses components may have, any license when empty
+	AllowedLicenses []string `hcl:"allowed_licenses,optional" json:"allowedLicenses,omitempty"`
+	// DeniedLicenses are the SPDX identifiers of the licenses components may not have
+	DeniedLicenses []string `hcl:"denied_licenses,optional" json:"deniedLicenses,omitempty"`
+	// RequireLicenses fails components without license metadata, they aren't checked against the licenses otherwise
+	RequireLicenses bool `hcl:"require_licenses,optional" json:"requireLicenses,omitempty"`
+	// MaxClosureSize is the maximum size of the NARs of the closure, with a unit. Ex: 512MiB
+	MaxClosureSize string `hcl:"max_closure_size,optional" json:"maxClosureSize,omitempty"`
+	// MaxPaths is the maximum number of store paths in the closure, unlimited when 0
+	MaxPaths int `hcl:"max_paths,optional" json:"maxPaths,omitempty"`
+	// Bans are the packages the closure may not contain
+	Bans []Ban `hcl:"ban,block" json:"bans,omitempty"`
+	// Hardening is the hardening the executables of the result must have
+	Hardening *Hardening `hcl:"hardening,block" json:"hardening,omitempty"`
+	// Ignores are the temporary exceptions to the rules of the policy
+	Ignores []Ignore `hcl:"ignore,block" json:"ignores,omitempty"`
+}
+
+// Ban bans a package, or versions of it, from the closure
+type Ban struct {
+	// Name is the name of the package, as in its store path. Ex: openssl
+	Name string `hcl:"name,label" json:"name"`
+	// Versions is the range of banned versions, all versions when unset, as package catalogs write them. Ex: <3
+	Versions string `hcl:"versions,optional" json:"versions,omitempty"`
+	// Reason is why the package is banned
+	Reason string `hcl:"reason,optional" json:"reason,omitempty"`
+}
+
+// Hardening is the hardening the executables of the result must have, their exploit mitigations and privileges
+type Hardening struct {
+	// RequirePIE fails executables that aren't position independent, ASLR doesn't randomize their code
+	RequirePIE bool `hcl:"require_pie,optional" json:"requirePIE,omitempty"`
+	// RequireRELRO is the RELRO executables must have at least: partial or full
+	RequireRELRO string `hcl:"require_relro,optional" json:"requireRELRO,omitempty"`
+	// RequireNX fails executables with an executable stack
+	RequireNX bool `hcl:"require_nx,optional" json:"requireNX,omitempty"`
+	// RequireStackProtector fails C executables built without stack protector, Go executables aren't checked
+	RequireStackProtector bool `hcl:"require_stack_protector,optional" json:"requireStackProtector,omitempty"`
+	// RequireFortify fails C executables built without FORTIFY_SOURCE, Go executables aren't checked
+	RequireFortify bool `hcl:"require_fortify,optional" json:"requireFortify,omitempty"`
+	// DenySetuid fails setuid and setgid executables
+	DenySetuid bool `hcl:"deny_setuid,optional" json:"denySetuid,omitempty"`
+	// DenyCapabilities fails executables requesting file capabilities other than AllowedCapabilities
+	DenyCapabilities bool `hcl:"deny_capabilities,optional" json:"denyCapabilities,omitempty"`
+	// AllowedCapabilities are the capabilities executables may request. Ex: cap_net_bind_service
+	AllowedCapabilities []string `hcl:"allowed_capabilities,optional" json:"allowedCapabilities,omitempty"`
+}
+
+// Validate validates Hardening
+func (h *Hardening) Validate() *string {
+	switch h.RequireRELRO {
+	case "", "partial", "full":
+	default:
+		return pointerTo(fmt.Sprintf("require_relro %q must be partial or full", h.RequireRELRO))
+	}
+	for _, c := range h.AllowedCapabilities {
+		if !strings.HasPrefix(c, "cap_") {
+			return pointerTo(fmt.Sprintf("allowed capability %q must be named as in capabilities(7), e.g. cap_net_bind_service", c))
+		}
+	}
+	return nil
+}
+
+// sizeUnits are the units of MaxClosureSize
+var sizeUnits = []struct {
+	suffix string
+	bytes  int64
+}{
+	{"KiB", 1 << 10}, {"MiB", 1 << 20}, {"GiB", 1 << 30},
+	{"KB", 1e3}, {"MB", 1e6}, {"GB", 1e9},
+	{"B", 1},
+}
+
+// Validate validates Policy
+func (p *Policy) Validate() *string {
+	if _, err := p.MaxClosureBytes(); err != nil {
+		return pointerTo(err.Error())
+	}
+	if p.MaxPaths < 0 {
+		return pointerTo("max_paths can't be negative")
+	}
+	for _, denied := range p.DeniedLicenses {
+		for _, allowed := range p.AllowedLicenses {
+			if denied == allowed {
+				return pointerTo(fmt.Sprintf("license %s is both allowed and denied", denied))
+			}
+		}
+	}
+	for _, b := range p.Bans {
+		if b.Name == "" {
+			return pointerTo("ban blocks must name a package")
+		}
+	}
+	if p.Hardening != nil {
+		if errStr := p.Hardening.Validate(); errStr != nil {
+			return errStr
+		}
+	}
+	for _, i := range p.Ignores {
+		if errStr := i.Validate(); errStr != nil {
+			return errStr
+		}
+	}
+	return nil
+}
+
+// MaxClosureBytes returns MaxClosureSize in bytes, 0 when unset
+func (p *Policy) MaxClosureBytes() (int64, error) {
+	s := strings.TrimSpace(p.MaxClosureSize)
+	if s == "" {
+		return 0, nil
+	}
+	for _, u := range sizeUnits {
+		if n, ok := strings.CutSuffix(s, u.suffix); ok {
+			v, err := strconv.ParseFloat(strings.TrimSpace(n), 64)
+			if err != nil || v <= 0 {
+				break
+			}
+			return int64(v * float64(u.bytes)), nil
+		}
+	}
+	return 0, fmt.Errorf("max_closure_size %q must be a positive size with a unit, e.g. 512MiB or 2GB", p.MaxClosureSize)
+}
@@ -0,0 +1,55 @@
+package hcl2nix
+
+import "net/url"
+
+// IconAnnotation is the annotation key of the product icon, as read by Artifact Hub. OCI has no key for it.
+const IconAnnotation = "io.artifacthub.package.logo-url"
+
+// Product holds the metadata of the product the artifacts are published as, for customer-facing registries.
+// It is set on the images as OCI annotations and on the root component of the SBOM.
+type Product struct {
+	// Name is the name of the product. Ex: Acme Billing
+	Name string `hcl:"name,optional" json:"name,omitempty"`
+	// Vendor is the organization distributing the product. Ex: Acme Inc.
+	Vendor string `hcl:"vendor,optional" json:"vendor,omitempty"`
+	// Description is a short description of the product
+	Description string `hcl:"description,optional" json:"description,omitempty"`
+	// Icon is the URL of the icon of the product
+	Icon string `hcl:"icon,optional" json:"icon,omitempty"`
+	// Documentation is the URL of the documentation of the product
+	Documentation string `hcl:"documentation,optional" json:"documentation,omitempty"`
+	// URL is the homepage of the product
+	URL string `hcl:"url,optional" json:"url,omitempty"`
+}
+
+// Validate validates Product
+func (p *Product) Validate() *string {
+	for name, u := range map[string]string{"icon": p.Icon, "documentation": p.Documentation, "url": p.URL} {
+		if u == "" {
+			continue
+		}
+		parsed, err := url.Parse(u)
+		if err != nil || (parsed.Scheme != "https" && parsed.Scheme != "http") || parsed.Host == "" {
+			return pointerTo("The " + name + " of the product must be a valid http(s) URL")
+		}
+	}
+	return nil
+}
+
+// Annotations returns the OCI annotations of the product, the pre-defined org.opencontainers.image keys where there is one
+func (p *Product) Annotations() map[string]string {
+	annotations := make(map[string]string)
+	for k, v := range map[string]string{
+		"org.opencontainers.image.title":         p.Name,
+		"org.opencontainers.image.vendor":        p.Vendor,
+		"org.opencontainers.image.description":   p.Description,
+		"org.opencontainers.image.documentation": p.Documentation,
+		"org.opencontainers.image.url":           p.URL,
+		IconAnnotation:                           p.Icon,
+	} {
+		if v != "" {
+			annotations[k] = v
+		}
+	}
+	return annotations
+}
@@ -0,0 +1,77 @@
+package hcl2nix
+
+import (
+	"strings"
+)
+
+// Redaction profiles built into bsf
+const (
+	// RedactNone publishes the attestations as they were generated
+	RedactNone = "none"
+	// RedactPublic removes the internal ids of private components, email addresses and the internal parameters of the build
+	RedactPublic = "public"
+)
+
+// Registry is a registry the image of an oci block is pushed to along with its attestations, e.g. an internal
+// registry and a customer-facing one
+type Registry struct {
+	Name string `hcl:"name,label"`
+	// Repository is the repository the image is pushed to, without a tag. Ex: ghcr.io/acme/billing
+	Repository string `hcl:"repository"`
+	// Tags are the templates of the tags the image is pushed under, evaluated from the build metadata:
+	// {tag} (the tag of the image name), {version}, {gitsha}, {date} and {channel}. Defaults to ["{tag}"]
+	Tags []string `hcl:"tags,optional"`
+	// MutableTags are templates of tags the image is pushed under as well, which may move to a new image, such as
+	// {channel}. Tags are immutable otherwise: pushing a different image under an existing tag fails unless forced.
+	// latest is always mutable.
+	MutableTags []string `hcl:"mutableTags,optional"`
+	// Redact is the redaction profile applied to the attestations: none (default), public or the name of a redaction block
+	Redact string `hcl:"redact,optional"`
+	// Key is the path to the PEM private key the attestations pushed to this registry are signed with
+	Key string `hcl:"key,optional"`
+	// Insecure pushes over plain HTTP, e.g. to a local registry
+	Insecure bool `hcl:"insecure,optional"`
+}
+
+// Redaction is a redaction profile removing internal details from the attestations pushed to a registry
+type Redaction struct {
+	Name string `hcl:"name,label"`
+	// Fields are the JSON keys removed from the attestations. Ex: ["internalParameters"]
+	Fields []string `hcl:"fields,optional"`
+	// Hosts are the hosts of internal URLs, references to them are removed. Ex: ["acme.internal"]
+	Hosts []string `hcl:"hosts,optional"`
+	// Comments are the prefixes of the comments of internal references. Ex: ["internal-id:"]
+	Comments []string `hcl:"comments,optional"`
+}
+
+// Validate validates Registry
+func (r *Registry) Validate(conf *Config) *string {
+	if r.Repository == "" || strings.ContainsAny(r.Repository, "@") || strings.Contains(r.Repository[strings.LastIndex(r.Repository, "/")+1:], ":") {
+		return pointerTo("The repository of registry " + r.Name + " must be set without a tag or digest. Ex: ghcr.io/acme/billing")
+	}
+	for _, tags := range [][]string{r.Tags, r.MutableTags} {
+		for _, t := range tags {
+			if t == "" || strings.ContainsAny(t, ":/@ ") {
+				return pointerTo("Invalid tag " + t + " for registry " + r.Name)
+			}
+		}
+	}
+	switch r.Redact {
+	case "", RedactNone, RedactPublic:
+	default:
+		if conf.FindRedaction(r.Redact) == nil {
+			return pointerTo("No redaction block " + r.Redact + " for registry " + r.Name)
+		}
+	}
+	return nil
+}
+
+// FindRedaction returns the redaction block of the given name, nil when there is none
+func (c *Config) FindRedaction(name string) *Redaction {
+	for i := range c.Redactions {
+		if c.Redactions[i].Name == name {
+			return &c.Redactions[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package hcl2nix
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// Kinds of runtime requirements
+const (
+	// RequirementPackage is software the application runs with but doesn't ship, e.g. a database
+	RequirementPackage = "package"
+	// RequirementService is a service the application calls, e.g. the API of a SaaS
+	RequirementService = "service"
+)
+
+// constraintRegex matches a version constraint, versions with an optional operator separated by commas. Ex: >= 14, < 17
+var constraintRegex = regexp.MustCompile(`^(?:(?:>=|<=|==|!=|>|<|=|~>|~|\^)?\s*[0-9A-Za-z][0-9A-Za-z.+\-*]*)(?:\s*,\s*(?:>=|<=|==|!=|>|<|=|~>|~|\^)?\s*[0-9A-Za-z][0-9A-Za-z.+\-*]*)*$`)
+
+// Requirement is a runtime dependency of the application that isn't in its closure, such as the database or the
+// external APIs it needs. It is a component of the SBOM the application has as a prerequisite.
+type Requirement struct {
+	// Name is the name of the package or service. Ex: postgres
+	Name string `hcl:"name,label" json:"name"`
+	// Version is the constraint on the versions the application supports, any version when unset. Ex: >= 14
+	Version string `hcl:"version,optional" json:"version,omitempty"`
+	// Kind is package, the default, or service
+	Kind string `hcl:"kind,optional" json:"kind,omitempty"`
+	// URL is the homepage of the package or the endpoint of the service. Ex: https://api.stripe.com
+	URL string `hcl:"url,optional" json:"url,omitempty"`
+	// Description is what the application needs it for
+	Description string `hcl:"description,optional" json:"description,omitempty"`
+}
+
+// Validate validates Requirement
+func (r *Requirement) Validate() *string {
+	if r.Kind != "" && r.Kind != RequirementPackage && r.Kind != RequirementService {
+		return pointerTo(fmt.Sprintf("requirement %s has an unsupported kind %s, use %s or %s", r.Name, r.Kind, RequirementPackage, RequirementService))
+	}
+	if r.Version != "" && !constraintRegex.MatchString(strings.TrimSpace(r.Version)) {
+		return pointerTo(fmt.Sprintf("the version of requirement %s must be a version constraint, e.g. >= 14", r.Name))
+	}
+	if r.URL != "" {
+		parsed, err := url.Parse(r.URL)
+		if err != nil || parsed.Scheme == "" || parsed.Host == "" {
+			return pointerTo(fmt.Sprintf("the url of requirement %s must be an absolute URL", r.Name))
+		}
+	}
+	return nil
+}
+
+// KindOrDefault returns the kind of the requirement, package when unset
+func (r *Requirement) KindOrDefault() string {
+	if r.Kind == "" {
+		return RequirementPackage
+	}
+	return r.Kind
+}
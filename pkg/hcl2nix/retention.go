@@ -0,0 +1,60 @@
+package hcl2nix
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Retention is how long the builds of the project and their artifacts are kept, bsf prune applies it
+type Retention struct {
+	// KeepBuilds is the number of most recent builds kept per branch, all of them when 0
+	KeepBuilds int `hcl:"keep_builds,optional"`
+	// MaxAge is the age after which builds, their SBOMs, attestations and image tags are deleted, with a unit: h,
+	// d or w. Ex: 90d
+	MaxAge string `hcl:"max_age,optional"`
+	// Registry also deletes the image tags pushed for the pruned builds from the registries of the oci blocks.
+	// Mutable tags, such as latest, are never deleted.
+	Registry bool `hcl:"registry,optional"`
+}
+
+// ageUnits are the units of MaxAge
+var ageUnits = []struct {
+	suffix   string
+	duration time.Duration
+}{
+	{"h", time.Hour}, {"d", 24 * time.Hour}, {"w", 7 * 24 * time.Hour},
+}
+
+// Validate validates Retention
+func (r *Retention) Validate() *string {
+	if r.KeepBuilds < 0 {
+		return pointerTo("keep_builds can't be negative")
+	}
+	if _, err := r.MaxAgeDuration(); err != nil {
+		return pointerTo(err.Error())
+	}
+	if r.KeepBuilds == 0 && r.MaxAge == "" {
+		return pointerTo("the retention block must set keep_builds, max_age or both")
+	}
+	return nil
+}
+
+// MaxAgeDuration returns MaxAge as a duration, 0 when unset
+func (r *Retention) MaxAgeDuration() (time.Duration, error) {
+	s := strings.TrimSpace(r.MaxAge)
+	if s == "" {
+		return 0, nil
+	}
+	for _, u := range ageUnits {
+		if n, ok := strings.CutSuffix(s, u.suffix); ok {
+			v, err := strconv.Atoi(strings.TrimSpace(n))
+			if err != nil || v <= 0 {
+				break
+			}
+			return time.Duration(v) * u.duration, nil
+		}
+	}
+	return 0, fmt.Errorf("max_age %q must be a positive number of hours, days or weeks, e.g. 72h, 90d or 12w", r.MaxAge)
+}
@@ -0,0 +1,31 @@
+package hcl2nix
+
+import "net/url"
+
+// Signing holds parameters describing how artifacts built by bsf are signed and how they should be verified
+type Signing struct {
+	// Issuer is the OIDC issuer of the keyless signing identity. Ex: https://token.actions.githubusercontent.com
+	Issuer string `hcl:"issuer,optional"`
+	// Subject is the identity that signs the artifacts. Ex: https://github.com/org/repo/.github/workflows/release.yml@refs/heads/main
+	Subject string `hcl:"subject,optional"`
+	// Key is the path to a cosign public key. When set, key based verification is used instead of keyless.
+	Key string `hcl:"key,optional"`
+	// Attestations are the predicate types that must be attached to the image. Ex: ["provenance", "spdx"]
+	Attestations []string `hcl:"attestations,optional"`
+}
+
+// Validate validates Signing
+func (s *Signing) Validate() *string {
+	if s.Key == "" && (s.Issuer == "" || s.Subject == "") {
+		return pointerTo("Either key or both issuer and subject must be set in the signing block")
+	}
+
+	if s.Issuer != "" {
+		u, err := url.Parse(s.Issuer)
+		if err != nil || u.Scheme != "https" {
+			return pointerTo("Issuer must be a valid https URL")
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,62 @@
+package hcl2nix
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// DefaultVariant is the name of the build of the package as declared, without variant
+const DefaultVariant = "default"
+
+// variantNameRegex matches the names of variants, used in the names of their output directories
+var variantNameRegex = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// overrideArgRegex matches the names of the arguments and attributes a variant overrides
+var overrideArgRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_'-]*$`)
+
+// Variant is a build variant of the application, such as a debug build or a build with a feature flag. It is built
+// from another attribute of the flake, or from the package with overridden arguments or attributes. Ex:
+//
+//	variant "fips" {
+//	  override = { openssl = "pkgs.openssl_3_fips" }
+//	}
+type Variant struct {
+	// Name is the name of the variant. Ex: fips
+	Name string `hcl:"name,label" json:"name"`
+	// Attribute is the flake attribute the variant is built from. Ex: .#app-debug
+	Attribute string `hcl:"attribute,optional" json:"attribute,omitempty"`
+	// Override are the arguments of the package overridden, as nix expressions in which pkgs is in scope. Ex:
+	// { withSystemd = "false" }
+	Override map[string]string `hcl:"override,optional" json:"override,omitempty"`
+	// OverrideAttrs are the attributes of the derivation overridden, as nix expressions in which old is the
+	// attributes of the package. Ex: { tags = "old.tags ++ [ \"netgo\" ]" }
+	OverrideAttrs map[string]string `hcl:"override_attrs,optional" json:"overrideAttrs,omitempty"`
+}
+
+// Validate validates Variant
+func (v *Variant) Validate() *string {
+	if !variantNameRegex.MatchString(v.Name) {
+		return pointerTo(fmt.Sprintf("variant %q must have a name of lowercase letters, digits, - and _", v.Name))
+	}
+	if v.Name == DefaultVariant {
+		return pointerTo(fmt.Sprintf("%s is the name of the build without variant", DefaultVariant))
+	}
+	overrides := len(v.Override) + len(v.OverrideAttrs)
+	if v.Attribute == "" && overrides == 0 {
+		return pointerTo(fmt.Sprintf("variant %s must set an attribute or overrides", v.Name))
+	}
+	if v.Attribute != "" && overrides > 0 {
+		return pointerTo(fmt.Sprintf("variant %s must set an attribute or overrides, not both", v.Name))
+	}
+	for _, args := range []map[string]string{v.Override, v.OverrideAttrs} {
+		for k, expr := range args {
+			if !overrideArgRegex.MatchString(k) {
+				return pointerTo(fmt.Sprintf("variant %s overrides %q, which isn't a nix identifier", v.Name, k))
+			}
+			if expr == "" {
+				return pointerTo(fmt.Sprintf("variant %s overrides %s with an empty expression", v.Name, k))
+			}
+		}
+	}
+	return nil
+}
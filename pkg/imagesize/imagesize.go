@@ -0,0 +1,253 @@
+// Package imagesize attributes the size of the layers of container images to the components of the closure, so the
+// dependencies inflating pull times can be told apart from the ones the NAR sizes make look large. The files of a
+// layer are attributed to the store path they are in, with the bytes of the tar archive they take and the bytes of
+// the compressed layer the compressor spent on them.
+package imagesize
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// ReportName is the name of the layer size report in the output directory
+const ReportName = "layers.json"
+
+const storeDir = "/nix/store"
+
+// ImageFiles is the store path the files of a layer outside the nix store are attributed to, e.g. /etc/passwd, with
+// the end of the archive
+const ImageFiles = ""
+
+// Component is the share of a store path of the size of a layer
+type Component struct {
+	// StorePath is the store path, ImageFiles for the files outside the store
+	StorePath string `json:"storePath"`
+	Name      string `json:"name"`
+	Files     int    `json:"files"`
+	// Size is the bytes of the uncompressed layer taking the files, CompressedSize the bytes of the layer blob
+	Size           int64 `json:"size"`
+	CompressedSize int64 `json:"compressedSize"`
+}
+
+// Layer is the size of a layer and its split between store paths, the largest compressed first
+type Layer struct {
+	Digest    string `json:"digest"`
+	MediaType string `json:"mediaType,omitempty"`
+	// Size is the bytes of the layer blob pulled, UncompressedSize the bytes of its tar archive
+	Size             int64       `json:"size"`
+	UncompressedSize int64       `json:"uncompressedSize"`
+	Components       []Component `json:"components"`
+	// Estimated is set when the compressed sizes of the components are their share of the uncompressed size, for
+	// compressions whose stream can't be split between files
+	Estimated bool `json:"estimated,omitempty"`
+}
+
+// Total is the size of a store path across the layers of the image
+type Total struct {
+	StorePath      string `json:"storePath"`
+	Name           string `json:"name"`
+	Size           int64  `json:"size"`
+	CompressedSize int64  `json:"compressedSize"`
+	// Layers are the digests of the layers with files of the store path
+	Layers []string `json:"layers"`
+}
+
+// Report is the size attribution of the layers of an image
+type Report struct {
+	Layers []Layer `json:"layers"`
+	// Components are the store paths of the layers, the largest compressed first
+	Components []Total `json:"components"`
+}
+
+// NewReport sums the components of the layers across the image
+func NewReport(layers []Layer) *Report {
+	r := &Report{Layers: layers, Components: make([]Total, 0)}
+	byPath := make(map[string]int)
+	for _, l := range layers {
+		for _, c := range l.Components {
+			i, ok := byPath[c.StorePath]
+			if !ok {
+				i = len(r.Components)
+				byPath[c.StorePath] = i
+				r.Components = append(r.Components, Total{StorePath: c.StorePath, Name: c.Name, Layers: make([]string, 0, 1)})
+			}
+			t := &r.Components[i]
+			t.Size += c.Size
+			t.CompressedSize += c.CompressedSize
+			t.Layers = append(t.Layers, l.Digest)
+		}
+	}
+	sort.SliceStable(r.Components, func(i, j int) bool { return r.Components[i].CompressedSize > r.Components[j].CompressedSize })
+	return r
+}
+
+// counter counts the bytes read through it
+type counter struct {
+	r io.Reader
+	n int64
+}
+
+func (c *counter) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// countingReader counts the bytes read through it. It is a ByteReader so decompressors read no further than the
+// data they decoded, the count is the position in the compressed stream.
+type countingReader struct {
+	r *bufio.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func (c *countingReader) ReadByte() (byte, error) {
+	b, err := c.r.ReadByte()
+	if err == nil {
+		c.n++
+	}
+	return b, err
+}
+
+// Attribute reads the layer, a tar archive compressed with gzip or zstd or not, and splits its size between the
+// store paths of its files. The compressed bytes are split where the decompressor was when the files ended, which is
+// within its window, 32KiB for gzip, of where they end in the stream: the error moves bytes between the store paths
+// on both sides of a boundary. The compressed sizes of zstd layers are estimated.
+func Attribute(r io.Reader, digest, mediaType string) (Layer, error) {
+	compressed := &countingReader{r: bufio.NewReader(r)}
+	var archive io.Reader = compressed
+	layer := Layer{Digest: digest, MediaType: mediaType, Components: make([]Component, 0)}
+
+	magic, _ := compressed.r.Peek(4)
+	switch {
+	case len(magic) >= 2 && magic[0] == 0x1f && magic[1] == 0x8b:
+		gz, err := gzip.NewReader(compressed)
+		if err != nil {
+			return Layer{}, err
+		}
+		defer gz.Close()
+		// the gzip trailer is attributed to the last file
+		gz.Multistream(false)
+		archive = gz
+	case len(magic) == 4 && magic[0] == 0x28 && magic[1] == 0xb5 && magic[2] == 0x2f && magic[3] == 0xfd:
+		zr, err := zstd.NewReader(compressed)
+		if err != nil {
+			return Layer{}, err
+		}
+		defer zr.Close()
+		archive = zr
+		layer.Estimated = true
+	}
+
+	uncompressed := &counter{r: archive}
+	tr := tar.NewReader(uncompressed)
+	byPath := make(map[string]int)
+	component := func(storePath string) *Component {
+		i, ok := byPath[storePath]
+		if !ok {
+			i = len(layer.Components)
+			byPath[storePath] = i
+			layer.Components = append(layer.Components, Component{StorePath: storePath, Name: Name(storePath)})
+		}
+		return &layer.Components[i]
+	}
+	var lastSize, lastCompressed int64
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return Layer{}, fmt.Errorf("failed to read layer %s: %v", digest, err)
+		}
+		if _, err := io.Copy(io.Discard, tr); err != nil {
+			return Layer{}, fmt.Errorf("failed to read layer %s: %v", digest, err)
+		}
+
+		// the padding of the previous file, and the header and content of this one, were read
+		c := component(StorePath(hdr.Name))
+		c.Files++
+		c.Size += uncompressed.n - lastSize
+		c.CompressedSize += compressed.n - lastCompressed
+		lastSize, lastCompressed = uncompressed.n, compressed.n
+	}
+	// the end of the archive and of the compressed stream are the image's
+	io.Copy(io.Discard, uncompressed)
+	io.Copy(io.Discard, compressed)
+	end := component(ImageFiles)
+	end.Size += uncompressed.n - lastSize
+	end.CompressedSize += compressed.n - lastCompressed
+	layer.Size, layer.UncompressedSize = compressed.n, uncompressed.n
+
+	if layer.Estimated && layer.UncompressedSize > 0 {
+		for i := range layer.Components {
+			c := &layer.Components[i]
+			c.CompressedSize = c.Size * layer.Size / layer.UncompressedSize
+		}
+	}
+	sortComponents(layer.Components)
+	return layer, nil
+}
+
+// FromPaths splits the size of a layer, uncompressed, between its store paths in proportion to their NAR sizes, for
+// layers whose archive isn't built yet, e.g. the ones nix2container assembles when the image is copied
+func FromPaths(digest, mediaType string, size int64, paths []string, narSize func(storePath string) int64) Layer {
+	layer := Layer{Digest: digest, MediaType: mediaType, Size: size, UncompressedSize: size, Components: make([]Component, 0, len(paths)), Estimated: true}
+	var total int64
+	sizes := make([]int64, len(paths))
+	for i, p := range paths {
+		sizes[i] = narSize(p)
+		total += sizes[i]
+	}
+	for i, p := range paths {
+		c := Component{StorePath: StorePath(p), Name: Name(StorePath(p))}
+		if total > 0 {
+			c.Size = sizes[i] * size / total
+			c.CompressedSize = c.Size
+		}
+		layer.Components = append(layer.Components, c)
+	}
+	sortComponents(layer.Components)
+	return layer
+}
+
+func sortComponents(components []Component) {
+	sort.SliceStable(components, func(i, j int) bool { return components[i].CompressedSize > components[j].CompressedSize })
+}
+
+// StorePath returns the store path of a file of a layer, ImageFiles for files outside the store
+func StorePath(name string) string {
+	name = path.Clean("/" + name)
+	rel, ok := strings.CutPrefix(name, storeDir+"/")
+	if !ok {
+		return ImageFiles
+	}
+	base, _, _ := strings.Cut(rel, "/")
+	return path.Join(storeDir, base)
+}
+
+// Name returns the name of the store path without its hash, the image files for ImageFiles
+func Name(storePath string) string {
+	if storePath == ImageFiles {
+		return "(image files)"
+	}
+	base := path.Base(storePath)
+	if _, name, ok := strings.Cut(base, "-"); ok && len(base) > 33 {
+		return name
+	}
+	return base
+}
@@ -0,0 +1,128 @@
+package imagesize
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"testing"
+)
+
+// testLayer writes a layer with a large incompressible file in one store path, a large compressible one in another
+// and /etc/passwd
+func testLayer(t *testing.T, compress bool) []byte {
+	t.Helper()
+	random := make([]byte, 256<<10)
+	if _, err := rand.Read(random); err != nil {
+		t.Fatal(err)
+	}
+	files := []struct {
+		name string
+		body []byte
+	}{
+		{"nix/store/aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa-openssl-3.0.13/lib/libcrypto.so", random},
+		{"nix/store/aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa-openssl-3.0.13/lib/libssl.so", random[:1024]},
+		{"nix/store/bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb-tzdata-2024a/share/zoneinfo", bytes.Repeat([]byte("zone"), 64<<10)},
+		{"etc/passwd", []byte("root:x:0:0::/root:/bin/sh\n")},
+	}
+
+	var buf bytes.Buffer
+	var gz *gzip.Writer
+	tw := tar.NewWriter(&buf)
+	if compress {
+		gz = gzip.NewWriter(&buf)
+		tw = tar.NewWriter(gz)
+	}
+	for _, f := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: f.name, Mode: 0644, Size: int64(len(f.body)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write(f.body); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if gz != nil {
+		if err := gz.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return buf.Bytes()
+}
+
+func TestAttribute(t *testing.T) {
+	for _, compress := range []bool{false, true} {
+		data := testLayer(t, compress)
+		layer, err := Attribute(bytes.NewReader(data), "abc", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if layer.Size != int64(len(data)) {
+			t.Errorf("compressed %v: Size = %d, want %d", compress, layer.Size, len(data))
+		}
+		var size, compressed int64
+		for _, c := range layer.Components {
+			size += c.Size
+			compressed += c.CompressedSize
+		}
+		if size != layer.UncompressedSize || compressed != layer.Size {
+			t.Errorf("compressed %v: the components sum to %d/%d bytes, the layer has %d/%d", compress, size, compressed, layer.UncompressedSize, layer.Size)
+		}
+		if len(layer.Components) != 3 {
+			t.Fatalf("compressed %v: %d components, want 3: %+v", compress, len(layer.Components), layer.Components)
+		}
+
+		openssl, tzdata := layer.Components[0], layer.Components[1]
+		if openssl.Name != "openssl-3.0.13" || openssl.Files != 2 || openssl.CompressedSize < 256<<10 {
+			t.Errorf("compressed %v: unexpected openssl %+v", compress, openssl)
+		}
+		if tzdata.Name != "tzdata-2024a" || tzdata.Size < 256<<10 {
+			t.Errorf("compressed %v: unexpected tzdata %+v", compress, tzdata)
+		}
+		// tzdata is larger than openssl uncompressed, but compresses to almost nothing
+		if compress && tzdata.CompressedSize > 64<<10 {
+			t.Errorf("tzdata takes %d compressed bytes", tzdata.CompressedSize)
+		}
+		if layer.Components[2].StorePath != ImageFiles || layer.Components[2].Files != 1 {
+			t.Errorf("compressed %v: unexpected image files %+v", compress, layer.Components[2])
+		}
+	}
+}
+
+func TestNewReport(t *testing.T) {
+	layers := []Layer{
+		{Digest: "a", Components: []Component{{StorePath: "/nix/store/x-glibc", Size: 10, CompressedSize: 5}, {StorePath: "/nix/store/y-app", Size: 4, CompressedSize: 2}}},
+		{Digest: "b", Components: []Component{{StorePath: "/nix/store/y-app", Size: 20, CompressedSize: 8}}},
+	}
+	r := NewReport(layers)
+	if len(r.Components) != 2 || r.Components[0].StorePath != "/nix/store/y-app" || r.Components[0].CompressedSize != 10 || len(r.Components[0].Layers) != 2 {
+		t.Errorf("NewReport() components = %+v", r.Components)
+	}
+}
+
+func TestFromPaths(t *testing.T) {
+	sizes := map[string]int64{"/nix/store/x-glibc": 300, "/nix/store/y-app": 100}
+	layer := FromPaths("a", "", 1000, []string{"/nix/store/y-app", "/nix/store/x-glibc"}, func(p string) int64 { return sizes[p] })
+	if layer.Components[0].StorePath != "/nix/store/x-glibc" || layer.Components[0].Size != 750 || layer.Components[1].CompressedSize != 250 || !layer.Estimated {
+		t.Errorf("FromPaths() = %+v", layer)
+	}
+}
+
+func TestStorePath(t *testing.T) {
+	tests := []struct {
+		name, want string
+	}{
+		{"nix/store/abc-hello-1.0/bin/hello", "/nix/store/abc-hello-1.0"},
+		{"./nix/store/abc-hello-1.0", "/nix/store/abc-hello-1.0"},
+		{"/nix/store/", ImageFiles},
+		{"etc/passwd", ImageFiles},
+	}
+	for _, tt := range tests {
+		if got := StorePath(tt.name); got != tt.want {
+			t.Errorf("StorePath(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package io
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/buildsafedev/bsf/pkg/shutdown"
+)
+
+// WriteAtomic writes the file through a temporary file renamed over it, so concurrent readers never read a partial one
+func WriteAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer shutdown.RemoveOnExit(tmp.Name())()
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
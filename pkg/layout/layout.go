@@ -0,0 +1,369 @@
+// Package layout manages the bsf output directory. Files are stored by the sha256 digest of their content under
+// artifacts/, sboms/, attestations/, logs/ and reports/, and index.json names them, so outputs can be archived and referenced
+// by digest from other tooling.
+package layout
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	bio "github.com/buildsafedev/bsf/pkg/io"
+	"github.com/buildsafedev/bsf/pkg/shutdown"
+)
+
+const (
+	// IndexFile is the name of the index in the output directory
+	IndexFile = "index.json"
+	// SchemaVersion is the version of the index format
+	SchemaVersion = 1
+
+	// KindArtifact is a file built by nix, such as a binary of the app
+	KindArtifact = "artifacts"
+	// KindSBOM is a software bill of materials
+	KindSBOM = "sboms"
+	// KindAttestation is a set of in-toto statements
+	KindAttestation = "attestations"
+	// KindLog is a build log
+	KindLog = "logs"
+	// KindReport is an analysis of the build, such as the reachability of its components
+	KindReport = "reports"
+)
+
+// Names of the entries bsf build writes
+const (
+	AttestationsName       = "attestations.intoto.jsonl"
+	SignedAttestationsName = "attestations.signed.jsonl"
+	BuildLogName           = "build.log"
+)
+
+// Entry is a file of the output directory
+type Entry struct {
+	Kind      string `json:"kind"`
+	Name      string `json:"name"`
+	MediaType string `json:"mediaType"`
+	Digest    string `json:"digest"`
+	Size      int64  `json:"size"`
+	// Path is relative to the output directory
+	Path string `json:"path"`
+	// StorePath is the nix store path the artifact was copied from
+	StorePath string `json:"storePath,omitempty"`
+}
+
+// Index lists the entries of the output directory
+type Index struct {
+	SchemaVersion int       `json:"schemaVersion"`
+	App           string    `json:"app,omitempty"`
+	Version       string    `json:"version,omitempty"`
+	Created       time.Time `json:"created"`
+	// Result is the store path of the build result, output/result is a garbage collector root for it
+	Result  string  `json:"result,omitempty"`
+	Entries []Entry `json:"entries"`
+}
+
+// Layout is an output directory being written
+type Layout struct {
+	Dir   string
+	Index *Index
+}
+
+// Open returns the layout of dir, with the entries of its index if it has one
+func Open(dir string) (*Layout, error) {
+	l := &Layout{Dir: dir, Index: &Index{SchemaVersion: SchemaVersion, Entries: make([]Entry, 0)}}
+
+	data, err := os.ReadFile(filepath.Join(dir, IndexFile))
+	if os.IsNotExist(err) {
+		return l, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, l.Index); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", IndexFile, err)
+	}
+	if l.Index.SchemaVersion > SchemaVersion {
+		return nil, fmt.Errorf("%s has schema version %d, this version of bsf supports up to %d", IndexFile, l.Index.SchemaVersion, SchemaVersion)
+	}
+	// indexes are copied between hosts, e.g. in bundles: their entries mustn't name files outside the directory
+	for _, e := range l.Index.Entries {
+		if err := checkPath(e.Path); err != nil {
+			return nil, fmt.Errorf("%s: entry %s/%s: %v", filepath.Join(dir, IndexFile), e.Kind, e.Name, err)
+		}
+	}
+	return l, nil
+}
+
+// checkPath checks that the path of an entry is a file of the output directory, rather than an absolute path or one
+// leaving it with ..
+func checkPath(rel string) error {
+	if !filepath.IsLocal(filepath.FromSlash(rel)) {
+		return fmt.Errorf("path %q is outside the output directory", rel)
+	}
+	return nil
+}
+
+// Add stores data and records it in the index under kind and name, replacing the previous entry with that name
+func (l *Layout) Add(kind, name, mediaType string, data []byte) (Entry, error) {
+	sum := sha256.Sum256(data)
+	hexDigest := hex.EncodeToString(sum[:])
+	rel := filepath.Join(kind, "sha256", hexDigest)
+
+	path := filepath.Join(l.Dir, rel)
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return Entry{}, err
+		}
+		if err := bio.WriteAtomic(path, data); err != nil {
+			return Entry{}, err
+		}
+	}
+
+	e := Entry{
+		Kind:      kind,
+		Name:      name,
+		MediaType: mediaType,
+		Digest:    "sha256:" + hexDigest,
+		Size:      int64(len(data)),
+		Path:      filepath.ToSlash(rel),
+	}
+	l.put(e)
+	return e, nil
+}
+
+// AddFile copies the file at path into the layout, see Add
+func (l *Layout) AddFile(kind, name, mediaType, path string) (Entry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Entry{}, err
+	}
+	defer f.Close()
+
+	tmp, err := os.CreateTemp(l.Dir, ".blob-*")
+	if err != nil {
+		return Entry{}, err
+	}
+	defer shutdown.RemoveOnExit(tmp.Name())()
+	defer os.Remove(tmp.Name())
+
+	h := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, h), f)
+	if err != nil {
+		tmp.Close()
+		return Entry{}, err
+	}
+	if err := tmp.Close(); err != nil {
+		return Entry{}, err
+	}
+
+	hexDigest := hex.EncodeToString(h.Sum(nil))
+	rel := filepath.Join(kind, "sha256", hexDigest)
+	if err := os.MkdirAll(filepath.Join(l.Dir, kind, "sha256"), 0755); err != nil {
+		return Entry{}, err
+	}
+	// files copied from the store are read-only
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return Entry{}, err
+	}
+	if info, err := os.Stat(path); err == nil && info.Mode()&0111 != 0 {
+		os.Chmod(tmp.Name(), 0755)
+	}
+	if err := os.Rename(tmp.Name(), filepath.Join(l.Dir, rel)); err != nil {
+		return Entry{}, err
+	}
+
+	e := Entry{
+		Kind:      kind,
+		Name:      name,
+		MediaType: mediaType,
+		Digest:    "sha256:" + hexDigest,
+		Size:      size,
+		Path:      filepath.ToSlash(rel),
+	}
+	l.put(e)
+	return e, nil
+}
+
+func (l *Layout) put(e Entry) {
+	for i, existing := range l.Index.Entries {
+		if existing.Kind == e.Kind && existing.Name == e.Name {
+			l.Index.Entries[i] = e
+			return
+		}
+	}
+	l.Index.Entries = append(l.Index.Entries, e)
+}
+
+// SetStorePath records the store path an entry was copied from
+func (l *Layout) SetStorePath(kind, name, storePath string) {
+	for i, e := range l.Index.Entries {
+		if e.Kind == kind && e.Name == name {
+			l.Index.Entries[i].StorePath = storePath
+		}
+	}
+}
+
+// Remove drops the entry from the index, its content is deleted by Prune
+func (l *Layout) Remove(kind, name string) {
+	kept := l.Index.Entries[:0]
+	for _, e := range l.Index.Entries {
+		if e.Kind != kind || e.Name != name {
+			kept = append(kept, e)
+		}
+	}
+	l.Index.Entries = kept
+}
+
+// Find returns the entry of kind with name
+func (l *Layout) Find(kind, name string) (Entry, bool) {
+	for _, e := range l.Index.Entries {
+		if e.Kind == kind && e.Name == name {
+			return e, true
+		}
+	}
+	return Entry{}, false
+}
+
+// Read returns the content of the entry of kind with name
+func (l *Layout) Read(kind, name string) ([]byte, error) {
+	e, ok := l.Find(kind, name)
+	if !ok {
+		return nil, fmt.Errorf("%s/%s not found in %s", kind, name, filepath.Join(l.Dir, IndexFile))
+	}
+	return os.ReadFile(filepath.Join(l.Dir, filepath.FromSlash(e.Path)))
+}
+
+// Write writes index.json. Entries are sorted so the index only changes with its content.
+func (l *Layout) Write() error {
+	sort.Slice(l.Index.Entries, func(i, j int) bool {
+		a, b := l.Index.Entries[i], l.Index.Entries[j]
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		return a.Name < b.Name
+	})
+	if l.Index.Created.IsZero() {
+		l.Index.Created = time.Now().UTC()
+	}
+
+	data, err := json.MarshalIndent(l.Index, "", "  ")
+	if err != nil {
+		return err
+	}
+	return bio.WriteAtomic(filepath.Join(l.Dir, IndexFile), append(data, '\n'))
+}
+
+// Link points the legacy name, relative to the output directory, at the entry so tools reading
+// bsf-result/attestations.intoto.jsonl keep working
+func (l *Layout) Link(kind, name, legacy string) error {
+	e, ok := l.Find(kind, name)
+	if !ok {
+		return fmt.Errorf("%s/%s not found", kind, name)
+	}
+	if err := checkPath(legacy); err != nil {
+		return err
+	}
+	path := filepath.Join(l.Dir, legacy)
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return os.Symlink(filepath.FromSlash(e.Path), path)
+}
+
+// Prune deletes the stored files the index does not reference anymore and returns how many were deleted
+func (l *Layout) Prune() (int, error) {
+	referenced := make(map[string]bool, len(l.Index.Entries))
+	for _, e := range l.Index.Entries {
+		referenced[filepath.FromSlash(e.Path)] = true
+	}
+
+	pruned := 0
+	for _, kind := range []string{KindArtifact, KindSBOM, KindAttestation, KindLog, KindReport} {
+		blobs, err := filepath.Glob(filepath.Join(l.Dir, kind, "sha256", "*"))
+		if err != nil {
+			return pruned, err
+		}
+		for _, b := range blobs {
+			rel, err := filepath.Rel(l.Dir, b)
+			if err != nil || referenced[rel] {
+				continue
+			}
+			if err := os.Remove(b); err != nil {
+				return pruned, err
+			}
+			pruned++
+		}
+	}
+	return pruned, nil
+}
+
+// Sweep cleans up after a build that stopped while writing the output directory: it deletes the temporary files left
+// by interrupted writes and the stored files the index does not reference, then the links of the output directory
+// left dangling, such as legacy names of entries never indexed. It returns how many files were deleted.
+func (l *Layout) Sweep() (int, error) {
+	swept := 0
+	dirs := []string{l.Dir}
+	for _, kind := range []string{KindArtifact, KindSBOM, KindAttestation, KindLog, KindReport} {
+		dirs = append(dirs, filepath.Join(l.Dir, kind, "sha256"))
+	}
+	for _, dir := range dirs {
+		for _, pattern := range []string{".tmp-*", ".blob-*"} {
+			temps, err := filepath.Glob(filepath.Join(dir, pattern))
+			if err != nil {
+				return swept, err
+			}
+			for _, t := range temps {
+				if err := os.Remove(t); err != nil && !os.IsNotExist(err) {
+					return swept, err
+				}
+				swept++
+			}
+		}
+	}
+
+	pruned, err := l.Prune()
+	swept += pruned
+	if err != nil {
+		return swept, err
+	}
+
+	entries, err := os.ReadDir(l.Dir)
+	if os.IsNotExist(err) {
+		return swept, nil
+	}
+	if err != nil {
+		return swept, err
+	}
+	for _, e := range entries {
+		if e.Type()&os.ModeSymlink == 0 {
+			continue
+		}
+		path := filepath.Join(l.Dir, e.Name())
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			continue
+		}
+		if err := os.Remove(path); err != nil {
+			return swept, err
+		}
+		swept++
+	}
+	return swept, nil
+}
+
+// ReadAttestations returns the attestations of the output directory, from its index
+// or from attestations.intoto.jsonl for directories written by older versions of bsf
+func ReadAttestations(dir string) ([]byte, error) {
+	l, err := Open(dir)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := l.Find(KindAttestation, AttestationsName); ok {
+		return l.Read(KindAttestation, AttestationsName)
+	}
+	return os.ReadFile(filepath.Join(dir, AttestationsName))
+}
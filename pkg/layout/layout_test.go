@@ -0,0 +1,173 @@
+package layout
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLayout(t *testing.T) {
+	dir := t.TempDir()
+
+	l, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, err := l.Add(KindAttestation, AttestationsName, "application/vnd.in-toto+jsonl", []byte("first\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Path != "attestations/sha256/"+first.Digest[len("sha256:"):] {
+		t.Errorf("unexpected path %s for digest %s", first.Path, first.Digest)
+	}
+
+	bin := filepath.Join(t.TempDir(), "app")
+	if err := os.WriteFile(bin, []byte("binary"), 0555); err != nil {
+		t.Fatal(err)
+	}
+	artifact, err := l.AddFile(KindArtifact, "bin/app", "application/octet-stream", bin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(filepath.Join(dir, artifact.Path)); err != nil || info.Mode().Perm() != 0755 {
+		t.Errorf("expected an executable copy of the artifact: %v %v", info, err)
+	}
+	if err := l.Write(); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Link(KindAttestation, AttestationsName, AttestationsName); err != nil {
+		t.Fatal(err)
+	}
+
+	// a new build replaces the attestations, the previous ones are pruned
+	l, err = Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(l.Index.Entries) != 2 {
+		t.Fatalf("expected 2 entries in the index, got %v", l.Index.Entries)
+	}
+	if _, err := l.Add(KindAttestation, AttestationsName, "application/vnd.in-toto+jsonl", []byte("second\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Write(); err != nil {
+		t.Fatal(err)
+	}
+	pruned, err := l.Prune()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pruned != 1 {
+		t.Errorf("expected the first attestations to be pruned, pruned %d files", pruned)
+	}
+	if err := l.Link(KindAttestation, AttestationsName, AttestationsName); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ReadAttestations(dir)
+	if err != nil || string(data) != "second\n" {
+		t.Errorf("ReadAttestations() = %q, %v", data, err)
+	}
+	legacy, err := os.ReadFile(filepath.Join(dir, AttestationsName))
+	if err != nil || string(legacy) != "second\n" {
+		t.Errorf("legacy path reads %q, %v", legacy, err)
+	}
+}
+
+func TestReadAttestationsLegacy(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, AttestationsName), []byte("legacy\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ReadAttestations(dir)
+	if err != nil || string(data) != "legacy\n" {
+		t.Errorf("ReadAttestations() = %q, %v", data, err)
+	}
+}
+
+func TestOpenOutsidePaths(t *testing.T) {
+	for _, path := range []string{"../../etc/passwd", "/etc/passwd", "sboms/sha256/../../../secret"} {
+		dir := t.TempDir()
+		index := `{"schemaVersion":1,"entries":[{"kind":"sboms","name":"sbom.spdx.json","path":"` + path + `"}]}`
+		if err := os.WriteFile(filepath.Join(dir, IndexFile), []byte(index), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Open(dir); err == nil {
+			t.Errorf("Open() accepted an entry with path %s", path)
+		}
+	}
+
+	l, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.Add(KindAttestation, AttestationsName, "application/vnd.in-toto+jsonl", []byte("{}\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Link(KindAttestation, AttestationsName, "../attestations.intoto.jsonl"); err == nil {
+		t.Error("Link() accepted a legacy name outside the output directory")
+	}
+}
+
+func TestSweep(t *testing.T) {
+	dir := t.TempDir()
+
+	l, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.Add(KindAttestation, AttestationsName, "application/vnd.in-toto+jsonl", []byte("built\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Write(); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Link(KindAttestation, AttestationsName, AttestationsName); err != nil {
+		t.Fatal(err)
+	}
+
+	// an interrupted build stored an SBOM it never indexed, linked it and left temporary files
+	interrupted, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sbom, err := interrupted.Add(KindSBOM, "bsf.spdx.json", "application/spdx+json", []byte("{}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := interrupted.Link(KindSBOM, "bsf.spdx.json", "bsf.spdx.json"); err != nil {
+		t.Fatal(err)
+	}
+	temps := []string{filepath.Join(dir, ".tmp-1"), filepath.Join(dir, ".blob-2"), filepath.Join(dir, KindSBOM, "sha256", ".tmp-3")}
+	for _, p := range temps {
+		if err := os.WriteFile(p, []byte("partial"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	l, err = Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	swept, err := l.Sweep()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the temporary files, the SBOM and its link
+	if swept != 5 {
+		t.Errorf("expected 5 files swept, got %d", swept)
+	}
+	for _, p := range append(temps, filepath.Join(dir, sbom.Path), filepath.Join(dir, "bsf.spdx.json")) {
+		if _, err := os.Lstat(p); !os.IsNotExist(err) {
+			t.Errorf("expected %s to be swept: %v", p, err)
+		}
+	}
+	data, err := ReadAttestations(dir)
+	if err != nil || string(data) != "built\n" {
+		t.Errorf("ReadAttestations() = %q, %v", data, err)
+	}
+	if _, err := os.ReadFile(filepath.Join(dir, AttestationsName)); err != nil {
+		t.Errorf("expected the link of the attestations to be kept: %v", err)
+	}
+}
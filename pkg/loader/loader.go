@@ -0,0 +1,303 @@
+// Package loader simulates the dynamic loader to find the shared libraries an executable loads at runtime.
+// Paths are store paths, the files of a chroot store are read below its root.
+// Libraries that are only referenced, e.g. by a string in a binary or a propagated input, are not loaded.
+// Libraries opened with dlopen can't be seen by the simulation.
+package loader
+
+import (
+	"bufio"
+	"bytes"
+	"debug/elf"
+	"os"
+	"path/filepath"
+	"strings"
+
+	nixcmd "github.com/buildsafedev/bsf/pkg/nix/cmd"
+)
+
+// Object is an executable or shared library found by the simulation
+type Object struct {
+	// Path is the real path of the object
+	Path string
+	// Missing are the sonames the object needs that could not be resolved
+	Missing []string
+}
+
+// Result is the simulation of loading the entrypoints
+type Result struct {
+	// Loaded are the objects loaded by any entrypoint, by real path
+	Loaded map[string]*Object
+	// LoadedBy lists the entrypoints that load each object
+	LoadedBy map[string][]string
+}
+
+// StorePaths returns the store paths of the loaded objects
+func (r *Result) StorePaths() map[string]bool {
+	paths := make(map[string]bool, len(r.Loaded))
+	for p := range r.Loaded {
+		if sp := StorePath(p); sp != "" {
+			paths[sp] = true
+		}
+	}
+	return paths
+}
+
+// StorePath returns the store path containing the file, such as /nix/store/<hash>-openssl-3.0.13
+func StorePath(path string) string {
+	rest, ok := strings.CutPrefix(path, "/nix/store/")
+	if !ok {
+		return ""
+	}
+	name, _, _ := strings.Cut(rest, "/")
+	return "/nix/store/" + name
+}
+
+// Simulate loads every entrypoint. Scripts are followed to their interpreter and to the programs they exec, as in nix wrappers.
+func Simulate(entrypoints []string) *Result {
+	r := &Result{
+		Loaded:   make(map[string]*Object),
+		LoadedBy: make(map[string][]string),
+	}
+	for _, entry := range entrypoints {
+		seen := make(map[string]bool)
+		for _, exe := range executables(entry, 0) {
+			r.load(entry, exe, seen)
+		}
+	}
+	return r
+}
+
+// executables returns the ELF executables an entrypoint runs, following scripts up to a few levels
+func executables(path string, depth int) []string {
+	real, err := nixcmd.EvalSymlinks(path)
+	if err != nil || depth > 4 {
+		return nil
+	}
+	if isELF(real) {
+		return []string{real}
+	}
+
+	exes := make([]string, 0)
+	for _, p := range scriptTargets(real) {
+		exes = append(exes, executables(p, depth+1)...)
+	}
+	return exes
+}
+
+// scriptTargets returns the interpreter of the script and the store paths it execs
+func scriptTargets(path string) []string {
+	f, err := os.Open(nixcmd.HostPath(path))
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	targets := make([]string, 0)
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for first := true; scanner.Scan(); first = false {
+		line := strings.TrimSpace(scanner.Text())
+		if first {
+			interp, ok := strings.CutPrefix(line, "#!")
+			if !ok {
+				return nil
+			}
+			if fields := strings.Fields(interp); len(fields) > 0 {
+				targets = append(targets, fields[0])
+			}
+			continue
+		}
+		if !strings.HasPrefix(line, "exec ") {
+			continue
+		}
+		for _, field := range strings.Fields(line) {
+			field = strings.Trim(field, `"'`)
+			if strings.HasPrefix(field, "/nix/store/") {
+				targets = append(targets, field)
+				break
+			}
+		}
+	}
+	return targets
+}
+
+func isELF(path string) bool {
+	f, err := os.Open(nixcmd.HostPath(path))
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	magic := make([]byte, 4)
+	if _, err := f.Read(magic); err != nil {
+		return false
+	}
+	return bytes.Equal(magic, []byte(elf.ELFMAG))
+}
+
+// load resolves the dependencies of the executable breadth first, like ld.so.
+// A soname is only loaded once per process, later objects needing it reuse the first match.
+func (r *Result) load(entry, exe string, seen map[string]bool) {
+	f, err := elf.Open(nixcmd.HostPath(exe))
+	if err != nil {
+		return
+	}
+	class, machine := f.Class, f.Machine
+	interp := interpreter(f)
+	f.Close()
+
+	// the interpreter is loaded first and its directory is the default search path of nixpkgs' glibc
+	defaultDirs := make([]string, 0)
+	if interp != "" {
+		if real, err := nixcmd.EvalSymlinks(interp); err == nil {
+			r.mark(entry, real, nil, seen)
+			defaultDirs = append(defaultDirs, filepath.Dir(real))
+		}
+	}
+
+	type pending struct {
+		path string
+		// rpaths are the DT_RPATH of the objects that loaded it, they apply to its dependencies when it has no DT_RUNPATH
+		rpaths []string
+	}
+
+	loadedSonames := make(map[string]bool)
+	queue := []pending{{path: exe}}
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+
+		obj, err := elf.Open(nixcmd.HostPath(cur.path))
+		if err != nil {
+			continue
+		}
+		needed, _ := obj.ImportedLibraries()
+		rpath := expand(dynStrings(obj, elf.DT_RPATH), cur.path)
+		runpath := expand(dynStrings(obj, elf.DT_RUNPATH), cur.path)
+		obj.Close()
+
+		search := make([]string, 0)
+		inherited := cur.rpaths
+		if len(runpath) == 0 {
+			inherited = append(append([]string{}, rpath...), cur.rpaths...)
+			search = append(search, inherited...)
+		} else {
+			inherited = nil
+		}
+		search = append(search, runpath...)
+		search = append(search, defaultDirs...)
+
+		missing := make([]string, 0)
+		for _, soname := range needed {
+			if loadedSonames[soname] {
+				continue
+			}
+			lib := resolve(soname, search, class, machine)
+			if lib == "" {
+				missing = append(missing, soname)
+				continue
+			}
+			loadedSonames[soname] = true
+			if r.mark(entry, lib, nil, seen) {
+				queue = append(queue, pending{path: lib, rpaths: inherited})
+			}
+		}
+		r.mark(entry, cur.path, missing, seen)
+	}
+}
+
+// mark records that entry loads the object and reports if it was not seen for that entry yet
+func (r *Result) mark(entry, path string, missing []string, seen map[string]bool) bool {
+	obj, ok := r.Loaded[path]
+	if !ok {
+		obj = &Object{Path: path}
+		r.Loaded[path] = obj
+	}
+	if len(missing) > 0 {
+		obj.Missing = missing
+	}
+	if seen[path] {
+		return false
+	}
+	seen[path] = true
+	r.LoadedBy[path] = append(r.LoadedBy[path], entry)
+	return true
+}
+
+func interpreter(f *elf.File) string {
+	for _, p := range f.Progs {
+		if p.Type != elf.PT_INTERP {
+			continue
+		}
+		data := make([]byte, p.Filesz)
+		if _, err := p.ReadAt(data, 0); err != nil {
+			return ""
+		}
+		return strings.TrimRight(string(data), "\x00")
+	}
+	return ""
+}
+
+func dynStrings(f *elf.File, tag elf.DynTag) []string {
+	values, err := f.DynString(tag)
+	if err != nil {
+		return nil
+	}
+	dirs := make([]string, 0)
+	for _, v := range values {
+		for _, d := range strings.Split(v, ":") {
+			if d != "" {
+				dirs = append(dirs, d)
+			}
+		}
+	}
+	return dirs
+}
+
+// expand substitutes $ORIGIN with the directory of the object
+func expand(dirs []string, object string) []string {
+	origin := filepath.Dir(object)
+	expanded := make([]string, 0, len(dirs))
+	for _, d := range dirs {
+		d = strings.ReplaceAll(d, "${ORIGIN}", origin)
+		d = strings.ReplaceAll(d, "$ORIGIN", origin)
+		expanded = append(expanded, d)
+	}
+	return expanded
+}
+
+// resolve finds the soname in the search path, skipping libraries of another ELF class or machine like ld.so does
+func resolve(soname string, search []string, class elf.Class, machine elf.Machine) string {
+	candidates := make([]string, 0, len(search))
+	if strings.Contains(soname, "/") {
+		candidates = append(candidates, soname)
+	} else {
+		for _, dir := range search {
+			candidates = append(candidates, filepath.Join(dir, soname))
+		}
+	}
+
+	for _, c := range candidates {
+		real, err := nixcmd.EvalSymlinks(c)
+		if err != nil {
+			continue
+		}
+		f, err := elf.Open(nixcmd.HostPath(real))
+		if err != nil {
+			continue
+		}
+		ok := f.Class == class && f.Machine == machine
+		f.Close()
+		if ok {
+			return real
+		}
+	}
+	return ""
+}
+
+// HasSharedObjects reports if the store path ships shared libraries in lib/, only those components can be classified
+// as loaded or not
+func HasSharedObjects(storePath string) bool {
+	matches, _ := filepath.Glob(filepath.Join(nixcmd.HostPath(storePath), "lib", "*.so*"))
+	return len(matches) > 0
+}
@@ -0,0 +1,121 @@
+package loader
+
+import (
+	"debug/elf"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/awalterschulze/gographviz"
+)
+
+func TestScriptTargets(t *testing.T) {
+	wrapper := filepath.Join(t.TempDir(), "app")
+	script := `#! /nix/store/aaaa-bash-5.2/bin/bash -e
+export PATH='/nix/store/bbbb-coreutils/bin'${PATH:+':'}$PATH
+exec -a "$0" "/nix/store/cccc-app/bin/.app-wrapped"  "$@"
+`
+	if err := os.WriteFile(wrapper, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"/nix/store/aaaa-bash-5.2/bin/bash", "/nix/store/cccc-app/bin/.app-wrapped"}
+	if got := scriptTargets(wrapper); !reflect.DeepEqual(got, want) {
+		t.Errorf("scriptTargets() = %v, want %v", got, want)
+	}
+}
+
+func TestExpand(t *testing.T) {
+	got := expand([]string{"$ORIGIN/../lib", "${ORIGIN}", "/nix/store/dddd-zlib/lib"}, "/nix/store/cccc-app/bin/app")
+	want := []string{"/nix/store/cccc-app/bin/../lib", "/nix/store/cccc-app/bin", "/nix/store/dddd-zlib/lib"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expand() = %v, want %v", got, want)
+	}
+}
+
+func TestStorePath(t *testing.T) {
+	tests := map[string]string{
+		"/nix/store/dddd-zlib-1.3/lib/libz.so.1": "/nix/store/dddd-zlib-1.3",
+		"/nix/store/dddd-zlib-1.3":               "/nix/store/dddd-zlib-1.3",
+		"/usr/lib/libz.so.1":                     "",
+	}
+	for path, want := range tests {
+		if got := StorePath(path); got != want {
+			t.Errorf("StorePath(%s) = %s, want %s", path, got, want)
+		}
+	}
+}
+
+// TestSimulate loads a dynamically linked binary of the host, the loader must at least find libc
+func TestSimulate(t *testing.T) {
+	exe := ""
+	for _, p := range []string{"/bin/sh", "/usr/bin/env", "/bin/ls"} {
+		f, err := elf.Open(p)
+		if err != nil {
+			continue
+		}
+		libs, _ := f.ImportedLibraries()
+		f.Close()
+		if len(libs) > 0 {
+			exe = p
+			break
+		}
+	}
+	if exe == "" {
+		t.Skip("no dynamically linked binary on the host")
+	}
+
+	r := Simulate([]string{exe})
+	if len(r.Loaded) < 2 {
+		t.Errorf("expected %s and its libraries to be loaded, got %v", exe, r.Loaded)
+	}
+	for path, entries := range r.LoadedBy {
+		if !reflect.DeepEqual(entries, []string{exe}) {
+			t.Errorf("expected %s to be loaded by %s, got %v", path, exe, entries)
+		}
+	}
+}
+
+func TestAnnotate(t *testing.T) {
+	graph := gographviz.NewGraph()
+	for name, attrs := range map[string][2]string{
+		"aaaa-app-1.0":      {"app", "1.0"},
+		"dddd-zlib-1.3":     {"zlib", "1.3"},
+		"eeee-tzdata-2024a": {"tzdata", "2024a"},
+	} {
+		if err := graph.AddNode("G", `"`+name+`"`, nil); err != nil {
+			t.Fatal(err)
+		}
+		node := graph.Nodes.Lookup[`"`+name+`"`]
+		node.Attrs["name"] = attrs[0]
+		node.Attrs["version"] = attrs[1]
+	}
+
+	entry := "/nix/store/aaaa-app-1.0/bin/app"
+	r := &Result{
+		Loaded: map[string]*Object{entry: {Path: entry}, "/nix/store/dddd-zlib-1.3/lib/libz.so.1.3": {}},
+		LoadedBy: map[string][]string{
+			entry: {entry},
+			"/nix/store/dddd-zlib-1.3/lib/libz.so.1.3": {entry},
+		},
+	}
+
+	report := Annotate(graph, []string{entry}, r)
+	if reachable, unreachable := report.Count(); reachable != 2 || unreachable != 0 {
+		t.Errorf("expected 2 reachable components, got %d reachable and %d unreachable", reachable, unreachable)
+	}
+	if got := graph.Nodes.Lookup[`"dddd-zlib-1.3"`].Attrs[Attr]; got != Reachable {
+		t.Errorf("expected zlib to be reachable, got %q", got)
+	}
+	// tzdata has no shared libraries, the loader can't tell if it is used
+	if _, ok := graph.Nodes.Lookup[`"eeee-tzdata-2024a"`].Attrs[Attr]; ok {
+		t.Errorf("expected tzdata to be left untagged")
+	}
+	if _, ok := report.Lookup("tzdata", ""); ok {
+		t.Errorf("expected tzdata to not be in the report")
+	}
+	if got, _ := report.Lookup("zlib", "1.3"); got != Reachable {
+		t.Errorf("Lookup(zlib) = %q", got)
+	}
+}
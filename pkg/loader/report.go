@@ -0,0 +1,131 @@
+package loader
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/awalterschulze/gographviz"
+
+	"github.com/buildsafedev/bsf/pkg/layout"
+	nixcmd "github.com/buildsafedev/bsf/pkg/nix/cmd"
+)
+
+const (
+	// Attr is the closure graph attribute holding the reachability of a component
+	Attr = "reachability"
+	// Reachable is a component the dynamic loader loads from an entrypoint
+	Reachable = "reachable"
+	// Unreachable is a component with shared libraries that no entrypoint loads
+	Unreachable = "unreachable"
+
+	// ReportName is the name of the reachability report in the output directory
+	ReportName = "reachability.json"
+)
+
+// Component is the reachability of a component of the closure
+type Component struct {
+	Name         string `json:"name"`
+	Version      string `json:"version,omitempty"`
+	StorePath    string `json:"storePath"`
+	Reachability string `json:"reachability"`
+	// LoadedBy are the entrypoints loading a library of the component
+	LoadedBy []string `json:"loadedBy,omitempty"`
+}
+
+// Report is the reachable/unreachable split of the closure
+type Report struct {
+	Entrypoints []string    `json:"entrypoints"`
+	Components  []Component `json:"components"`
+}
+
+// Annotate tags the closure graph nodes with their reachability. Components without shared libraries, such as data
+// or interpreted code, can't be classified by the loader and are left untagged.
+func Annotate(graph *gographviz.Graph, entrypoints []string, r *Result) *Report {
+	byStorePath := make(map[string][]string)
+	for path, entries := range r.LoadedBy {
+		sp := StorePath(path)
+		for _, e := range entries {
+			if !contains(byStorePath[sp], e) {
+				byStorePath[sp] = append(byStorePath[sp], e)
+			}
+		}
+	}
+
+	report := &Report{Entrypoints: entrypoints, Components: make([]Component, 0)}
+	for _, node := range graph.Nodes.Nodes {
+		storePath := "/nix/store/" + nixcmd.CleanNameFromGraph(node.Name)
+		loadedBy, reachable := byStorePath[storePath]
+
+		reachability := Reachable
+		if !reachable {
+			if !HasSharedObjects(storePath) {
+				continue
+			}
+			reachability = Unreachable
+		}
+		node.Attrs[gographviz.Attr(Attr)] = reachability
+
+		sort.Strings(loadedBy)
+		report.Components = append(report.Components, Component{
+			Name:         node.Attrs["name"],
+			Version:      node.Attrs["version"],
+			StorePath:    storePath,
+			Reachability: reachability,
+			LoadedBy:     loadedBy,
+		})
+	}
+	sort.Slice(report.Components, func(i, j int) bool {
+		return report.Components[i].StorePath < report.Components[j].StorePath
+	})
+	return report
+}
+
+// ReadReport reads the reachability report of the build in the output directory
+func ReadReport(dir string) (*Report, error) {
+	l, err := layout.Open(dir)
+	if err != nil {
+		return nil, err
+	}
+	data, err := l.Read(layout.KindReport, ReportName)
+	if err != nil {
+		return nil, fmt.Errorf("no reachability report in %s, only builds with executables are analyzed: %v", dir, err)
+	}
+	report := &Report{}
+	if err := json.Unmarshal(data, report); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// Count returns the number of reachable and unreachable components
+func (r *Report) Count() (reachable, unreachable int) {
+	for _, c := range r.Components {
+		if c.Reachability == Reachable {
+			reachable++
+		} else {
+			unreachable++
+		}
+	}
+	return reachable, unreachable
+}
+
+// Lookup returns the reachability of the component with the name and version, an empty version matches any.
+// Components that were not classified are reported as not found.
+func (r *Report) Lookup(name, version string) (string, bool) {
+	for _, c := range r.Components {
+		if c.Name == name && (version == "" || c.Version == version) {
+			return c.Reachability, true
+		}
+	}
+	return "", false
+}
+
+func contains(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,173 @@
+// Package location reads and writes the files bsf shares between machines at a location: a directory, e.g. a network
+// share, an http(s):// URL, read with GET and written with PUT, or an s3:// URL, read and written with the AWS CLI.
+package location
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	bio "github.com/buildsafedev/bsf/pkg/io"
+	"github.com/buildsafedev/bsf/pkg/toolchain"
+)
+
+// ErrNotFound is returned when the location has no file of the name
+var ErrNotFound = errors.New("not found at the location")
+
+// Get reads the file name at the location
+func Get(ctx context.Context, location, name string) ([]byte, error) {
+	remote := strings.TrimSuffix(location, "/") + "/" + name
+	switch {
+	case strings.HasPrefix(location, "s3://"):
+		found, err := s3Exists(ctx, remote)
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			return nil, fmt.Errorf("%s: %w", remote, ErrNotFound)
+		}
+
+		tmp, err := os.CreateTemp("", "bsf-location-*")
+		if err != nil {
+			return nil, err
+		}
+		tmp.Close()
+		defer os.Remove(tmp.Name())
+		if err := awsCopy(ctx, remote, tmp.Name()); err != nil {
+			return nil, err
+		}
+		return os.ReadFile(tmp.Name())
+	case strings.HasPrefix(location, "http://"), strings.HasPrefix(location, "https://"):
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, remote, nil)
+		if err != nil {
+			return nil, err
+		}
+		var buf bytes.Buffer
+		if err := doHTTP(req, &buf); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	case strings.Contains(location, "://") && !strings.HasPrefix(location, "file://"):
+		return nil, fmt.Errorf("unsupported location %s", location)
+	}
+
+	data, err := os.ReadFile(filepath.Join(strings.TrimPrefix(location, "file://"), name))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("%s: %w", remote, ErrNotFound)
+	}
+	return data, err
+}
+
+// Put writes data as the file name at the location, replacing it at once where the location allows, so machines
+// reading it never see it half written
+func Put(ctx context.Context, location, name, contentType string, data []byte) error {
+	remote := strings.TrimSuffix(location, "/") + "/" + name
+	switch {
+	case strings.HasPrefix(location, "s3://"):
+		tmp, err := writeTemp("", "bsf-location-*", data)
+		if err != nil {
+			return err
+		}
+		defer os.Remove(tmp)
+		return awsCopy(ctx, tmp, remote)
+	case strings.HasPrefix(location, "http://"), strings.HasPrefix(location, "https://"):
+		req, err := http.NewRequestWithContext(ctx, http.MethodPut, remote, bytes.NewReader(data))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", contentType)
+		return doHTTP(req, nil)
+	case strings.Contains(location, "://") && !strings.HasPrefix(location, "file://"):
+		return fmt.Errorf("unsupported location %s", location)
+	}
+
+	dir := strings.TrimPrefix(location, "file://")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	return bio.WriteAtomic(filepath.Join(dir, name), data)
+}
+
+func writeTemp(dir, pattern string, data []byte) (string, error) {
+	f, err := os.CreateTemp(dir, pattern)
+	if err != nil {
+		return "", err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+func doHTTP(req *http.Request, w io.Writer) error {
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if req.Method == http.MethodGet && resp.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("%s: %w", req.URL, ErrNotFound)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%s %s returned %s", req.Method, req.URL, resp.Status)
+	}
+	if w != nil {
+		_, err = io.Copy(w, resp.Body)
+	}
+	return err
+}
+
+// s3Exists lists the key of the s3:// URL, a missing key is an empty listing rather than an error of aws s3 cp
+func s3Exists(ctx context.Context, remote string) (bool, error) {
+	u, err := url.Parse(remote)
+	if err != nil {
+		return false, err
+	}
+	key := strings.TrimPrefix(u.Path, "/")
+	out, err := aws(ctx, "s3api", "list-objects-v2", "--bucket", u.Host, "--prefix", key, "--max-items", "1", "--query", "Contents[].Key", "--output", "json")
+	if err != nil {
+		return false, err
+	}
+
+	var keys []string
+	// an empty listing is printed as null
+	if err := json.Unmarshal(out, &keys); err != nil {
+		return false, fmt.Errorf("failed to parse the listing of %s: %v", remote, err)
+	}
+	return len(keys) > 0 && keys[0] == key, nil
+}
+
+func awsCopy(ctx context.Context, src, dst string) error {
+	_, err := aws(ctx, "s3", "cp", src, dst)
+	return err
+}
+
+func aws(ctx context.Context, args ...string) ([]byte, error) {
+	cmd := toolchain.Check(exec.CommandContext(ctx, "nix", append([]string{"run", "nixpkgs#awscli2", "--"}, args...)...))
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+	if err != nil {
+		return nil, fmt.Errorf("failed with %s", stderr.String())
+	}
+	return stdout.Bytes(), nil
+}
@@ -0,0 +1,51 @@
+package location
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestGetPut(t *testing.T) {
+	var mu sync.Mutex
+	files := make(map[string][]byte)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch r.Method {
+		case http.MethodGet:
+			data, ok := files[r.URL.Path]
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			w.Write(data)
+		case http.MethodPut:
+			var buf [1024]byte
+			n, _ := r.Body.Read(buf[:])
+			files[r.URL.Path] = buf[:n]
+		}
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	for _, loc := range []string{filepath.Join(t.TempDir(), "shared"), "file://" + t.TempDir(), server.URL + "/bsf/"} {
+		if _, err := Get(ctx, loc, "builds.jsonl"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Get(%s) = %v, want ErrNotFound", loc, err)
+		}
+		if err := Put(ctx, loc, "builds.jsonl", "application/jsonl", []byte("{}\n")); err != nil {
+			t.Fatalf("Put(%s) = %v", loc, err)
+		}
+		if data, err := Get(ctx, loc, "builds.jsonl"); err != nil || string(data) != "{}\n" {
+			t.Errorf("Get(%s) = %q, %v", loc, data, err)
+		}
+	}
+
+	if _, err := Get(ctx, "ftp://builds", "builds.jsonl"); err == nil || errors.Is(err, ErrNotFound) {
+		t.Errorf("Get() of an unsupported location = %v", err)
+	}
+}
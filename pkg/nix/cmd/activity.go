@@ -0,0 +1,128 @@
+package cmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// BuildTiming is when nix built a derivation, from the start to the stop of its build activity
+type BuildTiming struct {
+	DrvPath string    `json:"drvPath"`
+	Start   time.Time `json:"start"`
+	End     time.Time `json:"end"`
+}
+
+// Duration returns how long the derivation took to build
+func (t BuildTiming) Duration() time.Duration {
+	return t.End.Sub(t.Start)
+}
+
+var (
+	timingMu     sync.Mutex
+	timeBuilds   bool
+	buildTimings []BuildTiming
+)
+
+// SetBuildTiming times the derivations the following builds build, read from the activities nix logs in its
+// internal-json log format. The log is rendered as nix renders it with --log-format raw, without the progress bar.
+func SetBuildTiming(enabled bool) {
+	timingMu.Lock()
+	defer timingMu.Unlock()
+	timeBuilds = enabled
+	buildTimings = nil
+}
+
+// BuildTimings returns the derivations built since SetBuildTiming enabled the timing, in the order they started.
+// Derivations that were substituted or already valid aren't built, they have no timing.
+func BuildTimings() []BuildTiming {
+	timingMu.Lock()
+	defer timingMu.Unlock()
+	timings := append([]BuildTiming(nil), buildTimings...)
+	sort.SliceStable(timings, func(i, j int) bool { return timings[i].Start.Before(timings[j].Start) })
+	return timings
+}
+
+func buildTiming() bool {
+	timingMu.Lock()
+	defer timingMu.Unlock()
+	return timeBuilds
+}
+
+func addBuildTimings(timings []BuildTiming) {
+	timingMu.Lock()
+	defer timingMu.Unlock()
+	buildTimings = append(buildTimings, timings...)
+}
+
+const (
+	// activityBuild is the type of the activities building a derivation, their first field is the derivation
+	activityBuild = 105
+	// levelInfo is the verbosity of the messages nix prints without -v
+	levelInfo = 3
+)
+
+// activity is a line of the internal-json log of nix, "@nix " followed by the JSON of an event
+type activity struct {
+	Action string            `json:"action"`
+	ID     int64             `json:"id"`
+	Level  int               `json:"level"`
+	Type   int               `json:"type"`
+	Text   string            `json:"text"`
+	Msg    string            `json:"msg"`
+	Fields []json.RawMessage `json:"fields"`
+}
+
+// readActivities reads the internal-json log of nix from r, writes its messages and the activities started at the
+// info level to w and returns the timings of the builds, recorded as the events are read. Lines that aren't events
+// are written as they are.
+func readActivities(r io.Reader, w io.Writer, now func() time.Time) ([]BuildTiming, error) {
+	started := make(map[int64]BuildTiming)
+	timings := make([]BuildTiming, 0)
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64<<10), 16<<20)
+	for scanner.Scan() {
+		line := scanner.Text()
+		data, ok := strings.CutPrefix(line, "@nix ")
+		if !ok {
+			fmt.Fprintln(w, line)
+			continue
+		}
+		a := activity{}
+		if err := json.Unmarshal([]byte(data), &a); err != nil {
+			fmt.Fprintln(w, line)
+			continue
+		}
+
+		switch a.Action {
+		case "msg":
+			if a.Level <= levelInfo {
+				fmt.Fprintln(w, a.Msg)
+			}
+		case "start":
+			if a.Text != "" && a.Level <= levelInfo {
+				fmt.Fprintln(w, a.Text)
+			}
+			if a.Type != activityBuild || len(a.Fields) == 0 {
+				continue
+			}
+			var drvPath string
+			if err := json.Unmarshal(a.Fields[0], &drvPath); err == nil && drvPath != "" {
+				started[a.ID] = BuildTiming{DrvPath: drvPath, Start: now()}
+			}
+		case "stop":
+			if t, ok := started[a.ID]; ok {
+				t.End = now()
+				timings = append(timings, t)
+				delete(started, a.ID)
+			}
+		}
+	}
+	return timings, scanner.Err()
+}
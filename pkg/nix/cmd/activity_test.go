@@ -0,0 +1,41 @@
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadActivities(t *testing.T) {
+	log := strings.Join([]string{
+		`@nix {"action":"msg","level":3,"msg":"these 2 derivations will be built:"}`,
+		`@nix {"action":"start","id":1,"level":3,"parent":0,"text":"building '/nix/store/a-zlib.drv'","type":105,"fields":["/nix/store/a-zlib.drv","",1,1]}`,
+		`@nix {"action":"start","id":2,"level":5,"parent":1,"text":"querying info","type":0,"fields":[]}`,
+		`@nix {"action":"result","id":1,"type":101,"fields":["checking for gcc... yes"]}`,
+		`@nix {"action":"stop","id":2}`,
+		`@nix {"action":"stop","id":1}`,
+		`warning: Git tree is dirty`,
+		`@nix {"action":"start","id":3,"level":3,"parent":0,"text":"building '/nix/store/b-app.drv'","type":105,"fields":["/nix/store/b-app.drv","",1,1]}`,
+	}, "\n")
+
+	clock := time.Date(2024, 6, 1, 10, 0, 0, 0, time.UTC)
+	now := func() time.Time {
+		clock = clock.Add(time.Second)
+		return clock
+	}
+	var out bytes.Buffer
+	timings, err := readActivities(strings.NewReader(log), &out, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the build of b-app never stopped
+	if len(timings) != 1 || timings[0].DrvPath != "/nix/store/a-zlib.drv" || timings[0].Duration() != time.Second {
+		t.Errorf("readActivities() = %+v", timings)
+	}
+	want := "these 2 derivations will be built:\nbuilding '/nix/store/a-zlib.drv'\nwarning: Git tree is dirty\nbuilding '/nix/store/b-app.drv'\n"
+	if out.String() != want {
+		t.Errorf("readActivities() rendered %q, want %q", out.String(), want)
+	}
+}
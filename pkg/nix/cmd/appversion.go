@@ -0,0 +1,138 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/buildsafedev/bsf/pkg/git"
+)
+
+// DefaultAppVersion is the version of applications whose version can't be resolved
+const DefaultAppVersion = "0.0.0"
+
+// Sources of the version of the application
+const (
+	VersionFromFlag       = "flag"
+	VersionFromDerivation = "derivation"
+	VersionFromStorePath  = "store path"
+	VersionFromGit        = "git"
+	VersionFromDefault    = "default"
+)
+
+// AppMetadata is the name and version of the application and where the version comes from
+type AppMetadata struct {
+	Name          string
+	Version       string
+	VersionSource string
+}
+
+// metadataResolver resolves the metadata of applications, its lookups are replaced in tests
+type metadataResolver struct {
+	// derivationEnv returns the environment of the derivation of the store path, its pname, version and name
+	derivationEnv func(storePath string) (map[string]string, error)
+	// describe describes HEAD of the project with its nearest tag
+	describe func() (string, error)
+}
+
+var appMetadata = metadataResolver{derivationEnv: derivationEnv, describe: git.Describe}
+
+// ResolveAppMetadata returns the name and version of the application built at the store path. The version is the
+// one set by the user when not empty, else the one of its derivation, of its store path, of the nearest git tag of
+// the project and DefaultAppVersion at last. The name is the pname of its derivation or the name of its store path.
+func ResolveAppMetadata(storePath, version string) AppMetadata {
+	return appMetadata.resolve(storePath, version)
+}
+
+func (r metadataResolver) resolve(storePath, version string) AppMetadata {
+	var meta AppMetadata
+	if env, err := r.derivationEnv(storePath); err == nil {
+		meta.Name = env["pname"]
+		meta.Version = env["version"]
+		// derivations of mkDerivation without pname only have a name, e.g. hello-2.12.1
+		if name, v := parseDrvName(env["name"]); meta.Name == "" && v != "" {
+			meta.Name = name
+			if meta.Version == "" {
+				meta.Version = v
+			}
+		}
+		if meta.Version != "" {
+			meta.VersionSource = VersionFromDerivation
+		}
+	}
+
+	_, drvName, _ := strings.Cut(path.Base(storePath), "-")
+	name, v := parseDrvName(drvName)
+	if meta.Name == "" {
+		meta.Name = name
+	}
+	if meta.Version == "" && v != "" {
+		meta.Version, meta.VersionSource = v, VersionFromStorePath
+	}
+	if meta.Version == "" {
+		if tag, err := r.describe(); err == nil {
+			meta.Version, meta.VersionSource = versionOfTag(tag), VersionFromGit
+		}
+	}
+	if meta.Version == "" {
+		meta.Version, meta.VersionSource = DefaultAppVersion, VersionFromDefault
+	}
+
+	if version != "" {
+		meta.Version, meta.VersionSource = version, VersionFromFlag
+	}
+	return meta
+}
+
+// versionOfTag returns the version a git tag names, without the v prefix of tags such as v1.2.0
+func versionOfTag(tag string) string {
+	if v, ok := strings.CutPrefix(tag, "v"); ok && v != "" && v[0] >= '0' && v[0] <= '9' {
+		return v
+	}
+	return tag
+}
+
+// derivationEnv returns the environment of the derivation of the store path. The derivation is read from the store
+// when nix knows the deriver, nix derivation show is asked otherwise.
+func derivationEnv(storePath string) (map[string]string, error) {
+	if drvPath, err := GetDeriver(storePath); err == nil {
+		if drv, err := ReadDerivation(drvPath); err == nil {
+			return drv.Env, nil
+		}
+	}
+	return showDerivationEnv(storePath)
+}
+
+// showDerivationEnv returns the environment of the derivation nix derivation show prints for the store path
+func showDerivationEnv(storePath string) (map[string]string, error) {
+	cmd, cancel := nixCommand("nix", "derivation", "show", storePath)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, failed(cmd, err)
+	}
+	return parseDerivationShow(stdout.Bytes())
+}
+
+// parseDerivationShow returns the environment of the derivation of the output of nix derivation show, an object
+// keyed by the path of the derivation
+func parseDerivationShow(data []byte) (map[string]string, error) {
+	var drvs map[string]struct {
+		Env map[string]string `json:"env"`
+	}
+	if err := json.Unmarshal(data, &drvs); err != nil {
+		return nil, fmt.Errorf("failed to parse the derivation: %v", err)
+	}
+	if len(drvs) != 1 {
+		return nil, fmt.Errorf("expected a derivation, got %d", len(drvs))
+	}
+	for _, drv := range drvs {
+		return drv.Env, nil
+	}
+	return nil, nil
+}
@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestResolveAppMetadata(t *testing.T) {
+	noDrv := func(string) (map[string]string, error) { return nil, errors.New("no deriver") }
+	noTag := func() (string, error) { return "", errors.New("no tags") }
+	env := func(env map[string]string) func(string) (map[string]string, error) {
+		return func(string) (map[string]string, error) { return env, nil }
+	}
+	tag := func(tag string) func() (string, error) {
+		return func() (string, error) { return tag, nil }
+	}
+
+	tests := []struct {
+		name      string
+		storePath string
+		version   string
+		resolver  metadataResolver
+		want      AppMetadata
+	}{
+		{
+			name:      "derivation",
+			storePath: "/nix/store/da66gxmm6wy8shkw93x5m6c1x8gfj63r-my-app-1.0-rc1",
+			resolver:  metadataResolver{derivationEnv: env(map[string]string{"pname": "my-app", "version": "1.0-rc1"}), describe: tag("v2.0.0")},
+			want:      AppMetadata{Name: "my-app", Version: "1.0-rc1", VersionSource: VersionFromDerivation},
+		},
+		{
+			name:      "derivation without pname",
+			storePath: "/nix/store/da66gxmm6wy8shkw93x5m6c1x8gfj63r-hello-2.12.1",
+			resolver:  metadataResolver{derivationEnv: env(map[string]string{"name": "hello-2.12.1"}), describe: noTag},
+			want:      AppMetadata{Name: "hello", Version: "2.12.1", VersionSource: VersionFromDerivation},
+		},
+		{
+			name:      "store path",
+			storePath: "/nix/store/da66gxmm6wy8shkw93x5m6c1x8gfj63r-python3.11-app-0.1.0",
+			resolver:  metadataResolver{derivationEnv: noDrv, describe: tag("v2.0.0")},
+			want:      AppMetadata{Name: "python3.11-app", Version: "0.1.0", VersionSource: VersionFromStorePath},
+		},
+		{
+			name:      "git tag",
+			storePath: "/nix/store/da66gxmm6wy8shkw93x5m6c1x8gfj63r-my-app",
+			resolver:  metadataResolver{derivationEnv: env(map[string]string{"name": "my-app"}), describe: tag("v1.2.0-3-g1a2b3c4")},
+			want:      AppMetadata{Name: "my-app", Version: "1.2.0-3-g1a2b3c4", VersionSource: VersionFromGit},
+		},
+		{
+			name:      "default",
+			storePath: "/nix/store/da66gxmm6wy8shkw93x5m6c1x8gfj63r-my-app",
+			resolver:  metadataResolver{derivationEnv: noDrv, describe: noTag},
+			want:      AppMetadata{Name: "my-app", Version: DefaultAppVersion, VersionSource: VersionFromDefault},
+		},
+		{
+			name:      "flag",
+			storePath: "/nix/store/da66gxmm6wy8shkw93x5m6c1x8gfj63r-my-app-1.0",
+			version:   "1.1",
+			resolver:  metadataResolver{derivationEnv: env(map[string]string{"pname": "my-app", "version": "1.0"}), describe: noTag},
+			want:      AppMetadata{Name: "my-app", Version: "1.1", VersionSource: VersionFromFlag},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.resolver.resolve(tt.storePath, tt.version); got != tt.want {
+				t.Errorf("resolve() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseDerivationShow(t *testing.T) {
+	data := []byte(`{"/nix/store/q2f2x5dmrw9rp2ynv8xr8ix8wz6a4c8b-hello-2.12.1.drv":{"outputs":{"out":{"path":"/nix/store/da66gxmm6wy8shkw93x5m6c1x8gfj63r-hello-2.12.1"}},"env":{"pname":"hello","version":"2.12.1"}}}`)
+	env, err := parseDerivationShow(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if env["pname"] != "hello" || env["version"] != "2.12.1" {
+		t.Errorf("parseDerivationShow() = %v", env)
+	}
+
+	if _, err := parseDerivationShow([]byte(`{}`)); err == nil {
+		t.Error("parseDerivationShow() of no derivation succeeded")
+	}
+}
@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/bom-squad/protobom/pkg/sbom"
+
+	bio "github.com/buildsafedev/bsf/pkg/io"
+)
+
+// Artifact is a file of the result recorded with its digest, an executable of bin or a library of lib
+type Artifact struct {
+	// Path is the path of the file in the result, e.g. bin/app or lib/libapp.so.1
+	Path string
+	// Digest is the hex sha256 digest of the file
+	Digest  string
+	Purpose sbom.Purpose
+}
+
+// resultArtifacts returns the executables and libraries of the result, sorted by path. Executables are followed
+// to the binaries of wrappers, libraries are the files of lib, not the symlinks naming their versions.
+func resultArtifacts(storePath string) ([]Artifact, error) {
+	artifacts := make([]Artifact, 0)
+
+	entries, err := os.ReadDir(HostPath(filepath.Join(storePath, "bin")))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	for _, e := range entries {
+		// wrappers link to binaries of other store paths
+		target, err := EvalSymlinks(filepath.Join(storePath, "bin", e.Name()))
+		if err != nil {
+			continue
+		}
+		info, err := os.Stat(HostPath(target))
+		if err != nil || info.IsDir() {
+			continue
+		}
+		digest, err := bio.FileSHA256(HostPath(target))
+		if err != nil {
+			return nil, err
+		}
+		artifacts = append(artifacts, Artifact{Path: "bin/" + e.Name(), Digest: digest, Purpose: sbom.Purpose_EXECUTABLE})
+	}
+
+	entries, err = os.ReadDir(HostPath(filepath.Join(storePath, "lib")))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	for _, e := range entries {
+		if !e.Type().IsRegular() || !isLibrary(e.Name()) {
+			continue
+		}
+		digest, err := bio.FileSHA256(HostPath(filepath.Join(storePath, "lib", e.Name())))
+		if err != nil {
+			return nil, err
+		}
+		artifacts = append(artifacts, Artifact{Path: "lib/" + e.Name(), Digest: digest, Purpose: sbom.Purpose_LIBRARY})
+	}
+
+	sort.Slice(artifacts, func(i, j int) bool { return artifacts[i].Path < artifacts[j].Path })
+	return artifacts, nil
+}
+
+// isLibrary reports if the file name is the one of a shared or static library, e.g. libz.so.1.3 or libz.a
+func isLibrary(name string) bool {
+	return strings.HasSuffix(name, ".so") || strings.Contains(name, ".so.") ||
+		strings.HasSuffix(name, ".dylib") || strings.HasSuffix(name, ".a")
+}
+
+// NamedDigest is a digest of a file of the application, named as a subject of its attestations
+type NamedDigest struct {
+	Name   string
+	Digest string
+}
+
+// ArtifactDigests returns the digests of the artifacts of the application besides its binary: the other
+// executables and libraries of the result as app/bin/tool, and the manifests of each platform of an image index
+// as app@linux/arm64
+func (a *App) ArtifactDigests() []NamedDigest {
+	digests := make([]NamedDigest, 0)
+	for _, art := range a.Artifacts {
+		if art.Digest == a.BinaryHash {
+			continue
+		}
+		digests = append(digests, NamedDigest{Name: a.Name + "/" + art.Path, Digest: art.Digest})
+	}
+	if a.Image != nil {
+		for _, p := range a.Image.Platforms {
+			digests = append(digests, NamedDigest{Name: a.Name + "@" + p.Platform, Digest: p.ManifestDigest})
+		}
+	}
+	return digests
+}
@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/bom-squad/protobom/pkg/sbom"
+)
+
+func TestResultArtifacts(t *testing.T) {
+	dir := t.TempDir()
+	unwrapped := filepath.Join(dir, "unwrapped")
+	result := filepath.Join(dir, "result")
+	files := map[string]string{
+		"unwrapped/bin/.tool-wrapped": "tool binary",
+		"result/bin/app":              "app binary",
+		"result/lib/libapp.so.1.2":    "shared library",
+		"result/lib/libapp.a":         "static library",
+		"result/lib/app.pc":           "pkg-config file",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(filepath.Join(unwrapped, "bin", ".tool-wrapped"), filepath.Join(result, "bin", "tool")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("libapp.so.1.2", filepath.Join(result, "lib", "libapp.so.1")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(result, "lib", "pkgconfig"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	digest := func(s string) string {
+		sum := sha256.Sum256([]byte(s))
+		return hex.EncodeToString(sum[:])
+	}
+	want := []Artifact{
+		{Path: "bin/app", Digest: digest("app binary"), Purpose: sbom.Purpose_EXECUTABLE},
+		{Path: "bin/tool", Digest: digest("tool binary"), Purpose: sbom.Purpose_EXECUTABLE},
+		{Path: "lib/libapp.a", Digest: digest("static library"), Purpose: sbom.Purpose_LIBRARY},
+		{Path: "lib/libapp.so.1.2", Digest: digest("shared library"), Purpose: sbom.Purpose_LIBRARY},
+	}
+	got, err := resultArtifacts(result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("resultArtifacts() = %+v, want %+v", got, want)
+	}
+
+	app := &App{Name: "app", BinaryHash: digest("app binary"), Artifacts: got}
+	digests := app.ArtifactDigests()
+	if len(digests) != 3 || digests[0] != (NamedDigest{Name: "app/bin/tool", Digest: digest("tool binary")}) {
+		t.Errorf("ArtifactDigests() = %+v, want the artifacts but the binary", digests)
+	}
+}
+
+func TestResultArtifactsNoOutputs(t *testing.T) {
+	got, err := resultArtifacts(t.TempDir())
+	if err != nil || len(got) != 0 {
+		t.Errorf("resultArtifacts() = %v, %v, want no artifacts", got, err)
+	}
+}
@@ -0,0 +1,117 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// maxAttrEntries bounds the flake attribute cache, the entries of older revisions of flakes are dropped first
+const maxAttrEntries = 256
+
+var attrCacheMu sync.Mutex
+
+// attrEntry is the attribute names of an attribute set of a flake, at the revision of its flake.nix and flake.lock
+type attrEntry struct {
+	Key   string   `json:"key"`
+	Names []string `json:"names"`
+}
+
+// FlakeAttrsCachePath returns the location of the cache of flake attribute names in the local cache directory
+func FlakeAttrsCachePath() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "bsf", "flake-attrs.json"), nil
+}
+
+// flakeFingerprint identifies the revision of the flake in dir by the digest of its flake.nix and flake.lock
+func flakeFingerprint(dir string) (string, error) {
+	h := sha256.New()
+	for _, name := range []string{"flake.nix", "flake.lock"} {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil && !os.IsNotExist(err) {
+			return "", err
+		}
+		h.Write(data)
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// FlakeAttrNames returns the names of the attributes of the attribute set at attrPath of the flake in dir, e.g.
+// the images of ociImages.x86_64-linux. Names are cached until the flake changes, so shell completion only
+// evaluates the flake once.
+func FlakeAttrNames(dir, attrPath string) ([]string, error) {
+	return flakeAttrNames(dir, attrPath, evalAttrNames)
+}
+
+func flakeAttrNames(dir, attrPath string, eval func(dir, attrPath string) ([]string, error)) ([]string, error) {
+	fingerprint, err := flakeFingerprint(dir)
+	if err != nil {
+		return nil, err
+	}
+	key := fingerprint + "#" + attrPath
+
+	cachePath, cacheErr := FlakeAttrsCachePath()
+	attrCacheMu.Lock()
+	defer attrCacheMu.Unlock()
+	var entries []attrEntry
+	if cacheErr == nil {
+		if data, err := os.ReadFile(cachePath); err == nil {
+			json.Unmarshal(data, &entries)
+		}
+	}
+	for _, e := range entries {
+		if e.Key == key {
+			return e.Names, nil
+		}
+	}
+
+	names, err := eval(dir, attrPath)
+	if err != nil {
+		return nil, err
+	}
+	if cacheErr != nil {
+		return names, nil
+	}
+	entries = append(entries, attrEntry{Key: key, Names: names})
+	if len(entries) > maxAttrEntries {
+		entries = entries[len(entries)-maxAttrEntries:]
+	}
+	// the names are returned even when they can't be cached
+	if data, err := json.Marshal(entries); err == nil && os.MkdirAll(filepath.Dir(cachePath), 0755) == nil {
+		os.WriteFile(cachePath, data, 0644)
+	}
+	return names, nil
+}
+
+// evalAttrNames evaluates the names of the attributes of the attribute set of the flake
+func evalAttrNames(dir, attrPath string) ([]string, error) {
+	// relative flake references start with ./, like bsf/. in the other commands
+	ref := filepath.Clean(dir)
+	if !filepath.IsAbs(ref) {
+		ref = "./" + filepath.ToSlash(ref)
+	}
+	cmd, cancel := nixCommand("nix", "eval", "--json", ref+"#"+attrPath, "--apply", "builtins.attrNames")
+	defer cancel()
+
+	var stdout bytes.Buffer
+	var stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, failed(cmd, err)
+	}
+
+	names := make([]string, 0)
+	if err := json.Unmarshal(stdout.Bytes(), &names); err != nil {
+		return nil, err
+	}
+	return names, nil
+}
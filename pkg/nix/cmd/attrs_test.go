@@ -0,0 +1,62 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestFlakeAttrNames(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "flake.nix"), []byte("{ outputs = _: {}; }"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	evals := 0
+	eval := func(dir, attrPath string) ([]string, error) {
+		evals++
+		return []string{attrPath + "-a", attrPath + "-b"}, nil
+	}
+
+	for i := 0; i < 2; i++ {
+		got, err := flakeAttrNames(dir, "ociImages.x86_64-linux", eval)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := []string{"ociImages.x86_64-linux-a", "ociImages.x86_64-linux-b"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("flakeAttrNames() = %v, want %v", got, want)
+		}
+	}
+	if evals != 1 {
+		t.Errorf("the flake was evaluated %d times, want once", evals)
+	}
+
+	if _, err := flakeAttrNames(dir, "packages", eval); err != nil {
+		t.Fatal(err)
+	}
+	// a change of the flake invalidates its names
+	if err := os.WriteFile(filepath.Join(dir, "flake.lock"), []byte("{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := flakeAttrNames(dir, "ociImages.x86_64-linux", eval); err != nil {
+		t.Fatal(err)
+	}
+	if evals != 3 {
+		t.Errorf("the flake was evaluated %d times, want 3", evals)
+	}
+}
+
+func TestNarHashCachePaths(t *testing.T) {
+	c := &NarHashCache{entries: map[string]narHashEntry{
+		"/nix/store/bbbb-zlib-1.3":    {Hash: "z"},
+		"/nix/store/aaaa-hello-2.12":  {Hash: "h"},
+		"/tmp/not-a-store-path/hello": {Hash: "x"},
+	}}
+	want := []string{"/nix/store/aaaa-hello-2.12", "/nix/store/bbbb-zlib-1.3"}
+	if got := c.Paths(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Paths() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,134 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/buildsafedev/bsf/pkg/deadline"
+	"github.com/buildsafedev/bsf/pkg/nix/store"
+)
+
+// StoreBackend is how the paths of the local store are queried
+type StoreBackend string
+
+const (
+	// BackendDaemon queries the nix daemon over its socket
+	BackendDaemon StoreBackend = "daemon"
+	// BackendCLI runs nix-store
+	BackendCLI StoreBackend = "cli"
+	// BackendFilesystem reads the store directory, for hosts with neither a nix daemon nor the nix commands
+	BackendFilesystem StoreBackend = "filesystem"
+)
+
+// probeTimeout is how long the nix daemon has to answer the probe
+const probeTimeout = 2 * time.Second
+
+var (
+	probeMu sync.Mutex
+	backend StoreBackend
+	fsStore *store.FS
+	verbose io.Writer = io.Discard
+)
+
+// SetVerbose reports how the store is queried on stderr
+func SetVerbose(on bool) {
+	verbose = io.Discard
+	if on {
+		verbose = os.Stderr
+	}
+}
+
+// ProbeStore returns how the local store is queried, probed on first use: the nix daemon when its socket answers,
+// nix-store when it is installed and the store directory otherwise. Chroot stores are never queried from the
+// daemon, the backends that can't query a path fall back to the next one.
+func ProbeStore() StoreBackend {
+	probeMu.Lock()
+	defer probeMu.Unlock()
+	if backend != "" {
+		return backend
+	}
+
+	var reasons []error
+	if storeURI == "" {
+		ctx, cancel := context.WithTimeout(deadline.Context(), probeTimeout)
+		d, err := store.Dial(ctx, store.Socket())
+		cancel()
+		if err == nil {
+			d.Close()
+			backend = BackendDaemon
+			fmt.Fprintf(verbose, "store: querying the nix daemon at %s\n", store.Socket())
+			return backend
+		}
+		reasons = append(reasons, fmt.Errorf("no nix daemon: %v", err))
+	}
+	path, err := exec.LookPath("nix-store")
+	if err == nil {
+		backend = BackendCLI
+		fmt.Fprintf(verbose, "store: running %s (%v)\n", path, errors.Join(reasons...))
+		return backend
+	}
+	reasons = append(reasons, fmt.Errorf("no nix-store: %v", err))
+	if s, err := store.OpenFS(storeRoot); err == nil {
+		backend, fsStore = BackendFilesystem, s
+		fmt.Fprintf(verbose, "store: reading %s directly, its derivers are unknown (%v)\n", HostPath(StoreDir), errors.Join(reasons...))
+		return backend
+	}
+	// the commands report why the store can't be queried
+	backend = BackendCLI
+	fmt.Fprintf(verbose, "store: no backend available, running nix-store anyway (%v)\n", errors.Join(reasons...))
+	return backend
+}
+
+// resetStoreBackend makes the next query probe the store again, once the store changed
+func resetStoreBackend() {
+	probeMu.Lock()
+	defer probeMu.Unlock()
+	backend, fsStore = "", nil
+}
+
+// localPathInfo queries the path info of the store path without running nix-store, ok is false when nix-store has
+// to be run: the store is queried with it, or the daemon failed to answer
+func localPathInfo(storePath string) (info *store.PathInfo, ok bool, err error) {
+	ctx := deadline.Context()
+	switch ProbeStore() {
+	case BackendDaemon:
+		daemon, err := store.Dial(ctx, store.Socket())
+		if err == nil {
+			defer daemon.Close()
+			info, err = daemon.QueryPathInfo(ctx, storePath)
+		}
+		if err != nil && !errors.Is(err, store.ErrNotValid) {
+			fmt.Fprintf(verbose, "store: the nix daemon failed to query %s, running nix-store: %v\n", storePath, err)
+			return nil, false, nil
+		}
+		return info, true, err
+	case BackendFilesystem:
+		info, err := fsStore.QueryPathInfo(ctx, storePath)
+		return info, true, err
+	}
+	return nil, false, nil
+}
+
+// localClosure queries the closure of the store paths without running nix-store, ok is false when nix-store has to
+// be run
+func localClosure(roots []string) (closure *store.Graph, ok bool, err error) {
+	switch ProbeStore() {
+	case BackendDaemon:
+		closure, err := daemonClosure(roots)
+		if err != nil {
+			fmt.Fprintf(verbose, "store: the nix daemon failed to query the closure, running nix-store: %v\n", err)
+			return nil, false, nil
+		}
+		return closure, true, nil
+	case BackendFilesystem:
+		closure, err := store.Closure(deadline.Context(), fsStore, roots...)
+		return closure, true, err
+	}
+	return nil, false, nil
+}
@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestProbeStoreFilesystem(t *testing.T) {
+	// neither a nix daemon nor nix-store
+	t.Setenv("PATH", t.TempDir())
+	t.Setenv("NIX_DAEMON_SOCKET_PATH", filepath.Join(t.TempDir(), "socket"))
+
+	root := t.TempDir()
+	app := "/nix/store/da66gxmm6wy8shkw93x5m6c1x8gfj63r-app-1.0"
+	lib := "/nix/store/1vng6wj07s51jsgj338m24m0c0mw2i3k-lib-2.0"
+	for _, p := range []string{app + "/bin", lib + "/lib"} {
+		if err := os.MkdirAll(filepath.Join(root, p), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(root, app, "bin", "app"), []byte("RPATH="+lib+"/lib"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := SetStore("local?root=" + root); err != nil {
+		t.Fatal(err)
+	}
+	defer SetStore("")
+
+	if got := ProbeStore(); got != BackendFilesystem {
+		t.Fatalf("ProbeStore() = %s, want %s", got, BackendFilesystem)
+	}
+	refs, err := GetReferences(app)
+	if err != nil || !reflect.DeepEqual(refs, []string{lib}) {
+		t.Errorf("GetReferences() = %v, %v", refs, err)
+	}
+	closure, err := GetClosure(app)
+	if err != nil || !reflect.DeepEqual(closure, []string{lib, app}) {
+		t.Errorf("GetClosure() = %v, %v", closure, err)
+	}
+	if _, err := GetDeriver(app); err == nil {
+		t.Error("expected the deriver to be unknown")
+	}
+	if _, err := recordedPathInfos([]string{app}, nil); err == nil {
+		t.Error("expected the store directory to have no NAR hashes to check against")
+	}
+
+	// the backend is probed again for another store
+	if err := SetStore(""); err != nil {
+		t.Fatal(err)
+	}
+	if backend != "" {
+		t.Errorf("expected the backend to be reset, got %s", backend)
+	}
+}
+
+func TestRecordedPathInfosCLI(t *testing.T) {
+	bin := t.TempDir()
+	t.Setenv("PATH", bin)
+	t.Setenv("NIX_DAEMON_SOCKET_PATH", filepath.Join(t.TempDir(), "socket"))
+	app := "/nix/store/da66gxmm6wy8shkw93x5m6c1x8gfj63r-app-1.0"
+	pathInfo := `{"` + app + `":{"narHash":"sha256-sH8L2RKjyjiMFsMlD8XOrs2lJBDzVWGZOxTuQq8oGAQ=","narSize":120,"references":[]}}`
+	for name, script := range map[string]string{
+		"nix-store": "#!/bin/sh\nexit 1\n",
+		"nix":       "#!/bin/sh\necho '" + pathInfo + "'\n",
+	} {
+		if err := os.WriteFile(filepath.Join(bin, name), []byte(script), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	resetStoreBackend()
+	defer resetStoreBackend()
+
+	if got := ProbeStore(); got != BackendCLI {
+		t.Fatalf("ProbeStore() = %s, want %s", got, BackendCLI)
+	}
+	// nix-store -q --graph records no NAR hashes, they are queried with nix path-info
+	infos, err := recordedPathInfos([]string{app}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info := infos[app]; info == nil || info.NarSize != 120 {
+		t.Errorf("recordedPathInfos() = %v", infos)
+	}
+}
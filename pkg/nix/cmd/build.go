@@ -1,28 +1,141 @@
 package cmd
 
 import (
+	"bytes"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/buildsafedev/bsf/pkg/deadline"
 )
 
+// Parallelism limits how much work bsf and the nix commands it runs do at once
+type Parallelism struct {
+	// HashWorkers is the number of closure paths annotated at once, one per CPU when 0
+	HashWorkers int
+	// MaxJobs is the number of derivations nix builds at once, the nix configuration is used when 0
+	MaxJobs int
+	// Cores is the number of cores each nix build job can use, the nix configuration is used when 0
+	Cores int
+}
+
+var parallelism Parallelism
+
+// SetParallelism sets the parallelism of the following commands
+func SetParallelism(p Parallelism) {
+	parallelism = p
+}
+
+// fetchProxy is the proxy the fixed-output derivations of the builds are routed through
+var fetchProxy string
+
+// SetFetchProxy routes the fixed-output derivations of the following builds through the proxy, by its URL. Fetchers
+// read the proxy from the http_proxy and https_proxy variables, which nix passes to fixed-output derivations from the
+// environment of nix build, or from the impure-env setting when a daemon builds them.
+func SetFetchProxy(url string) {
+	fetchProxy = url
+}
+
+// proxyVars returns the variables routing fetchers through the fetch proxy
+func proxyVars() []string {
+	vars := make([]string, 0, 4)
+	for _, name := range []string{"http_proxy", "https_proxy", "HTTP_PROXY", "HTTPS_PROXY"} {
+		vars = append(vars, name+"="+fetchProxy)
+	}
+	return vars
+}
+
 // Build invokes nix build to build the project
 func Build(dir string, attribute string) error {
 	if attribute == "" {
 		attribute = "bsf/."
 	}
-	cmd := exec.Command("nix", "build", attribute, "-o", dir)
+	return nixBuild(dir, attribute)
+}
+
+// BuildExpr invokes nix build to build the nix expression, e.g. one of VariantExpr. The expression is evaluated
+// impurely, as builtins.getFlake of a local flake requires.
+func BuildExpr(dir string, expr string) error {
+	return nixBuild(dir, "--impure", "--expr", expr)
+}
+
+// nixBuild runs nix build with the installable arguments, linking the result to dir
+func nixBuild(dir string, installable ...string) error {
+	args := append([]string{"build"}, installable...)
+	args = append(args, "-o", dir)
+	if parallelism.MaxJobs > 0 {
+		args = append(args, "--max-jobs", strconv.Itoa(parallelism.MaxJobs))
+	}
+	if parallelism.Cores > 0 {
+		args = append(args, "--cores", strconv.Itoa(parallelism.Cores))
+	}
+	if fetchProxy != "" {
+		args = append(args, "--extra-experimental-features", "configurable-impure-env", "--option", "impure-env", strings.Join(proxyVars(), " "))
+	}
+	cmd, cancel := nixCommand("nix", args...)
+	defer cancel()
+	if fetchProxy != "" {
+		if cmd.Env == nil {
+			cmd.Env = os.Environ()
+		}
+		cmd.Env = append(cmd.Env, proxyVars()...)
+	}
 
 	cmd.Stdout = os.Stdout
 	// TODO: in future- we can pipe to stderr pipe and modify error messages to be understandable by the user
 	cmd.Stderr = os.Stderr
+	var log io.ReadCloser
+	if buildTiming() {
+		cmd.Args = append(cmd.Args, "--log-format", "internal-json")
+		cmd.Stderr = nil
+		var err error
+		if log, err = cmd.StderrPipe(); err != nil {
+			return err
+		}
+	}
 
 	if err := cmd.Start(); err != nil {
 		return fmt.Errorf("error starting command: %v", err)
 	}
+	if log != nil {
+		timings, _ := readActivities(log, os.Stderr, time.Now)
+		addBuildTimings(timings)
+		// the rest of a log the reader gave up on, so nix doesn't block writing it
+		io.Copy(os.Stderr, log)
+	}
 
 	if err := cmd.Wait(); err != nil {
-		return fmt.Errorf("error waiting for command: %v", err)
+		return fmt.Errorf("error waiting for command: %w", deadline.Wrap(cmd, err))
 	}
 	return nil
 }
+
+// BuildLog returns the log of the derivation. Nix only has it when the derivation was built locally, not substituted.
+func BuildLog(drvPath string) ([]byte, error) {
+	cmd, cancel := nixCommand("nix", "log", drvPath)
+	defer cancel()
+
+	var stdout bytes.Buffer
+	var stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+	if err != nil {
+		return nil, failed(cmd, err)
+	}
+
+	return stdout.Bytes(), nil
+}
+
+// failed returns the error of a command, with its stderr or the reason it was stopped
+func failed(cmd *exec.Cmd, err error) error {
+	if deadline.Exceeded() {
+		return deadline.Wrap(cmd, err)
+	}
+	return fmt.Errorf("failed with %s", cmd.Stderr)
+}
@@ -0,0 +1,134 @@
+package cmd
+
+import (
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/awalterschulze/gographviz"
+	"github.com/nix-community/go-nix/pkg/derivation"
+
+	"github.com/buildsafedev/bsf/pkg/nix/store"
+)
+
+// GetBuildClosureGraph returns the build-time closure of the result: the derivation that built it, the derivations
+// it depends on and the sources they were built from, as nix-store -q --graph prints it for the derivation.
+// Edges are build dependencies, or build tools when the dependency is a native build input or the builder of the
+// dependent, i.e. the toolchain that ran during its build. It also returns the path of the derivation.
+func GetBuildClosureGraph(output, symlink string) (string, *gographviz.Graph, error) {
+	drvPath, graph, err := GetDerivationGraph(output, symlink)
+	if err != nil {
+		return "", nil, err
+	}
+
+	for _, node := range graph.Nodes.Nodes {
+		if hash, err := GetNarHashFromPath("/nix/store/" + CleanNameFromGraph(node.Name)); err == nil {
+			node.Attrs["hash"] = hash
+		}
+	}
+	return drvPath, graph, nil
+}
+
+// GetDerivationGraph returns the derivation of the result and the graph of the derivations and sources its build
+// depends on, as GetBuildClosureGraph without hashing them
+func GetDerivationGraph(output, symlink string) (string, *gographviz.Graph, error) {
+	drvPath, err := GetDrvPathFromResult(output, symlink)
+	if err != nil {
+		return "", nil, err
+	}
+	graph, err := buildClosure(drvPath, ReadDerivation)
+	if err != nil {
+		return "", nil, err
+	}
+	return drvPath, graph, nil
+}
+
+// buildClosure walks the derivations from drvPath, reading them with read
+func buildClosure(drvPath string, read func(string) (*derivation.Derivation, error)) (*gographviz.Graph, error) {
+	graph := gographviz.NewGraph()
+	graph.SetName("G")
+	graph.SetDir(true)
+
+	quote := func(p string) string { return `"` + path.Base(p) + `"` }
+	addNode := func(p string) {
+		if graph.Nodes.Lookup[quote(p)] != nil {
+			return
+		}
+		node := AddGraphNode(graph, quote(p), map[string]string{
+			"label": `"` + store.Name(p) + `"`,
+			"name":  strings.TrimSuffix(store.Name(p), ".drv"),
+		})
+		if _, version, pname, err := parseNixStorePath(strings.TrimSuffix(p, ".drv")); err == nil {
+			node.Attrs["name"] = pname
+			node.Attrs["version"] = version
+		}
+	}
+
+	drvs := make(map[string]*derivation.Derivation)
+	queue := []string{drvPath}
+	for len(queue) > 0 {
+		p := queue[0]
+		queue = queue[1:]
+		if _, ok := drvs[p]; ok {
+			continue
+		}
+		drv, err := read(p)
+		if err != nil {
+			return nil, err
+		}
+		drvs[p] = drv
+		addNode(p)
+		if urls := fetchURLs(drv); len(urls) > 0 {
+			graph.Nodes.Lookup[quote(p)].Attrs["download"] = strings.Join(urls, " ")
+		}
+
+		inputs := make([]string, 0, len(drv.InputDerivations))
+		for input := range drv.InputDerivations {
+			inputs = append(inputs, input)
+		}
+		sort.Strings(inputs)
+		queue = append(queue, inputs...)
+	}
+
+	sorted := make([]string, 0, len(drvs))
+	for p := range drvs {
+		sorted = append(sorted, p)
+	}
+	sort.Strings(sorted)
+	for _, p := range sorted {
+		drv := drvs[p]
+		tools := buildTools(drv)
+		for _, src := range drv.InputSources {
+			addNode(src)
+			reftype := EdgeBuild
+			if tools[src] {
+				reftype = EdgeBuildTool
+			}
+			graph.Edges.Add(&gographviz.Edge{Src: quote(src), Dst: quote(p), Dir: true, Attrs: gographviz.Attrs{"reftype": reftype}})
+		}
+		for input, names := range drv.InputDerivations {
+			reftype := EdgeBuild
+			for _, name := range names {
+				if out, ok := drvs[input].Outputs[name]; ok && tools[out.Path] {
+					reftype = EdgeBuildTool
+				}
+			}
+			graph.Edges.Add(&gographviz.Edge{Src: quote(input), Dst: quote(p), Dir: true, Attrs: gographviz.Attrs{"reftype": reftype}})
+		}
+	}
+	return graph, nil
+}
+
+// buildTools returns the store paths of the tools that run during the build of the derivation: its native build
+// inputs and the package of its builder
+func buildTools(drv *derivation.Derivation) map[string]bool {
+	tools := make(map[string]bool)
+	for _, p := range inputPaths(drv.Env, "nativeBuildInputs", "depsBuildBuild", "propagatedNativeBuildInputs") {
+		tools[p] = true
+	}
+	if strings.HasPrefix(drv.Builder, "/nix/store/") {
+		parts := strings.SplitN(strings.TrimPrefix(drv.Builder, "/nix/store/"), "/", 2)
+		tools["/nix/store/"+parts[0]] = true
+	}
+	return tools
+}
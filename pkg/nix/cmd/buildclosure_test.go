@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/nix-community/go-nix/pkg/derivation"
+)
+
+func TestBuildClosure(t *testing.T) {
+	drvs := map[string]*derivation.Derivation{
+		"/nix/store/aaa-app-1.0.drv": {
+			Outputs:          map[string]*derivation.Output{"out": {Path: "/nix/store/xxx-app-1.0"}},
+			InputSources:     []string{"/nix/store/sss-builder.sh"},
+			InputDerivations: map[string][]string{"/nix/store/bbb-go-1.22.1.drv": {"out"}, "/nix/store/ccc-openssl-3.0.13.drv": {"dev"}},
+			Builder:          "/nix/store/yyy-bash-5.2/bin/bash",
+			Env: map[string]string{
+				"nativeBuildInputs": "/nix/store/zzz-go-1.22.1",
+				"buildInputs":       "/nix/store/www-openssl-3.0.13-dev",
+			},
+		},
+		"/nix/store/bbb-go-1.22.1.drv": {
+			Outputs:          map[string]*derivation.Output{"out": {Path: "/nix/store/zzz-go-1.22.1"}},
+			InputDerivations: map[string][]string{"/nix/store/ddd-go-1.22.1.tar.gz.drv": {"out"}},
+			Env:              map[string]string{},
+		},
+		"/nix/store/ccc-openssl-3.0.13.drv": {
+			Outputs: map[string]*derivation.Output{"dev": {Path: "/nix/store/www-openssl-3.0.13-dev"}},
+			Env:     map[string]string{},
+		},
+		"/nix/store/ddd-go-1.22.1.tar.gz.drv": {
+			Outputs: map[string]*derivation.Output{"out": {Path: "/nix/store/vvv-go-1.22.1.tar.gz"}},
+			Env:     map[string]string{"outputHash": "abc", "urls": "https://go.dev/dl/go1.22.1.src.tar.gz"},
+		},
+	}
+	read := func(p string) (*derivation.Derivation, error) {
+		if drv, ok := drvs[p]; ok {
+			return drv, nil
+		}
+		return nil, fmt.Errorf("%s not found", p)
+	}
+
+	graph, err := buildClosure("/nix/store/aaa-app-1.0.drv", read)
+	if err != nil {
+		t.Fatalf("buildClosure() error = %v", err)
+	}
+	if len(graph.Nodes.Nodes) != 5 {
+		t.Errorf("got %d nodes, want the 4 derivations and the source", len(graph.Nodes.Nodes))
+	}
+
+	goNode := graph.Nodes.Lookup[`"bbb-go-1.22.1.drv"`]
+	if goNode == nil || goNode.Attrs["name"] != "go" || goNode.Attrs["version"] != "1.22.1" {
+		t.Errorf("unexpected go node %v", goNode)
+	}
+	if tarball := graph.Nodes.Lookup[`"ddd-go-1.22.1.tar.gz.drv"`]; tarball == nil || tarball.Attrs["download"] != "https://go.dev/dl/go1.22.1.src.tar.gz" {
+		t.Errorf("download of the source not recorded: %v", tarball)
+	}
+
+	want := map[string]string{
+		`"bbb-go-1.22.1.drv"->"aaa-app-1.0.drv"`:          EdgeBuildTool,
+		`"ccc-openssl-3.0.13.drv"->"aaa-app-1.0.drv"`:     EdgeBuild,
+		`"sss-builder.sh"->"aaa-app-1.0.drv"`:             EdgeBuild,
+		`"ddd-go-1.22.1.tar.gz.drv"->"bbb-go-1.22.1.drv"`: EdgeBuild,
+	}
+	got := make(map[string]string)
+	for _, e := range graph.Edges.Edges {
+		got[e.Src+"->"+e.Dst] = e.Attrs["reftype"]
+	}
+	if len(got) != len(want) {
+		t.Errorf("got edges %v, want %v", got, want)
+	}
+	for edge, reftype := range want {
+		if got[edge] != reftype {
+			t.Errorf("edge %s is %q, want %q", edge, got[edge], reftype)
+		}
+	}
+
+	if _, err := buildClosure("/nix/store/eee-missing.drv", read); err == nil {
+		t.Error("buildClosure() of a missing derivation succeeded")
+	}
+}
+
+func TestBuildTools(t *testing.T) {
+	drv := &derivation.Derivation{
+		Builder: "/nix/store/yyy-bash-5.2/bin/bash",
+		Env:     map[string]string{"nativeBuildInputs": "/nix/store/zzz-go-1.22.1 /nix/store/ppp-pkg-config-0.29.2"},
+	}
+	tools := buildTools(drv)
+	for _, p := range []string{"/nix/store/yyy-bash-5.2", "/nix/store/zzz-go-1.22.1", "/nix/store/ppp-pkg-config-0.29.2"} {
+		if !tools[p] {
+			t.Errorf("%s is not a build tool", p)
+		}
+	}
+}
@@ -4,20 +4,28 @@ import (
 	"bytes"
 	"crypto/sha256"
 	"encoding/hex"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"io/fs"
 	"os"
-	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
 	"strings"
-	"sync"
+	"sync/atomic"
 
 	"github.com/awalterschulze/gographviz"
 	"github.com/bom-squad/protobom/pkg/sbom"
-	imgv1 "github.com/opencontainers/image-spec/specs-go/v1"
-	"zombiezen.com/go/nix/nar"
+	"golang.org/x/sync/errgroup"
 	"zombiezen.com/go/nix/nixbase32"
+
+	"github.com/buildsafedev/bsf/pkg/deadline"
+	"github.com/buildsafedev/bsf/pkg/events"
+	bio "github.com/buildsafedev/bsf/pkg/io"
+	"github.com/buildsafedev/bsf/pkg/nix/store"
+	"github.com/buildsafedev/bsf/pkg/purpose"
+	"github.com/buildsafedev/bsf/pkg/timing"
 )
 
 // App represents the application
@@ -28,164 +36,510 @@ type App struct {
 	ResultHash   string
 	ResultDigest string
 	BinaryHash   string
+	// Detection is how AppType was detected from the files of the result, with the metadata the detector
+	// extracted, nil when it is unknown
+	Detection *purpose.Detection
+	// VersionSource is where the version was resolved from, see ResolveAppMetadata
+	VersionSource string
+	// StorePath is the store path the result symlink points to
+	StorePath string
+	// Image is set when the result is a container image
+	Image *Image
+	// Slices are the architectures of the binary when it is a universal macOS binary
+	Slices []Slice
+	// Artifacts are the executables and libraries of the result with their digests, BinaryHash is the one of the
+	// executable named after the package
+	Artifacts []Artifact
+	// FHS is set when the result is built with buildFHSEnv, BinaryHash is then the one of the program it runs
+	FHS *FHSEnv
+}
+
+// ClosureOptions configures how the runtime closure graph is annotated
+type ClosureOptions struct {
+	// Depth limits full annotation to nodes up to that many levels below the result when greater than 0.
+	// Deeper nodes only get their NAR hash and the name and version from their store path.
+	Depth int
+	// Realise substitutes or rebuilds closure paths that were garbage collected
+	Realise bool
+	// Timer records how long each phase takes when set
+	Timer *timing.Recorder
+	// NoHashCache dumps every store path the store has no NAR hash of, rather than reusing the hashes cached
+	// by previous builds
+	NoHashCache bool
+	// Version overrides the version of the application resolved from its derivation
+	Version string
+	// StoreCheck is how the paths the store recorded the NAR hash of are checked against it, their hash is trusted
+	// by default
+	StoreCheck StoreCheck
 }
 
 // GetRuntimeClosureGraph returns the runtime closure graph for the project
-// TODO: we should look into adding metadata about licenses, homepage into the graph
-func GetRuntimeClosureGraph(appName, output string, symlink string) (*App, *gographviz.Graph, error) {
-	app, err := GetAppDetails(output, symlink)
+func GetRuntimeClosureGraph(appName, output string, symlink string, opts ClosureOptions) (*App, *gographviz.Graph, error) {
+	apps, graph, err := GetRuntimeClosureGraphs(appName, output, []string{symlink}, opts)
 	if err != nil {
 		return nil, nil, err
 	}
-	app.Name = appName
-	// todo: maybe we should get version from user.
-	app.Version = "0.0.0"
+	return apps[0], graph, nil
+}
 
-	cmd := exec.Command("nix-store", "-q", "--graph", output+symlink)
+// GetRuntimeClosureGraphs returns the runtime closure graph shared by several result symlinks of the project,
+// e.g. result, result-man and result-lib. The closures are queried and annotated once, so the dependencies they
+// share are hashed once. The first symlink is the application, the others are named after their output.
+func GetRuntimeClosureGraphs(appName, output string, symlinks []string, opts ClosureOptions) ([]*App, *gographviz.Graph, error) {
+	if len(symlinks) == 0 {
+		return nil, nil, errors.New("no result symlink")
+	}
 
-	var stdout bytes.Buffer
-	var stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
+	stop := opts.Timer.Start("app details")
+	apps := make([]*App, 0, len(symlinks))
+	paths := make([]string, 0, len(symlinks))
+	var meta AppMetadata
+	for i, symlink := range symlinks {
+		app, err := GetAppDetails(output, symlink)
+		if err != nil {
+			stop()
+			return nil, nil, err
+		}
+		// the other outputs are named after the application and share its version
+		if i == 0 {
+			meta = ResolveAppMetadata(app.StorePath, opts.Version)
+			if appName == "" {
+				appName = meta.Name
+			}
+		}
+		app.Name = appName
+		if i > 0 {
+			app.Name = appName + "-" + OutputName(symlink)
+		}
+		app.Version, app.VersionSource = meta.Version, meta.VersionSource
+		apps = append(apps, app)
+		paths = append(paths, filepath.Join(output, symlink))
+	}
+	stop()
 
-	err = cmd.Run()
+	roots := make([]string, 0, len(apps))
+	for _, app := range apps {
+		roots = append(roots, app.StorePath)
+	}
+	graph, infos, err := queryClosureGraph(roots, paths, opts.Timer)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed with %s", cmd.Stderr)
+		return nil, nil, err
+	}
+	if opts.StoreCheck != CheckNone && remote == nil {
+		stop = opts.Timer.Start("query path info")
+		infos, err = recordedPathInfos(roots, infos)
+		stop()
+		if err != nil {
+			return nil, nil, err
+		}
 	}
 
-	graphAst, err := gographviz.ParseString(stdout.String())
-	if err != nil {
+	stop = opts.Timer.Start("find missing paths")
+	missing := FindMissingPaths(graph)
+	stop()
+	if len(missing) > 0 && opts.Realise {
+		stop = opts.Timer.Start("realise")
+		err = Realise(missing)
+		stop()
+		if err != nil {
+			return nil, nil, err
+		}
+		missing = FindMissingPaths(graph)
+	}
+	if len(missing) > 0 {
+		return nil, nil, fmt.Errorf("closure paths are missing from the store, they may have been garbage collected:\n%s", strings.Join(missing, "\n"))
+	}
 
-		return nil, nil, fmt.Errorf("failed to parse graph: %s", err)
+	var depths map[string]int
+	if opts.Depth > 0 {
+		depths = nodeDepths(graph, roots...)
 	}
 
-	graph := gographviz.NewGraph()
-	if err := gographviz.Analyse(graphAst, graph); err != nil {
-		return nil, nil, fmt.Errorf("failed to analyse graph: %s", err)
+	var cache *NarHashCache
+	if !opts.NoHashCache {
+		if path, err := NarHashCachePath(); err == nil {
+			cache = OpenNarHashCache(path)
+		}
+	}
+	stop = opts.Timer.Start("annotate nodes")
+	addNarHashToGraph(graph, depths, opts.Depth, infos, cache, opts.StoreCheck)
+	stop()
+	// the cache only saves time, builds don't fail on it
+	cache.Save()
+
+	stop = opts.Timer.Start("classify edges")
+	ClassifyEdges(graph)
+	AnnotateFHS(graph)
+	stop()
+
+	stop = opts.Timer.Start("artifact hash")
+	defer stop()
+	for _, app := range apps {
+		host := HostPath(app.StorePath)
+		if _, err := os.Lstat(host); remote != nil && errors.Is(err, fs.ErrNotExist) {
+			// results of remote stores that aren't on this host are identified by the hash of their NAR
+			sum, err := nixbase32.DecodeString(app.ResultHash)
+			if err != nil {
+				return nil, nil, fmt.Errorf("invalid NAR hash %q of %s", app.ResultHash, app.StorePath)
+			}
+			app.BinaryHash = hex.EncodeToString(sum)
+			continue
+		}
+		format, err := DetectImageFormat(host)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to get artifact hash: %s", err)
+		}
+		if format != "" {
+			app.Image, err = GetImage(host)
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to read image: %s", err)
+			}
+			app.BinaryHash = app.Image.ConfigDigest
+			// the index names the images of every platform
+			if app.Image.IndexDigest != "" {
+				app.BinaryHash = app.Image.IndexDigest
+			}
+			continue
+		}
+		app.BinaryHash, err = artifactHash(app.StorePath)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to get artifact hash: %s", err)
+		}
+		app.Artifacts, err = resultArtifacts(app.StorePath)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to get artifact hashes: %s", err)
+		}
+		// the executable of an FHS env is a launcher script, the binary is the program it runs in the sandbox
+		app.FHS, err = DetectFHS(app.StorePath)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read the FHS env of %s: %s", app.StorePath, err)
+		}
+		if app.FHS != nil && app.FHS.Program != "" {
+			app.BinaryHash, err = bio.FileSHA256(HostPath(app.FHS.Program))
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to get artifact hash: %s", err)
+			}
+		}
+		if bin, err := resultBinary(app.StorePath); err == nil && bin != "" {
+			app.Slices, err = UniversalSlices(HostPath(bin))
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to read the slices of %s: %s", bin, err)
+			}
+		}
 	}
 
-	addNarHashToGraph(graph)
+	return apps, graph, nil
+}
 
-	app.BinaryHash, err = artifactHash(output, symlink)
+// StoreClosureGraph returns the closure graph of a store path, or of a symlink to one, with the NAR hash, name and
+// version of each path, e.g. to compare the closures of two results. Paths are not annotated further.
+func StoreClosureGraph(path string) (*gographviz.Graph, error) {
+	storePath, err := ResolveStorePath(path)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to get artifact hash: %s", err)
+		return nil, err
+	}
+	graph, infos, err := queryClosureGraph([]string{storePath}, []string{storePath}, nil)
+	if err != nil {
+		return nil, err
+	}
+	if missing := FindMissingPaths(graph); len(missing) > 0 {
+		return nil, fmt.Errorf("closure paths are missing from the store, they may have been garbage collected:\n%s", strings.Join(missing, "\n"))
 	}
 
-	return app, graph, nil
+	var cache *NarHashCache
+	if cachePath, err := NarHashCachePath(); err == nil {
+		cache = OpenNarHashCache(cachePath)
+	}
+	// without depths every node is deeper than the limit, so only hashed and named after its store path
+	addNarHashToGraph(graph, nil, 1, infos, cache, CheckNone)
+	cache.Save()
+	return graph, nil
 }
 
-func artifactHash(output, symlink string) (string, error) {
-	files, err := os.ReadDir(output + symlink)
+// OutputName returns the output a result symlink points to, e.g. man for result-man and out for result
+func OutputName(symlink string) string {
+	name := strings.TrimPrefix(filepath.Base(symlink), "result")
+	if name == "" {
+		return "out"
+	}
+	return strings.TrimPrefix(name, "-")
+}
+
+func artifactHash(storePath string) (string, error) {
+	bin, err := resultBinary(storePath)
+	if err != nil || bin == "" {
+		return "", err
+	}
+	return bio.FileSHA256(HostPath(bin))
+}
+
+// resultBinary returns the binary of the result, empty when it has no bin directory
+func resultBinary(storePath string) (string, error) {
+	files, err := os.ReadDir(HostPath(storePath))
 	if err != nil {
 		return "", err
 	}
 
 	for _, file := range files {
 		if file.Name() == "bin" {
-			binName, err := findResultBinary(output, symlink)
-			if err != nil {
-				return "", err
-			}
-			hash, err := fileSHA256(output + symlink + "/bin/" + binName)
+			binName, err := findResultBinary(storePath)
 			if err != nil {
 				return "", err
 			}
-			return hash, nil
+			// wrappers link to binaries of other store paths
+			return EvalSymlinks(filepath.Join(storePath, "bin", binName))
 		}
-		if file.Name() == "manifest.json" {
-			fbytes, err := os.ReadFile(output + symlink + "/manifest.json")
-			if err != nil {
-				return "", err
-			}
-
-			manifest := &imgv1.Manifest{}
-			err = json.Unmarshal(fbytes, manifest)
-			if err != nil {
-				return "", err
-			}
+	}
 
-			return strings.TrimPrefix(manifest.Config.Digest.String(), "sha256:"), nil
+	return "", nil
+}
 
+// FindMissingPaths returns the store paths of the graph that don't exist in the store. The closures of remote stores
+// have no missing paths, they were queried from the store rather than read on this host.
+func FindMissingPaths(graph *gographviz.Graph) []string {
+	missing := make([]string, 0)
+	if remote != nil {
+		return missing
+	}
+	for _, node := range graph.Nodes.Nodes {
+		path := "/nix/store/" + CleanNameFromGraph(node.Name)
+		if _, err := os.Lstat(HostPath(path)); errors.Is(err, fs.ErrNotExist) {
+			missing = append(missing, path)
 		}
 	}
+	sort.Strings(missing)
+	return missing
+}
 
-	return "", nil
+// Realise substitutes or builds the store paths
+func Realise(paths []string) error {
+	cmd, cancel := nixCommand("nix-store", append([]string{"--realise"}, paths...)...)
+	defer cancel()
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+	if err != nil {
+		if deadline.Exceeded() {
+			return deadline.Wrap(cmd, err)
+		}
+		return fmt.Errorf("failed to realise missing paths: %s", stderr.String())
+	}
+	return nil
 }
 
-func addNarHashToGraph(graph *gographviz.Graph) {
-	var wg sync.WaitGroup
+// nodeDepths returns how many levels below the closest root store path each node of the graph is.
+// Nodes that cannot be reached from the roots are not included.
+func nodeDepths(graph *gographviz.Graph, roots ...string) map[string]int {
+	// edges point from the dependency to the dependent
+	deps := make(map[string][]string)
+	for _, edge := range graph.Edges.Edges {
+		deps[edge.Dst] = append(deps[edge.Dst], edge.Src)
+	}
 
+	depths := make(map[string]int)
+	queue := make([]string, 0)
+	isRoot := make(map[string]bool, len(roots))
+	for _, root := range roots {
+		isRoot[root] = true
+	}
 	for _, node := range graph.Nodes.Nodes {
-		wg.Add(1)
+		if isRoot["/nix/store/"+CleanNameFromGraph(node.Name)] {
+			depths[node.Name] = 0
+			queue = append(queue, node.Name)
+		}
+	}
+
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		for _, dep := range deps[current] {
+			if _, ok := depths[dep]; ok {
+				continue
+			}
+			depths[dep] = depths[current] + 1
+			queue = append(queue, dep)
+		}
+	}
+
+	return depths
+}
+
+// ClosureOf returns the names of the graph nodes in the closure of the store path, including its own
+func ClosureOf(graph *gographviz.Graph, storePath string) map[string]bool {
+	closure := make(map[string]bool)
+	for name := range nodeDepths(graph, storePath) {
+		closure[name] = true
+	}
+	return closure
+}
 
-		go func(node *gographviz.Node) {
-			defer wg.Done()
+// Graph attributes of the paths that couldn't be hashed as they are
+const (
+	// AttrHashError is why the path couldn't be serialised, its node has no hash then
+	AttrHashError = "hash_error"
+	// AttrHashSkipped are the special files of the path, such as sockets, its hash was computed without. They are
+	// quoted, as their names can have spaces.
+	AttrHashSkipped = "hash_skipped"
+)
+
+// addNarHashToGraph annotates the nodes of the graph, at most parallelism.HashWorkers at once and one per CPU by
+// default. Paths the store has no NAR hash of are dumped, unless their hash is in the cache.
+// The NAR hashes and derivers the store recorded, when infos has
+// them, are used rather than hashing the paths again, unless check says otherwise.
+func addNarHashToGraph(graph *gographviz.Graph, depths map[string]int, maxDepth int, infos map[string]*store.PathInfo, cache *NarHashCache, check StoreCheck) {
+	var g errgroup.Group
+	n := parallelism.HashWorkers
+	if n <= 0 {
+		n = runtime.NumCPU()
+	}
+	// every node runs nix and reads derivations, a closure of thousands of paths would exhaust the processes and
+	// file descriptors of the host at once
+	g.SetLimit(n)
+	var done atomic.Int64
+	total := int64(len(graph.Nodes.Nodes))
+
+	for _, node := range graph.Nodes.Nodes {
+		node := node
+		g.Go(func() error {
+			defer func() {
+				events.Emit(events.Event{Type: events.Progress, Phase: "closure", Done: done.Add(1), Total: total})
+			}()
 			path := CleanNameFromGraph(node.Name)
-			hash, err := GetNarHashFromPath("/nix/store/" + path)
+			info := infos["/nix/store/"+path]
+			hash, err := narHash(info)
+			var skipped []string
+			switch {
+			case err != nil:
+				hash, skipped, err = cachedNarHash("/nix/store/"+path, cache)
+			// the hashes of remote stores are the ones they recorded, the paths aren't on this host
+			case check != CheckNone && remote == nil:
+				recorded := hash
+				hash, skipped, err = checkNarHash("/nix/store/"+path, recorded, check, node.Attrs)
+				if _, ok := node.Attrs[AttrHashMismatch]; ok {
+					events.Emit(events.Event{Type: events.HashMismatch, StorePath: "/nix/store/" + path, Hash: hash, Expected: recorded,
+						Repaired: node.Attrs[AttrRepaired] == "true", Error: node.Attrs[AttrRepairError]})
+				}
+			}
+			// the path is still named and versioned without its hash, the error is reported with it
 			if err != nil {
-				return
+				node.Attrs[AttrHashError] = strings.Join(strings.Fields(err.Error()), " ")
+			} else {
+				node.Attrs["hash"] = hash
+				if len(skipped) > 0 {
+					quoted := make([]string, 0, len(skipped))
+					for _, f := range skipped {
+						quoted = append(quoted, strconv.Quote(f))
+					}
+					node.Attrs[AttrHashSkipped] = strings.Join(quoted, " ")
+				}
+				if info != nil {
+					node.Attrs["narSize"] = strconv.FormatUint(info.NarSize, 10)
+				}
+				events.Emit(events.Event{Type: events.PathHashed, StorePath: "/nix/store/" + path, Hash: hash})
+			}
+			if d, ok := depths[node.Name]; maxDepth > 0 && (!ok || d > maxDepth) {
+				_, version, name, err := parseNixStorePath(path)
+				if err == nil {
+					node.Attrs["name"] = name
+					node.Attrs["version"] = version
+				}
+				return nil
 			}
 
-			node.Attrs["hash"] = hash
+			if drvPath, err := deriverOf("/nix/store/"+path, info); err == nil {
+				node.Attrs["deriver"] = drvPath
+				if urls, err := GetSourceURLs(drvPath); err == nil && len(urls) > 0 {
+					node.Attrs["download"] = strings.Join(urls, " ")
+				}
+			}
 			app, err := parseAppDetails("/nix/store/" + path)
-			if err != nil {
-				return
+			if err != nil || app.Version == "" {
+				return nil
 			}
 			node.Attrs["name"] = app.Name
 			node.Attrs["version"] = app.Version
-		}(node)
+			return nil
+		})
 	}
 
-	wg.Wait()
-	return
+	g.Wait()
 }
 
-// GetNarHashFromPath returns the sha256 hash of the nar
-func GetNarHashFromPath(path string) (string, error) {
-	h := sha256.New()
-	err := nar.DumpPath(h, path)
+// recordedPathInfos returns the path infos of the closure with the NAR hashes the store recorded, for the paths to be
+// checked against them. nix-store -q --graph prints none, they are queried with nix path-info. The store directory
+// read without nix has no record of them, its path infos are hashed from the very content they'd be checked against.
+func recordedPathInfos(roots []string, infos map[string]*store.PathInfo) (map[string]*store.PathInfo, error) {
+	if ProbeStore() == BackendFilesystem {
+		return nil, fmt.Errorf("the store is read without nix, it has no NAR hashes recorded to check the closure paths against")
+	}
+	if infos != nil {
+		return infos, nil
+	}
+	closure, err := (&pathInfoStore{uri: storeURI}).QueryClosure(deadline.Context(), roots...)
 	if err != nil {
-		return "", err
+		return nil, fmt.Errorf("failed to query the NAR hashes the store recorded: %v", err)
 	}
-
-	return nixbase32.EncodeToString(h.Sum(nil)), nil
+	return closure.Paths, nil
 }
 
-func findResultBinary(output string, symlink string) (string, error) {
-	files, err := os.ReadDir(output + symlink + "/bin")
+// cachedNarHash returns the NAR hash of the store path from the cache, dumping the path when it isn't cached. The
+// hashes of paths with skipped special files aren't cached, so the files are reported by every build.
+func cachedNarHash(storePath string, cache *NarHashCache) (string, []string, error) {
+	if hash, ok := cache.Lookup(storePath); ok {
+		return hash, nil, nil
+	}
+	hash, skipped, err := narHashOfPath(storePath)
 	if err != nil {
-		return "", err
+		return "", nil, err
 	}
-
-	for _, file := range files {
-		// As of now, I've only encountered result/bin having a single file
-		return file.Name(), nil
+	if len(skipped) == 0 {
+		cache.Store(storePath, hash)
 	}
-	return "", fmt.Errorf("no result binary found")
+	return hash, skipped, nil
 }
 
-// fileSHA256 returns the sha256 hash of the file
-func fileSHA256(filePath string) (string, error) {
-	// Open the file
-	file, err := os.Open(filePath)
+// GetNarHashFromPath returns the sha256 hash of the nar. The hashes of the paths of remote stores are the ones the
+// store recorded. Special files, such as sockets, are skipped, see store.DumpPath.
+func GetNarHashFromPath(path string) (string, error) {
+	hash, _, err := narHashOfPath(path)
+	return hash, err
+}
+
+// narHashOfPath returns the NAR hash of the path and the special files the serialisation skipped
+func narHashOfPath(path string) (string, []string, error) {
+	if remote != nil && IsStorePath(path) {
+		hash, err := remoteNarHash(path)
+		return hash, nil, err
+	}
+	h := sha256.New()
+	skipped, err := store.DumpPath(h, HostPath(path))
 	if err != nil {
-		return "", err
+		return "", nil, err
 	}
-	defer file.Close()
-
-	// Create a new SHA-256 hash
-	hash := sha256.New()
+	return nixbase32.EncodeToString(h.Sum(nil)), skipped, nil
+}
 
-	// Copy the file content to the hash
-	if _, err := io.Copy(hash, file); err != nil {
+func findResultBinary(storePath string) (string, error) {
+	files, err := os.ReadDir(filepath.Join(HostPath(storePath), "bin"))
+	if err != nil {
 		return "", err
 	}
 
-	// Get the SHA-256 checksum
-	checksum := hash.Sum(nil)
-
-	// Return the checksum as a hex string
-	return hex.EncodeToString(checksum), nil
+	if len(files) == 0 {
+		return "", fmt.Errorf("no result binary found")
+	}
+	// results with several binaries are named after the main one, e.g. bin/curl and bin/curl-config
+	_, _, name, err := parseNixStorePath(storePath)
+	if err == nil {
+		for _, file := range files {
+			if file.Name() == name {
+				return file.Name(), nil
+			}
+		}
+	}
+	return files[0].Name(), nil
 }
 
 // CleanNameFromGraph removes leading and trailing double quotes and escape characters
@@ -199,12 +553,21 @@ func CleanNameFromGraph(s string) string {
 	return s
 }
 
-// GetAppDetails checks if the symlink exists
+// GetAppDetails checks if the symlink exists and points to a store path
 func GetAppDetails(output string, symlink string) (*App, error) {
-	target, err := os.Readlink(output + symlink)
+	target, err := os.Readlink(filepath.Join(output, symlink))
 	if err != nil {
 		return nil, fmt.Errorf("failed to read symlink: %v", err)
 	}
+	// a result symlink replaced by one to the host would have the SBOM describe the wrong content
+	if err := CheckStorePath(target); err != nil {
+		return nil, fmt.Errorf("%s: %w", filepath.Join(output, symlink), err)
+	}
+	if remote == nil {
+		if _, err := EvalSymlinks(target); err != nil {
+			return nil, fmt.Errorf("%s: %w", filepath.Join(output, symlink), err)
+		}
+	}
 
 	hash, err := GetNarHashFromPath(target)
 	if err != nil {
@@ -215,20 +578,56 @@ func GetAppDetails(output string, symlink string) (*App, error) {
 		return nil, fmt.Errorf("failed to parse app details: %v", err)
 	}
 	app.ResultHash = hash
+	app.StorePath = target
+	app.Detection, err = detectPurpose(target)
+	if err != nil {
+		return nil, fmt.Errorf("failed to detect the purpose of %s: %v", target, err)
+	}
+	if app.Detection != nil {
+		app.AppType = app.Detection.Purpose
+	}
 
 	return app, nil
 }
 
-func parseAppDetails(path string) (*App, error) {
-	fs, err := os.ReadDir(path)
+// detectPurpose returns the purpose of the result, see package purpose, nil when it is unknown. The paths of remote
+// stores needn't be on this host, their purpose is unknown then.
+func detectPurpose(storePath string) (*purpose.Detection, error) {
+	host := HostPath(storePath)
+	info, err := os.Stat(host)
 	if err != nil {
+		if remote != nil && errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	// nix2container and streamLayeredImage results are files rather than directories
+	if !info.IsDir() {
+		if format, err := DetectImageFormat(host); err == nil && format != "" {
+			return &purpose.Detection{Purpose: sbom.Purpose_CONTAINER, Detector: "container", Metadata: map[string]string{"format": string(format)}}, nil
+		}
+	}
+	return purpose.Detect(host)
+}
+
+func parseAppDetails(path string) (*App, error) {
+	host := HostPath(path)
+	info, err := os.Stat(host)
+	// the paths of remote stores needn't be on this host, they're named after their path then
+	if err != nil && (remote == nil || !errors.Is(err, fs.ErrNotExist)) {
 		return nil, err
 	}
 
-	purpose := findAppType(fs)
+	if info != nil && info.IsDir() {
+		if _, err := os.ReadDir(host); err != nil {
+			return nil, err
+		}
+	}
 
-	resultDigest, version, name, err := parseNixStorePath(path)
-	if err != nil {
+	// results needn't have a version, GetRuntimeClosureGraphs resolves it from their derivation
+	resultDigest, drvName, _ := strings.Cut(strings.TrimPrefix(path, "/nix/store/"), "-")
+	name, version := parseDrvName(drvName)
+	if name == "" {
 		return nil, fmt.Errorf("invalid path: %s", path)
 	}
 
@@ -236,31 +635,31 @@ func parseAppDetails(path string) (*App, error) {
 		ResultDigest: resultDigest,
 		Name:         name,
 		Version:      version,
-		AppType:      purpose,
 	}, nil
 }
 
-// parseNixStorePath returns the digest ,  version, name from the nix store path
+// parseNixStorePath returns the digest, version and name of the package of the nix store path. Paths without a
+// version, such as sources and scripts, aren't packages.
 func parseNixStorePath(path string) (string, string, string, error) {
 	path = strings.TrimPrefix(path, "/nix/store/")
-	parts := strings.Split(path, "-")
-	if len(parts) < 3 {
+	digest, drvName, _ := strings.Cut(path, "-")
+	name, version := parseDrvName(drvName)
+	if name == "" || version == "" {
 		return "", "", "", fmt.Errorf("invalid path: %s", path)
 	}
 
-	return parts[0], parts[len(parts)-1], strings.Join(parts[1:len(parts)-1], "-"), nil
+	return digest, version, name, nil
 }
 
-func findAppType(fs []fs.DirEntry) sbom.Purpose {
-	for _, f := range fs {
-		if f.Name() == "bin" {
-			return sbom.Purpose_EXECUTABLE
-		}
-
-		if f.Name() == "manifest.json" {
-			return sbom.Purpose_CONTAINER
+// parseDrvName splits the name of a derivation into its package name and version as builtins.parseDrvName does: the
+// version starts after the first dash that isn't followed by a letter, e.g. python3.11-my-app-1.0-rc1 is
+// python3.11-my-app 1.0-rc1. The version is empty when there is no such dash.
+func parseDrvName(drvName string) (string, string) {
+	for i := 0; i < len(drvName)-1; i++ {
+		c := drvName[i+1]
+		if drvName[i] == '-' && !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z') {
+			return drvName[:i], drvName[i+1:]
 		}
 	}
-
-	return sbom.Purpose_UNKNOWN_PURPOSE
+	return drvName, ""
 }
@@ -0,0 +1,60 @@
+//go:build integration
+
+package cmd_test
+
+import (
+	"path"
+	"testing"
+
+	"github.com/buildsafedev/bsf/pkg/bsftest"
+	nixcmd "github.com/buildsafedev/bsf/pkg/nix/cmd"
+)
+
+func TestRuntimeClosureIntegration(t *testing.T) {
+	s := bsftest.NewStore(t)
+	lib := s.Add(bsftest.Package{Name: "libfoo", Version: "1.2.3", Files: map[string]string{"lib/libfoo.so": "foo"}})
+	doc := s.Add(bsftest.Package{Name: "docs", Version: "0.1", Files: map[string]string{"share/doc/README": "docs"}})
+	app := s.Add(bsftest.Package{
+		Name:    "app",
+		Version: "2.0.0",
+		Deps:    []string{lib},
+		Files:   map[string]string{"bin/app": "#!/bin/sh\necho app\n"},
+	})
+	s.Use()
+	output := s.Result(app)
+
+	details, graph, err := nixcmd.GetRuntimeClosureGraph("", output, bsftest.ResultSymlink, nixcmd.ClosureOptions{NoHashCache: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if details.Name != "app" || details.Version != "2.0.0" || details.VersionSource != nixcmd.VersionFromDerivation {
+		t.Errorf("app = %s %s from %s, want app 2.0.0 from the derivation", details.Name, details.Version, details.VersionSource)
+	}
+	if details.StorePath != app {
+		t.Errorf("StorePath = %s, want %s", details.StorePath, app)
+	}
+	if details.BinaryHash == "" {
+		t.Error("BinaryHash is empty")
+	}
+
+	closure := nixcmd.ClosureOf(graph, app)
+	if !closure[nodeName(lib)] {
+		t.Errorf("closure = %v, want %s", closure, lib)
+	}
+	if closure[nodeName(doc)] {
+		t.Errorf("closure = %v, has %s the app doesn't reference", closure, doc)
+	}
+	for _, node := range graph.Nodes.Nodes {
+		if node.Attrs["hash"] == "" {
+			t.Errorf("node %s has no NAR hash: %v", node.Name, node.Attrs)
+		}
+	}
+	if node := graph.Nodes.Lookup[nodeName(lib)]; node == nil || node.Attrs["name"] != "libfoo" || node.Attrs["version"] != "1.2.3" {
+		t.Errorf("node of %s = %v, want libfoo 1.2.3", lib, node)
+	}
+}
+
+// nodeName returns the name of the graph node of the store path
+func nodeName(storePath string) string {
+	return `"` + path.Base(storePath) + `"`
+}
@@ -1,7 +1,18 @@
 package cmd
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
 	"testing"
+
+	"github.com/awalterschulze/gographviz"
+
+	"github.com/buildsafedev/bsf/pkg/nix/store"
 )
 
 func TestParseNixStorePath(t *testing.T) {
@@ -36,6 +47,20 @@ func TestParseNixStorePath(t *testing.T) {
 			wantApp: nil,
 			wantErr: true,
 		},
+		{
+			name: "dashes in the name and version",
+			path: "/nix/store/da66gxmm6wy8shkw93x5m6c1x8gfj63r-my-app-1.0-rc1",
+			wantApp: &App{
+				ResultDigest: "da66gxmm6wy8shkw93x5m6c1x8gfj63r",
+				Name:         "my-app",
+				Version:      "1.0-rc1",
+			},
+		},
+		{
+			name:    "no version",
+			path:    "/nix/store/da66gxmm6wy8shkw93x5m6c1x8gfj63r-my-app-env",
+			wantErr: true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -63,3 +88,201 @@ func TestParseNixStorePath(t *testing.T) {
 		})
 	}
 }
+
+func TestExpandMirrorURL(t *testing.T) {
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{url: "mirror://gnu/hello/hello-2.12.1.tar.gz", want: "https://ftpmirror.gnu.org/hello/hello-2.12.1.tar.gz"},
+		{url: "mirror://unknown/foo.tar.gz", want: "mirror://unknown/foo.tar.gz"},
+		{url: "https://github.com/foo/bar/archive/v1.tar.gz", want: "https://github.com/foo/bar/archive/v1.tar.gz"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			if got := ExpandMirrorURL(tt.url); got != tt.want {
+				t.Errorf("ExpandMirrorURL() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNodeDepths(t *testing.T) {
+	graph := gographviz.NewGraph()
+	graph.SetName("G")
+	for _, n := range []string{`"aaaa-app-1.0"`, `"bbbb-curl-8.6.0"`, `"cccc-openssl-3.0.13"`, `"dddd-glibc-2.39"`, `"eeee-unrelated-1.0"`} {
+		if err := graph.AddNode("G", n, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// edges point from the dependency to the dependent
+	graph.Edges.Add(&gographviz.Edge{Src: `"bbbb-curl-8.6.0"`, Dst: `"aaaa-app-1.0"`, Dir: true})
+	graph.Edges.Add(&gographviz.Edge{Src: `"cccc-openssl-3.0.13"`, Dst: `"bbbb-curl-8.6.0"`, Dir: true})
+	graph.Edges.Add(&gographviz.Edge{Src: `"dddd-glibc-2.39"`, Dst: `"cccc-openssl-3.0.13"`, Dir: true})
+	graph.Edges.Add(&gographviz.Edge{Src: `"dddd-glibc-2.39"`, Dst: `"aaaa-app-1.0"`, Dir: true})
+
+	depths := nodeDepths(graph, "/nix/store/aaaa-app-1.0")
+
+	want := map[string]int{
+		`"aaaa-app-1.0"`:        0,
+		`"bbbb-curl-8.6.0"`:     1,
+		`"cccc-openssl-3.0.13"`: 2,
+		`"dddd-glibc-2.39"`:     1,
+	}
+	for name, d := range want {
+		if depths[name] != d {
+			t.Errorf("depth of %s = %d, want %d", name, depths[name], d)
+		}
+	}
+	if _, ok := depths[`"eeee-unrelated-1.0"`]; ok {
+		t.Errorf("unreachable node should not have a depth")
+	}
+}
+
+func TestOutputName(t *testing.T) {
+	tests := map[string]string{
+		"/result":     "out",
+		"/result-man": "man",
+		"result-lib":  "lib",
+		"/result-bin": "bin",
+	}
+	for symlink, want := range tests {
+		if got := OutputName(symlink); got != want {
+			t.Errorf("OutputName(%q) = %q, want %q", symlink, got, want)
+		}
+	}
+}
+
+func TestFindMissingPaths(t *testing.T) {
+	graph := gographviz.NewGraph()
+	graph.SetName("G")
+	if err := graph.AddNode("G", `"00000000000000000000000000000000-missing-1.0"`, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	got := FindMissingPaths(graph)
+	if len(got) != 1 || got[0] != "/nix/store/00000000000000000000000000000000-missing-1.0" {
+		t.Errorf("FindMissingPaths() = %v", got)
+	}
+}
+
+func TestAddNarHashToGraphProblems(t *testing.T) {
+	root := t.TempDir()
+	names := []string{
+		"0c0n2h2c8zsx3djq6qbd2a9qnv1jy6z0-service-1.0",
+		"1vng6wj07s51jsgj338m24m0c0mw2i3k-latin-2.0",
+		"da66gxmm6wy8shkw93x5m6c1x8gfj63r-zlib-1.3",
+	}
+	for _, name := range names {
+		if err := os.MkdirAll(filepath.Join(root, StoreDir, name, "lib"), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := syscall.Mkfifo(filepath.Join(root, StoreDir, names[0], "lib", "control"), 0644); err != nil {
+		t.Skip("can't create fifos")
+	}
+	if err := os.WriteFile(filepath.Join(root, StoreDir, names[1], "lib", "caf\xe9"), nil, 0644); err != nil {
+		t.Skip("the file system doesn't allow names that aren't UTF-8")
+	}
+	if err := SetStore(root); err != nil {
+		t.Fatal(err)
+	}
+	defer SetStore("")
+
+	graph := gographviz.NewGraph()
+	graph.SetName("G")
+	infos := make(map[string]*store.PathInfo)
+	for _, name := range names {
+		if err := graph.AddNode("G", `"`+name+`"`, nil); err != nil {
+			t.Fatal(err)
+		}
+		// no NAR hash nor deriver recorded, the paths are hashed and nix isn't queried
+		infos[StoreDir+"/"+name] = &store.PathInfo{Path: StoreDir + "/" + name}
+	}
+	addNarHashToGraph(graph, nil, 0, infos, nil, CheckNone)
+
+	service := graph.Nodes.Lookup[`"`+names[0]+`"`].Attrs
+	if service["hash"] == "" || service[AttrHashSkipped] != `"lib/control"` || service["name"] != "service" {
+		t.Errorf("unexpected attributes of the path with a fifo %v", service)
+	}
+	latin := graph.Nodes.Lookup[`"`+names[1]+`"`].Attrs
+	if latin["hash"] != "" || !strings.Contains(latin[AttrHashError], "UTF-8") || latin["version"] != "2.0" {
+		t.Errorf("unexpected attributes of the path that can't be serialised %v", latin)
+	}
+	zlib := graph.Nodes.Lookup[`"`+names[2]+`"`].Attrs
+	if zlib["hash"] == "" || zlib[AttrHashError] != "" || zlib[AttrHashSkipped] != "" {
+		t.Errorf("unexpected attributes of zlib %v", zlib)
+	}
+}
+
+func TestAddNarHashToGraphCheck(t *testing.T) {
+	root := t.TempDir()
+	intact, corrupted := "0c0n2h2c8zsx3djq6qbd2a9qnv1jy6z0-zlib-1.3", "da66gxmm6wy8shkw93x5m6c1x8gfj63r-openssl-3.0"
+	if err := os.MkdirAll(filepath.Join(root, StoreDir), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetStore(root); err != nil {
+		t.Fatal(err)
+	}
+	defer SetStore("")
+
+	write := func(name, content string) {
+		t.Helper()
+		if err := os.MkdirAll(filepath.Join(root, StoreDir, name, "lib"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(root, StoreDir, name, "lib", "lib.so"), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	infos := make(map[string]*store.PathInfo)
+	for _, name := range []string{intact, corrupted} {
+		write(name, name)
+		h := sha256.New()
+		if _, err := store.DumpPath(h, filepath.Join(root, StoreDir, name)); err != nil {
+			t.Fatal(err)
+		}
+		infos[StoreDir+"/"+name] = &store.PathInfo{Path: StoreDir + "/" + name, NarHash: hex.EncodeToString(h.Sum(nil))}
+	}
+	recorded, _ := narHash(infos[StoreDir+"/"+corrupted])
+
+	annotate := func(check StoreCheck) (gographviz.Attrs, gographviz.Attrs) {
+		graph := gographviz.NewGraph()
+		graph.SetName("G")
+		for _, name := range []string{intact, corrupted} {
+			if err := graph.AddNode("G", `"`+name+`"`, nil); err != nil {
+				t.Fatal(err)
+			}
+		}
+		addNarHashToGraph(graph, nil, 0, infos, nil, check)
+		return graph.Nodes.Lookup[`"`+intact+`"`].Attrs, graph.Nodes.Lookup[`"`+corrupted+`"`].Attrs
+	}
+
+	write(corrupted, "bit rot")
+	if _, attrs := annotate(CheckNone); attrs["hash"] != recorded || attrs[AttrHashMismatch] != "" {
+		t.Errorf("the recorded hashes should be trusted without a check, got %v", attrs)
+	}
+
+	good, bad := annotate(CheckHashes)
+	if good[AttrHashMismatch] != "" || good["hash"] == "" {
+		t.Errorf("unexpected attributes of the intact path %v", good)
+	}
+	want, actual, ok := HashMismatch(map[string]string{AttrHashMismatch: bad[AttrHashMismatch]})
+	if !ok || want != recorded || actual != bad["hash"] || actual == recorded || bad[AttrRepaired] != "" {
+		t.Errorf("unexpected attributes of the corrupted path %v", bad)
+	}
+
+	defer func() { repairStorePath = RepairPath }()
+	repairStorePath = func(string) error { return errors.New("no substituter has it") }
+	if _, bad := annotate(CheckRepair); bad[AttrRepairError] == "" || bad[AttrRepaired] != "" {
+		t.Errorf("unexpected attributes of the path that couldn't be repaired %v", bad)
+	}
+	repairStorePath = func(storePath string) error {
+		write(strings.TrimPrefix(storePath, StoreDir+"/"), corrupted)
+		return nil
+	}
+	if _, bad := annotate(CheckRepair); bad[AttrRepaired] != "true" || bad["hash"] != recorded || bad[AttrHashMismatch] == "" {
+		t.Errorf("unexpected attributes of the repaired path %v", bad)
+	}
+}
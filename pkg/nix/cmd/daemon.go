@@ -0,0 +1,119 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"path"
+
+	"github.com/awalterschulze/gographviz"
+	"zombiezen.com/go/nix/nixbase32"
+
+	"github.com/buildsafedev/bsf/pkg/deadline"
+	"github.com/buildsafedev/bsf/pkg/nix/store"
+	"github.com/buildsafedev/bsf/pkg/timing"
+)
+
+// queryClosureGraph returns the closure graph of the store paths, with the path info the store recorded when it was
+// queried from the nix daemon, the store directory or a remote store. Chroot stores and hosts without a daemon
+// socket fall back to nix-store -q --graph, queried for the result symlinks, see ProbeStore.
+func queryClosureGraph(roots, symlinks []string, timer *timing.Recorder) (*gographviz.Graph, map[string]*store.PathInfo, error) {
+	if remote != nil {
+		stop := timer.Start("query graph")
+		closure, err := remoteClosure(roots)
+		stop()
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to query the closure from the store: %v", err)
+		}
+		return ClosureGraph(closure), closure.Paths, nil
+	}
+	stop := timer.Start("query graph")
+	closure, ok, err := localClosure(roots)
+	stop()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to query the closure from the store: %v", err)
+	}
+	if ok {
+		return ClosureGraph(closure), closure.Paths, nil
+	}
+
+	cmd, cancel := nixCommand("nix-store", append([]string{"-q", "--graph"}, symlinks...)...)
+	defer cancel()
+
+	var stdout bytes.Buffer
+	var stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	stop = timer.Start("query graph")
+	err = cmd.Run()
+	stop()
+	if err != nil {
+		return nil, nil, failed(cmd, err)
+	}
+
+	stop = timer.Start("parse graph")
+	defer stop()
+	graph, err := parseClosureGraph(stdout.String())
+	if err != nil {
+		return nil, nil, err
+	}
+	return graph, nil, nil
+}
+
+// daemonClosure queries the closure of the store paths from the nix daemon
+func daemonClosure(roots []string) (*store.Graph, error) {
+	ctx := deadline.Context()
+	daemon, err := store.Dial(ctx, store.Socket())
+	if err != nil {
+		return nil, err
+	}
+	defer daemon.Close()
+
+	return store.Closure(ctx, daemon, roots...)
+}
+
+// ClosureGraph returns the closure as nix-store -q --graph prints it: nodes named after the base name of their
+// store path and edges from each reference to the path referencing it
+func ClosureGraph(closure *store.Graph) *gographviz.Graph {
+	graph := gographviz.NewGraph()
+	graph.SetName("G")
+	graph.SetDir(true)
+
+	quote := func(p string) string { return `"` + path.Base(p) + `"` }
+	for _, p := range closure.Sorted() {
+		AddGraphNode(graph, quote(p), map[string]string{"label": `"` + store.Name(p) + `"`})
+	}
+	for _, p := range closure.Sorted() {
+		for _, ref := range closure.Paths[p].References {
+			if ref == p {
+				continue
+			}
+			graph.AddEdge(quote(ref), quote(p), true, nil)
+		}
+	}
+	return graph
+}
+
+// narHash returns the NAR hash the store recorded for the path, in nixbase32 as GetNarHashFromPath returns it
+func narHash(info *store.PathInfo) (string, error) {
+	if info == nil {
+		return "", fmt.Errorf("no path info")
+	}
+	sum, err := hex.DecodeString(info.NarHash)
+	if err != nil || len(sum) != 32 {
+		return "", fmt.Errorf("invalid NAR hash %q of %s", info.NarHash, info.Path)
+	}
+	return nixbase32.EncodeToString(sum), nil
+}
+
+// deriverOf returns the deriver the store recorded for the path, querying it when the path info wasn't queried
+func deriverOf(storePath string, info *store.PathInfo) (string, error) {
+	if info == nil {
+		return GetDeriver(storePath)
+	}
+	if info.Deriver == "" {
+		return "", fmt.Errorf("no deriver known for %s", storePath)
+	}
+	return info.Deriver, nil
+}
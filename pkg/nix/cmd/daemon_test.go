@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/buildsafedev/bsf/pkg/nix/store"
+)
+
+func TestClosureGraph(t *testing.T) {
+	closure := &store.Graph{
+		Roots: []string{"/nix/store/aaa-app-1.0"},
+		Paths: map[string]*store.PathInfo{
+			"/nix/store/aaa-app-1.0":    {References: []string{"/nix/store/aaa-app-1.0", "/nix/store/bbb-curl-8.6.0", "/nix/store/ccc-glibc-2.39"}},
+			"/nix/store/bbb-curl-8.6.0": {References: []string{"/nix/store/ccc-glibc-2.39"}},
+			"/nix/store/ccc-glibc-2.39": {},
+		},
+	}
+
+	graph := ClosureGraph(closure)
+	nodes := make([]string, 0)
+	for _, node := range graph.Nodes.Nodes {
+		nodes = append(nodes, CleanNameFromGraph(node.Name))
+	}
+	wantNodes := []string{"aaa-app-1.0", "bbb-curl-8.6.0", "ccc-glibc-2.39"}
+	if !reflect.DeepEqual(nodes, wantNodes) {
+		t.Errorf("nodes = %v, want %v", nodes, wantNodes)
+	}
+	if label := graph.Nodes.Lookup[`"bbb-curl-8.6.0"`].Attrs["label"]; label != `"curl-8.6.0"` {
+		t.Errorf("label = %s, want \"curl-8.6.0\"", label)
+	}
+
+	edges := make([]string, 0)
+	for _, edge := range graph.Edges.Edges {
+		edges = append(edges, CleanNameFromGraph(edge.Src)+" -> "+CleanNameFromGraph(edge.Dst))
+	}
+	sort.Strings(edges)
+	wantEdges := []string{
+		"bbb-curl-8.6.0 -> aaa-app-1.0",
+		"ccc-glibc-2.39 -> aaa-app-1.0",
+		"ccc-glibc-2.39 -> bbb-curl-8.6.0",
+	}
+	if !reflect.DeepEqual(edges, wantEdges) {
+		t.Errorf("edges = %v, want %v", edges, wantEdges)
+	}
+
+	depths := nodeDepths(graph, "/nix/store/aaa-app-1.0")
+	if depths[`"ccc-glibc-2.39"`] != 1 || depths[`"bbb-curl-8.6.0"`] != 1 {
+		t.Errorf("nodeDepths() = %v", depths)
+	}
+}
+
+func TestNarHash(t *testing.T) {
+	tests := []struct {
+		name    string
+		info    *store.PathInfo
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "hex hash",
+			info: &store.PathInfo{NarHash: "0000000000000000000000000000000000000000000000000000000000000000"},
+			want: "0000000000000000000000000000000000000000000000000000",
+		},
+		{name: "no path info", wantErr: true},
+		{name: "invalid hash", info: &store.PathInfo{NarHash: "sha256:abc"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := narHash(tt.info)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("narHash() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("narHash() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
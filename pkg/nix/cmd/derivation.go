@@ -2,8 +2,7 @@ package cmd
 
 import (
 	"bytes"
-	"fmt"
-	"os/exec"
+	"path/filepath"
 	"strings"
 )
 
@@ -11,7 +10,8 @@ import (
 func GetDrvPathFromResult(output string, symlink string) (string, error) {
 	// TODO: check how to do this via go-nix package-
 	// found that it this information comes from narinfo but couldn't figure out how to get narinfo from go-nix
-	cmd := exec.Command("nix-store", "--query", "--deriver", output+ symlink)
+	cmd, cancel := nixCommand("nix-store", "--query", "--deriver", filepath.Join(output, symlink))
+	defer cancel()
 
 	var stdout bytes.Buffer
 	var stderr bytes.Buffer
@@ -20,7 +20,7 @@ func GetDrvPathFromResult(output string, symlink string) (string, error) {
 
 	err := cmd.Run()
 	if err != nil {
-		return "", fmt.Errorf("failed with %s", cmd.Stderr)
+		return "", failed(cmd, err)
 	}
 
 	return strings.TrimSuffix(stdout.String(), "\n"), nil
@@ -5,6 +5,8 @@ import (
 	"os"
 	"os/exec"
 	"strings"
+
+	"github.com/buildsafedev/bsf/pkg/toolchain"
 )
 
 // Develop opens a BSF development shell
@@ -20,7 +22,7 @@ func Develop() error {
 
 	// using the `path:` will let users work on the project without having to interact with git
 	if shell == "" {
-		cmd = exec.Command("nix", "develop", fmt.Sprintf("path:%s/bsf/.#devShell", dir))
+		cmd = toolchain.Check(exec.Command("nix", "develop", fmt.Sprintf("path:%s/bsf/.#devShell", dir)))
 	} else {
 		if strings.Contains(shell, " ") {
 			shells = strings.Split(shell, " ")
@@ -30,7 +32,7 @@ func Develop() error {
 			shells = strings.Split(shell, ";")
 		}
 
-		cmd = exec.Command("nix", "develop", fmt.Sprintf("path:%s/bsf/.#devShell", dir), "-c", shells[0])
+		cmd = toolchain.Check(exec.Command("nix", "develop", fmt.Sprintf("path:%s/bsf/.#devShell", dir), "-c", shells[0]))
 
 	}
 	// Connect the command's stdin, stdout, and stderr to the terminal
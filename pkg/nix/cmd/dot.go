@@ -0,0 +1,394 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/awalterschulze/gographviz"
+)
+
+// DOTError is a syntax error of a DOT graph, at the offset of the input it was found at
+type DOTError struct {
+	// Offset is the byte offset of the error, Line and Column its line and column in runes, from 1
+	Offset int
+	Line   int
+	Column int
+	Msg    string
+}
+
+func (e *DOTError) Error() string {
+	return fmt.Sprintf("line %d, column %d (offset %d): %s", e.Line, e.Column, e.Offset, e.Msg)
+}
+
+// ParseClosureDOT parses the closure graph nix-store -q --graph prints: a digraph of node statements with attributes,
+// edge statements from each reference to the path referencing it and default attributes, which are ignored. Nodes
+// are named as gographviz names them, quoted, and duplicate edges are dropped. It reads the names of paths of any
+// length and encoding, where gographviz fails on some of them.
+func ParseClosureDOT(data string) (*gographviz.Graph, error) {
+	p := &dotParser{data: data}
+	if err := p.parse(); err != nil {
+		return nil, err
+	}
+	return p.graph, nil
+}
+
+// parseClosureGraph parses the output of nix-store -q --graph, with gographviz when it isn't the dialect nix prints
+func parseClosureGraph(data string) (*gographviz.Graph, error) {
+	graph, err := ParseClosureDOT(data)
+	if err == nil {
+		return graph, nil
+	}
+
+	graphAst, gerr := gographviz.ParseString(data)
+	if gerr != nil {
+		return nil, fmt.Errorf("failed to parse graph: %v", err)
+	}
+	graph = gographviz.NewGraph()
+	if gerr := gographviz.Analyse(graphAst, graph); gerr != nil {
+		return nil, fmt.Errorf("failed to analyse graph: %s", gerr)
+	}
+	return graph, nil
+}
+
+// token kinds of DOT
+const (
+	tokEOF = iota
+	tokID
+	tokQuoted
+	tokPunct
+	tokArrow
+)
+
+type dotToken struct {
+	kind int
+	// text is the identifier or punctuation, the unescaped value of quoted strings
+	text   string
+	offset int
+}
+
+func (t dotToken) String() string {
+	switch t.kind {
+	case tokEOF:
+		return "end of input"
+	case tokQuoted:
+		return fmt.Sprintf("%q", t.text)
+	}
+	return "'" + t.text + "'"
+}
+
+type dotParser struct {
+	data  string
+	pos   int
+	tok   dotToken
+	graph *gographviz.Graph
+	edges map[[2]string]bool
+}
+
+func (p *dotParser) errorf(offset int, format string, args ...any) error {
+	line, col := 1, 1
+	for _, r := range p.data[:offset] {
+		if r == '\n' {
+			line, col = line+1, 1
+		} else {
+			col++
+		}
+	}
+	return &DOTError{Offset: offset, Line: line, Column: col, Msg: fmt.Sprintf(format, args...)}
+}
+
+// next reads the next token, skipping spaces and comments
+func (p *dotParser) next() error {
+	for p.pos < len(p.data) {
+		c := p.data[p.pos]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			p.pos++
+			continue
+		case strings.HasPrefix(p.data[p.pos:], "//"), c == '#' && (p.pos == 0 || p.data[p.pos-1] == '\n'):
+			end := strings.IndexByte(p.data[p.pos:], '\n')
+			if end < 0 {
+				p.pos = len(p.data)
+			} else {
+				p.pos += end
+			}
+			continue
+		case strings.HasPrefix(p.data[p.pos:], "/*"):
+			end := strings.Index(p.data[p.pos+2:], "*/")
+			if end < 0 {
+				return p.errorf(p.pos, "unterminated comment")
+			}
+			p.pos += end + 4
+			continue
+		}
+		break
+	}
+
+	start := p.pos
+	if p.pos >= len(p.data) {
+		p.tok = dotToken{kind: tokEOF, offset: start}
+		return nil
+	}
+
+	c := p.data[p.pos]
+	switch {
+	case c == '"':
+		var b strings.Builder
+		for p.pos++; p.pos < len(p.data); p.pos++ {
+			switch p.data[p.pos] {
+			case '"':
+				p.pos++
+				p.tok = dotToken{kind: tokQuoted, text: b.String(), offset: start}
+				return nil
+			case '\\':
+				// only quotes are escaped, other backslashes are part of the string
+				if p.pos+1 < len(p.data) && p.data[p.pos+1] == '"' {
+					p.pos++
+				}
+			}
+			b.WriteByte(p.data[p.pos])
+		}
+		return p.errorf(start, "unterminated string")
+	case strings.HasPrefix(p.data[p.pos:], "->"):
+		p.pos += 2
+		p.tok = dotToken{kind: tokArrow, text: "->", offset: start}
+		return nil
+	case strings.ContainsRune("{}[]=;,", rune(c)):
+		p.pos++
+		p.tok = dotToken{kind: tokPunct, text: string(c), offset: start}
+		return nil
+	}
+
+	for p.pos < len(p.data) {
+		r, size := utf8.DecodeRuneInString(p.data[p.pos:])
+		if r == utf8.RuneError && size <= 1 {
+			return p.errorf(p.pos, "invalid UTF-8")
+		}
+		// identifiers are letters, digits, underscores and non-ASCII characters, numerals may have a sign and dots
+		if !(r >= 0x80 || r == '_' || r == '.' || r == '-' && !strings.HasPrefix(p.data[p.pos:], "->") ||
+			'a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9') {
+			break
+		}
+		p.pos += size
+	}
+	if p.pos == start {
+		r, _ := utf8.DecodeRuneInString(p.data[p.pos:])
+		return p.errorf(start, "unexpected character %q", r)
+	}
+	p.tok = dotToken{kind: tokID, text: p.data[start:p.pos], offset: start}
+	return nil
+}
+
+// expect reads the punctuation
+func (p *dotParser) expect(punct string) error {
+	if p.tok.kind != tokPunct || p.tok.text != punct {
+		return p.errorf(p.tok.offset, "expected '%s', got %s", punct, p.tok)
+	}
+	return p.next()
+}
+
+// id reads an identifier or quoted string
+func (p *dotParser) id(what string) (string, error) {
+	if p.tok.kind != tokID && p.tok.kind != tokQuoted {
+		return "", p.errorf(p.tok.offset, "expected %s, got %s", what, p.tok)
+	}
+	text := p.tok.text
+	return text, p.next()
+}
+
+func (p *dotParser) parse() error {
+	if err := p.next(); err != nil {
+		return err
+	}
+	if p.tok.kind == tokID && strings.EqualFold(p.tok.text, "strict") {
+		if err := p.next(); err != nil {
+			return err
+		}
+	}
+	if p.tok.kind != tokID || !strings.EqualFold(p.tok.text, "digraph") {
+		return p.errorf(p.tok.offset, "expected 'digraph', got %s", p.tok)
+	}
+	if err := p.next(); err != nil {
+		return err
+	}
+	name := "G"
+	if p.tok.kind == tokID || p.tok.kind == tokQuoted {
+		name = p.tok.text
+		if err := p.next(); err != nil {
+			return err
+		}
+	}
+	if err := p.expect("{"); err != nil {
+		return err
+	}
+
+	p.graph = gographviz.NewGraph()
+	p.graph.SetName(name)
+	p.graph.SetDir(true)
+	p.edges = make(map[[2]string]bool)
+	for p.tok.kind != tokPunct || p.tok.text != "}" {
+		if p.tok.kind == tokEOF {
+			return p.errorf(p.tok.offset, "expected '}', got %s", p.tok)
+		}
+		if err := p.statement(); err != nil {
+			return err
+		}
+	}
+	if err := p.next(); err != nil {
+		return err
+	}
+	if p.tok.kind != tokEOF {
+		return p.errorf(p.tok.offset, "expected end of input, got %s", p.tok)
+	}
+	return nil
+}
+
+// statement reads a node, edge, attribute or default attributes statement
+func (p *dotParser) statement() error {
+	if p.tok.kind == tokPunct && p.tok.text == ";" {
+		return p.next()
+	}
+	if p.tok.kind == tokID {
+		switch strings.ToLower(p.tok.text) {
+		case "graph", "node", "edge":
+			// default attributes don't describe the closure
+			if err := p.next(); err != nil {
+				return err
+			}
+			_, err := p.attributes()
+			return err
+		case "subgraph":
+			return p.errorf(p.tok.offset, "subgraphs are not supported")
+		}
+	}
+
+	start := p.tok.offset
+	first, err := p.id("a node")
+	if err != nil {
+		return err
+	}
+	if p.tok.kind == tokPunct && p.tok.text == "=" {
+		// graph attributes, e.g. rankdir = LR
+		if err := p.next(); err != nil {
+			return err
+		}
+		_, err := p.id("a value")
+		return err
+	}
+
+	nodes := []string{first}
+	for p.tok.kind == tokArrow {
+		if err := p.next(); err != nil {
+			return err
+		}
+		node, err := p.id("a node")
+		if err != nil {
+			return err
+		}
+		nodes = append(nodes, node)
+	}
+	attrs, err := p.attributes()
+	if err != nil {
+		return err
+	}
+
+	for _, n := range nodes {
+		p.addNode(n)
+	}
+	if len(nodes) == 1 {
+		node := p.graph.Nodes.Lookup[quoteDOT(first)]
+		for k, v := range attrs {
+			node.Attrs[gographviz.Attr(k)] = v
+		}
+		return nil
+	}
+	for i := 1; i < len(nodes); i++ {
+		src, dst := quoteDOT(nodes[i-1]), quoteDOT(nodes[i])
+		if p.edges[[2]string{src, dst}] {
+			continue
+		}
+		p.edges[[2]string{src, dst}] = true
+		if err := p.graph.AddEdge(src, dst, true, nil); err != nil {
+			return p.errorf(start, "%v", err)
+		}
+		edge := p.graph.Edges.Edges[len(p.graph.Edges.Edges)-1]
+		for k, v := range attrs {
+			edge.Attrs[gographviz.Attr(k)] = v
+		}
+	}
+	return nil
+}
+
+// attributes reads the attribute lists of a statement and the semicolon ending it. Values are quoted as gographviz
+// keeps them.
+func (p *dotParser) attributes() (map[string]string, error) {
+	attrs := make(map[string]string)
+	for p.tok.kind == tokPunct && p.tok.text == "[" {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		for p.tok.kind != tokPunct || p.tok.text != "]" {
+			quoted := p.tok.kind == tokQuoted
+			key, err := p.id("an attribute or ']'")
+			if err != nil {
+				return nil, err
+			}
+			if quoted {
+				key = quoteDOT(key)
+			}
+			if err := p.expect("="); err != nil {
+				return nil, err
+			}
+			quoted = p.tok.kind == tokQuoted
+			value, err := p.id("an attribute value")
+			if err != nil {
+				return nil, err
+			}
+			if quoted {
+				value = quoteDOT(value)
+			}
+			attrs[key] = value
+			if p.tok.kind == tokPunct && (p.tok.text == "," || p.tok.text == ";") {
+				if err := p.next(); err != nil {
+					return nil, err
+				}
+			}
+		}
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+	}
+	if p.tok.kind == tokPunct && p.tok.text == ";" {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+	}
+	return attrs, nil
+}
+
+// addNode adds the node unless the graph has it
+func (p *dotParser) addNode(name string) {
+	if _, ok := p.graph.Nodes.Lookup[quoteDOT(name)]; ok {
+		return
+	}
+	AddGraphNode(p.graph, quoteDOT(name), nil)
+}
+
+// AddGraphNode adds the node to the graph unless it has it, sets the attributes and returns it. The attributes of the
+// nodes are ours, they are set on the node directly and bypass the validation of graphviz attributes.
+func AddGraphNode(graph *gographviz.Graph, name string, attrs map[string]string) *gographviz.Node {
+	node, ok := graph.Nodes.Lookup[name]
+	if !ok {
+		graph.AddNode(graph.Name, name, nil)
+		node = graph.Nodes.Lookup[name]
+	}
+	for k, v := range attrs {
+		node.Attrs[gographviz.Attr(k)] = v
+	}
+	return node
+}
+
+// quoteDOT quotes the string as DOT does, CleanNameFromGraph unquotes it
+func quoteDOT(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, `\"`) + `"`
+}
@@ -0,0 +1,188 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/awalterschulze/gographviz"
+)
+
+const nixStoreGraph = `digraph G {
+"bbb-curl-8.6.0" [label = "curl-8.6.0", shape = box, style = filled, fillcolor = "#ff0000"];
+"ccc-glibc-2.39" -> "bbb-curl-8.6.0" [color = "red"];
+"aaa-app-1.0" [label = "app-1.0", shape = box, style = filled, fillcolor = "#ff0000"];
+"bbb-curl-8.6.0" -> "aaa-app-1.0" [color = "black"];
+"ccc-glibc-2.39" -> "aaa-app-1.0" [color = "black"];
+"ccc-glibc-2.39" [label = "glibc-2.39", shape = box, style = filled, fillcolor = "#ff0000"];
+}
+`
+
+// graphSummary returns the nodes with their labels and the edges of the graph, sorted
+func graphSummary(g *gographviz.Graph) ([]string, []string) {
+	nodes := make([]string, 0, len(g.Nodes.Nodes))
+	for _, n := range g.Nodes.Nodes {
+		nodes = append(nodes, CleanNameFromGraph(n.Name)+" "+n.Attrs["label"])
+	}
+	edges := make([]string, 0, len(g.Edges.Edges))
+	for _, e := range g.Edges.Edges {
+		edges = append(edges, CleanNameFromGraph(e.Src)+" -> "+CleanNameFromGraph(e.Dst))
+	}
+	sort.Strings(nodes)
+	sort.Strings(edges)
+	return nodes, edges
+}
+
+func TestParseClosureDOT(t *testing.T) {
+	graph, err := ParseClosureDOT(nixStoreGraph)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ast, err := gographviz.ParseString(nixStoreGraph)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := gographviz.NewGraph()
+	if err := gographviz.Analyse(ast, want); err != nil {
+		t.Fatal(err)
+	}
+
+	nodes, edges := graphSummary(graph)
+	wantNodes, wantEdges := graphSummary(want)
+	if !reflect.DeepEqual(nodes, wantNodes) {
+		t.Errorf("nodes = %v, want %v", nodes, wantNodes)
+	}
+	if !reflect.DeepEqual(edges, wantEdges) {
+		t.Errorf("edges = %v, want %v", edges, wantEdges)
+	}
+	if color := graph.Edges.SrcToDsts[`"ccc-glibc-2.39"`][`"bbb-curl-8.6.0"`][0].Attrs["color"]; color != `"red"` {
+		t.Errorf("color = %s, want \"red\"", color)
+	}
+	if depths := nodeDepths(graph, "/nix/store/aaa-app-1.0"); depths[`"ccc-glibc-2.39"`] != 1 {
+		t.Errorf("nodeDepths() = %v", depths)
+	}
+}
+
+func TestParseClosureDOTErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		dot        string
+		wantOffset int
+		wantLine   int
+		wantColumn int
+	}{
+		{name: "not a digraph", dot: "graph G {}", wantOffset: 0, wantLine: 1, wantColumn: 1},
+		{name: "unterminated string", dot: "digraph G {\n\"aaa-app-1.0 [label = \"app\"];\n}", wantOffset: 38, wantLine: 2, wantColumn: 27},
+		{name: "missing attribute value", dot: "digraph G {\n\"aaa-app-1.0\" [label = ];\n}", wantOffset: 35, wantLine: 2, wantColumn: 24},
+		{name: "unicode before the error", dot: "digraph G {\n\"aaa-ünï-1.0\" -> ;\n}", wantOffset: 31, wantLine: 2, wantColumn: 18},
+		{name: "missing closing brace", dot: "digraph G {\n\"aaa-app-1.0\";\n", wantOffset: 27, wantLine: 3, wantColumn: 1},
+		{name: "trailing statements", dot: "digraph G {} \"aaa-app-1.0\"", wantOffset: 13, wantLine: 1, wantColumn: 14},
+		{name: "invalid UTF-8", dot: "digraph G {\n\xff}", wantOffset: 12, wantLine: 2, wantColumn: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseClosureDOT(tt.dot)
+			var dotErr *DOTError
+			if !errors.As(err, &dotErr) {
+				t.Fatalf("ParseClosureDOT() error = %v, want a DOTError", err)
+			}
+			if dotErr.Offset != tt.wantOffset || dotErr.Line != tt.wantLine || dotErr.Column != tt.wantColumn {
+				t.Errorf("ParseClosureDOT() error = %v, want offset %d, line %d, column %d", err, tt.wantOffset, tt.wantLine, tt.wantColumn)
+			}
+		})
+	}
+}
+
+// generateClosureDOT prints a random closure as nix-store -q --graph does, with the quirks of real closures: names
+// out of the ASCII range, very long names, escaped quotes, comments, edges printed several times and references
+// printed before the path they reference
+func generateClosureDOT(rng *rand.Rand) (string, []string, []string) {
+	parts := []string{"glibc", "python3.11-ünïcode", "日本語", "lib\\\"quoted\\\"", strings.Repeat("long", 500), "emoji-😀"}
+	n := 1 + rng.Intn(30)
+	names := make([]string, n)
+	for i := range names {
+		names[i] = fmt.Sprintf("%032d-%s-%d.%d", i, parts[rng.Intn(len(parts))], rng.Intn(10), i)
+	}
+
+	var b strings.Builder
+	b.WriteString("digraph G {\n")
+	nodes := make([]string, 0, n)
+	edges := make(map[string]bool)
+	for i, name := range names {
+		label := name[33:]
+		if rng.Intn(5) == 0 {
+			b.WriteString("// a comment\n")
+		}
+		b.WriteString(fmt.Sprintf("\"%s\" [label = \"%s\", shape = box, style = filled, fillcolor = \"#ff0000\"];\n", name, label))
+		clean := strings.ReplaceAll(name, `\"`, `"`)
+		nodes = append(nodes, clean+" \""+label+"\"")
+		for j := 0; j < i && j < 5; j++ {
+			dep := names[rng.Intn(i)]
+			for k := 0; k < 1+rng.Intn(3); k++ {
+				b.WriteString(fmt.Sprintf("\"%s\" -> \"%s\" [color = \"black\"];\n", dep, name))
+			}
+			edges[strings.ReplaceAll(dep, `\"`, `"`)+" -> "+clean] = true
+		}
+	}
+	b.WriteString("}\n")
+
+	edgeList := make([]string, 0, len(edges))
+	for e := range edges {
+		edgeList = append(edgeList, e)
+	}
+	sort.Strings(nodes)
+	sort.Strings(edgeList)
+	return b.String(), nodes, edgeList
+}
+
+func TestParseGeneratedClosures(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 200; i++ {
+		dot, wantNodes, wantEdges := generateClosureDOT(rng)
+		graph, err := ParseClosureDOT(dot)
+		if err != nil {
+			t.Fatalf("ParseClosureDOT() error = %v\n%s", err, dot)
+		}
+		nodes, edges := graphSummary(graph)
+		if !reflect.DeepEqual(nodes, wantNodes) {
+			t.Fatalf("nodes = %v, want %v", nodes, wantNodes)
+		}
+		if !reflect.DeepEqual(edges, wantEdges) {
+			t.Fatalf("edges = %v, want %v", edges, wantEdges)
+		}
+	}
+}
+
+func FuzzParseClosureDOT(f *testing.F) {
+	f.Add(nixStoreGraph)
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 10; i++ {
+		dot, _, _ := generateClosureDOT(rng)
+		f.Add(dot)
+	}
+
+	f.Fuzz(func(t *testing.T, dot string) {
+		graph, err := ParseClosureDOT(dot)
+		if err != nil {
+			var dotErr *DOTError
+			if !errors.As(err, &dotErr) {
+				t.Fatalf("ParseClosureDOT() error = %v, want a DOTError", err)
+			}
+			if dotErr.Offset < 0 || dotErr.Offset > len(dot) {
+				t.Fatalf("error offset %d out of the input of %d bytes", dotErr.Offset, len(dot))
+			}
+			return
+		}
+		for _, e := range graph.Edges.Edges {
+			if graph.Nodes.Lookup[e.Src] == nil || graph.Nodes.Lookup[e.Dst] == nil {
+				t.Fatalf("edge %s -> %s between unknown nodes", e.Src, e.Dst)
+			}
+		}
+	})
+}
@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"strings"
+
+	"github.com/awalterschulze/gographviz"
+)
+
+const (
+	// EdgeRuntime is a reference the output retains at runtime
+	EdgeRuntime = "runtime"
+	// EdgePropagated is a runtime reference that is also a propagated build input
+	EdgePropagated = "propagated"
+	// EdgeBuild is a build input that is not referenced at runtime
+	EdgeBuild = "build"
+	// EdgeBuildTool is a build input that runs during the build of the dependent, e.g. its compiler
+	EdgeBuildTool = "buildtool"
+)
+
+// ClassifyEdges stores the reference type of every edge in the "reftype" attribute, using the derivations recorded in the
+// "deriver" attribute of the nodes. Build inputs between nodes of the closure that are not runtime references are added as edges.
+// Edges point from the dependency to the dependent, as in nix-store --graph.
+func ClassifyEdges(graph *gographviz.Graph) {
+	byPath := make(map[string]string, len(graph.Nodes.Nodes))
+	for _, node := range graph.Nodes.Nodes {
+		byPath["/nix/store/"+CleanNameFromGraph(node.Name)] = node.Name
+	}
+
+	runtime := make(map[string]map[string]bool)
+	for _, edge := range graph.Edges.Edges {
+		if runtime[edge.Dst] == nil {
+			runtime[edge.Dst] = make(map[string]bool)
+		}
+		runtime[edge.Dst][edge.Src] = true
+		edge.Attrs["reftype"] = EdgeRuntime
+	}
+
+	for _, node := range graph.Nodes.Nodes {
+		drvPath := node.Attrs["deriver"]
+		if drvPath == "" {
+			continue
+		}
+		drv, err := ReadDerivation(drvPath)
+		if err != nil {
+			continue
+		}
+
+		propagated := make(map[string]bool)
+		for _, p := range inputPaths(drv.Env, "propagatedBuildInputs", "propagatedNativeBuildInputs") {
+			propagated[p] = true
+		}
+
+		for _, edge := range graph.Edges.Edges {
+			if edge.Dst == node.Name && propagated["/nix/store/"+CleanNameFromGraph(edge.Src)] {
+				edge.Attrs["reftype"] = EdgePropagated
+			}
+		}
+
+		for _, p := range inputPaths(drv.Env, "buildInputs", "nativeBuildInputs") {
+			dep, ok := byPath[p]
+			if !ok || dep == node.Name || runtime[node.Name][dep] {
+				continue
+			}
+			graph.Edges.Add(&gographviz.Edge{
+				Src:   dep,
+				Dst:   node.Name,
+				Dir:   true,
+				Attrs: gographviz.Attrs{"reftype": EdgeBuild},
+			})
+			if runtime[node.Name] == nil {
+				runtime[node.Name] = make(map[string]bool)
+			}
+			runtime[node.Name][dep] = true
+		}
+	}
+}
+
+// inputPaths returns the store paths listed in the environment variables of a derivation
+func inputPaths(env map[string]string, keys ...string) []string {
+	paths := make([]string, 0)
+	for _, k := range keys {
+		for _, p := range strings.Fields(env[k]) {
+			if strings.HasPrefix(p, "/nix/store/") {
+				paths = append(paths, p)
+			}
+		}
+	}
+	return paths
+}
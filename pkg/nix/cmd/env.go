@@ -0,0 +1,129 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// keptVars are the variables of the environment of bsf nix commands run with. The rest, NIX_PATH, NIX_CONFIG or
+// NIXPKGS_ALLOW_UNFREE among them, could change what nix evaluates without showing in the project.
+var keptVars = []string{
+	"PATH", "HOME", "USER", "LOGNAME", "TERM",
+	"NIX_REMOTE", "NIX_SSL_CERT_FILE", "SSL_CERT_FILE",
+	"XDG_CACHE_HOME", "XDG_RUNTIME_DIR",
+}
+
+// Environment controls the environment nix commands run with
+type Environment struct {
+	// Inherit runs nix commands with the environment of bsf, unscrubbed
+	Inherit bool
+	// Keep are the variables kept in addition to the defaults, e.g. NIX_CONFIG for access tokens
+	Keep []string
+}
+
+// EnvironmentRecord is the effective environment of the nix commands, as recorded in provenance.
+// Only the names of the kept and removed variables are recorded, their values can be secrets or personal.
+type EnvironmentRecord struct {
+	Scrubbed bool              `json:"scrubbed"`
+	Set      map[string]string `json:"set,omitempty"`
+	Kept     []string          `json:"kept,omitempty"`
+	Removed  []string          `json:"removed,omitempty"`
+}
+
+var (
+	environment Environment
+	tempDirOnce sync.Once
+	tempDirErr  error
+)
+
+// SetEnvironment sets the environment of the following commands
+func SetEnvironment(e Environment) {
+	environment = e
+}
+
+// TempDir is the TMPDIR of nix commands. It depends on the user only, not on the TMPDIR of bsf, so the paths
+// nix writes in its temporary files are the same from one run to the next.
+func TempDir() string {
+	return filepath.Join("/tmp", fmt.Sprintf("bsf-%d", os.Getuid()))
+}
+
+// fixedVars are set to the same values for every run
+func fixedVars() map[string]string {
+	return map[string]string{
+		"TMPDIR": TempDir(),
+		"LC_ALL": "C",
+		"TZ":     "UTC",
+	}
+}
+
+// commandEnv returns the environment of nix commands out of environ, as returned by os.Environ
+func commandEnv(environ []string) []string {
+	if environment.Inherit {
+		return environ
+	}
+
+	env, _ := scrub(environ)
+	fixed := fixedVars()
+	names := make([]string, 0, len(fixed))
+	for name := range fixed {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		env = append(env, name+"="+fixed[name])
+	}
+	return env
+}
+
+// scrub returns the variables of environ that are kept and the names of the ones removed
+func scrub(environ []string) ([]string, []string) {
+	keep := make(map[string]bool)
+	for _, name := range append(keptVars, environment.Keep...) {
+		keep[name] = true
+	}
+	fixed := fixedVars()
+
+	kept := make([]string, 0, len(keep))
+	removed := make([]string, 0)
+	for _, kv := range environ {
+		name, _, _ := strings.Cut(kv, "=")
+		if _, ok := fixed[name]; ok {
+			continue
+		}
+		if keep[name] {
+			kept = append(kept, kv)
+			continue
+		}
+		removed = append(removed, name)
+	}
+	sort.Strings(removed)
+	return kept, removed
+}
+
+// EffectiveEnvironment returns the environment nix commands run with
+func EffectiveEnvironment() EnvironmentRecord {
+	if environment.Inherit {
+		return EnvironmentRecord{Scrubbed: false}
+	}
+
+	kept, removed := scrub(os.Environ())
+	names := make([]string, 0, len(kept))
+	for _, kv := range kept {
+		name, _, _ := strings.Cut(kv, "=")
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return EnvironmentRecord{Scrubbed: true, Set: fixedVars(), Kept: names, Removed: removed}
+}
+
+// prepareTempDir creates the TMPDIR of nix commands, once per run
+func prepareTempDir() error {
+	tempDirOnce.Do(func() {
+		tempDirErr = os.MkdirAll(TempDir(), 0700)
+	})
+	return tempDirErr
+}
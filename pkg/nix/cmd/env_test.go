@@ -0,0 +1,71 @@
+package cmd
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCommandEnv(t *testing.T) {
+	defer SetEnvironment(Environment{})
+	environ := []string{"PATH=/bin", "HOME=/home/u", "NIX_PATH=nixpkgs=/src", "NIX_CONFIG=access-tokens = x", "TMPDIR=/var/tmp/u", "LANG=fr_FR.UTF-8"}
+	fixed := []string{"LC_ALL=C", "TMPDIR=" + TempDir(), "TZ=UTC"}
+
+	tests := []struct {
+		name string
+		env  Environment
+		want []string
+	}{
+		{
+			name: "scrubbed",
+			want: append([]string{"PATH=/bin", "HOME=/home/u"}, fixed...),
+		},
+		{
+			name: "kept",
+			env:  Environment{Keep: []string{"NIX_CONFIG"}},
+			want: append([]string{"PATH=/bin", "HOME=/home/u", "NIX_CONFIG=access-tokens = x"}, fixed...),
+		},
+		{
+			name: "inherited",
+			env:  Environment{Inherit: true},
+			want: environ,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetEnvironment(tt.env)
+			if got := commandEnv(environ); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("commandEnv() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEffectiveEnvironment(t *testing.T) {
+	defer SetEnvironment(Environment{})
+	t.Setenv("NIX_PATH", "nixpkgs=/src")
+	t.Setenv("NIX_CONFIG", "access-tokens = secret")
+
+	SetEnvironment(Environment{Keep: []string{"NIX_CONFIG"}})
+	rec := EffectiveEnvironment()
+	if !rec.Scrubbed || rec.Set["TMPDIR"] != TempDir() {
+		t.Errorf("unexpected record %+v", rec)
+	}
+	if !contains(rec.Removed, "NIX_PATH") || !contains(rec.Kept, "NIX_CONFIG") {
+		t.Errorf("NIX_PATH should be removed and NIX_CONFIG kept: %+v", rec)
+	}
+
+	SetEnvironment(Environment{Inherit: true})
+	if rec := EffectiveEnvironment(); rec.Scrubbed || rec.Kept != nil {
+		t.Errorf("unexpected record of an inherited environment %+v", rec)
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
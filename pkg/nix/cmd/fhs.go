@@ -0,0 +1,222 @@
+package cmd
+
+import (
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/awalterschulze/gographviz"
+)
+
+// Graph attributes of buildFHSEnv outputs. Their launcher runs the program in a bubblewrap (or, for the legacy
+// buildFHSUserEnv, chrootenv) sandbox whose root filesystem is an environment of the packages of the FHS env, so the
+// packages the program runs with are members of the environment rather than references of the output.
+const (
+	// AttrFHS is the role of the node in an FHS env: FHSWrapper, FHSLauncher or FHSRootFS
+	AttrFHS = "fhs"
+	// AttrFHSEnv is the store name of the root filesystem of the FHS env of wrappers and launchers
+	AttrFHSEnv = "fhs_env"
+
+	// FHSWrapper is the output of buildFHSEnv, with the executable running the launcher
+	FHSWrapper = "wrapper"
+	// FHSLauncher is a script setting up the sandbox, e.g. <name>-bwrap or <name>-init
+	FHSLauncher = "launcher"
+	// FHSRootFS is the environment mounted as the root filesystem of the sandbox, e.g. <name>-fhsenv-rootfs
+	FHSRootFS = "rootfs"
+
+	// EdgeContains is an edge from a member of an FHS root filesystem to the root filesystem
+	EdgeContains = "contains"
+)
+
+// fhsRootFSSuffixes are the suffixes of the root filesystems of FHS envs, -fhs before nixpkgs 24.05
+var fhsRootFSSuffixes = []string{"-fhsenv-rootfs", "-fhs"}
+
+// fhsLauncherSuffixes are the suffixes of the scripts FHS envs run before the program
+var fhsLauncherSuffixes = []string{"-bwrap", "-init", "-fhsenv-profile", "-chrootenv"}
+
+// fhsSandboxes are the packages running the sandbox of FHS envs
+var fhsSandboxes = []string{"bubblewrap", "chrootenv"}
+
+var (
+	scriptStorePathRe = regexp.MustCompile(`/nix/store/[0-9a-df-np-sv-z]{32}-[A-Za-z0-9+\-._?=]+`)
+	execRe            = regexp.MustCompile(`(?m)^\s*exec\s+"?([^\s"]+)`)
+)
+
+// maxScriptSize is the size above which an executable isn't read as a launcher script
+const maxScriptSize = 1 << 20
+
+// FHSEnv is a result built with buildFHSEnv
+type FHSEnv struct {
+	// Launcher is the script the executable of the result runs, e.g. <name>-bwrap
+	Launcher string
+	// RootFS is the store path of the root filesystem of the sandbox
+	RootFS string
+	// Program is the file the sandbox runs, the runScript of the FHS env, empty when it isn't a file, e.g. bash
+	Program string
+}
+
+// DetectFHS returns the FHS env of the result, nil when it isn't built with buildFHSEnv
+func DetectFHS(storePath string) (*FHSEnv, error) {
+	bin, err := resultBinary(storePath)
+	if err != nil || bin == "" {
+		return nil, err
+	}
+	script, ok := readScript(bin)
+	if !ok || (!strings.Contains(script, "bwrap") && !strings.Contains(script, "chrootenv")) {
+		return nil, nil
+	}
+
+	env := &FHSEnv{Launcher: storePathOf(bin)}
+	var init string
+	for _, p := range scriptStorePathRe.FindAllString(script, -1) {
+		name := storeName(p)
+		switch {
+		case hasAnySuffix(name, fhsRootFSSuffixes):
+			env.RootFS = p
+		case strings.HasSuffix(name, "-init"):
+			init = p
+		}
+	}
+	if env.RootFS == "" {
+		return nil, nil
+	}
+
+	// the init script ends by running the runScript, bwrap scripts without one run it themselves
+	runner := script
+	if init != "" {
+		if s, ok := readScript(init); ok {
+			runner = s
+		}
+	}
+	matches := execRe.FindAllStringSubmatch(runner, -1)
+	if len(matches) == 0 {
+		return env, nil
+	}
+	env.Program = resolveRunScript(env.RootFS, matches[len(matches)-1][1])
+	return env, nil
+}
+
+// resolveRunScript returns the file the runScript of an FHS env names: a store path, a path of the root filesystem or
+// a command of its bin directories. It returns an empty string when it isn't a file of the store.
+func resolveRunScript(rootFS, runScript string) string {
+	candidates := []string{runScript}
+	switch {
+	case strings.HasPrefix(runScript, StoreDir+"/"):
+	case strings.HasPrefix(runScript, "/"):
+		candidates = []string{path.Join(rootFS, runScript)}
+	default:
+		candidates = []string{path.Join(rootFS, "usr", "bin", runScript), path.Join(rootFS, "bin", runScript)}
+	}
+	for _, c := range candidates {
+		resolved, err := EvalSymlinks(c)
+		if err != nil || !IsStorePath(resolved) {
+			continue
+		}
+		if info, err := os.Stat(HostPath(resolved)); err == nil && info.Mode().IsRegular() {
+			return resolved
+		}
+	}
+	return ""
+}
+
+// AnnotateFHS flags the wrappers, launchers and root filesystems of the FHS envs of the closure graph, and makes the
+// runtime edges from the members of a root filesystem to it EdgeContains. It runs after ClassifyEdges and returns the
+// number of root filesystems.
+func AnnotateFHS(graph *gographviz.Graph) int {
+	sandboxed := false
+	byStoreName := make(map[string]*gographviz.Node, len(graph.Nodes.Nodes))
+	for _, node := range graph.Nodes.Nodes {
+		name := storeName(CleanNameFromGraph(node.Name))
+		byStoreName[name] = node
+		for _, s := range fhsSandboxes {
+			sandboxed = sandboxed || node.Attrs["name"] == s
+		}
+	}
+	if !sandboxed {
+		return 0
+	}
+
+	names := make([]string, 0, len(byStoreName))
+	for name := range byStoreName {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	rootFSs := 0
+	for _, name := range names {
+		base, ok := cutAnySuffix(name, fhsRootFSSuffixes)
+		if !ok {
+			continue
+		}
+		rootFS := byStoreName[name]
+		rootFS.Attrs[AttrFHS] = FHSRootFS
+		rootFSs++
+
+		if wrapper, ok := byStoreName[base]; ok {
+			wrapper.Attrs[AttrFHS] = FHSWrapper
+			wrapper.Attrs[AttrFHSEnv] = name
+		}
+		for _, suffix := range fhsLauncherSuffixes {
+			if launcher, ok := byStoreName[base+suffix]; ok {
+				launcher.Attrs[AttrFHS] = FHSLauncher
+				launcher.Attrs[AttrFHSEnv] = name
+			}
+		}
+		for _, edge := range graph.Edges.DstToSrcs[rootFS.Name] {
+			for _, e := range edge {
+				if t := e.Attrs["reftype"]; t == EdgeRuntime || t == EdgePropagated || t == "" {
+					e.Attrs["reftype"] = EdgeContains
+				}
+			}
+		}
+	}
+	return rootFSs
+}
+
+// readScript returns the content of the executable when it is a script
+func readScript(p string) (string, bool) {
+	f, err := os.Open(HostPath(p))
+	if err != nil {
+		return "", false
+	}
+	defer f.Close()
+	data, err := io.ReadAll(io.LimitReader(f, maxScriptSize))
+	if err != nil || !strings.HasPrefix(string(data), "#!") {
+		return "", false
+	}
+	return string(data), true
+}
+
+// storePathOf returns the store path of a path below it
+func storePathOf(p string) string {
+	rel, ok := strings.CutPrefix(p, StoreDir+"/")
+	if !ok {
+		return p
+	}
+	base, _, _ := strings.Cut(rel, "/")
+	return path.Join(StoreDir, base)
+}
+
+// storeName returns the name of a store path without its hash, e.g. steam-fhsenv-rootfs
+func storeName(p string) string {
+	_, name, _ := strings.Cut(filepath.Base(p), "-")
+	return name
+}
+
+func hasAnySuffix(s string, suffixes []string) bool {
+	_, ok := cutAnySuffix(s, suffixes)
+	return ok
+}
+
+func cutAnySuffix(s string, suffixes []string) (string, bool) {
+	for _, suffix := range suffixes {
+		if base, ok := strings.CutSuffix(s, suffix); ok {
+			return base, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,126 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/awalterschulze/gographviz"
+)
+
+const (
+	fhsWrapper = "/nix/store/0c9rf6rgcfd5j9b9wgzcm4cfdpi8wq5f-steam"
+	fhsBwrap   = "/nix/store/1ac3r0gk2fqsy3hkq8m4xhhlq4gfgnc4-steam-bwrap"
+	fhsInit    = "/nix/store/2kdc6mhcdkxq4jyzhm6xn2n0v8rz9vzr-steam-init"
+	fhsRootFS  = "/nix/store/3pw0zd2xvf1kjq2dl0yyhwb8z3ki4fg5-steam-fhsenv-rootfs"
+	fhsProgram = "/nix/store/4ry3b6rycz38g8nb3wxx5fnyd1y9fbsg-steam-1.0.0.81"
+	fhsSandbox = "/nix/store/5hd2ghf5v0c6xp0fkvzqhzpfz0h1qw7a-bubblewrap-0.9.0"
+	fhsMember  = "/nix/store/6j8jfg9z4mx6ghf8w1b9vpz0s2y0b5mq-glibc-2.39-52"
+)
+
+func TestDetectFHS(t *testing.T) {
+	root := t.TempDir()
+	write := func(p, content string) {
+		t.Helper()
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(root, p)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(root, p), []byte(content), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(fhsWrapper+"/bin/steam", "#! /nix/store/xxxx-bash/bin/bash\n"+
+		fhsSandbox+"/bin/bwrap --ro-bind "+fhsRootFS+"/usr /usr \\\n  "+fhsInit+" \"$@\"\n")
+	// the init script is a single file, written by writeShellScript
+	write(fhsInit, "#! /nix/store/xxxx-bash/bin/bash\nsource /etc/profile\nexec steam \"$@\"\n")
+	write(fhsProgram+"/bin/steam", "#! /nix/store/xxxx-bash/bin/bash\necho steam\n")
+	if err := os.MkdirAll(filepath.Join(root, fhsRootFS, "usr", "bin"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(fhsProgram+"/bin/steam", filepath.Join(root, fhsRootFS, "usr", "bin", "steam")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := SetStore("local?root=" + root); err != nil {
+		t.Fatal(err)
+	}
+	defer SetStore("")
+
+	env, err := DetectFHS(fhsWrapper)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if env == nil {
+		t.Fatal("DetectFHS() = nil, want the FHS env")
+	}
+	want := FHSEnv{Launcher: fhsWrapper, RootFS: fhsRootFS, Program: fhsProgram + "/bin/steam"}
+	if *env != want {
+		t.Errorf("DetectFHS() = %+v, want %+v", *env, want)
+	}
+
+	if env, err := DetectFHS(fhsProgram); err != nil || env != nil {
+		t.Errorf("DetectFHS() of a plain script = %+v, %v, want nil", env, err)
+	}
+}
+
+func TestAnnotateFHS(t *testing.T) {
+	graph := gographviz.NewGraph()
+	graph.SetName("G")
+	node := func(p, name string) string {
+		n := `"` + filepath.Base(p) + `"`
+		if err := graph.AddNode("G", n, nil); err != nil {
+			t.Fatal(err)
+		}
+		graph.Nodes.Lookup[n].Attrs["name"] = name
+		return n
+	}
+	wrapper := node(fhsWrapper, "steam")
+	bwrap := node(fhsBwrap, "steam-bwrap")
+	rootFS := node(fhsRootFS, "steam-fhsenv-rootfs")
+	program := node(fhsProgram, "steam")
+	sandbox := node(fhsSandbox, "bubblewrap")
+	glibc := node(fhsMember, "glibc")
+
+	// edges point from the dependency to the dependent
+	edge := func(src, dst, reftype string) *gographviz.Edge {
+		e := &gographviz.Edge{Src: src, Dst: dst, Dir: true, Attrs: gographviz.Attrs{}}
+		e.Attrs["reftype"] = reftype
+		graph.Edges.Add(e)
+		return e
+	}
+	edge(bwrap, wrapper, EdgeRuntime)
+	edge(sandbox, bwrap, EdgeRuntime)
+	edge(rootFS, bwrap, EdgeRuntime)
+	programEdge := edge(program, rootFS, EdgeRuntime)
+	glibcEdge := edge(glibc, rootFS, EdgePropagated)
+	buildEdge := edge(glibc, program, EdgeBuild)
+
+	if got := AnnotateFHS(graph); got != 1 {
+		t.Fatalf("AnnotateFHS() = %d, want 1", got)
+	}
+	roles := map[string]string{wrapper: FHSWrapper, bwrap: FHSLauncher, rootFS: FHSRootFS, program: "", sandbox: ""}
+	for n, role := range roles {
+		if got := graph.Nodes.Lookup[n].Attrs[AttrFHS]; got != role {
+			t.Errorf("role of %s = %q, want %q", n, got, role)
+		}
+	}
+	if got := graph.Nodes.Lookup[bwrap].Attrs[AttrFHSEnv]; got != "steam-fhsenv-rootfs" {
+		t.Errorf("env of the launcher = %q", got)
+	}
+	for _, e := range []*gographviz.Edge{programEdge, glibcEdge} {
+		if e.Attrs["reftype"] != EdgeContains {
+			t.Errorf("edge %s -> %s = %s, want %s", e.Src, e.Dst, e.Attrs["reftype"], EdgeContains)
+		}
+	}
+	if buildEdge.Attrs["reftype"] != EdgeBuild {
+		t.Errorf("edges outside the root filesystem should be left as is, got %s", buildEdge.Attrs["reftype"])
+	}
+
+	// closures without a sandbox have no FHS env
+	plain := gographviz.NewGraph()
+	plain.SetName("G")
+	plain.AddNode("G", `"`+filepath.Base(fhsRootFS)+`"`, nil)
+	if got := AnnotateFHS(plain); got != 0 {
+		t.Errorf("AnnotateFHS() without a sandbox = %d, want 0", got)
+	}
+}
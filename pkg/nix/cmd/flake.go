@@ -0,0 +1,118 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strconv"
+)
+
+// FlakeArchive holds the store paths of a flake and its inputs
+type FlakeArchive struct {
+	Path   string                  `json:"path"`
+	Inputs map[string]FlakeArchive `json:"inputs"`
+}
+
+// GetFlakeArchive returns the store paths of the flake inputs without copying them anywhere
+func GetFlakeArchive(flakeRef string) (*FlakeArchive, error) {
+	cmd, cancel := nixCommand("nix", "flake", "archive", "--json", "--dry-run", flakeRef)
+	defer cancel()
+
+	var stdout bytes.Buffer
+	var stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+	if err != nil {
+		return nil, failed(cmd, err)
+	}
+
+	archive := &FlakeArchive{}
+	err = json.Unmarshal(stdout.Bytes(), archive)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse flake archive: %v", err)
+	}
+
+	return archive, nil
+}
+
+// FlakeOutputs holds the attributes a flake provides for a system, by output, and the name of its default package
+type FlakeOutputs struct {
+	Outputs map[string][]string `json:"outputs"`
+	AppName string              `json:"appName"`
+}
+
+// NixSystem returns the nix system of the platform, such as x86_64-linux
+func NixSystem(goos, goarch string) string {
+	arch := goarch
+	switch goarch {
+	case "amd64":
+		arch = "x86_64"
+	case "arm64":
+		arch = "aarch64"
+	}
+	return arch + "-" + goos
+}
+
+// GetFlakeOutputs evaluates the flake in dir and returns the attributes of its outputs for the system
+func GetFlakeOutputs(dir, system string) (*FlakeOutputs, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	expr := fmt.Sprintf(`let
+		flake = builtins.getFlake %s;
+		system = %q;
+		default = flake.packages.${system}.default or null;
+	in {
+		outputs = builtins.mapAttrs (_: v: if builtins.isAttrs v && v ? ${system} && builtins.isAttrs v.${system} then builtins.attrNames v.${system} else []) flake.outputs;
+		appName = if default == null then "" else default.pname or default.name or "";
+	}`, strconv.Quote(abs), system)
+
+	cmd, cancel := nixCommand("nix", "eval", "--json", "--impure", "--expr", expr)
+	defer cancel()
+
+	var stdout bytes.Buffer
+	var stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err = cmd.Run()
+	if err != nil {
+		return nil, failed(cmd, err)
+	}
+
+	outputs := &FlakeOutputs{}
+	err = json.Unmarshal(stdout.Bytes(), outputs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse flake outputs: %v", err)
+	}
+
+	return outputs, nil
+}
+
+// EvalJSON evaluates the nix expression and returns its value as JSON
+func EvalJSON(expr string) ([]byte, error) {
+	return EvalJSONContext(context.Background(), expr)
+}
+
+// EvalJSONContext evaluates the nix expression as EvalJSON does, the evaluation is stopped when ctx is done
+func EvalJSONContext(ctx context.Context, expr string) ([]byte, error) {
+	cmd, cancel := nixCommandContext(ctx, "nix", "eval", "--json", "--impure", "--expr", expr)
+	defer cancel()
+
+	var stdout bytes.Buffer
+	var stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+	if err != nil {
+		return nil, failed(cmd, err)
+	}
+	return stdout.Bytes(), nil
+}
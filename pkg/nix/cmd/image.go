@@ -0,0 +1,434 @@
+package cmd
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/opencontainers/go-digest"
+	imgv1 "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/buildsafedev/bsf/pkg/deadline"
+	"github.com/buildsafedev/bsf/pkg/imagesize"
+)
+
+// ImageFormat is the mechanism used by nix to produce a container image
+type ImageFormat string
+
+const (
+	// ImageFormatOCIDir is a directory containing an OCI manifest.json, as produced by dockerTools or copyTo dir:
+	ImageFormatOCIDir ImageFormat = "oci-dir"
+	// ImageFormatNix2Container is the JSON image description produced by nix2container.buildImage
+	ImageFormatNix2Container ImageFormat = "nix2container"
+	// ImageFormatStream is the script produced by dockerTools.streamLayeredImage
+	ImageFormatStream ImageFormat = "stream-layered-image"
+)
+
+// Image describes a container image produced by nix
+type Image struct {
+	Format ImageFormat
+	// ConfigDigest and Layers are the ones of the image of the host platform when the image has several
+	ConfigDigest string
+	Layers       []Layer
+	// IndexDigest is the digest of the image index of multi-platform images
+	IndexDigest string
+	// Platforms are the images of each platform of the index
+	Platforms []PlatformImage
+}
+
+// PlatformImage is the image of one platform of a multi-platform image
+type PlatformImage struct {
+	// Platform is os/arch, with the variant when there is one, e.g. linux/arm64/v8
+	Platform       string
+	ManifestDigest string
+	ConfigDigest   string
+	Layers         []Layer
+}
+
+// Layer is a layer of a container image
+type Layer struct {
+	Digest    string
+	Size      int64
+	MediaType string
+	// Paths are the store paths included in the layer, when known
+	Paths []string
+	// sizes is the attribution of the layer to store paths of streamed images, read as they are streamed
+	sizes *imagesize.Layer
+}
+
+// nix2containerImage is the JSON written by nix2container.buildImage
+type nix2containerImage struct {
+	Version     int               `json:"version"`
+	ImageConfig imgv1.ImageConfig `json:"image-config"`
+	Arch        string            `json:"arch"`
+	Created     *time.Time        `json:"created,omitempty"`
+	Layers      []struct {
+		Digest    string `json:"digest"`
+		Size      int64  `json:"size"`
+		DiffIDs   string `json:"diff_ids"`
+		MediaType string `json:"mediatype"`
+		Paths     []struct {
+			Path string `json:"path"`
+		} `json:"paths"`
+	} `json:"layers"`
+}
+
+// DetectImageFormat returns the image format of the build result at path, or an empty string if it is not an image
+func DetectImageFormat(path string) (ImageFormat, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+
+	if info.IsDir() {
+		if _, err := os.Stat(path + "/manifest.json"); err == nil {
+			return ImageFormatOCIDir, nil
+		}
+		return "", nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return "", err
+	}
+	head = head[:n]
+
+	switch {
+	case bytes.HasPrefix(bytes.TrimSpace(head), []byte("{")) && bytes.Contains(head, []byte(`"image-config"`)):
+		return ImageFormatNix2Container, nil
+	case bytes.HasPrefix(head, []byte("#!")) && isStreamLayeredImage(path):
+		return ImageFormatStream, nil
+	}
+
+	return "", nil
+}
+
+// isStreamLayeredImage checks if the script execs stream_layered_image.py with a conf file
+func isStreamLayeredImage(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if strings.Contains(scanner.Text(), "stream_layered_image") || strings.Contains(scanner.Text(), "stream-layered-image") {
+			return true
+		}
+	}
+	return false
+}
+
+// GetImage parses the container image at path
+func GetImage(path string) (*Image, error) {
+	format, err := DetectImageFormat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch format {
+	case ImageFormatOCIDir:
+		return imageFromOCIDir(path)
+	case ImageFormatNix2Container:
+		return imageFromNix2Container(path)
+	case ImageFormatStream:
+		return imageFromStream(path)
+	}
+
+	return nil, fmt.Errorf("%s is not a container image", path)
+}
+
+func imageFromOCIDir(path string) (*Image, error) {
+	fbytes, err := os.ReadFile(path + "/manifest.json")
+	if err != nil {
+		return nil, err
+	}
+
+	// image indexes and docker manifest lists list the manifests of each platform
+	index := &imgv1.Index{}
+	if err := json.Unmarshal(fbytes, index); err == nil && len(index.Manifests) > 0 {
+		return imageFromIndex(path, fbytes, index)
+	}
+
+	configDigest, layers, err := parseManifest(fbytes)
+	if err != nil {
+		return nil, err
+	}
+	return &Image{Format: ImageFormatOCIDir, ConfigDigest: configDigest, Layers: layers}, nil
+}
+
+// imageFromIndex reads the manifests of the platforms of an image index from the blobs of the directory. The config
+// and layers of the image are the ones of the host platform, the first platform's when the host has none.
+func imageFromIndex(path string, data []byte, index *imgv1.Index) (*Image, error) {
+	sum := sha256.Sum256(data)
+	img := &Image{
+		Format:      ImageFormatOCIDir,
+		IndexDigest: hex.EncodeToString(sum[:]),
+	}
+
+	host := runtime.GOOS + "/" + runtime.GOARCH
+	for _, desc := range index.Manifests {
+		manifest, err := readBlob(path, desc.Digest.Encoded())
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the manifest %s of the index: %v", desc.Digest, err)
+		}
+		p := PlatformImage{ManifestDigest: desc.Digest.Encoded()}
+		if desc.Platform != nil {
+			p.Platform = desc.Platform.OS + "/" + desc.Platform.Architecture
+			if desc.Platform.Variant != "" {
+				p.Platform += "/" + desc.Platform.Variant
+			}
+		}
+		p.ConfigDigest, p.Layers, err = parseManifest(manifest)
+		if err != nil {
+			return nil, err
+		}
+		img.Platforms = append(img.Platforms, p)
+
+		if img.ConfigDigest == "" || strings.HasPrefix(p.Platform+"/", host+"/") {
+			img.ConfigDigest, img.Layers = p.ConfigDigest, p.Layers
+		}
+	}
+	return img, nil
+}
+
+// readBlob reads a blob of an image directory, named by its digest as skopeo dir: copies name them, or in the
+// blobs/sha256 directory of OCI layouts
+func readBlob(path, digest string) ([]byte, error) {
+	data, err := os.ReadFile(filepath.Join(path, digest))
+	if os.IsNotExist(err) {
+		return os.ReadFile(filepath.Join(path, "blobs", "sha256", digest))
+	}
+	return data, err
+}
+
+// parseManifest returns the config digest and the layers of an image manifest
+func parseManifest(data []byte) (string, []Layer, error) {
+	manifest := &imgv1.Manifest{}
+	err := json.Unmarshal(data, manifest)
+	if err != nil {
+		return "", nil, err
+	}
+
+	layers := make([]Layer, 0, len(manifest.Layers))
+	for _, l := range manifest.Layers {
+		layers = append(layers, Layer{
+			Digest:    strings.TrimPrefix(l.Digest.String(), "sha256:"),
+			Size:      l.Size,
+			MediaType: l.MediaType,
+		})
+	}
+	return strings.TrimPrefix(manifest.Config.Digest.String(), "sha256:"), layers, nil
+}
+
+// imageFromNix2Container reads the nix2container image description. nix2container only assembles the image config
+// when the image is copied, the config is assembled here the same way to get the digest registries serve it under.
+func imageFromNix2Container(path string) (*Image, error) {
+	fbytes, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	n2c := &nix2containerImage{}
+	err = json.Unmarshal(fbytes, n2c)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse nix2container image: %v", err)
+	}
+
+	config, err := nix2containerConfig(n2c)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(config)
+	img := &Image{
+		Format:       ImageFormatNix2Container,
+		ConfigDigest: hex.EncodeToString(sum[:]),
+	}
+	for _, l := range n2c.Layers {
+		layer := Layer{
+			Digest:    strings.TrimPrefix(l.Digest, "sha256:"),
+			Size:      l.Size,
+			MediaType: l.MediaType,
+		}
+		for _, p := range l.Paths {
+			layer.Paths = append(layer.Paths, p.Path)
+		}
+		img.Layers = append(img.Layers, layer)
+	}
+
+	return img, nil
+}
+
+// nix2containerConfig returns the OCI image config nix2container writes when it copies the image: the config of the
+// description with the diff IDs of its layers, marshalled from the image-spec types as nix2container does
+func nix2containerConfig(n2c *nix2containerImage) ([]byte, error) {
+	config := imgv1.Image{
+		Created: n2c.Created,
+		Platform: imgv1.Platform{
+			OS:           "linux",
+			Architecture: n2c.Arch,
+		},
+		Config: n2c.ImageConfig,
+		RootFS: imgv1.RootFS{Type: "layers"},
+	}
+	for _, l := range n2c.Layers {
+		diffID, err := digest.Parse(l.DiffIDs)
+		if err != nil {
+			return nil, fmt.Errorf("invalid diff ID of nix2container layer %s: %v", l.Digest, err)
+		}
+		config.RootFS.DiffIDs = append(config.RootFS.DiffIDs, diffID)
+	}
+	return json.Marshal(config)
+}
+
+// dockerLayerMediaType is the media type of the uncompressed layers of docker archives
+const dockerLayerMediaType = "application/vnd.docker.image.rootfs.diff.tar"
+
+// streamManifest is the docker archive manifest.json emitted by streamLayeredImage
+type streamManifest struct {
+	Config string   `json:"Config"`
+	Layers []string `json:"Layers"`
+}
+
+// imageFromStream runs the streamLayeredImage script and reads the docker archive it writes to stdout
+func imageFromStream(path string) (*Image, error) {
+	cmd, cancel := deadline.Command(path)
+	defer cancel()
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("error starting command: %v", err)
+	}
+
+	img, err := readDockerArchive(stdout)
+	if err != nil {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+		return nil, err
+	}
+
+	if err := cmd.Wait(); err != nil {
+		return nil, fmt.Errorf("failed with %s", stderr.String())
+	}
+
+	return img, nil
+}
+
+func readDockerArchive(r io.Reader) (*Image, error) {
+	tr := tar.NewReader(r)
+
+	layerDigests := make(map[string]Layer)
+	var manifests []streamManifest
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case hdr.Name == "manifest.json":
+			err = json.NewDecoder(tr).Decode(&manifests)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse manifest.json: %v", err)
+			}
+		case strings.HasSuffix(hdr.Name, ".tar"):
+			h := sha256.New()
+			sizes, attrErr := imagesize.Attribute(io.TeeReader(tr, h), "", dockerLayerMediaType)
+			// layers that aren't tar archives are hashed all the same, without their attribution
+			if _, err := io.Copy(h, tr); err != nil {
+				return nil, err
+			}
+			layer := Layer{
+				Digest:    hex.EncodeToString(h.Sum(nil)),
+				Size:      hdr.Size,
+				MediaType: dockerLayerMediaType,
+			}
+			if attrErr == nil {
+				sizes.Digest = layer.Digest
+				layer.sizes = &sizes
+			}
+			layerDigests[hdr.Name] = layer
+		}
+	}
+
+	if len(manifests) == 0 {
+		return nil, fmt.Errorf("no manifest.json found in image stream")
+	}
+
+	img := &Image{
+		Format:       ImageFormatStream,
+		ConfigDigest: strings.TrimSuffix(strings.TrimPrefix(manifests[0].Config, "sha256:"), ".json"),
+	}
+	for _, l := range manifests[0].Layers {
+		layer, ok := layerDigests[l]
+		if !ok {
+			return nil, fmt.Errorf("layer %s not found in image stream", l)
+		}
+		img.Layers = append(img.Layers, layer)
+	}
+
+	return img, nil
+}
+
+// LayerSizes attributes the size of the layers of the image at path to the store paths of their files. The layers of
+// OCI directories are read from their blobs, the ones of streamed images were read as the image was streamed. The
+// layers of nix2container images aren't built until the image is copied, they are split between their store paths in
+// proportion to narSize.
+func LayerSizes(path string, img *Image, narSize func(storePath string) int64) ([]imagesize.Layer, error) {
+	layers := make([]imagesize.Layer, 0, len(img.Layers))
+	for _, l := range img.Layers {
+		switch {
+		case l.sizes != nil:
+			layers = append(layers, *l.sizes)
+		case img.Format == ImageFormatNix2Container:
+			layers = append(layers, imagesize.FromPaths(l.Digest, l.MediaType, l.Size, l.Paths, narSize))
+		case img.Format == ImageFormatOCIDir:
+			sizes, err := blobSizes(path, l)
+			if err != nil {
+				return nil, err
+			}
+			layers = append(layers, sizes)
+		}
+	}
+	return layers, nil
+}
+
+// blobSizes attributes the layer blob of an image directory
+func blobSizes(path string, l Layer) (imagesize.Layer, error) {
+	f, err := os.Open(filepath.Join(path, l.Digest))
+	if os.IsNotExist(err) {
+		f, err = os.Open(filepath.Join(path, "blobs", "sha256", l.Digest))
+	}
+	if err != nil {
+		return imagesize.Layer{}, err
+	}
+	defer f.Close()
+	return imagesize.Attribute(f, l.Digest, l.MediaType)
+}
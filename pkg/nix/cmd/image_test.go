@@ -0,0 +1,239 @@
+package cmd
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestDetectImageFormat(t *testing.T) {
+	dir := t.TempDir()
+
+	ociDir := filepath.Join(dir, "oci")
+	if err := os.Mkdir(ociDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(ociDir, "manifest.json"), []byte(`{"schemaVersion":2,"config":{"digest":"sha256:abc"}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	n2c := filepath.Join(dir, "image.json")
+	if err := os.WriteFile(n2c, []byte(`{"version":1,"image-config":{"Env":["PATH=/bin"]},"arch":"amd64","layers":[{"digest":"sha256:def","size":10,"diff_ids":"sha256:1111111111111111111111111111111111111111111111111111111111111111","mediatype":"application/vnd.oci.image.layer.v1.tar","paths":[{"path":"/nix/store/abc-hello-1.0"}]}]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	stream := filepath.Join(dir, "stream")
+	if err := os.WriteFile(stream, []byte("#!/nix/store/abc-bash/bin/bash\nexec /nix/store/def-stream/bin/stream_layered_image.py /nix/store/ghi-conf.json\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	script := filepath.Join(dir, "script")
+	if err := os.WriteFile(script, []byte("#!/bin/sh\necho hello\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		path string
+		want ImageFormat
+	}{
+		{name: "oci dir", path: ociDir, want: ImageFormatOCIDir},
+		{name: "nix2container", path: n2c, want: ImageFormatNix2Container},
+		{name: "streamLayeredImage", path: stream, want: ImageFormatStream},
+		{name: "plain script", path: script, want: ""},
+		{name: "empty dir", path: t.TempDir(), want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := DetectImageFormat(tt.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("DetectImageFormat() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	img, err := GetImage(n2c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(img.Layers) != 1 || img.Layers[0].Digest != "def" || img.Layers[0].Paths[0] != "/nix/store/abc-hello-1.0" {
+		t.Errorf("GetImage() layers = %+v", img.Layers)
+	}
+	// the config nix2container pushes, which registries serve under its digest
+	config := sha256.Sum256([]byte(`{"architecture":"amd64","os":"linux","config":{"Env":["PATH=/bin"]},"rootfs":{"type":"layers","diff_ids":["sha256:1111111111111111111111111111111111111111111111111111111111111111"]}}`))
+	if img.ConfigDigest != hex.EncodeToString(config[:]) {
+		t.Errorf("GetImage() config digest = %s, want the digest of the assembled config", img.ConfigDigest)
+	}
+}
+
+func TestReadDockerArchive(t *testing.T) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	files := []struct {
+		name, body string
+	}{
+		{"layer1/layer.tar", "layer contents"},
+		{"abc123.json", "{}"},
+		{"manifest.json", `[{"Config":"abc123.json","Layers":["layer1/layer.tar"]}]`},
+	}
+	for _, f := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: f.name, Mode: 0644, Size: int64(len(f.body))}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(f.body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	img, err := readDockerArchive(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.ConfigDigest != "abc123" {
+		t.Errorf("ConfigDigest = %v, want abc123", img.ConfigDigest)
+	}
+	if len(img.Layers) != 1 || img.Layers[0].Size != int64(len("layer contents")) {
+		t.Errorf("Layers = %+v", img.Layers)
+	}
+}
+
+func TestImageIndex(t *testing.T) {
+	dir := t.TempDir()
+	manifests := map[string]string{
+		"linux/amd64":    `{"schemaVersion":2,"config":{"digest":"sha256:c0"},"layers":[{"digest":"sha256:l0","size":1}]}`,
+		"linux/arm64/v8": `{"schemaVersion":2,"config":{"digest":"sha256:c1"},"layers":[{"digest":"sha256:l1","size":2}]}`,
+	}
+	index := `{"schemaVersion":2,"mediaType":"application/vnd.oci.image.index.v1+json","manifests":[`
+	digests := map[string]string{}
+	for i, platform := range []string{"linux/amd64", "linux/arm64/v8"} {
+		sum := sha256.Sum256([]byte(manifests[platform]))
+		digests[platform] = hex.EncodeToString(sum[:])
+		if err := os.WriteFile(filepath.Join(dir, digests[platform]), []byte(manifests[platform]), 0644); err != nil {
+			t.Fatal(err)
+		}
+		parts := strings.Split(platform, "/")
+		variant := ""
+		if len(parts) == 3 {
+			variant = `,"variant":"` + parts[2] + `"`
+		}
+		if i > 0 {
+			index += ","
+		}
+		index += `{"mediaType":"application/vnd.oci.image.manifest.v1+json","digest":"sha256:` + digests[platform] + `","size":1,"platform":{"os":"linux","architecture":"` + parts[1] + `"` + variant + `}}`
+	}
+	index += "]}"
+	if err := os.WriteFile(filepath.Join(dir, "manifest.json"), []byte(index), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	img, err := GetImage(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256([]byte(index))
+	if img.IndexDigest != hex.EncodeToString(sum[:]) {
+		t.Errorf("IndexDigest = %s, want the digest of manifest.json", img.IndexDigest)
+	}
+	if len(img.Platforms) != 2 {
+		t.Fatalf("got %d platforms, want 2", len(img.Platforms))
+	}
+	for i, want := range []PlatformImage{
+		{Platform: "linux/amd64", ManifestDigest: digests["linux/amd64"], ConfigDigest: "c0"},
+		{Platform: "linux/arm64/v8", ManifestDigest: digests["linux/arm64/v8"], ConfigDigest: "c1"},
+	} {
+		got := img.Platforms[i]
+		if got.Platform != want.Platform || got.ManifestDigest != want.ManifestDigest || got.ConfigDigest != want.ConfigDigest || len(got.Layers) != 1 {
+			t.Errorf("platform %d = %+v, want %+v", i, got, want)
+		}
+	}
+	// the image is the one of the host, the first platform's on other hosts
+	wantConfig := "c0"
+	if runtime.GOOS == "linux" && runtime.GOARCH == "arm64" {
+		wantConfig = "c1"
+	}
+	if img.ConfigDigest != wantConfig {
+		t.Errorf("ConfigDigest = %s, want %s", img.ConfigDigest, wantConfig)
+	}
+}
+
+func TestLayerSizes(t *testing.T) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, name := range []string{"nix/store/abc-hello-1.0/bin/hello", "etc/passwd"} {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: 5}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte("hello")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(buf.Bytes())
+	digest := hex.EncodeToString(sum[:])
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, digest), buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	img := &Image{Format: ImageFormatOCIDir, Layers: []Layer{{Digest: digest, Size: int64(buf.Len())}}}
+	layers, err := LayerSizes(dir, img, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(layers) != 1 || layers[0].Size != int64(buf.Len()) || len(layers[0].Components) != 2 {
+		t.Fatalf("LayerSizes() = %+v", layers)
+	}
+
+	// the layers of streamed images are attributed as they are read
+	streamed, err := readDockerArchive(dockerArchive(t, buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	layers, err = LayerSizes("", streamed, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(layers) != 1 || layers[0].Digest != digest || len(layers[0].Components) != 2 || layers[0].Components[1].StorePath != "/nix/store/abc-hello-1.0" {
+		t.Errorf("LayerSizes() of the streamed image = %+v", layers)
+	}
+}
+
+// dockerArchive writes a docker archive of a single layer
+func dockerArchive(t *testing.T, layer []byte) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, f := range []struct {
+		name string
+		body []byte
+	}{
+		{"layer1/layer.tar", layer},
+		{"manifest.json", []byte(`[{"Config":"abc123.json","Layers":["layer1/layer.tar"]}]`)},
+	} {
+		if err := tw.WriteHeader(&tar.Header{Name: f.name, Mode: 0644, Size: int64(len(f.body))}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write(f.body); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return &buf
+}
@@ -1,9 +1,13 @@
 package cmd
 
 import (
+	"bytes"
 	"fmt"
 	"os"
 	"os/exec"
+	"strings"
+
+	"github.com/buildsafedev/bsf/pkg/toolchain"
 )
 
 // Lock generates the Nix flake lock file
@@ -12,7 +16,7 @@ func Lock() error {
 	if err != nil {
 		return err
 	}
-	cmd := exec.Command("nix", "flake", "lock", fmt.Sprintf("path:%s/bsf/", dir))
+	cmd := toolchain.Check(exec.Command("nix", "flake", "lock", fmt.Sprintf("path:%s/bsf/", dir)))
 
 	// Connect the command's stdin, stdout, and stderr to the terminal
 	cmd.Stdin = os.Stdin
@@ -36,3 +40,20 @@ func Lock() error {
 
 	return nil
 }
+
+// LockInput locks the input of the Nix flake lock file to the flake reference, e.g. github:NixOS/nixpkgs/<rev>,
+// leaving the other inputs as they are locked
+func LockInput(input, ref string) error {
+	dir, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	cmd := toolchain.Check(exec.Command("nix", "flake", "lock", "--override-input", input, ref, fmt.Sprintf("path:%s/bsf/", dir)))
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to lock %s to %s: %s", input, ref, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
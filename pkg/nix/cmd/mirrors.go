@@ -0,0 +1,57 @@
+package cmd
+
+import "strings"
+
+// mirrors holds the primary location of the mirrors defined in nixpkgs' pkgs/build-support/fetchurl/mirrors.nix
+var mirrors = map[string]string{
+	"alsa":            "https://www.alsa-project.org/files/pub/",
+	"apache":          "https://dlcdn.apache.org/",
+	"bioc":            "https://bioconductor.org/packages/",
+	"cpan":            "https://cpan.metacpan.org/",
+	"cran":            "https://cran.r-project.org/src/contrib/",
+	"debian":          "https://httpredir.debian.org/debian/",
+	"gcc":             "https://mirror.koddos.net/gcc/",
+	"gentoo":          "https://distfiles.gentoo.org/",
+	"gnome":           "https://download.gnome.org/",
+	"gnu":             "https://ftpmirror.gnu.org/",
+	"gnupg":           "https://gnupg.org/ftp/gcrypt/",
+	"hackage":         "https://hackage.haskell.org/package/",
+	"ibiblioPubLinux": "https://www.ibiblio.org/pub/Linux/",
+	"imagemagick":     "https://imagemagick.org/archive/",
+	"kde":             "https://cdn.download.kde.org/",
+	"kernel":          "https://cdn.kernel.org/pub/",
+	"luarocks":        "https://luarocks.org/",
+	"maven":           "https://repo1.maven.org/maven2/",
+	"mozilla":         "https://download.mozilla.org/",
+	"mysql":           "https://cdn.mysql.com/Downloads/",
+	"openbsd":         "https://ftp.openbsd.org/pub/OpenBSD/",
+	"postgresql":      "https://ftp.postgresql.org/pub/",
+	"pypi":            "https://files.pythonhosted.org/packages/source/",
+	"qt":              "https://download.qt.io/",
+	"samba":           "https://www.samba.org/ftp/",
+	"savannah":        "https://download.savannah.nongnu.org/releases/",
+	"sourceforge":     "https://downloads.sourceforge.net/",
+	"ubuntu":          "https://archive.ubuntu.com/ubuntu/",
+	"xfce":            "https://archive.xfce.org/",
+	"xorg":            "https://xorg.freedesktop.org/releases/",
+}
+
+// ExpandMirrorURL expands a mirror:// URL to the primary location of the mirror.
+// URLs of unknown mirrors and regular URLs are returned unchanged.
+func ExpandMirrorURL(u string) string {
+	rest, ok := strings.CutPrefix(u, "mirror://")
+	if !ok {
+		return u
+	}
+
+	name, path, ok := strings.Cut(rest, "/")
+	if !ok {
+		return u
+	}
+
+	base, ok := mirrors[name]
+	if !ok {
+		return u
+	}
+	return base + path
+}
@@ -0,0 +1,131 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io"
+	"os"
+	"strings"
+
+	"zombiezen.com/go/nix/nar"
+	"zombiezen.com/go/nix/nixbase32"
+
+	"github.com/buildsafedev/bsf/pkg/nix/store"
+	"github.com/buildsafedev/bsf/pkg/shutdown"
+)
+
+// PathInfo holds the narinfo fields of a store path
+type PathInfo struct {
+	StorePath string
+	// NarHash is the sha256 hash of the NAR serialisation, as sha256:<nixbase32>
+	NarHash    string
+	NarSize    int64
+	References []string
+	// Deriver is empty when the store has no deriver for the path, e.g. for sources
+	Deriver string
+}
+
+// DumpNAR writes the NAR serialisation of the store path to w and returns its narinfo fields.
+// The references and the deriver are queried from the store.
+func DumpNAR(w io.Writer, storePath string) (*PathInfo, error) {
+	h := sha256.New()
+	counter := &countingWriter{}
+	if err := nar.DumpPath(io.MultiWriter(w, h, counter), HostPath(storePath)); err != nil {
+		return nil, err
+	}
+
+	references, err := GetReferences(storePath)
+	if err != nil {
+		return nil, err
+	}
+	info := &PathInfo{
+		StorePath:  storePath,
+		NarHash:    "sha256:" + nixbase32.EncodeToString(h.Sum(nil)),
+		NarSize:    counter.n,
+		References: references,
+	}
+	if deriver, err := GetDeriver(storePath); err == nil {
+		info.Deriver = deriver
+	}
+	return info, nil
+}
+
+// DumpNARFile writes the NAR serialisation of the store path to a temporary file, the caller removes it. The file
+// is removed if the run shuts down while it is written.
+func DumpNARFile(storePath string) (string, *PathInfo, error) {
+	f, err := os.CreateTemp("", "bsf-*.nar")
+	if err != nil {
+		return "", nil, err
+	}
+	defer shutdown.RemoveOnExit(f.Name())()
+	defer f.Close()
+
+	info, err := DumpNAR(f, storePath)
+	if err != nil {
+		os.Remove(f.Name())
+		return "", nil, err
+	}
+	return f.Name(), info, nil
+}
+
+// GetNarSize returns the size of the NAR serialisation of the store path, for paths the store has no path info of
+func GetNarSize(storePath string) (int64, error) {
+	counter := &countingWriter{}
+	if _, err := store.DumpPath(counter, HostPath(storePath)); err != nil {
+		return 0, err
+	}
+	return counter.n, nil
+}
+
+// GetReferences returns the store paths the store path references
+func GetReferences(storePath string) ([]string, error) {
+	if info, ok, err := localPathInfo(storePath); ok {
+		if err != nil {
+			return nil, err
+		}
+		return info.References, nil
+	}
+	cmd, cancel := nixCommand("nix-store", "--query", "--references", storePath)
+	defer cancel()
+
+	var stdout bytes.Buffer
+	var stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return nil, failed(cmd, err)
+	}
+	return strings.Fields(stdout.String()), nil
+}
+
+// GetClosure returns the store paths in the closure of the store path, including itself
+func GetClosure(storePath string) ([]string, error) {
+	if closure, ok, err := localClosure([]string{storePath}); ok {
+		if err != nil {
+			return nil, err
+		}
+		return closure.Sorted(), nil
+	}
+	cmd, cancel := nixCommand("nix-store", "--query", "--requisites", storePath)
+	defer cancel()
+
+	var stdout bytes.Buffer
+	var stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return nil, failed(cmd, err)
+	}
+	return strings.Fields(stdout.String()), nil
+}
+
+type countingWriter struct {
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	c.n += int64(len(p))
+	return len(p), nil
+}
@@ -0,0 +1,151 @@
+package cmd
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// NarHashCache keeps the NAR hashes bsf computed by dumping store paths, so the closures of later builds don't
+// dump them again. Entries are keyed by the location of the store path on the host, so chroot stores don't share
+// them, and invalidated when the path was deleted and realised again,
+// which gives its directory another inode or modification time.
+type NarHashCache struct {
+	path    string
+	mu      sync.Mutex
+	entries map[string]narHashEntry
+	dirty   bool
+}
+
+type narHashEntry struct {
+	Hash  string `json:"hash"`
+	Stamp string `json:"stamp"`
+}
+
+// NarHashCachePath returns the location of the NAR hash cache in the local cache directory
+func NarHashCachePath() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "bsf", "narhash.json"), nil
+}
+
+// OpenNarHashCache reads the NAR hash cache at path. A cache that is missing or can't be read is empty.
+func OpenNarHashCache(path string) *NarHashCache {
+	c := &NarHashCache{path: path, entries: make(map[string]narHashEntry)}
+	if data, err := os.ReadFile(path); err == nil {
+		json.Unmarshal(data, &c.entries)
+	}
+	return c
+}
+
+// Lookup returns the NAR hash of the store path, when it was cached since the path was realised
+func (c *NarHashCache) Lookup(storePath string) (string, bool) {
+	if c == nil {
+		return "", false
+	}
+	host := HostPath(storePath)
+	stamp, err := pathStamp(host)
+	if err != nil {
+		return "", false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[host]
+	if !ok || e.Stamp != stamp {
+		return "", false
+	}
+	return e.Hash, true
+}
+
+// Store caches the NAR hash of the store path
+func (c *NarHashCache) Store(storePath, hash string) {
+	if c == nil {
+		return
+	}
+	host := HostPath(storePath)
+	stamp, err := pathStamp(host)
+	if err != nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[host] = narHashEntry{Hash: hash, Stamp: stamp}
+	c.dirty = true
+}
+
+// Save writes the cache when hashes were added, along with the ones other builds saved in the meantime. Paths that
+// were garbage collected are dropped.
+func (c *NarHashCache) Save() error {
+	if c == nil || !c.dirty {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entries := OpenNarHashCache(c.path).entries
+	for p, e := range c.entries {
+		entries[p] = e
+	}
+	for p := range entries {
+		if _, err := os.Lstat(p); os.IsNotExist(err) {
+			delete(entries, p)
+		}
+	}
+	data, err := json.Marshal(entries)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0755); err != nil {
+		return err
+	}
+	// concurrent builds replace the cache atomically, the last one wins
+	tmp, err := os.CreateTemp(filepath.Dir(c.path), ".narhash-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	c.dirty = false
+	return os.Rename(tmp.Name(), c.path)
+}
+
+// pathStamp identifies the realisation of the store path at path. Nix resets the modification time of store paths,
+// the inode of the path tells realisations apart where the platform has them.
+func pathStamp(path string) (string, error) {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return "", err
+	}
+	return strconv.FormatUint(inode(info), 10) + ":" + strconv.FormatInt(info.ModTime().UnixNano(), 10), nil
+}
+
+// Paths returns the store paths of the current store whose NAR hash is cached, sorted. They are the paths of the
+// closures bsf analyzed before.
+func (c *NarHashCache) Paths() []string {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	paths := make([]string, 0, len(c.entries))
+	for host := range c.entries {
+		p := strings.TrimPrefix(host, storeRoot)
+		if IsStorePath(p) && HostPath(p) == host {
+			paths = append(paths, p)
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
@@ -0,0 +1,9 @@
+//go:build !unix
+
+package cmd
+
+import "os"
+
+func inode(info os.FileInfo) uint64 {
+	return 0
+}
@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestNarHashCache(t *testing.T) {
+	dir := t.TempDir()
+	cachePath := filepath.Join(dir, "cache", "narhash.json")
+	hello := filepath.Join(dir, "abc-hello-2.12")
+	zlib := filepath.Join(dir, "def-zlib-1.3")
+	for _, p := range []string{hello, zlib} {
+		if err := os.Mkdir(p, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c := OpenNarHashCache(cachePath)
+	if _, ok := c.Lookup(hello); ok {
+		t.Fatal("empty cache has a hash")
+	}
+	c.Store(hello, "hellohash")
+	c.Store(zlib, "zlibhash")
+	// another build saved a hash in the meantime
+	other := OpenNarHashCache(cachePath)
+	other.Store(zlib, "zlibhash")
+	if err := other.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	c = OpenNarHashCache(cachePath)
+	if hash, ok := c.Lookup(hello); !ok || hash != "hellohash" {
+		t.Errorf("Lookup(hello) = %s, %v after saving", hash, ok)
+	}
+
+	// the path was garbage collected and realised again
+	if err := os.Remove(hello); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(hello, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(hello, time.Unix(1, 0), time.Unix(2, 0)); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := c.Lookup(hello); ok {
+		t.Error("the hash of a path realised again is still cached")
+	}
+
+	// garbage collected paths are dropped on save
+	if err := os.Remove(zlib); err != nil {
+		t.Fatal(err)
+	}
+	c.Store(hello, "newhash")
+	if err := c.Save(); err != nil {
+		t.Fatal(err)
+	}
+	c = OpenNarHashCache(cachePath)
+	if len(c.entries) != 1 || c.entries[hello].Hash != "newhash" {
+		t.Errorf("entries after saving = %v, want the new hash of hello only", c.entries)
+	}
+}
+
+func TestCachedNarHash(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "abc-hello-2.12")
+	if err := os.WriteFile(path, []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	want, err := GetNarHashFromPath(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := OpenNarHashCache(filepath.Join(dir, "narhash.json"))
+	if got, _, err := cachedNarHash(path, c); err != nil || got != want {
+		t.Fatalf("cachedNarHash() = %s, %v, want %s", got, err, want)
+	}
+	c.Store(path, "cached")
+	if got, _, _ := cachedNarHash(path, c); got != "cached" {
+		t.Errorf("cachedNarHash() = %s, want the cached hash", got)
+	}
+	// without a cache every path is dumped
+	if got, _, _ := cachedNarHash(path, nil); got != want {
+		t.Errorf("cachedNarHash() without a cache = %s, want %s", got, want)
+	}
+}
@@ -4,13 +4,15 @@ import (
 	"fmt"
 	"os/exec"
 	"strings"
+
+	"github.com/buildsafedev/bsf/pkg/toolchain"
 )
 
 // NixVersion returns the current nix version
 func NixVersion() (string, error) {
 	var nixVersion string
 
-	script := exec.Command("nix", "--version")
+	script := toolchain.Check(exec.Command("nix", "--version"))
 	out, err := script.CombinedOutput()
 	if err != nil {
 		return "", fmt.Errorf("error fetching nix version: %s", err)
@@ -31,7 +33,7 @@ func NixVersion() (string, error) {
 // NixShowConfig returns a map of nix configuration values
 func NixShowConfig() (map[string]string, error) {
 
-	script := exec.Command("nix", "show-config")
+	script := toolchain.Check(exec.Command("nix", "show-config"))
 	out, err := script.CombinedOutput()
 	if err != nil {
 		return nil, fmt.Errorf("error fetching nix config: %s", err)
@@ -0,0 +1,180 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+
+	"zombiezen.com/go/nix/nar"
+
+	"github.com/buildsafedev/bsf/pkg/nix/store"
+)
+
+// Promotion is the copy of the closure of a build from a store to another, e.g. from the staging cache to the
+// production cache
+type Promotion struct {
+	StorePath string
+	From      string
+	To        string
+	// Paths are the store paths of the closure with their NAR hash, in hex
+	Paths map[string]string
+	// KeyName is the name of the key the paths were signed with in the destination, empty when they weren't signed
+	KeyName string
+}
+
+// Promote copies the exact closure of the store path, as the source store records it, from a store to another with
+// nix copy and signs its paths in the destination with the secret key file, if any. The default store is the source
+// when from is empty. The promotion fails when the destination has other NAR hashes than the source, or lacks the
+// signature of the key.
+// With a compression, the NARs are pushed by bsf when the destination is a http(s):// or file:// binary cache and
+// the source the default store or such a cache, verified against their NAR hash, and nix copy is asked to compress
+// with it otherwise.
+func Promote(ctx context.Context, storePath, from, to, keyFile string, push store.PushOptions) (*Promotion, error) {
+	p := &Promotion{StorePath: storePath, From: from, To: to}
+	if keyFile != "" {
+		key, err := os.ReadFile(keyFile)
+		if err != nil {
+			return nil, err
+		}
+		if p.KeyName, err = SecretKeyName(key); err != nil {
+			return nil, fmt.Errorf("%s: %w", keyFile, err)
+		}
+	}
+
+	src, err := promotionStore(from)
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+	closure, err := store.Closure(ctx, src, storePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query the closure of %s: %w", storePath, err)
+	}
+	paths := closure.Sorted()
+	p.Paths = make(map[string]string, len(paths))
+	for _, path := range paths {
+		p.Paths[path] = closure.Paths[path].NarHash
+	}
+
+	if err := copyClosure(ctx, src, closure, from, to, push); err != nil {
+		return nil, fmt.Errorf("failed to copy the closure to %s: %w", to, err)
+	}
+	// paths already in the destination aren't copied, they are signed all the same
+	if keyFile != "" {
+		if err := runNix(ctx, append([]string{"store", "sign", "--store", to, "--key-file", keyFile}, paths...)...); err != nil {
+			return nil, fmt.Errorf("failed to sign the closure in %s: %w", to, err)
+		}
+	}
+
+	dst, err := promotionStore(to)
+	if err != nil {
+		return nil, err
+	}
+	defer dst.Close()
+	for _, path := range paths {
+		info, err := dst.QueryPathInfo(ctx, path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to verify the promotion: %w", err)
+		}
+		if err := verifyPromoted(path, p.Paths[path], p.KeyName, info); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+// copyClosure copies the paths of the closure to the destination, pushing their NARs when bsf can read them from the
+// source and write them to the destination, with nix copy otherwise
+func copyClosure(ctx context.Context, src store.Store, closure *store.Graph, from, to string, push store.PushOptions) error {
+	if push.Compression != "" && isDirectCache(to) && (from == "" || isDirectCache(from)) {
+		dst, err := store.OpenBinaryCache(to)
+		if err != nil {
+			return err
+		}
+		defer dst.Close()
+		dump := func(ctx context.Context, storePath string, w io.Writer) error {
+			return nar.DumpPath(w, HostPath(storePath))
+		}
+		if cache, ok := src.(*store.BinaryCache); ok {
+			dump = func(ctx context.Context, storePath string, w io.Writer) error {
+				_, err := cache.FetchNAR(ctx, storePath, w)
+				return err
+			}
+		}
+		_, err = store.PushClosure(ctx, dst, closure, dump, push)
+		return err
+	}
+
+	dest := to
+	if push.Compression != "" && isBinaryCache(to) {
+		sep := "?"
+		if strings.Contains(to, "?") {
+			sep = "&"
+		}
+		dest += sep + "compression=" + string(push.Compression) + "&parallel-compression=true"
+	}
+	args := []string{"copy", "--to", dest}
+	if from != "" {
+		args = append(args, "--from", from)
+	}
+	return runNix(ctx, append(args, closure.Sorted()...)...)
+}
+
+// isDirectCache returns whether bsf reads and writes the binary cache itself, without nix
+func isDirectCache(uri string) bool {
+	for _, scheme := range []string{"http://", "https://", "file://"} {
+		if strings.HasPrefix(uri, scheme) {
+			return true
+		}
+	}
+	return false
+}
+
+// verifyPromoted checks the path info of the destination has the NAR hash of the source and the signature of the key
+func verifyPromoted(path, narHash, keyName string, info *store.PathInfo) error {
+	if info.NarHash != narHash {
+		return fmt.Errorf("%s has NAR hash %s in the destination, %s in the source", path, info.NarHash, narHash)
+	}
+	if keyName != "" && !slices.ContainsFunc(info.Signatures, func(sig string) bool { return strings.HasPrefix(sig, keyName+":") }) {
+		return fmt.Errorf("%s isn't signed with %s in the destination", path, keyName)
+	}
+	return nil
+}
+
+// SecretKeyName returns the name of a nix secret key, as nix-store --generate-binary-cache-key writes it: <name>:<key>.
+// Signatures made with the key start with its name.
+func SecretKeyName(key []byte) (string, error) {
+	name, secret, ok := strings.Cut(strings.TrimSpace(string(key)), ":")
+	if !ok || name == "" || secret == "" {
+		return "", fmt.Errorf("not a nix secret key, expected <name>:<base64 key>")
+	}
+	return name, nil
+}
+
+// promotionStore returns the store to query the path infos of a promotion from, the default store when uri is empty
+func promotionStore(uri string) (store.Store, error) {
+	if uri == "" {
+		return &pathInfoStore{uri: storeURI}, nil
+	}
+	if isRemoteStore(uri) {
+		return openRemoteStore(uri)
+	}
+	return &pathInfoStore{uri: uri}, nil
+}
+
+// runNix runs a nix command, its stderr is returned on failure
+func runNix(ctx context.Context, args ...string) error {
+	cmd, cancel := nixCommandContext(ctx, "nix", args...)
+	defer cancel()
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return failed(cmd, err)
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/buildsafedev/bsf/pkg/nix/store"
+)
+
+func TestSecretKeyName(t *testing.T) {
+	tests := []struct {
+		key     string
+		want    string
+		wantErr bool
+	}{
+		{key: "prod-cache-1:c2VjcmV0\n", want: "prod-cache-1"},
+		{key: "c2VjcmV0", wantErr: true},
+		{key: ":c2VjcmV0", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := SecretKeyName([]byte(tt.key))
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("SecretKeyName(%q) = %q, %v, want %q", tt.key, got, err, tt.want)
+		}
+	}
+}
+
+func TestVerifyPromoted(t *testing.T) {
+	path := "/nix/store/aaaa-app-1.0"
+	tests := []struct {
+		name    string
+		keyName string
+		info    store.PathInfo
+		wantErr bool
+	}{
+		{name: "same hash", info: store.PathInfo{NarHash: "abcd"}},
+		{name: "other hash", info: store.PathInfo{NarHash: "ef01"}, wantErr: true},
+		{name: "signed", keyName: "prod-1", info: store.PathInfo{NarHash: "abcd", Signatures: []string{"staging-1:x", "prod-1:y"}}},
+		{name: "not signed", keyName: "prod-1", info: store.PathInfo{NarHash: "abcd", Signatures: []string{"prod-10:y"}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := verifyPromoted(path, "abcd", tt.keyName, &tt.info)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("verifyPromoted() = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,174 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/buildsafedev/bsf/pkg/deadline"
+	"github.com/buildsafedev/bsf/pkg/nix/store"
+)
+
+// remote is the store closures and NAR hashes are queried from rather than read on this host, nil unless a remote
+// store or binary cache was set
+var remote store.Store
+
+// isRemoteStore returns whether the store URI is a store on another host or a binary cache rather than a local store
+func isRemoteStore(uri string) bool {
+	scheme, _, ok := strings.Cut(uri, "://")
+	return ok && scheme != "local"
+}
+
+// isBinaryCache returns whether the store is a binary cache: nix can substitute from it but not build in it
+func isBinaryCache(uri string) bool {
+	for _, scheme := range []string{"http://", "https://", "file://", "s3://", "gs://"} {
+		if strings.HasPrefix(uri, scheme) {
+			return true
+		}
+	}
+	return false
+}
+
+// openRemoteStore returns the store to query the remote store from. The .narinfo files of http(s):// and file://
+// binary caches are read directly, the other stores, such as ssh-ng://builder or s3://bucket, are queried with nix.
+func openRemoteStore(uri string) (store.Store, error) {
+	switch {
+	case strings.HasPrefix(uri, "http://"), strings.HasPrefix(uri, "https://"), strings.HasPrefix(uri, "file://"):
+		return store.OpenBinaryCache(uri)
+	}
+	return &pathInfoStore{uri: uri}, nil
+}
+
+// Remote returns whether closures are queried from a remote store or binary cache, whose paths needn't be on this host
+func Remote() bool {
+	return remote != nil
+}
+
+// remoteClosure queries the closure of the store paths from the remote store
+func remoteClosure(roots []string) (*store.Graph, error) {
+	return store.Closure(deadline.Context(), remote, roots...)
+}
+
+// remoteNarHash returns the NAR hash the remote store recorded for the store path, in nixbase32
+func remoteNarHash(storePath string) (string, error) {
+	info, err := remote.QueryPathInfo(deadline.Context(), storePath)
+	if err != nil {
+		return "", err
+	}
+	return narHash(info)
+}
+
+// pathInfoStore queries a store nix reaches itself with nix path-info, in one command for a whole closure
+type pathInfoStore struct {
+	uri string
+}
+
+// QueryPathInfo returns the path info of the store path
+func (s *pathInfoStore) QueryPathInfo(ctx context.Context, storePath string) (*store.PathInfo, error) {
+	infos, err := s.pathInfo(storePath)
+	if err != nil {
+		return nil, err
+	}
+	info, ok := infos[storePath]
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", storePath, store.ErrNotValid)
+	}
+	return info, nil
+}
+
+// QueryClosure returns the closure of the store paths
+func (s *pathInfoStore) QueryClosure(ctx context.Context, roots ...string) (*store.Graph, error) {
+	infos, err := s.pathInfo(append([]string{"--recursive"}, roots...)...)
+	if err != nil {
+		return nil, err
+	}
+	for _, root := range roots {
+		if _, ok := infos[root]; !ok {
+			return nil, fmt.Errorf("%s: %w", root, store.ErrNotValid)
+		}
+	}
+	return &store.Graph{Roots: roots, Paths: infos}, nil
+}
+
+// Close does nothing, each query runs its own command
+func (s *pathInfoStore) Close() error {
+	return nil
+}
+
+func (s *pathInfoStore) pathInfo(args ...string) (map[string]*store.PathInfo, error) {
+	args = append([]string{"path-info", "--json"}, args...)
+	// binary caches aren't the store of the nix commands, see SetStore
+	if storeURI != s.uri {
+		args = append([]string{"--store", s.uri}, args...)
+	}
+	cmd, cancel := nixCommand("nix", args...)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, failed(cmd, err)
+	}
+	return parsePathInfo(stdout.Bytes())
+}
+
+// pathInfoJSON is the path info nix path-info --json prints
+type pathInfoJSON struct {
+	Path             string   `json:"path"`
+	Valid            *bool    `json:"valid"`
+	NarHash          string   `json:"narHash"`
+	NarSize          uint64   `json:"narSize"`
+	References       []string `json:"references"`
+	Deriver          string   `json:"deriver"`
+	RegistrationTime int64    `json:"registrationTime"`
+	Signatures       []string `json:"signatures"`
+	CA               string   `json:"ca"`
+}
+
+// parsePathInfo parses the output of nix path-info --json: a list of path infos up to nix 2.18, an object keyed by
+// store path since, with null for invalid paths. Invalid paths are left out.
+func parsePathInfo(data []byte) (map[string]*store.PathInfo, error) {
+	var list []*pathInfoJSON
+	if err := json.Unmarshal(data, &list); err != nil {
+		var byPath map[string]*pathInfoJSON
+		if err := json.Unmarshal(data, &byPath); err != nil {
+			return nil, fmt.Errorf("failed to parse path info: %v", err)
+		}
+		list = make([]*pathInfoJSON, 0, len(byPath))
+		for p, info := range byPath {
+			if info != nil {
+				info.Path = p
+				list = append(list, info)
+			}
+		}
+	}
+
+	infos := make(map[string]*store.PathInfo, len(list))
+	for _, p := range list {
+		if p == nil || (p.Valid != nil && !*p.Valid) {
+			continue
+		}
+		hash, err := store.ParseNarHash(p.NarHash)
+		if err != nil {
+			return nil, fmt.Errorf("path info of %s: %v", p.Path, err)
+		}
+		info := &store.PathInfo{
+			Path:       p.Path,
+			Deriver:    p.Deriver,
+			NarHash:    hash,
+			NarSize:    p.NarSize,
+			References: p.References,
+			Signatures: p.Signatures,
+			CA:         p.CA,
+		}
+		if p.RegistrationTime > 0 {
+			info.RegistrationTime = time.Unix(p.RegistrationTime, 0).UTC()
+		}
+		infos[p.Path] = info
+	}
+	return infos, nil
+}
@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParsePathInfo(t *testing.T) {
+	// nix 2.18 prints a list, later versions an object keyed by store path with null for invalid paths
+	outputs := []string{
+		`[{"path":"/nix/store/bbbb-curl-8.6.0","narHash":"sha256:1impfw8zdgisxkghq9a3q7cn7jb9zyzgxdydiamp8z2nlyyl0h5h","narSize":18735072,"references":["/nix/store/cccc-glibc-2.39"],"deriver":"/nix/store/dddd-curl-8.6.0.drv","registrationTime":1700000000,"signatures":["cache.nixos.org-1:abcd"]},{"path":"/nix/store/zzzz-gone","valid":false}]`,
+		`{"/nix/store/bbbb-curl-8.6.0":{"narHash":"sha256-sEBAvadWfHSris23/r7/aclj2cFDJQzf7Dq+9hF3t8Y=","narSize":18735072,"references":["/nix/store/cccc-glibc-2.39"],"deriver":"/nix/store/dddd-curl-8.6.0.drv","registrationTime":1700000000,"signatures":["cache.nixos.org-1:abcd"],"ca":null},"/nix/store/zzzz-gone":null}`,
+	}
+	for _, out := range outputs {
+		infos, err := parsePathInfo([]byte(out))
+		if err != nil {
+			t.Fatalf("parsePathInfo(%s) error = %v", out, err)
+		}
+		if len(infos) != 1 {
+			t.Fatalf("parsePathInfo(%s) = %v, want curl only", out, infos)
+		}
+		info := infos["/nix/store/bbbb-curl-8.6.0"]
+		if info == nil || info.NarHash != "b04040bda7567c74ab8acdb7febeff69c963d9c143250cdfec3abef61177b7c6" ||
+			info.Deriver != "/nix/store/dddd-curl-8.6.0.drv" || !reflect.DeepEqual(info.References, []string{"/nix/store/cccc-glibc-2.39"}) ||
+			info.RegistrationTime.Unix() != 1700000000 {
+			t.Errorf("parsePathInfo(%s) = %+v", out, info)
+		}
+	}
+
+	if _, err := parsePathInfo([]byte(`[{"path":"/nix/store/bbbb-curl-8.6.0","narHash":"md5:abcd"}]`)); err == nil {
+		t.Error("parsePathInfo of an md5 NAR hash succeeded")
+	}
+}
+
+func TestBinaryCacheClosure(t *testing.T) {
+	dir := t.TempDir()
+	for name, info := range map[string]string{
+		"bbbb.narinfo": "StorePath: /nix/store/bbbb-curl-8.6.0\nURL: nar/a.nar\nCompression: none\nNarHash: sha256:1impfw8zdgisxkghq9a3q7cn7jb9zyzgxdydiamp8z2nlyyl0h5h\nNarSize: 1\nReferences: cccc-glibc-2.39\n",
+		"cccc.narinfo": "StorePath: /nix/store/cccc-glibc-2.39\nURL: nar/b.nar\nCompression: none\nNarHash: sha256:0a2nssks6n8dkvmx8v9nccxhhjjaw7xk8x9gz3bl6n0rd7b8dn2a\nNarSize: 1\nReferences: \n",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(info), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := SetStore("file://" + dir); err != nil {
+		t.Fatal(err)
+	}
+	defer SetStore("")
+	if !Remote() || storeURI != "" {
+		t.Fatalf("binary caches are queried, not the store of the nix commands: store %q", storeURI)
+	}
+
+	// neither path is on this host
+	graph, err := StoreClosureGraph("/nix/store/bbbb-curl-8.6.0/bin/curl")
+	if err != nil {
+		t.Fatalf("StoreClosureGraph() error = %v", err)
+	}
+	curl := graph.Nodes.Lookup[`"bbbb-curl-8.6.0"`]
+	if curl == nil || curl.Attrs["hash"] != "1impfw8zdgisxkghq9a3q7cn7jb9zyzgxdydiamp8z2nlyyl0h5h" || curl.Attrs["name"] != "curl" {
+		t.Fatalf("curl = %+v", curl)
+	}
+	if len(graph.Edges.Edges) != 1 || graph.Edges.Edges[0].Src != `"cccc-glibc-2.39"` {
+		t.Errorf("edges = %+v, want glibc to curl", graph.Edges.Edges)
+	}
+
+	hash, err := GetNarHashFromPath("/nix/store/cccc-glibc-2.39")
+	if err != nil || hash != "0a2nssks6n8dkvmx8v9nccxhhjjaw7xk8x9gz3bl6n0rd7b8dn2a" {
+		t.Errorf("GetNarHashFromPath(glibc) = %s, %v", hash, err)
+	}
+}
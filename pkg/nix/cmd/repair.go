@@ -0,0 +1,92 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/awalterschulze/gographviz"
+
+	"github.com/buildsafedev/bsf/pkg/deadline"
+)
+
+// StoreCheck is how the closure paths the store recorded the NAR hash of are checked against it
+type StoreCheck int
+
+const (
+	// CheckNone trusts the NAR hashes the store recorded, the paths aren't hashed again
+	CheckNone StoreCheck = iota
+	// CheckHashes hashes the paths again and records the ones that don't hash to the NAR hash the store recorded,
+	// e.g. corrupted on disk or modified in place
+	CheckHashes
+	// CheckRepair also repairs them with nix store repair, which substitutes or rebuilds them, and hashes them again
+	CheckRepair
+)
+
+// Graph attributes of the paths whose content didn't hash to the NAR hash the store recorded
+const (
+	// AttrHashMismatch is the hash the store recorded and the one the path hashed to, separated by a space. The hash
+	// of the node is the one of the path once repaired, its content otherwise.
+	AttrHashMismatch = "hash_mismatch"
+	// AttrRepaired is true when nix store repair restored the content the store recorded
+	AttrRepaired = "repaired"
+	// AttrRepairError is why the path couldn't be repaired
+	AttrRepairError = "repair_error"
+)
+
+// repairStorePath repairs the store path, it is replaced in tests
+var repairStorePath = RepairPath
+
+// RepairPath restores the content of the store path the store recorded, substituting or rebuilding it
+func RepairPath(storePath string) error {
+	cmd, cancel := nixCommand("nix", "store", "repair", storePath)
+	defer cancel()
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+	if err != nil {
+		if deadline.Exceeded() {
+			return deadline.Wrap(cmd, err)
+		}
+		return fmt.Errorf("failed to repair %s: %s", storePath, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// checkNarHash hashes the store path the store recorded the NAR hash of, and records in attrs when it hashes to
+// another one, repairing the path when check is CheckRepair. It returns the hash of the path and the special files
+// its serialisation skipped.
+func checkNarHash(storePath, recorded string, check StoreCheck, attrs gographviz.Attrs) (string, []string, error) {
+	actual, skipped, err := narHashOfPath(storePath)
+	if err != nil || actual == recorded {
+		return actual, skipped, err
+	}
+	attrs[AttrHashMismatch] = recorded + " " + actual
+	if check != CheckRepair {
+		return actual, skipped, nil
+	}
+
+	if err := repairStorePath(storePath); err != nil {
+		attrs[AttrRepairError] = strings.Join(strings.Fields(err.Error()), " ")
+		return actual, skipped, nil
+	}
+	repaired, skipped, err := narHashOfPath(storePath)
+	if err != nil {
+		return "", nil, err
+	}
+	if repaired != recorded {
+		attrs[AttrRepairError] = fmt.Sprintf("the repaired path hashes to %s", repaired)
+		return repaired, skipped, nil
+	}
+	attrs[AttrRepaired] = "true"
+	return repaired, skipped, nil
+}
+
+// HashMismatch returns the hash the store recorded of the path of the node and the one its content hashed to, ok is
+// false when they matched or the path wasn't checked
+func HashMismatch(attrs map[string]string) (recorded, actual string, ok bool) {
+	recorded, actual, ok = strings.Cut(attrs[AttrHashMismatch], " ")
+	return recorded, actual, ok
+}
@@ -4,11 +4,13 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+
+	"github.com/buildsafedev/bsf/pkg/toolchain"
 )
 
 // Run runs the project after building it based on instructions defined in bsf.hcl.
 func Run() error {
-	cmd := exec.Command("nix", "run", "bsf/.")
+	cmd := toolchain.Check(exec.Command("nix", "run", "bsf/."))
 
 	// Connect the command's stdin, stdout, and stderr to the terminal
 	cmd.Stdin = os.Stdin
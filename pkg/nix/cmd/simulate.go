@@ -0,0 +1,169 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/awalterschulze/gographviz"
+)
+
+// Substitution replaces a package of nixpkgs with another one, e.g. openssl=libressl
+type Substitution struct {
+	// Attr is the attribute of nixpkgs that is replaced, e.g. openssl
+	Attr string
+	// With is the attribute path of nixpkgs replacing it, e.g. libressl or python3Packages.pycryptodome
+	With string
+}
+
+var (
+	nixAttrRe     = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_'-]*$`)
+	nixAttrPathRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_'-]*(\.[A-Za-z_][A-Za-z0-9_'-]*)*$`)
+)
+
+// ParseSubstitution parses a substitution written as <attr>=<attr path>, e.g. openssl=libressl
+func ParseSubstitution(s string) (Substitution, error) {
+	attr, with, ok := strings.Cut(s, "=")
+	attr, with = strings.TrimSpace(attr), strings.TrimSpace(with)
+	if !ok || attr == "" || with == "" {
+		return Substitution{}, fmt.Errorf("invalid substitution %q, use <package>=<replacement>, e.g. openssl=libressl", s)
+	}
+	if !nixAttrRe.MatchString(attr) {
+		return Substitution{}, fmt.Errorf("invalid substitution %q, %s is not a top-level attribute of nixpkgs", s, attr)
+	}
+	if !nixAttrPathRe.MatchString(with) {
+		return Substitution{}, fmt.Errorf("invalid substitution %q, %s is not an attribute path of nixpkgs", s, with)
+	}
+	return Substitution{Attr: attr, With: with}, nil
+}
+
+// SubstitutionOverlay returns the nixpkgs overlay applying the substitutions
+func SubstitutionOverlay(subs []Substitution) string {
+	var b strings.Builder
+	b.WriteString("final: prev: {")
+	for _, s := range subs {
+		fmt.Fprintf(&b, " %s = final.%s;", s.Attr, s.With)
+	}
+	b.WriteString(" }")
+	return b.String()
+}
+
+// Simulation holds the derivations of the default package of a flake evaluated without and with an overlay
+type Simulation struct {
+	Current   string `json:"current"`
+	Simulated string `json:"simulated"`
+}
+
+// SimulateOverlay evaluates the default package of the flake in dir for the system as it is and with the nixpkgs
+// overlay applied, without building either. The arguments of the package taken from nixpkgs are taken from nixpkgs
+// with the overlay instead, so the overlay reaches every package of nixpkgs the package depends on. Builders of other
+// flake inputs, e.g. buildGoApplication of gomod2nix, keep the nixpkgs they were given.
+func SimulateOverlay(dir, system, overlay string) (*Simulation, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	expr := fmt.Sprintf(`let
+		flake = builtins.getFlake %s;
+		system = %q;
+		pkg = flake.packages.${system}.default;
+		pkgs = import flake.inputs.nixpkgs { inherit system; };
+		simulatedPkgs = import flake.inputs.nixpkgs { inherit system; overlays = [ (%s) ]; };
+		fromNixpkgs = name: value: pkgs ? ${name} && (builtins.isFunction value
+			|| (builtins.tryEval (value.drvPath or null != null && value.drvPath or null == pkgs.${name}.drvPath or null)).value);
+		replace = name: value:
+			if name == "pkgs" then simulatedPkgs
+			else if fromNixpkgs name value then simulatedPkgs.${name}
+			else value;
+	in {
+		current = pkg.drvPath;
+		simulated = (pkg.override (args: builtins.mapAttrs replace args)).drvPath;
+	}`, strconv.Quote(abs), system, overlay)
+
+	data, err := EvalJSON(expr)
+	if err != nil {
+		return nil, err
+	}
+	sim := &Simulation{}
+	if err := json.Unmarshal(data, sim); err != nil {
+		return nil, fmt.Errorf("failed to parse the simulated derivations: %v", err)
+	}
+	return sim, nil
+}
+
+// DerivationGraph returns the derivations and sources the derivation is built from, as GetBuildClosureGraph does for
+// a result, for derivations that were evaluated but not built. The hash of a node is the one of its store path, which
+// changes whenever the derivation has to be rebuilt.
+func DerivationGraph(drvPath string) (*gographviz.Graph, error) {
+	graph, err := buildClosure(drvPath, ReadDerivation)
+	if err != nil {
+		return nil, err
+	}
+	for _, node := range graph.Nodes.Nodes {
+		if hash, _, ok := strings.Cut(CleanNameFromGraph(node.Name), "-"); ok {
+			node.Attrs["hash"] = hash
+		}
+	}
+	return graph, nil
+}
+
+// DryRun holds what nix would do to build a derivation
+type DryRun struct {
+	// Build are the derivations that would be built
+	Build []string `json:"build"`
+	// Fetch are the store paths that would be substituted from the binary caches
+	Fetch []string `json:"fetch"`
+}
+
+// DryRunBuild returns the derivations nix would build and the store paths it would fetch to build the derivation,
+// without building or fetching anything
+func DryRunBuild(drvPath string) (*DryRun, error) {
+	cmd, cancel := nixCommand("nix", "build", "--dry-run", "--no-link", drvPath+"^*")
+	defer cancel()
+
+	var stdout bytes.Buffer
+	var stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+	if err != nil {
+		return nil, failed(cmd, err)
+	}
+	return parseDryRun(stderr.String()), nil
+}
+
+// parseDryRun parses the report of nix build --dry-run, e.g.
+//
+//	these 2 derivations will be built:
+//	  /nix/store/...-app-1.0.drv
+//	these 3 paths will be fetched (1.20 MiB download, 5.10 MiB unpacked):
+//	  /nix/store/...-libressl-3.9.2
+func parseDryRun(report string) *DryRun {
+	dr := &DryRun{Build: make([]string, 0), Fetch: make([]string, 0)}
+	var section *[]string
+	sc := bufio.NewScanner(strings.NewReader(report))
+	for sc.Scan() {
+		line := sc.Text()
+		switch {
+		case strings.Contains(line, "will be built"):
+			section = &dr.Build
+		case strings.Contains(line, "will be fetched"):
+			section = &dr.Fetch
+		case section != nil && strings.HasPrefix(strings.TrimSpace(line), StoreDir+"/"):
+			*section = append(*section, strings.TrimSpace(line))
+		default:
+			section = nil
+		}
+	}
+	sort.Strings(dr.Build)
+	sort.Strings(dr.Fetch)
+	return dr
+}
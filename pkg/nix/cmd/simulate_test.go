@@ -0,0 +1,62 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseSubstitution(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Substitution
+		wantErr bool
+	}{
+		{in: "openssl=libressl", want: Substitution{Attr: "openssl", With: "libressl"}},
+		{in: " zlib = zlib-ng ", want: Substitution{Attr: "zlib", With: "zlib-ng"}},
+		{in: "cryptography=python3Packages.pycryptodome", want: Substitution{Attr: "cryptography", With: "python3Packages.pycryptodome"}},
+		{in: "openssl", wantErr: true},
+		{in: "=libressl", wantErr: true},
+		{in: "python3Packages.requests=httpx", wantErr: true},
+		{in: "openssl=libressl; rm", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseSubstitution(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseSubstitution(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseSubstitution(%q) = %+v, want %+v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestSubstitutionOverlay(t *testing.T) {
+	got := SubstitutionOverlay([]Substitution{{Attr: "openssl", With: "libressl"}, {Attr: "zlib", With: "zlib-ng"}})
+	want := "final: prev: { openssl = final.libressl; zlib = final.zlib-ng; }"
+	if got != want {
+		t.Errorf("SubstitutionOverlay() = %q, want %q", got, want)
+	}
+}
+
+func TestParseDryRun(t *testing.T) {
+	report := strings.Join([]string{
+		"these 2 derivations will be built:",
+		"  /nix/store/bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb-curl-8.7.1.drv",
+		"  /nix/store/aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa-app-1.0.drv",
+		"this path will be fetched (1.20 MiB download, 5.10 MiB unpacked):",
+		"  /nix/store/cccccccccccccccccccccccccccccccc-libressl-3.9.2",
+		"warning: Git tree '/src' is dirty",
+	}, "\n")
+	dr := parseDryRun(report)
+	if len(dr.Build) != 2 || !strings.HasSuffix(dr.Build[0], "-app-1.0.drv") {
+		t.Errorf("Build = %v", dr.Build)
+	}
+	if len(dr.Fetch) != 1 || !strings.HasSuffix(dr.Fetch[0], "-libressl-3.9.2") {
+		t.Errorf("Fetch = %v", dr.Fetch)
+	}
+
+	if dr := parseDryRun(""); len(dr.Build) != 0 || len(dr.Fetch) != 0 {
+		t.Errorf("nothing to do = %+v", dr)
+	}
+}
@@ -0,0 +1,111 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/nix-community/go-nix/pkg/derivation"
+)
+
+// GetDeriver returns the derivation that produced the store path
+func GetDeriver(storePath string) (string, error) {
+	if info, ok, err := localPathInfo(storePath); ok {
+		if err != nil {
+			return "", err
+		}
+		if info.Deriver == "" {
+			return "", fmt.Errorf("no deriver known for %s", storePath)
+		}
+		return info.Deriver, nil
+	}
+	cmd, cancel := nixCommand("nix-store", "--query", "--deriver", storePath)
+	defer cancel()
+
+	var stdout bytes.Buffer
+	var stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+	if err != nil {
+		return "", failed(cmd, err)
+	}
+
+	drvPath := strings.TrimSpace(stdout.String())
+	if drvPath == "unknown-deriver" {
+		return "", fmt.Errorf("no deriver known for %s", storePath)
+	}
+	return drvPath, nil
+}
+
+// ReadDerivation reads the derivation at drvPath
+func ReadDerivation(drvPath string) (*derivation.Derivation, error) {
+	f, err := os.Open(HostPath(drvPath))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return derivation.ReadDerivation(f)
+}
+
+// GetSourceURLs returns the URLs the fixed-output inputs of the derivation were fetched from, with mirror:// URLs expanded.
+// The URLs of the src attribute come first. Git sources are returned as git+<url>@<rev>.
+func GetSourceURLs(drvPath string) ([]string, error) {
+	drv, err := ReadDerivation(drvPath)
+	if err != nil {
+		return nil, err
+	}
+
+	src := drv.Env["src"]
+	var primary, others []string
+	for inputPath := range drv.InputDerivations {
+		input, err := ReadDerivation(inputPath)
+		if err != nil {
+			continue
+		}
+		urls := fetchURLs(input)
+		if len(urls) == 0 {
+			continue
+		}
+
+		isSrc := false
+		for _, o := range input.Outputs {
+			if o.Path == src {
+				isSrc = true
+			}
+		}
+		if isSrc {
+			primary = append(primary, urls...)
+		} else {
+			others = append(others, urls...)
+		}
+	}
+
+	return append(primary, others...), nil
+}
+
+// fetchURLs returns the URLs a fixed-output derivation fetches, or nil if it is not a fetcher
+func fetchURLs(drv *derivation.Derivation) []string {
+	if drv.Env["outputHash"] == "" {
+		return nil
+	}
+
+	// fetchgit and friends
+	if rev := drv.Env["rev"]; rev != "" && drv.Env["url"] != "" {
+		return []string{"git+" + drv.Env["url"] + "@" + rev}
+	}
+
+	raw := drv.Env["urls"]
+	if raw == "" {
+		raw = drv.Env["url"]
+	}
+
+	urls := make([]string, 0)
+	for _, u := range strings.Fields(raw) {
+		urls = append(urls, ExpandMirrorURL(u))
+	}
+	return urls
+}
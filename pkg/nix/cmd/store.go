@@ -0,0 +1,265 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/buildsafedev/bsf/pkg/deadline"
+	"github.com/buildsafedev/bsf/pkg/toolchain"
+)
+
+// StoreDir is the logical location of the store, the prefix of every store path
+const StoreDir = "/nix/store"
+
+// ErrOutsideStore is returned when a store path, or a symlink of one, resolves outside the store
+var ErrOutsideStore = errors.New("outside the store")
+
+var (
+	storeURI  string
+	storeRoot string
+
+	// realStoreDir is where the default store is on this host when /nix is itself a symlink, e.g. to another volume
+	realStoreDir     string
+	realStoreDirOnce sync.Once
+)
+
+// SetStore sets the store the following commands query. A chroot store, local?root=/tmp/nix-root or a plain
+// directory as nix accepts it, keeps its store paths below the root: they are read from there but still named
+// /nix/store/... in the graph and the artifacts. An empty uri, auto, daemon and local use the default store.
+//
+// Closures and NAR hashes are queried from remote stores, e.g. ssh-ng://builder, and from binary caches, e.g.
+// https://cache.example.com or s3://bucket, rather than read from paths realised on this host. nix builds in remote
+// stores, binary caches are only queried: nix builds in the default store and substitutes from its caches.
+func SetStore(uri string) error {
+	storeURI, storeRoot, remote = "", "", nil
+	resetStoreBackend()
+	switch uri {
+	case "", "auto", "daemon", "local":
+		return nil
+	}
+
+	if isRemoteStore(uri) {
+		s, err := openRemoteStore(uri)
+		if err != nil {
+			return err
+		}
+		remote = s
+		if !isBinaryCache(uri) {
+			storeURI = uri
+		}
+		return nil
+	}
+
+	root := uri
+	if !strings.HasPrefix(uri, "/") {
+		name, query, _ := strings.Cut(uri, "?")
+		if name != "local" {
+			return fmt.Errorf("unsupported store %q, stores are local chroot stores (local?root=/path), remote stores (ssh-ng://host) or binary caches (https://host)", uri)
+		}
+		params, err := url.ParseQuery(query)
+		if err != nil {
+			return fmt.Errorf("invalid store %q: %w", uri, err)
+		}
+		if root = params.Get("root"); root == "" {
+			return fmt.Errorf("store %q has no root", uri)
+		}
+	}
+
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return err
+	}
+	if fi, err := os.Stat(filepath.Join(root, StoreDir)); err != nil || !fi.IsDir() {
+		return fmt.Errorf("%s is not a chroot store, %s doesn't exist", root, filepath.Join(root, StoreDir))
+	}
+	storeURI, storeRoot = uri, root
+	return nil
+}
+
+// StoreRoot returns the root of the chroot store, empty for the default store
+func StoreRoot() string {
+	return storeRoot
+}
+
+// HostPath returns where a store path is on this host, below the root of a chroot store
+func HostPath(path string) string {
+	if storeRoot == "" || !IsStorePath(path) {
+		return path
+	}
+	return filepath.Join(storeRoot, path)
+}
+
+// EvalSymlinks is filepath.EvalSymlinks for store paths, symlinks of a chroot store are resolved within its root.
+// The returned path is the store path, see HostPath to read it. Store paths whose symlinks resolve outside the store,
+// e.g. to /etc or to the home of the user, fail with ErrOutsideStore rather than describing files of the host.
+func EvalSymlinks(path string) (string, error) {
+	if !IsStorePath(path) {
+		return filepath.EvalSymlinks(path)
+	}
+	if storeRoot == "" {
+		resolved, err := filepath.EvalSymlinks(path)
+		if err != nil {
+			return "", err
+		}
+		if !inStore(resolved) {
+			return "", fmt.Errorf("%s resolves to %s: %w", path, resolved, ErrOutsideStore)
+		}
+		return resolved, nil
+	}
+
+	parts := strings.Split(strings.TrimPrefix(filepath.Clean(path), "/"), "/")
+	resolved := "/"
+	for links := 0; len(parts) > 0; {
+		part := parts[0]
+		parts = parts[1:]
+		if part == "" || part == "." {
+			continue
+		}
+		if part == ".." {
+			resolved = filepath.Dir(resolved)
+			continue
+		}
+
+		next := filepath.Join(resolved, part)
+		fi, err := os.Lstat(filepath.Join(storeRoot, next))
+		if err != nil {
+			return "", err
+		}
+		if fi.Mode()&os.ModeSymlink == 0 {
+			resolved = next
+			continue
+		}
+
+		if links++; links > 255 {
+			return "", fmt.Errorf("too many levels of symbolic links in %s", path)
+		}
+		target, err := os.Readlink(filepath.Join(storeRoot, next))
+		if err != nil {
+			return "", err
+		}
+		if !filepath.IsAbs(target) {
+			target = filepath.Join(resolved, target)
+		}
+		parts = append(strings.Split(strings.TrimPrefix(filepath.Clean(target), "/"), "/"), parts...)
+		resolved = "/"
+	}
+	// the targets are resolved within the root, those outside the store are still files of the chroot store's host
+	if !IsStorePath(resolved) {
+		return "", fmt.Errorf("%s resolves to %s: %w", path, resolved, ErrOutsideStore)
+	}
+	return resolved, nil
+}
+
+// CheckStorePath checks that the path is a store path as nix names them, /nix/store/<hash>-<name>, rather than a
+// relative path, a path that leaves the store with .. or the store itself
+func CheckStorePath(path string) error {
+	name, ok := strings.CutPrefix(path, StoreDir+"/")
+	if !ok || filepath.Clean(path) != path || strings.Contains(name, "/") {
+		return fmt.Errorf("%s is not a store path: %w", path, ErrOutsideStore)
+	}
+	hash, _, ok := strings.Cut(name, "-")
+	if !ok || len(hash) != 32 {
+		return fmt.Errorf("%s is not a store path: %w", path, ErrOutsideStore)
+	}
+	return nil
+}
+
+// inStore reports if the path resolved on this host is in the default store
+func inStore(resolved string) bool {
+	if IsStorePath(resolved) {
+		return true
+	}
+	realStoreDirOnce.Do(func() {
+		realStoreDir, _ = filepath.EvalSymlinks(StoreDir)
+	})
+	return realStoreDir != "" && (resolved == realStoreDir || strings.HasPrefix(resolved, realStoreDir+"/"))
+}
+
+// ResultPath returns the store path the result symlink of the build points to
+func ResultPath(output, symlink string) (string, error) {
+	link := filepath.Join(output, symlink)
+	target, err := os.Readlink(link)
+	if err != nil {
+		return "", fmt.Errorf("failed to read symlink: %v", err)
+	}
+	if IsStorePath(target) {
+		return EvalSymlinks(target)
+	}
+	resolved, err := filepath.EvalSymlinks(link)
+	if err != nil {
+		return "", err
+	}
+	if !inStore(resolved) {
+		return "", fmt.Errorf("%s resolves to %s: %w", link, resolved, ErrOutsideStore)
+	}
+	return resolved, nil
+}
+
+// ResolveStorePath returns the store path of a store path, of a file within one or of a symlink to one,
+// such as a result symlink
+func ResolveStorePath(p string) (string, error) {
+	if remote != nil && IsStorePath(p) {
+		// the paths of remote stores needn't be on this host to resolve symlinks within them
+		name, _, _ := strings.Cut(strings.TrimPrefix(filepath.Clean(p), StoreDir+"/"), "/")
+		if name == "" || name == filepath.Base(StoreDir) {
+			return "", fmt.Errorf("%s is not in the store", p)
+		}
+		return filepath.Join(StoreDir, name), nil
+	}
+	if !IsStorePath(p) {
+		// result symlinks point to the store path, also in chroot stores where it isn't a host path
+		link, err := os.Readlink(p)
+		if err != nil {
+			return "", fmt.Errorf("%s is neither a store path nor a symlink to one", p)
+		}
+		p = link
+	}
+
+	resolved, err := EvalSymlinks(p)
+	if err != nil {
+		return "", err
+	}
+	// the store path is the top level entry of the store, not a file within it
+	name, _, _ := strings.Cut(strings.TrimPrefix(resolved, StoreDir+"/"), "/")
+	if name == "" || !strings.HasPrefix(resolved, StoreDir+"/") {
+		return "", fmt.Errorf("%s is not in the store", p)
+	}
+	return filepath.Join(StoreDir, name), nil
+}
+
+// IsStorePath reports if the path is in the store, the store directory included
+func IsStorePath(path string) bool {
+	return path == StoreDir || strings.HasPrefix(path, StoreDir+"/")
+}
+
+// nixCommand returns the nix command limited by the budget of the run, with the store and the scrubbed environment to use
+func nixCommand(name string, args ...string) (*exec.Cmd, context.CancelFunc) {
+	return nixCommandContext(context.Background(), name, args...)
+}
+
+// NixCommand returns the nix command as bsf runs it: limited by the budget of the run and stopped when ctx is done,
+// checked against the trusted toolchain, with the store and the scrubbed environment to use
+func NixCommand(ctx context.Context, name string, args ...string) (*exec.Cmd, context.CancelFunc) {
+	return nixCommandContext(ctx, name, args...)
+}
+
+// nixCommandContext returns the nix command as nixCommand does, also stopped when ctx is done
+func nixCommandContext(ctx context.Context, name string, args ...string) (*exec.Cmd, context.CancelFunc) {
+	if storeURI != "" {
+		args = append([]string{"--store", storeURI}, args...)
+	}
+	cmd, cancel := deadline.CommandContext(ctx, name, args...)
+	toolchain.Check(cmd)
+	// without its TMPDIR, the command runs in the environment of bsf rather than failing
+	if err := prepareTempDir(); err == nil {
+		cmd.Env = commandEnv(os.Environ())
+	}
+	return cmd, cancel
+}
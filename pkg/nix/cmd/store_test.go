@@ -0,0 +1,165 @@
+package cmd
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	bio "github.com/buildsafedev/bsf/pkg/io"
+)
+
+func TestSetStore(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, StoreDir), 0755); err != nil {
+		t.Fatal(err)
+	}
+	defer SetStore("")
+
+	tests := []struct {
+		uri      string
+		wantRoot string
+		wantErr  bool
+	}{
+		{uri: "", wantRoot: ""},
+		{uri: "daemon", wantRoot: ""},
+		{uri: "local?root=" + root, wantRoot: root},
+		{uri: root, wantRoot: root},
+		{uri: "local?root=" + filepath.Join(root, "missing"), wantErr: true},
+		{uri: "local", wantRoot: ""},
+		{uri: "local?state=/tmp", wantErr: true},
+		// remote stores and binary caches are queried rather than read below a root
+		{uri: "ssh-ng://builder", wantRoot: ""},
+		{uri: "https://cache.example.com", wantRoot: ""},
+		{uri: "https://[cache", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		err := SetStore(tt.uri)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("SetStore(%q) error = %v, wantErr %v", tt.uri, err, tt.wantErr)
+			continue
+		}
+		if err == nil && StoreRoot() != tt.wantRoot {
+			t.Errorf("SetStore(%q) root = %q, want %q", tt.uri, StoreRoot(), tt.wantRoot)
+		}
+	}
+}
+
+func TestChrootStore(t *testing.T) {
+	root := t.TempDir()
+	app := filepath.Join(root, StoreDir, "aaaa-app-1.0")
+	wrapped := filepath.Join(root, StoreDir, "bbbb-app-wrapped-1.0")
+	for _, dir := range []string{filepath.Join(app, "bin"), filepath.Join(wrapped, "bin")} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(wrapped, "bin", "app"), []byte("binary"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	// store paths link to each other with their logical path, which doesn't exist on the host
+	if err := os.Symlink("/nix/store/bbbb-app-wrapped-1.0/bin/app", filepath.Join(app, "bin", "app")); err != nil {
+		t.Fatal(err)
+	}
+	output := t.TempDir()
+	if err := os.Symlink("/nix/store/aaaa-app-1.0", filepath.Join(output, "result")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := SetStore("local?root=" + root); err != nil {
+		t.Fatal(err)
+	}
+	defer SetStore("")
+
+	if got := HostPath("/nix/store/aaaa-app-1.0"); got != app {
+		t.Errorf("HostPath() = %s, want %s", got, app)
+	}
+	if got := HostPath("/tmp/bsf-result"); got != "/tmp/bsf-result" {
+		t.Errorf("paths outside the store should be left as is, got %s", got)
+	}
+
+	result, err := ResultPath(output, "result")
+	if err != nil || result != "/nix/store/aaaa-app-1.0" {
+		t.Fatalf("ResultPath() = %s, %v", result, err)
+	}
+	bin, err := EvalSymlinks("/nix/store/aaaa-app-1.0/bin/../bin/app")
+	if err != nil || bin != "/nix/store/bbbb-app-wrapped-1.0/bin/app" {
+		t.Fatalf("EvalSymlinks() = %s, %v", bin, err)
+	}
+
+	hash, err := artifactHash(result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, _ := bio.FileSHA256(filepath.Join(wrapped, "bin", "app"))
+	if hash != want {
+		t.Errorf("artifactHash() = %s, want %s", hash, want)
+	}
+
+	if _, err := GetNarHashFromPath("/nix/store/aaaa-app-1.0"); err != nil {
+		t.Errorf("expected the store path to be hashed below the root: %v", err)
+	}
+}
+
+func TestEvalSymlinksOutsideStore(t *testing.T) {
+	root := t.TempDir()
+	bin := filepath.Join(root, StoreDir, "aaaa-app-1.0", "bin")
+	if err := os.MkdirAll(bin, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for name, target := range map[string]string{
+		"passwd":   "/etc/passwd",
+		"escape":   "../../../../../etc/passwd",
+		"sibling":  "../../bbbb-lib-1.0/lib/libfoo.so",
+		"absolute": "/nix/store/bbbb-lib-1.0/lib/libfoo.so",
+	} {
+		if err := os.Symlink(target, filepath.Join(bin, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	lib := filepath.Join(root, StoreDir, "bbbb-lib-1.0", "lib")
+	if err := os.MkdirAll(lib, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(lib, "libfoo.so"), []byte("lib"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(root, "etc"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "etc", "passwd"), []byte("root"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := SetStore(root); err != nil {
+		t.Fatal(err)
+	}
+	defer SetStore("")
+
+	for name, wantErr := range map[string]bool{"passwd": true, "escape": true, "sibling": false, "absolute": false} {
+		resolved, err := EvalSymlinks("/nix/store/aaaa-app-1.0/bin/" + name)
+		if wantErr != errors.Is(err, ErrOutsideStore) {
+			t.Errorf("EvalSymlinks(%s) = %s, %v", name, resolved, err)
+		}
+		if !wantErr && resolved != "/nix/store/bbbb-lib-1.0/lib/libfoo.so" {
+			t.Errorf("EvalSymlinks(%s) = %s", name, resolved)
+		}
+	}
+}
+
+func TestCheckStorePath(t *testing.T) {
+	for path, valid := range map[string]bool{
+		"/nix/store/0c0n2h2c8zsx3djq6qbd2a9qnv1jy6z0-hello-2.12.1":       true,
+		"/nix/store/0c0n2h2c8zsx3djq6qbd2a9qnv1jy6z0-hello-2.12.1/bin":   false,
+		"/nix/store/../../etc/passwd":                                    false,
+		"/nix/store/0c0n2h2c8zsx3djq6qbd2a9qnv1jy6z0-hello/../../../etc": false,
+		"../result":        false,
+		"/nix/store":       false,
+		"/home/user/hello": false,
+	} {
+		if err := CheckStorePath(path); (err == nil) != valid {
+			t.Errorf("CheckStorePath(%q) = %v", path, err)
+		}
+	}
+}
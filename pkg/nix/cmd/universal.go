@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"debug/macho"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+)
+
+// Slice is the binary of one architecture of a universal (fat) macOS binary
+type Slice struct {
+	// Arch is the architecture of the slice, named as GOARCH names it, e.g. arm64 or amd64
+	Arch string
+	// Digest is the hex sha256 digest of the bytes of the slice, the digest of the thin binary lipo would extract
+	Digest string
+	Offset uint32
+	Size   uint32
+}
+
+// sliceArchs names the CPU types of Mach-O binaries
+var sliceArchs = map[macho.Cpu]string{
+	macho.Cpu386:   "386",
+	macho.CpuAmd64: "amd64",
+	macho.CpuArm:   "arm",
+	macho.CpuArm64: "arm64",
+	macho.CpuPpc:   "ppc",
+	macho.CpuPpc64: "ppc64",
+}
+
+// UniversalSlices returns the slices of a universal macOS binary with their digests, nil for other files
+func UniversalSlices(path string) ([]Slice, error) {
+	fat, err := macho.OpenFat(path)
+	if err != nil {
+		var formatErr *macho.FormatError
+		if errors.Is(err, macho.ErrNotFat) || errors.As(err, &formatErr) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer fat.Close()
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	slices := make([]Slice, 0, len(fat.Arches))
+	for _, arch := range fat.Arches {
+		h := sha256.New()
+		if _, err := io.Copy(h, io.NewSectionReader(f, int64(arch.Offset), int64(arch.Size))); err != nil {
+			return nil, err
+		}
+		name, ok := sliceArchs[arch.Cpu]
+		if !ok {
+			name = arch.Cpu.String()
+		}
+		slices = append(slices, Slice{
+			Arch:   name,
+			Digest: hex.EncodeToString(h.Sum(nil)),
+			Offset: arch.Offset,
+			Size:   arch.Size,
+		})
+	}
+	return slices, nil
+}
@@ -0,0 +1,71 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"debug/macho"
+	"encoding/binary"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// thinMachO returns the header of a 64-bit Mach-O executable without load commands, padded to size
+func thinMachO(cpu macho.Cpu, size int) []byte {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, macho.FileHeader{Magic: macho.Magic64, Cpu: cpu, Type: macho.TypeExec})
+	binary.Write(&buf, binary.LittleEndian, uint32(0))
+	return append(buf.Bytes(), make([]byte, size-buf.Len())...)
+}
+
+func TestUniversalSlices(t *testing.T) {
+	amd64, arm64 := thinMachO(macho.CpuAmd64, 64), thinMachO(macho.CpuArm64, 96)
+	amd64[40] = 1
+
+	var fat bytes.Buffer
+	binary.Write(&fat, binary.BigEndian, []uint32{macho.MagicFat, 2})
+	binary.Write(&fat, binary.BigEndian, []uint32{uint32(macho.CpuAmd64), 3, 4096, uint32(len(amd64)), 12})
+	binary.Write(&fat, binary.BigEndian, []uint32{uint32(macho.CpuArm64), 0, 8192, uint32(len(arm64)), 14})
+	data := append(fat.Bytes(), make([]byte, 4096-fat.Len())...)
+	data = append(data, amd64...)
+	data = append(data, make([]byte, 8192-len(data))...)
+	data = append(data, arm64...)
+
+	dir := t.TempDir()
+	write := func(name string, content []byte) string {
+		p := filepath.Join(dir, name)
+		if err := os.WriteFile(p, content, 0755); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	digest := func(b []byte) string {
+		sum := sha256.Sum256(b)
+		return hex.EncodeToString(sum[:])
+	}
+
+	got, err := UniversalSlices(write("universal", data))
+	if err != nil {
+		t.Fatalf("UniversalSlices() error = %v", err)
+	}
+	want := []Slice{
+		{Arch: "amd64", Digest: digest(amd64), Offset: 4096, Size: 64},
+		{Arch: "arm64", Digest: digest(arm64), Offset: 8192, Size: 96},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("UniversalSlices() = %+v, want %+v", got, want)
+	}
+
+	for name, content := range map[string][]byte{
+		"thin":   arm64,
+		"script": []byte("#!/bin/sh\necho hello\n"),
+		"empty":  {},
+	} {
+		got, err := UniversalSlices(write(name, content))
+		if err != nil || got != nil {
+			t.Errorf("UniversalSlices(%s) = %v, %v, want no slices", name, got, err)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// VariantExpr returns the nix expression of the default package of the flake in dir for the system, with its
+// arguments overridden and then its derivation attributes. The expressions of override have pkgs, the nixpkgs of the
+// flake, in scope, the ones of overrideAttrs old, the attributes of the package, too.
+func VariantExpr(dir, system string, override, overrideAttrs map[string]string) (string, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+
+	pkg := "pkg"
+	if len(override) > 0 {
+		pkg = fmt.Sprintf("(%s.override (args: %s))", pkg, attrSet(override))
+	}
+	if len(overrideAttrs) > 0 {
+		pkg = fmt.Sprintf("(%s.overrideAttrs (old: %s))", pkg, attrSet(overrideAttrs))
+	}
+	return fmt.Sprintf(`let
+		flake = builtins.getFlake %s;
+		system = %q;
+		pkg = flake.packages.${system}.default;
+		pkgs = import flake.inputs.nixpkgs { inherit system; };
+	in with pkgs; %s`, strconv.Quote(abs), system, pkg), nil
+}
+
+// attrSet returns the nix attribute set of the expressions, sorted by name so the expression is stable
+func attrSet(exprs map[string]string) string {
+	names := make([]string, 0, len(exprs))
+	for name := range exprs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	b.WriteString("{")
+	for _, name := range names {
+		fmt.Fprintf(&b, " %s = %s;", name, exprs[name])
+	}
+	b.WriteString(" }")
+	return b.String()
+}
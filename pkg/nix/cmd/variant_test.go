@@ -0,0 +1,48 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestVariantExpr(t *testing.T) {
+	tests := []struct {
+		name          string
+		override      map[string]string
+		overrideAttrs map[string]string
+		want          string
+	}{
+		{
+			name:     "override",
+			override: map[string]string{"withSystemd": "false", "openssl": "pkgs.openssl_3_fips"},
+			want:     `in with pkgs; (pkg.override (args: { openssl = pkgs.openssl_3_fips; withSystemd = false; }))`,
+		},
+		{
+			name:          "overrideAttrs",
+			overrideAttrs: map[string]string{"tags": `old.tags ++ [ "netgo" ]`},
+			want:          `in with pkgs; (pkg.overrideAttrs (old: { tags = old.tags ++ [ "netgo" ]; }))`,
+		},
+		{
+			name:          "both",
+			override:      map[string]string{"debug": "true"},
+			overrideAttrs: map[string]string{"dontStrip": "true"},
+			want:          `in with pkgs; ((pkg.override (args: { debug = true; })).overrideAttrs (old: { dontStrip = true; }))`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expr, err := VariantExpr("/src/app", "x86_64-linux", tt.override, tt.overrideAttrs)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.HasSuffix(expr, tt.want) {
+				t.Errorf("VariantExpr() = %s, want it to end with %s", expr, tt.want)
+			}
+			for _, want := range []string{`builtins.getFlake "/src/app"`, `system = "x86_64-linux"`} {
+				if !strings.Contains(expr, want) {
+					t.Errorf("VariantExpr() = %s, lacks %s", expr, want)
+				}
+			}
+		})
+	}
+}
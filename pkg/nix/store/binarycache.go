@@ -0,0 +1,162 @@
+package store
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/nix-community/go-nix/pkg/narinfo"
+	"zombiezen.com/go/nix/nixbase32"
+)
+
+// storeDir is the store directory binary caches name their paths in
+const storeDir = "/nix/store"
+
+// BinaryCache reads the path info of store paths from the .narinfo files of a binary cache, served over http(s)
+// as cache.nixos.org is or kept in a directory (file://), without realising the paths
+type BinaryCache struct {
+	url    *url.URL
+	client *http.Client
+}
+
+// OpenBinaryCache returns the binary cache at the http://, https:// or file:// URL
+func OpenBinaryCache(cacheURL string) (*BinaryCache, error) {
+	u, err := url.Parse(cacheURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid binary cache %q: %w", cacheURL, err)
+	}
+	switch u.Scheme {
+	case "http", "https", "file":
+	default:
+		return nil, fmt.Errorf("unsupported binary cache %q, only http(s):// and file:// caches are read directly", cacheURL)
+	}
+	// store options such as ?trusted=1 are for nix, not part of the location of the cache
+	u.RawQuery = ""
+	return &BinaryCache{url: u, client: http.DefaultClient}, nil
+}
+
+// QueryPathInfo returns the path info of the .narinfo file of the store path, ErrNotValid when the cache has none
+func (c *BinaryCache) QueryPathInfo(ctx context.Context, storePath string) (*PathInfo, error) {
+	ni, err := c.narInfo(ctx, storePath)
+	if err != nil {
+		return nil, err
+	}
+	return narInfoPathInfo(ni)
+}
+
+// narInfo returns the parsed .narinfo file of the store path
+func (c *BinaryCache) narInfo(ctx context.Context, storePath string) (*narinfo.NarInfo, error) {
+	hashPart, _, ok := strings.Cut(path.Base(storePath), "-")
+	if !ok || path.Dir(storePath) != storeDir {
+		return nil, fmt.Errorf("%s is not a store path", storePath)
+	}
+
+	r, err := c.open(ctx, hashPart+".narinfo")
+	if err != nil {
+		if errors.Is(err, ErrNotValid) {
+			return nil, fmt.Errorf("%s: %w", storePath, err)
+		}
+		return nil, fmt.Errorf("failed to query %s: %w", storePath, err)
+	}
+	defer r.Close()
+
+	ni, err := narinfo.Parse(r)
+	if err != nil {
+		return nil, fmt.Errorf("invalid narinfo of %s: %w", storePath, err)
+	}
+	if ni.StorePath != storePath {
+		return nil, fmt.Errorf("the narinfo of %s is the one of %s", storePath, ni.StorePath)
+	}
+	return ni, nil
+}
+
+// Close does nothing, requests to the cache don't share a connection
+func (c *BinaryCache) Close() error {
+	return nil
+}
+
+// open opens the file of the cache, ErrNotValid when it doesn't exist
+func (c *BinaryCache) open(ctx context.Context, name string) (io.ReadCloser, error) {
+	if c.url.Scheme == "file" {
+		f, err := os.Open(filepath.Join(c.url.Path, name))
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, ErrNotValid
+		}
+		return f, err
+	}
+
+	u := c.url.JoinPath(name).String()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return resp.Body, nil
+	// S3 buckets answer 403 rather than 404 for missing keys unless listing is allowed
+	case http.StatusNotFound, http.StatusForbidden:
+		resp.Body.Close()
+		return nil, ErrNotValid
+	}
+	resp.Body.Close()
+	return nil, fmt.Errorf("GET %s: %s", u, resp.Status)
+}
+
+// narInfoPathInfo returns the path info of the narinfo. Binary caches name references and derivers by their base name.
+func narInfoPathInfo(ni *narinfo.NarInfo) (*PathInfo, error) {
+	if ni.NarHash == nil || ni.NarHash.HashTypeString() != "sha256" {
+		return nil, fmt.Errorf("%s has no sha256 NAR hash", ni.StorePath)
+	}
+	info := &PathInfo{
+		Path:       ni.StorePath,
+		NarHash:    hex.EncodeToString(ni.NarHash.Digest()),
+		NarSize:    ni.NarSize,
+		References: make([]string, 0, len(ni.References)),
+		CA:         ni.CA,
+	}
+	for _, ref := range ni.References {
+		info.References = append(info.References, storeDir+"/"+ref)
+	}
+	if ni.Deriver != "" {
+		info.Deriver = storeDir + "/" + ni.Deriver
+	}
+	for _, sig := range ni.Signatures {
+		info.Signatures = append(info.Signatures, sig.String())
+	}
+	return info, nil
+}
+
+// ParseNarHash returns the sha256 NAR hash in hex, as PathInfo keeps it, of the forms nix prints: sha256:<nixbase32>,
+// sha256:<hex> and the SRI sha256-<base64> of recent versions
+func ParseNarHash(s string) (string, error) {
+	var sum []byte
+	var err error
+	if digest, ok := strings.CutPrefix(s, "sha256-"); ok {
+		sum, err = base64.StdEncoding.DecodeString(digest)
+	} else if digest, ok := strings.CutPrefix(s, "sha256:"); ok {
+		if len(digest) == hex.EncodedLen(32) {
+			sum, err = hex.DecodeString(digest)
+		} else {
+			sum, err = nixbase32.DecodeString(digest)
+		}
+	} else {
+		return "", fmt.Errorf("invalid NAR hash %q, only sha256 hashes are supported", s)
+	}
+	if err != nil || len(sum) != 32 {
+		return "", fmt.Errorf("invalid NAR hash %q", s)
+	}
+	return hex.EncodeToString(sum), nil
+}
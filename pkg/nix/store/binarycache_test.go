@@ -0,0 +1,113 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// narInfos are the .narinfo files of a binary cache holding the closure of curl
+var narInfos = map[string]string{
+	"bbbb.narinfo": `StorePath: /nix/store/bbbb-curl-8.6.0
+URL: nar/1w1fff338fvdw53sqgamddn1b2xgds473pv6y13gizdbqjv4i5p3.nar.xz
+Compression: xz
+FileHash: sha256:1w1fff338fvdw53sqgamddn1b2xgds473pv6y13gizdbqjv4i5p3
+FileSize: 4029176
+NarHash: sha256:1impfw8zdgisxkghq9a3q7cn7jb9zyzgxdydiamp8z2nlyyl0h5h
+NarSize: 18735072
+References: bbbb-curl-8.6.0 cccc-glibc-2.39
+Deriver: dddd-curl-8.6.0.drv
+Sig: cache.nixos.org-1:GrGV/Ls10TzoOaCnrcAqmPbKXFLLSBDeGNh5EQGKyuGA4K1wv1LcRVb6/sU+NAPK8lDiam8XcdJzUngmdhfTBQ==
+`,
+	"cccc.narinfo": `StorePath: /nix/store/cccc-glibc-2.39
+URL: nar/0a2nssks6n8dkvmx8v9nccxhhjjaw7xk8x9gz3bl6n0rd7b8dn2a.nar.xz
+Compression: xz
+FileHash: sha256:0a2nssks6n8dkvmx8v9nccxhhjjaw7xk8x9gz3bl6n0rd7b8dn2a
+FileSize: 1
+NarHash: sha256:0a2nssks6n8dkvmx8v9nccxhhjjaw7xk8x9gz3bl6n0rd7b8dn2a
+NarSize: 1
+References: cccc-glibc-2.39
+`,
+}
+
+func TestBinaryCache(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		info, ok := narInfos[filepath.Base(r.URL.Path)]
+		if !ok || filepath.Dir(r.URL.Path) != "/cache" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(info))
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	for name, info := range narInfos {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(info), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, cacheURL := range []string{srv.URL + "/cache?trusted=1", "file://" + dir} {
+		c, err := OpenBinaryCache(cacheURL)
+		if err != nil {
+			t.Fatalf("OpenBinaryCache(%s) error = %v", cacheURL, err)
+		}
+
+		info, err := c.QueryPathInfo(context.Background(), "/nix/store/bbbb-curl-8.6.0")
+		if err != nil {
+			t.Fatalf("%s: QueryPathInfo() error = %v", cacheURL, err)
+		}
+		want := &PathInfo{
+			Path:       "/nix/store/bbbb-curl-8.6.0",
+			Deriver:    "/nix/store/dddd-curl-8.6.0.drv",
+			NarHash:    "b04040bda7567c74ab8acdb7febeff69c963d9c143250cdfec3abef61177b7c6",
+			NarSize:    18735072,
+			References: []string{"/nix/store/bbbb-curl-8.6.0", "/nix/store/cccc-glibc-2.39"},
+			Signatures: []string{"cache.nixos.org-1:GrGV/Ls10TzoOaCnrcAqmPbKXFLLSBDeGNh5EQGKyuGA4K1wv1LcRVb6/sU+NAPK8lDiam8XcdJzUngmdhfTBQ=="},
+		}
+		if !reflect.DeepEqual(info, want) {
+			t.Errorf("%s: QueryPathInfo() = %+v, want %+v", cacheURL, info, want)
+		}
+
+		g, err := Closure(context.Background(), c, "/nix/store/bbbb-curl-8.6.0")
+		if err != nil {
+			t.Fatalf("%s: Closure() error = %v", cacheURL, err)
+		}
+		if got := g.Sorted(); !reflect.DeepEqual(got, []string{"/nix/store/bbbb-curl-8.6.0", "/nix/store/cccc-glibc-2.39"}) {
+			t.Errorf("%s: Sorted() = %v", cacheURL, got)
+		}
+
+		if _, err := c.QueryPathInfo(context.Background(), "/nix/store/zzzz-gone"); !errors.Is(err, ErrNotValid) {
+			t.Errorf("%s: QueryPathInfo() error = %v, want %v", cacheURL, err, ErrNotValid)
+		}
+	}
+
+	if _, err := OpenBinaryCache("ssh-ng://builder"); err == nil {
+		t.Error("OpenBinaryCache(ssh-ng://builder) succeeded")
+	}
+}
+
+func TestParseNarHash(t *testing.T) {
+	want := "b04040bda7567c74ab8acdb7febeff69c963d9c143250cdfec3abef61177b7c6"
+	for _, s := range []string{
+		"sha256:1impfw8zdgisxkghq9a3q7cn7jb9zyzgxdydiamp8z2nlyyl0h5h",
+		"sha256:" + want,
+		"sha256-sEBAvadWfHSris23/r7/aclj2cFDJQzf7Dq+9hF3t8Y=",
+	} {
+		got, err := ParseNarHash(s)
+		if err != nil || got != want {
+			t.Errorf("ParseNarHash(%s) = %s, %v, want %s", s, got, err, want)
+		}
+	}
+	for _, s := range []string{"", "md5:abcd", "sha256:zzzz"} {
+		if _, err := ParseNarHash(s); err == nil {
+			t.Errorf("ParseNarHash(%q) succeeded", s)
+		}
+	}
+}
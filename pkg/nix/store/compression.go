@@ -0,0 +1,120 @@
+package store
+
+import (
+	"bytes"
+	"compress/bzip2"
+	"context"
+	"fmt"
+	"io"
+	"runtime"
+	"strconv"
+
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/buildsafedev/bsf/pkg/deadline"
+	"github.com/buildsafedev/bsf/pkg/toolchain"
+)
+
+// Compression is the compression of the NAR files of a binary cache, as the Compression field of .narinfo files
+// names it
+type Compression string
+
+const (
+	// CompressionNone stores the NARs as they are
+	CompressionNone Compression = "none"
+	// CompressionZstd is the compression recent caches serve, fast to decompress
+	CompressionZstd Compression = "zstd"
+	// CompressionXz is the compression of cache.nixos.org and the default of nix copy
+	CompressionXz Compression = "xz"
+	// CompressionBzip2 is the compression of old caches, only read
+	CompressionBzip2 Compression = "bzip2"
+)
+
+// ParseCompression returns the compression NARs can be pushed with: none, zstd or xz
+func ParseCompression(s string) (Compression, error) {
+	switch c := Compression(s); c {
+	case CompressionNone, CompressionZstd, CompressionXz:
+		return c, nil
+	case "":
+		return CompressionNone, nil
+	}
+	return "", fmt.Errorf("unsupported NAR compression %q, use none, zstd or xz", s)
+}
+
+// Extension returns the extension of the NAR files of the compression, as nix names them in the nar/ directory
+func (c Compression) Extension() string {
+	switch c {
+	case CompressionZstd:
+		return ".nar.zst"
+	case CompressionXz:
+		return ".nar.xz"
+	case CompressionBzip2:
+		return ".nar.bz2"
+	}
+	return ".nar"
+}
+
+// Compress writes the NAR read from r to w with the compression. zstd and xz compress with workers threads, one per
+// CPU when workers is 0. xz is run with the xz command, as no xz encoder is vendored.
+func Compress(ctx context.Context, w io.Writer, r io.Reader, c Compression, workers int) error {
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	switch c {
+	case CompressionNone, "":
+		_, err := io.Copy(w, r)
+		return err
+	case CompressionZstd:
+		enc, err := zstd.NewWriter(w, zstd.WithEncoderConcurrency(workers))
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(enc, r); err != nil {
+			enc.Close()
+			return err
+		}
+		return enc.Close()
+	case CompressionXz:
+		return runXz(ctx, w, r, "--compress", "--stdout", "-T", strconv.Itoa(workers))
+	}
+	return fmt.Errorf("unsupported NAR compression %q", c)
+}
+
+// Decompress returns the reader of the NAR compressed in r with the compression, the caller closes it
+func Decompress(ctx context.Context, r io.Reader, c Compression) (io.ReadCloser, error) {
+	switch c {
+	case CompressionNone, "":
+		return io.NopCloser(r), nil
+	case CompressionZstd:
+		dec, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return dec.IOReadCloser(), nil
+	case CompressionBzip2:
+		return io.NopCloser(bzip2.NewReader(r)), nil
+	case CompressionXz:
+		pr, pw := io.Pipe()
+		go func() {
+			pw.CloseWithError(runXz(ctx, pw, r, "--decompress", "--stdout"))
+		}()
+		return pr, nil
+	}
+	return nil, fmt.Errorf("unsupported NAR compression %q", c)
+}
+
+// runXz runs the xz command from r to w, limited by the budget of the run as the nix commands are
+func runXz(ctx context.Context, w io.Writer, r io.Reader, args ...string) error {
+	cmd, cancel := deadline.CommandContext(ctx, "xz", args...)
+	defer cancel()
+	toolchain.Check(cmd)
+	var stderr bytes.Buffer
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = r, w, &stderr
+	if err := cmd.Run(); err != nil {
+		if stderr.Len() > 0 {
+			return fmt.Errorf("xz: %v: %s", err, bytes.TrimSpace(stderr.Bytes()))
+		}
+		return fmt.Errorf("xz: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,340 @@
+package store
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/nix-community/go-nix/pkg/wire"
+)
+
+// DefaultSocket is where the nix daemon listens unless NIX_DAEMON_SOCKET_PATH says otherwise
+const DefaultSocket = "/nix/var/nix/daemon-socket/socket"
+
+const (
+	workerMagic1 = 0x6e697863
+	workerMagic2 = 0x6478696f
+
+	// protocolVersion is the version of the worker protocol the client speaks, 1.26
+	protocolVersion = 1<<8 | 26
+
+	opQueryPathInfo = 26
+
+	stderrNext          = 0x6f6c6d67
+	stderrRead          = 0x64617461
+	stderrWrite         = 0x64617416
+	stderrLast          = 0x616c7473
+	stderrError         = 0x63787470
+	stderrStartActivity = 0x53545254
+	stderrStopActivity  = 0x53544f50
+	stderrResult        = 0x52534c54
+
+	// maxString bounds the strings read from the daemon, store paths and messages are far shorter
+	maxString = 1 << 20
+	// maxList bounds the lists read from the daemon, e.g. the references of a path
+	maxList = 1 << 20
+)
+
+// Daemon is a client of the nix daemon. Requests are sent one at a time over a single connection.
+type Daemon struct {
+	mu      sync.Mutex
+	conn    net.Conn
+	r       *bufio.Reader
+	w       *bufio.Writer
+	version uint64
+}
+
+// Socket returns the socket of the nix daemon
+func Socket() string {
+	if s := os.Getenv("NIX_DAEMON_SOCKET_PATH"); s != "" {
+		return s
+	}
+	return DefaultSocket
+}
+
+// Dial connects to the nix daemon listening on the unix socket
+func Dial(ctx context.Context, socket string) (*Daemon, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "unix", socket)
+	if err != nil {
+		return nil, err
+	}
+	daemon, err := NewDaemon(ctx, conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return daemon, nil
+}
+
+// NewDaemon performs the handshake of the worker protocol on the connection
+func NewDaemon(ctx context.Context, conn net.Conn) (*Daemon, error) {
+	d := &Daemon{conn: conn, r: bufio.NewReader(conn), w: bufio.NewWriter(conn)}
+	defer d.setDeadline(ctx)()
+
+	if err := wire.WriteUint64(d.w, workerMagic1); err != nil {
+		return nil, err
+	}
+	if err := d.w.Flush(); err != nil {
+		return nil, err
+	}
+	magic, err := wire.ReadUint64(d.r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the nix daemon handshake: %w", err)
+	}
+	if magic != workerMagic2 {
+		return nil, fmt.Errorf("%s is not a nix daemon socket", conn.RemoteAddr())
+	}
+	serverVersion, err := wire.ReadUint64(d.r)
+	if err != nil {
+		return nil, err
+	}
+	if serverVersion>>8 != 1 || serverVersion&0xff < 21 {
+		return nil, fmt.Errorf("unsupported nix daemon protocol %d.%d", serverVersion>>8, serverVersion&0xff)
+	}
+	d.version = min(serverVersion, protocolVersion)
+
+	// client version, then the obsolete CPU affinity and reserve space settings
+	for _, v := range []uint64{protocolVersion, 0, 0} {
+		if err := wire.WriteUint64(d.w, v); err != nil {
+			return nil, err
+		}
+	}
+	if err := d.w.Flush(); err != nil {
+		return nil, err
+	}
+	if err := d.processStderr(); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// setDeadline applies the deadline of the context to the connection, the returned function clears it
+func (d *Daemon) setDeadline(ctx context.Context) func() {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return func() {}
+	}
+	d.conn.SetDeadline(deadline)
+	return func() { d.conn.SetDeadline(time.Time{}) }
+}
+
+// QueryPathInfo returns the path info of the store path, ErrNotValid when it is not in the store
+func (d *Daemon) QueryPathInfo(ctx context.Context, storePath string) (*PathInfo, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	defer d.setDeadline(ctx)()
+
+	if err := wire.WriteUint64(d.w, opQueryPathInfo); err != nil {
+		return nil, err
+	}
+	if err := wire.WriteString(d.w, storePath); err != nil {
+		return nil, err
+	}
+	if err := d.w.Flush(); err != nil {
+		return nil, err
+	}
+	if err := d.processStderr(); err != nil {
+		return nil, fmt.Errorf("failed to query %s: %w", storePath, err)
+	}
+
+	valid, err := wire.ReadBool(d.r)
+	if err != nil {
+		return nil, err
+	}
+	if !valid {
+		return nil, fmt.Errorf("%s: %w", storePath, ErrNotValid)
+	}
+
+	info := &PathInfo{Path: storePath}
+	if info.Deriver, err = wire.ReadString(d.r, maxString); err != nil {
+		return nil, err
+	}
+	if info.NarHash, err = wire.ReadString(d.r, maxString); err != nil {
+		return nil, err
+	}
+	if info.References, err = d.readStrings(); err != nil {
+		return nil, err
+	}
+	registered, err := wire.ReadUint64(d.r)
+	if err != nil {
+		return nil, err
+	}
+	info.RegistrationTime = time.Unix(int64(registered), 0).UTC()
+	if info.NarSize, err = wire.ReadUint64(d.r); err != nil {
+		return nil, err
+	}
+	// ultimate: the path was built here rather than substituted
+	if _, err := wire.ReadBool(d.r); err != nil {
+		return nil, err
+	}
+	if info.Signatures, err = d.readStrings(); err != nil {
+		return nil, err
+	}
+	if info.CA, err = wire.ReadString(d.r, maxString); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// Close closes the connection to the daemon
+func (d *Daemon) Close() error {
+	return d.conn.Close()
+}
+
+func (d *Daemon) readStrings() ([]string, error) {
+	n, err := wire.ReadUint64(d.r)
+	if err != nil {
+		return nil, err
+	}
+	if n > maxList {
+		return nil, fmt.Errorf("list of %d elements exceeds the maximum of %d", n, maxList)
+	}
+	list := make([]string, 0, n)
+	for i := uint64(0); i < n; i++ {
+		s, err := wire.ReadString(d.r, maxString)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, s)
+	}
+	return list, nil
+}
+
+// processStderr reads the log messages the daemon sends before the result of an operation, up to the last one.
+// An error message of the daemon is returned as an error.
+func (d *Daemon) processStderr() error {
+	for {
+		msg, err := wire.ReadUint64(d.r)
+		if err != nil {
+			return err
+		}
+		switch msg {
+		case stderrLast:
+			return nil
+		case stderrError:
+			return d.readError()
+		case stderrNext, stderrWrite:
+			if _, err := wire.ReadString(d.r, maxString); err != nil {
+				return err
+			}
+		case stderrStartActivity:
+			// id, level, type, text, fields and parent
+			if err := d.skipUint64s(3); err != nil {
+				return err
+			}
+			if _, err := wire.ReadString(d.r, maxString); err != nil {
+				return err
+			}
+			if err := d.skipFields(); err != nil {
+				return err
+			}
+			if err := d.skipUint64s(1); err != nil {
+				return err
+			}
+		case stderrStopActivity:
+			if err := d.skipUint64s(1); err != nil {
+				return err
+			}
+		case stderrResult:
+			// id, type and fields
+			if err := d.skipUint64s(2); err != nil {
+				return err
+			}
+			if err := d.skipFields(); err != nil {
+				return err
+			}
+		case stderrRead:
+			return fmt.Errorf("the nix daemon asked for data, no operation of the client sends any")
+		default:
+			return fmt.Errorf("unknown message %#x from the nix daemon", msg)
+		}
+	}
+}
+
+// readError reads an error of the daemon, structured since protocol 1.26
+func (d *Daemon) readError() error {
+	if d.version < 1<<8|26 {
+		msg, err := wire.ReadString(d.r, maxString)
+		if err != nil {
+			return err
+		}
+		if _, err := wire.ReadUint64(d.r); err != nil {
+			return err
+		}
+		return fmt.Errorf("nix daemon: %s", msg)
+	}
+
+	// type, level, name, message, position and traces
+	if _, err := wire.ReadString(d.r, maxString); err != nil {
+		return err
+	}
+	if err := d.skipUint64s(1); err != nil {
+		return err
+	}
+	if _, err := wire.ReadString(d.r, maxString); err != nil {
+		return err
+	}
+	msg, err := wire.ReadString(d.r, maxString)
+	if err != nil {
+		return err
+	}
+	if err := d.skipUint64s(1); err != nil {
+		return err
+	}
+	traces, err := wire.ReadUint64(d.r)
+	if err != nil {
+		return err
+	}
+	for i := uint64(0); i < traces; i++ {
+		if err := d.skipUint64s(1); err != nil {
+			return err
+		}
+		if _, err := wire.ReadString(d.r, maxString); err != nil {
+			return err
+		}
+	}
+	return fmt.Errorf("nix daemon: %s", msg)
+}
+
+func (d *Daemon) skipUint64s(n int) error {
+	for i := 0; i < n; i++ {
+		if _, err := wire.ReadUint64(d.r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// skipFields skips the fields of an activity, integers or strings
+func (d *Daemon) skipFields() error {
+	n, err := wire.ReadUint64(d.r)
+	if err != nil {
+		return err
+	}
+	for i := uint64(0); i < n; i++ {
+		kind, err := wire.ReadUint64(d.r)
+		if err != nil {
+			return err
+		}
+		switch kind {
+		case 0:
+			_, err = wire.ReadUint64(d.r)
+		case 1:
+			_, err = wire.ReadString(d.r, maxString)
+		default:
+			err = fmt.Errorf("unknown field type %d from the nix daemon", kind)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var _ io.Closer = (*Daemon)(nil)
@@ -0,0 +1,245 @@
+package store
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/nix-community/go-nix/pkg/wire"
+)
+
+// fakeDaemon answers the handshake and the path info queries of the worker protocol for the paths it knows
+func fakeDaemon(t *testing.T, conn net.Conn, paths map[string]*PathInfo) {
+	t.Helper()
+	r := bufio.NewReader(conn)
+	w := bufio.NewWriter(conn)
+	go func() {
+		defer conn.Close()
+		if magic, err := wire.ReadUint64(r); err != nil || magic != workerMagic1 {
+			return
+		}
+		wire.WriteUint64(w, workerMagic2)
+		wire.WriteUint64(w, protocolVersion)
+		w.Flush()
+		// client version, CPU affinity and reserve space
+		for i := 0; i < 3; i++ {
+			if _, err := wire.ReadUint64(r); err != nil {
+				return
+			}
+		}
+		wire.WriteUint64(w, stderrLast)
+		w.Flush()
+
+		for {
+			op, err := wire.ReadUint64(r)
+			if err != nil {
+				return
+			}
+			if op != opQueryPathInfo {
+				t.Errorf("unexpected operation %d", op)
+				return
+			}
+			p, err := wire.ReadString(r, maxString)
+			if err != nil {
+				return
+			}
+
+			// a log line and an activity precede the result
+			wire.WriteUint64(w, stderrNext)
+			wire.WriteString(w, "querying "+p)
+			wire.WriteUint64(w, stderrStartActivity)
+			for _, v := range []uint64{1, 0, 0} {
+				wire.WriteUint64(w, v)
+			}
+			wire.WriteString(w, "")
+			wire.WriteUint64(w, 2)
+			wire.WriteUint64(w, 0)
+			wire.WriteUint64(w, 42)
+			wire.WriteUint64(w, 1)
+			wire.WriteString(w, "field")
+			wire.WriteUint64(w, 0)
+			wire.WriteUint64(w, stderrStopActivity)
+			wire.WriteUint64(w, 1)
+
+			if p == "/nix/store/broken" {
+				wire.WriteUint64(w, stderrError)
+				wire.WriteString(w, "Error")
+				wire.WriteUint64(w, 0)
+				wire.WriteString(w, "Error")
+				wire.WriteString(w, "path is corrupt")
+				wire.WriteUint64(w, 0)
+				wire.WriteUint64(w, 1)
+				wire.WriteUint64(w, 0)
+				wire.WriteString(w, "while querying")
+				w.Flush()
+				continue
+			}
+
+			wire.WriteUint64(w, stderrLast)
+			info, ok := paths[p]
+			wire.WriteBool(w, ok)
+			if ok {
+				wire.WriteString(w, info.Deriver)
+				wire.WriteString(w, info.NarHash)
+				wire.WriteUint64(w, uint64(len(info.References)))
+				for _, ref := range info.References {
+					wire.WriteString(w, ref)
+				}
+				wire.WriteUint64(w, uint64(info.RegistrationTime.Unix()))
+				wire.WriteUint64(w, info.NarSize)
+				wire.WriteBool(w, false)
+				wire.WriteUint64(w, uint64(len(info.Signatures)))
+				for _, sig := range info.Signatures {
+					wire.WriteString(w, sig)
+				}
+				wire.WriteString(w, info.CA)
+			}
+			w.Flush()
+		}
+	}()
+}
+
+func testPaths() map[string]*PathInfo {
+	return map[string]*PathInfo{
+		"/nix/store/aaa-app-1.0": {
+			Path:             "/nix/store/aaa-app-1.0",
+			Deriver:          "/nix/store/ddd-app-1.0.drv",
+			NarHash:          "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef",
+			NarSize:          1024,
+			RegistrationTime: time.Unix(1700000000, 0).UTC(),
+			References:       []string{"/nix/store/aaa-app-1.0", "/nix/store/bbb-curl-8.6.0", "/nix/store/ccc-glibc-2.39"},
+			Signatures:       []string{"cache.nixos.org-1:abc"},
+		},
+		"/nix/store/bbb-curl-8.6.0": {
+			Path:             "/nix/store/bbb-curl-8.6.0",
+			RegistrationTime: time.Unix(0, 0).UTC(),
+			NarHash:          "fedcba9876543210fedcba9876543210fedcba9876543210fedcba9876543210",
+			NarSize:          2048,
+			References:       []string{"/nix/store/ccc-glibc-2.39"},
+			Signatures:       []string{},
+		},
+		"/nix/store/ccc-glibc-2.39": {
+			Path:             "/nix/store/ccc-glibc-2.39",
+			RegistrationTime: time.Unix(0, 0).UTC(),
+			NarHash:          "00112233445566778899aabbccddeeff00112233445566778899aabbccddeeff",
+			NarSize:          4096,
+			References:       []string{},
+			Signatures:       []string{},
+			CA:               "fixed:r:sha256:abc",
+		},
+	}
+}
+
+func dialFake(t *testing.T) *Daemon {
+	t.Helper()
+	client, server := net.Pipe()
+	fakeDaemon(t, server, testPaths())
+	d, err := NewDaemon(context.Background(), client)
+	if err != nil {
+		t.Fatalf("NewDaemon() error = %v", err)
+	}
+	t.Cleanup(func() { d.Close() })
+	return d
+}
+
+func TestQueryPathInfo(t *testing.T) {
+	d := dialFake(t)
+	paths := testPaths()
+
+	tests := []struct {
+		name    string
+		path    string
+		want    *PathInfo
+		wantErr error
+	}{
+		{
+			name: "valid path",
+			path: "/nix/store/aaa-app-1.0",
+			want: paths["/nix/store/aaa-app-1.0"],
+		},
+		{
+			name: "content addressed path",
+			path: "/nix/store/ccc-glibc-2.39",
+			want: paths["/nix/store/ccc-glibc-2.39"],
+		},
+		{
+			name:    "path not in the store",
+			path:    "/nix/store/zzz-gone",
+			wantErr: ErrNotValid,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := d.QueryPathInfo(context.Background(), tt.path)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("QueryPathInfo() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.want == nil {
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("QueryPathInfo() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQueryPathInfoError(t *testing.T) {
+	d := dialFake(t)
+
+	_, err := d.QueryPathInfo(context.Background(), "/nix/store/broken")
+	if err == nil || err.Error() != "failed to query /nix/store/broken: nix daemon: path is corrupt" {
+		t.Fatalf("QueryPathInfo() error = %v", err)
+	}
+	// the connection is usable after an error of the daemon
+	if _, err := d.QueryPathInfo(context.Background(), "/nix/store/ccc-glibc-2.39"); err != nil {
+		t.Errorf("QueryPathInfo() error = %v", err)
+	}
+}
+
+func TestClosure(t *testing.T) {
+	d := dialFake(t)
+
+	g, err := Closure(context.Background(), d, "/nix/store/aaa-app-1.0")
+	if err != nil {
+		t.Fatalf("Closure() error = %v", err)
+	}
+	want := []string{"/nix/store/aaa-app-1.0", "/nix/store/bbb-curl-8.6.0", "/nix/store/ccc-glibc-2.39"}
+	if got := g.Sorted(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Sorted() = %v, want %v", got, want)
+	}
+
+	wantReferrers := map[string][]string{
+		"/nix/store/bbb-curl-8.6.0": {"/nix/store/aaa-app-1.0"},
+		"/nix/store/ccc-glibc-2.39": {"/nix/store/aaa-app-1.0", "/nix/store/bbb-curl-8.6.0"},
+	}
+	if got := g.Referrers(); !reflect.DeepEqual(got, wantReferrers) {
+		t.Errorf("Referrers() = %v, want %v", got, wantReferrers)
+	}
+
+	if _, err := Closure(context.Background(), d, "/nix/store/zzz-gone"); !errors.Is(err, ErrNotValid) {
+		t.Errorf("Closure() error = %v, want %v", err, ErrNotValid)
+	}
+}
+
+func TestName(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{path: "/nix/store/da66gxmm6wy8shkw93x5m6c1x8gfj63r-caddy-2.7.6", want: "caddy-2.7.6"},
+		{path: "/nix/store/1vng6wj07s51jsgj338m24m0c0mw2i3k-python3.11-app-0.1.0", want: "python3.11-app-0.1.0"},
+		{path: "/nix/store/1vng6wj07s51jsgj338m24m0c0mw2i3k", want: ""},
+	}
+
+	for _, tt := range tests {
+		if got := Name(tt.path); got != tt.want {
+			t.Errorf("Name(%s) = %s, want %s", tt.path, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package store
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"unicode/utf8"
+
+	"zombiezen.com/go/nix/nar"
+)
+
+// DumpPath writes the NAR serialisation of the file at host to w, as nix does, and returns the special files it
+// skipped relative to host. nix can't serialise sockets, fifos and devices, they only end up in store directories
+// nix didn't write, e.g. a path a running service wrote its socket to: they are skipped rather than failing the whole
+// path. Symlinks are serialised as their target and never followed, so chains and loops of any length serialise.
+// Errors name the file that couldn't be serialised.
+func DumpPath(w io.Writer, host string) ([]string, error) {
+	info, err := os.Lstat(host)
+	if err != nil {
+		return nil, err
+	}
+
+	nw := nar.NewWriter(w)
+	switch info.Mode().Type() {
+	case 0:
+		if err := nw.WriteHeader(&nar.Header{Mode: info.Mode(), Size: info.Size()}); err != nil {
+			return nil, fmt.Errorf("%s: %w", host, err)
+		}
+		f, err := os.Open(host)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		if _, err := io.Copy(nw, f); err != nil {
+			return nil, fmt.Errorf("%s: %w", host, err)
+		}
+	case fs.ModeSymlink:
+		target, err := os.Readlink(host)
+		if err != nil {
+			return nil, err
+		}
+		if err := nw.WriteHeader(&nar.Header{Mode: fs.ModeSymlink, LinkTarget: target}); err != nil {
+			return nil, fmt.Errorf("%s: %w", host, err)
+		}
+	case fs.ModeDir:
+		fsys := &dumpFS{FS: os.DirFS(host), host: host}
+		d := &nar.Dumper{ReadLink: func(p string) (string, error) {
+			return os.Readlink(filepath.Join(host, filepath.FromSlash(p)))
+		}}
+		err := d.Dump(w, fsys, ".")
+		// the dumper doesn't stop on the directories it can't list, their error explains the one it stops on
+		if fsys.err != nil {
+			return nil, fsys.err
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", host, err)
+		}
+		return fsys.skipped, nil
+	default:
+		return nil, fmt.Errorf("%s is a %s, NARs only have regular files, directories and symlinks", host, typeName(info.Mode()))
+	}
+	return nil, nw.Close()
+}
+
+// dumpFS lists the directories of the path being dumped without their special files, which it records
+type dumpFS struct {
+	fs.FS
+	host    string
+	skipped []string
+	// err is the first directory that couldn't be listed
+	err error
+}
+
+// ReadDir lists the entries of the directory, sorted by name as the NAR serialisation requires
+func (d *dumpFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	entries, err := d.readDir(name)
+	if err != nil && d.err == nil {
+		d.err = err
+	}
+	return entries, err
+}
+
+func (d *dumpFS) readDir(name string) ([]fs.DirEntry, error) {
+	entries, err := fs.ReadDir(d.FS, name)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filepath.Join(d.host, filepath.FromSlash(name)), err)
+	}
+	kept := entries[:0]
+	for _, e := range entries {
+		p := path.Join(name, e.Name())
+		if !utf8.ValidString(e.Name()) {
+			return nil, fmt.Errorf("%s: the name isn't UTF-8, which NARs require", filepath.Join(d.host, filepath.FromSlash(p)))
+		}
+		switch e.Type() {
+		case 0, fs.ModeDir, fs.ModeSymlink:
+			kept = append(kept, e)
+		default:
+			d.skipped = append(d.skipped, p)
+		}
+	}
+	return kept, nil
+}
+
+// typeName names the type of a special file
+func typeName(mode fs.FileMode) string {
+	switch {
+	case mode&fs.ModeSocket != 0:
+		return "socket"
+	case mode&fs.ModeNamedPipe != 0:
+		return "fifo"
+	case mode&fs.ModeCharDevice != 0:
+		return "character device"
+	case mode&fs.ModeDevice != 0:
+		return "device"
+	default:
+		return "special file"
+	}
+}
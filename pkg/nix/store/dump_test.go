@@ -0,0 +1,99 @@
+package store
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"syscall"
+	"testing"
+
+	"zombiezen.com/go/nix/nar"
+)
+
+func TestDumpPath(t *testing.T) {
+	host := filepath.Join(t.TempDir(), "app")
+	for _, dir := range []string{"bin", "share/doc", "run"} {
+		if err := os.MkdirAll(filepath.Join(host, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(host, "bin", "app"), []byte("binary"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(host, "share", "doc", "release\nnotes"), []byte("notes"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// a chain of symlinks longer than the kernel follows, and a loop: they're serialised, never followed
+	for i := 0; i < 300; i++ {
+		if err := os.Symlink(fmt.Sprintf("link%03d", i+1), filepath.Join(host, "share", fmt.Sprintf("link%03d", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink("loop", filepath.Join(host, "share", "loop")); err != nil {
+		t.Fatal(err)
+	}
+
+	var want bytes.Buffer
+	if err := nar.DumpPath(&want, host); err != nil {
+		t.Fatal(err)
+	}
+
+	wantSkipped := make([]string, 0)
+	if err := syscall.Mkfifo(filepath.Join(host, "run", "fifo"), 0644); err == nil {
+		wantSkipped = append(wantSkipped, "run/fifo")
+	}
+	if l, err := net.Listen("unix", filepath.Join(host, "run", "socket")); err == nil {
+		defer l.Close()
+		wantSkipped = append(wantSkipped, "run/socket")
+	}
+
+	var got bytes.Buffer
+	skipped, err := DumpPath(&got, host)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got.Bytes(), want.Bytes()) {
+		t.Error("DumpPath() serialised a different NAR than nix")
+	}
+	if !reflect.DeepEqual(skipped, wantSkipped) && len(skipped)+len(wantSkipped) > 0 {
+		t.Errorf("DumpPath() skipped %v, want %v", skipped, wantSkipped)
+	}
+
+	// the roots of store paths can be files and symlinks
+	for _, p := range []string{filepath.Join(host, "bin", "app"), filepath.Join(host, "share", "link000")} {
+		want.Reset()
+		got.Reset()
+		if err := nar.DumpPath(&want, p); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := DumpPath(&got, p); err != nil || !bytes.Equal(got.Bytes(), want.Bytes()) {
+			t.Errorf("DumpPath(%s) = %v, or a different NAR than nix", p, err)
+		}
+	}
+}
+
+func TestDumpPathErrors(t *testing.T) {
+	host := filepath.Join(t.TempDir(), "app")
+	if err := os.MkdirAll(filepath.Join(host, "lib"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(host, "lib", "caf\xe9"), []byte("latin-1"), 0644); err != nil {
+		t.Skip("the file system doesn't allow names that aren't UTF-8")
+	}
+	_, err := DumpPath(&bytes.Buffer{}, host)
+	if err == nil || !strings.Contains(err.Error(), filepath.Join(host, "lib")) {
+		t.Errorf("DumpPath() error = %v, want the file named", err)
+	}
+
+	fifo := filepath.Join(t.TempDir(), "fifo")
+	if err := syscall.Mkfifo(fifo, 0644); err != nil {
+		t.Skip("can't create fifos")
+	}
+	if _, err := DumpPath(&bytes.Buffer{}, fifo); err == nil || !strings.Contains(err.Error(), "is a fifo") {
+		t.Errorf("DumpPath() of a fifo error = %v", err)
+	}
+}
@@ -0,0 +1,179 @@
+package store
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// hashLen is the length of the hash part of store path names
+const hashLen = 32
+
+// base32Chars are the characters of the nixbase32 alphabet hashes are written in
+var base32Chars = func() (chars [256]bool) {
+	for _, c := range "0123456789abcdfghijklmnpqrsvwxyz" {
+		chars[c] = true
+	}
+	return chars
+}()
+
+// FS reads the path info of store paths from the store directory itself, for hosts with neither a nix daemon nor the
+// nix commands, e.g. containers the closure was copied into. The NAR hash is computed and the references are found
+// by scanning the contents of the path for the hash parts of the other paths of the store, as nix does when it
+// registers a path. The deriver and the signatures of the paths are unknown.
+type FS struct {
+	// root is the directory the store directory is below, / for the default store
+	root string
+
+	once   sync.Once
+	hashes map[string]string
+	err    error
+}
+
+// OpenFS returns the store whose store directory is below root, / for the default store
+func OpenFS(root string) (*FS, error) {
+	if root == "" {
+		root = "/"
+	}
+	if fi, err := os.Stat(filepath.Join(root, storeDir)); err != nil || !fi.IsDir() {
+		return nil, fmt.Errorf("%s is not a store directory", filepath.Join(root, storeDir))
+	}
+	return &FS{root: root}, nil
+}
+
+// QueryPathInfo reads the path info of the store path from the store directory
+func (s *FS) QueryPathInfo(ctx context.Context, storePath string) (*PathInfo, error) {
+	if path.Dir(storePath) != storeDir {
+		return nil, fmt.Errorf("%s: %w", storePath, ErrNotValid)
+	}
+	host := filepath.Join(s.root, storePath)
+	if _, err := os.Lstat(host); errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%s: %w", storePath, ErrNotValid)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	hashes, err := s.storeHashes()
+	if err != nil {
+		return nil, err
+	}
+	d := newDigester()
+	if _, err := DumpPath(d, host); err != nil {
+		return nil, fmt.Errorf("failed to serialise %s: %v", storePath, err)
+	}
+	references, err := ScanReferences(host, hashes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan the references of %s: %v", storePath, err)
+	}
+	return &PathInfo{Path: storePath, NarHash: hex.EncodeToString(d.sum()), NarSize: d.n, References: references}, nil
+}
+
+// Close releases nothing, the store directory is read path by path
+func (s *FS) Close() error {
+	return nil
+}
+
+// storeHashes returns the store paths of the store directory by the hash part of their name, read once
+func (s *FS) storeHashes() (map[string]string, error) {
+	s.once.Do(func() {
+		entries, err := os.ReadDir(filepath.Join(s.root, storeDir))
+		if err != nil {
+			s.err = err
+			return
+		}
+		s.hashes = make(map[string]string, len(entries))
+		for _, e := range entries {
+			name := e.Name()
+			// .links and the lock files of nix aren't store paths
+			if len(name) > hashLen+1 && name[hashLen] == '-' {
+				s.hashes[name[:hashLen]] = path.Join(storeDir, name)
+			}
+		}
+	})
+	return s.hashes, s.err
+}
+
+// ScanReferences returns the store paths, by the hash part of their name, whose hashes the files and symlinks at
+// host contain, sorted. A path referencing itself is one of its references, as nix records it.
+func ScanReferences(host string, hashes map[string]string) ([]string, error) {
+	found := make(map[string]bool)
+	err := filepath.WalkDir(host, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		switch {
+		case d.Type()&fs.ModeSymlink != 0:
+			target, err := os.Readlink(p)
+			if err != nil {
+				return err
+			}
+			scanHashes([]byte(target), hashes, found)
+		case d.Type().IsRegular():
+			f, err := os.Open(p)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			return scanReader(f, hashes, found)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	references := make([]string, 0, len(found))
+	for p := range found {
+		references = append(references, p)
+	}
+	sort.Strings(references)
+	return references, nil
+}
+
+// scanReader scans the content read from r for hashes, in chunks overlapping by a hash so hashes across chunks are
+// found too
+func scanReader(r io.Reader, hashes map[string]string, found map[string]bool) error {
+	buf := make([]byte, 0, 64<<10+hashLen)
+	for {
+		n, err := r.Read(buf[len(buf):cap(buf)])
+		buf = buf[:len(buf)+n]
+		rest := scanHashes(buf, hashes, found)
+		// the bytes not scanned yet start the next chunk
+		buf = buf[:copy(buf, rest)]
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// scanHashes records the store paths whose hashes data contains, and returns the end of data too short to hold one
+func scanHashes(data []byte, hashes map[string]string, found map[string]bool) []byte {
+	i := 0
+	for i+hashLen <= len(data) {
+		// a character out of the alphabet skips the windows containing it, as nix scans references
+		j := hashLen - 1
+		for ; j >= 0 && base32Chars[data[i+j]]; j-- {
+		}
+		if j >= 0 {
+			i += j + 1
+			continue
+		}
+		if p, ok := hashes[string(data[i:i+hashLen])]; ok {
+			found[p] = true
+		}
+		i++
+	}
+	return data[i:]
+}
@@ -0,0 +1,122 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"zombiezen.com/go/nix/nar"
+)
+
+const (
+	appPath   = "/nix/store/da66gxmm6wy8shkw93x5m6c1x8gfj63r-app-1.0"
+	curlPath  = "/nix/store/1vng6wj07s51jsgj338m24m0c0mw2i3k-curl-8.6.0"
+	glibcPath = "/nix/store/0c7mp2rwkzwsqxq9k27k5r5xqhm6mx3l-glibc-2.39"
+)
+
+// testFS writes a store of three paths below a temporary root: the app references itself and curl, which links
+// to glibc
+func testFS(t *testing.T) string {
+	t.Helper()
+	root := t.TempDir()
+	write := func(p, content string) {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(root, p)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(root, p), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(appPath+"/bin/app", "#!"+curlPath+"/bin/curl\nexec "+appPath+"/libexec/app\n")
+	write(curlPath+"/bin/curl", "ELF")
+	write(glibcPath+"/lib/libc.so.6", "ELF")
+	if err := os.Symlink(glibcPath+"/lib/libc.so.6", filepath.Join(root, curlPath, "libc.so.6")); err != nil {
+		t.Fatal(err)
+	}
+	// nix keeps the hard links of optimised stores in .links
+	if err := os.MkdirAll(filepath.Join(root, storeDir, ".links"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return root
+}
+
+func TestFSQueryPathInfo(t *testing.T) {
+	root := testFS(t)
+	s, err := OpenFS(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		path    string
+		want    []string
+		wantErr error
+	}{
+		{name: "self reference", path: appPath, want: []string{curlPath, appPath}},
+		{name: "symlink", path: curlPath, want: []string{glibcPath}},
+		{name: "no reference", path: glibcPath, want: []string{}},
+		{name: "path not in the store", path: "/nix/store/zzz-gone", wantErr: ErrNotValid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info, err := s.QueryPathInfo(context.Background(), tt.path)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("QueryPathInfo() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+			if !reflect.DeepEqual(info.References, tt.want) {
+				t.Errorf("References = %v, want %v", info.References, tt.want)
+			}
+
+			var b bytes.Buffer
+			if err := nar.DumpPath(&b, filepath.Join(root, tt.path)); err != nil {
+				t.Fatal(err)
+			}
+			sum := sha256.Sum256(b.Bytes())
+			if info.NarHash != hex.EncodeToString(sum[:]) || info.NarSize != uint64(b.Len()) {
+				t.Errorf("NAR hash %s of %d bytes, want %x of %d bytes", info.NarHash, info.NarSize, sum, b.Len())
+			}
+		})
+	}
+
+	g, err := Closure(context.Background(), s, appPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := g.Sorted(); !reflect.DeepEqual(got, []string{glibcPath, curlPath, appPath}) {
+		t.Errorf("Sorted() = %v", got)
+	}
+
+	if _, err := OpenFS(t.TempDir()); err == nil {
+		t.Error("expected an error for a root without a store directory")
+	}
+}
+
+func TestScanReader(t *testing.T) {
+	hashes := map[string]string{"1vng6wj07s51jsgj338m24m0c0mw2i3k": curlPath}
+	// the hash is split between the reads of the one byte reader, and follows characters of the alphabet
+	content := strings.Repeat("x", 100) + "abc" + curlPath + strings.Repeat("\x00", 10)
+	found := make(map[string]bool)
+	if err := scanReader(iotest.OneByteReader(strings.NewReader(content)), hashes, found); err != nil {
+		t.Fatal(err)
+	}
+	if !found[curlPath] {
+		t.Errorf("expected %s to be found", curlPath)
+	}
+
+	found = make(map[string]bool)
+	if err := scanReader(strings.NewReader("1vng6wj07s51jsgj338m24m0c0mw2i3"), hashes, found); err != nil || len(found) != 0 {
+		t.Errorf("expected no reference in a truncated hash, got %v %v", found, err)
+	}
+}
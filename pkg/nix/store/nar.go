@@ -0,0 +1,335 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"zombiezen.com/go/nix/nixbase32"
+
+	"github.com/buildsafedev/bsf/pkg/shutdown"
+)
+
+// cacheInfo is the nix-cache-info file nix requires at the root of a binary cache
+const cacheInfo = "StoreDir: " + storeDir + "\n"
+
+// FetchNAR writes the NAR of the store path, decompressed, to w and returns its path info. The compressed file is
+// checked against the FileHash and FileSize of the .narinfo file, the NAR against its NarHash and NarSize: an error
+// is returned when they don't match, after w was written to.
+func (c *BinaryCache) FetchNAR(ctx context.Context, storePath string, w io.Writer) (*PathInfo, error) {
+	ni, err := c.narInfo(ctx, storePath)
+	if err != nil {
+		return nil, err
+	}
+	info, err := narInfoPathInfo(ni)
+	if err != nil {
+		return nil, err
+	}
+	if ni.URL == "" {
+		return nil, fmt.Errorf("the narinfo of %s has no URL", storePath)
+	}
+	// nix reads NARs without a Compression field as bzip2, the compression of the first caches
+	compression := Compression(ni.Compression)
+	if compression == "" {
+		compression = CompressionBzip2
+	}
+
+	r, err := c.open(ctx, ni.URL)
+	if errors.Is(err, ErrNotValid) {
+		return nil, fmt.Errorf("the NAR of %s is missing from the cache", storePath)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch the NAR of %s: %w", storePath, err)
+	}
+	defer r.Close()
+
+	file := newDigester()
+	compressed := io.TeeReader(r, file)
+	dec, err := Decompress(ctx, compressed, compression)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", storePath, err)
+	}
+	defer dec.Close()
+
+	nar := newDigester()
+	if _, err := io.Copy(io.MultiWriter(w, nar), dec); err != nil {
+		return nil, fmt.Errorf("failed to decompress the NAR of %s: %w", storePath, err)
+	}
+	// the decompressor may stop before the end of the file, e.g. on trailing padding
+	if _, err := io.Copy(io.Discard, compressed); err != nil {
+		return nil, fmt.Errorf("failed to fetch the NAR of %s: %w", storePath, err)
+	}
+
+	if ni.FileHash != nil && ni.FileHash.HashTypeString() == "sha256" {
+		if got := hex.EncodeToString(file.sum()); got != hex.EncodeToString(ni.FileHash.Digest()) {
+			return nil, fmt.Errorf("the NAR file of %s has hash %s, the narinfo records %s", storePath, got, hex.EncodeToString(ni.FileHash.Digest()))
+		}
+	}
+	if ni.FileSize != 0 && file.n != ni.FileSize {
+		return nil, fmt.Errorf("the NAR file of %s has %d bytes, the narinfo records %d", storePath, file.n, ni.FileSize)
+	}
+	if err := nar.check(storePath, info); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// PutNAR compresses the NAR of the path read from r and uploads it to the cache with its .narinfo file, the NAR
+// first so the cache never lists a path it can't serve. The NAR is checked against the NarHash and NarSize of info
+// before anything is uploaded. Caches over http(s) are written to with PUT requests, as nix copy does.
+func (c *BinaryCache) PutNAR(ctx context.Context, info *PathInfo, r io.Reader, compression Compression, workers int) error {
+	tmp, err := os.CreateTemp("", "bsf-*"+compression.Extension())
+	if err != nil {
+		return err
+	}
+	defer shutdown.RemoveOnExit(tmp.Name())()
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	nar, file := newDigester(), newDigester()
+	if err := Compress(ctx, io.MultiWriter(tmp, file), io.TeeReader(r, nar), compression, workers); err != nil {
+		return fmt.Errorf("failed to compress the NAR of %s: %w", info.Path, err)
+	}
+	if err := nar.check(info.Path, info); err != nil {
+		return err
+	}
+
+	fileHash := nixbase32.EncodeToString(file.sum())
+	url := "nar/" + fileHash + compression.Extension()
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if err := c.put(ctx, url, tmp, int64(file.n), "application/x-nix-nar"); err != nil {
+		return fmt.Errorf("failed to upload the NAR of %s: %w", info.Path, err)
+	}
+
+	ni := formatNarInfo(info, url, compression, "sha256:"+fileHash, file.n)
+	hashPart, _, _ := strings.Cut(path.Base(info.Path), "-")
+	if err := c.put(ctx, hashPart+".narinfo", strings.NewReader(ni), int64(len(ni)), "text/x-nix-narinfo"); err != nil {
+		return fmt.Errorf("failed to upload the narinfo of %s: %w", info.Path, err)
+	}
+	return nil
+}
+
+// PushOptions are the options of PushClosure
+type PushOptions struct {
+	Compression Compression
+	// Jobs is the number of paths compressed and uploaded at once, 1 when 0
+	Jobs int
+	// Workers is the number of threads each path is compressed with, one per CPU when 0
+	Workers int
+}
+
+// PushResult lists the paths of a push
+type PushResult struct {
+	Pushed []string
+	// Skipped are the paths the cache already had
+	Skipped []string
+}
+
+// DumpFunc writes the NAR of the store path to w
+type DumpFunc func(ctx context.Context, storePath string, w io.Writer) error
+
+// PushClosure pushes the paths of the closure the cache doesn't have yet, their NARs written by dump, with
+// opts.Jobs paths at once. Paths the cache has with another NAR hash are an error, the cache would keep serving
+// them. The first failure cancels the pushes in progress.
+func PushClosure(ctx context.Context, c *BinaryCache, g *Graph, dump DumpFunc, opts PushOptions) (*PushResult, error) {
+	if err := c.ensureCacheInfo(ctx); err != nil {
+		return nil, err
+	}
+
+	result := &PushResult{}
+	pending := make([]*PathInfo, 0, len(g.Paths))
+	for _, p := range g.Sorted() {
+		info := g.Paths[p]
+		cached, err := c.QueryPathInfo(ctx, p)
+		switch {
+		case err == nil && cached.NarHash == info.NarHash:
+			result.Skipped = append(result.Skipped, p)
+		case err == nil:
+			return nil, fmt.Errorf("the cache has %s with NAR hash %s, not %s", p, cached.NarHash, info.NarHash)
+		case errors.Is(err, ErrNotValid):
+			pending = append(pending, info)
+		default:
+			return nil, err
+		}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	jobs := opts.Jobs
+	if jobs <= 0 {
+		jobs = 1
+	}
+	queue := make(chan *PathInfo)
+	var (
+		mu       sync.Mutex
+		firstErr error
+		wg       sync.WaitGroup
+	)
+	for i := 0; i < jobs; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for info := range queue {
+				err := pushPath(ctx, c, info, dump, opts)
+				mu.Lock()
+				if err != nil && firstErr == nil {
+					firstErr = err
+					cancel()
+				} else if err == nil {
+					result.Pushed = append(result.Pushed, info.Path)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, info := range pending {
+		select {
+		case queue <- info:
+		case <-ctx.Done():
+		}
+	}
+	close(queue)
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return result, ctx.Err()
+}
+
+// pushPath streams the NAR dump writes to PutNAR
+func pushPath(ctx context.Context, c *BinaryCache, info *PathInfo, dump DumpFunc, opts PushOptions) error {
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(dump(ctx, info.Path, pw))
+	}()
+	err := c.PutNAR(ctx, info, pr, opts.Compression, opts.Workers)
+	pr.CloseWithError(err)
+	return err
+}
+
+// ensureCacheInfo writes the nix-cache-info file of a new cache
+func (c *BinaryCache) ensureCacheInfo(ctx context.Context) error {
+	r, err := c.open(ctx, "nix-cache-info")
+	if err == nil {
+		return r.Close()
+	}
+	if !errors.Is(err, ErrNotValid) {
+		return err
+	}
+	return c.put(ctx, "nix-cache-info", strings.NewReader(cacheInfo), int64(len(cacheInfo)), "text/x-nix-cache-info")
+}
+
+// put writes the file of the cache
+func (c *BinaryCache) put(ctx context.Context, name string, r io.Reader, size int64, contentType string) error {
+	if c.url.Scheme == "file" {
+		file := filepath.Join(c.url.Path, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			return err
+		}
+		tmp, err := os.CreateTemp(filepath.Dir(file), ".tmp-*")
+		if err != nil {
+			return err
+		}
+		defer os.Remove(tmp.Name())
+		if _, err := io.Copy(tmp, r); err != nil {
+			tmp.Close()
+			return err
+		}
+		if err := tmp.Close(); err != nil {
+			return err
+		}
+		if err := os.Chmod(tmp.Name(), 0644); err != nil {
+			return err
+		}
+		return os.Rename(tmp.Name(), file)
+	}
+
+	u := c.url.JoinPath(name).String()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, u, r)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	req.Header.Set("Content-Type", contentType)
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("PUT %s: %s", u, resp.Status)
+	}
+	return nil
+}
+
+// formatNarInfo returns the .narinfo file of the path, whose NAR is at url
+func formatNarInfo(info *PathInfo, url string, compression Compression, fileHash string, fileSize uint64) string {
+	narHash, _ := hex.DecodeString(info.NarHash)
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "StorePath: %s\n", info.Path)
+	fmt.Fprintf(&b, "URL: %s\n", url)
+	fmt.Fprintf(&b, "Compression: %s\n", compression)
+	fmt.Fprintf(&b, "FileHash: %s\n", fileHash)
+	fmt.Fprintf(&b, "FileSize: %d\n", fileSize)
+	fmt.Fprintf(&b, "NarHash: sha256:%s\n", nixbase32.EncodeToString(narHash))
+	fmt.Fprintf(&b, "NarSize: %d\n", info.NarSize)
+	refs := make([]string, 0, len(info.References))
+	for _, ref := range info.References {
+		refs = append(refs, path.Base(ref))
+	}
+	fmt.Fprintf(&b, "References: %s\n", strings.Join(refs, " "))
+	if info.Deriver != "" {
+		fmt.Fprintf(&b, "Deriver: %s\n", path.Base(info.Deriver))
+	}
+	for _, sig := range info.Signatures {
+		fmt.Fprintf(&b, "Sig: %s\n", sig)
+	}
+	if info.CA != "" {
+		fmt.Fprintf(&b, "CA: %s\n", info.CA)
+	}
+	return b.String()
+}
+
+// digester hashes and counts the bytes written to it
+type digester struct {
+	h hash.Hash
+	n uint64
+}
+
+func newDigester() *digester {
+	return &digester{h: sha256.New()}
+}
+
+func (d *digester) Write(p []byte) (int, error) {
+	d.n += uint64(len(p))
+	return d.h.Write(p)
+}
+
+func (d *digester) sum() []byte {
+	return d.h.Sum(nil)
+}
+
+// check compares the NAR hashed by d with the NarHash and NarSize of info
+func (d *digester) check(storePath string, info *PathInfo) error {
+	if got := hex.EncodeToString(d.sum()); got != info.NarHash {
+		return fmt.Errorf("the NAR of %s has hash %s, expected %s", storePath, got, info.NarHash)
+	}
+	if info.NarSize != 0 && d.n != info.NarSize {
+		return fmt.Errorf("the NAR of %s has %d bytes, expected %d", storePath, d.n, info.NarSize)
+	}
+	return nil
+}
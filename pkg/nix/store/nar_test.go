@@ -0,0 +1,215 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// testNARs are the NARs of a closure, their content doesn't matter to the cache
+var testNARs = map[string][]byte{
+	"/nix/store/aaaa-app-1.0":    bytes.Repeat([]byte("app "), 4096),
+	"/nix/store/cccc-glibc-2.39": []byte("glibc"),
+}
+
+func testClosure() *Graph {
+	g := &Graph{Roots: []string{"/nix/store/aaaa-app-1.0"}, Paths: make(map[string]*PathInfo)}
+	for p, data := range testNARs {
+		sum := sha256.Sum256(data)
+		g.Paths[p] = &PathInfo{Path: p, NarHash: hex.EncodeToString(sum[:]), NarSize: uint64(len(data)), References: []string{p}}
+	}
+	g.Paths["/nix/store/aaaa-app-1.0"].References = append(g.Paths["/nix/store/aaaa-app-1.0"].References, "/nix/store/cccc-glibc-2.39")
+	g.Paths["/nix/store/aaaa-app-1.0"].Deriver = "/nix/store/dddd-app-1.0.drv"
+	return g
+}
+
+func testDump(ctx context.Context, storePath string, w io.Writer) error {
+	data, ok := testNARs[storePath]
+	if !ok {
+		return fmt.Errorf("%s: %w", storePath, ErrNotValid)
+	}
+	_, err := w.Write(data)
+	return err
+}
+
+func TestPushClosureFetchNAR(t *testing.T) {
+	compressions := []Compression{CompressionNone, CompressionZstd}
+	if _, err := exec.LookPath("xz"); err == nil {
+		compressions = append(compressions, CompressionXz)
+	}
+
+	for _, c := range compressions {
+		t.Run(string(c), func(t *testing.T) {
+			dir := t.TempDir()
+			cache, err := OpenBinaryCache("file://" + dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ctx := context.Background()
+			result, err := PushClosure(ctx, cache, testClosure(), testDump, PushOptions{Compression: c, Jobs: 2, Workers: 2})
+			if err != nil {
+				t.Fatalf("PushClosure() error = %v", err)
+			}
+			if len(result.Pushed) != 2 || len(result.Skipped) != 0 {
+				t.Errorf("PushClosure() = %+v, want 2 paths pushed", result)
+			}
+			if _, err := os.Stat(filepath.Join(dir, "nix-cache-info")); err != nil {
+				t.Errorf("nix-cache-info not written: %v", err)
+			}
+			narInfo, err := os.ReadFile(filepath.Join(dir, "aaaa.narinfo"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, want := range []string{"Compression: " + string(c), "URL: nar/", c.Extension() + "\n", "References: aaaa-app-1.0 cccc-glibc-2.39", "Deriver: dddd-app-1.0.drv"} {
+				if !strings.Contains(string(narInfo), want) {
+					t.Errorf("narinfo %q lacks %q", narInfo, want)
+				}
+			}
+
+			for p, data := range testNARs {
+				var buf bytes.Buffer
+				info, err := cache.FetchNAR(ctx, p, &buf)
+				if err != nil {
+					t.Fatalf("FetchNAR(%s) error = %v", p, err)
+				}
+				if !bytes.Equal(buf.Bytes(), data) {
+					t.Errorf("FetchNAR(%s) wrote %d bytes, want the %d pushed", p, buf.Len(), len(data))
+				}
+				if info.NarHash != testClosure().Paths[p].NarHash {
+					t.Errorf("FetchNAR(%s) NarHash = %s", p, info.NarHash)
+				}
+			}
+
+			result, err = PushClosure(ctx, cache, testClosure(), testDump, PushOptions{Compression: c})
+			if err != nil {
+				t.Fatalf("PushClosure() again error = %v", err)
+			}
+			if len(result.Pushed) != 0 || len(result.Skipped) != 2 {
+				t.Errorf("PushClosure() again = %+v, want 2 paths skipped", result)
+			}
+		})
+	}
+}
+
+func TestPushClosureHTTP(t *testing.T) {
+	var mu sync.Mutex
+	files := make(map[string][]byte)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch r.Method {
+		case http.MethodPut:
+			data, _ := io.ReadAll(r.Body)
+			files[r.URL.Path] = data
+		case http.MethodGet:
+			data, ok := files[r.URL.Path]
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			w.Write(data)
+		}
+	}))
+	defer srv.Close()
+
+	cache, err := OpenBinaryCache(srv.URL + "/cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if _, err := PushClosure(ctx, cache, testClosure(), testDump, PushOptions{Compression: CompressionZstd, Jobs: 2}); err != nil {
+		t.Fatalf("PushClosure() error = %v", err)
+	}
+	var buf bytes.Buffer
+	if _, err := cache.FetchNAR(ctx, "/nix/store/aaaa-app-1.0", &buf); err != nil {
+		t.Fatalf("FetchNAR() error = %v", err)
+	}
+	if !bytes.Equal(buf.Bytes(), testNARs["/nix/store/aaaa-app-1.0"]) {
+		t.Errorf("FetchNAR() wrote another NAR")
+	}
+}
+
+func TestPushClosureErrors(t *testing.T) {
+	ctx := context.Background()
+	cache, err := OpenBinaryCache("file://" + t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	g := testClosure()
+	g.Paths["/nix/store/cccc-glibc-2.39"].NarHash = strings.Repeat("0", 64)
+	if _, err := PushClosure(ctx, cache, g, testDump, PushOptions{Compression: CompressionZstd}); err == nil || !strings.Contains(err.Error(), "has hash") {
+		t.Errorf("PushClosure() of a NAR with another hash error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(cache.url.Path, "cccc.narinfo")); err == nil {
+		t.Errorf("the narinfo of a NAR with another hash was uploaded")
+	}
+
+	if _, err := PushClosure(ctx, cache, testClosure(), testDump, PushOptions{Compression: CompressionZstd}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := PushClosure(ctx, cache, g, testDump, PushOptions{Compression: CompressionZstd}); err == nil {
+		t.Errorf("PushClosure() of a path the cache has with another NAR hash error = nil")
+	}
+}
+
+func TestFetchNARCorrupt(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	cache, err := OpenBinaryCache("file://" + dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := PushClosure(ctx, cache, testClosure(), testDump, PushOptions{Compression: CompressionNone}); err != nil {
+		t.Fatal(err)
+	}
+
+	nars, err := filepath.Glob(filepath.Join(dir, "nar", "*.nar"))
+	if err != nil || len(nars) != 2 {
+		t.Fatalf("nar files = %v, %v", nars, err)
+	}
+	for _, nar := range nars {
+		data, err := os.ReadFile(nar)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data[0] ^= 0xff
+		if err := os.WriteFile(nar, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := cache.FetchNAR(ctx, "/nix/store/aaaa-app-1.0", io.Discard); err == nil || !strings.Contains(err.Error(), "has hash") {
+		t.Errorf("FetchNAR() of a corrupt NAR error = %v", err)
+	}
+}
+
+func TestParseCompression(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Compression
+		wantErr bool
+	}{
+		{"", CompressionNone, false},
+		{"zstd", CompressionZstd, false},
+		{"xz", CompressionXz, false},
+		{"bzip2", "", true},
+		{"gzip", "", true},
+	}
+	for _, tt := range tests {
+		got, err := ParseCompression(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseCompression(%q) = %q, %v, want %q, error %v", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+// Package store queries the nix store without running nix commands. The daemon client speaks the worker protocol
+// of the nix daemon over its socket, the way nix-store does, and returns typed path info and closure graphs. Hosts
+// without a daemon read the store directory itself.
+package store
+
+import (
+	"context"
+	"errors"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ErrNotValid is returned for store paths that are not in the store
+var ErrNotValid = errors.New("path is not valid in the store")
+
+// PathInfo holds what the store records about a store path
+type PathInfo struct {
+	Path    string
+	Deriver string
+	// NarHash is the sha256 hash of the NAR serialisation of the path, in hex
+	NarHash          string
+	NarSize          uint64
+	References       []string
+	RegistrationTime time.Time
+	Signatures       []string
+	// CA is the content address of content addressed paths, e.g. fixed output derivations
+	CA string
+}
+
+// Store queries the path info of store paths
+type Store interface {
+	QueryPathInfo(ctx context.Context, storePath string) (*PathInfo, error)
+	Close() error
+}
+
+// ClosureQuerier is a Store that queries a whole closure at once rather than path by path, e.g. remote stores
+// reached by a command per query
+type ClosureQuerier interface {
+	QueryClosure(ctx context.Context, roots ...string) (*Graph, error)
+}
+
+// Graph is the closure of store paths: each path with the paths it references
+type Graph struct {
+	// Roots are the store paths the closure was queried for
+	Roots []string
+	Paths map[string]*PathInfo
+}
+
+// Closure queries the closure of the store paths: the paths they reference, the paths those reference, and so on
+func Closure(ctx context.Context, s Store, roots ...string) (*Graph, error) {
+	if q, ok := s.(ClosureQuerier); ok {
+		return q.QueryClosure(ctx, roots...)
+	}
+
+	g := &Graph{Roots: roots, Paths: make(map[string]*PathInfo)}
+	queue := append([]string(nil), roots...)
+	for len(queue) > 0 {
+		p := queue[0]
+		queue = queue[1:]
+		if _, ok := g.Paths[p]; ok {
+			continue
+		}
+
+		info, err := s.QueryPathInfo(ctx, p)
+		if err != nil {
+			return nil, err
+		}
+		g.Paths[p] = info
+		for _, ref := range info.References {
+			if _, ok := g.Paths[ref]; !ok {
+				queue = append(queue, ref)
+			}
+		}
+	}
+	return g, nil
+}
+
+// Sorted returns the store paths of the graph in lexical order
+func (g *Graph) Sorted() []string {
+	paths := make([]string, 0, len(g.Paths))
+	for p := range g.Paths {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// Referrers returns the paths of the graph referencing each path of the graph, self references excluded
+func (g *Graph) Referrers() map[string][]string {
+	referrers := make(map[string][]string, len(g.Paths))
+	for _, p := range g.Sorted() {
+		for _, ref := range g.Paths[p].References {
+			if ref != p {
+				referrers[ref] = append(referrers[ref], p)
+			}
+		}
+	}
+	return referrers
+}
+
+// Name returns the name of the store path without its hash, e.g. curl-8.6.0
+func Name(storePath string) string {
+	_, name, _ := strings.Cut(path.Base(storePath), "-")
+	return name
+}
@@ -2,6 +2,7 @@ package template
 
 import (
 	"bytes"
+	"strings"
 	"text/template"
 
 	"github.com/buildsafedev/bsf/pkg/hcl2nix"
@@ -17,6 +18,8 @@ type OCIArtifact struct {
 	ImportConfigs []string
 	ExposedPorts  []string
 	DevDeps       bool
+	// Annotations are set as labels of the image config, so they are part of the image nix builds
+	Annotations map[string]string
 }
 
 const (
@@ -42,6 +45,12 @@ const (
 			{{ range $port := $artifact.ExposedPorts}}
 			 "{{ . }}"={}; {{end}}
 		  };
+		  {{- if $artifact.Annotations}}
+		  Labels = {
+			{{- range $k, $v := $artifact.Annotations}}
+			 "{{ nixstr $k }}" = "{{ nixstr $v }}";{{end}}
+		  };
+		  {{- end}}
 		  };
 		 maxLayers = 100;
 		 layers = [
@@ -64,8 +73,12 @@ const (
 	`
 )
 
-func hclOCIToOCIArtifact(ociArtifacts []hcl2nix.OCIArtifact) []OCIArtifact {
+func hclOCIToOCIArtifact(ociArtifacts []hcl2nix.OCIArtifact, product *hcl2nix.Product) []OCIArtifact {
 	converted := make([]OCIArtifact, len(ociArtifacts))
+	var annotations map[string]string
+	if product != nil {
+		annotations = product.Annotations()
+	}
 
 	for i, ociArtifact := range ociArtifacts {
 		converted[i] = OCIArtifact{
@@ -77,6 +90,7 @@ func hclOCIToOCIArtifact(ociArtifacts []hcl2nix.OCIArtifact) []OCIArtifact {
 			ImportConfigs: ociArtifact.ImportConfigs,
 			ExposedPorts:  ociArtifact.ExposedPorts,
 			DevDeps:       ociArtifact.DevDeps,
+			Annotations:   annotations,
 		}
 	}
 
@@ -87,7 +101,8 @@ func hclOCIToOCIArtifact(ociArtifacts []hcl2nix.OCIArtifact) []OCIArtifact {
 // GenerateOCIAttr generates the Nix attribute set for oci artifacts
 func GenerateOCIAttr(artifacts []OCIArtifact) (*string, error) {
 	tmpl, err := template.New("ociAttr").Funcs(template.FuncMap{
-		"quote": quote,
+		"quote":  quote,
+		"nixstr": NixString,
 	}).
 		Parse(ociTmpl)
 	if err != nil {
@@ -103,3 +118,8 @@ func GenerateOCIAttr(artifacts []OCIArtifact) (*string, error) {
 	result := buf.String()
 	return &result, nil
 }
+
+// NixString escapes s to be used in a double quoted nix string
+func NixString(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "${", `\${`, "\n", `\n`, "\r", `\r`, "\t", `\t`).Replace(s)
+}
@@ -54,3 +54,50 @@ func TestGenerateOCIAttr(t *testing.T) {
 	}
 	fmt.Println(*result)
 }
+
+func TestGenerateOCIAttrAnnotations(t *testing.T) {
+	artifacts := []OCIArtifact{{
+		Environment: "prod",
+		Name:        "acme/billing",
+		Annotations: map[string]string{
+			"org.opencontainers.image.vendor": "Acme \"Inc\"",
+			"org.opencontainers.image.title":  "Billing ${version}",
+		},
+	}}
+
+	result, err := GenerateOCIAttr(artifacts)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for _, want := range []string{
+		`"org.opencontainers.image.vendor" = "Acme \"Inc\"";`,
+		`"org.opencontainers.image.title" = "Billing \${version}";`,
+	} {
+		if !strings.Contains(*result, want) {
+			t.Errorf("Generated template does not contain %s", want)
+		}
+	}
+
+	if result, _ := GenerateOCIAttr([]OCIArtifact{{Environment: "dev", Name: "app"}}); strings.Contains(*result, "Labels") {
+		t.Errorf("Generated template should not set labels without product metadata")
+	}
+}
+
+func TestNixString(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{in: "hello", want: `hello`},
+		{in: `say "hi"`, want: `say \"hi\"`},
+		{in: "${HOME}", want: `\${HOME}`},
+		{in: `a\b`, want: `a\\b`},
+		{in: "line\nline", want: `line\nline`},
+	}
+
+	for _, tt := range tests {
+		if got := NixString(tt.in); got != tt.want {
+			t.Errorf("NixString(%q) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
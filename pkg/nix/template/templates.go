@@ -206,7 +206,7 @@ func GenerateFlake(fl Flake, wr io.Writer, conf *hcl2nix.Config) error {
 	}
 
 	if conf.OCIArtifact != nil {
-		artifacts := hclOCIToOCIArtifact(conf.OCIArtifact)
+		artifacts := hclOCIToOCIArtifact(conf.OCIArtifact, conf.Product)
 		artifacttAttr, err := GenerateOCIAttr(artifacts)
 		if err != nil {
 			return err
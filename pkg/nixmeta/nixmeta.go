@@ -0,0 +1,272 @@
+package nixmeta
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/buildsafedev/bsf/pkg/toolchain"
+)
+
+// Entry is the metadata of a nixpkgs attribute
+type Entry struct {
+	AttrPath string   `json:"attrPath"`
+	Pname    string   `json:"pname"`
+	Version  string   `json:"version"`
+	Licenses []string `json:"licenses,omitempty"`
+	Homepage string   `json:"homepage,omitempty"`
+	// Description is the one line description of meta.description
+	Description string `json:"description,omitempty"`
+	// Maintainers are the nixpkgs maintainers of the package, as "name <email>"
+	Maintainers []string `json:"maintainers,omitempty"`
+}
+
+// Cache holds the metadata of every package of a nixpkgs revision, keyed by derivation name (pname-version)
+type Cache struct {
+	Rev     string           `json:"rev"`
+	Entries map[string]Entry `json:"entries"`
+}
+
+// Lookup returns the metadata of the derivation name
+func (c *Cache) Lookup(name string) (Entry, bool) {
+	e, ok := c.Entries[name]
+	return e, ok
+}
+
+// nixEnvPackage is a package as printed by nix-env -qaP --json --meta
+type nixEnvPackage struct {
+	Name    string `json:"name"`
+	Pname   string `json:"pname"`
+	Version string `json:"version"`
+	Meta    meta   `json:"meta"`
+}
+
+// meta is the meta attribute of a nixpkgs package
+type meta struct {
+	License     json.RawMessage `json:"license"`
+	Homepage    json.RawMessage `json:"homepage"`
+	Description string          `json:"description"`
+	Maintainers []maintainer    `json:"maintainers"`
+}
+
+type maintainer struct {
+	Name   string `json:"name"`
+	Email  string `json:"email"`
+	Github string `json:"github"`
+}
+
+func (m maintainer) String() string {
+	name := m.Name
+	if name == "" {
+		name = m.Github
+	}
+	if m.Email == "" {
+		return name
+	}
+	return name + " <" + m.Email + ">"
+}
+
+// entry returns the cache entry of the package metadata
+func (m meta) entry(attrPath, pname, version string) Entry {
+	e := Entry{
+		AttrPath:    attrPath,
+		Pname:       pname,
+		Version:     version,
+		Licenses:    parseLicenses(m.License),
+		Homepage:    parseHomepage(m.Homepage),
+		Description: m.Description,
+	}
+	for _, mt := range m.Maintainers {
+		if s := mt.String(); s != "" {
+			e.Maintainers = append(e.Maintainers, s)
+		}
+	}
+	return e
+}
+
+// Generate evaluates nixpkgs at rev and collects the metadata of all packages. This takes several minutes.
+func Generate(rev string) (*Cache, error) {
+	cmd := toolchain.Check(exec.Command("nix-env", "-f", fmt.Sprintf("https://github.com/NixOS/nixpkgs/archive/%s.tar.gz", rev), "-qaP", "--json", "--meta"))
+
+	var stdout bytes.Buffer
+	var stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+	if err != nil {
+		return nil, fmt.Errorf("failed with %s", cmd.Stderr)
+	}
+
+	return parseNixEnv(rev, stdout.Bytes())
+}
+
+func parseNixEnv(rev string, data []byte) (*Cache, error) {
+	pkgs := make(map[string]nixEnvPackage)
+	err := json.Unmarshal(data, &pkgs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse nixpkgs metadata: %v", err)
+	}
+
+	c := &Cache{
+		Rev:     rev,
+		Entries: make(map[string]Entry, len(pkgs)),
+	}
+	for attrPath, p := range pkgs {
+		// the shortest attribute path wins when several point to the same derivation
+		if existing, ok := c.Entries[p.Name]; ok && len(existing.AttrPath) <= len(attrPath) {
+			continue
+		}
+		c.Entries[p.Name] = p.Meta.entry(attrPath, p.Pname, p.Version)
+	}
+
+	return c, nil
+}
+
+type license struct {
+	SpdxID    string `json:"spdxId"`
+	ShortName string `json:"shortName"`
+}
+
+// parseLicenses handles meta.license being a license, a list of licenses or a free form string
+func parseLicenses(raw json.RawMessage) []string {
+	if len(raw) == 0 {
+		return nil
+	}
+
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return []string{s}
+	}
+
+	var one license
+	if err := json.Unmarshal(raw, &one); err == nil {
+		return []string{one.id()}
+	}
+
+	var many []license
+	if err := json.Unmarshal(raw, &many); err == nil {
+		ids := make([]string, 0, len(many))
+		for _, l := range many {
+			ids = append(ids, l.id())
+		}
+		return ids
+	}
+
+	return nil
+}
+
+func (l license) id() string {
+	if l.SpdxID != "" {
+		return l.SpdxID
+	}
+	return l.ShortName
+}
+
+// parseHomepage handles meta.homepage being a string or a list of strings
+func parseHomepage(raw json.RawMessage) string {
+	if len(raw) == 0 {
+		return ""
+	}
+
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return s
+	}
+
+	var many []string
+	if err := json.Unmarshal(raw, &many); err == nil && len(many) > 0 {
+		return many[0]
+	}
+
+	return ""
+}
+
+// Dir returns the local directory of the metadata cache
+func Dir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "bsf", "nixmeta"), nil
+}
+
+func fileName(rev string) string {
+	return rev + ".json.gz"
+}
+
+// Path returns the location of the metadata cache of rev in the local cache directory
+func Path(rev string) (string, error) {
+	dir, err := Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, fileName(rev)), nil
+}
+
+// Load reads the metadata cache of rev from the local cache directory
+func Load(rev string) (*Cache, error) {
+	dir, err := Dir()
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(filepath.Join(dir, fileName(rev)))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return Read(f)
+}
+
+// Save writes the metadata cache to the local cache directory
+func (c *Cache) Save() (string, error) {
+	dir, err := Dir()
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+
+	path := filepath.Join(dir, fileName(c.Rev))
+	f, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	return path, c.Write(f)
+}
+
+// Read reads a gzipped metadata cache
+func Read(r io.Reader) (*Cache, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+
+	c := &Cache{}
+	err = json.NewDecoder(gz).Decode(c)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Write writes the metadata cache gzipped
+func (c *Cache) Write(w io.Writer) error {
+	gz := gzip.NewWriter(w)
+	err := json.NewEncoder(gz).Encode(c)
+	if err != nil {
+		return err
+	}
+	return gz.Close()
+}
@@ -0,0 +1,54 @@
+package nixmeta
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestParseNixEnv(t *testing.T) {
+	data := []byte(`{
+		"hello": {"name": "hello-2.12.1", "pname": "hello", "version": "2.12.1", "meta": {"license": {"spdxId": "GPL-3.0-or-later"}, "homepage": "https://www.gnu.org/software/hello/manual/"}},
+		"python3Packages.hello": {"name": "hello-2.12.1", "pname": "hello", "version": "2.12.1", "meta": {}},
+		"openssl": {"name": "openssl-3.0.13", "pname": "openssl", "version": "3.0.13", "meta": {"license": [{"spdxId": "Apache-2.0"}, {"shortName": "openssl"}], "homepage": ["https://www.openssl.org/"]}}
+	}`)
+
+	c, err := parseNixEnv("abc", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		want Entry
+	}{
+		{
+			name: "hello-2.12.1",
+			want: Entry{AttrPath: "hello", Pname: "hello", Version: "2.12.1", Licenses: []string{"GPL-3.0-or-later"}, Homepage: "https://www.gnu.org/software/hello/manual/"},
+		},
+		{
+			name: "openssl-3.0.13",
+			want: Entry{AttrPath: "openssl", Pname: "openssl", Version: "3.0.13", Licenses: []string{"Apache-2.0", "openssl"}, Homepage: "https://www.openssl.org/"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := c.Lookup(tt.name)
+			if !ok || !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Lookup() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	var buf bytes.Buffer
+	if err := c.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	read, err := Read(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if read.Rev != "abc" || len(read.Entries) != 2 {
+		t.Errorf("Read() = %+v", read)
+	}
+}
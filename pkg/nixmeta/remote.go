@@ -0,0 +1,48 @@
+package nixmeta
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/buildsafedev/bsf/pkg/location"
+)
+
+// Push uploads the local metadata cache of rev to the shared location, one of the locations of package location
+func Push(ctx context.Context, loc, rev string) error {
+	dir, err := Dir()
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(filepath.Join(dir, fileName(rev)))
+	if err != nil {
+		return fmt.Errorf("no local metadata cache for %s: %v", rev, err)
+	}
+	return location.Put(ctx, loc, fileName(rev), "application/gzip", data)
+}
+
+// Pull downloads the metadata cache of rev from the shared location into the local cache directory
+func Pull(ctx context.Context, loc, rev string) (*Cache, error) {
+	dir, err := Dir()
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	data, err := location.Get(ctx, loc, fileName(rev))
+	if err != nil {
+		return nil, err
+	}
+	// validate before replacing the local copy
+	if _, err := Read(bytes.NewReader(data)); err != nil {
+		return nil, fmt.Errorf("invalid metadata cache at %s: %v", loc, err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, fileName(rev)), data, 0644); err != nil {
+		return nil, err
+	}
+	return Load(rev)
+}
@@ -0,0 +1,224 @@
+package nixmeta
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/awalterschulze/gographviz"
+
+	nixcmd "github.com/buildsafedev/bsf/pkg/nix/cmd"
+)
+
+// Resolver resolves the metadata of the packages of a closure, from the metadata cache of the nixpkgs revision
+// when there is one and by evaluating their meta attribute in nixpkgs otherwise
+type Resolver struct {
+	Rev   string
+	Cache *Cache
+	// Eval evaluates a nix expression to JSON, nixcmd.EvalJSONContext when nil
+	Eval func(expr string) ([]byte, error)
+	// Workers is the number of evaluations of packages missing from the cache run at once, 1 when not set
+	Workers int
+}
+
+// NewResolver returns the resolver of the nixpkgs revision, using its local metadata cache when it was generated or pulled
+func NewResolver(rev string) *Resolver {
+	r := &Resolver{Rev: rev}
+	if c, err := Load(rev); err == nil {
+		r.Cache = c
+	}
+	return r
+}
+
+// Package is a package of the closure, named after its store path
+type Package struct {
+	Pname   string
+	Version string
+}
+
+// Name returns the derivation name of the package, pname-version
+func (p Package) Name() string {
+	return p.Pname + "-" + p.Version
+}
+
+// Resolve returns the metadata of the packages keyed by derivation name. Packages that are not attributes of
+// nixpkgs, or whose attribute is another version, have no metadata.
+func (r *Resolver) Resolve(pkgs []Package) (map[string]Entry, error) {
+	entries, _, err := r.ResolveContext(context.Background(), pkgs)
+	return entries, err
+}
+
+// ResolveContext resolves the metadata of the packages as Resolve does. The packages missing from the cache are
+// split between Workers evaluations run at once, the packages whose evaluation didn't complete when ctx is done are
+// returned as pending with the metadata resolved so far.
+func (r *Resolver) ResolveContext(ctx context.Context, pkgs []Package) (map[string]Entry, []Package, error) {
+	entries := make(map[string]Entry, len(pkgs))
+	wanted := make(map[string]bool, len(pkgs))
+	missing := make([]string, 0)
+	for _, p := range pkgs {
+		if r.Cache != nil {
+			if e, ok := r.Cache.Lookup(p.Name()); ok {
+				entries[p.Name()] = e
+				continue
+			}
+		}
+		if !wanted[p.Name()] {
+			wanted[p.Name()] = true
+			missing = append(missing, p.Pname)
+		}
+	}
+	if len(missing) == 0 || r.Rev == "" {
+		return entries, nil, nil
+	}
+	sort.Strings(missing)
+	missing = slices.Compact(missing)
+
+	eval := func(ctx context.Context, expr string) ([]byte, error) {
+		if r.Eval != nil {
+			return r.Eval(expr)
+		}
+		return nixcmd.EvalJSONContext(ctx, expr)
+	}
+	workers := max(r.Workers, 1)
+	size := (len(missing) + workers - 1) / workers
+	type result struct {
+		chunk []string
+		out   []byte
+		err   error
+	}
+	// buffered, evaluations completing after ctx is done don't block
+	results := make(chan result, workers)
+	chunks := 0
+	for start := 0; start < len(missing); start += size {
+		chunk := missing[start:min(start+size, len(missing))]
+		chunks++
+		go func() {
+			out, err := eval(ctx, metaExpr(r.Rev, chunk))
+			results <- result{chunk: chunk, out: out, err: err}
+		}()
+	}
+
+	done := make(map[string]bool, len(missing))
+	failed := 0
+	var evalErr error
+collect:
+	for i := 0; i < chunks; i++ {
+		var res result
+		select {
+		case res = <-results:
+		case <-ctx.Done():
+			break collect
+		}
+		if res.err == nil {
+			res.err = parseEvaluated(res.out, wanted, entries)
+		}
+		if res.err != nil && ctx.Err() != nil {
+			// stopped by ctx, the packages are pending rather than failed
+			continue
+		}
+		for _, pname := range res.chunk {
+			done[pname] = true
+		}
+		if res.err != nil {
+			failed += len(res.chunk)
+			evalErr = res.err
+		}
+	}
+
+	var pending []Package
+	for _, p := range pkgs {
+		if _, ok := entries[p.Name()]; !ok && !done[p.Pname] {
+			pending = append(pending, p)
+		}
+	}
+	if evalErr != nil {
+		return entries, pending, fmt.Errorf("failed to evaluate the metadata of %d packages: %w", failed, evalErr)
+	}
+	return entries, pending, nil
+}
+
+// parseEvaluated adds the metadata of the evaluated packages to the entries
+func parseEvaluated(out []byte, wanted map[string]bool, entries map[string]Entry) error {
+	evaluated := make(map[string]*struct {
+		Name    string `json:"name"`
+		Version string `json:"version"`
+		Meta    meta   `json:"meta"`
+	})
+	if err := json.Unmarshal(out, &evaluated); err != nil {
+		return fmt.Errorf("failed to parse the metadata of nixpkgs: %v", err)
+	}
+	for pname, p := range evaluated {
+		// the attribute may be another version of the package, or another package altogether
+		if p == nil || !wanted[p.Name] {
+			continue
+		}
+		entries[p.Name] = p.Meta.entry(pname, pname, p.Version)
+	}
+	return nil
+}
+
+// metaExpr returns the expression evaluating the name and meta of the nixpkgs attributes. Attributes that don't
+// exist or fail to evaluate are null.
+func metaExpr(rev string, attrs []string) string {
+	quoted := make([]string, 0, len(attrs))
+	for _, a := range attrs {
+		quoted = append(quoted, strconv.Quote(a))
+	}
+
+	return fmt.Sprintf(`let
+		pkgs = (builtins.getFlake "github:NixOS/nixpkgs/%s").legacyPackages.${builtins.currentSystem};
+		meta = p: {
+			name = p.name or "";
+			version = p.version or "";
+			meta = {
+				license = p.meta.license or null;
+				homepage = p.meta.homepage or null;
+				description = p.meta.description or "";
+				maintainers = map (m: { name = m.name or ""; email = m.email or ""; github = m.github or ""; }) (p.meta.maintainers or []);
+			};
+		};
+		attempt = a: let r = builtins.tryEval (let v = meta pkgs.${a}; in builtins.deepSeq v v); in if r.success then r.value else null;
+	in builtins.listToAttrs (map (a: { name = a; value = if pkgs ? ${a} then attempt a else null; }) [ %s ])`, rev, strings.Join(quoted, " "))
+}
+
+// Annotate records the metadata on the nodes of the closure graph, keeping the attributes other sources, such as
+// the package registry, already set. It returns the number of annotated nodes.
+func Annotate(graph *gographviz.Graph, entries map[string]Entry) int {
+	annotated := 0
+	for _, node := range graph.Nodes.Nodes {
+		e, ok := entries[node.Attrs["name"]+"-"+node.Attrs["version"]]
+		if !ok {
+			continue
+		}
+		annotated++
+
+		set := func(key, value string) {
+			if value != "" && node.Attrs[gographviz.Attr(key)] == "" {
+				node.Attrs[gographviz.Attr(key)] = value
+			}
+		}
+		// SPDX identifiers have no spaces, maintainers are separated by commas
+		set("licenses", strings.Join(e.Licenses, " "))
+		set("homepage", e.Homepage)
+		set("description", e.Description)
+		set("maintainers", strings.Join(e.Maintainers, ", "))
+		// the attribute confirms the name and version parsed from the store path
+		set("attr_path", e.AttrPath)
+	}
+	return annotated
+}
+
+// Packages returns the packages of the nodes of the closure graph
+func Packages(graph *gographviz.Graph) []Package {
+	pkgs := make([]Package, 0, len(graph.Nodes.Nodes))
+	for _, node := range graph.Nodes.Nodes {
+		if name := node.Attrs["name"]; name != "" {
+			pkgs = append(pkgs, Package{Pname: name, Version: node.Attrs["version"]})
+		}
+	}
+	return pkgs
+}
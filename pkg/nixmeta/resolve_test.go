@@ -0,0 +1,116 @@
+package nixmeta
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/awalterschulze/gographviz"
+)
+
+func TestResolve(t *testing.T) {
+	cache := &Cache{Rev: "abc", Entries: map[string]Entry{
+		"hello-2.12.1": {AttrPath: "hello", Pname: "hello", Version: "2.12.1", Licenses: []string{"GPL-3.0-or-later"}},
+	}}
+
+	var evaluated string
+	r := &Resolver{Rev: "abc", Cache: cache, Eval: func(expr string) ([]byte, error) {
+		evaluated = expr
+		return []byte(`{
+			"curl": {"name": "curl-8.6.0", "version": "8.6.0", "meta": {"license": {"spdxId": "curl"}, "homepage": "https://curl.se/", "description": "A command line tool for transferring files", "maintainers": [{"name": "Jane Doe", "email": "jane@example.com", "github": "jdoe"}, {"name": "", "email": "", "github": "jdoe2"}]}},
+			"openssl": {"name": "openssl-3.3.0", "version": "3.3.0", "meta": {"license": {"spdxId": "Apache-2.0"}}},
+			"libfoo": null
+		}`), nil
+	}}
+
+	entries, err := r.Resolve([]Package{
+		{Pname: "hello", Version: "2.12.1"},
+		{Pname: "curl", Version: "8.6.0"},
+		{Pname: "openssl", Version: "3.0.13"},
+		{Pname: "libfoo", Version: "1.0"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Contains(evaluated, `"hello"`) || !strings.Contains(evaluated, `[ "curl" "libfoo" "openssl" ]`) {
+		t.Errorf("cached packages should not be evaluated: %s", evaluated)
+	}
+	want := map[string]Entry{
+		"hello-2.12.1": cache.Entries["hello-2.12.1"],
+		"curl-8.6.0": {
+			AttrPath:    "curl",
+			Pname:       "curl",
+			Version:     "8.6.0",
+			Licenses:    []string{"curl"},
+			Homepage:    "https://curl.se/",
+			Description: "A command line tool for transferring files",
+			Maintainers: []string{"Jane Doe <jane@example.com>", "jdoe2"},
+		},
+	}
+	if !reflect.DeepEqual(entries, want) {
+		t.Errorf("Resolve() = %+v, want %+v", entries, want)
+	}
+}
+
+func TestResolveContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// curl is evaluated, the evaluation of openssl doesn't complete before the deadline
+	r := &Resolver{Rev: "abc", Workers: 2, Eval: func(expr string) ([]byte, error) {
+		if strings.Contains(expr, `"openssl"`) {
+			cancel()
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}
+		return []byte(`{"curl": {"name": "curl-8.6.0", "version": "8.6.0", "meta": {"license": {"spdxId": "curl"}}}}`), nil
+	}}
+
+	entries, pending, err := r.ResolveContext(ctx, []Package{
+		{Pname: "curl", Version: "8.6.0"},
+		{Pname: "openssl", Version: "3.3.0"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := entries["curl-8.6.0"]; !ok && len(pending) != 2 {
+		t.Errorf("curl was neither resolved nor pending: %v %v", entries, pending)
+	}
+	if len(pending) == 0 || pending[len(pending)-1] != (Package{Pname: "openssl", Version: "3.3.0"}) {
+		t.Errorf("pending = %v, want openssl", pending)
+	}
+}
+
+func TestAnnotate(t *testing.T) {
+	graph := gographviz.NewGraph()
+	graph.SetName("G")
+	for _, n := range []string{`"aaaa-curl-8.6.0"`, `"bbbb-billing-2.1.0"`} {
+		if err := graph.AddNode("G", n, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	graph.Nodes.Lookup[`"aaaa-curl-8.6.0"`].Attrs["name"] = "curl"
+	graph.Nodes.Lookup[`"aaaa-curl-8.6.0"`].Attrs["version"] = "8.6.0"
+	billing := graph.Nodes.Lookup[`"bbbb-billing-2.1.0"`]
+	billing.Attrs["name"] = "billing"
+	billing.Attrs["version"] = "2.1.0"
+	billing.Attrs["description"] = "from the package registry"
+
+	n := Annotate(graph, map[string]Entry{
+		"curl-8.6.0":    {Licenses: []string{"curl", "MIT"}, Homepage: "https://curl.se/", Maintainers: []string{"Jane Doe <jane@example.com>", "jdoe2"}},
+		"billing-2.1.0": {Description: "from nixpkgs"},
+	})
+	if n != 2 {
+		t.Errorf("Annotate() = %d, want 2", n)
+	}
+
+	curl := graph.Nodes.Lookup[`"aaaa-curl-8.6.0"`].Attrs
+	if curl["licenses"] != "curl MIT" || curl["homepage"] != "https://curl.se/" || curl["maintainers"] != "Jane Doe <jane@example.com>, jdoe2" {
+		t.Errorf("unexpected attributes %v", curl)
+	}
+	if billing.Attrs["description"] != "from the package registry" {
+		t.Errorf("the registry description was replaced: %v", billing.Attrs)
+	}
+}
@@ -0,0 +1,180 @@
+package nixmeta
+
+import (
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/awalterschulze/gographviz"
+
+	nixcmd "github.com/buildsafedev/bsf/pkg/nix/cmd"
+)
+
+// Graph attributes of wrapper derivations, such as wrapProgram, symlinkJoin and buildEnv results. Wrappers have no
+// license of their own, they are licensed as the packages they wrap.
+const (
+	// AttrWrapper is "true" on the nodes of wrappers
+	AttrWrapper = "wrapper"
+	// AttrWraps holds the names of the wrapped packages, separated by spaces
+	AttrWraps = "wraps"
+	// AttrInheritedLicenses holds the licenses of the wrapped packages, SPDX identifiers separated by spaces
+	AttrInheritedLicenses = "inherited_licenses"
+)
+
+// wrapperSuffixes are the name suffixes nixpkgs gives wrappers and environments, e.g. gcc-wrapper-13.2.0 or
+// python3-3.11.9-env
+var wrapperSuffixes = []string{"-wrapper", "-wrapped", "-env", "-with-packages", "-with-plugins"}
+
+// wrapperTools are the runtime dependencies wrappers add themselves, they are not wrapped
+var wrapperTools = map[string]bool{
+	"bash":             true,
+	"bash-interactive": true,
+	"coreutils":        true,
+	"dash":             true,
+	"gnugrep":          true,
+	"gnused":           true,
+	"findutils":        true,
+}
+
+// InheritWrapperLicenses flags the wrappers of the closure graph and gives them the licenses of the packages they wrap.
+// The wrapped packages are the ones named like the wrapper, e.g. firefox-unwrapped for firefox, and the members of
+// environments otherwise. Wrappers with a license of their own keep it. It returns the number of wrappers.
+func InheritWrapperLicenses(graph *gographviz.Graph) int {
+	wrappers := 0
+	done := make(map[string]bool)
+	var inherit func(name string) []string
+	inherit = func(name string) []string {
+		node, ok := graph.Nodes.Lookup[name]
+		if !ok {
+			return nil
+		}
+		if done[name] {
+			return nodeLicenses(node.Attrs)
+		}
+		done[name] = true
+
+		targets := wrappedTargets(graph, node)
+		if targets == nil {
+			return nodeLicenses(node.Attrs)
+		}
+		wrappers++
+
+		licenses := make([]string, 0)
+		names := make([]string, 0, len(targets))
+		for _, t := range targets {
+			names = append(names, graph.Nodes.Lookup[t].Attrs["name"])
+			licenses = append(licenses, inherit(t)...)
+		}
+		sort.Strings(names)
+		sort.Strings(licenses)
+		licenses = slices.Compact(licenses)
+
+		node.Attrs[AttrWrapper] = "true"
+		node.Attrs[AttrWraps] = strings.Join(slices.Compact(names), " ")
+		if len(licenses) > 0 {
+			node.Attrs[AttrInheritedLicenses] = strings.Join(licenses, " ")
+		}
+		return nodeLicenses(node.Attrs)
+	}
+
+	names := make([]string, 0, len(graph.Nodes.Nodes))
+	for _, node := range graph.Nodes.Nodes {
+		names = append(names, node.Name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		inherit(name)
+	}
+	return wrappers
+}
+
+// nodeLicenses returns the licenses of a node: its own, from nixpkgs or the package registry, or inherited
+func nodeLicenses(attrs gographviz.Attrs) []string {
+	if licenses := strings.Fields(attrs["licenses"]); len(licenses) > 0 {
+		return licenses
+	}
+	if license := attrs["license"]; license != "" {
+		return []string{license}
+	}
+	return strings.Fields(attrs[AttrInheritedLicenses])
+}
+
+// wrappedTargets returns the nodes of the packages a wrapper wraps, nil when the node is not a wrapper
+func wrappedTargets(graph *gographviz.Graph, node *gographviz.Node) []string {
+	name, version := node.Attrs["name"], node.Attrs["version"]
+	if name == "" {
+		return nil
+	}
+	deps := make([]string, 0)
+	for src := range graph.Edges.DstToSrcs[node.Name] {
+		if src != node.Name {
+			deps = append(deps, src)
+		}
+	}
+	sort.Strings(deps)
+
+	// FHS envs wrap the members of their root filesystem, see nixcmd.AnnotateFHS
+	switch node.Attrs[nixcmd.AttrFHS] {
+	case nixcmd.FHSWrapper:
+		// the wrapper runs the launcher referencing the root filesystem
+		env := node.Attrs[nixcmd.AttrFHSEnv]
+		for _, n := range graph.Nodes.Nodes {
+			if n.Attrs[nixcmd.AttrFHS] == nixcmd.FHSRootFS && strings.HasSuffix(nixcmd.CleanNameFromGraph(n.Name), "-"+env) {
+				return []string{n.Name}
+			}
+		}
+	case nixcmd.FHSRootFS:
+		members := make([]string, 0, len(deps))
+		for _, dep := range deps {
+			if depName := graph.Nodes.Lookup[dep].Attrs["name"]; depName != "" && !wrapperTools[depName] {
+				members = append(members, dep)
+			}
+		}
+		return members
+	}
+
+	// wrapProgram wrappers keep the name of the package, which is renamed to <name>-unwrapped
+	for _, dep := range deps {
+		if graph.Nodes.Lookup[dep].Attrs["name"] == name+"-unwrapped" {
+			return []string{dep}
+		}
+	}
+
+	base, ok := wrapperBase(name, version)
+	if !ok {
+		return nil
+	}
+	named := make([]string, 0)
+	members := make([]string, 0)
+	for _, dep := range deps {
+		depName := graph.Nodes.Lookup[dep].Attrs["name"]
+		switch {
+		case depName == base || depName == base+"-unwrapped":
+			named = append(named, dep)
+		case depName != "" && !wrapperTools[depName]:
+			members = append(members, dep)
+		}
+	}
+	if len(named) > 0 {
+		return named
+	}
+	return members
+}
+
+// wrapperBase returns the name of the package a wrapper is named after, e.g. gcc for gcc-wrapper. Environments
+// named after a version, e.g. python3-3.11.9-env parsed as version env, are named after the package of the version.
+func wrapperBase(name, version string) (string, bool) {
+	for _, suffix := range wrapperSuffixes {
+		if base, ok := strings.CutSuffix(name, suffix); ok {
+			return base, true
+		}
+		if version == strings.TrimPrefix(suffix, "-") {
+			base := name
+			if i := strings.LastIndex(base, "-"); i > 0 && base[i+1] >= '0' && base[i+1] <= '9' {
+				base = base[:i]
+			}
+			return base, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,151 @@
+package nixmeta
+
+import (
+	"testing"
+
+	"github.com/awalterschulze/gographviz"
+
+	nixcmd "github.com/buildsafedev/bsf/pkg/nix/cmd"
+)
+
+func TestInheritWrapperLicenses(t *testing.T) {
+	graph := gographviz.NewGraph()
+	graph.SetName("G")
+	graph.SetDir(true)
+	nodes := map[string][2]string{
+		`"aaaa-firefox-128.0"`:              {"firefox", ""},
+		`"bbbb-firefox-unwrapped-128.0"`:    {"firefox-unwrapped", "MPL-2.0"},
+		`"cccc-python3-3.11.9-env"`:         {"python3-3.11.9", ""},
+		`"dddd-python3-3.11.9"`:             {"python3", "Python-2.0"},
+		`"eeee-python3.11-requests-2.31.0"`: {"python3.11-requests", "Apache-2.0"},
+		`"ffff-bash-5.2"`:                   {"bash", "GPL-3.0-or-later"},
+		`"gggg-gcc-wrapper-13.2.0"`:         {"gcc-wrapper", ""},
+		`"hhhh-gcc-13.2.0"`:                 {"gcc", "GPL-3.0-or-later"},
+		`"iiii-binutils-wrapper-2.41"`:      {"binutils-wrapper", ""},
+		`"jjjj-binutils-2.41"`:              {"binutils", "GPL-3.0-only"},
+		`"kkkk-openssl-3.0.13"`:             {"openssl", "Apache-2.0"},
+	}
+	for name, meta := range nodes {
+		if err := graph.AddNode("G", name, nil); err != nil {
+			t.Fatal(err)
+		}
+		graph.Nodes.Lookup[name].Attrs["name"] = meta[0]
+		if meta[1] != "" {
+			graph.Nodes.Lookup[name].Attrs["licenses"] = meta[1]
+		}
+	}
+	graph.Nodes.Lookup[`"cccc-python3-3.11.9-env"`].Attrs["version"] = "env"
+	// edges go from the dependency to the dependent
+	for _, e := range [][2]string{
+		{`"bbbb-firefox-unwrapped-128.0"`, `"aaaa-firefox-128.0"`},
+		{`"ffff-bash-5.2"`, `"aaaa-firefox-128.0"`},
+		{`"dddd-python3-3.11.9"`, `"cccc-python3-3.11.9-env"`},
+		{`"eeee-python3.11-requests-2.31.0"`, `"cccc-python3-3.11.9-env"`},
+		{`"ffff-bash-5.2"`, `"cccc-python3-3.11.9-env"`},
+		{`"hhhh-gcc-13.2.0"`, `"gggg-gcc-wrapper-13.2.0"`},
+		{`"iiii-binutils-wrapper-2.41"`, `"gggg-gcc-wrapper-13.2.0"`},
+		{`"jjjj-binutils-2.41"`, `"iiii-binutils-wrapper-2.41"`},
+		{`"ffff-bash-5.2"`, `"kkkk-openssl-3.0.13"`},
+	} {
+		if err := graph.AddEdge(e[0], e[1], true, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got := InheritWrapperLicenses(graph); got != 4 {
+		t.Errorf("InheritWrapperLicenses() = %d wrappers, want 4", got)
+	}
+
+	tests := map[string]struct {
+		wraps, licenses string
+	}{
+		`"aaaa-firefox-128.0"`:         {"firefox-unwrapped", "MPL-2.0"},
+		`"cccc-python3-3.11.9-env"`:    {"python3", "Python-2.0"},
+		`"gggg-gcc-wrapper-13.2.0"`:    {"gcc", "GPL-3.0-or-later"},
+		`"iiii-binutils-wrapper-2.41"`: {"binutils", "GPL-3.0-only"},
+	}
+	for name, want := range tests {
+		attrs := graph.Nodes.Lookup[name].Attrs
+		if attrs[AttrWrapper] != "true" || attrs[AttrWraps] != want.wraps || attrs[AttrInheritedLicenses] != want.licenses {
+			t.Errorf("%s: wraps %q licensed %q, want %q %q", name, attrs[AttrWraps], attrs[AttrInheritedLicenses], want.wraps, want.licenses)
+		}
+	}
+	if attrs := graph.Nodes.Lookup[`"kkkk-openssl-3.0.13"`].Attrs; attrs[AttrWrapper] != "" {
+		t.Errorf("openssl flagged as a wrapper: %v", attrs)
+	}
+}
+
+func TestInheritWrapperLicensesEnvironment(t *testing.T) {
+	graph := gographviz.NewGraph()
+	graph.SetName("G")
+	graph.SetDir(true)
+	for name, attrs := range map[string]map[string]string{
+		`"aaaa-tools-env"`:       {"name": "tools", "version": "env"},
+		`"bbbb-ripgrep-14.1.0"`:  {"name": "ripgrep", "licenses": "MIT Unlicense"},
+		`"cccc-jq-1.7.1"`:        {"name": "jq", "licenses": "MIT"},
+		`"dddd-coreutils-9.5"`:   {"name": "coreutils", "licenses": "GPL-3.0-or-later"},
+		`"eeee-internal-tool-1"`: {"name": "internal-tool", "license": "LicenseRef-Internal"},
+	} {
+		if err := graph.AddNode("G", name, nil); err != nil {
+			t.Fatal(err)
+		}
+		for k, v := range attrs {
+			graph.Nodes.Lookup[name].Attrs[gographviz.Attr(k)] = v
+		}
+	}
+	for _, dep := range []string{`"bbbb-ripgrep-14.1.0"`, `"cccc-jq-1.7.1"`, `"dddd-coreutils-9.5"`, `"eeee-internal-tool-1"`} {
+		if err := graph.AddEdge(dep, `"aaaa-tools-env"`, true, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	InheritWrapperLicenses(graph)
+	attrs := graph.Nodes.Lookup[`"aaaa-tools-env"`].Attrs
+	if got := attrs[AttrWraps]; got != "internal-tool jq ripgrep" {
+		t.Errorf("wraps %q, want the members of the environment but coreutils", got)
+	}
+	if got := attrs[AttrInheritedLicenses]; got != "LicenseRef-Internal MIT Unlicense" {
+		t.Errorf("inherited licenses %q", got)
+	}
+}
+
+func TestInheritWrapperLicensesFHS(t *testing.T) {
+	graph := gographviz.NewGraph()
+	graph.SetName("G")
+	graph.SetDir(true)
+	for name, attrs := range map[string]map[string]string{
+		`"aaaa-steam"`:               {"name": "steam", nixcmd.AttrFHS: nixcmd.FHSWrapper, nixcmd.AttrFHSEnv: "steam-fhsenv-rootfs"},
+		`"bbbb-steam-bwrap"`:         {"name": "steam-bwrap", nixcmd.AttrFHS: nixcmd.FHSLauncher, nixcmd.AttrFHSEnv: "steam-fhsenv-rootfs"},
+		`"cccc-steam-fhsenv-rootfs"`: {"name": "steam-fhsenv-rootfs", nixcmd.AttrFHS: nixcmd.FHSRootFS},
+		`"dddd-steam-1.0.0.81"`:      {"name": "steam", "license": "LicenseRef-Steam"},
+		`"eeee-glibc-2.39-52"`:       {"name": "glibc", "licenses": "LGPL-2.1-or-later"},
+		`"ffff-bubblewrap-0.9.0"`:    {"name": "bubblewrap", "licenses": "LGPL-2.0-or-later"},
+	} {
+		if err := graph.AddNode("G", name, nil); err != nil {
+			t.Fatal(err)
+		}
+		for k, v := range attrs {
+			graph.Nodes.Lookup[name].Attrs[gographviz.Attr(k)] = v
+		}
+	}
+	for _, e := range [][2]string{
+		{`"bbbb-steam-bwrap"`, `"aaaa-steam"`},
+		{`"ffff-bubblewrap-0.9.0"`, `"bbbb-steam-bwrap"`},
+		{`"cccc-steam-fhsenv-rootfs"`, `"bbbb-steam-bwrap"`},
+		{`"dddd-steam-1.0.0.81"`, `"cccc-steam-fhsenv-rootfs"`},
+		{`"eeee-glibc-2.39-52"`, `"cccc-steam-fhsenv-rootfs"`},
+	} {
+		if err := graph.AddEdge(e[0], e[1], true, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	InheritWrapperLicenses(graph)
+	attrs := graph.Nodes.Lookup[`"aaaa-steam"`].Attrs
+	if got := attrs[AttrWraps]; got != "steam-fhsenv-rootfs" {
+		t.Errorf("wraps %q, want the root filesystem rather than the launcher", got)
+	}
+	if got := attrs[AttrInheritedLicenses]; got != "LGPL-2.1-or-later LicenseRef-Steam" {
+		t.Errorf("inherited licenses %q, want the licenses of the members", got)
+	}
+}
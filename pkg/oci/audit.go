@@ -0,0 +1,130 @@
+package oci
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	bio "github.com/buildsafedev/bsf/pkg/io"
+)
+
+// ImageDigests are the digests of the manifest, config and layers of an image
+type ImageDigests struct {
+	// Manifest is empty when the manifest of the image is not known, e.g. for images nix assembles on copy
+	Manifest string
+	Config   string
+	Layers   []string
+}
+
+// DirDigests recomputes the digests of the image in dir, in the dir: layout PullDir writes and PushDir reads.
+// Every blob named by the manifest is hashed, a blob whose content does not match its digest is an error.
+func DirDigests(dir string) (ImageDigests, error) {
+	data, err := os.ReadFile(filepath.Join(dir, "manifest.json"))
+	if err != nil {
+		return ImageDigests{}, err
+	}
+	manifest := &imageManifest{}
+	if err := json.Unmarshal(data, manifest); err != nil {
+		return ImageDigests{}, fmt.Errorf("failed to parse manifest: %v", err)
+	}
+
+	check := func(b blob) (string, error) {
+		path, err := blobPath(dir, b.Digest)
+		if err != nil {
+			return "", err
+		}
+		sum, err := bio.FileSHA256(path)
+		if err != nil {
+			return "", err
+		}
+		if "sha256:"+sum != b.Digest {
+			return "", fmt.Errorf("blob %s of %s has digest sha256:%s", b.Digest, dir, sum)
+		}
+		return b.Digest, nil
+	}
+
+	d := ImageDigests{Manifest: DigestOf(data)}
+	if d.Config, err = check(manifest.Config); err != nil {
+		return ImageDigests{}, err
+	}
+	for _, l := range manifest.Layers {
+		digest, err := check(l)
+		if err != nil {
+			return ImageDigests{}, err
+		}
+		d.Layers = append(d.Layers, digest)
+	}
+	return d, nil
+}
+
+// DirLayers returns the files of the layers of the image in dir, in the order of its manifest
+func DirLayers(dir string) ([]string, error) {
+	data, err := os.ReadFile(filepath.Join(dir, "manifest.json"))
+	if err != nil {
+		return nil, err
+	}
+	manifest := &imageManifest{}
+	if err := json.Unmarshal(data, manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest: %v", err)
+	}
+	files := make([]string, 0, len(manifest.Layers))
+	for _, l := range manifest.Layers {
+		path, err := blobPath(dir, l.Digest)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, path)
+	}
+	return files, nil
+}
+
+// Discrepancy is a difference between a published image and the image of its build record
+type Discrepancy struct {
+	What   string
+	Detail string
+}
+
+// CompareImages compares the digests of a published image with the ones recorded by its build.
+// A different config means the tag now names another image, it was reused or tampered with; the same config
+// and layers under another manifest means the registry rewrote the manifest.
+func CompareImages(published, recorded ImageDigests) []Discrepancy {
+	discrepancies := make([]Discrepancy, 0)
+	add := func(what, format string, args ...interface{}) {
+		discrepancies = append(discrepancies, Discrepancy{What: what, Detail: fmt.Sprintf(format, args...)})
+	}
+
+	if published.Config != recorded.Config {
+		add("config", "published config is %s, the build recorded %s: the tag was reused or the image tampered with", published.Config, recorded.Config)
+	}
+
+	recordedLayers := make(map[string]bool, len(recorded.Layers))
+	for _, l := range recorded.Layers {
+		recordedLayers[l] = true
+	}
+	publishedLayers := make(map[string]bool, len(published.Layers))
+	for _, l := range published.Layers {
+		publishedLayers[l] = true
+		if !recordedLayers[l] {
+			add("layers", "layer %s was not built", l)
+		}
+	}
+	for _, l := range recorded.Layers {
+		if !publishedLayers[l] {
+			add("layers", "layer %s is missing from the published image", l)
+		}
+	}
+	if len(discrepancies) == 0 && strings.Join(published.Layers, ",") != strings.Join(recorded.Layers, ",") {
+		add("layers", "the layers of the published image are in a different order")
+	}
+
+	if recorded.Manifest != "" && published.Manifest != recorded.Manifest {
+		detail := fmt.Sprintf("published manifest is %s, the build recorded %s", published.Manifest, recorded.Manifest)
+		if len(discrepancies) == 0 {
+			detail += ": the registry rewrote the manifest of the same config and layers"
+		}
+		add("manifest", "%s", detail)
+	}
+	return discrepancies
+}
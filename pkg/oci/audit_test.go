@@ -0,0 +1,92 @@
+package oci
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDirDigests(t *testing.T) {
+	dir := writeImageDir(t, []byte("app layer"))
+	d, err := DirDigests(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(d.Layers) != 1 || d.Layers[0] != fmt.Sprintf("sha256:%x", sha256.Sum256([]byte("app layer"))) {
+		t.Errorf("unexpected layers %v", d.Layers)
+	}
+	manifest, _ := os.ReadFile(filepath.Join(dir, "manifest.json"))
+	if d.Manifest != fmt.Sprintf("sha256:%x", sha256.Sum256(manifest)) {
+		t.Errorf("unexpected manifest digest %s", d.Manifest)
+	}
+
+	// a blob modified after it was written is detected
+	if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("%x", sha256.Sum256([]byte("app layer")))), []byte("tampered"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := DirDigests(dir); err == nil {
+		t.Errorf("expected a tampered blob to be rejected")
+	}
+}
+
+func TestCompareImages(t *testing.T) {
+	recorded := ImageDigests{Manifest: "sha256:m1", Config: "sha256:c1", Layers: []string{"sha256:l1", "sha256:l2"}}
+
+	tests := []struct {
+		name      string
+		published ImageDigests
+		recorded  ImageDigests
+		want      []string
+	}{
+		{
+			name:      "same image",
+			published: recorded,
+			recorded:  recorded,
+		},
+		{
+			name:      "tag reused",
+			published: ImageDigests{Manifest: "sha256:m2", Config: "sha256:c2", Layers: []string{"sha256:l1", "sha256:l3"}},
+			recorded:  recorded,
+			want:      []string{"config", "layers", "layers", "manifest"},
+		},
+		{
+			name:      "layer swapped",
+			published: ImageDigests{Manifest: "sha256:m2", Config: "sha256:c1", Layers: []string{"sha256:l1", "sha256:l3"}},
+			recorded:  recorded,
+			want:      []string{"layers", "layers", "manifest"},
+		},
+		{
+			name:      "layers reordered",
+			published: ImageDigests{Manifest: "sha256:m1", Config: "sha256:c1", Layers: []string{"sha256:l2", "sha256:l1"}},
+			recorded:  recorded,
+			want:      []string{"layers"},
+		},
+		{
+			name:      "manifest rewritten",
+			published: ImageDigests{Manifest: "sha256:m2", Config: "sha256:c1", Layers: []string{"sha256:l1", "sha256:l2"}},
+			recorded:  recorded,
+			want:      []string{"manifest"},
+		},
+		{
+			name:      "unknown manifest",
+			published: ImageDigests{Manifest: "sha256:m2", Config: "sha256:c1", Layers: []string{"sha256:l1", "sha256:l2"}},
+			recorded:  ImageDigests{Config: "sha256:c1", Layers: []string{"sha256:l1", "sha256:l2"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := CompareImages(tt.published, tt.recorded)
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+			for i, d := range got {
+				if d.What != tt.want[i] {
+					t.Errorf("discrepancy %d is %s, want %s", i, d.What, tt.want[i])
+				}
+			}
+		})
+	}
+}
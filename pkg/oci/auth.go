@@ -0,0 +1,203 @@
+package oci
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/buildsafedev/bsf/pkg/toolchain"
+)
+
+// credentials returns the username and password stored for the registry by docker login or podman login,
+// asking the credential helper configured for the registry when there is one
+func credentials(registry string) (string, string) {
+	keys := []string{registry, "https://" + registry}
+	if registry == dockerHub {
+		keys = append(keys, "https://index.docker.io/v1/", "index.docker.io")
+	}
+
+	for _, path := range credentialFiles() {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+
+		conf := struct {
+			Auths map[string]struct {
+				Auth string `json:"auth"`
+			} `json:"auths"`
+			CredsStore  string            `json:"credsStore"`
+			CredHelpers map[string]string `json:"credHelpers"`
+		}{}
+		if err := json.Unmarshal(data, &conf); err != nil {
+			continue
+		}
+
+		for _, k := range keys {
+			helper, ok := conf.CredHelpers[k]
+			if !ok {
+				continue
+			}
+			if user, pass, err := helperCredentials(helper, k); err == nil {
+				return user, pass
+			}
+		}
+		if conf.CredsStore != "" {
+			for _, k := range keys {
+				if user, pass, err := helperCredentials(conf.CredsStore, k); err == nil {
+					return user, pass
+				}
+			}
+		}
+
+		for _, k := range keys {
+			auth, ok := conf.Auths[k]
+			if !ok {
+				continue
+			}
+			decoded, err := base64.StdEncoding.DecodeString(auth.Auth)
+			if err != nil {
+				continue
+			}
+			user, pass, ok := strings.Cut(string(decoded), ":")
+			if ok {
+				return user, pass
+			}
+		}
+	}
+	return "", ""
+}
+
+// helperCredentials asks the docker credential helper, e.g. docker-credential-ecr-login, for the credentials of server
+func helperCredentials(helper, server string) (string, string, error) {
+	cmd := toolchain.Check(exec.Command("docker-credential-"+helper, "get"))
+	cmd.Stdin = strings.NewReader(server)
+	out, err := cmd.Output()
+	if err != nil {
+		return "", "", fmt.Errorf("credential helper %s: %v", helper, err)
+	}
+
+	creds := struct {
+		Username string `json:"Username"`
+		Secret   string `json:"Secret"`
+	}{}
+	if err := json.Unmarshal(out, &creds); err != nil {
+		return "", "", fmt.Errorf("credential helper %s: %v", helper, err)
+	}
+	if creds.Secret == "" {
+		return "", "", fmt.Errorf("credential helper %s has no credentials for %s", helper, server)
+	}
+	return creds.Username, creds.Secret, nil
+}
+
+func credentialFiles() []string {
+	files := make([]string, 0)
+	if dir := os.Getenv("DOCKER_CONFIG"); dir != "" {
+		files = append(files, filepath.Join(dir, "config.json"))
+	}
+	if path := os.Getenv("REGISTRY_AUTH_FILE"); path != "" {
+		files = append(files, path)
+	}
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		files = append(files, filepath.Join(dir, "containers", "auth.json"))
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		files = append(files, filepath.Join(home, ".docker", "config.json"))
+	}
+	return files
+}
+
+// parseChallenge parses a WWW-Authenticate header such as
+// Bearer realm="https://auth.docker.io/token",service="registry.docker.io"
+func parseChallenge(header string) (string, map[string]string) {
+	scheme, rest, _ := strings.Cut(header, " ")
+	params := make(map[string]string)
+	for rest != "" {
+		var kv string
+		// values are quoted and may contain commas
+		key, after, ok := strings.Cut(rest, "=")
+		if !ok {
+			break
+		}
+		if strings.HasPrefix(after, `"`) {
+			end := strings.Index(after[1:], `"`)
+			if end < 0 {
+				break
+			}
+			kv = after[1 : end+1]
+			rest = strings.TrimLeft(after[end+2:], ", ")
+		} else {
+			kv, rest, _ = strings.Cut(after, ",")
+			rest = strings.TrimLeft(rest, " ")
+		}
+		params[strings.ToLower(strings.TrimSpace(key))] = kv
+	}
+	return strings.ToLower(scheme), params
+}
+
+// authorize answers the authentication challenge of the registry and returns the Authorization header to use
+func (c *Client) authorize(challenge string, ref *Reference) (string, error) {
+	user, pass := credentials(ref.Registry)
+
+	scheme, params := parseChallenge(challenge)
+	switch scheme {
+	case "basic":
+		if user == "" {
+			return "", fmt.Errorf("registry %s requires credentials, run docker login %s", ref.Registry, ref.Registry)
+		}
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(user+":"+pass)), nil
+	case "bearer":
+	default:
+		return "", fmt.Errorf("unsupported authentication scheme %q", scheme)
+	}
+
+	realm, err := url.Parse(params["realm"])
+	if err != nil || params["realm"] == "" {
+		return "", fmt.Errorf("invalid authentication realm %q", params["realm"])
+	}
+	q := realm.Query()
+	if params["service"] != "" {
+		q.Set("service", params["service"])
+	}
+	q.Set("scope", fmt.Sprintf("repository:%s:pull,push", ref.Repository))
+	// mounting a blob needs pull access to the repository it comes from
+	for _, repo := range c.mountRepositories(ref) {
+		q.Add("scope", fmt.Sprintf("repository:%s:pull", repo))
+	}
+	realm.RawQuery = q.Encode()
+
+	req, err := http.NewRequest(http.MethodGet, realm.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	if user != "" {
+		req.SetBasicAuth(user, pass)
+	}
+
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to get a registry token from %s: %s", realm.Host, resp.Status)
+	}
+
+	token := struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", err
+	}
+	if token.Token == "" {
+		token.Token = token.AccessToken
+	}
+	return "Bearer " + token.Token, nil
+}
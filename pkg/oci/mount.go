@@ -0,0 +1,154 @@
+package oci
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// maxIndexedRepositories limits how many repositories from the blob index are asked for pull access
+const maxIndexedRepositories = 10
+
+// blobIndexMu guards the blob index file, blobs are pushed concurrently
+var blobIndexMu sync.Mutex
+
+// blobIndex records which repositories of each registry bsf pushed blobs to, by digest
+type blobIndex map[string]map[string][]string
+
+func blobIndexPath() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "bsf", "blobs.json"), nil
+}
+
+func readBlobIndex() blobIndex {
+	index := make(blobIndex)
+	path, err := blobIndexPath()
+	if err != nil {
+		return index
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return index
+	}
+	json.Unmarshal(data, &index)
+	return index
+}
+
+// rememberBlob records that the repository has the blob, so later pushes to other repositories can mount it
+func rememberBlob(ref *Reference, digest string) {
+	blobIndexMu.Lock()
+	defer blobIndexMu.Unlock()
+
+	index := readBlobIndex()
+	if index[ref.Registry] == nil {
+		index[ref.Registry] = make(map[string][]string)
+	}
+	for _, repo := range index[ref.Registry][digest] {
+		if repo == ref.Repository {
+			return
+		}
+	}
+	index[ref.Registry][digest] = append(index[ref.Registry][digest], ref.Repository)
+
+	path, err := blobIndexPath()
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return
+	}
+	data, err := json.Marshal(index)
+	if err != nil {
+		return
+	}
+	os.WriteFile(path, data, 0600)
+}
+
+// mountCandidates returns the repositories that may have the blob, the ones it was pushed to before first
+func (c *Client) mountCandidates(ref *Reference, digest string) []string {
+	blobIndexMu.Lock()
+	index := readBlobIndex()
+	blobIndexMu.Unlock()
+
+	seen := map[string]bool{ref.Repository: true}
+	candidates := make([]string, 0)
+	for _, repo := range append(index[ref.Registry][digest], c.MountFrom...) {
+		if seen[repo] {
+			continue
+		}
+		seen[repo] = true
+		candidates = append(candidates, repo)
+	}
+	return candidates
+}
+
+// mountRepositories returns the repositories of the registry blobs may be mounted from
+func (c *Client) mountRepositories(ref *Reference) []string {
+	blobIndexMu.Lock()
+	index := readBlobIndex()
+	blobIndexMu.Unlock()
+
+	seen := map[string]bool{ref.Repository: true}
+	repos := make([]string, 0)
+	for _, repo := range c.MountFrom {
+		if !seen[repo] {
+			seen[repo] = true
+			repos = append(repos, repo)
+		}
+	}
+
+	indexed := make([]string, 0)
+	for _, rs := range index[ref.Registry] {
+		for _, repo := range rs {
+			if !seen[repo] {
+				seen[repo] = true
+				indexed = append(indexed, repo)
+			}
+		}
+	}
+	sort.Strings(indexed)
+	if len(indexed) > maxIndexedRepositories {
+		indexed = indexed[:maxIndexedRepositories]
+	}
+
+	return append(repos, indexed...)
+}
+
+// mountBlob asks the registry to mount the blob from another repository instead of uploading it.
+// When the registry can't, it opens an upload session instead and its location is returned.
+func (c *Client) mountBlob(ctx context.Context, ref *Reference, digest string) (bool, string, error) {
+	location := ""
+	for _, from := range c.mountCandidates(ref, digest) {
+		q := url.Values{}
+		q.Set("mount", digest)
+		q.Set("from", from)
+
+		resp, err := c.do(ctx, ref, http.MethodPost, c.baseURL(ref)+"/blobs/uploads/?"+q.Encode(), nil, nil)
+		if err != nil {
+			return false, "", err
+		}
+		resp.Body.Close()
+
+		switch resp.StatusCode {
+		case http.StatusCreated:
+			return true, "", nil
+		case http.StatusAccepted:
+			location, err = resolveLocation(resp)
+			if err != nil {
+				return false, "", err
+			}
+		default:
+			return false, "", fmt.Errorf("failed to mount blob from %s: %s", from, resp.Status)
+		}
+	}
+	return false, location, nil
+}
@@ -0,0 +1,86 @@
+package oci
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	bio "github.com/buildsafedev/bsf/pkg/io"
+)
+
+const (
+	// NARArtifactType is the artifact type of store paths pushed as artifacts
+	NARArtifactType = "application/vnd.bsf.nix.nar.v1"
+	// NARMediaType is the media type of the NAR serialisation of a store path
+	NARMediaType = "application/x-nix-nar"
+)
+
+// Annotations of store path artifacts, holding the fields of the narinfo of the store path
+const (
+	AnnotationStorePath  = "buildsafe.dev/nix.store-path"
+	AnnotationNarHash    = "buildsafe.dev/nix.nar-hash"
+	AnnotationNarSize    = "buildsafe.dev/nix.nar-size"
+	AnnotationReferences = "buildsafe.dev/nix.references"
+	AnnotationDeriver    = "buildsafe.dev/nix.deriver"
+)
+
+// NARInfo holds the narinfo fields of a store path pushed as an artifact
+type NARInfo struct {
+	StorePath string
+	// NarHash is the hash of the NAR as nix prints it, sha256:<nixbase32>
+	NarHash    string
+	NarSize    int64
+	References []string
+	Deriver    string
+}
+
+// Annotations returns the narinfo fields as annotations. References and the deriver are store path basenames,
+// like in narinfo files.
+func (n NARInfo) Annotations() map[string]string {
+	refs := make([]string, 0, len(n.References))
+	for _, r := range n.References {
+		refs = append(refs, path.Base(r))
+	}
+	annotations := map[string]string{
+		AnnotationStorePath:  n.StorePath,
+		AnnotationNarHash:    n.NarHash,
+		AnnotationNarSize:    strconv.FormatInt(n.NarSize, 10),
+		AnnotationReferences: strings.Join(refs, " "),
+	}
+	if n.Deriver != "" {
+		annotations[AnnotationDeriver] = path.Base(n.Deriver)
+	}
+	return annotations
+}
+
+// StorePathTag returns the tag a store path is pushed under when none is given: the hash part of its name,
+// so the registry is addressed like a binary cache
+func StorePathTag(storePath string) string {
+	hash, _, _ := strings.Cut(path.Base(storePath), "-")
+	return hash
+}
+
+// PushNAR pushes the NAR of a store path, read from narPath, as an artifact. The NAR is a blob whose digest is
+// the NAR hash of the store path, the manifest is annotated with the rest of the narinfo.
+func (c *Client) PushNAR(ctx context.Context, ref *Reference, narPath string, info NARInfo) (Descriptor, error) {
+	fi, err := os.Stat(narPath)
+	if err != nil {
+		return Descriptor{}, err
+	}
+	sum, err := bio.FileSHA256(narPath)
+	if err != nil {
+		return Descriptor{}, err
+	}
+	if info.NarSize != 0 && info.NarSize != fi.Size() {
+		return Descriptor{}, fmt.Errorf("NAR of %s is %d bytes, the narinfo says %d", info.StorePath, fi.Size(), info.NarSize)
+	}
+
+	l := layer{
+		Descriptor:  Descriptor{MediaType: NARMediaType, Digest: "sha256:" + sum, Size: fi.Size()},
+		Annotations: map[string]string{"org.opencontainers.image.title": path.Base(info.StorePath) + ".nar"},
+	}
+	return c.pushArtifact(ctx, ref, ref.Tag, NARArtifactType, l, narPath, nil, info.Annotations())
+}
@@ -0,0 +1,106 @@
+package oci
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	bio "github.com/buildsafedev/bsf/pkg/io"
+	"github.com/buildsafedev/bsf/pkg/shutdown"
+)
+
+// manifestMediaTypes are the single platform manifests PullDir accepts
+var manifestMediaTypes = []string{
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+}
+
+// PullDir pulls the image from the registry to dir in the dir: layout PushDir reads, so it can be mirrored to another
+// registry or verified without network access. It returns the digest of the manifest.
+func (c *Client) PullDir(ctx context.Context, ref *Reference, dir string) (string, error) {
+	header := http.Header{}
+	header.Set("Accept", strings.Join(manifestMediaTypes, ", "))
+	resp, err := c.do(ctx, ref, http.MethodGet, c.baseURL(ref)+"/manifests/"+ref.Tag, header, nil)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to pull manifest of %s: %s", ref, responseError(resp))
+	}
+	manifestData, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+
+	manifest := &imageManifest{}
+	if err := json.Unmarshal(manifestData, manifest); err != nil {
+		return "", fmt.Errorf("failed to parse manifest: %v", err)
+	}
+	if manifest.Config.Digest == "" {
+		return "", fmt.Errorf("%s is not a single platform image, image indexes are not supported", ref)
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	for _, b := range append([]blob{manifest.Config}, manifest.Layers...) {
+		if err := c.pullBlob(ctx, ref, b, dir); err != nil {
+			return "", fmt.Errorf("failed to pull %s: %v", b.Digest, err)
+		}
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "manifest.json"), manifestData, 0644); err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(manifestData)
+	return "sha256:" + hex.EncodeToString(sum[:]), nil
+}
+
+// pullBlob downloads the blob to dir/<hex digest>, checking its digest. Blobs already in dir are kept.
+func (c *Client) pullBlob(ctx context.Context, ref *Reference, b blob, dir string) error {
+	algo, hexDigest, ok := strings.Cut(b.Digest, ":")
+	if !ok || algo != "sha256" {
+		return fmt.Errorf("unsupported digest %s", b.Digest)
+	}
+	path := filepath.Join(dir, hexDigest)
+	if digest, err := bio.FileSHA256(path); err == nil && digest == hexDigest {
+		return nil
+	}
+
+	resp, err := c.do(ctx, ref, http.MethodGet, c.baseURL(ref)+"/blobs/"+b.Digest, nil, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET blob returned %s", responseError(resp))
+	}
+
+	tmp, err := os.CreateTemp(dir, ".blob-*")
+	if err != nil {
+		return err
+	}
+	defer shutdown.RemoveOnExit(tmp.Name())()
+	defer os.Remove(tmp.Name())
+
+	h := sha256.New()
+	_, err = io.Copy(io.MultiWriter(tmp, h), resp.Body)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	if got := hex.EncodeToString(h.Sum(nil)); got != hexDigest {
+		return fmt.Errorf("registry sent a blob with digest sha256:%s", got)
+	}
+	return os.Rename(tmp.Name(), path)
+}
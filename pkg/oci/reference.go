@@ -0,0 +1,66 @@
+package oci
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	dockerHub         = "docker.io"
+	dockerHubRegistry = "registry-1.docker.io"
+)
+
+// Reference is a parsed image reference such as ghcr.io/org/app:v1
+type Reference struct {
+	Registry   string
+	Repository string
+	Tag        string
+}
+
+// ParseReference parses an image name the way docker does: images without a registry are on Docker Hub,
+// official Docker Hub images are in the library namespace and the tag defaults to latest
+func ParseReference(name string) (*Reference, error) {
+	if name == "" {
+		return nil, fmt.Errorf("empty image reference")
+	}
+
+	ref := &Reference{Registry: dockerHub, Tag: "latest"}
+	rest := name
+	if i := strings.Index(name, "/"); i > 0 {
+		first := name[:i]
+		if strings.ContainsAny(first, ".:") || first == "localhost" {
+			ref.Registry = first
+			rest = name[i+1:]
+		}
+	}
+
+	if i := strings.Index(rest, "@"); i >= 0 {
+		return nil, fmt.Errorf("pushing to a digest reference is not supported: %s", name)
+	}
+	if i := strings.LastIndex(rest, ":"); i >= 0 {
+		ref.Tag = rest[i+1:]
+		rest = rest[:i]
+	}
+	if rest == "" || ref.Tag == "" {
+		return nil, fmt.Errorf("invalid image reference %s", name)
+	}
+	if ref.Registry == dockerHub && !strings.Contains(rest, "/") {
+		rest = "library/" + rest
+	}
+	ref.Repository = strings.ToLower(rest)
+
+	return ref, nil
+}
+
+// String returns the reference as registry/repository:tag
+func (r *Reference) String() string {
+	return r.Registry + "/" + r.Repository + ":" + r.Tag
+}
+
+// host returns the host serving the registry API
+func (r *Reference) host() string {
+	if r.Registry == dockerHub {
+		return dockerHubRegistry
+	}
+	return r.Registry
+}
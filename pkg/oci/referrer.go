@@ -0,0 +1,158 @@
+package oci
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// AttestationsArtifactType is the artifact type of the in-toto attestations bsf attaches to images
+	AttestationsArtifactType = "application/vnd.bsf.attestations.v1+jsonl"
+
+	imageManifestMediaType = "application/vnd.oci.image.manifest.v1+json"
+	imageIndexMediaType    = "application/vnd.oci.image.index.v1+json"
+	emptyMediaType         = "application/vnd.oci.empty.v1+json"
+)
+
+// Descriptor identifies a blob or a manifest by its digest
+type Descriptor struct {
+	MediaType string `json:"mediaType"`
+	Digest    string `json:"digest"`
+	Size      int64  `json:"size"`
+}
+
+// artifactManifest is an OCI 1.1 artifact manifest, referring to the manifest of an image when it has a subject
+type artifactManifest struct {
+	SchemaVersion int               `json:"schemaVersion"`
+	MediaType     string            `json:"mediaType"`
+	ArtifactType  string            `json:"artifactType"`
+	Config        Descriptor        `json:"config"`
+	Layers        []layer           `json:"layers"`
+	Subject       *Descriptor       `json:"subject,omitempty"`
+	Annotations   map[string]string `json:"annotations,omitempty"`
+}
+
+// layer is the descriptor of a layer of an artifact
+type layer struct {
+	Descriptor
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// DirManifest returns the descriptor of the manifest of the image in dir, the manifest PushDir pushes as is. It is
+// the image index of multi-platform images.
+func DirManifest(dir string) (Descriptor, error) {
+	data, err := os.ReadFile(filepath.Join(dir, "manifest.json"))
+	if err != nil {
+		return Descriptor{}, err
+	}
+	index := &imageIndex{}
+	if err := json.Unmarshal(data, index); err != nil {
+		return Descriptor{}, fmt.Errorf("failed to parse manifest: %v", err)
+	}
+	mediaType := index.MediaType
+	switch {
+	case mediaType != "":
+	case len(index.Manifests) > 0:
+		mediaType = imageIndexMediaType
+	default:
+		mediaType = imageManifestMediaType
+	}
+	return Descriptor{MediaType: mediaType, Digest: DigestOf(data), Size: int64(len(data))}, nil
+}
+
+// DirPlatforms returns the descriptors of the manifests of the platforms of the multi-platform image in dir by
+// os/arch, with the variant when there is one, e.g. linux/arm64/v8. It is empty for single platform images.
+func DirPlatforms(dir string) (map[string]Descriptor, error) {
+	data, err := os.ReadFile(filepath.Join(dir, "manifest.json"))
+	if err != nil {
+		return nil, err
+	}
+	index := &imageIndex{}
+	if err := json.Unmarshal(data, index); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest: %v", err)
+	}
+	platforms := make(map[string]Descriptor, len(index.Manifests))
+	for _, m := range index.Manifests {
+		if m.Platform == nil {
+			continue
+		}
+		platform := m.Platform.OS + "/" + m.Platform.Architecture
+		if m.Platform.Variant != "" {
+			platform += "/" + m.Platform.Variant
+		}
+		d := m.Descriptor
+		if d.MediaType == "" {
+			d.MediaType = imageManifestMediaType
+		}
+		platforms[platform] = d
+	}
+	return platforms, nil
+}
+
+// PushReferrer pushes data as an artifact referring to the subject manifest. Registries implementing the referrers
+// API list it with the subject, for the others it is tagged sha256-<hex of the subject digest>.<suffix>.
+func (c *Client) PushReferrer(ctx context.Context, ref *Reference, subject Descriptor, artifactType, mediaType, suffix string, data []byte, annotations map[string]string) (Descriptor, error) {
+	dir, err := os.MkdirTemp("", "bsf-referrer-")
+	if err != nil {
+		return Descriptor{}, err
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "data")
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return Descriptor{}, err
+	}
+	l := layer{Descriptor: Descriptor{MediaType: mediaType, Digest: DigestOf(data), Size: int64(len(data))}}
+	tag := strings.Replace(subject.Digest, ":", "-", 1) + "." + suffix
+	return c.pushArtifact(ctx, ref, tag, artifactType, l, path, &subject, annotations)
+}
+
+// pushArtifact pushes an artifact with an empty config and the single layer read from path under the tag
+func (c *Client) pushArtifact(ctx context.Context, ref *Reference, tag, artifactType string, l layer, path string, subject *Descriptor, annotations map[string]string) (Descriptor, error) {
+	config := []byte("{}")
+	configPath := path + ".config"
+	if err := os.WriteFile(configPath, config, 0600); err != nil {
+		return Descriptor{}, err
+	}
+	defer os.Remove(configPath)
+
+	configDesc := Descriptor{MediaType: emptyMediaType, Digest: DigestOf(config), Size: int64(len(config))}
+	for _, b := range []struct {
+		d    Descriptor
+		path string
+	}{{configDesc, configPath}, {l.Descriptor, path}} {
+		if err := c.pushBlob(ctx, ref, blob{Digest: b.d.Digest, Size: b.d.Size}, b.path); err != nil {
+			return Descriptor{}, fmt.Errorf("failed to push %s: %v", b.d.Digest, err)
+		}
+	}
+
+	manifest, err := json.Marshal(artifactManifest{
+		SchemaVersion: 2,
+		MediaType:     imageManifestMediaType,
+		ArtifactType:  artifactType,
+		Config:        configDesc,
+		Layers:        []layer{l},
+		Subject:       subject,
+		Annotations:   annotations,
+	})
+	if err != nil {
+		return Descriptor{}, err
+	}
+
+	tagged := *ref
+	tagged.Tag = tag
+	if err := c.putManifest(ctx, &tagged, imageManifestMediaType, manifest); err != nil {
+		return Descriptor{}, err
+	}
+	return Descriptor{MediaType: imageManifestMediaType, Digest: DigestOf(manifest), Size: int64(len(manifest))}, nil
+}
+
+// DigestOf returns the OCI digest of the data
+func DigestOf(data []byte) string {
+	return fmt.Sprintf("sha256:%x", sha256.Sum256(data))
+}
@@ -0,0 +1,358 @@
+package oci
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+const (
+	// DefaultChunkSize is the size of the chunks blobs are uploaded in
+	DefaultChunkSize = 64 << 20
+	// DefaultParallel is the number of blobs uploaded at the same time
+	DefaultParallel = 4
+	// DefaultRetries is the number of times a failed chunk is resumed before giving up
+	DefaultRetries = 5
+)
+
+// Client pushes images to registries implementing the OCI distribution API.
+// Blobs are uploaded in chunks, and an interrupted upload resumes from the last chunk the registry acknowledged,
+// even across runs.
+type Client struct {
+	HTTPClient *http.Client
+	ChunkSize  int64
+	Parallel   int
+	Retries    int
+	// Insecure uses plain HTTP, e.g. for a local registry
+	Insecure bool
+	// MountFrom are repositories of the same registry blobs are mounted from instead of uploaded, when they have them.
+	// Repositories bsf pushed the blob to before are tried as well.
+	MountFrom []string
+	// Progress is called with the digest and the number of bytes uploaded so far
+	Progress func(digest string, uploaded, size int64)
+
+	mu   sync.Mutex
+	auth string
+}
+
+// NewClient returns a client with the default chunk size, parallelism and retries
+func NewClient() *Client {
+	return &Client{
+		ChunkSize: DefaultChunkSize,
+		Parallel:  DefaultParallel,
+		Retries:   DefaultRetries,
+	}
+}
+
+func (c *Client) httpClient() *http.Client {
+	if c.HTTPClient != nil {
+		return c.HTTPClient
+	}
+	return http.DefaultClient
+}
+
+func (c *Client) baseURL(ref *Reference) string {
+	scheme := "https"
+	if c.Insecure {
+		scheme = "http"
+	}
+	return fmt.Sprintf("%s://%s/v2/%s", scheme, ref.host(), ref.Repository)
+}
+
+// do sends the request, authenticating with the registry when it asks to. body is resent on retries.
+func (c *Client) do(ctx context.Context, ref *Reference, method, url string, header http.Header, body []byte) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		c.mu.Lock()
+		if c.auth != "" {
+			req.Header.Set("Authorization", c.auth)
+		}
+		c.mu.Unlock()
+
+		resp, err := c.httpClient().Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusUnauthorized || attempt > 0 {
+			return resp, nil
+		}
+
+		challenge := resp.Header.Get("WWW-Authenticate")
+		resp.Body.Close()
+		auth, err := c.authorize(challenge, ref)
+		if err != nil {
+			return nil, err
+		}
+		c.mu.Lock()
+		c.auth = auth
+		c.mu.Unlock()
+	}
+}
+
+// blob is a blob referenced by the image manifest
+type blob struct {
+	Digest string `json:"digest"`
+	Size   int64  `json:"size"`
+}
+
+// imageManifest has the fields of docker and OCI manifests needed to push the image
+type imageManifest struct {
+	MediaType string `json:"mediaType"`
+	Config    blob   `json:"config"`
+	Layers    []blob `json:"layers"`
+}
+
+// imageIndex has the fields of OCI image indexes and docker manifest lists needed to push the image
+type imageIndex struct {
+	MediaType string          `json:"mediaType"`
+	Manifests []indexManifest `json:"manifests"`
+}
+
+// indexManifest is the descriptor of the manifest of a platform in an image index
+type indexManifest struct {
+	Descriptor
+	Platform *struct {
+		OS           string `json:"os"`
+		Architecture string `json:"architecture"`
+		Variant      string `json:"variant,omitempty"`
+	} `json:"platform,omitempty"`
+}
+
+// PushDir pushes the image in dir, as written by skopeo copy dir: or nix dockerTools, to the registry. The manifest
+// of a multi-platform image is an index, the manifests of its platforms are pushed by digest before it.
+func (c *Client) PushDir(ctx context.Context, dir string, ref *Reference) error {
+	manifestData, err := os.ReadFile(filepath.Join(dir, "manifest.json"))
+	if err != nil {
+		return err
+	}
+	index := &imageIndex{}
+	if err := json.Unmarshal(manifestData, index); err != nil {
+		return fmt.Errorf("failed to parse manifest: %v", err)
+	}
+	if len(index.Manifests) == 0 {
+		return c.pushManifest(ctx, dir, ref, ref.Tag, manifestData)
+	}
+
+	for _, m := range index.Manifests {
+		path, err := blobPath(dir, m.Digest)
+		if err != nil {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if err := c.pushManifest(ctx, dir, ref, m.Digest, data); err != nil {
+			return fmt.Errorf("failed to push the manifest %s of the index: %v", m.Digest, err)
+		}
+	}
+	mediaType := index.MediaType
+	if mediaType == "" {
+		mediaType = imageIndexMediaType
+	}
+	return c.putManifest(ctx, ref, mediaType, manifestData)
+}
+
+// pushManifest pushes the blobs of the image manifest read from dir, then the manifest under tag, a digest for the
+// manifests of an index
+func (c *Client) pushManifest(ctx context.Context, dir string, ref *Reference, tag string, manifestData []byte) error {
+	manifest := &imageManifest{}
+	if err := json.Unmarshal(manifestData, manifest); err != nil {
+		return fmt.Errorf("failed to parse manifest: %v", err)
+	}
+
+	blobs := append([]blob{manifest.Config}, manifest.Layers...)
+	parallel := c.Parallel
+	if parallel < 1 {
+		parallel = 1
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, parallel)
+	errs := make(chan error, len(blobs))
+	for _, b := range blobs {
+		wg.Add(1)
+		go func(b blob) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			path, err := blobPath(dir, b.Digest)
+			if err != nil {
+				errs <- err
+				cancel()
+				return
+			}
+			if err := c.pushBlob(ctx, ref, b, path); err != nil {
+				errs <- fmt.Errorf("failed to push %s: %v", b.Digest, err)
+				cancel()
+			}
+		}(b)
+	}
+	wg.Wait()
+	close(errs)
+	if err := <-errs; err != nil {
+		return err
+	}
+
+	tagged := *ref
+	tagged.Tag = tag
+	return c.putManifest(ctx, &tagged, manifest.MediaType, manifestData)
+}
+
+// blobPath finds the blob in the dir: layout, where blobs are named by their hex digest,
+// or in the OCI layout, where they are under blobs/<algorithm>/
+func blobPath(dir, digest string) (string, error) {
+	algo, hex, ok := strings.Cut(digest, ":")
+	if !ok {
+		return "", fmt.Errorf("invalid digest %s", digest)
+	}
+	for _, p := range []string{filepath.Join(dir, hex), filepath.Join(dir, "blobs", algo, hex)} {
+		if _, err := os.Stat(p); err == nil {
+			return p, nil
+		}
+	}
+	return "", fmt.Errorf("blob %s not found in %s", digest, dir)
+}
+
+// blobExists checks if the registry already has the blob
+func (c *Client) blobExists(ctx context.Context, ref *Reference, digest string) (bool, error) {
+	resp, err := c.do(ctx, ref, http.MethodHead, c.baseURL(ref)+"/blobs/"+digest, nil, nil)
+	if err != nil {
+		return false, err
+	}
+	resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	}
+	return false, fmt.Errorf("HEAD blob returned %s", resp.Status)
+}
+
+// ManifestDigest returns the digest of the manifest the tag of ref points to, empty when the tag doesn't exist
+func (c *Client) ManifestDigest(ctx context.Context, ref *Reference) (string, error) {
+	header := http.Header{}
+	header.Set("Accept", strings.Join(append(manifestMediaTypes,
+		"application/vnd.oci.image.index.v1+json",
+		"application/vnd.docker.distribution.manifest.list.v2+json"), ", "))
+	resp, err := c.do(ctx, ref, http.MethodHead, c.baseURL(ref)+"/manifests/"+ref.Tag, header, nil)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusNotFound:
+		return "", nil
+	case http.StatusOK:
+	default:
+		return "", fmt.Errorf("HEAD manifest returned %s", resp.Status)
+	}
+	if digest := resp.Header.Get("Docker-Content-Digest"); digest != "" {
+		return digest, nil
+	}
+
+	// the digest header is optional, the manifest has to be fetched to compute it
+	resp, err = c.do(ctx, ref, http.MethodGet, c.baseURL(ref)+"/manifests/"+ref.Tag, header, nil)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to get manifest of %s: %s", ref, responseError(resp))
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	return DigestOf(data), nil
+}
+
+// DeleteTag deletes the tag of ref from the registry, which must point to digest. Registries that can't delete tags,
+// only manifests, get the manifest deleted by digest, which also deletes the other tags of the image. A tag that no
+// longer exists isn't an error.
+func (c *Client) DeleteTag(ctx context.Context, ref *Reference, digest string) error {
+	resp, err := c.do(ctx, ref, http.MethodDelete, c.baseURL(ref)+"/manifests/"+ref.Tag, nil, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusAccepted, http.StatusOK, http.StatusNotFound:
+		return nil
+	// the distribution spec only requires deleting manifests, tags are refused as an unsupported operation
+	case http.StatusBadRequest, http.StatusMethodNotAllowed:
+	default:
+		return fmt.Errorf("failed to delete tag %s: %s", ref, responseError(resp))
+	}
+
+	current, err := c.ManifestDigest(ctx, ref)
+	if err != nil {
+		return err
+	}
+	if current == "" {
+		return nil
+	}
+	if current != digest {
+		return fmt.Errorf("tag %s was moved to %s, it isn't deleted", ref, current)
+	}
+	resp, err = c.do(ctx, ref, http.MethodDelete, c.baseURL(ref)+"/manifests/"+digest, nil, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusAccepted, http.StatusOK, http.StatusNotFound:
+		return nil
+	}
+	return fmt.Errorf("failed to delete manifest %s of %s: %s", digest, ref, responseError(resp))
+}
+
+func (c *Client) putManifest(ctx context.Context, ref *Reference, mediaType string, data []byte) error {
+	if mediaType == "" {
+		mediaType = "application/vnd.oci.image.manifest.v1+json"
+	}
+	header := http.Header{}
+	header.Set("Content-Type", mediaType)
+
+	resp, err := c.do(ctx, ref, http.MethodPut, c.baseURL(ref)+"/manifests/"+ref.Tag, header, data)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to push manifest: %s", responseError(resp))
+	}
+	return nil
+}
+
+// responseError returns the status and the error message of the registry
+func responseError(resp *http.Response) string {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	msg := strings.TrimSpace(string(body))
+	if msg == "" {
+		return resp.Status
+	}
+	return resp.Status + ": " + msg
+}
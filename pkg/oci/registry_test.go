@@ -0,0 +1,649 @@
+package oci
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeRegistry is a registry that fails chosen PATCH requests and requires a bearer token
+type fakeRegistry struct {
+	mu        sync.Mutex
+	uploads   map[string][]byte
+	blobs     map[string][]byte
+	manifests map[string][]byte
+	patches   int
+	// failPatch lists the PATCH requests (counted from 1) that fail without storing anything
+	failPatch   map[int]bool
+	patchedSize int
+	mounts      int
+	nextID      int
+	// noTagDelete refuses to delete tags, only manifests by digest
+	noTagDelete bool
+}
+
+func newFakeRegistry() *fakeRegistry {
+	return &fakeRegistry{
+		uploads:   make(map[string][]byte),
+		blobs:     make(map[string][]byte),
+		manifests: make(map[string][]byte),
+		failPatch: make(map[int]bool),
+	}
+}
+
+func (f *fakeRegistry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/token" {
+		fmt.Fprint(w, `{"token":"secret"}`)
+		return
+	}
+	if r.Header.Get("Authorization") != "Bearer secret" {
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="http://%s/token",service="fake"`, r.Host))
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	// blobs are stored per repository, as repository@digest
+	repo, path, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/v2/"), "/")
+	switch {
+	case r.Method == http.MethodHead && strings.HasPrefix(path, "blobs/sha256:"):
+		if _, ok := f.blobs[repo+"@"+strings.TrimPrefix(path, "blobs/")]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	case r.Method == http.MethodPost && path == "blobs/uploads/":
+		mount := r.URL.Query().Get("mount")
+		if data, ok := f.blobs[r.URL.Query().Get("from")+"@"+mount]; ok && mount != "" {
+			f.mounts++
+			f.blobs[repo+"@"+mount] = data
+			w.WriteHeader(http.StatusCreated)
+			return
+		}
+		f.nextID++
+		id := strconv.Itoa(f.nextID)
+		f.uploads[id] = nil
+		w.Header().Set("Location", "/v2/"+repo+"/blobs/uploads/"+id)
+		w.WriteHeader(http.StatusAccepted)
+	case strings.HasPrefix(path, "blobs/uploads/"):
+		id := strings.TrimPrefix(path, "blobs/uploads/")
+		data, ok := f.uploads[id]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		switch r.Method {
+		case http.MethodPatch:
+			f.patches++
+			if f.failPatch[f.patches] {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			start, _ := strconv.Atoi(strings.Split(r.Header.Get("Content-Range"), "-")[0])
+			if start != len(data) {
+				w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+				return
+			}
+			body, _ := io.ReadAll(r.Body)
+			f.patchedSize += len(body)
+			f.uploads[id] = append(data, body...)
+			w.Header().Set("Location", "/v2/"+repo+"/blobs/uploads/"+id)
+			w.Header().Set("Range", fmt.Sprintf("0-%d", len(f.uploads[id])-1))
+			w.WriteHeader(http.StatusAccepted)
+		case http.MethodGet:
+			w.Header().Set("Range", fmt.Sprintf("0-%d", len(data)-1))
+			w.WriteHeader(http.StatusNoContent)
+		case http.MethodPut:
+			digest := r.URL.Query().Get("digest")
+			if digest != fmt.Sprintf("sha256:%x", sha256.Sum256(data)) {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			f.blobs[repo+"@"+digest] = data
+			delete(f.uploads, id)
+			w.WriteHeader(http.StatusCreated)
+		}
+	case r.Method == http.MethodGet && strings.HasPrefix(path, "blobs/sha256:"):
+		data, ok := f.blobs[repo+"@"+strings.TrimPrefix(path, "blobs/")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write(data)
+	case r.Method == http.MethodHead && strings.HasPrefix(path, "manifests/"):
+		if _, ok := f.manifests[strings.TrimPrefix(path, "manifests/")]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	case r.Method == http.MethodGet && strings.HasPrefix(path, "manifests/"):
+		data, ok := f.manifests[strings.TrimPrefix(path, "manifests/")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write(data)
+	case r.Method == http.MethodPut && strings.HasPrefix(path, "manifests/"):
+		body, _ := io.ReadAll(r.Body)
+		f.manifests[strings.TrimPrefix(path, "manifests/")] = body
+		w.WriteHeader(http.StatusCreated)
+	case r.Method == http.MethodDelete && strings.HasPrefix(path, "manifests/sha256:"):
+		// deleting a manifest deletes the tags pointing to it
+		digest := strings.TrimPrefix(path, "manifests/")
+		for tag, data := range f.manifests {
+			if DigestOf(data) == digest {
+				delete(f.manifests, tag)
+			}
+		}
+		w.WriteHeader(http.StatusAccepted)
+	case r.Method == http.MethodDelete && strings.HasPrefix(path, "manifests/"):
+		tag := strings.TrimPrefix(path, "manifests/")
+		switch _, ok := f.manifests[tag]; {
+		case f.noTagDelete:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		case !ok:
+			w.WriteHeader(http.StatusNotFound)
+		default:
+			delete(f.manifests, tag)
+			w.WriteHeader(http.StatusAccepted)
+		}
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// writeImageDir writes an image in the dir: layout with a config and one layer
+func writeImageDir(t *testing.T, layer []byte) string {
+	t.Helper()
+	dir := t.TempDir()
+	config := []byte(`{"architecture":"amd64","os":"linux"}`)
+
+	blobs := make([]string, 0, 2)
+	for _, b := range [][]byte{config, layer} {
+		hex := fmt.Sprintf("%x", sha256.Sum256(b))
+		if err := os.WriteFile(filepath.Join(dir, hex), b, 0644); err != nil {
+			t.Fatal(err)
+		}
+		blobs = append(blobs, fmt.Sprintf(`{"mediaType":"application/vnd.oci.image.layer.v1.tar","digest":"sha256:%s","size":%d}`, hex, len(b)))
+	}
+	manifest := fmt.Sprintf(`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json","config":%s,"layers":[%s]}`, blobs[0], blobs[1])
+	if err := os.WriteFile(filepath.Join(dir, "manifest.json"), []byte(manifest), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestPushDirResumes(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("DOCKER_CONFIG", t.TempDir())
+
+	registry := newFakeRegistry()
+	srv := httptest.NewServer(registry)
+	defer srv.Close()
+
+	layer := []byte(strings.Repeat("layer data ", 100))
+	dir := writeImageDir(t, layer)
+	ref := &Reference{Registry: strings.TrimPrefix(srv.URL, "http://"), Repository: "app", Tag: "v1"}
+
+	c := &Client{ChunkSize: 256, Parallel: 1, Insecure: true}
+	// the config is uploaded in one chunk, the third chunk of the layer fails and there are no retries
+	registry.failPatch[4] = true
+	if err := c.PushDir(context.Background(), dir, ref); err == nil {
+		t.Fatalf("expected the push to fail")
+	}
+
+	// a new run resumes the layer where the registry stopped
+	c.Retries = 1
+	registry.failPatch[6] = true
+	if err := c.PushDir(context.Background(), dir, ref); err != nil {
+		t.Fatal(err)
+	}
+
+	digest := fmt.Sprintf("sha256:%x", sha256.Sum256(layer))
+	if string(registry.blobs["app@"+digest]) != string(layer) {
+		t.Errorf("layer was not pushed correctly")
+	}
+	if _, ok := registry.manifests["v1"]; !ok {
+		t.Errorf("manifest was not pushed")
+	}
+	config := 37
+	if registry.patchedSize != len(layer)+config {
+		t.Errorf("uploaded %d bytes, expected each byte once (%d)", registry.patchedSize, len(layer)+config)
+	}
+}
+
+func TestPushDirMounts(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("DOCKER_CONFIG", t.TempDir())
+
+	registry := newFakeRegistry()
+	srv := httptest.NewServer(registry)
+	defer srv.Close()
+	host := strings.TrimPrefix(srv.URL, "http://")
+
+	dir := writeImageDir(t, []byte("base layer"))
+	c := &Client{ChunkSize: 256, Parallel: 2, Insecure: true}
+	if err := c.PushDir(context.Background(), dir, &Reference{Registry: host, Repository: "base", Tag: "v1"}); err != nil {
+		t.Fatal(err)
+	}
+	uploaded := registry.patchedSize
+
+	// the blobs were pushed to base by bsf, the index knows where to mount them from
+	if err := c.PushDir(context.Background(), dir, &Reference{Registry: host, Repository: "app", Tag: "v1"}); err != nil {
+		t.Fatal(err)
+	}
+	if registry.mounts != 2 || registry.patchedSize != uploaded {
+		t.Errorf("expected both blobs to be mounted, got %d mounts and %d bytes uploaded", registry.mounts, registry.patchedSize-uploaded)
+	}
+
+	// without the index, repositories passed explicitly are tried
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	c.MountFrom = []string{"unknown", "base"}
+	if err := c.PushDir(context.Background(), dir, &Reference{Registry: host, Repository: "other", Tag: "v1"}); err != nil {
+		t.Fatal(err)
+	}
+	if registry.mounts != 4 || registry.patchedSize != uploaded {
+		t.Errorf("expected blobs to be mounted from base, got %d mounts and %d bytes uploaded", registry.mounts, registry.patchedSize-uploaded)
+	}
+}
+
+func TestPullDir(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("DOCKER_CONFIG", t.TempDir())
+
+	registry := newFakeRegistry()
+	srv := httptest.NewServer(registry)
+	defer srv.Close()
+
+	dir := writeImageDir(t, []byte("app layer"))
+	ref := &Reference{Registry: strings.TrimPrefix(srv.URL, "http://"), Repository: "app", Tag: "v1"}
+	c := &Client{ChunkSize: 256, Parallel: 1, Insecure: true}
+	if err := c.PushDir(context.Background(), dir, ref); err != nil {
+		t.Fatal(err)
+	}
+
+	pulled := t.TempDir()
+	digest, err := c.PullDir(context.Background(), ref, pulled)
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifest, _ := os.ReadFile(filepath.Join(dir, "manifest.json"))
+	if digest != fmt.Sprintf("sha256:%x", sha256.Sum256(manifest)) {
+		t.Errorf("unexpected manifest digest %s", digest)
+	}
+	layer, err := os.ReadFile(filepath.Join(pulled, fmt.Sprintf("%x", sha256.Sum256([]byte("app layer")))))
+	if err != nil || string(layer) != "app layer" {
+		t.Errorf("layer was not pulled: %q %v", layer, err)
+	}
+
+	// a registry serving tampered blobs is detected
+	for k := range registry.blobs {
+		registry.blobs[k] = []byte("tampered")
+	}
+	if _, err := c.PullDir(context.Background(), ref, t.TempDir()); err == nil {
+		t.Errorf("expected a tampered blob to be rejected")
+	}
+}
+
+func TestPushReferrer(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("DOCKER_CONFIG", t.TempDir())
+
+	registry := newFakeRegistry()
+	srv := httptest.NewServer(registry)
+	defer srv.Close()
+
+	dir := writeImageDir(t, []byte("app layer"))
+	ref := &Reference{Registry: strings.TrimPrefix(srv.URL, "http://"), Repository: "app", Tag: "v1"}
+	c := &Client{ChunkSize: 256, Parallel: 1, Insecure: true}
+	if err := c.PushDir(context.Background(), dir, ref); err != nil {
+		t.Fatal(err)
+	}
+	subject, err := DirManifest(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	attestations := []byte(`{"_type":"https://in-toto.io/Statement/v1"}` + "\n")
+	if _, err := c.PushReferrer(context.Background(), ref, subject, AttestationsArtifactType, "application/vnd.in-toto+jsonl", "att", attestations, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	data, ok := registry.manifests[strings.Replace(subject.Digest, ":", "-", 1)+".att"]
+	if !ok {
+		t.Fatalf("the referrer was not tagged after its subject")
+	}
+	manifest := &artifactManifest{}
+	if err := json.Unmarshal(data, manifest); err != nil {
+		t.Fatal(err)
+	}
+	if manifest.Subject == nil || *manifest.Subject != subject {
+		t.Errorf("subject = %+v, want %+v", manifest.Subject, subject)
+	}
+	if len(manifest.Layers) != 1 || string(registry.blobs["app@"+manifest.Layers[0].Digest]) != string(attestations) {
+		t.Errorf("the attestations were not pushed as the layer of the referrer")
+	}
+}
+
+func TestPushDirIndex(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("DOCKER_CONFIG", t.TempDir())
+
+	registry := newFakeRegistry()
+	srv := httptest.NewServer(registry)
+	defer srv.Close()
+
+	// the index lists the manifests of two single platform images, stored as blobs of the directory
+	dir := t.TempDir()
+	manifests := make([]string, 0, 2)
+	for _, p := range []struct{ arch, variant, layer string }{{"amd64", "", "amd64 layer"}, {"arm64", "v8", "arm64 layer"}} {
+		image := writeImageDir(t, []byte(p.layer))
+		entries, err := os.ReadDir(image)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, e := range entries {
+			data, err := os.ReadFile(filepath.Join(image, e.Name()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			name := e.Name()
+			if name == "manifest.json" {
+				name = fmt.Sprintf("%x", sha256.Sum256(data))
+				manifests = append(manifests, fmt.Sprintf(`{"mediaType":"application/vnd.oci.image.manifest.v1+json","digest":"sha256:%s","size":%d,"platform":{"os":"linux","architecture":"%s","variant":"%s"}}`,
+					name, len(data), p.arch, p.variant))
+			}
+			if err := os.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	index := fmt.Sprintf(`{"schemaVersion":2,"manifests":[%s]}`, strings.Join(manifests, ","))
+	if err := os.WriteFile(filepath.Join(dir, "manifest.json"), []byte(index), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ref := &Reference{Registry: strings.TrimPrefix(srv.URL, "http://"), Repository: "app", Tag: "v1"}
+	c := &Client{ChunkSize: 256, Parallel: 1, Insecure: true}
+	if err := c.PushDir(context.Background(), dir, ref); err != nil {
+		t.Fatal(err)
+	}
+
+	subject, err := DirManifest(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if subject.MediaType != imageIndexMediaType || string(registry.manifests["v1"]) != index {
+		t.Errorf("the index was not pushed under the tag as %s, got %s", imageIndexMediaType, subject.MediaType)
+	}
+	platforms, err := DirPlatforms(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(platforms) != 2 {
+		t.Fatalf("DirPlatforms() = %v, want linux/amd64 and linux/arm64/v8", platforms)
+	}
+	for platform, layer := range map[string]string{"linux/amd64": "amd64 layer", "linux/arm64/v8": "arm64 layer"} {
+		d, ok := platforms[platform]
+		if !ok {
+			t.Fatalf("platform %s is missing from %v", platform, platforms)
+		}
+		if _, ok := registry.manifests[d.Digest]; !ok {
+			t.Errorf("the manifest of %s was not pushed by digest", platform)
+		}
+		if _, ok := registry.blobs[fmt.Sprintf("app@sha256:%x", sha256.Sum256([]byte(layer)))]; !ok {
+			t.Errorf("the layer of %s was not pushed", platform)
+		}
+	}
+
+	if platforms, err := DirPlatforms(writeImageDir(t, []byte("app layer"))); err != nil || len(platforms) != 0 {
+		t.Errorf("DirPlatforms() of a single platform image = %v, %v", platforms, err)
+	}
+}
+
+func TestPushNAR(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("DOCKER_CONFIG", t.TempDir())
+
+	registry := newFakeRegistry()
+	srv := httptest.NewServer(registry)
+	defer srv.Close()
+
+	nar := []byte("nix-archive-1 (type regular contents hello)")
+	narPath := filepath.Join(t.TempDir(), "hello.nar")
+	if err := os.WriteFile(narPath, nar, 0644); err != nil {
+		t.Fatal(err)
+	}
+	info := NARInfo{
+		StorePath:  "/nix/store/0c9rf6rgcfd5j9b9wgzcm4cfdpi8wq5f-hello-2.12.1",
+		NarHash:    "sha256:1b8m03r63zqhnjf7l5wnldhh7c134ap5vpj0850ymkq1iyzicy5s",
+		NarSize:    int64(len(nar)),
+		References: []string{"/nix/store/vnwdak3n1w2jjil119j65k8mw1z23p84-glibc-2.35-224"},
+	}
+	ref := &Reference{Registry: strings.TrimPrefix(srv.URL, "http://"), Repository: "cache", Tag: StorePathTag(info.StorePath)}
+	c := &Client{ChunkSize: 256, Parallel: 1, Insecure: true}
+	if _, err := c.PushNAR(context.Background(), ref, narPath, info); err != nil {
+		t.Fatal(err)
+	}
+
+	data, ok := registry.manifests["0c9rf6rgcfd5j9b9wgzcm4cfdpi8wq5f"]
+	if !ok {
+		t.Fatalf("the artifact was not tagged with the hash of the store path")
+	}
+	manifest := &artifactManifest{}
+	if err := json.Unmarshal(data, manifest); err != nil {
+		t.Fatal(err)
+	}
+	if manifest.ArtifactType != NARArtifactType || manifest.Subject != nil {
+		t.Errorf("unexpected artifact type %s or subject %v", manifest.ArtifactType, manifest.Subject)
+	}
+	if manifest.Annotations[AnnotationReferences] != "vnwdak3n1w2jjil119j65k8mw1z23p84-glibc-2.35-224" || manifest.Annotations[AnnotationNarHash] != info.NarHash {
+		t.Errorf("unexpected annotations %v", manifest.Annotations)
+	}
+	if len(manifest.Layers) != 1 || string(registry.blobs["cache@"+manifest.Layers[0].Digest]) != string(nar) {
+		t.Errorf("the NAR was not pushed as the layer of the artifact")
+	}
+
+	info.NarSize++
+	if _, err := c.PushNAR(context.Background(), ref, narPath, info); err == nil {
+		t.Errorf("expected a NAR of the wrong size to be rejected")
+	}
+}
+
+func TestManifestDigest(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("DOCKER_CONFIG", t.TempDir())
+
+	registry := newFakeRegistry()
+	srv := httptest.NewServer(registry)
+	defer srv.Close()
+
+	ref := &Reference{Registry: strings.TrimPrefix(srv.URL, "http://"), Repository: "app", Tag: "v1"}
+	c := &Client{ChunkSize: 256, Parallel: 1, Insecure: true}
+	digest, err := c.ManifestDigest(context.Background(), ref)
+	if err != nil || digest != "" {
+		t.Fatalf("ManifestDigest() of a missing tag = %q, %v", digest, err)
+	}
+
+	dir := writeImageDir(t, []byte("app layer"))
+	if err := c.PushDir(context.Background(), dir, ref); err != nil {
+		t.Fatal(err)
+	}
+	want, err := DirManifest(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the fake registry doesn't send Docker-Content-Digest, the manifest is hashed
+	if digest, err = c.ManifestDigest(context.Background(), ref); err != nil || digest != want.Digest {
+		t.Errorf("ManifestDigest() = %q, %v, want %s", digest, err, want.Digest)
+	}
+}
+
+func TestDeleteTag(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("DOCKER_CONFIG", t.TempDir())
+
+	tests := []struct {
+		name        string
+		noTagDelete bool
+		moved       bool
+		wantErr     bool
+		wantTags    []string
+	}{
+		{name: "tag deleted", wantTags: []string{"latest"}},
+		{name: "manifest deleted by digest", noTagDelete: true, wantTags: []string{}},
+		{name: "tag moved", noTagDelete: true, moved: true, wantErr: true, wantTags: []string{"latest", "v1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			registry := newFakeRegistry()
+			registry.noTagDelete = tt.noTagDelete
+			srv := httptest.NewServer(registry)
+			defer srv.Close()
+
+			c := &Client{ChunkSize: 256, Parallel: 1, Insecure: true}
+			host := strings.TrimPrefix(srv.URL, "http://")
+			dir := writeImageDir(t, []byte("app layer"))
+			for _, tag := range []string{"v1", "latest"} {
+				if err := c.PushDir(context.Background(), dir, &Reference{Registry: host, Repository: "app", Tag: tag}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			m, err := DirManifest(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			digest := m.Digest
+			if tt.moved {
+				digest = "sha256:" + strings.Repeat("0", 64)
+			}
+
+			err = c.DeleteTag(context.Background(), &Reference{Registry: host, Repository: "app", Tag: "v1"}, digest)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("DeleteTag() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			tags := make([]string, 0)
+			for tag := range registry.manifests {
+				tags = append(tags, tag)
+			}
+			sort.Strings(tags)
+			if strings.Join(tags, " ") != strings.Join(tt.wantTags, " ") {
+				t.Errorf("tags left = %v, want %v", tags, tt.wantTags)
+			}
+			// deleting a deleted tag isn't an error
+			if !tt.wantErr {
+				if err := c.DeleteTag(context.Background(), &Reference{Registry: host, Repository: "app", Tag: "v1"}, digest); err != nil {
+					t.Errorf("DeleteTag() of a deleted tag: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestExpandTags(t *testing.T) {
+	data := TagData{Tag: "v1", Version: "1.2.0+build.3", GitSHA: "8f3c2a1", Date: "20261015", Channel: "stable"}
+	tests := []struct {
+		name      string
+		templates []string
+		want      []string
+		wantErr   bool
+	}{
+		{name: "placeholders", templates: []string{"{version}", "{channel}-{date}-{gitsha}", "latest"}, want: []string{"1.2.0_build.3", "stable-20261015-8f3c2a1", "latest"}},
+		{name: "duplicate template", templates: []string{"{tag}", "{tag}"}, want: []string{"v1"}},
+		{name: "collision", templates: []string{"{tag}", "v1"}, wantErr: true},
+		{name: "unknown placeholder", templates: []string{"{branch}"}, wantErr: true},
+		{name: "no value", templates: []string{"{channel}"}, wantErr: true},
+		{name: "invalid tag", templates: []string{".{tag}"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := data
+			if tt.name == "no value" {
+				d.Channel = ""
+			}
+			got, err := ExpandTags(tt.templates, d)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ExpandTags() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("ExpandTags() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseReference(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Reference
+	}{
+		{"caddy", Reference{Registry: "docker.io", Repository: "library/caddy", Tag: "latest"}},
+		{"org/app:v1", Reference{Registry: "docker.io", Repository: "org/app", Tag: "v1"}},
+		{"ghcr.io/Org/app:1.0", Reference{Registry: "ghcr.io", Repository: "org/app", Tag: "1.0"}},
+		{"localhost:5000/app", Reference{Registry: "localhost:5000", Repository: "app", Tag: "latest"}},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseReference(tt.in)
+		if err != nil {
+			t.Errorf("ParseReference(%q) failed: %v", tt.in, err)
+			continue
+		}
+		if *got != tt.want {
+			t.Errorf("ParseReference(%q) = %+v, want %+v", tt.in, *got, tt.want)
+		}
+	}
+}
+
+func TestParseChallenge(t *testing.T) {
+	scheme, params := parseChallenge(`Bearer realm="https://auth.docker.io/token",service="registry.docker.io",scope="repository:a/b:pull,push"`)
+	if scheme != "bearer" || params["realm"] != "https://auth.docker.io/token" || params["scope"] != "repository:a/b:pull,push" {
+		t.Errorf("unexpected challenge %s %v", scheme, params)
+	}
+}
+
+func TestCredentialHelpers(t *testing.T) {
+	dir := t.TempDir()
+	helper := "#!/bin/sh\nread server\necho '{\"ServerURL\":\"'$server'\",\"Username\":\"AWS\",\"Secret\":\"token-'$server'\"}'\n"
+	if err := os.WriteFile(filepath.Join(dir, "docker-credential-fake"), []byte(helper), 0755); err != nil {
+		t.Fatal(err)
+	}
+	conf := `{
+		"auths": {"ghcr.io": {"auth": "dXNlcjpwYXNz"}, "123.dkr.ecr.us-east-1.amazonaws.com": {}},
+		"credHelpers": {"123.dkr.ecr.us-east-1.amazonaws.com": "fake"}
+	}`
+	if err := os.WriteFile(filepath.Join(dir, "config.json"), []byte(conf), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	t.Setenv("DOCKER_CONFIG", dir)
+	t.Setenv("HOME", dir)
+	t.Setenv("REGISTRY_AUTH_FILE", "")
+	t.Setenv("XDG_RUNTIME_DIR", "")
+
+	if user, pass := credentials("123.dkr.ecr.us-east-1.amazonaws.com"); user != "AWS" || pass != "token-123.dkr.ecr.us-east-1.amazonaws.com" {
+		t.Errorf("credentials of the helper = %q, %q", user, pass)
+	}
+	if user, pass := credentials("ghcr.io"); user != "user" || pass != "pass" {
+		t.Errorf("credentials of auths = %q, %q", user, pass)
+	}
+
+	// a credential store answers for every registry
+	conf = `{"credsStore": "fake"}`
+	if err := os.WriteFile(filepath.Join(dir, "config.json"), []byte(conf), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if user, pass := credentials("registry.example.com"); user != "AWS" || pass != "token-registry.example.com" {
+		t.Errorf("credentials of the store = %q, %q", user, pass)
+	}
+}
@@ -0,0 +1,80 @@
+package oci
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// TagData is the build metadata tag templates are evaluated from
+type TagData struct {
+	// Tag is the tag of the image name in bsf.hcl
+	Tag string
+	// Version is the version of the app
+	Version string
+	// GitSHA is the abbreviated hash of the commit the image was built from
+	GitSHA string
+	// Date is the UTC date of the push, as YYYYMMDD
+	Date string
+	// Channel is the release channel, e.g. stable or nightly
+	Channel string
+}
+
+var (
+	placeholder = regexp.MustCompile(`\{[^{}]*\}`)
+	validTag    = regexp.MustCompile(`^[a-zA-Z0-9_][a-zA-Z0-9._-]{0,127}$`)
+)
+
+// ExpandTag replaces the {tag}, {version}, {gitsha}, {date} and {channel} placeholders of the template.
+// Unknown placeholders, placeholders without a value and results that aren't valid tags are errors.
+func ExpandTag(template string, data TagData) (string, error) {
+	values := map[string]string{
+		"{tag}":     data.Tag,
+		"{version}": data.Version,
+		"{gitsha}":  data.GitSHA,
+		"{date}":    data.Date,
+		"{channel}": data.Channel,
+	}
+
+	var err error
+	tag := placeholder.ReplaceAllStringFunc(template, func(p string) string {
+		v, ok := values[p]
+		if !ok && err == nil {
+			err = fmt.Errorf("unknown placeholder %s in tag %s", p, template)
+		} else if v == "" && err == nil {
+			err = fmt.Errorf("no value for %s in tag %s", p, template)
+		}
+		return v
+	})
+	if err != nil {
+		return "", err
+	}
+	// versions such as 1.2.3+build are common, + isn't allowed in tags
+	tag = strings.ReplaceAll(tag, "+", "_")
+	if !validTag.MatchString(tag) {
+		return "", fmt.Errorf("tag %s evaluates to %q, which isn't a valid tag", template, tag)
+	}
+	return tag, nil
+}
+
+// ExpandTags evaluates the tag templates. Two templates evaluating to the same tag are a collision and an error,
+// one of them would silently be lost.
+func ExpandTags(templates []string, data TagData) ([]string, error) {
+	tags := make([]string, 0, len(templates))
+	from := make(map[string]string, len(templates))
+	for _, t := range templates {
+		tag, err := ExpandTag(t, data)
+		if err != nil {
+			return nil, err
+		}
+		if other, ok := from[tag]; ok {
+			if other == t {
+				continue
+			}
+			return nil, fmt.Errorf("tags %s and %s both evaluate to %s", other, t, tag)
+		}
+		from[tag] = t
+		tags = append(tags, tag)
+	}
+	return tags, nil
+}
@@ -0,0 +1,278 @@
+package oci
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// uploadState is an upload session that was interrupted, saved so the next push can resume it
+type uploadState struct {
+	Location string `json:"location"`
+	Offset   int64  `json:"offset"`
+}
+
+func statePath(ref *Reference, digest string) (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	name := fmt.Sprintf("%x.json", sha256.Sum256([]byte(ref.Registry+"/"+ref.Repository+"@"+digest)))
+	return filepath.Join(dir, "bsf", "uploads", name), nil
+}
+
+func loadState(ref *Reference, digest string) *uploadState {
+	path, err := statePath(ref, digest)
+	if err != nil {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	state := &uploadState{}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil
+	}
+	return state
+}
+
+func saveState(ref *Reference, digest string, state *uploadState) {
+	path, err := statePath(ref, digest)
+	if err != nil {
+		return
+	}
+	if state == nil {
+		os.Remove(path)
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		return
+	}
+	os.WriteFile(path, data, 0600)
+}
+
+// pushBlob uploads the blob in chunks unless the registry already has it
+func (c *Client) pushBlob(ctx context.Context, ref *Reference, b blob, path string) error {
+	exists, err := c.blobExists(ctx, ref, b.Digest)
+	if err != nil {
+		return err
+	}
+	if exists {
+		c.progress(b.Digest, b.Size, b.Size)
+		rememberBlob(ref, b.Digest)
+		return nil
+	}
+
+	mounted, location, err := c.mountBlob(ctx, ref, b.Digest)
+	if err != nil {
+		return err
+	}
+	if mounted {
+		c.progress(b.Digest, b.Size, b.Size)
+		rememberBlob(ref, b.Digest)
+		return nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	state := loadState(ref, b.Digest)
+	if state != nil {
+		// the session may have expired, the registry tells us how far it got
+		state.Offset, err = c.uploadOffset(ctx, ref, state.Location)
+		if err != nil {
+			state = nil
+		}
+	}
+	if state == nil {
+		// a failed mount already opened an upload session
+		if location == "" {
+			location, err = c.startUpload(ctx, ref)
+			if err != nil {
+				return err
+			}
+		}
+		state = &uploadState{Location: location}
+	}
+
+	chunkSize := c.ChunkSize
+	if chunkSize <= 0 {
+		chunkSize = DefaultChunkSize
+	}
+	buf := make([]byte, chunkSize)
+
+	failures := 0
+	for state.Offset < b.Size {
+		n, err := f.ReadAt(buf, state.Offset)
+		if err != nil && err != io.EOF {
+			return err
+		}
+
+		location, offset, err := c.uploadChunk(ctx, ref, state.Location, state.Offset, buf[:n])
+		if err != nil {
+			if ctx.Err() != nil {
+				saveState(ref, b.Digest, state)
+				return ctx.Err()
+			}
+			failures++
+			if failures > c.Retries {
+				saveState(ref, b.Digest, state)
+				return fmt.Errorf("%v, giving up after %d retries, run the push again to resume", err, c.Retries)
+			}
+			time.Sleep(time.Duration(failures) * time.Second)
+
+			offset, qerr := c.uploadOffset(ctx, ref, state.Location)
+			if qerr != nil {
+				return fmt.Errorf("%v, and the upload can't be resumed: %v", err, qerr)
+			}
+			state.Offset = offset
+			continue
+		}
+
+		failures = 0
+		state.Location = location
+		state.Offset = offset
+		saveState(ref, b.Digest, state)
+		c.progress(b.Digest, state.Offset, b.Size)
+	}
+
+	err = c.completeUpload(ctx, ref, state.Location, b.Digest)
+	if err != nil {
+		return err
+	}
+	saveState(ref, b.Digest, nil)
+	rememberBlob(ref, b.Digest)
+	return nil
+}
+
+func (c *Client) progress(digest string, uploaded, size int64) {
+	if c.Progress != nil {
+		c.Progress(digest, uploaded, size)
+	}
+}
+
+// startUpload opens an upload session and returns its location
+func (c *Client) startUpload(ctx context.Context, ref *Reference) (string, error) {
+	resp, err := c.do(ctx, ref, http.MethodPost, c.baseURL(ref)+"/blobs/uploads/", nil, nil)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusAccepted {
+		return "", fmt.Errorf("failed to start upload: %s", responseError(resp))
+	}
+	return resolveLocation(resp)
+}
+
+// uploadChunk sends data at offset and returns the next location and offset
+func (c *Client) uploadChunk(ctx context.Context, ref *Reference, location string, offset int64, data []byte) (string, int64, error) {
+	header := http.Header{}
+	header.Set("Content-Type", "application/octet-stream")
+	header.Set("Content-Range", fmt.Sprintf("%d-%d", offset, offset+int64(len(data))-1))
+
+	resp, err := c.do(ctx, ref, http.MethodPatch, location, header, data)
+	if err != nil {
+		return "", 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusAccepted {
+		return "", 0, fmt.Errorf("failed to upload chunk: %s", responseError(resp))
+	}
+
+	next, err := resolveLocation(resp)
+	if err != nil {
+		return "", 0, err
+	}
+	end, ok := parseRange(resp.Header.Get("Range"))
+	if !ok {
+		// registries should return the range, assume the chunk was stored
+		return next, offset + int64(len(data)), nil
+	}
+	return next, end + 1, nil
+}
+
+// uploadOffset asks the registry how much of the upload session it has stored
+func (c *Client) uploadOffset(ctx context.Context, ref *Reference, location string) (int64, error) {
+	resp, err := c.do(ctx, ref, http.MethodGet, location, nil, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent {
+		return 0, fmt.Errorf("upload status returned %s", resp.Status)
+	}
+	end, ok := parseRange(resp.Header.Get("Range"))
+	if !ok {
+		return 0, nil
+	}
+	return end + 1, nil
+}
+
+// completeUpload closes the upload session, the registry verifies the digest
+func (c *Client) completeUpload(ctx context.Context, ref *Reference, location, digest string) error {
+	u, err := url.Parse(location)
+	if err != nil {
+		return err
+	}
+	q := u.Query()
+	q.Set("digest", digest)
+	u.RawQuery = q.Encode()
+
+	resp, err := c.do(ctx, ref, http.MethodPut, u.String(), nil, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		return fmt.Errorf("failed to complete upload: %s", responseError(resp))
+	}
+	return nil
+}
+
+// resolveLocation returns the absolute URL of the Location header, registries often return a path
+func resolveLocation(resp *http.Response) (string, error) {
+	loc := resp.Header.Get("Location")
+	if loc == "" {
+		return "", fmt.Errorf("registry did not return an upload location")
+	}
+	u, err := resp.Request.URL.Parse(loc)
+	if err != nil {
+		return "", err
+	}
+	return u.String(), nil
+}
+
+// parseRange returns the last byte of a Range header such as 0-1023
+func parseRange(r string) (int64, bool) {
+	r = strings.TrimPrefix(r, "bytes=")
+	_, end, ok := strings.Cut(r, "-")
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(end, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return n, true
+}
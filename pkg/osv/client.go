@@ -0,0 +1,128 @@
+package osv
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Client queries the osv.dev API
+type Client struct {
+	BaseURL    string
+	HTTPClient *http.Client
+	// records are the vulnerabilities fetched by ID, the batch API only returns their IDs
+	records map[string]*Vulnerability
+}
+
+// NewClient returns a client of api.osv.dev
+func NewClient() *Client {
+	return &Client{
+		BaseURL: "https://api.osv.dev",
+		HTTPClient: &http.Client{
+			Timeout: 60 * time.Second,
+		},
+		records: make(map[string]*Vulnerability),
+	}
+}
+
+// maxBatch is the number of queries the batch API accepts at once
+const maxBatch = 1000
+
+// Query implements Source
+func (c *Client) Query(ctx context.Context, purls []string) ([][]Vulnerability, error) {
+	results := make([][]Vulnerability, 0, len(purls))
+	for start := 0; start < len(purls); start += maxBatch {
+		end := min(start+maxBatch, len(purls))
+		batch, err := c.queryBatch(ctx, purls[start:end])
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, batch...)
+	}
+	return results, nil
+}
+
+func (c *Client) queryBatch(ctx context.Context, purls []string) ([][]Vulnerability, error) {
+	type query struct {
+		Package struct {
+			Purl string `json:"purl"`
+		} `json:"package"`
+	}
+	req := struct {
+		Queries []query `json:"queries"`
+	}{Queries: make([]query, len(purls))}
+	for i, p := range purls {
+		req.Queries[i].Package.Purl = p
+	}
+
+	resp := struct {
+		Results []struct {
+			Vulns []struct {
+				ID string `json:"id"`
+			} `json:"vulns"`
+		} `json:"results"`
+	}{}
+	if err := c.do(ctx, http.MethodPost, "/v1/querybatch", req, &resp); err != nil {
+		return nil, err
+	}
+	if len(resp.Results) != len(purls) {
+		return nil, fmt.Errorf("osv.dev returned %d results for %d queries", len(resp.Results), len(purls))
+	}
+
+	results := make([][]Vulnerability, len(purls))
+	for i, r := range resp.Results {
+		results[i] = make([]Vulnerability, 0, len(r.Vulns))
+		for _, v := range r.Vulns {
+			record, err := c.vulnerability(ctx, v.ID)
+			if err != nil {
+				return nil, err
+			}
+			results[i] = append(results[i], *record)
+		}
+	}
+	return results, nil
+}
+
+// vulnerability returns the record of the vulnerability, fetching it once
+func (c *Client) vulnerability(ctx context.Context, id string) (*Vulnerability, error) {
+	if c.records == nil {
+		c.records = make(map[string]*Vulnerability)
+	}
+	if v, ok := c.records[id]; ok {
+		return v, nil
+	}
+	v := &Vulnerability{}
+	if err := c.do(ctx, http.MethodGet, "/v1/vulns/"+url.PathEscape(id), nil, v); err != nil {
+		return nil, err
+	}
+	c.records[id] = v
+	return v, nil
+}
+
+func (c *Client) do(ctx context.Context, method, path string, body, v interface{}) error {
+	var reqBody bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&reqBody).Encode(body); err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.BaseURL+path, &reqBody)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("osv.dev returned %s for %s", resp.Status, path)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
@@ -0,0 +1,269 @@
+package osv
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// ecosystems are the OSV ecosystems of package url types
+var ecosystems = map[string]string{
+	"cargo":    "crates.io",
+	"composer": "Packagist",
+	"gem":      "RubyGems",
+	"golang":   "Go",
+	"hex":      "Hex",
+	"maven":    "Maven",
+	"npm":      "npm",
+	"nuget":    "NuGet",
+	"pub":      "Pub",
+	"pypi":     "PyPI",
+}
+
+// Package returns the OSV ecosystem, package name and version of a package url. ok is false for package urls of
+// types OSV has no ecosystem for, such as nix.
+func Package(purl string) (ecosystem, name, version string, ok bool) {
+	rest, found := strings.CutPrefix(purl, "pkg:")
+	if !found {
+		return "", "", "", false
+	}
+	rest, _, _ = strings.Cut(rest, "#")
+	rest, _, _ = strings.Cut(rest, "?")
+	rest, version, _ = strings.Cut(rest, "@")
+	typ, rest, found := strings.Cut(rest, "/")
+	if !found {
+		return "", "", "", false
+	}
+	ecosystem, ok = ecosystems[strings.ToLower(typ)]
+	if !ok {
+		return "", "", "", false
+	}
+
+	segments := strings.Split(rest, "/")
+	for i, s := range segments {
+		if unescaped, err := url.PathUnescape(s); err == nil {
+			segments[i] = unescaped
+		}
+	}
+	if v, err := url.PathUnescape(version); err == nil {
+		version = v
+	}
+
+	name = strings.Join(segments, "/")
+	switch ecosystem {
+	case "Maven":
+		name = strings.Join(segments, ":")
+	case "PyPI":
+		name = NormalizePyPI(name)
+	}
+	return ecosystem, name, version, true
+}
+
+// NormalizePyPI normalizes a python package name as PEP 503 does
+func NormalizePyPI(name string) string {
+	return strings.ToLower(strings.NewReplacer("_", "-", ".", "-").Replace(name))
+}
+
+// DB is an offline OSV database, read from the all.zip archives of OSV ecosystems
+type DB struct {
+	vulns map[string][]*Vulnerability
+}
+
+// OpenDB reads the OSV archives
+func OpenDB(paths ...string) (*DB, error) {
+	db := &DB{vulns: make(map[string][]*Vulnerability)}
+	for _, p := range paths {
+		if err := db.read(p); err != nil {
+			return nil, fmt.Errorf("failed to read the OSV database %s: %w", p, err)
+		}
+	}
+	return db, nil
+}
+
+func (db *DB) read(p string) error {
+	r, err := zip.OpenReader(p)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	for _, f := range r.File {
+		if path.Ext(f.Name) != ".json" {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return err
+		}
+		v := &Vulnerability{}
+		err = json.NewDecoder(rc).Decode(v)
+		rc.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %w", f.Name, err)
+		}
+		db.Add(v)
+	}
+	return nil
+}
+
+// Add adds a vulnerability to the database
+func (db *DB) Add(v *Vulnerability) {
+	seen := make(map[string]bool)
+	for _, a := range v.Affected {
+		key := dbKey(a.Package.Ecosystem, a.Package.Name)
+		if !seen[key] {
+			seen[key] = true
+			db.vulns[key] = append(db.vulns[key], v)
+		}
+	}
+}
+
+func dbKey(ecosystem, name string) string {
+	// ecosystems may have a release suffix, e.g. Debian:12
+	ecosystem, _, _ = strings.Cut(ecosystem, ":")
+	if ecosystem == "PyPI" {
+		name = NormalizePyPI(name)
+	}
+	return ecosystem + "/" + name
+}
+
+// Query implements Source. Package urls of other ecosystems than the ones of the database have no vulnerabilities.
+func (db *DB) Query(ctx context.Context, purls []string) ([][]Vulnerability, error) {
+	results := make([][]Vulnerability, len(purls))
+	for i, p := range purls {
+		results[i] = make([]Vulnerability, 0)
+		ecosystem, name, version, ok := Package(p)
+		if !ok || version == "" {
+			continue
+		}
+		for _, v := range db.vulns[dbKey(ecosystem, name)] {
+			if v.affects(ecosystem, name, version) {
+				results[i] = append(results[i], *v)
+			}
+		}
+	}
+	return results, nil
+}
+
+// affects reports if the version of the package is affected, listed or in a range of ECOSYSTEM or SEMVER versions
+func (v *Vulnerability) affects(ecosystem, name, version string) bool {
+	for _, a := range v.Affected {
+		if dbKey(a.Package.Ecosystem, a.Package.Name) != dbKey(ecosystem, name) {
+			continue
+		}
+		for _, listed := range a.Versions {
+			if listed == version {
+				return true
+			}
+		}
+		for _, r := range a.Ranges {
+			if r.Type != "ECOSYSTEM" && r.Type != "SEMVER" {
+				continue
+			}
+			// events are sorted, the version is affected from an introduction to the next fix
+			affected := false
+			for _, e := range r.Events {
+				switch {
+				case e.Introduced != "":
+					if e.Introduced == "0" || CompareVersions(version, e.Introduced) >= 0 {
+						affected = true
+					}
+				case e.Fixed != "":
+					if CompareVersions(version, e.Fixed) >= 0 {
+						affected = false
+					}
+				case e.LastAffected != "":
+					if CompareVersions(version, e.LastAffected) > 0 {
+						affected = false
+					}
+				}
+			}
+			if affected {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// CompareVersions compares versions by their numeric and alphabetic parts, numbers numerically.
+// A version continuing with letters is a pre-release of the version without them, 1.0.0-rc1 is before 1.0.0.
+func CompareVersions(a, b string) int {
+	pa, pb := versionParts(strings.TrimPrefix(a, "v")), versionParts(strings.TrimPrefix(b, "v"))
+	for i := 0; i < len(pa) || i < len(pb); i++ {
+		switch {
+		case i >= len(pa):
+			if isNumber(pb[i]) {
+				return -1
+			}
+			return 1
+		case i >= len(pb):
+			if isNumber(pa[i]) {
+				return 1
+			}
+			return -1
+		}
+		if c := comparePart(pa[i], pb[i]); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+func comparePart(a, b string) int {
+	na, errA := strconv.ParseUint(a, 10, 64)
+	nb, errB := strconv.ParseUint(b, 10, 64)
+	switch {
+	case errA == nil && errB == nil:
+		switch {
+		case na < nb:
+			return -1
+		case na > nb:
+			return 1
+		}
+		return 0
+	case errA == nil:
+		// releases are after pre-releases
+		return 1
+	case errB == nil:
+		return -1
+	}
+	return strings.Compare(a, b)
+}
+
+// versionParts splits a version in runs of digits and runs of letters, dropping separators
+func versionParts(v string) []string {
+	parts := make([]string, 0)
+	start := -1
+	for i, r := range v {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			if start >= 0 {
+				parts = append(parts, v[start:i])
+			}
+			start = -1
+			continue
+		}
+		if start >= 0 && unicode.IsDigit(r) != unicode.IsDigit(rune(v[start])) {
+			parts = append(parts, v[start:i])
+			start = -1
+		}
+		if start < 0 {
+			start = i
+		}
+	}
+	if start >= 0 {
+		parts = append(parts, v[start:])
+	}
+	return parts
+}
+
+func isNumber(s string) bool {
+	_, err := strconv.ParseUint(s, 10, 64)
+	return err == nil
+}
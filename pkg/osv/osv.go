@@ -0,0 +1,151 @@
+// Package osv matches the components of a closure against the vulnerabilities of the OSV database, through the
+// osv.dev API or offline, with the databases bsf db fetch osv/<ecosystem> downloads.
+package osv
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/awalterschulze/gographviz"
+)
+
+// Graph attributes holding the vulnerabilities of a component and the highest of their severities
+const (
+	AttrVulnerabilities = "vulnerabilities"
+	AttrSeverity        = "severity"
+)
+
+// Vulnerability is an OSV record, with the fields bsf uses
+type Vulnerability struct {
+	ID       string   `json:"id"`
+	Aliases  []string `json:"aliases,omitempty"`
+	Summary  string   `json:"summary,omitempty"`
+	Modified string   `json:"modified,omitempty"`
+	Severity []struct {
+		Type  string `json:"type"`
+		Score string `json:"score"`
+	} `json:"severity,omitempty"`
+	Affected         []Affected `json:"affected,omitempty"`
+	DatabaseSpecific struct {
+		Severity string `json:"severity,omitempty"`
+	} `json:"database_specific,omitempty"`
+}
+
+// Affected is a package a vulnerability affects, and its affected versions
+type Affected struct {
+	Package struct {
+		Ecosystem string `json:"ecosystem"`
+		Name      string `json:"name"`
+		Purl      string `json:"purl,omitempty"`
+	} `json:"package"`
+	Ranges []struct {
+		Type   string `json:"type"`
+		Events []struct {
+			Introduced   string `json:"introduced,omitempty"`
+			Fixed        string `json:"fixed,omitempty"`
+			LastAffected string `json:"last_affected,omitempty"`
+		} `json:"events"`
+	} `json:"ranges,omitempty"`
+	Versions []string `json:"versions,omitempty"`
+}
+
+// Fixed returns the versions fixing the vulnerability
+func (v *Vulnerability) Fixed() []string {
+	fixed := make([]string, 0)
+	for _, a := range v.Affected {
+		for _, r := range a.Ranges {
+			for _, e := range r.Events {
+				if e.Fixed != "" {
+					fixed = append(fixed, e.Fixed)
+				}
+			}
+		}
+	}
+	return fixed
+}
+
+// Source returns the vulnerabilities of the packages named by package urls with versions, in the order of purls
+type Source interface {
+	Query(ctx context.Context, purls []string) ([][]Vulnerability, error)
+}
+
+// Component is a component of the closure to scan
+type Component struct {
+	// Node is the name of its node in the closure graph
+	Node    string
+	Name    string
+	Version string
+	// Purl is its upstream package url, only components of an OSV ecosystem are scanned
+	Purl         string
+	Reachability string
+}
+
+// Finding is a vulnerability of a component
+type Finding struct {
+	Component     Component
+	Vulnerability Vulnerability
+	Severity      Severity
+}
+
+// Scan returns the vulnerabilities of the components, sorted by decreasing severity
+func Scan(ctx context.Context, src Source, components []Component) ([]Finding, error) {
+	purls := make([]string, 0, len(components))
+	for _, c := range components {
+		purls = append(purls, c.Purl)
+	}
+	results, err := src.Query(ctx, purls)
+	if err != nil {
+		return nil, err
+	}
+	if len(results) != len(components) {
+		return nil, fmt.Errorf("got the vulnerabilities of %d packages, expected %d", len(results), len(components))
+	}
+
+	findings := make([]Finding, 0)
+	for i, vulns := range results {
+		for _, v := range vulns {
+			findings = append(findings, Finding{Component: components[i], Vulnerability: v, Severity: SeverityOf(&v)})
+		}
+	}
+	sort.SliceStable(findings, func(i, j int) bool {
+		if findings[i].Severity != findings[j].Severity {
+			return findings[i].Severity > findings[j].Severity
+		}
+		return findings[i].Vulnerability.ID < findings[j].Vulnerability.ID
+	})
+	return findings, nil
+}
+
+// Annotate records the vulnerabilities of the components and the highest of their severities on the closure graph
+func Annotate(graph *gographviz.Graph, findings []Finding) {
+	ids := make(map[string][]string)
+	highest := make(map[string]Severity)
+	for _, f := range findings {
+		ids[f.Component.Node] = append(ids[f.Component.Node], f.Vulnerability.ID)
+		if f.Severity > highest[f.Component.Node] {
+			highest[f.Component.Node] = f.Severity
+		}
+	}
+	for name, vulns := range ids {
+		node, ok := graph.Nodes.Lookup[name]
+		if !ok {
+			continue
+		}
+		node.Attrs[AttrVulnerabilities] = strings.Join(vulns, " ")
+		node.Attrs[AttrSeverity] = highest[name].String()
+	}
+}
+
+// AtLeast returns the findings at or above the severity. Findings of unknown severity, e.g. only scored with CVSS v4,
+// are returned at the lowest threshold, low, so they can't pass a strict policy unseen.
+func AtLeast(findings []Finding, threshold Severity) []Finding {
+	above := make([]Finding, 0)
+	for _, f := range findings {
+		if f.Severity >= threshold || (f.Severity == SeverityUnknown && threshold <= SeverityLow) {
+			above = append(above, f)
+		}
+	}
+	return above
+}
@@ -0,0 +1,209 @@
+package osv
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/awalterschulze/gographviz"
+)
+
+const requestsVuln = `{
+	"id": "GHSA-9wx4-h78v-vm56",
+	"aliases": ["CVE-2024-35195"],
+	"severity": [{"type": "CVSS_V3", "score": "CVSS:3.1/AV:L/AC:H/PR:H/UI:R/S:U/C:H/I:H/A:N"}],
+	"affected": [{
+		"package": {"ecosystem": "PyPI", "name": "requests"},
+		"ranges": [{"type": "ECOSYSTEM", "events": [{"introduced": "0"}, {"fixed": "2.32.0"}]}]
+	}]
+}`
+
+const lodashVuln = `{
+	"id": "GHSA-35jh-r3h4-6jhm",
+	"database_specific": {"severity": "HIGH"},
+	"affected": [{
+		"package": {"ecosystem": "npm", "name": "lodash"},
+		"ranges": [{"type": "SEMVER", "events": [{"introduced": "4.0.0"}, {"last_affected": "4.17.20"}]}]
+	}]
+}`
+
+func vulnerability(t *testing.T, record string) *Vulnerability {
+	t.Helper()
+	v := &Vulnerability{}
+	if err := json.Unmarshal([]byte(record), v); err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func TestPackage(t *testing.T) {
+	tests := []struct {
+		purl                     string
+		ecosystem, name, version string
+		ok                       bool
+	}{
+		{"pkg:pypi/Flask_Cors@4.0.0", "PyPI", "flask-cors", "4.0.0", true},
+		{"pkg:npm/%40babel/core@7.24.0", "npm", "@babel/core", "7.24.0", true},
+		{"pkg:golang/golang.org/x/net@v0.22.0?type=module", "Go", "golang.org/x/net", "v0.22.0", true},
+		{"pkg:maven/org.apache.logging.log4j/log4j-core@2.14.1", "Maven", "org.apache.logging.log4j:log4j-core", "2.14.1", true},
+		{"pkg:nix/openssl@3.0.13", "", "", "", false},
+		{"openssl", "", "", "", false},
+	}
+	for _, tt := range tests {
+		ecosystem, name, version, ok := Package(tt.purl)
+		if ecosystem != tt.ecosystem || name != tt.name || version != tt.version || ok != tt.ok {
+			t.Errorf("Package(%q) = %q, %q, %q, %v, want %q, %q, %q, %v", tt.purl, ecosystem, name, version, ok, tt.ecosystem, tt.name, tt.version, tt.ok)
+		}
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"2.31.0", "2.32.0", -1},
+		{"2.10", "2.9", 1},
+		{"v1.2.3", "1.2.3", 0},
+		{"1.0.0-rc1", "1.0.0", -1},
+		{"1.0", "1.0.0", -1},
+	}
+	for _, tt := range tests {
+		if got := CompareVersions(tt.a, tt.b); got != tt.want {
+			t.Errorf("CompareVersions(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestCVSS3Score(t *testing.T) {
+	tests := map[string]float64{
+		"CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:U/C:H/I:H/A:H": 9.8,
+		"CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:C/C:H/I:H/A:H": 10,
+		"CVSS:3.1/AV:L/AC:H/PR:H/UI:R/S:U/C:H/I:H/A:N": 5.6,
+		"CVSS:3.0/AV:N/AC:L/PR:L/UI:N/S:C/C:L/I:L/A:N": 6.4,
+		"CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:U/C:N/I:N/A:N": 0,
+	}
+	for vector, want := range tests {
+		got, err := CVSS3Score(vector)
+		if err != nil {
+			t.Errorf("CVSS3Score(%q): %v", vector, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("CVSS3Score(%q) = %v, want %v", vector, got, want)
+		}
+	}
+
+	if _, err := CVSS3Score("CVSS:3.1/AV:N/AC:L"); err == nil {
+		t.Error("CVSS3Score() of an incomplete vector should fail")
+	}
+}
+
+func TestDBQuery(t *testing.T) {
+	db, err := OpenDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Add(vulnerability(t, requestsVuln))
+	db.Add(vulnerability(t, lodashVuln))
+
+	tests := map[string][]string{
+		"pkg:pypi/requests@2.31.0": {"GHSA-9wx4-h78v-vm56"},
+		"pkg:pypi/Requests@2.32.3": {},
+		"pkg:npm/lodash@4.17.20":   {"GHSA-35jh-r3h4-6jhm"},
+		"pkg:npm/lodash@4.17.21":   {},
+		"pkg:npm/lodash@3.10.1":    {},
+		"pkg:nix/requests@2.31.0":  {},
+	}
+	for purl, want := range tests {
+		results, err := db.Query(context.Background(), []string{purl})
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := make([]string, 0)
+		for _, v := range results[0] {
+			got = append(got, v.ID)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("Query(%q) = %v, want %v", purl, got, want)
+		}
+	}
+}
+
+func TestScan(t *testing.T) {
+	db, _ := OpenDB()
+	db.Add(vulnerability(t, requestsVuln))
+	db.Add(vulnerability(t, lodashVuln))
+
+	graph := gographviz.NewGraph()
+	graph.SetDir(true)
+	graph.AddNode("G", `"aaaa-python3.11-requests-2.31.0"`, nil)
+	graph.AddNode("G", `"bbbb-lodash-4.17.20"`, nil)
+	components := []Component{
+		{Node: `"aaaa-python3.11-requests-2.31.0"`, Name: "requests", Version: "2.31.0", Purl: "pkg:pypi/requests@2.31.0"},
+		{Node: `"bbbb-lodash-4.17.20"`, Name: "lodash", Version: "4.17.20", Purl: "pkg:npm/lodash@4.17.20"},
+	}
+
+	findings, err := Scan(context.Background(), db, components)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(findings) != 2 {
+		t.Fatalf("Scan() found %d vulnerabilities, want 2", len(findings))
+	}
+	if findings[0].Vulnerability.ID != "GHSA-35jh-r3h4-6jhm" || findings[0].Severity != SeverityHigh {
+		t.Errorf("first finding = %s %s, want the high GHSA-35jh-r3h4-6jhm", findings[0].Vulnerability.ID, findings[0].Severity)
+	}
+	if findings[1].Severity != SeverityMedium {
+		t.Errorf("severity of %s = %s, want medium", findings[1].Vulnerability.ID, findings[1].Severity)
+	}
+	if got := AtLeast(findings, SeverityHigh); len(got) != 1 {
+		t.Errorf("AtLeast(high) = %d findings, want 1", len(got))
+	}
+
+	unknown := []Finding{{Severity: SeverityUnknown}}
+	if got := AtLeast(unknown, SeverityLow); len(got) != 1 {
+		t.Errorf("AtLeast(low) = %d findings, want the finding of unknown severity", len(got))
+	}
+	if got := AtLeast(unknown, SeverityMedium); len(got) != 0 {
+		t.Errorf("AtLeast(medium) = %d findings, want 0", len(got))
+	}
+
+	Annotate(graph, findings)
+	node := graph.Nodes.Lookup[`"aaaa-python3.11-requests-2.31.0"`]
+	if node.Attrs[AttrVulnerabilities] != "GHSA-9wx4-h78v-vm56" || node.Attrs[AttrSeverity] != "medium" {
+		t.Errorf("Annotate() set %v", node.Attrs)
+	}
+}
+
+func TestClientQuery(t *testing.T) {
+	fetched := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/querybatch":
+			w.Write([]byte(`{"results": [{"vulns": [{"id": "GHSA-9wx4-h78v-vm56"}]}, {}, {"vulns": [{"id": "GHSA-9wx4-h78v-vm56"}]}]}`))
+		case "/v1/vulns/GHSA-9wx4-h78v-vm56":
+			fetched++
+			w.Write([]byte(requestsVuln))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	c := NewClient()
+	c.BaseURL = srv.URL
+	results, err := c.Query(context.Background(), []string{"pkg:pypi/requests@2.31.0", "pkg:pypi/flask@3.0.3", "pkg:pypi/requests@2.31.0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 3 || len(results[0]) != 1 || len(results[1]) != 0 || results[2][0].ID != "GHSA-9wx4-h78v-vm56" {
+		t.Errorf("Query() = %v", results)
+	}
+	if fetched != 1 {
+		t.Errorf("fetched the record %d times, want once", fetched)
+	}
+}
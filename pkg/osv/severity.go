@@ -0,0 +1,149 @@
+package osv
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Severity is the qualitative severity of a vulnerability, from its CVSS v3 base score
+type Severity int
+
+// Severities, in increasing order
+const (
+	SeverityUnknown Severity = iota
+	SeverityLow
+	SeverityMedium
+	SeverityHigh
+	SeverityCritical
+)
+
+var severityNames = []string{"unknown", "low", "medium", "high", "critical"}
+
+// String returns the name of the severity
+func (s Severity) String() string {
+	if s < 0 || int(s) >= len(severityNames) {
+		return severityNames[0]
+	}
+	return severityNames[s]
+}
+
+// ParseSeverity returns the severity of its name: low, medium, high or critical. Moderate is medium, as GitHub
+// advisories name it.
+func ParseSeverity(name string) (Severity, error) {
+	switch strings.ToLower(name) {
+	case "low":
+		return SeverityLow, nil
+	case "medium", "moderate":
+		return SeverityMedium, nil
+	case "high":
+		return SeverityHigh, nil
+	case "critical":
+		return SeverityCritical, nil
+	}
+	return SeverityUnknown, fmt.Errorf("unknown severity %q, expected low, medium, high or critical", name)
+}
+
+// SeverityOf returns the severity of the vulnerability, from its CVSS v3 vector or the severity its database assigned.
+// CVSS v4 vectors aren't scored, vulnerabilities with neither are of unknown severity.
+func SeverityOf(v *Vulnerability) Severity {
+	for _, s := range v.Severity {
+		if s.Type != "CVSS_V3" {
+			continue
+		}
+		if score, err := CVSS3Score(s.Score); err == nil {
+			return scoreSeverity(score)
+		}
+	}
+	if s, err := ParseSeverity(v.DatabaseSpecific.Severity); err == nil {
+		return s
+	}
+	return SeverityUnknown
+}
+
+func scoreSeverity(score float64) Severity {
+	switch {
+	case score >= 9:
+		return SeverityCritical
+	case score >= 7:
+		return SeverityHigh
+	case score >= 4:
+		return SeverityMedium
+	case score > 0:
+		return SeverityLow
+	}
+	return SeverityUnknown
+}
+
+// cvss3Weights are the weights of the base metric values of CVSS v3
+var cvss3Weights = map[string]map[string]float64{
+	"AV": {"N": 0.85, "A": 0.62, "L": 0.55, "P": 0.2},
+	"AC": {"L": 0.77, "H": 0.44},
+	"PR": {"N": 0.85, "L": 0.62, "H": 0.27},
+	"UI": {"N": 0.85, "R": 0.62},
+	"C":  {"H": 0.56, "L": 0.22, "N": 0},
+	"I":  {"H": 0.56, "L": 0.22, "N": 0},
+	"A":  {"H": 0.56, "L": 0.22, "N": 0},
+}
+
+// CVSS3Score returns the base score of a CVSS v3.0 or v3.1 vector, e.g. CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:U/C:H/I:H/A:H
+func CVSS3Score(vector string) (float64, error) {
+	parts := strings.Split(vector, "/")
+	if len(parts) == 0 || !strings.HasPrefix(parts[0], "CVSS:3") {
+		return 0, fmt.Errorf("not a CVSS v3 vector: %s", vector)
+	}
+
+	metrics := make(map[string]string)
+	for _, p := range parts[1:] {
+		k, v, ok := strings.Cut(p, ":")
+		if !ok {
+			return 0, fmt.Errorf("invalid metric %q of %s", p, vector)
+		}
+		metrics[k] = v
+	}
+	scope := metrics["S"]
+	if scope != "U" && scope != "C" {
+		return 0, fmt.Errorf("invalid scope of %s", vector)
+	}
+
+	w := make(map[string]float64)
+	for k, values := range cvss3Weights {
+		weight, ok := values[metrics[k]]
+		if !ok {
+			return 0, fmt.Errorf("invalid or missing %s of %s", k, vector)
+		}
+		w[k] = weight
+	}
+	// privileges weigh more when the scope changes
+	if scope == "C" {
+		switch metrics["PR"] {
+		case "L":
+			w["PR"] = 0.68
+		case "H":
+			w["PR"] = 0.5
+		}
+	}
+
+	iss := 1 - (1-w["C"])*(1-w["I"])*(1-w["A"])
+	impact := 6.42 * iss
+	if scope == "C" {
+		impact = 7.52*(iss-0.029) - 3.25*math.Pow(iss-0.02, 15)
+	}
+	if impact <= 0 {
+		return 0, nil
+	}
+	exploitability := 8.22 * w["AV"] * w["AC"] * w["PR"] * w["UI"]
+	if scope == "C" {
+		return roundUp(math.Min(1.08*(impact+exploitability), 10)), nil
+	}
+	return roundUp(math.Min(impact+exploitability, 10)), nil
+}
+
+// roundUp rounds up to one decimal as CVSS v3.1 specifies it, avoiding floating point errors
+func roundUp(x float64) float64 {
+	i := int64(math.Round(x * 100000))
+	if i%10000 == 0 {
+		return float64(i) / 100000
+	}
+	return (math.Floor(float64(i)/10000) + 1) / 10
+}
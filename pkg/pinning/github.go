@@ -0,0 +1,67 @@
+package pinning
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+// GitHub looks up the heads of the nixpkgs branches with the GitHub API
+type GitHub struct {
+	BaseURL    string
+	Repository string
+	Token      string
+	HTTPClient *http.Client
+}
+
+// NewGitHub creates a GitHub client of NixOS/nixpkgs, authenticating with GITHUB_TOKEN if it is set
+func NewGitHub() *GitHub {
+	return &GitHub{
+		BaseURL:    "https://api.github.com",
+		Repository: "NixOS/nixpkgs",
+		Token:      os.Getenv("GITHUB_TOKEN"),
+		HTTPClient: &http.Client{
+			Timeout: 30 * time.Second,
+		},
+	}
+}
+
+// Head returns the commit the branch points to
+func (g *GitHub) Head(ctx context.Context, branch string) (Candidate, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("%s/repos/%s/branches/%s", g.BaseURL, g.Repository, url.PathEscape(branch)), nil)
+	if err != nil {
+		return Candidate{}, err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	if g.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+g.Token)
+	}
+
+	resp, err := g.HTTPClient.Do(req)
+	if err != nil {
+		return Candidate{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return Candidate{}, fmt.Errorf("GitHub API returned %s for branch %s", resp.Status, branch)
+	}
+
+	head := struct {
+		Commit struct {
+			SHA    string `json:"sha"`
+			Commit struct {
+				Committer struct {
+					Date time.Time `json:"date"`
+				} `json:"committer"`
+			} `json:"commit"`
+		} `json:"commit"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&head); err != nil {
+		return Candidate{}, err
+	}
+	return Candidate{Branch: branch, Rev: head.Commit.SHA, Date: head.Commit.Commit.Committer.Date}, nil
+}
@@ -0,0 +1,223 @@
+// Package pinning recommends the nixpkgs revision to lock that resolves the most vulnerabilities of the closure with
+// the fewest version jumps. The candidates are the heads of the nixpkgs channels and release branches, the
+// vulnerable packages are looked up in each of them and their versions there scanned against OSV again.
+package pinning
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/buildsafedev/bsf/pkg/osv"
+)
+
+// Candidate is a nixpkgs revision the lock could be bumped to, the head of a branch
+type Candidate struct {
+	Branch string    `json:"branch"`
+	Rev    string    `json:"rev"`
+	Date   time.Time `json:"date"`
+}
+
+// Jump is a package whose version differs at the candidate
+type Jump struct {
+	Package string `json:"package"`
+	From    string `json:"from"`
+	To      string `json:"to"`
+	// Major is set when the first number of the version changes
+	Major bool `json:"major,omitempty"`
+}
+
+// Recommendation is the effect of locking the candidate on the vulnerabilities of the closure
+type Recommendation struct {
+	Candidate
+	// Resolved are the vulnerabilities of the closure the candidate doesn't have, Introduced the ones it adds
+	Resolved   []string `json:"resolved"`
+	Introduced []string `json:"introduced"`
+	// Remaining is the number of vulnerabilities left at the candidate
+	Remaining int    `json:"remaining"`
+	Jumps     []Jump `json:"jumps"`
+}
+
+// Net returns the number of vulnerabilities the candidate resolves, less the ones it introduces
+func (r Recommendation) Net() int {
+	return len(r.Resolved) - len(r.Introduced)
+}
+
+// majorJumps returns the number of jumps to another major version
+func (r Recommendation) majorJumps() int {
+	n := 0
+	for _, j := range r.Jumps {
+		if j.Major {
+			n++
+		}
+	}
+	return n
+}
+
+// Evaluate scans the components of the closure at the versions the candidate has, by package name, and compares their
+// vulnerabilities with the current findings. Packages the candidate has no version of keep theirs.
+func Evaluate(ctx context.Context, src osv.Source, components []osv.Component, current []osv.Finding, c Candidate, versions map[string]string) (Recommendation, error) {
+	moved := make([]osv.Component, 0, len(components))
+	rec := Recommendation{Candidate: c, Resolved: make([]string, 0), Introduced: make([]string, 0), Jumps: make([]Jump, 0)}
+	for _, comp := range components {
+		if v, ok := versions[comp.Name]; ok && v != "" && v != comp.Version {
+			rec.Jumps = append(rec.Jumps, Jump{Package: comp.Name, From: comp.Version, To: v, Major: major(comp.Version) != major(v)})
+			comp.Version, comp.Purl = v, WithVersion(comp.Purl, v)
+		}
+		moved = append(moved, comp)
+	}
+	sort.Slice(rec.Jumps, func(i, j int) bool { return rec.Jumps[i].Package < rec.Jumps[j].Package })
+
+	findings, err := osv.Scan(ctx, src, moved)
+	if err != nil {
+		return Recommendation{}, err
+	}
+	before, after := vulnerabilityIDs(current), vulnerabilityIDs(findings)
+	for id := range before {
+		if !after[id] {
+			rec.Resolved = append(rec.Resolved, id)
+		}
+	}
+	for id := range after {
+		if !before[id] {
+			rec.Introduced = append(rec.Introduced, id)
+		}
+	}
+	sort.Strings(rec.Resolved)
+	sort.Strings(rec.Introduced)
+	rec.Remaining = len(after)
+	return rec, nil
+}
+
+// vulnerabilityIDs returns the vulnerabilities of the findings, by id and package
+func vulnerabilityIDs(findings []osv.Finding) map[string]bool {
+	ids := make(map[string]bool, len(findings))
+	for _, f := range findings {
+		ids[f.Vulnerability.ID+" ("+f.Component.Name+")"] = true
+	}
+	return ids
+}
+
+// Rank sorts the recommendations, the ones resolving the most vulnerabilities net first, then the ones with the
+// fewest version jumps, to another major version in particular, then the most recent
+func Rank(recs []Recommendation) {
+	sort.SliceStable(recs, func(i, j int) bool {
+		a, b := recs[i], recs[j]
+		switch {
+		case a.Net() != b.Net():
+			return a.Net() > b.Net()
+		case len(a.Jumps) != len(b.Jumps):
+			return len(a.Jumps) < len(b.Jumps)
+		case a.majorJumps() != b.majorJumps():
+			return a.majorJumps() < b.majorJumps()
+		}
+		return a.Date.After(b.Date)
+	})
+}
+
+// Branches returns the branches the candidates are the heads of: the branch locked now, nixos-unstable and the two
+// latest release branches at now. nixpkgs releases in May and November, the release of a month is out at its end.
+func Branches(locked string, now time.Time) []string {
+	branches := make([]string, 0, 4)
+	add := func(b string) {
+		for _, existing := range branches {
+			if existing == b {
+				return
+			}
+		}
+		branches = append(branches, b)
+	}
+	if locked != "" {
+		add(locked)
+	}
+	add("nixos-unstable")
+
+	year, month := now.Year()%100, now.Month()
+	latest := fmt.Sprintf("nixos-%02d.11", year-1)
+	previous := fmt.Sprintf("nixos-%02d.05", year-1)
+	switch {
+	case month == time.December:
+		latest, previous = fmt.Sprintf("nixos-%02d.11", year), fmt.Sprintf("nixos-%02d.05", year)
+	case month > time.May:
+		latest, previous = fmt.Sprintf("nixos-%02d.05", year), fmt.Sprintf("nixos-%02d.11", year-1)
+	}
+	add(latest)
+	add(previous)
+	return branches
+}
+
+// pythonPrefix matches the interpreter prefix of python packages, e.g. python3.11-requests
+var pythonPrefix = regexp.MustCompile(`^python3(\.\d+)?-`)
+
+// attrPaths returns the nixpkgs attributes the package may be, its name and the package set of its prefix
+func attrPaths(name string) []string {
+	paths := []string{name}
+	if loc := pythonPrefix.FindStringIndex(name); loc != nil {
+		paths = append(paths, "python3Packages."+name[loc[1]:])
+	}
+	return paths
+}
+
+// VersionsExpr returns the expression evaluating the versions of the packages in nixpkgs at rev, by package name.
+// Packages that aren't attributes of nixpkgs, or fail to evaluate, are null.
+func VersionsExpr(rev string, names []string) string {
+	quoted := make([]string, 0, len(names))
+	for _, n := range names {
+		paths := make([]string, 0, 2)
+		for _, p := range attrPaths(n) {
+			paths = append(paths, strconv.Quote(p))
+		}
+		quoted = append(quoted, fmt.Sprintf("{ name = %s; paths = [ %s ]; }", strconv.Quote(n), strings.Join(paths, " ")))
+	}
+
+	return fmt.Sprintf(`let
+		pkgs = (builtins.getFlake "github:NixOS/nixpkgs/%s").legacyPackages.${builtins.currentSystem};
+		lib = pkgs.lib;
+		version = path: let
+			p = lib.attrByPath (lib.splitString "." path) null pkgs;
+			r = builtins.tryEval (if p == null then null else p.version or null);
+		in if r.success then r.value else null;
+		first = paths: lib.findFirst (v: v != null) null (map version paths);
+	in builtins.listToAttrs (map (p: { name = p.name; value = first p.paths; }) [ %s ])`, rev, strings.Join(quoted, " "))
+}
+
+// ParseVersions parses the versions evaluated by VersionsExpr, leaving out the packages without one
+func ParseVersions(out []byte) (map[string]string, error) {
+	evaluated := make(map[string]*string)
+	if err := json.Unmarshal(out, &evaluated); err != nil {
+		return nil, fmt.Errorf("failed to parse the versions of nixpkgs: %v", err)
+	}
+	versions := make(map[string]string, len(evaluated))
+	for name, v := range evaluated {
+		if v != nil && *v != "" {
+			versions[name] = *v
+		}
+	}
+	return versions, nil
+}
+
+// WithVersion returns the package url with the version replaced
+func WithVersion(purl, version string) string {
+	rest, suffix := purl, ""
+	if i := strings.IndexAny(rest, "?#"); i >= 0 {
+		rest, suffix = rest[:i], rest[i:]
+	}
+	rest, _, _ = strings.Cut(rest, "@")
+	return rest + "@" + url.PathEscape(version) + suffix
+}
+
+// major returns the first number of the version
+func major(version string) string {
+	version = strings.TrimPrefix(version, "v")
+	end := strings.IndexFunc(version, func(r rune) bool { return r < '0' || r > '9' })
+	if end < 0 {
+		return version
+	}
+	return version[:end]
+}
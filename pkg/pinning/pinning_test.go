@@ -0,0 +1,152 @@
+package pinning
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/buildsafedev/bsf/pkg/osv"
+)
+
+// testDB has a vulnerability of requests fixed in 2.32.0 and one of urllib3 introduced in 2.0.0
+func testDB(t *testing.T) *osv.DB {
+	t.Helper()
+	db, err := osv.OpenDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, record := range []string{
+		`{"id": "GHSA-requests", "affected": [{"package": {"ecosystem": "PyPI", "name": "requests"},
+			"ranges": [{"type": "ECOSYSTEM", "events": [{"introduced": "0"}, {"fixed": "2.32.0"}]}]}]}`,
+		`{"id": "GHSA-urllib3", "affected": [{"package": {"ecosystem": "PyPI", "name": "urllib3"},
+			"ranges": [{"type": "ECOSYSTEM", "events": [{"introduced": "2.0.0"}, {"fixed": "2.2.2"}]}]}]}`,
+	} {
+		v := &osv.Vulnerability{}
+		if err := json.Unmarshal([]byte(record), v); err != nil {
+			t.Fatal(err)
+		}
+		db.Add(v)
+	}
+	return db
+}
+
+func TestEvaluate(t *testing.T) {
+	db := testDB(t)
+	components := []osv.Component{
+		{Name: "python3.11-requests", Version: "2.31.0", Purl: "pkg:pypi/requests@2.31.0"},
+		{Name: "python3.11-urllib3", Version: "1.26.18", Purl: "pkg:pypi/urllib3@1.26.18"},
+	}
+	current, err := osv.Scan(context.Background(), db, components)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	unstable := Candidate{Branch: "nixos-unstable", Rev: "a", Date: time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)}
+	release := Candidate{Branch: "nixos-24.05", Rev: "b", Date: time.Date(2024, 5, 30, 0, 0, 0, 0, time.UTC)}
+	old := Candidate{Branch: "nixos-23.11", Rev: "c", Date: time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)}
+	recs := make([]Recommendation, 0, 3)
+	for _, tt := range []struct {
+		c        Candidate
+		versions map[string]string
+	}{
+		// unstable fixes requests but moves urllib3 to a vulnerable major version
+		{unstable, map[string]string{"python3.11-requests": "2.32.3", "python3.11-urllib3": "2.0.7"}},
+		{release, map[string]string{"python3.11-requests": "2.32.3", "python3.11-urllib3": "1.26.18"}},
+		{old, map[string]string{"python3.11-requests": "2.31.0"}},
+	} {
+		rec, err := Evaluate(context.Background(), db, components, current, tt.c, tt.versions)
+		if err != nil {
+			t.Fatal(err)
+		}
+		recs = append(recs, rec)
+	}
+
+	if got := recs[0]; !reflect.DeepEqual(got.Resolved, []string{"GHSA-requests (python3.11-requests)"}) ||
+		!reflect.DeepEqual(got.Introduced, []string{"GHSA-urllib3 (python3.11-urllib3)"}) || got.Remaining != 1 || got.Net() != 0 {
+		t.Errorf("unexpected recommendation of nixos-unstable %+v", got)
+	}
+	if got := recs[0].Jumps; len(got) != 2 || !got[1].Major || got[0].Major {
+		t.Errorf("unexpected jumps %+v", got)
+	}
+
+	Rank(recs)
+	branches := make([]string, 0, len(recs))
+	for _, r := range recs {
+		branches = append(branches, r.Branch)
+	}
+	if want := []string{"nixos-24.05", "nixos-23.11", "nixos-unstable"}; !reflect.DeepEqual(branches, want) {
+		t.Errorf("Rank() = %v, want %v", branches, want)
+	}
+}
+
+func TestBranches(t *testing.T) {
+	tests := []struct {
+		locked string
+		now    time.Time
+		want   []string
+	}{
+		{"", time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), []string{"nixos-unstable", "nixos-23.11", "nixos-23.05"}},
+		{"nixos-23.11", time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC), []string{"nixos-23.11", "nixos-unstable", "nixos-24.05"}},
+		{"nixpkgs-unstable", time.Date(2024, 12, 1, 0, 0, 0, 0, time.UTC), []string{"nixpkgs-unstable", "nixos-unstable", "nixos-24.11", "nixos-24.05"}},
+	}
+	for _, tt := range tests {
+		if got := Branches(tt.locked, tt.now); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Branches(%q, %s) = %v, want %v", tt.locked, tt.now.Format("2006-01"), got, tt.want)
+		}
+	}
+}
+
+func TestWithVersion(t *testing.T) {
+	tests := []struct {
+		purl, version, want string
+	}{
+		{"pkg:pypi/requests@2.31.0", "2.32.3", "pkg:pypi/requests@2.32.3"},
+		{"pkg:golang/golang.org/x/net@v0.22.0?type=module", "v0.23.0", "pkg:golang/golang.org/x/net@v0.23.0?type=module"},
+		{"pkg:npm/lodash", "4.17.21", "pkg:npm/lodash@4.17.21"},
+	}
+	for _, tt := range tests {
+		if got := WithVersion(tt.purl, tt.version); got != tt.want {
+			t.Errorf("WithVersion(%q, %q) = %q, want %q", tt.purl, tt.version, got, tt.want)
+		}
+	}
+}
+
+func TestParseVersions(t *testing.T) {
+	got, err := ParseVersions([]byte(`{"curl": "8.7.1", "python3.11-requests": "2.32.3", "gone": null}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]string{"curl": "8.7.1", "python3.11-requests": "2.32.3"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseVersions() = %v, want %v", got, want)
+	}
+	if !reflect.DeepEqual(attrPaths("python3.11-requests"), []string{"python3.11-requests", "python3Packages.requests"}) {
+		t.Errorf("attrPaths() = %v", attrPaths("python3.11-requests"))
+	}
+}
+
+func TestHead(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/repos/NixOS/nixpkgs/branches/nixos-24.05" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{"name": "nixos-24.05", "commit": {"sha": "abc123", "commit": {"committer": {"date": "2024-06-01T10:00:00Z"}}}}`))
+	}))
+	defer srv.Close()
+
+	g := &GitHub{BaseURL: srv.URL, Repository: "NixOS/nixpkgs", HTTPClient: srv.Client()}
+	c, err := g.Head(context.Background(), "nixos-24.05")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Rev != "abc123" || c.Branch != "nixos-24.05" || !c.Date.Equal(time.Date(2024, 6, 1, 10, 0, 0, 0, time.UTC)) {
+		t.Errorf("Head() = %+v", c)
+	}
+	if _, err := g.Head(context.Background(), "nixos-00.05"); err == nil {
+		t.Error("expected an error for a missing branch")
+	}
+}
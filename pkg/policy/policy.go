@@ -0,0 +1,285 @@
+// Package policy evaluates the license and dependency policy of bsf.hcl against the closure of a build: the licenses
+// components may or may not have, the packages banned from it and how large it may grow, and the hardening its
+// executables must have. Violations are returned as a structured report, bsf build fails on them.
+package policy
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/buildsafedev/bsf/pkg/catalog"
+	"github.com/buildsafedev/bsf/pkg/depgraph"
+	"github.com/buildsafedev/bsf/pkg/hardening"
+	"github.com/buildsafedev/bsf/pkg/hcl2nix"
+	"github.com/buildsafedev/bsf/pkg/nixmeta"
+)
+
+// ReportName is the report of the policy check of bsf build
+const ReportName = "policy.json"
+
+// AttrNarSize is the attribute of the nodes of the closure graph holding the size of the NAR of their store path
+const AttrNarSize = "narSize"
+
+// Rules of the policy
+const (
+	RuleDeniedLicense    = "denied-license"
+	RuleUnallowedLicense = "unallowed-license"
+	RuleMissingLicense   = "missing-license"
+	RuleBannedPackage    = "banned-package"
+	RuleMaxClosureSize   = "max-closure-size"
+	RuleMaxPaths         = "max-paths"
+	// RuleLapsedIgnore is violated by the ignore blocks past their expiry date, they must be renewed or removed
+	RuleLapsedIgnore = "lapsed-ignore"
+	// Rules of the hardening block, violated by the executables of the result
+	RuleHardeningPIE            = "hardening-pie"
+	RuleHardeningRELRO          = "hardening-relro"
+	RuleHardeningNX             = "hardening-nx"
+	RuleHardeningStackProtector = "hardening-stack-protector"
+	RuleHardeningFortify        = "hardening-fortify"
+	RuleHardeningSetuid         = "hardening-setuid"
+	RuleHardeningCapabilities   = "hardening-capabilities"
+)
+
+// IgnoreWarningPeriod is how long before they lapse ignore blocks are reported as expiring
+const IgnoreWarningPeriod = 14 * 24 * time.Hour
+
+// Violation is a violation of a rule of the policy, by a component or by the whole closure
+type Violation struct {
+	Rule string `json:"rule"`
+	// Name, Version and StorePath are the component violating the rule, empty for rules of the closure
+	Name      string `json:"name,omitempty"`
+	Version   string `json:"version,omitempty"`
+	StorePath string `json:"storePath,omitempty"`
+	Message   string `json:"message"`
+	// Ignore is the ignore block excepting the violation, if any
+	Ignore *hcl2nix.Ignore `json:"ignore,omitempty"`
+}
+
+// Report is the check of the closure against the policy
+type Report struct {
+	Passed bool `json:"passed"`
+	// Paths is the number of store paths of the closure, ClosureSize the size of their NARs in bytes
+	Paths       int         `json:"paths"`
+	ClosureSize int64       `json:"closureSize"`
+	Violations  []Violation `json:"violations"`
+	// Ignored are the violations excepted by ignore blocks, they don't fail the check
+	Ignored []Violation `json:"ignored,omitempty"`
+	// Expiring are the ignore blocks lapsing within IgnoreWarningPeriod
+	Expiring []hcl2nix.Ignore `json:"expiring,omitempty"`
+}
+
+// Check checks the closure graph against the policy on the day of now. The results of the build, the roots of the
+// closure, count towards its size but aren't checked as components: bsf.hcl describes them. The violations ignore
+// blocks except are reported apart until the blocks lapse.
+func Check(p *hcl2nix.Policy, graph *depgraph.Graph, now time.Time, results ...string) (*Report, error) {
+	maxBytes, err := p.MaxClosureBytes()
+	if err != nil {
+		return nil, err
+	}
+	bans := make(map[string][]ban)
+	for _, b := range p.Bans {
+		r, err := catalog.ParseRange(b.Versions)
+		if err != nil {
+			return nil, fmt.Errorf("ban %s: %v", b.Name, err)
+		}
+		bans[b.Name] = append(bans[b.Name], ban{Ban: b, versions: r})
+	}
+	allowed := set(p.AllowedLicenses)
+	denied := set(p.DeniedLicenses)
+	isResult := set(results)
+
+	report := &Report{Violations: make([]Violation, 0)}
+	unsized := 0
+	for _, node := range graph.Nodes {
+		report.Paths++
+		if size, err := strconv.ParseInt(node.Attrs[AttrNarSize], 10, 64); err == nil {
+			report.ClosureSize += size
+		} else {
+			unsized++
+		}
+
+		name, version := node.Attrs["name"], node.Attrs["version"]
+		if name == "" || isResult[node.StorePath()] {
+			continue
+		}
+		violation := func(rule, msg string) {
+			report.Violations = append(report.Violations, Violation{Rule: rule, Name: name, Version: version, StorePath: node.StorePath(), Message: msg})
+		}
+
+		for _, b := range bans[name] {
+			if b.versions.Contains(version) {
+				msg := fmt.Sprintf("%s %s is banned", name, version)
+				if b.Reason != "" {
+					msg += ": " + b.Reason
+				}
+				violation(RuleBannedPackage, msg)
+			}
+		}
+
+		licenses := licenses(node.Attrs)
+		if len(licenses) == 0 {
+			if p.RequireLicenses {
+				violation(RuleMissingLicense, fmt.Sprintf("%s %s has no license metadata", name, version))
+			}
+			continue
+		}
+		// components with several licenses are under each of them
+		for _, l := range licenses {
+			if denied[l] {
+				violation(RuleDeniedLicense, fmt.Sprintf("%s %s is licensed under %s, which is denied", name, version, l))
+			} else if len(allowed) > 0 && !allowed[l] {
+				violation(RuleUnallowedLicense, fmt.Sprintf("%s %s is licensed under %s, which is not allowed", name, version, l))
+			}
+		}
+	}
+
+	if p.MaxPaths > 0 && report.Paths > p.MaxPaths {
+		report.Violations = append(report.Violations, Violation{
+			Rule:    RuleMaxPaths,
+			Message: fmt.Sprintf("the closure has %d store paths, the policy allows %d", report.Paths, p.MaxPaths),
+		})
+	}
+	if maxBytes > 0 {
+		if unsized > 0 {
+			return nil, fmt.Errorf("max_closure_size can't be checked, the size of %d paths is unknown", unsized)
+		}
+		if report.ClosureSize > maxBytes {
+			report.Violations = append(report.Violations, Violation{
+				Rule:    RuleMaxClosureSize,
+				Message: fmt.Sprintf("the closure is %d bytes, the policy allows %s", report.ClosureSize, p.MaxClosureSize),
+			})
+		}
+	}
+
+	report.Violations, report.Ignored = except(report.Violations, p.Ignores, now)
+	for _, i := range p.Ignores {
+		switch {
+		case i.Lapsed(now):
+			name, component := i.Component, i.Component
+			if i.Component == hcl2nix.IgnoreAnyComponent {
+				name, component = "", "every component"
+			}
+			report.Violations = append(report.Violations, Violation{
+				Rule:    RuleLapsedIgnore,
+				Name:    name,
+				Version: i.Version,
+				Message: fmt.Sprintf("the exception to %s for %s, owned by %s, lapsed after %s: renew or remove it", i.Rule, component, i.Owner, i.Expires),
+			})
+		case i.Lapses().Sub(now) <= IgnoreWarningPeriod:
+			report.Expiring = append(report.Expiring, i)
+		}
+	}
+
+	sortViolations(report.Violations)
+	sortViolations(report.Ignored)
+	report.Passed = len(report.Violations) == 0
+	return report, nil
+}
+
+// CheckHardening checks the executables of the result against the hardening block of the policy on the day of now
+// and adds the violations to the report. Violations name the executable, ignore blocks except them by its name.
+func (r *Report) CheckHardening(p *hcl2nix.Policy, binaries *hardening.Report, now time.Time) {
+	h := p.Hardening
+	if h == nil || binaries == nil {
+		return
+	}
+	relroLevels := map[string]int{hardening.RELRONone: 0, hardening.RELROPartial: 1, hardening.RELROFull: 2}
+	allowedCaps := set(h.AllowedCapabilities)
+
+	violations := make([]Violation, 0)
+	for _, b := range binaries.Binaries {
+		name := filepath.Base(b.Path)
+		violation := func(rule, msg string) {
+			violations = append(violations, Violation{Rule: rule, Name: name, StorePath: b.Path, Message: msg})
+		}
+		if h.RequirePIE && !b.PIE {
+			violation(RuleHardeningPIE, fmt.Sprintf("%s is not a position independent executable", b.Path))
+		}
+		if h.RequireRELRO != "" && relroLevels[b.RELRO] < relroLevels[h.RequireRELRO] {
+			violation(RuleHardeningRELRO, fmt.Sprintf("%s has %s RELRO, the policy requires %s", b.Path, b.RELRO, h.RequireRELRO))
+		}
+		if h.RequireNX && !b.NX {
+			violation(RuleHardeningNX, fmt.Sprintf("%s has an executable stack", b.Path))
+		}
+		if h.RequireStackProtector && !b.Go && !b.StackProtector {
+			violation(RuleHardeningStackProtector, fmt.Sprintf("%s was built without stack protector", b.Path))
+		}
+		if h.RequireFortify && !b.Go && !b.Fortify {
+			violation(RuleHardeningFortify, fmt.Sprintf("%s was built without FORTIFY_SOURCE", b.Path))
+		}
+		if h.DenySetuid && (b.Setuid || b.Setgid) {
+			violation(RuleHardeningSetuid, fmt.Sprintf("%s is setuid or setgid", b.Path))
+		}
+		if h.DenyCapabilities {
+			for _, c := range b.Capabilities {
+				if !allowedCaps[c] {
+					violation(RuleHardeningCapabilities, fmt.Sprintf("%s requests %s, which is not allowed", b.Path, c))
+				}
+			}
+		}
+	}
+
+	kept, ignored := except(violations, p.Ignores, now)
+	r.Violations = append(r.Violations, kept...)
+	r.Ignored = append(r.Ignored, ignored...)
+	sortViolations(r.Violations)
+	sortViolations(r.Ignored)
+	r.Passed = len(r.Violations) == 0
+}
+
+// except splits the violations into those no ignore block applies to and those an ignore block, not lapsed on the
+// day of now, excepts
+func except(violations []Violation, ignores []hcl2nix.Ignore, now time.Time) ([]Violation, []Violation) {
+	kept, ignored := make([]Violation, 0, len(violations)), make([]Violation, 0)
+	for _, v := range violations {
+		i := slices.IndexFunc(ignores, func(i hcl2nix.Ignore) bool {
+			return !i.Lapsed(now) && i.Matches(v.Rule, v.Name, v.Version)
+		})
+		if i < 0 {
+			kept = append(kept, v)
+			continue
+		}
+		v.Ignore = &ignores[i]
+		ignored = append(ignored, v)
+	}
+	return kept, ignored
+}
+
+func sortViolations(violations []Violation) {
+	sort.SliceStable(violations, func(i, j int) bool {
+		a, b := violations[i], violations[j]
+		if a.Rule != b.Rule {
+			return a.Rule < b.Rule
+		}
+		return a.StorePath < b.StorePath
+	})
+}
+
+type ban struct {
+	hcl2nix.Ban
+	versions catalog.Range
+}
+
+// licenses returns the SPDX identifiers of the licenses of a node: its own, or those of the packages it wraps
+func licenses(attrs map[string]string) []string {
+	if l := strings.Fields(attrs["licenses"]); len(l) > 0 {
+		return l
+	}
+	if l := attrs["license"]; l != "" {
+		return []string{l}
+	}
+	return strings.Fields(attrs[nixmeta.AttrInheritedLicenses])
+}
+
+func set(values []string) map[string]bool {
+	s := make(map[string]bool, len(values))
+	for _, v := range values {
+		s[v] = true
+	}
+	return s
+}
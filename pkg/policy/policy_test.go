@@ -0,0 +1,230 @@
+package policy
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/buildsafedev/bsf/pkg/depgraph"
+	"github.com/buildsafedev/bsf/pkg/hardening"
+	"github.com/buildsafedev/bsf/pkg/hcl2nix"
+	"github.com/buildsafedev/bsf/pkg/nixmeta"
+)
+
+var now = time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+
+func closure() *depgraph.Graph {
+	g := depgraph.New()
+	g.AddNode("aaaa-app-1.0", map[string]string{"name": "app", "version": "1.0", AttrNarSize: "1000"})
+	g.AddNode("bbbb-openssl-1.1.1w", map[string]string{"name": "openssl", "version": "1.1.1w", "licenses": "OpenSSL", AttrNarSize: "4000"})
+	g.AddNode("cccc-mongodb-7.0", map[string]string{"name": "mongodb", "version": "7.0", "licenses": "SSPL-1.0 Apache-2.0", AttrNarSize: "3000"})
+	g.AddNode("dddd-wrapper-1.0", map[string]string{"name": "wrapper", "version": "1.0", nixmeta.AttrInheritedLicenses: "MIT", AttrNarSize: "500"})
+	g.AddNode("eeee-data-1.0", map[string]string{"name": "data", "version": "1.0", AttrNarSize: "1500"})
+	g.AddEdge("bbbb-openssl-1.1.1w", "aaaa-app-1.0", nil)
+	return g
+}
+
+func TestCheck(t *testing.T) {
+	p := &hcl2nix.Policy{
+		AllowedLicenses: []string{"MIT", "Apache-2.0", "OpenSSL"},
+		DeniedLicenses:  []string{"SSPL-1.0"},
+		MaxClosureSize:  "9KB",
+		MaxPaths:        4,
+		Bans:            []hcl2nix.Ban{{Name: "openssl", Versions: "<3", Reason: "end of life"}, {Name: "zlib"}},
+	}
+	report, err := Check(p, closure(), now, "/nix/store/aaaa-app-1.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Passed || report.Paths != 5 || report.ClosureSize != 10000 {
+		t.Errorf("report = %+v", report)
+	}
+	rules := make([]string, 0, len(report.Violations))
+	for _, v := range report.Violations {
+		rules = append(rules, v.Rule+" "+v.Name)
+	}
+	want := []string{
+		"banned-package openssl",
+		"denied-license mongodb",
+		"max-closure-size ",
+		"max-paths ",
+	}
+	if !reflect.DeepEqual(rules, want) {
+		t.Errorf("violations = %v, want %v", rules, want)
+	}
+	if v := report.Violations[0]; v.Message != "openssl 1.1.1w is banned: end of life" || v.StorePath != "/nix/store/bbbb-openssl-1.1.1w" {
+		t.Errorf("ban violation = %+v", v)
+	}
+
+	// components without licenses only fail when licenses are required
+	p = &hcl2nix.Policy{AllowedLicenses: []string{"OpenSSL", "SSPL-1.0", "Apache-2.0"}, RequireLicenses: true}
+	report, err = Check(p, closure(), now, "/nix/store/aaaa-app-1.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rules = rules[:0]
+	for _, v := range report.Violations {
+		rules = append(rules, v.Rule+" "+v.Name)
+	}
+	want = []string{"missing-license data", "unallowed-license wrapper"}
+	if !reflect.DeepEqual(rules, want) {
+		t.Errorf("violations = %v, want %v", rules, want)
+	}
+
+	report, err = Check(&hcl2nix.Policy{MaxPaths: 5}, closure(), now)
+	if err != nil || !report.Passed {
+		t.Errorf("Check() = %+v, %v, want the closure to comply", report, err)
+	}
+}
+
+func TestCheckErrors(t *testing.T) {
+	if _, err := Check(&hcl2nix.Policy{Bans: []hcl2nix.Ban{{Name: "openssl", Versions: ">="}}}, closure(), now); err == nil {
+		t.Error("Check() with an invalid version range succeeded")
+	}
+
+	g := closure()
+	g.AddNode("ffff-unsized-1.0", nil)
+	if _, err := Check(&hcl2nix.Policy{MaxClosureSize: "1GB"}, g, now); err == nil {
+		t.Error("Check() of the size of a closure with unsized paths succeeded")
+	}
+	if _, err := Check(&hcl2nix.Policy{MaxPaths: 10}, g, now); err != nil {
+		t.Errorf("Check() without a size limit: %v", err)
+	}
+}
+
+func TestCheckIgnores(t *testing.T) {
+	p := &hcl2nix.Policy{
+		DeniedLicenses: []string{"SSPL-1.0"},
+		MaxPaths:       4,
+		Bans:           []hcl2nix.Ban{{Name: "openssl", Versions: "<3"}},
+		Ignores: []hcl2nix.Ignore{
+			{Component: "openssl", Rule: "banned-package", Version: "1.1.1w", Owner: "security@example.com", Expires: "2025-06-10"},
+			// the rule of the ignore block is another one than the violation's
+			{Component: "mongodb", Rule: "banned-package", Owner: "security@example.com", Expires: "2025-12-31"},
+			{Component: "*", Rule: "max-paths", Owner: "platform@example.com", Expires: "2025-05-31"},
+		},
+	}
+	tests := []struct {
+		name     string
+		now      time.Time
+		rules    []string
+		ignored  []string
+		expiring []string
+	}{
+		{
+			name:     "ignore blocks near expiry",
+			now:      now,
+			rules:    []string{"denied-license mongodb", "lapsed-ignore ", "max-paths "},
+			ignored:  []string{"banned-package openssl"},
+			expiring: []string{"openssl"},
+		},
+		{
+			name:    "last day of an ignore block",
+			now:     time.Date(2025, 5, 31, 23, 0, 0, 0, time.UTC),
+			rules:   []string{"denied-license mongodb"},
+			ignored: []string{"banned-package openssl", "max-paths "},
+			// both lapse within the warning period
+			expiring: []string{"openssl", "*"},
+		},
+		{
+			name:     "lapsed ignore blocks",
+			now:      time.Date(2025, 6, 11, 0, 0, 0, 0, time.UTC),
+			rules:    []string{"banned-package openssl", "denied-license mongodb", "lapsed-ignore openssl", "lapsed-ignore ", "max-paths "},
+			ignored:  []string{},
+			expiring: []string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report, err := Check(p, closure(), tt.now, "/nix/store/aaaa-app-1.0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			names := func(violations []Violation) []string {
+				rules := make([]string, 0, len(violations))
+				for _, v := range violations {
+					rules = append(rules, v.Rule+" "+v.Name)
+				}
+				return rules
+			}
+			if got := names(report.Violations); !reflect.DeepEqual(got, tt.rules) {
+				t.Errorf("violations = %v, want %v", got, tt.rules)
+			}
+			if got := names(report.Ignored); !reflect.DeepEqual(got, tt.ignored) {
+				t.Errorf("ignored = %v, want %v", got, tt.ignored)
+			}
+			expiring := make([]string, 0)
+			for _, i := range report.Expiring {
+				expiring = append(expiring, i.Component)
+			}
+			if !reflect.DeepEqual(expiring, tt.expiring) {
+				t.Errorf("expiring = %v, want %v", expiring, tt.expiring)
+			}
+			if report.Passed {
+				t.Error("the check of a violating closure passed")
+			}
+		})
+	}
+
+	report, err := Check(p, closure(), now, "/nix/store/aaaa-app-1.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := report.Ignored[0]; v.Ignore == nil || v.Ignore.Owner != "security@example.com" {
+		t.Errorf("the ignored violation doesn't name its ignore block: %+v", v)
+	}
+}
+
+func TestCheckHardening(t *testing.T) {
+	binaries := &hardening.Report{Binaries: []hardening.Binary{
+		{Path: "/nix/store/aaaa-app-1.0/bin/app", PIE: true, RELRO: hardening.RELROFull, NX: true, StackProtector: true, Fortify: true},
+		{Path: "/nix/store/aaaa-app-1.0/bin/legacy", RELRO: hardening.RELROPartial, NX: true},
+		{Path: "/nix/store/aaaa-app-1.0/bin/server", Go: true, RELRO: hardening.RELRONone, NX: true, Capabilities: []string{"cap_net_bind_service", "cap_sys_admin"}},
+		{Path: "/nix/store/aaaa-app-1.0/bin/helper", PIE: true, RELRO: hardening.RELROFull, Setuid: true, StackProtector: true, Fortify: true},
+	}}
+	p := &hcl2nix.Policy{
+		Hardening: &hcl2nix.Hardening{
+			RequirePIE:            true,
+			RequireRELRO:          "full",
+			RequireNX:             true,
+			RequireStackProtector: true,
+			RequireFortify:        true,
+			DenySetuid:            true,
+			DenyCapabilities:      true,
+			AllowedCapabilities:   []string{"cap_net_bind_service"},
+		},
+		Ignores: []hcl2nix.Ignore{{Component: "server", Rule: RuleHardeningPIE, Owner: "security@example.com", Expires: "2025-12-31"}},
+	}
+
+	report := &Report{Passed: true, Violations: make([]Violation, 0)}
+	report.CheckHardening(p, binaries, now)
+	got := make([]string, 0, len(report.Violations))
+	for _, v := range report.Violations {
+		got = append(got, v.Rule+" "+v.Name)
+	}
+	want := []string{
+		"hardening-capabilities server",
+		"hardening-fortify legacy",
+		"hardening-nx helper",
+		"hardening-pie legacy",
+		"hardening-relro legacy",
+		"hardening-relro server",
+		"hardening-setuid helper",
+		"hardening-stack-protector legacy",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("violations = %v, want %v", got, want)
+	}
+	if len(report.Ignored) != 1 || report.Ignored[0].Name != "server" {
+		t.Errorf("ignored = %+v, want the PIE violation of server", report.Ignored)
+	}
+	if report.Passed {
+		t.Error("the check of violating executables passed")
+	}
+
+	report = &Report{Passed: true, Violations: make([]Violation, 0)}
+	report.CheckHardening(&hcl2nix.Policy{}, binaries, now)
+	if !report.Passed || len(report.Violations) != 0 {
+		t.Errorf("a policy without hardening block checked the executables: %+v", report)
+	}
+}
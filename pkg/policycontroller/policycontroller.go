@@ -0,0 +1,182 @@
+package policycontroller
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/buildsafedev/bsf/pkg/hcl2nix"
+)
+
+const (
+	fulcioURL = "https://fulcio.sigstore.dev"
+	rekorURL  = "https://rekor.sigstore.dev"
+)
+
+// predicateTypes maps the short attestation names used by bsf to the predicate types bsf writes
+var predicateTypes = map[string]string{
+	"provenance": "https://slsa.dev/provenance/v1",
+	"spdx":       "https://spdx.github.io/spdx-spec/v2.3/",
+	"cdx":        "https://cyclonedx.org/specification/overview/",
+	"vuln":       "https://in-toto.io/attestation/vulns",
+}
+
+// ClusterImagePolicy is the policy-controller resource describing how images should be verified
+type ClusterImagePolicy struct {
+	APIVersion string   `yaml:"apiVersion"`
+	Kind       string   `yaml:"kind"`
+	Metadata   Metadata `yaml:"metadata"`
+	Spec       Spec     `yaml:"spec"`
+}
+
+// Metadata of the policy
+type Metadata struct {
+	Name string `yaml:"name"`
+}
+
+// Spec of the policy
+type Spec struct {
+	Images      []ImagePattern `yaml:"images"`
+	Authorities []Authority    `yaml:"authorities"`
+}
+
+// ImagePattern selects the images the policy applies to
+type ImagePattern struct {
+	Glob string `yaml:"glob"`
+}
+
+// Authority describes who is allowed to sign the images
+type Authority struct {
+	Name         string        `yaml:"name"`
+	Keyless      *Keyless      `yaml:"keyless,omitempty"`
+	Key          *Key          `yaml:"key,omitempty"`
+	CTLog        *CTLog        `yaml:"ctlog,omitempty"`
+	Attestations []Attestation `yaml:"attestations,omitempty"`
+}
+
+// Keyless holds the fulcio identities allowed to sign
+type Keyless struct {
+	URL        string     `yaml:"url"`
+	Identities []Identity `yaml:"identities"`
+}
+
+// Identity is an OIDC issuer and subject pair
+type Identity struct {
+	Issuer  string `yaml:"issuer"`
+	Subject string `yaml:"subject"`
+}
+
+// Key holds a public key used to verify signatures
+type Key struct {
+	Data string `yaml:"data"`
+}
+
+// CTLog is the transparency log to verify against
+type CTLog struct {
+	URL string `yaml:"url"`
+}
+
+// Attestation is an attestation that must be present on the image
+type Attestation struct {
+	Name          string `yaml:"name"`
+	PredicateType string `yaml:"predicateType"`
+}
+
+// NewClusterImagePolicy creates a ClusterImagePolicy for the oci artifact based on the signing config
+func NewClusterImagePolicy(env hcl2nix.OCIArtifact, signing *hcl2nix.Signing) (*ClusterImagePolicy, error) {
+	if signing == nil {
+		return nil, fmt.Errorf("signing block is not defined in bsf.hcl")
+	}
+	if errStr := signing.Validate(); errStr != nil {
+		return nil, fmt.Errorf(*errStr)
+	}
+
+	attestations := signing.Attestations
+	if len(attestations) == 0 {
+		attestations = []string{"provenance", "spdx"}
+	}
+
+	auth := Authority{
+		Name: "bsf",
+		CTLog: &CTLog{
+			URL: rekorURL,
+		},
+	}
+	for _, a := range attestations {
+		pt, ok := predicateTypes[a]
+		if !ok {
+			return nil, fmt.Errorf("unknown attestation %s, valid attestations are provenance, spdx, cdx and vuln", a)
+		}
+		auth.Attestations = append(auth.Attestations, Attestation{
+			Name:          "must-have-" + a,
+			PredicateType: pt,
+		})
+	}
+
+	if signing.Key != "" {
+		key, err := os.ReadFile(signing.Key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read public key: %v", err)
+		}
+		auth.Key = &Key{Data: string(key)}
+	} else {
+		auth.Keyless = &Keyless{
+			URL: fulcioURL,
+			Identities: []Identity{
+				{
+					Issuer:  signing.Issuer,
+					Subject: signing.Subject,
+				},
+			},
+		}
+	}
+
+	return &ClusterImagePolicy{
+		APIVersion: "policy.sigstore.dev/v1beta1",
+		Kind:       "ClusterImagePolicy",
+		Metadata: Metadata{
+			Name: "bsf-" + strings.ToLower(env.Environment),
+		},
+		Spec: Spec{
+			Images:      imagePatterns(env.Name),
+			Authorities: []Authority{auth},
+		},
+	}, nil
+}
+
+// Write writes the policy as YAML
+func (p *ClusterImagePolicy) Write(w io.Writer) error {
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(p); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// imagePatterns returns the globs matching every tag and digest of the image repository, and none of the repositories
+// whose names it prefixes
+func imagePatterns(image string) []ImagePattern {
+	repo := image
+	if i := strings.Index(repo, "@"); i != -1 {
+		repo = repo[:i]
+	}
+	// a colon after the last slash separates the tag, otherwise it is a registry port
+	if i := strings.LastIndex(repo, ":"); i != -1 && i > strings.LastIndex(repo, "/") {
+		repo = repo[:i]
+	}
+
+	parts := strings.SplitN(repo, "/", 2)
+	isRegistry := len(parts) == 2 && (strings.ContainsAny(parts[0], ".:") || parts[0] == "localhost")
+	if !isRegistry {
+		if len(parts) == 1 {
+			repo = "library/" + repo
+		}
+		repo = "index.docker.io/" + repo
+	}
+
+	return []ImagePattern{{Glob: repo + ":**"}, {Glob: repo + "@**"}}
+}
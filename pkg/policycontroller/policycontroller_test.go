@@ -0,0 +1,121 @@
+package policycontroller
+
+import (
+	"bytes"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/buildsafedev/bsf/pkg/hcl2nix"
+)
+
+func TestImagePatterns(t *testing.T) {
+	tests := []struct {
+		name  string
+		image string
+		want  []string
+	}{
+		{
+			name:  "registry with tag",
+			image: "ttl.sh/myproject/app:1h",
+			want:  []string{"ttl.sh/myproject/app:**", "ttl.sh/myproject/app@**"},
+		},
+		{
+			name:  "registry with port",
+			image: "localhost:5000/app",
+			want:  []string{"localhost:5000/app:**", "localhost:5000/app@**"},
+		},
+		{
+			name:  "docker hub official image",
+			image: "caddy:2.7.6",
+			want:  []string{"index.docker.io/library/caddy:**", "index.docker.io/library/caddy@**"},
+		},
+		{
+			name:  "docker hub user image with digest",
+			image: "buildsafe/app@sha256:abcd",
+			want:  []string{"index.docker.io/buildsafe/app:**", "index.docker.io/buildsafe/app@**"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := make([]string, 0)
+			for _, p := range imagePatterns(tt.image) {
+				got = append(got, p.Glob)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("imagePatterns() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestImagePatternsMatch(t *testing.T) {
+	patterns := imagePatterns("ghcr.io/org/app:v1")
+	tests := []struct {
+		image string
+		want  bool
+	}{
+		{image: "ghcr.io/org/app:v1", want: true},
+		{image: "ghcr.io/org/app:v2", want: true},
+		{image: "ghcr.io/org/app@sha256:abcd", want: true},
+		{image: "ghcr.io/org/app-internal:v1", want: false},
+		{image: "ghcr.io/org/app2@sha256:abcd", want: false},
+		{image: "ghcr.io/org/app/debug:v1", want: false},
+	}
+
+	for _, tt := range tests {
+		matched := false
+		for _, p := range patterns {
+			// policy-controller globs match ** across slashes
+			re := regexp.MustCompile("^" + strings.ReplaceAll(regexp.QuoteMeta(p.Glob), `\*\*`, ".*") + "$")
+			matched = matched || re.MatchString(tt.image)
+		}
+		if matched != tt.want {
+			t.Errorf("%s matched %v, want %v", tt.image, matched, tt.want)
+		}
+	}
+}
+
+func TestNewClusterImagePolicy(t *testing.T) {
+	env := hcl2nix.OCIArtifact{Environment: "prod", Name: "ghcr.io/buildsafedev/app:v1"}
+
+	_, err := NewClusterImagePolicy(env, nil)
+	if err == nil {
+		t.Errorf("expected error when signing block is missing")
+	}
+
+	_, err = NewClusterImagePolicy(env, &hcl2nix.Signing{Issuer: "https://token.actions.githubusercontent.com"})
+	if err == nil {
+		t.Errorf("expected error when subject is missing")
+	}
+
+	p, err := NewClusterImagePolicy(env, &hcl2nix.Signing{
+		Issuer:       "https://token.actions.githubusercontent.com",
+		Subject:      "https://github.com/buildsafedev/app/.github/workflows/release.yml@refs/heads/main",
+		Attestations: []string{"provenance", "cdx"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := p.Write(&buf); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, want := range []string{
+		"kind: ClusterImagePolicy",
+		"name: bsf-prod",
+		"glob: ghcr.io/buildsafedev/app:**",
+		"glob: ghcr.io/buildsafedev/app@**",
+		"issuer: https://token.actions.githubusercontent.com",
+		"predicateType: https://slsa.dev/provenance/v1",
+		"predicateType: https://cyclonedx.org/specification/overview/",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("policy does not contain %q:\n%s", want, buf.String())
+		}
+	}
+}
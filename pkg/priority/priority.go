@@ -0,0 +1,77 @@
+// Package priority lowers the CPU and IO priority of bsf and the commands it runs, so generating SBOMs on a shared
+// build server doesn't starve concurrent builds. The priority is inherited by the nix commands bsf starts.
+package priority
+
+import (
+	"fmt"
+	"strings"
+)
+
+// IOClass is the IO scheduling class, see ionice(1)
+type IOClass int
+
+const (
+	// IONone leaves the IO priority as is
+	IONone IOClass = iota
+	// IORealtime gets the disk first, it requires root
+	IORealtime
+	// IOBestEffort is the default class, its level goes from 0 (highest) to 7 (lowest)
+	IOBestEffort
+	// IOIdle only gets the disk when no other process needs it
+	IOIdle
+)
+
+// Options is the priority of the run
+type Options struct {
+	// Nice is the niceness of the process, from -20 to 19. 0 leaves it as is.
+	Nice int
+	// IOClass is the IO scheduling class
+	IOClass IOClass
+	// IOLevel is the level within the best-effort and realtime classes, from 0 to 7
+	IOLevel int
+}
+
+// ParseIOClass parses the name of an IO class as ionice(1) names them: idle, best-effort or realtime.
+// The level of the best-effort and realtime classes can follow a colon, e.g. best-effort:7.
+func ParseIOClass(s string) (IOClass, int, error) {
+	name, level, hasLevel := strings.Cut(s, ":")
+	l := 4
+	if hasLevel {
+		if _, err := fmt.Sscanf(level, "%d", &l); err != nil || l < 0 || l > 7 {
+			return IONone, 0, fmt.Errorf("invalid io level %q, it goes from 0 to 7", level)
+		}
+	}
+
+	switch name {
+	case "":
+		return IONone, 0, nil
+	case "idle":
+		if hasLevel {
+			return IONone, 0, fmt.Errorf("the idle io class has no level")
+		}
+		return IOIdle, 0, nil
+	case "best-effort":
+		return IOBestEffort, l, nil
+	case "realtime":
+		return IORealtime, l, nil
+	}
+	return IONone, 0, fmt.Errorf("unknown io class %q, expected idle, best-effort or realtime", name)
+}
+
+// Apply sets the priority of the process
+func Apply(opts Options) error {
+	if opts.Nice < -20 || opts.Nice > 19 {
+		return fmt.Errorf("invalid niceness %d, it goes from -20 to 19", opts.Nice)
+	}
+	if opts.Nice != 0 {
+		if err := setNice(opts.Nice); err != nil {
+			return fmt.Errorf("failed to set the niceness: %w", err)
+		}
+	}
+	if opts.IOClass != IONone {
+		if err := setIOPriority(opts.IOClass, opts.IOLevel); err != nil {
+			return fmt.Errorf("failed to set the io priority: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package priority
+
+import (
+	"os"
+	"strconv"
+	"syscall"
+)
+
+const (
+	ioprioWhoProcess = 1
+	ioprioClassShift = 13
+)
+
+// setNice sets the niceness of each thread of the process, Linux sets it per thread and new threads inherit the
+// niceness of the thread creating them
+func setNice(nice int) error {
+	return eachThread(func(tid int) error {
+		return syscall.Setpriority(syscall.PRIO_PROCESS, tid, nice)
+	})
+}
+
+func setIOPriority(class IOClass, level int) error {
+	prio := int(class)<<ioprioClassShift | level
+	return eachThread(func(tid int) error {
+		_, _, errno := syscall.Syscall(syscall.SYS_IOPRIO_SET, ioprioWhoProcess, uintptr(tid), uintptr(prio))
+		if errno != 0 {
+			return errno
+		}
+		return nil
+	})
+}
+
+func eachThread(f func(tid int) error) error {
+	tasks, err := os.ReadDir("/proc/self/task")
+	if err != nil {
+		return f(0)
+	}
+	for _, t := range tasks {
+		tid, err := strconv.Atoi(t.Name())
+		if err != nil {
+			continue
+		}
+		// threads may exit while we go through them
+		if err := f(tid); err != nil && err != syscall.ESRCH {
+			return err
+		}
+	}
+	return nil
+}
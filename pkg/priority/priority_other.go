@@ -0,0 +1,16 @@
+//go:build !linux
+
+package priority
+
+import (
+	"errors"
+	"syscall"
+)
+
+func setNice(nice int) error {
+	return syscall.Setpriority(syscall.PRIO_PROCESS, 0, nice)
+}
+
+func setIOPriority(class IOClass, level int) error {
+	return errors.New("io priorities are only supported on Linux")
+}
@@ -0,0 +1,38 @@
+package priority
+
+import "testing"
+
+func TestParseIOClass(t *testing.T) {
+	tests := []struct {
+		in      string
+		class   IOClass
+		level   int
+		wantErr bool
+	}{
+		{in: "", class: IONone},
+		{in: "idle", class: IOIdle},
+		{in: "best-effort", class: IOBestEffort, level: 4},
+		{in: "best-effort:7", class: IOBestEffort, level: 7},
+		{in: "realtime:0", class: IORealtime, level: 0},
+		{in: "best-effort:8", wantErr: true},
+		{in: "idle:3", wantErr: true},
+		{in: "fast", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		class, level, err := ParseIOClass(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseIOClass(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if class != tt.class || level != tt.level {
+			t.Errorf("ParseIOClass(%q) = %v, %d, want %v, %d", tt.in, class, level, tt.class, tt.level)
+		}
+	}
+}
+
+func TestApplyInvalidNice(t *testing.T) {
+	if err := Apply(Options{Nice: 20}); err == nil {
+		t.Errorf("expected an error for a niceness out of range")
+	}
+}
@@ -0,0 +1,123 @@
+// Package profile bundles the defaults of the flags of bsf commands for an environment, e.g. quick annotation in
+// development or signed, scanned and pushed builds for releases, so they needn't be repeated on every invocation.
+package profile
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/spf13/pflag"
+)
+
+// AllCommands are the flags a profile sets for every command that has them, e.g. nice
+const AllCommands = "*"
+
+// Profile is the defaults of the flags of the commands for an environment
+type Profile struct {
+	Description string `json:"description,omitempty"`
+	// Flags are the values of the flags by command, the command path without bsf, e.g. build or receipt verify
+	Flags map[string]map[string]string `json:"flags"`
+}
+
+// Builtin are the profiles bsf knows without configuration. Profiles of the same name in ~/.bsf.json override
+// their flags.
+var Builtin = map[string]Profile{
+	"dev": {
+		Description: "quick builds: only the top levels of the closure are fully annotated",
+		Flags: map[string]map[string]string{
+			"build": {"quick": "true"},
+		},
+	},
+	"ci": {
+		Description: "verified inputs and a vulnerability scan failing on critical vulnerabilities",
+		Flags: map[string]map[string]string{
+			"build": {"verify-inputs": "true", "scan": "true", "fail-on": "critical"},
+		},
+	},
+	"release": {
+		Description: "fully annotated builds with signed inputs, their build closure, a scan failing on high vulnerabilities, signed attestations and pushed images",
+		Flags: map[string]map[string]string{
+			"build": {"verify-signatures": "true", "build-closure": "true", "scan": "true", "fail-on": "high", "sign": "true"},
+			"oci":   {"push": "true"},
+		},
+	},
+	"airgapped": {
+		Description: "no substitution of garbage collected paths, metadata left pending for bsf enrich after a short wait, receipts verified offline",
+		Flags: map[string]map[string]string{
+			"build":          {"no-realise": "true", "enrich-timeout": "5s"},
+			"receipt verify": {"offline": "true"},
+		},
+	},
+}
+
+// Resolve returns the profile of the name, the builtin profile with the flags of the custom one of the same name
+func Resolve(name string, custom map[string]Profile) (Profile, error) {
+	b, isBuiltin := Builtin[name]
+	c, isCustom := custom[name]
+	if !isBuiltin && !isCustom {
+		return Profile{}, fmt.Errorf("unknown profile %q, profiles are %s", name, strings.Join(Names(custom), ", "))
+	}
+
+	p := Profile{Description: b.Description, Flags: make(map[string]map[string]string)}
+	if c.Description != "" {
+		p.Description = c.Description
+	}
+	for _, flags := range []map[string]map[string]string{b.Flags, c.Flags} {
+		for command, values := range flags {
+			if p.Flags[command] == nil {
+				p.Flags[command] = make(map[string]string)
+			}
+			for name, value := range values {
+				p.Flags[command][name] = value
+			}
+		}
+	}
+	return p, nil
+}
+
+// Names returns the names of the builtin and custom profiles, sorted
+func Names(custom map[string]Profile) []string {
+	names := make([]string, 0, len(Builtin)+len(custom))
+	for name := range Builtin {
+		names = append(names, name)
+	}
+	for name := range custom {
+		if _, ok := Builtin[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Apply sets the flags of the command the profile has a value for and that weren't given, and returns their names,
+// sorted. The flags the profile sets for the command must exist, the ones it sets for every command are skipped by the
+// commands without them.
+func (p Profile) Apply(fs *pflag.FlagSet, command string) ([]string, error) {
+	values := make(map[string]string)
+	for name, value := range p.Flags[AllCommands] {
+		if fs.Lookup(name) != nil {
+			values[name] = value
+		}
+	}
+	for name, value := range p.Flags[command] {
+		if fs.Lookup(name) == nil {
+			return nil, fmt.Errorf("bsf %s has no --%s flag", command, name)
+		}
+		values[name] = value
+	}
+
+	applied := make([]string, 0, len(values))
+	for name, value := range values {
+		if fs.Changed(name) {
+			continue
+		}
+		if err := fs.Set(name, value); err != nil {
+			return nil, fmt.Errorf("invalid value %q of --%s: %v", value, name, err)
+		}
+		applied = append(applied, name)
+	}
+	sort.Strings(applied)
+	return applied, nil
+}
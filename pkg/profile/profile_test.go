@@ -0,0 +1,73 @@
+package profile
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/spf13/pflag"
+)
+
+func TestResolve(t *testing.T) {
+	custom := map[string]Profile{
+		"release": {Flags: map[string]map[string]string{"build": {"fail-on": "critical", "deep": "true"}}},
+		"nightly": {Description: "nightly builds", Flags: map[string]map[string]string{"build": {"scan": "true"}}},
+	}
+
+	p, err := Resolve("release", custom)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := p.Flags["build"]; b["fail-on"] != "critical" || b["deep"] != "true" || b["sign"] != "true" {
+		t.Errorf("the custom release profile should override the builtin one, got %v", b)
+	}
+	if p.Flags["oci"]["push"] != "true" || p.Description != Builtin["release"].Description {
+		t.Errorf("unexpected release profile %+v", p)
+	}
+	// the builtin profile is left as is
+	if Builtin["release"].Flags["build"]["fail-on"] != "high" {
+		t.Error("Resolve() changed the builtin profile")
+	}
+
+	if p, err := Resolve("nightly", custom); err != nil || p.Flags["build"]["scan"] != "true" {
+		t.Errorf("Resolve(nightly) = %+v, %v", p, err)
+	}
+	if _, err := Resolve("staging", custom); err == nil {
+		t.Error("Resolve() accepted an unknown profile")
+	}
+	if got, want := Names(custom), []string{"airgapped", "ci", "dev", "nightly", "release"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Names() = %v, want %v", got, want)
+	}
+}
+
+func TestApply(t *testing.T) {
+	p := Profile{Flags: map[string]map[string]string{
+		AllCommands: {"nice": "10", "chunk-size": "64"},
+		"build":     {"quick": "true", "format": "spdx-json", "scan": "true"},
+	}}
+
+	fs := pflag.NewFlagSet("build", pflag.ContinueOnError)
+	nice := fs.Int("nice", 0, "")
+	quick := fs.Bool("quick", false, "")
+	format := fs.StringSlice("format", []string{"spdx-json", "cyclonedx-json"}, "")
+	scan := fs.Bool("scan", false, "")
+	if err := fs.Parse([]string{"--scan=false"}); err != nil {
+		t.Fatal(err)
+	}
+
+	applied, err := p.Apply(fs, "build")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the flags given override the profile, the flags of every command are skipped by the commands without them
+	if want := []string{"format", "nice", "quick"}; !reflect.DeepEqual(applied, want) {
+		t.Errorf("Apply() = %v, want %v", applied, want)
+	}
+	if *nice != 10 || !*quick || *scan || !reflect.DeepEqual(*format, []string{"spdx-json"}) {
+		t.Errorf("unexpected flags nice=%d quick=%t scan=%t format=%v", *nice, *quick, *scan, *format)
+	}
+
+	p.Flags["build"]["quik"] = "true"
+	if _, err := p.Apply(pflag.NewFlagSet("build", pflag.ContinueOnError), "build"); err == nil {
+		t.Error("Apply() accepted a flag the command doesn't have")
+	}
+}
@@ -3,6 +3,8 @@ package provenance
 import (
 	"context"
 	"encoding/json"
+	"fmt"
+	"time"
 
 	"github.com/awalterschulze/gographviz"
 	intoto "github.com/in-toto/in-toto-golang/in_toto"
@@ -11,14 +13,18 @@ import (
 	"github.com/nix-community/go-nix/pkg/derivation/store"
 	"google.golang.org/protobuf/types/known/structpb"
 
+	"github.com/buildsafedev/bsf/pkg/buildhost"
+	"github.com/buildsafedev/bsf/pkg/egress"
+	"github.com/buildsafedev/bsf/pkg/flakelock"
 	nixcmd "github.com/buildsafedev/bsf/pkg/nix/cmd"
 	slsav1 "github.com/buildsafedev/bsf/pkg/slsa/v1"
+	"github.com/buildsafedev/bsf/pkg/workload"
 )
 
 // Statement is a struct to hold the provenance statement
 type Statement struct {
 	intoto.StatementHeader
-	Predicate slsav1.Provenance
+	Predicate *slsav1.Provenance
 }
 
 // NewStatement creates a new provenance statement
@@ -40,6 +46,12 @@ func NewStatement(appDetails *nixcmd.App) *Statement {
 			},
 		},
 	}
+	for _, d := range appDetails.ArtifactDigests() {
+		st.Subject = append(st.Subject, intoto.Subject{
+			Name:   d.Name,
+			Digest: intotoCom.DigestSet{"sha256": d.Digest},
+		})
+	}
 	return &st
 }
 
@@ -91,7 +103,7 @@ func (s *Statement) FromDerivationClosure(drvPath string, drv *derivation.Deriva
 		},
 	}
 
-	s.Predicate = prov
+	s.Predicate = &prov
 
 	return nil
 }
@@ -121,6 +133,147 @@ func graphToResourceDes(graph *gographviz.Graph) []*slsav1.ResourceDescriptor {
 	return rds
 }
 
+// AddFlakeInputs records the verified flake inputs as resolved dependencies of the build
+func (s *Statement) AddFlakeInputs(inputs []flakelock.Verification) error {
+	if s.Predicate == nil || s.Predicate.BuildDefinition == nil {
+		return fmt.Errorf("provenance has no build definition")
+	}
+
+	for _, in := range inputs {
+		digest := make(map[string]string)
+		if in.Rev != "" {
+			digest["gitCommit"] = in.Rev
+		}
+		narHash, err := flakelock.SRIToHex(in.NarHash)
+		if err == nil {
+			digest["sha256"] = narHash
+		}
+
+		fields := map[string]*structpb.Value{
+			"narHashVerified": structpb.NewBoolValue(in.NarHashVerified),
+		}
+		if in.Signature != "" {
+			fields["signature"] = structpb.NewStringValue(in.Signature)
+		}
+
+		s.Predicate.BuildDefinition.ResolvedDependencies = append(s.Predicate.BuildDefinition.ResolvedDependencies, &slsav1.ResourceDescriptor{
+			Uri:         in.Ref,
+			Name:        in.Input,
+			Digest:      digest,
+			Annotations: &structpb.Struct{Fields: fields},
+		})
+	}
+
+	return nil
+}
+
+// AddWorkloadIdentity records the CI workload identity that ran the build as the builder and invocation of the provenance
+func (s *Statement) AddWorkloadIdentity(id *workload.Identity) error {
+	if s.Predicate == nil || s.Predicate.RunDetails == nil || s.Predicate.RunDetails.Builder == nil {
+		return fmt.Errorf("provenance has no run details")
+	}
+
+	s.Predicate.RunDetails.Builder.Id = id.BuilderID
+	s.Predicate.RunDetails.Metadata = &slsav1.BuildMetadata{
+		InvocationId: id.InvocationID,
+	}
+
+	claims, err := structpb.NewStruct(map[string]interface{}{
+		"provider": id.Provider,
+		"issuer":   id.Issuer,
+		"subject":  id.Subject,
+		"claims":   id.Claims,
+	})
+	if err != nil {
+		return err
+	}
+	if s.Predicate.BuildDefinition.InternalParameters == nil {
+		s.Predicate.BuildDefinition.InternalParameters = &structpb.Struct{Fields: make(map[string]*structpb.Value)}
+	}
+	s.Predicate.BuildDefinition.InternalParameters.Fields["workloadIdentity"] = structpb.NewStructValue(claims)
+
+	return nil
+}
+
+// AddEnvironment records the effective environment of the nix commands of the build
+func (s *Statement) AddEnvironment(env nixcmd.EnvironmentRecord) error {
+	if s.Predicate == nil || s.Predicate.BuildDefinition == nil {
+		return fmt.Errorf("provenance has no build definition")
+	}
+
+	data, err := json.Marshal(env)
+	if err != nil {
+		return err
+	}
+	fields := &structpb.Struct{}
+	if err := fields.UnmarshalJSON(data); err != nil {
+		return err
+	}
+	if s.Predicate.BuildDefinition.InternalParameters == nil {
+		s.Predicate.BuildDefinition.InternalParameters = &structpb.Struct{Fields: make(map[string]*structpb.Value)}
+	}
+	s.Predicate.BuildDefinition.InternalParameters.Fields["environment"] = structpb.NewStructValue(fields)
+	return nil
+}
+
+// AddBuilder records the fingerprint of the host and nix installation that built, the version of nix as the version
+// of the builder
+func (s *Statement) AddBuilder(f *buildhost.Fingerprint) error {
+	if s.Predicate == nil || s.Predicate.RunDetails == nil || s.Predicate.RunDetails.Builder == nil {
+		return fmt.Errorf("provenance has no run details")
+	}
+
+	if f.NixVersion != "" {
+		s.Predicate.RunDetails.Builder.Version["nix"] = f.NixVersion
+	}
+	data, err := json.Marshal(f)
+	if err != nil {
+		return err
+	}
+	fields := &structpb.Struct{}
+	if err := fields.UnmarshalJSON(data); err != nil {
+		return err
+	}
+	if s.Predicate.BuildDefinition.InternalParameters == nil {
+		s.Predicate.BuildDefinition.InternalParameters = &structpb.Struct{Fields: make(map[string]*structpb.Value)}
+	}
+	s.Predicate.BuildDefinition.InternalParameters.Fields["builder"] = structpb.NewStructValue(fields)
+	return nil
+}
+
+// AddEgress records the requests of the build through the egress proxy as byproducts of the run, the digest of the
+// downloads the proxy could see
+func (s *Statement) AddEgress(records []egress.Record) error {
+	if s.Predicate == nil || s.Predicate.RunDetails == nil {
+		return fmt.Errorf("provenance has no run details")
+	}
+
+	for _, r := range records {
+		fields := map[string]*structpb.Value{
+			"method": structpb.NewStringValue(r.Method),
+			"time":   structpb.NewStringValue(r.Time.Format(time.RFC3339Nano)),
+			"size":   structpb.NewNumberValue(float64(r.Size)),
+			"tunnel": structpb.NewBoolValue(r.Tunnel),
+		}
+		if r.Status != 0 {
+			fields["status"] = structpb.NewNumberValue(float64(r.Status))
+		}
+		if r.Error != "" {
+			fields["error"] = structpb.NewStringValue(r.Error)
+		}
+		rd := &slsav1.ResourceDescriptor{
+			Uri:         r.URL,
+			Name:        "egress",
+			Annotations: &structpb.Struct{Fields: fields},
+		}
+		if r.Digest != "" {
+			rd.Digest = map[string]string{"sha256": r.Digest}
+		}
+		s.Predicate.RunDetails.Byproducts = append(s.Predicate.RunDetails.Byproducts, rd)
+	}
+	return nil
+}
+
 // ToJSON converts the provenance statement to JSON
 func (s *Statement) ToJSON() ([]byte, error) {
 	return json.Marshal(s)
@@ -0,0 +1,138 @@
+// Package provides indexes the files of the store paths of a closure, to find which package provides a file such
+// as lib/libssl.so.3 or bin/python3 when debugging runtime errors or triaging a vulnerability.
+package provides
+
+import (
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	nixcmd "github.com/buildsafedev/bsf/pkg/nix/cmd"
+)
+
+// ReportName is the report of bsf build --deep holding the index of the closure
+const ReportName = "provides.json"
+
+// Index maps the files of the closure to the store paths providing them
+type Index struct {
+	// Files maps the path of files relative to their store path, e.g. lib/libssl.so.3, to the store paths providing
+	// them, sorted. Symlinks are files, directories are not.
+	Files map[string][]string `json:"files"`
+}
+
+// Match is a file of the closure matching a lookup
+type Match struct {
+	File      string `json:"file"`
+	StorePath string `json:"storePath"`
+}
+
+// Build indexes the files of the store paths, walking at most workers of them at once
+func Build(storePaths []string, workers int) (*Index, error) {
+	if workers < 1 {
+		workers = 1
+	}
+	ix := &Index{Files: make(map[string][]string)}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	var firstErr error
+	sem := make(chan struct{}, workers)
+	for _, sp := range storePaths {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(sp string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			files, err := storePathFiles(sp)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				if firstErr == nil {
+					firstErr = err
+				}
+				return
+			}
+			for _, f := range files {
+				ix.Files[f] = append(ix.Files[f], sp)
+			}
+		}(sp)
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	for _, sps := range ix.Files {
+		sort.Strings(sps)
+	}
+	return ix, nil
+}
+
+// storePathFiles returns the files of the store path relative to it, nothing for store paths that are files
+func storePathFiles(storePath string) ([]string, error) {
+	root := nixcmd.HostPath(storePath)
+	files := make([]string, 0)
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || path == root {
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		files = append(files, filepath.ToSlash(rel))
+		return nil
+	})
+	return files, err
+}
+
+// Lookup returns the files matching the query, sorted by file and store path. The query is a file of a store
+// path, e.g. /nix/store/...-openssl-3.0.13/lib/libssl.so.3, a path relative to store paths such as lib/libssl.so.3,
+// or the end of one, such as libssl.so.3 or bin/python3.
+func (ix *Index) Lookup(query string) []Match {
+	if strings.HasPrefix(query, nixcmd.StoreDir+"/") {
+		name, rel, _ := strings.Cut(strings.TrimPrefix(query, nixcmd.StoreDir+"/"), "/")
+		matches := make([]Match, 0, 1)
+		for _, sp := range ix.Files[rel] {
+			if sp == nixcmd.StoreDir+"/"+name {
+				matches = append(matches, Match{File: rel, StorePath: sp})
+			}
+		}
+		return matches
+	}
+
+	query = strings.TrimPrefix(filepath.ToSlash(query), "/")
+	matches := make([]Match, 0)
+	for f, sps := range ix.Files {
+		if f != query && !strings.HasSuffix(f, "/"+query) {
+			continue
+		}
+		for _, sp := range sps {
+			matches = append(matches, Match{File: f, StorePath: sp})
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].File != matches[j].File {
+			return matches[i].File < matches[j].File
+		}
+		return matches[i].StorePath < matches[j].StorePath
+	})
+	return matches
+}
+
+// ByStorePath returns the files of each store path, sorted
+func (ix *Index) ByStorePath() map[string][]string {
+	files := make(map[string][]string)
+	for f, sps := range ix.Files {
+		for _, sp := range sps {
+			files[sp] = append(files[sp], f)
+		}
+	}
+	for _, fs := range files {
+		sort.Strings(fs)
+	}
+	return files
+}
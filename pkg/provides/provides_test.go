@@ -0,0 +1,92 @@
+package provides
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestBuild(t *testing.T) {
+	dir := t.TempDir()
+	openssl := filepath.Join(dir, "abc-openssl-3.0.13")
+	python := filepath.Join(dir, "def-python3-3.11.9")
+	for _, f := range []string{
+		filepath.Join(openssl, "lib", "libssl.so.3"),
+		filepath.Join(python, "bin", "python3.11"),
+		filepath.Join(python, "lib", "libssl.so.3"),
+	} {
+		if err := os.MkdirAll(filepath.Dir(f), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(f, []byte(f), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink("python3.11", filepath.Join(python, "bin", "python3")); err != nil {
+		t.Fatal(err)
+	}
+	// a store path that is a file has no files
+	script := filepath.Join(dir, "ghi-script.sh")
+	if err := os.WriteFile(script, []byte("#!/bin/sh"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	ix, err := Build([]string{python, openssl, script}, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string][]string{
+		"bin/python3":     {python},
+		"bin/python3.11":  {python},
+		"lib/libssl.so.3": {openssl, python},
+	}
+	if !reflect.DeepEqual(ix.Files, want) {
+		t.Errorf("Files = %v, want %v", ix.Files, want)
+	}
+
+	wantByStorePath := map[string][]string{
+		openssl: {"lib/libssl.so.3"},
+		python:  {"bin/python3", "bin/python3.11", "lib/libssl.so.3"},
+	}
+	if got := ix.ByStorePath(); !reflect.DeepEqual(got, wantByStorePath) {
+		t.Errorf("ByStorePath() = %v, want %v", got, wantByStorePath)
+	}
+}
+
+func TestLookup(t *testing.T) {
+	openssl := "/nix/store/abc-openssl-3.0.13"
+	python := "/nix/store/def-python3-3.11.9"
+	ix := &Index{Files: map[string][]string{
+		"bin/python3":             {python},
+		"lib/libssl.so.3":         {openssl, python},
+		"lib/engines/libssl.so.3": {openssl},
+		"share/doc/python3":       {python},
+	}}
+
+	tests := []struct {
+		query string
+		want  []Match
+	}{
+		{"libssl.so.3", []Match{
+			{"lib/engines/libssl.so.3", openssl},
+			{"lib/libssl.so.3", openssl},
+			{"lib/libssl.so.3", python},
+		}},
+		{"lib/libssl.so.3", []Match{
+			{"lib/libssl.so.3", openssl},
+			{"lib/libssl.so.3", python},
+		}},
+		{"bin/python3", []Match{{"bin/python3", python}}},
+		{"python3", []Match{{"bin/python3", python}, {"share/doc/python3", python}}},
+		{openssl + "/lib/libssl.so.3", []Match{{"lib/libssl.so.3", openssl}}},
+		{"/nix/store/xyz-other/lib/libssl.so.3", []Match{}},
+		// the end of a file name isn't a file
+		{"ssl.so.3", []Match{}},
+	}
+	for _, tt := range tests {
+		if got := ix.Lookup(tt.query); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Lookup(%q) = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,248 @@
+package purpose
+
+import (
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/bom-squad/protobom/pkg/sbom"
+)
+
+// builtin are the detectors of the shapes of results nixpkgs builds, in the order they're tried. Results with
+// executables are executables whatever else they have, as they were before detectors.
+var builtin = []namedDetector{
+	{"executable", detectExecutable},
+	{"container", detectContainer},
+	{"vm-image", detectVMImage},
+	{"firmware", detectFirmware},
+	{"python", detectPython},
+	{"static-site", detectStaticSite},
+	{"docs", detectDocs},
+}
+
+// vmImageFormats are the extensions of the disk images of virtual machines, e.g. of nixos-generators
+var vmImageFormats = map[string]bool{
+	"qcow2": true, "vmdk": true, "vdi": true, "vhd": true, "vhdx": true, "ova": true, "iso": true,
+}
+
+// firmwareFormats are the extensions of the images flashed to devices
+var firmwareFormats = map[string]bool{
+	"uf2": true, "hex": true, "dfu": true, "fw": true,
+}
+
+// detectExecutable recognises the results with a bin directory
+func detectExecutable(root string, info fs.FileInfo) (*Detection, error) {
+	if !info.IsDir() {
+		return nil, nil
+	}
+	if _, err := os.Lstat(filepath.Join(root, "bin")); err != nil {
+		return nil, nil
+	}
+	return &Detection{Purpose: sbom.Purpose_EXECUTABLE}, nil
+}
+
+// detectContainer recognises the images written as directories, with their manifest.json
+func detectContainer(root string, info fs.FileInfo) (*Detection, error) {
+	if !info.IsDir() {
+		return nil, nil
+	}
+	if _, err := os.Lstat(filepath.Join(root, "manifest.json")); err != nil {
+		return nil, nil
+	}
+	return &Detection{Purpose: sbom.Purpose_CONTAINER}, nil
+}
+
+// detectVMImage recognises the disk images of virtual machines, as the result or in it or its iso directory
+func detectVMImage(root string, info fs.FileInfo) (*Detection, error) {
+	file, format, err := findFile(root, info, vmImageFormats, ".", "iso")
+	if err != nil || file == "" {
+		return nil, err
+	}
+	return &Detection{Purpose: sbom.Purpose_OPERATING_SYSTEM, Metadata: map[string]string{
+		"file":   file,
+		"format": format,
+	}}, nil
+}
+
+// detectFirmware recognises the firmware images, as the result or in it, and the firmware directories of kernels
+func detectFirmware(root string, info fs.FileInfo) (*Detection, error) {
+	file, format, err := findFile(root, info, firmwareFormats, ".", "firmware")
+	if err != nil {
+		return nil, err
+	}
+	if file != "" {
+		return &Detection{Purpose: sbom.Purpose_FIRMWARE, Metadata: map[string]string{
+			"file":   file,
+			"format": format,
+		}}, nil
+	}
+	if info.IsDir() && isDir(filepath.Join(root, "lib", "firmware")) {
+		return &Detection{Purpose: sbom.Purpose_FIRMWARE, Metadata: map[string]string{"file": "lib/firmware"}}, nil
+	}
+	return nil, nil
+}
+
+// detectPython recognises wheels, as the result or in it or its dist directory, and installed python packages by
+// their dist-info directory
+func detectPython(root string, info fs.FileInfo) (*Detection, error) {
+	file, _, err := findFile(root, info, map[string]bool{"whl": true}, ".", "dist")
+	if err != nil {
+		return nil, err
+	}
+	if file != "" {
+		name := path.Base(file)
+		if file == "." {
+			// the store path of a wheel is named after it, after the hash of the path
+			name = info.Name()
+			if len(name) > 33 && name[32] == '-' {
+				name = name[33:]
+			}
+		}
+		metadata := parseWheelName(name)
+		if metadata == nil {
+			return nil, nil
+		}
+		metadata["file"] = file
+		return &Detection{Purpose: sbom.Purpose_LIBRARY, Metadata: metadata}, nil
+	}
+
+	if !info.IsDir() {
+		return nil, nil
+	}
+	matches, err := fs.Glob(os.DirFS(root), "lib/python*/site-packages/*.dist-info")
+	if err != nil || len(matches) == 0 {
+		return nil, err
+	}
+	name, version, _ := strings.Cut(strings.TrimSuffix(path.Base(matches[0]), ".dist-info"), "-")
+	return &Detection{Purpose: sbom.Purpose_LIBRARY, Metadata: map[string]string{
+		"name":    name,
+		"version": version,
+		"python":  strings.Split(matches[0], "/")[1],
+	}}, nil
+}
+
+// parseWheelName returns the distribution, version and tags of the file name of a wheel,
+// {distribution}-{version}(-{build})?-{python}-{abi}-{platform}.whl, nil when it isn't one
+func parseWheelName(name string) map[string]string {
+	parts := strings.Split(strings.TrimSuffix(name, ".whl"), "-")
+	if len(parts) != 5 && len(parts) != 6 {
+		return nil
+	}
+	n := len(parts)
+	return map[string]string{
+		"name":     parts[0],
+		"version":  parts[1],
+		"python":   parts[n-3],
+		"abi":      parts[n-2],
+		"platform": parts[n-1],
+	}
+}
+
+// detectStaticSite recognises the bundles of static sites by their index.html, in the result or in the directory
+// static site generators and web servers use
+func detectStaticSite(root string, info fs.FileInfo) (*Detection, error) {
+	if !info.IsDir() {
+		return nil, nil
+	}
+	for _, dir := range []string{".", "public", "dist", "www", "share/www"} {
+		index := path.Join(dir, "index.html")
+		if _, err := os.Stat(filepath.Join(root, filepath.FromSlash(index))); err != nil {
+			continue
+		}
+		pages := 0
+		err := filepath.WalkDir(filepath.Join(root, filepath.FromSlash(dir)), func(p string, d fs.DirEntry, err error) error {
+			if err == nil && !d.IsDir() && strings.HasSuffix(d.Name(), ".html") {
+				pages++
+			}
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		return &Detection{Purpose: sbom.Purpose_APPLICATION, Metadata: map[string]string{
+			"index": index,
+			"pages": strconv.Itoa(pages),
+		}}, nil
+	}
+	return nil, nil
+}
+
+// detectDocs recognises the results that only have documentation, e.g. the doc, man and info outputs of nixpkgs
+func detectDocs(root string, info fs.FileInfo) (*Detection, error) {
+	if !info.IsDir() {
+		return nil, nil
+	}
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		// nix-support has the metadata of the package, e.g. its propagated inputs
+		if e.Name() != "share" && e.Name() != "nix-support" {
+			return nil, nil
+		}
+	}
+
+	entries, err = os.ReadDir(filepath.Join(root, "share"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	formats := make([]string, 0, len(entries))
+	for _, e := range entries {
+		switch e.Name() {
+		case "doc", "man", "info", "gtk-doc", "devhelp":
+			formats = append(formats, e.Name())
+		default:
+			return nil, nil
+		}
+	}
+	if len(formats) == 0 {
+		return nil, nil
+	}
+	sort.Strings(formats)
+	return &Detection{Purpose: sbom.Purpose_DOCUMENTATION, Metadata: map[string]string{"formats": strings.Join(formats, ",")}}, nil
+}
+
+// findFile returns the first file, sorted by name, with one of the extensions and its extension: the result itself
+// when it is a file, as ".", or a file of one of the directories of the result, relative to it. The file is empty
+// when none has one.
+func findFile(root string, info fs.FileInfo, extensions map[string]bool, dirs ...string) (string, string, error) {
+	if !info.IsDir() {
+		if ext := extension(info.Name()); extensions[ext] {
+			return ".", ext, nil
+		}
+		return "", "", nil
+	}
+	for _, dir := range dirs {
+		entries, err := os.ReadDir(filepath.Join(root, dir))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return "", "", err
+		}
+		for _, e := range entries {
+			if ext := extension(e.Name()); e.Type().IsRegular() && extensions[ext] {
+				return path.Join(dir, e.Name()), ext, nil
+			}
+		}
+	}
+	return "", "", nil
+}
+
+// extension returns the extension of the file name without its dot, lower cased
+func extension(name string) string {
+	return strings.ToLower(strings.TrimPrefix(path.Ext(name), "."))
+}
+
+func isDir(p string) bool {
+	info, err := os.Stat(p)
+	return err == nil && info.IsDir()
+}
@@ -0,0 +1,154 @@
+// Package purpose detects what the result of a build is, e.g. an executable, a python wheel, a firmware or a VM
+// image, from its files. Detectors are tried in turn: the rules of ~/.bsf.json, the detectors programs embedding bsf
+// register, then the builtin ones. Each returns the purpose of the result and the metadata it extracted from it.
+package purpose
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/bom-squad/protobom/pkg/sbom"
+)
+
+// Detection is the purpose of a result a detector recognised, with the metadata it extracted from its files
+type Detection struct {
+	Purpose sbom.Purpose
+	// Detector is the name of the detector that recognised the result
+	Detector string
+	// Metadata describes the result, e.g. the name and version of a python wheel
+	Metadata map[string]string
+}
+
+// String describes the detection, e.g. python: name=requests version=2.31.0
+func (d *Detection) String() string {
+	keys := make([]string, 0, len(d.Metadata))
+	for k := range d.Metadata {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		pairs = append(pairs, k+"="+d.Metadata[k])
+	}
+	if len(pairs) == 0 {
+		return d.Detector
+	}
+	return d.Detector + ": " + strings.Join(pairs, " ")
+}
+
+// Detector recognises the results of a shape from their files. root is the result on the host, a directory or a
+// file, info its file info. It returns nil when it doesn't recognise the result.
+type Detector func(root string, info fs.FileInfo) (*Detection, error)
+
+type namedDetector struct {
+	name   string
+	detect Detector
+}
+
+var (
+	mu         sync.RWMutex
+	rules      []namedDetector
+	registered []namedDetector
+)
+
+// Register adds a detector, tried before the builtin ones and the ones registered before it
+func Register(name string, d Detector) {
+	mu.Lock()
+	defer mu.Unlock()
+	registered = append([]namedDetector{{name, d}}, registered...)
+}
+
+// Detect returns the purpose of the result at root, nil when no detector recognises it
+func Detect(root string) (*Detection, error) {
+	info, err := os.Stat(root)
+	if err != nil {
+		return nil, err
+	}
+
+	mu.RLock()
+	detectors := make([]namedDetector, 0, len(rules)+len(registered)+len(builtin))
+	detectors = append(append(append(detectors, rules...), registered...), builtin...)
+	mu.RUnlock()
+
+	for _, d := range detectors {
+		detection, err := d.detect(root, info)
+		if err != nil {
+			return nil, fmt.Errorf("%s detector: %w", d.name, err)
+		}
+		if detection != nil {
+			detection.Detector = d.name
+			return detection, nil
+		}
+	}
+	return nil, nil
+}
+
+// Rule recognises the results that have files matching each of its patterns as results of its purpose, e.g. the
+// results with share/charts/*.tgz as DATA
+type Rule struct {
+	Name string `json:"name"`
+	// Purpose is the name of the purpose, as protobom names them, e.g. DATA or FIRMWARE
+	Purpose string `json:"purpose"`
+	// Files are glob patterns of paths in the result, as path.Match matches them
+	Files []string `json:"files"`
+}
+
+// SetRules replaces the rules detectors are made of, e.g. the ones of ~/.bsf.json
+func SetRules(rs []Rule) error {
+	detectors := make([]namedDetector, 0, len(rs))
+	for _, r := range rs {
+		d, err := r.detector()
+		if err != nil {
+			return err
+		}
+		detectors = append(detectors, namedDetector{r.Name, d})
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	rules = detectors
+	return nil
+}
+
+// detector returns the detector of the rule. The metadata of its detections are the first file each pattern matched.
+func (r Rule) detector() (Detector, error) {
+	if r.Name == "" {
+		return nil, fmt.Errorf("purpose detector without a name")
+	}
+	value, ok := sbom.Purpose_value[strings.ToUpper(r.Purpose)]
+	if !ok || sbom.Purpose(value) == sbom.Purpose_UNKNOWN_PURPOSE {
+		return nil, fmt.Errorf("purpose detector %s: unknown purpose %q", r.Name, r.Purpose)
+	}
+	if len(r.Files) == 0 {
+		return nil, fmt.Errorf("purpose detector %s: no file patterns", r.Name)
+	}
+	for _, pattern := range r.Files {
+		if _, err := path.Match(pattern, ""); err != nil || !filepath.IsLocal(pattern) {
+			return nil, fmt.Errorf("purpose detector %s: invalid file pattern %q", r.Name, pattern)
+		}
+	}
+
+	return func(root string, info fs.FileInfo) (*Detection, error) {
+		if !info.IsDir() {
+			return nil, nil
+		}
+		metadata := make(map[string]string, len(r.Files))
+		for _, pattern := range r.Files {
+			matches, err := fs.Glob(os.DirFS(root), pattern)
+			if err != nil {
+				return nil, err
+			}
+			if len(matches) == 0 {
+				return nil, nil
+			}
+			metadata[pattern] = matches[0]
+		}
+		return &Detection{Purpose: sbom.Purpose(value), Metadata: metadata}, nil
+	}, nil
+}
@@ -0,0 +1,136 @@
+package purpose
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/bom-squad/protobom/pkg/sbom"
+)
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		name     string
+		files    []string
+		want     sbom.Purpose
+		detector string
+		metadata map[string]string
+	}{
+		{name: "executable", files: []string{"bin/app", "share/man/man1/app.1"}, want: sbom.Purpose_EXECUTABLE, detector: "executable"},
+		{name: "image directory", files: []string{"manifest.json", "config.json"}, want: sbom.Purpose_CONTAINER, detector: "container"},
+		{
+			name: "vm image", files: []string{"nixos.qcow2", "nix-support/hydra-build-products"},
+			want: sbom.Purpose_OPERATING_SYSTEM, detector: "vm-image", metadata: map[string]string{"file": "nixos.qcow2", "format": "qcow2"},
+		},
+		{
+			name: "installer iso", files: []string{"iso/nixos-24.05-x86_64-linux.iso"},
+			want: sbom.Purpose_OPERATING_SYSTEM, detector: "vm-image", metadata: map[string]string{"file": "iso/nixos-24.05-x86_64-linux.iso", "format": "iso"},
+		},
+		{
+			name: "firmware", files: []string{"firmware/pico.UF2"},
+			want: sbom.Purpose_FIRMWARE, detector: "firmware", metadata: map[string]string{"file": "firmware/pico.UF2", "format": "uf2"},
+		},
+		{name: "kernel firmware", files: []string{"lib/firmware/iwlwifi.ucode"}, want: sbom.Purpose_FIRMWARE, detector: "firmware", metadata: map[string]string{"file": "lib/firmware"}},
+		{
+			name: "wheel", files: []string{"dist/requests-2.31.0-py3-none-any.whl"},
+			want: sbom.Purpose_LIBRARY, detector: "python",
+			metadata: map[string]string{"file": "dist/requests-2.31.0-py3-none-any.whl", "name": "requests", "version": "2.31.0", "python": "py3", "abi": "none", "platform": "any"},
+		},
+		{
+			name: "python package", files: []string{"lib/python3.11/site-packages/requests-2.31.0.dist-info/METADATA"},
+			want: sbom.Purpose_LIBRARY, detector: "python", metadata: map[string]string{"name": "requests", "version": "2.31.0", "python": "python3.11"},
+		},
+		{
+			name: "static site", files: []string{"public/index.html", "public/about/index.html", "public/style.css"},
+			want: sbom.Purpose_APPLICATION, detector: "static-site", metadata: map[string]string{"index": "public/index.html", "pages": "2"},
+		},
+		{
+			name: "docs", files: []string{"share/doc/app/README", "share/man/man1/app.1", "nix-support/propagated-build-inputs"},
+			want: sbom.Purpose_DOCUMENTATION, detector: "docs", metadata: map[string]string{"formats": "doc,man"},
+		},
+		{name: "data", files: []string{"share/zoneinfo/UTC"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			for _, f := range tt.files {
+				writeFile(t, filepath.Join(root, f))
+			}
+
+			got, err := Detect(root)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.want == sbom.Purpose_UNKNOWN_PURPOSE {
+				if got != nil {
+					t.Errorf("Detect() = %+v, want nil", got)
+				}
+				return
+			}
+			if got == nil || got.Purpose != tt.want || got.Detector != tt.detector || (len(tt.metadata) > 0 || len(got.Metadata) > 0) && !reflect.DeepEqual(got.Metadata, tt.metadata) {
+				t.Errorf("Detect() = %+v, want %s by %s with %v", got, tt.want, tt.detector, tt.metadata)
+			}
+		})
+	}
+
+	// results can be files, wheels are named after their store path
+	wheel := filepath.Join(t.TempDir(), "1vng6wj07s51jsgj338m24m0c0mw2i3k-numpy-1.26.4-cp311-cp311-manylinux_2_17_x86_64.whl")
+	writeFile(t, wheel)
+	got, err := Detect(wheel)
+	if err != nil || got == nil || got.Metadata["name"] != "numpy" || got.Metadata["abi"] != "cp311" || got.Metadata["file"] != "." {
+		t.Errorf("Detect() of a wheel = %+v, %v", got, err)
+	}
+}
+
+func TestRulesAndRegister(t *testing.T) {
+	defer func() {
+		SetRules(nil)
+		registered = nil
+	}()
+
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "bin", "helm"))
+	writeFile(t, filepath.Join(root, "share", "charts", "app-1.0.0.tgz"))
+
+	err := SetRules([]Rule{{Name: "helm-chart", Purpose: "data", Files: []string{"share/charts/*.tgz"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := Detect(root)
+	if err != nil || got == nil || got.Purpose != sbom.Purpose_DATA || got.String() != "helm-chart: share/charts/*.tgz=share/charts/app-1.0.0.tgz" {
+		t.Errorf("Detect() = %+v, %v, want the rule to take precedence", got, err)
+	}
+
+	// registered detectors are tried after the rules and before the builtin ones
+	SetRules(nil)
+	Register("cli", func(root string, info fs.FileInfo) (*Detection, error) {
+		return &Detection{Purpose: sbom.Purpose_APPLICATION, Metadata: map[string]string{"kind": "cli"}}, nil
+	})
+	if got, err := Detect(root); err != nil || got == nil || got.Detector != "cli" || got.Purpose != sbom.Purpose_APPLICATION {
+		t.Errorf("Detect() = %+v, %v, want the registered detector", got, err)
+	}
+
+	for _, r := range []Rule{
+		{Purpose: "DATA", Files: []string{"*.tgz"}},
+		{Name: "charts", Purpose: "chart", Files: []string{"*.tgz"}},
+		{Name: "charts", Purpose: "DATA"},
+		{Name: "charts", Purpose: "DATA", Files: []string{"../*.tgz"}},
+		{Name: "charts", Purpose: "DATA", Files: []string{"[*.tgz"}},
+	} {
+		if err := SetRules([]Rule{r}); err == nil {
+			t.Errorf("SetRules() accepted %+v", r)
+		}
+	}
+}
+
+func writeFile(t *testing.T, path string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,179 @@
+// Package receipt creates and verifies build receipts. A receipt links the source commit and pull request to the
+// derivation, the output and image digests and the digests of the SBOMs and attestations of a build, signed as one document.
+package receipt
+
+import (
+	"crypto"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	bgit "github.com/buildsafedev/bsf/pkg/git"
+	"github.com/buildsafedev/bsf/pkg/layout"
+	"github.com/buildsafedev/bsf/pkg/signing"
+)
+
+const (
+	// PayloadType is the DSSE payload type of receipts
+	PayloadType = "application/vnd.buildsafe.receipt.v1+json"
+	// Name is the name of the receipt in the output directory
+	Name = "receipt.json"
+)
+
+// Receipt is the chain from the source of a build to the artifacts it produced
+type Receipt struct {
+	Version      int       `json:"version"`
+	Created      time.Time `json:"created"`
+	Source       Source    `json:"source"`
+	Derivation   string    `json:"derivation"`
+	Output       Output    `json:"output"`
+	Image        *Digest   `json:"image,omitempty"`
+	Artifacts    []Digest  `json:"artifacts"`
+	SBOMs        []Digest  `json:"sboms"`
+	Attestations Digest    `json:"attestations"`
+	// Builder is the CI workflow that ran the build, when it was built by a trusted builder
+	Builder string `json:"builder,omitempty"`
+}
+
+// Source is the commit the build was made from
+type Source struct {
+	Repository string `json:"repository,omitempty"`
+	Commit     string `json:"commit"`
+	// PullRequest is the number of the pull or merge request the commit was built for
+	PullRequest int `json:"pullRequest,omitempty"`
+}
+
+// Output is the store path of the build result
+type Output struct {
+	StorePath string `json:"storePath"`
+	NarHash   string `json:"narHash"`
+}
+
+// Digest names a file of the output directory by its digest
+type Digest struct {
+	Name   string `json:"name"`
+	Digest string `json:"digest"`
+}
+
+// Signed is a signed receipt, with the certificate chain of the key when it was certified for a CI workload identity.
+// Like attestations, it is written as a sigstore bundle.
+type Signed = signing.SignedAttestation
+
+// DetectSource returns the commit being built and the pull request it belongs to, from the CI environment or the git repository
+func DetectSource() (Source, error) {
+	src := Source{}
+
+	switch {
+	case os.Getenv("GITHUB_ACTIONS") == "true":
+		src.Repository = os.Getenv("GITHUB_SERVER_URL") + "/" + os.Getenv("GITHUB_REPOSITORY")
+		src.Commit = os.Getenv("GITHUB_SHA")
+		// pull request builds check out refs/pull/<number>/merge
+		if ref, ok := strings.CutPrefix(os.Getenv("GITHUB_REF"), "refs/pull/"); ok {
+			fmt.Sscanf(ref, "%d/", &src.PullRequest)
+		}
+	case os.Getenv("GITLAB_CI") == "true":
+		src.Repository = os.Getenv("CI_PROJECT_URL")
+		src.Commit = os.Getenv("CI_COMMIT_SHA")
+		fmt.Sscanf(os.Getenv("CI_MERGE_REQUEST_IID"), "%d", &src.PullRequest)
+	}
+
+	if src.Commit == "" {
+		commit, err := bgit.HeadCommit()
+		if err != nil {
+			return src, fmt.Errorf("failed to find the source commit: %v", err)
+		}
+		src.Commit = commit
+	}
+	if src.Repository == "" {
+		src.Repository, _ = bgit.RemoteURL("origin")
+	}
+	return src, nil
+}
+
+// New returns the receipt of the build in the output directory, the artifacts, SBOMs and attestations are taken from its index
+func New(l *layout.Layout, src Source, derivation string, output Output) *Receipt {
+	r := &Receipt{
+		Version:    1,
+		Created:    time.Now().UTC(),
+		Source:     src,
+		Derivation: derivation,
+		Output:     output,
+		Artifacts:  make([]Digest, 0),
+		SBOMs:      make([]Digest, 0),
+	}
+	for _, e := range l.Index.Entries {
+		d := Digest{Name: e.Name, Digest: e.Digest}
+		switch {
+		case e.Kind == layout.KindArtifact:
+			r.Artifacts = append(r.Artifacts, d)
+		case e.Kind == layout.KindSBOM:
+			r.SBOMs = append(r.SBOMs, d)
+		case e.Kind == layout.KindAttestation && e.Name == layout.AttestationsName:
+			r.Attestations = d
+		}
+	}
+	return r
+}
+
+// Sign signs the receipt. certificates certify the key of the signer, they are empty for a key managed by the user.
+func Sign(r *Receipt, signer crypto.Signer, certificates []string) (*Signed, error) {
+	payload, err := json.Marshal(r)
+	if err != nil {
+		return nil, err
+	}
+	env, err := signing.SignEnvelope(signer, PayloadType, payload)
+	if err != nil {
+		return nil, err
+	}
+	return &Signed{Envelope: env, Certificates: certificates}, nil
+}
+
+// OpenOptions configure how the signature of a receipt is checked
+type OpenOptions struct {
+	// Key checks receipts signed with a key managed by the user
+	Key crypto.PublicKey
+	// TrustRoot checks receipts signed with a certified key, such as those of trusted builders
+	TrustRoot *signing.TrustRoot
+	// Identity is the identity the certificate of a certified key must have been issued for
+	Identity signing.Identity
+}
+
+// Open verifies the signature of the receipt and returns it. Receipts with certificates are checked against
+// the trust root and the expected identity unless a key is given, the identity it was issued for is returned.
+func Open(data []byte, opts OpenOptions) (*Receipt, string, error) {
+	signed := &Signed{}
+	if err := json.Unmarshal(data, signed); err != nil {
+		return nil, "", fmt.Errorf("failed to parse receipt: %v", err)
+	}
+	if signed.Envelope == nil || signed.Envelope.PayloadType != PayloadType {
+		return nil, "", fmt.Errorf("not a build receipt")
+	}
+
+	var payload []byte
+	var identity string
+	var err error
+	switch {
+	case opts.Key != nil:
+		payload, err = signing.VerifyEnvelope(opts.Key, signed.Envelope)
+	case len(signed.Certificates) == 0:
+		return nil, "", fmt.Errorf("the receipt was signed with a key of its own, pass its public key to verify it")
+	case opts.TrustRoot == nil:
+		return nil, "", fmt.Errorf("no trust root to check the certificate of the receipt")
+	default:
+		if err := signing.CheckIdentity(signed.Certificates[0], opts.Identity); err != nil {
+			return nil, "", err
+		}
+		payload, identity, err = opts.TrustRoot.Verify(signed.Envelope, signed.Certificates, signed.TlogEntry)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	r := &Receipt{}
+	if err := json.Unmarshal(payload, r); err != nil {
+		return nil, "", fmt.Errorf("failed to parse receipt payload: %v", err)
+	}
+	return r, identity, nil
+}
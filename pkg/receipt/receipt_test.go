@@ -0,0 +1,122 @@
+package receipt
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/buildsafedev/bsf/pkg/layout"
+	"github.com/buildsafedev/bsf/pkg/signing"
+)
+
+func TestReceiptChain(t *testing.T) {
+	dir := t.TempDir()
+	l, err := layout.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range []struct{ kind, name, data string }{
+		{layout.KindArtifact, "bin/app", "binary"},
+		{layout.KindSBOM, "sbom.spdx.json", `{"spdxVersion":"SPDX-2.3"}`},
+		{layout.KindAttestation, layout.AttestationsName, "{}\n"},
+	} {
+		if _, err := l.Add(e.kind, e.name, "application/octet-stream", []byte(e.data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := l.Write(); err != nil {
+		t.Fatal(err)
+	}
+
+	src := Source{Repository: "https://github.com/acme/app", Commit: "abc123", PullRequest: 7}
+	r := New(l, src, "/nix/store/aaaa-app.drv", Output{StorePath: "/nix/store/bbbb-app", NarHash: "sha256-xyz"})
+
+	signer, err := signing.NewEphemeralSigner()
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed, err := Sign(r, signer, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := Open(data, OpenOptions{}); err == nil {
+		t.Errorf("expected a receipt without certificates to require a key")
+	}
+	other, _ := signing.NewEphemeralSigner()
+	if _, _, err := Open(data, OpenOptions{Key: other.Public()}); err == nil {
+		t.Errorf("expected the signature to not verify with another key")
+	}
+	opened, _, err := Open(data, OpenOptions{Key: signer.Public()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v := &Verifier{
+		OutputDir: dir,
+		Deriver:   func(string) (string, error) { return "/nix/store/aaaa-app.drv", nil },
+		NarHash:   func(string) (string, error) { return "sha256-xyz", nil },
+		PullRequestCommits: func(context.Context, string, int) ([]string, error) {
+			return []string{"def456", "abc123"}, nil
+		},
+	}
+	checks := v.Verify(context.Background(), opened)
+	if failed := Failed(checks); len(failed) != 0 {
+		t.Errorf("expected the chain to hold, failed: %v", failed)
+	}
+	if len(checks) != 6 {
+		t.Errorf("expected 6 checks, got %v", checks)
+	}
+
+	// a tampered SBOM and an output rebuilt from another derivation break the chain
+	e, _ := l.Find(layout.KindSBOM, "sbom.spdx.json")
+	if err := os.WriteFile(filepath.Join(dir, e.Path), []byte("{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	v.Deriver = func(string) (string, error) { return "/nix/store/cccc-app.drv", nil }
+	failed := Failed(v.Verify(context.Background(), opened))
+	if len(failed) != 2 {
+		t.Errorf("expected 2 failed checks, got %v", failed)
+	}
+}
+
+func TestGitHubPullRequestCommits(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/repos/acme/app/pulls/7":
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"merge_commit_sha": "merge", "head": map[string]string{"sha": "head"}})
+		case r.URL.Path == "/repos/acme/app/pulls/7/commits" && r.URL.Query().Get("per_page") == "100":
+			n := 100
+			if r.URL.Query().Get("page") == "2" {
+				n = 3
+			}
+			commits := make([]map[string]string, n)
+			for i := range commits {
+				commits[i] = map[string]string{"sha": fmt.Sprintf("%s-%d", r.URL.Query().Get("page"), i)}
+			}
+			_ = json.NewEncoder(w).Encode(commits)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+	defer func(u string) { githubAPI = u }(githubAPI)
+	githubAPI = srv.URL
+
+	shas, err := GitHubPullRequestCommits(context.Background(), "https://github.com/acme/app.git", 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(shas) != 105 || shas[0] != "head" || shas[1] != "merge" || shas[104] != "2-2" {
+		t.Errorf("GitHubPullRequestCommits() returned %d commits, want the head, merge and 103 commits of two pages", len(shas))
+	}
+}
@@ -0,0 +1,240 @@
+package receipt
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	bio "github.com/buildsafedev/bsf/pkg/io"
+	"github.com/buildsafedev/bsf/pkg/layout"
+	nixcmd "github.com/buildsafedev/bsf/pkg/nix/cmd"
+)
+
+// Status is the result of checking a link of the chain
+type Status string
+
+const (
+	// StatusOK is a link that was verified
+	StatusOK Status = "ok"
+	// StatusFailed is a link that does not hold
+	StatusFailed Status = "failed"
+	// StatusSkipped is a link that could not be checked, e.g. because the store path was garbage collected
+	StatusSkipped Status = "skipped"
+)
+
+// Check is the result of checking one link of the chain
+type Check struct {
+	Link   string
+	Status Status
+	Detail string
+}
+
+// Verifier walks the chain of a receipt, from the pull request to the files of the output directory
+type Verifier struct {
+	// OutputDir is the output directory of the build, its files are checked against the receipt
+	OutputDir string
+	// Deriver returns the derivation of a store path
+	Deriver func(storePath string) (string, error)
+	// NarHash returns the NAR hash of a store path
+	NarHash func(storePath string) (string, error)
+	// ImageDigest returns the digest of the image at path
+	ImageDigest func(path string) (string, error)
+	// PullRequestCommits returns the commits of the pull request, nil skips the check
+	PullRequestCommits func(ctx context.Context, repository string, number int) ([]string, error)
+}
+
+// NewVerifier returns a verifier checking the receipt against the nix store and the output directory
+func NewVerifier(outputDir string) *Verifier {
+	return &Verifier{
+		OutputDir: outputDir,
+		Deriver: func(storePath string) (string, error) {
+			return nixcmd.GetDrvPathFromResult(storePath, "")
+		},
+		NarHash:     nixcmd.GetNarHashFromPath,
+		ImageDigest: ImageDigest,
+	}
+}
+
+// ImageDigest returns the digest identifying the image at path, as recorded in receipts
+func ImageDigest(path string) (string, error) {
+	img, err := nixcmd.GetImage(path)
+	if err != nil {
+		return "", err
+	}
+	return "sha256:" + img.ConfigDigest, nil
+}
+
+// Verify checks every link of the chain. The receipt holds if no check failed.
+func (v *Verifier) Verify(ctx context.Context, r *Receipt) []Check {
+	checks := make([]Check, 0)
+	add := func(link string, status Status, format string, args ...interface{}) {
+		checks = append(checks, Check{Link: link, Status: status, Detail: fmt.Sprintf(format, args...)})
+	}
+
+	switch {
+	case r.Source.PullRequest == 0:
+		add("source → pull request", StatusSkipped, "commit %s was not built for a pull request", r.Source.Commit)
+	case v.PullRequestCommits == nil:
+		add("source → pull request", StatusSkipped, "pull request #%d was not checked", r.Source.PullRequest)
+	default:
+		commits, err := v.PullRequestCommits(ctx, r.Source.Repository, r.Source.PullRequest)
+		switch {
+		case err != nil:
+			add("source → pull request", StatusSkipped, "%v", err)
+		case contains(commits, r.Source.Commit):
+			add("source → pull request", StatusOK, "commit %s belongs to pull request #%d", r.Source.Commit, r.Source.PullRequest)
+		default:
+			add("source → pull request", StatusFailed, "commit %s is not part of pull request #%d", r.Source.Commit, r.Source.PullRequest)
+		}
+	}
+
+	if deriver, err := v.Deriver(r.Output.StorePath); err != nil {
+		add("derivation → output", StatusSkipped, "%s is not in the store: %v", r.Output.StorePath, err)
+	} else if deriver != r.Derivation {
+		add("derivation → output", StatusFailed, "%s was built by %s, the receipt names %s", r.Output.StorePath, deriver, r.Derivation)
+	} else {
+		add("derivation → output", StatusOK, "%s built %s", r.Derivation, r.Output.StorePath)
+	}
+
+	if narHash, err := v.NarHash(r.Output.StorePath); err != nil {
+		add("output digest", StatusSkipped, "%s is not in the store: %v", r.Output.StorePath, err)
+	} else if narHash != r.Output.NarHash {
+		add("output digest", StatusFailed, "%s has NAR hash %s, the receipt has %s", r.Output.StorePath, narHash, r.Output.NarHash)
+	} else {
+		add("output digest", StatusOK, "%s has NAR hash %s", r.Output.StorePath, narHash)
+	}
+
+	l, err := layout.Open(v.OutputDir)
+	if err != nil {
+		add("output directory", StatusFailed, "%v", err)
+		return checks
+	}
+
+	if r.Image != nil {
+		checks = append(checks, v.checkImage(*r.Image))
+	}
+	for _, d := range r.Artifacts {
+		checks = append(checks, checkEntry(l, "artifact", layout.KindArtifact, d))
+	}
+	for _, d := range r.SBOMs {
+		checks = append(checks, checkEntry(l, "sbom", layout.KindSBOM, d))
+	}
+	checks = append(checks, checkEntry(l, "attestations", layout.KindAttestation, r.Attestations))
+
+	return checks
+}
+
+// Failed returns the checks that failed
+func Failed(checks []Check) []Check {
+	failed := make([]Check, 0)
+	for _, c := range checks {
+		if c.Status == StatusFailed {
+			failed = append(failed, c)
+		}
+	}
+	return failed
+}
+
+// checkEntry checks that the file of the output directory has the digest of the receipt
+func checkEntry(l *layout.Layout, link, kind string, d Digest) Check {
+	link = link + " " + d.Name
+	e, ok := l.Find(kind, d.Name)
+	if !ok {
+		return Check{Link: link, Status: StatusFailed, Detail: fmt.Sprintf("%s is not in %s", d.Name, l.Dir)}
+	}
+
+	sum, err := bio.FileSHA256(filepath.Join(l.Dir, filepath.FromSlash(e.Path)))
+	if err != nil {
+		return Check{Link: link, Status: StatusFailed, Detail: err.Error()}
+	}
+	digest := "sha256:" + sum
+	if digest != d.Digest {
+		return Check{Link: link, Status: StatusFailed, Detail: fmt.Sprintf("%s has digest %s, the receipt has %s", d.Name, digest, d.Digest)}
+	}
+	return Check{Link: link, Status: StatusOK, Detail: digest}
+}
+
+// checkImage checks the digest of the image in the output directory, images are the result of bsf oci
+func (v *Verifier) checkImage(d Digest) Check {
+	link := "image " + d.Name
+	digest, err := v.ImageDigest(filepath.Join(v.OutputDir, "result"))
+	if err != nil {
+		return Check{Link: link, Status: StatusSkipped, Detail: fmt.Sprintf("image not found in %s: %v", v.OutputDir, err)}
+	}
+	if digest != d.Digest {
+		return Check{Link: link, Status: StatusFailed, Detail: fmt.Sprintf("image has digest %s, the receipt has %s", digest, d.Digest)}
+	}
+	return Check{Link: link, Status: StatusOK, Detail: d.Digest}
+}
+
+func contains(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
+
+// githubAPI is the URL of the GitHub API, tests replace it
+var githubAPI = "https://api.github.com"
+
+// GitHubPullRequestCommits returns the commits of a GitHub pull request, including its head and merge commits
+func GitHubPullRequestCommits(ctx context.Context, repository string, number int) ([]string, error) {
+	_, repo, ok := strings.Cut(strings.TrimSuffix(repository, ".git"), "github.com/")
+	if !ok {
+		return nil, fmt.Errorf("pull requests can only be checked for GitHub repositories")
+	}
+
+	get := func(path string, v interface{}) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, githubAPI+"/repos/"+repo+path, nil)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Accept", "application/vnd.github+json")
+		if token := os.Getenv("GITHUB_TOKEN"); token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("GitHub API returned %s", resp.Status)
+		}
+		return json.NewDecoder(resp.Body).Decode(v)
+	}
+
+	pr := struct {
+		MergeCommitSHA string `json:"merge_commit_sha"`
+		Head           struct {
+			SHA string `json:"sha"`
+		} `json:"head"`
+	}{}
+	if err := get(fmt.Sprintf("/pulls/%d", number), &pr); err != nil {
+		return nil, err
+	}
+
+	shas := []string{pr.Head.SHA, pr.MergeCommitSHA}
+	// GitHub returns at most 100 commits a page, the pages end with a short one
+	const perPage = 100
+	for page := 1; ; page++ {
+		commits := []struct {
+			SHA string `json:"sha"`
+		}{}
+		if err := get(fmt.Sprintf("/pulls/%d/commits?per_page=%d&page=%d", number, perPage, page), &commits); err != nil {
+			return nil, err
+		}
+		for _, c := range commits {
+			shas = append(shas, c.SHA)
+		}
+		if len(commits) < perPage {
+			return shas, nil
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package receipt
+
+import (
+	"crypto"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"time"
+
+	intoto "github.com/in-toto/in-toto-golang/in_toto"
+	intotoCom "github.com/in-toto/in-toto-golang/in_toto/slsa_provenance/common"
+	"zombiezen.com/go/nix/nixbase32"
+
+	"github.com/buildsafedev/bsf/pkg/signing"
+)
+
+const (
+	// VSAPredicateType is the predicate type of SLSA verification summary attestations
+	VSAPredicateType = "https://slsa.dev/verification_summary/v1"
+	// DefaultVerifierID identifies bsf as the verifier of VSAs
+	DefaultVerifierID = "https://github.com/buildsafedev/bsf"
+	// DefaultPolicy identifies the policy bsf receipt verify applies: every link of the receipt chain holds
+	DefaultPolicy = "https://github.com/buildsafedev/bsf/receipt-chain/v1"
+
+	// VerificationPassed is the result of a verification in which no check failed
+	VerificationPassed = "PASSED"
+	// VerificationFailed is the result of a verification in which a check failed
+	VerificationFailed = "FAILED"
+)
+
+// VSAStatement is an in-toto statement summarising the verification of a receipt
+type VSAStatement struct {
+	intoto.StatementHeader
+	Predicate VSA `json:"predicate"`
+}
+
+// VSA is the predicate of a SLSA verification summary attestation, consumers rely on it instead of verifying the
+// receipt chain, the provenance and the signatures again
+type VSA struct {
+	Verifier           VSAVerifier          `json:"verifier"`
+	TimeVerified       time.Time            `json:"timeVerified"`
+	ResourceURI        string               `json:"resourceUri"`
+	Policy             ResourceDescriptor   `json:"policy"`
+	InputAttestations  []ResourceDescriptor `json:"inputAttestations,omitempty"`
+	VerificationResult string               `json:"verificationResult"`
+	VerifiedLevels     []string             `json:"verifiedLevels"`
+	SLSAVersion        string               `json:"slsaVersion"`
+}
+
+// VSAVerifier identifies the party that verified the receipt
+type VSAVerifier struct {
+	ID      string            `json:"id"`
+	Version map[string]string `json:"version,omitempty"`
+}
+
+// ResourceDescriptor names a resource by URI and digest
+type ResourceDescriptor struct {
+	URI    string              `json:"uri"`
+	Digest intotoCom.DigestSet `json:"digest,omitempty"`
+}
+
+// VSAOptions are what the verifier records about itself and the verified resource
+type VSAOptions struct {
+	VerifierID string
+	// Version is the version of bsf
+	Version     string
+	ResourceURI string
+	Policy      string
+	// Receipt is the signed receipt that was verified
+	Receipt []byte
+	// Identity is the CI workload identity the receipt was certified for, empty for receipts signed with a user key
+	Identity string
+}
+
+// NewVSA returns the verification summary of the checks of the receipt. The subjects are the image, the artifacts
+// and the output of the receipt. Receipts of trusted builders are signed with a key certified for the CI workload
+// that built them, they verify SLSA build level 2, receipts signed with a user key level 1.
+func NewVSA(r *Receipt, checks []Check, opts VSAOptions) *VSAStatement {
+	st := &VSAStatement{}
+	st.Type = "https://in-toto.io/Statement/v1"
+	st.PredicateType = VSAPredicateType
+	st.Subject = make([]intoto.Subject, 0)
+	if r.Image != nil {
+		st.Subject = append(st.Subject, subject(*r.Image))
+	}
+	for _, d := range r.Artifacts {
+		st.Subject = append(st.Subject, subject(d))
+	}
+	if hash, err := nixbase32.DecodeString(r.Output.NarHash); err == nil {
+		st.Subject = append(st.Subject, intoto.Subject{
+			Name:   r.Output.StorePath,
+			Digest: intotoCom.DigestSet{"sha256": hex.EncodeToString(hash)},
+		})
+	}
+
+	if opts.VerifierID == "" {
+		opts.VerifierID = DefaultVerifierID
+	}
+	if opts.Policy == "" {
+		opts.Policy = DefaultPolicy
+	}
+	if opts.ResourceURI == "" {
+		opts.ResourceURI = r.Source.Repository
+	}
+
+	st.Predicate = VSA{
+		Verifier:           VSAVerifier{ID: opts.VerifierID},
+		TimeVerified:       time.Now().UTC().Truncate(time.Second),
+		ResourceURI:        opts.ResourceURI,
+		Policy:             ResourceDescriptor{URI: opts.Policy},
+		InputAttestations:  make([]ResourceDescriptor, 0),
+		VerificationResult: VerificationPassed,
+		VerifiedLevels:     []string{"SLSA_BUILD_LEVEL_1"},
+		SLSAVersion:        "1.0",
+	}
+	if opts.Version != "" {
+		st.Predicate.Verifier.Version = map[string]string{"bsf": opts.Version}
+	}
+	if opts.Identity != "" {
+		st.Predicate.VerifiedLevels = []string{"SLSA_BUILD_LEVEL_2"}
+	}
+	if len(Failed(checks)) > 0 {
+		st.Predicate.VerificationResult = VerificationFailed
+		st.Predicate.VerifiedLevels = []string{}
+	}
+
+	if len(opts.Receipt) > 0 {
+		sum := sha256.Sum256(opts.Receipt)
+		st.Predicate.InputAttestations = append(st.Predicate.InputAttestations, ResourceDescriptor{
+			URI:    Name,
+			Digest: intotoCom.DigestSet{"sha256": hex.EncodeToString(sum[:])},
+		})
+	}
+	if r.Attestations.Name != "" {
+		algo, digest, _ := strings.Cut(r.Attestations.Digest, ":")
+		st.Predicate.InputAttestations = append(st.Predicate.InputAttestations, ResourceDescriptor{
+			URI:    r.Attestations.Name,
+			Digest: intotoCom.DigestSet{algo: digest},
+		})
+	}
+	return st
+}
+
+func subject(d Digest) intoto.Subject {
+	algo, digest, _ := strings.Cut(d.Digest, ":")
+	return intoto.Subject{Name: d.Name, Digest: intotoCom.DigestSet{algo: digest}}
+}
+
+// SignVSA signs the VSA as the verifier, as a DSSE envelope of the in-toto statement
+func SignVSA(st *VSAStatement, signer crypto.Signer, certificates []string) (*signing.SignedAttestation, error) {
+	payload, err := json.Marshal(st)
+	if err != nil {
+		return nil, err
+	}
+	env, err := signing.SignEnvelope(signer, signing.InTotoPayloadType, payload)
+	if err != nil {
+		return nil, err
+	}
+	return &signing.SignedAttestation{Envelope: env, Certificates: certificates}, nil
+}
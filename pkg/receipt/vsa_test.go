@@ -0,0 +1,115 @@
+package receipt
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	intotoCom "github.com/in-toto/in-toto-golang/in_toto/slsa_provenance/common"
+
+	"github.com/buildsafedev/bsf/pkg/signing"
+)
+
+func TestNewVSA(t *testing.T) {
+	r := &Receipt{
+		Source: Source{Repository: "https://github.com/acme/app", Commit: "abc"},
+		Output: Output{
+			StorePath: "/nix/store/1vng6wj07s51jsgj338m24m0c0mw2i3k-app-0.1.0",
+			NarHash:   "0000000000000000000000000000000000000000000000000000",
+		},
+		Image:        &Digest{Name: "app", Digest: "sha256:aaaa"},
+		Artifacts:    []Digest{{Name: "app-linux-amd64", Digest: "sha256:bbbb"}},
+		Attestations: Digest{Name: "attestations.intoto.jsonl", Digest: "sha256:cccc"},
+	}
+
+	tests := []struct {
+		name       string
+		checks     []Check
+		identity   string
+		wantResult string
+		wantLevels []string
+	}{
+		{
+			name:       "user key",
+			checks:     []Check{{Link: "output digest", Status: StatusOK}, {Link: "source → pull request", Status: StatusSkipped}},
+			wantResult: VerificationPassed,
+			wantLevels: []string{"SLSA_BUILD_LEVEL_1"},
+		},
+		{
+			name:       "trusted builder",
+			checks:     []Check{{Link: "output digest", Status: StatusOK}},
+			identity:   "https://github.com/acme/app/.github/workflows/release.yml@refs/heads/main",
+			wantResult: VerificationPassed,
+			wantLevels: []string{"SLSA_BUILD_LEVEL_2"},
+		},
+		{
+			name:       "failed check",
+			checks:     []Check{{Link: "output digest", Status: StatusFailed}},
+			identity:   "https://github.com/acme/app/.github/workflows/release.yml@refs/heads/main",
+			wantResult: VerificationFailed,
+			wantLevels: []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st := NewVSA(r, tt.checks, VSAOptions{Version: "v1.2.3", Receipt: []byte("{}"), Identity: tt.identity})
+
+			if st.PredicateType != VSAPredicateType {
+				t.Errorf("predicate type = %s", st.PredicateType)
+			}
+			if st.Predicate.VerificationResult != tt.wantResult || !reflect.DeepEqual(st.Predicate.VerifiedLevels, tt.wantLevels) {
+				t.Errorf("result = %s %v, want %s %v", st.Predicate.VerificationResult, st.Predicate.VerifiedLevels, tt.wantResult, tt.wantLevels)
+			}
+			if st.Predicate.ResourceURI != "https://github.com/acme/app" || st.Predicate.Verifier.ID != DefaultVerifierID || st.Predicate.Policy.URI != DefaultPolicy {
+				t.Errorf("unexpected defaults %+v", st.Predicate)
+			}
+
+			wantSubjects := map[string]intotoCom.DigestSet{
+				"app":              {"sha256": "aaaa"},
+				"app-linux-amd64":  {"sha256": "bbbb"},
+				r.Output.StorePath: {"sha256": "0000000000000000000000000000000000000000000000000000000000000000"},
+			}
+			if len(st.Subject) != len(wantSubjects) {
+				t.Fatalf("subjects = %v", st.Subject)
+			}
+			for _, s := range st.Subject {
+				if !reflect.DeepEqual(s.Digest, wantSubjects[s.Name]) {
+					t.Errorf("subject %s = %v, want %v", s.Name, s.Digest, wantSubjects[s.Name])
+				}
+			}
+
+			if len(st.Predicate.InputAttestations) != 2 || st.Predicate.InputAttestations[1].Digest["sha256"] != "cccc" {
+				t.Errorf("input attestations = %v", st.Predicate.InputAttestations)
+			}
+		})
+	}
+}
+
+func TestSignVSA(t *testing.T) {
+	signer, err := signing.NewEphemeralSigner()
+	if err != nil {
+		t.Fatal(err)
+	}
+	st := NewVSA(&Receipt{Source: Source{Repository: "https://github.com/acme/app"}}, nil, VSAOptions{})
+
+	signed, err := SignVSA(st, signer, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, err := signing.VerifyEnvelope(signer.Public(), signed.Envelope)
+	if err != nil {
+		t.Fatalf("VerifyEnvelope() error = %v", err)
+	}
+	if signed.Envelope.PayloadType != signing.InTotoPayloadType {
+		t.Errorf("payload type = %s", signed.Envelope.PayloadType)
+	}
+
+	decoded := map[string]interface{}{}
+	if err := json.Unmarshal(payload, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded["predicateType"] != VSAPredicateType {
+		t.Errorf("payload = %s", payload)
+	}
+}
@@ -0,0 +1,155 @@
+// Package release runs the steps of the release of a project in order, e.g. build, sign, push and publish, and
+// records their progress in a state file so a release that stopped resumes at the step that failed. The steps that
+// publish, that other systems see the result of, only run once every other step passed: nothing is published by a
+// release that fails a gate.
+package release
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"time"
+)
+
+// Statuses of the steps of a release
+const (
+	StepSucceeded = "succeeded"
+	StepFailed    = "failed"
+	// StepPending is the status of the steps that didn't run, as a step before them failed
+	StepPending = "pending"
+)
+
+// Step is a step of the release
+type Step struct {
+	Name string
+	// Publishes is set for the steps other systems see the result of, e.g. pushing an image
+	Publishes bool
+	// Run runs the step, writing its output to log
+	Run func(log io.Writer) error
+}
+
+// StepResult is the outcome of a step
+type StepResult struct {
+	Name      string `json:"name"`
+	Status    string `json:"status"`
+	Publishes bool   `json:"publishes,omitempty"`
+	Duration  string `json:"duration,omitempty"`
+	Error     string `json:"error,omitempty"`
+	// Resumed is set for the steps a previous run of the release completed
+	Resumed bool `json:"resumed,omitempty"`
+}
+
+// State is the progress of a release, written after each step
+type State struct {
+	// Commit and Args identify the release: the commit released and the arguments of the release
+	Commit  string       `json:"commit"`
+	Args    []string     `json:"args"`
+	Started time.Time    `json:"started"`
+	Steps   []StepResult `json:"steps"`
+}
+
+// ReadState reads the state file, nil when there is none
+func ReadState(path string) (*State, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	s := &State{}
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("invalid release state %s: %v", path, err)
+	}
+	return s, nil
+}
+
+// Write writes the state file
+func (s *State) Write(path string) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// Resumes reports if the state is the one of the release of the commit with the arguments
+func (s *State) Resumes(commit string, args []string) bool {
+	return s != nil && s.Commit == commit && slices.Equal(s.Args, args)
+}
+
+// Completed reports if the step of the state succeeded
+func (s *State) Completed(name string) bool {
+	if s == nil {
+		return false
+	}
+	for _, r := range s.Steps {
+		if r.Name == name && r.Status == StepSucceeded {
+			return true
+		}
+	}
+	return false
+}
+
+// Published returns the names of the steps that publish and succeeded
+func (s *State) Published() []string {
+	published := make([]string, 0)
+	for _, r := range s.Steps {
+		if r.Publishes && r.Status == StepSucceeded {
+			published = append(published, r.Name)
+		}
+	}
+	return published
+}
+
+// Check checks that the steps that publish come after the others, so none runs before every gate passed
+func Check(steps []Step) error {
+	publishing := ""
+	for _, s := range steps {
+		if s.Publishes && publishing == "" {
+			publishing = s.Name
+		}
+		if !s.Publishes && publishing != "" {
+			return fmt.Errorf("the %s step would publish before the %s step ran", publishing, s.Name)
+		}
+	}
+	return nil
+}
+
+// Run runs the steps in order, skipping the ones the state of the previous run completed when it is given, and stops
+// at the first that fails. The state is saved after each step. log returns the writer of the output of a step.
+func Run(steps []Step, state *State, previous *State, save func(*State) error, log func(name string) io.Writer) error {
+	if err := Check(steps); err != nil {
+		return err
+	}
+
+	state.Steps = make([]StepResult, len(steps))
+	for i, s := range steps {
+		state.Steps[i] = StepResult{Name: s.Name, Status: StepPending, Publishes: s.Publishes}
+	}
+
+	for i, s := range steps {
+		r := &state.Steps[i]
+		if previous.Completed(s.Name) {
+			r.Status, r.Resumed = StepSucceeded, true
+			continue
+		}
+
+		start := time.Now()
+		err := s.Run(log(s.Name))
+		r.Duration = time.Since(start).Round(time.Millisecond).String()
+		r.Status = StepSucceeded
+		if err != nil {
+			r.Status, r.Error = StepFailed, err.Error()
+		}
+		if saveErr := save(state); saveErr != nil {
+			return saveErr
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", s.Name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package release
+
+import (
+	"errors"
+	"io"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name    string
+		steps   []Step
+		wantErr bool
+	}{
+		{name: "gates first", steps: []Step{{Name: "build"}, {Name: "image"}, {Name: "sign", Publishes: true}, {Name: "push", Publishes: true}}},
+		{name: "no publishing", steps: []Step{{Name: "build"}}},
+		{name: "publishing before a gate", steps: []Step{{Name: "build"}, {Name: "push", Publishes: true}, {Name: "image"}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := Check(tt.steps); (err != nil) != tt.wantErr {
+				t.Errorf("Check() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRun(t *testing.T) {
+	var ran []string
+	failing := "image"
+	step := func(name string, publishes bool) Step {
+		return Step{Name: name, Publishes: publishes, Run: func(io.Writer) error {
+			ran = append(ran, name)
+			if name == failing {
+				return errors.New("no oci block")
+			}
+			return nil
+		}}
+	}
+	steps := []Step{step("build", false), step("image", false), step("sign", true), step("push", true)}
+	path := filepath.Join(t.TempDir(), "bsf-release.json")
+	save := func(s *State) error { return s.Write(path) }
+	log := func(string) io.Writer { return io.Discard }
+
+	// a failing gate stops the release before anything is published
+	state := &State{Commit: "abc", Args: []string{"--sign=true"}}
+	if err := Run(steps, state, nil, save, log); err == nil {
+		t.Fatal("Run() succeeded, want the image step to fail")
+	}
+	if !reflect.DeepEqual(ran, []string{"build", "image"}) {
+		t.Errorf("ran %v, want build and image", ran)
+	}
+	if len(state.Published()) != 0 || state.Steps[2].Status != StepPending || state.Steps[1].Error != "no oci block" {
+		t.Errorf("Run() state = %+v", state.Steps)
+	}
+
+	previous, err := ReadState(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !previous.Resumes("abc", []string{"--sign=true"}) || previous.Resumes("def", []string{"--sign=true"}) || previous.Resumes("abc", nil) {
+		t.Errorf("Resumes() of %+v", previous)
+	}
+
+	// resuming skips the steps that completed
+	ran, failing = nil, ""
+	state = &State{Commit: "abc", Args: []string{"--sign=true"}}
+	if err := Run(steps, state, previous, save, log); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(ran, []string{"image", "sign", "push"}) {
+		t.Errorf("ran %v, want the steps from image", ran)
+	}
+	if !state.Steps[0].Resumed || state.Steps[1].Resumed || !reflect.DeepEqual(state.Published(), []string{"sign", "push"}) {
+		t.Errorf("Run() state = %+v", state.Steps)
+	}
+
+	if s, err := ReadState(filepath.Join(t.TempDir(), "missing.json")); s != nil || err != nil {
+		t.Errorf("ReadState() of a missing file = %+v, %v", s, err)
+	}
+}
@@ -0,0 +1,142 @@
+package sbom
+
+import (
+	_ "embed"
+	"encoding/json"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/bom-squad/protobom/pkg/sbom"
+
+	"github.com/buildsafedev/bsf/pkg/hcl2nix"
+)
+
+//go:embed aliases.json
+var embeddedAliases []byte
+
+// aliasPattern maps the packages of a nixpkgs package set to an ecosystem, the upstream name is the first group
+type aliasPattern struct {
+	Match string `json:"match"`
+	Type  string `json:"type"`
+	re    *regexp.Regexp
+}
+
+// Aliases maps nixpkgs package names to the names of their upstream ecosystem, e.g. python3.11-requests to the
+// requests package of pypi, for the package urls and CPEs of the SBOM
+type Aliases struct {
+	exact    map[string]hcl2nix.Alias
+	patterns []aliasPattern
+	// user are the package names mapped by bsf.hcl
+	user map[string]bool
+}
+
+// NewAliases returns the aliases bsf embeds extended with the aliases of bsf.hcl, which take precedence
+func NewAliases(user []hcl2nix.Alias) *Aliases {
+	table := struct {
+		Patterns []aliasPattern  `json:"patterns"`
+		Aliases  []hcl2nix.Alias `json:"aliases"`
+	}{}
+	// the table is embedded, it is checked by the tests
+	_ = json.Unmarshal(embeddedAliases, &table)
+
+	a := &Aliases{exact: make(map[string]hcl2nix.Alias), user: make(map[string]bool)}
+	for _, p := range table.Patterns {
+		p.re = regexp.MustCompile(p.Match)
+		a.patterns = append(a.patterns, p)
+	}
+	for _, alias := range append(table.Aliases, user...) {
+		a.exact[alias.Pname] = alias
+	}
+	for _, alias := range user {
+		a.user[alias.Pname] = true
+	}
+	return a
+}
+
+// Overridden reports if the nixpkgs package name is mapped by an alias block of bsf.hcl
+func (a *Aliases) Overridden(pname string) bool {
+	return a.user[pname]
+}
+
+// Lookup returns the alias of the nixpkgs package name, false when it is not mapped
+func (a *Aliases) Lookup(pname string) (hcl2nix.Alias, bool) {
+	if alias, ok := a.exact[pname]; ok {
+		if alias.Name == "" {
+			alias.Name = pname
+		}
+		return alias, true
+	}
+	for _, p := range a.patterns {
+		if m := p.re.FindStringSubmatch(pname); m != nil {
+			return hcl2nix.Alias{Pname: pname, Name: normalizeName(p.Type, m[1]), Type: p.Type}, true
+		}
+	}
+	return hcl2nix.Alias{}, false
+}
+
+var pypiSeparators = regexp.MustCompile(`[-_.]+`)
+
+// normalizeName returns the name as the package url type spells it
+func normalizeName(purlType, name string) string {
+	if purlType == "pypi" {
+		return pypiSeparators.ReplaceAllString(strings.ToLower(name), "-")
+	}
+	return name
+}
+
+// Identifiers returns the package url of the package, and its CPE when the alias has one
+func (a *Aliases) Identifiers(pname, version string) map[int32]string {
+	ids := map[int32]string{
+		int32(sbom.SoftwareIdentifierType_PURL): GeneratePurl(pname, version, "", ""),
+	}
+	alias, ok := a.Lookup(pname)
+	if !ok {
+		return ids
+	}
+
+	if alias.Type != "" && alias.Type != "nix" {
+		purl := "pkg:" + alias.Type + "/"
+		if alias.Namespace != "" {
+			purl += alias.Namespace + "/"
+		}
+		ids[int32(sbom.SoftwareIdentifierType_PURL)] = purl + alias.Name + "@" + version
+	} else if alias.Name != pname {
+		ids[int32(sbom.SoftwareIdentifierType_PURL)] = GeneratePurl(alias.Name, version, "", "")
+	}
+	if alias.CPE != "" {
+		ids[int32(sbom.SoftwareIdentifierType_CPE23)] = GenerateCPE(alias.CPE, version)
+	}
+	return ids
+}
+
+// GenerateCPE returns the CPE 2.3 of the version of an application given as vendor:product
+func GenerateCPE(vendorProduct, version string) string {
+	if version == "" {
+		version = "*"
+	}
+	return "cpe:2.3:a:" + vendorProduct + ":" + version + ":*:*:*:*:*:*:*"
+}
+
+// Unmapped returns the components of the SBOM, as name@version, that only have a nix package url and no CPE:
+// scanners can't match them against the advisories of their upstream ecosystem
+func Unmapped(doc *sbom.Document) []string {
+	roots := make(map[string]bool)
+	for _, id := range doc.NodeList.RootElements {
+		roots[id] = true
+	}
+
+	unmapped := make([]string, 0)
+	for _, n := range doc.NodeList.Nodes {
+		if roots[n.Id] || n.Type != sbom.Node_PACKAGE {
+			continue
+		}
+		purl := n.Identifiers[int32(sbom.SoftwareIdentifierType_PURL)]
+		if n.Identifiers[int32(sbom.SoftwareIdentifierType_CPE23)] != "" || !strings.HasPrefix(purl, "pkg:nix/") {
+			continue
+		}
+		unmapped = append(unmapped, n.Name+"@"+n.Version)
+	}
+	sort.Strings(unmapped)
+	return unmapped
+}
@@ -0,0 +1,73 @@
+package sbom
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/bom-squad/protobom/pkg/sbom"
+
+	"github.com/buildsafedev/bsf/pkg/hcl2nix"
+)
+
+func TestEmbeddedAliases(t *testing.T) {
+	table := struct {
+		Aliases []hcl2nix.Alias `json:"aliases"`
+	}{}
+	if err := json.Unmarshal(embeddedAliases, &table); err != nil {
+		t.Fatal(err)
+	}
+	for _, a := range table.Aliases {
+		if errStr := a.Validate(); errStr != nil {
+			t.Errorf("embedded alias %s is invalid: %s", a.Pname, *errStr)
+		}
+	}
+}
+
+func TestAliasIdentifiers(t *testing.T) {
+	aliases := NewAliases([]hcl2nix.Alias{
+		{Pname: "python3.11-acme_Client", Name: "acme-client-internal", Type: "pypi"},
+		{Pname: "curl", CPE: "acme:curl"},
+		{Pname: "jackson", Name: "jackson-databind", Type: "maven", Namespace: "com.fasterxml.jackson.core"},
+	})
+	purl := int32(sbom.SoftwareIdentifierType_PURL)
+	cpe := int32(sbom.SoftwareIdentifierType_CPE23)
+
+	tests := []struct {
+		pname   string
+		version string
+		want    map[int32]string
+	}{
+		{pname: "python3.11-requests", version: "2.31.0", want: map[int32]string{purl: "pkg:pypi/requests@2.31.0"}},
+		{pname: "python3.12-Flask_SQLAlchemy", version: "3.1.1", want: map[int32]string{purl: "pkg:pypi/flask-sqlalchemy@3.1.1"}},
+		{pname: "perl5.38.2-URI", version: "5.21", want: map[int32]string{purl: "pkg:cpan/URI@5.21"}},
+		{pname: "python3", version: "3.11.8", want: map[int32]string{purl: "pkg:nix/python@v3.11.8", cpe: "cpe:2.3:a:python:python:3.11.8:*:*:*:*:*:*:*"}},
+		{pname: "openssl", version: "3.0.13", want: map[int32]string{purl: "pkg:nix/openssl@v3.0.13", cpe: "cpe:2.3:a:openssl:openssl:3.0.13:*:*:*:*:*:*:*"}},
+		{pname: "libunmapped", version: "1.0", want: map[int32]string{purl: "pkg:nix/libunmapped@v1.0"}},
+		// the aliases of bsf.hcl take precedence over the embedded ones and the patterns
+		{pname: "python3.11-acme_Client", version: "1.0", want: map[int32]string{purl: "pkg:pypi/acme-client-internal@1.0"}},
+		{pname: "curl", version: "8.6.0", want: map[int32]string{purl: "pkg:nix/curl@v8.6.0", cpe: "cpe:2.3:a:acme:curl:8.6.0:*:*:*:*:*:*:*"}},
+		{pname: "jackson", version: "2.17.0", want: map[int32]string{purl: "pkg:maven/com.fasterxml.jackson.core/jackson-databind@2.17.0"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pname, func(t *testing.T) {
+			if got := aliases.Identifiers(tt.pname, tt.version); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Identifiers(%s) = %v, want %v", tt.pname, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnmapped(t *testing.T) {
+	aliases := NewAliases(nil)
+	doc := sbom.NewDocument()
+	doc.NodeList.AddRootNode(&sbom.Node{Id: "app", Name: "app", Type: sbom.Node_PACKAGE, Identifiers: aliases.Identifiers("app", "1.0")})
+	for _, c := range [][2]string{{"python3.11-requests", "2.31.0"}, {"openssl", "3.0.13"}, {"libunmapped", "1.0"}, {"acme-tool", "0.1"}} {
+		doc.NodeList.AddNode(&sbom.Node{Id: c[0], Name: c[0], Version: c[1], Type: sbom.Node_PACKAGE, Identifiers: aliases.Identifiers(c[0], c[1])})
+	}
+
+	want := []string{"acme-tool@0.1", "libunmapped@1.0"}
+	if got := Unmapped(doc); !reflect.DeepEqual(got, want) {
+		t.Errorf("Unmapped() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,136 @@
+package compat
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+
+	cdx "github.com/CycloneDX/cyclonedx-go"
+	"github.com/bom-squad/protobom/pkg/formats"
+	"github.com/bom-squad/protobom/pkg/reader"
+	spdxjson "github.com/spdx/tools-golang/json"
+	"github.com/spdx/tools-golang/spdxlib"
+	"github.com/xeipuuv/gojsonschema"
+)
+
+// schemas holds the official CycloneDX 1.5 JSON schema with the schemas it references, and the SPDX 2.3 JSON schema.
+// spdx.schema.json is the SPDX license list CycloneDX references, not the schema of SPDX documents.
+//
+//go:embed schemas/*.json
+var schemas embed.FS
+
+// Result is the outcome of checking a SBOM with one consumer
+type Result struct {
+	Consumer string   `json:"consumer"`
+	Errors   []string `json:"errors,omitempty"`
+}
+
+// OK reports whether the consumer accepted the SBOM
+func (r Result) OK() bool {
+	return len(r.Errors) == 0
+}
+
+// Check validates the SBOM against the schema of its format and parses it with the libraries SBOM consumers use:
+// syft and trivy read CycloneDX with cyclonedx-go and SPDX with spdx/tools-golang, and bsf itself reads both with protobom.
+func Check(format formats.Format, data []byte) ([]Result, error) {
+	var results []Result
+	switch format {
+	case formats.CDX15JSON:
+		schema, err := cdxSchema()
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, validateSchema("cyclonedx-1.5-schema", schema, data), checkCycloneDXGo(data))
+	case formats.SPDX23JSON:
+		schema, err := spdxSchema()
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, validateSchema("spdx-2.3-schema", schema, data), checkSPDXToolsGolang(data))
+	default:
+		return nil, fmt.Errorf("unsupported format %s", format)
+	}
+
+	return append(results, checkProtobom(data)), nil
+}
+
+func cdxSchema() (*gojsonschema.Schema, error) {
+	loader := gojsonschema.NewSchemaLoader()
+	for _, name := range []string{"spdx.schema.json", "jsf-0.82.schema.json"} {
+		b, err := schemas.ReadFile("schemas/" + name)
+		if err != nil {
+			return nil, err
+		}
+		if err := loader.AddSchemas(gojsonschema.NewBytesLoader(b)); err != nil {
+			return nil, fmt.Errorf("failed to load %s: %v", name, err)
+		}
+	}
+
+	b, err := schemas.ReadFile("schemas/bom-1.5.schema.json")
+	if err != nil {
+		return nil, err
+	}
+	return loader.Compile(gojsonschema.NewBytesLoader(b))
+}
+
+func spdxSchema() (*gojsonschema.Schema, error) {
+	b, err := schemas.ReadFile("schemas/spdx-2.3.schema.json")
+	if err != nil {
+		return nil, err
+	}
+	return gojsonschema.NewSchema(gojsonschema.NewBytesLoader(b))
+}
+
+func validateSchema(consumer string, schema *gojsonschema.Schema, data []byte) Result {
+	r := Result{Consumer: consumer}
+	res, err := schema.Validate(gojsonschema.NewBytesLoader(data))
+	if err != nil {
+		r.Errors = append(r.Errors, err.Error())
+		return r
+	}
+	for _, e := range res.Errors() {
+		r.Errors = append(r.Errors, e.String())
+	}
+	return r
+}
+
+func checkCycloneDXGo(data []byte) Result {
+	r := Result{Consumer: "cyclonedx-go"}
+	bom := cdx.NewBOM()
+	err := cdx.NewBOMDecoder(bytes.NewReader(data), cdx.BOMFileFormatJSON).Decode(bom)
+	if err != nil {
+		r.Errors = append(r.Errors, err.Error())
+		return r
+	}
+	if bom.SpecVersion != cdx.SpecVersion1_5 {
+		r.Errors = append(r.Errors, fmt.Sprintf("unexpected spec version %s", bom.SpecVersion))
+	}
+	if bom.Metadata == nil || bom.Metadata.Component == nil {
+		r.Errors = append(r.Errors, "metadata.component is missing, consumers can't tell what the SBOM describes")
+	}
+	return r
+}
+
+func checkSPDXToolsGolang(data []byte) Result {
+	r := Result{Consumer: "spdx/tools-golang"}
+	doc, err := spdxjson.Read(bytes.NewReader(data))
+	if err != nil {
+		r.Errors = append(r.Errors, err.Error())
+		return r
+	}
+	if err := spdxlib.ValidateDocument(doc); err != nil {
+		r.Errors = append(r.Errors, err.Error())
+	}
+	if _, err := spdxlib.GetDescribedPackageIDs(doc); err != nil {
+		r.Errors = append(r.Errors, err.Error())
+	}
+	return r
+}
+
+func checkProtobom(data []byte) Result {
+	r := Result{Consumer: "protobom"}
+	if _, err := reader.New().ParseStream(bytes.NewReader(data)); err != nil {
+		r.Errors = append(r.Errors, err.Error())
+	}
+	return r
+}
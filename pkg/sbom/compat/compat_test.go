@@ -0,0 +1,263 @@
+package compat
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/awalterschulze/gographviz"
+	"github.com/bom-squad/protobom/pkg/formats"
+	"github.com/bom-squad/protobom/pkg/sbom"
+	buildsafev1 "github.com/buildsafedev/bsf-apis/go/buildsafe/v1"
+
+	"github.com/buildsafedev/bsf/pkg/depgraph"
+	"github.com/buildsafedev/bsf/pkg/hcl2nix"
+	nixcmd "github.com/buildsafedev/bsf/pkg/nix/cmd"
+	bsbom "github.com/buildsafedev/bsf/pkg/sbom"
+)
+
+var update = flag.Bool("update", false, "update the golden files in testdata")
+
+// fixtureDocument returns a SBOM covering the fields bsf emits: closure components with hashes,
+// download locations, runtime and build edges, and lock file packages
+func fixtureDocument() *sbom.Document {
+	graph := gographviz.NewGraph()
+	graph.SetName("G")
+	nodes := []struct {
+		id, name, version, download string
+	}{
+		{`"aaaa-app-1.0.0"`, "app", "1.0.0", ""},
+		{`"bbbb-openssl-3.0.13"`, "openssl", "3.0.13", "https://www.openssl.org/source/openssl-3.0.13.tar.gz"},
+		{`"cccc-curl-8.6.0"`, "curl", "8.6.0", "git+https://github.com/curl/curl@7ab9d43"},
+		{`"dddd-cmake-3.28.3"`, "cmake", "3.28.3", ""},
+	}
+	for _, n := range nodes {
+		graph.AddNode("G", n.id, nil)
+		attrs := graph.Nodes.Lookup[n.id].Attrs
+		attrs["name"] = n.name
+		attrs["version"] = n.version
+		attrs["hash"] = "0mdqa9w1p6cmli6976v4wi0sw9r4p5prkj7lzfd1877wk11c9c73"
+		if n.download != "" {
+			attrs["download"] = n.download
+		}
+	}
+	graph.Edges.Add(&gographviz.Edge{Src: `"bbbb-openssl-3.0.13"`, Dst: `"cccc-curl-8.6.0"`, Dir: true, Attrs: gographviz.Attrs{"reftype": nixcmd.EdgeRuntime}})
+	graph.Edges.Add(&gographviz.Edge{Src: `"cccc-curl-8.6.0"`, Dst: `"aaaa-app-1.0.0"`, Dir: true, Attrs: gographviz.Attrs{"reftype": nixcmd.EdgeRuntime}})
+	graph.Edges.Add(&gographviz.Edge{Src: `"dddd-cmake-3.28.3"`, Dst: `"cccc-curl-8.6.0"`, Dir: true, Attrs: gographviz.Attrs{"reftype": nixcmd.EdgeBuild}})
+
+	lockFile := &hcl2nix.LockFile{
+		Packages: []hcl2nix.LockPackage{
+			{
+				Package: &buildsafev1.Package{
+					Name:         "curl",
+					Version:      "8.6.0",
+					Homepage:     "https://curl.se",
+					SpdxId:       "curl",
+					Description:  "A command line tool for transferring files with URL syntax",
+					EpochSeconds: 1706659200,
+				},
+				Runtime: true,
+			},
+		},
+	}
+
+	appNode := &sbom.Node{
+		Id:      bsbom.GenerateID("app", "1.0.0", "linux", "amd64"),
+		Type:    sbom.Node_PACKAGE,
+		Name:    "app",
+		Version: "1.0.0",
+		Identifiers: map[int32]string{
+			int32(sbom.SoftwareIdentifierType_PURL): bsbom.GeneratePurl("app", "1.0.0", "linux", "amd64"),
+		},
+		PrimaryPurpose: []sbom.Purpose{sbom.Purpose_EXECUTABLE},
+		Hashes: map[int32]string{
+			int32(sbom.HashAlgorithm_SHA256): "4f53cda18c2baa0c0354bb5f9a3ecbe5ed12ab4d8e11ba873c2f11161202b945",
+		},
+	}
+
+	return bsbom.PackageGraphToSBOM(appNode, lockFile, depgraph.FromDOT(graph))
+}
+
+// volatile are the fields that change on every run
+var volatile = map[string]bool{
+	"created":           true,
+	"timestamp":         true,
+	"documentNamespace": true,
+	"serialNumber":      true,
+}
+
+// normalize replaces volatile fields and sorts arrays, the writers don't keep components in a stable order,
+// so the output can be compared with golden files
+func normalize(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		t.Fatal(err)
+	}
+	out, err := json.MarshalIndent(canonical(v), "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func canonical(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, e := range v {
+			if volatile[k] {
+				v[k] = "NORMALIZED"
+				continue
+			}
+			v[k] = canonical(e)
+		}
+	case []interface{}:
+		keys := make([]string, len(v))
+		for i, e := range v {
+			v[i] = canonical(e)
+			b, _ := json.Marshal(v[i])
+			keys[i] = string(b)
+		}
+		sort.Sort(byKey{keys, v})
+	}
+	return v
+}
+
+// byKey sorts values by their JSON encoding
+type byKey struct {
+	keys   []string
+	values []interface{}
+}
+
+func (b byKey) Len() int           { return len(b.keys) }
+func (b byKey) Less(i, j int) bool { return b.keys[i] < b.keys[j] }
+func (b byKey) Swap(i, j int) {
+	b.keys[i], b.keys[j] = b.keys[j], b.keys[i]
+	b.values[i], b.values[j] = b.values[j], b.values[i]
+}
+
+func render(t *testing.T, doc *sbom.Document, format formats.Format) []byte {
+	t.Helper()
+	data, err := bsbom.Write(doc, format)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestConsumerCompatibility(t *testing.T) {
+	tests := []struct {
+		format formats.Format
+		golden string
+	}{
+		{formats.SPDX23JSON, "app.spdx.json"},
+		{formats.CDX15JSON, "app.cdx.json"},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.format), func(t *testing.T) {
+			data := render(t, fixtureDocument(), tt.format)
+
+			results, err := Check(tt.format, data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, r := range results {
+				for _, e := range r.Errors {
+					t.Errorf("%s: %s", r.Consumer, e)
+				}
+			}
+
+			golden := filepath.Join("testdata", tt.golden)
+			got := normalize(t, data)
+			if *update {
+				if err := os.WriteFile(golden, got, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("%v, run go test with -update to create it", err)
+			}
+			if !bytes.Equal(bytes.TrimSpace(got), bytes.TrimSpace(want)) {
+				t.Errorf("%s output changed, check consumers still accept it and run go test with -update:\n%s", tt.format, got)
+			}
+		})
+	}
+}
+
+func TestCheckRejects(t *testing.T) {
+	tests := []struct {
+		name   string
+		format formats.Format
+		data   string
+	}{
+		{
+			name:   "cdx without spec version",
+			format: formats.CDX15JSON,
+			data:   `{"bomFormat":"CycloneDX","components":[{"type":"library","name":"curl"}]}`,
+		},
+		{
+			name:   "cdx with invalid component type",
+			format: formats.CDX15JSON,
+			data:   `{"bomFormat":"CycloneDX","specVersion":"1.5","components":[{"type":"nix","name":"curl"}]}`,
+		},
+		{
+			name:   "spdx without namespace",
+			format: formats.SPDX23JSON,
+			data:   `{"spdxVersion":"SPDX-2.3","dataLicense":"CC0-1.0","SPDXID":"SPDXRef-DOCUMENT","name":"x","creationInfo":{"created":"2024-01-01T00:00:00Z","creators":["Tool: bsf"]}}`,
+		},
+		{
+			name:   "spdx with invalid package id",
+			format: formats.SPDX23JSON,
+			data:   `{"spdxVersion":"SPDX-2.3","dataLicense":"CC0-1.0","SPDXID":"SPDXRef-DOCUMENT","name":"x","documentNamespace":"https://example.com/x","creationInfo":{"created":"2024-01-01T00:00:00Z","creators":["Tool: bsf"]},"packages":[{"SPDXID":"pkg:nix/curl@v8.6.0","name":"curl","downloadLocation":"NOASSERTION"}]}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results, err := Check(tt.format, []byte(tt.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			failed := false
+			for _, r := range results {
+				if !r.OK() {
+					failed = true
+				}
+			}
+			if !failed {
+				t.Errorf("expected at least one consumer to reject the SBOM")
+			}
+		})
+	}
+}
+
+func TestSPDXSchema(t *testing.T) {
+	schema, err := spdxSchema()
+	if err != nil {
+		t.Fatal(err)
+	}
+	head := `"spdxVersion":"SPDX-2.3","dataLicense":"CC0-1.0","SPDXID":"SPDXRef-DOCUMENT","name":"x","documentNamespace":"https://example.com/x","creationInfo":{"created":"2024-01-01T00:00:00Z","creators":["Tool: bsf"]}`
+	tests := []struct {
+		name string
+		data string
+		ok   bool
+	}{
+		{"valid", `{` + head + `,"packages":[{"SPDXID":"SPDXRef-curl","name":"curl","downloadLocation":"NOASSERTION","primaryPackagePurpose":"LIBRARY"}]}`, true},
+		{"without creators", `{"spdxVersion":"SPDX-2.3","dataLicense":"CC0-1.0","SPDXID":"SPDXRef-DOCUMENT","name":"x","creationInfo":{"created":"2024-01-01T00:00:00Z","creators":[]}}`, false},
+		{"package without download location", `{` + head + `,"packages":[{"SPDXID":"SPDXRef-curl","name":"curl"}]}`, false},
+		{"unknown purpose", `{` + head + `,"packages":[{"SPDXID":"SPDXRef-curl","name":"curl","downloadLocation":"NOASSERTION","primaryPackagePurpose":"EXECUTABLE"}]}`, false},
+		{"unknown relationship", `{` + head + `,"relationships":[{"spdxElementId":"SPDXRef-DOCUMENT","relatedSpdxElement":"SPDXRef-curl","relationshipType":"USES"}]}`, false},
+		{"unknown field", `{` + head + `,"components":[]}`, false},
+	}
+	for _, tt := range tests {
+		if r := validateSchema("spdx-2.3-schema", schema, []byte(tt.data)); r.OK() != tt.ok {
+			t.Errorf("%s: schema errors %v, want ok %v", tt.name, r.Errors, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,433 @@
+package sbom
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/bom-squad/protobom/pkg/formats"
+	"github.com/bom-squad/protobom/pkg/reader"
+	"github.com/bom-squad/protobom/pkg/sbom"
+	"github.com/bom-squad/protobom/pkg/writer"
+	"google.golang.org/protobuf/proto"
+
+	bio "github.com/buildsafedev/bsf/pkg/io"
+)
+
+// StorePathComment is the comment of the external reference holding the store path of a component.
+// SPDX keeps it as an OTHER external reference, CycloneDX as the nix:store_path property.
+const StorePathComment = "nix-store-path"
+
+// CycloneDX properties holding the data protobom has no CycloneDX field for, so it survives conversions
+const (
+	PropertyStorePath  = "nix:store_path"
+	PropertyComment    = "bsf:comment"
+	PropertyEdgePrefix = "bsf:edge:"
+)
+
+// Protobom is the protocol buffers serialization of the protobom document. It keeps every field of the components,
+// for tools that read protobom documents rather than SPDX or CycloneDX.
+const Protobom formats.Format = "application/x-protobuf;type=protobom"
+
+// ParseFormat returns the format of its command line name: spdx-json, cyclonedx-json or protobom
+func ParseFormat(name string) (formats.Format, error) {
+	switch name {
+	case "spdx", "spdx-json":
+		return formats.SPDX23JSON, nil
+	case "cyclonedx", "cdx", "cyclonedx-json":
+		return formats.CDX15JSON, nil
+	case "protobom":
+		return Protobom, nil
+	}
+	return "", fmt.Errorf("unsupported format %q, use spdx-json, cyclonedx-json or protobom", name)
+}
+
+// FileName returns the name and media type of a SBOM file in the format
+func FileName(format formats.Format) (string, string) {
+	switch {
+	case format == Protobom:
+		return "sbom.pb", "application/x-protobuf"
+	case format.Type() == formats.CDXFORMAT:
+		return "sbom.cdx.json", "application/vnd.cyclonedx+json"
+	}
+	return "sbom.spdx.json", "application/spdx+json"
+}
+
+// DetectFormat returns the format of the SBOM document: CycloneDX or SPDX for JSON documents, protobom otherwise
+func DetectFormat(data []byte) formats.Format {
+	if !bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		return Protobom
+	}
+	var doc struct {
+		BOMFormat string `json:"bomFormat"`
+	}
+	if err := json.Unmarshal(data, &doc); err == nil && doc.BOMFormat == "CycloneDX" {
+		return formats.CDX15JSON
+	}
+	return formats.SPDX23JSON
+}
+
+// Write serializes the document in the format. The store paths, comments, field provenances and typed relationships
+// of the components are stashed in CycloneDX properties, Parse restores them.
+func Write(bom *sbom.Document, format formats.Format) ([]byte, error) {
+	if format == Protobom {
+		return proto.Marshal(bom)
+	}
+	out := bio.NewBufferCloser()
+	err := writer.New().WriteStreamWithOptions(bom, out, &writer.Options{Format: format})
+	if err != nil {
+		return nil, err
+	}
+	if format.Type() != formats.CDXFORMAT {
+		return out.Bytes(), nil
+	}
+	return stashCDX(bom, out.Bytes())
+}
+
+// Parse reads a SPDX, CycloneDX or protobom document, restoring the data Write stashed in CycloneDX properties
+func Parse(data []byte) (*sbom.Document, error) {
+	if !bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		bom := &sbom.Document{}
+		if err := proto.Unmarshal(data, bom); err != nil {
+			return nil, fmt.Errorf("not a SPDX, CycloneDX or protobom document: %w", err)
+		}
+		return bom, nil
+	}
+
+	bom, err := reader.New().ParseStream(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	cdx := &cdxBOM{}
+	if err := json.Unmarshal(data, cdx); err != nil || cdx.BOMFormat != "CycloneDX" {
+		return bom, nil
+	}
+	restoreCDX(bom, cdx)
+	return bom, nil
+}
+
+// Convert converts the SBOM to the format, SPDX to CycloneDX or back, without losing the Nix data of its components
+func Convert(data []byte, format formats.Format) ([]byte, error) {
+	bom, err := Parse(data)
+	if err != nil {
+		return nil, err
+	}
+	return Write(bom, format)
+}
+
+// stashCDX adds the properties of the components to the CycloneDX document written by protobom
+func stashCDX(bom *sbom.Document, data []byte) ([]byte, error) {
+	var doc map[string]interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+
+	edges := make(map[string]map[string][]string)
+	for _, e := range bom.NodeList.Edges {
+		if edges[e.From] == nil {
+			edges[e.From] = make(map[string][]string)
+		}
+		edges[e.From][e.Type.String()] = append(edges[e.From][e.Type.String()], e.To...)
+	}
+
+	var visit func(c map[string]interface{})
+	visit = func(c map[string]interface{}) {
+		if children, ok := c["components"].([]interface{}); ok {
+			for _, child := range children {
+				if cc, ok := child.(map[string]interface{}); ok {
+					visit(cc)
+				}
+			}
+		}
+		id, _ := c["bom-ref"].(string)
+		node := bom.NodeList.GetNodeByID(id)
+		if node == nil {
+			return
+		}
+
+		props, _ := c["properties"].([]interface{})
+		add := func(name, value string) {
+			props = append(props, map[string]interface{}{"name": name, "value": value})
+		}
+		if node.Comment != "" {
+			add(PropertyComment, node.Comment)
+		}
+		for _, ref := range node.ExternalReferences {
+			switch ref.Comment {
+			case StorePathComment:
+				add(PropertyStorePath, ref.Url)
+			case PendingEnrichmentComment:
+				add(PropertyPendingEnrichment, ref.Url)
+			case RuntimeRequirementComment:
+				add(PropertyRuntimeRequirement, ref.Url)
+			}
+		}
+		for _, p := range FieldProvenances(node) {
+			add(PropertySourcePrefix+p.Field, p.Source)
+			add(PropertyConfidencePrefix+p.Field, p.Confidence)
+		}
+		types := make([]string, 0, len(edges[id]))
+		for t := range edges[id] {
+			types = append(types, t)
+		}
+		sort.Strings(types)
+		for _, t := range types {
+			add(PropertyEdgePrefix+t, strings.Join(edges[id][t], ","))
+		}
+		if len(props) > 0 {
+			c["properties"] = props
+		}
+
+		// the store path, the field provenances, the pending enrichment and the runtime requirement are properties,
+		// the endpoints and flags of services are fields of the service, they aren't URLs
+		if refs, ok := c["externalReferences"].([]interface{}); ok {
+			kept := refs[:0]
+			for _, r := range refs {
+				if rm, ok := r.(map[string]interface{}); ok && isStashedReference(rm["comment"]) {
+					continue
+				}
+				kept = append(kept, r)
+			}
+			if len(kept) == 0 {
+				delete(c, "externalReferences")
+			} else {
+				c["externalReferences"] = kept
+			}
+		}
+	}
+
+	if metadata, ok := doc["metadata"].(map[string]interface{}); ok {
+		if root, ok := metadata["component"].(map[string]interface{}); ok {
+			visit(root)
+		}
+	}
+	visit(doc)
+	moveServices(bom, doc)
+
+	var out bytes.Buffer
+	enc := json.NewEncoder(&out)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// isStashedReference returns whether the external reference of the comment is written as a CycloneDX property or
+// field of a service
+func isStashedReference(comment interface{}) bool {
+	switch comment {
+	case StorePathComment, FieldProvenanceComment, PendingEnrichmentComment, RuntimeRequirementComment,
+		ServiceComment, ServiceEndpointComment:
+		return true
+	}
+	return false
+}
+
+// moveServices moves the components that are services to the services of the CycloneDX document. Their relationships
+// are dependencies of the document, which protobom only writes for the components.
+func moveServices(bom *sbom.Document, doc map[string]interface{}) {
+	components, _ := doc["components"].([]interface{})
+	kept := make([]interface{}, 0, len(components))
+	services := make([]map[string]interface{}, 0)
+	isService := make(map[string]bool)
+	for _, c := range components {
+		cm, _ := c.(map[string]interface{})
+		id, _ := cm["bom-ref"].(string)
+		node := bom.NodeList.GetNodeByID(id)
+		if node == nil {
+			kept = append(kept, c)
+			continue
+		}
+		s, ok := ServiceOf(node)
+		if !ok {
+			kept = append(kept, c)
+			continue
+		}
+
+		isService[id] = true
+		svc := map[string]interface{}{"bom-ref": id, "name": node.Name, "x-trust-boundary": s.TrustBoundary}
+		if node.Version != "" {
+			svc["version"] = node.Version
+		}
+		if node.Description != "" {
+			svc["description"] = node.Description
+		}
+		if len(s.Endpoints) > 0 {
+			svc["endpoints"] = s.Endpoints
+		}
+		if s.Authenticated != nil {
+			svc["authenticated"] = *s.Authenticated
+		}
+		for _, k := range []string{"externalReferences", "properties"} {
+			if v, ok := cm[k]; ok {
+				svc[k] = v
+			}
+		}
+		services = append(services, svc)
+	}
+	if len(services) == 0 {
+		return
+	}
+	// protobom writes the components in no particular order
+	sort.Slice(services, func(i, j int) bool {
+		return services[i]["bom-ref"].(string) < services[j]["bom-ref"].(string)
+	})
+	doc["components"] = kept
+	doc["services"] = services
+
+	refs := make([]string, 0)
+	dependsOn := make(map[string][]string)
+	add := func(from, to string) {
+		if _, ok := dependsOn[from]; !ok {
+			refs = append(refs, from)
+		}
+		if !slices.Contains(dependsOn[from], to) {
+			dependsOn[from] = append(dependsOn[from], to)
+		}
+	}
+	existing, _ := doc["dependencies"].([]interface{})
+	for _, d := range existing {
+		dm, _ := d.(map[string]interface{})
+		ref, _ := dm["ref"].(string)
+		if ref == "" {
+			continue
+		}
+		if _, ok := dependsOn[ref]; !ok {
+			refs = append(refs, ref)
+			dependsOn[ref] = []string{}
+		}
+		tos, _ := dm["dependsOn"].([]interface{})
+		for _, to := range tos {
+			if to, ok := to.(string); ok {
+				add(ref, to)
+			}
+		}
+	}
+	for _, e := range bom.NodeList.Edges {
+		if e.Type == sbom.Edge_contains {
+			continue
+		}
+		for _, to := range e.To {
+			if isService[e.From] || isService[to] {
+				add(e.From, to)
+			}
+		}
+	}
+	deps := make([]interface{}, 0, len(refs))
+	for _, ref := range refs {
+		deps = append(deps, map[string]interface{}{"ref": ref, "dependsOn": dependsOn[ref]})
+	}
+	doc["dependencies"] = deps
+}
+
+// cdxBOM has the fields of a CycloneDX document protobom doesn't read
+type cdxBOM struct {
+	BOMFormat string `json:"bomFormat"`
+	Metadata  struct {
+		Component *cdxComponent `json:"component"`
+	} `json:"metadata"`
+	Components []cdxComponent `json:"components"`
+	Services   []cdxService   `json:"services"`
+}
+
+type cdxService struct {
+	cdxComponent
+	Name          string   `json:"name"`
+	Version       string   `json:"version"`
+	Description   string   `json:"description"`
+	Endpoints     []string `json:"endpoints"`
+	Authenticated *bool    `json:"authenticated"`
+	TrustBoundary bool     `json:"x-trust-boundary"`
+}
+
+type cdxComponent struct {
+	Ref      string `json:"bom-ref"`
+	Supplier *struct {
+		Name string `json:"name"`
+	} `json:"supplier"`
+	Properties []struct {
+		Name  string `json:"name"`
+		Value string `json:"value"`
+	} `json:"properties"`
+	Components []cdxComponent `json:"components"`
+}
+
+// restoreCDX sets the data stashed in the properties of the CycloneDX document on the nodes read by protobom
+func restoreCDX(bom *sbom.Document, cdx *cdxBOM) {
+	var edges []*sbom.Edge
+	var visit func(c *cdxComponent)
+	visit = func(c *cdxComponent) {
+		for i := range c.Components {
+			visit(&c.Components[i])
+		}
+		node := bom.NodeList.GetNodeByID(c.Ref)
+		if node == nil {
+			return
+		}
+		// a CycloneDX supplier is always an organization
+		if c.Supplier != nil && c.Supplier.Name != "" && len(node.Suppliers) == 0 {
+			node.Suppliers = []*sbom.Person{{Name: c.Supplier.Name, IsOrg: true}}
+		}
+		sources := make(map[string]string)
+		confidences := make(map[string]string)
+		for _, p := range c.Properties {
+			switch {
+			case strings.HasPrefix(p.Name, PropertySourcePrefix):
+				sources[strings.TrimPrefix(p.Name, PropertySourcePrefix)] = p.Value
+			case strings.HasPrefix(p.Name, PropertyConfidencePrefix):
+				confidences[strings.TrimPrefix(p.Name, PropertyConfidencePrefix)] = p.Value
+			case p.Name == PropertyComment:
+				node.Comment = p.Value
+			case p.Name == PropertyStorePath:
+				node.ExternalReferences = append(node.ExternalReferences, &sbom.ExternalReference{
+					Url:     p.Value,
+					Type:    sbom.ExternalReference_OTHER,
+					Comment: StorePathComment,
+				})
+			case p.Name == PropertyPendingEnrichment:
+				SetPendingEnrichment(node, strings.Fields(p.Value))
+			case p.Name == PropertyRuntimeRequirement:
+				kind, constraint, _ := strings.Cut(p.Value, " ")
+				setRuntimeRequirement(node, kind, constraint)
+			case strings.HasPrefix(p.Name, PropertyEdgePrefix):
+				t, ok := sbom.Edge_Type_value[strings.TrimPrefix(p.Name, PropertyEdgePrefix)]
+				if !ok || p.Value == "" {
+					continue
+				}
+				edges = append(edges, &sbom.Edge{Type: sbom.Edge_Type(t), From: c.Ref, To: strings.Split(p.Value, ",")})
+			}
+		}
+		fields := make([]string, 0, len(sources))
+		for field := range sources {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+		for _, field := range fields {
+			setFieldProvenance(node, FieldProvenance{Field: field, Source: sources[field], Confidence: confidences[field]})
+		}
+	}
+
+	// protobom doesn't read services, they are components marked as services
+	for i := range cdx.Services {
+		s := &cdx.Services[i]
+		node := &sbom.Node{Id: s.Ref, Type: sbom.Node_PACKAGE, Name: s.Name, Version: s.Version, Description: s.Description}
+		SetService(node, Service{Endpoints: s.Endpoints, Authenticated: s.Authenticated, TrustBoundary: s.TrustBoundary})
+		bom.NodeList.AddNode(node)
+		visit(&s.cdxComponent)
+	}
+	if cdx.Metadata.Component != nil {
+		visit(cdx.Metadata.Component)
+	}
+	for i := range cdx.Components {
+		visit(&cdx.Components[i])
+	}
+	// the nesting of CycloneDX components only says which contains which, the typed relationships replace it
+	if len(edges) > 0 {
+		bom.NodeList.Edges = edges
+	}
+}
@@ -0,0 +1,162 @@
+package sbom
+
+import (
+	"testing"
+
+	"github.com/awalterschulze/gographviz"
+	"github.com/bom-squad/protobom/pkg/formats"
+	"github.com/bom-squad/protobom/pkg/sbom"
+
+	"github.com/buildsafedev/bsf/pkg/depgraph"
+	"github.com/buildsafedev/bsf/pkg/hcl2nix"
+	nixcmd "github.com/buildsafedev/bsf/pkg/nix/cmd"
+)
+
+func TestConvertRoundTrip(t *testing.T) {
+	graph := gographviz.NewGraph()
+	graph.SetName("G")
+	for name, attrs := range map[string][3]string{
+		`"aaaa-app-1.0"`:        {"app", "1.0", ""},
+		`"bbbb-openssl-3.0.13"`: {"openssl", "3.0.13", "loaded"},
+	} {
+		if err := graph.AddNode("G", name, nil); err != nil {
+			t.Fatal(err)
+		}
+		node := graph.Nodes.Lookup[name]
+		node.Attrs["name"] = attrs[0]
+		node.Attrs["version"] = attrs[1]
+		node.Attrs["hash"] = "1b8m03r63zqhnjf7l5wnldhh7c134ap5vpj0850ymkq1iyzicy5s"
+		if attrs[2] != "" {
+			node.Attrs["reachability"] = attrs[2]
+			node.Attrs[AttrPendingEnrichment] = "nixpkgs"
+		}
+	}
+	graph.Edges.Add(&gographviz.Edge{Src: `"bbbb-openssl-3.0.13"`, Dst: `"aaaa-app-1.0"`, Dir: true, Attrs: gographviz.Attrs{"reftype": nixcmd.EdgeRuntime}})
+
+	app := &sbom.Node{Id: GenerateID("app", "1.0", "", ""), Name: "app", Version: "1.0"}
+	lockFile := &hcl2nix.LockFile{App: hcl2nix.LockApp{Requirements: []hcl2nix.Requirement{
+		{Name: "postgres", Version: ">= 14", Description: "primary database"},
+		{Name: "stripe", Kind: hcl2nix.RequirementService, URL: "https://api.stripe.com"},
+	}}}
+	bom := OutputsGraphToSBOM([]Root{{Node: app, StorePath: "/nix/store/aaaa-app-1.0"}}, lockFile, depgraph.FromDOT(graph))
+	spdx, err := Write(bom, formats.SPDX23JSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cdx, err := Convert(spdx, formats.CDX15JSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if DetectFormat(spdx) != formats.SPDX23JSON || DetectFormat(cdx) != formats.CDX15JSON {
+		t.Errorf("DetectFormat() = %s, %s", DetectFormat(spdx), DetectFormat(cdx))
+	}
+	back, err := Convert(cdx, formats.SPDX23JSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := Parse(back)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	openssl := got.NodeList.GetNodeByID(GenerateID("openssl", "3.0.13", "", ""))
+	if openssl == nil {
+		t.Fatal("openssl was lost")
+	}
+	storePath := ""
+	for _, ref := range openssl.ExternalReferences {
+		if ref.Comment == StorePathComment {
+			storePath = ref.Url
+		}
+	}
+	if storePath != "/nix/store/bbbb-openssl-3.0.13" {
+		t.Errorf("store path = %q, want /nix/store/bbbb-openssl-3.0.13", storePath)
+	}
+	if openssl.Hashes[int32(sbom.HashAlgorithm_SHA256)] != NarHashHex("1b8m03r63zqhnjf7l5wnldhh7c134ap5vpj0850ymkq1iyzicy5s") {
+		t.Errorf("NAR hash was lost: %v", openssl.Hashes)
+	}
+	if openssl.Comment != "reachability: loaded" {
+		t.Errorf("comment = %q, want reachability: loaded", openssl.Comment)
+	}
+	if pending := PendingEnrichment(openssl); len(pending) != 1 || pending[0] != "nixpkgs" {
+		t.Errorf("pending enrichment = %v, want [nixpkgs]", pending)
+	}
+
+	for id, want := range map[string][2]string{
+		"requirement-postgres": {hcl2nix.RequirementPackage, ">= 14"},
+		"requirement-stripe":   {hcl2nix.RequirementService, ""},
+	} {
+		node := got.NodeList.GetNodeByID(id)
+		if node == nil {
+			t.Errorf("%s was lost", id)
+			continue
+		}
+		if kind, constraint, ok := RuntimeRequirement(node); !ok || kind != want[0] || constraint != want[1] {
+			t.Errorf("RuntimeRequirement(%s) = %s, %q, %t, want %s, %q", id, kind, constraint, ok, want[0], want[1])
+		}
+	}
+
+	edges := make(map[string]bool)
+	for _, e := range got.NodeList.Edges {
+		for _, to := range e.To {
+			edges[e.From+" "+e.Type.String()+" "+to] = true
+		}
+	}
+	for _, e := range bom.NodeList.Edges {
+		for _, to := range e.To {
+			if !edges[e.From+" "+e.Type.String()+" "+to] {
+				t.Errorf("relationship %s %s %s was lost", e.From, e.Type, to)
+			}
+		}
+	}
+}
+
+func TestProtobomRoundTrip(t *testing.T) {
+	app := &sbom.Node{Id: GenerateID("app", "1.0", "", ""), Name: "app", Version: "1.0"}
+	bom := OutputsGraphToSBOM([]Root{{Node: app}}, &hcl2nix.LockFile{}, depgraph.New())
+	data, err := Write(bom, Protobom)
+	if err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	if !IsDocument(data) {
+		t.Fatal("IsDocument() = false for a protobom document")
+	}
+
+	spdx, err := Convert(data, formats.SPDX23JSON)
+	if err != nil {
+		t.Fatalf("Convert() error = %v", err)
+	}
+	got, err := Parse(spdx)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if got.NodeList.GetNodeByID(app.Id) == nil {
+		t.Errorf("application %s not found after the round trip", app.Id)
+	}
+
+	if _, err := Parse([]byte("not a document")); err == nil {
+		t.Error("Parse() of garbage succeeded")
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    formats.Format
+		wantErr bool
+	}{
+		{name: "spdx-json", want: formats.SPDX23JSON},
+		{name: "cyclonedx-json", want: formats.CDX15JSON},
+		{name: "cdx", want: formats.CDX15JSON},
+		{name: "protobom", want: Protobom},
+		{name: "spdx-tv", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseFormat(tt.name)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseFormat(%s) = %s, %v", tt.name, got, err)
+		}
+	}
+}
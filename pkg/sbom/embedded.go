@@ -0,0 +1,46 @@
+package sbom
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/bom-squad/protobom/pkg/sbom"
+
+	"github.com/buildsafedev/bsf/pkg/embedded"
+)
+
+// EmbeddedComment prefixes the comment of the components embedded in the store path of another, followed by the file
+// they were found in
+const EmbeddedComment = "embedded in "
+
+// AddEmbedded adds the packages embedded in the store paths of the components as components they contain, e.g. the
+// wheels of a python environment or the libraries bundled in a JAR. packages maps store paths to their packages.
+func AddEmbedded(bom *sbom.Document, packages map[string][]embedded.Package) {
+	nodes := append([]*sbom.Node(nil), bom.NodeList.Nodes...)
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].Id < nodes[j].Id })
+	for _, node := range nodes {
+		for _, ref := range node.ExternalReferences {
+			if ref.Comment != StorePathComment {
+				continue
+			}
+			for _, p := range packages[ref.Url] {
+				purl := p.Purl()
+				sub := &sbom.Node{
+					Id:             node.Id + "-embedded-" + strings.Trim(invalidIDChars.ReplaceAllString(purl, "-"), "-"),
+					Type:           sbom.Node_PACKAGE,
+					Name:           p.Name,
+					Version:        p.Version,
+					Licenses:       p.Licenses,
+					PrimaryPurpose: []sbom.Purpose{sbom.Purpose_LIBRARY},
+					Identifiers:    map[int32]string{int32(sbom.SoftwareIdentifierType_PURL): purl},
+					Comment:        EmbeddedComment + ref.Url + "/" + p.File,
+				}
+				if bom.NodeList.GetNodeByID(sub.Id) != nil {
+					continue
+				}
+				bom.NodeList.AddNode(sub)
+				bom.NodeList.RelateNodeAtID(sub, node.Id, sbom.Edge_contains)
+			}
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package sbom
+
+import (
+	"testing"
+
+	"github.com/bom-squad/protobom/pkg/formats"
+	"github.com/bom-squad/protobom/pkg/sbom"
+
+	"github.com/buildsafedev/bsf/pkg/embedded"
+)
+
+func TestAddEmbedded(t *testing.T) {
+	env := &sbom.Node{Id: GenerateID("python3-env", "3.11.9", "", ""), Type: sbom.Node_PACKAGE, Name: "python3-env", Version: "3.11.9"}
+	addStorePath(env, "/nix/store/abc-python3-3.11.9-env")
+	app := &sbom.Node{Id: GenerateID("app", "0.0.0", "", ""), Name: "app"}
+	bom := sbom.NewDocument()
+	bom.NodeList.AddRootNode(app)
+	bom.NodeList.AddNode(env)
+	bom.NodeList.RelateNodeAtID(env, app.Id, sbom.Edge_dependsOn)
+
+	AddEmbedded(bom, map[string][]embedded.Package{
+		"/nix/store/abc-python3-3.11.9-env": {
+			{Ecosystem: embedded.EcosystemPyPI, Name: "PyYAML", Version: "6.0.1", Licenses: []string{"MIT"}, File: "lib/python3.11/site-packages/PyYAML-6.0.1.dist-info"},
+			{Ecosystem: embedded.EcosystemPyPI, Name: "requests", Version: "2.31.0", File: "lib/python3.11/site-packages/requests-2.31.0.dist-info"},
+		},
+	})
+
+	sub := bom.NodeList.GetNodeByID(env.Id + "-embedded-pkg-pypi-pyyaml-6.0.1")
+	if sub == nil {
+		t.Fatal("missing the PyYAML package embedded in the environment")
+	}
+	if sub.Identifiers[int32(sbom.SoftwareIdentifierType_PURL)] != "pkg:pypi/pyyaml@6.0.1" || len(sub.Licenses) != 1 {
+		t.Errorf("package = %v", sub)
+	}
+	if want := EmbeddedComment + "/nix/store/abc-python3-3.11.9-env/lib/python3.11/site-packages/PyYAML-6.0.1.dist-info"; sub.Comment != want {
+		t.Errorf("comment = %q, want %q", sub.Comment, want)
+	}
+	contained := 0
+	for _, e := range bom.NodeList.Edges {
+		if e.From == env.Id && e.Type == sbom.Edge_contains {
+			contained += len(e.To)
+		}
+	}
+	if contained != 2 {
+		t.Errorf("the environment contains %d packages, want 2", contained)
+	}
+
+	for _, format := range []formats.Format{formats.SPDX23JSON, formats.CDX15JSON} {
+		if _, err := Write(bom, format); err != nil {
+			t.Errorf("Write(%s): %v", format, err)
+		}
+	}
+}
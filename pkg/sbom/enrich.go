@@ -0,0 +1,63 @@
+package sbom
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/bom-squad/protobom/pkg/sbom"
+)
+
+// AttrPendingEnrichment is the attribute of the closure graph nodes listing the sources of metadata whose lookup
+// didn't complete before the enrichment deadline of the build, e.g. "nixpkgs registry"
+const AttrPendingEnrichment = "pending_enrichment"
+
+// PendingEnrichmentComment is the comment of the external reference listing the sources of metadata a component
+// is pending, bsf enrich completes them. SPDX keeps it as an OTHER external reference, CycloneDX as the
+// bsf:pending_enrichment property.
+const PendingEnrichmentComment = "bsf-pending-enrichment"
+
+// PropertyPendingEnrichment is the CycloneDX property holding the sources of metadata a component is pending
+const PropertyPendingEnrichment = "bsf:pending_enrichment"
+
+// PendingEnrichment returns the sources of metadata the component is pending
+func PendingEnrichment(node *sbom.Node) []string {
+	for _, ref := range node.ExternalReferences {
+		if ref.Comment == PendingEnrichmentComment {
+			return strings.Fields(ref.Url)
+		}
+	}
+	return nil
+}
+
+// SetPendingEnrichment replaces the sources of metadata the component is pending, components pending none have no
+// reference
+func SetPendingEnrichment(node *sbom.Node, sources []string) {
+	node.ExternalReferences = slices.DeleteFunc(node.ExternalReferences, func(ref *sbom.ExternalReference) bool {
+		return ref.Comment == PendingEnrichmentComment
+	})
+	if len(sources) == 0 {
+		return
+	}
+	node.ExternalReferences = append(node.ExternalReferences, &sbom.ExternalReference{
+		Url:     strings.Join(sources, " "),
+		Type:    sbom.ExternalReference_OTHER,
+		Comment: PendingEnrichmentComment,
+	})
+}
+
+// Enrich sets the metadata of the attributes, named as the attributes of the closure graph nodes, on a component of
+// a SBOM written before they were resolved: the nixpkgs metadata and the one of the package registry. The name and
+// version the registry may have are not set, the component keeps its identifier.
+func Enrich(node *sbom.Node, attrs map[string]string) {
+	if node.Identifiers == nil {
+		node.Identifiers = make(map[int32]string)
+	}
+	addNixpkgsMetadata(node, attrs)
+	addRegistryMetadata(node, attrs)
+	if p, ok := licenseProvenance(attrs); ok {
+		setFieldProvenance(node, p)
+	}
+	if attrs["purl"] != "" {
+		setFieldProvenance(node, FieldProvenance{FieldPurl, SourceRegistry, ConfidenceHigh})
+	}
+}
@@ -0,0 +1,40 @@
+package sbom
+
+import (
+	"testing"
+
+	"github.com/bom-squad/protobom/pkg/sbom"
+)
+
+func TestEnrich(t *testing.T) {
+	node := &sbom.Node{Id: GenerateID("billing", "2.1.0", "", ""), Name: "billing", Version: "2.1.0"}
+	SetPendingEnrichment(node, []string{"nixpkgs", "registry"})
+	if pending := PendingEnrichment(node); len(pending) != 2 {
+		t.Fatalf("pending enrichment = %v, want nixpkgs and registry", pending)
+	}
+
+	Enrich(node, map[string]string{
+		"name":        "billing-service",
+		"license":     "LicenseRef-Proprietary",
+		"purl":        "pkg:generic/acme/billing@2.1.0",
+		"description": "billing service",
+	})
+	SetPendingEnrichment(node, nil)
+
+	if node.Name != "billing" || node.Id != GenerateID("billing", "2.1.0", "", "") {
+		t.Errorf("the component was renamed: %s %s", node.Name, node.Id)
+	}
+	if node.LicenseConcluded != "LicenseRef-Proprietary" || node.Description != "billing service" {
+		t.Errorf("unexpected metadata: %s %s", node.LicenseConcluded, node.Description)
+	}
+	if node.Identifiers[int32(sbom.SoftwareIdentifierType_PURL)] != "pkg:generic/acme/billing@2.1.0" {
+		t.Errorf("purl = %v", node.Identifiers)
+	}
+	provs := FieldProvenances(node)
+	if len(provs) != 2 || provs[0] != (FieldProvenance{FieldLicense, SourceRegistry, ConfidenceHigh}) {
+		t.Errorf("field provenances = %v", provs)
+	}
+	if pending := PendingEnrichment(node); len(pending) != 0 {
+		t.Errorf("pending enrichment = %v, want none", pending)
+	}
+}
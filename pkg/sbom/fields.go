@@ -0,0 +1,161 @@
+package sbom
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/bom-squad/protobom/pkg/sbom"
+
+	"github.com/buildsafedev/bsf/pkg/nixmeta"
+)
+
+// FieldProvenanceComment is the comment of the external references recording how a field of a component was derived.
+// SPDX keeps them as OTHER external references, CycloneDX as bsf:source: and bsf:confidence: properties.
+const FieldProvenanceComment = "bsf-field-provenance"
+
+// CycloneDX properties holding the source and confidence of a field, e.g. bsf:source:license
+const (
+	PropertySourcePrefix     = "bsf:source:"
+	PropertyConfidencePrefix = "bsf:confidence:"
+)
+
+// Fields of components whose provenance is recorded
+const (
+	FieldVersion = "version"
+	FieldLicense = "license"
+	FieldPurl    = "purl"
+)
+
+// Sources of the fields of components
+const (
+	// SourceStorePath is a field parsed from the name of the store path
+	SourceStorePath = "store-path"
+	// SourceNixpkgs is a field of the nixpkgs attribute of the package
+	SourceNixpkgs = "nixpkgs"
+	// SourceRegistry is a field of the internal package registry
+	SourceRegistry = "registry"
+	// SourceOverride is a field set by an alias block of bsf.hcl
+	SourceOverride = "override"
+	// SourceAlias is a field set by the aliases bsf ships, mapping nixpkgs names to upstream ecosystems
+	SourceAlias = "alias"
+	// SourceInherited is a license inherited from the packages a wrapper wraps
+	SourceInherited = "inherited"
+)
+
+// Confidence levels of the fields of components: authoritative, derived by a rule, or guessed
+const (
+	ConfidenceHigh   = "high"
+	ConfidenceMedium = "medium"
+	ConfidenceLow    = "low"
+)
+
+// FieldProvenance is how a field of a component was derived, and how much it can be trusted
+type FieldProvenance struct {
+	Field      string
+	Source     string
+	Confidence string
+}
+
+// String returns the field provenance as recorded in external references, field:source:confidence
+func (p FieldProvenance) String() string {
+	return p.Field + ":" + p.Source + ":" + p.Confidence
+}
+
+// parseFieldProvenance parses the field provenance of an external reference
+func parseFieldProvenance(s string) (FieldProvenance, bool) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 3 {
+		return FieldProvenance{}, false
+	}
+	return FieldProvenance{Field: parts[0], Source: parts[1], Confidence: parts[2]}, true
+}
+
+// FieldProvenances returns the provenance of the fields of the component, sorted by field
+func FieldProvenances(node *sbom.Node) []FieldProvenance {
+	provs := make([]FieldProvenance, 0)
+	for _, ref := range node.ExternalReferences {
+		if ref.Comment != FieldProvenanceComment {
+			continue
+		}
+		if p, ok := parseFieldProvenance(ref.Url); ok {
+			provs = append(provs, p)
+		}
+	}
+	sort.Slice(provs, func(i, j int) bool { return provs[i].Field < provs[j].Field })
+	return provs
+}
+
+// setFieldProvenance records the provenance of a field of the component, replacing the one recorded before
+func setFieldProvenance(node *sbom.Node, p FieldProvenance) {
+	for _, ref := range node.ExternalReferences {
+		if prev, ok := parseFieldProvenance(ref.Url); ok && ref.Comment == FieldProvenanceComment && prev.Field == p.Field {
+			ref.Url = p.String()
+			return
+		}
+	}
+	node.ExternalReferences = append(node.ExternalReferences, &sbom.ExternalReference{
+		Url:     p.String(),
+		Type:    sbom.ExternalReference_OTHER,
+		Comment: FieldProvenanceComment,
+	})
+}
+
+// closureFieldProvenances returns how the version, license and package url of a closure component were derived
+// from the annotations of its graph node
+func closureFieldProvenances(attrs map[string]string, aliases *Aliases, name string) []FieldProvenance {
+	registry := attrs["internal_id"] != "" || attrs["registry_url"] != ""
+	provs := make([]FieldProvenance, 0, 3)
+
+	switch version := attrs["version"]; {
+	case version == "":
+	case registry:
+		provs = append(provs, FieldProvenance{FieldVersion, SourceRegistry, ConfidenceHigh})
+	case attrs["attr_path"] != "":
+		// nixpkgs has an attribute of this version, the name of the store path split right
+		provs = append(provs, FieldProvenance{FieldVersion, SourceNixpkgs, ConfidenceHigh})
+	case unicode.IsDigit(rune(version[0])):
+		provs = append(provs, FieldProvenance{FieldVersion, SourceStorePath, ConfidenceMedium})
+	default:
+		// the last part of names without a version, e.g. source or env
+		provs = append(provs, FieldProvenance{FieldVersion, SourceStorePath, ConfidenceLow})
+	}
+
+	if p, ok := licenseProvenance(attrs); ok {
+		provs = append(provs, p)
+	}
+
+	if attrs["purl"] != "" {
+		return append(provs, FieldProvenance{FieldPurl, SourceRegistry, ConfidenceHigh})
+	}
+	return append(provs, purlProvenance(aliases, name, attrs["hash"] != ""))
+}
+
+// licenseProvenance returns where the license of the closure graph node comes from, if it has one
+func licenseProvenance(attrs map[string]string) (FieldProvenance, bool) {
+	switch {
+	case attrs["license"] != "":
+		return FieldProvenance{FieldLicense, SourceRegistry, ConfidenceHigh}, true
+	case attrs["licenses"] != "":
+		return FieldProvenance{FieldLicense, SourceNixpkgs, ConfidenceHigh}, true
+	case attrs[nixmeta.AttrInheritedLicenses] != "":
+		return FieldProvenance{FieldLicense, SourceInherited, ConfidenceMedium}, true
+	}
+	return FieldProvenance{}, false
+}
+
+// purlProvenance returns how the package url of a package was derived. Upstream package urls are mapped by
+// aliases, nix package urls qualified with the NAR hash name the store path exactly.
+func purlProvenance(aliases *Aliases, name string, narHash bool) FieldProvenance {
+	alias, ok := aliases.Lookup(name)
+	switch {
+	case !ok || alias.Type == "" || alias.Type == "nix":
+		if narHash {
+			return FieldProvenance{FieldPurl, SourceStorePath, ConfidenceHigh}
+		}
+		return FieldProvenance{FieldPurl, SourceStorePath, ConfidenceMedium}
+	case aliases.Overridden(name):
+		return FieldProvenance{FieldPurl, SourceOverride, ConfidenceHigh}
+	}
+	return FieldProvenance{FieldPurl, SourceAlias, ConfidenceMedium}
+}
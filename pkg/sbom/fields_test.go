@@ -0,0 +1,112 @@
+package sbom
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/bom-squad/protobom/pkg/formats"
+	"github.com/bom-squad/protobom/pkg/sbom"
+
+	"github.com/buildsafedev/bsf/pkg/hcl2nix"
+	"github.com/buildsafedev/bsf/pkg/nixmeta"
+)
+
+func TestClosureFieldProvenances(t *testing.T) {
+	aliases := NewAliases([]hcl2nix.Alias{{Pname: "python3.11-mylib", Name: "mylib", Type: "pypi"}})
+	hash := "1b8m03r63zqhnjf7l5wnldhh7c134ap5vpj0850ymkq1iyzicy5s"
+
+	tests := []struct {
+		name  string
+		attrs map[string]string
+		want  []FieldProvenance
+	}{
+		{
+			name:  "openssl",
+			attrs: map[string]string{"version": "3.0.13", "hash": hash},
+			want: []FieldProvenance{
+				{FieldVersion, SourceStorePath, ConfidenceMedium},
+				{FieldPurl, SourceStorePath, ConfidenceHigh},
+			},
+		},
+		{
+			name:  "openssl",
+			attrs: map[string]string{"version": "3.0.13", "attr_path": "openssl", "licenses": "Apache-2.0"},
+			want: []FieldProvenance{
+				{FieldVersion, SourceNixpkgs, ConfidenceHigh},
+				{FieldLicense, SourceNixpkgs, ConfidenceHigh},
+				{FieldPurl, SourceStorePath, ConfidenceMedium},
+			},
+		},
+		{
+			name:  "python3",
+			attrs: map[string]string{"version": "env", nixmeta.AttrInheritedLicenses: "Python-2.0"},
+			want: []FieldProvenance{
+				{FieldVersion, SourceStorePath, ConfidenceLow},
+				{FieldLicense, SourceInherited, ConfidenceMedium},
+				{FieldPurl, SourceStorePath, ConfidenceMedium},
+			},
+		},
+		{
+			name:  "python3.11-mylib",
+			attrs: map[string]string{"version": "1.2.0"},
+			want: []FieldProvenance{
+				{FieldVersion, SourceStorePath, ConfidenceMedium},
+				{FieldPurl, SourceOverride, ConfidenceHigh},
+			},
+		},
+		{
+			name:  "python3.11-requests",
+			attrs: map[string]string{"version": "2.31.0"},
+			want: []FieldProvenance{
+				{FieldVersion, SourceStorePath, ConfidenceMedium},
+				{FieldPurl, SourceAlias, ConfidenceMedium},
+			},
+		},
+		{
+			name:  "acme-lib",
+			attrs: map[string]string{"version": "2.1.0", "internal_id": "42", "license": "LicenseRef-Acme", "purl": "pkg:generic/acme/lib@2.1.0"},
+			want: []FieldProvenance{
+				{FieldVersion, SourceRegistry, ConfidenceHigh},
+				{FieldLicense, SourceRegistry, ConfidenceHigh},
+				{FieldPurl, SourceRegistry, ConfidenceHigh},
+			},
+		},
+	}
+	for _, tt := range tests {
+		if got := closureFieldProvenances(tt.attrs, aliases, tt.name); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("closureFieldProvenances(%s, %v) = %v, want %v", tt.name, tt.attrs, got, tt.want)
+		}
+	}
+}
+
+func TestFieldProvenanceRoundTrip(t *testing.T) {
+	node := &sbom.Node{Id: GenerateID("openssl", "3.0.13", "", ""), Name: "openssl", Version: "3.0.13"}
+	setFieldProvenance(node, FieldProvenance{FieldVersion, SourceStorePath, ConfidenceMedium})
+	setFieldProvenance(node, FieldProvenance{FieldPurl, SourceStorePath, ConfidenceHigh})
+	setFieldProvenance(node, FieldProvenance{FieldVersion, SourceNixpkgs, ConfidenceHigh})
+	want := []FieldProvenance{
+		{FieldPurl, SourceStorePath, ConfidenceHigh},
+		{FieldVersion, SourceNixpkgs, ConfidenceHigh},
+	}
+	if got := FieldProvenances(node); !reflect.DeepEqual(got, want) {
+		t.Fatalf("FieldProvenances() = %v, want %v", got, want)
+	}
+
+	bom := sbom.NewDocument()
+	bom.NodeList.AddRootNode(node)
+	cdx, err := Write(bom, formats.CDX15JSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := Parse(cdx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	back := got.NodeList.GetNodeByID(node.Id)
+	if back == nil {
+		t.Fatal("component was lost")
+	}
+	if provs := FieldProvenances(back); !reflect.DeepEqual(provs, want) {
+		t.Errorf("field provenances after a CycloneDX round trip = %v, want %v", provs, want)
+	}
+}
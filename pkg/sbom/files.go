@@ -0,0 +1,35 @@
+package sbom
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/bom-squad/protobom/pkg/sbom"
+)
+
+// AddFiles adds the files of the store paths of the components as file components they contain, e.g. the
+// lib/libssl.so.3 of openssl. files maps store paths to the paths of their files relative to them.
+func AddFiles(bom *sbom.Document, files map[string][]string) {
+	nodes := append([]*sbom.Node(nil), bom.NodeList.Nodes...)
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].Id < nodes[j].Id })
+	for _, node := range nodes {
+		for _, ref := range node.ExternalReferences {
+			if ref.Comment != StorePathComment {
+				continue
+			}
+			for _, f := range files[ref.Url] {
+				file := &sbom.Node{
+					Id:      node.Id + "-file-" + strings.Trim(invalidIDChars.ReplaceAllString(f, "-"), "-"),
+					Type:    sbom.Node_FILE,
+					Name:    f,
+					Comment: ref.Url + "/" + f,
+				}
+				if bom.NodeList.GetNodeByID(file.Id) != nil {
+					continue
+				}
+				bom.NodeList.AddNode(file)
+				bom.NodeList.RelateNodeAtID(file, node.Id, sbom.Edge_contains)
+			}
+		}
+	}
+}
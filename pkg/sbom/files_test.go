@@ -0,0 +1,51 @@
+package sbom
+
+import (
+	"testing"
+
+	"github.com/bom-squad/protobom/pkg/formats"
+	"github.com/bom-squad/protobom/pkg/sbom"
+)
+
+func TestAddFiles(t *testing.T) {
+	openssl := &sbom.Node{Id: GenerateID("openssl", "3.0.13", "", ""), Type: sbom.Node_PACKAGE, Name: "openssl", Version: "3.0.13"}
+	addStorePath(openssl, "/nix/store/abc-openssl-3.0.13")
+	zlib := &sbom.Node{Id: GenerateID("zlib", "1.3", "", ""), Type: sbom.Node_PACKAGE, Name: "zlib", Version: "1.3"}
+	app := &sbom.Node{Id: GenerateID("app", "0.0.0", "", ""), Name: "app"}
+	bom := sbom.NewDocument()
+	bom.NodeList.AddRootNode(app)
+	bom.NodeList.AddNode(openssl)
+	bom.NodeList.AddNode(zlib)
+	bom.NodeList.RelateNodeListAtID(&sbom.NodeList{Nodes: []*sbom.Node{openssl, zlib}}, app.Id, sbom.Edge_dependsOn)
+
+	AddFiles(bom, map[string][]string{
+		"/nix/store/abc-openssl-3.0.13": {"bin/openssl", "lib/libssl.so.3"},
+		"/nix/store/def-zlib-1.3":       {"lib/libz.so.1"},
+	})
+
+	file := bom.NodeList.GetNodeByID(openssl.Id + "-file-lib-libssl.so.3")
+	if file == nil {
+		t.Fatal("missing the lib/libssl.so.3 file of openssl")
+	}
+	if file.Type != sbom.Node_FILE || file.Name != "lib/libssl.so.3" || file.Comment != "/nix/store/abc-openssl-3.0.13/lib/libssl.so.3" {
+		t.Errorf("file = %v", file)
+	}
+	if got := len(bom.NodeList.Nodes); got != 5 {
+		t.Errorf("%d nodes, want app, openssl, zlib and the 2 files of openssl", got)
+	}
+	contained := 0
+	for _, e := range bom.NodeList.Edges {
+		if e.From == openssl.Id && e.Type == sbom.Edge_contains {
+			contained += len(e.To)
+		}
+	}
+	if contained != 2 {
+		t.Errorf("openssl contains %d files, want 2", contained)
+	}
+
+	for _, format := range []formats.Format{formats.SPDX23JSON, formats.CDX15JSON} {
+		if _, err := Write(bom, format); err != nil {
+			t.Errorf("Write(%s): %v", format, err)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package sbom
+
+import (
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// IndexSBOMName is the name of the SBOM of a multi-platform image, referencing the SBOMs of its platforms
+const IndexSBOMName = "index-sbom.cdx.json"
+
+// Properties selecting the platform of the image a component of the index SBOM is, as the platform of the OCI index
+const (
+	PropertyPlatformOS           = "oci:platform:os"
+	PropertyPlatformArchitecture = "oci:platform:architecture"
+	PropertyPlatformVariant      = "oci:platform:variant"
+)
+
+// PlatformSBOM is a SBOM of the image of a platform of a multi-platform image
+type PlatformSBOM struct {
+	// Platform is os/arch, with the variant when there is one, e.g. linux/arm64/v8
+	Platform string
+	// ManifestDigest is the hex digest of the manifest of the image of the platform
+	ManifestDigest string
+	// Name is the file name of the SBOM, Digest the hex sha256 digest of its content and MediaType its media type
+	Name, Digest, MediaType string
+	// Components is the number of components of the SBOM
+	Components int
+}
+
+// IndexImage is the multi-platform image the index SBOM is about
+type IndexImage struct {
+	Name, Version string
+	// IndexDigest is the hex digest of the image index
+	IndexDigest string
+}
+
+// indexBOM is the CycloneDX document of an index SBOM
+type indexBOM struct {
+	BOMFormat    string            `json:"bomFormat"`
+	SpecVersion  string            `json:"specVersion"`
+	Version      int               `json:"version"`
+	Metadata     indexMetadata     `json:"metadata"`
+	Components   []indexComponent  `json:"components"`
+	Dependencies []indexDependency `json:"dependencies"`
+}
+
+type indexMetadata struct {
+	Timestamp  time.Time      `json:"timestamp"`
+	Component  indexComponent `json:"component"`
+	Properties []cdxProperty  `json:"properties"`
+}
+
+type indexComponent struct {
+	Type               string             `json:"type"`
+	BOMRef             string             `json:"bom-ref"`
+	Name               string             `json:"name"`
+	Version            string             `json:"version,omitempty"`
+	Purl               string             `json:"purl,omitempty"`
+	Hashes             []cdxHash          `json:"hashes,omitempty"`
+	ExternalReferences []indexExternalRef `json:"externalReferences,omitempty"`
+	Properties         []cdxProperty      `json:"properties,omitempty"`
+}
+
+type cdxHash struct {
+	Alg     string `json:"alg"`
+	Content string `json:"content"`
+}
+
+type cdxProperty struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type indexExternalRef struct {
+	Type    string    `json:"type"`
+	URL     string    `json:"url"`
+	Comment string    `json:"comment,omitempty"`
+	Hashes  []cdxHash `json:"hashes"`
+}
+
+type indexDependency struct {
+	Ref       string   `json:"ref"`
+	DependsOn []string `json:"dependsOn"`
+}
+
+// IndexSBOM returns the CycloneDX SBOM of the multi-platform image, whose components are the images of its platforms.
+// Each platform image carries the os, architecture and variant of its platform as properties and references the
+// SBOMs of the platform by file name and digest, so consumers select the SBOM of the platform they resolved. The
+// metadata aggregates the platforms and the components of their SBOMs.
+func IndexSBOM(img IndexImage, sboms []PlatformSBOM, now time.Time) ([]byte, error) {
+	byPlatform := make(map[string][]PlatformSBOM)
+	for _, s := range sboms {
+		byPlatform[s.Platform] = append(byPlatform[s.Platform], s)
+	}
+	platforms := make([]string, 0, len(byPlatform))
+	for p := range byPlatform {
+		platforms = append(platforms, p)
+	}
+	sort.Strings(platforms)
+
+	indexRef := GenerateID(img.Name, img.Version, "", "") + "-index"
+	doc := indexBOM{
+		BOMFormat:   "CycloneDX",
+		SpecVersion: "1.5",
+		Version:     1,
+		Metadata: indexMetadata{
+			Timestamp: now.UTC().Truncate(time.Second),
+			Component: indexComponent{
+				Type:    "container",
+				BOMRef:  indexRef,
+				Name:    img.Name,
+				Version: img.Version,
+				Purl:    "pkg:oci/" + img.Name + "@sha256%3A" + img.IndexDigest,
+				Hashes:  []cdxHash{{Alg: "SHA-256", Content: img.IndexDigest}},
+			},
+		},
+		Components:   make([]indexComponent, 0, len(platforms)),
+		Dependencies: []indexDependency{{Ref: indexRef, DependsOn: make([]string, 0, len(platforms))}},
+	}
+
+	components := 0
+	for _, p := range platforms {
+		os, arch, _ := strings.Cut(p, "/")
+		arch, variant, _ := strings.Cut(arch, "/")
+		ref := strings.TrimSuffix(GenerateID(img.Name, img.Version, os, arch)+"-"+variant, "-") + "-platform"
+		c := indexComponent{
+			Type:    "container",
+			BOMRef:  ref,
+			Name:    img.Name,
+			Version: img.Version,
+			Purl:    "pkg:oci/" + img.Name + "@sha256%3A" + byPlatform[p][0].ManifestDigest,
+			Hashes:  []cdxHash{{Alg: "SHA-256", Content: byPlatform[p][0].ManifestDigest}},
+			Properties: []cdxProperty{
+				{Name: PropertyPlatformOS, Value: os},
+				{Name: PropertyPlatformArchitecture, Value: arch},
+			},
+		}
+		if variant != "" {
+			c.Properties = append(c.Properties, cdxProperty{Name: PropertyPlatformVariant, Value: variant})
+		}
+		for _, s := range byPlatform[p] {
+			c.ExternalReferences = append(c.ExternalReferences, indexExternalRef{
+				Type:    "bom",
+				URL:     s.Name,
+				Comment: s.MediaType,
+				Hashes:  []cdxHash{{Alg: "SHA-256", Content: s.Digest}},
+			})
+		}
+		// the SBOMs of a platform are the same document in several formats
+		c.Properties = append(c.Properties, cdxProperty{Name: "bsf:components", Value: strconv.Itoa(byPlatform[p][0].Components)})
+		components += byPlatform[p][0].Components
+
+		doc.Components = append(doc.Components, c)
+		doc.Dependencies[0].DependsOn = append(doc.Dependencies[0].DependsOn, ref)
+	}
+	doc.Metadata.Properties = []cdxProperty{
+		{Name: "bsf:platforms", Value: strings.Join(platforms, ",")},
+		{Name: "bsf:components", Value: strconv.Itoa(components)},
+	}
+	return json.MarshalIndent(doc, "", "  ")
+}
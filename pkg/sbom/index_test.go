@@ -0,0 +1,48 @@
+package sbom
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestIndexSBOM(t *testing.T) {
+	sboms := []PlatformSBOM{
+		{Platform: "linux/arm64/v8", ManifestDigest: "bbbb", Name: "platform-linux-arm64-v8-sbom.spdx.json", Digest: "22", MediaType: "application/spdx+json", Components: 12},
+		{Platform: "linux/amd64", ManifestDigest: "aaaa", Name: "platform-linux-amd64-sbom.spdx.json", Digest: "11", MediaType: "application/spdx+json", Components: 10},
+		{Platform: "linux/amd64", ManifestDigest: "aaaa", Name: "platform-linux-amd64-sbom.cdx.json", Digest: "12", MediaType: "application/vnd.cyclonedx+json", Components: 10},
+	}
+	data, err := IndexSBOM(IndexImage{Name: "app", Version: "1.0", IndexDigest: "ffff"}, sboms, time.Unix(0, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc := indexBOM{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	if doc.Metadata.Component.Purl != "pkg:oci/app@sha256%3Affff" {
+		t.Errorf("unexpected index purl %s", doc.Metadata.Component.Purl)
+	}
+	if got := doc.Metadata.Properties; len(got) != 2 || got[0].Value != "linux/amd64,linux/arm64/v8" || got[1].Value != "22" {
+		t.Errorf("unexpected aggregate properties %+v", got)
+	}
+	if len(doc.Components) != 2 || len(doc.Dependencies[0].DependsOn) != 2 {
+		t.Fatalf("expected a component per platform, got %+v", doc.Components)
+	}
+
+	amd64, arm64 := doc.Components[0], doc.Components[1]
+	if len(amd64.ExternalReferences) != 2 || amd64.ExternalReferences[1].URL != "platform-linux-amd64-sbom.cdx.json" || amd64.ExternalReferences[1].Hashes[0].Content != "12" {
+		t.Errorf("expected the SBOMs of linux/amd64 in both formats, got %+v", amd64.ExternalReferences)
+	}
+	selectors := map[string]string{}
+	for _, p := range arm64.Properties {
+		selectors[p.Name] = p.Value
+	}
+	if selectors[PropertyPlatformOS] != "linux" || selectors[PropertyPlatformArchitecture] != "arm64" || selectors[PropertyPlatformVariant] != "v8" {
+		t.Errorf("unexpected platform selectors %v", selectors)
+	}
+	if arm64.BOMRef == amd64.BOMRef || arm64.Hashes[0].Content != "bbbb" {
+		t.Errorf("unexpected component of linux/arm64/v8 %+v", arm64)
+	}
+}
@@ -0,0 +1,110 @@
+package sbom
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/bom-squad/protobom/pkg/sbom"
+)
+
+// SourceOrganization is a package url in the namespace of the organization, given to an internal component
+const SourceOrganization = "organization"
+
+// Namespace is the package url namespace of an organization, giving the internal components of the closures, the
+// ones without a public identifier, a package url that is unique, stable and resolvable within the organization
+type Namespace struct {
+	// Prefix is the package url type and namespace, e.g. pkg:generic/acme
+	Prefix string
+	// Packages are the name patterns of the internal packages, e.g. acme-*. When empty, every component nixpkgs has no
+	// package of and no alias maps to an upstream ecosystem is internal.
+	Packages []string
+	// RepositoryURL is where the internal packages are resolved, the repository_url qualifier of their package urls
+	RepositoryURL string
+}
+
+// ParseNamespace validates the package url type and namespace, e.g. pkg:generic/acme
+func ParseNamespace(prefix string) (Namespace, error) {
+	prefix = strings.TrimSuffix(prefix, "/")
+	rest, ok := strings.CutPrefix(prefix, "pkg:")
+	purlType, namespace, _ := strings.Cut(rest, "/")
+	if !ok || purlType == "" || namespace == "" || strings.ContainsAny(rest, "@?#") {
+		return Namespace{}, fmt.Errorf("invalid package url namespace %q, e.g. pkg:generic/acme", prefix)
+	}
+	return Namespace{Prefix: prefix}, nil
+}
+
+// Purl returns the package url of the internal component, qualified with the checksum of its NAR
+func (ns Namespace) Purl(name, version, sha256 string) string {
+	purl := ns.Prefix + "/" + url.PathEscape(name)
+	if version != "" {
+		purl += "@" + url.PathEscape(version)
+	}
+	qualifiers := make([]string, 0, 2)
+	if sha256 != "" {
+		qualifiers = append(qualifiers, "checksum=sha256:"+sha256)
+	}
+	if ns.RepositoryURL != "" {
+		qualifiers = append(qualifiers, "repository_url="+url.QueryEscape(ns.RepositoryURL))
+	}
+	if len(qualifiers) > 0 {
+		purl += "?" + strings.Join(qualifiers, "&")
+	}
+	return purl
+}
+
+// internal reports if the component is internal: its name matches the patterns of the namespace or, without
+// patterns, it has neither a CPE nor a package url of nixpkgs, an upstream ecosystem or the package registry
+func (ns Namespace) internal(node *sbom.Node) bool {
+	if len(ns.Packages) > 0 {
+		for _, pattern := range ns.Packages {
+			if ok, _ := path.Match(pattern, node.Name); ok {
+				return true
+			}
+		}
+		return false
+	}
+
+	if node.Identifiers[int32(sbom.SoftwareIdentifierType_CPE23)] != "" {
+		return false
+	}
+	for _, p := range FieldProvenances(node) {
+		switch {
+		case p.Field == FieldVersion && p.Source == SourceNixpkgs:
+			return false
+		case p.Field == FieldPurl && p.Source != SourceStorePath:
+			return false
+		}
+	}
+	// components whose nixpkgs metadata wasn't resolved may be in nixpkgs
+	for _, source := range PendingEnrichment(node) {
+		if source == SourceNixpkgs {
+			return false
+		}
+	}
+	return strings.HasPrefix(node.Identifiers[int32(sbom.SoftwareIdentifierType_PURL)], "pkg:nix/")
+}
+
+// ApplyNamespace gives the internal packages of the SBOM a package url in the namespace, in place of their nix
+// package url. The roots, the products the SBOM describes, keep theirs. It returns the number of components renamed.
+func ApplyNamespace(doc *sbom.Document, ns Namespace) int {
+	if doc == nil || ns.Prefix == "" {
+		return 0
+	}
+	roots := make(map[string]bool)
+	for _, id := range doc.NodeList.RootElements {
+		roots[id] = true
+	}
+
+	n := 0
+	for _, node := range doc.NodeList.Nodes {
+		if roots[node.Id] || node.Type != sbom.Node_PACKAGE || !ns.internal(node) {
+			continue
+		}
+		node.Identifiers[int32(sbom.SoftwareIdentifierType_PURL)] = ns.Purl(node.Name, node.Version, node.Hashes[int32(sbom.HashAlgorithm_SHA256)])
+		setFieldProvenance(node, FieldProvenance{FieldPurl, SourceOrganization, ConfidenceHigh})
+		n++
+	}
+	return n
+}
@@ -0,0 +1,73 @@
+package sbom
+
+import (
+	"testing"
+
+	"github.com/bom-squad/protobom/pkg/sbom"
+)
+
+func TestApplyNamespace(t *testing.T) {
+	purl := int32(sbom.SoftwareIdentifierType_PURL)
+	node := func(id, name string, ids map[int32]string, provs ...FieldProvenance) *sbom.Node {
+		n := &sbom.Node{Id: id, Name: name, Version: "1.2.0", Type: sbom.Node_PACKAGE, Identifiers: ids,
+			Hashes: map[int32]string{int32(sbom.HashAlgorithm_SHA256): "abc123"}}
+		for _, p := range provs {
+			setFieldProvenance(n, p)
+		}
+		return n
+	}
+	fromStorePath := FieldProvenance{FieldPurl, SourceStorePath, ConfidenceHigh}
+
+	doc := sbom.NewDocument()
+	doc.NodeList.AddRootNode(node("app", "acme-app", map[int32]string{purl: "pkg:nix/acme-app@v1.2.0"}, fromStorePath))
+	for _, n := range []*sbom.Node{
+		node("billing", "acme-billing", map[int32]string{purl: "pkg:nix/acme-billing@v1.2.0?hash=abc123"}, fromStorePath),
+		node("openssl", "openssl", map[int32]string{purl: "pkg:nix/openssl@v3.0.13"}, fromStorePath, FieldProvenance{FieldVersion, SourceNixpkgs, ConfidenceHigh}),
+		node("requests", "python3.11-requests", map[int32]string{purl: "pkg:pypi/requests@2.31.0"}, FieldProvenance{FieldPurl, SourceAlias, ConfidenceMedium}),
+		node("curl", "curl", map[int32]string{purl: "pkg:nix/curl@v8.7.1", int32(sbom.SoftwareIdentifierType_CPE23): "cpe:2.3:a:haxx:curl:8.7.1:*:*:*:*:*:*:*"}, fromStorePath),
+	} {
+		doc.NodeList.AddNode(n)
+	}
+
+	ns, err := ParseNamespace("pkg:generic/acme/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ns.RepositoryURL = "https://registry.acme.com"
+	if n := ApplyNamespace(doc, ns); n != 1 {
+		t.Errorf("ApplyNamespace() renamed %d components, want 1", n)
+	}
+
+	want := map[string]string{
+		"app":      "pkg:nix/acme-app@v1.2.0",
+		"billing":  "pkg:generic/acme/acme-billing@1.2.0?checksum=sha256:abc123&repository_url=https%3A%2F%2Fregistry.acme.com",
+		"openssl":  "pkg:nix/openssl@v3.0.13",
+		"requests": "pkg:pypi/requests@2.31.0",
+		"curl":     "pkg:nix/curl@v8.7.1",
+	}
+	for id, purlWant := range want {
+		if got := doc.NodeList.GetNodeByID(id).Identifiers[purl]; got != purlWant {
+			t.Errorf("purl of %s = %q, want %q", id, got, purlWant)
+		}
+	}
+
+	// with patterns, only the matching components are internal, whatever their identifiers
+	ns.Packages = []string{"open*"}
+	if n := ApplyNamespace(doc, ns); n != 1 || doc.NodeList.GetNodeByID("openssl").Identifiers[purl] != "pkg:generic/acme/openssl@1.2.0?checksum=sha256:abc123&repository_url=https%3A%2F%2Fregistry.acme.com" {
+		t.Errorf("ApplyNamespace() with patterns renamed %d components", n)
+	}
+}
+
+func TestParseNamespace(t *testing.T) {
+	for prefix, valid := range map[string]bool{
+		"pkg:generic/acme":      true,
+		"pkg:generic/acme/team": true,
+		"pkg:generic":           false,
+		"generic/acme":          false,
+		"pkg:generic/acme@1":    false,
+	} {
+		if _, err := ParseNamespace(prefix); (err == nil) != valid {
+			t.Errorf("ParseNamespace(%q) = %v", prefix, err)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package sbom
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/bom-squad/protobom/pkg/sbom"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/buildsafedev/bsf/pkg/attestation"
+)
+
+// FromAttestations reads the SBOM document out of an in-toto attestations JSONL file generated by bsf
+func FromAttestations(file []byte) (*sbom.Document, error) {
+	pred, err := PredicateFromAttestations(file)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(pred)
+}
+
+// PredicateFromAttestations returns the SBOM of an in-toto attestations JSONL file generated by bsf as it was written,
+// the SPDX one when there are several
+func PredicateFromAttestations(file []byte) ([]byte, error) {
+	psMap, err := attestation.ValidateInTotoStatement(file)
+	if err != nil {
+		return nil, err
+	}
+
+	sts := psMap["spdx"]
+	if len(sts) == 0 {
+		sts = psMap["cdx"]
+	}
+	if len(sts) == 0 {
+		return nil, fmt.Errorf("no SBOM found in attestations")
+	}
+
+	return json.Marshal(sts[0].Predicate)
+}
+
+// IsDocument reports if data is a SPDX or CycloneDX JSON document or a protobom document, rather than attestations
+func IsDocument(data []byte) bool {
+	if !bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		return proto.Unmarshal(data, &sbom.Document{}) == nil
+	}
+	var doc struct {
+		BOMFormat   string `json:"bomFormat"`
+		SPDXVersion string `json:"spdxVersion"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return false
+	}
+	return doc.BOMFormat != "" || doc.SPDXVersion != ""
+}
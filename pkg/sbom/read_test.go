@@ -0,0 +1,53 @@
+package sbom
+
+import (
+	"testing"
+
+	"github.com/awalterschulze/gographviz"
+	"github.com/bom-squad/protobom/pkg/formats"
+	"github.com/bom-squad/protobom/pkg/sbom"
+
+	"github.com/buildsafedev/bsf/pkg/depgraph"
+	"github.com/buildsafedev/bsf/pkg/hcl2nix"
+	nixcmd "github.com/buildsafedev/bsf/pkg/nix/cmd"
+)
+
+func TestFromAttestations(t *testing.T) {
+	graph := gographviz.NewGraph()
+	graph.SetName("G")
+	if err := graph.AddNode("G", `"abcd-openssl-3.0.13"`, nil); err != nil {
+		t.Fatal(err)
+	}
+	// attributes are set directly, the same way the closure graph is annotated
+	node := graph.Nodes.Lookup[`"abcd-openssl-3.0.13"`]
+	node.Attrs["name"] = "openssl"
+	node.Attrs["version"] = "3.0.13"
+	node.Attrs["hash"] = "0123"
+
+	appDetails := &nixcmd.App{Name: "app", BinaryHash: "aa", ResultHash: "bb"}
+	appNode := &sbom.Node{
+		Id:   GeneratePurl("app", "0.0.0", "", ""),
+		Name: "app",
+	}
+
+	bom := PackageGraphToSBOM(appNode, &hcl2nix.LockFile{}, depgraph.FromDOT(graph))
+	st, err := NewStatement(appDetails).ToJSON(bom, formats.SPDX23JSON)
+	if err != nil {
+		t.Fatalf("failed to write statement: %v", err)
+	}
+
+	doc, err := FromAttestations(st)
+	if err != nil {
+		t.Fatalf("FromAttestations() error = %v", err)
+	}
+
+	found := false
+	for _, n := range doc.NodeList.Nodes {
+		if n.Name == "openssl" && n.Version == "3.0.13" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("FromAttestations() did not return the openssl node")
+	}
+}
@@ -0,0 +1,65 @@
+package sbom
+
+import (
+	"strings"
+
+	"github.com/bom-squad/protobom/pkg/sbom"
+
+	"github.com/buildsafedev/bsf/pkg/hcl2nix"
+)
+
+// RuntimeRequirementComment is the comment of the external reference marking a component as a runtime requirement
+// declared in bsf.hcl, its URL is the kind of the requirement and its version constraint. SPDX keeps it as an OTHER
+// external reference, CycloneDX as the bsf:runtime_requirement property.
+const RuntimeRequirementComment = "bsf-runtime-requirement"
+
+// PropertyRuntimeRequirement is the CycloneDX property holding the kind and version constraint of a runtime requirement
+const PropertyRuntimeRequirement = "bsf:runtime_requirement"
+
+// AddRequirements adds the runtime requirements of bsf.hcl as components the root has as a prerequisite, the
+// services it calls are services of CycloneDX documents. They aren't in the closure, they have no store path nor hash.
+func AddRequirements(document *sbom.Document, root *sbom.Node, requirements []hcl2nix.Requirement) {
+	for _, r := range requirements {
+		node := &sbom.Node{
+			Id:          "requirement-" + strings.Trim(invalidIDChars.ReplaceAllString(r.Name, "-"), "-"),
+			Type:        sbom.Node_PACKAGE,
+			Name:        r.Name,
+			UrlHome:     r.URL,
+			Description: r.Description,
+			Identifiers: make(map[int32]string),
+		}
+		if r.KindOrDefault() == hcl2nix.RequirementPackage {
+			node.Identifiers[int32(sbom.SoftwareIdentifierType_PURL)] = "pkg:generic/" + r.Name
+		} else {
+			// the services the application calls are outside of its trust boundary
+			s := Service{TrustBoundary: true}
+			if r.URL != "" {
+				s.Endpoints = []string{r.URL}
+			}
+			SetService(node, s)
+		}
+		setRuntimeRequirement(node, r.KindOrDefault(), r.Version)
+		document.NodeList.AddNode(node)
+		document.NodeList.RelateNodeAtID(node, root.Id, sbom.Edge_prerequisite)
+	}
+}
+
+// RuntimeRequirement returns the kind and version constraint of the component when it is a runtime requirement
+func RuntimeRequirement(node *sbom.Node) (string, string, bool) {
+	for _, ref := range node.ExternalReferences {
+		if ref.Comment == RuntimeRequirementComment {
+			kind, constraint, _ := strings.Cut(ref.Url, " ")
+			return kind, constraint, true
+		}
+	}
+	return "", "", false
+}
+
+// setRuntimeRequirement marks the component as a runtime requirement of the kind and version constraint
+func setRuntimeRequirement(node *sbom.Node, kind, constraint string) {
+	node.ExternalReferences = append(node.ExternalReferences, &sbom.ExternalReference{
+		Url:     strings.TrimSpace(kind + " " + constraint),
+		Type:    sbom.ExternalReference_OTHER,
+		Comment: RuntimeRequirementComment,
+	})
+}
@@ -1,20 +1,23 @@
 package sbom
 
 import (
+	"encoding/hex"
 	"encoding/json"
+	"regexp"
+	"strings"
 	"time"
 
-	"github.com/awalterschulze/gographviz"
 	"github.com/bom-squad/protobom/pkg/formats"
 	"github.com/bom-squad/protobom/pkg/sbom"
-	"github.com/bom-squad/protobom/pkg/writer"
 	intoto "github.com/in-toto/in-toto-golang/in_toto"
 	intotoCom "github.com/in-toto/in-toto-golang/in_toto/slsa_provenance/common"
 	"google.golang.org/protobuf/types/known/timestamppb"
+	"zombiezen.com/go/nix/nixbase32"
 
+	"github.com/buildsafedev/bsf/pkg/depgraph"
 	"github.com/buildsafedev/bsf/pkg/hcl2nix"
-	bio "github.com/buildsafedev/bsf/pkg/io"
 	nixcmd "github.com/buildsafedev/bsf/pkg/nix/cmd"
+	"github.com/buildsafedev/bsf/pkg/nixmeta"
 )
 
 // Statement is a struct to hold the SBOM in SPDX format
@@ -24,8 +27,8 @@ type Statement struct {
 	Predicate interface{}
 }
 
-// NewStatement creates a new SBOM
-func NewStatement(appDetails *nixcmd.App) *Statement {
+// NewStatement creates a new SBOM, the results of the other outputs of the package are subjects as well
+func NewStatement(appDetails *nixcmd.App, outputs ...*nixcmd.App) *Statement {
 	st := Statement{}
 	st.Type = "https://in-toto.io/Statement/v1"
 	st.Subject = []intoto.Subject{
@@ -42,6 +45,24 @@ func NewStatement(appDetails *nixcmd.App) *Statement {
 			},
 		},
 	}
+	for _, d := range appDetails.ArtifactDigests() {
+		st.Subject = append(st.Subject, intoto.Subject{
+			Name:   d.Name,
+			Digest: intotoCom.DigestSet{"sha256": d.Digest},
+		})
+	}
+	for _, out := range outputs {
+		if out.BinaryHash != "" {
+			st.Subject = append(st.Subject, intoto.Subject{
+				Name:   out.Name,
+				Digest: intotoCom.DigestSet{"sha256": out.BinaryHash},
+			})
+		}
+		st.Subject = append(st.Subject, intoto.Subject{
+			Name:   "result-" + out.Name,
+			Digest: intotoCom.DigestSet{"sha256": out.ResultHash},
+		})
+	}
 	return &st
 }
 
@@ -56,19 +77,56 @@ func sbomTools() []*sbom.Tool {
 	}
 }
 
+// Root is a root component of the SBOM, the result of one of the outputs of the package
+type Root struct {
+	Node *sbom.Node
+	// StorePath is the store path of the result, the root contains the components of its closure.
+	// A root without a store path contains all the components of the graph.
+	StorePath string
+	// Relation relates the root to the components of its closure, contains when unset
+	Relation sbom.Edge_Type
+}
+
 // PackageGraphToSBOM converts the package graph to a SBOM
-func PackageGraphToSBOM(appNode *sbom.Node, lockFile *hcl2nix.LockFile, graph *gographviz.Graph) *sbom.Document {
+func PackageGraphToSBOM(appNode *sbom.Node, lockFile *hcl2nix.LockFile, graph *depgraph.Graph) *sbom.Document {
+	return OutputsGraphToSBOM([]Root{{Node: appNode}}, lockFile, graph)
+}
+
+// BuildGraphToSBOM converts the build-time closure graph of the derivation at drvPath to a SBOM of the application.
+// The application depends on the derivations and sources of the closure, the graph edges say which of them were
+// build tools and which build dependencies.
+func BuildGraphToSBOM(appNode *sbom.Node, drvPath string, graph *depgraph.Graph) *sbom.Document {
+	document := sbom.NewDocument()
+	document.Metadata.Tools = sbomTools()
+	document.Metadata.Name = "Build SBOM for " + appNode.Name
+	document.Metadata.Version = "1"
+	document.NodeList.AddRootNode(appNode)
+
+	parseDotGraph(document, []Root{{Node: appNode, StorePath: drvPath, Relation: sbom.Edge_dependsOn}}, graph, NewAliases(nil))
+	return document
+}
+
+// OutputsGraphToSBOM converts the closure graph shared by several outputs of the package to a single SBOM with a
+// root component for each of them. The first root is the application, the packages of the lock file belong to it.
+func OutputsGraphToSBOM(roots []Root, lockFile *hcl2nix.LockFile, graph *depgraph.Graph) *sbom.Document {
+	appNode := roots[0].Node
 	document := sbom.NewDocument()
 
 	document.Metadata.Tools = sbomTools()
 
 	document.Metadata.Name = "SBOM for " + appNode.Name
+	// CycloneDX requires the BOM version to be at least 1
+	document.Metadata.Version = "1"
 
-	document.NodeList.AddRootNode(appNode)
+	for _, root := range roots {
+		document.NodeList.AddRootNode(root.Node)
+	}
 
-	parseDotGraph(document, appNode, graph)
+	aliases := NewAliases(lockFile.App.Aliases)
+	parseDotGraph(document, roots, graph, aliases)
 
-	parseLockfileToSBOMNodes(document, appNode, lockFile)
+	parseLockfileToSBOMNodes(document, appNode, lockFile, aliases)
+	AddRequirements(document, appNode, lockFile.App.Requirements)
 
 	return document
 
@@ -81,18 +139,14 @@ func (s *Statement) ToJSON(bom *sbom.Document, format formats.Format) ([]byte, e
 		s.PredicateType = "https://cyclonedx.org/specification/overview/"
 	}
 
-	w := writer.New()
-	bomBytes := bio.NewBufferCloser()
-	err := w.WriteStreamWithOptions(bom, bomBytes, &writer.Options{
-		Format: format,
-	})
+	bomBytes, err := Write(bom, format)
 	if err != nil {
 		return nil, err
 	}
 
 	// Unmarshal the Predicate into an interface{} to prettify it
 	var pred interface{}
-	err = json.Unmarshal(bomBytes.Bytes(), &pred)
+	err = json.Unmarshal(bomBytes, &pred)
 	if err != nil {
 		return nil, err
 	}
@@ -101,14 +155,16 @@ func (s *Statement) ToJSON(bom *sbom.Document, format formats.Format) ([]byte, e
 	return json.Marshal(s)
 }
 
-func parseLockfileToSBOMNodes(document *sbom.Document, appNode *sbom.Node, lf *hcl2nix.LockFile) {
+func parseLockfileToSBOMNodes(document *sbom.Document, appNode *sbom.Node, lf *hcl2nix.LockFile, aliases *Aliases) {
 	for _, pkg := range lf.Packages {
+		ids := aliases.Identifiers(pkg.Package.Name, pkg.Package.Version)
+		// the CPE nixpkgs declares is preferred to the one of the aliases
+		if pkg.Package.Cpe != "" {
+			ids[int32(sbom.SoftwareIdentifierType_CPE23)] = pkg.Package.Cpe
+		}
 		snode := sbom.Node{
-			Id: GeneratePurl(pkg.Package.Name, pkg.Package.Version, "", ""),
-			Identifiers: map[int32]string{
-				int32(sbom.SoftwareIdentifierType_CPE23): pkg.Package.Cpe,
-				int32(sbom.SoftwareIdentifierType_PURL):  GeneratePurl(pkg.Package.Name, pkg.Package.Version, "", ""),
-			},
+			Id:               GenerateID(pkg.Package.Name, pkg.Package.Version, "", ""),
+			Identifiers:      ids,
 			Type:             sbom.Node_PACKAGE,
 			Name:             pkg.Package.Name,
 			Version:          pkg.Package.Version,
@@ -120,7 +176,23 @@ func parseLockfileToSBOMNodes(document *sbom.Document, appNode *sbom.Node, lf *h
 			ReleaseDate:      timestamppb.New(time.Unix(int64(pkg.Package.EpochSeconds), 0)),
 		}
 
-		document.NodeList.AddNode(&snode)
+		// the package is usually part of the closure as well, keep a single component for it
+		if existing := document.NodeList.GetNodeByID(snode.Id); existing != nil {
+			// bsf.hcl names the nixpkgs package of this version, its license is the one of the lock file unless the
+			// closure had one
+			setFieldProvenance(existing, FieldProvenance{FieldVersion, SourceNixpkgs, ConfidenceHigh})
+			if existing.LicenseConcluded == "" && pkg.Package.SpdxId != "" {
+				setFieldProvenance(existing, FieldProvenance{FieldLicense, SourceNixpkgs, ConfidenceHigh})
+			}
+			existing.Augment(&snode)
+		} else {
+			setFieldProvenance(&snode, FieldProvenance{FieldVersion, SourceNixpkgs, ConfidenceHigh})
+			if pkg.Package.SpdxId != "" {
+				setFieldProvenance(&snode, FieldProvenance{FieldLicense, SourceNixpkgs, ConfidenceHigh})
+			}
+			setFieldProvenance(&snode, purlProvenance(aliases, pkg.Package.Name, false))
+			document.NodeList.AddNode(&snode)
+		}
 		if pkg.Runtime {
 			document.NodeList.RelateNodeAtID(&snode, appNode.Id, sbom.Edge_runtimeDependency)
 		} else {
@@ -132,34 +204,306 @@ func parseLockfileToSBOMNodes(document *sbom.Document, appNode *sbom.Node, lf *h
 	return
 }
 
-func parseDotGraph(document *sbom.Document, appNode *sbom.Node, graph *gographviz.Graph) {
-	for _, node := range graph.Nodes.Nodes {
+func parseDotGraph(document *sbom.Document, roots []Root, graph *depgraph.Graph, aliases *Aliases) {
+	appNode := roots[0].Node
+	ids := make(map[string]string, len(graph.Nodes))
+	closures := make([]map[string]bool, len(roots))
+	for i, root := range roots {
+		if root.StorePath == "" {
+			continue
+		}
+		closures[i] = graph.ClosureOf(root.StorePath)
+		addStorePath(root.Node, root.StorePath)
+		for _, node := range graph.Nodes {
+			if node.StorePath() == root.StorePath {
+				ids[node.ID] = root.Node.Id
+			}
+		}
+	}
+
+	relation := func(root Root) sbom.Edge_Type {
+		if root.Relation == sbom.Edge_UNKNOWN {
+			return sbom.Edge_contains
+		}
+		return root.Relation
+	}
+
+	// the members of an FHS root filesystem are the packages the program runs with, e.g. the unwrapped app itself
+	fhsMembers := make(map[string]bool)
+	for _, edge := range graph.Edges {
+		if edge.Attrs["reftype"] == nixcmd.EdgeContains {
+			fhsMembers[edge.From] = true
+		}
+	}
+
+	for _, node := range graph.Nodes {
 		name := node.Attrs["name"]
 		version := node.Attrs["version"]
-		if name == "" || name == appNode.Name {
+		if name == appNode.Name && !fhsMembers[node.ID] {
+			ids[node.ID] = appNode.Id
+		}
+		if _, ok := ids[node.ID]; ok || name == "" {
 			continue
 		}
+		id := GenerateID(name, version, "", "")
+		if id == appNode.Id {
+			id += "-fhs"
+		}
+		ids[node.ID] = id
 
 		snode := sbom.Node{
 			Name:           name,
 			Type:           sbom.Node_PACKAGE,
-			Id:             GeneratePurl(name, version, "", ""),
+			Id:             id,
 			Version:        version,
 			PrimaryPurpose: []sbom.Purpose{sbom.Purpose_DATA},
-			Identifiers: map[int32]string{
-				int32(sbom.SoftwareIdentifierType_PURL): GeneratePurl(name, version, "", ""),
-			},
-			Hashes: map[int32]string{
-				int32(sbom.HashAlgorithm_SHA256): node.Attrs["hash"],
-			},
+			Identifiers:    withNarHash(aliases.Identifiers(name, version), node.Attrs["hash"]),
+			Hashes:         map[int32]string{},
+		}
+		// paths that couldn't be serialised have no hash rather than an empty one
+		if hash := node.Attrs["hash"]; hash != "" {
+			snode.Hashes[int32(sbom.HashAlgorithm_SHA256)] = NarHashHex(hash)
+		}
+		addDownloadLocations(&snode, node.Attrs["download"])
+		addNixpkgsMetadata(&snode, node.Attrs)
+		addRegistryMetadata(&snode, node.Attrs)
+		addWrapperMetadata(&snode, node.Attrs)
+		addFHSMetadata(&snode, node.Attrs)
+		for _, p := range closureFieldProvenances(node.Attrs, aliases, name) {
+			setFieldProvenance(&snode, p)
+		}
+		addStorePath(&snode, node.StorePath())
+		SetPendingEnrichment(&snode, strings.Fields(node.Attrs[AttrPendingEnrichment]))
+		if reachability := node.Attrs["reachability"]; reachability != "" {
+			addComment(&snode, "reachability: "+reachability)
 		}
 		document.NodeList.AddNode(&snode)
-		document.NodeList.RelateNodeAtID(&snode, appNode.Id, sbom.Edge_contains)
+
+		// components shared by several outputs are listed once and contained by each of them
+		contained := false
+		for i, root := range roots {
+			if closures[i] == nil || closures[i][node.ID] {
+				document.NodeList.RelateNodeAtID(&snode, root.Node.Id, relation(root))
+				contained = true
+			}
+		}
+		if !contained {
+			document.NodeList.RelateNodeAtID(&snode, appNode.Id, relation(roots[0]))
+		}
 	}
 
+	addGraphEdges(document, graph, ids)
+
 	return
 }
 
+// addGraphEdges relates the components using the reference type of the closure graph edges,
+// e.g. "openssl RUNTIME_DEPENDENCY_OF curl"
+func addGraphEdges(document *sbom.Document, graph *depgraph.Graph, ids map[string]string) {
+	seen := make(map[string]bool)
+	for _, edge := range graph.Edges {
+		from, ok := ids[edge.From]
+		if !ok {
+			continue
+		}
+		to, ok := ids[edge.To]
+		if !ok || from == to {
+			continue
+		}
+
+		edgeType := sbom.Edge_runtimeDependency
+		switch edge.Attrs["reftype"] {
+		case nixcmd.EdgeBuild:
+			edgeType = sbom.Edge_buildDependency
+		case nixcmd.EdgeBuildTool:
+			edgeType = sbom.Edge_buildTool
+		case nixcmd.EdgeContains:
+			// "rootfs CONTAINS member", the reverse of the graph edge
+			edgeType = sbom.Edge_contains
+			from, to = to, from
+		}
+
+		key := from + edgeType.String() + to
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		document.NodeList.AddEdge(&sbom.Edge{
+			Type: edgeType,
+			From: from,
+			To:   []string{to},
+		})
+	}
+}
+
+// AddProductMetadata describes the root component with the product metadata declared in bsf.hcl
+func AddProductMetadata(node *sbom.Node, product *hcl2nix.Product) {
+	if product == nil {
+		return
+	}
+	node.Summary = product.Name
+	node.Description = product.Description
+	node.UrlHome = product.URL
+	if product.Vendor != "" {
+		node.Suppliers = []*sbom.Person{{Name: product.Vendor, IsOrg: true, Url: product.URL}}
+	}
+	if product.Documentation != "" {
+		node.ExternalReferences = append(node.ExternalReferences, &sbom.ExternalReference{
+			Url:  product.Documentation,
+			Type: sbom.ExternalReference_DOCUMENTATION,
+		})
+	}
+	if product.Icon != "" {
+		node.ExternalReferences = append(node.ExternalReferences, &sbom.ExternalReference{
+			Url:     product.Icon,
+			Type:    sbom.ExternalReference_PRODUCT_METADATA,
+			Comment: "icon",
+		})
+	}
+}
+
+// addDownloadLocations sets the download location of the node to the first source URL and records all of them as external references
+func addDownloadLocations(node *sbom.Node, downloads string) {
+	for _, u := range strings.Fields(downloads) {
+		ref := &sbom.ExternalReference{
+			Url:  u,
+			Type: sbom.ExternalReference_DOWNLOAD,
+		}
+		if strings.HasPrefix(u, "git+") {
+			ref.Type = sbom.ExternalReference_VCS
+		}
+		if node.UrlDownload == "" {
+			node.UrlDownload = u
+		}
+		node.ExternalReferences = append(node.ExternalReferences, ref)
+	}
+}
+
+// addStorePath records the store path of the component, the NAR hash is its SHA-256 hash
+func addStorePath(node *sbom.Node, storePath string) {
+	node.ExternalReferences = append(node.ExternalReferences, &sbom.ExternalReference{
+		Url:     storePath,
+		Type:    sbom.ExternalReference_OTHER,
+		Comment: StorePathComment,
+	})
+}
+
+// StorePath returns the store path of the component, empty when it has none
+func StorePath(node *sbom.Node) string {
+	for _, ref := range node.ExternalReferences {
+		if ref.Comment == StorePathComment {
+			return ref.Url
+		}
+	}
+	return ""
+}
+
+// addNixpkgsMetadata sets the meta attribute of the nixpkgs package, resolved on the closure graph node
+func addNixpkgsMetadata(node *sbom.Node, attrs map[string]string) {
+	if licenses := strings.Fields(attrs["licenses"]); len(licenses) > 0 {
+		node.Licenses = licenses
+		node.LicenseConcluded = strings.Join(licenses, " AND ")
+	}
+	if homepage := attrs["homepage"]; homepage != "" {
+		node.UrlHome = homepage
+	}
+	if desc := attrs["description"]; desc != "" {
+		node.Description = desc
+	}
+	if maintainers := attrs["maintainers"]; maintainers != "" {
+		for _, m := range strings.Split(maintainers, ", ") {
+			name, email, _ := strings.Cut(strings.TrimSuffix(m, ">"), " <")
+			node.Suppliers = append(node.Suppliers, &sbom.Person{Name: name, Email: email})
+		}
+	}
+}
+
+// addWrapperMetadata concludes the license of a wrapper from the packages it wraps, see nixmeta.InheritWrapperLicenses.
+// The licenses are not declared by the wrapper, wrappers with a license of their own keep it.
+func addWrapperMetadata(node *sbom.Node, attrs map[string]string) {
+	if attrs[nixmeta.AttrWrapper] != "true" {
+		return
+	}
+	addComment(node, "wrapper of "+attrs[nixmeta.AttrWraps])
+	if licenses := strings.Fields(attrs[nixmeta.AttrInheritedLicenses]); len(licenses) > 0 && node.LicenseConcluded == "" {
+		node.LicenseConcluded = strings.Join(licenses, " AND ")
+	}
+}
+
+// addFHSMetadata describes the role of the component in a buildFHSEnv output, see nixcmd.AnnotateFHS
+func addFHSMetadata(node *sbom.Node, attrs map[string]string) {
+	switch attrs[nixcmd.AttrFHS] {
+	case nixcmd.FHSRootFS:
+		node.PrimaryPurpose = []sbom.Purpose{sbom.Purpose_CONTAINER}
+		addComment(node, "FHS root filesystem")
+	case nixcmd.FHSLauncher:
+		addComment(node, "FHS launcher of "+attrs[nixcmd.AttrFHSEnv])
+	case nixcmd.FHSWrapper:
+		addComment(node, "FHS wrapper of "+attrs[nixcmd.AttrFHSEnv])
+	}
+}
+
+func addComment(node *sbom.Node, comment string) {
+	if node.Comment != "" {
+		comment = node.Comment + "; " + comment
+	}
+	node.Comment = comment
+}
+
+// addRegistryMetadata sets the metadata the internal package registry recorded on the closure graph node,
+// for components of private overlays that nixpkgs knows nothing about
+func addRegistryMetadata(node *sbom.Node, attrs map[string]string) {
+	if purl := attrs["purl"]; purl != "" {
+		node.Identifiers[int32(sbom.SoftwareIdentifierType_PURL)] = purl
+	}
+	if license := attrs["license"]; license != "" {
+		node.Licenses = []string{license}
+		node.LicenseConcluded = license
+	}
+	if owner := attrs["owner"]; owner != "" {
+		node.Suppliers = []*sbom.Person{{Name: owner, IsOrg: true, Email: attrs["owner_email"]}}
+	}
+	if desc := attrs["description"]; desc != "" {
+		node.Description = desc
+	}
+	if id := attrs["internal_id"]; id != "" {
+		node.ExternalReferences = append(node.ExternalReferences, &sbom.ExternalReference{
+			Url:     attrs["registry_url"],
+			Type:    sbom.ExternalReference_OTHER,
+			Comment: "internal-id:" + id,
+		})
+	}
+}
+
+// NarHashHex converts the nixbase32 NAR hash of the closure graph to hex, the encoding SBOM formats require
+func NarHashHex(hash string) string {
+	b, err := nixbase32.DecodeString(hash)
+	if err != nil {
+		return hash
+	}
+	return hex.EncodeToString(b)
+}
+
+// withNarHash qualifies the nix package url of a closure component with its NAR hash, so it names the store path
+// rather than any build of the version. Package urls of other ecosystems are kept as they are.
+func withNarHash(ids map[int32]string, hash string) map[int32]string {
+	purl := ids[int32(sbom.SoftwareIdentifierType_PURL)]
+	if hash == "" || !strings.HasPrefix(purl, "pkg:nix/") || strings.Contains(purl, "?") {
+		return ids
+	}
+	ids[int32(sbom.SoftwareIdentifierType_PURL)] = purl + "?hash=" + NarHashHex(hash)
+	return ids
+}
+
+var invalidIDChars = regexp.MustCompile(`[^a-zA-Z0-9.-]+`)
+
+// GenerateID returns the component identifier for the given name and version.
+// It is derived from the package url but only uses the characters SPDX allows in identifiers.
+func GenerateID(name, version, os, arch string) string {
+	return strings.Trim(invalidIDChars.ReplaceAllString(GeneratePurl(name, version, os, arch), "-"), "-")
+}
+
 // GeneratePurl returns a package url for the given name and version
 func GeneratePurl(name, version, os, arch string) string {
 	purl := "pkg:" + "nix/" + name + "@v" + version
@@ -0,0 +1,384 @@
+package sbom
+
+import (
+	"testing"
+
+	"github.com/awalterschulze/gographviz"
+	"github.com/bom-squad/protobom/pkg/sbom"
+
+	"github.com/buildsafedev/bsf/pkg/depgraph"
+	"github.com/buildsafedev/bsf/pkg/hcl2nix"
+	nixcmd "github.com/buildsafedev/bsf/pkg/nix/cmd"
+	"github.com/buildsafedev/bsf/pkg/nixmeta"
+)
+
+func TestPackageGraphToSBOMEdges(t *testing.T) {
+	graph := gographviz.NewGraph()
+	graph.SetName("G")
+	for name, attrs := range map[string][2]string{
+		`"aaaa-openssl-3.0.13"`: {"openssl", "3.0.13"},
+		`"bbbb-curl-8.6.0"`:     {"curl", "8.6.0"},
+		`"cccc-cmake-3.28.3"`:   {"cmake", "3.28.3"},
+	} {
+		if err := graph.AddNode("G", name, nil); err != nil {
+			t.Fatal(err)
+		}
+		graph.Nodes.Lookup[name].Attrs["name"] = attrs[0]
+		graph.Nodes.Lookup[name].Attrs["version"] = attrs[1]
+	}
+	graph.Edges.Add(&gographviz.Edge{Src: `"aaaa-openssl-3.0.13"`, Dst: `"bbbb-curl-8.6.0"`, Dir: true, Attrs: gographviz.Attrs{"reftype": nixcmd.EdgeRuntime}})
+	graph.Edges.Add(&gographviz.Edge{Src: `"cccc-cmake-3.28.3"`, Dst: `"bbbb-curl-8.6.0"`, Dir: true, Attrs: gographviz.Attrs{"reftype": nixcmd.EdgeBuild}})
+
+	appNode := &sbom.Node{Id: GenerateID("app", "0.0.0", "", ""), Name: "app"}
+	bom := PackageGraphToSBOM(appNode, &hcl2nix.LockFile{}, depgraph.FromDOT(graph))
+
+	want := map[string]sbom.Edge_Type{
+		GenerateID("openssl", "3.0.13", "", ""): sbom.Edge_runtimeDependency,
+		GenerateID("cmake", "3.28.3", "", ""):   sbom.Edge_buildDependency,
+	}
+	for from, edgeType := range want {
+		found := false
+		for _, e := range bom.NodeList.Edges {
+			if e.From == from && e.Type == edgeType && len(e.To) == 1 && e.To[0] == GenerateID("curl", "8.6.0", "", "") {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("missing %s edge from %s to curl", edgeType, from)
+		}
+	}
+}
+
+func TestGenerateID(t *testing.T) {
+	tests := []struct {
+		name, version, os, arch string
+		want                    string
+	}{
+		{"curl", "8.6.0", "", "", "pkg-nix-curl-v8.6.0"},
+		{"app", "0.0.0", "linux", "amd64", "pkg-nix-app-v0.0.0-os-linux-arch-amd64"},
+		{"python3.11-requests", "2.31.0", "", "", "pkg-nix-python3.11-requests-v2.31.0"},
+	}
+
+	for _, tt := range tests {
+		if got := GenerateID(tt.name, tt.version, tt.os, tt.arch); got != tt.want {
+			t.Errorf("GenerateID(%q, %q) = %q, want %q", tt.name, tt.version, got, tt.want)
+		}
+	}
+}
+
+func TestPackageGraphToSBOMRegistryMetadata(t *testing.T) {
+	graph := gographviz.NewGraph()
+	graph.SetName("G")
+	name := `"bbbb-libbilling-2.1.0"`
+	if err := graph.AddNode("G", name, nil); err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range map[string]string{
+		"name":         "billing-core",
+		"version":      "2.1.0",
+		"owner":        "payments",
+		"license":      "LicenseRef-Internal",
+		"internal_id":  "PKG-42",
+		"purl":         "pkg:generic/acme/billing-core@2.1.0",
+		"registry_url": "https://packages.acme.internal/PKG-42",
+	} {
+		graph.Nodes.Lookup[name].Attrs[gographviz.Attr(k)] = v
+	}
+
+	appNode := &sbom.Node{Id: GenerateID("app", "0.0.0", "", ""), Name: "app"}
+	bom := PackageGraphToSBOM(appNode, &hcl2nix.LockFile{}, depgraph.FromDOT(graph))
+
+	node := bom.NodeList.GetNodeByID(GenerateID("billing-core", "2.1.0", "", ""))
+	if node == nil {
+		t.Fatal("component not found")
+	}
+	if node.Identifiers[int32(sbom.SoftwareIdentifierType_PURL)] != "pkg:generic/acme/billing-core@2.1.0" {
+		t.Errorf("unexpected purl %v", node.Identifiers)
+	}
+	if node.LicenseConcluded != "LicenseRef-Internal" || len(node.Suppliers) != 1 || node.Suppliers[0].Name != "payments" {
+		t.Errorf("license or owner not set: %v %v", node.LicenseConcluded, node.Suppliers)
+	}
+	internal := 0
+	for _, ref := range node.ExternalReferences {
+		if ref.Comment == "internal-id:PKG-42" {
+			internal++
+		}
+	}
+	if internal != 1 {
+		t.Errorf("internal id not recorded: %v", node.ExternalReferences)
+	}
+}
+
+func TestPackageGraphToSBOMNixpkgsMetadata(t *testing.T) {
+	graph := gographviz.NewGraph()
+	graph.SetName("G")
+	name := `"cccc-openssl-3.0.13"`
+	if err := graph.AddNode("G", name, nil); err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range map[string]string{
+		"name":        "openssl",
+		"version":     "3.0.13",
+		"licenses":    "Apache-2.0 OpenSSL",
+		"homepage":    "https://www.openssl.org/",
+		"description": "A cryptographic library that implements the SSL and TLS protocols",
+		"maintainers": "Jane Doe <jane@example.com>, jdoe2",
+	} {
+		graph.Nodes.Lookup[name].Attrs[gographviz.Attr(k)] = v
+	}
+
+	appNode := &sbom.Node{Id: GenerateID("app", "0.0.0", "", ""), Name: "app"}
+	bom := PackageGraphToSBOM(appNode, &hcl2nix.LockFile{}, depgraph.FromDOT(graph))
+
+	node := bom.NodeList.GetNodeByID(GenerateID("openssl", "3.0.13", "", ""))
+	if node == nil {
+		t.Fatal("component not found")
+	}
+	if node.LicenseConcluded != "Apache-2.0 AND OpenSSL" || len(node.Licenses) != 2 {
+		t.Errorf("unexpected licenses %v %q", node.Licenses, node.LicenseConcluded)
+	}
+	if node.UrlHome != "https://www.openssl.org/" || node.Description == "" {
+		t.Errorf("homepage or description not set: %q %q", node.UrlHome, node.Description)
+	}
+	if len(node.Suppliers) != 2 || node.Suppliers[0].Name != "Jane Doe" || node.Suppliers[0].Email != "jane@example.com" || node.Suppliers[1].Name != "jdoe2" {
+		t.Errorf("unexpected maintainers %v", node.Suppliers)
+	}
+}
+
+func TestPackageGraphToSBOMWrapper(t *testing.T) {
+	graph := gographviz.NewGraph()
+	graph.SetName("G")
+	name := `"aaaa-firefox-128.0"`
+	if err := graph.AddNode("G", name, nil); err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range map[string]string{
+		"name":                        "firefox",
+		"version":                     "128.0",
+		nixmeta.AttrWrapper:           "true",
+		nixmeta.AttrWraps:             "firefox-unwrapped",
+		nixmeta.AttrInheritedLicenses: "MPL-2.0",
+		"reachability":                "reachable",
+	} {
+		graph.Nodes.Lookup[name].Attrs[gographviz.Attr(k)] = v
+	}
+
+	appNode := &sbom.Node{Id: GenerateID("app", "0.0.0", "", ""), Name: "app"}
+	bom := PackageGraphToSBOM(appNode, &hcl2nix.LockFile{}, depgraph.FromDOT(graph))
+
+	node := bom.NodeList.GetNodeByID(GenerateID("firefox", "128.0", "", ""))
+	if node == nil {
+		t.Fatal("component not found")
+	}
+	if node.LicenseConcluded != "MPL-2.0" || len(node.Licenses) != 0 {
+		t.Errorf("wrapper licenses %v %q, want MPL-2.0 concluded only", node.Licenses, node.LicenseConcluded)
+	}
+	if node.Comment != "wrapper of firefox-unwrapped; reachability: reachable" {
+		t.Errorf("comment %q", node.Comment)
+	}
+}
+
+func TestPackageGraphToSBOMFHS(t *testing.T) {
+	graph := gographviz.NewGraph()
+	graph.SetName("G")
+	for name, attrs := range map[string][3]string{
+		`"aaaa-steam-bwrap"`:         {"steam-bwrap", "", nixcmd.FHSLauncher},
+		`"bbbb-steam-fhsenv-rootfs"`: {"steam-fhsenv-rootfs", "", nixcmd.FHSRootFS},
+		`"cccc-steam-1.0.0.81"`:      {"steam", "1.0.0.81", ""},
+		`"dddd-glibc-2.39-52"`:       {"glibc", "2.39-52", ""},
+		`"eeee-bubblewrap-0.9.0"`:    {"bubblewrap", "0.9.0", ""},
+	} {
+		if err := graph.AddNode("G", name, nil); err != nil {
+			t.Fatal(err)
+		}
+		graph.Nodes.Lookup[name].Attrs["name"] = attrs[0]
+		graph.Nodes.Lookup[name].Attrs["version"] = attrs[1]
+		if attrs[2] != "" {
+			graph.Nodes.Lookup[name].Attrs[nixcmd.AttrFHS] = attrs[2]
+			graph.Nodes.Lookup[name].Attrs[nixcmd.AttrFHSEnv] = "steam-fhsenv-rootfs"
+		}
+	}
+	graph.Edges.Add(&gographviz.Edge{Src: `"eeee-bubblewrap-0.9.0"`, Dst: `"aaaa-steam-bwrap"`, Dir: true, Attrs: gographviz.Attrs{"reftype": nixcmd.EdgeRuntime}})
+	graph.Edges.Add(&gographviz.Edge{Src: `"bbbb-steam-fhsenv-rootfs"`, Dst: `"aaaa-steam-bwrap"`, Dir: true, Attrs: gographviz.Attrs{"reftype": nixcmd.EdgeRuntime}})
+	graph.Edges.Add(&gographviz.Edge{Src: `"cccc-steam-1.0.0.81"`, Dst: `"bbbb-steam-fhsenv-rootfs"`, Dir: true, Attrs: gographviz.Attrs{"reftype": nixcmd.EdgeContains}})
+	graph.Edges.Add(&gographviz.Edge{Src: `"dddd-glibc-2.39-52"`, Dst: `"bbbb-steam-fhsenv-rootfs"`, Dir: true, Attrs: gographviz.Attrs{"reftype": nixcmd.EdgeContains}})
+
+	// the wrapper is named and versioned as the program it runs
+	appNode := &sbom.Node{Id: GenerateID("steam", "1.0.0.81", "", ""), Name: "steam"}
+	bom := PackageGraphToSBOM(appNode, &hcl2nix.LockFile{}, depgraph.FromDOT(graph))
+
+	rootFSID := GenerateID("steam-fhsenv-rootfs", "", "", "")
+	programID := appNode.Id + "-fhs"
+	rootFS := bom.NodeList.GetNodeByID(rootFSID)
+	if rootFS == nil || len(rootFS.PrimaryPurpose) != 1 || rootFS.PrimaryPurpose[0] != sbom.Purpose_CONTAINER {
+		t.Fatalf("root filesystem = %v, want a container", rootFS)
+	}
+	if program := bom.NodeList.GetNodeByID(programID); program == nil || program.Name != "steam" {
+		t.Fatalf("the program of the root filesystem should be its own component, got %v", program)
+	}
+	launcher := bom.NodeList.GetNodeByID(GenerateID("steam-bwrap", "", "", ""))
+	if launcher == nil || launcher.Comment != "FHS launcher of steam-fhsenv-rootfs" {
+		t.Errorf("launcher = %v", launcher)
+	}
+
+	for _, member := range []string{programID, GenerateID("glibc", "2.39-52", "", "")} {
+		found := false
+		for _, e := range bom.NodeList.Edges {
+			if e.From == rootFSID && e.Type == sbom.Edge_contains && len(e.To) == 1 && e.To[0] == member {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("missing contains edge from the root filesystem to %s", member)
+		}
+	}
+}
+
+func TestWithNarHash(t *testing.T) {
+	const hash = "1b8m03r63zqhnjf7l5wnldhh7c134ap5vpj0850ymkq1iyzicy5s"
+	tests := []struct {
+		name string
+		purl string
+		hash string
+		want string
+	}{
+		{name: "nix purl", purl: "pkg:nix/curl@v8.6.0", hash: hash, want: "pkg:nix/curl@v8.6.0?hash=" + NarHashHex(hash)},
+		{name: "no hash", purl: "pkg:nix/curl@v8.6.0", want: "pkg:nix/curl@v8.6.0"},
+		{name: "upstream purl", purl: "pkg:pypi/requests@2.31.0", hash: hash, want: "pkg:pypi/requests@2.31.0"},
+		{name: "qualified purl", purl: "pkg:nix/app@v1.0?os=linux&arch=amd64", hash: hash, want: "pkg:nix/app@v1.0?os=linux&arch=amd64"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ids := withNarHash(map[int32]string{int32(sbom.SoftwareIdentifierType_PURL): tt.purl}, tt.hash)
+			if got := ids[int32(sbom.SoftwareIdentifierType_PURL)]; got != tt.want {
+				t.Errorf("withNarHash() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOutputsGraphToSBOM(t *testing.T) {
+	graph := gographviz.NewGraph()
+	graph.SetName("G")
+	for name, attrs := range map[string][2]string{
+		`"aaaa-app-1.0"`:      {"app", "1.0"},
+		`"bbbb-app-1.0-man"`:  {"app-1.0", "man"},
+		`"cccc-glibc-2.39"`:   {"glibc", "2.39"},
+		`"dddd-openssl-3.0"`:  {"openssl", "3.0"},
+		`"eeee-groff-1.23.0"`: {"groff", "1.23.0"},
+	} {
+		if err := graph.AddNode("G", name, nil); err != nil {
+			t.Fatal(err)
+		}
+		graph.Nodes.Lookup[name].Attrs["name"] = attrs[0]
+		graph.Nodes.Lookup[name].Attrs["version"] = attrs[1]
+	}
+	// edges point from the dependency to the dependent
+	for _, e := range [][2]string{
+		{`"cccc-glibc-2.39"`, `"aaaa-app-1.0"`},
+		{`"dddd-openssl-3.0"`, `"aaaa-app-1.0"`},
+		{`"cccc-glibc-2.39"`, `"bbbb-app-1.0-man"`},
+		{`"eeee-groff-1.23.0"`, `"bbbb-app-1.0-man"`},
+	} {
+		graph.Edges.Add(&gographviz.Edge{Src: e[0], Dst: e[1], Dir: true})
+	}
+
+	app := &sbom.Node{Id: GenerateID("app", "0.0.0", "", ""), Name: "app"}
+	man := &sbom.Node{Id: GenerateID("app-man", "0.0.0", "", ""), Name: "app-man"}
+	bom := OutputsGraphToSBOM([]Root{
+		{Node: app, StorePath: "/nix/store/aaaa-app-1.0"},
+		{Node: man, StorePath: "/nix/store/bbbb-app-1.0-man"},
+	}, &hcl2nix.LockFile{}, depgraph.FromDOT(graph))
+
+	if len(bom.NodeList.RootElements) != 2 {
+		t.Fatalf("expected 2 root components, got %v", bom.NodeList.RootElements)
+	}
+	if n := bom.NodeList.GetNodeByID(GenerateID("app-1.0", "man", "", "")); n != nil {
+		t.Errorf("the result of an output should be its root component, not a package")
+	}
+
+	contains := func(root, name, version string) bool {
+		for _, e := range bom.NodeList.Edges {
+			if e.From == root && e.Type == sbom.Edge_contains {
+				for _, to := range e.To {
+					if to == GenerateID(name, version, "", "") {
+						return true
+					}
+				}
+			}
+		}
+		return false
+	}
+	tests := []struct {
+		root, name, version string
+		want                bool
+	}{
+		{app.Id, "glibc", "2.39", true},
+		{man.Id, "glibc", "2.39", true},
+		{app.Id, "openssl", "3.0", true},
+		{man.Id, "openssl", "3.0", false},
+		{app.Id, "groff", "1.23.0", false},
+		{man.Id, "groff", "1.23.0", true},
+	}
+	for _, tt := range tests {
+		if got := contains(tt.root, tt.name, tt.version); got != tt.want {
+			t.Errorf("%s contains %s = %v, want %v", tt.root, tt.name, got, tt.want)
+		}
+	}
+
+	count := 0
+	for _, n := range bom.NodeList.Nodes {
+		if n.Name == "glibc" {
+			count++
+		}
+	}
+	if count != 1 {
+		t.Errorf("expected the shared component once, got %d", count)
+	}
+}
+
+func TestBuildGraphToSBOM(t *testing.T) {
+	graph := gographviz.NewGraph()
+	graph.SetName("G")
+	for name, attrs := range map[string][2]string{
+		`"aaaa-app-1.0.drv"`:   {"app", "1.0"},
+		`"bbbb-go-1.22.1.drv"`: {"go", "1.22.1"},
+		`"cccc-zlib-1.3.drv"`:  {"zlib", "1.3"},
+	} {
+		if err := graph.AddNode("G", name, nil); err != nil {
+			t.Fatal(err)
+		}
+		graph.Nodes.Lookup[name].Attrs["name"] = attrs[0]
+		graph.Nodes.Lookup[name].Attrs["version"] = attrs[1]
+	}
+	graph.Edges.Add(&gographviz.Edge{Src: `"bbbb-go-1.22.1.drv"`, Dst: `"aaaa-app-1.0.drv"`, Dir: true, Attrs: gographviz.Attrs{"reftype": nixcmd.EdgeBuildTool}})
+	graph.Edges.Add(&gographviz.Edge{Src: `"cccc-zlib-1.3.drv"`, Dst: `"aaaa-app-1.0.drv"`, Dir: true, Attrs: gographviz.Attrs{"reftype": nixcmd.EdgeBuild}})
+
+	app := &sbom.Node{Id: GenerateID("app", "0.0.0", "", ""), Name: "app"}
+	bom := BuildGraphToSBOM(app, "/nix/store/aaaa-app-1.0.drv", depgraph.FromDOT(graph))
+
+	goID, zlibID := GenerateID("go", "1.22.1", "", ""), GenerateID("zlib", "1.3", "", "")
+	want := map[string]sbom.Edge_Type{
+		app.Id + "->" + goID:   sbom.Edge_dependsOn,
+		app.Id + "->" + zlibID: sbom.Edge_dependsOn,
+		goID + "->" + app.Id:   sbom.Edge_buildTool,
+		zlibID + "->" + app.Id: sbom.Edge_buildDependency,
+	}
+	got := make(map[string]sbom.Edge_Type)
+	for _, e := range bom.NodeList.Edges {
+		for _, to := range e.To {
+			got[e.From+"->"+to] = e.Type
+		}
+	}
+	for edge, edgeType := range want {
+		if got[edge] != edgeType {
+			t.Errorf("edge %s is %v, want %v", edge, got[edge], edgeType)
+		}
+	}
+	for edge, edgeType := range got {
+		if edgeType == sbom.Edge_contains {
+			t.Errorf("unexpected contains edge %s", edge)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package sbom
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/bom-squad/protobom/pkg/sbom"
+
+	"github.com/buildsafedev/bsf/pkg/hcl2nix"
+)
+
+// ServiceComment is the comment of the external reference marking a component as a service, its URL holds the
+// authenticated and trust-boundary flags of the service. CycloneDX lists the component in services, SPDX keeps it
+// as a package with an OTHER external reference.
+const ServiceComment = "bsf-service"
+
+// ServiceEndpointComment is the comment of the external references holding the endpoints of a service
+const ServiceEndpointComment = "bsf-service-endpoint"
+
+// Service is what a CycloneDX service has that a component doesn't
+type Service struct {
+	Endpoints []string
+	// Authenticated is whether the service requires authentication, unknown when nil
+	Authenticated *bool
+	// TrustBoundary is whether calling the service crosses a trust boundary
+	TrustBoundary bool
+}
+
+// AddServices adds the endpoints the container of the root serves as services, which depend on the root
+func AddServices(document *sbom.Document, root *sbom.Node, endpoints []hcl2nix.Endpoint) {
+	for _, e := range endpoints {
+		node := &sbom.Node{
+			Id:          "service-" + strings.Trim(invalidIDChars.ReplaceAllString(e.Name, "-"), "-"),
+			Type:        sbom.Node_PACKAGE,
+			Name:        e.Name,
+			Version:     root.Version,
+			Description: e.Description,
+		}
+		SetService(node, Service{Endpoints: []string{e.URL()}, Authenticated: e.Authenticated, TrustBoundary: e.Public})
+		document.NodeList.AddNode(node)
+		document.NodeList.RelateNodeAtID(root, node.Id, sbom.Edge_dependsOn)
+	}
+}
+
+// ServiceOf returns the service of the component, if it is one
+func ServiceOf(node *sbom.Node) (Service, bool) {
+	var s Service
+	found := false
+	for _, ref := range node.ExternalReferences {
+		switch ref.Comment {
+		case ServiceEndpointComment:
+			s.Endpoints = append(s.Endpoints, ref.Url)
+		case ServiceComment:
+			found = true
+			for _, flag := range strings.Fields(ref.Url) {
+				k, v, _ := strings.Cut(flag, "=")
+				b, err := strconv.ParseBool(v)
+				if err != nil {
+					continue
+				}
+				switch k {
+				case "authenticated":
+					s.Authenticated = &b
+				case "trust-boundary":
+					s.TrustBoundary = b
+				}
+			}
+		}
+	}
+	return s, found
+}
+
+// SetService marks the component as the service
+func SetService(node *sbom.Node, s Service) {
+	flags := []string{"trust-boundary=" + strconv.FormatBool(s.TrustBoundary)}
+	if s.Authenticated != nil {
+		flags = append(flags, "authenticated="+strconv.FormatBool(*s.Authenticated))
+	}
+	node.ExternalReferences = append(node.ExternalReferences, &sbom.ExternalReference{
+		Url:     strings.Join(flags, " "),
+		Type:    sbom.ExternalReference_OTHER,
+		Comment: ServiceComment,
+	})
+	for _, e := range s.Endpoints {
+		node.ExternalReferences = append(node.ExternalReferences, &sbom.ExternalReference{
+			Url:     e,
+			Type:    sbom.ExternalReference_OTHER,
+			Comment: ServiceEndpointComment,
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package sbom
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/bom-squad/protobom/pkg/formats"
+	"github.com/bom-squad/protobom/pkg/sbom"
+
+	"github.com/buildsafedev/bsf/pkg/depgraph"
+	"github.com/buildsafedev/bsf/pkg/hcl2nix"
+)
+
+func TestServicesCycloneDX(t *testing.T) {
+	app := &sbom.Node{Id: GenerateID("billing", "1.0", "", ""), Name: "billing", Version: "1.0"}
+	bom := OutputsGraphToSBOM([]Root{{Node: app}}, &hcl2nix.LockFile{}, depgraph.New())
+	authenticated := true
+	AddServices(bom, app, []hcl2nix.Endpoint{
+		{Name: "public-api", Port: "8443/tcp", Protocol: "https", Path: "/v1", Authenticated: &authenticated, Public: true},
+		{Name: "metrics", Port: "9090/tcp", Description: "prometheus metrics"},
+	})
+
+	data, err := Write(bom, formats.CDX15JSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc struct {
+		Components []struct {
+			Ref string `json:"bom-ref"`
+		} `json:"components"`
+		Services []struct {
+			Ref           string   `json:"bom-ref"`
+			Name          string   `json:"name"`
+			Endpoints     []string `json:"endpoints"`
+			Authenticated *bool    `json:"authenticated"`
+			TrustBoundary bool     `json:"x-trust-boundary"`
+		} `json:"services"`
+		Dependencies []struct {
+			Ref       string   `json:"ref"`
+			DependsOn []string `json:"dependsOn"`
+		} `json:"dependencies"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatal(err)
+	}
+	if len(doc.Components) != 0 {
+		t.Errorf("components = %v, want the services only in services", doc.Components)
+	}
+	if len(doc.Services) != 2 {
+		t.Fatalf("services = %+v, want 2", doc.Services)
+	}
+	// the services are sorted by reference
+	api := doc.Services[1]
+	if api.Name != "public-api" || len(api.Endpoints) != 1 || api.Endpoints[0] != "https://0.0.0.0:8443/v1" ||
+		api.Authenticated == nil || !*api.Authenticated || !api.TrustBoundary {
+		t.Errorf("public-api service = %+v", api)
+	}
+	if metrics := doc.Services[0]; metrics.Authenticated != nil || metrics.TrustBoundary {
+		t.Errorf("metrics service = %+v, want unknown authentication within the trust boundary", metrics)
+	}
+	linked := 0
+	for _, d := range doc.Dependencies {
+		if (d.Ref == "service-public-api" || d.Ref == "service-metrics") && len(d.DependsOn) == 1 && d.DependsOn[0] == app.Id {
+			linked++
+		}
+	}
+	if linked != 2 {
+		t.Errorf("dependencies = %+v, want the services to depend on the root", doc.Dependencies)
+	}
+
+	back, err := Parse(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	node := back.NodeList.GetNodeByID("service-public-api")
+	if node == nil {
+		t.Fatal("public-api was lost")
+	}
+	s, ok := ServiceOf(node)
+	if !ok || len(s.Endpoints) != 1 || s.Authenticated == nil || !*s.Authenticated || !s.TrustBoundary {
+		t.Errorf("ServiceOf() = %+v, %t", s, ok)
+	}
+	spdx, err := Write(back, formats.SPDX23JSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := Convert(spdx, formats.CDX15JSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(again, &doc); err != nil {
+		t.Fatal(err)
+	}
+	if len(doc.Services) != 2 {
+		t.Errorf("services after a SPDX round trip = %+v, want 2", doc.Services)
+	}
+}
@@ -0,0 +1,260 @@
+// Package schedule analyzes the derivation graph of a build with the time each derivation took to build, to size
+// build farms and find where builds serialize. The critical path is the chain of dependent derivations that bounds
+// the build however many builders there are, the parallelism profile how many derivations could build at once.
+// The scheduling hints rank the derivations by the length of the critical path they start, the order list
+// schedulers should build them in.
+package schedule
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/buildsafedev/bsf/pkg/depgraph"
+)
+
+// ReportName is the name of the schedule report in the output directory
+const ReportName = "schedule.json"
+
+// Timing is when a derivation built, by its store path
+type Timing struct {
+	DrvPath string
+	Start   time.Time
+	End     time.Time
+}
+
+// Task is a derivation of the build
+type Task struct {
+	// Drv is the name of the store path of the derivation, e.g. 0c5nd8lq...-openssl-3.0.13.drv
+	Drv  string `json:"drv"`
+	Name string `json:"name"`
+	// Duration is how long the derivation built, zero for the derivations that were substituted or already valid
+	Duration time.Duration `json:"duration"`
+	Built    bool          `json:"built"`
+	// Start and End are the offsets from the start of the build the derivation built between
+	Start time.Duration `json:"start,omitempty"`
+	End   time.Duration `json:"end,omitempty"`
+	// EarliestStart is when the derivation could start with unlimited builders, once its dependencies built
+	EarliestStart time.Duration `json:"earliestStart"`
+	// Priority is the length of the longest chain of derivations from this one to the result, included
+	Priority time.Duration `json:"priority"`
+	// Slack is how late the derivation can start without delaying the result with unlimited builders
+	Slack    time.Duration `json:"slack"`
+	Critical bool          `json:"critical,omitempty"`
+}
+
+// Step is the number of derivations building from an offset of the build to the next step
+type Step struct {
+	Offset  time.Duration `json:"offset"`
+	Running int           `json:"running"`
+}
+
+// Summary sums up the schedule of the build
+type Summary struct {
+	// Work is the time of all the builds, what a single builder would take
+	Work time.Duration `json:"work"`
+	// CriticalPath is what unlimited builders would take, Wall what the build took
+	CriticalPath time.Duration `json:"criticalPath"`
+	Wall         time.Duration `json:"wall"`
+	// Parallelism is the average parallelism of the graph, work over the critical path
+	Parallelism float64 `json:"parallelism"`
+	// PeakParallelism is the most derivations building at once with unlimited builders, PeakRunning during the build
+	PeakParallelism int `json:"peakParallelism"`
+	PeakRunning     int `json:"peakRunning"`
+	// Builders is the number of builders past which the critical path bounds the build, the parallelism rounded up
+	Builders int `json:"builders"`
+	Built    int `json:"built"`
+	Cached   int `json:"cached"`
+}
+
+// Report is the schedule of a build
+type Report struct {
+	Summary Summary `json:"summary"`
+	// CriticalPath are the derivations of the critical path, the first one first
+	CriticalPath []string `json:"criticalPath"`
+	// Hints are the derivations built, in the order a list scheduler should start them: by priority
+	Hints []Task `json:"hints"`
+	// Ideal is the parallelism profile with unlimited builders, Actual the one of the build
+	Ideal  []Step `json:"ideal"`
+	Actual []Step `json:"actual"`
+}
+
+// Analyze computes the schedule of the derivations of the graph, as GetDerivationGraph returns it, with their
+// timings. The sources of the graph and the derivations without timing take no time.
+func Analyze(g *depgraph.Graph, timings []Timing) *Report {
+	byDrv := make(map[string]Timing, len(timings))
+	var origin time.Time
+	for _, t := range timings {
+		name := t.DrvPath[strings.LastIndex(t.DrvPath, "/")+1:]
+		byDrv[name] = t
+		if origin.IsZero() || t.Start.Before(origin) {
+			origin = t.Start
+		}
+	}
+
+	tasks := make(map[string]*Task)
+	order := make([]string, 0)
+	for _, n := range g.Nodes {
+		if !strings.HasSuffix(n.ID, ".drv") {
+			continue
+		}
+		task := &Task{Drv: n.ID, Name: n.Attrs["name"]}
+		if task.Name == "" {
+			task.Name = n.ID
+		}
+		if t, ok := byDrv[n.ID]; ok {
+			task.Built = true
+			task.Duration = t.End.Sub(t.Start)
+			task.Start, task.End = t.Start.Sub(origin), t.End.Sub(origin)
+		}
+		tasks[n.ID] = task
+		order = append(order, n.ID)
+	}
+	deps := make(map[string][]string)
+	dependents := make(map[string][]string)
+	for _, e := range g.Edges {
+		if tasks[e.From] != nil && tasks[e.To] != nil {
+			deps[e.To] = append(deps[e.To], e.From)
+			dependents[e.From] = append(dependents[e.From], e.To)
+		}
+	}
+	sorted := topological(order, deps)
+
+	r := &Report{CriticalPath: make([]string, 0), Hints: make([]Task, 0)}
+	// earliest starts forward, priorities backward
+	for _, id := range sorted {
+		t := tasks[id]
+		for _, d := range deps[id] {
+			if end := tasks[d].EarliestStart + tasks[d].Duration; end > t.EarliestStart {
+				t.EarliestStart = end
+			}
+		}
+		if end := t.EarliestStart + t.Duration; end > r.Summary.CriticalPath {
+			r.Summary.CriticalPath = end
+		}
+	}
+	for i := len(sorted) - 1; i >= 0; i-- {
+		t := tasks[sorted[i]]
+		var longest time.Duration
+		for _, d := range dependents[sorted[i]] {
+			if p := tasks[d].Priority; p > longest {
+				longest = p
+			}
+		}
+		t.Priority = t.Duration + longest
+		t.Slack = r.Summary.CriticalPath - t.EarliestStart - t.Priority
+	}
+
+	// the critical path starts at the built derivation with the highest priority and follows the dependents without
+	// slack
+	var current *Task
+	for _, id := range sorted {
+		if t := tasks[id]; t.Built && (current == nil || t.Priority > current.Priority) {
+			current = t
+		}
+	}
+	for current != nil && r.Summary.CriticalPath > 0 {
+		current.Critical = true
+		r.CriticalPath = append(r.CriticalPath, current.Drv)
+		var next *Task
+		for _, d := range dependents[current.Drv] {
+			if t := tasks[d]; t.Slack == 0 && t.EarliestStart == current.EarliestStart+current.Duration && t.Built && (next == nil || t.Priority > next.Priority) {
+				next = t
+			}
+		}
+		current = next
+	}
+
+	var ideal, actual []interval
+	var first, last time.Duration
+	for _, id := range sorted {
+		t := tasks[id]
+		if !t.Built {
+			r.Summary.Cached++
+			continue
+		}
+		r.Summary.Built++
+		r.Summary.Work += t.Duration
+		r.Hints = append(r.Hints, *t)
+		ideal = append(ideal, interval{t.EarliestStart, t.EarliestStart + t.Duration})
+		actual = append(actual, interval{t.Start, t.End})
+		if r.Summary.Built == 1 || t.Start < first {
+			first = t.Start
+		}
+		if t.End > last {
+			last = t.End
+		}
+	}
+	sort.SliceStable(r.Hints, func(i, j int) bool { return r.Hints[i].Priority > r.Hints[j].Priority })
+	r.Summary.Wall = last - first
+	r.Ideal, r.Summary.PeakParallelism = profile(ideal)
+	r.Actual, r.Summary.PeakRunning = profile(actual)
+	if r.Summary.CriticalPath > 0 {
+		r.Summary.Parallelism = float64(r.Summary.Work) / float64(r.Summary.CriticalPath)
+		r.Summary.Builders = int(math.Ceil(r.Summary.Parallelism - 1e-9))
+	}
+	return r
+}
+
+// topological sorts the nodes so dependencies come before their dependents, in the order of nodes otherwise
+func topological(nodes []string, deps map[string][]string) []string {
+	sorted := make([]string, 0, len(nodes))
+	// 0 unvisited, 1 visiting, 2 done: a cycle, which derivations can't have, is cut where it is found
+	state := make(map[string]int, len(nodes))
+	var visit func(id string)
+	visit = func(id string) {
+		if state[id] != 0 {
+			return
+		}
+		state[id] = 1
+		for _, d := range deps[id] {
+			visit(d)
+		}
+		state[id] = 2
+		sorted = append(sorted, id)
+	}
+	for _, id := range nodes {
+		visit(id)
+	}
+	return sorted
+}
+
+type interval struct {
+	start, end time.Duration
+}
+
+// profile returns the number of intervals running at each offset they start or end at, and its peak
+func profile(intervals []interval) ([]Step, int) {
+	type event struct {
+		at    time.Duration
+		delta int
+	}
+	events := make([]event, 0, 2*len(intervals))
+	for _, i := range intervals {
+		if i.end > i.start {
+			events = append(events, event{i.start, 1}, event{i.end, -1})
+		}
+	}
+	// at the same offset, ends come before starts
+	sort.Slice(events, func(i, j int) bool {
+		if events[i].at != events[j].at {
+			return events[i].at < events[j].at
+		}
+		return events[i].delta < events[j].delta
+	})
+
+	steps := make([]Step, 0)
+	running, peak := 0, 0
+	for i, e := range events {
+		running += e.delta
+		if running > peak {
+			peak = running
+		}
+		if i+1 < len(events) && events[i+1].at == e.at {
+			continue
+		}
+		steps = append(steps, Step{Offset: e.at, Running: running})
+	}
+	return steps, peak
+}
@@ -0,0 +1,71 @@
+package schedule
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/buildsafedev/bsf/pkg/depgraph"
+)
+
+func TestAnalyze(t *testing.T) {
+	// zlib and openssl build in parallel, curl needs both, app needs curl; glibc was substituted
+	g := depgraph.New()
+	for from, to := range map[string]string{
+		"a-zlib.drv":    "c-curl.drv",
+		"b-openssl.drv": "c-curl.drv",
+		"c-curl.drv":    "d-app.drv",
+		"e-glibc.drv":   "b-openssl.drv",
+		"f-src.tar.gz":  "a-zlib.drv",
+	} {
+		g.AddEdge(from, to, nil)
+	}
+	g.AddNode("c-curl.drv", map[string]string{"name": "curl"})
+
+	start := time.Date(2024, 6, 1, 10, 0, 0, 0, time.UTC)
+	at := func(s int) time.Time { return start.Add(time.Duration(s) * time.Second) }
+	timings := []Timing{
+		{DrvPath: "/nix/store/a-zlib.drv", Start: at(0), End: at(10)},
+		{DrvPath: "/nix/store/b-openssl.drv", Start: at(0), End: at(60)},
+		{DrvPath: "/nix/store/c-curl.drv", Start: at(60), End: at(90)},
+		{DrvPath: "/nix/store/d-app.drv", Start: at(90), End: at(100)},
+	}
+	r := Analyze(g, timings)
+
+	if want := []string{"b-openssl.drv", "c-curl.drv", "d-app.drv"}; !reflect.DeepEqual(r.CriticalPath, want) {
+		t.Errorf("CriticalPath = %v, want %v", r.CriticalPath, want)
+	}
+	s := r.Summary
+	if s.Work != 110*time.Second || s.CriticalPath != 100*time.Second || s.Wall != 100*time.Second {
+		t.Errorf("unexpected summary %+v", s)
+	}
+	if s.Built != 4 || s.Cached != 1 || s.Builders != 2 || s.PeakParallelism != 2 || s.PeakRunning != 2 {
+		t.Errorf("unexpected summary %+v", s)
+	}
+
+	if r.Hints[0].Drv != "b-openssl.drv" || r.Hints[0].Priority != 100*time.Second {
+		t.Errorf("unexpected first hint %+v", r.Hints[0])
+	}
+	for _, h := range r.Hints {
+		if h.Drv == "a-zlib.drv" && (h.Slack != 50*time.Second || h.Critical) {
+			t.Errorf("unexpected hint of zlib %+v", h)
+		}
+		if h.Drv == "c-curl.drv" && (h.Name != "curl" || h.EarliestStart != 60*time.Second) {
+			t.Errorf("unexpected hint of curl %+v", h)
+		}
+	}
+
+	want := []Step{{0, 2}, {10 * time.Second, 1}, {60 * time.Second, 1}, {90 * time.Second, 1}, {100 * time.Second, 0}}
+	if !reflect.DeepEqual(r.Ideal, want) {
+		t.Errorf("Ideal = %v, want %v", r.Ideal, want)
+	}
+}
+
+func TestAnalyzeNothingBuilt(t *testing.T) {
+	g := depgraph.New()
+	g.AddEdge("a-zlib.drv", "b-app.drv", nil)
+	r := Analyze(g, nil)
+	if len(r.CriticalPath) != 0 || len(r.Hints) != 0 || r.Summary.Cached != 2 || r.Summary.Builders != 0 {
+		t.Errorf("unexpected report %+v", r)
+	}
+}
@@ -0,0 +1,132 @@
+package scorecard
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+
+	"github.com/bom-squad/protobom/pkg/sbom"
+)
+
+// Component is a SBOM component enriched with the scorecard of its upstream repository
+type Component struct {
+	Name    string  `json:"name"`
+	Version string  `json:"version"`
+	Repo    string  `json:"repo,omitempty"`
+	Score   float64 `json:"score"`
+	// Scored is false when the upstream repository could not be resolved or has no scorecard
+	Scored bool    `json:"scored"`
+	Checks []Check `json:"checks,omitempty"`
+}
+
+// Report holds the scorecard results of all components of an artifact
+type Report struct {
+	Components []Component `json:"components"`
+	// Average is the mean score of all scored components
+	Average float64 `json:"average"`
+	// Lowest is the lowest score of all scored components
+	Lowest float64 `json:"lowest"`
+	// RiskScore is the aggregated risk of the artifact from 0 (lowest risk) to 10 (highest risk)
+	RiskScore float64 `json:"riskScore"`
+	Unscored  int     `json:"unscored"`
+}
+
+// HomepageResolver resolves the homepage of a package when the SBOM does not carry it
+type HomepageResolver func(ctx context.Context, name, version string) (string, error)
+
+// Enrich fetches scorecard results for the upstream repository of each node, with at most concurrency requests in flight
+func Enrich(ctx context.Context, c *Client, nodes []*sbom.Node, resolve HomepageResolver, concurrency int) (*Report, error) {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	components := make([]Component, len(nodes))
+	errs := make([]error, len(nodes))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+
+	for i, node := range nodes {
+		wg.Add(1)
+		go func(i int, node *sbom.Node) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			comp := Component{Name: node.Name, Version: node.Version}
+			homepage := node.UrlHome
+			if homepage == "" && resolve != nil {
+				homepage, _ = resolve(ctx, node.Name, node.Version)
+			}
+
+			repo, ok := RepoFromURL(homepage)
+			if !ok {
+				components[i] = comp
+				return
+			}
+			comp.Repo = repo
+
+			result, err := c.Fetch(ctx, repo)
+			if err != nil {
+				if !errors.Is(err, ErrNotFound) {
+					errs[i] = err
+				}
+				components[i] = comp
+				return
+			}
+
+			comp.Score = result.Score
+			comp.Scored = true
+			comp.Checks = result.Checks
+			components[i] = comp
+		}(i, node)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return newReport(components), nil
+}
+
+func newReport(components []Component) *Report {
+	sort.Slice(components, func(i, j int) bool {
+		return components[i].Name < components[j].Name
+	})
+
+	r := &Report{Components: components}
+	scored := 0
+	total := 0.0
+	for _, c := range components {
+		if !c.Scored {
+			r.Unscored++
+			continue
+		}
+		if scored == 0 || c.Score < r.Lowest {
+			r.Lowest = c.Score
+		}
+		scored++
+		total += c.Score
+	}
+
+	if scored > 0 {
+		r.Average = total / float64(scored)
+		r.RiskScore = 10 - r.Average
+	}
+
+	return r
+}
+
+// Violations returns the scored components whose score is below minScore
+func (r *Report) Violations(minScore float64) []Component {
+	violations := make([]Component, 0)
+	for _, c := range r.Components {
+		if c.Scored && c.Score < minScore {
+			violations = append(violations, c)
+		}
+	}
+	return violations
+}
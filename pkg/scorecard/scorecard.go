@@ -0,0 +1,104 @@
+package scorecard
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultAPI is the public OpenSSF Scorecard API
+	DefaultAPI = "https://api.securityscorecards.dev"
+)
+
+// Result is the scorecard result of a repository
+type Result struct {
+	Date  string  `json:"date"`
+	Score float64 `json:"score"`
+	Repo  struct {
+		Name   string `json:"name"`
+		Commit string `json:"commit"`
+	} `json:"repo"`
+	Checks []Check `json:"checks"`
+}
+
+// Check is an individual scorecard check
+type Check struct {
+	Name   string `json:"name"`
+	Score  int    `json:"score"`
+	Reason string `json:"reason"`
+}
+
+// Client fetches scorecard results
+type Client struct {
+	BaseURL    string
+	HTTPClient *http.Client
+}
+
+// NewClient creates a client for the public scorecard API
+func NewClient() *Client {
+	return &Client{
+		BaseURL: DefaultAPI,
+		HTTPClient: &http.Client{
+			Timeout: 30 * time.Second,
+		},
+	}
+}
+
+// ErrNotFound is returned when scorecard has no results for the repository
+var ErrNotFound = fmt.Errorf("no scorecard results found")
+
+// Fetch fetches the scorecard of the repository. repo should be of the form github.com/owner/name
+func (c *Client) Fetch(ctx context.Context, repo string) (*Result, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.BaseURL+"/projects/"+repo, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("scorecard API returned %s for %s", resp.Status, repo)
+	}
+
+	result := &Result{}
+	err = json.NewDecoder(resp.Body).Decode(result)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode scorecard result: %v", err)
+	}
+
+	return result, nil
+}
+
+// RepoFromURL returns the repository scorecard knows about for a homepage or source URL.
+// Only github.com and gitlab.com repositories are scored.
+func RepoFromURL(rawURL string) (string, bool) {
+	rawURL = strings.TrimPrefix(rawURL, "git+")
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", false
+	}
+
+	host := strings.TrimPrefix(u.Host, "www.")
+	if host != "github.com" && host != "gitlab.com" {
+		return "", false
+	}
+
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if len(parts) < 2 || parts[0] == "" || parts[1] == "" {
+		return "", false
+	}
+
+	return host + "/" + parts[0] + "/" + strings.TrimSuffix(parts[1], ".git"), true
+}
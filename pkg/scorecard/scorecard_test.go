@@ -0,0 +1,80 @@
+package scorecard
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bom-squad/protobom/pkg/sbom"
+)
+
+func TestRepoFromURL(t *testing.T) {
+	tests := []struct {
+		url    string
+		want   string
+		wantOk bool
+	}{
+		{"https://github.com/curl/curl", "github.com/curl/curl", true},
+		{"https://www.github.com/openssl/openssl/tree/master", "github.com/openssl/openssl", true},
+		{"git+https://gitlab.com/inkscape/inkscape.git", "gitlab.com/inkscape/inkscape", true},
+		{"https://www.openssl.org", "", false},
+		{"https://github.com/curl", "", false},
+		{"", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			got, ok := RepoFromURL(tt.url)
+			if got != tt.want || ok != tt.wantOk {
+				t.Errorf("RepoFromURL() = %v, %v, want %v, %v", got, ok, tt.want, tt.wantOk)
+			}
+		})
+	}
+}
+
+func TestEnrich(t *testing.T) {
+	scores := map[string]float64{
+		"/projects/github.com/curl/curl":       8,
+		"/projects/github.com/madler/zlib":     4,
+		"/projects/github.com/unknown/nothing": -1,
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		score, ok := scores[r.URL.Path]
+		if !ok || score < 0 {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		fmt.Fprintf(w, `{"score": %v, "checks": [{"name": "Maintained", "score": 10}]}`, score)
+	}))
+	defer srv.Close()
+
+	c := &Client{BaseURL: srv.URL, HTTPClient: srv.Client()}
+	nodes := []*sbom.Node{
+		{Name: "curl", Version: "8.5.0", UrlHome: "https://github.com/curl/curl"},
+		{Name: "zlib", Version: "1.3"},
+		{Name: "nothing", Version: "1.0", UrlHome: "https://github.com/unknown/nothing"},
+		{Name: "glibc", Version: "2.38", UrlHome: "https://www.gnu.org/software/libc/"},
+	}
+	resolve := func(ctx context.Context, name, version string) (string, error) {
+		if name == "zlib" {
+			return "https://github.com/madler/zlib", nil
+		}
+		return "", nil
+	}
+
+	r, err := Enrich(context.Background(), c, nodes, resolve, 2)
+	if err != nil {
+		t.Fatalf("Enrich() error = %v", err)
+	}
+
+	if r.Average != 6 || r.Lowest != 4 || r.RiskScore != 4 || r.Unscored != 2 {
+		t.Errorf("Enrich() = average %v lowest %v risk %v unscored %v", r.Average, r.Lowest, r.RiskScore, r.Unscored)
+	}
+
+	violations := r.Violations(5)
+	if len(violations) != 1 || violations[0].Name != "zlib" {
+		t.Errorf("Violations() = %v, want zlib", violations)
+	}
+}
@@ -0,0 +1,129 @@
+// Package shutdown stops a bsf run that fails or is interrupted cleanly. Commands register hooks removing what they
+// wrote partially and recording the failure, and exit through Exit instead of os.Exit. With Notify, SIGINT and SIGTERM
+// cancel the context of the run, so the concurrent pipelines and external commands stop, and run the hooks too.
+// Temporary files registered with RemoveOnExit are removed whichever way the run stops.
+package shutdown
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+// ErrInterrupted is the cause of the shutdown of a run interrupted by a signal
+var ErrInterrupted = errors.New("interrupted")
+
+// Hook cleans up after a run stopped by cause
+type Hook func(cause error)
+
+var (
+	mu       sync.Mutex
+	hooks    = make(map[int]Hook)
+	nextID   int
+	temps    = make(map[string]int)
+	ctx      context.Context
+	cancel   context.CancelFunc
+	stopping bool
+	done     = make(chan struct{})
+	notify   sync.Once
+)
+
+func init() {
+	ctx, cancel = context.WithCancel(context.Background())
+}
+
+// Context returns the context of the run, it is done once the run is shutting down
+func Context() context.Context {
+	mu.Lock()
+	defer mu.Unlock()
+	return ctx
+}
+
+// Register registers the hook, run when the run stops through Exit or a signal. Hooks run once, the last registered
+// first as deferred functions do. The returned function unregisters it, e.g. once the work it cleans up is complete.
+func Register(h Hook) (unregister func()) {
+	mu.Lock()
+	defer mu.Unlock()
+	id := nextID
+	nextID++
+	hooks[id] = h
+	return func() {
+		mu.Lock()
+		defer mu.Unlock()
+		delete(hooks, id)
+	}
+}
+
+// RemoveOnExit removes the file at path if the run stops before release is called. Paths can be registered several
+// times, e.g. by concurrent writers.
+func RemoveOnExit(path string) (release func()) {
+	mu.Lock()
+	defer mu.Unlock()
+	temps[path]++
+	return func() {
+		mu.Lock()
+		defer mu.Unlock()
+		if temps[path]--; temps[path] <= 0 {
+			delete(temps, path)
+		}
+	}
+}
+
+// Run cancels the context of the run, runs the hooks and removes the temporary files, once. Concurrent calls wait
+// for the first one to complete.
+func Run(cause error) {
+	mu.Lock()
+	if stopping {
+		mu.Unlock()
+		<-done
+		return
+	}
+	stopping = true
+	cancel()
+	pending := make([]Hook, 0, len(hooks))
+	// the last registered hook runs first
+	for id := nextID - 1; id >= 0; id-- {
+		if h, ok := hooks[id]; ok {
+			pending = append(pending, h)
+		}
+	}
+	paths := make([]string, 0, len(temps))
+	for p := range temps {
+		paths = append(paths, p)
+	}
+	hooks, temps = make(map[int]Hook), make(map[string]int)
+	mu.Unlock()
+
+	for _, h := range pending {
+		h(cause)
+	}
+	for _, p := range paths {
+		os.RemoveAll(p)
+	}
+	close(done)
+}
+
+// Exit runs the hooks with the cause and exits with the code
+func Exit(code int, cause error) {
+	Run(cause)
+	os.Exit(code)
+}
+
+// Notify shuts the run down on SIGINT and SIGTERM, exiting with 130 and 143 as shells report them
+func Notify() {
+	notify.Do(func() {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+		go func() {
+			sig := <-signals
+			code := 130
+			if sig == syscall.SIGTERM {
+				code = 143
+			}
+			Exit(code, ErrInterrupted)
+		}()
+	})
+}
@@ -0,0 +1,69 @@
+package shutdown
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	defer reset()
+	reset()
+
+	var order []string
+	var causes []error
+	Register(func(cause error) { order, causes = append(order, "first"), append(causes, cause) })
+	unregister := Register(func(error) { order = append(order, "unregistered") })
+	Register(func(error) { order = append(order, "last") })
+	unregister()
+
+	dir := t.TempDir()
+	kept, removed := filepath.Join(dir, "kept"), filepath.Join(dir, "removed.nar")
+	for _, p := range []string{kept, removed} {
+		if err := os.WriteFile(p, []byte("nar"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	RemoveOnExit(kept)()
+	RemoveOnExit(removed)
+
+	cause := errors.New("nix build failed")
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			Run(cause)
+		}()
+	}
+	wg.Wait()
+
+	if !reflect.DeepEqual(order, []string{"last", "first"}) {
+		t.Errorf("hooks ran %v, want the last registered first, once", order)
+	}
+	if len(causes) != 1 || causes[0] != cause {
+		t.Errorf("hooks got causes %v", causes)
+	}
+	if Context().Err() == nil {
+		t.Errorf("the context of the run wasn't canceled")
+	}
+	if _, err := os.Stat(kept); err != nil {
+		t.Errorf("a released file was removed: %v", err)
+	}
+	if _, err := os.Stat(removed); !os.IsNotExist(err) {
+		t.Errorf("a temporary file was kept: %v", err)
+	}
+}
+
+// reset restores the initial state of the package
+func reset() {
+	mu.Lock()
+	defer mu.Unlock()
+	hooks, temps, nextID, stopping = make(map[int]Hook), make(map[string]int), 0, false
+	ctx, cancel = context.WithCancel(context.Background())
+	done = make(chan struct{})
+}
@@ -0,0 +1,46 @@
+package signing
+
+import (
+	"bufio"
+	"bytes"
+	"crypto"
+	"encoding/json"
+	"io"
+)
+
+// SignedAttestation is a DSSE signed in-toto statement together with the certificate chain of the signing key. It is
+// written as a sigstore bundle.
+type SignedAttestation struct {
+	Envelope     *Envelope `json:"dsseEnvelope"`
+	Certificates []string  `json:"certificates"`
+	// TlogEntry is the transparency log entry of the envelope, attestations signed with a certified key are recorded in the log
+	TlogEntry *LogEntry `json:"tlogEntry,omitempty"`
+}
+
+// SignAttestations signs every in-toto statement of the JSON lines attestations and writes the signed attestations as JSON lines
+func SignAttestations(w io.Writer, attestations []byte, signer crypto.Signer, certificates []string) error {
+	scanner := bufio.NewScanner(bytes.NewReader(attestations))
+	scanner.Buffer(make([]byte, 0, 1024*1024), 64*1024*1024)
+
+	enc := json.NewEncoder(w)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		env, err := SignEnvelope(signer, InTotoPayloadType, line)
+		if err != nil {
+			return err
+		}
+		err = enc.Encode(SignedAttestation{
+			Envelope:     env,
+			Certificates: certificates,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return scanner.Err()
+}
@@ -0,0 +1,291 @@
+package signing
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// BundleMediaType is the media type of the sigstore bundles bsf writes, the v0.3 bundles cosign v2 and policy
+// engines verify
+const BundleMediaType = "application/vnd.dev.sigstore.bundle.v0.3+json"
+
+// bundleMediaTypePrefix is the prefix of the media types of every version of sigstore bundles
+const bundleMediaTypePrefix = "application/vnd.dev.sigstore.bundle"
+
+// Bundle is a sigstore bundle: a DSSE envelope with the material to verify it offline, the certificate of the signing
+// key or a hint of the public key, and the transparency log entry of the envelope
+type Bundle struct {
+	MediaType            string               `json:"mediaType"`
+	VerificationMaterial verificationMaterial `json:"verificationMaterial"`
+	DSSEEnvelope         *Envelope            `json:"dsseEnvelope"`
+}
+
+type verificationMaterial struct {
+	// Certificate is the leaf certificate of bundles v0.3
+	Certificate *rawBytes `json:"certificate,omitempty"`
+	// X509CertificateChain is the certificate chain of bundles v0.1 and v0.2, read but not written
+	X509CertificateChain *struct {
+		Certificates []rawBytes `json:"certificates"`
+	} `json:"x509CertificateChain,omitempty"`
+	PublicKey   *publicKeyIdentifier `json:"publicKey,omitempty"`
+	TlogEntries []bundleTlogEntry    `json:"tlogEntries"`
+}
+
+type rawBytes struct {
+	RawBytes string `json:"rawBytes"`
+}
+
+type publicKeyIdentifier struct {
+	Hint string `json:"hint,omitempty"`
+}
+
+// bundleTlogEntry is a transparency log entry as bundles hold it: integers are strings, hashes and log IDs base64
+type bundleTlogEntry struct {
+	LogIndex string `json:"logIndex"`
+	LogID    struct {
+		KeyID string `json:"keyId"`
+	} `json:"logId"`
+	KindVersion struct {
+		Kind    string `json:"kind"`
+		Version string `json:"version"`
+	} `json:"kindVersion"`
+	IntegratedTime   string `json:"integratedTime"`
+	InclusionPromise *struct {
+		SignedEntryTimestamp string `json:"signedEntryTimestamp"`
+	} `json:"inclusionPromise,omitempty"`
+	InclusionProof    *bundleInclusionProof `json:"inclusionProof,omitempty"`
+	CanonicalizedBody string                `json:"canonicalizedBody"`
+}
+
+type bundleInclusionProof struct {
+	LogIndex   string   `json:"logIndex"`
+	RootHash   string   `json:"rootHash"`
+	TreeSize   string   `json:"treeSize"`
+	Hashes     []string `json:"hashes"`
+	Checkpoint struct {
+		Envelope string `json:"envelope"`
+	} `json:"checkpoint"`
+}
+
+// NewBundle returns the bundle of the envelope. The first of the PEM encoded certificates is the certificate of the
+// signing key, bundles hold the public key hint of envelopes signed with a key of their own.
+func NewBundle(env *Envelope, certificates []string, entry *LogEntry) (*Bundle, error) {
+	b := &Bundle{MediaType: BundleMediaType, DSSEEnvelope: env, VerificationMaterial: verificationMaterial{TlogEntries: make([]bundleTlogEntry, 0)}}
+	if len(certificates) > 0 {
+		block, _ := pem.Decode([]byte(certificates[0]))
+		if block == nil || block.Type != "CERTIFICATE" {
+			return nil, fmt.Errorf("the certificate of the signing key is not PEM encoded")
+		}
+		// the intermediate certificates are in the trust root, v0.3 bundles only hold the leaf
+		b.VerificationMaterial.Certificate = &rawBytes{RawBytes: base64.StdEncoding.EncodeToString(block.Bytes)}
+	} else {
+		hint := ""
+		if env != nil && len(env.Signatures) > 0 {
+			hint = env.Signatures[0].KeyID
+		}
+		b.VerificationMaterial.PublicKey = &publicKeyIdentifier{Hint: hint}
+	}
+	if entry != nil {
+		e, err := bundleEntry(entry)
+		if err != nil {
+			return nil, err
+		}
+		b.VerificationMaterial.TlogEntries = append(b.VerificationMaterial.TlogEntries, *e)
+	}
+	return b, nil
+}
+
+// Open returns the envelope of the bundle, the PEM encoded certificates of the signing key and its transparency log
+// entry, nil when it wasn't recorded
+func (b *Bundle) Open() (*Envelope, []string, *LogEntry, error) {
+	if !strings.HasPrefix(b.MediaType, bundleMediaTypePrefix) {
+		return nil, nil, nil, fmt.Errorf("unsupported bundle media type %q", b.MediaType)
+	}
+	if b.DSSEEnvelope == nil {
+		return nil, nil, nil, fmt.Errorf("the bundle has no DSSE envelope, message signatures are not supported")
+	}
+
+	var raw []rawBytes
+	if c := b.VerificationMaterial.Certificate; c != nil {
+		raw = append(raw, *c)
+	} else if chain := b.VerificationMaterial.X509CertificateChain; chain != nil {
+		raw = chain.Certificates
+	}
+	certificates := make([]string, 0, len(raw))
+	for _, c := range raw {
+		der, err := base64.StdEncoding.DecodeString(c.RawBytes)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("invalid certificate in bundle: %v", err)
+		}
+		certificates = append(certificates, string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})))
+	}
+
+	var entry *LogEntry
+	if len(b.VerificationMaterial.TlogEntries) > 0 {
+		var err error
+		if entry, err = logEntryOf(&b.VerificationMaterial.TlogEntries[0]); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	return b.DSSEEnvelope, certificates, entry, nil
+}
+
+// IsBundle returns whether the JSON document is a sigstore bundle
+func IsBundle(data []byte) bool {
+	var doc struct {
+		MediaType string `json:"mediaType"`
+	}
+	return json.Unmarshal(data, &doc) == nil && strings.HasPrefix(doc.MediaType, bundleMediaTypePrefix)
+}
+
+// MarshalJSON writes the signed attestation as a sigstore bundle
+func (sa SignedAttestation) MarshalJSON() ([]byte, error) {
+	b, err := NewBundle(sa.Envelope, sa.Certificates, sa.TlogEntry)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(b)
+}
+
+// UnmarshalJSON reads a signed attestation from a sigstore bundle, or from the format of earlier versions of bsf with
+// the certificate chain and log entry next to the envelope
+func (sa *SignedAttestation) UnmarshalJSON(data []byte) error {
+	if !IsBundle(data) {
+		// legacy has the fields of SignedAttestation without its methods
+		type legacy SignedAttestation
+		return json.Unmarshal(data, (*legacy)(sa))
+	}
+
+	b := &Bundle{}
+	if err := json.Unmarshal(data, b); err != nil {
+		return err
+	}
+	env, certificates, entry, err := b.Open()
+	if err != nil {
+		return err
+	}
+	*sa = SignedAttestation{Envelope: env, Certificates: certificates, TlogEntry: entry}
+	return nil
+}
+
+// bundleEntry converts a log entry as Rekor returns it to a log entry of a bundle
+func bundleEntry(e *LogEntry) (*bundleTlogEntry, error) {
+	b := &bundleTlogEntry{
+		LogIndex:          strconv.FormatInt(e.LogIndex, 10),
+		IntegratedTime:    strconv.FormatInt(e.IntegratedTime, 10),
+		CanonicalizedBody: e.Body,
+	}
+	logID, err := hexToBase64(e.LogID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid log ID: %v", err)
+	}
+	b.LogID.KeyID = logID
+
+	body, err := base64.StdEncoding.DecodeString(e.Body)
+	if err != nil {
+		return nil, fmt.Errorf("invalid log entry body: %v", err)
+	}
+	var kind struct {
+		Kind       string `json:"kind"`
+		APIVersion string `json:"apiVersion"`
+	}
+	if err := json.Unmarshal(body, &kind); err != nil {
+		return nil, fmt.Errorf("invalid log entry body: %v", err)
+	}
+	b.KindVersion.Kind, b.KindVersion.Version = kind.Kind, kind.APIVersion
+
+	if set := e.Verification.SignedEntryTimestamp; set != "" {
+		b.InclusionPromise = &struct {
+			SignedEntryTimestamp string `json:"signedEntryTimestamp"`
+		}{set}
+	}
+	if p := e.Verification.InclusionProof; p != nil {
+		proof := &bundleInclusionProof{
+			LogIndex: strconv.FormatInt(p.LogIndex, 10),
+			TreeSize: strconv.FormatInt(p.TreeSize, 10),
+			Hashes:   make([]string, 0, len(p.Hashes)),
+		}
+		if proof.RootHash, err = hexToBase64(p.RootHash); err != nil {
+			return nil, fmt.Errorf("invalid root hash: %v", err)
+		}
+		for _, h := range p.Hashes {
+			h, err := hexToBase64(h)
+			if err != nil {
+				return nil, fmt.Errorf("invalid inclusion proof hash: %v", err)
+			}
+			proof.Hashes = append(proof.Hashes, h)
+		}
+		proof.Checkpoint.Envelope = p.Checkpoint
+		b.InclusionProof = proof
+	}
+	return b, nil
+}
+
+// logEntryOf converts a log entry of a bundle to a log entry as Rekor returns it
+func logEntryOf(b *bundleTlogEntry) (*LogEntry, error) {
+	e := &LogEntry{Body: b.CanonicalizedBody}
+	var err error
+	if e.LogIndex, err = strconv.ParseInt(b.LogIndex, 10, 64); err != nil {
+		return nil, fmt.Errorf("invalid log index %q", b.LogIndex)
+	}
+	if e.IntegratedTime, err = strconv.ParseInt(b.IntegratedTime, 10, 64); err != nil {
+		return nil, fmt.Errorf("invalid integrated time %q", b.IntegratedTime)
+	}
+	if e.LogID, err = base64ToHex(b.LogID.KeyID); err != nil {
+		return nil, fmt.Errorf("invalid log ID: %v", err)
+	}
+	body, err := base64.StdEncoding.DecodeString(b.CanonicalizedBody)
+	if err != nil {
+		return nil, fmt.Errorf("invalid log entry body: %v", err)
+	}
+	// Rekor finds entries by the hash of their leaf, bundles don't hold the tree ID of the full UUID
+	leaf := sha256.Sum256(append([]byte{0x00}, body...))
+	e.UUID = hex.EncodeToString(leaf[:])
+
+	if p := b.InclusionPromise; p != nil {
+		e.Verification.SignedEntryTimestamp = p.SignedEntryTimestamp
+	}
+	if p := b.InclusionProof; p != nil {
+		proof := &InclusionProof{Checkpoint: p.Checkpoint.Envelope, Hashes: make([]string, 0, len(p.Hashes))}
+		if proof.LogIndex, err = strconv.ParseInt(p.LogIndex, 10, 64); err != nil {
+			return nil, fmt.Errorf("invalid inclusion proof log index %q", p.LogIndex)
+		}
+		if proof.TreeSize, err = strconv.ParseInt(p.TreeSize, 10, 64); err != nil {
+			return nil, fmt.Errorf("invalid inclusion proof tree size %q", p.TreeSize)
+		}
+		if proof.RootHash, err = base64ToHex(p.RootHash); err != nil {
+			return nil, fmt.Errorf("invalid root hash: %v", err)
+		}
+		for _, h := range p.Hashes {
+			h, err := base64ToHex(h)
+			if err != nil {
+				return nil, fmt.Errorf("invalid inclusion proof hash: %v", err)
+			}
+			proof.Hashes = append(proof.Hashes, h)
+		}
+		e.Verification.InclusionProof = proof
+	}
+	return e, nil
+}
+
+func hexToBase64(s string) (string, error) {
+	data, err := hex.DecodeString(s)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(data), nil
+}
+
+func base64ToHex(s string) (string, error) {
+	data, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(data), nil
+}
@@ -0,0 +1,154 @@
+package signing
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestBundleRoundTrip(t *testing.T) {
+	now := time.Now()
+	caKey, _ := NewEphemeralSigner()
+	ca := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caPEM := certificatePEM(t, ca, ca, &caKey.PublicKey, caKey)
+
+	signer, _ := NewEphemeralSigner()
+	leaf := &x509.Certificate{
+		SerialNumber:   big.NewInt(2),
+		NotBefore:      now.Add(-time.Minute),
+		NotAfter:       now.Add(10 * time.Minute),
+		KeyUsage:       x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:    []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+		EmailAddresses: []string{"ci@example.com"},
+	}
+	leafPEM := certificatePEM(t, leaf, ca, &signer.PublicKey, caKey)
+
+	env, err := SignEnvelope(signer, InTotoPayloadType, []byte(`{"_type":"https://in-toto.io/Statement/v1"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	logKey, _ := NewEphemeralSigner()
+	entry := logEntry(t, env, logKey, 2, 5)
+	entry.Verification.InclusionProof.Checkpoint = "rekor.sigstore.dev - 1\n5\nroot\n"
+
+	tests := []struct {
+		name string
+		sa   *SignedAttestation
+		// want is the attestation read back: bundles only hold the leaf certificate
+		want *SignedAttestation
+	}{
+		{
+			name: "certified key with log entry",
+			sa:   &SignedAttestation{Envelope: env, Certificates: []string{leafPEM, caPEM}, TlogEntry: entry},
+			want: &SignedAttestation{Envelope: env, Certificates: []string{leafPEM}, TlogEntry: entry},
+		},
+		{
+			name: "key of its own",
+			sa:   &SignedAttestation{Envelope: env},
+			want: &SignedAttestation{Envelope: env, Certificates: []string{}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := json.Marshal(tt.sa)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !IsBundle(data) {
+				t.Fatalf("expected a sigstore bundle, got %s", data)
+			}
+
+			got := &SignedAttestation{}
+			if err := json.Unmarshal(data, got); err != nil {
+				t.Fatal(err)
+			}
+			if got.TlogEntry != nil {
+				// the UUID is restored from the leaf hash, the tree ID is lost
+				if len(got.TlogEntry.UUID) != 64 {
+					t.Errorf("UUID = %q, want the leaf hash", got.TlogEntry.UUID)
+				}
+				got.TlogEntry.UUID = tt.want.TlogEntry.UUID
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	// bundles verify like the attestations they were written from
+	data, _ := json.Marshal(tests[0].sa)
+	sa := &SignedAttestation{}
+	if err := json.Unmarshal(data, sa); err != nil {
+		t.Fatal(err)
+	}
+	logPEM, _ := PublicKeyPEM(logKey)
+	logID, _ := LogID(logPEM)
+	root := &TrustRoot{
+		Created:                now,
+		Expires:                now.Add(24 * time.Hour),
+		CertificateAuthorities: []CertificateAuthority{{Certificates: []string{caPEM}}},
+		TransparencyLogs:       []TransparencyLog{{LogID: logID, PublicKey: string(logPEM)}},
+	}
+	if _, identity, err := root.Verify(sa.Envelope, sa.Certificates, sa.TlogEntry); err != nil || identity != "ci@example.com" {
+		t.Errorf("Verify() = %q, %v", identity, err)
+	}
+}
+
+func TestReadSignedAttestation(t *testing.T) {
+	signer, _ := NewEphemeralSigner()
+	cert := &x509.Certificate{SerialNumber: big.NewInt(1), NotBefore: time.Now(), NotAfter: time.Now().Add(time.Hour)}
+	certPEM := certificatePEM(t, cert, cert, &signer.PublicKey, signer)
+	block, _ := pem.Decode([]byte(certPEM))
+	rawCert := base64.StdEncoding.EncodeToString(block.Bytes)
+	env, _ := SignEnvelope(signer, InTotoPayloadType, []byte(`{}`))
+	envJSON, _ := json.Marshal(env)
+
+	tests := []struct {
+		name    string
+		data    string
+		certs   int
+		wantErr bool
+	}{
+		{name: "legacy format", data: `{"dsseEnvelope":` + string(envJSON) + `,"certificates":[` + string(mustJSON(certPEM)) + `]}`, certs: 1},
+		{name: "bundle v0.1 with certificate chain", data: `{"mediaType":"application/vnd.dev.sigstore.bundle+json;version=0.1","verificationMaterial":{"x509CertificateChain":{"certificates":[{"rawBytes":"` + rawCert + `"},{"rawBytes":"` + rawCert + `"}]},"tlogEntries":[]},"dsseEnvelope":` + string(envJSON) + `}`, certs: 2},
+		{name: "bundle v0.3", data: `{"mediaType":"application/vnd.dev.sigstore.bundle.v0.3+json","verificationMaterial":{"certificate":{"rawBytes":"` + rawCert + `"}},"dsseEnvelope":` + string(envJSON) + `}`, certs: 1},
+		{name: "message signature bundle", data: `{"mediaType":"application/vnd.dev.sigstore.bundle.v0.3+json","verificationMaterial":{"certificate":{"rawBytes":"` + rawCert + `"}},"messageSignature":{}}`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sa := &SignedAttestation{}
+			err := json.Unmarshal([]byte(tt.data), sa)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Unmarshal() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if len(sa.Certificates) != tt.certs || sa.Certificates[0] != certPEM {
+				t.Errorf("got certificates %q", sa.Certificates)
+			}
+			if _, err := VerifyEnvelope(&signer.PublicKey, sa.Envelope); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func mustJSON(v interface{}) []byte {
+	data, _ := json.Marshal(v)
+	return data
+}
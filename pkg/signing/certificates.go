@@ -0,0 +1,86 @@
+package signing
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/pem"
+	"fmt"
+	"strings"
+)
+
+var (
+	// oidIssuer is the deprecated Fulcio extension holding the OIDC issuer as raw bytes
+	oidIssuer = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 57264, 1, 1}
+	// oidIssuerV2 holds the OIDC issuer as a DER encoded UTF8String
+	oidIssuerV2 = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 57264, 1, 8}
+)
+
+// Identity is the identity a keyless signature is expected from: a subject alternative name of the certificate,
+// such as the workflow URI of a CI job or an email, and the OIDC issuer of the token it was issued for
+type Identity struct {
+	Subject string
+	Issuer  string
+}
+
+// ParseCertificate parses a PEM encoded certificate
+func ParseCertificate(data string) (*x509.Certificate, error) {
+	block, _ := pem.Decode([]byte(data))
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, fmt.Errorf("certificate is not PEM encoded")
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
+// CertificateIdentity returns the identities a Fulcio certificate was issued for, such as the workflow URI of a CI job
+func CertificateIdentity(cert *x509.Certificate) string {
+	ids := make([]string, 0, len(cert.URIs)+len(cert.EmailAddresses))
+	for _, u := range cert.URIs {
+		ids = append(ids, u.String())
+	}
+	ids = append(ids, cert.EmailAddresses...)
+	return strings.Join(ids, ", ")
+}
+
+// CertificateIssuer returns the OIDC issuer of the token a Fulcio certificate was issued for
+func CertificateIssuer(cert *x509.Certificate) string {
+	issuer := ""
+	for _, ext := range cert.Extensions {
+		switch {
+		case ext.Id.Equal(oidIssuerV2):
+			var s string
+			if _, err := asn1.UnmarshalWithParams(ext.Value, &s, "utf8"); err == nil {
+				return s
+			}
+		case ext.Id.Equal(oidIssuer):
+			issuer = string(ext.Value)
+		}
+	}
+	return issuer
+}
+
+// CheckIdentity returns an error unless the PEM encoded certificate was issued for the expected identity.
+// Both the subject and the issuer must be set, a certificate of any identity proves nothing about who signed.
+func CheckIdentity(certificate string, want Identity) error {
+	if want.Subject == "" || want.Issuer == "" {
+		return fmt.Errorf("the expected identity and OIDC issuer of the signer are required to verify a keyless signature")
+	}
+	cert, err := ParseCertificate(certificate)
+	if err != nil {
+		return err
+	}
+
+	if issuer := CertificateIssuer(cert); issuer != want.Issuer {
+		return fmt.Errorf("certificate was issued by %q, expected %q", issuer, want.Issuer)
+	}
+	for _, u := range cert.URIs {
+		if u.String() == want.Subject {
+			return nil
+		}
+	}
+	for _, e := range cert.EmailAddresses {
+		if e == want.Subject {
+			return nil
+		}
+	}
+	return fmt.Errorf("certificate was issued for %q, expected %q", CertificateIdentity(cert), want.Subject)
+}
@@ -0,0 +1,75 @@
+package signing
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+)
+
+// InTotoPayloadType is the DSSE payload type of in-toto statements
+const InTotoPayloadType = "application/vnd.in-toto+json"
+
+// Envelope is a DSSE envelope
+type Envelope struct {
+	PayloadType string      `json:"payloadType"`
+	Payload     string      `json:"payload"`
+	Signatures  []Signature `json:"signatures"`
+}
+
+// Signature is a signature of a DSSE envelope
+type Signature struct {
+	KeyID string `json:"keyid"`
+	Sig   string `json:"sig"`
+}
+
+// PAE returns the DSSE pre-authentication encoding of the payload
+func PAE(payloadType string, payload []byte) []byte {
+	return []byte(fmt.Sprintf("DSSEv1 %d %s %d %s", len(payloadType), payloadType, len(payload), payload))
+}
+
+// SignEnvelope wraps the payload in a DSSE envelope signed by signer, the signature names the key by its KeyID
+func SignEnvelope(signer crypto.Signer, payloadType string, payload []byte) (*Envelope, error) {
+	keyID, err := KeyID(signer)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := signSHA256(signer, PAE(payloadType, payload))
+	if err != nil {
+		return nil, err
+	}
+
+	return &Envelope{
+		PayloadType: payloadType,
+		Payload:     base64.StdEncoding.EncodeToString(payload),
+		Signatures: []Signature{
+			{KeyID: keyID, Sig: base64.StdEncoding.EncodeToString(sig)},
+		},
+	}, nil
+}
+
+// VerifyEnvelope checks that a signature of the envelope was made by the ECDSA key and returns the payload
+func VerifyEnvelope(pub crypto.PublicKey, env *Envelope) ([]byte, error) {
+	key, ok := pub.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("unsupported public key type %T", pub)
+	}
+
+	payload, err := base64.StdEncoding.DecodeString(env.Payload)
+	if err != nil {
+		return nil, fmt.Errorf("invalid envelope payload: %v", err)
+	}
+	digest := sha256.Sum256(PAE(env.PayloadType, payload))
+
+	for _, s := range env.Signatures {
+		sig, err := base64.StdEncoding.DecodeString(s.Sig)
+		if err != nil {
+			continue
+		}
+		if ecdsa.VerifyASN1(key, digest[:], sig) {
+			return payload, nil
+		}
+	}
+	return nil, fmt.Errorf("no signature of the envelope matches the key")
+}
@@ -0,0 +1,97 @@
+package signing
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// DefaultFulcioURL is the public good Sigstore certificate authority
+const DefaultFulcioURL = "https://fulcio.sigstore.dev"
+
+type fulcioRequest struct {
+	Credentials struct {
+		OIDCIdentityToken string `json:"oidcIdentityToken"`
+	} `json:"credentials"`
+	PublicKeyRequest struct {
+		PublicKey struct {
+			Algorithm string `json:"algorithm"`
+			Content   string `json:"content"`
+		} `json:"publicKey"`
+		ProofOfPossession string `json:"proofOfPossession"`
+	} `json:"publicKeyRequest"`
+}
+
+type fulcioChain struct {
+	Chain struct {
+		Certificates []string `json:"certificates"`
+	} `json:"chain"`
+}
+
+type fulcioResponse struct {
+	SignedCertificateEmbeddedSct *fulcioChain `json:"signedCertificateEmbeddedSct"`
+	SignedCertificateDetachedSct *fulcioChain `json:"signedCertificateDetachedSct"`
+}
+
+// RequestCertificate exchanges the OIDC token for a short lived code signing certificate binding the signer's key to the
+// token's identity. subject is the sub claim of the token, signed to prove possession of the key.
+func RequestCertificate(ctx context.Context, fulcioURL string, signer crypto.Signer, token, subject string) ([]string, error) {
+	pub, err := PublicKeyPEM(signer)
+	if err != nil {
+		return nil, err
+	}
+	proof, err := signSHA256(signer, []byte(subject))
+	if err != nil {
+		return nil, err
+	}
+
+	reqBody := fulcioRequest{}
+	reqBody.Credentials.OIDCIdentityToken = token
+	reqBody.PublicKeyRequest.PublicKey.Algorithm = "ECDSA"
+	reqBody.PublicKeyRequest.PublicKey.Content = string(pub)
+	reqBody.PublicKeyRequest.ProofOfPossession = base64.StdEncoding.EncodeToString(proof)
+
+	body, err := json.Marshal(reqBody)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(fulcioURL, "/")+"/api/v2/signingCert", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("fulcio returned %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+
+	fr := &fulcioResponse{}
+	err = json.NewDecoder(resp.Body).Decode(fr)
+	if err != nil {
+		return nil, err
+	}
+
+	chain := fr.SignedCertificateEmbeddedSct
+	if chain == nil {
+		chain = fr.SignedCertificateDetachedSct
+	}
+	if chain == nil || len(chain.Chain.Certificates) == 0 {
+		return nil, fmt.Errorf("fulcio returned no certificate")
+	}
+	return chain.Chain.Certificates, nil
+}
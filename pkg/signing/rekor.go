@@ -0,0 +1,259 @@
+package signing
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// DefaultRekorURL is the public good Sigstore transparency log
+const DefaultRekorURL = "https://rekor.sigstore.dev"
+
+// LogEntry is an entry of the Rekor transparency log, with the proofs needed to verify it offline
+type LogEntry struct {
+	UUID           string `json:"uuid"`
+	Body           string `json:"body"`
+	IntegratedTime int64  `json:"integratedTime"`
+	LogID          string `json:"logID"`
+	LogIndex       int64  `json:"logIndex"`
+	Verification   struct {
+		SignedEntryTimestamp string          `json:"signedEntryTimestamp"`
+		InclusionProof       *InclusionProof `json:"inclusionProof,omitempty"`
+	} `json:"verification"`
+}
+
+// InclusionProof proves that an entry is in the Merkle tree of the log with the root hash
+type InclusionProof struct {
+	LogIndex   int64    `json:"logIndex"`
+	RootHash   string   `json:"rootHash"`
+	TreeSize   int64    `json:"treeSize"`
+	Hashes     []string `json:"hashes"`
+	Checkpoint string   `json:"checkpoint,omitempty"`
+}
+
+// UploadEntry records the DSSE envelope in the transparency log. verifier is the PEM encoded certificate or public key
+// of the signer.
+func UploadEntry(ctx context.Context, rekorURL string, env *Envelope, verifier string) (*LogEntry, error) {
+	envelope, err := json.Marshal(env)
+	if err != nil {
+		return nil, err
+	}
+	reqBody := map[string]interface{}{
+		"apiVersion": "0.0.1",
+		"kind":       "dsse",
+		"spec": map[string]interface{}{
+			"proposedContent": map[string]interface{}{
+				"envelope":  string(envelope),
+				"verifiers": []string{base64.StdEncoding.EncodeToString([]byte(verifier))},
+			},
+		},
+	}
+	body, err := json.Marshal(reqBody)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(rekorURL, "/")+"/api/v1/log/entries", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	return doLogRequest(req)
+}
+
+// FetchEntry returns the entry of the transparency log with its current inclusion proof
+func FetchEntry(ctx context.Context, rekorURL, uuid string) (*LogEntry, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(rekorURL, "/")+"/api/v1/log/entries/"+uuid, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	return doLogRequest(req)
+}
+
+// doLogRequest sends a request returning log entries by UUID and returns the first one
+func doLogRequest(req *http.Request) (*LogEntry, error) {
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("rekor returned %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+
+	entries := map[string]*LogEntry{}
+	if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
+		return nil, err
+	}
+	for uuid, e := range entries {
+		e.UUID = uuid
+		return e, nil
+	}
+	return nil, fmt.Errorf("rekor returned no entry")
+}
+
+// RecordAttestations records every signed attestation of the JSON lines in the transparency log and returns them with their log entries
+func RecordAttestations(ctx context.Context, rekorURL string, signed []byte) ([]byte, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(signed))
+	scanner.Buffer(make([]byte, 0, 1024*1024), 64*1024*1024)
+
+	var out bytes.Buffer
+	enc := json.NewEncoder(&out)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		sa := &SignedAttestation{}
+		if err := json.Unmarshal(line, sa); err != nil {
+			return nil, err
+		}
+		if len(sa.Certificates) == 0 {
+			return nil, fmt.Errorf("only attestations signed with a certified key can be recorded in the transparency log")
+		}
+
+		entry, err := UploadEntry(ctx, rekorURL, sa.Envelope, sa.Certificates[0])
+		if err != nil {
+			return nil, err
+		}
+		sa.TlogEntry = entry
+		if err := enc.Encode(sa); err != nil {
+			return nil, err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// VerifyEntryTimestamp checks the signed entry timestamp, the promise of the log that the entry was integrated at IntegratedTime
+func VerifyEntryTimestamp(e *LogEntry, logKey crypto.PublicKey) error {
+	key, ok := logKey.(*ecdsa.PublicKey)
+	if !ok {
+		return fmt.Errorf("unsupported log key type %T", logKey)
+	}
+	sig, err := base64.StdEncoding.DecodeString(e.Verification.SignedEntryTimestamp)
+	if err != nil {
+		return fmt.Errorf("invalid signed entry timestamp: %v", err)
+	}
+
+	// the fields are in the order of canonical JSON
+	payload, err := json.Marshal(struct {
+		Body           string `json:"body"`
+		IntegratedTime int64  `json:"integratedTime"`
+		LogID          string `json:"logID"`
+		LogIndex       int64  `json:"logIndex"`
+	}{e.Body, e.IntegratedTime, e.LogID, e.LogIndex})
+	if err != nil {
+		return err
+	}
+	digest := sha256.Sum256(payload)
+	if !ecdsa.VerifyASN1(key, digest[:], sig) {
+		return fmt.Errorf("signed entry timestamp of log entry %d does not verify", e.LogIndex)
+	}
+	return nil
+}
+
+// VerifyInclusion checks the inclusion proof of the entry, the Merkle audit path of RFC 9162 from its leaf to the root hash
+func VerifyInclusion(e *LogEntry) error {
+	p := e.Verification.InclusionProof
+	if p == nil {
+		return fmt.Errorf("log entry %d has no inclusion proof", e.LogIndex)
+	}
+	body, err := base64.StdEncoding.DecodeString(e.Body)
+	if err != nil {
+		return fmt.Errorf("invalid log entry body: %v", err)
+	}
+	root, err := hex.DecodeString(p.RootHash)
+	if err != nil {
+		return fmt.Errorf("invalid root hash: %v", err)
+	}
+	if p.LogIndex < 0 || p.LogIndex >= p.TreeSize {
+		return fmt.Errorf("log index %d is not in a tree of size %d", p.LogIndex, p.TreeSize)
+	}
+
+	leaf := sha256.Sum256(append([]byte{0x00}, body...))
+	r := leaf[:]
+	fn, sn := p.LogIndex, p.TreeSize-1
+	for _, h := range p.Hashes {
+		sibling, err := hex.DecodeString(h)
+		if err != nil {
+			return fmt.Errorf("invalid inclusion proof hash: %v", err)
+		}
+		if sn == 0 {
+			return fmt.Errorf("inclusion proof of log entry %d is too long", e.LogIndex)
+		}
+		if fn&1 == 1 || fn == sn {
+			r = hashChildren(sibling, r)
+			for fn&1 == 0 && fn != 0 {
+				fn >>= 1
+				sn >>= 1
+			}
+		} else {
+			r = hashChildren(r, sibling)
+		}
+		fn >>= 1
+		sn >>= 1
+	}
+
+	if sn != 0 || !bytes.Equal(r, root) {
+		return fmt.Errorf("inclusion proof of log entry %d does not lead to root %s", e.LogIndex, p.RootHash)
+	}
+	return nil
+}
+
+func hashChildren(left, right []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{0x01})
+	h.Write(left)
+	h.Write(right)
+	return h.Sum(nil)
+}
+
+// VerifyEntryContent checks that the entry records the envelope, the log stores the hash of its payload
+func VerifyEntryContent(e *LogEntry, env *Envelope) error {
+	body, err := base64.StdEncoding.DecodeString(e.Body)
+	if err != nil {
+		return fmt.Errorf("invalid log entry body: %v", err)
+	}
+	entry := struct {
+		Kind string `json:"kind"`
+		Spec struct {
+			PayloadHash struct {
+				Algorithm string `json:"algorithm"`
+				Value     string `json:"value"`
+			} `json:"payloadHash"`
+		} `json:"spec"`
+	}{}
+	if err := json.Unmarshal(body, &entry); err != nil {
+		return fmt.Errorf("invalid log entry body: %v", err)
+	}
+	if entry.Kind != "dsse" || entry.Spec.PayloadHash.Algorithm != "sha256" {
+		return fmt.Errorf("log entry %d is not a DSSE entry", e.LogIndex)
+	}
+
+	payload, err := base64.StdEncoding.DecodeString(env.Payload)
+	if err != nil {
+		return fmt.Errorf("invalid envelope payload: %v", err)
+	}
+	sum := sha256.Sum256(payload)
+	if hex.EncodeToString(sum[:]) != entry.Spec.PayloadHash.Value {
+		return fmt.Errorf("log entry %d records another payload", e.LogIndex)
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package signing
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func TestSignAttestations(t *testing.T) {
+	signer, err := NewEphemeralSigner()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert := &x509.Certificate{SerialNumber: big.NewInt(1), NotBefore: time.Now(), NotAfter: time.Now().Add(time.Hour)}
+	certPEM := certificatePEM(t, cert, cert, &signer.PublicKey, signer)
+
+	attestations := []byte("{\"_type\":\"https://in-toto.io/Statement/v1\"}\n{\"_type\":\"https://in-toto.io/Statement/v1\",\"predicateType\":\"x\"}\n")
+
+	var buf bytes.Buffer
+	if err := SignAttestations(&buf, attestations, signer, []string{certPEM}); err != nil {
+		t.Fatal(err)
+	}
+
+	keyID, err := KeyID(signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+	if len(lines) != 2 {
+		t.Fatalf("got %d signed attestations, want 2", len(lines))
+	}
+
+	for _, line := range lines {
+		sa := &SignedAttestation{}
+		if err := json.Unmarshal(line, sa); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(sa.Certificates) != 1 || sa.Certificates[0] != certPEM {
+			t.Errorf("got certificates %q, want the certificate of the signing key", sa.Certificates)
+		}
+
+		if sa.Envelope.Signatures[0].KeyID != keyID {
+			t.Errorf("got key ID %q, want %q", sa.Envelope.Signatures[0].KeyID, keyID)
+		}
+
+		payload, err := base64.StdEncoding.DecodeString(sa.Envelope.Payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sig, err := base64.StdEncoding.DecodeString(sa.Envelope.Signatures[0].Sig)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		digest := sha256.Sum256(PAE(sa.Envelope.PayloadType, payload))
+		if !ecdsa.VerifyASN1(&signer.PublicKey, digest[:], sig) {
+			t.Errorf("signature does not verify")
+		}
+	}
+}
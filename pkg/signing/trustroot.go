@@ -0,0 +1,223 @@
+package signing
+
+import (
+	"context"
+	"crypto"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// TrustRoot is the material needed to verify keyless signatures without network access: the certificate authorities
+// issuing signing certificates and the keys of the transparency logs. It expires so that revoked or rotated keys
+// are not trusted forever by disconnected verifiers.
+type TrustRoot struct {
+	Created                time.Time              `json:"created"`
+	Expires                time.Time              `json:"expires"`
+	CertificateAuthorities []CertificateAuthority `json:"certificateAuthorities"`
+	TransparencyLogs       []TransparencyLog      `json:"transparencyLogs"`
+}
+
+// CertificateAuthority is a certificate authority, such as Fulcio, with its certificate chain, root last
+type CertificateAuthority struct {
+	URL          string   `json:"url"`
+	Certificates []string `json:"certificates"`
+	Validity
+}
+
+// TransparencyLog is a transparency log, such as Rekor, with its PEM encoded public key
+type TransparencyLog struct {
+	URL       string `json:"url"`
+	LogID     string `json:"logID"`
+	PublicKey string `json:"publicKey"`
+	Validity
+}
+
+// Validity is the period a key is trusted for, signatures made outside of it are rejected. The zero time is unbounded.
+type Validity struct {
+	ValidFrom  time.Time `json:"validFrom,omitempty"`
+	ValidUntil time.Time `json:"validUntil,omitempty"`
+}
+
+// Contains reports if t is in the validity period
+func (v Validity) Contains(t time.Time) bool {
+	return (v.ValidFrom.IsZero() || !t.Before(v.ValidFrom)) && (v.ValidUntil.IsZero() || !t.After(v.ValidUntil))
+}
+
+// FetchTrustRoot fetches the certificate chain of the certificate authority and the key of the transparency log.
+// The trust root expires after ttl, verifiers need a fresh one then.
+func FetchTrustRoot(ctx context.Context, fulcioURL, rekorURL string, ttl time.Duration) (*TrustRoot, error) {
+	chain, err := fetchText(ctx, strings.TrimSuffix(fulcioURL, "/")+"/api/v1/rootCert")
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch the certificate authority chain: %v", err)
+	}
+	certs := splitPEM(chain)
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("%s returned no certificate", fulcioURL)
+	}
+
+	key, err := fetchText(ctx, strings.TrimSuffix(rekorURL, "/")+"/api/v1/log/publicKey")
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch the transparency log key: %v", err)
+	}
+	logID, err := LogID([]byte(key))
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	return &TrustRoot{
+		Created:                now,
+		Expires:                now.Add(ttl),
+		CertificateAuthorities: []CertificateAuthority{{URL: fulcioURL, Certificates: certs}},
+		TransparencyLogs:       []TransparencyLog{{URL: rekorURL, LogID: logID, PublicKey: key}},
+	}, nil
+}
+
+// LogID returns the ID of a transparency log, the hex SHA-256 of its DER encoded public key
+func LogID(publicKeyPEM []byte) (string, error) {
+	block, _ := pem.Decode(publicKeyPEM)
+	if block == nil {
+		return "", fmt.Errorf("log public key is not PEM encoded")
+	}
+	sum := sha256.Sum256(block.Bytes)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Check returns an error when the trust root expired at now
+func (t *TrustRoot) Check(now time.Time) error {
+	if !t.Expires.IsZero() && now.After(t.Expires) {
+		return fmt.Errorf("trust root expired on %s, fetch a new one on a connected machine", t.Expires.Format(time.DateOnly))
+	}
+	return nil
+}
+
+// ExpiresWithin reports if the trust root expires within d of now
+func (t *TrustRoot) ExpiresWithin(now time.Time, d time.Duration) bool {
+	return !t.Expires.IsZero() && now.Add(d).After(t.Expires)
+}
+
+// logKey returns the key of the log that was valid when the entry was integrated
+func (t *TrustRoot) logKey(logID string, at time.Time) (crypto.PublicKey, error) {
+	for _, l := range t.TransparencyLogs {
+		if l.LogID != logID {
+			continue
+		}
+		if !l.Contains(at) {
+			return nil, fmt.Errorf("key of transparency log %s was not valid on %s", l.URL, at.Format(time.RFC3339))
+		}
+		return ParsePublicKeyPEM([]byte(l.PublicKey))
+	}
+	return nil, fmt.Errorf("transparency log %s is not in the trust root", logID)
+}
+
+// Verify checks a keyless signature offline: the entry of the transparency log is signed by a trusted log and included
+// in its tree, the certificate chains to a trusted authority at the time the entry was integrated, and the envelope is
+// signed by the certified key. It returns the payload and the identity the certificate was issued for.
+func (t *TrustRoot) Verify(env *Envelope, certificates []string, entry *LogEntry) ([]byte, string, error) {
+	if len(certificates) == 0 {
+		return nil, "", fmt.Errorf("the signature has no certificate")
+	}
+	if entry == nil {
+		return nil, "", fmt.Errorf("the signature was not recorded in the transparency log, its short lived certificate can't be checked")
+	}
+
+	integrated := time.Unix(entry.IntegratedTime, 0)
+	logKey, err := t.logKey(entry.LogID, integrated)
+	if err != nil {
+		return nil, "", err
+	}
+	if err := VerifyEntryTimestamp(entry, logKey); err != nil {
+		return nil, "", err
+	}
+	if err := VerifyInclusion(entry); err != nil {
+		return nil, "", err
+	}
+	if err := VerifyEntryContent(entry, env); err != nil {
+		return nil, "", err
+	}
+
+	leaf, err := ParseCertificate(certificates[0])
+	if err != nil {
+		return nil, "", err
+	}
+	intermediates := x509.NewCertPool()
+	for _, c := range certificates[1:] {
+		cert, err := ParseCertificate(c)
+		if err != nil {
+			return nil, "", err
+		}
+		intermediates.AddCert(cert)
+	}
+	roots := x509.NewCertPool()
+	for _, ca := range t.CertificateAuthorities {
+		if !ca.Contains(integrated) {
+			continue
+		}
+		for _, c := range ca.Certificates {
+			cert, err := ParseCertificate(c)
+			if err != nil {
+				return nil, "", err
+			}
+			roots.AddCert(cert)
+		}
+	}
+
+	// the certificate must have been valid when the log integrated the signature
+	_, err = leaf.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		CurrentTime:   integrated,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+	})
+	if err != nil {
+		return nil, "", fmt.Errorf("certificate does not chain to the trust root: %v", err)
+	}
+
+	payload, err := VerifyEnvelope(leaf.PublicKey, env)
+	if err != nil {
+		return nil, "", err
+	}
+	return payload, CertificateIdentity(leaf), nil
+}
+
+func fetchText(ctx context.Context, url string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1024*1024))
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%s returned %s", url, resp.Status)
+	}
+	return string(body), nil
+}
+
+// splitPEM splits concatenated PEM blocks
+func splitPEM(data string) []string {
+	blocks := make([]string, 0)
+	rest := []byte(data)
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			return blocks
+		}
+		blocks = append(blocks, string(pem.EncodeToMemory(block)))
+	}
+}
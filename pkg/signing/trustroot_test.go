@@ -0,0 +1,218 @@
+package signing
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// merkleRoot and merklePath compute the tree hash and audit path of RFC 9162 over leaf hashes
+func merkleRoot(leaves [][]byte) []byte {
+	if len(leaves) == 1 {
+		return leaves[0]
+	}
+	k := splitPoint(len(leaves))
+	return hashChildren(merkleRoot(leaves[:k]), merkleRoot(leaves[k:]))
+}
+
+func merklePath(m int, leaves [][]byte) []string {
+	if len(leaves) == 1 {
+		return nil
+	}
+	k := splitPoint(len(leaves))
+	if m < k {
+		return append(merklePath(m, leaves[:k]), hex.EncodeToString(merkleRoot(leaves[k:])))
+	}
+	return append(merklePath(m-k, leaves[k:]), hex.EncodeToString(merkleRoot(leaves[:k])))
+}
+
+func splitPoint(n int) int {
+	k := 1
+	for k*2 < n {
+		k *= 2
+	}
+	return k
+}
+
+func certificatePEM(t *testing.T, tmpl, parent *x509.Certificate, pub interface{}, priv interface{}) string {
+	t.Helper()
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, pub, priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+}
+
+// logEntry records the envelope as the entry at index of a log of size entries, signed by logKey
+func logEntry(t *testing.T, env *Envelope, logKey *ecdsa.PrivateKey, index, size int) *LogEntry {
+	t.Helper()
+	payload, _ := base64.StdEncoding.DecodeString(env.Payload)
+	sum := sha256.Sum256(payload)
+	body, _ := json.Marshal(map[string]interface{}{
+		"apiVersion": "0.0.1",
+		"kind":       "dsse",
+		"spec":       map[string]interface{}{"payloadHash": map[string]string{"algorithm": "sha256", "value": hex.EncodeToString(sum[:])}},
+	})
+
+	leaves := make([][]byte, size)
+	for i := range leaves {
+		data := []byte(fmt.Sprintf("entry %d", i))
+		if i == index {
+			data = body
+		}
+		h := sha256.Sum256(append([]byte{0x00}, data...))
+		leaves[i] = h[:]
+	}
+
+	der, _ := x509.MarshalPKIXPublicKey(&logKey.PublicKey)
+	logID := sha256.Sum256(der)
+	e := &LogEntry{
+		Body:           base64.StdEncoding.EncodeToString(body),
+		IntegratedTime: time.Now().Unix(),
+		LogID:          hex.EncodeToString(logID[:]),
+		LogIndex:       int64(index),
+	}
+	e.Verification.InclusionProof = &InclusionProof{
+		LogIndex: int64(index),
+		RootHash: hex.EncodeToString(merkleRoot(leaves)),
+		TreeSize: int64(size),
+		Hashes:   merklePath(index, leaves),
+	}
+
+	set, _ := json.Marshal(struct {
+		Body           string `json:"body"`
+		IntegratedTime int64  `json:"integratedTime"`
+		LogID          string `json:"logID"`
+		LogIndex       int64  `json:"logIndex"`
+	}{e.Body, e.IntegratedTime, e.LogID, e.LogIndex})
+	digest := sha256.Sum256(set)
+	sig, err := ecdsa.SignASN1(rand.Reader, logKey, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.Verification.SignedEntryTimestamp = base64.StdEncoding.EncodeToString(sig)
+	return e
+}
+
+func TestVerifyInclusion(t *testing.T) {
+	logKey, _ := NewEphemeralSigner()
+	env := &Envelope{PayloadType: InTotoPayloadType, Payload: base64.StdEncoding.EncodeToString([]byte("{}"))}
+
+	for size := 1; size <= 9; size++ {
+		for index := 0; index < size; index++ {
+			e := logEntry(t, env, logKey, index, size)
+			if err := VerifyInclusion(e); err != nil {
+				t.Errorf("entry %d of %d: %v", index, size, err)
+			}
+		}
+	}
+
+	e := logEntry(t, env, logKey, 3, 7)
+	e.Verification.InclusionProof.LogIndex = 4
+	if err := VerifyInclusion(e); err == nil {
+		t.Errorf("expected a proof for another index to fail")
+	}
+}
+
+func TestTrustRootVerify(t *testing.T) {
+	now := time.Now()
+	caKey, _ := NewEphemeralSigner()
+	ca := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caPEM := certificatePEM(t, ca, ca, &caKey.PublicKey, caKey)
+
+	signer, _ := NewEphemeralSigner()
+	issuerDER, _ := asn1.MarshalWithParams("https://token.actions.githubusercontent.com", "utf8")
+	workflow, _ := url.Parse("https://github.com/acme/app/.github/workflows/build.yml@refs/heads/main")
+	leaf := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		NotBefore:    now.Add(-time.Minute),
+		NotAfter:     now.Add(10 * time.Minute),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+		URIs:         []*url.URL{workflow},
+		ExtraExtensions: []pkix.Extension{
+			{Id: oidIssuerV2, Value: issuerDER},
+		},
+	}
+	leafPEM := certificatePEM(t, leaf, ca, &signer.PublicKey, caKey)
+
+	env, err := SignEnvelope(signer, InTotoPayloadType, []byte(`{"_type":"https://in-toto.io/Statement/v1"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	logKey, _ := NewEphemeralSigner()
+	logPEM, _ := PublicKeyPEM(logKey)
+	logID, _ := LogID(logPEM)
+	entry := logEntry(t, env, logKey, 5, 12)
+
+	root := &TrustRoot{
+		Created:                now,
+		Expires:                now.Add(24 * time.Hour),
+		CertificateAuthorities: []CertificateAuthority{{Certificates: []string{caPEM}}},
+		TransparencyLogs:       []TransparencyLog{{LogID: logID, PublicKey: string(logPEM)}},
+	}
+
+	_, identity, err := root.Verify(env, []string{leafPEM, caPEM}, entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if identity != workflow.String() {
+		t.Errorf("identity = %q", identity)
+	}
+
+	if err := CheckIdentity(leafPEM, Identity{Subject: workflow.String(), Issuer: "https://token.actions.githubusercontent.com"}); err != nil {
+		t.Errorf("expected the identity to match: %v", err)
+	}
+	for _, want := range []Identity{
+		{Subject: "https://github.com/evil/app/.github/workflows/build.yml@refs/heads/main", Issuer: "https://token.actions.githubusercontent.com"},
+		{Subject: workflow.String(), Issuer: "https://accounts.google.com"},
+		{Subject: workflow.String()},
+	} {
+		if err := CheckIdentity(leafPEM, want); err == nil {
+			t.Errorf("expected identity %+v to be rejected", want)
+		}
+	}
+
+	// a log key rotated before the entry was integrated is not trusted for it
+	root.TransparencyLogs[0].ValidUntil = now.Add(-time.Hour)
+	if _, _, err := root.Verify(env, []string{leafPEM, caPEM}, entry); err == nil {
+		t.Errorf("expected the rotated log key to be rejected")
+	}
+	root.TransparencyLogs[0].ValidUntil = time.Time{}
+
+	// the entry must record this envelope
+	other, _ := SignEnvelope(signer, InTotoPayloadType, []byte(`{"_type":"other"}`))
+	if _, _, err := root.Verify(other, []string{leafPEM, caPEM}, entry); err == nil {
+		t.Errorf("expected an envelope the entry does not record to be rejected")
+	}
+	if _, _, err := root.Verify(env, []string{leafPEM, caPEM}, nil); err == nil {
+		t.Errorf("expected a signature without log entry to be rejected")
+	}
+
+	if err := root.Check(now.Add(48 * time.Hour)); err == nil {
+		t.Errorf("expected the trust root to be expired")
+	}
+	if !root.ExpiresWithin(now, 7*24*time.Hour) || root.ExpiresWithin(now, time.Hour) {
+		t.Errorf("unexpected expiry window")
+	}
+}
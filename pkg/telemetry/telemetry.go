@@ -0,0 +1,254 @@
+// Package telemetry records anonymous statistics about bsf runs, such as closure sizes, phase durations and the flags
+// used, for users who opted in. Events never contain names, paths or hashes. They are queued locally, where
+// bsf telemetry preview shows them exactly as they will be sent, and sent in batches.
+package telemetry
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/buildsafedev/bsf/pkg/timing"
+)
+
+const (
+	// DefaultEndpoint receives the events when the configuration doesn't name another one
+	DefaultEndpoint = "https://api.buildsafe.dev/telemetry/v1/events"
+	// SchemaVersion is the version of the event format
+	SchemaVersion = 1
+	// BatchSize is the number of queued events that triggers sending them
+	BatchSize = 20
+	// maxQueued bounds the queue when the endpoint can't be reached
+	maxQueued = 200
+)
+
+// Event is the statistics of one bsf run
+type Event struct {
+	SchemaVersion int    `json:"schemaVersion"`
+	Command       string `json:"command"`
+	BSFVersion    string `json:"bsfVersion"`
+	OS            string `json:"os"`
+	Arch          string `json:"arch"`
+	CI            bool   `json:"ci"`
+	// Features are the names of the flags set, never their values
+	Features []string `json:"features,omitempty"`
+	// DurationsMs are the durations of the phases of the run in milliseconds
+	DurationsMs map[string]int64 `json:"durationsMs"`
+	// ClosureSize is the number of components in the runtime closure of the app
+	ClosureSize int `json:"closureSize,omitempty"`
+	// Day is the date of the run, the time of day is not recorded
+	Day string `json:"day"`
+}
+
+// Disabled reports if telemetry is disabled by the environment, regardless of the configuration.
+// DO_NOT_TRACK is the convention shared across developer tools.
+func Disabled() bool {
+	if v := os.Getenv("DO_NOT_TRACK"); v != "" && v != "0" {
+		return true
+	}
+	switch strings.ToLower(os.Getenv("BSF_TELEMETRY")) {
+	case "0", "off", "false":
+		return true
+	}
+	return false
+}
+
+var (
+	mu      sync.Mutex
+	current *Event
+	rec     *timing.Recorder
+	started time.Time
+)
+
+// Start begins recording the run of the command, it is a no-op unless enabled
+func Start(enabled bool, command, bsfVersion string, features []string) {
+	if !enabled || Disabled() {
+		return
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	sort.Strings(features)
+	current = NewEvent(command, bsfVersion, features)
+	rec = timing.NewRecorder()
+	started = time.Now()
+}
+
+// NewEvent returns an event of the command for this machine
+func NewEvent(command, bsfVersion string, features []string) *Event {
+	return &Event{
+		SchemaVersion: SchemaVersion,
+		Command:       command,
+		BSFVersion:    bsfVersion,
+		OS:            runtime.GOOS,
+		Arch:          runtime.GOARCH,
+		CI:            os.Getenv("CI") != "",
+		Features:      features,
+		DurationsMs:   make(map[string]int64),
+		Day:           time.Now().UTC().Format(time.DateOnly),
+	}
+}
+
+// Phase starts timing a phase of the run and returns the function that stops it. It records nothing when telemetry is off.
+func Phase(name string) func() {
+	mu.Lock()
+	defer mu.Unlock()
+	return rec.Start(name)
+}
+
+// SetClosureSize records the number of components of the runtime closure
+func SetClosureSize(n int) {
+	mu.Lock()
+	defer mu.Unlock()
+	if current != nil {
+		current.ClosureSize = n
+	}
+}
+
+// Finish queues the event of the run and returns it, nil when nothing was recorded
+func Finish() (*Event, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	if current == nil {
+		return nil, nil
+	}
+
+	e := current
+	for _, p := range rec.Phases() {
+		e.DurationsMs[p.Name] = p.Duration.Milliseconds()
+	}
+	e.DurationsMs["total"] = time.Since(started).Milliseconds()
+	current, rec = nil, nil
+
+	return e, Queue(e)
+}
+
+// QueuePath is the file events are queued in before they are sent
+func QueuePath() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "bsf", "telemetry.jsonl"), nil
+}
+
+// Queue appends the event to the queue, dropping the oldest events when it is full
+func Queue(e *Event) error {
+	events, err := Pending()
+	if err != nil {
+		return err
+	}
+	events = append(events, e)
+	if len(events) > maxQueued {
+		events = events[len(events)-maxQueued:]
+	}
+	return writeQueue(events)
+}
+
+// Pending returns the queued events
+func Pending() ([]*Event, error) {
+	path, err := QueuePath()
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return make([]*Event, 0), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	events := make([]*Event, 0)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		e := &Event{}
+		// events of another schema are dropped rather than sent
+		if err := json.Unmarshal(scanner.Bytes(), e); err != nil || e.SchemaVersion != SchemaVersion {
+			continue
+		}
+		events = append(events, e)
+	}
+	return events, scanner.Err()
+}
+
+// Clear deletes the queued events
+func Clear() error {
+	path, err := QueuePath()
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func writeQueue(events []*Event) error {
+	path, err := QueuePath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, e := range events {
+		if err := enc.Encode(e); err != nil {
+			return err
+		}
+	}
+	return os.WriteFile(path, buf.Bytes(), 0600)
+}
+
+// Payload is the request body the events are sent in, preview shows it as is
+func Payload(events []*Event) ([]byte, error) {
+	return json.MarshalIndent(struct {
+		Events []*Event `json:"events"`
+	}{events}, "", "  ")
+}
+
+// Flush sends the queued events once there are BatchSize of them, or all of them when force is set.
+// The queue is only cleared when the endpoint accepted the events.
+func Flush(ctx context.Context, endpoint string, force bool) (int, error) {
+	events, err := Pending()
+	if err != nil || len(events) == 0 || (!force && len(events) < BatchSize) {
+		return 0, err
+	}
+	if endpoint == "" {
+		endpoint = DefaultEndpoint
+	}
+
+	body, err := Payload(events)
+	if err != nil {
+		return 0, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return 0, fmt.Errorf("telemetry endpoint returned %s", resp.Status)
+	}
+	return len(events), Clear()
+}
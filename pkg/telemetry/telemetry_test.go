@@ -0,0 +1,73 @@
+package telemetry
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRecordAndFlush(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("DO_NOT_TRACK", "")
+	t.Setenv("BSF_TELEMETRY", "")
+
+	// nothing is recorded unless enabled
+	Start(false, "bsf build", "v0.1.0", nil)
+	if e, err := Finish(); e != nil || err != nil {
+		t.Fatalf("expected no event, got %v %v", e, err)
+	}
+
+	for i := 0; i < BatchSize; i++ {
+		Start(true, "bsf build", "v0.1.0", []string{"quick", "output"})
+		stop := Phase("nix build")
+		stop()
+		SetClosureSize(42)
+		if _, err := Finish(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	events, err := Pending()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != BatchSize {
+		t.Fatalf("expected %d queued events, got %d", BatchSize, len(events))
+	}
+	e := events[0]
+	if e.ClosureSize != 42 || e.Features[0] != "output" || e.Command != "bsf build" {
+		t.Errorf("unexpected event %+v", e)
+	}
+	if _, ok := e.DurationsMs["nix build"]; !ok {
+		t.Errorf("expected the nix build phase to be recorded, got %v", e.DurationsMs)
+	}
+
+	received := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := struct{ Events []*Event }{}
+		json.NewDecoder(r.Body).Decode(&body)
+		received += len(body.Events)
+	}))
+	defer srv.Close()
+
+	n, err := Flush(context.Background(), srv.URL, false)
+	if err != nil || n != BatchSize || received != BatchSize {
+		t.Fatalf("Flush() = %d, %v, server received %d", n, err, received)
+	}
+	if events, _ := Pending(); len(events) != 0 {
+		t.Errorf("expected the queue to be cleared, got %d events", len(events))
+	}
+}
+
+func TestDisabled(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("BSF_TELEMETRY", "")
+	t.Setenv("DO_NOT_TRACK", "1")
+
+	Start(true, "bsf build", "v0.1.0", nil)
+	if e, _ := Finish(); e != nil {
+		t.Errorf("expected DO_NOT_TRACK to disable telemetry")
+	}
+}
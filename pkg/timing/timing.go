@@ -0,0 +1,95 @@
+package timing
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"runtime/trace"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// Phase is the accumulated duration of a step of the pipeline
+type Phase struct {
+	Name     string        `json:"name"`
+	Duration time.Duration `json:"duration"`
+	Calls    int           `json:"calls"`
+}
+
+// Recorder records how long each phase takes. A nil Recorder records nothing, so callers don't need to check for it.
+// Phases also show up as regions in execution traces.
+type Recorder struct {
+	mu     sync.Mutex
+	phases []*Phase
+}
+
+// NewRecorder returns an empty Recorder
+func NewRecorder() *Recorder {
+	return &Recorder{}
+}
+
+// Start starts timing the phase and returns the function that stops it
+func (r *Recorder) Start(name string) func() {
+	if r == nil {
+		return func() {}
+	}
+
+	region := trace.StartRegion(context.Background(), name)
+	start := time.Now()
+	return func() {
+		region.End()
+		r.add(name, time.Since(start))
+	}
+}
+
+func (r *Recorder) add(name string, d time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, p := range r.phases {
+		if p.Name == name {
+			p.Duration += d
+			p.Calls++
+			return
+		}
+	}
+	r.phases = append(r.phases, &Phase{Name: name, Duration: d, Calls: 1})
+}
+
+// Phases returns the recorded phases in the order they first started
+func (r *Recorder) Phases() []Phase {
+	if r == nil {
+		return nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	phases := make([]Phase, 0, len(r.phases))
+	for _, p := range r.phases {
+		phases = append(phases, *p)
+	}
+	return phases
+}
+
+// Report writes a table of the phases and their share of the total
+func (r *Recorder) Report(w io.Writer) error {
+	phases := r.Phases()
+	var total time.Duration
+	for _, p := range phases {
+		total += p.Duration
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "PHASE\tCALLS\tDURATION\tSHARE")
+	for _, p := range phases {
+		share := 0.0
+		if total > 0 {
+			share = float64(p.Duration) / float64(total) * 100
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%.1f%%\n", p.Name, p.Calls, p.Duration.Round(time.Microsecond), share)
+	}
+	fmt.Fprintf(tw, "total\t\t%s\t\n", total.Round(time.Microsecond))
+	return tw.Flush()
+}
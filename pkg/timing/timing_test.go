@@ -0,0 +1,36 @@
+package timing
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRecorder(t *testing.T) {
+	r := NewRecorder()
+	for i := 0; i < 3; i++ {
+		r.Start("hash")()
+	}
+	r.Start("sbom")()
+
+	phases := r.Phases()
+	if len(phases) != 2 {
+		t.Fatalf("expected 2 phases, got %d", len(phases))
+	}
+	if phases[0].Name != "hash" || phases[0].Calls != 3 {
+		t.Errorf("unexpected first phase %+v", phases[0])
+	}
+
+	var sb strings.Builder
+	if err := r.Report(&sb); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(sb.String(), "sbom") || !strings.Contains(sb.String(), "total") {
+		t.Errorf("unexpected report:\n%s", sb.String())
+	}
+
+	var nilRecorder *Recorder
+	nilRecorder.Start("noop")()
+	if nilRecorder.Phases() != nil {
+		t.Errorf("nil recorder should not record phases")
+	}
+}
@@ -0,0 +1,132 @@
+// Package toolchain verifies the external binaries bsf runs, such as nix, against the paths and digests trusted in
+// ~/.bsf.json. A build machine signing releases then can't be made to run another nix by changing its PATH.
+package toolchain
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	bio "github.com/buildsafedev/bsf/pkg/io"
+)
+
+// Trust is what a tool must match to run. The tool is resolved through PATH and its symlinks, e.g. to the nix of
+// a store path.
+type Trust struct {
+	// Paths are the globs the resolved path of the tool must match, e.g. /nix/store/*-nix-2.18.1/bin/nix
+	Paths []string `json:"paths,omitempty"`
+	// SHA256 are the hex sha256 digests the binary of the tool must have one of
+	SHA256 []string `json:"sha256,omitempty"`
+}
+
+// Validate validates Trust
+func (t Trust) Validate(name string) error {
+	if len(t.Paths) == 0 && len(t.SHA256) == 0 {
+		return fmt.Errorf("toolchain %s trusts no path nor digest", name)
+	}
+	for _, p := range t.Paths {
+		if !filepath.IsAbs(p) {
+			return fmt.Errorf("toolchain %s: path %s is not absolute", name, p)
+		}
+		if _, err := filepath.Match(p, ""); err != nil {
+			return fmt.Errorf("toolchain %s: invalid path %s: %v", name, p, err)
+		}
+	}
+	for _, d := range t.SHA256 {
+		if b, err := hex.DecodeString(d); err != nil || len(b) != sha256.Size {
+			return fmt.Errorf("toolchain %s: %s is not a hex sha256 digest", name, d)
+		}
+	}
+	return nil
+}
+
+// nixTools are links to the nix binary, they are verified against the trust of nix
+var nixTools = []string{"nix-build", "nix-channel", "nix-collect-garbage", "nix-copy-closure", "nix-env", "nix-hash",
+	"nix-instantiate", "nix-prefetch-url", "nix-shell", "nix-store"}
+
+var (
+	mu      sync.Mutex
+	trusted map[string]Trust
+	// verified holds the result of the verification of each path a tool was found at, tools are verified once a run
+	verified map[string]error
+)
+
+// Set sets the trusted tools. Tools that are not listed run without verification.
+func Set(tools map[string]Trust) error {
+	for name, t := range tools {
+		if err := t.Validate(name); err != nil {
+			return err
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	trusted = tools
+	verified = make(map[string]error)
+	return nil
+}
+
+// Check verifies the tool of the command when it is trusted in the configuration. A tool that doesn't match its
+// trust makes the command fail to start, with the error of the verification.
+func Check(cmd *exec.Cmd) *exec.Cmd {
+	if cmd.Err != nil {
+		return cmd
+	}
+	cmd.Err = Verify(filepath.Base(cmd.Args[0]), cmd.Path)
+	return cmd
+}
+
+// Verify verifies the tool found at path against its trust
+func Verify(name, path string) error {
+	if slices.Contains(nixTools, name) {
+		name = "nix"
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	t, ok := trusted[name]
+	if !ok {
+		return nil
+	}
+	if err, ok := verified[path]; ok {
+		return err
+	}
+
+	err := verify(name, path, t)
+	verified[path] = err
+	return err
+}
+
+func verify(name, path string, t Trust) error {
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return fmt.Errorf("toolchain %s: %w", name, err)
+	}
+	resolved, err = filepath.Abs(resolved)
+	if err != nil {
+		return fmt.Errorf("toolchain %s: %w", name, err)
+	}
+
+	if len(t.Paths) > 0 && !slices.ContainsFunc(t.Paths, func(p string) bool {
+		ok, _ := filepath.Match(p, resolved)
+		return ok
+	}) {
+		return fmt.Errorf("toolchain %s: %s is not a trusted path (%s)", name, resolved, strings.Join(t.Paths, ", "))
+	}
+
+	if len(t.SHA256) > 0 {
+		digest, err := bio.FileSHA256(resolved)
+		if err != nil {
+			return fmt.Errorf("toolchain %s: %w", name, err)
+		}
+		if !slices.ContainsFunc(t.SHA256, func(d string) bool { return strings.EqualFold(d, digest) }) {
+			return fmt.Errorf("toolchain %s: %s has the untrusted digest sha256:%s", name, resolved, digest)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+package toolchain
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestVerify(t *testing.T) {
+	dir := t.TempDir()
+	bin := filepath.Join(dir, "store", "abc-nix-2.18.1", "bin")
+	if err := os.MkdirAll(bin, 0755); err != nil {
+		t.Fatal(err)
+	}
+	nix := filepath.Join(bin, "nix")
+	if err := os.WriteFile(nix, []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256([]byte("#!/bin/sh\n"))
+	digest := hex.EncodeToString(sum[:])
+
+	// the profile links to the nix of the store, nix-store links to nix
+	profile := filepath.Join(dir, "profile")
+	if err := os.Mkdir(profile, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"nix", "nix-store"} {
+		if err := os.Symlink(nix, filepath.Join(profile, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	hijacked := filepath.Join(dir, "nix")
+	if err := os.WriteFile(hijacked, []byte("#!/bin/sh\necho pwned\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		trust   map[string]Trust
+		tool    string
+		path    string
+		wantErr string
+	}{
+		{
+			name:  "untrusted tools are not verified",
+			trust: map[string]Trust{},
+			tool:  "nix",
+			path:  hijacked,
+		},
+		{
+			name:  "path matches",
+			trust: map[string]Trust{"nix": {Paths: []string{filepath.Join(dir, "store", "*-nix-2.18.1", "bin", "nix")}}},
+			tool:  "nix",
+			path:  filepath.Join(profile, "nix"),
+		},
+		{
+			name:  "digest matches",
+			trust: map[string]Trust{"nix": {SHA256: []string{strings.ToUpper(digest)}}},
+			tool:  "nix",
+			path:  filepath.Join(profile, "nix"),
+		},
+		{
+			name:  "links to nix are verified as nix",
+			trust: map[string]Trust{"nix": {Paths: []string{nix}, SHA256: []string{digest}}},
+			tool:  "nix-store",
+			path:  filepath.Join(profile, "nix-store"),
+		},
+		{
+			name:    "path doesn't match",
+			trust:   map[string]Trust{"nix": {Paths: []string{filepath.Join(dir, "store", "*", "bin", "nix")}}},
+			tool:    "nix",
+			path:    hijacked,
+			wantErr: "is not a trusted path",
+		},
+		{
+			name:    "digest doesn't match",
+			trust:   map[string]Trust{"nix": {SHA256: []string{digest}}},
+			tool:    "nix",
+			path:    hijacked,
+			wantErr: "untrusted digest",
+		},
+		{
+			name:    "tool doesn't exist",
+			trust:   map[string]Trust{"nix": {SHA256: []string{digest}}},
+			tool:    "nix",
+			path:    filepath.Join(dir, "missing"),
+			wantErr: "no such file",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := Set(tt.trust); err != nil {
+				t.Fatal(err)
+			}
+			defer Set(nil)
+
+			err := Verify(tt.tool, tt.path)
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("Verify() error = %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("Verify() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		trust   Trust
+		wantErr bool
+	}{
+		{name: "paths", trust: Trust{Paths: []string{"/nix/store/*-nix-2.18.1/bin/nix"}}},
+		{name: "digests", trust: Trust{SHA256: []string{strings.Repeat("ab", 32)}}},
+		{name: "nothing trusted", trust: Trust{}, wantErr: true},
+		{name: "relative path", trust: Trust{Paths: []string{"bin/nix"}}, wantErr: true},
+		{name: "invalid glob", trust: Trust{Paths: []string{"/nix/store/[-nix/bin/nix"}}, wantErr: true},
+		{name: "short digest", trust: Trust{SHA256: []string{"abcd"}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.trust.Validate("nix"); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCheck(t *testing.T) {
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("no sh")
+	}
+	if err := Set(map[string]Trust{"sh": {SHA256: []string{strings.Repeat("00", 32)}}}); err != nil {
+		t.Fatal(err)
+	}
+	defer Set(nil)
+
+	cmd := Check(exec.Command(sh, "-c", "true"))
+	if err := cmd.Run(); err == nil || !strings.Contains(err.Error(), "untrusted digest") {
+		t.Errorf("Run() error = %v, want the verification error", err)
+	}
+}
@@ -0,0 +1,230 @@
+// Package vex writes the vulnerabilities found in a closure as VEX documents, OpenVEX or CycloneDX, so consumers of
+// the SBOM know which components are affected and which are not.
+package vex
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/buildsafedev/bsf/pkg/loader"
+	"github.com/buildsafedev/bsf/pkg/osv"
+)
+
+// Formats of VEX documents
+const (
+	FormatOpenVEX   = "openvex"
+	FormatCycloneDX = "cyclonedx"
+)
+
+// Statuses of OpenVEX statements
+const (
+	StatusAffected    = "affected"
+	StatusNotAffected = "not_affected"
+)
+
+// Product is the application the VEX document is about
+type Product struct {
+	// Purl is the package url of the application
+	Purl string
+	// ComponentID returns the identifier of a component in the SBOM, the bom-ref of CycloneDX documents
+	ComponentID func(name, version string) string
+}
+
+// FileName returns the name of the VEX document of the format in the output directory
+func FileName(format string) (string, error) {
+	switch format {
+	case FormatOpenVEX:
+		return "vex.openvex.json", nil
+	case FormatCycloneDX:
+		return "vex.cdx.json", nil
+	}
+	return "", fmt.Errorf("unsupported VEX format %q, use openvex or cyclonedx", format)
+}
+
+// Write returns the VEX document of the findings in the format
+func Write(format string, product Product, findings []osv.Finding, now time.Time) ([]byte, error) {
+	switch format {
+	case FormatOpenVEX:
+		return json.MarshalIndent(OpenVEX(product, findings, now), "", "  ")
+	case FormatCycloneDX:
+		return json.MarshalIndent(CycloneDX(product, findings, now), "", "  ")
+	}
+	return nil, fmt.Errorf("unsupported VEX format %q, use openvex or cyclonedx", format)
+}
+
+// OpenVEXDocument is an OpenVEX v0.2.0 document
+type OpenVEXDocument struct {
+	Context    string             `json:"@context"`
+	ID         string             `json:"@id"`
+	Author     string             `json:"author"`
+	Timestamp  time.Time          `json:"timestamp"`
+	Version    int                `json:"version"`
+	Statements []OpenVEXStatement `json:"statements"`
+}
+
+// OpenVEXStatement is the status of a vulnerability in the components of the product
+type OpenVEXStatement struct {
+	Vulnerability struct {
+		Name    string   `json:"name"`
+		Aliases []string `json:"aliases,omitempty"`
+	} `json:"vulnerability"`
+	Products        []OpenVEXProduct `json:"products"`
+	Status          string           `json:"status"`
+	Justification   string           `json:"justification,omitempty"`
+	ImpactStatement string           `json:"impact_statement,omitempty"`
+	ActionStatement string           `json:"action_statement,omitempty"`
+}
+
+// OpenVEXProduct is a product, or a component of a product, named by package url
+type OpenVEXProduct struct {
+	ID            string           `json:"@id"`
+	Subcomponents []OpenVEXProduct `json:"subcomponents,omitempty"`
+}
+
+// OpenVEX returns the OpenVEX document of the findings. Components the entrypoints of the application don't load
+// are not affected, their vulnerable code is not in the execute path.
+func OpenVEX(product Product, findings []osv.Finding, now time.Time) *OpenVEXDocument {
+	doc := &OpenVEXDocument{
+		Context:    "https://openvex.dev/ns/v0.2.0",
+		Author:     "bsf",
+		Timestamp:  now.UTC().Truncate(time.Second),
+		Version:    1,
+		Statements: make([]OpenVEXStatement, 0, len(findings)),
+	}
+
+	h := sha256.New()
+	h.Write([]byte(product.Purl))
+	for _, f := range findings {
+		st := OpenVEXStatement{Status: StatusAffected}
+		st.Vulnerability.Name = f.Vulnerability.ID
+		st.Vulnerability.Aliases = f.Vulnerability.Aliases
+		st.Products = []OpenVEXProduct{{ID: product.Purl, Subcomponents: []OpenVEXProduct{{ID: f.Component.Purl}}}}
+
+		if f.Component.Reachability == loader.Unreachable {
+			st.Status = StatusNotAffected
+			st.Justification = "vulnerable_code_not_in_execute_path"
+			st.ImpactStatement = fmt.Sprintf("%s is not loaded by the entrypoints of the application", f.Component.Name)
+		} else if fixed := f.Vulnerability.Fixed(); len(fixed) > 0 {
+			st.ActionStatement = fmt.Sprintf("update %s to %s", f.Component.Name, strings.Join(fixed, " or "))
+		} else {
+			st.ActionStatement = "no fixed version is known"
+		}
+		doc.Statements = append(doc.Statements, st)
+		h.Write([]byte(f.Vulnerability.ID + f.Component.Purl + st.Status))
+	}
+	doc.ID = "https://openvex.dev/docs/public/vex-" + hex.EncodeToString(h.Sum(nil))
+	return doc
+}
+
+// CycloneDXDocument is a CycloneDX 1.5 document holding vulnerabilities only, the components are in the SBOM
+type CycloneDXDocument struct {
+	BOMFormat       string                   `json:"bomFormat"`
+	SpecVersion     string                   `json:"specVersion"`
+	Version         int                      `json:"version"`
+	Metadata        map[string]interface{}   `json:"metadata"`
+	Vulnerabilities []CycloneDXVulnerability `json:"vulnerabilities"`
+}
+
+// CycloneDXVulnerability is a vulnerability and the components it affects, by bom-ref
+type CycloneDXVulnerability struct {
+	ID     string `json:"id"`
+	Source struct {
+		Name string `json:"name"`
+		URL  string `json:"url"`
+	} `json:"source"`
+	References  []CycloneDXReference `json:"references,omitempty"`
+	Ratings     []CycloneDXRating    `json:"ratings,omitempty"`
+	Description string               `json:"description,omitempty"`
+	Affects     []CycloneDXReference `json:"affects"`
+	Analysis    struct {
+		State         string   `json:"state"`
+		Justification string   `json:"justification,omitempty"`
+		Response      []string `json:"response,omitempty"`
+		Detail        string   `json:"detail,omitempty"`
+	} `json:"analysis"`
+}
+
+// CycloneDXReference references a vulnerability by ID or a component by bom-ref
+type CycloneDXReference struct {
+	ID  string `json:"id,omitempty"`
+	Ref string `json:"ref,omitempty"`
+}
+
+// CycloneDXRating is the severity of a vulnerability
+type CycloneDXRating struct {
+	Severity string `json:"severity"`
+	Method   string `json:"method,omitempty"`
+	Vector   string `json:"vector,omitempty"`
+}
+
+// CycloneDX returns the CycloneDX VEX document of the findings. A vulnerability of several components is listed
+// once, affecting all of them.
+func CycloneDX(product Product, findings []osv.Finding, now time.Time) *CycloneDXDocument {
+	doc := &CycloneDXDocument{
+		BOMFormat:   "CycloneDX",
+		SpecVersion: "1.5",
+		Version:     1,
+		Metadata: map[string]interface{}{
+			"timestamp": now.UTC().Truncate(time.Second),
+			"component": map[string]string{"type": "application", "purl": product.Purl},
+		},
+		Vulnerabilities: make([]CycloneDXVulnerability, 0),
+	}
+
+	byID := make(map[string]*CycloneDXVulnerability)
+	reachable := make(map[string]bool)
+	order := make([]string, 0)
+	for _, f := range findings {
+		v, ok := byID[f.Vulnerability.ID]
+		if !ok {
+			v = &CycloneDXVulnerability{ID: f.Vulnerability.ID, Description: f.Vulnerability.Summary}
+			v.Source.Name = "OSV"
+			v.Source.URL = "https://osv.dev/vulnerability/" + f.Vulnerability.ID
+			for _, alias := range f.Vulnerability.Aliases {
+				v.References = append(v.References, CycloneDXReference{ID: alias})
+			}
+			for _, s := range f.Vulnerability.Severity {
+				switch s.Type {
+				case "CVSS_V3":
+					v.Ratings = append(v.Ratings, CycloneDXRating{Severity: f.Severity.String(), Method: "CVSSv31", Vector: s.Score})
+				case "CVSS_V4":
+					v.Ratings = append(v.Ratings, CycloneDXRating{Severity: f.Severity.String(), Method: "CVSSv4", Vector: s.Score})
+				}
+			}
+			if len(v.Ratings) == 0 {
+				v.Ratings = append(v.Ratings, CycloneDXRating{Severity: f.Severity.String()})
+			}
+			byID[f.Vulnerability.ID] = v
+			order = append(order, f.Vulnerability.ID)
+		}
+
+		ref := f.Component.Purl
+		if product.ComponentID != nil {
+			ref = product.ComponentID(f.Component.Name, f.Component.Version)
+		}
+		v.Affects = append(v.Affects, CycloneDXReference{Ref: ref})
+		if f.Component.Reachability != loader.Unreachable {
+			reachable[f.Vulnerability.ID] = true
+		}
+	}
+
+	for _, id := range order {
+		v := byID[id]
+		sort.Slice(v.Affects, func(i, j int) bool { return v.Affects[i].Ref < v.Affects[j].Ref })
+		if reachable[id] {
+			v.Analysis.State = "exploitable"
+			v.Analysis.Response = []string{"update"}
+		} else {
+			v.Analysis.State = "not_affected"
+			v.Analysis.Justification = "code_not_reachable"
+			v.Analysis.Detail = "the affected components are not loaded by the entrypoints of the application"
+		}
+		doc.Vulnerabilities = append(doc.Vulnerabilities, *v)
+	}
+	return doc
+}
@@ -0,0 +1,86 @@
+package vex
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/buildsafedev/bsf/pkg/loader"
+	"github.com/buildsafedev/bsf/pkg/osv"
+)
+
+func findings(t *testing.T) []osv.Finding {
+	t.Helper()
+	v := osv.Vulnerability{}
+	err := json.Unmarshal([]byte(`{
+		"id": "GHSA-9wx4-h78v-vm56",
+		"aliases": ["CVE-2024-35195"],
+		"affected": [{"package": {"ecosystem": "PyPI", "name": "requests"}, "ranges": [{"type": "ECOSYSTEM", "events": [{"introduced": "0"}, {"fixed": "2.32.0"}]}]}]
+	}`), &v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return []osv.Finding{
+		{Component: osv.Component{Name: "requests", Version: "2.31.0", Purl: "pkg:pypi/requests@2.31.0", Reachability: loader.Reachable}, Vulnerability: v, Severity: osv.SeverityMedium},
+		{Component: osv.Component{Name: "requests", Version: "2.28.2", Purl: "pkg:pypi/requests@2.28.2", Reachability: loader.Unreachable}, Vulnerability: v, Severity: osv.SeverityMedium},
+	}
+}
+
+func TestOpenVEX(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	doc := OpenVEX(Product{Purl: "pkg:nix/app@0.0.0"}, findings(t), now)
+	if len(doc.Statements) != 2 {
+		t.Fatalf("OpenVEX() has %d statements, want 2", len(doc.Statements))
+	}
+
+	affected, unreachable := doc.Statements[0], doc.Statements[1]
+	if affected.Status != StatusAffected || affected.ActionStatement != "update requests to 2.32.0" {
+		t.Errorf("statement of the loaded component = %+v", affected)
+	}
+	if unreachable.Status != StatusNotAffected || unreachable.Justification != "vulnerable_code_not_in_execute_path" {
+		t.Errorf("statement of the unloaded component = %+v", unreachable)
+	}
+	if got := affected.Products[0].Subcomponents[0].ID; got != "pkg:pypi/requests@2.31.0" {
+		t.Errorf("subcomponent = %s, want pkg:pypi/requests@2.31.0", got)
+	}
+
+	again := OpenVEX(Product{Purl: "pkg:nix/app@0.0.0"}, findings(t), now.Add(time.Hour))
+	if again.ID != doc.ID {
+		t.Error("the ID of the document should only depend on its statements")
+	}
+}
+
+func TestCycloneDX(t *testing.T) {
+	product := Product{
+		Purl:        "pkg:nix/app@0.0.0",
+		ComponentID: func(name, version string) string { return name + "@" + version },
+	}
+	doc := CycloneDX(product, findings(t), time.Now())
+	if len(doc.Vulnerabilities) != 1 {
+		t.Fatalf("CycloneDX() has %d vulnerabilities, want 1", len(doc.Vulnerabilities))
+	}
+	v := doc.Vulnerabilities[0]
+	if len(v.Affects) != 2 || v.Affects[0].Ref != "requests@2.28.2" {
+		t.Errorf("affects = %v", v.Affects)
+	}
+	if v.Analysis.State != "exploitable" {
+		t.Errorf("state = %s, want exploitable as one of the components is loaded", v.Analysis.State)
+	}
+	if v.Ratings[0].Severity != "medium" {
+		t.Errorf("rating = %+v, want medium", v.Ratings[0])
+	}
+
+	doc = CycloneDX(product, findings(t)[1:], time.Now())
+	if got := doc.Vulnerabilities[0].Analysis; got.State != "not_affected" || got.Justification != "code_not_reachable" {
+		t.Errorf("analysis of an unloaded component = %+v", got)
+	}
+}
+
+func TestFileName(t *testing.T) {
+	if _, err := FileName("csaf"); err == nil {
+		t.Error("FileName(csaf) should fail")
+	}
+	if name, _ := FileName(FormatCycloneDX); name != "vex.cdx.json" {
+		t.Errorf("FileName(cyclonedx) = %s", name)
+	}
+}
@@ -0,0 +1,180 @@
+package vulnerability
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	bsfv1 "github.com/buildsafedev/bsf-apis/go/buildsafe/v1"
+)
+
+const (
+	// FixOpen is the state of a fix whose pull request is not merged yet
+	FixOpen = "open"
+	// FixMerged is the state of a fix merged in nixpkgs
+	FixMerged = "merged"
+)
+
+// Fix is a nixpkgs pull request fixing a vulnerability, with the next step it suggests to the user
+type Fix struct {
+	ID     string `json:"id"`
+	URL    string `json:"url"`
+	Title  string `json:"title"`
+	State  string `json:"state"`
+	Author string `json:"author"`
+	// Commit is the merge commit of a merged pull request
+	Commit string `json:"commit,omitempty"`
+	// Version is the version of the package the pull request updates to, when its title says so
+	Version    string `json:"version,omitempty"`
+	Suggestion string `json:"suggestion"`
+}
+
+// FixFinder searches the nixpkgs pull requests mentioning a vulnerability with the GitHub API
+type FixFinder struct {
+	BaseURL    string
+	Repository string
+	Token      string
+	HTTPClient *http.Client
+}
+
+// NewFixFinder creates a FixFinder of NixOS/nixpkgs, authenticating with GITHUB_TOKEN if it is set.
+// Unauthenticated searches are limited to 10 a minute.
+func NewFixFinder() *FixFinder {
+	return &FixFinder{
+		BaseURL:    "https://api.github.com",
+		Repository: "NixOS/nixpkgs",
+		Token:      os.Getenv("GITHUB_TOKEN"),
+		HTTPClient: &http.Client{
+			Timeout: 30 * time.Second,
+		},
+	}
+}
+
+// versionBump matches the titles of version updates, e.g. "curl: 8.5.0 -> 8.6.0" of the nixpkgs-update bot
+var versionBump = regexp.MustCompile(`^([^\s:]+): (\S+) -> (\S+)`)
+
+// Find returns the pull requests of nixpkgs mentioning the vulnerability id that change the package, merged ones
+// first. Pull requests that were closed without being merged are left out.
+func (f *FixFinder) Find(ctx context.Context, pkg, id string) ([]Fix, error) {
+	query := url.Values{}
+	query.Set("q", fmt.Sprintf("%q repo:%s is:pr", id, f.Repository))
+	query.Set("sort", "updated")
+
+	result := struct {
+		Items []struct {
+			Number  int    `json:"number"`
+			Title   string `json:"title"`
+			HTMLURL string `json:"html_url"`
+			State   string `json:"state"`
+			User    struct {
+				Login string `json:"login"`
+			} `json:"user"`
+			PullRequest struct {
+				MergedAt *time.Time `json:"merged_at"`
+			} `json:"pull_request"`
+		} `json:"items"`
+	}{}
+	if err := f.get(ctx, "/search/issues?"+query.Encode(), &result); err != nil {
+		return nil, err
+	}
+
+	merged := make([]Fix, 0)
+	open := make([]Fix, 0)
+	for _, item := range result.Items {
+		fix := Fix{ID: id, URL: item.HTMLURL, Title: item.Title, Author: item.User.Login}
+		// titles name the attribute, e.g. python311Packages.requests
+		if m := versionBump.FindStringSubmatch(item.Title); m != nil {
+			if attr := m[1]; attr[strings.LastIndex(attr, ".")+1:] != pkg {
+				continue
+			}
+			fix.Version = m[3]
+		}
+
+		switch {
+		case item.PullRequest.MergedAt != nil:
+			fix.State = FixMerged
+			pr := struct {
+				MergeCommitSHA string `json:"merge_commit_sha"`
+			}{}
+			if err := f.get(ctx, fmt.Sprintf("/repos/%s/pulls/%d", f.Repository, item.Number), &pr); err == nil {
+				fix.Commit = pr.MergeCommitSHA
+			}
+			fix.Suggestion = Suggest(pkg, fix)
+			merged = append(merged, fix)
+		case item.State == FixOpen:
+			fix.State = FixOpen
+			fix.Suggestion = Suggest(pkg, fix)
+			open = append(open, fix)
+		}
+	}
+	return append(merged, open...), nil
+}
+
+// FindAll returns the fixes of the vulnerabilities of the package. Pull requests fixing several of them are listed
+// once, for the first.
+func (f *FixFinder) FindAll(ctx context.Context, pkg string, vulns []*bsfv1.Vulnerability) ([]Fix, error) {
+	fixes := make([]Fix, 0)
+	seen := make(map[string]bool)
+	for _, v := range vulns {
+		found, err := f.Find(ctx, pkg, v.Id)
+		if err != nil {
+			return fixes, fmt.Errorf("failed to search the fixes of %s: %w", v.Id, err)
+		}
+		for _, fix := range found {
+			if !seen[fix.URL] {
+				seen[fix.URL] = true
+				fixes = append(fixes, fix)
+			}
+		}
+	}
+	return fixes, nil
+}
+
+// Suggest returns the next step the fix suggests: pinning the fixed version or a nixpkgs revision including the
+// merged fix, or applying the patch of a pull request that is still open
+func Suggest(pkg string, fix Fix) string {
+	switch {
+	case fix.State == FixMerged && fix.Version != "":
+		return fmt.Sprintf("pin %s@%s in bsf.hcl and run bsf update", pkg, fix.Version)
+	case fix.State == FixMerged && fix.Commit != "":
+		return fmt.Sprintf("update nixpkgs to a revision including %s", shortCommit(fix.Commit))
+	case fix.State == FixMerged:
+		return fmt.Sprintf("update nixpkgs to a revision including %s", fix.URL)
+	}
+	return fmt.Sprintf(`add the patch of the open pull request to %s: patches = [ (fetchpatch { url = "%s.patch"; hash = ""; }) ]`, pkg, fix.URL)
+}
+
+func shortCommit(sha string) string {
+	if len(sha) > 12 {
+		return sha[:12]
+	}
+	return sha
+}
+
+func (f *FixFinder) get(ctx context.Context, path string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, f.BaseURL+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	if f.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+f.Token)
+	}
+
+	resp, err := f.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GitHub API returned %s", resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
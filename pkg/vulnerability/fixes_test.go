@@ -0,0 +1,92 @@
+package vulnerability
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	bsfv1 "github.com/buildsafedev/bsf-apis/go/buildsafe/v1"
+)
+
+func TestFindAll(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/search/issues":
+			if q := r.URL.Query().Get("q"); q != `"CVE-2024-2398" repo:NixOS/nixpkgs is:pr` && q != `"CVE-2024-2004" repo:NixOS/nixpkgs is:pr` {
+				t.Errorf("unexpected query %s", q)
+			}
+			w.Write([]byte(`{"items": [
+				{"number": 1, "title": "curl: 8.6.0 -> 8.7.1", "html_url": "https://github.com/NixOS/nixpkgs/pull/1", "state": "closed", "user": {"login": "r-ryantm"}, "pull_request": {"merged_at": "2024-03-27T10:00:00Z"}},
+				{"number": 2, "title": "curl: backport the fix of CVE-2024-2398", "html_url": "https://github.com/NixOS/nixpkgs/pull/2", "state": "open", "user": {"login": "jdoe"}, "pull_request": {}},
+				{"number": 3, "title": "curlie: 1.7.1 -> 1.7.2", "html_url": "https://github.com/NixOS/nixpkgs/pull/3", "state": "closed", "user": {"login": "r-ryantm"}, "pull_request": {"merged_at": "2024-03-28T10:00:00Z"}},
+				{"number": 4, "title": "curl: revert the fix", "html_url": "https://github.com/NixOS/nixpkgs/pull/4", "state": "closed", "user": {"login": "jdoe"}, "pull_request": {}}
+			]}`))
+		case "/repos/NixOS/nixpkgs/pulls/1":
+			w.Write([]byte(`{"merge_commit_sha": "0123456789abcdef0123456789abcdef01234567"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	f := NewFixFinder()
+	f.BaseURL = srv.URL
+	f.Token = ""
+
+	got, err := f.FindAll(context.Background(), "curl", []*bsfv1.Vulnerability{{Id: "CVE-2024-2398"}, {Id: "CVE-2024-2004"}})
+	if err != nil {
+		t.Fatalf("FindAll() error = %v", err)
+	}
+	want := []Fix{
+		{
+			ID:         "CVE-2024-2398",
+			URL:        "https://github.com/NixOS/nixpkgs/pull/1",
+			Title:      "curl: 8.6.0 -> 8.7.1",
+			State:      FixMerged,
+			Author:     "r-ryantm",
+			Commit:     "0123456789abcdef0123456789abcdef01234567",
+			Version:    "8.7.1",
+			Suggestion: "pin curl@8.7.1 in bsf.hcl and run bsf update",
+		},
+		{
+			ID:         "CVE-2024-2398",
+			URL:        "https://github.com/NixOS/nixpkgs/pull/2",
+			Title:      "curl: backport the fix of CVE-2024-2398",
+			State:      FixOpen,
+			Author:     "jdoe",
+			Suggestion: `add the patch of the open pull request to curl: patches = [ (fetchpatch { url = "https://github.com/NixOS/nixpkgs/pull/2.patch"; hash = ""; }) ]`,
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("FindAll() = %+v, want %+v", got, want)
+	}
+}
+
+func TestSuggest(t *testing.T) {
+	tests := []struct {
+		name string
+		fix  Fix
+		want string
+	}{
+		{
+			name: "merged fix without version",
+			fix:  Fix{State: FixMerged, Commit: "0123456789abcdef0123"},
+			want: "update nixpkgs to a revision including 0123456789ab",
+		},
+		{
+			name: "merged fix without merge commit",
+			fix:  Fix{State: FixMerged, URL: "https://github.com/NixOS/nixpkgs/pull/5"},
+			want: "update nixpkgs to a revision including https://github.com/NixOS/nixpkgs/pull/5",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Suggest("curl", tt.fix); got != tt.want {
+				t.Errorf("Suggest() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
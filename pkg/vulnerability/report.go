@@ -0,0 +1,57 @@
+package vulnerability
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	bsfv1 "github.com/buildsafedev/bsf-apis/go/buildsafe/v1"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/buildsafedev/bsf/pkg/enrichdb"
+)
+
+// Report is the result of scanning a package, along with the snapshots of the data it was scanned against
+type Report struct {
+	Name      string              `json:"name"`
+	Version   string              `json:"version"`
+	ScannedAt time.Time           `json:"scannedAt"`
+	Sources   []enrichdb.Snapshot `json:"sources"`
+	// Reachability tells if the dynamic loader loads the package from the entrypoints of the build it was scanned for.
+	// Vulnerabilities of unreachable packages can be prioritized lower.
+	Reachability    string                 `json:"reachability,omitempty"`
+	Vulnerabilities []*bsfv1.Vulnerability `json:"vulnerabilities"`
+	// Fixes are the nixpkgs pull requests fixing the vulnerabilities, when they were searched
+	Fixes []Fix `json:"fixes,omitempty"`
+}
+
+// NewReport returns the report of the vulnerabilities returned by the API at addr.
+// The digest of the response identifies the data the package was scanned against, the databases recorded in lock are listed as well.
+func NewReport(name, version, addr string, resp *bsfv1.FetchVulnerabilitiesResponse, lock *enrichdb.Lock) (*Report, error) {
+	data, err := proto.MarshalOptions{Deterministic: true}.Marshal(resp)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(data)
+
+	now := time.Now().UTC()
+	sources := []enrichdb.Snapshot{
+		{
+			Name:      "buildsafe-api",
+			URL:       addr,
+			Digest:    "sha256:" + hex.EncodeToString(sum[:]),
+			FetchedAt: now,
+		},
+	}
+	if lock != nil {
+		sources = append(sources, lock.Snapshots()...)
+	}
+
+	return &Report{
+		Name:            name,
+		Version:         version,
+		ScannedAt:       now,
+		Sources:         sources,
+		Vulnerabilities: SortVulnerabilities(resp.Vulnerabilities),
+	}, nil
+}
@@ -0,0 +1,125 @@
+package workload
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"strings"
+
+	"github.com/buildsafedev/bsf/pkg/toolchain"
+)
+
+// github uses the Actions OIDC provider, the workflow needs the id-token: write permission
+type github struct{}
+
+func (g *github) name() string {
+	return "github"
+}
+
+func (g *github) available() bool {
+	return env("ACTIONS_ID_TOKEN_REQUEST_URL") != "" && env("ACTIONS_ID_TOKEN_REQUEST_TOKEN") != ""
+}
+
+func (g *github) token(ctx context.Context, audience string) (string, error) {
+	u, err := url.Parse(env("ACTIONS_ID_TOKEN_REQUEST_URL"))
+	if err != nil {
+		return "", err
+	}
+	q := u.Query()
+	q.Set("audience", audience)
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+env("ACTIONS_ID_TOKEN_REQUEST_TOKEN"))
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token request returned %s", resp.Status)
+	}
+
+	var body struct {
+		Value string `json:"value"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&body)
+	if err != nil {
+		return "", err
+	}
+	return body.Value, nil
+}
+
+func (g *github) identity(claims map[string]interface{}) (string, string) {
+	builderID := "https://github.com/" + claimString(claims, "job_workflow_ref")
+	invocationID := fmt.Sprintf("https://github.com/%s/actions/runs/%s/attempts/%s",
+		claimString(claims, "repository"), claimString(claims, "run_id"), claimString(claims, "run_attempt"))
+	return builderID, invocationID
+}
+
+// gitlab reads the token GitLab injects for an id_tokens entry named SIGSTORE_ID_TOKEN
+type gitlab struct{}
+
+func (g *gitlab) name() string {
+	return "gitlab"
+}
+
+func (g *gitlab) available() bool {
+	return env("GITLAB_CI") != "" && env("SIGSTORE_ID_TOKEN") != ""
+}
+
+func (g *gitlab) token(ctx context.Context, audience string) (string, error) {
+	return env("SIGSTORE_ID_TOKEN"), nil
+}
+
+func (g *gitlab) identity(claims map[string]interface{}) (string, string) {
+	builderID := "https://" + claimString(claims, "ci_config_ref_uri")
+	invocationID := env("CI_PIPELINE_URL")
+	if invocationID == "" {
+		invocationID = fmt.Sprintf("%s/%s/-/pipelines/%s", env("CI_SERVER_URL"), claimString(claims, "project_path"), claimString(claims, "pipeline_id"))
+	}
+	return builderID, invocationID
+}
+
+// buildkite requests tokens from the agent
+type buildkite struct{}
+
+func (b *buildkite) name() string {
+	return "buildkite"
+}
+
+func (b *buildkite) available() bool {
+	return env("BUILDKITE") == "true" && env("BUILDKITE_AGENT_ACCESS_TOKEN") != ""
+}
+
+func (b *buildkite) token(ctx context.Context, audience string) (string, error) {
+	cmd := toolchain.Check(exec.CommandContext(ctx, "buildkite-agent", "oidc", "request-token", "--audience", audience))
+
+	var stdout bytes.Buffer
+	var stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+	if err != nil {
+		return "", fmt.Errorf("failed with %s", cmd.Stderr)
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+func (b *buildkite) identity(claims map[string]interface{}) (string, string) {
+	builderID := fmt.Sprintf("https://buildkite.com/%s/%s", claimString(claims, "organization_slug"), claimString(claims, "pipeline_slug"))
+	invocationID := env("BUILDKITE_BUILD_URL")
+	if job := env("BUILDKITE_JOB_ID"); invocationID != "" && job != "" {
+		invocationID += "#" + job
+	}
+	return builderID, invocationID
+}
@@ -0,0 +1,166 @@
+package workload
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ErrNoIdentity is returned when no CI workload identity is available
+var ErrNoIdentity = errors.New("no workload identity available, trusted builder mode requires GitHub Actions, GitLab CI or Buildkite")
+
+// Identity is the OIDC identity of the CI job running bsf
+type Identity struct {
+	Provider string `json:"provider"`
+	Issuer   string `json:"issuer"`
+	Subject  string `json:"subject"`
+	// BuilderID identifies the workflow or pipeline definition that ran the build
+	BuilderID string `json:"builderId"`
+	// InvocationID identifies the run of the workflow or pipeline
+	InvocationID string `json:"invocationId"`
+	// Claims are the claims of the token describing the runner
+	Claims map[string]interface{} `json:"claims"`
+	// Token is the raw OIDC token, it is short lived and not recorded anywhere
+	Token string `json:"-"`
+}
+
+type provider interface {
+	name() string
+	available() bool
+	token(ctx context.Context, audience string) (string, error)
+	identity(claims map[string]interface{}) (builderID, invocationID string)
+}
+
+var providers = []provider{
+	&github{},
+	&gitlab{},
+	&buildkite{},
+}
+
+// Detect requests an OIDC token for the audience from the CI provider bsf is running in
+func Detect(ctx context.Context, audience string) (*Identity, error) {
+	for _, p := range providers {
+		if !p.available() {
+			continue
+		}
+
+		token, err := p.token(ctx, audience)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get %s OIDC token: %v", p.name(), err)
+		}
+		claims, err := ParseClaims(token)
+		if err != nil {
+			return nil, err
+		}
+
+		id := &Identity{
+			Provider: p.name(),
+			Issuer:   claimString(claims, "iss"),
+			Subject:  claimString(claims, "sub"),
+			Claims:   runnerClaims(claims),
+			Token:    token,
+		}
+		id.BuilderID, id.InvocationID = p.identity(claims)
+		return id, nil
+	}
+
+	return nil, ErrNoIdentity
+}
+
+// Refresh requests a new token for the audience from the CI provider of the identity. CI tokens expire within
+// minutes, they are refreshed right before they are exchanged. Tokens obtained out of band are kept as they are.
+func (id *Identity) Refresh(ctx context.Context, audience string) error {
+	for _, p := range providers {
+		if p.name() != id.Provider {
+			continue
+		}
+		token, err := p.token(ctx, audience)
+		if err != nil {
+			return fmt.Errorf("failed to get %s OIDC token: %v", p.name(), err)
+		}
+		id.Token = token
+		return nil
+	}
+	return nil
+}
+
+// TokenEnv is the environment variable holding an OIDC token to sign with outside CI, as cosign reads it
+const TokenEnv = "SIGSTORE_ID_TOKEN"
+
+// FromToken returns the identity of an OIDC token obtained out of band, e.g. with an interactive login. Tokens of
+// email identities are certified for the email, as Fulcio binds them.
+func FromToken(token string) (*Identity, error) {
+	claims, err := ParseClaims(token)
+	if err != nil {
+		return nil, err
+	}
+	id := &Identity{
+		Provider: "token",
+		Issuer:   claimString(claims, "iss"),
+		Subject:  claimString(claims, "sub"),
+		Claims:   runnerClaims(claims),
+		Token:    token,
+	}
+	if email := claimString(claims, "email"); email != "" {
+		id.Subject = email
+	}
+	return id, nil
+}
+
+// Signing returns the identity to sign with: the token of TokenEnv when it is set, the CI workload identity otherwise
+func Signing(ctx context.Context, audience string) (*Identity, error) {
+	if token := env(TokenEnv); token != "" {
+		return FromToken(token)
+	}
+	id, err := Detect(ctx, audience)
+	if errors.Is(err, ErrNoIdentity) {
+		return nil, fmt.Errorf("no identity to sign with, set %s to an OIDC token or run in GitHub Actions, GitLab CI or Buildkite", TokenEnv)
+	}
+	return id, err
+}
+
+// ParseClaims returns the claims of a JWT without verifying it. The token is verified by the certificate authority it is exchanged with.
+func ParseClaims(token string) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("invalid OIDC token")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("invalid OIDC token: %v", err)
+	}
+
+	claims := make(map[string]interface{})
+	err = json.Unmarshal(payload, &claims)
+	if err != nil {
+		return nil, fmt.Errorf("invalid OIDC token: %v", err)
+	}
+	return claims, nil
+}
+
+// runnerClaims drops the claims that only matter to validate the token itself
+func runnerClaims(claims map[string]interface{}) map[string]interface{} {
+	filtered := make(map[string]interface{}, len(claims))
+	for k, v := range claims {
+		switch k {
+		case "aud", "exp", "iat", "nbf", "jti":
+			continue
+		}
+		filtered[k] = v
+	}
+	return filtered
+}
+
+func claimString(claims map[string]interface{}, key string) string {
+	s, _ := claims[key].(string)
+	return s
+}
+
+func env(key string) string {
+	return os.Getenv(key)
+}
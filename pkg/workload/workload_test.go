@@ -0,0 +1,113 @@
+package workload
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func testToken(t *testing.T, claims map[string]interface{}) string {
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return "e30." + base64.RawURLEncoding.EncodeToString(payload) + ".c2ln"
+}
+
+func TestDetectGitHub(t *testing.T) {
+	token := testToken(t, map[string]interface{}{
+		"iss":              "https://token.actions.githubusercontent.com",
+		"sub":              "repo:buildsafedev/bsf:ref:refs/tags/v1.0.0",
+		"aud":              "sigstore",
+		"repository":       "buildsafedev/bsf",
+		"job_workflow_ref": "buildsafedev/bsf/.github/workflows/release.yml@refs/tags/v1.0.0",
+		"run_id":           "42",
+		"run_attempt":      "1",
+	})
+
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("audience") != "sigstore" || r.Header.Get("Authorization") != "Bearer request-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		requests++
+		_ = json.NewEncoder(w).Encode(map[string]string{"value": token})
+	}))
+	defer srv.Close()
+
+	t.Setenv("ACTIONS_ID_TOKEN_REQUEST_URL", srv.URL+"/token")
+	t.Setenv("ACTIONS_ID_TOKEN_REQUEST_TOKEN", "request-token")
+
+	id, err := Detect(context.Background(), "sigstore")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if id.Provider != "github" || id.Subject != "repo:buildsafedev/bsf:ref:refs/tags/v1.0.0" {
+		t.Errorf("Detect() = %+v", id)
+	}
+	if id.BuilderID != "https://github.com/buildsafedev/bsf/.github/workflows/release.yml@refs/tags/v1.0.0" {
+		t.Errorf("BuilderID = %v", id.BuilderID)
+	}
+	if id.InvocationID != "https://github.com/buildsafedev/bsf/actions/runs/42/attempts/1" {
+		t.Errorf("InvocationID = %v", id.InvocationID)
+	}
+	if _, ok := id.Claims["aud"]; ok {
+		t.Errorf("token validation claims should not be recorded")
+	}
+
+	id.Token = ""
+	if err := id.Refresh(context.Background(), "sigstore"); err != nil {
+		t.Fatal(err)
+	}
+	if id.Token != token || requests != 2 {
+		t.Errorf("Refresh() requested %d tokens, token = %q", requests, id.Token)
+	}
+}
+
+func TestDetectNoIdentity(t *testing.T) {
+	for _, k := range []string{"ACTIONS_ID_TOKEN_REQUEST_URL", "GITLAB_CI", "BUILDKITE"} {
+		t.Setenv(k, "")
+	}
+
+	_, err := Detect(context.Background(), "sigstore")
+	if err != ErrNoIdentity {
+		t.Errorf("Detect() error = %v, want ErrNoIdentity", err)
+	}
+}
+
+func TestSigningToken(t *testing.T) {
+	token := testToken(t, map[string]interface{}{
+		"iss":   "https://oauth2.sigstore.dev/auth",
+		"sub":   "CgYxMjM0NTYSJmh0dHBzOi8vZ2l0aHViLmNvbS9sb2dpbi9vYXV0aA",
+		"aud":   "sigstore",
+		"email": "dev@example.com",
+	})
+	t.Setenv(TokenEnv, token)
+
+	id, err := Signing(context.Background(), "sigstore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id.Provider != "token" || id.Subject != "dev@example.com" || id.Token != token {
+		t.Errorf("Signing() = %+v, want the email identity of the token", id)
+	}
+	if id.BuilderID != "" {
+		t.Errorf("a token obtained out of band identifies no builder, got %q", id.BuilderID)
+	}
+}
+
+func TestSigningNoIdentity(t *testing.T) {
+	for _, k := range []string{TokenEnv, "ACTIONS_ID_TOKEN_REQUEST_URL", "GITLAB_CI", "BUILDKITE"} {
+		t.Setenv(k, "")
+	}
+
+	_, err := Signing(context.Background(), "sigstore")
+	if err == nil {
+		t.Error("Signing() without a token nor CI should fail")
+	}
+}
@@ -0,0 +1,44 @@
+package workspace
+
+import (
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// skippedDirs are not searched for projects, they hold build outputs or dependencies
+var skippedDirs = map[string]bool{
+	"bsf": true, "bsf-result": true, "node_modules": true, "vendor": true, "target": true,
+}
+
+// FindProjects returns the bsf projects in the subdirectories of dir, relative to it and sorted. Projects are not
+// searched for nested projects, hidden directories and the outputs of builds are skipped.
+func FindProjects(dir string) ([]string, error) {
+	projects := make([]string, 0)
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() || path == dir {
+			return nil
+		}
+		if strings.HasPrefix(d.Name(), ".") || skippedDirs[d.Name()] {
+			return filepath.SkipDir
+		}
+		if !IsRoot(path) {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		projects = append(projects, rel)
+		return filepath.SkipDir
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(projects)
+	return projects, nil
+}
@@ -0,0 +1,141 @@
+// Package workspace finds the root of the bsf project a command runs in, so bsf can be run from any of its
+// subdirectories. Commands work from the root, paths given by the user are resolved against the directory
+// bsf was invoked from.
+package workspace
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/pflag"
+)
+
+// PathAnnotation marks the flags whose values are paths, they are resolved against the invocation directory
+const PathAnnotation = "bsf_path"
+
+// ErrNotFound is returned when no directory above the start directory is a bsf project
+var ErrNotFound = errors.New("not in a bsf project (or any of its parent directories), run bsf init or pass --chdir")
+
+// markers are the files that make a directory the root of a bsf project
+var markers = []string{"bsf.hcl", filepath.Join("bsf", "flake.nix")}
+
+var (
+	invocation string
+	root       string
+)
+
+// FindRoot returns the closest directory from start upwards containing bsf.hcl or bsf/flake.nix
+func FindRoot(start string) (string, error) {
+	dir, err := filepath.Abs(start)
+	if err != nil {
+		return "", err
+	}
+	for {
+		if IsRoot(dir) {
+			return dir, nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", ErrNotFound
+		}
+		dir = parent
+	}
+}
+
+// IsRoot reports if dir is the root of a bsf project
+func IsRoot(dir string) bool {
+	for _, m := range markers {
+		if _, err := os.Stat(filepath.Join(dir, m)); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// Enter changes the working directory to the root of the project. The search starts from dir when it is set,
+// or the working directory otherwise. When no project is found, the working directory is dir, or left as is.
+// Like git -C, paths given by the user are then relative to dir.
+func Enter(dir string) (string, error) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+	invocation = cwd
+
+	start := cwd
+	if dir != "" {
+		start = dir
+		if !filepath.IsAbs(start) {
+			start = filepath.Join(cwd, start)
+		}
+		if fi, err := os.Stat(start); err != nil {
+			return "", err
+		} else if !fi.IsDir() {
+			return "", errors.New(dir + " is not a directory")
+		}
+		invocation = start
+	}
+
+	root, err = FindRoot(start)
+	if errors.Is(err, ErrNotFound) {
+		root = start
+	} else if err != nil {
+		return "", err
+	}
+	if root == cwd {
+		return root, nil
+	}
+	return root, os.Chdir(root)
+}
+
+// Root returns the root of the project, or the working directory when Enter wasn't called
+func Root() string {
+	if root != "" {
+		return root
+	}
+	cwd, _ := os.Getwd()
+	return cwd
+}
+
+// Resolve resolves a path given relative to the invocation directory. Paths inside the project are returned
+// relative to its root, so they can still be used in .gitignore and in nix expressions.
+func Resolve(path string) string {
+	if path == "" || filepath.IsAbs(path) || invocation == "" || invocation == Root() {
+		return path
+	}
+	abs := filepath.Join(invocation, path)
+	rel, err := filepath.Rel(Root(), abs)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return abs
+	}
+	return rel
+}
+
+// MarkPaths annotates the flags whose values are paths
+func MarkPaths(fs *pflag.FlagSet, names ...string) {
+	for _, name := range names {
+		fs.SetAnnotation(name, PathAnnotation, []string{"true"})
+	}
+}
+
+// ResolveFlags resolves the values of the path flags that were set against the invocation directory
+func ResolveFlags(fs *pflag.FlagSet) error {
+	var err error
+	fs.Visit(func(f *pflag.Flag) {
+		if _, ok := f.Annotations[PathAnnotation]; !ok || err != nil {
+			return
+		}
+		if sv, ok := f.Value.(pflag.SliceValue); ok {
+			values := sv.GetSlice()
+			for i := range values {
+				values[i] = Resolve(values[i])
+			}
+			err = sv.Replace(values)
+			return
+		}
+		err = f.Value.Set(Resolve(f.Value.String()))
+	})
+	return err
+}
@@ -0,0 +1,114 @@
+package workspace
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/spf13/pflag"
+)
+
+func TestEnter(t *testing.T) {
+	project, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub := filepath.Join(project, "src", "app")
+	if err := os.MkdirAll(sub, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(project, "bsf.hcl"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(cwd)
+	defer func() { invocation, root = "", "" }()
+
+	tests := []struct {
+		name    string
+		cwd     string
+		chdir   string
+		path    string
+		want    string
+		wantCwd string
+	}{
+		{name: "subdirectory", cwd: sub, path: "out", want: filepath.Join("src", "app", "out"), wantCwd: project},
+		{name: "root", cwd: project, path: "bsf-result", want: "bsf-result", wantCwd: project},
+		{name: "outside the project", cwd: sub, path: "../../../out", want: filepath.Join(filepath.Dir(project), "out"), wantCwd: project},
+		{name: "chdir", cwd: cwd, chdir: sub, path: "out", want: filepath.Join("src", "app", "out"), wantCwd: project},
+		{name: "absolute", cwd: sub, path: "/tmp/out", want: "/tmp/out", wantCwd: project},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := os.Chdir(tt.cwd); err != nil {
+				t.Fatal(err)
+			}
+			got, err := Enter(tt.chdir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != project {
+				t.Errorf("Enter() = %s, want %s", got, project)
+			}
+			if dir, _ := os.Getwd(); dir != tt.wantCwd {
+				t.Errorf("working directory is %s, want %s", dir, tt.wantCwd)
+			}
+
+			fs := pflag.NewFlagSet("test", pflag.ContinueOnError)
+			var output string
+			fs.StringVarP(&output, "output", "o", "", "")
+			MarkPaths(fs, "output")
+			if err := fs.Parse([]string{"-o", tt.path}); err != nil {
+				t.Fatal(err)
+			}
+			if err := ResolveFlags(fs); err != nil {
+				t.Fatal(err)
+			}
+			if output != tt.want {
+				t.Errorf("output = %s, want %s", output, tt.want)
+			}
+		})
+	}
+}
+
+func TestFindRootNotFound(t *testing.T) {
+	if _, err := FindRoot(t.TempDir()); err != ErrNotFound {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestFindProjects(t *testing.T) {
+	dir := t.TempDir()
+	for _, f := range []string{
+		"services/api/bsf.hcl",
+		"services/api/tools/bsf.hcl",
+		"services/worker/bsf/flake.nix",
+		"cli/bsf.hcl",
+		"docs/index.md",
+		".git/bsf.hcl",
+		"web/node_modules/pkg/bsf.hcl",
+	} {
+		path := filepath.Join(dir, f)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := FindProjects(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"cli", filepath.Join("services", "api"), filepath.Join("services", "worker")}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("FindProjects() = %v, want %v", got, want)
+	}
+}